@@ -6,6 +6,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"strconv"
@@ -26,6 +27,7 @@ import (
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/client"
 
 	blocksAPI "github.com/thanos-io/thanos/pkg/api/blocks"
@@ -104,7 +106,11 @@ type compactMetrics struct {
 	blocksCleaned               prometheus.Counter
 	blockCleanupFailures        prometheus.Counter
 	blocksMarked                *prometheus.CounterVec
+	blocksRelocated             prometheus.Counter
 	garbageCollectedBlocks      prometheus.Counter
+	operationBudgetExhausted    *prometheus.CounterVec
+	loopDuration                *prometheus.HistogramVec
+	loopLastSuccess             *prometheus.GaugeVec
 }
 
 func newCompactMetrics(reg *prometheus.Registry, deleteDelay time.Duration) *compactMetrics {
@@ -152,12 +158,32 @@ func newCompactMetrics(reg *prometheus.Registry, deleteDelay time.Duration) *com
 	}, []string{"marker", "reason"})
 	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.OutOfOrderChunksNoCompactReason)
 	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.IndexSizeExceedingNoCompactReason)
+	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.OutputVerificationFailedNoCompactReason)
 	m.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")
+	m.blocksMarked.WithLabelValues(metadata.TombstoneFilename, "")
+
+	m.blocksRelocated = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_blocks_relocated_total",
+		Help: "Total number of blocks copied to the cold bucket and marked for deletion in compactor.",
+	})
 
 	m.garbageCollectedBlocks = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_compact_garbage_collected_blocks_total",
 		Help: "Total number of blocks marked for deletion by compactor.",
 	})
+	m.operationBudgetExhausted = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_operation_budget_exhausted_total",
+		Help: "Total number of compactor iterations cut short because their object storage operation budget of the given operation was exhausted.",
+	}, []string{"operation"})
+	m.loopDuration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "thanos_compact_loop_duration_seconds",
+		Help:    "Time it took to run an iteration of the retention or garbage collection loops scheduled independently from compaction.",
+		Buckets: []float64{0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120, 240, 360, 720},
+	}, []string{"loop"})
+	m.loopLastSuccess = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_compact_loop_last_success_timestamp_seconds",
+		Help: "Timestamp of the last successful iteration of the retention or garbage collection loops scheduled independently from compaction.",
+	}, []string{"loop"})
 	return m
 }
 
@@ -202,11 +228,47 @@ func runCompact(
 		return err
 	}
 
-	bkt, err := client.NewBucket(logger, confContentYaml, reg, component.String())
+	coldConfContentYaml, err := conf.coldObjStore.Content()
+	if err != nil {
+		return err
+	}
+	if conf.tieringMinBlockAge > 0 && len(coldConfContentYaml) == 0 {
+		return errors.New("--tiering.min-block-age requires the cold bucket configuration --objstore-cold.config or --objstore-cold.config-file")
+	}
+
+	bktReg := prometheus.Registerer(reg)
+	if conf.tieringMinBlockAge > 0 {
+		// The bucket metrics of both tiers have a tier label.
+		bktReg = extprom.WrapRegistererWith(prometheus.Labels{"tier": ""}, reg)
+	}
+	bkt, err := client.NewBucket(logger, confContentYaml, bktReg, component.String())
 	if err != nil {
 		return err
 	}
 
+	var operationBudget *compact.OperationBudget
+	if len(conf.operationBudget) > 0 {
+		limits, err := compact.ParseOperationBudgetLimits(conf.operationBudget)
+		if err != nil {
+			return errors.Wrap(err, "parse operation budget")
+		}
+		operationBudget = compact.NewOperationBudget(limits)
+		bkt = operationBudget.Bucket(bkt)
+	}
+
+	var coldBkt objstore.InstrumentedBucket
+	if conf.tieringMinBlockAge > 0 {
+		coldBkt, err = client.NewBucket(logger, coldConfContentYaml, extprom.WrapRegistererWith(prometheus.Labels{"tier": metadata.ColdTier}, reg), component.String())
+		if err != nil {
+			return errors.Wrap(err, "create cold bucket")
+		}
+		if conf.tieringDryRun {
+			level.Info(logger).Log("msg", "tiering dry run is enabled; blocks to relocate to the cold bucket are only logged", "minBlockAge", conf.tieringMinBlockAge)
+		}
+	}
+
+	deletionMode, objectLock := resolveDeletionMode(logger, confContentYaml, block.DeletionMode(conf.deletionMode))
+
 	relabelContentYaml, err := conf.selectorRelabelConf.Content()
 	if err != nil {
 		return errors.Wrap(err, "get content of relabel configuration")
@@ -217,6 +279,17 @@ func runCompact(
 		return err
 	}
 
+	var downsamplePolicies *downsample.Policies
+	downsamplePoliciesYaml, err := conf.downsamplePoliciesConf.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of downsampling policies configuration")
+	}
+	if len(downsamplePoliciesYaml) > 0 {
+		if downsamplePolicies, err = downsample.ParsePolicies(downsamplePoliciesYaml); err != nil {
+			return err
+		}
+	}
+
 	// Ensure we close up everything properly.
 	defer func() {
 		if err != nil {
@@ -228,6 +301,10 @@ func runCompact(
 	// The delay of deleteDelay/2 is added to ensure we fetch blocks that are meant to be deleted but do not have a replacement yet.
 	// This is to make sure compactor will not accidentally perform compactions with gap instead.
 	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, deleteDelay/2, conf.blockMetaFetchConcurrency)
+	deletionMarkOpts := []block.DeletionMarkOption{
+		block.WithDeletionSource(component.String()),
+		block.WithDeletionAudit(conf.deletionAudit),
+	}
 	duplicateBlocksFilter := block.NewDeduplicateFilter(conf.blockMetaFetchConcurrency)
 	noCompactMarkerFilter := compact.NewGatherNoCompactionMarkFilter(logger, bkt, conf.blockMetaFetchConcurrency)
 	labelShardedMetaFilter := block.NewLabelShardedMetaFilter(relabelConfig)
@@ -239,6 +316,9 @@ func runCompact(
 		return errors.Wrap(err, "create meta fetcher")
 	}
 
+	if err := validateGroupKeyIgnoreLabels(conf.groupKeyIgnoreLabels, conf.dedupReplicaLabels); err != nil {
+		return err
+	}
 	enableVerticalCompaction := conf.enableVerticalCompaction
 	if len(conf.dedupReplicaLabels) > 0 {
 		enableVerticalCompaction = true
@@ -246,24 +326,35 @@ func runCompact(
 			"msg", "deduplication.replica-label specified, enabling vertical compaction", "dedupReplicaLabels", strings.Join(conf.dedupReplicaLabels, ","),
 		)
 	}
+	if len(conf.groupKeyIgnoreLabels) > 0 {
+		enableVerticalCompaction = true
+		level.Info(logger).Log(
+			"msg", "compact.group-key-ignore-label specified, enabling vertical compaction", "groupKeyIgnoreLabels", strings.Join(conf.groupKeyIgnoreLabels, ","),
+		)
+	}
 	if enableVerticalCompaction {
 		level.Info(logger).Log(
 			"msg", "vertical compaction is enabled", "compact.enable-vertical-compaction", fmt.Sprintf("%v", conf.enableVerticalCompaction),
 		)
 	}
 	var (
-		api = blocksAPI.NewBlocksAPI(logger, conf.webConf.disableCORS, conf.label, flagsMap, bkt)
-		sy  *compact.Syncer
+		api         = blocksAPI.NewBlocksAPI(logger, conf.webConf.disableCORS, conf.label, flagsMap, bkt, conf.webConf.readWrite)
+		sy          *compact.Syncer
+		blocksInUse = compact.NewBlocksInUse()
 	)
+	api.SetObjectLock(objectLock)
+	api.SetDeletionMode(deletionMode)
 	{
 		// Make sure all compactor meta syncs are done through Syncer.SyncMeta for readability.
 		cf := baseMetaFetcher.NewMetaFetcher(
 			extprom.WrapRegistererWithPrefix("thanos_", reg), []block.MetadataFilter{
+				compact.NewMetaVersionFilter(logger, conf.skipNewerMetaVersions),
 				timePartitionMetaFilter,
 				labelShardedMetaFilter,
 				consistencyDelayMetaFilter,
 				ignoreDeletionMarkFilter,
 				block.NewReplicaLabelRemover(logger, conf.dedupReplicaLabels),
+				block.NewGroupKeyLabelRemover(logger, conf.groupKeyIgnoreLabels),
 				duplicateBlocksFilter,
 				noCompactMarkerFilter,
 			},
@@ -280,10 +371,13 @@ func runCompact(
 			ignoreDeletionMarkFilter,
 			compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, ""),
 			compactMetrics.garbageCollectedBlocks,
+			deletionMarkOpts...,
 		)
 		if err != nil {
 			return errors.Wrap(err, "create syncer")
 		}
+		// Retention and garbage collection running on their own schedule skip the blocks being compacted.
+		sy.WithBlocksInUse(blocksInUse)
 	}
 
 	levels, err := compactions.levels(conf.maxCompactionLevel)
@@ -351,15 +445,78 @@ func runCompact(
 		metadata.HashFunc(conf.hashFunc),
 		conf.blockFilesConcurrency,
 		conf.compactBlocksFetchConcurrency,
+		deletionMarkOpts...,
 	)
+	if conf.verifyOutput {
+		if conf.verifyOutputTolerance < 0 || conf.verifyOutputTolerance > 1 {
+			return errors.Errorf("output verification tolerance must be between 0 and 1, got %v", conf.verifyOutputTolerance)
+		}
+		grouper.WithOutputVerification(compact.OutputVerification{
+			Enabled:   true,
+			Tolerance: conf.verifyOutputTolerance,
+		}, compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.OutputVerificationFailedNoCompactReason))
+	}
+	if conf.writeLabelIndex {
+		grouper.WithLabelIndex()
+	}
 	tsdbPlanner := compact.NewPlanner(logger, levels, noCompactMarkerFilter)
-	planner := compact.WithLargeTotalIndexSizeFilter(
-		tsdbPlanner,
+	var planner compact.Planner
+	if conf.splitBlocks {
+		// Blocks exceeding the limits are split instead, so nothing has to be excluded from compaction.
+		grouper.WithBlockSplitLimits(compact.BlockSplitLimits{
+			MaxIndexSizeBytes: int64(conf.maxBlockIndexSize),
+			MaxSeries:         conf.maxBlockSeries,
+		})
+		planner = tsdbPlanner
+	} else {
+		planner = compact.WithLargeTotalIndexSizeFilter(
+			tsdbPlanner,
+			bkt,
+			int64(conf.maxBlockIndexSize),
+			compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.IndexSizeExceedingNoCompactReason),
+		)
+	}
+	blocksCleaner := compact.NewBlocksCleaner(
+		logger,
 		bkt,
-		int64(conf.maxBlockIndexSize),
-		compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.IndexSizeExceedingNoCompactReason),
+		ignoreDeletionMarkFilter,
+		deleteDelay,
+		deletionMode,
+		compactMetrics.blocksCleaned,
+		compactMetrics.blocksMarked.WithLabelValues(metadata.TombstoneFilename, ""),
+		compactMetrics.blockCleanupFailures,
 	)
-	blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, deleteDelay, compactMetrics.blocksCleaned, compactMetrics.blockCleanupFailures)
+
+	// Retention applies to the blocks relocated to the cold bucket as well, which are then deleted like the ones of
+	// the bucket.
+	var (
+		coldMetaFetcher   *block.MetaFetcher
+		coldBlocksCleaner *compact.BlocksCleaner
+	)
+	if coldBkt != nil {
+		coldDeletionMode, _ := resolveDeletionMode(logger, coldConfContentYaml, block.DeletionMode(conf.deletionMode))
+		coldIgnoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, coldBkt, deleteDelay/2, conf.blockMetaFetchConcurrency)
+		coldMetaFetcher, err = block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, coldBkt, "", extprom.WrapRegistererWithPrefix("thanos_cold_", reg), []block.MetadataFilter{
+			block.NewTierMetaFilter(metadata.ColdTier),
+			block.NewLabelShardedMetaFilter(relabelConfig),
+			block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
+			coldIgnoreDeletionMarkFilter,
+		})
+		if err != nil {
+			return errors.Wrap(err, "create cold meta fetcher")
+		}
+		coldBlocksCleaner = compact.NewBlocksCleaner(
+			log.With(logger, "tier", metadata.ColdTier),
+			coldBkt,
+			coldIgnoreDeletionMarkFilter,
+			deleteDelay,
+			coldDeletionMode,
+			compactMetrics.blocksCleaned,
+			compactMetrics.blocksMarked.WithLabelValues(metadata.TombstoneFilename, ""),
+			compactMetrics.blockCleanupFailures,
+		)
+	}
+
 	compactor, err := compact.NewBucketCompactor(
 		logger,
 		sy,
@@ -374,6 +531,14 @@ func runCompact(
 	if err != nil {
 		return errors.Wrap(err, "create bucket compactor")
 	}
+	if conf.healthReport {
+		var interval time.Duration
+		if conf.wait {
+			interval = conf.waitInterval
+		}
+		compactor.WithHealthReporter(compact.NewHealthReporter(logger, bkt, interval))
+	}
+	compactor.WithOperationBudget(operationBudget)
 
 	retentionByResolution := map[compact.ResolutionLevel]time.Duration{
 		compact.ResolutionLevelRaw: time.Duration(conf.retentionRaw),
@@ -410,19 +575,87 @@ func runCompact(
 			return errors.Wrap(err, "syncing metas")
 		}
 
-		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, sy.Partial(), bkt, compactMetrics.partialUploadDeleteAttempts, compactMetrics.blocksCleaned, compactMetrics.blockCleanupFailures)
+		compact.BestEffortCleanAbortedPartialUploads(
+			ctx,
+			logger,
+			sy.Partial(),
+			bkt,
+			deletionMode,
+			compactMetrics.partialUploadDeleteAttempts,
+			compactMetrics.blocksCleaned,
+			compactMetrics.blocksMarked.WithLabelValues(metadata.TombstoneFilename, ""),
+			compactMetrics.blockCleanupFailures,
+			deletionMarkOpts...,
+		)
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "cleaning marked blocks")
 		}
+		if coldBlocksCleaner != nil {
+			if err := coldBlocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
+				return errors.Wrap(err, "cleaning marked blocks of cold bucket")
+			}
+		}
 		compactMetrics.cleanups.Inc()
 
 		return nil
 	}
 
+	var retentionMtx sync.Mutex
+	applyRetention := func() error {
+		retentionMtx.Lock()
+		defer retentionMtx.Unlock()
+
+		if err := sy.SyncMetas(ctx); err != nil {
+			return errors.Wrap(err, "sync before retention")
+		}
+
+		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, blocksInUse.NotInUse(sy.Metas()), retentionByResolution, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, ""), deletionMarkOpts...); err != nil {
+			return errors.Wrap(err, "retention failed")
+		}
+
+		if coldMetaFetcher != nil {
+			coldMetas, _, err := coldMetaFetcher.Fetch(ctx)
+			if err != nil {
+				return errors.Wrap(err, "sync cold bucket before retention")
+			}
+			if err := compact.ApplyRetentionPolicyByResolution(ctx, log.With(logger, "tier", metadata.ColdTier), coldBkt, coldMetas, retentionByResolution, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, ""), deletionMarkOpts...); err != nil {
+				return errors.Wrap(err, "retention of cold bucket failed")
+			}
+		}
+		return nil
+	}
+	independentRetention := conf.wait && conf.retentionInterval > 0
+
+	relocateToColdTier := func() error {
+		if err := sy.SyncMetas(ctx); err != nil {
+			return errors.Wrap(err, "sync before relocation to cold tier")
+		}
+		if err := compact.RelocateToColdTier(ctx, logger, bkt, coldBkt, blocksInUse.NotInUse(sy.Metas()), ignoreDeletionMarkFilter.DeletionMarkBlocks(), time.Duration(conf.tieringMinBlockAge), conf.tieringDryRun, compactMetrics.blocksRelocated, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, ""), deletionMarkOpts...); err != nil {
+			return errors.Wrap(err, "relocation to cold tier failed")
+		}
+		return nil
+	}
+
+	// budgetExhausted tells whether the rest of the iteration is skipped because its object storage operation budget is
+	// exhausted. The iteration still succeeds, so that the next one resumes the work.
+	budgetExhausted := func() bool {
+		op, ok := operationBudget.Exhausted()
+		if !ok {
+			return false
+		}
+		level.Warn(logger).Log("msg", "object storage operation budget of the iteration exhausted, skipping the rest of the iteration", "operation", op, "used", operationBudget.Used(op), "limit", operationBudget.Limit(op))
+		compactMetrics.operationBudgetExhausted.WithLabelValues(op).Inc()
+		return true
+	}
+
 	compactMainFn := func() error {
+		operationBudget.Reset()
 		if err := compactor.Compact(ctx); err != nil {
 			return errors.Wrap(err, "compaction")
 		}
+		if budgetExhausted() {
+			return nil
+		}
 
 		if !conf.disableDownsampling {
 			// After all compactions are done, work down the downsampling backlog.
@@ -438,7 +671,7 @@ func runCompact(
 				downsampleMetrics.downsamples.WithLabelValues(groupKey)
 				downsampleMetrics.downsampleFailures.WithLabelValues(groupKey)
 			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, metadata.HashFunc(conf.hashFunc)); err != nil {
+			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, metadata.HashFunc(conf.hashFunc), downsamplePolicies, blocksInUse); err != nil {
 				return errors.Wrap(err, "first pass of downsampling failed")
 			}
 
@@ -446,21 +679,28 @@ func runCompact(
 			if err := sy.SyncMetas(ctx); err != nil {
 				return errors.Wrap(err, "sync before second pass of downsampling")
 			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, metadata.HashFunc(conf.hashFunc)); err != nil {
+			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, metadata.HashFunc(conf.hashFunc), downsamplePolicies, blocksInUse); err != nil {
 				return errors.Wrap(err, "second pass of downsampling failed")
 			}
 			level.Info(logger).Log("msg", "downsampling iterations done")
 		} else {
 			level.Info(logger).Log("msg", "downsampling was explicitly disabled")
 		}
+		if budgetExhausted() {
+			return nil
+		}
 
 		// TODO(bwplotka): Find a way to avoid syncing if no op was done.
-		if err := sy.SyncMetas(ctx); err != nil {
-			return errors.Wrap(err, "sync before retention")
+		if !independentRetention {
+			if err := applyRetention(); err != nil {
+				return err
+			}
 		}
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, sy.Metas(), retentionByResolution, compactMetrics.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")); err != nil {
-			return errors.Wrap(err, "retention failed")
+		if coldBkt != nil {
+			if err := relocateToColdTier(); err != nil {
+				return err
+			}
 		}
 
 		return cleanPartialMarked()
@@ -468,6 +708,9 @@ func runCompact(
 
 	g.Add(func() error {
 		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+		if coldBkt != nil {
+			defer runutil.CloseWithLogOnErr(logger, coldBkt, "cold bucket client")
+		}
 
 		if !conf.wait {
 			return compactMainFn()
@@ -525,9 +768,14 @@ func runCompact(
 
 		// Separate fetcher for global view.
 		// TODO(bwplotka): Allow Bucket UI to visualize the state of the block as well.
-		f := baseMetaFetcher.NewMetaFetcher(extprom.WrapRegistererWithPrefix("thanos_bucket_ui", reg), nil, "component", "globalBucketUI")
+		// Deletion marks are only tracked, the blocks marked for deletion are still shown.
+		uiDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(math.MaxInt64), conf.blockMetaFetchConcurrency)
+		uiNoCompactMarkFilter := compact.NewGatherNoCompactionMarkFilter(logger, bkt, conf.blockMetaFetchConcurrency)
+		f := baseMetaFetcher.NewMetaFetcher(extprom.WrapRegistererWithPrefix("thanos_bucket_ui", reg), []block.MetadataFilter{uiDeletionMarkFilter, uiNoCompactMarkFilter}, "component", "globalBucketUI")
 		f.UpdateOnChange(func(blocks []metadata.Meta, err error) {
 			api.SetGlobal(blocks, err)
+			api.SetGlobalDeletionMarks(uiDeletionMarkFilter.DeletionMarkBlocks())
+			api.SetGlobalNoCompactMarks(uiNoCompactMarkFilter.NoCompactMarkedBlocks())
 		})
 
 		srv.Handle("/", r)
@@ -542,6 +790,37 @@ func runCompact(
 			})
 		}
 
+		// Periodically apply retention and garbage collect blocks independently from compaction, which can be behind.
+		runLoop := func(name string, interval time.Duration, f func() error) {
+			g.Add(func() error {
+				return runutil.Repeat(interval, ctx.Done(), func() error {
+					begin := time.Now()
+					err := f()
+					compactMetrics.loopDuration.WithLabelValues(name).Observe(time.Since(begin).Seconds())
+					if err != nil {
+						// Compaction does not depend on these loops, so try again at the next interval.
+						level.Error(logger).Log("msg", "loop iteration failed", "loop", name, "err", err)
+						return nil
+					}
+					compactMetrics.loopLastSuccess.WithLabelValues(name).SetToCurrentTime()
+					return nil
+				})
+			}, func(error) {
+				cancel()
+			})
+		}
+		if independentRetention {
+			runLoop("retention", conf.retentionInterval, applyRetention)
+		}
+		if conf.gcInterval > 0 {
+			runLoop("gc", conf.gcInterval, func() error {
+				if err := sy.SyncMetas(ctx); err != nil {
+					return errors.Wrap(err, "sync before garbage collection")
+				}
+				return errors.Wrap(sy.GarbageCollect(ctx), "garbage collection")
+			})
+		}
+
 		// Periodically calculate the progress of compaction, downsampling and retention.
 		if conf.progressCalculateInterval > 0 {
 			g.Add(func() error {
@@ -549,7 +828,7 @@ func runCompact(
 				rs := compact.NewRetentionProgressCalculator(reg, retentionByResolution)
 				var ds *compact.DownsampleProgressCalculator
 				if !conf.disableDownsampling {
-					ds = compact.NewDownsampleProgressCalculator(reg)
+					ds = compact.NewDownsampleProgressCalculator(reg, downsamplePolicies)
 				}
 
 				return runutil.Repeat(conf.progressCalculateInterval, ctx.Done(), func() error {
@@ -626,8 +905,13 @@ type compactConfig struct {
 	http                                           httpConfig
 	dataDir                                        string
 	objStore                                       extflag.PathOrContent
+	coldObjStore                                   extflag.PathOrContent
+	tieringMinBlockAge                             model.Duration
+	tieringDryRun                                  bool
 	consistencyDelay                               time.Duration
 	retentionRaw, retentionFiveMin, retentionOneHr model.Duration
+	retentionInterval                              time.Duration
+	gcInterval                                     time.Duration
 	wait                                           bool
 	waitInterval                                   time.Duration
 	disableDownsampling                            bool
@@ -640,19 +924,66 @@ type compactConfig struct {
 	downsampleConcurrency                          int
 	compactBlocksFetchConcurrency                  int
 	deleteDelay                                    model.Duration
+	deletionAudit                                  bool
+	deletionMode                                   string
 	dedupReplicaLabels                             []string
+	groupKeyIgnoreLabels                           []string
 	selectorRelabelConf                            extflag.PathOrContent
+	downsamplePoliciesConf                         *extflag.PathOrContent
 	webConf                                        webConfig
 	label                                          string
 	maxBlockIndexSize                              units.Base2Bytes
+	maxBlockSeries                                 uint64
+	splitBlocks                                    bool
+	verifyOutput                                   bool
+	writeLabelIndex                                bool
+	skipNewerMetaVersions                          bool
+	verifyOutputTolerance                          float64
 	hashFunc                                       string
 	enableVerticalCompaction                       bool
 	dedupFunc                                      string
 	skipBlockWithOutOfOrderChunks                  bool
 	progressCalculateInterval                      time.Duration
+	healthReport                                   bool
+	operationBudget                                map[string]string
 	filterConf                                     *store.FilterConfig
 }
 
+// validateGroupKeyIgnoreLabels checks the external labels ignored when grouping blocks for compaction. Replica labels
+// are already removed from the blocks, so they can't be ignored as well.
+func validateGroupKeyIgnoreLabels(ignoreLabels, replicaLabels []string) error {
+	for _, l := range ignoreLabels {
+		if l == "" {
+			return errors.New("group key label to ignore must not be empty")
+		}
+		for _, r := range replicaLabels {
+			if l == r {
+				return errors.Errorf("label %s is both a group key label to ignore and a deduplication replica label", l)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveDeletionMode detects the object lock configuration of the bucket and returns the deletion mode to use with it.
+// Object lock is assumed to be disabled if it cannot be detected.
+func resolveDeletionMode(logger log.Logger, confContentYaml []byte, mode block.DeletionMode) (block.DeletionMode, block.ObjectLock) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	objectLock, err := block.DetectObjectLock(ctx, logger, confContentYaml)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to detect object lock configuration of bucket; assuming object lock is disabled", "err", err)
+	}
+	resolved := mode.Resolve(objectLock)
+	if resolved == block.MarkOnlyDeletionMode {
+		level.Info(logger).Log("msg", "blocks will be kept in bucket with a tombstone instead of being deleted; their expiry is left to the lifecycle rules of the bucket", "deletionMode", mode)
+	} else if objectLock.Enabled {
+		level.Warn(logger).Log("msg", "object lock is enabled on bucket, but blocks will be deleted; consider --delete.mode=mark-only", "deletionMode", mode)
+	}
+	return resolved, objectLock
+}
+
 func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("debug.halt-on-error", "Halt the process if a critical compaction error is detected.").
 		Hidden().Default("true").BoolVar(&cc.haltOnError)
@@ -668,6 +999,11 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("./data").StringVar(&cc.dataDir)
 
 	cc.objStore = *extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
+	cc.coldObjStore = *extkingpin.RegisterCommonObjStoreFlags(cmd, "-cold", false, "Blocks older than --tiering.min-block-age are relocated to it.")
+	cmd.Flag("tiering.min-block-age", "Age of the max time of blocks after which they are copied to the cold bucket and marked for deletion in the bucket, at the end of each iteration. Setting this to 0d disables the relocation of blocks.").
+		Default("0d").SetValue(&cc.tieringMinBlockAge)
+	cmd.Flag("tiering.dry-run", "Only log the blocks which would be relocated to the cold bucket.").
+		Default("false").BoolVar(&cc.tieringDryRun)
 
 	cmd.Flag("consistency-delay", fmt.Sprintf("Minimum age of fresh (non-compacted) blocks before they are being processed. Malformed blocks older than the maximum of consistency-delay and %v will be removed.", compact.PartialUploadThresholdAge)).
 		Default("30m").DurationVar(&cc.consistencyDelay)
@@ -679,6 +1015,10 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("0d").SetValue(&cc.retentionFiveMin)
 	cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").
 		Default("0d").SetValue(&cc.retentionOneHr)
+	cmd.Flag("retention.interval", "How often retention policies are applied in the background when --wait has been enabled, independently from compaction iterations. Blocks being compacted are skipped until their compaction is done. Setting it to \"0s\" disables it - retention will only be applied at the end of an iteration.").
+		Default("0s").DurationVar(&cc.retentionInterval)
+	cmd.Flag("gc.interval", "How often blocks replaced by compacted blocks are marked for deletion in the background when --wait has been enabled, in addition to the start of each compaction iteration. Blocks being compacted are skipped until their compaction is done. Setting it to \"0s\" disables it.").
+		Default("0s").DurationVar(&cc.gcInterval)
 
 	// TODO(kakkoyun, pgough): https://github.com/thanos-io/thanos/issues/2266.
 	cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
@@ -689,6 +1029,9 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("downsampling.disable", "Disables downsampling. This is not recommended "+
 		"as querying long time ranges without non-downsampled data is not efficient and useful e.g it is not possible to render all samples for a human eye anyway").
 		Default("false").BoolVar(&cc.disableDownsampling)
+	cc.downsamplePoliciesConf = extflag.RegisterPathOrContent(cmd, "downsampling.policies-config", "YAML file that contains the downsampling policies of the blocks selected by their external labels, e.g. of tenants: "+
+		"whether their downsampling to 5m and 1h resolution is disabled and the minimum age of raw blocks before they are downsampled. "+
+		"See format details: https://thanos.io/tip/components/compact.md/#downsampling-policies", extflag.WithEnvSubstitution())
 
 	cmd.Flag("block-meta-fetch-concurrency", "Number of goroutines to use when fetching block metadata from object storage.").
 		Default("32").IntVar(&cc.blockMetaFetchConcurrency)
@@ -702,6 +1045,13 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("5m").DurationVar(&cc.cleanupBlocksInterval)
 	cmd.Flag("compact.progress-interval", "Frequency of calculating the compaction progress in the background when --wait has been enabled. Setting it to \"0s\" disables it. Now compaction, downsampling and retention progress are supported.").
 		Default("5m").DurationVar(&cc.progressCalculateInterval)
+	cmd.Flag("compact.health-report", "If true, the compaction health of each compaction group is written to the bucket after each compaction iteration, "+
+		"under "+compact.HealthDir+"/. It can be inspected with the 'tools bucket health' command and in the bucket UI.").
+		Default("false").BoolVar(&cc.healthReport)
+	cmd.Flag("compact.operation-budget", "Maximum number of object storage operations of the given type per compactor iteration, as <operation>=<count> (repeated), "+
+		"where operation is one of iter, get, get_range, exists, attributes, upload and delete. Once a budget is exhausted, the groups being compacted are finished "+
+		"and the rest of the iteration is skipped until the next one. Reads of deletion marks are not counted.").
+		PlaceHolder("<operation>=<count>").StringMapVar(&cc.operationBudget)
 
 	cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
 		Default("1").IntVar(&cc.compactionConcurrency)
@@ -717,6 +1067,16 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"or compactor is ignoring the deletion because it's compacting the block at the same time.").
 		Default("48h").SetValue(&cc.deleteDelay)
 
+	cmd.Flag("delete.audit", "If true, compactor uploads an audit object to the markers/audit/ directory of the bucket for every block it marks for deletion or deletes directly. "+
+		"The audit object contains the same reason, source and compaction group which is recorded in the deletion mark and logged.").
+		Default("false").BoolVar(&cc.deletionAudit)
+
+	cmd.Flag("delete.mode", "How compactor removes blocks after delete-delay and aborted partial uploads. "+
+		"When set to delete, the blocks are deleted from the bucket. "+
+		"When set to mark-only, the blocks are kept in the bucket with a tombstone.json file, so that lifecycle rules of the bucket can expire them, e.g. for S3 buckets with object lock. "+
+		"When set to auto, mark-only is used for S3 buckets with object lock enabled and delete otherwise.").
+		Default(string(block.AutoDeletionMode)).EnumVar(&cc.deletionMode, string(block.AutoDeletionMode), string(block.DeleteDeletionMode), string(block.MarkOnlyDeletionMode))
+
 	cmd.Flag("compact.enable-vertical-compaction", "Experimental. When set to true, compactor will allow overlaps and perform **irreversible** vertical compaction. See https://thanos.io/tip/components/compact.md/#vertical-compactions to read more. "+
 		"Please note that by default this uses a NAIVE algorithm for merging. If you need a different deduplication algorithm (e.g one that works well with Prometheus replicas), please set it via --deduplication.func."+
 		"NOTE: This flag is ignored and (enabled) when --deduplication.replica-label flag is set.").
@@ -733,6 +1093,11 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"If you need a different deduplication algorithm (e.g one that works well with Prometheus replicas), please set it via --deduplication.func.").
 		StringsVar(&cc.dedupReplicaLabels)
 
+	cmd.Flag("compact.group-key-ignore-label", "External label to ignore when grouping blocks for compaction, besides the --deduplication.replica-label ones (repeated). "+
+		"Blocks only differing by these labels are vertically compacted together, and the compacted blocks don't have them anymore. This process is irreversible. "+
+		"Blocks left without external labels once these labels are removed make the compaction fail, as they would be compacted with the blocks of all sources.").
+		StringsVar(&cc.groupKeyIgnoreLabels)
+
 	// TODO(bwplotka): This is short term fix for https://github.com/thanos-io/thanos/issues/1424, replace with vertical block sharding https://github.com/thanos-io/thanos/pull/3390.
 	cmd.Flag("compact.block-max-index-size", "Maximum index size for the resulted block during any compaction. Note that"+
 		"total size is approximated in worst case. If the block that would be resulted from compaction is estimated to exceed this number, biggest source"+
@@ -740,6 +1105,32 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"Default is due to https://github.com/thanos-io/thanos/issues/1424, but it's overall recommended to keeps block size to some reasonable size.").
 		Hidden().Default("64GB").BytesVar(&cc.maxBlockIndexSize)
 
+	cmd.Flag("compact.split-blocks", "If true, a block that would be resulted from compaction and is estimated to exceed --compact.block-max-index-size "+
+		"or --compact.block-max-series is split into multiple blocks by series hash, instead of marking its biggest source block for no compaction. "+
+		"Split blocks record their shard in meta.json and are compacted separately from then on.").
+		Default("false").BoolVar(&cc.splitBlocks)
+
+	cmd.Flag("compact.block-max-series", "Maximum number of series for the resulted block during any compaction, estimated in the worst case. "+
+		"Only used with --compact.split-blocks. 0 means no limit.").
+		Default("0").Uint64Var(&cc.maxBlockSeries)
+
+	cmd.Flag("compact.verify-output", "If true, blocks resulted from compaction are verified against their source blocks before they are uploaded and the source blocks are deleted. "+
+		"Their samples and number of values per label name have to match the ones of the source blocks within --compact.verify-output.tolerance, and their chunks must not be empty or out of order. "+
+		"If the verification fails, the compacted blocks are not uploaded and the source blocks are marked for no compaction instead.").
+		Default("false").BoolVar(&cc.verifyOutput)
+
+	cmd.Flag("compact.verify-output.tolerance", "Ratio of the samples and of the values per label name of the source blocks that blocks resulted from compaction may miss. "+
+		"Samples of vertically compacted blocks are only checked to not exceed the ones of the source blocks, as deduplication removes samples. Only used with --compact.verify-output.").
+		Default("0").Float64Var(&cc.verifyOutputTolerance)
+
+	cmd.Flag("compact.label-index", "If true, the label index file of blocks resulted from compaction is written, holding the values of the label names of the block with their number of series, "+
+		"from which store gateways answer label names and values requests without the index of the block. Blocks resulted from downsampling have one if their source block has one.").
+		Default("false").BoolVar(&cc.writeLabelIndex)
+
+	cmd.Flag("compact.skip-newer-meta-versions", "If true, blocks whose meta.json was written by a newer version of Thanos, with a meta version this compactor doesn't support, are skipped: "+
+		"they are not compacted, downsampled or deleted by retention. Otherwise, the compactor halts on such blocks.").
+		Default("false").BoolVar(&cc.skipNewerMetaVersions)
+
 	cmd.Flag("compact.skip-block-with-out-of-order-chunks", "When set to true, mark blocks containing index with out-of-order chunks for no compact instead of halting the compaction").
 		Hidden().Default("false").BoolVar(&cc.skipBlockWithOutOfOrderChunks)
 
@@ -755,6 +1146,7 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cc.selectorRelabelConf = *extkingpin.RegisterSelectorRelabelFlags(cmd)
 
 	cc.webConf.registerFlag(cmd)
+	cmd.Flag("web.read-write", "Allow blocks to be marked and unmarked for deletion and no compaction through the bucket web UI and its blocks API. Disable with --no-web.read-write to make them read-only.").Default("true").BoolVar(&cc.webConf.readWrite)
 
 	cmd.Flag("bucket-web-label", "Prometheus label to use as timeline title in the bucket web UI").StringVar(&cc.label)
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/prometheus/common/model"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/shipper"
 )
 
 type grpcConfig struct {
@@ -126,6 +127,7 @@ type shipperConfig struct {
 	ignoreBlockSize       bool
 	allowOutOfOrderUpload bool
 	hashFunc              string
+	uploadVerification    string
 }
 
 func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig {
@@ -142,6 +144,8 @@ func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig
 		Default("false").Hidden().BoolVar(&sc.allowOutOfOrderUpload)
 	cmd.Flag("hash-func", "Specify which hash function to use when calculating the hashes of produced files. If no function has been specified, it does not happen. This permits avoiding downloading some files twice albeit at some performance cost. Possible values are: \"\", \"SHA256\".").
 		Default("").EnumVar(&sc.hashFunc, "SHA256", "")
+	cmd.Flag("shipper.upload-verification", "How each uploaded block is compared with the local one, to detect blocks altered on their way to the object storage. Blocks which don't match are deleted from the object storage and uploaded again on the next sync. 'size' compares the sizes of the uploaded files with the local ones, 'hash' downloads the uploaded files to compare their SHA256 hashes, at the cost of the egress traffic. Possible values are: \"none\", \"size\", \"hash\".").
+		Default(string(shipper.NoUploadVerification)).EnumVar(&sc.uploadVerification, string(shipper.NoUploadVerification), string(shipper.SizeUploadVerification), string(shipper.HashUploadVerification))
 	return sc
 }
 
@@ -150,6 +154,8 @@ type webConfig struct {
 	externalPrefix   string
 	prefixHeaderName string
 	disableCORS      bool
+	// readWrite is only registered by the components serving the bucket web UI.
+	readWrite bool
 }
 
 func (wc *webConfig) registerFlag(cmd extkingpin.FlagClause) *webConfig {
@@ -197,6 +203,10 @@ type alertMgrConfig struct {
 	alertmgrURLs           []string
 	alertmgrsTimeout       time.Duration
 	alertmgrsDNSSDInterval time.Duration
+	alertmgrsSDFiles       []string
+	alertmgrsSDInterval    time.Duration
+	alertmgrsMaxFailures   int
+	alertmgrsCooldown      time.Duration
 	alertExcludeLabels     []string
 	alertQueryURL          *string
 	alertRelabelConfigPath *extflag.PathOrContent
@@ -210,6 +220,14 @@ func (ac *alertMgrConfig) registerFlag(cmd extflag.FlagClause) *alertMgrConfig {
 		DurationVar(&ac.alertmgrsTimeout)
 	cmd.Flag("alertmanagers.sd-dns-interval", "Interval between DNS resolutions of Alertmanager hosts.").
 		Default("30s").DurationVar(&ac.alertmgrsDNSSDInterval)
+	cmd.Flag("alertmanagers.sd-files", "Path to files that contain addresses of Alertmanager replicas to push firing alerts to over HTTP, in the file SD format of Prometheus. The addresses may be prefixed with 'dns+' or 'dnssrv+' like the hosts of '--alertmanagers.url'. The path can be a glob pattern (repeatable). The files are reloaded on change.").
+		PlaceHolder("<path>").StringsVar(&ac.alertmgrsSDFiles)
+	cmd.Flag("alertmanagers.sd-interval", "Refresh interval to re-read Alertmanager file SD files. (used as a fallback)").
+		Default("5m").DurationVar(&ac.alertmgrsSDInterval)
+	cmd.Flag("alertmanagers.max-consecutive-failures", "Number of failed sends in a row to an Alertmanager replica after which no alerts are sent to it for '--alertmanagers.failure-cooldown', as long as other replicas are not in their cooldown too. 0 disables the cooldown.").
+		Default("0").IntVar(&ac.alertmgrsMaxFailures)
+	cmd.Flag("alertmanagers.failure-cooldown", "Time during which no alerts are sent to an Alertmanager replica which failed '--alertmanagers.max-consecutive-failures' times in a row.").
+		Default("1m").DurationVar(&ac.alertmgrsCooldown)
 	ac.alertQueryURL = cmd.Flag("alert.query-url", "The external Thanos Query URL that would be set in all alerts 'Source' field").String()
 	cmd.Flag("alert.label-drop", "Labels by name to drop before sending to alertmanager. This allows alert to be deduplicated on replica label (repeated). Similar Prometheus alert relabelling").
 		StringsVar(&ac.alertExcludeLabels)
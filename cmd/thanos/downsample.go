@@ -16,6 +16,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
 	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -33,6 +35,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
 type DownsampleMetrics struct {
@@ -65,6 +68,7 @@ func RunDownsample(
 	g *run.Group,
 	logger log.Logger,
 	reg *prometheus.Registry,
+	tracer opentracing.Tracer,
 	httpBindAddr string,
 	httpTLSConfig string,
 	httpGracePeriod time.Duration,
@@ -109,6 +113,7 @@ func RunDownsample(
 	// Start cycle of syncing blocks from the bucket and garbage collecting the bucket.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
+		ctx = tracing.ContextWithTracer(ctx, tracer)
 
 		g.Add(func() error {
 			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
@@ -126,7 +131,7 @@ func RunDownsample(
 					metrics.downsamples.WithLabelValues(groupKey)
 					metrics.downsampleFailures.WithLabelValues(groupKey)
 				}
-				if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, hashFunc); err != nil {
+				if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, hashFunc, nil, nil); err != nil {
 					return errors.Wrap(err, "downsampling failed")
 				}
 
@@ -135,7 +140,7 @@ func RunDownsample(
 				if err != nil {
 					return errors.Wrap(err, "sync before second pass of downsampling")
 				}
-				if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, hashFunc); err != nil {
+				if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, hashFunc, nil, nil); err != nil {
 					return errors.Wrap(err, "downsampling failed")
 				}
 				return nil
@@ -175,6 +180,8 @@ func downsampleBucket(
 	dir string,
 	downsampleConcurrency int,
 	hashFunc metadata.HashFunc,
+	policies *downsample.Policies,
+	blocksInUse *compact.BlocksInUse,
 ) (rerr error) {
 	if err := os.MkdirAll(dir, 0750); err != nil {
 		return errors.Wrap(err, "create dir")
@@ -193,21 +200,17 @@ func downsampleBucket(
 
 	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
 	// if a downsampled version with the same hash already exists.
-	sources5m := map[ulid.ULID]struct{}{}
-	sources1h := map[ulid.ULID]struct{}{}
+	sources5m := downsample.Sources{}
+	sources1h := downsample.Sources{}
 
 	for _, m := range metas {
 		switch m.Thanos.Downsample.Resolution {
 		case downsample.ResLevel0:
 			continue
 		case downsample.ResLevel1:
-			for _, id := range m.Compaction.Sources {
-				sources5m[id] = struct{}{}
-			}
+			sources5m.Add(m)
 		case downsample.ResLevel2:
-			for _, id := range m.Compaction.Sources {
-				sources1h[id] = struct{}{}
-			}
+			sources1h.Add(m)
 		default:
 			return errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
 		}
@@ -252,7 +255,14 @@ func downsampleBucket(
 					resolution = downsample.ResLevel2
 					errMsg = "downsampling to 60 min"
 				}
-				if err := processDownsampling(workerCtx, logger, bkt, m, dir, resolution, hashFunc, metrics); err != nil {
+				// The source block must not be deleted by retention while it is downsampled.
+				ids := []ulid.ULID{m.ULID}
+				blocksInUse.Acquire(ids)
+				err := tracing.DoInSpanWithErr(workerCtx, "downsample_block", func(ctx context.Context) error {
+					return processDownsampling(ctx, logger, bkt, m, dir, resolution, hashFunc, metrics)
+				}, opentracing.Tags{"block.id": m.ULID, "block.series": m.Stats.NumSeries, "resolution": resolution})
+				blocksInUse.Release(ids)
+				if err != nil {
 					metrics.downsampleFailures.WithLabelValues(m.Thanos.GroupKey()).Inc()
 					errCh <- errors.Wrap(err, errMsg)
 
@@ -272,14 +282,7 @@ metaSendLoop:
 			continue
 
 		case downsample.ResLevel0:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources5m[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
+			if sources5m.Covered(m) {
 				continue
 			}
 			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
@@ -290,14 +293,7 @@ metaSendLoop:
 			}
 
 		case downsample.ResLevel1:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources1h[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
+			if sources1h.Covered(m) {
 				continue
 			}
 			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
@@ -308,6 +304,11 @@ metaSendLoop:
 			}
 		}
 
+		if reason := policies.Skip(m); reason != "" {
+			level.Debug(logger).Log("msg", "downsampling of block skipped by its downsampling policy", "block", m.ULID, "resolution", m.Thanos.Downsample.Resolution, "reason", reason)
+			continue
+		}
+
 		select {
 		case <-workerCtx.Done():
 			downsampleErrs.Add(workerCtx.Err())
@@ -344,12 +345,16 @@ func processDownsampling(
 ) error {
 	begin := time.Now()
 	bdir := filepath.Join(dir, m.ULID.String())
+	span := tracing.SpanFromContext(ctx)
 
-	err := block.Download(ctx, logger, bkt, m.ULID, bdir)
+	err := tracing.DoInSpanWithErr(ctx, "downsample_block_download", func(ctx context.Context) error {
+		return block.Download(ctx, logger, bkt, m.ULID, bdir)
+	}, opentracing.Tags{"block.id": m.ULID})
 	if err != nil {
 		return errors.Wrapf(err, "download block %s", m.ULID)
 	}
 	level.Info(logger).Log("msg", "downloaded block", "id", m.ULID, "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
+	span.LogKV("event", "block downloaded", "duration_ms", time.Since(begin).Milliseconds())
 
 	if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
 		return errors.Wrap(err, "input block index not valid")
@@ -370,11 +375,17 @@ func processDownsampling(
 	}
 	defer runutil.CloseWithLogOnErr(log.With(logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
 
-	id, err := downsample.Downsample(logger, m, b, dir, resolution)
+	var id ulid.ULID
+	err = tracing.DoInSpanWithErr(ctx, "downsample", func(ctx context.Context) (e error) {
+		id, e = downsample.Downsample(logger, m, b, dir, resolution)
+		return e
+	}, opentracing.Tags{"block.id": m.ULID, "resolution": resolution})
 	if err != nil {
 		return errors.Wrapf(err, "downsample block %s to window %d", m.ULID, resolution)
 	}
 	resdir := filepath.Join(dir, id.String())
+	span.SetTag("result_block.id", id)
+	span.LogKV("event", "block downsampled", "duration_ms", time.Since(begin).Milliseconds())
 
 	downsampleDuration := time.Since(begin)
 	level.Info(logger).Log("msg", "downsampled block",
@@ -385,9 +396,24 @@ func processDownsampling(
 		return errors.Wrap(err, "output block index not valid")
 	}
 
+	if _, err := block.CopyExemplars(logger, resdir, bdir); err != nil {
+		return errors.Wrapf(err, "copy exemplars of block %s to downsampled block %s", m.ULID, id)
+	}
+
+	// Downsampled blocks have the series of their source block, so they have a label index if it has one.
+	if _, err := os.Stat(filepath.Join(bdir, block.LabelIndexFilename)); err == nil {
+		if err := block.WriteLabelIndex(logger, resdir); err != nil {
+			return errors.Wrapf(err, "write label index of downsampled block %s", id)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "stat label index of block %s", m.ULID)
+	}
+
 	begin = time.Now()
 
-	err = block.Upload(ctx, logger, bkt, resdir, hashFunc)
+	err = tracing.DoInSpanWithErr(ctx, "downsample_block_upload", func(ctx context.Context) error {
+		return block.Upload(ctx, logger, bkt, resdir, hashFunc)
+	}, opentracing.Tags{"result_block.id": id})
 	if err != nil {
 		return errors.Wrapf(err, "upload downsampled block %s", id)
 	}
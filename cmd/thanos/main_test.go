@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
@@ -159,7 +161,7 @@ func TestRegression4960_Deadlock(t *testing.T) {
 
 	metas, _, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
-	err = downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, metadata.NoneFunc)
+	err = downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, metadata.NoneFunc, nil, nil)
 	testutil.NotOk(t, err)
 
 	testutil.Assert(t, strings.Contains(err.Error(), "some random error has occurred"))
@@ -199,9 +201,61 @@ func TestCleanupDownsampleCacheFolder(t *testing.T) {
 
 	metas, _, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
-	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, metadata.NoneFunc))
+	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, metadata.NoneFunc, nil, nil))
 	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(meta.Thanos.GroupKey())))
 
 	_, err = os.Stat(dir)
 	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
 }
+
+type inUseRecordingBucket struct {
+	objstore.InstrumentedBucket
+
+	blocksInUse *compact.BlocksInUse
+	mtx         sync.Mutex
+	inUse       map[string]bool
+}
+
+// Get records whether the block of the object is in use while it is read.
+func (b *inUseRecordingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if id, ok := block.IsBlockDir(path.Dir(name)); ok && path.Base(name) == block.IndexFilename {
+		b.mtx.Lock()
+		b.inUse[id.String()] = b.blocksInUse.InUse(id)
+		b.mtx.Unlock()
+	}
+	return b.InstrumentedBucket.Get(ctx, name)
+}
+
+func TestDownsampleBucket_BlocksInUse(t *testing.T) {
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	blocksInUse := compact.NewBlocksInUse()
+	bkt := &inUseRecordingBucket{
+		InstrumentedBucket: objstore.WithNoopInstr(objstore.NewInMemBucket()),
+		blocksInUse:        blocksInUse,
+		inUse:              map[string]bool{},
+	}
+	id, err := e2eutil.CreateBlock(
+		ctx,
+		dir,
+		[]labels.Labels{{{Name: "a", Value: "1"}}},
+		1, 0, downsample.ResLevel1DownsampleRange+1, // Pass the minimum ResLevel1DownsampleRange check.
+		labels.Labels{{Name: "e1", Value: "1"}},
+		downsample.ResLevel0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, id.String()), metadata.NoneFunc))
+
+	metaFetcher, err := block.NewMetaFetcher(nil, block.FetcherConcurrency, bkt, "", nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, downsampleBucket(ctx, logger, newDownsampleMetrics(prometheus.NewRegistry()), bkt, metas, path.Join(dir, "downsample"), 1, metadata.NoneFunc, nil, blocksInUse))
+	// The source block was in use while it was downsampled, and is released afterwards.
+	testutil.Equals(t, map[string]bool{id.String(): true}, bkt.inUse)
+	testutil.Assert(t, !blocksInUse.InUse(id), "block must be released after downsampling")
+}
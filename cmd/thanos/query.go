@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	extflag "github.com/efficientgo/tools/extkingpin"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
@@ -30,6 +32,7 @@ import (
 	apiv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	"github.com/thanos-io/thanos/pkg/exemplars"
@@ -44,6 +47,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/metadata"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
@@ -59,6 +63,8 @@ const (
 	promqlNegativeOffset = "promql-negative-offset"
 	promqlAtModifier     = "promql-at-modifier"
 	queryPushdown        = "query-pushdown"
+
+	promqlExperimentalFunctions = "promql-experimental-functions"
 )
 
 // registerQuery registers a query command.
@@ -92,12 +98,38 @@ func registerQuery(app *extkingpin.App) {
 	lookbackDelta := cmd.Flag("query.lookback-delta", "The maximum lookback duration for retrieving metrics during expression evaluations. PromQL always evaluates the query for the certain timestamp (query range timestamps are deduced by step). Since scrape intervals might be different, PromQL looks back for given amount of time to get latest sample. If it exceeds the maximum lookback delta it assumes series is stale and returns none (a gap). This is why lookback delta should be set to at least 2 times of the slowest scrape interval. If unset it will use the promql default of 5m.").Duration()
 	dynamicLookbackDelta := cmd.Flag("query.dynamic-lookback-delta", "Allow for larger lookback duration for queries based on resolution.").Hidden().Default("true").Bool()
 
+	activeQueriesFile := cmd.Flag("query.active-queries-file", "Path of the file the queries being executed are written to, so that the queries which were running when the querier crashed are logged on its next start. If empty, active queries are only tracked in memory.").
+		Default("").String()
+	activeQueryMaxLength := cmd.Flag("query.active-query-max-length", "Maximum length in bytes of the query text of tracked active queries, longer ones are truncated. 0 disables the limit, but the queries longer than the entries of the active queries file are not written to it.").
+		Default("4096").Int()
+
+	maxResponseBytes := cmd.Flag("query.max-response-bytes", "Maximum size of the responses of instant and range queries, before compression. Queries whose response exceeds it fail with 413 Request Entity Too Large. 0 disables the limit.").
+		Default("0").Bytes()
+
+	cardinalityMaxSeries := cmd.Flag("query.cardinality.max-series", "Maximum number of series a request to the /api/v1/status/cardinality endpoint can fetch from the stores, counted before deduplication. Requests fetching more series are canceled, fail and have to be narrowed with the match[] or metric parameters. 0 disables the limit.").
+		Default("100000").Int()
+
+	cacheImmutableAfter := extkingpin.ModelDuration(cmd.Flag("query.cache-control.immutable-after", "Age of the end of instant and range queries after which their responses are considered immutable and get a 'Cache-Control: public, max-age' header, unless they are partial. Responses of more recent queries get 'Cache-Control: no-cache' and partial responses 'Cache-Control: no-store'. 0s disables the Cache-Control headers of query responses, besides the ones of partial responses.").
+		Default("0s"))
+	cacheMaxAge := extkingpin.ModelDuration(cmd.Flag("query.cache-control.max-age", "Max age of the 'Cache-Control' header of the responses of queries older than --query.cache-control.immutable-after.").
+		Default("1h"))
+
+	disableFederate := cmd.Flag("query.federate.disable", "Disable the Prometheus-compatible /federate endpoint.").
+		Default("false").Bool()
+	federateOffset := extkingpin.ModelDuration(cmd.Flag("query.federate.offset", "Duration before now at which the /federate endpoint selects the latest samples of the series, so that samples still being ingested by the stores are not missed. Samples older than --query.lookback-delta before it are not federated.").
+		Default("0s"))
+	federateMaxSeries := cmd.Flag("query.federate.max-series", "Maximum number of series of the responses of the /federate endpoint. Requests selecting more series fail with 422 Unprocessable Entity. 0 disables the limit.").
+		Default("100000").Int()
+
 	maxConcurrentSelects := cmd.Flag("query.max-concurrent-select", "Maximum number of select requests made concurrently per a query.").
 		Default("4").Int()
 
 	queryReplicaLabels := cmd.Flag("query.replica-label", "Labels to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter. Data includes time series, recording rules, and alerting rules.").
 		Strings()
 
+	queryReplicaLabelRewrites := cmd.Flag("query.replica-label-rewrite", "Label to add to deduplicated series in place of a stripped replica label, in <replica label>:<label>=<value template> format, e.g. prometheus_replica:source=ha-pair-{{ .cluster }}. The value is a Go template executed with the labels of the deduplicated series. The label is only added to series which had the replica label and do not have the label yet. Disabled by default.").
+		PlaceHolder("<rewrite>").Strings()
+
 	instantDefaultMaxSourceResolution := extkingpin.ModelDuration(cmd.Flag("query.instant.default.max_source_resolution", "default value for max_source_resolution for instant queries. If not set, defaults to 0s only taking raw resolution into account. 1h can be a good value if you use instant queries over time ranges that incorporate times outside of your raw-retention.").Default("0s").Hidden())
 
 	defaultMetadataTimeRange := cmd.Flag("query.metadata.default-time-range", "The default metadata time range duration for retrieving labels through Labels and Series API when the range parameters are not specified. The zero value means range covers the time since the beginning.").Default("0s").Duration()
@@ -131,6 +163,11 @@ func registerQuery(app *extkingpin.App) {
 	strictEndpoints := cmd.Flag("endpoint-strict", "Addresses of only statically configured Thanos API servers that are always used, even if the health check fails. Useful if you have a caching layer on top.").
 		PlaceHolder("<staticendpoint>").Strings()
 
+	endpointConfig := extflag.RegisterPathOrContent(cmd, "endpoint.sd-config", "YAML file that contains statically configured Thanos API servers with optional per-endpoint gRPC client TLS and authentication settings. See format details: https://thanos.io/tip/components/query.md/#endpoints-configuration", extflag.WithEnvSubstitution())
+
+	endpointConfigReloadInterval := extkingpin.ModelDuration(cmd.Flag("endpoint.sd-config-reload-interval", "Interval between endpoint config refreshes. Only endpoints with changed settings are dialed again on refresh.").
+		Default("5m"))
+
 	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers. The path can be a glob pattern (repeatable).").
 		PlaceHolder("<path>").Strings()
 
@@ -149,6 +186,9 @@ func registerQuery(app *extkingpin.App) {
 	enableAutodownsampling := cmd.Flag("query.auto-downsampling", "Enable automatic adjustment (step / 5) to what source of data should be used in store gateways if no max_source_resolution param is specified.").
 		Default("false").Bool()
 
+	sliceChunks := cmd.Flag("query.slice-chunks", "Ask the stores to send only the samples of the chunks within the time range of each select, plus one sample on each side, instead of whole chunks. Store gateways only do it with --store.enable-chunk-slicing, other stores ignore it.").
+		Default("false").Bool()
+
 	enableQueryPartialResponse := cmd.Flag("query.partial-response", "Enable partial response for queries if no partial_response param is specified. --no-query.partial-response for disabling.").
 		Default("true").Bool()
 
@@ -168,10 +208,30 @@ func registerQuery(app *extkingpin.App) {
 
 	defaultEvaluationInterval := extkingpin.ModelDuration(cmd.Flag("query.default-evaluation-interval", "Set default evaluation interval for sub queries.").Default("1m"))
 
+	maxSamples := cmd.Flag("query.max-samples", "Maximum number of samples a single query can load into memory. Note that queries will fail if they try to load more samples than this into memory, so this also limits the number of samples a query can return.").
+		Default(strconv.Itoa(math.MaxInt32)).Int()
+
+	tenantHeader := cmd.Flag("query.tenant-header", "HTTP header identifying the tenant of query requests, whose engine limits are configured by the tenant limits configuration.").
+		Default(receive.DefaultTenantHeader).String()
+	tenantLimitsConfig := extflag.RegisterPathOrContent(cmd, "query.tenant-limits-config", "YAML file that contains the PromQL engine limits (timeout, max_samples and default_evaluation_interval), the max lookback (max_lookback) and the deduplication replica labels (replica_labels) of tenants, overriding the ones of the --query.timeout, --query.max-samples, --query.default-evaluation-interval, --query.max-lookback and --query.replica-label flags. See format details: https://thanos.io/tip/components/query.md/#tenant-engine-limits")
+
+	maxLookback := extkingpin.ModelDuration(cmd.Flag("query.max-lookback", "Maximum age of the start of queries, e.g. the retention of the queried data, so that queries of older data don't run to return nothing. What is done with the queries starting before it is set by --query.max-lookback-mode. 0 disables the limit.").
+		Default("0s"))
+	maxLookbackMode := cmd.Flag("query.max-lookback-mode", "What is done with the queries starting before their max lookback: 'clamp' evaluates them from the max lookback only and returns a warning, 'reject' rejects them with 422.").
+		Default(string(apiv1.MaxLookbackClamp)).Enum(string(apiv1.MaxLookbackClamp), string(apiv1.MaxLookbackReject))
+
+	tenantUsageMaxTenants := cmd.Flag("query.tenant-usage.max-tenants", "Maximum number of tenants, as identified by --query.tenant-header, whose query usage is accounted separately in the thanos_query_tenant_* metrics and the /api/v1/tenant_usage endpoint. The usage of further tenants is accounted to the __overflow__ tenant. 0 disables tenant usage accounting.").
+		Default("0").Int()
+
 	defaultRangeQueryStep := extkingpin.ModelDuration(cmd.Flag("query.default-step", "Set default step for range queries. Default step is only used when step is not set in UI. In such cases, Thanos UI will use default step to calculate resolution (resolution = max(rangeSeconds / 250, defaultStep)). This will not work from Grafana, but Grafana has __step variable which can be used.").
 		Default("1s"))
 
 	storeResponseTimeout := extkingpin.ModelDuration(cmd.Flag("store.response-timeout", "If a Store doesn't send any data in this specified duration then a Store will be ignored and partial data will be returned if it's enabled. 0 disables timeout.").Default("0ms"))
+
+	matcherCacheSize := cmd.Flag("query.matcher-cache-size", "Maximum number of compiled regex matchers, and separately of their results against store external labels, cached by the querier. 0 disables the cache.").
+		Default("1000").Int()
+	matcherCacheTTL := extkingpin.ModelDuration(cmd.Flag("query.matcher-cache-ttl", "How long results of regex matchers against store external labels are cached. They are also dropped whenever the set of stores changes.").
+		Default("1m"))
 	reqLogConfig := extkingpin.RegisterRequestLoggingFlags(cmd)
 
 	alertQueryURL := cmd.Flag("alert.query-url", "The external Thanos Query URL that would be set in all alerts 'Source' field.").String()
@@ -182,6 +242,15 @@ func registerQuery(app *extkingpin.App) {
 			return errors.Wrap(err, "parse federation labels")
 		}
 
+		replicaLabelRewrites := make([]dedup.ReplicaLabelRewrite, 0, len(*queryReplicaLabelRewrites))
+		for _, rw := range *queryReplicaLabelRewrites {
+			r, err := dedup.ParseReplicaLabelRewrite(rw)
+			if err != nil {
+				return errors.Wrap(err, "parse replica label rewrites")
+			}
+			replicaLabelRewrites = append(replicaLabelRewrites, r)
+		}
+
 		var enableQueryPushdown bool
 		for _, feature := range *featureList {
 			if feature == queryPushdown {
@@ -193,6 +262,9 @@ func registerQuery(app *extkingpin.App) {
 			if feature == promqlNegativeOffset {
 				level.Warn(logger).Log("msg", "This option for --enable-feature is now permanently enabled and therefore a no-op.", "option", promqlNegativeOffset)
 			}
+			if feature == promqlExperimentalFunctions {
+				level.Warn(logger).Log("msg", "This option for --enable-feature is not supported by the PromQL engine of this version and therefore a no-op.", "option", promqlExperimentalFunctions)
+			}
 		}
 
 		httpLogOpts, err := logging.ParseHTTPOptions(*reqLogDecision, reqLogConfig)
@@ -214,6 +286,16 @@ func registerQuery(app *extkingpin.App) {
 			fileSD = file.NewDiscovery(conf, logger)
 		}
 
+		tenantLimitsYAML, err := tenantLimitsConfig.Content()
+		if err != nil {
+			return err
+		}
+		tenantLimits, err := apiv1.ParseTenantLimitsConfig(tenantLimitsYAML)
+		if err != nil {
+			return err
+		}
+		queryMaxLookback := apiv1.NewMaxLookback(*tenantHeader, apiv1.MaxLookbackMode(*maxLookbackMode), time.Duration(*maxLookback), tenantLimits)
+
 		if *webRoutePrefix == "" {
 			*webRoutePrefix = *webExternalPrefix
 		}
@@ -249,14 +331,30 @@ func registerQuery(app *extkingpin.App) {
 			*webExternalPrefix,
 			*webPrefixHeaderName,
 			*maxConcurrentQueries,
+			*activeQueriesFile,
+			*activeQueryMaxLength,
+			int64(*maxResponseBytes),
+			*cardinalityMaxSeries,
+			time.Duration(*cacheImmutableAfter),
+			time.Duration(*cacheMaxAge),
+			federateOptions(*disableFederate, time.Duration(*federateOffset), *lookbackDelta, *federateMaxSeries),
 			*maxConcurrentSelects,
 			time.Duration(*defaultRangeQueryStep),
 			time.Duration(*queryTimeout),
 			*lookbackDelta,
 			*dynamicLookbackDelta,
 			time.Duration(*defaultEvaluationInterval),
+			*maxSamples,
+			*tenantHeader,
+			tenantLimits,
+			queryMaxLookback,
+			*tenantUsageMaxTenants,
 			time.Duration(*storeResponseTimeout),
+			*matcherCacheSize,
+			time.Duration(*matcherCacheTTL),
 			*queryReplicaLabels,
+			replicaLabelRewrites,
+			*sliceChunks,
 			selectorLset,
 			getFlagsMap(cmd.Flags()),
 			*endpoints,
@@ -279,6 +377,8 @@ func registerQuery(app *extkingpin.App) {
 			*defaultMetadataTimeRange,
 			*strictStores,
 			*strictEndpoints,
+			endpointConfig,
+			time.Duration(*endpointConfigReloadInterval),
 			*webDisableCORS,
 			enableQueryPushdown,
 			*alertQueryURL,
@@ -316,14 +416,30 @@ func runQuery(
 	webExternalPrefix string,
 	webPrefixHeaderName string,
 	maxConcurrentQueries int,
+	activeQueriesFile string,
+	activeQueryMaxLength int,
+	maxResponseBytes int64,
+	cardinalityMaxSeries int,
+	cacheImmutableAfter time.Duration,
+	cacheMaxAge time.Duration,
+	federateOpts *apiv1.FederateOptions,
 	maxConcurrentSelects int,
 	defaultRangeQueryStep time.Duration,
 	queryTimeout time.Duration,
 	lookbackDelta time.Duration,
 	dynamicLookbackDelta bool,
 	defaultEvaluationInterval time.Duration,
+	maxSamples int,
+	tenantHeader string,
+	tenantLimits apiv1.TenantLimitsConfig,
+	maxLookback *apiv1.MaxLookback,
+	tenantUsageMaxTenants int,
 	storeResponseTimeout time.Duration,
+	matcherCacheSize int,
+	matcherCacheTTL time.Duration,
 	queryReplicaLabels []string,
+	replicaLabelRewrites []dedup.ReplicaLabelRewrite,
+	sliceChunks bool,
 	selectorLset labels.Labels,
 	flagsMap map[string]string,
 	endpointAddrs []string,
@@ -346,6 +462,8 @@ func runQuery(
 	defaultMetadataTimeRange time.Duration,
 	strictStores []string,
 	strictEndpoints []string,
+	endpointConfig *extflag.PathOrContent,
+	endpointConfigReloadInterval time.Duration,
 	disableCORS bool,
 	enableQueryPushdown bool,
 	alertQueryURL string,
@@ -388,6 +506,12 @@ func runQuery(
 		}
 	}
 
+	endpointConfigSpecs, err := loadEndpointConfigSpecs(logger, endpointConfig)
+	if err != nil {
+		return errors.Wrap(err, "loading endpoint config")
+	}
+	var endpointConfigMtx sync.RWMutex
+
 	dnsEndpointProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_endpoints_", reg),
@@ -418,6 +542,14 @@ func runQuery(
 		dns.ResolverType(dnsSDResolver),
 	)
 
+	var matcherCache *store.MatcherCache
+	if matcherCacheSize > 0 {
+		matcherCache, err = store.NewMatcherCache(reg, matcherCacheSize, matcherCacheTTL)
+		if err != nil {
+			return errors.Wrap(err, "create matcher cache")
+		}
+	}
+
 	var (
 		endpoints = query.NewEndpointSet(
 			logger,
@@ -432,6 +564,11 @@ func runQuery(
 					specs = append(specs, query.NewGRPCEndpointSpec(addr, true))
 				}
 
+				// Add nodes from endpoint config, before dynamic ones so their settings take precedence.
+				endpointConfigMtx.RLock()
+				specs = append(specs, endpointConfigSpecs...)
+				endpointConfigMtx.RUnlock()
+
 				for _, dnsProvider := range []*dns.Provider{
 					dnsStoreProvider,
 					dnsRuleProvider,
@@ -454,7 +591,7 @@ func runQuery(
 			dialOpts,
 			unhealthyStoreTimeout,
 		)
-		proxy            = store.NewProxyStore(logger, reg, endpoints.GetStoreClients, component.Query, selectorLset, storeResponseTimeout)
+		proxy            = store.NewProxyStore(logger, reg, endpoints.GetStoreClients, component.Query, selectorLset, storeResponseTimeout, store.WithMatcherCache(matcherCache))
 		rulesProxy       = rules.NewProxy(logger, endpoints.GetRulesClients)
 		targetsProxy     = targets.NewProxy(logger, endpoints.GetTargetsClients)
 		metadataProxy    = metadata.NewProxy(logger, endpoints.GetMetricMetadataClients)
@@ -465,12 +602,13 @@ func runQuery(
 			proxy,
 			maxConcurrentSelects,
 			queryTimeout,
+			replicaLabelRewrites,
+			sliceChunks,
 		)
 		engineOpts = promql.EngineOpts{
-			Logger: logger,
-			Reg:    reg,
-			// TODO(bwplotka): Expose this as a flag: https://github.com/thanos-io/thanos/issues/703.
-			MaxSamples:    math.MaxInt32,
+			Logger:        logger,
+			Reg:           reg,
+			MaxSamples:    maxSamples,
 			Timeout:       queryTimeout,
 			LookbackDelta: lookbackDelta,
 			NoStepSubqueryIntervalFn: func(int64) int64 {
@@ -480,6 +618,9 @@ func runQuery(
 			EnableAtModifier:     true,
 		}
 	)
+	if matcherCache != nil {
+		endpoints.UpdateOnChange(matcherCache.InvalidateValues)
+	}
 
 	// Periodically update the store set with the addresses we see in our cluster.
 	{
@@ -495,6 +636,26 @@ func runQuery(
 		})
 	}
 
+	// Periodically reload the endpoint config.
+	if endpointConfigReloadInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(endpointConfigReloadInterval, ctx.Done(), func() error {
+				specs, err := loadEndpointConfigSpecs(logger, endpointConfig)
+				if err != nil {
+					level.Error(logger).Log("msg", "failed to reload endpoint config, keeping the previous one", "err", err)
+					return nil
+				}
+				endpointConfigMtx.Lock()
+				endpointConfigSpecs = specs
+				endpointConfigMtx.Unlock()
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	// Run File Service Discovery and update the store set when the files are modified.
 	if fileSD != nil {
 		var fileSDUpdates chan []*targetgroup.Group
@@ -574,7 +735,25 @@ func runQuery(
 		grpcProbe,
 		prober.NewInstrumentation(comp, logger, extprom.WrapRegistererWithPrefix("thanos_", reg)),
 	)
-	engineCreator := engineFactory(promql.NewEngine, engineOpts, dynamicLookbackDelta)
+	newEngine := func(eo promql.EngineOpts) func(int64) *promql.Engine {
+		return engineFactory(promql.NewEngine, eo, dynamicLookbackDelta)
+	}
+	var tenantEngines *apiv1.TenantEngines
+	if len(tenantLimits.Tenants) > 0 {
+		tenantEngines = apiv1.NewTenantEngines(tenantHeader, tenantLimits, engineOpts, newEngine)
+		// The engine metrics of tenants with limits have a tenant label.
+		engineOpts.Reg = extprom.WrapRegistererWith(prometheus.Labels{"tenant": ""}, engineOpts.Reg)
+	}
+	engineCreator := newEngine(engineOpts)
+
+	activeQueries, err := query.NewActiveQueryTracker(logger, activeQueriesFile, maxConcurrentQueries, activeQueryMaxLength)
+	if err != nil {
+		return errors.Wrap(err, "create active query tracker")
+	}
+	var tenantUsage *apiv1.TenantUsageTracker
+	if tenantUsageMaxTenants > 0 {
+		tenantUsage = apiv1.NewTenantUsageTracker(reg, tenantHeader, tenantUsageMaxTenants)
+	}
 
 	// Start query API + UI HTTP server.
 	{
@@ -604,7 +783,18 @@ func runQuery(
 		api := apiv1.NewQueryAPI(
 			logger,
 			endpoints.GetEndpointStatus,
+			proxy.MatchStores,
 			engineCreator,
+			apiv1.EngineFeatures{
+				NegativeOffset: engineOpts.EnableNegativeOffset,
+				AtModifier:     engineOpts.EnableAtModifier,
+			},
+			tenantEngines,
+			maxLookback,
+			apiv1.NewTenantReplicaLabels(tenantHeader, tenantLimits),
+			tenantHeader,
+			activeQueries,
+			tenantUsage,
 			queryableCreator,
 			// NOTE: Will share the same replica label as the query for now.
 			rules.NewGRPCClientWithDedup(rulesProxy, queryReplicaLabels),
@@ -628,10 +818,17 @@ func runQuery(
 				extprom.WrapRegistererWithPrefix("thanos_query_concurrent_", reg),
 				maxConcurrentQueries,
 			),
+			maxResponseBytes,
+			cardinalityMaxSeries,
+			cacheImmutableAfter,
+			cacheMaxAge,
 			reg,
 		)
 
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
+		if federateOpts != nil {
+			api.RegisterFederate(router, tracer, logger, ins, logMiddleware, *federateOpts)
+		}
 
 		srv := httpserver.New(logger, reg, comp, httpProbe,
 			httpserver.WithListen(httpBindAddr),
@@ -649,6 +846,7 @@ func runQuery(
 			defer statusProber.NotHealthy(err)
 
 			srv.Shutdown(err)
+			runutil.CloseWithLogOnErr(logger, activeQueries, "active query tracker")
 		})
 	}
 	// Start query (proxy) gRPC StoreAPI.
@@ -667,6 +865,8 @@ func runQuery(
 					return &infopb.StoreInfo{
 						MinTime: mint,
 						MaxTime: maxt,
+						// Proxy removes replica labels after merging the series of all stores.
+						SupportsWithoutReplicaLabels: true,
 					}
 				}
 				return nil
@@ -678,7 +878,7 @@ func runQuery(
 			info.WithQueryAPIInfoFunc(),
 		)
 
-		grpcAPI := apiv1.NewGRPCAPI(time.Now, queryReplicaLabels, queryableCreator, engineCreator, instantDefaultMaxSourceResolution)
+		grpcAPI := apiv1.NewGRPCAPI(time.Now, queryReplicaLabels, apiv1.NewTenantReplicaLabels(tenantHeader, tenantLimits), queryableCreator, engineCreator, instantDefaultMaxSourceResolution)
 		s := grpcserver.New(logger, reg, tracer, grpcLogOpts, tagOpts, comp, grpcProbe,
 			grpcserver.WithServer(apiv1.RegisterQueryServer(grpcAPI)),
 			grpcserver.WithServer(store.RegisterStoreServer(proxy)),
@@ -706,6 +906,23 @@ func runQuery(
 	return nil
 }
 
+// loadEndpointConfigSpecs loads the endpoint config and returns the specs of configured endpoints.
+func loadEndpointConfigSpecs(logger log.Logger, endpointConfig *extflag.PathOrContent) ([]*query.GRPCEndpointSpec, error) {
+	content, err := endpointConfig.Content()
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	cfg, err := query.LoadEndpointsConfig(content)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.EndpointSpecs(logger)
+}
+
 func removeDuplicateEndpointSpecs(logger log.Logger, duplicatedStores prometheus.Counter, specs []*query.GRPCEndpointSpec) []*query.GRPCEndpointSpec {
 	set := make(map[string]*query.GRPCEndpointSpec)
 	for _, spec := range specs {
@@ -729,6 +946,15 @@ func removeDuplicateEndpointSpecs(logger log.Logger, duplicatedStores prometheus
 //
 // TODO: it seems like a good idea to tweak Prometheus itself
 // instead of creating several Engines here.
+// federateOptions returns the options of the /federate endpoint, nil if it is disabled. The latest samples of the
+// series are looked up within the lookback delta of queries.
+func federateOptions(disable bool, offset, lookbackDelta time.Duration, maxSeries int) *apiv1.FederateOptions {
+	if disable {
+		return nil
+	}
+	return &apiv1.FederateOptions{Offset: offset, LookbackDelta: lookbackDelta, MaxSeries: maxSeries}
+}
+
 func engineFactory(
 	newEngine func(promql.EngineOpts) *promql.Engine,
 	eo promql.EngineOpts,
@@ -24,6 +24,7 @@ import (
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	cortexvalidation "github.com/thanos-io/thanos/internal/cortex/util/validation"
 	"github.com/thanos-io/thanos/pkg/api"
+	apiv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
@@ -40,7 +41,9 @@ type queryFrontendConfig struct {
 	http           httpConfig
 	webDisableCORS bool
 	queryfrontend.Config
-	orgIdHeaders []string
+	orgIdHeaders       []string
+	maxLookbackMode    string
+	tenantLimitsConfig *extflag.PathOrContent
 }
 
 func registerQueryFrontend(app *extkingpin.App) {
@@ -70,6 +73,12 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("query-range.align-range-with-step", "Mutate incoming queries to align their start and end with their step for better cache-ability. Note: Grafana dashboards do that by default.").
 		Default("true").BoolVar(&cfg.QueryRangeConfig.AlignRangeWithStep)
 
+	cmd.Flag("query-range.min-step", "Minimum step of range queries. Queries with a smaller step are evaluated with this step instead, 0 disables it. The step used is returned in the "+queryfrontend.EffectiveStepHeader+" response header.").
+		Default("0s").DurationVar(&cfg.QueryRangeConfig.MinStep)
+
+	cmd.Flag("query-range.allowed-step", "Step range queries are snapped to for better cache-ability (repeated). Queries are evaluated with the smallest allowed step not below their step, or a multiple of the largest one. The step used is returned in the "+queryfrontend.EffectiveStepHeader+" response header.").
+		PlaceHolder("<step>").DurationListVar(&cfg.QueryRangeConfig.AllowedSteps)
+
 	cmd.Flag("query-range.request-downsampled", "Make additional query for downsampled data in case of empty or incomplete response to range request.").
 		Default("true").BoolVar(&cfg.QueryRangeConfig.RequestDownsampled)
 
@@ -91,8 +100,19 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("query-range.partial-response", "Enable partial response for query range requests if no partial_response param is specified. --no-query-range.partial-response for disabling.").
 		Default("true").BoolVar(&cfg.QueryRangeConfig.PartialResponseStrategy)
 
+	cmd.Flag("query-range.max-lookback", "Maximum age of the start of query range requests, e.g. the retention of the queried data, so that no downstream requests are sent for older data. What is done with the queries starting before it is set by --query-range.max-lookback-mode. 0 disables the limit.").
+		Default("0").DurationVar((*time.Duration)(&cfg.QueryRangeConfig.Limits.MaxQueryLookback))
+
+	cmd.Flag("query-range.max-lookback-mode", "What is done with the query range requests starting before their max lookback, before they are split: 'clamp' moves their start forward by whole steps and returns a warning, 'reject' rejects them with 422.").
+		Default(string(apiv1.MaxLookbackClamp)).EnumVar(&cfg.maxLookbackMode, string(apiv1.MaxLookbackClamp), string(apiv1.MaxLookbackReject))
+
+	cfg.tenantLimitsConfig = extflag.RegisterPathOrContent(cmd, "query-range.tenant-limits-config", "YAML file that contains the limits of tenants, as identified by the query-frontend.org-id-header flag, in the format of the querier tenant limits configuration. Only max_lookback is used, overriding --query-range.max-lookback. See format details: https://thanos.io/tip/components/query.md/#tenant-engine-limits")
+
 	cfg.QueryRangeConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-range.response-cache-config", "YAML file that contains response cache configuration.", extflag.WithEnvSubstitution())
 
+	cmd.Flag("query-range.cache-invalidation.enabled", "Enable the "+queryfrontend.CacheInvalidationPath+" endpoint, invalidating the cached query range results of the tenant of the request within its start and end parameters. Requires query-range.response-cache-config to be configured.").
+		Default("false").BoolVar(&cfg.QueryRangeConfig.CacheInvalidationEnabled)
+
 	// Labels tripperware flags.
 	cmd.Flag("labels.split-interval", "Split labels requests by an interval and execute in parallel, it should be greater than 0 when labels.response-cache-config is configured.").
 		Default("24h").DurationVar(&cfg.LabelsConfig.SplitQueriesByInterval)
@@ -114,6 +134,9 @@ func registerQueryFrontend(app *extkingpin.App) {
 
 	cfg.LabelsConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "labels.response-cache-config", "YAML file that contains response cache configuration.", extflag.WithEnvSubstitution())
 
+	cmd.Flag("query-frontend.cache-disabled-tenant", "Tenant, as identified by the query-frontend.org-id-header flag, whose query range and labels results are never cached (repeated).").
+		PlaceHolder("<tenant>").StringsVar(&cfg.CacheDisabledTenants)
+
 	cmd.Flag("cache-compression-type", "Use compression in results cache. Supported values are: 'snappy' and '' (disable compression).").
 		Default("").StringVar(&cfg.CacheCompression)
 
@@ -122,6 +145,21 @@ func registerQueryFrontend(app *extkingpin.App) {
 
 	cfg.DownstreamTripperConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-frontend.downstream-tripper-config", "YAML file that contains downstream tripper configuration. If your downstream URL is localhost or 127.0.0.1 then it is highly recommended to increase max_idle_conns_per_host to at least 100.", extflag.WithEnvSubstitution())
 
+	cmd.Flag("query-frontend.retryable-status-code", "Status code, like 503, or 5xx for all server errors, of the downstream responses retried by the query range and labels requests (repeated). Client errors are never retried. Requests failing without a response are always retried.").
+		Default(queryfrontend.DefaultRetryableStatusCodes...).StringsVar(&cfg.RetryableStatusCodes)
+
+	cmd.Flag("query-frontend.circuit-breaker.error-ratio", "Ratio of downstream requests failing with 5xx or without a response within a window above which the circuit to the downstream opens: requests are rejected right away with 503 and a Retry-After header, then a single probe request at a time is let through once the open duration is over, closing the circuit if it succeeds. 0 disables the circuit breaker.").
+		Default("0").Float64Var(&cfg.CircuitBreakerConfig.ErrorRatio)
+
+	cmd.Flag("query-frontend.circuit-breaker.min-requests", "Minimum number of downstream requests within a window for the circuit to open.").
+		Default("20").IntVar(&cfg.CircuitBreakerConfig.MinRequests)
+
+	cmd.Flag("query-frontend.circuit-breaker.window", "Duration of the windows in which the downstream requests and failures are counted.").
+		Default("10s").DurationVar(&cfg.CircuitBreakerConfig.Window)
+
+	cmd.Flag("query-frontend.circuit-breaker.open-duration", "Duration during which the downstream requests are rejected once the circuit opened, before a probe request is let through.").
+		Default("10s").DurationVar(&cfg.CircuitBreakerConfig.OpenDuration)
+
 	cmd.Flag("query-frontend.compress-responses", "Compress HTTP responses.").
 		Default("false").BoolVar(&cfg.CompressResponses)
 
@@ -234,6 +272,24 @@ func runQueryFrontend(
 		}
 	}
 
+	tenantLimitsYAML, err := cfg.tenantLimitsConfig.Content()
+	if err != nil {
+		return err
+	}
+	tenantLimits, err := apiv1.ParseTenantLimitsConfig(tenantLimitsYAML)
+	if err != nil {
+		return err
+	}
+	cfg.QueryRangeConfig.Limits.MaxQueryLookbackReject = cfg.maxLookbackMode == string(apiv1.MaxLookbackReject)
+	for tenant, l := range tenantLimits.Tenants {
+		if l.MaxLookback > 0 {
+			if cfg.QueryRangeConfig.TenantMaxLookbacks == nil {
+				cfg.QueryRangeConfig.TenantMaxLookbacks = map[string]time.Duration{}
+			}
+			cfg.QueryRangeConfig.TenantMaxLookbacks[tenant] = time.Duration(l.MaxLookback)
+		}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return errors.Wrap(err, "error validating the config")
 	}
@@ -258,6 +314,11 @@ func runQueryFrontend(
 		return errors.Wrap(err, "setup downstream roundtripper")
 	}
 
+	// The circuit breaker sits below the tripperware, so that the cached results are served while it is open.
+	if cfg.CircuitBreakerConfig.Enabled() {
+		roundTripper = queryfrontend.NewCircuitBreakerRoundTripper(roundTripper, cfg.DownstreamURL, cfg.CircuitBreakerConfig, reg, logger)
+	}
+
 	// Wrap the downstream RoundTripper into query frontend Tripperware.
 	roundTripper = tripperWare(roundTripper)
 
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/client"
+	"google.golang.org/grpc"
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -48,6 +50,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/tls"
 )
 
+// Receiver modes which can be set explicitly with the --receive.mode flag.
+const (
+	receiveModeRouter   = "router"
+	receiveModeIngestor = "ingestor"
+	receiveModeBoth     = "both"
+)
+
 func registerReceive(app *extkingpin.App) {
 	cmd := app.Command(component.Receive.String(), "Accept Prometheus remote write API requests and write to local tsdb.")
 
@@ -63,6 +72,18 @@ func registerReceive(app *extkingpin.App) {
 		if !model.LabelName.IsValid(model.LabelName(conf.tenantLabelName)) {
 			return errors.Errorf("unsupported format for tenant label name, got %s", conf.tenantLabelName)
 		}
+		if err := conf.validateTenantSources(); err != nil {
+			return err
+		}
+		if conf.diskHighWatermark < 0 || conf.diskHighWatermark > 1 {
+			return errors.Errorf("--receive.disk-watermark.high must be between 0 and 1, got %v", conf.diskHighWatermark)
+		}
+		if conf.diskLowWatermark == 0 {
+			conf.diskLowWatermark = conf.diskHighWatermark
+		}
+		if conf.diskLowWatermark < 0 || conf.diskLowWatermark > conf.diskHighWatermark {
+			return errors.Errorf("--receive.disk-watermark.low must be between 0 and the high watermark %v, got %v", conf.diskHighWatermark, conf.diskLowWatermark)
+		}
 		if len(lset) == 0 {
 			return errors.New("no external labels configured for receive, uniquely identifying external labels must be configured (ideally with `receive_` prefix); see https://thanos.io/tip/thanos/storage.md#external-labels for details.")
 		}
@@ -84,7 +105,10 @@ func registerReceive(app *extkingpin.App) {
 		}
 
 		// Are we running in IngestorOnly, RouterOnly or RouterIngestor mode?
-		receiveMode := conf.determineMode()
+		receiveMode, err := conf.determineMode()
+		if err != nil {
+			return err
+		}
 
 		return runReceive(
 			g,
@@ -172,8 +196,10 @@ func runReceive(
 
 	// TODO(brancz): remove after a couple of versions
 	// Migrate non-multi-tsdb capable storage to multi-tsdb disk layout.
-	if err := migrateLegacyStorage(logger, conf.dataDir, conf.defaultTenantID); err != nil {
-		return errors.Wrapf(err, "migrate legacy storage in %v to default tenant %v", conf.dataDir, conf.defaultTenantID)
+	if enableIngestion {
+		if err := migrateLegacyStorage(logger, conf.dataDir, conf.defaultTenantID); err != nil {
+			return errors.Wrapf(err, "migrate legacy storage in %v to default tenant %v", conf.dataDir, conf.defaultTenantID)
+		}
 	}
 
 	relabelContentYaml, err := conf.relabelConfigPath.Content()
@@ -185,6 +211,57 @@ func runReceive(
 		return errors.Wrap(err, "parse relabel configuration")
 	}
 
+	tenantRelabelConfigs, err := loadTenantRelabelConfigs(conf.tenantRelabelConfigPath)
+	if err != nil {
+		return errors.Wrap(err, "load tenant relabel configuration")
+	}
+
+	tenantLimits, err := loadTenantLimits(conf.tenantLimitsConfigPath)
+	if err != nil {
+		return errors.Wrap(err, "load tenant limits configuration")
+	}
+
+	idleTimeoutOverrides, err := parseTenantIdleTimeoutOverrides(conf.tenantIdleTimeoutOverrides)
+	if err != nil {
+		return errors.Wrap(err, "parse tenant idle timeout overrides")
+	}
+
+	labelValidationOverrides, err := parseTenantLabelValidationOverrides(conf.labelValidationOverrides)
+	if err != nil {
+		return errors.Wrap(err, "parse tenant label validation overrides")
+	}
+
+	var diskGuard *receive.DiskGuard
+	if enableIngestion && conf.diskHighWatermark > 0 {
+		diskGuard = receive.NewDiskGuard(log.With(logger, "component", "disk-guard"), reg, conf.dataDir, conf.diskHighWatermark, conf.diskLowWatermark)
+	}
+
+	remoteReplicator, err := newRemoteReplicator(logger, reg, conf, dialOpts)
+	if err != nil {
+		return err
+	}
+
+	asyncReplicator, err := newAsyncReplicator(logger, reg, conf, dialOpts)
+	if err != nil {
+		return err
+	}
+
+	admission, err := newAdmission(reg, conf)
+	if err != nil {
+		return errors.Wrap(err, "parse admission tenant weights")
+	}
+
+	multiTSDBOpts := []receive.MultiTSDBOption{
+		receive.WithTenantIdleTimeout(time.Duration(*conf.tenantIdleTimeout)),
+		receive.WithTenantIdleTimeoutOverrides(idleTimeoutOverrides),
+		receive.WithDiskPressureRetention(diskGuard, time.Duration(*conf.diskPressureRetention)),
+	}
+	if conf.uploadExemplars {
+		multiTSDBOpts = append(multiTSDBOpts, receive.WithExemplarsUpload())
+	}
+	if conf.tsdbHeadCompactionConcurrency > 0 {
+		multiTSDBOpts = append(multiTSDBOpts, receive.WithHeadCompactionScheduling(conf.tsdbHeadCompactionConcurrency, time.Duration(*conf.tsdbHeadCompactionStagger)))
+	}
 	dbs := receive.NewMultiTSDB(
 		conf.dataDir,
 		logger,
@@ -195,7 +272,9 @@ func runReceive(
 		bkt,
 		conf.allowOutOfOrderUpload,
 		hashFunc,
+		multiTSDBOpts...,
 	)
+	dbs.SetTenantLimits(tenantLimits)
 	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs)
 	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
 		Writer:            writer,
@@ -214,10 +293,33 @@ func runReceive(
 		DialOpts:          dialOpts,
 		ForwardTimeout:    time.Duration(*conf.forwardTimeout),
 		TSDBStats:         dbs,
+		// Ingestors running explicitly behind a routing tier accept only writes forwarded by routers.
+		ReplicatedWritesOnly: conf.mode == receiveModeIngestor,
+		MetricsTenants:       conf.metricsTenants,
+		DiskGuard:            diskGuard,
+
+		TenantSources:               conf.tenantSources,
+		TenantExtractionLabel:       conf.tenantExtractionLabel,
+		RemoveTenantExtractionLabel: conf.removeTenantExtractionLabel,
+		RejectMissingTenant:         conf.rejectMissingTenant,
+		RemoteReplicator:            remoteReplicator,
+		AsyncReplicator:             asyncReplicator,
+		ReplicationCompression:      conf.replicationCompression,
+
+		ForwardCircuitBreakerFailures:     conf.forwardCircuitBreakerFailures,
+		ForwardCircuitBreakerOpenDuration: time.Duration(*conf.forwardCircuitBreakerOpenDuration),
+
+		LabelValidation:       conf.labelValidation,
+		TenantLabelValidation: labelValidationOverrides,
+		Admission:             admission,
+		EnableDebugHeader:     conf.debugHeader,
 	})
 
+	webHandler.TenantRelabelConfigs(tenantRelabelConfigs)
+
 	grpcProbe := prober.NewGRPC()
-	httpProbe := prober.NewHTTP()
+	readiness := prober.NewReadiness(comp, extprom.WrapRegistererWithPrefix("thanos_", reg))
+	httpProbe := prober.NewHTTP(prober.WithReadiness(readiness))
 	statusProber := prober.Combine(
 		httpProbe,
 		grpcProbe,
@@ -241,7 +343,8 @@ func runReceive(
 
 		level.Debug(logger).Log("msg", "setting up tsdb")
 		{
-			if err := startTSDBAndUpload(g, logger, reg, dbs, reloadGRPCServer, uploadC, hashringChangedChan, upload, uploadDone, statusProber, bkt); err != nil {
+			walReplay := readiness.Register("wal-replay")
+			if err := startTSDBAndUpload(g, logger, reg, dbs, reloadGRPCServer, uploadC, hashringChangedChan, upload, uploadDone, statusProber, walReplay, bkt); err != nil {
 				return err
 			}
 		}
@@ -249,11 +352,66 @@ func runReceive(
 
 	level.Debug(logger).Log("msg", "setting up hashring")
 	{
-		if err := setupHashring(g, logger, reg, conf, hashringChangedChan, webHandler, statusProber, reloadGRPCServer, enableIngestion); err != nil {
+		hashringLoaded := readiness.Register("hashring-loaded")
+		if err := setupHashring(g, logger, reg, conf, hashringChangedChan, webHandler, statusProber, hashringLoaded, reloadGRPCServer, enableIngestion); err != nil {
 			return err
 		}
 	}
 
+	if remoteReplicator != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return remoteReplicator.Run(ctx)
+		}, func(error) {
+			cancel()
+		})
+	}
+
+	if asyncReplicator != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return asyncReplicator.Run(ctx)
+		}, func(error) {
+			cancel()
+		})
+	}
+
+	// Periodically reload the tenant relabel config.
+	if *conf.tenantRelabelConfigReloadInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Duration(*conf.tenantRelabelConfigReloadInterval), ctx.Done(), func() error {
+				configs, err := loadTenantRelabelConfigs(conf.tenantRelabelConfigPath)
+				if err != nil {
+					level.Error(logger).Log("msg", "failed to reload tenant relabel config, keeping the previous one", "err", err)
+					return nil
+				}
+				webHandler.TenantRelabelConfigs(configs)
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
+	// Periodically reload the tenant limits config.
+	if *conf.tenantLimitsConfigReloadInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Duration(*conf.tenantLimitsConfigReloadInterval), ctx.Done(), func() error {
+				limits, err := loadTenantLimits(conf.tenantLimitsConfigPath)
+				if err != nil {
+					level.Error(logger).Log("msg", "failed to reload tenant limits config, keeping the previous one", "err", err)
+					return nil
+				}
+				dbs.SetTenantLimits(limits)
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	level.Debug(logger).Log("msg", "setting up http server")
 	{
 		srv := httpserver.New(logger, reg, comp, httpProbe,
@@ -293,11 +451,21 @@ func runReceive(
 		)
 	}
 
-	level.Debug(logger).Log("msg", "setting up periodic tenant pruning")
-	{
+	if enableIngestion {
+		level.Debug(logger).Log("msg", "setting up periodic tenant pruning")
+		// Check idle tenants at least as often as the shortest idle timeout, so they are not kept much longer.
+		pruneInterval := 2 * time.Hour
+		if d := time.Duration(*conf.tenantIdleTimeout); d > 0 && d < pruneInterval {
+			pruneInterval = d
+		}
+		for _, d := range idleTimeoutOverrides {
+			if d > 0 && d < pruneInterval {
+				pruneInterval = d
+			}
+		}
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			return runutil.Repeat(2*time.Hour, ctx.Done(), func() error {
+			return runutil.Repeat(pruneInterval, ctx.Done(), func() error {
 				if err := dbs.Prune(ctx); err != nil {
 					level.Error(logger).Log("err", err)
 				}
@@ -308,10 +476,75 @@ func runReceive(
 		})
 	}
 
+	if enableIngestion && *conf.ingestionLagInterval > 0 {
+		level.Debug(logger).Log("msg", "setting up ingestion lag metrics")
+		ingestionLag := receive.NewIngestionLag(reg, dbs, conf.metricsTenants)
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Duration(*conf.ingestionLagInterval), ctx.Done(), func() error {
+				ingestionLag.Update()
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if diskGuard != nil {
+		level.Debug(logger).Log("msg", "setting up disk watermark checks")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(10*time.Second, ctx.Done(), func() error {
+				if err := diskGuard.Update(); err != nil {
+					level.Error(logger).Log("msg", "failed to check disk watermark", "err", err)
+				}
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
 	level.Info(logger).Log("msg", "starting receiver")
 	return nil
 }
 
+// parseTenantIdleTimeoutOverrides parses <tenant>=<duration> pairs into idle timeouts by tenant.
+func parseTenantIdleTimeoutOverrides(s []string) (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration, len(s))
+	for _, o := range s {
+		parts := strings.SplitN(o, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("unrecognized tenant idle timeout override %q", o)
+		}
+		d, err := model.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse idle timeout of tenant %s", parts[0])
+		}
+		overrides[parts[0]] = time.Duration(d)
+	}
+	return overrides, nil
+}
+
+func parseTenantLabelValidationOverrides(s []string) (map[string]string, error) {
+	overrides := make(map[string]string, len(s))
+	for _, o := range s {
+		parts := strings.SplitN(o, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("unrecognized tenant label validation override %q", o)
+		}
+		valid := false
+		for _, m := range receive.LabelValidationModes {
+			valid = valid || parts[1] == m
+		}
+		if !valid {
+			return nil, errors.Errorf("label validation of tenant %s must be one of %s, got %q", parts[0], strings.Join(receive.LabelValidationModes, ", "), parts[1])
+		}
+		overrides[parts[0]] = parts[1]
+	}
+	return overrides, nil
+}
+
 // setupAndRunGRPCServer sets up the configuration for the gRPC server.
 // It also sets up a handler for reloading the server if tsdb reloads.
 func setupAndRunGRPCServer(g *run.Group,
@@ -364,8 +597,9 @@ func setupAndRunGRPCServer(g *run.Group,
 					if isReady() {
 						minTime, maxTime := mts.TimeRange()
 						return &infopb.StoreInfo{
-							MinTime: minTime,
-							MaxTime: maxTime,
+							MinTime:          minTime,
+							MaxTime:          maxTime,
+							AsyncReplication: conf.replicationMode == receive.ReplicationModeAsync,
 						}
 					}
 					return nil
@@ -418,6 +652,7 @@ func setupHashring(g *run.Group,
 	hashringChangedChan chan struct{},
 	webHandler *receive.Handler,
 	statusProber prober.Probe,
+	hashringLoaded *prober.Condition,
 	reloadGRPCServer chan struct{},
 	enableIngestion bool,
 ) error {
@@ -491,6 +726,7 @@ func setupHashring(g *run.Group,
 					return nil
 				}
 				webHandler.Hashring(h)
+				hashringLoaded.Met()
 				msg := "hashring has changed; server is not ready to receive web requests"
 				statusProber.NotReady(errors.New(msg))
 				level.Info(logger).Log("msg", msg)
@@ -527,6 +763,7 @@ func startTSDBAndUpload(g *run.Group,
 	upload bool,
 	uploadDone chan struct{},
 	statusProber prober.Probe,
+	walReplay *prober.Condition,
 	bkt objstore.Bucket,
 
 ) error {
@@ -580,9 +817,12 @@ func startTSDBAndUpload(g *run.Group,
 				if err := dbs.Flush(); err != nil {
 					return errors.Wrap(err, "flushing storage")
 				}
+				walReplay.Unmet(errors.New("storage is being opened"))
 				if err := dbs.Open(); err != nil {
+					walReplay.Unmet(err)
 					return errors.Wrap(err, "opening storage")
 				}
+				walReplay.Met()
 				if upload {
 					uploadC <- struct{}{}
 					<-uploadDone
@@ -740,6 +980,7 @@ type receiveConfig struct {
 
 	refreshInterval   *model.Duration
 	endpoint          string
+	mode              string
 	tenantHeader      string
 	tenantField       string
 	tenantLabelName   string
@@ -748,21 +989,72 @@ type receiveConfig struct {
 	replicationFactor uint64
 	forwardTimeout    *model.Duration
 
+	replicationCompression string
+
+	replicationMode             string
+	asyncReplicationQueueSize   int
+	asyncReplicationConcurrency int
+	asyncReplicationMaxRetries  int
+
+	forwardCircuitBreakerFailures     int
+	forwardCircuitBreakerOpenDuration *model.Duration
+
+	admissionMaxConcurrency  int
+	admissionTenantQueueSize int
+	admissionTenantWeights   []string
+	admissionRetryAfter      *model.Duration
+
+	debugHeader bool
+
+	remoteHashrings              *extflag.PathOrContent
+	remoteReplicationFactor      uint64
+	remoteReplicationQueueSize   int
+	remoteReplicationConcurrency int
+	remoteReplicationMaxRetries  int
+
+	tenantSources               []string
+	tenantExtractionLabel       string
+	removeTenantExtractionLabel bool
+	rejectMissingTenant         bool
+
 	tsdbMinBlockDuration       *model.Duration
 	tsdbMaxBlockDuration       *model.Duration
 	tsdbAllowOverlappingBlocks bool
 	tsdbMaxExemplars           int64
 
+	tsdbHeadCompactionConcurrency int
+	tsdbHeadCompactionStagger     *model.Duration
+
 	walCompression bool
 	noLockFile     bool
 
+	tenantIdleTimeout          *model.Duration
+	tenantIdleTimeoutOverrides []string
+
 	hashFunc string
 
 	ignoreBlockSize       bool
 	allowOutOfOrderUpload bool
+	uploadExemplars       bool
 
 	reqLogConfig      *extflag.PathOrContent
 	relabelConfigPath *extflag.PathOrContent
+
+	tenantRelabelConfigPath           *extflag.PathOrContent
+	tenantRelabelConfigReloadInterval *model.Duration
+
+	tenantLimitsConfigPath           *extflag.PathOrContent
+	tenantLimitsConfigReloadInterval *model.Duration
+
+	labelValidation          string
+	labelValidationOverrides []string
+
+	metricsTenants       []string
+	ingestionLagInterval *model.Duration
+
+	diskHighWatermark     float64
+	diskLowWatermark      float64
+	diskPressureRetention *model.Duration
 }
 
 func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -809,22 +1101,104 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("receive.local-endpoint", "Endpoint of local receive node. Used to identify the local node in the hashring configuration. If it's empty AND hashring configuration was provided, it means that receive will run in RoutingOnly mode.").StringVar(&rc.endpoint)
 
+	cmd.Flag("receive.mode", "Mode of the receiver. \""+receiveModeRouter+"\" only forwards write requests to the receivers in the hashring and does not run a local TSDB. "+
+		"\""+receiveModeIngestor+"\" only writes to the local TSDB and accepts only write requests forwarded by routers. \""+receiveModeBoth+"\" routes and ingests write requests. "+
+		"If empty, the mode is determined from the hashring configuration and --receive.local-endpoint flags.").
+		Default("").EnumVar(&rc.mode, "", receiveModeRouter, receiveModeIngestor, receiveModeBoth)
+
 	cmd.Flag("receive.tenant-header", "HTTP header to determine tenant for write requests.").Default(receive.DefaultTenantHeader).StringVar(&rc.tenantHeader)
 
-	cmd.Flag("receive.tenant-certificate-field", "Use TLS client's certificate field to determine tenant for write requests. Must be one of "+receive.CertificateFieldOrganization+", "+receive.CertificateFieldOrganizationalUnit+" or "+receive.CertificateFieldCommonName+". This setting will cause the receive.tenant-header flag value to be ignored.").Default("").EnumVar(&rc.tenantField, "", receive.CertificateFieldOrganization, receive.CertificateFieldOrganizationalUnit, receive.CertificateFieldCommonName)
+	cmd.Flag("receive.tenant-certificate-field", "Use TLS client's certificate field to determine tenant for write requests. Must be one of "+receive.CertificateFieldOrganization+", "+receive.CertificateFieldOrganizationalUnit+" or "+receive.CertificateFieldCommonName+". This setting will cause the receive.tenant-header flag value to be ignored, unless --receive.tenant-extraction-order is given.").Default("").EnumVar(&rc.tenantField, "", receive.CertificateFieldOrganization, receive.CertificateFieldOrganizationalUnit, receive.CertificateFieldCommonName)
+
+	cmd.Flag("receive.tenant-extraction-order", "Source to determine the tenant of write requests from, in order of precedence (repeated). Must be one of "+receive.TenantSourceHeader+", "+receive.TenantSourceCertificate+" or "+receive.TenantSourceLabel+". The first source providing a tenant wins. If none is given, the tenant is taken from the TLS client's certificate if --receive.tenant-certificate-field is set, and from the --receive.tenant-header otherwise.").
+		EnumsVar(&rc.tenantSources, receive.TenantSourceHeader, receive.TenantSourceCertificate, receive.TenantSourceLabel)
+
+	cmd.Flag("receive.tenant-extraction-label", "Label of the incoming series to determine the tenant of write requests from, with the "+receive.TenantSourceLabel+" tenant extraction source. All series of a write request having the label must have the same value.").Default("").StringVar(&rc.tenantExtractionLabel)
+
+	cmd.Flag("receive.tenant-extraction-label-remove", "Remove the --receive.tenant-extraction-label from the incoming series before writing them.").Default("false").BoolVar(&rc.removeTenantExtractionLabel)
 
 	cmd.Flag("receive.default-tenant-id", "Default tenant ID to use when none is provided via a header.").Default(receive.DefaultTenant).StringVar(&rc.defaultTenantID)
 
+	cmd.Flag("receive.reject-missing-tenant", "Reject write requests whose tenant can't be determined from any of the --receive.tenant-extraction-order sources with 400 Bad Request, instead of using the --receive.default-tenant-id.").Default("false").BoolVar(&rc.rejectMissingTenant)
+
 	cmd.Flag("receive.tenant-label-name", "Label name through which the tenant will be announced.").Default(receive.DefaultTenantLabel).StringVar(&rc.tenantLabelName)
 
+	rc.tenantIdleTimeout = extkingpin.ModelDuration(cmd.Flag("receive.tenant-idle-timeout", "Prune the TSDB of tenants that have not appended any samples for longer than this duration: its head is flushed and uploaded, and its local data removed. The TSDB is opened again once the tenant writes again. 0s disables it, so tenants are pruned only once past the retention.").Default("0s"))
+
+	cmd.Flag("receive.tenant-idle-timeout-override", "Idle timeout of a single tenant, overriding --receive.tenant-idle-timeout (repeated).").PlaceHolder("<tenant>=<duration>").StringsVar(&rc.tenantIdleTimeoutOverrides)
+
+	cmd.Flag("receive.metrics-tenant", "Tenant labelled by its ID in the write duration metrics of local appends, forwards and replication quorums, in the ingestion lag metrics, in the invalid labels metrics and in the admission metrics (repeated). All other tenants are labelled as \""+receive.OtherTenantsLabel+"\". If none is given, all tenants are labelled by their ID, except in the admission metrics, where only the first 100 tenants are.").StringsVar(&rc.metricsTenants)
+
+	rc.ingestionLagInterval = extkingpin.ModelDuration(cmd.Flag("receive.ingestion-lag-interval", "Interval between updates of the ingestion lag metrics of the tenants, i.e. the time since the most recent sample in the head of their TSDB. Tenants are labelled as set by --receive.metrics-tenant. Disabled by default, as they add series per tenant.").Default("0s"))
+
+	cmd.Flag("receive.disk-watermark.high", "Disk usage ratio of the data directory at which local writes are rejected with 503 Service Unavailable, while uploads of blocks continue. 0 disables it.").
+		Default("0").Float64Var(&rc.diskHighWatermark)
+
+	cmd.Flag("receive.disk-watermark.low", "Disk usage ratio of the data directory below which local writes are accepted again after the high watermark was reached. 0 means the high watermark.").
+		Default("0").Float64Var(&rc.diskLowWatermark)
+
+	rc.diskPressureRetention = extkingpin.ModelDuration(cmd.Flag("receive.disk-watermark.retention", "Local retention of blocks already uploaded to object storage while the disk usage is above the high watermark, overriding --tsdb.retention. The oldest uploaded blocks are deleted first. 0d disables it.").Default("0d"))
+
 	cmd.Flag("receive.replica-header", "HTTP header specifying the replica number of a write request.").Default(receive.DefaultReplicaHeader).StringVar(&rc.replicaHeader)
 
 	cmd.Flag("receive.replication-factor", "How many times to replicate incoming write requests.").Default("1").Uint64Var(&rc.replicationFactor)
 
+	cmd.Flag("receive.replication-compression", "Compression of the write requests forwarded and replicated to other receivers. Must be one of "+strings.Join(receive.ReplicationCompressions, ", ")+". Receivers not supporting it are sent uncompressed requests.").
+		Default(receive.ReplicationCompressionNone).EnumVar(&rc.replicationCompression, receive.ReplicationCompressions...)
+
+	cmd.Flag("receive.replication-mode", "Replication mode of incoming write requests. 'sync': write requests are acknowledged once a quorum of their replicas was written. 'async': write requests are acknowledged once their first replica, the local one if possible, was written, and the other replicas are written asynchronously. The async mode bypasses the write quorum: replicas are dropped without clients being told if they can't be written, trading durability for latency.").
+		Default(receive.ReplicationModeSync).EnumVar(&rc.replicationMode, receive.ReplicationModes...)
+
+	cmd.Flag("receive.async-replication.queue-size", "Number of replicas waiting to be written asynchronously in the async replication mode beyond which new ones are dropped.").Default("10000").IntVar(&rc.asyncReplicationQueueSize)
+
+	cmd.Flag("receive.async-replication.concurrency", "Number of replicas written asynchronously concurrently in the async replication mode.").Default("10").IntVar(&rc.asyncReplicationConcurrency)
+
+	cmd.Flag("receive.async-replication.max-retries", "Number of retries of failed replicas in the async replication mode before their time series are dropped.").Default("5").IntVar(&rc.asyncReplicationMaxRetries)
+
 	rc.forwardTimeout = extkingpin.ModelDuration(cmd.Flag("receive-forward-timeout", "Timeout for each forward request.").Default("5s").Hidden())
 
+	cmd.Flag("receive.forward-circuit-breaker.failures", "Number of consecutive failed write requests forwarded to a receiver after which its circuit opens: write requests to it fail without being sent, counting as failed replicas, until a probing write request succeeds. 0 disables the circuit breakers.").
+		Default("0").IntVar(&rc.forwardCircuitBreakerFailures)
+
+	rc.forwardCircuitBreakerOpenDuration = extkingpin.ModelDuration(cmd.Flag("receive.forward-circuit-breaker.open-duration", "How long the circuit of a receiver stays open before a probing write request is forwarded to it.").Default("30s"))
+
+	cmd.Flag("receive.admission.max-concurrency", "Number of write requests of clients processed concurrently. Further write requests wait in a queue per tenant, and are admitted by weighted fair queuing so that each tenant with waiting write requests gets a share of the slots proportional to its weight. 0 disables the admission control.").
+		Default("0").IntVar(&rc.admissionMaxConcurrency)
+
+	cmd.Flag("receive.admission.tenant-queue-size", "Number of write requests of a tenant waiting for admission beyond which new ones are rejected with 429 Too Many Requests.").Default("100").IntVar(&rc.admissionTenantQueueSize)
+
+	cmd.Flag("receive.admission.tenant-weight", "Weight of a single tenant in the admission of write requests, 1 for tenants without weight (repeated).").PlaceHolder("<tenant>=<weight>").StringsVar(&rc.admissionTenantWeights)
+
+	rc.admissionRetryAfter = extkingpin.ModelDuration(cmd.Flag("receive.admission.retry-after", "Duration clients are told to wait in the Retry-After header of the write requests rejected by the admission control.").Default("1s"))
+
+	cmd.Flag("receive.debug-header", "If true, the responses to write requests with the "+receive.DebugHeader+": true header list the endpoints the batches of their series were routed to, the replicas that succeeded and failed, and whether the write quorum tolerated failed replicas, in their headers and trace span.").
+		Default("false").BoolVar(&rc.debugHeader)
+
+	rc.remoteHashrings = extflag.RegisterPathOrContent(cmd, "receive.remote-hashrings", "JSON file that contains the hashring configuration of a remote cluster. Write requests of clients are replicated asynchronously to its endpoints once they were written to the local hashring. See format details: https://thanos.io/tip/components/receive.md/#remote-replication", extflag.WithEnvSubstitution())
+
+	cmd.Flag("receive.remote-replication-factor", "How many endpoints of the remote hashring to replicate incoming write requests to.").Default("1").Uint64Var(&rc.remoteReplicationFactor)
+
+	cmd.Flag("receive.remote-replication.queue-size", "Number of write requests waiting for replication to the remote hashring beyond which new ones are dropped.").Default("10000").IntVar(&rc.remoteReplicationQueueSize)
+
+	cmd.Flag("receive.remote-replication.concurrency", "Number of write requests replicated to the remote hashring concurrently.").Default("10").IntVar(&rc.remoteReplicationConcurrency)
+
+	cmd.Flag("receive.remote-replication.max-retries", "Number of retries of failed remote writes to the remote hashring before their time series are dropped.").Default("5").IntVar(&rc.remoteReplicationMaxRetries)
+
 	rc.relabelConfigPath = extflag.RegisterPathOrContent(cmd, "receive.relabel-config", "YAML file that contains relabeling configuration.", extflag.WithEnvSubstitution())
 
+	rc.tenantRelabelConfigPath = extflag.RegisterPathOrContent(cmd, "receive.tenant-relabel-config", "YAML file that contains write relabeling configuration per tenant, applied after the global relabeling and before routing. See format details: https://thanos.io/tip/components/receive.md/#per-tenant-relabeling", extflag.WithEnvSubstitution())
+
+	rc.tenantRelabelConfigReloadInterval = extkingpin.ModelDuration(cmd.Flag("receive.tenant-relabel-config-reload-interval", "Interval between reloads of the tenant relabel config file. 0s disables reloading.").Default("1m"))
+
+	rc.tenantLimitsConfigPath = extflag.RegisterPathOrContent(cmd, "receive.tenant-limits-config", "YAML file that contains the maximum number of tenants of the receiver and the regular expressions allowing and denying tenant IDs, checked before the TSDB of a new tenant is created. See format details: https://thanos.io/tip/components/receive.md/#tenant-limits", extflag.WithEnvSubstitution())
+
+	rc.tenantLimitsConfigReloadInterval = extkingpin.ModelDuration(cmd.Flag("receive.tenant-limits-config-reload-interval", "Interval between reloads of the tenant limits config file. 0s disables reloading.").Default("1m"))
+
+	cmd.Flag("receive.label-validation", "Validation of the labels of the series of write requests, before relabeling. Label names must be valid Prometheus label names, metric names valid Prometheus metric names, label values valid UTF-8, and label names unique within a series. \""+receive.LabelValidationNone+"\" writes series as they are received. \""+receive.LabelValidationStrict+"\" rejects write requests with invalid series with 400 Bad Request. \""+receive.LabelValidationNormalize+"\" replaces disallowed characters of names with underscores and invalid UTF-8 of values with the replacement character, and drops labels with empty or duplicate names.").
+		Default(receive.LabelValidationNone).EnumVar(&rc.labelValidation, receive.LabelValidationModes...)
+
+	cmd.Flag("receive.label-validation-override", "Label validation of a single tenant, overriding --receive.label-validation (repeated).").PlaceHolder("<tenant>=<mode>").StringsVar(&rc.labelValidationOverrides)
+
 	rc.tsdbMinBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.min-block-duration", "Min duration for local TSDB blocks").Default("2h").Hidden())
 
 	rc.tsdbMaxBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.max-block-duration", "Max duration for local TSDB blocks").Default("2h").Hidden())
@@ -841,6 +1215,12 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 			" ingesting a new exemplar will evict the oldest exemplar from storage. 0 (or less) value of this flag disables exemplars storage.").
 		Default("0").Int64Var(&rc.tsdbMaxExemplars)
 
+	cmd.Flag("tsdb.head-compaction-concurrency", "Maximum number of tenant TSDBs compacting their head at once. Tenant TSDBs are then compacted in the background instead of on their own, so that many tenants don't all compact at the same time. 0 lets each tenant TSDB compact on its own.").
+		Default("0").IntVar(&rc.tsdbHeadCompactionConcurrency)
+
+	rc.tsdbHeadCompactionStagger = extkingpin.ModelDuration(cmd.Flag("tsdb.head-compaction-stagger", "Maximum delay, in the time of the samples, of the compaction of the head of a tenant TSDB after it becomes compactable. Each tenant is delayed by a deterministic offset up to it, so that tenants receiving samples at the same time don't all compact at the same time. Should be less than half of the block duration. Only used with --tsdb.head-compaction-concurrency.").
+		Default("0s"))
+
 	cmd.Flag("hash-func", "Specify which hash function to use when calculating the hashes of produced files. If no function has been specified, it does not happen. This permits avoiding downloading some files twice albeit at some performance cost. Possible values are: \"\", \"SHA256\".").
 		Default("").EnumVar(&rc.hashFunc, "SHA256", "")
 
@@ -852,26 +1232,170 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 			"about order.").
 		Default("false").Hidden().BoolVar(&rc.allowOutOfOrderUpload)
 
+	cmd.Flag("shipper.upload-exemplars", "If true, the exemplars of each tenant are uploaded along with its blocks, so that the store gateways serve them once they are dropped from the exemplar storage. Only the exemplars still in the exemplar storage when a block is uploaded are kept. Requires --tsdb.max-exemplars to be set.").
+		Default("false").BoolVar(&rc.uploadExemplars)
+
 	rc.reqLogConfig = extkingpin.RegisterRequestLoggingFlags(cmd)
 }
 
+// loadTenantRelabelConfigs loads the write relabel configs by tenant from the given config.
+func loadTenantRelabelConfigs(tenantRelabelConfig *extflag.PathOrContent) (map[string][]*relabel.Config, error) {
+	content, err := tenantRelabelConfig.Content()
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return receive.ParseTenantsRelabelConfig(content)
+}
+
+func loadTenantLimits(tenantLimitsConfig *extflag.PathOrContent) (*receive.TenantLimits, error) {
+	content, err := tenantLimitsConfig.Content()
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return receive.ParseTenantLimitsConfig(content)
+}
+
+// validateTenantSources checks that the tenant extraction sources are configured.
+func (rc *receiveConfig) validateTenantSources() error {
+	seen := map[string]struct{}{}
+	for _, source := range rc.tenantSources {
+		if _, ok := seen[source]; ok {
+			return errors.Errorf("tenant extraction source %s given more than once", source)
+		}
+		seen[source] = struct{}{}
+
+		switch source {
+		case receive.TenantSourceCertificate:
+			if rc.tenantField == "" {
+				return errors.New("--receive.tenant-certificate-field is required to determine the tenant from the client certificate")
+			}
+		case receive.TenantSourceLabel:
+			if !model.LabelName.IsValid(model.LabelName(rc.tenantExtractionLabel)) {
+				return errors.Errorf("unsupported format for tenant extraction label, got %q", rc.tenantExtractionLabel)
+			}
+		}
+	}
+	return nil
+}
+
+// newRemoteReplicator returns the replicator of write requests to the remote hashring, or nil if none is configured.
+func newRemoteReplicator(logger log.Logger, reg prometheus.Registerer, conf *receiveConfig, dialOpts []grpc.DialOption) (*receive.RemoteReplicator, error) {
+	content, err := conf.remoteHashrings.Content()
+	if err != nil {
+		return nil, errors.Wrap(err, "get content of remote hashrings configuration")
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	if conf.mode == receiveModeIngestor {
+		return nil, errors.New("remote hashrings cannot be used in ingestor mode, ingestors do not forward write requests")
+	}
+	ring, err := receive.HashringFromConfig(receive.HashringAlgorithm(conf.hashringsAlgorithm), string(content))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse remote hashrings configuration")
+	}
+	return receive.NewRemoteReplicator(log.With(logger, "component", "remote-replicator"), reg, receive.RemoteReplicationOptions{
+		Hashring:          ring,
+		ReplicationFactor: conf.remoteReplicationFactor,
+		QueueSize:         conf.remoteReplicationQueueSize,
+		Concurrency:       conf.remoteReplicationConcurrency,
+		MaxRetries:        conf.remoteReplicationMaxRetries,
+		ForwardTimeout:    time.Duration(*conf.forwardTimeout),
+		DialOpts:          dialOpts,
+	}), nil
+}
+
+// newAsyncReplicator returns the replicator of the replicas written asynchronously, or nil if the replication mode is
+// not async.
+func newAsyncReplicator(logger log.Logger, reg prometheus.Registerer, conf *receiveConfig, dialOpts []grpc.DialOption) (*receive.AsyncReplicator, error) {
+	if conf.replicationMode != receive.ReplicationModeAsync {
+		return nil, nil
+	}
+	if conf.mode == receiveModeIngestor {
+		return nil, errors.New("async replication mode cannot be used in ingestor mode, ingestors do not replicate write requests")
+	}
+	level.Warn(logger).Log("msg", "async replication mode enabled, write requests are acknowledged without write quorum and replicas may be lost",
+		"replication_factor", conf.replicationFactor)
+	return receive.NewAsyncReplicator(log.With(logger, "component", "async-replicator"), reg, receive.AsyncReplicationOptions{
+		QueueSize:      conf.asyncReplicationQueueSize,
+		Concurrency:    conf.asyncReplicationConcurrency,
+		MaxRetries:     conf.asyncReplicationMaxRetries,
+		ForwardTimeout: time.Duration(*conf.forwardTimeout),
+		Compression:    conf.replicationCompression,
+		DialOpts:       dialOpts,
+	}), nil
+}
+
+// newAdmission returns the admission control of the write requests of clients, nil if it is disabled.
+func newAdmission(reg prometheus.Registerer, conf *receiveConfig) (*receive.Admission, error) {
+	if conf.admissionMaxConcurrency <= 0 {
+		return nil, nil
+	}
+	weights := make(map[string]float64, len(conf.admissionTenantWeights))
+	for _, w := range conf.admissionTenantWeights {
+		parts := strings.SplitN(w, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("unrecognized tenant weight %q", w)
+		}
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || weight <= 0 {
+			return nil, errors.Errorf("weight of tenant %s must be a positive number, got %q", parts[0], parts[1])
+		}
+		weights[parts[0]] = weight
+	}
+	return receive.NewAdmission(reg, receive.AdmissionOptions{
+		MaxConcurrency:  conf.admissionMaxConcurrency,
+		TenantQueueSize: conf.admissionTenantQueueSize,
+		TenantWeights:   weights,
+		RetryAfter:      time.Duration(*conf.admissionRetryAfter),
+		MetricsTenants:  conf.metricsTenants,
+	}), nil
+}
+
 // determineMode returns the ReceiverMode that this receiver is configured to run in.
 // This is used to configure this Receiver's forwarding and ingesting behavior at runtime.
-func (rc *receiveConfig) determineMode() receive.ReceiverMode {
+func (rc *receiveConfig) determineMode() (receive.ReceiverMode, error) {
 	// Has the user provided some kind of hashring configuration?
 	hashringSpecified := rc.hashringsFileContent != "" || rc.hashringsFilePath != ""
 	// Has the user specified the --receive.local-endpoint flag?
 	localEndpointSpecified := rc.endpoint != ""
 
+	switch rc.mode {
+	case receiveModeRouter:
+		if !hashringSpecified {
+			return "", errors.New("hashring configuration is required in router mode")
+		}
+		if localEndpointSpecified {
+			return "", errors.New("--receive.local-endpoint cannot be used in router mode, routers do not ingest write requests")
+		}
+		return receive.RouterOnly, nil
+	case receiveModeIngestor:
+		if hashringSpecified {
+			return "", errors.New("hashring configuration cannot be used in ingestor mode, ingestors do not forward write requests")
+		}
+		return receive.IngestorOnly, nil
+	case receiveModeBoth:
+		if !localEndpointSpecified {
+			return "", errors.New("--receive.local-endpoint is required in both mode to identify the local node in the hashring")
+		}
+		return receive.RouterIngestor, nil
+	}
+
 	switch {
 	case hashringSpecified && localEndpointSpecified:
-		return receive.RouterIngestor
+		return receive.RouterIngestor, nil
 	case hashringSpecified && !localEndpointSpecified:
 		// Be careful - if the hashring contains an address that routes to itself and does not specify a local
 		// endpoint - you've just created an infinite loop / fork bomb :)
-		return receive.RouterOnly
+		return receive.RouterOnly, nil
 	default:
 		// hashring configuration has not been provided so we ingest all metrics locally.
-		return receive.IngestorOnly
+		return receive.IngestorOnly, nil
 	}
 }
@@ -5,10 +5,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -30,6 +32,7 @@ import (
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/notifier"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
@@ -38,8 +41,9 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/agent"
 	"github.com/prometheus/prometheus/util/strutil"
+	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/client"
-	"gopkg.in/yaml.v2"
+	"github.com/thanos-io/objstore/providers/filesystem"
 
 	"github.com/thanos-io/thanos/pkg/alert"
 	v1 "github.com/thanos-io/thanos/pkg/api/rule"
@@ -56,6 +60,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/receive"
 	thanosrules "github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
@@ -69,6 +74,19 @@ import (
 	"github.com/thanos-io/thanos/pkg/ui"
 )
 
+const (
+	alertStateBackendTSDB     = "tsdb"
+	alertStateBackendQuery    = "query"
+	alertStateBackendFile     = "file"
+	alertStateBackendObjstore = "objstore"
+
+	// alertStateFile is the file of the data directory snapshots of the state of alerts are persisted in.
+	alertStateFile = "alert-state.json"
+	// alertStateDir is the directory of the bucket snapshots of the state of alerts are persisted in, by hash of
+	// the labels of the ruler.
+	alertStateDir = "rule-alert-state"
+)
+
 type ruleConfig struct {
 	http    httpConfig
 	grpc    grpcConfig
@@ -85,12 +103,22 @@ type ruleConfig struct {
 
 	rwConfig *extflag.PathOrContent
 
-	resendDelay    time.Duration
-	evalInterval   time.Duration
-	ruleFiles      []string
-	objStoreConfig *extflag.PathOrContent
-	dataDir        string
-	lset           labels.Labels
+	resendDelay        time.Duration
+	evalInterval       time.Duration
+	maxConcurrentEvals int
+	perRuleMetrics     bool
+	tenantHeader       string
+	tenantLabel        string
+	allowCrossTenant   bool
+	outageTolerance    time.Duration
+	forGracePeriod     time.Duration
+	ruleFiles          []string
+	objStoreConfig     *extflag.PathOrContent
+	dataDir            string
+	lset               labels.Labels
+
+	alertStateBackend          string
+	alertStateSnapshotInterval time.Duration
 }
 
 func (rc *ruleConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -126,6 +154,24 @@ func registerRule(app *extkingpin.App) {
 		Default("1m").DurationVar(&conf.resendDelay)
 	cmd.Flag("eval-interval", "The default evaluation interval to use.").
 		Default("1m").DurationVar(&conf.evalInterval)
+	cmd.Flag("rules.max-concurrent-evals", "Maximum number of queries of rules evaluated concurrently across all rule groups with concurrent_evaluation enabled.").
+		Default(strconv.Itoa(thanosrules.DefaultMaxConcurrentEvals)).IntVar(&conf.maxConcurrentEvals)
+	cmd.Flag("rules.per-rule-metrics", "Expose the duration, time and failure of the last evaluation of each rule as metrics. Beware that it adds a few series per rule, which can be many with large rule files.").
+		Default("false").BoolVar(&conf.perRuleMetrics)
+	cmd.Flag("rules.tenant-header", "HTTP header the source_tenants of rule groups are set in, joined by '|', on their queries.").
+		Default(receive.DefaultTenantHeader).StringVar(&conf.tenantHeader)
+	cmd.Flag("rules.tenant-label-name", "Label the results and alerts of rule groups with a destination_tenant get, with the destination tenant as value. It should be the tenant label of the blocks of the receivers.").
+		Default(receive.DefaultTenantLabel).StringVar(&conf.tenantLabel)
+	cmd.Flag("rules.allow-cross-tenant-groups", "Allow rule groups querying other tenants than their destination_tenant, e.g. several source_tenants. They are rejected otherwise.").
+		Default("false").BoolVar(&conf.allowCrossTenant)
+	cmd.Flag("for-outage-tolerance", "Max time to tolerate an outage of the ruler for restoring the \"for\" state of alerts.").
+		Default("1h").DurationVar(&conf.outageTolerance)
+	cmd.Flag("for-grace-period", "Minimum duration between an alert and its restored \"for\" state. This is maintained only for alerts with a configured \"for\" time greater than the grace period.").
+		Default("10m").DurationVar(&conf.forGracePeriod)
+	cmd.Flag("alert.state.backend", "Where the \"for\" state of alerts is restored from on startup. 'tsdb': the ALERTS_FOR_STATE series of the local TSDB, not available in stateless mode. 'query': the ALERTS_FOR_STATE series queried through the query APIs, e.g. when they are remote written. 'file': snapshots of the state persisted in the data directory. 'objstore': snapshots of the state persisted in the bucket of --objstore.config.").
+		Default(alertStateBackendTSDB).EnumVar(&conf.alertStateBackend, alertStateBackendTSDB, alertStateBackendQuery, alertStateBackendFile, alertStateBackendObjstore)
+	cmd.Flag("alert.state.snapshot-interval", "Interval of persisting snapshots of the \"for\" state of alerts with the 'file' and 'objstore' --alert.state.backend. A snapshot is also persisted on shutdown.").
+		Default("1m").DurationVar(&conf.alertStateSnapshotInterval)
 
 	conf.rwConfig = extflag.RegisterPathOrContent(cmd, "remote-write.config", "YAML config for the remote-write configurations, that specify servers where samples should be sent to (see https://prometheus.io/docs/prometheus/latest/configuration/configuration/#remote_write). This automatically enables stateless mode for ruler and no series will be stored in the ruler's TSDB. If an empty config (or file) is provided, the flag is ignored and ruler is run with its own TSDB.", extflag.WithEnvSubstitution())
 
@@ -147,6 +193,16 @@ func registerRule(app *extkingpin.App) {
 			return errors.Wrap(err, "parse alert query url")
 		}
 
+		if conf.maxConcurrentEvals < 1 {
+			return errors.New("--rules.max-concurrent-evals must be at least 1")
+		}
+		if conf.tenantHeader == "" {
+			return errors.New("--rules.tenant-header must not be empty")
+		}
+		if conf.alertStateSnapshotInterval <= 0 {
+			return errors.New("--alert.state.snapshot-interval must be positive")
+		}
+
 		tsdbOpts := &tsdb.Options{
 			MinBlockDuration:  int64(time.Duration(*tsdbBlockDuration) / time.Millisecond),
 			MaxBlockDuration:  int64(time.Duration(*tsdbBlockDuration) / time.Millisecond),
@@ -186,8 +242,8 @@ func registerRule(app *extkingpin.App) {
 		if err != nil {
 			return err
 		}
-		if len(conf.alertmgrsConfigYAML) != 0 && len(conf.alertmgr.alertmgrURLs) != 0 {
-			return errors.New("--alertmanagers.url and --alertmanagers.config* parameters cannot be defined at the same time")
+		if len(conf.alertmgrsConfigYAML) != 0 && (len(conf.alertmgr.alertmgrURLs) != 0 || len(conf.alertmgr.alertmgrsSDFiles) != 0) {
+			return errors.New("--alertmanagers.url/--alertmanagers.sd-files and --alertmanagers.config* parameters cannot be defined at the same time")
 		}
 
 		conf.alertRelabelConfigYAML, err = conf.alertmgr.alertRelabelConfigPath.Content()
@@ -321,7 +377,11 @@ func runRule(
 		extprom.WrapRegistererWithPrefix("thanos_rule_query_apis_", reg),
 		dns.ResolverType(conf.query.dnsSDResolver),
 	)
-	var queryClients []*httpconfig.Client
+	var (
+		queryClients []*httpconfig.Client
+		// querySources are the query clients by name of their configuration, for rule groups selecting them by query_source.
+		querySources = map[string][]*httpconfig.Client{}
+	)
 	queryClientMetrics := extpromhttp.NewClientMetrics(extprom.WrapRegistererWith(prometheus.Labels{"client": "query"}, reg))
 	for _, cfg := range queryCfg {
 		cfg.HTTPClientConfig.ClientMetrics = queryClientMetrics
@@ -335,6 +395,9 @@ func runRule(
 			return err
 		}
 		queryClients = append(queryClients, queryClient)
+		if cfg.Name != "" {
+			querySources[cfg.Name] = append(querySources[cfg.Name], queryClient)
+		}
 		// Discover and resolve query addresses.
 		addDiscoveryGroups(g, queryClient, conf.query.dnsSDInterval)
 	}
@@ -351,10 +414,8 @@ func runRule(
 	}
 
 	if len(rwCfgYAML) > 0 {
-		var rwCfg struct {
-			RemoteWriteConfigs []*config.RemoteWriteConfig `yaml:"remote_write,omitempty"`
-		}
-		if err := yaml.Unmarshal(rwCfgYAML, &rwCfg); err != nil {
+		rwCfgs, err := thanosrules.LoadRemoteWriteConfigs(rwCfgYAML)
+		if err != nil {
 			return errors.Wrapf(err, "failed to parse remote write config %v", string(rwCfgYAML))
 		}
 
@@ -366,7 +427,7 @@ func runRule(
 			GlobalConfig: config.GlobalConfig{
 				ExternalLabels: labelsTSDBToProm(conf.lset),
 			},
-			RemoteWriteConfigs: rwCfg.RemoteWriteConfigs,
+			RemoteWriteConfigs: rwCfgs,
 		}); err != nil {
 			return errors.Wrap(err, "applying config to remote storage")
 		}
@@ -402,6 +463,50 @@ func runRule(
 		queryable = tsdbDB
 	}
 
+	var bkt objstore.Bucket
+	confContentYaml, err := conf.objStoreConfig.Content()
+	if err != nil {
+		return err
+	}
+	if len(confContentYaml) > 0 {
+		bkt, err = client.NewBucket(logger, confContentYaml, reg, component.Rule.String())
+		if err != nil {
+			return err
+		}
+
+		// Ensure we close up everything properly.
+		defer func() {
+			if err != nil {
+				runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+			}
+		}()
+	}
+
+	// The 'for' state of alerts is restored from the queryable of the rules manager.
+	restoreQueryable := queryable
+	var alertStateStore *thanosrules.AlertStateStore
+	switch conf.alertStateBackend {
+	case alertStateBackendQuery:
+		restoreQueryable = thanosrules.NewQueryForStateQueryable(
+			queryFuncCreator(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, conf.query.httpMethod, conf.tenantHeader)(storepb.PartialResponseStrategy_WARN),
+			externalLabelNames(conf.lset),
+		)
+	case alertStateBackendFile:
+		fsBkt, err := filesystem.NewBucket(conf.dataDir)
+		if err != nil {
+			return errors.Wrap(err, "create alert state bucket")
+		}
+		alertStateStore = thanosrules.NewAlertStateStore(fsBkt, alertStateFile)
+	case alertStateBackendObjstore:
+		if bkt == nil {
+			return errors.New("--alert.state.backend=objstore requires --objstore.config")
+		}
+		alertStateStore = thanosrules.NewAlertStateStore(bkt, path.Join(alertStateDir, fmt.Sprintf("%x.json", conf.lset.Hash())))
+	}
+	if alertStateStore != nil {
+		restoreQueryable = loadAlertState(logger, alertStateStore)
+	}
+
 	// Build the Alertmanager clients.
 	var alertingCfg alert.AlertingConfig
 	if len(conf.alertmgrsConfigYAML) > 0 {
@@ -418,6 +523,15 @@ func runRule(
 			}
 			alertingCfg.Alertmanagers = append(alertingCfg.Alertmanagers, cfg)
 		}
+		if len(conf.alertmgr.alertmgrsSDFiles) > 0 {
+			cfg := alert.DefaultAlertmanagerConfig()
+			cfg.EndpointsConfig.FileSDConfigs = []httpconfig.FileSDConfig{{
+				Files:           conf.alertmgr.alertmgrsSDFiles,
+				RefreshInterval: model.Duration(conf.alertmgr.alertmgrsSDInterval),
+			}}
+			cfg.Timeout = model.Duration(conf.alertmgr.alertmgrsTimeout)
+			alertingCfg.Alertmanagers = append(alertingCfg.Alertmanagers, cfg)
+		}
 	}
 
 	if len(alertingCfg.Alertmanagers) == 0 {
@@ -490,24 +604,42 @@ func runRule(
 
 		ctx, cancel := context.WithCancel(context.Background())
 		logger = log.With(logger, "component", "rules")
+
+		mgrOpts := []thanosrules.ManagerOption{thanosrules.WithMaxConcurrentEvals(conf.maxConcurrentEvals)}
+		if conf.perRuleMetrics {
+			level.Warn(logger).Log("msg", "per-rule metrics enabled, the number of series exposed grows with the number of rules")
+			mgrOpts = append(mgrOpts, thanosrules.WithPerRuleMetrics())
+		}
+		if conf.tenantLabel != "" {
+			mgrOpts = append(mgrOpts, thanosrules.WithTenantLabel(conf.tenantLabel))
+		}
+		if conf.allowCrossTenant {
+			mgrOpts = append(mgrOpts, thanosrules.WithCrossTenantGroups())
+		}
+		for name, clients := range querySources {
+			mgrOpts = append(mgrOpts, thanosrules.WithQuerySource(name, queryFuncCreator(logger, clients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, conf.query.httpMethod, conf.tenantHeader)))
+		}
 		ruleMgr = thanosrules.NewManager(
 			tracing.ContextWithTracer(ctx, tracer),
 			reg,
 			conf.dataDir,
 			rules.ManagerOptions{
-				NotifyFunc:  notifyFunc,
-				Logger:      logger,
-				Appendable:  appendable,
-				ExternalURL: nil,
-				Queryable:   queryable,
-				ResendDelay: conf.resendDelay,
+				NotifyFunc:      notifyFunc,
+				Logger:          logger,
+				Appendable:      appendable,
+				ExternalURL:     nil,
+				Queryable:       restoreQueryable,
+				ResendDelay:     conf.resendDelay,
+				OutageTolerance: conf.outageTolerance,
+				ForGracePeriod:  conf.forGracePeriod,
 			},
-			queryFuncCreator(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, conf.query.httpMethod),
+			queryFuncCreator(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, conf.query.httpMethod, conf.tenantHeader),
 			conf.lset,
 			// In our case the querying URL is the external URL because in Prometheus
 			// --web.external-url points to it i.e. it points at something where the user
 			// could execute the alert or recording rule's expression and get results.
 			conf.alertQueryURL.String(),
+			mgrOpts...,
 		)
 
 		// Schedule rule manager that evaluates rules.
@@ -521,9 +653,32 @@ func runRule(
 			ruleMgr.Stop()
 		})
 	}
+	// Persist snapshots of the state of alerts.
+	if alertStateStore != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			err := runutil.Repeat(conf.alertStateSnapshotInterval, ctx.Done(), func() error {
+				saveAlertState(ctx, logger, ruleMgr, alertStateStore)
+				return nil
+			})
+
+			// Persist the state on shutdown too, so that it is restored as of the time of the shutdown.
+			saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer saveCancel()
+			saveAlertState(saveCtx, logger, ruleMgr, alertStateStore)
+			return err
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	// Run the alert sender.
+	var senderOpts []alert.SenderOption
+	if conf.alertmgr.alertmgrsMaxFailures > 0 {
+		senderOpts = append(senderOpts, alert.WithFailureCooldown(conf.alertmgr.alertmgrsMaxFailures, conf.alertmgr.alertmgrsCooldown))
+	}
+	sdr := alert.NewSender(logger, reg, alertmgrs, senderOpts...)
 	{
-		sdr := alert.NewSender(logger, reg, alertmgrs)
 		ctx, cancel := context.WithCancel(context.Background())
 		ctx = tracing.ContextWithTracer(ctx, tracer)
 
@@ -661,7 +816,7 @@ func runRule(
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
 		ui.NewRuleUI(logger, reg, ruleMgr, conf.alertQueryURL.String(), conf.web.externalPrefix, conf.web.prefixHeaderName).Register(router, ins)
 
-		api := v1.NewRuleAPI(logger, reg, thanosrules.NewGRPCClient(ruleMgr), ruleMgr, conf.web.disableCORS, flagsMap)
+		api := v1.NewRuleAPI(logger, reg, thanosrules.NewGRPCClient(ruleMgr), ruleMgr, sdr, conf.web.disableCORS, flagsMap)
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
 		srv := httpserver.New(logger, reg, comp, httpProbe,
@@ -683,27 +838,11 @@ func runRule(
 		})
 	}
 
-	confContentYaml, err := conf.objStoreConfig.Content()
-	if err != nil {
-		return err
-	}
-
-	if len(confContentYaml) > 0 {
+	if bkt != nil {
 		// The background shipper continuously scans the data directory and uploads
 		// new blocks to Google Cloud Storage or an S3-compatible storage service.
-		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Rule.String())
-		if err != nil {
-			return err
-		}
-
-		// Ensure we close up everything properly.
-		defer func() {
-			if err != nil {
-				runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
-			}
-		}()
-
-		s := shipper.New(logger, reg, conf.dataDir, bkt, func() labels.Labels { return conf.lset }, metadata.RulerSource, false, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc))
+		s := shipper.New(logger, reg, conf.dataDir, bkt, func() labels.Labels { return conf.lset }, metadata.RulerSource, false, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc)).
+			WithUploadVerification(shipper.UploadVerification(conf.shipper.uploadVerification))
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -727,6 +866,42 @@ func runRule(
 	return nil
 }
 
+// loadAlertState returns the queryable to restore the state of alerts from the last snapshot of the store. Nothing is
+// restored if it can't be loaded.
+func loadAlertState(logger log.Logger, s *thanosrules.AlertStateStore) storage.Queryable {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	state, err := s.Load(ctx)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to load the state of alerts, it will not be restored", "err", err)
+	}
+	if state == nil {
+		return (&thanosrules.AlertState{}).Queryable()
+	}
+	level.Info(logger).Log("msg", "loaded the state of alerts", "alerts", len(state.Alerts), "time", timestamp.Time(state.Timestamp))
+	return state.Queryable()
+}
+
+// saveAlertState persists a snapshot of the state of alerts, unless it has not been restored yet.
+func saveAlertState(ctx context.Context, logger log.Logger, m *thanosrules.Manager, s *thanosrules.AlertStateStore) {
+	state, ok := m.AlertState(time.Now())
+	if !ok {
+		return
+	}
+	if err := s.Save(ctx, state); err != nil {
+		level.Warn(logger).Log("msg", "failed to persist the state of alerts", "err", err)
+	}
+}
+
+func externalLabelNames(lset labels.Labels) []string {
+	names := make([]string, 0, len(lset))
+	for _, l := range lset {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
 func removeLockfileIfAny(logger log.Logger, dataDir string) error {
 	absdir, err := filepath.Abs(dataDir)
 	if err != nil {
@@ -793,6 +968,7 @@ func queryFuncCreator(
 	duplicatedQuery prometheus.Counter,
 	ruleEvalWarnings *prometheus.CounterVec,
 	httpMethod string,
+	tenantHeader string,
 ) func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
 
 	// queryFunc returns query function that hits the HTTP query API of query peers in randomized order until we get a result
@@ -816,6 +992,11 @@ func queryFuncCreator(
 		}
 
 		return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+			var headers http.Header
+			if tenants := thanosrules.SourceTenantsFromContext(ctx); len(tenants) > 0 {
+				headers = http.Header{}
+				headers.Set(tenantHeader, strings.Join(tenants, "|"))
+			}
 			for _, i := range rand.Perm(len(queriers)) {
 				promClient := promClients[i]
 				endpoints := removeDuplicateQueryEndpoints(logger, duplicatedQuery, queriers[i].Endpoints())
@@ -825,6 +1006,7 @@ func queryFuncCreator(
 						Deduplicate:             true,
 						PartialResponseStrategy: partialResponseStrategy,
 						Method:                  httpMethod,
+						HTTPHeaders:             headers,
 					})
 					span.Finish()
 
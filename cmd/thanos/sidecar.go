@@ -125,7 +125,8 @@ func runSidecar(
 	}
 
 	grpcProbe := prober.NewGRPC()
-	httpProbe := prober.NewHTTP()
+	readiness := prober.NewReadiness(comp, extprom.WrapRegistererWithPrefix("thanos_", reg))
+	httpProbe := prober.NewHTTP(prober.WithReadiness(readiness))
 	statusProber := prober.Combine(
 		httpProbe,
 		grpcProbe,
@@ -156,14 +157,12 @@ func runSidecar(
 			Help: "Boolean indicator whether the sidecar can reach its Prometheus peer.",
 		})
 
+		externalLabels := readiness.Register("prometheus-external-labels")
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			// Only check Prometheus's flags when upload is enabled.
-			if uploads {
-				// Check prometheus's flags to ensure same sidecar flags.
-				if err := validatePrometheus(ctx, m.client, logger, conf.shipper.ignoreBlockSize, m); err != nil {
-					return errors.Wrap(err, "validate Prometheus flags")
-				}
+			// Check Prometheus's flags to detect agent mode and, when upload is enabled, to ensure same sidecar flags.
+			if err := validatePrometheus(ctx, m.client, logger, uploads, conf.shipper.ignoreBlockSize, m); err != nil {
+				return errors.Wrap(err, "validate Prometheus flags")
 			}
 
 			// We retry infinitely until we reach and fetch BuildVersion from our Prometheus.
@@ -195,6 +194,7 @@ func runSidecar(
 					)
 					promUp.Set(0)
 					statusProber.NotReady(err)
+					externalLabels.Unmet(err)
 					return err
 				}
 
@@ -204,6 +204,7 @@ func runSidecar(
 				)
 				promUp.Set(1)
 				statusProber.Ready()
+				externalLabels.Met()
 				return nil
 			})
 			if err != nil {
@@ -336,8 +337,19 @@ func runSidecar(
 				return errors.Wrapf(err, "aborting as no external labels found after waiting %s", promReadyTimeout)
 			}
 
+			// Agent mode is detected before the external labels are loaded.
+			if m.Agent() {
+				level.Info(logger).Log("msg", "Prometheus runs in agent mode, which does not produce blocks; uploads will be disabled")
+				<-ctx.Done()
+				return nil
+			}
+
 			s := shipper.New(logger, reg, conf.tsdb.path, bkt, m.Labels, metadata.SidecarSource,
-				conf.shipper.uploadCompacted, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc))
+				conf.shipper.uploadCompacted, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc)).
+				WithUploadVerification(shipper.UploadVerification(conf.shipper.uploadVerification))
+			if conf.uploadExemplars {
+				s.WithExemplars(exemplars.NewPrometheus(conf.prometheus.url, m.client, m.Labels).AllSeries)
+			}
 
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
 				if uploaded, err := s.Sync(ctx); err != nil {
@@ -361,7 +373,7 @@ func runSidecar(
 	return nil
 }
 
-func validatePrometheus(ctx context.Context, client *promclient.Client, logger log.Logger, ignoreBlockSize bool, m *promMetadata) error {
+func validatePrometheus(ctx context.Context, client *promclient.Client, logger log.Logger, uploads, ignoreBlockSize bool, m *promMetadata) error {
 	var (
 		flagErr error
 		flags   promclient.Flags
@@ -382,6 +394,16 @@ func validatePrometheus(ctx context.Context, client *promclient.Client, logger l
 		return nil
 	}
 
+	if flags.Agent {
+		level.Info(logger).Log("msg", "found that Prometheus runs in agent mode; no data will be served through the StoreAPI")
+		m.SetAgent(true)
+		return nil
+	}
+	// Only check the TSDB flags when upload is enabled.
+	if !uploads {
+		return nil
+	}
+
 	// Check if compaction is disabled.
 	if flags.TSDBMinTime != flags.TSDBMaxTime {
 		if !ignoreBlockSize {
@@ -406,6 +428,8 @@ type promMetadata struct {
 	maxt        int64
 	labels      labels.Labels
 	promVersion string
+	// agent is true if Prometheus runs in agent mode and has no data to serve.
+	agent bool
 
 	limitMinTime thanosmodel.TimeOrDurationValue
 
@@ -448,9 +472,27 @@ func (s *promMetadata) Timestamps() (mint, maxt int64) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	if s.agent {
+		// Announce an empty time range, so that queriers don't send requests for data Prometheus does not have.
+		return math.MaxInt64, math.MinInt64
+	}
 	return s.mint, s.maxt
 }
 
+func (s *promMetadata) SetAgent(agent bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.agent = agent
+}
+
+func (s *promMetadata) Agent() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.agent
+}
+
 func (s *promMetadata) BuildVersion(ctx context.Context) error {
 	ver, err := s.client.BuildVersion(ctx, s.promURL)
 	if err != nil {
@@ -481,6 +523,8 @@ type sidecarConfig struct {
 	objStore     extflag.PathOrContent
 	shipper      shipperConfig
 	limitMinTime thanosmodel.TimeOrDurationValue
+	// uploadExemplars makes the shipper upload the exemplars of Prometheus along with the blocks.
+	uploadExemplars bool
 }
 
 func (sc *sidecarConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -492,6 +536,8 @@ func (sc *sidecarConfig) registerFlag(cmd extkingpin.FlagClause) {
 	sc.reqLogConfig = extkingpin.RegisterRequestLoggingFlags(cmd)
 	sc.objStore = *extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
 	sc.shipper.registerFlag(cmd)
+	cmd.Flag("shipper.upload-exemplars", "If true, the exemplars of Prometheus are uploaded along with each block, so that the store gateways serve them once Prometheus dropped them. Only the exemplars still in the exemplar storage of Prometheus when the block is uploaded are kept.").
+		Default("false").BoolVar(&sc.uploadExemplars)
 	cmd.Flag("min-time", "Start of time range limit to serve. Thanos sidecar will serve only metrics, which happened later than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
 		Default("0000-01-01T00:00:00Z").SetValue(&sc.limitMinTime)
 }
@@ -6,6 +6,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alecthomas/units"
@@ -14,10 +17,12 @@ import (
 	grpclogging "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
 	"github.com/oklog/run"
+	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/route"
+	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/client"
 
 	commonmodel "github.com/prometheus/common/model"
@@ -28,6 +33,8 @@ import (
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	hidden "github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
@@ -38,6 +45,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/prober"
+	"github.com/thanos-io/thanos/pkg/receive"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
@@ -51,20 +59,32 @@ import (
 type storeConfig struct {
 	indexCacheConfigs           extflag.PathOrContent
 	objStoreConfig              extflag.PathOrContent
+	coldObjStoreConfig          extflag.PathOrContent
 	dataDir                     string
 	grpcConfig                  grpcConfig
 	httpConfig                  httpConfig
 	indexCacheSizeBytes         units.Base2Bytes
 	chunkPoolSize               units.Base2Bytes
+	chunkPoolMinBucketSize      units.Base2Bytes
+	chunkPoolMaxBucketSize      units.Base2Bytes
+	chunksPrefetchBudget        units.Base2Bytes
+	labelIndexMaxSize           units.Base2Bytes
+	labelIndexCacheSize         units.Base2Bytes
+	chunkSlicingEnabled         bool
 	maxSampleCount              uint64
 	maxTouchedSeriesCount       uint64
+	tenantLabelName             string
+	tenantLimitsConfig          extflag.PathOrContent
+	tenantLimitsReloadInterval  time.Duration
 	maxConcurrency              int
+	seriesStreamWindowSize      units.Base2Bytes
 	component                   component.StoreAPI
 	debugLogging                bool
 	syncInterval                time.Duration
 	blockSyncConcurrency        int
 	blockMetaFetchConcurrency   int
 	filterConf                  *store.FilterConfig
+	timePartitions              []string
 	selectorRelabelConf         extflag.PathOrContent
 	advertiseCompatibilityLabel bool
 	consistencyDelay            commonmodel.Duration
@@ -72,11 +92,32 @@ type storeConfig struct {
 	webConfig                   webConfig
 	postingOffsetsInMemSampling int
 	cachingBucketConfig         extflag.PathOrContent
+	readReplicasConfig          extflag.PathOrContent
 	reqLogConfig                *extflag.PathOrContent
 	lazyIndexReaderEnabled      bool
 	lazyIndexReaderIdleTimeout  time.Duration
+	exemplarsEnabled            bool
+
+	indexHeaderVerifyOnLoad    bool
+	indexHeaderVerifyOnStartup bool
+
+	metricNameFilterFalsePositiveRate float64
+	metricNameFilterLease             time.Duration
+
+	cacheWarmupMaxEntries     int
+	cacheWarmupExportInterval time.Duration
+	cacheWarmupTimeout        time.Duration
+	cacheWarmupGatesReadiness bool
+
+	initialSyncRecentWindow     commonmodel.Duration
+	initialSyncWaitForAllBlocks bool
 }
 
+const (
+	storeDefaultMinTime = "0000-01-01T00:00:00Z"
+	storeDefaultMaxTime = "9999-12-31T23:59:59Z"
+)
+
 func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	sc.httpConfig = *sc.httpConfig.registerFlag(cmd)
 	sc.grpcConfig = *sc.grpcConfig.registerFlag(cmd)
@@ -97,9 +138,44 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 		extflag.WithEnvSubstitution(),
 	)
 
+	sc.readReplicasConfig = *extflag.RegisterPathOrContent(cmd, "store.read-replicas.config",
+		"YAML that contains the bucket configurations of read replicas of the object storage, in the order they are read from before the bucket of --objstore.config. See format details: https://thanos.io/tip/components/store.md/#read-replicas",
+		extflag.WithEnvSubstitution(),
+	)
+
 	cmd.Flag("chunk-pool-size", "Maximum size of concurrently allocatable bytes reserved strictly to reuse for chunks in memory.").
 		Default("2GB").BytesVar(&sc.chunkPoolSize)
 
+	cmd.Flag("store.chunk-pool.min-bucket-size", "Size of the smallest byte slices reused for chunks. The chunk pool keeps byte slices in buckets doubling in size from this size up to --store.chunk-pool.max-bucket-size.").
+		Default("64KiB").BytesVar(&sc.chunkPoolMinBucketSize)
+
+	cmd.Flag("store.chunk-pool.max-bucket-size", "Size of the largest byte slices reused for chunks. Larger byte slices are allocated for each request and not reused.").
+		Default("64MiB").BytesVar(&sc.chunkPoolMaxBucketSize)
+
+	cmd.Flag("store.chunks-prefetch-budget", "Maximum bytes of chunk ranges each Series call downloads ahead of decoding them, so that ranges are downloaded concurrently from object storage. The bytes are borrowed from the chunk pool. 0 disables read-ahead.").
+		Default("0").BytesVar(&sc.chunksPrefetchBudget)
+
+	cmd.Flag("store.label-index.max-size", "Maximum size of the label-index files of the blocks, written by compactors with --compact.label-index, used to answer label names and values requests without matchers. They are downloaded on first use and kept in memory up to --store.label-index.cache-size. Blocks with larger label-index files are answered from their index-header. 0 disables the label-index files.").
+		Default("32MiB").BytesVar(&sc.labelIndexMaxSize)
+
+	cmd.Flag("store.label-index.cache-size", "Total size of the label-index files kept in memory. The least recently used ones are dropped to make room for others, and downloaded again on their next use. 0 disables the label-index files.").
+		Default("512MiB").BytesVar(&sc.labelIndexCacheSize)
+
+	cmd.Flag("store.enable-chunk-slicing", "If true, the raw chunks sent by Series calls whose hints ask for it, as set by queriers with --query.slice-chunks, are cut down to the samples within the requested time range, plus one sample on each side. It trades CPU to decode and encode the chunks for less data sent.").
+		Default("false").BoolVar(&sc.chunkSlicingEnabled)
+
+	cmd.Flag("store.cache-warmup.max-entries", "Maximum number of the matcher sets most frequently used per block by Series calls, which are exported periodically to the data directory and fetched into the index cache on startup. 0 disables index cache warmup.").
+		Default("0").IntVar(&sc.cacheWarmupMaxEntries)
+
+	cmd.Flag("store.cache-warmup.export-interval", "Interval between exports of the index cache warmup entries to the data directory.").
+		Default("5m").DurationVar(&sc.cacheWarmupExportInterval)
+
+	cmd.Flag("store.cache-warmup.timeout", "Maximum duration of the index cache warmup on startup. The remaining entries are not warmed once it is exceeded.").
+		Default("1m").DurationVar(&sc.cacheWarmupTimeout)
+
+	cmd.Flag("store.cache-warmup.gate-readiness", "If true, the store is not ready until the index cache warmup finished. Otherwise the index cache is warmed up in the background after the initial block sync.").
+		Default("true").BoolVar(&sc.cacheWarmupGatesReadiness)
+
 	cmd.Flag("store.grpc.series-sample-limit",
 		"Maximum amount of samples returned via a single Series call. The Series call fails if this limit is exceeded. 0 means no limit. NOTE: For efficiency the limit is internally implemented as 'chunks limit' considering each chunk contains 120 samples (it's the max number of samples each chunk can contain), so the actual number of samples might be lower, even though the maximum could be hit.").
 		Default("0").Uint64Var(&sc.maxSampleCount)
@@ -108,15 +184,38 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"Maximum amount of touched series returned via a single Series call. The Series call fails if this limit is exceeded. 0 means no limit.").
 		Default("0").Uint64Var(&sc.maxTouchedSeriesCount)
 
+	cmd.Flag("store.tenant-label-name", "External label of the blocks identifying their tenant, the limits of --store.tenant-limits-config are enforced per value of this label.").
+		Default(receive.DefaultTenantLabel).StringVar(&sc.tenantLabelName)
+
+	sc.tenantLimitsConfig = *extflag.RegisterPathOrContent(cmd, "store.tenant-limits-config",
+		"YAML file that contains the limits of the series, chunks and bytes touched by a single Series call in the blocks of each tenant, in addition to the overall limits. See format details: https://thanos.io/tip/components/store.md/#tenant-limits",
+		extflag.WithEnvSubstitution(),
+	)
+
+	cmd.Flag("store.tenant-limits-config-reload-interval", "Interval between reloads of the tenant limits config file. 0s disables reloading.").
+		Default("1m").DurationVar(&sc.tenantLimitsReloadInterval)
+
 	cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of concurrent Series calls.").Default("20").IntVar(&sc.maxConcurrency)
 
+	cmd.Flag("store.grpc.series-stream-window-size", "Flow control window of the gRPC streams, bounding the bytes of Series responses sent to a client but not acknowledged by it yet. "+
+		"Series calls of slow clients block once it is exhausted, and the chunks of the series they sent are released meanwhile, unless --store.time-partition is used. "+
+		"0 uses the default windows of gRPC, which grow with the bandwidth of the connection. Values lower than 64KiB are ignored.").
+		Default("0").BytesVar(&sc.seriesStreamWindowSize)
+
 	sc.component = component.Store
 
 	sc.objStoreConfig = *extkingpin.RegisterCommonObjStoreFlags(cmd, "", true)
+	sc.coldObjStoreConfig = *extkingpin.RegisterCommonObjStoreFlags(cmd, "-cold", false, "The blocks the compactor relocated to it are served in addition to the ones of --objstore.config.")
 
 	cmd.Flag("sync-block-duration", "Repeat interval for syncing the blocks between local and remote view.").
 		Default("3m").DurationVar(&sc.syncInterval)
 
+	cmd.Flag("store.initial-sync.recent-window", "Window of recent blocks the initial sync loads first, from the newest to the oldest. The store is ready and serves the loaded blocks once the blocks with samples within the window are loaded, while the older blocks keep loading. Until they are, the store advertises only the time range of which all blocks are loaded.").
+		Default("14d").SetValue(&sc.initialSyncRecentWindow)
+
+	cmd.Flag("store.initial-sync.wait-for-all-blocks", "If true, the store is not ready until the initial sync loaded all blocks, regardless of --store.initial-sync.recent-window.").
+		Default("false").BoolVar(&sc.initialSyncWaitForAllBlocks)
+
 	cmd.Flag("block-sync-concurrency", "Number of goroutines to use when constructing index-cache.json blocks from object storage. Must be equal or greater than 1.").
 		Default("20").IntVar(&sc.blockSyncConcurrency)
 
@@ -126,10 +225,13 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	sc.filterConf = &store.FilterConfig{}
 
 	cmd.Flag("min-time", "Start of time range limit to serve. Thanos Store will serve only metrics, which happened later than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
-		Default("0000-01-01T00:00:00Z").SetValue(&sc.filterConf.MinTime)
+		Default(storeDefaultMinTime).SetValue(&sc.filterConf.MinTime)
 
 	cmd.Flag("max-time", "End of time range limit to serve. Thanos Store will serve only blocks, which happened earlier than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
-		Default("9999-12-31T23:59:59Z").SetValue(&sc.filterConf.MaxTime)
+		Default(storeDefaultMaxTime).SetValue(&sc.filterConf.MaxTime)
+
+	cmd.Flag("store.time-partition", "Time partition of blocks served by a separate bucket store of this process (repeated), in the <min-time>/<max-time> format with the same time formats as --min-time and --max-time. An empty time leaves that side unbounded. All partitions share the caches and are served through the same gRPC server, but sync their blocks independently. Cannot be used together with --min-time and --max-time.").
+		PlaceHolder("<min-time>/<max-time>").StringsVar(&sc.timePartitions)
 
 	cmd.Flag("debug.advertise-compatibility-label", "If true, Store Gateway in addition to other labels, will advertise special \"@thanos_compatibility_store_type=store\" label set. This makes store Gateway compatible with Querier before 0.8.0").
 		Hidden().Default("true").BoolVar(&sc.advertiseCompatibilityLabel)
@@ -154,9 +256,24 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("store.enable-index-header-lazy-reader", "If true, Store Gateway will lazy memory map index-header only once the block is required by a query.").
 		Default("false").BoolVar(&sc.lazyIndexReaderEnabled)
 
+	cmd.Flag("store.enable-exemplars", "If true, Store Gateway serves the exemplars uploaded along with the blocks, see --shipper.upload-exemplars of sidecar and receive, through the Exemplars API.").
+		Default("false").BoolVar(&sc.exemplarsEnabled)
+
 	cmd.Flag("store.index-header-lazy-reader-idle-timeout", "If index-header lazy reader is enabled and this idle timeout setting is > 0, memory map-ed index-headers will be automatically released after 'idle timeout' inactivity.").
 		Hidden().Default("5m").DurationVar(&sc.lazyIndexReaderIdleTimeout)
 
+	cmd.Flag("index-header.verify-on-load", "If true, Store Gateway verifies each index-header on disk against the index of its block in the bucket before loading it, and rebuilds it from the bucket if it doesn't match, e.g. because it was truncated. Index-headers built by previous versions are rebuilt once.").
+		Default("false").BoolVar(&sc.indexHeaderVerifyOnLoad)
+
+	cmd.Flag("index-header.verify-on-startup", "If true, Store Gateway verifies all the index-headers on disk in the background after the initial sync, and reloads the blocks whose index-header doesn't match with a rebuilt one, even with the lazy index-header reader. Implies --index-header.verify-on-load.").
+		Default("false").BoolVar(&sc.indexHeaderVerifyOnStartup)
+
+	cmd.Flag("store.metric-name-filter-false-positive-rate", "False positive rate of the bloom filter of the metric names of the loaded blocks advertised through the Info API, which queriers use to skip this store for queries of metric names it does not have. The metric names are read from the index-header of each block when loading it. 0 disables the filter. Not advertised with --store.time-partition, where it only skips partitions.").
+		Default("0").Float64Var(&sc.metricNameFilterFalsePositiveRate)
+
+	cmd.Flag("store.metric-name-filter-lease", "Duration for which queriers may skip this store by the metric name filter advertised to them, which must exceed the interval at which they update their endpoints. Loaded blocks with metric names missing from an advertised filter are only queried once its leases expired. 0 disables the advertisement of the filter.").
+		Default("30s").DurationVar(&sc.metricNameFilterLease)
+
 	cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the bucket web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos bucket web UI to be served behind a reverse proxy that strips a URL sub-path.").
 		Default("").StringVar(&sc.webConfig.externalPrefix)
 
@@ -166,9 +283,34 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("web.disable-cors", "Whether to disable CORS headers to be set by Thanos. By default Thanos sets CORS headers to be allowed by all.").
 		Default("false").BoolVar(&sc.webConfig.disableCORS)
 
+	cmd.Flag("web.read-write", "Allow blocks to be marked and unmarked for deletion and no compaction through the bucket web UI and its blocks API. Disable with --no-web.read-write to make them read-only.").
+		Default("true").BoolVar(&sc.webConfig.readWrite)
+
 	sc.reqLogConfig = extkingpin.RegisterRequestLoggingFlags(cmd)
 }
 
+// loadStoreTenantLimits loads the tenant limits configuration, nil if there is none.
+func loadStoreTenantLimits(tenantLabel string, tenantLimitsConfig *extflag.PathOrContent) (*store.TenantLimits, error) {
+	content, err := tenantLimitsConfig.Content()
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return store.ParseTenantLimitsConfig(tenantLabel, content)
+}
+
+// warmupIndexCache fetches the postings and series of the warmup entries into the index cache, within the timeout.
+func warmupIndexCache(ctx context.Context, logger log.Logger, bs *store.BucketStore, entries []store.CacheWarmupEntry, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	begin := time.Now()
+	warmed := bs.WarmupIndexCache(ctx, entries)
+	level.Info(logger).Log("msg", "index cache warmed up", "warmed", warmed, "entries", len(entries), "duration", time.Since(begin).String())
+}
+
 // registerStore registers a store command.
 func registerStore(app *extkingpin.App) {
 	cmd := app.Command(component.Store.String(), "Store node giving access to blocks in a bucket provider. Now supported GCS, S3, Azure, Swift, Tencent COS and Aliyun OSS.")
@@ -181,6 +323,12 @@ func registerStore(app *extkingpin.App) {
 			return errors.Errorf("invalid argument: --min-time '%s' can't be greater than --max-time '%s'",
 				conf.filterConf.MinTime, conf.filterConf.MaxTime)
 		}
+		if len(conf.timePartitions) > 0 && !isDefaultStoreTimeRange(conf.filterConf) {
+			return errors.New("invalid argument: --store.time-partition can't be used together with --min-time and --max-time")
+		}
+		if conf.metricNameFilterFalsePositiveRate < 0 || conf.metricNameFilterFalsePositiveRate >= 1 {
+			return errors.Errorf("invalid argument: --store.metric-name-filter-false-positive-rate must be within [0, 1), got %v", conf.metricNameFilterFalsePositiveRate)
+		}
 
 		httpLogOpts, err := logging.ParseHTTPOptions("", conf.reqLogConfig)
 		if err != nil {
@@ -218,7 +366,8 @@ func runStore(
 	flagsMap map[string]string,
 ) error {
 	grpcProbe := prober.NewGRPC()
-	httpProbe := prober.NewHTTP()
+	readiness := prober.NewReadiness(conf.component, extprom.WrapRegistererWithPrefix("thanos_", reg))
+	httpProbe := prober.NewHTTP(prober.WithReadiness(readiness))
 	statusProber := prober.Combine(
 		httpProbe,
 		grpcProbe,
@@ -248,11 +397,33 @@ func runStore(
 		return err
 	}
 
-	bkt, err := client.NewBucket(logger, confContentYaml, reg, conf.component.String())
+	coldConfContentYaml, err := conf.coldObjStoreConfig.Content()
+	if err != nil {
+		return err
+	}
+
+	// The bucket and meta fetcher metrics of both tiers have a tier label.
+	tierReg := prometheus.Registerer(reg)
+	if len(coldConfContentYaml) > 0 {
+		tierReg = prometheus.WrapRegistererWith(prometheus.Labels{"tier": ""}, reg)
+	}
+
+	bkt, err := client.NewBucket(logger, confContentYaml, tierReg, conf.component.String())
 	if err != nil {
 		return errors.Wrap(err, "create bucket client")
 	}
 
+	readReplicasConfigYaml, err := conf.readReplicasConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get read replicas configuration")
+	}
+	if len(readReplicasConfigYaml) > 0 {
+		bkt, err = store.NewReadReplicasBucketFromYaml(logger, reg, readReplicasConfigYaml, bkt, conf.component.String())
+		if err != nil {
+			return errors.Wrap(err, "create read replicas bucket")
+		}
+	}
+
 	cachingBucketConfigYaml, err := conf.cachingBucketConfig.Content()
 	if err != nil {
 		return errors.Wrap(err, "get caching bucket configuration")
@@ -282,6 +453,11 @@ func runStore(
 		return errors.Wrap(err, "get content of index cache configuration")
 	}
 
+	tenantLimits, err := loadStoreTenantLimits(conf.tenantLabelName, &conf.tenantLimitsConfig)
+	if err != nil {
+		return errors.Wrap(err, "load tenant limits configuration")
+	}
+
 	// Create the index cache loading its config from config file, while keeping
 	// backward compatibility with the pre-config file era.
 	var indexCache storecache.IndexCache
@@ -297,19 +473,6 @@ func runStore(
 		return errors.Wrap(err, "create index cache")
 	}
 
-	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(conf.ignoreDeletionMarksDelay), conf.blockMetaFetchConcurrency)
-	metaFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, bkt, conf.dataDir, extprom.WrapRegistererWithPrefix("thanos_", reg),
-		[]block.MetadataFilter{
-			block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
-			block.NewLabelShardedMetaFilter(relabelConfig),
-			block.NewConsistencyDelayMetaFilter(logger, time.Duration(conf.consistencyDelay), extprom.WrapRegistererWithPrefix("thanos_", reg)),
-			ignoreDeletionMarkFilter,
-			block.NewDeduplicateFilter(conf.blockMetaFetchConcurrency),
-		})
-	if err != nil {
-		return errors.Wrap(err, "meta fetcher")
-	}
-
 	// Limit the concurrency on queries against the Thanos store.
 	if conf.maxConcurrency < 0 {
 		return errors.Errorf("max concurrency value cannot be lower than 0 (got %v)", conf.maxConcurrency)
@@ -317,89 +480,309 @@ func runStore(
 
 	queriesGate := gate.New(extprom.WrapRegistererWithPrefix("thanos_bucket_store_series_", reg), int(conf.maxConcurrency))
 
-	chunkPool, err := store.NewDefaultChunkBytesPool(uint64(conf.chunkPoolSize))
+	chunkPool, err := store.NewChunkBytesPool(int(conf.chunkPoolMinBucketSize), int(conf.chunkPoolMaxBucketSize), uint64(conf.chunkPoolSize))
 	if err != nil {
 		return errors.Wrap(err, "create chunk pool")
 	}
 
-	options := []store.BucketStoreOption{
-		store.WithLogger(logger),
-		store.WithRegistry(reg),
-		store.WithIndexCache(indexCache),
-		store.WithQueryGate(queriesGate),
-		store.WithChunkPool(chunkPool),
-		store.WithFilterConfig(conf.filterConf),
-	}
-
-	if conf.debugLogging {
-		options = append(options, store.WithDebugLogging())
-	}
-
-	bs, err := store.NewBucketStore(
-		bkt,
-		metaFetcher,
-		conf.dataDir,
-		store.NewChunksLimiterFactory(conf.maxSampleCount/store.MaxSamplesPerChunk), // The samples limit is an approximation based on the max number of samples per chunk.
-		store.NewSeriesLimiterFactory(conf.maxTouchedSeriesCount),
-		store.NewGapBasedPartitioner(store.PartitionerMaxGapSize),
-		conf.blockSyncConcurrency,
-		conf.advertiseCompatibilityLabel,
-		conf.postingOffsetsInMemSampling,
-		false,
-		conf.lazyIndexReaderEnabled,
-		conf.lazyIndexReaderIdleTimeout,
-		options...,
-	)
+	partitions, err := storeTimePartitions(conf.filterConf, conf.timePartitions)
 	if err != nil {
-		return errors.Wrap(err, "create object storage store")
+		return err
 	}
 
-	// bucketStoreReady signals when bucket store is ready.
-	bucketStoreReady := make(chan struct{})
-	{
+	// All partitions share the index cache, chunk pool and query gate, as well as the cache of fetched metas of their
+	// tier.
+	baseFetcher, err := block.NewBaseFetcher(logger, conf.blockMetaFetchConcurrency, bkt, conf.dataDir, extprom.WrapRegistererWithPrefix("thanos_", tierReg))
+	if err != nil {
+		return errors.Wrap(err, "create meta fetcher")
+	}
+	var (
+		tierBkts     = map[string]objstore.InstrumentedBucket{"": bkt}
+		tierFetchers = map[string]*block.BaseFetcher{"": baseFetcher}
+	)
+	if len(coldConfContentYaml) > 0 {
+		coldReg := prometheus.WrapRegistererWith(prometheus.Labels{"tier": metadata.ColdTier}, reg)
+		coldBkt, err := client.NewBucket(logger, coldConfContentYaml, coldReg, conf.component.String())
+		if err != nil {
+			return errors.Wrap(err, "create cold bucket client")
+		}
+		coldFetcher, err := block.NewBaseFetcher(logger, conf.blockMetaFetchConcurrency, coldBkt, filepath.Join(conf.dataDir, metadata.ColdTier), extprom.WrapRegistererWithPrefix("thanos_", coldReg))
+		if err != nil {
+			return errors.Wrap(err, "create cold meta fetcher")
+		}
+		tierBkts[metadata.ColdTier], tierFetchers[metadata.ColdTier] = coldBkt, coldFetcher
+		partitions = withColdTierPartitions(partitions)
+	}
+
+	var (
+		timePartitions []store.TimePartition
+		bucketStores   []*store.BucketStore
+		exemplarsSrvs  partitionsExemplarsServer
+		// bucketStoresReady signals when all bucket stores are ready.
+		bucketStoresReady sync.WaitGroup
+		// bucketStoresDone signals when all bucket stores stopped syncing.
+		bucketStoresDone sync.WaitGroup
+		loaded           = newLoadedBlocks(len(partitions))
+	)
+	for i, p := range partitions {
+		i, p := i, p
+
+		partitionLogger, partitionReg, dataDir, initialSyncName := logger, prometheus.Registerer(reg), conf.dataDir, "initial-block-sync"
+		cacheWarmupName := "index-cache-warmup"
+		if p.name != "" {
+			partitionLogger = log.With(logger, "partition", p.name)
+			partitionReg = prometheus.WrapRegistererWith(prometheus.Labels{"partition": p.name}, reg)
+			// Bucket stores remove local data of blocks they do not serve, so partitions need their own directory.
+			dataDir = filepath.Join(conf.dataDir, fmt.Sprintf("partition-%d", i))
+			initialSyncName = fmt.Sprintf("initial-block-sync-%d", i)
+			cacheWarmupName = fmt.Sprintf("index-cache-warmup-%d", i)
+		}
+
+		partitionBkt := tierBkts[p.tier]
+		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(partitionLogger, partitionBkt, time.Duration(conf.ignoreDeletionMarksDelay), conf.blockMetaFetchConcurrency)
+		filters := []block.MetadataFilter{
+			block.NewTierMetaFilter(p.tier),
+			block.NewTimePartitionMetaFilter(p.filterConf.MinTime, p.filterConf.MaxTime),
+			block.NewLabelShardedMetaFilter(relabelConfig),
+			block.NewConsistencyDelayMetaFilter(partitionLogger, time.Duration(conf.consistencyDelay), extprom.WrapRegistererWithPrefix("thanos_", partitionReg)),
+			ignoreDeletionMarkFilter,
+		}
+		if len(coldConfContentYaml) > 0 && p.tier == "" {
+			// Blocks relocated to the cold tier are served by the cold partition of the same time range once it loaded
+			// them, which are the second half of the partitions.
+			filters = append(filters, block.NewRelocatedMetaFilter(ignoreDeletionMarkFilter.DeletionMarkBlocks, func(id ulid.ULID) bool {
+				return bucketStores[i+len(partitions)/2].HasBlock(id)
+			}))
+		}
+		filters = append(filters, block.NewDeduplicateFilter(conf.blockMetaFetchConcurrency))
+		metaFetcher := tierFetchers[p.tier].NewMetaFetcher(extprom.WrapRegistererWithPrefix("thanos_", partitionReg), filters)
+
+		// Each partition syncs independently, so that syncing a large partition does not delay the others.
+		bucketStoresReady.Add(1)
+		bucketStoresDone.Add(1)
+		initialSync := readiness.Register(initialSyncName)
+		var cacheWarmup *prober.Condition
+		if conf.cacheWarmupMaxEntries > 0 && conf.cacheWarmupGatesReadiness {
+			cacheWarmup = readiness.Register(cacheWarmupName)
+		}
+		warmupFile := filepath.Join(dataDir, store.CacheWarmupFilename)
 		ctx, cancel := context.WithCancel(context.Background())
+
+		var (
+			bs            *store.BucketStore
+			warmupEntries []store.CacheWarmupEntry
+			begin         time.Time
+			readyOnce     sync.Once
+		)
+		// markReady is called once the initial sync loaded the recent blocks or all blocks.
+		markReady := func() {
+			readyOnce.Do(func() {
+				level.Info(partitionLogger).Log("msg", "bucket store ready", "init_duration", time.Since(begin).String())
+				initialSync.Met()
+
+				if cacheWarmup != nil {
+					warmupIndexCache(ctx, partitionLogger, bs, warmupEntries, conf.cacheWarmupTimeout)
+					cacheWarmup.Met()
+				} else if len(warmupEntries) > 0 {
+					go warmupIndexCache(ctx, partitionLogger, bs, warmupEntries, conf.cacheWarmupTimeout)
+				}
+				bucketStoresReady.Done()
+			})
+		}
+
+		options := []store.BucketStoreOption{
+			store.WithLogger(partitionLogger),
+			store.WithRegistry(partitionReg),
+			store.WithIndexCache(indexCache),
+			store.WithQueryGate(queriesGate),
+			store.WithChunkPool(chunkPool),
+			store.WithFilterConfig(p.filterConf),
+			store.WithChunksPrefetchBudget(int64(conf.chunksPrefetchBudget)),
+			store.WithLabelIndexMaxSize(int64(conf.labelIndexMaxSize)),
+			store.WithLabelIndexCacheSize(int64(conf.labelIndexCacheSize)),
+			store.WithCacheWarmupTracking(conf.cacheWarmupMaxEntries),
+			store.WithMetricNameFilter(conf.metricNameFilterFalsePositiveRate, conf.metricNameFilterLease),
+			store.WithDeletionMarkFilter(ignoreDeletionMarkFilter),
+		}
+
+		if conf.debugLogging {
+			options = append(options, store.WithDebugLogging())
+		}
+		if conf.chunkSlicingEnabled {
+			options = append(options, store.WithChunkSlicing())
+		}
+		if conf.indexHeaderVerifyOnLoad || conf.indexHeaderVerifyOnStartup {
+			options = append(options, store.WithIndexHeaderVerification())
+		}
+		if !conf.initialSyncWaitForAllBlocks && conf.initialSyncRecentWindow > 0 {
+			// The warmup of the index cache must not hold back the loading of the older blocks.
+			options = append(options, store.WithServeWhileSyncing(time.Duration(conf.initialSyncRecentWindow), func() { go markReady() }))
+		}
+		// Partitions are served through in-process clients, which still use the responses once sent.
+		if len(partitions) == 1 {
+			options = append(options, store.WithSentChunksRelease())
+		}
+
+		bs, err = store.NewBucketStore(
+			partitionBkt,
+			metaFetcher,
+			dataDir,
+			store.NewChunksLimiterFactory(conf.maxSampleCount/store.MaxSamplesPerChunk), // The samples limit is an approximation based on the max number of samples per chunk.
+			store.NewSeriesLimiterFactory(conf.maxTouchedSeriesCount),
+			store.NewGapBasedPartitioner(store.PartitionerMaxGapSize),
+			conf.blockSyncConcurrency,
+			conf.advertiseCompatibilityLabel,
+			conf.postingOffsetsInMemSampling,
+			false,
+			conf.lazyIndexReaderEnabled,
+			conf.lazyIndexReaderIdleTimeout,
+			options...,
+		)
+		if err != nil {
+			cancel()
+			return errors.Wrap(err, "create object storage store")
+		}
+		bs.SetTenantLimits(tenantLimits)
+		timePartitions = append(timePartitions, store.TimePartition{Name: p.name, Store: bs})
+		bucketStores = append(bucketStores, bs)
+		exemplarsSrvs = append(exemplarsSrvs, bs)
+
+		metaFetcher.UpdateOnChange(func(blocks []metadata.Meta, err error) {
+			loaded.set(i, blocks, err)
+		})
+
 		g.Add(func() error {
-			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+			defer bucketStoresDone.Done()
 
-			level.Info(logger).Log("msg", "initializing bucket store")
-			begin := time.Now()
+			// The entries are read before they can be overwritten by the first export.
+			if conf.cacheWarmupMaxEntries > 0 {
+				entries, err := store.ReadCacheWarmupEntries(warmupFile)
+				if err != nil {
+					level.Warn(partitionLogger).Log("msg", "failed to read index cache warmup entries", "err", err)
+				}
+				warmupEntries = entries
+			}
+
+			level.Info(partitionLogger).Log("msg", "initializing bucket store")
+			begin = time.Now()
 			if err := bs.InitialSync(ctx); err != nil {
-				close(bucketStoreReady)
+				readyOnce.Do(func() {
+					initialSync.Unmet(err)
+					bucketStoresReady.Done()
+				})
 				return errors.Wrap(err, "bucket store initial sync")
 			}
-			level.Info(logger).Log("msg", "bucket store ready", "init_duration", time.Since(begin).String())
-			close(bucketStoreReady)
+			level.Info(partitionLogger).Log("msg", "bucket store initial sync done", "sync_duration", time.Since(begin).String())
+			markReady()
+
+			if conf.indexHeaderVerifyOnStartup {
+				go func() {
+					begin := time.Now()
+					if err := bs.VerifyIndexHeaders(ctx); err != nil {
+						level.Warn(partitionLogger).Log("msg", "index-header verification failed", "err", err)
+						return
+					}
+					level.Info(partitionLogger).Log("msg", "index-header verification done", "duration", time.Since(begin).String())
+				}()
+			}
 
 			err := runutil.Repeat(conf.syncInterval, ctx.Done(), func() error {
 				if err := bs.SyncBlocks(ctx); err != nil {
-					level.Warn(logger).Log("msg", "syncing blocks failed", "err", err)
+					level.Warn(partitionLogger).Log("msg", "syncing blocks failed", "err", err)
 				}
 				return nil
 			})
 
-			runutil.CloseWithLogOnErr(logger, bs, "bucket store")
+			runutil.CloseWithLogOnErr(partitionLogger, bs, "bucket store")
 			return err
 		}, func(error) {
 			cancel()
 		})
+
+		if conf.cacheWarmupMaxEntries > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return runutil.Repeat(conf.cacheWarmupExportInterval, ctx.Done(), func() error {
+					// Without Series calls since the last export, the previous entries are kept.
+					if entries := bs.CacheWarmupEntries(); len(entries) > 0 {
+						if err := store.WriteCacheWarmupEntries(warmupFile, entries); err != nil {
+							level.Warn(partitionLogger).Log("msg", "failed to export index cache warmup entries", "err", err)
+						}
+					}
+					return nil
+				})
+			}, func(error) {
+				cancel()
+			})
+		}
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			<-cancel
+			bucketStoresDone.Wait()
+			for tier, b := range tierBkts {
+				runutil.CloseWithLogOnErr(logger, b, "bucket client %s", tier)
+			}
+			return nil
+		}, func(error) {
+			close(cancel)
+		})
+	}
+
+	if conf.tenantLimitsReloadInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(conf.tenantLimitsReloadInterval, ctx.Done(), func() error {
+				limits, err := loadStoreTenantLimits(conf.tenantLabelName, &conf.tenantLimitsConfig)
+				if err != nil {
+					level.Error(logger).Log("msg", "failed to reload tenant limits config, keeping the previous one", "err", err)
+					return nil
+				}
+				for _, bs := range bucketStores {
+					bs.SetTenantLimits(limits)
+				}
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
 	}
 
-	infoSrv := info.NewInfoServer(
-		component.Store.String(),
+	var storeSrv store.InfoStoreServer = timePartitions[0].Store
+	if len(timePartitions) > 1 {
+		storeSrv = store.NewTimePartitionedStores(logger, reg, conf.component, timePartitions)
+	}
+
+	infoOpts := []info.ServerOptionFunc{
 		info.WithLabelSetFunc(func() []labelpb.ZLabelSet {
-			return bs.LabelSet()
+			return storeSrv.LabelSet()
 		}),
 		info.WithStoreInfoFunc(func() *infopb.StoreInfo {
 			if httpProbe.IsReady() {
-				mint, maxt := bs.TimeRange()
+				mint, maxt := storeSrv.TimeRange()
 				return &infopb.StoreInfo{
+					MinTime:          mint,
+					MaxTime:          maxt,
+					MetricNameFilter: metricNameFilterInfo(storeSrv),
+				}
+			}
+			return nil
+		}),
+	}
+	if conf.exemplarsEnabled {
+		infoOpts = append(infoOpts, info.WithExemplarsInfoFunc(func() *infopb.ExemplarsInfo {
+			if httpProbe.IsReady() {
+				mint, maxt := storeSrv.TimeRange()
+				return &infopb.ExemplarsInfo{
 					MinTime: mint,
 					MaxTime: maxt,
 				}
 			}
 			return nil
-		}),
-	)
+		}))
+	}
+	infoSrv := info.NewInfoServer(component.Store.String(), infoOpts...)
 
 	// Start query (proxy) gRPC StoreAPI.
 	{
@@ -408,16 +791,21 @@ func runStore(
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		s := grpcserver.New(logger, reg, tracer, grpcLogOpts, tagOpts, conf.component, grpcProbe,
-			grpcserver.WithServer(store.RegisterStoreServer(bs)),
+		grpcOpts := []grpcserver.Option{
+			grpcserver.WithServer(store.RegisterStoreServer(storeSrv)),
 			grpcserver.WithServer(info.RegisterInfoServer(infoSrv)),
 			grpcserver.WithListen(conf.grpcConfig.bindAddress),
 			grpcserver.WithGracePeriod(time.Duration(conf.grpcConfig.gracePeriod)),
 			grpcserver.WithTLSConfig(tlsCfg),
-		)
+			grpcserver.WithStreamWindowSize(int32(conf.seriesStreamWindowSize)),
+		}
+		if conf.exemplarsEnabled {
+			grpcOpts = append(grpcOpts, grpcserver.WithServer(exemplars.RegisterExemplarsServer(exemplarsSrvs)))
+		}
+		s := grpcserver.New(logger, reg, tracer, grpcLogOpts, tagOpts, conf.component, grpcProbe, grpcOpts...)
 
 		g.Add(func() error {
-			<-bucketStoreReady
+			bucketStoresReady.Wait()
 			statusProber.Ready()
 			return s.ListenAndServe()
 		}, func(err error) {
@@ -434,15 +822,175 @@ func runStore(
 
 		// Configure Request Logging for HTTP calls.
 		logMiddleware := logging.NewHTTPServerMiddleware(logger, httpLogOpts...)
-		api := blocksAPI.NewBlocksAPI(logger, conf.webConfig.disableCORS, "", flagsMap, bkt)
+		api := blocksAPI.NewBlocksAPI(logger, conf.webConfig.disableCORS, "", flagsMap, bkt, conf.webConfig.readWrite)
 		api.Register(r.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
-		metaFetcher.UpdateOnChange(func(blocks []metadata.Meta, err error) {
-			api.SetLoaded(blocks, err)
-		})
+		loaded.onChange(api.SetLoaded)
 		srv.Handle("/", r)
 	}
 
 	level.Info(logger).Log("msg", "starting store node")
 	return nil
 }
+
+// isDefaultStoreTimeRange returns true if --min-time and --max-time are not set.
+func isDefaultStoreTimeRange(filterConf *store.FilterConfig) bool {
+	var minTime, maxTime model.TimeOrDurationValue
+	if err := minTime.Set(storeDefaultMinTime); err != nil {
+		panic(err)
+	}
+	if err := maxTime.Set(storeDefaultMaxTime); err != nil {
+		panic(err)
+	}
+	return filterConf.MinTime.String() == minTime.String() && filterConf.MaxTime.String() == maxTime.String()
+}
+
+// metricNameFilterInfo returns the metric name filter of the store to advertise, nil if it is not a single bucket store
+// or its filter is not enabled.
+func metricNameFilterInfo(s store.InfoStoreServer) *infopb.MetricNameFilter {
+	bs, ok := s.(*store.BucketStore)
+	if !ok {
+		return nil
+	}
+	f, lease := bs.LeaseMetricNameFilter()
+	if f == nil {
+		return nil
+	}
+	return &infopb.MetricNameFilter{Version: f.Version(), HashCount: f.HashCount(), Bits: f.Bits(), LeaseMillis: lease.Milliseconds()}
+}
+
+// partitionsExemplarsServer serves the exemplars of all time partitions. Exemplars of blocks served by multiple
+// partitions are deduplicated by the querier.
+type partitionsExemplarsServer []exemplarspb.ExemplarsServer
+
+func (p partitionsExemplarsServer) Exemplars(req *exemplarspb.ExemplarsRequest, srv exemplarspb.Exemplars_ExemplarsServer) error {
+	for _, s := range p {
+		if err := s.Exemplars(req, srv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storePartition is a time partition of a tier served by a bucket store.
+type storePartition struct {
+	// name is the flag value of the partition, empty if the store is not partitioned.
+	name       string
+	filterConf *store.FilterConfig
+	// tier is the storage tier of the blocks of the partition, empty for the blocks of the bucket.
+	tier string
+}
+
+// withColdTierPartitions returns the given partitions and a partition of the cold tier for each of them, named after
+// the tier. The store is partitioned afterwards, so that its partitions are named.
+func withColdTierPartitions(partitions []storePartition) []storePartition {
+	res := make([]storePartition, 0, 2*len(partitions))
+	for _, p := range partitions {
+		if p.name == "" {
+			p.name = "hot"
+		}
+		res = append(res, p)
+	}
+	for _, p := range partitions {
+		p.tier = metadata.ColdTier
+		if p.name == "" {
+			p.name = metadata.ColdTier
+		} else {
+			p.name = fmt.Sprintf("%s:%s", metadata.ColdTier, p.name)
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// storeTimePartitions returns the partitions given as <min-time>/<max-time>, or a single one with the given filter
+// if there are none.
+func storeTimePartitions(filterConf *store.FilterConfig, timePartitions []string) ([]storePartition, error) {
+	if len(timePartitions) == 0 {
+		return []storePartition{{filterConf: filterConf}}, nil
+	}
+
+	partitions := make([]storePartition, 0, len(timePartitions))
+	for _, tp := range timePartitions {
+		parts := strings.SplitN(tp, "/", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid argument: time partition %q is not in <min-time>/<max-time> format", tp)
+		}
+		if parts[0] == "" {
+			parts[0] = storeDefaultMinTime
+		}
+		if parts[1] == "" {
+			parts[1] = storeDefaultMaxTime
+		}
+
+		p := storePartition{name: tp, filterConf: &store.FilterConfig{}}
+		if err := p.filterConf.MinTime.Set(parts[0]); err != nil {
+			return nil, errors.Wrapf(err, "invalid argument: min time of time partition %q", tp)
+		}
+		if err := p.filterConf.MaxTime.Set(parts[1]); err != nil {
+			return nil, errors.Wrapf(err, "invalid argument: max time of time partition %q", tp)
+		}
+		if p.filterConf.MinTime.PrometheusTimestamp() > p.filterConf.MaxTime.PrometheusTimestamp() {
+			return nil, errors.Errorf("invalid argument: min time of time partition %q can't be greater than its max time", tp)
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+// loadedBlocks combines the blocks loaded by the bucket stores of all partitions.
+type loadedBlocks struct {
+	mtx    sync.Mutex
+	blocks [][]metadata.Meta
+	errs   []error
+	f      func([]metadata.Meta, error)
+}
+
+func newLoadedBlocks(partitions int) *loadedBlocks {
+	return &loadedBlocks{
+		blocks: make([][]metadata.Meta, partitions),
+		errs:   make([]error, partitions),
+	}
+}
+
+// onChange registers the function called with the blocks of all partitions whenever the blocks of one changed.
+// The error is the first error of the partitions.
+func (l *loadedBlocks) onChange(f func([]metadata.Meta, error)) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.f = f
+}
+
+func (l *loadedBlocks) set(partition int, blocks []metadata.Meta, err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.blocks[partition], l.errs[partition] = blocks, err
+	if l.f == nil {
+		return
+	}
+	if len(l.blocks) == 1 {
+		l.f(blocks, err)
+		return
+	}
+
+	var (
+		all      []metadata.Meta
+		firstErr error
+		seen     = map[ulid.ULID]struct{}{}
+	)
+	for i, blocks := range l.blocks {
+		if firstErr == nil {
+			firstErr = l.errs[i]
+		}
+		for _, b := range blocks {
+			// Blocks overlapping with the boundary of partitions are loaded by both.
+			if _, ok := seen[b.ULID]; ok {
+				continue
+			}
+			seen[b.ULID] = struct{}{}
+			all = append(all, b)
+		}
+	}
+	l.f(all, firstErr)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestStoreTimePartitions(t *testing.T) {
+	filterConf := &store.FilterConfig{}
+
+	partitions, err := storeTimePartitions(filterConf, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []storePartition{{filterConf: filterConf}}, partitions)
+
+	partitions, err = storeTimePartitions(filterConf, []string{"/2020-01-01T00:00:00Z", "2020-01-01T00:00:00Z/2021-01-01T00:00:00Z", "2021-01-01T00:00:00Z/"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(partitions))
+
+	var ranges [][2]int64
+	for _, p := range partitions {
+		ranges = append(ranges, [2]int64{p.filterConf.MinTime.PrometheusTimestamp(), p.filterConf.MaxTime.PrometheusTimestamp()})
+	}
+	testutil.Equals(t, "/2020-01-01T00:00:00Z", partitions[0].name)
+	testutil.Equals(t, [][2]int64{
+		{-62167219200000, 1577836800000},
+		{1577836800000, 1609459200000},
+		{1609459200000, 253402300799000},
+	}, ranges)
+
+	for _, tc := range []struct {
+		partition string
+		expectErr string
+	}{
+		{partition: "2020-01-01T00:00:00Z", expectErr: "invalid argument: time partition \"2020-01-01T00:00:00Z\" is not in <min-time>/<max-time> format"},
+		{partition: "yesterday/", expectErr: "invalid argument: min time of time partition \"yesterday/\""},
+		{partition: "/-1x", expectErr: "invalid argument: max time of time partition \"/-1x\""},
+		{partition: "2021-01-01T00:00:00Z/2020-01-01T00:00:00Z", expectErr: "invalid argument: min time of time partition \"2021-01-01T00:00:00Z/2020-01-01T00:00:00Z\" can't be greater than its max time"},
+	} {
+		t.Run(tc.partition, func(t *testing.T) {
+			_, err := storeTimePartitions(filterConf, []string{tc.partition})
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.HasPrefix(err.Error(), tc.expectErr), "unexpected error %v", err)
+		})
+	}
+}
+
+func TestWithColdTierPartitions(t *testing.T) {
+	filterConf := &store.FilterConfig{}
+
+	testutil.Equals(t, []storePartition{
+		{name: "hot", filterConf: filterConf},
+		{name: "cold", filterConf: filterConf, tier: metadata.ColdTier},
+	}, withColdTierPartitions([]storePartition{{filterConf: filterConf}}))
+
+	testutil.Equals(t, []storePartition{
+		{name: "/2020-01-01T00:00:00Z", filterConf: filterConf},
+		{name: "2020-01-01T00:00:00Z/", filterConf: filterConf},
+		{name: "cold:/2020-01-01T00:00:00Z", filterConf: filterConf, tier: metadata.ColdTier},
+		{name: "cold:2020-01-01T00:00:00Z/", filterConf: filterConf, tier: metadata.ColdTier},
+	}, withColdTierPartitions([]storePartition{{name: "/2020-01-01T00:00:00Z", filterConf: filterConf}, {name: "2020-01-01T00:00:00Z/", filterConf: filterConf}}))
+}
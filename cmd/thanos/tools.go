@@ -27,6 +27,7 @@ func registerTools(app *extkingpin.App) {
 	cmd := app.Command("tools", "Tools utility commands")
 
 	registerBucket(cmd)
+	registerToolsReceive(cmd)
 	registerCheckRules(cmd)
 }
 
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/csv"
@@ -11,8 +12,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -20,6 +23,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
@@ -116,6 +120,7 @@ type bucketWebConfig struct {
 	webExternalPrefix   string
 	webPrefixHeaderName string
 	webDisableCORS      bool
+	webReadWrite        bool
 	interval            time.Duration
 	label               string
 	timeout             time.Duration
@@ -139,6 +144,7 @@ type bucketCleanupConfig struct {
 	consistencyDelay     time.Duration
 	blockSyncConcurrency int
 	deleteDelay          time.Duration
+	deletionMode         string
 }
 
 type bucketRetentionConfig struct {
@@ -147,10 +153,35 @@ type bucketRetentionConfig struct {
 	deleteDelay          time.Duration
 }
 
+// retentionFunc applies retention policies to the synced metas of the bucket.
+type retentionFunc func(ctx context.Context, logger log.Logger, bkt objstore.Bucket, metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[compact.ResolutionLevel]time.Duration) error
+
+type bucketHealthConfig struct {
+	selector        []string
+	staleIterations uint
+	output          string
+	timeout         time.Duration
+}
+
+type bucketAnalyzeConfig struct {
+	id            string
+	limit         int
+	sampledChunks int
+	output        string
+}
+
 type bucketMarkBlockConfig struct {
-	details  string
-	marker   string
-	blockIDs []string
+	details     string
+	marker      string
+	blockIDs    []string
+	selector    []string
+	minTime     model.TimeOrDurationValue
+	maxTime     model.TimeOrDurationValue
+	resolutions []time.Duration
+	compactions []int
+	remove      bool
+	yes         bool
+	timeout     time.Duration
 }
 
 func (tbc *bucketVerifyConfig) registerBucketVerifyFlag(cmd extkingpin.FlagClause) *bucketVerifyConfig {
@@ -185,6 +216,27 @@ func (tbc *bucketInspectConfig) registerBucketInspectFlag(cmd extkingpin.FlagCla
 	return tbc
 }
 
+func (tbc *bucketHealthConfig) registerBucketHealthFlag(cmd extkingpin.FlagClause) *bucketHealthConfig {
+	cmd.Flag("selector", "Selects compaction groups based on label, e.g. '-l key1=\\\"value1\\\" -l key2=\\\"value2\\\"'. All key value pairs must match.").Short('l').
+		PlaceHolder("<name>=\\\"<value>\\\"").StringsVar(&tbc.selector)
+	cmd.Flag("stale-iterations", "Number of compaction iterations of the compactor after which a compaction health object not updated is flagged as stale.").
+		Default("3").UintVar(&tbc.staleIterations)
+	cmd.Flag("output", "Output format for result. Currently supports table, csv, tsv, json.").
+		Default(string(TABLE)).EnumVar(&tbc.output, string(TABLE), string(CSV), string(TSV), "json")
+	cmd.Flag("timeout", "Timeout to download the compaction health objects from remote storage").Default("5m").DurationVar(&tbc.timeout)
+	return tbc
+}
+
+func (tbc *bucketAnalyzeConfig) registerBucketAnalyzeFlag(cmd extkingpin.FlagClause) *bucketAnalyzeConfig {
+	cmd.Flag("id", "ID (ULID) of the block to analyze.").Required().StringVar(&tbc.id)
+	cmd.Flag("limit", "Number of entries to print in each top list.").Default("20").IntVar(&tbc.limit)
+	cmd.Flag("chunks.sample", "Number of chunks to read from the bucket, picked at random, to print statistics about the chunks. 0 disables the sampling, only the index is read then.").
+		Default("0").IntVar(&tbc.sampledChunks)
+	cmd.Flag("output", "Output format for result. Currently supports table, json.").
+		Default(string(TABLE)).EnumVar(&tbc.output, string(TABLE), "json")
+	return tbc
+}
+
 func (tbc *bucketWebConfig) registerBucketWebFlag(cmd extkingpin.FlagClause) *bucketWebConfig {
 	cmd.Flag("web.route-prefix", "Prefix for API and UI endpoints. This allows thanos UI to be served on a sub-path. Defaults to the value of --web.external-prefix. This option is analogous to --web.route-prefix of Prometheus.").Default("").StringVar(&tbc.webRoutePrefix)
 
@@ -194,6 +246,8 @@ func (tbc *bucketWebConfig) registerBucketWebFlag(cmd extkingpin.FlagClause) *bu
 
 	cmd.Flag("web.disable-cors", "Whether to disable CORS headers to be set by Thanos. By default Thanos sets CORS headers to be allowed by all.").Default("false").BoolVar(&tbc.webDisableCORS)
 
+	cmd.Flag("web.read-write", "Allow blocks to be marked and unmarked for deletion and no compaction through the bucket web UI and its blocks API. Disable with --no-web.read-write to make them read-only.").Default("true").BoolVar(&tbc.webReadWrite)
+
 	cmd.Flag("refresh", "Refresh interval to download metadata from remote storage").Default("30m").DurationVar(&tbc.interval)
 
 	cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").DurationVar(&tbc.timeout)
@@ -238,9 +292,20 @@ func (tbc *bucketDownsampleConfig) registerBucketDownsampleFlag(cmd extkingpin.F
 }
 
 func (tbc *bucketMarkBlockConfig) registerBucketMarkBlockFlag(cmd extkingpin.FlagClause) *bucketMarkBlockConfig {
-	cmd.Flag("id", "ID (ULID) of the blocks to be marked for deletion (repeated flag)").Required().StringsVar(&tbc.blockIDs)
+	cmd.Flag("id", "ID (ULID) of the blocks to be marked (repeated flag).").StringsVar(&tbc.blockIDs)
+	cmd.Flag("selector", "Selects blocks to be marked based on their external labels, e.g. '-l key1=\\\"value1\\\" -l key2=\\\"value2\\\"'. All key value pairs must match.").Short('l').
+		PlaceHolder("<name>=\\\"<value>\\\"").StringsVar(&tbc.selector)
+	cmd.Flag("min-time", "Selects blocks to be marked which overlap with the time range starting at this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		SetValue(&tbc.minTime)
+	cmd.Flag("max-time", "Selects blocks to be marked which overlap with the time range ending at this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		SetValue(&tbc.maxTime)
+	cmd.Flag("resolution", "Selects blocks to be marked with these resolutions (repeated flag).").HintAction(listResLevel).DurationListVar(&tbc.resolutions)
+	cmd.Flag("compaction", "Selects blocks to be marked with these compaction levels (repeated flag).").IntsVar(&tbc.compactions)
 	cmd.Flag("marker", "Marker to be put.").Required().EnumVar(&tbc.marker, metadata.DeletionMarkFilename, metadata.NoCompactMarkFilename)
-	cmd.Flag("details", "Human readable details to be put into marker.").Required().StringVar(&tbc.details)
+	cmd.Flag("details", "Human readable details to be put into marker. Required unless the marker is removed.").StringVar(&tbc.details)
+	cmd.Flag("remove", "Remove the marker from the selected blocks instead of putting it.").Default("false").BoolVar(&tbc.remove)
+	cmd.Flag("yes", "Mark the blocks selected by external labels, time range, resolution or compaction level without asking for confirmation. Blocks selected by their ID only are always marked without confirmation.").Default("false").BoolVar(&tbc.yes)
+	cmd.Flag("timeout", "Timeout to download metadata from remote storage and mark the blocks.").Default("5m").DurationVar(&tbc.timeout)
 
 	return tbc
 }
@@ -251,6 +316,11 @@ func (tbc *bucketCleanupConfig) registerBucketCleanupFlag(cmd extkingpin.FlagCla
 		Default("30m").DurationVar(&tbc.consistencyDelay)
 	cmd.Flag("block-sync-concurrency", "Number of goroutines to use when syncing block metadata from object storage.").
 		Default("20").IntVar(&tbc.blockSyncConcurrency)
+	cmd.Flag("delete.mode", "How blocks after delete-delay and aborted partial uploads are removed. "+
+		"When set to delete, the blocks are deleted from the bucket. "+
+		"When set to mark-only, the blocks are kept in the bucket with a tombstone.json file, so that lifecycle rules of the bucket can expire them. "+
+		"When set to auto, mark-only is used for S3 buckets with object lock enabled and delete otherwise.").
+		Default(string(block.AutoDeletionMode)).EnumVar(&tbc.deletionMode, string(block.AutoDeletionMode), string(block.DeleteDeletionMode), string(block.MarkOnlyDeletionMode))
 	return tbc
 }
 
@@ -278,6 +348,8 @@ func registerBucket(app extkingpin.AppClause) {
 	registerBucketMarkBlock(cmd, objStoreConfig)
 	registerBucketRewrite(cmd, objStoreConfig)
 	registerBucketRetention(cmd, objStoreConfig)
+	registerBucketHealth(cmd, objStoreConfig)
+	registerBucketAnalyze(cmd, objStoreConfig)
 }
 
 func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
@@ -385,10 +457,17 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 			return err
 		}
 
-		var filters []block.MetadataFilter
+		var (
+			filters                  []block.MetadataFilter
+			ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter
+		)
 
 		if tbc.excludeDelete {
-			ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 0, block.FetcherConcurrency)
+			ignoreDeletionMarkFilter = block.NewIgnoreDeletionMarkFilter(logger, bkt, 0, block.FetcherConcurrency)
+			filters = append(filters, ignoreDeletionMarkFilter)
+		} else if tbc.output == "wide" {
+			// Never filter out blocks, we only need to know about their deletion marks.
+			ignoreDeletionMarkFilter = block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(math.MaxInt64), block.FetcherConcurrency)
 			filters = append(filters, ignoreDeletionMarkFilter)
 		}
 		fetcher, err := block.NewMetaFetcher(logger, block.FetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), filters)
@@ -405,9 +484,10 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 		defer cancel()
 
 		var (
-			format     = tbc.output
-			objects    = 0
-			printBlock func(m *metadata.Meta) error
+			format        = tbc.output
+			objects       = 0
+			printBlock    func(m *metadata.Meta) error
+			deletionMarks map[ulid.ULID]*metadata.DeletionMark
 		)
 
 		switch format {
@@ -421,12 +501,22 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 				minTime := time.Unix(m.MinTime/1000, 0)
 				maxTime := time.Unix(m.MaxTime/1000, 0)
 
-				if _, err = fmt.Fprintf(os.Stdout, "%s -- %s - %s Diff: %s, Compaction: %d, Downsample: %d, Source: %s\n",
+				if _, err = fmt.Fprintf(os.Stdout, "%s -- %s - %s Diff: %s, Compaction: %d, Downsample: %d, Source: %s",
 					m.ULID, minTime.Format(time.RFC3339), maxTime.Format(time.RFC3339), maxTime.Sub(minTime),
 					m.Compaction.Level, m.Thanos.Downsample.Resolution, m.Thanos.Source); err != nil {
 					return err
 				}
-				return nil
+				if dm, ok := deletionMarks[m.ULID]; ok {
+					reason := string(dm.Reason)
+					if reason == "" {
+						reason = "unknown"
+					}
+					if _, err = fmt.Fprintf(os.Stdout, ", Marked for deletion: %s", reason); err != nil {
+						return err
+					}
+				}
+				_, err = fmt.Fprintln(os.Stdout)
+				return err
 			}
 		case "json":
 			enc := json.NewEncoder(os.Stdout)
@@ -453,6 +543,9 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 		if err != nil {
 			return err
 		}
+		if ignoreDeletionMarkFilter != nil {
+			deletionMarks = ignoreDeletionMarkFilter.DeletionMarkBlocks()
+		}
 
 		for _, meta := range metas {
 			objects++
@@ -599,7 +692,12 @@ func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrC
 			return errors.Wrap(err, "bucket client")
 		}
 
-		api := v1.NewBlocksAPI(logger, tbc.webDisableCORS, tbc.label, flagsMap, bkt)
+		api := v1.NewBlocksAPI(logger, tbc.webDisableCORS, tbc.label, flagsMap, bkt, tbc.webReadWrite)
+		objectLock, err := block.DetectObjectLock(context.Background(), logger, confContentYaml)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to detect object lock configuration of bucket", "err", err)
+		}
+		api.SetObjectLock(objectLock)
 
 		// Configure Request Logging for HTTP calls.
 		opts := []logging.Option{logging.WithDecider(func(_ string, _ error) logging.Decision {
@@ -632,18 +730,25 @@ func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrC
 		if err != nil {
 			return err
 		}
+		// Deletion marks are only tracked, the blocks marked for deletion are still shown.
+		deletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(math.MaxInt64), block.FetcherConcurrency)
+		noCompactMarkFilter := compact.NewGatherNoCompactionMarkFilter(logger, bkt, block.FetcherConcurrency)
 		// TODO(bwplotka): Allow Bucket UI to visualize the state of block as well.
 		fetcher, err := block.NewMetaFetcher(logger, block.FetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg),
 			[]block.MetadataFilter{
 				block.NewTimePartitionMetaFilter(filterConf.MinTime, filterConf.MaxTime),
 				block.NewLabelShardedMetaFilter(relabelConfig),
 				block.NewDeduplicateFilter(block.FetcherConcurrency),
+				deletionMarkFilter,
+				noCompactMarkFilter,
 			})
 		if err != nil {
 			return err
 		}
 		fetcher.UpdateOnChange(func(blocks []metadata.Meta, err error) {
 			api.SetGlobal(blocks, err)
+			api.SetGlobalDeletionMarks(deletionMarkFilter.DeletionMarkBlocks())
+			api.SetGlobalNoCompactMarks(noCompactMarkFilter.NoCompactMarkedBlocks())
 		})
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -751,7 +856,7 @@ func registerBucketDownsample(app extkingpin.AppClause, objStoreConfig *extflag.
 	tbc.registerBucketDownsampleFlag(cmd)
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
-		return RunDownsample(g, logger, reg, *httpAddr, *httpTLSConfig, time.Duration(*httpGracePeriod), tbc.dataDir,
+		return RunDownsample(g, logger, reg, tracer, *httpAddr, *httpTLSConfig, time.Duration(*httpGracePeriod), tbc.dataDir,
 			tbc.waitInterval, tbc.downsampleConcurrency, objStoreConfig, component.Downsample, metadata.HashFunc(tbc.hashFunc))
 	})
 }
@@ -783,6 +888,7 @@ func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 		if err != nil {
 			return err
 		}
+		deletionMode, _ := resolveDeletionMode(logger, confContentYaml, block.DeletionMode(tbc.deletionMode))
 
 		// Dummy actor to immediately kill the group after the run function returns.
 		g.Add(func() error { return nil }, func(error) {})
@@ -794,7 +900,7 @@ func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 		// This is to make sure compactor will not accidentally perform compactions with gap instead.
 		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, tbc.deleteDelay/2, tbc.blockSyncConcurrency)
 		duplicateBlocksFilter := block.NewDeduplicateFilter(tbc.blockSyncConcurrency)
-		blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, tbc.deleteDelay, stubCounter, stubCounter)
+		blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, tbc.deleteDelay, deletionMode, stubCounter, stubCounter, stubCounter)
 
 		ctx := context.Background()
 
@@ -821,6 +927,7 @@ func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 				ignoreDeletionMarkFilter,
 				stubCounter,
 				stubCounter,
+				block.WithDeletionSource(component.Cleanup.String()),
 			)
 			if err != nil {
 				return errors.Wrap(err, "create syncer")
@@ -834,7 +941,7 @@ func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 
 		level.Info(logger).Log("msg", "synced blocks done")
 
-		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, sy.Partial(), bkt, stubCounter, stubCounter, stubCounter)
+		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, sy.Partial(), bkt, deletionMode, stubCounter, stubCounter, stubCounter, stubCounter, block.WithDeletionSource(component.Cleanup.String()))
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "error cleaning blocks")
 		}
@@ -964,8 +1071,13 @@ func getKeysAlphabetically(labels map[string]string) []string {
 // matchesSelector checks if blockMeta contains every label from
 // the selector with the correct value.
 func matchesSelector(blockMeta *metadata.Meta, selectorLabels labels.Labels) bool {
+	return matchesLabels(blockMeta.Thanos.Labels, selectorLabels)
+}
+
+// matchesLabels checks if lset contains every label from the selector with the correct value.
+func matchesLabels(lset map[string]string, selectorLabels labels.Labels) bool {
 	for _, l := range selectorLabels {
-		if v, ok := blockMeta.Thanos.Labels[l.Name]; !ok || v != l.Value {
+		if v, ok := lset[l.Name]; !ok || v != l.Value {
 			return false
 		}
 	}
@@ -1029,6 +1141,14 @@ func registerBucketMarkBlock(app extkingpin.AppClause, objStoreConfig *extflag.P
 	tbc.registerBucketMarkBlockFlag(cmd)
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		sel, err := tbc.blockSelection()
+		if err != nil {
+			return err
+		}
+		if !tbc.remove && tbc.details == "" {
+			return errors.New("details are required to put a marker")
+		}
+
 		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
@@ -1039,40 +1159,226 @@ func registerBucketMarkBlock(app extkingpin.AppClause, objStoreConfig *extflag.P
 			return err
 		}
 
-		var ids []ulid.ULID
-		for _, id := range tbc.blockIDs {
-			u, err := ulid.Parse(id)
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		ctx, cancel := context.WithTimeout(context.Background(), tbc.timeout)
+		defer cancel()
+
+		// Blocks selected by their ID only are marked directly. The ones of other selections are resolved from the
+		// metas of the bucket and only marked once confirmed.
+		ids := sel.ids
+		if !sel.idsOnly() {
+			fetcher, err := block.NewMetaFetcher(logger, block.FetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil)
 			if err != nil {
-				return errors.Errorf("block.id is not a valid UUID, got: %v", id)
+				return err
+			}
+			metas, _, err := fetcher.Fetch(ctx)
+			if err != nil {
+				return err
+			}
+			selected, err := sel.selectBlocks(metas)
+			if err != nil {
+				return err
+			}
+			if len(selected) == 0 {
+				level.Info(logger).Log("msg", "no blocks match the selection, nothing to mark")
+				return nil
 			}
-			ids = append(ids, u)
-		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		g.Add(func() error {
-			for _, id := range ids {
-				switch tbc.marker {
-				case metadata.DeletionMarkFilename:
-					if err := block.MarkForDeletion(ctx, logger, bkt, id, tbc.details, promauto.With(nil).NewCounter(prometheus.CounterOpts{})); err != nil {
-						return errors.Wrapf(err, "mark %v for %v", id, tbc.marker)
-					}
-				case metadata.NoCompactMarkFilename:
-					if err := block.MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, tbc.details, promauto.With(nil).NewCounter(prometheus.CounterOpts{})); err != nil {
-						return errors.Wrapf(err, "mark %v for %v", id, tbc.marker)
-					}
-				default:
-					return errors.Errorf("not supported marker %v", tbc.marker)
-				}
+			if err := printBlockData(selected, nil, []string{"FROM", "UNTIL"}, printTable); err != nil {
+				return err
 			}
-			level.Info(logger).Log("msg", "marking done", "marker", tbc.marker, "IDs", strings.Join(tbc.blockIDs, ","))
-			return nil
-		}, func(err error) {
-			cancel()
-		})
+			action := "Mark"
+			if tbc.remove {
+				action = "Remove the marker of"
+			}
+			if !tbc.yes && !confirm(os.Stdin, os.Stdout, fmt.Sprintf("%s %d blocks with %s? [y/N] ", action, len(selected), tbc.marker)) {
+				return errors.New("marking not confirmed; pass --yes to skip the confirmation")
+			}
+
+			ids = make([]ulid.ULID, 0, len(selected))
+			for _, m := range selected {
+				ids = append(ids, m.ULID)
+			}
+		}
+
+		res := markBlocks(ctx, logger, bkt, ids, tbc.marker, tbc.details, tbc.remove)
+		fmt.Fprintf(os.Stdout, "%s: %d blocks done, %d blocks already done, %d blocks failed\n", tbc.marker, res.done, res.skipped, res.failed)
+		if res.failed > 0 {
+			return errors.Errorf("failed to mark %d blocks", res.failed)
+		}
 		return nil
 	})
 }
 
+// markBlockSelection selects the blocks of a bucket to be marked. Blocks are selected if they match all its criteria,
+// unset ones matching all blocks.
+type markBlockSelection struct {
+	ids            []ulid.ULID
+	selectorLabels labels.Labels
+	// minTime and maxTime are the bounds of the time range blocks must overlap with, in milliseconds.
+	minTime, maxTime int64
+	resolutions      map[int64]struct{}
+	compactions      map[int]struct{}
+}
+
+// blockSelection returns the selection of the blocks to be marked. At least one criterion must be set, so that all
+// blocks of a bucket are never marked by mistake.
+func (tbc *bucketMarkBlockConfig) blockSelection() (*markBlockSelection, error) {
+	sel := &markBlockSelection{minTime: math.MinInt64, maxTime: math.MaxInt64}
+	for _, id := range tbc.blockIDs {
+		u, err := ulid.Parse(id)
+		if err != nil {
+			return nil, errors.Errorf("block.id is not a valid UUID, got: %v", id)
+		}
+		sel.ids = append(sel.ids, u)
+	}
+
+	selectorLabels, err := parseFlagLabels(tbc.selector)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing selector flag")
+	}
+	sel.selectorLabels = selectorLabels
+
+	if tbc.minTime.Time != nil || tbc.minTime.Dur != nil {
+		sel.minTime = tbc.minTime.PrometheusTimestamp()
+	}
+	if tbc.maxTime.Time != nil || tbc.maxTime.Dur != nil {
+		sel.maxTime = tbc.maxTime.PrometheusTimestamp()
+	}
+	if sel.minTime > sel.maxTime {
+		return nil, errors.Errorf("min-time %s is after max-time %s", tbc.minTime.String(), tbc.maxTime.String())
+	}
+
+	if len(tbc.resolutions) > 0 {
+		sel.resolutions = map[int64]struct{}{}
+		for _, r := range tbc.resolutions {
+			sel.resolutions[r.Milliseconds()] = struct{}{}
+		}
+	}
+	if len(tbc.compactions) > 0 {
+		sel.compactions = map[int]struct{}{}
+		for _, c := range tbc.compactions {
+			sel.compactions[c] = struct{}{}
+		}
+	}
+
+	if len(sel.ids) == 0 && len(sel.selectorLabels) == 0 && sel.minTime == math.MinInt64 && sel.maxTime == math.MaxInt64 &&
+		sel.resolutions == nil && sel.compactions == nil {
+		return nil, errors.New("no blocks selected; select them by ID, external labels, time range, resolution or compaction level")
+	}
+	return sel, nil
+}
+
+// idsOnly returns true if blocks are selected by their ID only.
+func (sel *markBlockSelection) idsOnly() bool {
+	return len(sel.ids) > 0 && len(sel.selectorLabels) == 0 && sel.minTime == math.MinInt64 && sel.maxTime == math.MaxInt64 &&
+		sel.resolutions == nil && sel.compactions == nil
+}
+
+// selectBlocks returns the metas of the selected blocks, sorted by their time range. It fails if any of the blocks
+// selected by their ID is not in metas.
+func (sel *markBlockSelection) selectBlocks(metas map[ulid.ULID]*metadata.Meta) ([]*metadata.Meta, error) {
+	for _, id := range sel.ids {
+		if _, ok := metas[id]; !ok {
+			return nil, errors.Errorf("block %s not found in bucket", id)
+		}
+	}
+
+	var res []*metadata.Meta
+	for _, m := range metas {
+		if len(sel.ids) > 0 && !containsULID(sel.ids, m.ULID) {
+			continue
+		}
+		if !matchesSelector(m, sel.selectorLabels) {
+			continue
+		}
+		if m.MaxTime <= sel.minTime || m.MinTime > sel.maxTime {
+			continue
+		}
+		if _, ok := sel.resolutions[m.Thanos.Downsample.Resolution]; sel.resolutions != nil && !ok {
+			continue
+		}
+		if _, ok := sel.compactions[m.Compaction.Level]; sel.compactions != nil && !ok {
+			continue
+		}
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].MinTime != res[j].MinTime {
+			return res[i].MinTime < res[j].MinTime
+		}
+		return res[i].ULID.Compare(res[j].ULID) < 0
+	})
+	return res, nil
+}
+
+func containsULID(ids []ulid.ULID, id ulid.ULID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// markResult counts the blocks marked, already marked and failed to be marked by markBlocks.
+type markResult struct {
+	done, skipped, failed int
+}
+
+// markBlocks puts the marker with the given details to the blocks, or removes it if remove is true. Blocks which
+// already have the marker, or don't have it when removing it, are skipped, so that marking blocks again is a noop.
+func markBlocks(ctx context.Context, logger log.Logger, bkt objstore.Bucket, ids []ulid.ULID, marker, details string, remove bool) markResult {
+	var (
+		res         markResult
+		stubCounter = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	)
+	for _, id := range ids {
+		exists, err := bkt.Exists(ctx, path.Join(id.String(), marker))
+		if err == nil && exists != remove {
+			res.skipped++
+			continue
+		}
+		if err == nil {
+			switch {
+			case remove:
+				err = block.RemoveMark(ctx, logger, bkt, id, marker)
+			case marker == metadata.DeletionMarkFilename:
+				err = block.MarkForDeletion(ctx, logger, bkt, id, metadata.ManualDeletionReason, details, stubCounter, block.WithDeletionSource(component.Mark.String()))
+			case marker == metadata.NoCompactMarkFilename:
+				err = block.MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, details, stubCounter)
+			default:
+				err = errors.Errorf("not supported marker %v", marker)
+			}
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to mark block", "id", id, "marker", marker, "remove", remove, "err", err)
+			res.failed++
+			continue
+		}
+		res.done++
+	}
+	return res
+}
+
+// confirm writes the question to w and returns true if the answer read from r is yes.
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprint(w, question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
 func registerBucketRewrite(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command(component.Rewrite.String(), "Rewrite chosen blocks in the bucket, while deleting or modifying series "+
 		"Resulted block has modified stats in meta.json. Additionally compaction.sources are altered to not confuse readers of meta.json. "+
@@ -1241,7 +1547,7 @@ func registerBucketRewrite(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 				level.Info(logger).Log("msg", "uploaded", "source", id, "new", newID)
 
 				if !tbc.dryRun && tbc.deleteBlocks {
-					if err := block.MarkForDeletion(ctx, logger, bkt, id, "block rewritten", stubCounter); err != nil {
+					if err := block.MarkForDeletion(ctx, logger, bkt, id, metadata.RewrittenDeletionReason, "block rewritten", stubCounter, block.WithDeletionSource(component.Rewrite.String())); err != nil {
 						level.Error(logger).Log("msg", "failed to mark block for deletion", "id", id.String(), "err", err)
 					}
 				}
@@ -1273,39 +1579,248 @@ func registerBucketRetention(app extkingpin.AppClause, objStoreConfig *extflag.P
 		Default("0d").SetValue(&retentionFiveMin)
 	cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").
 		Default("0d").SetValue(&retentionOneHr)
-	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
-		retentionByResolution := map[compact.ResolutionLevel]time.Duration{
-			compact.ResolutionLevelRaw: time.Duration(retentionRaw),
-			compact.ResolutionLevel5m:  time.Duration(retentionFiveMin),
-			compact.ResolutionLevel1h:  time.Duration(retentionOneHr),
+
+	// setupRetention syncs the metas of the bucket and passes them to fn along with the retention policies.
+	setupRetention := func(fn retentionFunc) extkingpin.SetupFunc {
+		return func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+			retentionByResolution := map[compact.ResolutionLevel]time.Duration{
+				compact.ResolutionLevelRaw: time.Duration(retentionRaw),
+				compact.ResolutionLevel5m:  time.Duration(retentionFiveMin),
+				compact.ResolutionLevel1h:  time.Duration(retentionOneHr),
+			}
+
+			if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
+				level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
+			}
+			if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
+				level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
+			}
+			if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
+				level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
+			}
+
+			confContentYaml, err := objStoreConfig.Content()
+			if err != nil {
+				return err
+			}
+
+			relabelContentYaml, err := selectorRelabelConf.Content()
+			if err != nil {
+				return errors.Wrap(err, "get content of relabel configuration")
+			}
+
+			relabelConfig, err := block.ParseRelabelConfig(relabelContentYaml, block.SelectorSupportedRelabelActions)
+			if err != nil {
+				return err
+			}
+
+			bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Retention.String())
+			if err != nil {
+				return err
+			}
+
+			// Dummy actor to immediately kill the group after the run function returns.
+			g.Add(func() error { return nil }, func(error) {})
+
+			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+			// While fetching blocks, we filter out blocks that were marked for deletion by using IgnoreDeletionMarkFilter.
+			// The delay of deleteDelay/2 is added to ensure we fetch blocks that are meant to be deleted but do not have a replacement yet.
+			// This is to make sure compactor will not accidentally perform compactions with gap instead.
+			ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, tbc.deleteDelay/2, tbc.blockSyncConcurrency)
+			duplicateBlocksFilter := block.NewDeduplicateFilter(tbc.blockSyncConcurrency)
+			stubCounter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+
+			var sy *compact.Syncer
+			{
+				baseMetaFetcher, err := block.NewBaseFetcher(logger, tbc.blockSyncConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg))
+				if err != nil {
+					return errors.Wrap(err, "create meta fetcher")
+				}
+				cf := baseMetaFetcher.NewMetaFetcher(
+					extprom.WrapRegistererWithPrefix(extpromPrefix, reg), []block.MetadataFilter{
+						block.NewLabelShardedMetaFilter(relabelConfig),
+						block.NewConsistencyDelayMetaFilter(logger, tbc.consistencyDelay, extprom.WrapRegistererWithPrefix(extpromPrefix, reg)),
+						duplicateBlocksFilter,
+						ignoreDeletionMarkFilter,
+					},
+				)
+				sy, err = compact.NewMetaSyncer(
+					logger,
+					reg,
+					bkt,
+					cf,
+					duplicateBlocksFilter,
+					ignoreDeletionMarkFilter,
+					stubCounter,
+					stubCounter,
+					block.WithDeletionSource(component.Retention.String()),
+				)
+				if err != nil {
+					return errors.Wrap(err, "create syncer")
+				}
+			}
+
+			ctx := context.Background()
+			level.Info(logger).Log("msg", "syncing blocks metadata")
+			if err := sy.SyncMetas(ctx); err != nil {
+				return errors.Wrap(err, "sync blocks")
+			}
+
+			level.Info(logger).Log("msg", "synced blocks done")
+
+			return fn(ctx, logger, bkt, sy.Metas(), retentionByResolution)
 		}
+	}
+
+	cmd.Command("apply", "Mark the blocks exceeding the retention policies for deletion. Please make sure no compactor is running on the same bucket at the same time.").Default().
+		Setup(setupRetention(func(ctx context.Context, logger log.Logger, bkt objstore.Bucket, metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[compact.ResolutionLevel]time.Duration) error {
+			level.Warn(logger).Log("msg", "GLOBAL COMPACTOR SHOULD __NOT__ BE RUNNING ON THE SAME BUCKET")
+
+			stubCounter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, retentionByResolution, stubCounter, block.WithDeletionSource(component.Retention.String())); err != nil {
+				return errors.Wrap(err, "retention failed")
+			}
+			return nil
+		}))
 
-		if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
-			level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
+	simulate := cmd.Command("simulate", "Print the blocks the retention policies would mark for deletion, with their sizes, without marking any of them.")
+	output := simulate.Flag("output", "Output format for result. Currently supports table, json.").Default("table").Enum(string(TABLE), "json")
+	simulate.Setup(setupRetention(func(ctx context.Context, logger log.Logger, bkt objstore.Bucket, metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[compact.ResolutionLevel]time.Duration) error {
+		sim, err := simulateRetention(ctx, bkt, metas, retentionByResolution, time.Now())
+		if err != nil {
+			return err
 		}
-		if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
-			level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
+		for _, b := range sim.Blocks {
+			if b.WithoutDownsampled {
+				level.Warn(logger).Log("msg", "raw block would be deleted before its data is available in downsampled blocks", "id", b.ULID)
+			}
 		}
-		if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
-			level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
+		level.Info(logger).Log("msg", "retention simulation done", "blocks", len(sim.Blocks), "reclaimedBytes", sim.TotalSizeBytes)
+
+		if *output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(sim)
 		}
+		return printTable(os.Stdout, sim.table())
+	}))
+}
 
-		confContentYaml, err := objStoreConfig.Content()
+// retentionSimulation is the result of simulating retention policies on the blocks of a bucket.
+type retentionSimulation struct {
+	Blocks         []retentionSimulationBlock `json:"blocks"`
+	TotalSizeBytes int64                      `json:"total_size_bytes"`
+}
+
+// retentionSimulationBlock is a block the retention policies would mark for deletion.
+type retentionSimulationBlock struct {
+	ULID       ulid.ULID         `json:"ulid"`
+	MinTime    int64             `json:"min_time"`
+	MaxTime    int64             `json:"max_time"`
+	Resolution int64             `json:"resolution"`
+	Labels     map[string]string `json:"labels"`
+	Retention  string            `json:"retention"`
+	SizeBytes  int64             `json:"size_bytes"`
+	// WithoutDownsampled is true for raw blocks whose data is not available in any downsampled block which is kept.
+	WithoutDownsampled bool `json:"without_downsampled,omitempty"`
+}
+
+// simulateRetention returns the blocks of metas which exceed the retention policies at the given time. The sizes of
+// blocks are taken from their meta, or from the bucket if their meta does not have them.
+func simulateRetention(ctx context.Context, bkt objstore.BucketReader, metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[compact.ResolutionLevel]time.Duration, now time.Time) (*retentionSimulation, error) {
+	exceeding := compact.BlocksExceedingRetention(metas, retentionByResolution, now)
+	withoutDownsampled := map[ulid.ULID]struct{}{}
+	for _, m := range compact.RawBlocksWithoutDownsampled(metas, exceeding) {
+		withoutDownsampled[m.ULID] = struct{}{}
+	}
+
+	sim := &retentionSimulation{Blocks: make([]retentionSimulationBlock, 0, len(exceeding))}
+	for _, m := range exceeding {
+		size, err := blockSizeInBucket(ctx, bkt, m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get size of block %s", m.ULID)
+		}
+		_, ok := withoutDownsampled[m.ULID]
+		sim.Blocks = append(sim.Blocks, retentionSimulationBlock{
+			ULID:               m.ULID,
+			MinTime:            m.MinTime,
+			MaxTime:            m.MaxTime,
+			Resolution:         m.Thanos.Downsample.Resolution,
+			Labels:             m.Thanos.Labels,
+			Retention:          prommodel.Duration(retentionByResolution[compact.ResolutionLevel(m.Thanos.Downsample.Resolution)]).String(),
+			SizeBytes:          size,
+			WithoutDownsampled: ok,
+		})
+		sim.TotalSizeBytes += size
+	}
+	return sim, nil
+}
+
+// blockSizeInBucket returns the size in bytes of the files of the given block.
+func blockSizeInBucket(ctx context.Context, bkt objstore.BucketReader, m *metadata.Meta) (int64, error) {
+	var size int64
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	if size > 0 {
+		return size, nil
+	}
+	err := bkt.Iter(ctx, m.ULID.String(), func(name string) error {
+		attrs, err := bkt.Attributes(ctx, name)
 		if err != nil {
 			return err
 		}
+		size += attrs.Size
+		return nil
+	}, objstore.WithRecursiveIter)
+	return size, err
+}
 
-		relabelContentYaml, err := selectorRelabelConf.Content()
+func (s *retentionSimulation) table() Table {
+	t := Table{Header: []string{"ULID", "FROM", "UNTIL", "RESOLUTION", "LABELS", "RETENTION", "SIZE", "WARNING"}}
+	for _, b := range s.Blocks {
+		var lset []string
+		for _, key := range getKeysAlphabetically(b.Labels) {
+			lset = append(lset, fmt.Sprintf("%s=%s", key, b.Labels[key]))
+		}
+		warning := ""
+		if b.WithoutDownsampled {
+			warning = "no downsampled data"
+		}
+		t.Lines = append(t.Lines, []string{
+			b.ULID.String(),
+			time.Unix(b.MinTime/1000, 0).Format(time.RFC3339),
+			time.Unix(b.MaxTime/1000, 0).Format(time.RFC3339),
+			time.Duration(b.Resolution * int64(time.Millisecond)).String(),
+			strings.Join(lset, ","),
+			b.Retention,
+			units.Base2Bytes(b.SizeBytes).String(),
+			warning,
+		})
+	}
+	t.Lines = append(t.Lines, []string{"TOTAL", "", "", "", "", "", units.Base2Bytes(s.TotalSizeBytes).String(), ""})
+	return t
+}
+
+func registerBucketHealth(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command("health", "Print the compaction health of the compaction groups of the bucket, as reported by the compactor after each compaction iteration.")
+
+	tbc := &bucketHealthConfig{}
+	tbc.registerBucketHealthFlag(cmd)
+
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		selectorLabels, err := parseFlagLabels(tbc.selector)
 		if err != nil {
-			return errors.Wrap(err, "get content of relabel configuration")
+			return errors.Wrap(err, "error parsing selector flag")
 		}
 
-		relabelConfig, err := block.ParseRelabelConfig(relabelContentYaml, block.SelectorSupportedRelabelActions)
+		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
 		}
 
-		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Retention.String())
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
 		if err != nil {
 			return err
 		}
@@ -1315,55 +1830,191 @@ func registerBucketRetention(app extkingpin.AppClause, objStoreConfig *extflag.P
 
 		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
 
-		// While fetching blocks, we filter out blocks that were marked for deletion by using IgnoreDeletionMarkFilter.
-		// The delay of deleteDelay/2 is added to ensure we fetch blocks that are meant to be deleted but do not have a replacement yet.
-		// This is to make sure compactor will not accidentally perform compactions with gap instead.
-		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, tbc.deleteDelay/2, tbc.blockSyncConcurrency)
-		duplicateBlocksFilter := block.NewDeduplicateFilter(tbc.blockSyncConcurrency)
-		stubCounter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+		ctx, cancel := context.WithTimeout(context.Background(), tbc.timeout)
+		defer cancel()
 
-		var sy *compact.Syncer
-		{
-			baseMetaFetcher, err := block.NewBaseFetcher(logger, tbc.blockSyncConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg))
-			if err != nil {
-				return errors.Wrap(err, "create meta fetcher")
+		healths, err := compact.ReadHealth(ctx, bkt)
+		if err != nil {
+			return err
+		}
+		var selected []*compact.GroupHealth
+		for _, h := range healths {
+			if matchesLabels(h.Labels, selectorLabels) {
+				selected = append(selected, h)
 			}
-			cf := baseMetaFetcher.NewMetaFetcher(
-				extprom.WrapRegistererWithPrefix(extpromPrefix, reg), []block.MetadataFilter{
-					block.NewLabelShardedMetaFilter(relabelConfig),
-					block.NewConsistencyDelayMetaFilter(logger, tbc.consistencyDelay, extprom.WrapRegistererWithPrefix(extpromPrefix, reg)),
-					duplicateBlocksFilter,
-					ignoreDeletionMarkFilter,
-				},
-			)
-			sy, err = compact.NewMetaSyncer(
-				logger,
-				reg,
-				bkt,
-				cf,
-				duplicateBlocksFilter,
-				ignoreDeletionMarkFilter,
-				stubCounter,
-				stubCounter,
-			)
-			if err != nil {
-				return errors.Wrap(err, "create syncer")
+		}
+		status := compact.HealthStatus(selected, time.Now(), int(tbc.staleIterations))
+		for _, s := range status {
+			if s.Stale {
+				level.Warn(logger).Log("msg", "compaction health of group is stale", "group", s.Group, "updated", time.Unix(s.UpdateTime, 0).Format(time.RFC3339))
 			}
 		}
 
-		ctx := context.Background()
-		level.Info(logger).Log("msg", "syncing blocks metadata")
-		if err := sy.SyncMetas(ctx); err != nil {
-			return errors.Wrap(err, "sync blocks")
+		var printer tablePrinter
+		switch outputType(tbc.output) {
+		case TABLE:
+			printer = printTable
+		case TSV:
+			printer = printTSV
+		case CSV:
+			printer = printCSV
+		default:
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(status)
 		}
+		return printer(os.Stdout, healthTable(status))
+	})
+}
 
-		level.Info(logger).Log("msg", "synced blocks done")
+func healthTable(status []compact.GroupHealthStatus) Table {
+	t := Table{Header: []string{"GROUP", "LABELS", "RESOLUTION", "UPDATED", "LAST-COMPACTION", "#PENDING-BLOCKS", "OLDEST-UNCOMPACTED", "HALTED", "STALE", "ERROR"}}
+	for _, s := range status {
+		var lset []string
+		for _, key := range getKeysAlphabetically(s.Labels) {
+			lset = append(lset, fmt.Sprintf("%s=%s", key, s.Labels[key]))
+		}
+		lastCompaction := "-"
+		if s.LastSuccessfulCompactionTime > 0 {
+			lastCompaction = time.Unix(s.LastSuccessfulCompactionTime, 0).Format(time.RFC3339)
+		}
+		oldest := "-"
+		if s.PendingBlocks > 0 {
+			oldest = (time.Duration(s.OldestUncompactedBlockAge) * time.Second).String()
+		}
+		t.Lines = append(t.Lines, []string{
+			s.Group,
+			strings.Join(lset, ","),
+			time.Duration(s.Resolution * int64(time.Millisecond)).String(),
+			time.Unix(s.UpdateTime, 0).Format(time.RFC3339),
+			lastCompaction,
+			strconv.Itoa(s.PendingBlocks),
+			oldest,
+			strconv.FormatBool(s.Halted),
+			strconv.FormatBool(s.Stale),
+			s.Error,
+		})
+	}
+	return t
+}
+
+func registerBucketAnalyze(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command("analyze", "Analyze the cardinality of a block by streaming its index from the bucket, without downloading the block.")
 
-		level.Warn(logger).Log("msg", "GLOBAL COMPACTOR SHOULD __NOT__ BE RUNNING ON THE SAME BUCKET")
+	tbc := &bucketAnalyzeConfig{}
+	tbc.registerBucketAnalyzeFlag(cmd)
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, sy.Metas(), retentionByResolution, stubCounter); err != nil {
-			return errors.Wrap(err, "retention failed")
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		id, err := ulid.Parse(tbc.id)
+		if err != nil {
+			return errors.Wrapf(err, "parse block ID %s", tbc.id)
 		}
-		return nil
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		a, err := block.AnalyzeIndex(context.Background(), logger, bkt, id, block.IndexAnalysisOptions{
+			Limit:         tbc.limit,
+			SampledChunks: tbc.sampledChunks,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "analyze block %s", id)
+		}
+
+		if tbc.output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			return enc.Encode(a)
+		}
+		return printIndexAnalysis(os.Stdout, a)
 	})
 }
+
+func printIndexAnalysis(w io.Writer, a *block.IndexAnalysis) error {
+	p := message.NewPrinter(language.English)
+	fmt.Fprintf(w, "Block ID: %s\n", a.ULID)
+	fmt.Fprintf(w, "Index version: %d, size: %s\n", a.IndexVersion, units.Base2Bytes(a.IndexBytes).String())
+	p.Fprintf(w, "Series: %d, chunks: %d, label names: %d, label pairs: %d\n", a.Series, a.Chunks, a.LabelNames, a.LabelPairs)
+
+	sections := Table{Header: []string{"SECTION", "SIZE", "%"}}
+	for _, s := range a.Sections {
+		sections.Lines = append(sections.Lines, []string{s.Name, units.Base2Bytes(s.Bytes).String(), percent(s.Bytes, a.IndexBytes)})
+	}
+	pairs := func(stats []block.LabelPairStats) Table {
+		t := Table{Header: []string{"LABEL PAIR", "#SERIES", "POSTINGS-SIZE"}}
+		for _, s := range stats {
+			t.Lines = append(t.Lines, []string{fmt.Sprintf("%s=%q", s.Name, s.Value), p.Sprint(s.Series), units.Base2Bytes(s.PostingsBytes).String()})
+		}
+		return t
+	}
+	names := func(stats []block.LabelNameStats) Table {
+		t := Table{Header: []string{"LABEL NAME", "#VALUES", "#SERIES", "POSTINGS-SIZE"}}
+		for _, s := range stats {
+			t.Lines = append(t.Lines, []string{s.Name, p.Sprint(s.Values), p.Sprint(s.Series), units.Base2Bytes(s.PostingsBytes).String()})
+		}
+		return t
+	}
+	churn := func(header string, stats []block.ChurnStats) Table {
+		t := Table{Header: []string{header, "CHURN (SERIES)"}}
+		for _, s := range stats {
+			key := s.Name
+			if s.Value != "" {
+				key = fmt.Sprintf("%s=%q", s.Name, s.Value)
+			}
+			t.Lines = append(t.Lines, []string{key, strconv.FormatFloat(s.Churn, 'f', 2, 64)})
+		}
+		return t
+	}
+
+	type titledTable struct {
+		title string
+		table Table
+	}
+	tables := []titledTable{
+		{title: "Index sections", table: sections},
+		{title: "Label pairs with the most series", table: pairs(a.TopLabelPairs)},
+		{title: "Metric names with the most series", table: pairs(a.TopMetricNames)},
+		{title: "Label names with the most values", table: names(a.TopLabelNamesByValues)},
+		{title: "Label names with the largest postings", table: names(a.TopLabelNamesByPostings)},
+		{title: "Label names most involved in churning", table: churn("LABEL NAME", a.TopChurnLabelNames)},
+		{title: "Label pairs most involved in churning (estimated)", table: churn("LABEL PAIR", a.TopChurnLabelPairs)},
+	}
+	if c := a.ChunkSample; c != nil && c.Chunks > 0 {
+		t := Table{Header: []string{"ENCODING", "#CHUNKS"}}
+		for enc, n := range c.Encodings {
+			t.Lines = append(t.Lines, []string{enc, p.Sprint(n)})
+		}
+		sort.Slice(t.Lines, func(i, j int) bool { return t.Lines[i][0] < t.Lines[j][0] })
+		tables = append(tables, titledTable{
+			title: p.Sprintf("Sampled chunks: %d, %.1f samples per chunk, %.2f bytes per sample", c.Chunks,
+				float64(c.Samples)/float64(c.Chunks), float64(c.Bytes)/math.Max(1, float64(c.Samples))),
+			table: t,
+		})
+	}
+	for _, t := range tables {
+		fmt.Fprintf(w, "\n%s:\n", t.title)
+		if err := printTable(w, t.table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func percent(v, total uint64) string {
+	if total == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(v)*100/float64(total), 'f', 1, 64)
+}
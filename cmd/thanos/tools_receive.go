@@ -0,0 +1,89 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	extflag "github.com/efficientgo/tools/extkingpin"
+	"github.com/go-kit/log"
+	"github.com/oklog/run"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/receive"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+type receiveRouteConfig struct {
+	hashrings          *extflag.PathOrContent
+	hashringsAlgorithm string
+	replicationFactor  uint64
+	tenant             string
+	labels             string
+}
+
+func (rc *receiveRouteConfig) registerFlag(cmd extkingpin.FlagClause) *receiveRouteConfig {
+	rc.hashrings = extflag.RegisterPathOrContent(cmd, "receive.hashrings", "JSON file that contains the hashring configuration of the receivers.", extflag.WithRequired())
+	hashringAlgorithmsHelptext := strings.Join([]string{string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama)}, ", ")
+	cmd.Flag("receive.hashrings-algorithm", "The algorithm used by the receivers when distributing series in the hashrings. Must be one of "+hashringAlgorithmsHelptext).
+		Default(string(receive.AlgorithmHashmod)).
+		EnumVar(&rc.hashringsAlgorithm, string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama))
+	cmd.Flag("receive.replication-factor", "Replication factor of the receivers, i.e. number of endpoints owning each series.").Default("1").Uint64Var(&rc.replicationFactor)
+	cmd.Flag("tenant", "Tenant of the series.").Default(receive.DefaultTenant).StringVar(&rc.tenant)
+	cmd.Flag("labels", "Labels of the series, e.g. 'up{job=\"node\"}' or '{__name__=\"up\", job=\"node\"}'. They are sorted by name, as Prometheus sends them in remote write requests.").
+		Required().StringVar(&rc.labels)
+	return rc
+}
+
+func registerToolsReceive(app extkingpin.AppClause) {
+	cmd := app.Command("receive", "Receive utility commands")
+
+	registerReceiveRoute(cmd)
+}
+
+func registerReceiveRoute(app extkingpin.AppClause) {
+	cmd := app.Command("route", "Print the hash of a series of a tenant and the receive endpoints owning it according to a hashring configuration, in replication order.")
+
+	rc := &receiveRouteConfig{}
+	rc.registerFlag(cmd)
+
+	cmd.Setup(func(g *run.Group, _ log.Logger, _ *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		lset, err := parser.ParseMetric(rc.labels)
+		if err != nil {
+			return errors.Wrapf(err, "parse labels %s", rc.labels)
+		}
+		content, err := rc.hashrings.Content()
+		if err != nil {
+			return errors.Wrap(err, "get content of hashrings configuration")
+		}
+		ring, err := receive.HashringFromConfig(receive.HashringAlgorithm(rc.hashringsAlgorithm), string(content))
+		if err != nil {
+			return err
+		}
+		if ring == nil {
+			return errors.New("hashrings configuration is empty")
+		}
+
+		ts := &prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+		fmt.Fprintf(os.Stdout, "hash: %016x\n", receive.HashSeries(rc.tenant, ts.Labels))
+		for n := uint64(0); n < rc.replicationFactor; n++ {
+			endpoint, err := ring.GetN(rc.tenant, ts, n)
+			if err != nil {
+				return errors.Wrapf(err, "get endpoint of replica %d", n)
+			}
+			fmt.Fprintln(os.Stdout, endpoint)
+		}
+		return nil
+	})
+}
@@ -4,10 +4,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
 
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -45,3 +55,96 @@ func Test_CheckRules_Glob(t *testing.T) {
 	files = &[]string{"./testdata/rules-files/*.yamlaaa"}
 	testutil.NotOk(t, checkRulesFiles(logger, files), "expected err for file %s", files)
 }
+
+func TestBucketMarkBlock_SelectAndMark(t *testing.T) {
+	meta := func(id uint64, mint, maxt int64, region string, res int64, lvl int) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(id, nil),
+				MinTime:    mint,
+				MaxTime:    maxt,
+				Compaction: tsdb.BlockMetaCompaction{Level: lvl},
+			},
+			Thanos: metadata.Thanos{
+				Labels:     map[string]string{"region": region},
+				Downsample: metadata.ThanosDownsample{Resolution: res},
+			},
+		}
+	}
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for _, m := range []*metadata.Meta{
+		meta(1, 0, 1000, "eu", 0, 1),
+		meta(2, 1000, 2000, "eu", 0, 1),
+		meta(3, 1000, 2000, "us", 0, 1),
+		meta(4, 0, 2000, "eu", 0, 2),
+		meta(5, 0, 2000, "eu", 300000, 2),
+	} {
+		metas[m.ULID] = m
+	}
+	ids := func(ms []*metadata.Meta) (res []uint64) {
+		for _, m := range ms {
+			res = append(res, m.ULID.Time())
+		}
+		return res
+	}
+
+	_, err := (&bucketMarkBlockConfig{}).blockSelection()
+	testutil.NotOk(t, err)
+
+	minTime, maxTime := time.Unix(2, 0), time.Unix(1, 0)
+	_, err = (&bucketMarkBlockConfig{minTime: model.TimeOrDurationValue{Time: &minTime}, maxTime: model.TimeOrDurationValue{Time: &maxTime}}).blockSelection()
+	testutil.NotOk(t, err)
+
+	sel, err := (&bucketMarkBlockConfig{selector: []string{`region="eu"`}, resolutions: []time.Duration{0}, compactions: []int{1}}).blockSelection()
+	testutil.Ok(t, err)
+	selected, err := sel.selectBlocks(metas)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []uint64{1, 2}, ids(selected))
+
+	// Blocks are selected if they overlap with the time range.
+	minTime, maxTime = time.Unix(1, 0), time.Unix(1, 500*int64(time.Millisecond))
+	sel, err = (&bucketMarkBlockConfig{minTime: model.TimeOrDurationValue{Time: &minTime}, maxTime: model.TimeOrDurationValue{Time: &maxTime}}).blockSelection()
+	testutil.Ok(t, err)
+	selected, err = sel.selectBlocks(metas)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []uint64{4, 5, 2, 3}, ids(selected))
+
+	// Blocks selected by their ID only are marked without being resolved, unlike the ones of other selections.
+	sel, err = (&bucketMarkBlockConfig{blockIDs: []string{ulid.MustNew(3, nil).String()}}).blockSelection()
+	testutil.Ok(t, err)
+	testutil.Assert(t, sel.idsOnly())
+
+	sel, err = (&bucketMarkBlockConfig{blockIDs: []string{ulid.MustNew(3, nil).String(), ulid.MustNew(4, nil).String()}, compactions: []int{2}}).blockSelection()
+	testutil.Ok(t, err)
+	testutil.Assert(t, !sel.idsOnly())
+	selected, err = sel.selectBlocks(metas)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []uint64{4}, ids(selected))
+
+	sel, err = (&bucketMarkBlockConfig{blockIDs: []string{ulid.MustNew(6, nil).String()}}).blockSelection()
+	testutil.Ok(t, err)
+	_, err = sel.selectBlocks(metas)
+	testutil.NotOk(t, err)
+
+	// Marking is idempotent, and so is removing the marker.
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	marked := []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}
+	testutil.Equals(t, markResult{done: 2}, markBlocks(ctx, log.NewNopLogger(), bkt, marked, metadata.NoCompactMarkFilename, "bad scrape", false))
+	testutil.Equals(t, markResult{skipped: 2}, markBlocks(ctx, log.NewNopLogger(), bkt, marked, metadata.NoCompactMarkFilename, "bad scrape", false))
+	ok, err := bkt.Exists(ctx, path.Join(ulid.MustNew(2, nil).String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "no-compact mark not written")
+
+	testutil.Equals(t, markResult{done: 2}, markBlocks(ctx, log.NewNopLogger(), bkt, marked, metadata.NoCompactMarkFilename, "", true))
+	testutil.Equals(t, markResult{skipped: 2}, markBlocks(ctx, log.NewNopLogger(), bkt, marked, metadata.NoCompactMarkFilename, "", true))
+	testutil.Equals(t, 0, len(bkt.Objects()))
+}
+
+func TestConfirm(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "yes": true, "n\n": false, "\n": false, "": false} {
+		var out bytes.Buffer
+		testutil.Equals(t, expected, confirm(strings.NewReader(answer), &out, "Mark? "), "answer %q", answer)
+		testutil.Equals(t, "Mark? ", out.String())
+	}
+}
@@ -5,10 +5,12 @@ package queryrange
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/weaveworks/common/httpgrpc"
 
@@ -24,6 +26,10 @@ type Limits interface {
 	// MaxQueryLookback returns the max lookback period of queries.
 	MaxQueryLookback(userID string) time.Duration
 
+	// MaxQueryLookbackReject returns whether the queries starting before the
+	// max lookback are rejected, instead of having their start clamped.
+	MaxQueryLookbackReject(userID string) bool
+
 	// MaxQueryLength returns the limit of the length (in time) of a query.
 	MaxQueryLength(string) time.Duration
 
@@ -34,6 +40,10 @@ type Limits interface {
 	// MaxCacheFreshness returns the period after which results are cacheable,
 	// to prevent caching of very recent results.
 	MaxCacheFreshness(string) time.Duration
+
+	// ResultsCacheDisabled returns whether the results of queries of the tenant
+	// should not be cached.
+	ResultsCacheDisabled(string) bool
 }
 
 type limitsMiddleware struct {
@@ -60,31 +70,52 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 	}
 
-	// Clamp the time range based on the max query lookback.
-
+	// Clamp the time range based on the max query lookback, or reject the query if configured to.
 	if maxQueryLookback := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxQueryLookback); maxQueryLookback > 0 {
 		minStartTime := util.TimeToMillis(time.Now().Add(-maxQueryLookback))
 
-		if r.GetEnd() < minStartTime {
-			// The request is fully outside the allowed range, so we can return an
-			// empty response.
-			level.Debug(log).Log(
-				"msg", "skipping the execution of the query because its time range is before the 'max query lookback' setting",
-				"reqStart", util.FormatTimeMillis(r.GetStart()),
-				"redEnd", util.FormatTimeMillis(r.GetEnd()),
-				"maxQueryLookback", maxQueryLookback)
-
-			return NewEmptyPrometheusResponse(), nil
-		}
-
 		if r.GetStart() < minStartTime {
+			if validation.AnyTruePerTenant(tenantIDs, l.MaxQueryLookbackReject) {
+				return nil, httpgrpc.Errorf(http.StatusUnprocessableEntity, "the query starts at %s, before the max lookback of %s, only data after %s can be queried",
+					formatRFC3339Millis(r.GetStart()), model.Duration(maxQueryLookback), formatRFC3339Millis(minStartTime))
+			}
+
+			// Move the start forward by whole steps, so that the evaluation timestamps are kept.
+			start := minStartTime
+			if step := r.GetStep(); step > 0 {
+				start = r.GetStart() + ((minStartTime-r.GetStart()+step-1)/step)*step
+			}
+			warning := fmt.Sprintf("the query starts before the max lookback of %s, only data after %s was queried",
+				model.Duration(maxQueryLookback), formatRFC3339Millis(start))
+
+			if start > r.GetEnd() {
+				// The request is fully outside the allowed range, so we can return an
+				// empty response.
+				level.Debug(log).Log(
+					"msg", "skipping the execution of the query because its time range is before the 'max query lookback' setting",
+					"reqStart", util.FormatTimeMillis(r.GetStart()),
+					"redEnd", util.FormatTimeMillis(r.GetEnd()),
+					"maxQueryLookback", maxQueryLookback)
+
+				resp := NewEmptyPrometheusResponse()
+				resp.Warnings = []string{warning}
+				return resp, nil
+			}
+
 			// Replace the start time in the request.
 			level.Debug(log).Log(
 				"msg", "the start time of the query has been manipulated because of the 'max query lookback' setting",
 				"original", util.FormatTimeMillis(r.GetStart()),
-				"updated", util.FormatTimeMillis(minStartTime))
-
-			r = r.WithStartEnd(minStartTime, r.GetEnd())
+				"updated", util.FormatTimeMillis(start))
+
+			resp, err := l.next.Do(ctx, r.WithStartEnd(start, r.GetEnd()))
+			if err != nil {
+				return nil, err
+			}
+			if promResp, ok := resp.(*PrometheusResponse); ok {
+				promResp.Warnings = append(promResp.Warnings, warning)
+			}
+			return resp, nil
 		}
 	}
 
@@ -98,3 +129,8 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 
 	return l.next.Do(ctx, r)
 }
+
+// formatRFC3339Millis formats a timestamp in milliseconds for the messages returned to users.
+func formatRFC3339Millis(ms int64) string {
+	return util.TimeFromMillis(ms).UTC().Format(time.RFC3339)
+}
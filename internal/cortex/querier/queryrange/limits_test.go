@@ -5,12 +5,14 @@ package queryrange
 
 import (
 	"context"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 
 	"github.com/thanos-io/thanos/internal/cortex/util"
@@ -105,6 +107,48 @@ func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
 	}
 }
 
+func TestLimitsMiddleware_MaxQueryLookbackStepsAndReject(t *testing.T) {
+	const (
+		thirtyDays = 30 * 24 * time.Hour
+	)
+
+	now := time.Now()
+	req := &PrometheusRequest{
+		Start: util.TimeToMillis(now.Add(-thirtyDays).Add(-100*time.Hour - 30*time.Minute)),
+		End:   util.TimeToMillis(now),
+		Step:  time.Hour.Milliseconds(),
+	}
+	ctx := user.InjectOrgID(context.Background(), "test")
+
+	t.Run("should move the start forward by whole steps with a warning", func(t *testing.T) {
+		innerRes := NewEmptyPrometheusResponse()
+		inner := &mockHandler{}
+		inner.On("Do", mock.Anything, mock.Anything).Return(innerRes, nil)
+
+		res, err := NewLimitsMiddleware(mockLimits{maxQueryLookback: thirtyDays}).Wrap(inner).Do(ctx, req)
+		require.NoError(t, err)
+		assert.Same(t, innerRes, res)
+
+		require.Len(t, inner.Calls, 1)
+		assert.Equal(t, req.Start+101*time.Hour.Milliseconds(), inner.Calls[0].Arguments.Get(1).(Request).GetStart())
+		assert.Equal(t, req.End, inner.Calls[0].Arguments.Get(1).(Request).GetEnd())
+		require.Len(t, innerRes.Warnings, 1)
+		assert.Contains(t, innerRes.Warnings[0], "the query starts before the max lookback of 30d")
+	})
+
+	t.Run("should reject the query if configured to", func(t *testing.T) {
+		inner := &mockHandler{}
+
+		res, err := NewLimitsMiddleware(mockLimits{maxQueryLookback: thirtyDays, lookbackReject: true}).Wrap(inner).Do(ctx, req)
+		require.Error(t, err)
+		assert.Nil(t, res)
+		httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+		require.True(t, ok)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), httpResp.Code)
+		assert.Len(t, inner.Calls, 0)
+	})
+}
+
 func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 	const (
 		thirtyDays = 30 * 24 * time.Hour
@@ -191,14 +235,20 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 
 type mockLimits struct {
 	maxQueryLookback  time.Duration
+	lookbackReject    bool
 	maxQueryLength    time.Duration
 	maxCacheFreshness time.Duration
+	cacheDisabled     bool
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
 	return m.maxQueryLookback
 }
 
+func (m mockLimits) MaxQueryLookbackReject(string) bool {
+	return m.lookbackReject
+}
+
 func (m mockLimits) MaxQueryLength(string) time.Duration {
 	return m.maxQueryLength
 }
@@ -211,6 +261,10 @@ func (m mockLimits) MaxCacheFreshness(string) time.Duration {
 	return m.maxCacheFreshness
 }
 
+func (m mockLimits) ResultsCacheDisabled(string) bool {
+	return m.cacheDisabled
+}
+
 type mockHandler struct {
 	mock.Mock
 }
@@ -52,6 +52,13 @@ var (
 	cacheControlHeader = "Cache-Control"
 )
 
+const (
+	// maxMergedAnnotations is the maximum number of warnings and of infos kept in a merged response.
+	maxMergedAnnotations = 100
+	// truncatedAnnotationsFormat is the format of the last annotation of a merged response, if annotations were truncated.
+	truncatedAnnotationsFormat = "%d more annotations were truncated"
+)
+
 // Codec is used to encode/decode query range requests and responses so they can be passed down to middlewares.
 type Codec interface {
 	Merger
@@ -192,6 +199,10 @@ func (prometheusCodec) MergeResponse(responses ...Response) (Response, error) {
 			Stats:      statsMerge(promResponses),
 		},
 	}
+	for _, res := range promResponses {
+		response.Warnings = mergeAnnotations(response.Warnings, res.Warnings)
+		response.Infos = mergeAnnotations(response.Infos, res.Infos)
+	}
 
 	if len(resultsCacheGenNumberHeaderValues) != 0 {
 		response.Headers = []*PrometheusResponseHeader{{
@@ -254,6 +265,9 @@ func (prometheusCodec) DecodeRequest(_ context.Context, r *http.Request, forward
 			result.CachingOptions.Disabled = true
 			break
 		}
+		if strings.Contains(value, noCacheValue) {
+			result.CachingOptions.Refresh = true
+		}
 	}
 
 	return &result, nil
@@ -438,6 +452,49 @@ func statsMerge(resps []*PrometheusResponse) *PrometheusResponseStats {
 	return result
 }
 
+// mergeAnnotations merges the annotations of two responses in order, dropping duplicates. At most maxMergedAnnotations are
+// kept, followed by an annotation with the number of truncated ones, which is summed up if responses are merged again.
+func mergeAnnotations(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+
+	var (
+		merged    = make([]string, 0, len(a)+len(b))
+		seen      = make(map[string]struct{}, len(a)+len(b))
+		truncated int
+	)
+	for _, annotations := range [][]string{a, b} {
+		for _, annotation := range annotations {
+			if n, ok := parseTruncatedAnnotations(annotation); ok {
+				truncated += n
+				continue
+			}
+			if _, ok := seen[annotation]; ok {
+				continue
+			}
+			seen[annotation] = struct{}{}
+			if len(merged) >= maxMergedAnnotations {
+				truncated++
+				continue
+			}
+			merged = append(merged, annotation)
+		}
+	}
+	if truncated > 0 {
+		merged = append(merged, fmt.Sprintf(truncatedAnnotationsFormat, truncated))
+	}
+	return merged
+}
+
+func parseTruncatedAnnotations(annotation string) (int, bool) {
+	var n int
+	if _, err := fmt.Sscanf(annotation, truncatedAnnotationsFormat, &n); err != nil {
+		return 0, false
+	}
+	return n, fmt.Sprintf(truncatedAnnotationsFormat, n) == annotation
+}
+
 func matrixMerge(resps []*PrometheusResponse) []SampleStream {
 	output := map[string]*SampleStream{}
 	for _, resp := range resps {
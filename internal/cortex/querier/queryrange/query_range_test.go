@@ -6,6 +6,7 @@ package queryrange
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -88,6 +89,9 @@ func TestRequest(t *testing.T) {
 func TestResponse(t *testing.T) {
 	r := *parsedResponse
 	r.Headers = respHeaders
+	withAnnotations := r
+	withAnnotations.Warnings = []string{"PromQL warning: possible missing counter reset info"}
+	withAnnotations.Infos = []string{"PromQL info: metric might not be a counter"}
 	for i, tc := range []struct {
 		body     string
 		expected *PrometheusResponse
@@ -96,6 +100,10 @@ func TestResponse(t *testing.T) {
 			body:     responseBody,
 			expected: &r,
 		},
+		{
+			body:     responseBody[:len(responseBody)-1] + `,"warnings":["PromQL warning: possible missing counter reset info"],"infos":["PromQL info: metric might not be a counter"]}`,
+			expected: &withAnnotations,
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			response := &http.Response{
@@ -667,3 +675,59 @@ func mustParse(t *testing.T, response string) Response {
 	require.NoError(t, json.Unmarshal([]byte(response), &resp))
 	return &resp
 }
+
+func TestMergeAPIResponsesAnnotations(t *testing.T) {
+	mkResponse := func(start int64, warnings, infos []string) Response {
+		return &PrometheusResponse{
+			Status: StatusSuccess,
+			Data: PrometheusData{
+				ResultType: matrix,
+				Result: []SampleStream{{
+					Labels:  []cortexpb.LabelAdapter{{Name: "a", Value: "b"}},
+					Samples: []cortexpb.Sample{{Value: 1, TimestampMs: start}},
+				}},
+			},
+			Warnings: warnings,
+			Infos:    infos,
+		}
+	}
+
+	t.Run("deduplicated in order of the split queries", func(t *testing.T) {
+		merged, err := PrometheusCodec.MergeResponse(
+			mkResponse(2000, []string{"w2", "w1"}, nil),
+			mkResponse(1000, []string{"w1"}, []string{"i1"}),
+			mkResponse(3000, []string{"w3", "w2"}, []string{"i1"}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, []string{"w1", "w2", "w3"}, merged.(*PrometheusResponse).Warnings)
+		require.Equal(t, []string{"i1"}, merged.(*PrometheusResponse).Infos)
+	})
+
+	t.Run("no annotations", func(t *testing.T) {
+		merged, err := PrometheusCodec.MergeResponse(mkResponse(1000, nil, nil), mkResponse(2000, nil, nil))
+		require.NoError(t, err)
+		require.Nil(t, merged.(*PrometheusResponse).Warnings)
+		require.Nil(t, merged.(*PrometheusResponse).Infos)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var first, second []string
+		for i := 0; i < maxMergedAnnotations; i++ {
+			first = append(first, fmt.Sprintf("w%d", i))
+			second = append(second, fmt.Sprintf("w%d", i+maxMergedAnnotations-2))
+		}
+		merged, err := PrometheusCodec.MergeResponse(mkResponse(1000, first, nil), mkResponse(2000, second, nil))
+		require.NoError(t, err)
+		warnings := merged.(*PrometheusResponse).Warnings
+		require.Equal(t, maxMergedAnnotations+1, len(warnings))
+		require.Equal(t, first, warnings[:maxMergedAnnotations])
+		require.Equal(t, "98 more annotations were truncated", warnings[maxMergedAnnotations])
+
+		// Merging merged responses again sums up the truncated annotations.
+		merged, err = PrometheusCodec.MergeResponse(merged, mkResponse(3000, []string{"w0", "other"}, nil))
+		require.NoError(t, err)
+		warnings = merged.(*PrometheusResponse).Warnings
+		require.Equal(t, maxMergedAnnotations+1, len(warnings))
+		require.Equal(t, "99 more annotations were truncated", warnings[maxMergedAnnotations])
+	})
+}
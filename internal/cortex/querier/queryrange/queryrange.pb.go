@@ -247,6 +247,9 @@ type PrometheusResponse struct {
 	ErrorType string                      `protobuf:"bytes,3,opt,name=ErrorType,proto3" json:"errorType,omitempty"`
 	Error     string                      `protobuf:"bytes,4,opt,name=Error,proto3" json:"error,omitempty"`
 	Headers   []*PrometheusResponseHeader `protobuf:"bytes,5,rep,name=Headers,proto3" json:"-"`
+	// PromQL annotations of the query, merged across split queries.
+	Warnings []string `protobuf:"bytes,6,rep,name=Warnings,proto3" json:"warnings,omitempty"`
+	Infos    []string `protobuf:"bytes,7,rep,name=Infos,proto3" json:"infos,omitempty"`
 }
 
 func (m *PrometheusResponse) Reset()      { *m = PrometheusResponse{} }
@@ -316,6 +319,20 @@ func (m *PrometheusResponse) GetHeaders() []*PrometheusResponseHeader {
 	return nil
 }
 
+func (m *PrometheusResponse) GetWarnings() []string {
+	if m != nil {
+		return m.Warnings
+	}
+	return nil
+}
+
+func (m *PrometheusResponse) GetInfos() []string {
+	if m != nil {
+		return m.Infos
+	}
+	return nil
+}
+
 type PrometheusData struct {
 	ResultType string                   `protobuf:"bytes,1,opt,name=ResultType,proto3" json:"resultType"`
 	Result     []SampleStream           `protobuf:"bytes,2,rep,name=Result,proto3" json:"result"`
@@ -570,6 +587,8 @@ type CachedResponse struct {
 	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key"`
 	// List of cached responses; non-overlapping and in order.
 	Extents []Extent `protobuf:"bytes,2,rep,name=extents,proto3" json:"extents"`
+	// Version of the format of the cached responses, 0 for responses cached before annotations were added.
+	Version uint32 `protobuf:"varint,3,opt,name=version,proto3" json:"version"`
 }
 
 func (m *CachedResponse) Reset()      { *m = CachedResponse{} }
@@ -618,6 +637,13 @@ func (m *CachedResponse) GetExtents() []Extent {
 	return nil
 }
 
+func (m *CachedResponse) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
 type Extent struct {
 	Start    int64      `protobuf:"varint,1,opt,name=start,proto3" json:"start"`
 	End      int64      `protobuf:"varint,2,opt,name=end,proto3" json:"end"`
@@ -687,6 +713,8 @@ func (m *Extent) GetResponse() *types.Any {
 
 type CachingOptions struct {
 	Disabled bool `protobuf:"varint,1,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	// refresh skips the lookup of cached results, the results are still stored in the cache.
+	Refresh bool `protobuf:"varint,2,opt,name=refresh,proto3" json:"refresh,omitempty"`
 }
 
 func (m *CachingOptions) Reset()      { *m = CachingOptions{} }
@@ -728,6 +756,13 @@ func (m *CachingOptions) GetDisabled() bool {
 	return false
 }
 
+func (m *CachingOptions) GetRefresh() bool {
+	if m != nil {
+		return m.Refresh
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*PrometheusRequestHeader)(nil), "queryrange.PrometheusRequestHeader")
 	proto.RegisterType((*PrometheusRequest)(nil), "queryrange.PrometheusRequest")
@@ -746,70 +781,75 @@ func init() {
 func init() { proto.RegisterFile("queryrange.proto", fileDescriptor_79b02382e213d0b2) }
 
 var fileDescriptor_79b02382e213d0b2 = []byte{
-	// 1007 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x4f, 0x6f, 0x1b, 0x55,
-	0x10, 0xf7, 0xfa, 0xbf, 0xc7, 0x91, 0x1b, 0x5e, 0x0a, 0x5d, 0x47, 0xb0, 0x6b, 0xb6, 0x1c, 0x02,
-	0x6a, 0x1d, 0x29, 0x88, 0x03, 0x95, 0x40, 0xed, 0x92, 0xa0, 0xf2, 0xaf, 0x4d, 0x9f, 0x2b, 0x0e,
-	0x5c, 0xaa, 0x67, 0xef, 0xc3, 0xd9, 0xd6, 0xeb, 0xdd, 0xbe, 0x7d, 0x8b, 0xe2, 0x1b, 0x1f, 0x81,
-	0x03, 0x07, 0x8e, 0x1c, 0x41, 0xe2, 0x63, 0x70, 0xe8, 0x31, 0xe2, 0x54, 0x71, 0x58, 0x88, 0x73,
-	0x41, 0x7b, 0xea, 0x47, 0x40, 0xef, 0xcf, 0xda, 0x1b, 0x27, 0x35, 0xaa, 0xb8, 0x58, 0x6f, 0xe6,
-	0xcd, 0x6f, 0x66, 0xde, 0x6f, 0x66, 0x67, 0x0c, 0x9b, 0x4f, 0x13, 0xca, 0x66, 0x8c, 0x4c, 0xc7,
-	0xb4, 0x1f, 0xb1, 0x90, 0x87, 0x08, 0x96, 0x9a, 0xed, 0x9b, 0x63, 0x9f, 0x1f, 0x25, 0xc3, 0xfe,
-	0x28, 0x0c, 0x76, 0xc7, 0xe1, 0x38, 0xdc, 0x95, 0x26, 0xc3, 0xe4, 0x5b, 0x29, 0x49, 0x41, 0x9e,
-	0x14, 0x74, 0xdb, 0x1a, 0x87, 0xe1, 0x78, 0x42, 0x97, 0x56, 0x5e, 0xc2, 0x08, 0xf7, 0xc3, 0xa9,
-	0xbe, 0xff, 0xb0, 0xe0, 0x6e, 0x14, 0x32, 0x4e, 0x8f, 0x23, 0x16, 0x3e, 0xa6, 0x23, 0xae, 0xa5,
-	0xdd, 0xe8, 0xc9, 0x38, 0xbf, 0x18, 0xea, 0x83, 0x86, 0x76, 0x57, 0x5d, 0x93, 0xe9, 0x4c, 0x5d,
-	0x39, 0x03, 0xb8, 0x76, 0xc8, 0xc2, 0x80, 0xf2, 0x23, 0x9a, 0xc4, 0x98, 0x3e, 0x4d, 0x68, 0xcc,
-	0xef, 0x52, 0xe2, 0x51, 0x86, 0xba, 0x50, 0xbd, 0x47, 0x02, 0x6a, 0x1a, 0x3d, 0x63, 0xa7, 0xe5,
-	0xd6, 0xb2, 0xd4, 0x36, 0x6e, 0x62, 0xa9, 0x42, 0x6f, 0x41, 0xfd, 0x6b, 0x32, 0x49, 0x68, 0x6c,
-	0x96, 0x7b, 0x95, 0xe5, 0xa5, 0x56, 0x3a, 0x69, 0x19, 0x5e, 0xbb, 0xe0, 0x15, 0x21, 0xa8, 0x46,
-	0x84, 0x1f, 0x29, 0x7f, 0x58, 0x9e, 0xd1, 0x55, 0xa8, 0xc5, 0x9c, 0x30, 0x6e, 0x96, 0x7b, 0xc6,
-	0x4e, 0x05, 0x2b, 0x01, 0x6d, 0x42, 0x85, 0x4e, 0x3d, 0xb3, 0x22, 0x75, 0xe2, 0x28, 0xb0, 0x31,
-	0xa7, 0x91, 0x59, 0x95, 0x2a, 0x79, 0x46, 0x1f, 0x41, 0x83, 0xfb, 0x01, 0x0d, 0x13, 0x6e, 0xd6,
-	0x7a, 0xc6, 0x4e, 0x7b, 0xaf, 0xdb, 0x57, 0xef, 0xec, 0xe7, 0xef, 0xec, 0xef, 0x6b, 0x0a, 0xdd,
-	0xe6, 0xb3, 0xd4, 0x2e, 0xfd, 0xf4, 0x97, 0x6d, 0xe0, 0x1c, 0x23, 0x42, 0xcb, 0x62, 0x99, 0x75,
-	0x99, 0x8f, 0x12, 0xd0, 0x5d, 0xe8, 0x8c, 0xc8, 0xe8, 0xc8, 0x9f, 0x8e, 0xef, 0x47, 0x02, 0x19,
-	0x9b, 0x0d, 0xe9, 0x7b, 0xbb, 0x5f, 0xa8, 0xf5, 0x27, 0xe7, 0x2c, 0xdc, 0xaa, 0x70, 0x8e, 0x57,
-	0x70, 0x68, 0x1f, 0x1a, 0x8a, 0xc8, 0xd8, 0x6c, 0xf6, 0x2a, 0x3b, 0xed, 0xbd, 0xeb, 0x45, 0x17,
-	0x2f, 0x21, 0x3d, 0x67, 0x32, 0x87, 0x6a, 0x82, 0x78, 0x6c, 0xb6, 0x54, 0x96, 0x52, 0x70, 0x1e,
-	0x82, 0x59, 0x74, 0x10, 0x47, 0xe1, 0x34, 0xa6, 0xff, 0xbb, 0x6c, 0xbf, 0x96, 0x01, 0x5d, 0x74,
-	0x8b, 0x1c, 0xa8, 0x0f, 0x38, 0xe1, 0x49, 0xac, 0x5d, 0x42, 0x96, 0xda, 0xf5, 0x58, 0x6a, 0xb0,
-	0xbe, 0x41, 0x9f, 0x42, 0x75, 0x9f, 0x70, 0x22, 0xcb, 0xb8, 0x42, 0xd6, 0xd2, 0xa3, 0xb0, 0x70,
-	0xdf, 0x10, 0x64, 0x65, 0xa9, 0xdd, 0xf1, 0x08, 0x27, 0x37, 0xc2, 0xc0, 0xe7, 0x34, 0x88, 0xf8,
-	0x0c, 0x4b, 0x3c, 0xfa, 0x00, 0x5a, 0x07, 0x8c, 0x85, 0xec, 0xe1, 0x2c, 0xa2, 0xb2, 0xfe, 0x2d,
-	0xf7, 0x5a, 0x96, 0xda, 0x5b, 0x34, 0x57, 0x16, 0x10, 0x4b, 0x4b, 0xf4, 0x2e, 0xd4, 0xa4, 0x20,
-	0xfb, 0xa3, 0xe5, 0x6e, 0x65, 0xa9, 0x7d, 0x45, 0x42, 0x0a, 0xe6, 0xca, 0x02, 0x1d, 0x2c, 0xcb,
-	0x52, 0x93, 0x65, 0x79, 0xe7, 0x65, 0x65, 0x29, 0xb2, 0xba, 0x5a, 0x17, 0xe7, 0x0f, 0x03, 0x3a,
-	0xe7, 0x5f, 0x86, 0xfa, 0x00, 0x98, 0xc6, 0xc9, 0x84, 0xcb, 0xe4, 0x15, 0x57, 0x9d, 0x2c, 0xb5,
-	0x81, 0x2d, 0xb4, 0xb8, 0x60, 0x81, 0x6e, 0x43, 0x5d, 0x49, 0xb2, 0x1a, 0xed, 0x3d, 0xb3, 0x98,
-	0xc8, 0x80, 0x04, 0xd1, 0x84, 0x0e, 0x38, 0xa3, 0x24, 0x70, 0x3b, 0x9a, 0xb3, 0xba, 0xf2, 0x84,
-	0x35, 0x0e, 0xdd, 0xcb, 0x9b, 0xa3, 0x22, 0x69, 0xbf, 0xbe, 0xfe, 0x25, 0xa2, 0x54, 0xb1, 0xe2,
-	0x46, 0xa2, 0x8a, 0xdc, 0xa8, 0xb6, 0x9a, 0x9c, 0x1f, 0x06, 0x05, 0x18, 0x7a, 0x00, 0x8d, 0x58,
-	0xa6, 0xa4, 0xba, 0xa0, 0xbd, 0xf7, 0xde, 0x7f, 0x04, 0x53, 0xc6, 0x2a, 0x66, 0x3b, 0x4b, 0xed,
-	0x1c, 0x8e, 0xf3, 0x83, 0xf3, 0x63, 0x19, 0xac, 0xf5, 0x40, 0x74, 0x1f, 0x5e, 0xe7, 0x21, 0x27,
-	0x93, 0x07, 0x22, 0x14, 0x19, 0x4e, 0xf2, 0x5b, 0x99, 0x43, 0xc5, 0xed, 0x66, 0xa9, 0x7d, 0xb9,
-	0x01, 0xbe, 0x5c, 0x8d, 0x7e, 0x36, 0xe0, 0xcd, 0x4b, 0x6f, 0x0e, 0x29, 0x1b, 0x88, 0x01, 0xa3,
-	0x4a, 0x71, 0x6b, 0xfd, 0xe3, 0x56, 0xc1, 0x32, 0x59, 0xed, 0xc1, 0xed, 0x65, 0xa9, 0xbd, 0x36,
-	0x06, 0x5e, 0x7b, 0xeb, 0xf8, 0xf0, 0x8a, 0x11, 0xc5, 0x8c, 0xf8, 0x4e, 0x7c, 0xc1, 0x8a, 0x15,
-	0xac, 0x04, 0xf4, 0x36, 0x6c, 0x88, 0x51, 0x17, 0x73, 0x12, 0x44, 0x8f, 0x82, 0x58, 0x4f, 0xd8,
-	0xf6, 0x42, 0xf7, 0x55, 0xec, 0xfc, 0x6e, 0xc0, 0x46, 0xb1, 0xd1, 0xd0, 0x31, 0xd4, 0x27, 0x64,
-	0x48, 0x27, 0x82, 0x60, 0xc1, 0xc3, 0x56, 0x3f, 0x5f, 0x28, 0xfd, 0x2f, 0x85, 0xfe, 0x90, 0xf8,
-	0xcc, 0xfd, 0x42, 0x74, 0xe3, 0x9f, 0xa9, 0xfd, 0x4a, 0x0b, 0x49, 0xe1, 0xef, 0x78, 0x24, 0xe2,
-	0x94, 0x89, 0x56, 0x0e, 0x28, 0x67, 0xfe, 0x08, 0xeb, 0x78, 0xe8, 0xd6, 0xb2, 0xbf, 0x54, 0x09,
-	0x36, 0x97, 0xa1, 0x55, 0x8a, 0xcb, 0xaf, 0x40, 0xbe, 0xaf, 0xd0, 0x48, 0x8f, 0xa1, 0x23, 0x26,
-	0x32, 0xf5, 0x16, 0x23, 0xab, 0x0b, 0x95, 0x27, 0x74, 0xa6, 0xbf, 0xc1, 0x46, 0x96, 0xda, 0x42,
-	0xc4, 0xe2, 0x47, 0x6c, 0x0d, 0x7a, 0xcc, 0xe9, 0x94, 0xe7, 0x81, 0x50, 0xb1, 0xd6, 0x07, 0xf2,
-	0xca, 0xbd, 0xa2, 0x43, 0xe5, 0xa6, 0x38, 0x3f, 0x38, 0xbf, 0x19, 0x50, 0x57, 0x46, 0xc8, 0xce,
-	0x77, 0x97, 0x6a, 0xc6, 0x56, 0x96, 0xda, 0x4a, 0x91, 0xaf, 0xb1, 0xae, 0x5a, 0x63, 0x92, 0x78,
-	0x95, 0x05, 0x9d, 0x7a, 0x6a, 0x9f, 0xf5, 0xa0, 0xc9, 0x19, 0x19, 0xd1, 0x47, 0xbe, 0xa7, 0x67,
-	0x56, 0x3e, 0x60, 0xa4, 0xfa, 0x33, 0x0f, 0x7d, 0x0c, 0x4d, 0xa6, 0x9f, 0xa3, 0xd7, 0xdb, 0xd5,
-	0x0b, 0xeb, 0xed, 0xce, 0x74, 0xe6, 0x6e, 0x64, 0xa9, 0xbd, 0xb0, 0xc4, 0x8b, 0xd3, 0xe7, 0xd5,
-	0x66, 0x65, 0xb3, 0xea, 0xdc, 0x50, 0xd4, 0x14, 0xd6, 0xd2, 0x36, 0x34, 0x3d, 0x3f, 0x16, 0xad,
-	0xe4, 0xc9, 0xc4, 0x9b, 0x78, 0x21, 0xbb, 0xb7, 0x4f, 0x4e, 0xad, 0xd2, 0xf3, 0x53, 0xab, 0xf4,
-	0xe2, 0xd4, 0x32, 0xbe, 0x9f, 0x5b, 0xc6, 0x2f, 0x73, 0xcb, 0x78, 0x36, 0xb7, 0x8c, 0x93, 0xb9,
-	0x65, 0xfc, 0x3d, 0xb7, 0x8c, 0x7f, 0xe6, 0x56, 0xe9, 0xc5, 0xdc, 0x32, 0x7e, 0x38, 0xb3, 0x4a,
-	0x27, 0x67, 0x56, 0xe9, 0xf9, 0x99, 0x55, 0xfa, 0xa6, 0xf0, 0x9f, 0x67, 0x58, 0x97, 0xb9, 0xbd,
-	0xff, 0x6f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xe8, 0x24, 0x32, 0x4a, 0x1a, 0x09, 0x00, 0x00,
+	// 1081 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0xcd, 0x6f, 0x1b, 0x45,
+	0x14, 0xf7, 0xc6, 0x8e, 0x3f, 0x9e, 0x8b, 0x1b, 0xa6, 0xa5, 0x5d, 0x47, 0xb0, 0x6b, 0x0c, 0x48,
+	0x01, 0x11, 0x47, 0x0a, 0xe2, 0x52, 0x09, 0xd4, 0x2c, 0x49, 0xd5, 0x22, 0x68, 0xd3, 0x71, 0x05,
+	0x12, 0x97, 0x6a, 0xec, 0x9d, 0xd8, 0x2b, 0xbc, 0x1f, 0x9d, 0x19, 0x97, 0xfa, 0xd6, 0x23, 0x47,
+	0x90, 0x38, 0x70, 0xe4, 0xc8, 0x81, 0x3f, 0xa4, 0x17, 0xa4, 0x88, 0x53, 0xc5, 0x61, 0x21, 0xce,
+	0x05, 0xed, 0xa9, 0x7f, 0x02, 0x9a, 0x8f, 0xb5, 0xb7, 0xf9, 0x42, 0xc0, 0x25, 0x79, 0xef, 0xcd,
+	0xfb, 0xfc, 0xbd, 0xb7, 0xef, 0x19, 0xd6, 0x1e, 0x4d, 0x29, 0x9b, 0x31, 0x12, 0x8d, 0x68, 0x2f,
+	0x61, 0xb1, 0x88, 0x11, 0x2c, 0x25, 0xeb, 0x9b, 0xa3, 0x40, 0x8c, 0xa7, 0x83, 0xde, 0x30, 0x0e,
+	0xb7, 0x46, 0xf1, 0x28, 0xde, 0x52, 0x2a, 0x83, 0xe9, 0x81, 0xe2, 0x14, 0xa3, 0x28, 0x6d, 0xba,
+	0xee, 0x8c, 0xe2, 0x78, 0x34, 0xa1, 0x4b, 0x2d, 0x7f, 0xca, 0x88, 0x08, 0xe2, 0xc8, 0xbc, 0xef,
+	0x14, 0xdc, 0x89, 0x31, 0x89, 0x62, 0xbe, 0x19, 0xc4, 0x86, 0xda, 0x0a, 0x22, 0x41, 0x59, 0x44,
+	0x26, 0x5b, 0xc3, 0x98, 0x09, 0xfa, 0xc4, 0xfc, 0x4b, 0x06, 0x86, 0x30, 0x2e, 0xda, 0x27, 0x43,
+	0x90, 0x68, 0xa6, 0x9f, 0xba, 0x7d, 0xb8, 0xbe, 0xcf, 0xe2, 0x90, 0x8a, 0x31, 0x9d, 0x72, 0x4c,
+	0x1f, 0x4d, 0x29, 0x17, 0xb7, 0x29, 0xf1, 0x29, 0x43, 0x6d, 0xa8, 0xdc, 0x25, 0x21, 0xb5, 0xad,
+	0x8e, 0xb5, 0xd1, 0xf0, 0x56, 0xb3, 0xd4, 0xb5, 0x36, 0xb1, 0x12, 0xa1, 0x37, 0xa0, 0xfa, 0x05,
+	0x99, 0x4c, 0x29, 0xb7, 0x57, 0x3a, 0xe5, 0xe5, 0xa3, 0x11, 0x76, 0xd3, 0x15, 0x78, 0xf5, 0x94,
+	0x57, 0x84, 0xa0, 0x92, 0x10, 0x31, 0xd6, 0xfe, 0xb0, 0xa2, 0xd1, 0x55, 0x58, 0xe5, 0x82, 0x30,
+	0x61, 0xaf, 0x74, 0xac, 0x8d, 0x32, 0xd6, 0x0c, 0x5a, 0x83, 0x32, 0x8d, 0x7c, 0xbb, 0xac, 0x64,
+	0x92, 0x94, 0xb6, 0x5c, 0xd0, 0xc4, 0xae, 0x28, 0x91, 0xa2, 0xd1, 0x47, 0x50, 0x13, 0x41, 0x48,
+	0xe3, 0xa9, 0xb0, 0x57, 0x3b, 0xd6, 0x46, 0x73, 0xbb, 0xdd, 0xd3, 0x75, 0xf6, 0xf2, 0x3a, 0x7b,
+	0xbb, 0x06, 0x4a, 0xaf, 0xfe, 0x2c, 0x75, 0x4b, 0x3f, 0xfe, 0xe1, 0x5a, 0x38, 0xb7, 0x91, 0xa1,
+	0x55, 0xd3, 0xec, 0xaa, 0xca, 0x47, 0x33, 0xe8, 0x36, 0xb4, 0x86, 0x64, 0x38, 0x0e, 0xa2, 0xd1,
+	0xbd, 0x44, 0x5a, 0x72, 0xbb, 0xa6, 0x7c, 0xaf, 0xf7, 0x0a, 0x3d, 0xff, 0xe4, 0x25, 0x0d, 0xaf,
+	0x22, 0x9d, 0xe3, 0x13, 0x76, 0x68, 0x17, 0x6a, 0x1a, 0x48, 0x6e, 0xd7, 0x3b, 0xe5, 0x8d, 0xe6,
+	0xf6, 0x5b, 0x45, 0x17, 0xe7, 0x80, 0x9e, 0x23, 0x99, 0x9b, 0x1a, 0x80, 0x04, 0xb7, 0x1b, 0x3a,
+	0x4b, 0xc5, 0x74, 0x1f, 0x80, 0x5d, 0x74, 0xc0, 0x93, 0x38, 0xe2, 0xf4, 0x7f, 0xb7, 0xed, 0xdb,
+	0x32, 0xa0, 0xd3, 0x6e, 0x51, 0x17, 0xaa, 0x7d, 0x41, 0xc4, 0x94, 0x1b, 0x97, 0x90, 0xa5, 0x6e,
+	0x95, 0x2b, 0x09, 0x36, 0x2f, 0xe8, 0x16, 0x54, 0x76, 0x89, 0x20, 0xf6, 0xca, 0x69, 0xb0, 0x96,
+	0x1e, 0xa5, 0x86, 0x77, 0x4d, 0x82, 0x95, 0xa5, 0x6e, 0xcb, 0x27, 0x82, 0xbc, 0x1f, 0x87, 0x81,
+	0xa0, 0x61, 0x22, 0x66, 0x58, 0xd9, 0xa3, 0x0f, 0xa1, 0xb1, 0xc7, 0x58, 0xcc, 0x1e, 0xcc, 0x12,
+	0xaa, 0xfa, 0xdf, 0xf0, 0xae, 0x67, 0xa9, 0x7b, 0x85, 0xe6, 0xc2, 0x82, 0xc5, 0x52, 0x13, 0xbd,
+	0x0b, 0xab, 0x8a, 0x51, 0xf3, 0xd1, 0xf0, 0xae, 0x64, 0xa9, 0x7b, 0x59, 0x99, 0x14, 0xd4, 0xb5,
+	0x06, 0xda, 0x5b, 0xb6, 0x65, 0x55, 0xb5, 0xe5, 0xed, 0xf3, 0xda, 0x52, 0x44, 0xf5, 0x54, 0x5f,
+	0xb6, 0xa1, 0xfe, 0x25, 0x61, 0x51, 0x10, 0x8d, 0xb8, 0x5d, 0x55, 0x60, 0x5e, 0xcb, 0x52, 0x17,
+	0x7d, 0x63, 0x64, 0x85, 0xb8, 0x0b, 0x3d, 0x99, 0xe5, 0x9d, 0xe8, 0x20, 0x96, 0x23, 0x55, 0xce,
+	0xb3, 0x0c, 0xa4, 0xa0, 0x98, 0xa5, 0xd2, 0xe8, 0xfe, 0x66, 0x41, 0xeb, 0x65, 0xe0, 0x50, 0x0f,
+	0x00, 0x53, 0x3e, 0x9d, 0x08, 0x85, 0x8d, 0x6e, 0x45, 0x2b, 0x4b, 0x5d, 0x60, 0x0b, 0x29, 0x2e,
+	0x68, 0xa0, 0x9b, 0x50, 0xd5, 0x9c, 0x6a, 0x76, 0x73, 0xdb, 0x2e, 0xd6, 0xd9, 0x27, 0x61, 0x32,
+	0xa1, 0x7d, 0xc1, 0x28, 0x09, 0xbd, 0x96, 0x69, 0x49, 0x55, 0x7b, 0xc2, 0xc6, 0x0e, 0xdd, 0xcd,
+	0x67, 0xaf, 0xdc, 0xb1, 0x2e, 0x9a, 0x5f, 0x0d, 0x94, 0x9c, 0x04, 0xae, 0x8b, 0x52, 0x56, 0xc5,
+	0xa2, 0xf4, 0xd4, 0x4e, 0xe0, 0xfa, 0x39, 0x66, 0xe8, 0x3e, 0xd4, 0xb8, 0x4a, 0x49, 0x0f, 0x59,
+	0x73, 0xfb, 0xbd, 0x7f, 0x08, 0xa6, 0x95, 0x75, 0xcc, 0x66, 0x96, 0xba, 0xb9, 0x39, 0xce, 0x89,
+	0xee, 0x0f, 0x2b, 0xe0, 0x5c, 0x6c, 0x88, 0xee, 0xc1, 0x6b, 0x22, 0x16, 0x64, 0x72, 0x5f, 0x86,
+	0x22, 0x83, 0x09, 0xed, 0x17, 0x72, 0x28, 0x7b, 0xed, 0x2c, 0x75, 0xcf, 0x56, 0xc0, 0x67, 0x8b,
+	0xd1, 0x4f, 0x16, 0xbc, 0x7e, 0xe6, 0xcb, 0x3e, 0x65, 0x7d, 0xb9, 0xbf, 0x74, 0x2b, 0x6e, 0x5c,
+	0x5c, 0xdc, 0x49, 0x63, 0x95, 0xac, 0xf1, 0xe0, 0x75, 0xb2, 0xd4, 0xbd, 0x30, 0x06, 0xbe, 0xf0,
+	0xb5, 0x1b, 0xc0, 0xbf, 0x8c, 0x28, 0x57, 0xd0, 0x63, 0xb9, 0x20, 0x34, 0x2a, 0x58, 0x33, 0xe8,
+	0x4d, 0xb8, 0x24, 0x37, 0x29, 0x17, 0x24, 0x4c, 0x1e, 0x86, 0xdc, 0x2c, 0xf0, 0xe6, 0x42, 0xf6,
+	0x39, 0xef, 0xfe, 0x6a, 0xc1, 0xa5, 0xe2, 0xa0, 0xa1, 0xa7, 0x16, 0x54, 0x27, 0x64, 0x40, 0x27,
+	0x12, 0x61, 0x09, 0xc4, 0x95, 0x5e, 0x7e, 0xb0, 0x7a, 0x9f, 0x49, 0xf9, 0x3e, 0x09, 0x98, 0xd7,
+	0x97, 0xe3, 0xf8, 0x7b, 0xea, 0xfe, 0xa7, 0xc3, 0xa7, 0xfd, 0xec, 0xf8, 0x24, 0x11, 0x94, 0xc9,
+	0x99, 0x0e, 0xa9, 0x60, 0xc1, 0x10, 0x9b, 0xb8, 0xe8, 0xc6, 0x72, 0xd0, 0x74, 0x2f, 0xd6, 0x96,
+	0x29, 0xe8, 0x5c, 0x97, 0x9f, 0x83, 0x2a, 0xb4, 0x30, 0x51, 0xdf, 0x5b, 0xd0, 0x92, 0xab, 0x9f,
+	0xfa, 0x8b, 0xdd, 0xd8, 0x86, 0xf2, 0xd7, 0x74, 0x66, 0xbe, 0xc6, 0x5a, 0x96, 0xba, 0x92, 0xc5,
+	0xf2, 0x8f, 0x3c, 0x4f, 0xf4, 0x89, 0xa0, 0x91, 0xc8, 0x23, 0xa1, 0x62, 0xd7, 0xf7, 0xd4, 0x93,
+	0x77, 0xd9, 0xc4, 0xca, 0x55, 0x71, 0x4e, 0xa0, 0x77, 0xa0, 0xf6, 0x98, 0x32, 0x1e, 0xc4, 0x91,
+	0xfa, 0xfc, 0x5e, 0xd1, 0x53, 0x6e, 0x44, 0x38, 0x27, 0xba, 0xbf, 0x58, 0x50, 0xd5, 0xbe, 0x90,
+	0x9b, 0xdf, 0x52, 0x3d, 0xbd, 0x8d, 0x2c, 0x75, 0xb5, 0x20, 0x3f, 0xab, 0x6d, 0x7d, 0x56, 0x55,
+	0xa7, 0x74, 0xb2, 0x34, 0xf2, 0xf5, 0x7d, 0xed, 0x40, 0x5d, 0x30, 0x32, 0xa4, 0x0f, 0x03, 0xdf,
+	0xec, 0xd0, 0x7c, 0xe1, 0x29, 0xf1, 0x1d, 0x1f, 0x7d, 0x0c, 0x75, 0x66, 0xaa, 0x36, 0xe7, 0xf6,
+	0xea, 0xa9, 0x73, 0xbb, 0x13, 0xcd, 0xbc, 0x4b, 0x59, 0xea, 0x2e, 0x34, 0xf1, 0x82, 0xfa, 0xb4,
+	0x52, 0x2f, 0xaf, 0x55, 0xba, 0xb7, 0x34, 0x82, 0x85, 0x33, 0xb9, 0x0e, 0x75, 0x3f, 0xe0, 0x72,
+	0xf6, 0x7c, 0x95, 0x78, 0x1d, 0x2f, 0x78, 0x64, 0x43, 0x8d, 0xd1, 0x03, 0x46, 0xf9, 0x58, 0x25,
+	0x5d, 0xc7, 0x39, 0xeb, 0xdd, 0x3c, 0x3c, 0x72, 0x4a, 0xcf, 0x8f, 0x9c, 0xd2, 0x8b, 0x23, 0xc7,
+	0x7a, 0x3a, 0x77, 0xac, 0x9f, 0xe7, 0x8e, 0xf5, 0x6c, 0xee, 0x58, 0x87, 0x73, 0xc7, 0xfa, 0x73,
+	0xee, 0x58, 0x7f, 0xcd, 0x9d, 0xd2, 0x8b, 0xb9, 0x63, 0x7d, 0x77, 0xec, 0x94, 0x0e, 0x8f, 0x9d,
+	0xd2, 0xf3, 0x63, 0xa7, 0xf4, 0x55, 0xe1, 0x57, 0xda, 0xa0, 0xaa, 0xb2, 0xfe, 0xe0, 0xef, 0x01,
+	0x00, 0xe4, 0xe8, 0x93, 0x23, 0xcc, 0x09, 0x00, 0x00,
 }
 
 func (this *PrometheusRequestHeader) Equal(that interface{}) bool {
@@ -968,6 +1008,22 @@ func (this *PrometheusResponse) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if len(this.Warnings) != len(that1.Warnings) {
+		return false
+	}
+	for i := range this.Warnings {
+		if this.Warnings[i] != that1.Warnings[i] {
+			return false
+		}
+	}
+	if len(this.Infos) != len(that1.Infos) {
+		return false
+	}
+	for i := range this.Infos {
+		if this.Infos[i] != that1.Infos[i] {
+			return false
+		}
+	}
 	return true
 }
 func (this *PrometheusData) Equal(that interface{}) bool {
@@ -1155,6 +1211,9 @@ func (this *CachedResponse) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if this.Version != that1.Version {
+		return false
+	}
 	return true
 }
 func (this *Extent) Equal(that interface{}) bool {
@@ -1212,6 +1271,9 @@ func (this *CachingOptions) Equal(that interface{}) bool {
 	if this.Disabled != that1.Disabled {
 		return false
 	}
+	if this.Refresh != that1.Refresh {
+		return false
+	}
 	return true
 }
 func (this *PrometheusRequestHeader) GoString() string {
@@ -1260,7 +1322,7 @@ func (this *PrometheusResponse) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 9)
+	s := make([]string, 0, 11)
 	s = append(s, "&queryrange.PrometheusResponse{")
 	s = append(s, "Status: "+fmt.Sprintf("%#v", this.Status)+",\n")
 	s = append(s, "Data: "+strings.Replace(this.Data.GoString(), `&`, ``, 1)+",\n")
@@ -1269,6 +1331,8 @@ func (this *PrometheusResponse) GoString() string {
 	if this.Headers != nil {
 		s = append(s, "Headers: "+fmt.Sprintf("%#v", this.Headers)+",\n")
 	}
+	s = append(s, "Warnings: "+fmt.Sprintf("%#v", this.Warnings)+",\n")
+	s = append(s, "Infos: "+fmt.Sprintf("%#v", this.Infos)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1280,9 +1344,9 @@ func (this *PrometheusData) GoString() string {
 	s = append(s, "&queryrange.PrometheusData{")
 	s = append(s, "ResultType: "+fmt.Sprintf("%#v", this.ResultType)+",\n")
 	if this.Result != nil {
-		vs := make([]*SampleStream, len(this.Result))
+		vs := make([]SampleStream, len(this.Result))
 		for i := range vs {
-			vs[i] = &this.Result[i]
+			vs[i] = this.Result[i]
 		}
 		s = append(s, "Result: "+fmt.Sprintf("%#v", vs)+",\n")
 	}
@@ -1336,9 +1400,9 @@ func (this *SampleStream) GoString() string {
 	s = append(s, "&queryrange.SampleStream{")
 	s = append(s, "Labels: "+fmt.Sprintf("%#v", this.Labels)+",\n")
 	if this.Samples != nil {
-		vs := make([]*cortexpb.Sample, len(this.Samples))
+		vs := make([]cortexpb.Sample, len(this.Samples))
 		for i := range vs {
-			vs[i] = &this.Samples[i]
+			vs[i] = this.Samples[i]
 		}
 		s = append(s, "Samples: "+fmt.Sprintf("%#v", vs)+",\n")
 	}
@@ -1349,16 +1413,17 @@ func (this *CachedResponse) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 6)
+	s := make([]string, 0, 7)
 	s = append(s, "&queryrange.CachedResponse{")
 	s = append(s, "Key: "+fmt.Sprintf("%#v", this.Key)+",\n")
 	if this.Extents != nil {
-		vs := make([]*Extent, len(this.Extents))
+		vs := make([]Extent, len(this.Extents))
 		for i := range vs {
-			vs[i] = &this.Extents[i]
+			vs[i] = this.Extents[i]
 		}
 		s = append(s, "Extents: "+fmt.Sprintf("%#v", vs)+",\n")
 	}
+	s = append(s, "Version: "+fmt.Sprintf("%#v", this.Version)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1381,9 +1446,10 @@ func (this *CachingOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 5)
+	s := make([]string, 0, 6)
 	s = append(s, "&queryrange.CachingOptions{")
 	s = append(s, "Disabled: "+fmt.Sprintf("%#v", this.Disabled)+",\n")
+	s = append(s, "Refresh: "+fmt.Sprintf("%#v", this.Refresh)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1584,6 +1650,24 @@ func (m *PrometheusResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Infos) > 0 {
+		for iNdEx := len(m.Infos) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Infos[iNdEx])
+			copy(dAtA[i:], m.Infos[iNdEx])
+			i = encodeVarintQueryrange(dAtA, i, uint64(len(m.Infos[iNdEx])))
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintQueryrange(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
 	if len(m.Headers) > 0 {
 		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1869,6 +1953,11 @@ func (m *CachedResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Version != 0 {
+		i = encodeVarintQueryrange(dAtA, i, uint64(m.Version))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Extents) > 0 {
 		for iNdEx := len(m.Extents) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1965,6 +2054,16 @@ func (m *CachingOptions) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Refresh {
+		i--
+		if m.Refresh {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
 	if m.Disabled {
 		i--
 		if m.Disabled {
@@ -2093,6 +2192,18 @@ func (m *PrometheusResponse) Size() (n int) {
 			n += 1 + l + sovQueryrange(uint64(l))
 		}
 	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovQueryrange(uint64(l))
+		}
+	}
+	if len(m.Infos) > 0 {
+		for _, s := range m.Infos {
+			l = len(s)
+			n += 1 + l + sovQueryrange(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -2202,6 +2313,9 @@ func (m *CachedResponse) Size() (n int) {
 			n += 1 + l + sovQueryrange(uint64(l))
 		}
 	}
+	if m.Version != 0 {
+		n += 1 + sovQueryrange(uint64(m.Version))
+	}
 	return n
 }
 
@@ -2237,6 +2351,9 @@ func (m *CachingOptions) Size() (n int) {
 	if m.Disabled {
 		n += 2
 	}
+	if m.Refresh {
+		n += 2
+	}
 	return n
 }
 
@@ -2271,7 +2388,7 @@ func (this *PrometheusRequest) String() string {
 		`Start:` + fmt.Sprintf("%v", this.Start) + `,`,
 		`End:` + fmt.Sprintf("%v", this.End) + `,`,
 		`Step:` + fmt.Sprintf("%v", this.Step) + `,`,
-		`Timeout:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.Timeout), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`Timeout:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.Timeout), "Duration", "durationpb.Duration", 1), `&`, ``, 1) + `,`,
 		`Query:` + fmt.Sprintf("%v", this.Query) + `,`,
 		`CachingOptions:` + strings.Replace(strings.Replace(this.CachingOptions.String(), "CachingOptions", "CachingOptions", 1), `&`, ``, 1) + `,`,
 		`Headers:` + repeatedStringForHeaders + `,`,
@@ -2306,6 +2423,8 @@ func (this *PrometheusResponse) String() string {
 		`ErrorType:` + fmt.Sprintf("%v", this.ErrorType) + `,`,
 		`Error:` + fmt.Sprintf("%v", this.Error) + `,`,
 		`Headers:` + repeatedStringForHeaders + `,`,
+		`Warnings:` + fmt.Sprintf("%v", this.Warnings) + `,`,
+		`Infos:` + fmt.Sprintf("%v", this.Infos) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -2392,6 +2511,7 @@ func (this *CachedResponse) String() string {
 	s := strings.Join([]string{`&CachedResponse{`,
 		`Key:` + fmt.Sprintf("%v", this.Key) + `,`,
 		`Extents:` + repeatedStringForExtents + `,`,
+		`Version:` + fmt.Sprintf("%v", this.Version) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -2415,6 +2535,7 @@ func (this *CachingOptions) String() string {
 	}
 	s := strings.Join([]string{`&CachingOptions{`,
 		`Disabled:` + fmt.Sprintf("%v", this.Disabled) + `,`,
+		`Refresh:` + fmt.Sprintf("%v", this.Refresh) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -2526,10 +2647,7 @@ func (m *PrometheusRequestHeader) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -2832,10 +2950,7 @@ func (m *PrometheusRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -2949,10 +3064,7 @@ func (m *PrometheusResponseHeader) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3159,16 +3271,77 @@ func (m *PrometheusResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Infos", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Infos = append(m.Infos, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQueryrange(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3320,10 +3493,7 @@ func (m *PrometheusData) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3409,10 +3579,7 @@ func (m *PrometheusResponseStats) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3515,10 +3682,7 @@ func (m *PrometheusResponseSamplesStats) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3606,10 +3770,7 @@ func (m *PrometheusResponseQueryableSamplesStatsPerStep) Unmarshal(dAtA []byte)
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3727,10 +3888,7 @@ func (m *SampleStream) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -3840,16 +3998,32 @@ func (m *CachedResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQueryrange(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -4005,10 +4179,7 @@ func (m *Extent) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -4072,16 +4243,33 @@ func (m *CachingOptions) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.Disabled = bool(v != 0)
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Refresh", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Refresh = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQueryrange(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthQueryrange
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthQueryrange
 			}
 			if (iNdEx + skippy) > l {
@@ -4099,6 +4287,7 @@ func (m *CachingOptions) Unmarshal(dAtA []byte) error {
 func skipQueryrange(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
+	depth := 0
 	for iNdEx < l {
 		var wire uint64
 		for shift := uint(0); ; shift += 7 {
@@ -4130,10 +4319,8 @@ func skipQueryrange(dAtA []byte) (n int, err error) {
 					break
 				}
 			}
-			return iNdEx, nil
 		case 1:
 			iNdEx += 8
-			return iNdEx, nil
 		case 2:
 			var length int
 			for shift := uint(0); ; shift += 7 {
@@ -4154,55 +4341,30 @@ func skipQueryrange(dAtA []byte) (n int, err error) {
 				return 0, ErrInvalidLengthQueryrange
 			}
 			iNdEx += length
-			if iNdEx < 0 {
-				return 0, ErrInvalidLengthQueryrange
-			}
-			return iNdEx, nil
 		case 3:
-			for {
-				var innerWire uint64
-				var start int = iNdEx
-				for shift := uint(0); ; shift += 7 {
-					if shift >= 64 {
-						return 0, ErrIntOverflowQueryrange
-					}
-					if iNdEx >= l {
-						return 0, io.ErrUnexpectedEOF
-					}
-					b := dAtA[iNdEx]
-					iNdEx++
-					innerWire |= (uint64(b) & 0x7F) << shift
-					if b < 0x80 {
-						break
-					}
-				}
-				innerWireType := int(innerWire & 0x7)
-				if innerWireType == 4 {
-					break
-				}
-				next, err := skipQueryrange(dAtA[start:])
-				if err != nil {
-					return 0, err
-				}
-				iNdEx = start + next
-				if iNdEx < 0 {
-					return 0, ErrInvalidLengthQueryrange
-				}
-			}
-			return iNdEx, nil
+			depth++
 		case 4:
-			return iNdEx, nil
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupQueryrange
+			}
+			depth--
 		case 5:
 			iNdEx += 4
-			return iNdEx, nil
 		default:
 			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
 		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthQueryrange
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
 	}
-	panic("unreachable")
+	return 0, io.ErrUnexpectedEOF
 }
 
 var (
-	ErrInvalidLengthQueryrange = fmt.Errorf("proto: negative length found during unmarshaling")
-	ErrIntOverflowQueryrange   = fmt.Errorf("proto: integer overflow")
+	ErrInvalidLengthQueryrange        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowQueryrange          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupQueryrange = fmt.Errorf("proto: unexpected end of group")
 )
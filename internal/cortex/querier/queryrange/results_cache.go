@@ -40,11 +40,16 @@ import (
 var (
 	// Value that cacheControlHeader has if the response indicates that the results should not be cached.
 	noStoreValue = "no-store"
+	// Value that cacheControlHeader has if the request indicates that the cached results should be recomputed.
+	noCacheValue = "no-cache"
 
 	// ResultsCacheGenNumberHeaderName holds name of the header we want to set in http response
 	ResultsCacheGenNumberHeaderName = "Results-Cache-Gen-Number"
 )
 
+// cachedResponseVersion is the version of the format of cached responses. Version 1 added annotations of responses.
+const cachedResponseVersion = 1
+
 type CacheGenNumberLoader interface {
 	GetResultsCacheGenNumber(tenantIDs []string) string
 }
@@ -103,6 +108,9 @@ func (PrometheusResponseExtractor) Extract(start, end int64, from Response) Resp
 			Stats:      extractStats(start, end, promRes.Data.Stats),
 		},
 		Headers: promRes.Headers,
+		// Annotations cannot be attributed to a part of the range, so they are kept for every part of it.
+		Warnings: promRes.Warnings,
+		Infos:    promRes.Infos,
 	}
 }
 
@@ -117,6 +125,8 @@ func (PrometheusResponseExtractor) ResponseWithoutHeaders(resp Response) Respons
 			Result:     promRes.Data.Result,
 			Stats:      promRes.Data.Stats,
 		},
+		Warnings: promRes.Warnings,
+		Infos:    promRes.Infos,
 	}
 }
 
@@ -129,7 +139,9 @@ func (PrometheusResponseExtractor) ResponseWithoutStats(resp Response) Response
 			ResultType: promRes.Data.ResultType,
 			Result:     promRes.Data.Result,
 		},
-		Headers: promRes.Headers,
+		Headers:  promRes.Headers,
+		Warnings: promRes.Warnings,
+		Infos:    promRes.Infos,
 	}
 }
 
@@ -233,6 +245,10 @@ func (s resultsCache) Do(ctx context.Context, r Request) (Response, error) {
 		return s.next.Do(ctx, r)
 	}
 
+	if validation.AnyTruePerTenant(tenantIDs, s.limits.ResultsCacheDisabled) {
+		return s.next.Do(ctx, r)
+	}
+
 	if s.cacheGenNumberLoader != nil {
 		ctx = cache.InjectCacheGenNumber(ctx, s.cacheGenNumberLoader.GetResultsCacheGenNumber(tenantIDs))
 	}
@@ -249,7 +265,14 @@ func (s resultsCache) Do(ctx context.Context, r Request) (Response, error) {
 		return s.next.Do(ctx, r)
 	}
 
-	cached, ok := s.get(ctx, key)
+	// A refresh recomputes the results and overwrites the cached ones.
+	var (
+		cached []Extent
+		ok     bool
+	)
+	if !r.GetCachingOptions().Refresh {
+		cached, ok = s.get(ctx, key)
+	}
 	if ok {
 		response, extents, err = s.handleHit(ctx, r, cached, maxCacheTime)
 	} else {
@@ -619,6 +642,11 @@ func (s resultsCache) get(ctx context.Context, key string) ([]Extent, bool) {
 		return nil, false
 	}
 
+	// Responses cached in a newer format might not be decoded correctly. Older ones are decoded without annotations.
+	if resp.Version > cachedResponseVersion {
+		return nil, false
+	}
+
 	// Refreshes the cache if it contains an old proto schema.
 	for _, e := range resp.Extents {
 		if e.Response == nil {
@@ -633,6 +661,7 @@ func (s resultsCache) put(ctx context.Context, key string, extents []Extent) {
 	buf, err := proto.Marshal(&CachedResponse{
 		Key:     key,
 		Extents: extents,
+		Version: cachedResponseVersion,
 	})
 	if err != nil {
 		level.Error(s.logger).Log("msg", "error marshalling cached value", "err", err)
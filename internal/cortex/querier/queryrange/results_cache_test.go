@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
@@ -1026,6 +1027,100 @@ func TestResultsCache(t *testing.T) {
 	require.Equal(t, 2, calls)
 }
 
+func TestResultsCacheAnnotations(t *testing.T) {
+	cfg := ResultsCacheConfig{
+		CacheConfig: cache.Config{
+			Cache: cache.NewMockCache(),
+		},
+	}
+	rcm, _, err := NewResultsCacheMiddleware(
+		log.NewNopLogger(),
+		cfg,
+		constSplitter(day),
+		mockLimits{},
+		PrometheusCodec,
+		PrometheusResponseExtractor{},
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	calls := 0
+	rc := rcm.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+		calls++
+		resp := mkAPIResponse(req.GetStart(), req.GetEnd(), req.GetStep())
+		resp.Warnings = []string{"warning", fmt.Sprintf("warning %d", calls)}
+		resp.Infos = []string{"info"}
+		return resp, nil
+	}))
+	ctx := user.InjectOrgID(context.Background(), "1")
+	req := &PrometheusRequest{Start: 0, End: 100 * 1e3, Step: 10 * 1e3}
+
+	resp, err := rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, []string{"warning", "warning 1"}, resp.(*PrometheusResponse).Warnings)
+	require.Equal(t, []string{"info"}, resp.(*PrometheusResponse).Infos)
+
+	// Cache hits return the annotations of the cached response.
+	resp, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, []string{"warning", "warning 1"}, resp.(*PrometheusResponse).Warnings)
+	require.Equal(t, []string{"info"}, resp.(*PrometheusResponse).Infos)
+
+	// Partial hits merge the annotations of cached and new responses.
+	resp, err = rc.Do(ctx, req.WithStartEnd(req.GetStart(), req.GetEnd()+100*1e3))
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, []string{"warning", "warning 1", "warning 2"}, resp.(*PrometheusResponse).Warnings)
+	require.Equal(t, []string{"info"}, resp.(*PrometheusResponse).Infos)
+}
+
+func TestResultsCacheVersion(t *testing.T) {
+	cfg := ResultsCacheConfig{
+		CacheConfig: cache.Config{
+			Cache: cache.NewMockCache(),
+		},
+	}
+	rm, _, err := NewResultsCacheMiddleware(
+		log.NewNopLogger(),
+		cfg,
+		constSplitter(day),
+		mockLimits{},
+		PrometheusCodec,
+		PrometheusResponseExtractor{},
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+	rc := rm.Wrap(nil).(*resultsCache)
+	ctx := context.Background()
+
+	store := func(key string, version uint32) {
+		buf, err := proto.Marshal(&CachedResponse{Key: key, Extents: []Extent{mkExtent(100, 120)}, Version: version})
+		require.NoError(t, err)
+		rc.cache.Store(ctx, []string{cache.HashKey(key)}, [][]byte{buf})
+	}
+
+	// Responses cached before annotations were added are still used.
+	store("v0", 0)
+	extents, hit := rc.get(ctx, "v0")
+	require.True(t, hit)
+	require.Equal(t, 1, len(extents))
+
+	store("current", cachedResponseVersion)
+	extents, hit = rc.get(ctx, "current")
+	require.True(t, hit)
+	require.Equal(t, 1, len(extents))
+
+	store("newer", cachedResponseVersion+1)
+	_, hit = rc.get(ctx, "newer")
+	require.False(t, hit)
+}
+
 func TestResultsCacheRecent(t *testing.T) {
 	var cfg ResultsCacheConfig
 	flagext.DefaultValues(&cfg)
@@ -1264,6 +1359,74 @@ func TestResultsCacheShouldCacheFunc(t *testing.T) {
 	}
 }
 
+func TestResultsCacheRefreshAndDisabledTenant(t *testing.T) {
+	refreshRequest := &PrometheusRequest{
+		Path:           "/api/v1/query_range",
+		Start:          1536673680 * 1e3,
+		End:            1536716898 * 1e3,
+		Step:           120 * 1e3,
+		Query:          "sum(container_memory_rss) by (namespace)",
+		CachingOptions: CachingOptions{Refresh: true},
+	}
+
+	testcases := []struct {
+		name          string
+		cacheDisabled bool
+		requests      []Request
+		expectedCall  int
+	}{
+		{
+			name:         "refresh skips cached results",
+			requests:     []Request{parsedRequest, refreshRequest, refreshRequest},
+			expectedCall: 3,
+		},
+		{
+			name:         "refresh caches results",
+			requests:     []Request{refreshRequest, parsedRequest, parsedRequest},
+			expectedCall: 1,
+		},
+		{
+			name:          "cache disabled for tenant",
+			cacheDisabled: true,
+			requests:      []Request{parsedRequest, parsedRequest},
+			expectedCall:  2,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			var cfg ResultsCacheConfig
+			flagext.DefaultValues(&cfg)
+			cfg.CacheConfig.Cache = cache.NewMockCache()
+			rcm, _, err := NewResultsCacheMiddleware(
+				log.NewNopLogger(),
+				cfg,
+				constSplitter(day),
+				mockLimits{maxCacheFreshness: 10 * time.Minute, cacheDisabled: tc.cacheDisabled},
+				PrometheusCodec,
+				PrometheusResponseExtractor{},
+				nil,
+				nil,
+				nil,
+			)
+			require.NoError(t, err)
+			rc := rcm.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				calls++
+				return parsedResponse, nil
+			}))
+
+			for _, req := range tc.requests {
+				ctx := user.InjectOrgID(context.Background(), "1")
+				_, err := rc.Do(ctx, req)
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, tc.expectedCall, calls)
+		})
+	}
+}
+
 func toMs(t time.Duration) int64 {
 	return int64(t / time.Millisecond)
 }
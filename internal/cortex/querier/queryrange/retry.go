@@ -32,26 +32,44 @@ func NewRetryMiddlewareMetrics(registerer prometheus.Registerer) *RetryMiddlewar
 }
 
 type retry struct {
-	log        log.Logger
-	next       Handler
-	maxRetries int
+	log         log.Logger
+	next        Handler
+	maxRetries  int
+	shouldRetry RetryPolicy
 
 	metrics *RetryMiddlewareMetrics
 }
 
+// RetryPolicy tells whether a request which failed with the given error, other than a canceled context, should be
+// retried.
+type RetryPolicy func(err error) bool
+
+// DefaultRetryPolicy retries requests failing with 5xx or a non-HTTP error.
+func DefaultRetryPolicy(err error) bool {
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	return !ok || httpResp.Code/100 == 5
+}
+
 // NewRetryMiddleware returns a middleware that retries requests if they
 // fail with 500 or a non-HTTP error.
 func NewRetryMiddleware(log log.Logger, maxRetries int, metrics *RetryMiddlewareMetrics) Middleware {
+	return NewRetryMiddlewareWithPolicy(log, maxRetries, metrics, DefaultRetryPolicy)
+}
+
+// NewRetryMiddlewareWithPolicy returns a middleware that retries requests if they fail with an error for which the
+// policy returns true.
+func NewRetryMiddlewareWithPolicy(log log.Logger, maxRetries int, metrics *RetryMiddlewareMetrics, shouldRetry RetryPolicy) Middleware {
 	if metrics == nil {
 		metrics = NewRetryMiddlewareMetrics(nil)
 	}
 
 	return MiddlewareFunc(func(next Handler) Handler {
 		return retry{
-			log:        log,
-			next:       next,
-			maxRetries: maxRetries,
-			metrics:    metrics,
+			log:         log,
+			next:        next,
+			maxRetries:  maxRetries,
+			shouldRetry: shouldRetry,
+			metrics:     metrics,
 		}
 	})
 }
@@ -74,9 +92,7 @@ func (r retry) Do(ctx context.Context, req Request) (Response, error) {
 			return nil, err
 		}
 
-		// Retry if we get a HTTP 500 or a non-HTTP error.
-		httpResp, ok := httpgrpc.HTTPResponseFromError(err)
-		if !ok || httpResp.Code/100 == 5 {
+		if r.shouldRetry(err) {
 			lastErr = err
 			level.Error(util_log.WithContext(ctx, r.log)).Log("msg", "error processing request", "try", tries, "err", err)
 			continue
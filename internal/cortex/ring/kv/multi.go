@@ -5,8 +5,11 @@ package kv
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -81,10 +84,16 @@ type MultiClient struct {
 	inProgress    map[int]clientInProgress
 	inProgressCnt int
 
+	outOfSyncMu sync.Mutex
+	// Keys whose latest mirror-write to a secondary store failed.
+	outOfSync map[string]struct{}
+
 	primaryStoreGauge     *prometheus.GaugeVec
 	mirrorEnabledGauge    prometheus.Gauge
 	mirrorWritesCounter   prometheus.Counter
 	mirrorFailuresCounter prometheus.Counter
+	mirrorLag             prometheus.Histogram
+	outOfSyncGauge        prometheus.Gauge
 }
 
 // NewMultiClient creates new MultiClient with given KV Clients.
@@ -94,6 +103,7 @@ func NewMultiClient(cfg MultiConfig, clients []kvclient, logger log.Logger, regi
 		clients:    clients,
 		primaryID:  atomic.NewInt32(0),
 		inProgress: map[int]clientInProgress{},
+		outOfSync:  map[string]struct{}{},
 
 		mirrorTimeout:    cfg.MirrorTimeout,
 		mirroringEnabled: atomic.NewBool(cfg.MirrorEnabled),
@@ -123,20 +133,11 @@ func (m *MultiClient) watchConfigChannel(ctx context.Context, configChannel <-ch
 			}
 
 			if cfg.Mirroring != nil {
-				enabled := *cfg.Mirroring
-				old := m.mirroringEnabled.Swap(enabled)
-				if old != enabled {
-					level.Info(m.logger).Log("msg", "toggled mirroring", "enabled", enabled)
-				}
-				m.updateMirrorEnabledGauge()
+				m.SetMirroring(*cfg.Mirroring)
 			}
 
 			if cfg.PrimaryStore != "" {
-				switched, err := m.setNewPrimaryClient(cfg.PrimaryStore)
-				if switched {
-					level.Info(m.logger).Log("msg", "switched primary KV store", "primary", cfg.PrimaryStore)
-				}
-				if err != nil {
+				if _, err := m.SwitchPrimary(cfg.PrimaryStore); err != nil {
 					level.Error(m.logger).Log("msg", "failed to switch primary KV store", "primary", cfg.PrimaryStore, "err", err)
 				}
 			}
@@ -147,6 +148,79 @@ func (m *MultiClient) watchConfigChannel(ctx context.Context, configChannel <-ch
 	}
 }
 
+// SwitchPrimary makes the KV store with the given name the primary one, and returns true if it was not already.
+// Watches of the previous primary store are restarted on the new one.
+func (m *MultiClient) SwitchPrimary(store string) (bool, error) {
+	switched, err := m.setNewPrimaryClient(store)
+	if switched {
+		level.Info(m.logger).Log("msg", "switched primary KV store", "primary", store)
+	}
+	return switched, err
+}
+
+// SetMirroring enables or disables mirroring of writes to the secondary stores.
+func (m *MultiClient) SetMirroring(enabled bool) {
+	old := m.mirroringEnabled.Swap(enabled)
+	if old != enabled {
+		level.Info(m.logger).Log("msg", "toggled mirroring", "enabled", enabled)
+	}
+	m.updateMirrorEnabledGauge()
+}
+
+// MultiClientStatus is the state of a MultiClient.
+type MultiClientStatus struct {
+	Primary       string   `json:"primary"`
+	Stores        []string `json:"stores"`
+	MirrorEnabled bool     `json:"mirror_enabled"`
+	// OutOfSyncKeys is the number of keys whose latest mirror-write to a secondary store failed. Switching the primary
+	// store is only safe once there are none.
+	OutOfSyncKeys int `json:"out_of_sync_keys"`
+}
+
+// Status returns the current state of the client.
+func (m *MultiClient) Status() MultiClientStatus {
+	_, primary := m.getPrimaryClient()
+	st := MultiClientStatus{Primary: primary.name, MirrorEnabled: m.mirroringEnabled.Load()}
+	for _, c := range m.clients {
+		st.Stores = append(st.Stores, c.name)
+	}
+	m.outOfSyncMu.Lock()
+	st.OutOfSyncKeys = len(m.outOfSync)
+	m.outOfSyncMu.Unlock()
+	return st
+}
+
+// ServeHTTP serves the status of the client as JSON. POST requests switch the primary store and toggle mirroring
+// first, as given by the optional "primary" and "mirror_enabled" form values, so that stores can be migrated at
+// runtime.
+func (m *MultiClient) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if v := req.Form.Get("mirror_enabled"); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid mirror_enabled value: %v", err), http.StatusBadRequest)
+				return
+			}
+			m.SetMirroring(enabled)
+		}
+		if v := req.Form.Get("primary"); v != "" {
+			if _, err := m.SwitchPrimary(v); err != nil {
+				http.Error(w, fmt.Sprintf("switch primary KV store to %s: %v", v, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Status()); err != nil {
+		level.Error(m.logger).Log("msg", "error writing multi KV client status", "err", err)
+	}
+}
+
 func (m *MultiClient) getPrimaryClient() (int, kvclient) {
 	v := m.primaryID.Load()
 	return int(v), m.clients[v]
@@ -205,6 +279,17 @@ func (m *MultiClient) registerMetrics(registerer prometheus.Registerer) {
 		Name: "multikv_mirror_write_errors_total",
 		Help: "Number of failures to mirror-write to secondary store",
 	})
+
+	m.mirrorLag = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		Name:    "multikv_mirror_lag_seconds",
+		Help:    "Time between the update of a value in the primary store and its successful mirror-write to secondary store",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	m.outOfSyncGauge = promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+		Name: "multikv_mirror_out_of_sync_keys",
+		Help: "Number of keys whose latest mirror-write to secondary store failed",
+	})
 }
 
 func (m *MultiClient) updatePrimaryStoreGauge() {
@@ -339,6 +424,10 @@ func (m *MultiClient) WatchPrefix(ctx context.Context, prefix string, f func(str
 }
 
 func (m *MultiClient) writeToSecondary(ctx context.Context, primary kvclient, key string, newValue interface{}) {
+	updated := time.Now()
+	failed := false
+	defer func() { m.setOutOfSync(key, failed) }()
+
 	if m.mirrorTimeout > 0 {
 		var cfn context.CancelFunc
 		ctx, cfn = context.WithTimeout(ctx, m.mirrorTimeout)
@@ -358,10 +447,25 @@ func (m *MultiClient) writeToSecondary(ctx context.Context, primary kvclient, ke
 		})
 
 		if err != nil {
+			failed = true
 			m.mirrorFailuresCounter.Inc()
 			level.Warn(m.logger).Log("msg", "failed to update value in secondary store", "key", key, "err", err, "primary", primary.name, "secondary", kvc.name)
 		} else {
+			m.mirrorLag.Observe(time.Since(updated).Seconds())
 			level.Debug(m.logger).Log("msg", "stored updated value to secondary store", "key", key, "primary", primary.name, "secondary", kvc.name)
 		}
 	}
 }
+
+// setOutOfSync records whether the latest mirror-write of the key failed.
+func (m *MultiClient) setOutOfSync(key string, failed bool) {
+	m.outOfSyncMu.Lock()
+	defer m.outOfSyncMu.Unlock()
+
+	if failed {
+		m.outOfSync[key] = struct{}{}
+	} else {
+		delete(m.outOfSync, key)
+	}
+	m.outOfSyncGauge.Set(float64(len(m.outOfSync)))
+}
@@ -4,10 +4,25 @@
 package kv
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/internal/cortex/ring/kv/codec"
+	"github.com/thanos-io/thanos/internal/cortex/ring/kv/consul"
+	"github.com/thanos-io/thanos/internal/cortex/ring/kv/etcd"
 )
 
 func boolPtr(b bool) *bool {
@@ -33,3 +48,147 @@ func TestMultiRuntimeConfigWithVariousEnabledValues(t *testing.T) {
 		})
 	}
 }
+
+// failingClient fails all the operations of the wrapped client while failing is set.
+type failingClient struct {
+	Client
+	failing *atomic.Bool
+}
+
+func (c failingClient) Get(ctx context.Context, key string) (interface{}, error) {
+	if c.failing.Load() {
+		return nil, errors.New("store unavailable")
+	}
+	return c.Client.Get(ctx, key)
+}
+
+func (c failingClient) CAS(ctx context.Context, key string, f func(in interface{}) (out interface{}, retry bool, err error)) error {
+	if c.failing.Load() {
+		return errors.New("store unavailable")
+	}
+	return c.Client.CAS(ctx, key, f)
+}
+
+func newTestMultiClient(t *testing.T) (m *MultiClient, consulClient, etcdClient Client, consulFailing, etcdFailing *atomic.Bool) {
+	consulKV, consulCloser := consul.NewInMemoryClient(codec.String{}, testLogger{}, nil)
+	t.Cleanup(func() { _ = consulCloser.Close() })
+	etcdKV, etcdCloser := etcd.NewInMemoryClient(codec.String{}, testLogger{})
+	t.Cleanup(func() { _ = etcdCloser.Close() })
+
+	consulFailing, etcdFailing = atomic.NewBool(false), atomic.NewBool(false)
+	m = NewMultiClient(MultiConfig{MirrorEnabled: true, MirrorTimeout: time.Second}, []kvclient{
+		{client: failingClient{Client: consulKV, failing: consulFailing}, name: "consul"},
+		{client: failingClient{Client: etcdKV, failing: etcdFailing}, name: "etcd"},
+	}, testLogger{}, prometheus.NewPedanticRegistry())
+	return m, consulKV, etcdKV, consulFailing, etcdFailing
+}
+
+func set(value string) func(interface{}) (interface{}, bool, error) {
+	return func(interface{}) (interface{}, bool, error) { return value, true, nil }
+}
+
+func TestMultiClient_Mirroring(t *testing.T) {
+	m, consulKV, etcdKV, consulFailing, etcdFailing := newTestMultiClient(t)
+
+	require.NoError(t, m.CAS(ctx, key, set("1")))
+	for _, c := range []Client{m, consulKV, etcdKV} {
+		v, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, "1", v)
+	}
+	require.Equal(t, 1.0, testutil.ToFloat64(m.mirrorWritesCounter))
+	lag := &dto.Metric{}
+	require.NoError(t, m.mirrorLag.Write(lag))
+	require.Equal(t, uint64(1), lag.GetHistogram().GetSampleCount())
+
+	// A failing primary store mid-migration fails the write, which is not mirrored.
+	consulFailing.Store(true)
+	require.Error(t, m.CAS(ctx, key, set("2")))
+	v, err := etcdKV.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "1", v)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.mirrorWritesCounter))
+	consulFailing.Store(false)
+
+	// A failing secondary store does not fail the write, but leaves the key out of sync until it is mirrored again.
+	etcdFailing.Store(true)
+	require.NoError(t, m.CAS(ctx, key, set("3")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.mirrorFailuresCounter))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.outOfSyncGauge))
+	require.Equal(t, 1, m.Status().OutOfSyncKeys)
+
+	etcdFailing.Store(false)
+	require.NoError(t, m.CAS(ctx, key, set("4")))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.outOfSyncGauge))
+	v, err = etcdKV.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "4", v)
+
+	// Without mirroring, writes only go to the primary store.
+	m.SetMirroring(false)
+	require.NoError(t, m.CAS(ctx, key, set("5")))
+	v, err = etcdKV.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "4", v)
+}
+
+func TestMultiClient_SwitchPrimary(t *testing.T) {
+	m, consulKV, _, _, _ := newTestMultiClient(t)
+	require.NoError(t, m.CAS(ctx, key, set("1")))
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watched := make(chan interface{}, 10)
+	go m.WatchKey(watchCtx, key, func(v interface{}) bool {
+		watched <- v
+		return true
+	})
+	requireWatched := func(exp string) {
+		t.Helper()
+		for {
+			select {
+			case v := <-watched:
+				if v == exp {
+					return
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("value %s not watched", exp)
+			}
+		}
+	}
+	requireWatched("1")
+
+	status := func(req *http.Request) MultiClientStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var st MultiClientStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &st))
+		return st
+	}
+	require.Equal(t, MultiClientStatus{Primary: "consul", Stores: []string{"consul", "etcd"}, MirrorEnabled: true}, status(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	// Unknown stores are rejected.
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?primary=memberlist", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.Equal(t, MultiClientStatus{Primary: "etcd", Stores: []string{"consul", "etcd"}, MirrorEnabled: true}, status(httptest.NewRequest(http.MethodPost, "/?primary=etcd", nil)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.primaryStoreGauge.WithLabelValues("etcd")))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.primaryStoreGauge.WithLabelValues("consul")))
+
+	// Watches and writes move to the new primary store, writes are mirrored to the previous one.
+	require.NoError(t, m.CAS(ctx, key, set("2")))
+	requireWatched("2")
+	v, err := consulKV.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "2", v)
+
+	// Mirroring is turned off once the migration is done.
+	require.Equal(t, MultiClientStatus{Primary: "etcd", Stores: []string{"consul", "etcd"}}, status(httptest.NewRequest(http.MethodPost, "/?mirror_enabled=false", nil)))
+	require.NoError(t, m.CAS(ctx, key, set("3")))
+	v, err = consulKV.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "2", v)
+}
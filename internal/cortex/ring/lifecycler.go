@@ -34,6 +34,7 @@ type LifecyclerConfig struct {
 	ObservePeriod            time.Duration `yaml:"observe_period"`
 	JoinAfter                time.Duration `yaml:"join_after"`
 	MinReadyDuration         time.Duration `yaml:"min_ready_duration"`
+	MinJoiningDuration       time.Duration `yaml:"min_joining_duration"`
 	InfNames                 []string      `yaml:"interface_names"`
 	FinalSleep               time.Duration `yaml:"final_sleep"`
 	TokensFilePath           string        `yaml:"tokens_file_path"`
@@ -70,6 +71,7 @@ func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.Flag
 	f.DurationVar(&cfg.JoinAfter, prefix+"join-after", 0*time.Second, "Period to wait for a claim from another member; will join automatically after this.")
 	f.DurationVar(&cfg.ObservePeriod, prefix+"observe-period", 0*time.Second, "Observe tokens after generating to resolve collisions. Useful when using gossiping ring.")
 	f.DurationVar(&cfg.MinReadyDuration, prefix+"min-ready-duration", 15*time.Second, "Minimum duration to wait after the internal readiness checks have passed but before succeeding the readiness endpoint. This is used to slowdown deployment controllers (eg. Kubernetes) after an instance is ready and before they proceed with a rolling update, to give the rest of the cluster instances enough time to receive ring updates.")
+	f.DurationVar(&cfg.MinJoiningDuration, prefix+"min-joining-duration", 0, "Minimum duration the instance stays JOINING with stable tokens before going ACTIVE, also when it restarts with tokens in the ring or on disk, so that it does not get writes right away. 0 = disabled, unless a join readiness check is set by the component.")
 	f.DurationVar(&cfg.FinalSleep, prefix+"final-sleep", 30*time.Second, "Duration to sleep for before exiting, to ensure metrics are scraped.")
 	f.StringVar(&cfg.TokensFilePath, prefix+"tokens-file-path", "", "File path where tokens are stored. If empty, tokens are not stored at shutdown and restored at startup.")
 
@@ -121,6 +123,11 @@ type Lifecycler struct {
 	ready      bool
 	readySince time.Time
 
+	// Controls the transition from JOINING to ACTIVE, when joining is gated. joiningSince is only accessed from loop().
+	joinReadinessCheck func(ctx context.Context) error
+	joinCheckPeriod    time.Duration
+	joiningSince       time.Time
+
 	// Keeps stats updated at every heartbeat period
 	countersLock          sync.RWMutex
 	healthyInstancesCount int
@@ -173,6 +180,7 @@ func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer, ringNa
 		Zone:                 zone,
 		actorChan:            make(chan func()),
 		state:                PENDING,
+		joinCheckPeriod:      time.Second,
 		lifecyclerMetrics:    NewLifecyclerMetrics(ringName, reg),
 		logger:               logger,
 	}
@@ -186,6 +194,26 @@ func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer, ringNa
 	return l, nil
 }
 
+// SetJoinReadinessCheck sets the check of the component the instance must pass before going ACTIVE, e.g. for its
+// WAL to be replayed. Until then and for at least the min joining duration with stable tokens, the instance stays
+// JOINING and gets no writes. It must be called before the lifecycler is started.
+func (i *Lifecycler) SetJoinReadinessCheck(check func(ctx context.Context) error) {
+	i.joinReadinessCheck = check
+}
+
+// joinGated returns whether the instance goes JOINING instead of ACTIVE until it is ready to get writes.
+func (i *Lifecycler) joinGated() bool {
+	return i.cfg.MinJoiningDuration > 0 || i.joinReadinessCheck != nil
+}
+
+// joinState returns the state the instance goes to once it owns its tokens.
+func (i *Lifecycler) joinState() InstanceState {
+	if i.joinGated() {
+		return JOINING
+	}
+	return ACTIVE
+}
+
 // CheckReady is used to rate limit the number of ingesters that can be coming or
 // going at any one time, by only returning true if all ingesters are active.
 // The state latches: once we have gone ready we don't go un-ready
@@ -403,7 +431,12 @@ func (i *Lifecycler) loop(ctx context.Context) error {
 
 	// We do various period tasks
 	autoJoinAfter := time.After(i.cfg.JoinAfter)
-	var observeChan <-chan time.Time
+	var observeChan, joinCheckChan <-chan time.Time
+
+	// The instance may have restarted with its tokens and be JOINING until it is ready.
+	if i.joinGated() && i.GetState() == JOINING {
+		joinCheckChan = i.startJoinChecks()
+	}
 
 	heartbeatTickerStop, heartbeatTickerChan := newDisableableTicker(i.cfg.HeartbeatPeriod)
 	defer heartbeatTickerStop()
@@ -427,9 +460,12 @@ func (i *Lifecycler) loop(ctx context.Context) error {
 					level.Info(i.logger).Log("msg", "observing tokens before going ACTIVE", "ring", i.RingName)
 					observeChan = time.After(i.cfg.ObservePeriod)
 				} else {
-					if err := i.autoJoin(context.Background(), ACTIVE); err != nil {
+					if err := i.autoJoin(context.Background(), i.joinState()); err != nil {
 						return perrors.Wrapf(err, "failed to pick tokens in the KV store, ring: %s", i.RingName)
 					}
+					if i.joinGated() {
+						joinCheckChan = i.startJoinChecks()
+					}
 				}
 			}
 
@@ -445,6 +481,10 @@ func (i *Lifecycler) loop(ctx context.Context) error {
 			if i.verifyTokens(context.Background()) {
 				level.Info(i.logger).Log("msg", "token verification successful", "ring", i.RingName)
 
+				if i.joinGated() {
+					joinCheckChan = i.startJoinChecks()
+					continue
+				}
 				err := i.changeState(context.Background(), ACTIVE)
 				if err != nil {
 					level.Error(i.logger).Log("msg", "failed to set state to ACTIVE", "ring", i.RingName, "err", err)
@@ -455,6 +495,13 @@ func (i *Lifecycler) loop(ctx context.Context) error {
 				observeChan = time.After(i.cfg.ObservePeriod)
 			}
 
+		case <-joinCheckChan:
+			// if joinCheckChan is nil, this case is ignored. It is set to nil once the instance is ACTIVE.
+			joinCheckChan = nil
+			if !i.checkJoin(context.Background()) {
+				joinCheckChan = time.After(i.joinCheckPeriod)
+			}
+
 		case <-heartbeatTickerChan:
 			i.lifecyclerMetrics.consulHeartbeats.Inc()
 			if err := i.updateConsul(context.Background()); err != nil {
@@ -471,6 +518,44 @@ func (i *Lifecycler) loop(ctx context.Context) error {
 	}
 }
 
+// startJoinChecks starts waiting for the JOINING instance to be ready to go ACTIVE.
+func (i *Lifecycler) startJoinChecks() <-chan time.Time {
+	level.Info(i.logger).Log("msg", "waiting for the instance to be ready and its tokens to be stable before going ACTIVE", "min_joining_duration", i.cfg.MinJoiningDuration, "ring", i.RingName)
+	i.joiningSince = time.Now()
+	return time.After(i.joinCheckPeriod)
+}
+
+// checkJoin moves the JOINING instance to ACTIVE once the join readiness check passes and its tokens have been stable
+// for the min joining duration. It returns whether checking is done.
+func (i *Lifecycler) checkJoin(ctx context.Context) bool {
+	if s := i.GetState(); s != JOINING {
+		level.Warn(i.logger).Log("msg", "unexpected state while waiting to go ACTIVE", "state", s, "ring", i.RingName)
+		return true
+	}
+
+	// The stability of the tokens is observed from scratch whenever they change, e.g. on conflicts in a gossiping ring.
+	if !i.verifyTokens(ctx) {
+		level.Info(i.logger).Log("msg", "token verification failed, waiting for tokens to be stable", "ring", i.RingName)
+		i.joiningSince = time.Now()
+		return false
+	}
+	if i.joinReadinessCheck != nil {
+		if err := i.joinReadinessCheck(ctx); err != nil {
+			level.Debug(i.logger).Log("msg", "instance not ready to go ACTIVE", "ring", i.RingName, "err", err)
+			return false
+		}
+	}
+	if time.Since(i.joiningSince) < i.cfg.MinJoiningDuration {
+		return false
+	}
+
+	if err := i.changeState(ctx, ACTIVE); err != nil {
+		level.Error(i.logger).Log("msg", "failed to set state to ACTIVE", "ring", i.RingName, "err", err)
+		return false
+	}
+	return true
+}
+
 // Shutdown the lifecycle.  It will:
 // - send chunks to another ingester, if it can.
 // - otherwise, flush chunks to the chunk store.
@@ -560,7 +645,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 			if len(tokensFromFile) > 0 {
 				level.Info(i.logger).Log("msg", "adding tokens from file", "num_tokens", len(tokensFromFile))
 				if len(tokensFromFile) >= i.cfg.NumTokens {
-					i.setState(ACTIVE)
+					i.setState(i.joinState())
 				}
 				ringDesc.AddIngester(i.ID, i.Addr, i.Zone, tokensFromFile, i.GetState(), registeredAt)
 				i.setTokens(tokensFromFile)
@@ -595,6 +680,14 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 			instanceDesc.State = ACTIVE
 		}
 
+		// An instance restarting ACTIVE quickly must not get writes before it is ready again.
+		modified := false
+		if instanceDesc.State == ACTIVE && i.joinGated() {
+			level.Info(i.logger).Log("msg", "instance found in ring as ACTIVE, setting to JOINING until it is ready", "ring", i.RingName)
+			instanceDesc.State = JOINING
+			modified = true
+		}
+
 		// We exist in the ring, so assume the ring is right and copy out tokens & state out of there.
 		i.setState(instanceDesc.State)
 		tokens, _ := ringDesc.TokensFor(i.ID)
@@ -605,7 +698,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 		// Update the ring if the instance has been changed and the heartbeat is disabled.
 		// We dont need to update KV here when heartbeat is enabled as this info will eventually be update on KV
 		// on the next heartbeat
-		if i.cfg.HeartbeatPeriod == 0 && !instanceDesc.Equal(ringDesc.Ingesters[i.ID]) {
+		if modified || (i.cfg.HeartbeatPeriod == 0 && !instanceDesc.Equal(ringDesc.Ingesters[i.ID])) {
 			// Update timestamp to give gossiping client a chance register ring change.
 			instanceDesc.Timestamp = time.Now().Unix()
 			ringDesc.Ingesters[i.ID] = instanceDesc
@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/thanos-io/thanos/internal/cortex/ring/kv/consul"
 	"github.com/thanos-io/thanos/internal/cortex/util/flagext"
@@ -257,6 +258,101 @@ func TestLifecycler_ShouldHandleInstanceAbruptlyRestarted(t *testing.T) {
 	})
 }
 
+func TestLifecycler_JoinGated(t *testing.T) {
+	ringStore, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.KVStore.Mock = ringStore
+
+	r, err := New(ringConfig, "ingester", ringKey, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	getState := func(id string) InstanceState {
+		d, err := r.KVClient.Get(context.Background(), ringKey)
+		require.NoError(t, err)
+		desc, ok := d.(*Desc)
+		if !ok || desc == nil {
+			return PENDING
+		}
+		return desc.Ingesters[id].State
+	}
+	writeInstances := func() []string {
+		d, err := r.KVClient.Get(context.Background(), ringKey)
+		require.NoError(t, err)
+		var instances []InstanceDesc
+		for _, ing := range d.(*Desc).Ingesters {
+			instances = append(instances, ing)
+		}
+		healthy, _, err := NewDefaultReplicationStrategy().Filter(instances, Write, 1, ringConfig.HeartbeatTimeout, false)
+		require.NoError(t, err)
+		var addrs []string
+		for _, ing := range healthy {
+			addrs = append(addrs, ing.Addr)
+		}
+		return addrs
+	}
+
+	// An ungated instance goes ACTIVE right away.
+	cfg0 := testLifecyclerConfig(ringConfig, "ing0")
+	cfg0.Addr = "1.1.1.1"
+	l0, err := NewLifecycler(cfg0, &nopFlushTransferer{}, "ingester", ringKey, true, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), l0))
+	defer services.StopAndAwaitTerminated(context.Background(), l0) //nolint:errcheck
+	test.Poll(t, time.Second, ACTIVE, func() interface{} { return getState("ing0") })
+
+	cfg1 := testLifecyclerConfig(ringConfig, "ing1")
+	cfg1.Addr = "2.2.2.2"
+	cfg1.MinJoiningDuration = 200 * time.Millisecond
+	newGatedLifecycler := func(ready *atomic.Bool) *Lifecycler {
+		l, err := NewLifecycler(cfg1, &nopFlushTransferer{}, "ingester", ringKey, true, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+		l.joinCheckPeriod = 10 * time.Millisecond
+		l.SetJoinReadinessCheck(func(context.Context) error {
+			if !ready.Load() {
+				return errors.New("WAL not replayed")
+			}
+			return nil
+		})
+		return l
+	}
+
+	// The gated instance stays JOINING, without getting writes, until it is ready.
+	ready := atomic.NewBool(false)
+	l1 := newGatedLifecycler(ready)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), l1))
+	test.Poll(t, time.Second, JOINING, func() interface{} { return getState("ing1") })
+	time.Sleep(2 * cfg1.MinJoiningDuration)
+	require.Equal(t, JOINING, getState("ing1"))
+	require.Equal(t, []string{"1.1.1.1:1"}, writeInstances())
+
+	ready.Store(true)
+	test.Poll(t, time.Second, ACTIVE, func() interface{} { return getState("ing1") })
+	require.ElementsMatch(t, []string{"1.1.1.1:1", "2.2.2.2:1"}, writeInstances())
+
+	// When restarting ACTIVE without unregistering, the instance goes JOINING again until it is ready and its tokens
+	// have been stable for the min joining duration.
+	l1.SetUnregisterOnShutdown(false)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), l1))
+	require.Equal(t, LEAVING, getState("ing1"))
+
+	ready.Store(false)
+	l1 = newGatedLifecycler(ready)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), l1))
+	defer services.StopAndAwaitTerminated(context.Background(), l1) //nolint:errcheck
+	test.Poll(t, time.Second, JOINING, func() interface{} { return getState("ing1") })
+	require.Equal(t, []string{"1.1.1.1:1"}, writeInstances())
+
+	ready.Store(true)
+	start := time.Now()
+	test.Poll(t, time.Second, ACTIVE, func() interface{} { return getState("ing1") })
+	require.GreaterOrEqual(t, time.Since(start), cfg1.MinJoiningDuration/2)
+}
+
 type MockClient struct {
 	ListFunc        func(ctx context.Context, prefix string) ([]string, error)
 	GetFunc         func(ctx context.Context, key string) (interface{}, error)
@@ -69,6 +69,7 @@ func TestBucketIndexMetadataFetcher_Fetch(t *testing.T) {
 	assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
 		# HELP blocks_meta_modified Number of blocks whose metadata changed
 		# TYPE blocks_meta_modified gauge
+		blocks_meta_modified{modified="group-key-label-removed"} 0
 		blocks_meta_modified{modified="replica-label-removed"} 0
 
 		# HELP blocks_meta_sync_failures_total Total blocks metadata synchronization failures
@@ -85,8 +86,11 @@ func TestBucketIndexMetadataFetcher_Fetch(t *testing.T) {
 		blocks_meta_synced{state="loaded"} 2
 		blocks_meta_synced{state="marked-for-deletion"} 1
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 
@@ -120,6 +124,7 @@ func TestBucketIndexMetadataFetcher_Fetch_NoBucketIndex(t *testing.T) {
 	assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
 		# HELP blocks_meta_modified Number of blocks whose metadata changed
 		# TYPE blocks_meta_modified gauge
+		blocks_meta_modified{modified="group-key-label-removed"} 0
 		blocks_meta_modified{modified="replica-label-removed"} 0
 
 		# HELP blocks_meta_sync_failures_total Total blocks metadata synchronization failures
@@ -136,8 +141,11 @@ func TestBucketIndexMetadataFetcher_Fetch_NoBucketIndex(t *testing.T) {
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 1
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 
@@ -174,6 +182,7 @@ func TestBucketIndexMetadataFetcher_Fetch_CorruptedBucketIndex(t *testing.T) {
 	assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
 		# HELP blocks_meta_modified Number of blocks whose metadata changed
 		# TYPE blocks_meta_modified gauge
+		blocks_meta_modified{modified="group-key-label-removed"} 0
 		blocks_meta_modified{modified="replica-label-removed"} 0
 
 		# HELP blocks_meta_sync_failures_total Total blocks metadata synchronization failures
@@ -190,8 +199,11 @@ func TestBucketIndexMetadataFetcher_Fetch_CorruptedBucketIndex(t *testing.T) {
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 
@@ -236,8 +248,11 @@ func TestBucketIndexMetadataFetcher_Fetch_ShouldResetGaugeMetrics(t *testing.T)
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 	`), "blocks_meta_synced"))
@@ -260,8 +275,11 @@ func TestBucketIndexMetadataFetcher_Fetch_ShouldResetGaugeMetrics(t *testing.T)
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 1
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 	`), "blocks_meta_synced"))
@@ -292,8 +310,11 @@ func TestBucketIndexMetadataFetcher_Fetch_ShouldResetGaugeMetrics(t *testing.T)
 		blocks_meta_synced{state="loaded"} 3
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 	`), "blocks_meta_synced"))
@@ -318,8 +339,11 @@ func TestBucketIndexMetadataFetcher_Fetch_ShouldResetGaugeMetrics(t *testing.T)
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="newer-meta-version"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="relocated"} 0
+		blocks_meta_synced{state="tier-excluded"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
 	`), "blocks_meta_synced"))
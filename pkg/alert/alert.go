@@ -233,6 +233,15 @@ type Sender struct {
 	errs    *prometheus.CounterVec
 	dropped prometheus.Counter
 	latency *prometheus.HistogramVec
+
+	maxFailures int
+	cooldown    time.Duration
+	now         func() time.Time
+
+	healthMtx           sync.Mutex
+	health              map[string]*endpointHealth
+	consecutiveFailures *prometheus.GaugeVec
+	inCooldown          *prometheus.GaugeVec
 }
 
 // NewSender returns a new sender. On each call to Send the entire alert batch is sent
@@ -241,6 +250,7 @@ func NewSender(
 	logger log.Logger,
 	reg prometheus.Registerer,
 	alertmanagers []*Alertmanager,
+	opts ...SenderOption,
 ) *Sender {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -279,6 +289,20 @@ func NewSender(
 			Name: "thanos_alert_sender_latency_seconds",
 			Help: "Latency for sending alert notifications (not including dropped notifications).",
 		}, []string{"alertmanager"}),
+
+		now:    time.Now,
+		health: map[string]*endpointHealth{},
+		consecutiveFailures: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_alert_sender_alertmanager_consecutive_failures",
+			Help: "Number of failed sends of alerts in a row to the discovered alertmanager.",
+		}, []string{"alertmanager"}),
+		inCooldown: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_alert_sender_alertmanager_in_cooldown",
+			Help: "1 if no alerts are sent to the discovered alertmanager because it failed too many times in a row, as of the last send, 0 otherwise.",
+		}, []string{"alertmanager"}),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	return s
 }
@@ -292,7 +316,8 @@ func toAPILabels(labels labels.Labels) models.LabelSet {
 	return apiLabels
 }
 
-// Send an alert batch to all given Alertmanager clients.
+// Send an alert batch to all given Alertmanager clients, except the endpoints in their failure cooldown, see
+// WithFailureCooldown.
 // TODO(bwplotka): https://github.com/thanos-io/thanos/issues/660.
 func (s *Sender) Send(ctx context.Context, alerts []*notifier.Alert) {
 	if len(alerts) == 0 {
@@ -335,35 +360,36 @@ func (s *Sender) Send(ctx context.Context, alerts []*notifier.Alert) {
 	var (
 		wg         sync.WaitGroup
 		numSuccess atomic.Uint64
+		now        = s.now()
 	)
-	for _, am := range s.alertmanagers {
-		for _, u := range am.dispatcher.Endpoints() {
-			wg.Add(1)
-			go func(am *Alertmanager, u url.URL) {
-				defer wg.Done()
-
-				level.Debug(s.logger).Log("msg", "sending alerts", "alertmanager", u.Host, "numAlerts", len(alerts))
-				start := time.Now()
-				u.Path = path.Join(u.Path, fmt.Sprintf("/api/%s/alerts", string(am.version)))
-
-				tracing.DoInSpan(ctx, "post_alerts HTTP[client]", func(ctx context.Context) {
-					if err := am.postAlerts(ctx, u, bytes.NewReader(payload[am.version])); err != nil {
-						level.Warn(s.logger).Log(
-							"msg", "sending alerts failed",
-							"alertmanager", u.Host,
-							"alerts", string(payload[am.version]),
-							"err", err,
-						)
-						s.errs.WithLabelValues(u.Host).Inc()
-						return
-					}
-					s.latency.WithLabelValues(u.Host).Observe(time.Since(start).Seconds())
-					s.sent.WithLabelValues(u.Host).Add(float64(len(alerts)))
-
-					numSuccess.Inc()
-				})
-			}(am, *u)
-		}
+	for _, ep := range s.withoutCooldowns(s.endpoints(now), now) {
+		wg.Add(1)
+		go func(am *Alertmanager, u url.URL) {
+			defer wg.Done()
+
+			level.Debug(s.logger).Log("msg", "sending alerts", "alertmanager", u.Host, "numAlerts", len(alerts))
+			start := time.Now()
+			u.Path = path.Join(u.Path, fmt.Sprintf("/api/%s/alerts", string(am.version)))
+
+			tracing.DoInSpan(ctx, "post_alerts HTTP[client]", func(ctx context.Context) {
+				err := am.postAlerts(ctx, u, bytes.NewReader(payload[am.version]))
+				s.recordSend(u.Host, err, now)
+				if err != nil {
+					level.Warn(s.logger).Log(
+						"msg", "sending alerts failed",
+						"alertmanager", u.Host,
+						"alerts", string(payload[am.version]),
+						"err", err,
+					)
+					s.errs.WithLabelValues(u.Host).Inc()
+					return
+				}
+				s.latency.WithLabelValues(u.Host).Observe(time.Since(start).Seconds())
+				s.sent.WithLabelValues(u.Host).Add(float64(len(alerts)))
+
+				numSuccess.Inc()
+			})
+		}(ep.am, ep.u)
 	}
 	wg.Wait()
 
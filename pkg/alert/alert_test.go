@@ -215,3 +215,87 @@ func TestSenderSendsAllFail(t *testing.T) {
 	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.errs.WithLabelValues(poster.urls[1].Host))))
 	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.dropped)))
 }
+
+func TestSenderFailureCooldown(t *testing.T) {
+	poster := &fakeClient{
+		urls: []*url.URL{{Host: "am1:9090"}, {Host: "am2:9090"}, {Host: "am3:9090"}},
+		dof: func(u *url.URL) (*http.Response, error) {
+			if u.Host == "am2:9090" {
+				return nil, errors.New("connection refused")
+			}
+			rec := httptest.NewRecorder()
+			rec.WriteHeader(http.StatusOK)
+			return rec.Result(), nil
+		},
+	}
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, WithFailureCooldown(2, time.Minute))
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+
+	send := func() {
+		poster.seen = nil
+		s.Send(context.Background(), []*notifier.Alert{{}})
+		now = now.Add(10 * time.Second)
+	}
+
+	// The dead Alertmanager is tried until it failed twice in a row.
+	send()
+	send()
+	assertSameHosts(t, poster.urls, poster.seen)
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.consecutiveFailures.WithLabelValues("am2:9090"))))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.inCooldown.WithLabelValues("am2:9090"))))
+
+	// During the cooldown, the alerts only go to the healthy ones.
+	send()
+	testutil.Equals(t, 2, len(poster.seen))
+	for _, u := range poster.seen {
+		testutil.Assert(t, u.Host != "am2:9090", "alerts sent to the Alertmanager in cooldown")
+	}
+	testutil.Equals(t, 3, int(promtestutil.ToFloat64(s.sent.WithLabelValues("am1:9090"))))
+	testutil.Equals(t, 3, int(promtestutil.ToFloat64(s.sent.WithLabelValues("am3:9090"))))
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.errs.WithLabelValues("am2:9090"))))
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.dropped)))
+
+	statuses := s.Alertmanagers()
+	testutil.Equals(t, 3, len(statuses))
+	testutil.Equals(t, "//am2:9090", statuses[1].URL)
+	testutil.Equals(t, false, statuses[1].Healthy)
+	testutil.Equals(t, 2, statuses[1].ConsecutiveFailures)
+	testutil.Equals(t, "send request to \"//am2:9090/api/v1/alerts\": connection refused", statuses[1].LastError)
+	testutil.Equals(t, time.Unix(70, 0), statuses[1].CooldownUntil)
+	testutil.Equals(t, true, statuses[0].Healthy)
+	testutil.Equals(t, time.Unix(20, 0), statuses[0].LastSuccess)
+
+	// Once the cooldown is over, the Alertmanager is tried again, and goes back in cooldown as it still fails.
+	now = time.Unix(70, 0)
+	send()
+	assertSameHosts(t, poster.urls, poster.seen)
+	testutil.Equals(t, 3, int(promtestutil.ToFloat64(s.consecutiveFailures.WithLabelValues("am2:9090"))))
+	send()
+	testutil.Equals(t, 2, len(poster.seen))
+
+	// The Alertmanagers which are not discovered anymore are forgotten.
+	poster.urls = poster.urls[:1]
+	send()
+	testutil.Equals(t, 1, len(s.Alertmanagers()))
+	testutil.Equals(t, 1, promtestutil.CollectAndCount(s.consecutiveFailures))
+}
+
+func TestSenderFailureCooldownAllFail(t *testing.T) {
+	poster := &fakeClient{
+		urls: []*url.URL{{Host: "am1:9090"}, {Host: "am2:9090"}},
+		dof: func(u *url.URL) (*http.Response, error) {
+			return nil, errors.New("no such host")
+		},
+	}
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, WithFailureCooldown(1, time.Minute))
+
+	s.Send(context.Background(), []*notifier.Alert{{}})
+	assertSameHosts(t, poster.urls, poster.seen)
+
+	// With all Alertmanagers in their cooldown, the alerts are still sent to all of them.
+	poster.seen = nil
+	s.Send(context.Background(), []*notifier.Alert{{}})
+	testutil.Equals(t, 2, len(poster.seen))
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.dropped)))
+}
@@ -0,0 +1,168 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package alert
+
+import (
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// SenderOption configures a Sender.
+type SenderOption func(*Sender)
+
+// WithFailureCooldown makes the sender stop sending alerts to an Alertmanager endpoint for the cooldown once
+// maxFailures sends to it failed in a row, so that a dead endpoint doesn't slow down the sends nor flood the logs. The
+// alerts keep being sent to the other endpoints, or to all of them if they are all in their cooldown. Once the cooldown
+// is over, the endpoint is tried again, and goes back in cooldown right away if it still fails.
+func WithFailureCooldown(maxFailures int, cooldown time.Duration) SenderOption {
+	return func(s *Sender) {
+		s.maxFailures = maxFailures
+		s.cooldown = cooldown
+	}
+}
+
+// AlertmanagerStatus is the health of an Alertmanager endpoint, as of the last sends of alerts to it.
+type AlertmanagerStatus struct {
+	URL string `json:"url"`
+	// Healthy is true if the last send to the endpoint succeeded, or none happened yet.
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError"`
+	LastFailure         time.Time `json:"lastFailure"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	// CooldownUntil is the time until which no alerts are sent to the endpoint, if it is in the future.
+	CooldownUntil time.Time `json:"cooldownUntil"`
+}
+
+// endpointHealth tracks the health of an Alertmanager endpoint.
+type endpointHealth struct {
+	url                 string
+	consecutiveFailures int
+	lastError           string
+	lastFailure         time.Time
+	lastSuccess         time.Time
+	cooldownUntil       time.Time
+}
+
+func (h *endpointHealth) inCooldown(now time.Time) bool {
+	return now.Before(h.cooldownUntil)
+}
+
+// endpoint is an Alertmanager endpoint to send alerts to.
+type endpoint struct {
+	am *Alertmanager
+	u  url.URL
+}
+
+// endpoints returns the endpoints of all Alertmanagers, tracking the health of the new ones and forgetting the ones
+// which are not discovered anymore.
+func (s *Sender) endpoints(now time.Time) []endpoint {
+	var eps []endpoint
+	for _, am := range s.alertmanagers {
+		for _, u := range am.dispatcher.Endpoints() {
+			eps = append(eps, endpoint{am: am, u: *u})
+		}
+	}
+
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+
+	discovered := make(map[string]struct{}, len(eps))
+	for _, ep := range eps {
+		discovered[ep.u.Host] = struct{}{}
+		if _, ok := s.health[ep.u.Host]; !ok {
+			s.health[ep.u.Host] = &endpointHealth{url: ep.u.String()}
+		}
+	}
+	for host, h := range s.health {
+		if _, ok := discovered[host]; !ok {
+			delete(s.health, host)
+			s.consecutiveFailures.DeleteLabelValues(host)
+			s.inCooldown.DeleteLabelValues(host)
+			continue
+		}
+		if h.inCooldown(now) {
+			s.inCooldown.WithLabelValues(host).Set(1)
+		} else {
+			s.inCooldown.WithLabelValues(host).Set(0)
+		}
+	}
+	return eps
+}
+
+// withoutCooldowns returns the endpoints which are not in their cooldown, or all of them if they all are.
+func (s *Sender) withoutCooldowns(eps []endpoint, now time.Time) []endpoint {
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+
+	var res []endpoint
+	for _, ep := range eps {
+		if h, ok := s.health[ep.u.Host]; ok && h.inCooldown(now) {
+			continue
+		}
+		res = append(res, ep)
+	}
+	if len(res) == 0 && len(eps) > 0 {
+		level.Warn(s.logger).Log("msg", "all alertmanagers are in their failure cooldown, sending alerts to all of them")
+		return eps
+	}
+	return res
+}
+
+// recordSend records the result of a send of alerts to the endpoint.
+func (s *Sender) recordSend(host string, err error, now time.Time) {
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+
+	h, ok := s.health[host]
+	if !ok {
+		return
+	}
+	if err == nil {
+		h.consecutiveFailures = 0
+		h.lastSuccess = now
+		h.cooldownUntil = time.Time{}
+		s.consecutiveFailures.WithLabelValues(host).Set(0)
+		s.inCooldown.WithLabelValues(host).Set(0)
+		return
+	}
+
+	h.consecutiveFailures++
+	h.lastError = err.Error()
+	h.lastFailure = now
+	s.consecutiveFailures.WithLabelValues(host).Set(float64(h.consecutiveFailures))
+	if s.maxFailures > 0 && h.consecutiveFailures >= s.maxFailures {
+		h.cooldownUntil = now.Add(s.cooldown)
+		s.inCooldown.WithLabelValues(host).Set(1)
+		level.Warn(s.logger).Log("msg", "alertmanager failed too many times in a row, not sending alerts to it until the cooldown is over",
+			"alertmanager", host, "failures", h.consecutiveFailures, "cooldown_until", h.cooldownUntil)
+	}
+}
+
+// Alertmanagers returns the health of the discovered Alertmanager endpoints, sorted by URL.
+func (s *Sender) Alertmanagers() []AlertmanagerStatus {
+	now := s.now()
+	s.endpoints(now)
+
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+
+	res := make([]AlertmanagerStatus, 0, len(s.health))
+	for _, h := range s.health {
+		res = append(res, AlertmanagerStatus{
+			URL:                 h.url,
+			Healthy:             h.consecutiveFailures == 0,
+			ConsecutiveFailures: h.consecutiveFailures,
+			LastError:           h.lastError,
+			LastFailure:         h.lastFailure,
+			LastSuccess:         h.lastSuccess,
+			CooldownUntil:       h.cooldownUntil,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].URL < res[j].URL })
+	return res
+}
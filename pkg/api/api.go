@@ -22,6 +22,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"runtime"
@@ -31,6 +32,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/common/version"
 
@@ -50,14 +52,22 @@ const (
 type ErrorType string
 
 const (
-	ErrorNone     ErrorType = ""
-	ErrorTimeout  ErrorType = "timeout"
-	ErrorCanceled ErrorType = "canceled"
-	ErrorExec     ErrorType = "execution"
-	ErrorBadData  ErrorType = "bad_data"
-	ErrorInternal ErrorType = "internal"
+	ErrorNone      ErrorType = ""
+	ErrorTimeout   ErrorType = "timeout"
+	ErrorCanceled  ErrorType = "canceled"
+	ErrorExec      ErrorType = "execution"
+	ErrorBadData   ErrorType = "bad_data"
+	ErrorInternal  ErrorType = "internal"
+	ErrorTooLarge  ErrorType = "too_large"
+	ErrorForbidden ErrorType = "forbidden"
 )
 
+// streamedResponseBufferSize is the size of the beginning of streamed responses buffered before writing them. Streamed
+// responses exceeding their limit within it are rejected with a proper error response.
+const streamedResponseBufferSize = 64 * 1024
+
+var errResponseTooLarge = errors.New("response too large")
+
 var corsHeaders = map[string]string{
 	"Access-Control-Allow-Headers":  "Accept, Accept-Encoding, Authorization, Content-Type, Origin",
 	"Access-Control-Allow-Methods":  "GET, OPTIONS",
@@ -230,7 +240,26 @@ func GetInstr(
 	return instr
 }
 
+// StreamedData is response data encoded as it is written to the response, instead of being encoded entirely in memory
+// before.
+type StreamedData struct {
+	// Encode writes the JSON encoding of the data to w.
+	Encode func(w io.Writer) error
+	// MaxBytes is the maximum size of the response, 0 means unlimited.
+	MaxBytes int64
+	// Written is called with the size of the response once it is written, if not nil.
+	Written func(bytes int64)
+	// CacheControl is the Cache-Control header of the response, if not empty. Responses with warnings are never
+	// stored.
+	CacheControl string
+}
+
 func Respond(w http.ResponseWriter, data interface{}, warnings []error) {
+	if sd, ok := data.(*StreamedData); ok {
+		respondStreamed(w, sd, warnings)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if len(warnings) > 0 {
 		w.Header().Set("Cache-Control", "no-store")
@@ -261,6 +290,10 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 		code = http.StatusServiceUnavailable
 	case ErrorInternal:
 		code = http.StatusInternalServerError
+	case ErrorTooLarge:
+		code = http.StatusRequestEntityTooLarge
+	case ErrorForbidden:
+		code = http.StatusForbidden
 	default:
 		code = http.StatusInternalServerError
 	}
@@ -273,3 +306,106 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 		Data:      data,
 	})
 }
+
+// respondStreamed writes the response of the streamed data. Responses exceeding the maximum size of the data are
+// rejected with 413 Request Entity Too Large if nothing was written yet. Otherwise an error response is appended to
+// the partial response and the response is aborted, so that clients fail reading it instead of getting a truncated
+// body with a successful status.
+func respondStreamed(w http.ResponseWriter, data *StreamedData, warnings []error) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(warnings) > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+	} else if data.CacheControl != "" {
+		w.Header().Set("Cache-Control", data.CacheControl)
+	}
+	lw := &limitedResponseWriter{w: w, maxBytes: data.MaxBytes}
+	err := writeStreamed(lw, data, warnings)
+	if err == nil {
+		err = lw.flush()
+	}
+	if data.Written != nil {
+		data.Written(lw.written)
+	}
+	if err == nil {
+		return
+	}
+
+	apiErr := &ApiError{Typ: ErrorInternal, Err: errors.Wrap(err, "encode response")}
+	if errors.Is(err, errResponseTooLarge) {
+		apiErr = &ApiError{Typ: ErrorTooLarge, Err: errors.Errorf("response exceeds the limit of %d bytes", data.MaxBytes)}
+	}
+	if !lw.wroteHeader {
+		RespondError(w, apiErr, nil)
+		return
+	}
+	if errors.Is(err, errResponseTooLarge) {
+		_ = lw.flush()
+		_, _ = w.Write([]byte("\n"))
+		_ = json.NewEncoder(w).Encode(&response{Status: StatusError, ErrorType: apiErr.Typ, Error: apiErr.Err.Error()})
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// writeStreamed writes the response of the streamed data, encoded as by Respond.
+func writeStreamed(w io.Writer, data *StreamedData, warnings []error) error {
+	if _, err := io.WriteString(w, `{"status":"success","data":`); err != nil {
+		return err
+	}
+	if err := data.Encode(w); err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		ws := make([]string, 0, len(warnings))
+		for _, warn := range warnings {
+			ws = append(ws, warn.Error())
+		}
+		b, err := json.Marshal(ws)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, `,"warnings":`); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+// limitedResponseWriter buffers the beginning of a successful response and fails writes exceeding its maximum size.
+type limitedResponseWriter struct {
+	w           http.ResponseWriter
+	maxBytes    int64
+	buf         []byte
+	written     int64
+	wroteHeader bool
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	if w.maxBytes > 0 && w.written+int64(len(p)) > w.maxBytes {
+		return 0, errResponseTooLarge
+	}
+	w.written += int64(len(p))
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= streamedResponseBufferSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *limitedResponseWriter) flush() error {
+	if !w.wroteHeader {
+		w.w.WriteHeader(http.StatusOK)
+		w.wroteHeader = true
+	}
+	_, err := w.w.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
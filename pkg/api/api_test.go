@@ -18,10 +18,13 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/log"
@@ -139,3 +142,87 @@ func TestOptionsMethod(t *testing.T) {
 		}
 	}
 }
+
+func TestRespondStreamed(t *testing.T) {
+	// streamedSeries returns streamed data of n series, written one by one.
+	streamedSeries := func(n int, maxBytes int64, written *int64) *StreamedData {
+		return &StreamedData{
+			Encode: func(w io.Writer) error {
+				if _, err := io.WriteString(w, "["); err != nil {
+					return err
+				}
+				for i := 0; i < n; i++ {
+					sep := ","
+					if i == 0 {
+						sep = ""
+					}
+					if _, err := fmt.Fprintf(w, `%s{"metric":{"i":"%d"},"values":[[1,"1"]]}`, sep, i); err != nil {
+						return err
+					}
+				}
+				_, err := io.WriteString(w, "]")
+				return err
+			},
+			MaxBytes: maxBytes,
+			Written:  func(bytes int64) { *written = bytes },
+		}
+	}
+	instr := GetInstr(&opentracing.NoopTracer{}, log.NewNopLogger(), extpromhttp.NewNopInstrumentationMiddleware(), logging.NewHTTPServerMiddleware(log.NewNopLogger()), false)
+	get := func(data *StreamedData) (*http.Response, []byte, error) {
+		s := httptest.NewServer(instr("test", func(r *http.Request) (interface{}, []error, *ApiError) {
+			return data, []error{errors.New("warning")}, nil
+		}))
+		defer s.Close()
+
+		resp, err := http.Get(s.URL)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, resp.Body.Close()) }()
+		body, err := ioutil.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	t.Run("within limit", func(t *testing.T) {
+		var written int64
+		data := streamedSeries(10000, 1<<20, &written)
+		data.CacheControl = "public, max-age=60"
+		resp, body, err := get(data)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, resp.StatusCode)
+		testutil.Equals(t, "application/json", resp.Header.Get("Content-Type"))
+		// Responses with warnings are never stored.
+		testutil.Equals(t, "no-store", resp.Header.Get("Cache-Control"))
+		testutil.Equals(t, int64(len(body)), written)
+
+		var res struct {
+			Status   status            `json:"status"`
+			Data     []json.RawMessage `json:"data"`
+			Warnings []string          `json:"warnings"`
+		}
+		testutil.Ok(t, json.Unmarshal(body, &res))
+		testutil.Equals(t, StatusSuccess, res.Status)
+		testutil.Equals(t, 10000, len(res.Data))
+		testutil.Equals(t, []string{"warning"}, res.Warnings)
+	})
+	t.Run("exceeding limit before writing", func(t *testing.T) {
+		var written int64
+		resp, body, err := get(streamedSeries(10000, 1000, &written))
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		var res response
+		testutil.Ok(t, json.Unmarshal(body, &res))
+		testutil.Equals(t, StatusError, res.Status)
+		testutil.Equals(t, ErrorTooLarge, res.ErrorType)
+		testutil.Equals(t, "response exceeds the limit of 1000 bytes", res.Error)
+		testutil.Assert(t, written <= 1000)
+	})
+	t.Run("exceeding limit after writing", func(t *testing.T) {
+		var written int64
+		resp, body, err := get(streamedSeries(100000, 1<<20, &written))
+		// The response is aborted, ending with an error.
+		testutil.NotOk(t, err)
+		testutil.Equals(t, http.StatusOK, resp.StatusCode)
+		testutil.Assert(t, strings.HasSuffix(string(body), "\n"+`{"status":"error","errorType":"too_large","error":"response exceeds the limit of 1048576 bytes"}`+"\n"), string(body[len(body)-200:]))
+		testutil.Assert(t, written <= 1<<20)
+	})
+}
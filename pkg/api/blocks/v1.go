@@ -5,6 +5,7 @@ package v1
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-kit/log"
@@ -14,11 +15,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/logging"
 )
@@ -31,13 +35,22 @@ type BlocksAPI struct {
 	loadedBlocksInfo *BlocksInfo
 	disableCORS      bool
 	bkt              objstore.Bucket
+	// readOnly forbids blocks to be marked and unmarked through the API.
+	readOnly bool
 }
 
 type BlocksInfo struct {
-	Label       string          `json:"label"`
-	Blocks      []metadata.Meta `json:"blocks"`
-	RefreshedAt time.Time       `json:"refreshedAt"`
-	Err         error           `json:"err"`
+	Label         string                               `json:"label"`
+	Blocks        []metadata.Meta                      `json:"blocks"`
+	DeletionMarks map[ulid.ULID]*metadata.DeletionMark `json:"deletionMarks,omitempty"`
+	// NoCompactMarks are the no-compact marks of the blocks, if tracked.
+	NoCompactMarks map[ulid.ULID]*metadata.NoCompactMark `json:"noCompactMarks,omitempty"`
+	// ReadWrite is true if the blocks can be marked and unmarked through the API.
+	ReadWrite    bool               `json:"readWrite"`
+	DeletionMode block.DeletionMode `json:"deletionMode,omitempty"`
+	ObjectLock   *block.ObjectLock  `json:"objectLock,omitempty"`
+	RefreshedAt  time.Time          `json:"refreshedAt"`
+	Err          error              `json:"err"`
 }
 
 type ActionType int32
@@ -59,21 +72,32 @@ func parse(s string) ActionType {
 	}
 }
 
-// NewBlocksAPI creates a simple API to be used by Thanos Block Viewer.
-func NewBlocksAPI(logger log.Logger, disableCORS bool, label string, flagsMap map[string]string, bkt objstore.Bucket) *BlocksAPI {
+// Values of the marked parameter of the blocks endpoint.
+const (
+	markedDeletion  = "deletion"
+	markedNoCompact = "no-compact"
+	markedNone      = "none"
+)
+
+// NewBlocksAPI creates a simple API to be used by Thanos Block Viewer. Blocks can only be marked and unmarked through
+// it if readWrite is true.
+func NewBlocksAPI(logger log.Logger, disableCORS bool, label string, flagsMap map[string]string, bkt objstore.Bucket, readWrite bool) *BlocksAPI {
 	return &BlocksAPI{
 		baseAPI: api.NewBaseAPI(logger, disableCORS, flagsMap),
 		logger:  logger,
 		globalBlocksInfo: &BlocksInfo{
-			Blocks: []metadata.Meta{},
-			Label:  label,
+			Blocks:    []metadata.Meta{},
+			Label:     label,
+			ReadWrite: readWrite,
 		},
 		loadedBlocksInfo: &BlocksInfo{
-			Blocks: []metadata.Meta{},
-			Label:  label,
+			Blocks:    []metadata.Meta{},
+			Label:     label,
+			ReadWrite: readWrite,
 		},
 		disableCORS: disableCORS,
 		bkt:         bkt,
+		readOnly:    !readWrite,
 	}
 }
 
@@ -84,12 +108,39 @@ func (bapi *BlocksAPI) Register(r *route.Router, tracer opentracing.Tracer, logg
 
 	r.Get("/blocks", instr("blocks", bapi.blocks))
 	r.Post("/blocks/mark", instr("blocks_mark", bapi.markBlock))
+	r.Get("/blocks/health", instr("blocks_health", bapi.health))
+}
+
+// defaultStaleIterations is the default number of compaction iterations after which compaction health objects not
+// updated are flagged as stale.
+const defaultStaleIterations = 3
+
+// health returns the compaction health of the compaction groups of the bucket, as reported by the compactor.
+func (bapi *BlocksAPI) health(r *http.Request) (interface{}, []error, *api.ApiError) {
+	staleIterations := defaultStaleIterations
+	if s := r.URL.Query().Get("staleIterations"); s != "" {
+		var err error
+		if staleIterations, err = strconv.Atoi(s); err != nil || staleIterations <= 0 {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("staleIterations %q is not a positive number", s)}
+		}
+	}
+
+	healths, err := compact.ReadHealth(r.Context(), bapi.bkt)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}
+	}
+	return compact.HealthStatus(healths, time.Now(), staleIterations), nil, nil
 }
 
 func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if bapi.readOnly {
+		return nil, nil, &api.ApiError{Typ: api.ErrorForbidden, Err: errors.New("blocks cannot be marked, the API is read-only")}
+	}
+
 	idParam := r.FormValue("id")
 	actionParam := r.FormValue("action")
 	detailParam := r.FormValue("detail")
+	removeParam := r.FormValue("remove")
 
 	if idParam == "" {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("ID cannot be empty")}
@@ -104,14 +155,29 @@ func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("ULID %q is not valid: %v", idParam, err)}
 	}
 
+	remove := false
+	if removeParam != "" {
+		if remove, err = strconv.ParseBool(removeParam); err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("remove %q is not a boolean: %v", removeParam, err)}
+		}
+	}
+
 	actionType := parse(actionParam)
-	switch actionType {
-	case Deletion:
-		err := block.MarkForDeletion(r.Context(), bapi.logger, bapi.bkt, id, detailParam, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
+	switch {
+	case remove && actionType == Deletion:
+		if err := block.RemoveMark(r.Context(), bapi.logger, bapi.bkt, id, metadata.DeletionMarkFilename); err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+	case remove && actionType == NoCompaction:
+		if err := block.RemoveMark(r.Context(), bapi.logger, bapi.bkt, id, metadata.NoCompactMarkFilename); err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+	case actionType == Deletion:
+		err := block.MarkForDeletion(r.Context(), bapi.logger, bapi.bkt, id, metadata.ManualDeletionReason, detailParam, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
 		if err != nil {
 			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 		}
-	case NoCompaction:
+	case actionType == NoCompaction:
 		err := block.MarkForNoCompact(r.Context(), bapi.logger, bapi.bkt, id, metadata.ManualNoCompactReason, detailParam, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
 		if err != nil {
 			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
@@ -123,11 +189,128 @@ func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.Ap
 }
 
 func (bapi *BlocksAPI) blocks(r *http.Request) (interface{}, []error, *api.ApiError) {
+	f, err := parseBlocksFilter(r)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+
 	viewParam := r.URL.Query().Get("view")
 	if viewParam == "loaded" {
-		return bapi.loadedBlocksInfo, nil, nil
+		return f.apply(bapi.loadedBlocksInfo), nil, nil
 	}
-	return bapi.globalBlocksInfo, nil, nil
+	return f.apply(bapi.globalBlocksInfo), nil, nil
+}
+
+// blocksFilter selects the blocks returned by the blocks endpoint. Unset fields select all blocks.
+type blocksFilter struct {
+	// matchers select blocks whose external labels match any of the matcher sets.
+	matchers   [][]*labels.Matcher
+	resolution *int64
+	level      *int
+	marked     string
+}
+
+func parseBlocksFilter(r *http.Request) (*blocksFilter, error) {
+	q := r.URL.Query()
+	f := &blocksFilter{marked: q.Get("marked")}
+	for _, s := range q["match[]"] {
+		ms, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse matchers %q", s)
+		}
+		f.matchers = append(f.matchers, ms)
+	}
+	if s := q.Get("resolution"); s != "" {
+		res, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("resolution %q is not a number of milliseconds: %v", s, err)
+		}
+		f.resolution = &res
+	}
+	if s := q.Get("level"); s != "" {
+		lvl, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.Errorf("compaction level %q is not a number: %v", s, err)
+		}
+		f.level = &lvl
+	}
+	switch f.marked {
+	case "", markedDeletion, markedNoCompact, markedNone:
+	default:
+		return nil, errors.Errorf("marked %q must be one of %s, %s or %s", f.marked, markedDeletion, markedNoCompact, markedNone)
+	}
+	return f, nil
+}
+
+// apply returns the blocks info with the blocks selected by the filter, and only their marks. It returns the blocks
+// info itself if the filter selects all blocks.
+func (f *blocksFilter) apply(info *BlocksInfo) *BlocksInfo {
+	if len(f.matchers) == 0 && f.resolution == nil && f.level == nil && f.marked == "" {
+		return info
+	}
+
+	res := *info
+	res.Blocks = make([]metadata.Meta, 0, len(info.Blocks))
+	res.DeletionMarks = map[ulid.ULID]*metadata.DeletionMark{}
+	res.NoCompactMarks = map[ulid.ULID]*metadata.NoCompactMark{}
+	for _, m := range info.Blocks {
+		if !f.matches(m, info) {
+			continue
+		}
+		res.Blocks = append(res.Blocks, m)
+		if dm, ok := info.DeletionMarks[m.ULID]; ok {
+			res.DeletionMarks[m.ULID] = dm
+		}
+		if ncm, ok := info.NoCompactMarks[m.ULID]; ok {
+			res.NoCompactMarks[m.ULID] = ncm
+		}
+	}
+	return &res
+}
+
+func (f *blocksFilter) matches(m metadata.Meta, info *BlocksInfo) bool {
+	if f.resolution != nil && m.Thanos.Downsample.Resolution != *f.resolution {
+		return false
+	}
+	if f.level != nil && m.Compaction.Level != *f.level {
+		return false
+	}
+
+	_, deletion := info.DeletionMarks[m.ULID]
+	_, noCompact := info.NoCompactMarks[m.ULID]
+	switch f.marked {
+	case markedDeletion:
+		if !deletion {
+			return false
+		}
+	case markedNoCompact:
+		if !noCompact {
+			return false
+		}
+	case markedNone:
+		if deletion || noCompact {
+			return false
+		}
+	}
+
+	if len(f.matchers) == 0 {
+		return true
+	}
+	for _, ms := range f.matchers {
+		if matchesLabels(ms, m.Thanos.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesLabels(ms []*labels.Matcher, lset map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(lset[m.Name]) {
+			return false
+		}
+	}
+	return true
 }
 
 func (b *BlocksInfo) set(blocks []metadata.Meta, err error) {
@@ -148,6 +331,28 @@ func (bapi *BlocksAPI) SetGlobal(blocks []metadata.Meta, err error) {
 	bapi.globalBlocksInfo.set(blocks, err)
 }
 
+// SetGlobalDeletionMarks updates the deletion marks of the global blocks in the API.
+func (bapi *BlocksAPI) SetGlobalDeletionMarks(marks map[ulid.ULID]*metadata.DeletionMark) {
+	bapi.globalBlocksInfo.DeletionMarks = marks
+}
+
+// SetGlobalNoCompactMarks updates the no-compact marks of the global blocks in the API.
+func (bapi *BlocksAPI) SetGlobalNoCompactMarks(marks map[ulid.ULID]*metadata.NoCompactMark) {
+	bapi.globalBlocksInfo.NoCompactMarks = marks
+}
+
+// SetObjectLock updates the object lock configuration of the bucket in the API.
+func (bapi *BlocksAPI) SetObjectLock(lock block.ObjectLock) {
+	bapi.globalBlocksInfo.ObjectLock = &lock
+	bapi.loadedBlocksInfo.ObjectLock = &lock
+}
+
+// SetDeletionMode updates the mode the blocks are removed from the bucket with in the API.
+func (bapi *BlocksAPI) SetDeletionMode(mode block.DeletionMode) {
+	bapi.globalBlocksInfo.DeletionMode = mode
+	bapi.loadedBlocksInfo.DeletionMode = mode
+}
+
 // SetLoaded updates the local blocks' metadata in the API.
 func (bapi *BlocksAPI) SetLoaded(blocks []metadata.Meta, err error) {
 	bapi.loadedBlocksInfo.set(blocks, err)
@@ -4,7 +4,9 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,6 +28,7 @@ import (
 	baseAPI "github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
@@ -166,6 +169,43 @@ func TestMarkBlockEndpoint(t *testing.T) {
 			},
 			errType: baseAPI.ErrorBadData,
 		},
+		// invalid remove
+		{
+			endpoint: api.markBlock,
+			query: url.Values{
+				"id":     []string{b1.String()},
+				"action": []string{"DELETION"},
+				"remove": []string{"maybe"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// missing mark
+		{
+			endpoint: api.markBlock,
+			query: url.Values{
+				"id":     []string{b1.String()},
+				"action": []string{"NO_COMPACTION"},
+				"remove": []string{"true"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.markBlock,
+			query: url.Values{
+				"id":     []string{b1.String()},
+				"action": []string{"NO_COMPACTION"},
+			},
+			response: nil,
+		},
+		{
+			endpoint: api.markBlock,
+			query: url.Values{
+				"id":     []string{b1.String()},
+				"action": []string{"NO_COMPACTION"},
+				"remove": []string{"true"},
+			},
+			response: nil,
+		},
 		{
 			endpoint: api.markBlock,
 			query: url.Values{
@@ -185,4 +225,188 @@ func TestMarkBlockEndpoint(t *testing.T) {
 	file := path.Join(tmpDir, b1.String())
 	_, err = os.Stat(file)
 	testutil.Ok(t, err)
+
+	exists, err := bkt.Exists(ctx, path.Join(b1.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "block was not marked for deletion")
+	exists, err = bkt.Exists(ctx, path.Join(b1.String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "no-compact mark of block was not removed")
+}
+
+func TestMarkBlockEndpoint_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	id := ulid.MustNew(1, nil)
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	api := NewBlocksAPI(log.NewNopLogger(), true, "foo", nil, bkt, false)
+	testutil.Assert(t, !api.globalBlocksInfo.ReadWrite, "blocks info must tell the UI that the API is read-only")
+
+	for _, action := range []string{"DELETION", "NO_COMPACTION"} {
+		testEndpoint(t, endpointTestCase{
+			endpoint: api.markBlock,
+			query: url.Values{
+				"id":     []string{id.String()},
+				"action": []string{action},
+			},
+			errType: baseAPI.ErrorForbidden,
+		}, action, reflect.DeepEqual)
+	}
+
+	exists, err := bkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "block must not be marked for deletion")
+	exists, err = bkt.Exists(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "block must not be marked for no compaction")
+}
+
+func TestBlocksEndpointFilter(t *testing.T) {
+	newMeta := func(id ulid.ULID, lset map[string]string, res int64, lvl int) metadata.Meta {
+		m := metadata.Meta{}
+		m.ULID = id
+		m.Thanos.Labels = lset
+		m.Thanos.Downsample.Resolution = res
+		m.Compaction.Level = lvl
+		return m
+	}
+	b1 := newMeta(ulid.MustNew(1, nil), map[string]string{"tenant": "foo"}, 0, 1)
+	b2 := newMeta(ulid.MustNew(2, nil), map[string]string{"tenant": "foo"}, 300000, 4)
+	b3 := newMeta(ulid.MustNew(3, nil), map[string]string{"tenant": "bar"}, 0, 4)
+	b4 := newMeta(ulid.MustNew(4, nil), map[string]string{"tenant": "baz", "region": "eu"}, 0, 4)
+
+	deletionMark := &metadata.DeletionMark{ID: b3.ULID}
+	noCompactMark := &metadata.NoCompactMark{ID: b4.ULID}
+	api := NewBlocksAPI(log.NewNopLogger(), true, "foo", nil, objstore.NewInMemBucket(), false)
+	api.SetGlobal([]metadata.Meta{b1, b2, b3, b4}, nil)
+	api.SetGlobalDeletionMarks(map[ulid.ULID]*metadata.DeletionMark{b3.ULID: deletionMark})
+	api.SetGlobalNoCompactMarks(map[ulid.ULID]*metadata.NoCompactMark{b4.ULID: noCompactMark})
+
+	blocksInfo := func(blocks ...metadata.Meta) *BlocksInfo {
+		info := &BlocksInfo{
+			Label:          "foo",
+			Blocks:         append([]metadata.Meta{}, blocks...),
+			DeletionMarks:  map[ulid.ULID]*metadata.DeletionMark{},
+			NoCompactMarks: map[ulid.ULID]*metadata.NoCompactMark{},
+			RefreshedAt:    api.globalBlocksInfo.RefreshedAt,
+		}
+		for _, b := range blocks {
+			if b.ULID == b3.ULID {
+				info.DeletionMarks[b3.ULID] = deletionMark
+			}
+			if b.ULID == b4.ULID {
+				info.NoCompactMarks[b4.ULID] = noCompactMark
+			}
+		}
+		return info
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		query    url.Values
+		response interface{}
+		errType  baseAPI.ErrorType
+	}{
+		{
+			name:     "no filter",
+			query:    url.Values{},
+			response: api.globalBlocksInfo,
+		},
+		{
+			name:     "label matchers",
+			query:    url.Values{"match[]": []string{`{tenant="foo"}`, `{region=~"e.*"}`}},
+			response: blocksInfo(b1, b2, b4),
+		},
+		{
+			name:     "resolution and level",
+			query:    url.Values{"resolution": []string{"0"}, "level": []string{"4"}},
+			response: blocksInfo(b3, b4),
+		},
+		{
+			name:     "marked for deletion",
+			query:    url.Values{"marked": []string{"deletion"}},
+			response: blocksInfo(b3),
+		},
+		{
+			name:     "marked for no compaction",
+			query:    url.Values{"marked": []string{"no-compact"}, "match[]": []string{`{tenant!="foo"}`}},
+			response: blocksInfo(b4),
+		},
+		{
+			name:     "not marked",
+			query:    url.Values{"marked": []string{"none"}, "level": []string{"4"}},
+			response: blocksInfo(b2),
+		},
+		{
+			name:    "invalid matchers",
+			query:   url.Values{"match[]": []string{`{tenant=}`}},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			name:    "invalid resolution",
+			query:   url.Values{"resolution": []string{"5m"}},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			name:    "invalid level",
+			query:   url.Values{"level": []string{"high"}},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			name:    "invalid marked",
+			query:   url.Values{"marked": []string{"tombstone"}},
+			errType: baseAPI.ErrorBadData,
+		},
+	} {
+		testEndpoint(t, endpointTestCase{
+			endpoint: api.blocks,
+			query:    tcase.query,
+			response: tcase.response,
+			errType:  tcase.errType,
+		}, tcase.name, reflect.DeepEqual)
+	}
+}
+
+func TestBlocksHealthEndpoint(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	health := compact.GroupHealth{
+		Version:    compact.GroupHealthVersion1,
+		Group:      "0@1",
+		Labels:     map[string]string{"tenant": "foo"},
+		UpdateTime: time.Now().Add(-20 * time.Minute).Unix(),
+		Interval:   300,
+	}
+	b, err := json.Marshal(health)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(context.Background(), compact.HealthPath(health.Group), bytes.NewReader(b)))
+
+	api := NewBlocksAPI(log.NewNopLogger(), true, "foo", nil, bkt, false)
+	for _, tcase := range []struct {
+		name     string
+		query    url.Values
+		response interface{}
+		errType  baseAPI.ErrorType
+	}{
+		{
+			name:     "stale after the default iterations",
+			query:    url.Values{},
+			response: []compact.GroupHealthStatus{{GroupHealth: health, Stale: true}},
+		},
+		{
+			name:     "not stale yet",
+			query:    url.Values{"staleIterations": []string{"5"}},
+			response: []compact.GroupHealthStatus{{GroupHealth: health}},
+		},
+		{
+			name:    "invalid stale iterations",
+			query:   url.Values{"staleIterations": []string{"0"}},
+			errType: baseAPI.ErrorBadData,
+		},
+	} {
+		testEndpoint(t, endpointTestCase{
+			endpoint: api.health,
+			query:    tcase.query,
+			response: tcase.response,
+			errType:  tcase.errType,
+		}, tcase.name, reflect.DeepEqual)
+	}
 }
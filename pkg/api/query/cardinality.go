@@ -0,0 +1,249 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+const (
+	// MetricParam restricts the cardinality analysis to the series of the given metric name.
+	MetricParam = "metric"
+	// TopValuesParam is the number of values with the most series returned per label name by the cardinality API.
+	TopValuesParam = "top_values"
+
+	defaultCardinalityLimit = 10
+)
+
+// CardinalityResult is the cardinality of the series selected by a cardinality API request.
+type CardinalityResult struct {
+	TotalSeries int                    `json:"totalSeries"`
+	LabelNames  []LabelNameCardinality `json:"labelNames"`
+}
+
+// LabelNameCardinality is the cardinality of a label name.
+type LabelNameCardinality struct {
+	Name           string `json:"name"`
+	DistinctValues int    `json:"distinctValues"`
+	Series         int    `json:"series"`
+	// TopValues are the values of the label name with the most series, only if requested.
+	TopValues []LabelValueCardinality `json:"topValues,omitempty"`
+}
+
+// LabelValueCardinality is the number of series with a label value.
+type LabelValueCardinality struct {
+	Value  string `json:"value"`
+	Series int    `json:"series"`
+}
+
+// cardinality returns the label names of the series selected by the match[] and metric parameters, sorted by their
+// number of distinct values, and optionally the values of each label name with the most series. It is computed from
+// the label sets of the series returned by the stores, so the number of series it fetches from them is limited.
+func (qapi *QueryAPI) cardinality(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
+	}
+
+	start, end, err := parseMetadataTimeRange(r, qapi.defaultMetadataTimeRange)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+
+	matcherSets, apiErr := parseCardinalityMatchers(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	limit, apiErr := parseNonNegativeIntParam(r, "limit", defaultCardinalityLimit)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	topValues, apiErr := parseNonNegativeIntParam(r, TopValuesParam, 0)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	enableDedup, apiErr := qapi.parseEnableDedupParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	replicaLabels, apiErr := qapi.parseReplicaLabelsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx := store.NewContextWithStoreTypes(r.Context(), storeTypes)
+	var seriesLimit *query.SeriesLimit
+	if qapi.cardinalityMaxSeries > 0 {
+		// The limit is enforced while the series are fetched, so that the stores stop sending them once it is exceeded.
+		ctx, seriesLimit = query.NewContextWithSeriesLimit(ctx, qapi.cardinalityMaxSeries)
+	}
+
+	tracing.DoInSpan(ctx, "query_gate_ismyturn", func(ctx context.Context) {
+		err = qapi.gate.Start(ctx)
+	})
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+	}
+	defer qapi.gate.Done()
+
+	q, err := qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, false, enablePartialResponse, qapi.enableQueryPushdown, true).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+	}
+	defer runutil.CloseWithLogOnErr(qapi.logger, q, "queryable cardinality")
+
+	var sets []storage.SeriesSet
+	for _, mset := range matcherSets {
+		sets = append(sets, q.Select(false, nil, mset...))
+	}
+
+	stats := newCardinalityStats()
+	set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+	for set.Next() {
+		stats.add(set.At().Labels())
+	}
+	if seriesLimit != nil && seriesLimit.Exceeded() {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf(
+			"the selection has more than %d series, narrow it with the %s or %s parameters", qapi.cardinalityMaxSeries, MatcherParam, MetricParam)}
+	}
+	if set.Err() != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: set.Err()}
+	}
+	return stats.result(limit, topValues), set.Warnings(), nil
+}
+
+// parseCardinalityMatchers returns the matcher sets of the match[] parameters, all series if there are none, restricted
+// to the metric name of the metric parameter, if any.
+func parseCardinalityMatchers(r *http.Request) ([][]*labels.Matcher, *api.ApiError) {
+	var matcherSets [][]*labels.Matcher
+	for _, s := range r.Form[MatcherParam] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+	if len(matcherSets) == 0 {
+		matcherSets = [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+")}}
+	}
+
+	if metric := r.FormValue(MetricParam); metric != "" {
+		for i := range matcherSets {
+			matcherSets[i] = append(matcherSets[i], labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metric))
+		}
+	}
+	return matcherSets, nil
+}
+
+func parseNonNegativeIntParam(r *http.Request, name string, defaultVal int) (int, *api.ApiError) {
+	val := r.FormValue(name)
+	if val == "" {
+		return defaultVal, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid %s parameter %q, it must be a non-negative integer", name, val)}
+	}
+	return i, nil
+}
+
+// cardinalityStats counts the series of each label name and value.
+type cardinalityStats struct {
+	totalSeries int
+	// Number of series of each value of each label name.
+	values map[string]map[string]int
+}
+
+func newCardinalityStats() *cardinalityStats {
+	return &cardinalityStats{values: map[string]map[string]int{}}
+}
+
+func (s *cardinalityStats) add(lset labels.Labels) {
+	s.totalSeries++
+	for _, l := range lset {
+		vals, ok := s.values[l.Name]
+		if !ok {
+			vals = map[string]int{}
+			s.values[l.Name] = vals
+		}
+		vals[l.Value]++
+	}
+}
+
+// result returns the limit label names with the most distinct values, all of them if limit is 0, each with its
+// topValues values with the most series.
+func (s *cardinalityStats) result(limit, topValues int) CardinalityResult {
+	res := CardinalityResult{TotalSeries: s.totalSeries, LabelNames: make([]LabelNameCardinality, 0, len(s.values))}
+	for name, vals := range s.values {
+		lc := LabelNameCardinality{Name: name, DistinctValues: len(vals)}
+		for _, series := range vals {
+			lc.Series += series
+		}
+		res.LabelNames = append(res.LabelNames, lc)
+	}
+	sort.Slice(res.LabelNames, func(i, j int) bool {
+		if res.LabelNames[i].DistinctValues != res.LabelNames[j].DistinctValues {
+			return res.LabelNames[i].DistinctValues > res.LabelNames[j].DistinctValues
+		}
+		return res.LabelNames[i].Name < res.LabelNames[j].Name
+	})
+	if limit > 0 && len(res.LabelNames) > limit {
+		res.LabelNames = res.LabelNames[:limit]
+	}
+
+	if topValues == 0 {
+		return res
+	}
+	for i := range res.LabelNames {
+		vals := s.values[res.LabelNames[i].Name]
+		top := make([]LabelValueCardinality, 0, len(vals))
+		for v, series := range vals {
+			top = append(top, LabelValueCardinality{Value: v, Series: series})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Series != top[j].Series {
+				return top[i].Series > top[j].Series
+			}
+			return top[i].Value < top[j].Value
+		})
+		if len(top) > topValues {
+			top = top[:topValues]
+		}
+		res.LabelNames[i].TopValues = top
+	}
+	return res
+}
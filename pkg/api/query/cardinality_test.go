@@ -0,0 +1,152 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"go.uber.org/atomic"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+// warningStore sends a warning before the series of the store, like the proxy does when a store fails with partial
+// response enabled.
+type warningStore struct {
+	storepb.StoreServer
+}
+
+func (s warningStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	if err := srv.Send(storepb.NewWarnSeriesResponse(errors.New("store unavailable"))); err != nil {
+		return err
+	}
+	return s.StoreServer.Series(r, srv)
+}
+
+// endlessStore sends series until sending one fails, counting the series it sent.
+type endlessStore struct {
+	storepb.StoreServer
+	sent *atomic.Int64
+}
+
+func (s endlessStore) Series(_ *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	for i := 0; ; i++ {
+		lset := labelpb.ZLabelsFromPromLabels(labels.FromStrings("__name__", "up", "instance", strconv.Itoa(i)))
+		if err := srv.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: lset})); err != nil {
+			return err
+		}
+		s.sent.Inc()
+	}
+}
+
+func TestQueryAPI_Cardinality(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "http_requests_total", "code", "200", "instance", "a"),
+		labels.FromStrings("__name__", "http_requests_total", "code", "500", "instance", "a"),
+		labels.FromStrings("__name__", "http_requests_total", "code", "200", "instance", "b"),
+		labels.FromStrings("__name__", "up", "instance", "a"),
+		labels.FromStrings("__name__", "up", "instance", "b"),
+		labels.FromStrings("__name__", "up", "instance", "c"),
+	} {
+		_, err := app.Append(0, lset, 0, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	tsdbStore := store.NewTSDBStore(nil, db, component.Query, nil)
+	api := &QueryAPI{
+		baseAPI:              &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate:      query.NewQueryableCreator(nil, nil, tsdbStore, 2, 100*time.Second, nil, false),
+		gate:                 gate.New(nil, 4),
+		cardinalityMaxSeries: 10,
+	}
+
+	request := func(params url.Values) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/api/v1/status/cardinality?"+params.Encode(), nil)
+		testutil.Ok(t, err)
+		return r
+	}
+
+	t.Run("all series", func(t *testing.T) {
+		res, warns, apiErr := api.cardinality(request(url.Values{"top_values": []string{"2"}}))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 0, len(warns))
+		testutil.Equals(t, CardinalityResult{
+			TotalSeries: 6,
+			LabelNames: []LabelNameCardinality{
+				{Name: "instance", DistinctValues: 3, Series: 6, TopValues: []LabelValueCardinality{{Value: "a", Series: 3}, {Value: "b", Series: 2}}},
+				{Name: "__name__", DistinctValues: 2, Series: 6, TopValues: []LabelValueCardinality{{Value: "http_requests_total", Series: 3}, {Value: "up", Series: 3}}},
+				{Name: "code", DistinctValues: 2, Series: 3, TopValues: []LabelValueCardinality{{Value: "200", Series: 2}, {Value: "500", Series: 1}}},
+			},
+		}, res)
+	})
+	t.Run("single metric", func(t *testing.T) {
+		res, _, apiErr := api.cardinality(request(url.Values{"metric": []string{"up"}, "limit": []string{"1"}}))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, CardinalityResult{
+			TotalSeries: 3,
+			LabelNames:  []LabelNameCardinality{{Name: "instance", DistinctValues: 3, Series: 3}},
+		}, res)
+	})
+	t.Run("match", func(t *testing.T) {
+		res, _, apiErr := api.cardinality(request(url.Values{"match[]": []string{`{code="500"}`, `up{instance="c"}`}}))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 2, res.(CardinalityResult).TotalSeries)
+	})
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, params := range []url.Values{
+			{"top_values": []string{"-1"}},
+			{"limit": []string{"many"}},
+			{"match[]": []string{"up{"}},
+		} {
+			_, _, apiErr := api.cardinality(request(params))
+			testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error for %v", params)
+		}
+	})
+	t.Run("too many series", func(t *testing.T) {
+		api := *api
+		api.cardinalityMaxSeries = 5
+		_, _, apiErr := api.cardinality(request(url.Values{}))
+		testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error, got %v", apiErr)
+
+		_, _, apiErr = api.cardinality(request(url.Values{"metric": []string{"up"}}))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+
+		// The store stops sending series once the limit is exceeded.
+		sent := atomic.NewInt64(0)
+		api.queryableCreate = query.NewQueryableCreator(nil, nil, endlessStore{StoreServer: tsdbStore, sent: sent}, 2, 100*time.Second, nil, false)
+		_, _, apiErr = api.cardinality(request(url.Values{"partial_response": []string{"true"}}))
+		testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error, got %v", apiErr)
+		testutil.Equals(t, int64(5), sent.Load())
+	})
+	t.Run("partial response", func(t *testing.T) {
+		api := *api
+		api.queryableCreate = query.NewQueryableCreator(nil, nil, warningStore{tsdbStore}, 2, 100*time.Second, nil, false)
+
+		res, warns, apiErr := api.cardinality(request(url.Values{"partial_response": []string{"true"}}))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 6, res.(CardinalityResult).TotalSeries)
+		testutil.Equals(t, 1, len(warns))
+	})
+}
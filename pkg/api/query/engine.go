@@ -0,0 +1,108 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/api"
+)
+
+// PrometheusEngine is the name of the Prometheus PromQL engine, the only engine of the querier.
+const PrometheusEngine = "prometheus"
+
+// Capabilities of PromQL engines which functions of later Prometheus versions depend on.
+const (
+	ExperimentalFunctionsCapability = "experimental functions"
+	NativeHistogramsCapability      = "native histograms"
+)
+
+// laterFunctions are the PromQL functions and aggregations of later Prometheus versions, by the capability the engine
+// needs to evaluate them.
+var laterFunctions = map[string]string{
+	"sort_by_label":                ExperimentalFunctionsCapability,
+	"sort_by_label_desc":           ExperimentalFunctionsCapability,
+	"mad_over_time":                ExperimentalFunctionsCapability,
+	"double_exponential_smoothing": ExperimentalFunctionsCapability,
+	"limitk":                       ExperimentalFunctionsCapability,
+	"limit_ratio":                  ExperimentalFunctionsCapability,
+	"info":                         ExperimentalFunctionsCapability,
+	"histogram_count":              NativeHistogramsCapability,
+	"histogram_sum":                NativeHistogramsCapability,
+	"histogram_avg":                NativeHistogramsCapability,
+	"histogram_fraction":           NativeHistogramsCapability,
+	"histogram_stddev":             NativeHistogramsCapability,
+	"histogram_stdvar":             NativeHistogramsCapability,
+}
+
+// EngineFeatures are the optional PromQL features of an engine.
+type EngineFeatures struct {
+	NegativeOffset        bool `json:"negativeOffset"`
+	AtModifier            bool `json:"atModifier"`
+	ExperimentalFunctions bool `json:"experimentalFunctions"`
+	NativeHistograms      bool `json:"nativeHistograms"`
+}
+
+// EngineStatus describes a PromQL engine of the querier.
+type EngineStatus struct {
+	Name     string         `json:"name"`
+	Default  bool           `json:"default"`
+	Features EngineFeatures `json:"features"`
+	// Functions are the names of the functions the engine evaluates.
+	Functions []string `json:"functions"`
+}
+
+// engineStatus returns the PromQL engines of the querier with their features, so that clients can tell which queries
+// they evaluate.
+func (qapi *QueryAPI) engineStatus(_ *http.Request) (interface{}, []error, *api.ApiError) {
+	functions := make([]string, 0, len(parser.Functions))
+	for name := range parser.Functions {
+		functions = append(functions, name)
+	}
+	sort.Strings(functions)
+
+	return []EngineStatus{{
+		Name:      PrometheusEngine,
+		Default:   true,
+		Features:  qapi.engineFeatures,
+		Functions: functions,
+	}}, nil, nil
+}
+
+// checkEngineCapabilities returns an error naming the missing capability if the query calls a function of a later
+// Prometheus version the engine does not support, instead of the parser failing on an unknown function.
+func checkEngineCapabilities(query string, features EngineFeatures) *api.ApiError {
+	var (
+		l          = parser.Lex(query)
+		prev, item parser.Item
+	)
+	for {
+		l.NextItem(&item)
+		if item.Typ == parser.EOF || item.Typ == parser.ERROR {
+			return nil
+		}
+		if item.Typ == parser.LEFT_PAREN && prev.Typ == parser.IDENTIFIER {
+			if _, ok := parser.Functions[prev.Val]; !ok {
+				if capability, ok := laterFunctions[prev.Val]; ok && !features.supports(capability) {
+					return &api.ApiError{Typ: api.ErrorBadData, Err: fmt.Errorf("function %q requires the %s capability, which the %s PromQL engine does not support, see /api/v1/status/engine", prev.Val, capability, PrometheusEngine)}
+				}
+			}
+		}
+		prev = item
+	}
+}
+
+func (f EngineFeatures) supports(capability string) bool {
+	switch capability {
+	case ExperimentalFunctionsCapability:
+		return f.ExperimentalFunctions
+	case NativeHistogramsCapability:
+		return f.NativeHistograms
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestEngineStatus(t *testing.T) {
+	api := &QueryAPI{engineFeatures: EngineFeatures{NegativeOffset: true, AtModifier: true}}
+
+	res, _, apiErr := api.engineStatus(nil)
+	testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+	engines := res.([]EngineStatus)
+	testutil.Equals(t, 1, len(engines))
+	testutil.Equals(t, PrometheusEngine, engines[0].Name)
+	testutil.Assert(t, engines[0].Default, "the only engine is the default one")
+	testutil.Equals(t, EngineFeatures{NegativeOffset: true, AtModifier: true}, engines[0].Features)
+	testutil.Assert(t, sort.StringsAreSorted(engines[0].Functions), "functions are not sorted")
+	i := sort.SearchStrings(engines[0].Functions, "rate")
+	testutil.Assert(t, i < len(engines[0].Functions) && engines[0].Functions[i] == "rate", "rate is not listed")
+}
+
+func TestCheckEngineCapabilities(t *testing.T) {
+	for _, tcase := range []struct {
+		query       string
+		features    EngineFeatures
+		expectedErr string
+	}{
+		{query: `sum by (job) (rate(up[5m]))`},
+		{query: `up{sort_by_label="a"}`},
+		// Unknown functions are left to the parser.
+		{query: `not_a_function(up)`},
+		{query: `sum(`},
+		{
+			query:       `sort_by_label(up, "instance")`,
+			expectedErr: `function "sort_by_label" requires the experimental functions capability, which the prometheus PromQL engine does not support, see /api/v1/status/engine`,
+		},
+		{
+			query:       `sum(limitk(2, up))`,
+			expectedErr: `function "limitk" requires the experimental functions capability, which the prometheus PromQL engine does not support, see /api/v1/status/engine`,
+		},
+		{
+			query:       `histogram_count(rate(http_request_duration_seconds[5m]))`,
+			expectedErr: `function "histogram_count" requires the native histograms capability, which the prometheus PromQL engine does not support, see /api/v1/status/engine`,
+		},
+		{
+			query:    `histogram_count(rate(http_request_duration_seconds[5m]))`,
+			features: EngineFeatures{NativeHistograms: true},
+		},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			apiErr := checkEngineCapabilities(tcase.query, tcase.features)
+			if tcase.expectedErr == "" {
+				testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+				return
+			}
+			testutil.Assert(t, apiErr != nil, "expected error")
+			testutil.Equals(t, baseAPI.ErrorBadData, apiErr.Typ)
+			testutil.Equals(t, tcase.expectedErr, apiErr.Err.Error())
+		})
+	}
+}
+
+func TestQueryAPI_RejectsUnsupportedFunctions(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	qe := promql.NewEngine(promql.EngineOpts{MaxSamples: 10000, Timeout: 100 * time.Second})
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, 100*time.Second, nil, false),
+		queryEngine:     func(int64) *promql.Engine { return qe },
+		gate:            gate.New(nil, 4),
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/api/v1/query?"+url.Values{"query": []string{`sort_by_label(up, "job")`}}.Encode(), nil)
+	testutil.Ok(t, err)
+	_, _, apiErr := api.query(r)
+	testutil.Assert(t, apiErr != nil, "expected error")
+	testutil.Equals(t, `function "sort_by_label" requires the experimental functions capability, which the prometheus PromQL engine does not support, see /api/v1/status/engine`, apiErr.Err.Error())
+
+	r, err = http.NewRequest(http.MethodGet, "http://example.com/api/v1/query_range?"+url.Values{
+		"query": []string{`histogram_sum(up)`},
+		"start": []string{"0"},
+		"end":   []string{"60"},
+		"step":  []string{"15"},
+	}.Encode(), nil)
+	testutil.Ok(t, err)
+	_, _, apiErr = api.queryRange(r)
+	testutil.Assert(t, apiErr != nil, "expected error")
+	testutil.Equals(t, `function "histogram_sum" requires the native histograms capability, which the prometheus PromQL engine does not support, see /api/v1/status/engine`, apiErr.Err.Error())
+}
@@ -0,0 +1,221 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/server/http/middleware"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// defaultFederateLookbackDelta is the default maximum age of the federated samples, the PromQL default lookback delta.
+const defaultFederateLookbackDelta = 5 * time.Minute
+
+// FederateOptions configure the Prometheus-compatible federation endpoint.
+type FederateOptions struct {
+	// Offset is the duration before now at which the latest samples are selected, so that samples still being
+	// ingested by the stores are not missed.
+	Offset time.Duration
+	// LookbackDelta is the maximum age of the latest sample of a series for it to be federated.
+	LookbackDelta time.Duration
+	// MaxSeries is the maximum number of series of a response, 0 means no limit.
+	MaxSeries int
+}
+
+// RegisterFederate registers the Prometheus-compatible /federate endpoint
+// https://prometheus.io/docs/prometheus/latest/federation/ on the router.
+func (qapi *QueryAPI) RegisterFederate(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware, logMiddleware *logging.HTTPServerMiddleware, opts FederateOptions) {
+	// Federation responses are in the text exposition format, so they are not wrapped like the JSON APIs.
+	r.Get("/federate", tracing.HTTPMiddleware(tracer, "federate", logger,
+		ins.NewHandler("federate",
+			middleware.RequestID(
+				logMiddleware.HTTPMiddleware("federate", qapi.federate(opts)),
+			),
+		),
+	))
+}
+
+// federate returns a handler serving the latest samples of the series selected by the match[] URL parameters in the
+// exposition format negotiated with the client, like Prometheus. The labels of the series include the external labels
+// of their stores. Like the query APIs, it honors the Thanos-specific dedup, replica labels, max_source_resolution,
+// partial_response and store type URL parameters.
+func (qapi *QueryAPI) federate(opts FederateOptions) http.HandlerFunc {
+	if opts.LookbackDelta <= 0 {
+		opts.LookbackDelta = defaultFederateLookbackDelta
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing form values: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var matcherSets [][]*labels.Matcher
+		for _, s := range r.Form[MatcherParam] {
+			matchers, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			matcherSets = append(matcherSets, matchers)
+		}
+
+		queryable, apiErr := qapi.requestQueryable(r)
+		if apiErr != nil {
+			http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+			return
+		}
+		storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+		if apiErr != nil {
+			http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx := store.NewContextWithStoreTypes(r.Context(), storeTypes)
+
+		var err error
+		tracing.DoInSpan(ctx, "query_gate_ismyturn", func(ctx context.Context) {
+			err = qapi.gate.Start(ctx)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer qapi.gate.Done()
+
+		vec, code, err := qapi.federateSamples(ctx, queryable, matcherSets, opts)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		if err := encodeFederation(expfmt.NewEncoder(w, format), vec); err != nil {
+			level.Error(qapi.logger).Log("msg", "federation failed", "err", err)
+		}
+	}
+}
+
+// federateSamples returns the latest samples of the selected series, sorted by metric name, or an error and the status
+// code of the response.
+func (qapi *QueryAPI) federateSamples(ctx context.Context, queryable storage.Queryable, matcherSets [][]*labels.Matcher, opts FederateOptions) (promql.Vector, int, error) {
+	var (
+		maxt = timestamp.FromTime(qapi.baseAPI.Now().Add(-opts.Offset))
+		mint = maxt - opts.LookbackDelta.Milliseconds()
+	)
+	q, err := queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer runutil.CloseWithLogOnErr(qapi.logger, q, "queryable federate")
+
+	hints := &storage.SelectHints{Start: mint, End: maxt}
+	var sets []storage.SeriesSet
+	for _, mset := range matcherSets {
+		sets = append(sets, q.Select(true, hints, mset...))
+	}
+
+	var (
+		vec promql.Vector
+		set = storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+		it  = storage.NewBuffer(opts.LookbackDelta.Milliseconds())
+	)
+	for set.Next() {
+		s := set.At()
+		it.Reset(s.Iterator())
+
+		var (
+			t  int64
+			v  float64
+			ok = it.Seek(maxt)
+		)
+		if ok {
+			t, v = it.At()
+		}
+		// Stores may return samples after the end of the selected time range.
+		if !ok || t > maxt {
+			if t, v, ok = it.PeekBack(1); !ok {
+				continue
+			}
+		}
+		// The exposition formats do not support stale markers, so drop them.
+		if value.IsStaleNaN(v) {
+			continue
+		}
+		if opts.MaxSeries > 0 && len(vec) >= opts.MaxSeries {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("federation exceeded the limit of %d series, use more selective match[] parameters", opts.MaxSeries)
+		}
+		vec = append(vec, promql.Sample{Metric: s.Labels(), Point: promql.Point{T: t, V: v}})
+	}
+	if ws := set.Warnings(); len(ws) > 0 {
+		level.Debug(qapi.logger).Log("msg", "federation select returned warnings", "warnings", fmt.Sprint(ws))
+	}
+	if err := set.Err(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// The series are sorted by labels already, so that the series of each metric name stay sorted.
+	sort.SliceStable(vec, func(i, j int) bool {
+		return vec[i].Metric.Get(labels.MetricName) < vec[j].Metric.Get(labels.MetricName)
+	})
+	return vec, http.StatusOK, nil
+}
+
+// encodeFederation encodes the samples sorted by metric name as untyped metric families, one per metric name.
+// Series without metric name can't be exposed, so they are skipped.
+func encodeFederation(enc expfmt.Encoder, vec promql.Vector) error {
+	var fam *dto.MetricFamily
+	for _, s := range vec {
+		name := s.Metric.Get(labels.MetricName)
+		if name == "" {
+			continue
+		}
+		if fam == nil || fam.GetName() != name {
+			if fam != nil {
+				if err := enc.Encode(fam); err != nil {
+					return err
+				}
+			}
+			fam = &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum()}
+		}
+
+		m := &dto.Metric{
+			Untyped:     &dto.Untyped{Value: proto.Float64(s.V)},
+			TimestampMs: proto.Int64(s.T),
+		}
+		for _, l := range s.Metric {
+			if l.Name == labels.MetricName || l.Value == "" {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+		fam.Metric = append(fam.Metric, m)
+	}
+	if fam == nil {
+		return nil
+	}
+	return enc.Encode(fam)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/value"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestFederateEndpoint(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "a"),
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "b"),
+		labels.FromStrings("__name__", "go_goroutines", "job", "api", "replica", "a"),
+		labels.FromStrings("__name__", "stale", "job", "api", "replica", "a"),
+	} {
+		for i := int64(0); i < 10; i++ {
+			v := float64(i)
+			if lset.Get("__name__") == "stale" && i == 9 {
+				v = math.Float64frombits(value.StaleNaN)
+			}
+			_, err := app.Append(0, lset, i*60000, v)
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: func() time.Time { return time.Unix(600, 0) }},
+		logger:          log.NewNopLogger(),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, labels.FromStrings("cluster", "eu")), 2, 100*time.Second, nil, false),
+		gate:            gate.New(nil, 4),
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		opts   FederateOptions
+		params url.Values
+
+		exp     string
+		expCode int
+	}{
+		{
+			name:   "dedup",
+			params: url.Values{MatcherParam: []string{`{job="api"}`}, ReplicaLabelsParam: []string{"replica"}},
+			exp: `# TYPE go_goroutines untyped
+go_goroutines{cluster="eu",job="api"} 9 540000
+# TYPE up untyped
+up{cluster="eu",job="api"} 9 540000
+`,
+		},
+		{
+			name:   "no dedup",
+			params: url.Values{MatcherParam: []string{"up"}, ReplicaLabelsParam: []string{"replica"}, DedupParam: []string{"false"}},
+			exp: `# TYPE up untyped
+up{cluster="eu",job="api",replica="a"} 9 540000
+up{cluster="eu",job="api",replica="b"} 9 540000
+`,
+		},
+		{
+			name:   "multiple matchers",
+			params: url.Values{MatcherParam: []string{"up", "go_goroutines"}, ReplicaLabelsParam: []string{"replica"}},
+			exp: `# TYPE go_goroutines untyped
+go_goroutines{cluster="eu",job="api"} 9 540000
+# TYPE up untyped
+up{cluster="eu",job="api"} 9 540000
+`,
+		},
+		{
+			name:   "offset",
+			opts:   FederateOptions{Offset: 90 * time.Second},
+			params: url.Values{MatcherParam: []string{"up"}, ReplicaLabelsParam: []string{"replica"}},
+			exp: `# TYPE up untyped
+up{cluster="eu",job="api"} 8 480000
+`,
+		},
+		{
+			name:   "offset beyond lookback delta",
+			opts:   FederateOptions{Offset: time.Hour, LookbackDelta: time.Minute},
+			params: url.Values{MatcherParam: []string{"up"}},
+		},
+		{
+			name:   "series limit",
+			opts:   FederateOptions{MaxSeries: 2},
+			params: url.Values{MatcherParam: []string{"up"}, ReplicaLabelsParam: []string{"replica"}},
+			exp: `# TYPE up untyped
+up{cluster="eu",job="api"} 9 540000
+`,
+		},
+		{
+			name:    "series limit exceeded",
+			opts:    FederateOptions{MaxSeries: 2},
+			params:  url.Values{MatcherParam: []string{`{job="api"}`}, DedupParam: []string{"false"}},
+			expCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "invalid matcher",
+			params:  url.Values{MatcherParam: []string{`up{`}},
+			expCode: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/federate?"+tcase.params.Encode(), nil)
+			rec := httptest.NewRecorder()
+			api.federate(tcase.opts)(rec, req)
+
+			if tcase.expCode != 0 {
+				testutil.Equals(t, tcase.expCode, rec.Code)
+				return
+			}
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+			testutil.Equals(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+			testutil.Equals(t, tcase.exp, rec.Body.String())
+
+			// The response must be parsable by Prometheus.
+			p := textparse.NewPromParser(rec.Body.Bytes())
+			for {
+				et, err := p.Next()
+				if err == io.EOF {
+					break
+				}
+				testutil.Ok(t, err)
+				if et != textparse.EntrySeries {
+					continue
+				}
+				_, ts, _ := p.Series()
+				testutil.Assert(t, ts != nil, "expected timestamp")
+				var lset labels.Labels
+				p.Metric(&lset)
+				testutil.Equals(t, "eu", lset.Get("cluster"))
+			}
+		})
+	}
+}
@@ -7,26 +7,32 @@ import (
 	"context"
 	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/thanos/pkg/api/query/querypb"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCAPI struct {
 	now                         func() time.Time
 	replicaLabels               []string
+	tenantReplicaLabels         *TenantReplicaLabels
 	queryableCreate             query.QueryableCreator
 	queryEngine                 func(int64) *promql.Engine
 	defaultMaxResolutionSeconds time.Duration
 }
 
-func NewGRPCAPI(now func() time.Time, replicaLabels []string, creator query.QueryableCreator, queryEngine func(int64) *promql.Engine, defaultMaxResolutionSeconds time.Duration) *GRPCAPI {
+func NewGRPCAPI(now func() time.Time, replicaLabels []string, tenantReplicaLabels *TenantReplicaLabels, creator query.QueryableCreator, queryEngine func(int64) *promql.Engine, defaultMaxResolutionSeconds time.Duration) *GRPCAPI {
 	return &GRPCAPI{
 		now:                         now,
 		replicaLabels:               replicaLabels,
+		tenantReplicaLabels:         tenantReplicaLabels,
 		queryableCreate:             creator,
 		queryEngine:                 queryEngine,
 		defaultMaxResolutionSeconds: defaultMaxResolutionSeconds,
@@ -55,98 +61,74 @@ func (g *GRPCAPI) Query(request *querypb.QueryRequest, server querypb.Query_Quer
 		defer cancel()
 	}
 
-	maxResolution := request.MaxResolutionSeconds
-	if request.MaxResolutionSeconds == 0 {
-		maxResolution = g.defaultMaxResolutionSeconds.Milliseconds() / 1000
-	}
-
 	storeMatchers, err := querypb.StoreMatchersToLabelMatchers(request.StoreMatchers)
 	if err != nil {
-		return err
-	}
-
-	replicaLabels := g.replicaLabels
-	if len(request.ReplicaLabels) != 0 {
-		replicaLabels = request.ReplicaLabels
-	}
-	qe := g.queryEngine(request.MaxResolutionSeconds)
-	queryable := g.queryableCreate(
-		request.EnableDedup,
-		replicaLabels,
-		storeMatchers,
-		maxResolution,
-		request.EnablePartialResponse,
-		request.EnableQueryPushdown,
-		false,
-	)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	maxResolution := g.maxResolutionMillis(request.MaxResolutionSeconds)
+	qe := g.queryEngine(maxResolution)
+	queryable := g.queryable(ctx, request.EnableDedup, request.ReplicaLabels, storeMatchers, maxResolution, request.EnablePartialResponse, request.EnableQueryPushdown)
 	qry, err := qe.NewInstantQuery(queryable, &promql.QueryOpts{}, request.Query, ts)
 	if err != nil {
-		return err
+		return status.Error(codes.InvalidArgument, err.Error())
 	}
 	defer qry.Close()
 
 	result := qry.Exec(ctx)
-	if err := server.Send(querypb.NewQueryWarningsResponse(result.Warnings)); err != nil {
-		return nil
+	if result.Err != nil {
+		return queryError(result.Err)
+	}
+	if len(result.Warnings) > 0 {
+		if err := server.Send(querypb.NewQueryWarningsResponse(result.Warnings)); err != nil {
+			return err
+		}
 	}
 
-	switch vector := result.Value.(type) {
+	send := func(series *prompb.TimeSeries) error { return server.Send(querypb.NewQueryResponse(series)) }
+	switch value := result.Value.(type) {
 	case promql.Scalar:
 		series := &prompb.TimeSeries{
-			Samples: []prompb.Sample{{Value: vector.V, Timestamp: vector.T}},
+			Samples: []prompb.Sample{{Value: value.V, Timestamp: value.T}},
 		}
-		if err := server.Send(querypb.NewQueryResponse(series)); err != nil {
+		if err := send(series); err != nil {
 			return err
 		}
 	case promql.Vector:
-		for _, sample := range vector {
+		for _, sample := range value {
 			series := &prompb.TimeSeries{
 				Labels:  labelpb.ZLabelsFromPromLabels(sample.Metric),
 				Samples: prompb.SamplesFromPromqlPoints([]promql.Point{sample.Point}),
 			}
-			if err := server.Send(querypb.NewQueryResponse(series)); err != nil {
+			if err := send(series); err != nil {
 				return err
 			}
 		}
-
-		return nil
+	case promql.Matrix:
+		if err := sendMatrix(value, send); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return server.Send(querypb.NewQueryStatsResponse(qry.Stats().Samples))
 }
 
 func (g *GRPCAPI) QueryRange(request *querypb.QueryRangeRequest, srv querypb.Query_QueryRangeServer) error {
 	ctx := srv.Context()
 	if request.TimeoutSeconds != 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(request.TimeoutSeconds))
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(request.TimeoutSeconds)*time.Second)
 		defer cancel()
 	}
 
-	maxResolution := request.MaxResolutionSeconds
-	if request.MaxResolutionSeconds == 0 {
-		maxResolution = g.defaultMaxResolutionSeconds.Milliseconds() / 1000
-	}
-
 	storeMatchers, err := querypb.StoreMatchersToLabelMatchers(request.StoreMatchers)
 	if err != nil {
-		return err
+		return status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	replicaLabels := g.replicaLabels
-	if len(request.ReplicaLabels) != 0 {
-		replicaLabels = request.ReplicaLabels
-	}
-	qe := g.queryEngine(request.MaxResolutionSeconds)
-	queryable := g.queryableCreate(
-		request.EnableDedup,
-		replicaLabels,
-		storeMatchers,
-		maxResolution,
-		request.EnablePartialResponse,
-		request.EnableQueryPushdown,
-		false,
-	)
+	maxResolution := g.maxResolutionMillis(request.MaxResolutionSeconds)
+	qe := g.queryEngine(maxResolution)
+	queryable := g.queryable(ctx, request.EnableDedup, request.ReplicaLabels, storeMatchers, maxResolution, request.EnablePartialResponse, request.EnableQueryPushdown)
 
 	startTime := time.Unix(request.StartTimeSeconds, 0)
 	endTime := time.Unix(request.EndTimeSeconds, 0)
@@ -154,29 +136,74 @@ func (g *GRPCAPI) QueryRange(request *querypb.QueryRangeRequest, srv querypb.Que
 
 	qry, err := qe.NewRangeQuery(queryable, &promql.QueryOpts{}, request.Query, startTime, endTime, interval)
 	if err != nil {
-		return err
+		return status.Error(codes.InvalidArgument, err.Error())
 	}
 	defer qry.Close()
 
 	result := qry.Exec(ctx)
-	if err := srv.Send(querypb.NewQueryRangeWarningsResponse(result.Warnings)); err != nil {
-		return err
+	if result.Err != nil {
+		return queryError(result.Err)
+	}
+	if len(result.Warnings) > 0 {
+		if err := srv.Send(querypb.NewQueryRangeWarningsResponse(result.Warnings)); err != nil {
+			return err
+		}
 	}
 
-	switch matrix := result.Value.(type) {
-	case promql.Matrix:
-		for _, series := range matrix {
-			series := &prompb.TimeSeries{
-				Labels:  labelpb.ZLabelsFromPromLabels(series.Metric),
-				Samples: prompb.SamplesFromPromqlPoints(series.Points),
-			}
-			if err := srv.Send(querypb.NewQueryRangeResponse(series)); err != nil {
-				return err
-			}
+	if matrix, ok := result.Value.(promql.Matrix); ok {
+		if err := sendMatrix(matrix, func(series *prompb.TimeSeries) error {
+			return srv.Send(querypb.NewQueryRangeResponse(series))
+		}); err != nil {
+			return err
 		}
+	}
 
-		return nil
+	return srv.Send(querypb.NewQueryRangeStatsResponse(qry.Stats().Samples))
+}
+
+// maxResolutionMillis returns the max source resolution in milliseconds of the request with the given one in seconds,
+// or the default one if it is not set.
+func (g *GRPCAPI) maxResolutionMillis(maxResolutionSeconds int64) int64 {
+	if maxResolutionSeconds == 0 {
+		return g.defaultMaxResolutionSeconds.Milliseconds()
 	}
+	return maxResolutionSeconds * 1000
+}
 
+// queryable returns the queryable of a request, deduplicating by the replica labels of the tenant of the request, or
+// else of the API, unless the request has some.
+func (g *GRPCAPI) queryable(ctx context.Context, dedup bool, replicaLabels []string, storeMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, queryPushdown bool) storage.Queryable {
+	if len(replicaLabels) == 0 {
+		replicaLabels = g.replicaLabels
+		if tenantLabels, ok := g.tenantReplicaLabels.grpcReplicaLabels(ctx); ok {
+			replicaLabels = tenantLabels
+		}
+	}
+	return g.queryableCreate(dedup, replicaLabels, storeMatchers, maxResolutionMillis, false, partialResponse, queryPushdown, false)
+}
+
+func sendMatrix(matrix promql.Matrix, send func(*prompb.TimeSeries) error) error {
+	for _, series := range matrix {
+		series := &prompb.TimeSeries{
+			Labels:  labelpb.ZLabelsFromPromLabels(series.Metric),
+			Samples: prompb.SamplesFromPromqlPoints(series.Points),
+		}
+		if err := send(series); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// queryError returns the gRPC error of a query which failed with the given PromQL engine error.
+func queryError(err error) error {
+	switch err.(type) {
+	case promql.ErrQueryCanceled:
+		return status.Error(codes.Canceled, err.Error())
+	case promql.ErrQueryTimeout:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case promql.ErrTooManySamples:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,198 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/api/query/querypb"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+type grpcQueryResult struct {
+	series   []*prompb.TimeSeries
+	warnings []string
+	stats    *querypb.QueryStats
+}
+
+// newGRPCQueryClient returns a client of the query server of the API, served over a local listener.
+func newGRPCQueryClient(t *testing.T, api *GRPCAPI) querypb.QueryClient {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	srv := grpc.NewServer()
+	RegisterQueryServer(api)(srv)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, conn.Close()) })
+	return querypb.NewQueryClient(conn)
+}
+
+func TestGRPCAPI(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lbls := range []labels.Labels{
+		labels.FromStrings(labels.MetricName, "a", "foo", "1", "replica", "x"),
+		labels.FromStrings(labels.MetricName, "a", "foo", "1", "replica", "y"),
+		labels.FromStrings(labels.MetricName, "a", "foo", "2", "replica", "x"),
+	} {
+		for i := int64(0); i < 10; i++ {
+			_, err := app.Append(0, lbls, i*60000, float64(i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	newClient := func(maxSamples int) querypb.QueryClient {
+		qe := promql.NewEngine(promql.EngineOpts{MaxSamples: maxSamples, Timeout: 100 * time.Second})
+		creator := query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, 100*time.Second, nil, false)
+		return newGRPCQueryClient(t, NewGRPCAPI(
+			func() time.Time { return time.Unix(300, 0) },
+			[]string{"replica"},
+			nil,
+			creator,
+			func(int64) *promql.Engine { return qe },
+			0,
+		))
+	}
+	client := newClient(10000)
+	ctx := context.Background()
+
+	t.Run("instant vector", func(t *testing.T) {
+		res, err := queryGRPC(ctx, client, &querypb.QueryRequest{Query: "a", EnableDedup: true})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []*prompb.TimeSeries{
+			{
+				Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "a", "foo", "1")),
+				Samples: []prompb.Sample{{Value: 5, Timestamp: 300000}},
+			},
+			{
+				Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "a", "foo", "2")),
+				Samples: []prompb.Sample{{Value: 5, Timestamp: 300000}},
+			},
+		}, res.series)
+		testutil.Equals(t, 0, len(res.warnings))
+		testutil.Equals(t, &querypb.QueryStats{SamplesTotal: 2, PeakSamples: 2}, res.stats)
+
+		// The replica labels of the request override the ones of the API.
+		res, err = queryGRPC(ctx, client, &querypb.QueryRequest{Query: "a", TimeSeconds: 60, EnableDedup: true, ReplicaLabels: []string{"foo"}})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 2, len(res.series))
+		testutil.Equals(t, []prompb.Sample{{Value: 1, Timestamp: 60000}}, res.series[0].Samples)
+	})
+	t.Run("instant matrix", func(t *testing.T) {
+		res, err := queryGRPC(ctx, client, &querypb.QueryRequest{Query: `a{foo="2"}[2m]`})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(res.series))
+		testutil.Equals(t, []prompb.Sample{{Value: 3, Timestamp: 180000}, {Value: 4, Timestamp: 240000}, {Value: 5, Timestamp: 300000}}, res.series[0].Samples)
+	})
+	t.Run("instant scalar", func(t *testing.T) {
+		res, err := queryGRPC(ctx, client, &querypb.QueryRequest{Query: "scalar(count(a))"})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []*prompb.TimeSeries{{Samples: []prompb.Sample{{Value: 3, Timestamp: 300000}}}}, res.series)
+	})
+	t.Run("range", func(t *testing.T) {
+		res, err := queryRangeGRPC(ctx, client, &querypb.QueryRangeRequest{
+			Query:            `sum(a)`,
+			StartTimeSeconds: 60,
+			EndTimeSeconds:   180,
+			IntervalSeconds:  60,
+			EnableDedup:      true,
+			// The timeout is in seconds.
+			TimeoutSeconds: 10,
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []*prompb.TimeSeries{{
+			Samples: []prompb.Sample{{Value: 2, Timestamp: 60000}, {Value: 4, Timestamp: 120000}, {Value: 6, Timestamp: 180000}},
+		}}, res.series)
+		testutil.Equals(t, int64(6), res.stats.SamplesTotal)
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := queryGRPC(ctx, client, &querypb.QueryRequest{Query: "sum("})
+		testutil.Equals(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = queryRangeGRPC(ctx, client, &querypb.QueryRangeRequest{Query: "sum(", EndTimeSeconds: 60, IntervalSeconds: 60})
+		testutil.Equals(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("too many samples", func(t *testing.T) {
+		limited := newClient(2)
+		_, err := queryGRPC(ctx, limited, &querypb.QueryRequest{Query: "a"})
+		testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+
+		_, err = queryRangeGRPC(ctx, limited, &querypb.QueryRangeRequest{Query: "a", StartTimeSeconds: 60, EndTimeSeconds: 180, IntervalSeconds: 60})
+		testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
+
+func queryGRPC(ctx context.Context, client querypb.QueryClient, req *querypb.QueryRequest) (grpcQueryResult, error) {
+	var res grpcQueryResult
+	stream, err := client.Query(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		switch r := msg.Result.(type) {
+		case *querypb.QueryResponse_Timeseries:
+			res.series = append(res.series, r.Timeseries)
+		case *querypb.QueryResponse_Warnings:
+			res.warnings = append(res.warnings, r.Warnings)
+		case *querypb.QueryResponse_Stats:
+			res.stats = r.Stats
+		}
+	}
+}
+
+func queryRangeGRPC(ctx context.Context, client querypb.QueryClient, req *querypb.QueryRangeRequest) (grpcQueryResult, error) {
+	var res grpcQueryResult
+	stream, err := client.QueryRange(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		switch r := msg.Result.(type) {
+		case *querypb.QueryRangeResponse_Timeseries:
+			res.series = append(res.series, r.Timeseries)
+		case *querypb.QueryRangeResponse_Warnings:
+			res.warnings = append(res.warnings, r.Warnings)
+		case *querypb.QueryRangeResponse_Stats:
+			res.stats = r.Stats
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/api"
+)
+
+// MaxLookbackMode is what is done with the queries starting before their max lookback.
+type MaxLookbackMode string
+
+const (
+	// MaxLookbackClamp evaluates the queries from their max lookback only, with a warning.
+	MaxLookbackClamp MaxLookbackMode = "clamp"
+	// MaxLookbackReject rejects the queries as unprocessable.
+	MaxLookbackReject MaxLookbackMode = "reject"
+)
+
+// MaxLookback limits how far in the past the queries of tenants can start, so that queries of data older than the
+// retention don't run for minutes to return nothing.
+type MaxLookback struct {
+	header  string
+	mode    MaxLookbackMode
+	def     time.Duration
+	tenants map[string]time.Duration
+}
+
+// NewMaxLookback returns the max lookback of queries, overridden by the max_lookback limits of the tenants of the
+// configuration, as identified by the header. A zero lookback disables the limit. It returns nil if no query is
+// limited.
+func NewMaxLookback(header string, mode MaxLookbackMode, def time.Duration, cfg TenantLimitsConfig) *MaxLookback {
+	l := &MaxLookback{header: header, mode: mode, def: def, tenants: map[string]time.Duration{}}
+	for tenant, tl := range cfg.Tenants {
+		if tl.MaxLookback > 0 {
+			l.tenants[tenant] = time.Duration(tl.MaxLookback)
+		}
+	}
+	if def == 0 && len(l.tenants) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l *MaxLookback) lookback(r *http.Request) time.Duration {
+	if lookback, ok := l.tenants[r.Header.Get(l.header)]; ok {
+		return lookback
+	}
+	return l.def
+}
+
+// check checks the start of the query of the request against its max lookback, and returns the start from which the
+// query is evaluated. In clamp mode, the start is moved forward by whole steps so that the evaluated steps remain the
+// ones of the query, and a warning is returned; ok is false if the whole query is before the max lookback. It returns
+// the start as is on nil MaxLookback.
+func (l *MaxLookback) check(r *http.Request, now, start, end time.Time, step time.Duration) (_ time.Time, warning error, ok bool, _ *api.ApiError) {
+	if l == nil {
+		return start, nil, true, nil
+	}
+	lookback := l.lookback(r)
+	if lookback == 0 {
+		return start, nil, true, nil
+	}
+	minTime := now.Add(-lookback)
+	if !start.Before(minTime) {
+		return start, nil, true, nil
+	}
+	if l.mode == MaxLookbackReject {
+		err := errors.Errorf("the query starts at %s, before the max lookback of %s, only data after %s can be queried",
+			start.UTC().Format(time.RFC3339), model.Duration(lookback), minTime.UTC().Format(time.RFC3339))
+		return time.Time{}, nil, false, &api.ApiError{Typ: api.ErrorExec, Err: err}
+	}
+
+	clamped := minTime
+	if step > 0 {
+		steps := (minTime.Sub(start) + step - 1) / step
+		clamped = start.Add(steps * step)
+	}
+	warning = errors.Errorf("the query starts before the max lookback of %s, only data after %s was queried",
+		model.Duration(lookback), clamped.UTC().Format(time.RFC3339))
+	return clamped, warning, !clamped.After(end), nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestNewMaxLookback(t *testing.T) {
+	testutil.Assert(t, NewMaxLookback(receive.DefaultTenantHeader, MaxLookbackClamp, 0, TenantLimitsConfig{}) == nil, "expected no max lookback")
+	testutil.Assert(t, NewMaxLookback(receive.DefaultTenantHeader, MaxLookbackClamp, 0, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+		"team-a": {MaxSamples: 10},
+	}}) == nil, "expected no max lookback")
+
+	l := NewMaxLookback(receive.DefaultTenantHeader, MaxLookbackClamp, 0, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+		"team-a": {MaxLookback: model.Duration(time.Hour)},
+	}})
+	testutil.Assert(t, l != nil, "expected max lookback")
+	testutil.Equals(t, map[string]time.Duration{"team-a": time.Hour}, l.tenants)
+}
+
+func TestQueryAPI_MaxLookback(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "test_metric"), i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	qe := promql.NewEngine(promql.EngineOpts{MaxSamples: 10000, Timeout: 100 * time.Second})
+	newAPI := func(mode MaxLookbackMode) *QueryAPI {
+		return &QueryAPI{
+			// Only the data after 300s can be queried.
+			baseAPI:         &baseAPI.BaseAPI{Now: func() time.Time { return time.Unix(600, 0) }},
+			queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, 100*time.Second, nil, false),
+			queryEngine:     func(int64) *promql.Engine { return qe },
+			maxLookback: NewMaxLookback(receive.DefaultTenantHeader, mode, 5*time.Minute, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+				"long": {MaxLookback: model.Duration(time.Hour)},
+			}}),
+			gate: gate.New(nil, 4),
+			queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+				Name: "query_range_hist",
+			}),
+		}
+	}
+	newRequest := func(path string, params url.Values, tenant string) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, "http://example.com"+path+"?"+params.Encode(), nil)
+		testutil.Ok(t, err)
+		if tenant != "" {
+			r.Header.Set(receive.DefaultTenantHeader, tenant)
+		}
+		return r
+	}
+	rangeParams := func(start, end string) url.Values {
+		return url.Values{"query": []string{"test_metric"}, "start": []string{start}, "end": []string{end}, "step": []string{"60"}}
+	}
+	timestamps := func(t *testing.T, data interface{}) []int64 {
+		var ts []int64
+		switch v := data.(*queryData).Result.(type) {
+		case promql.Matrix:
+			for _, s := range v {
+				for _, p := range s.Points {
+					ts = append(ts, p.T/1000)
+				}
+			}
+		case promql.Vector:
+			for _, s := range v {
+				ts = append(ts, s.T/1000)
+			}
+		default:
+			t.Fatalf("unexpected result type %T", v)
+		}
+		return ts
+	}
+
+	t.Run("clamp", func(t *testing.T) {
+		api := newAPI(MaxLookbackClamp)
+
+		data, warnings, apiErr := api.queryRange(newRequest("/api/v1/query_range", rangeParams("30", "540"), ""))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 1, len(warnings))
+		testutil.Equals(t, "the query starts before the max lookback of 5m, only data after 1970-01-01T00:05:30Z was queried", warnings[0].Error())
+		// The steps of the query are kept.
+		testutil.Equals(t, []int64{330, 390, 450, 510}, timestamps(t, data))
+
+		data, warnings, apiErr = api.queryRange(newRequest("/api/v1/query_range", rangeParams("0", "240"), ""))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 1, len(warnings))
+		testutil.Equals(t, 0, len(timestamps(t, data)))
+
+		data, warnings, apiErr = api.queryRange(newRequest("/api/v1/query_range", rangeParams("0", "540"), "long"))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 0, len(warnings))
+		testutil.Equals(t, 10, len(timestamps(t, data)))
+
+		data, warnings, apiErr = api.query(newRequest("/api/v1/query", url.Values{"query": []string{"test_metric"}, "time": []string{"120"}}, ""))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 1, len(warnings))
+		testutil.Equals(t, 0, len(timestamps(t, data)))
+
+		data, warnings, apiErr = api.query(newRequest("/api/v1/query", url.Values{"query": []string{"test_metric"}, "time": []string{"420"}}, ""))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, 0, len(warnings))
+		testutil.Equals(t, []int64{420}, timestamps(t, data))
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		api := newAPI(MaxLookbackReject)
+
+		_, _, apiErr := api.queryRange(newRequest("/api/v1/query_range", rangeParams("30", "540"), ""))
+		testutil.Assert(t, apiErr != nil, "expected error")
+		testutil.Equals(t, baseAPI.ErrorExec, apiErr.Typ)
+		testutil.Equals(t, "the query starts at 1970-01-01T00:00:30Z, before the max lookback of 5m, only data after 1970-01-01T00:05:00Z can be queried", apiErr.Err.Error())
+
+		_, _, apiErr = api.query(newRequest("/api/v1/query", url.Values{"query": []string{"test_metric"}, "time": []string{"120"}}, ""))
+		testutil.Assert(t, apiErr != nil, "expected error")
+		testutil.Equals(t, baseAPI.ErrorExec, apiErr.Typ)
+
+		_, _, apiErr = api.queryRange(newRequest("/api/v1/query_range", rangeParams("300", "540"), ""))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		_, _, apiErr = api.queryRange(newRequest("/api/v1/query_range", rangeParams("0", "540"), "long"))
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+	})
+}
@@ -117,6 +117,7 @@ type QueryResponse struct {
 	// Types that are valid to be assigned to Result:
 	//	*QueryResponse_Warnings
 	//	*QueryResponse_Timeseries
+	//	*QueryResponse_Stats
 	Result isQueryResponse_Result `protobuf_oneof:"result"`
 }
 
@@ -165,9 +166,13 @@ type QueryResponse_Warnings struct {
 type QueryResponse_Timeseries struct {
 	Timeseries *prompb.TimeSeries `protobuf:"bytes,2,opt,name=timeseries,proto3,oneof" json:"timeseries,omitempty"`
 }
+type QueryResponse_Stats struct {
+	Stats *QueryStats `protobuf:"bytes,3,opt,name=stats,proto3,oneof" json:"stats,omitempty"`
+}
 
 func (*QueryResponse_Warnings) isQueryResponse_Result()   {}
 func (*QueryResponse_Timeseries) isQueryResponse_Result() {}
+func (*QueryResponse_Stats) isQueryResponse_Result()      {}
 
 func (m *QueryResponse) GetResult() isQueryResponse_Result {
 	if m != nil {
@@ -190,14 +195,62 @@ func (m *QueryResponse) GetTimeseries() *prompb.TimeSeries {
 	return nil
 }
 
+func (m *QueryResponse) GetStats() *QueryStats {
+	if x, ok := m.GetResult().(*QueryResponse_Stats); ok {
+		return x.Stats
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*QueryResponse) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*QueryResponse_Warnings)(nil),
 		(*QueryResponse_Timeseries)(nil),
+		(*QueryResponse_Stats)(nil),
 	}
 }
 
+type QueryStats struct {
+	/// samples_total is the total number of samples loaded by the query.
+	SamplesTotal int64 `protobuf:"varint,1,opt,name=samples_total,json=samplesTotal,proto3" json:"samples_total,omitempty"`
+	/// peak_samples is the highest number of samples held in memory at once while evaluating the query.
+	PeakSamples int64 `protobuf:"varint,2,opt,name=peak_samples,json=peakSamples,proto3" json:"peak_samples,omitempty"`
+}
+
+func (m *QueryStats) Reset()         { *m = QueryStats{} }
+func (m *QueryStats) String() string { return proto.CompactTextString(m) }
+func (*QueryStats) ProtoMessage()    {}
+func (*QueryStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4b2aba43925d729f, []int{3}
+}
+func (m *QueryStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *QueryStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_QueryStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *QueryStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryStats.Merge(m, src)
+}
+func (m *QueryStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *QueryStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryStats proto.InternalMessageInfo
+
 type QueryRangeRequest struct {
 	Query                 string          `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
 	StartTimeSeconds      int64           `protobuf:"varint,2,opt,name=start_time_seconds,json=startTimeSeconds,proto3" json:"start_time_seconds,omitempty"`
@@ -217,7 +270,7 @@ func (m *QueryRangeRequest) Reset()         { *m = QueryRangeRequest{} }
 func (m *QueryRangeRequest) String() string { return proto.CompactTextString(m) }
 func (*QueryRangeRequest) ProtoMessage()    {}
 func (*QueryRangeRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_4b2aba43925d729f, []int{3}
+	return fileDescriptor_4b2aba43925d729f, []int{4}
 }
 func (m *QueryRangeRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -250,6 +303,7 @@ type QueryRangeResponse struct {
 	// Types that are valid to be assigned to Result:
 	//	*QueryRangeResponse_Warnings
 	//	*QueryRangeResponse_Timeseries
+	//	*QueryRangeResponse_Stats
 	Result isQueryRangeResponse_Result `protobuf_oneof:"result"`
 }
 
@@ -257,7 +311,7 @@ func (m *QueryRangeResponse) Reset()         { *m = QueryRangeResponse{} }
 func (m *QueryRangeResponse) String() string { return proto.CompactTextString(m) }
 func (*QueryRangeResponse) ProtoMessage()    {}
 func (*QueryRangeResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_4b2aba43925d729f, []int{4}
+	return fileDescriptor_4b2aba43925d729f, []int{5}
 }
 func (m *QueryRangeResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -298,9 +352,13 @@ type QueryRangeResponse_Warnings struct {
 type QueryRangeResponse_Timeseries struct {
 	Timeseries *prompb.TimeSeries `protobuf:"bytes,2,opt,name=timeseries,proto3,oneof" json:"timeseries,omitempty"`
 }
+type QueryRangeResponse_Stats struct {
+	Stats *QueryStats `protobuf:"bytes,3,opt,name=stats,proto3,oneof" json:"stats,omitempty"`
+}
 
 func (*QueryRangeResponse_Warnings) isQueryRangeResponse_Result()   {}
 func (*QueryRangeResponse_Timeseries) isQueryRangeResponse_Result() {}
+func (*QueryRangeResponse_Stats) isQueryRangeResponse_Result()      {}
 
 func (m *QueryRangeResponse) GetResult() isQueryRangeResponse_Result {
 	if m != nil {
@@ -323,11 +381,19 @@ func (m *QueryRangeResponse) GetTimeseries() *prompb.TimeSeries {
 	return nil
 }
 
+func (m *QueryRangeResponse) GetStats() *QueryStats {
+	if x, ok := m.GetResult().(*QueryRangeResponse_Stats); ok {
+		return x.Stats
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*QueryRangeResponse) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*QueryRangeResponse_Warnings)(nil),
 		(*QueryRangeResponse_Timeseries)(nil),
+		(*QueryRangeResponse_Stats)(nil),
 	}
 }
 
@@ -335,6 +401,7 @@ func init() {
 	proto.RegisterType((*QueryRequest)(nil), "thanos.QueryRequest")
 	proto.RegisterType((*StoreMatchers)(nil), "thanos.StoreMatchers")
 	proto.RegisterType((*QueryResponse)(nil), "thanos.QueryResponse")
+	proto.RegisterType((*QueryStats)(nil), "thanos.QueryStats")
 	proto.RegisterType((*QueryRangeRequest)(nil), "thanos.QueryRangeRequest")
 	proto.RegisterType((*QueryRangeResponse)(nil), "thanos.QueryRangeResponse")
 }
@@ -342,47 +409,50 @@ func init() {
 func init() { proto.RegisterFile("api/query/querypb/query.proto", fileDescriptor_4b2aba43925d729f) }
 
 var fileDescriptor_4b2aba43925d729f = []byte{
-	// 627 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x95, 0xcf, 0x6e, 0xd3, 0x4c,
-	0x14, 0xc5, 0xed, 0x2f, 0x4d, 0x9a, 0xdc, 0x34, 0x6d, 0xbf, 0x21, 0x45, 0x6e, 0x00, 0x63, 0x22,
-	0x55, 0x04, 0x09, 0x25, 0x55, 0xa9, 0xd8, 0x21, 0x41, 0x01, 0xa9, 0x8b, 0x22, 0xb5, 0x6e, 0x57,
-	0x6c, 0xa2, 0x49, 0x72, 0x95, 0x58, 0x75, 0x66, 0xdc, 0x99, 0x71, 0xff, 0x88, 0x3d, 0x6b, 0xde,
-	0x80, 0xf7, 0xe0, 0x09, 0xba, 0xec, 0x92, 0x15, 0x82, 0xf6, 0x45, 0x90, 0xc7, 0x76, 0xb0, 0x4b,
-	0x54, 0x35, 0x20, 0xb1, 0x71, 0x3c, 0xe7, 0x9c, 0x9b, 0x3b, 0x77, 0xf2, 0x8b, 0x0d, 0x0f, 0x68,
-	0xe0, 0x75, 0x8e, 0x42, 0x14, 0x67, 0xf1, 0x35, 0xe8, 0xc5, 0x9f, 0xed, 0x40, 0x70, 0xc5, 0x49,
-	0x49, 0x8d, 0x28, 0xe3, 0xb2, 0x51, 0x1f, 0xf2, 0x21, 0xd7, 0x52, 0x27, 0xba, 0x8b, 0xdd, 0xc6,
-	0xaa, 0x54, 0x5c, 0x60, 0x47, 0x5f, 0x83, 0x5e, 0x47, 0x9d, 0x05, 0x28, 0x13, 0xcb, 0xc9, 0x5b,
-	0x81, 0xe0, 0xe3, 0x7c, 0xa2, 0xf9, 0xa5, 0x00, 0x0b, 0x7b, 0x51, 0x2b, 0x17, 0x8f, 0x42, 0x94,
-	0x8a, 0xd4, 0xa1, 0xa8, 0x5b, 0x5b, 0xa6, 0x63, 0xb6, 0x2a, 0x6e, 0xbc, 0x20, 0x8f, 0x60, 0x41,
-	0x79, 0x63, 0xec, 0x4a, 0xec, 0x73, 0x36, 0x90, 0xd6, 0x7f, 0x8e, 0xd9, 0x2a, 0xb8, 0xd5, 0x48,
-	0xdb, 0x8f, 0x25, 0xf2, 0x18, 0x96, 0xa2, 0x25, 0x0f, 0xd5, 0x24, 0x55, 0xd0, 0xa9, 0xc5, 0x44,
-	0x4e, 0x83, 0x9b, 0x70, 0x77, 0x4c, 0x4f, 0xbb, 0x02, 0x25, 0xf7, 0x43, 0xe5, 0x71, 0x36, 0xc9,
-	0xcf, 0xe9, 0x7c, 0x7d, 0x4c, 0x4f, 0xdd, 0x89, 0x99, 0x56, 0xad, 0xc1, 0xa2, 0xc0, 0xc0, 0xf7,
-	0xfa, 0xb4, 0xeb, 0xd3, 0x1e, 0xfa, 0xd2, 0x2a, 0x3a, 0x85, 0x56, 0xc5, 0xad, 0x25, 0xea, 0x8e,
-	0x16, 0xc9, 0x2b, 0xa8, 0xe9, 0x69, 0xdf, 0x51, 0xd5, 0x1f, 0xa1, 0x90, 0x56, 0xc9, 0x29, 0xb4,
-	0xaa, 0x1b, 0x2b, 0xed, 0xf8, 0x08, 0xdb, 0xfb, 0x59, 0x73, 0x6b, 0xee, 0xfc, 0xdb, 0x43, 0xc3,
-	0xcd, 0x57, 0x10, 0x07, 0xaa, 0xc8, 0x68, 0xcf, 0xc7, 0x37, 0x38, 0x08, 0x03, 0x6b, 0xde, 0x31,
-	0x5b, 0x65, 0x37, 0x2b, 0x91, 0x4d, 0x58, 0x89, 0x97, 0xbb, 0x54, 0x28, 0x8f, 0xfa, 0x2e, 0xca,
-	0x80, 0x33, 0x89, 0x56, 0x59, 0x67, 0xa7, 0x9b, 0x64, 0x1d, 0xee, 0xc4, 0x86, 0x3e, 0xef, 0xdd,
-	0x50, 0x8e, 0x06, 0xfc, 0x84, 0x59, 0x15, 0x5d, 0x33, 0xcd, 0x22, 0x36, 0x80, 0x3c, 0xf4, 0x82,
-	0xd7, 0xa3, 0x90, 0x1d, 0x4a, 0x0b, 0x74, 0x30, 0xa3, 0x34, 0xf7, 0xa0, 0x96, 0x9b, 0x87, 0xbc,
-	0x84, 0x9a, 0x3e, 0x9c, 0xc9, 0xf4, 0xa6, 0x9e, 0xbe, 0x9e, 0x4e, 0xbf, 0x93, 0x31, 0xd3, 0xe1,
-	0x73, 0x05, 0xcd, 0x63, 0xa8, 0x25, 0x38, 0x24, 0xbb, 0xbe, 0x0f, 0xe5, 0x13, 0x2a, 0x98, 0xc7,
-	0x86, 0x32, 0x46, 0x62, 0xdb, 0x70, 0x27, 0x0a, 0x79, 0x01, 0x10, 0xfd, 0xba, 0x12, 0x85, 0x87,
-	0x31, 0x15, 0xd5, 0x8d, 0x7b, 0x11, 0x5a, 0x63, 0x54, 0x23, 0x0c, 0x65, 0xb7, 0xcf, 0x83, 0xb3,
-	0xf6, 0x81, 0xc6, 0x24, 0x8a, 0x6c, 0x1b, 0x6e, 0xa6, 0x60, 0xab, 0x0c, 0x25, 0x81, 0x32, 0xf4,
-	0x55, 0xf3, 0xf3, 0x1c, 0xfc, 0x1f, 0x37, 0xa6, 0x6c, 0x88, 0x37, 0xc3, 0xf8, 0x14, 0x88, 0x54,
-	0x54, 0xa8, 0xee, 0x14, 0x24, 0x97, 0xb5, 0x73, 0x90, 0xe1, 0xb2, 0x05, 0xcb, 0xc8, 0x06, 0xf9,
-	0x6c, 0x02, 0x26, 0xb2, 0x41, 0x36, 0xf9, 0x04, 0x96, 0x3d, 0xa6, 0x50, 0x1c, 0x53, 0xff, 0x1a,
-	0x92, 0x4b, 0xa9, 0x7e, 0x03, 0xec, 0xc5, 0x19, 0x61, 0x2f, 0xcd, 0x04, 0xfb, 0xfc, 0xad, 0x60,
-	0x2f, 0xff, 0x2d, 0xec, 0x95, 0x19, 0x60, 0x87, 0x3f, 0x80, 0xbd, 0x7a, 0x5b, 0xd8, 0x17, 0x7e,
-	0x83, 0xfd, 0x03, 0x90, 0x2c, 0x20, 0xff, 0x14, 0xcf, 0x8d, 0x8f, 0x26, 0x14, 0x75, 0x77, 0xf2,
-	0x3c, 0xbd, 0x99, 0xfc, 0xa9, 0xb2, 0x8f, 0xcf, 0xc6, 0xca, 0x35, 0x35, 0xde, 0xe6, 0xba, 0x49,
-	0xde, 0x02, 0xfc, 0xda, 0x3e, 0x59, 0xcd, 0xc7, 0x32, 0xcc, 0x37, 0x1a, 0xd3, 0xac, 0xf4, 0x6b,
-	0xb6, 0xd6, 0xce, 0x7f, 0xd8, 0xc6, 0xf9, 0xa5, 0x6d, 0x5e, 0x5c, 0xda, 0xe6, 0xf7, 0x4b, 0xdb,
-	0xfc, 0x74, 0x65, 0x1b, 0x17, 0x57, 0xb6, 0xf1, 0xf5, 0xca, 0x36, 0xde, 0xcf, 0x27, 0x6f, 0x8f,
-	0x5e, 0x49, 0x3f, 0xdd, 0x9f, 0xfd, 0x0c, 0x00, 0x00, 0xff, 0xff, 0x4f, 0xb6, 0xe9, 0xc9, 0x59,
-	0x06, 0x00, 0x00,
+	// 688 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x55, 0xc1, 0x6e, 0xd3, 0x4a,
+	0x14, 0xb5, 0x5f, 0x9a, 0x34, 0xb9, 0x49, 0xda, 0xbe, 0x79, 0xe9, 0x93, 0x1b, 0xc0, 0x84, 0xa0,
+	0x8a, 0x80, 0x50, 0x52, 0x85, 0x8a, 0x1d, 0x12, 0x14, 0x90, 0xba, 0x28, 0x52, 0xeb, 0x64, 0xc5,
+	0xc6, 0x9a, 0x24, 0x57, 0x89, 0x55, 0xc7, 0xe3, 0x7a, 0xc6, 0xb4, 0xfd, 0x01, 0xd6, 0xfc, 0x01,
+	0x12, 0x1b, 0xfe, 0x81, 0x2f, 0xe8, 0xb2, 0x4b, 0x56, 0x08, 0xda, 0x1f, 0x41, 0x9e, 0xb1, 0x53,
+	0xbb, 0x44, 0x55, 0x0b, 0x1b, 0x36, 0x8e, 0xe7, 0x9c, 0x73, 0xe3, 0x39, 0xe3, 0x73, 0x64, 0xb8,
+	0x43, 0x7d, 0xa7, 0x73, 0x10, 0x62, 0x70, 0xac, 0xae, 0xfe, 0x40, 0xfd, 0xb6, 0xfd, 0x80, 0x09,
+	0x46, 0x0a, 0x62, 0x42, 0x3d, 0xc6, 0xeb, 0xb5, 0x31, 0x1b, 0x33, 0x09, 0x75, 0xa2, 0x3b, 0xc5,
+	0xd6, 0xd7, 0xb8, 0x60, 0x01, 0x76, 0xe4, 0xd5, 0x1f, 0x74, 0xc4, 0xb1, 0x8f, 0x3c, 0xa6, 0x1a,
+	0x59, 0xca, 0x0f, 0xd8, 0x34, 0xab, 0x68, 0x7e, 0xc9, 0x41, 0x65, 0x2f, 0x7a, 0x94, 0x85, 0x07,
+	0x21, 0x72, 0x41, 0x6a, 0x90, 0x97, 0x8f, 0x36, 0xf4, 0x86, 0xde, 0x2a, 0x59, 0x6a, 0x41, 0xee,
+	0x41, 0x45, 0x38, 0x53, 0xb4, 0x39, 0x0e, 0x99, 0x37, 0xe2, 0xc6, 0x3f, 0x0d, 0xbd, 0x95, 0xb3,
+	0xca, 0x11, 0xd6, 0x53, 0x10, 0x79, 0x00, 0xcb, 0xd1, 0x92, 0x85, 0x62, 0xa6, 0xca, 0x49, 0xd5,
+	0x52, 0x0c, 0x27, 0xc2, 0x4d, 0xf8, 0x7f, 0x4a, 0x8f, 0xec, 0x00, 0x39, 0x73, 0x43, 0xe1, 0x30,
+	0x6f, 0xa6, 0x5f, 0x90, 0xfa, 0xda, 0x94, 0x1e, 0x59, 0x33, 0x32, 0x99, 0x5a, 0x87, 0xa5, 0x00,
+	0x7d, 0xd7, 0x19, 0x52, 0xdb, 0xa5, 0x03, 0x74, 0xb9, 0x91, 0x6f, 0xe4, 0x5a, 0x25, 0xab, 0x1a,
+	0xa3, 0x3b, 0x12, 0x24, 0x2f, 0xa0, 0x2a, 0xdd, 0xbe, 0xa1, 0x62, 0x38, 0xc1, 0x80, 0x1b, 0x85,
+	0x46, 0xae, 0x55, 0xee, 0xae, 0xb6, 0xd5, 0x11, 0xb6, 0x7b, 0x69, 0x72, 0x6b, 0xe1, 0xe4, 0xdb,
+	0x5d, 0xcd, 0xca, 0x4e, 0x90, 0x06, 0x94, 0xd1, 0xa3, 0x03, 0x17, 0x5f, 0xe1, 0x28, 0xf4, 0x8d,
+	0xc5, 0x86, 0xde, 0x2a, 0x5a, 0x69, 0x88, 0x6c, 0xc2, 0xaa, 0x5a, 0xee, 0xd2, 0x40, 0x38, 0xd4,
+	0xb5, 0x90, 0xfb, 0xcc, 0xe3, 0x68, 0x14, 0xa5, 0x76, 0x3e, 0x49, 0x36, 0xe0, 0x3f, 0x45, 0xc8,
+	0xf3, 0xde, 0x0d, 0xf9, 0x64, 0xc4, 0x0e, 0x3d, 0xa3, 0x24, 0x67, 0xe6, 0x51, 0xc4, 0x04, 0xe0,
+	0xfb, 0x8e, 0xff, 0x72, 0x12, 0x7a, 0xfb, 0xdc, 0x00, 0x29, 0x4c, 0x21, 0xcd, 0x3d, 0xa8, 0x66,
+	0xfc, 0x90, 0xe7, 0x50, 0x95, 0x87, 0x33, 0x73, 0xaf, 0x4b, 0xf7, 0xb5, 0xc4, 0xfd, 0x4e, 0x8a,
+	0x4c, 0xcc, 0x67, 0x06, 0x9a, 0x9f, 0x74, 0xa8, 0xc6, 0x79, 0x88, 0xb7, 0x7d, 0x1b, 0x8a, 0x87,
+	0x34, 0xf0, 0x1c, 0x6f, 0xcc, 0x55, 0x26, 0xb6, 0x35, 0x6b, 0x86, 0x90, 0x67, 0x00, 0xd1, 0xeb,
+	0xe5, 0x18, 0x38, 0xa8, 0x62, 0x51, 0xee, 0xde, 0x8a, 0xb2, 0x35, 0x45, 0x31, 0xc1, 0x90, 0xdb,
+	0x43, 0xe6, 0x1f, 0xb7, 0xfb, 0x32, 0x27, 0x91, 0x64, 0x5b, 0xb3, 0x52, 0x03, 0xe4, 0x11, 0xe4,
+	0xb9, 0xa0, 0x42, 0x45, 0xa5, 0xdc, 0x25, 0xc9, 0x46, 0xe5, 0x16, 0x7a, 0x11, 0xb3, 0xad, 0x59,
+	0x4a, 0xb2, 0x55, 0x84, 0x42, 0x80, 0x3c, 0x74, 0x45, 0xb3, 0x0f, 0x70, 0x21, 0x20, 0xf7, 0xa1,
+	0xca, 0xe9, 0xd4, 0x77, 0x91, 0xdb, 0x82, 0x09, 0xea, 0xca, 0x5d, 0xe6, 0xac, 0x4a, 0x0c, 0xf6,
+	0x23, 0x2c, 0x0a, 0xb0, 0x8f, 0x74, 0xdf, 0x8e, 0xc1, 0x24, 0xc0, 0x11, 0xd6, 0x53, 0x50, 0xf3,
+	0xe3, 0x02, 0xfc, 0xab, 0xac, 0x53, 0x6f, 0x8c, 0x57, 0xf7, 0xe1, 0x31, 0x10, 0x2e, 0x68, 0x20,
+	0xec, 0x39, 0xad, 0x58, 0x91, 0x4c, 0x3f, 0x55, 0x8d, 0x16, 0xac, 0xa0, 0x37, 0xca, 0x6a, 0xe3,
+	0x6e, 0xa0, 0x37, 0x4a, 0x2b, 0x1f, 0xc2, 0x8a, 0xe3, 0x09, 0x0c, 0xde, 0x51, 0xf7, 0x52, 0x2b,
+	0x96, 0x13, 0xfc, 0x8a, 0xbe, 0xe5, 0x6f, 0xd8, 0xb7, 0xc2, 0x8d, 0xfa, 0xb6, 0x78, 0xad, 0xbe,
+	0x15, 0xff, 0xb4, 0x6f, 0xa5, 0x1b, 0xf4, 0x0d, 0x7e, 0xa3, 0x6f, 0xe5, 0xeb, 0xf6, 0xad, 0xf2,
+	0x4b, 0xdf, 0x3e, 0xeb, 0x40, 0xd2, 0x09, 0xf9, 0x6b, 0x1b, 0xd2, 0x7d, 0xaf, 0x43, 0x5e, 0x2a,
+	0xc8, 0xd3, 0xe4, 0xa6, 0x96, 0x99, 0x8c, 0xe3, 0x5d, 0x5f, 0xbd, 0x84, 0x2a, 0x4b, 0x1b, 0x3a,
+	0x79, 0x0d, 0x70, 0x61, 0x95, 0xac, 0x65, 0x65, 0xa9, 0x82, 0xd4, 0xeb, 0xf3, 0xa8, 0xe4, 0x6f,
+	0xb6, 0xd6, 0x4f, 0x7e, 0x98, 0xda, 0xc9, 0x99, 0xa9, 0x9f, 0x9e, 0x99, 0xfa, 0xf7, 0x33, 0x53,
+	0xff, 0x70, 0x6e, 0x6a, 0xa7, 0xe7, 0xa6, 0xf6, 0xf5, 0xdc, 0xd4, 0xde, 0x2e, 0xc6, 0x5f, 0xbb,
+	0x41, 0x41, 0x7e, 0x8d, 0x9e, 0xfc, 0x1c, 0x00, 0xa6, 0xb5, 0xb8, 0xab, 0x09, 0x07, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -767,6 +837,60 @@ func (m *QueryResponse_Timeseries) MarshalToSizedBuffer(dAtA []byte) (int, error
 	}
 	return len(dAtA) - i, nil
 }
+func (m *QueryResponse_Stats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *QueryResponse_Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	if m.Stats != nil {
+		{
+			size, err := m.Stats.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintQuery(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	return len(dAtA) - i, nil
+}
+func (m *QueryStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *QueryStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *QueryStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.PeakSamples != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.PeakSamples))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.SamplesTotal != 0 {
+		i = encodeVarintQuery(dAtA, i, uint64(m.SamplesTotal))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *QueryRangeRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -952,6 +1076,27 @@ func (m *QueryRangeResponse_Timeseries) MarshalToSizedBuffer(dAtA []byte) (int,
 	}
 	return len(dAtA) - i, nil
 }
+func (m *QueryRangeResponse_Stats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *QueryRangeResponse_Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	if m.Stats != nil {
+		{
+			size, err := m.Stats.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintQuery(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	return len(dAtA) - i, nil
+}
 func encodeVarintQuery(dAtA []byte, offset int, v uint64) int {
 	offset -= sovQuery(v)
 	base := offset
@@ -1058,6 +1203,33 @@ func (m *QueryResponse_Timeseries) Size() (n int) {
 	}
 	return n
 }
+func (m *QueryResponse_Stats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Stats != nil {
+		l = m.Stats.Size()
+		n += 1 + l + sovQuery(uint64(l))
+	}
+	return n
+}
+func (m *QueryStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.SamplesTotal != 0 {
+		n += 1 + sovQuery(uint64(m.SamplesTotal))
+	}
+	if m.PeakSamples != 0 {
+		n += 1 + sovQuery(uint64(m.PeakSamples))
+	}
+	return n
+}
+
 func (m *QueryRangeRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1144,6 +1316,18 @@ func (m *QueryRangeResponse_Timeseries) Size() (n int) {
 	}
 	return n
 }
+func (m *QueryRangeResponse_Stats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Stats != nil {
+		l = m.Stats.Size()
+		n += 1 + l + sovQuery(uint64(l))
+	}
+	return n
+}
 
 func sovQuery(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
@@ -1616,6 +1800,129 @@ func (m *QueryResponse) Unmarshal(dAtA []byte) error {
 			}
 			m.Result = &QueryResponse_Timeseries{v}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Stats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &QueryStats{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Result = &QueryResponse_Stats{v}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQuery(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *QueryStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQuery
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: QueryStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: QueryStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SamplesTotal", wireType)
+			}
+			m.SamplesTotal = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SamplesTotal |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PeakSamples", wireType)
+			}
+			m.PeakSamples = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PeakSamples |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQuery(dAtA[iNdEx:])
@@ -2056,6 +2363,41 @@ func (m *QueryRangeResponse) Unmarshal(dAtA []byte) error {
 			}
 			m.Result = &QueryRangeResponse_Timeseries{v}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Stats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &QueryStats{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Result = &QueryRangeResponse_Stats{v}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQuery(dAtA[iNdEx:])
@@ -6,6 +6,8 @@ package querypb
 import (
 	"strings"
 
+	"github.com/prometheus/prometheus/util/stats"
+
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 )
 
@@ -18,7 +20,7 @@ func NewQueryResponse(series *prompb.TimeSeries) *QueryResponse {
 }
 
 func NewQueryWarningsResponse(errs []error) *QueryResponse {
-	warnings := make([]string, len(errs))
+	warnings := make([]string, 0, len(errs))
 	for _, err := range errs {
 		warnings = append(warnings, err.Error())
 	}
@@ -29,6 +31,14 @@ func NewQueryWarningsResponse(errs []error) *QueryResponse {
 	}
 }
 
+func NewQueryStatsResponse(samples *stats.QuerySamples) *QueryResponse {
+	return &QueryResponse{
+		Result: &QueryResponse_Stats{
+			Stats: NewQueryStats(samples),
+		},
+	}
+}
+
 func NewQueryRangeResponse(series *prompb.TimeSeries) *QueryRangeResponse {
 	return &QueryRangeResponse{
 		Result: &QueryRangeResponse_Timeseries{
@@ -38,7 +48,7 @@ func NewQueryRangeResponse(series *prompb.TimeSeries) *QueryRangeResponse {
 }
 
 func NewQueryRangeWarningsResponse(errs []error) *QueryRangeResponse {
-	warnings := make([]string, len(errs))
+	warnings := make([]string, 0, len(errs))
 	for _, err := range errs {
 		warnings = append(warnings, err.Error())
 	}
@@ -48,3 +58,22 @@ func NewQueryRangeWarningsResponse(errs []error) *QueryRangeResponse {
 		},
 	}
 }
+
+func NewQueryRangeStatsResponse(samples *stats.QuerySamples) *QueryRangeResponse {
+	return &QueryRangeResponse{
+		Result: &QueryRangeResponse_Stats{
+			Stats: NewQueryStats(samples),
+		},
+	}
+}
+
+// NewQueryStats returns the QueryStats of the samples statistics of a query, or empty ones on nil statistics.
+func NewQueryStats(samples *stats.QuerySamples) *QueryStats {
+	if samples == nil {
+		return &QueryStats{}
+	}
+	return &QueryStats{
+		SamplesTotal: samples.TotalSamples,
+		PeakSamples:  int64(samples.PeakSamples),
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/api"
+)
+
+// TenantReplicaLabels are the replica labels along which the queries of tenants are deduplicated by default, when
+// their HA groups are labeled differently than the ones of other tenants.
+type TenantReplicaLabels struct {
+	header  string
+	tenants map[string][]string
+}
+
+// NewTenantReplicaLabels returns the replica_labels of the tenants of the configuration, as identified by the header.
+// A tenant with an empty list of replica labels is not deduplicated by default. It returns nil if no tenant has replica
+// labels.
+func NewTenantReplicaLabels(header string, cfg TenantLimitsConfig) *TenantReplicaLabels {
+	l := &TenantReplicaLabels{header: header, tenants: map[string][]string{}}
+	for tenant, tl := range cfg.Tenants {
+		if tl.ReplicaLabels != nil {
+			l.tenants[tenant] = tl.ReplicaLabels
+		}
+	}
+	if len(l.tenants) == 0 {
+		return nil
+	}
+	return l
+}
+
+// replicaLabels returns the replica labels of the tenant of the request, and false if it has none or on nil
+// TenantReplicaLabels.
+func (l *TenantReplicaLabels) replicaLabels(r *http.Request) ([]string, bool) {
+	if l == nil {
+		return nil, false
+	}
+	return l.tenantReplicaLabels(r.Header.Get(l.header))
+}
+
+// grpcReplicaLabels returns the replica labels of the tenant of the gRPC request of the context, identified by the
+// metadata named like the header, and false if it has none or on nil TenantReplicaLabels.
+func (l *TenantReplicaLabels) grpcReplicaLabels(ctx context.Context) ([]string, bool) {
+	if l == nil {
+		return nil, false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	tenants := md.Get(l.header)
+	if len(tenants) == 0 {
+		return nil, false
+	}
+	return l.tenantReplicaLabels(tenants[0])
+}
+
+func (l *TenantReplicaLabels) tenantReplicaLabels(tenant string) ([]string, bool) {
+	labels, ok := l.tenants[tenant]
+	return labels, ok
+}
+
+// ReplicaLabelsStatus are the replica labels along which queries are deduplicated by default.
+type ReplicaLabelsStatus struct {
+	// Default are the replica labels of the --query.replica-label flags.
+	Default []string `json:"default"`
+	// Tenants are the replica labels of the tenants overriding the default ones.
+	Tenants []TenantReplicaLabelsStatus `json:"tenants"`
+}
+
+// TenantReplicaLabelsStatus are the replica labels of the queries of a tenant.
+type TenantReplicaLabelsStatus struct {
+	Tenant        string   `json:"tenant"`
+	ReplicaLabels []string `json:"replicaLabels"`
+}
+
+// replicaLabelsStatus returns the default replica labels of queries, overall and by tenant. The replicaLabels[]
+// parameter of requests still overrides them.
+func (qapi *QueryAPI) replicaLabelsStatus(_ *http.Request) (interface{}, []error, *api.ApiError) {
+	status := ReplicaLabelsStatus{Default: qapi.replicaLabels, Tenants: []TenantReplicaLabelsStatus{}}
+	if status.Default == nil {
+		status.Default = []string{}
+	}
+	if qapi.tenantReplicaLabels != nil {
+		for tenant, labels := range qapi.tenantReplicaLabels.tenants {
+			status.Tenants = append(status.Tenants, TenantReplicaLabelsStatus{Tenant: tenant, ReplicaLabels: labels})
+		}
+	}
+	sort.Slice(status.Tenants, func(i, j int) bool { return status.Tenants[i].Tenant < status.Tenants[j].Tenant })
+	return status, nil, nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc/metadata"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestNewTenantReplicaLabels(t *testing.T) {
+	testutil.Assert(t, NewTenantReplicaLabels(receive.DefaultTenantHeader, TenantLimitsConfig{}) == nil, "expected no tenant replica labels")
+	testutil.Assert(t, NewTenantReplicaLabels(receive.DefaultTenantHeader, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+		"team-a": {MaxSamples: 10},
+	}}) == nil, "expected no tenant replica labels")
+
+	cfg, err := ParseTenantLimitsConfig([]byte(`
+tenants:
+  team-a:
+    replica_labels: [pod_replica]
+  team-b:
+    replica_labels: []
+  team-c:
+    max_samples: 10
+`))
+	testutil.Ok(t, err)
+	l := NewTenantReplicaLabels(receive.DefaultTenantHeader, cfg)
+	testutil.Assert(t, l != nil, "expected tenant replica labels")
+	testutil.Equals(t, map[string][]string{"team-a": {"pod_replica"}, "team-b": {}}, l.tenants)
+
+	// gRPC requests identify their tenant with the metadata named like the header.
+	replicaLabels, ok := l.grpcReplicaLabels(metadata.NewIncomingContext(context.Background(), metadata.Pairs(receive.DefaultTenantHeader, "team-a")))
+	testutil.Assert(t, ok, "expected replica labels of team-a")
+	testutil.Equals(t, []string{"pod_replica"}, replicaLabels)
+	_, ok = l.grpcReplicaLabels(metadata.NewIncomingContext(context.Background(), metadata.Pairs(receive.DefaultTenantHeader, "team-c")))
+	testutil.Assert(t, !ok, "expected no replica labels of team-c")
+	_, ok = l.grpcReplicaLabels(context.Background())
+	testutil.Assert(t, !ok, "expected no replica labels without tenant")
+
+	_, err = ParseTenantLimitsConfig([]byte(`
+tenants:
+  team-a:
+    replica_labels: [""]
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestQueryAPI_TenantReplicaLabels(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "a"),
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "b"),
+		labels.FromStrings("__name__", "up", "job", "db", "pod_replica", "0"),
+		labels.FromStrings("__name__", "up", "job", "db", "pod_replica", "1"),
+	} {
+		for i := int64(0); i < 10; i++ {
+			_, err := app.Append(0, lset, i*60000, float64(i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	qe := promql.NewEngine(promql.EngineOpts{MaxSamples: 10000, Timeout: 100 * time.Second})
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, 100*time.Second, nil, false),
+		queryEngine:     func(int64) *promql.Engine { return qe },
+		replicaLabels:   []string{"replica"},
+		tenantReplicaLabels: NewTenantReplicaLabels(receive.DefaultTenantHeader, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+			"team-a": {ReplicaLabels: []string{"pod_replica"}},
+			"team-b": {ReplicaLabels: []string{}},
+		}}),
+		gate: gate.New(nil, 4),
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		tenant string
+		params url.Values
+
+		expSeries []string
+	}{
+		{
+			name:      "global replica labels",
+			expSeries: []string{`{__name__="up", job="api"}`, `{__name__="up", job="db", pod_replica="0"}`, `{__name__="up", job="db", pod_replica="1"}`},
+		},
+		{
+			name:      "tenant without replica labels",
+			tenant:    "team-c",
+			expSeries: []string{`{__name__="up", job="api"}`, `{__name__="up", job="db", pod_replica="0"}`, `{__name__="up", job="db", pod_replica="1"}`},
+		},
+		{
+			name:      "tenant replica labels",
+			tenant:    "team-a",
+			expSeries: []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`, `{__name__="up", job="db"}`},
+		},
+		{
+			name:      "tenant with empty replica labels",
+			tenant:    "team-b",
+			expSeries: []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`, `{__name__="up", job="db", pod_replica="0"}`, `{__name__="up", job="db", pod_replica="1"}`},
+		},
+		{
+			name:      "request replica labels override the tenant ones",
+			tenant:    "team-a",
+			params:    url.Values{ReplicaLabelsParam: []string{"replica", "pod_replica"}},
+			expSeries: []string{`{__name__="up", job="api"}`, `{__name__="up", job="db"}`},
+		},
+		{
+			name:      "no dedup",
+			tenant:    "team-a",
+			params:    url.Values{DedupParam: []string{"false"}},
+			expSeries: []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`, `{__name__="up", job="db", pod_replica="0"}`, `{__name__="up", job="db", pod_replica="1"}`},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			params := url.Values{"query": []string{"up"}, "time": []string{"300"}}
+			for k, v := range tcase.params {
+				params[k] = v
+			}
+			r, err := http.NewRequest(http.MethodGet, "http://example.com/api/v1/query?"+params.Encode(), nil)
+			testutil.Ok(t, err)
+			if tcase.tenant != "" {
+				r.Header.Set(receive.DefaultTenantHeader, tcase.tenant)
+			}
+
+			data, _, apiErr := api.query(r)
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			var series []string
+			for _, s := range data.(*queryData).Result.(promql.Vector) {
+				series = append(series, s.Metric.String())
+			}
+			sort.Strings(series)
+			testutil.Equals(t, tcase.expSeries, series)
+		})
+	}
+
+	t.Run("status", func(t *testing.T) {
+		data, _, apiErr := api.replicaLabelsStatus(nil)
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		testutil.Equals(t, ReplicaLabelsStatus{
+			Default: []string{"replica"},
+			Tenants: []TenantReplicaLabelsStatus{
+				{Tenant: "team-a", ReplicaLabels: []string{"pod_replica"}},
+				{Tenant: "team-b", ReplicaLabels: []string{}},
+			},
+		}, data)
+	})
+}
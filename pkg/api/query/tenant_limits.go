@@ -0,0 +1,113 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/extprom"
+)
+
+// TenantLimits are the limits of the PromQL engine evaluating the queries of a tenant, how far in the past they can
+// start and the replica labels along which they are deduplicated by default. Unset limits fall back to the global ones.
+type TenantLimits struct {
+	Timeout                   model.Duration `yaml:"timeout"`
+	MaxSamples                int            `yaml:"max_samples"`
+	DefaultEvaluationInterval model.Duration `yaml:"default_evaluation_interval"`
+	MaxLookback               model.Duration `yaml:"max_lookback"`
+	ReplicaLabels             []string       `yaml:"replica_labels"`
+}
+
+func (l TenantLimits) hasEngineLimits() bool {
+	return l.Timeout > 0 || l.MaxSamples > 0 || l.DefaultEvaluationInterval > 0
+}
+
+// TenantLimitsConfig configures the engine limits of tenants.
+type TenantLimitsConfig struct {
+	// Tenants are the limits by tenant, as identified by the tenant header of query requests.
+	Tenants map[string]TenantLimits `yaml:"tenants"`
+}
+
+// ParseTenantLimitsConfig parses the YAML tenant limits configuration.
+func ParseTenantLimitsConfig(content []byte) (TenantLimitsConfig, error) {
+	var cfg TenantLimitsConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return TenantLimitsConfig{}, errors.Wrap(err, "parse tenant limits config")
+	}
+	for tenant, l := range cfg.Tenants {
+		if l.Timeout < 0 || l.MaxSamples < 0 || l.DefaultEvaluationInterval < 0 || l.MaxLookback < 0 {
+			return TenantLimitsConfig{}, errors.Errorf("tenant %q: limits must not be negative", tenant)
+		}
+		for _, label := range l.ReplicaLabels {
+			if label == "" {
+				return TenantLimitsConfig{}, errors.Errorf("tenant %q: replica labels must not be empty", tenant)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// TenantEngines are the engines evaluating the queries of the tenants with limits.
+type TenantEngines struct {
+	header  string
+	engines map[string]tenantEngine
+}
+
+type tenantEngine struct {
+	maxSamples int
+	engine     func(int64) *promql.Engine
+}
+
+// NewTenantEngines returns the engines of the tenants of the configuration with engine limits, as identified by the
+// header. They are created by newEngine from the global engine options, overridden by the limits of the tenant. The
+// engine metrics of each tenant have a tenant label, so the global engine metrics must have an empty one.
+func NewTenantEngines(header string, cfg TenantLimitsConfig, opts promql.EngineOpts, newEngine func(promql.EngineOpts) func(int64) *promql.Engine) *TenantEngines {
+	e := &TenantEngines{header: header, engines: make(map[string]tenantEngine, len(cfg.Tenants))}
+	for tenant, l := range cfg.Tenants {
+		if !l.hasEngineLimits() {
+			continue
+		}
+		o := opts
+		o.Reg = extprom.WrapRegistererWith(prometheus.Labels{"tenant": tenant}, opts.Reg)
+		if l.Timeout > 0 {
+			o.Timeout = time.Duration(l.Timeout)
+		}
+		if l.MaxSamples > 0 {
+			o.MaxSamples = l.MaxSamples
+		}
+		if l.DefaultEvaluationInterval > 0 {
+			interval := time.Duration(l.DefaultEvaluationInterval).Milliseconds()
+			o.NoStepSubqueryIntervalFn = func(int64) int64 { return interval }
+		}
+		e.engines[tenant] = tenantEngine{maxSamples: o.MaxSamples, engine: newEngine(o)}
+	}
+	return e
+}
+
+// engine returns the engine of the tenant of the request with the given max source resolution, and the function
+// annotating errors of too many samples with the limit of the tenant. It returns a nil engine if the tenant has no
+// limits, or on nil TenantEngines.
+func (e *TenantEngines) engine(r *http.Request, maxSourceResolution int64) (*promql.Engine, func(error) error) {
+	if e == nil {
+		return nil, nil
+	}
+	tenant := r.Header.Get(e.header)
+	te, ok := e.engines[tenant]
+	if !ok {
+		return nil, nil
+	}
+	return te.engine(maxSourceResolution), func(err error) error {
+		if _, ok := err.(promql.ErrTooManySamples); ok {
+			return errors.Wrapf(err, "max samples limit of tenant %s is %d", tenant, te.maxSamples)
+		}
+		return err
+	}
+}
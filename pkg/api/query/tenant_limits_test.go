@@ -0,0 +1,140 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestParseTenantLimitsConfig(t *testing.T) {
+	cfg, err := ParseTenantLimitsConfig(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(cfg.Tenants))
+
+	cfg, err = ParseTenantLimitsConfig([]byte(`
+tenants:
+  team-a:
+    timeout: 30s
+    max_samples: 1000
+  team-b:
+    default_evaluation_interval: 5m
+  team-c:
+    max_lookback: 30d
+  team-d:
+    replica_labels: [pod_replica]
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+		"team-a": {Timeout: model.Duration(30 * time.Second), MaxSamples: 1000},
+		"team-b": {DefaultEvaluationInterval: model.Duration(5 * time.Minute)},
+		"team-c": {MaxLookback: model.Duration(30 * 24 * time.Hour)},
+		"team-d": {ReplicaLabels: []string{"pod_replica"}},
+	}}, cfg)
+
+	_, err = ParseTenantLimitsConfig([]byte(`
+tenants:
+  team-a:
+    max_series: 1000
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseTenantLimitsConfig([]byte(`
+tenants:
+  team-a:
+    max_samples: -1
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestQueryAPI_TenantEngines(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "test_metric"), i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	opts := promql.EngineOpts{MaxSamples: 10000, Timeout: 100 * time.Second}
+	qe := promql.NewEngine(opts)
+	var created []promql.EngineOpts
+	tenantEngines := NewTenantEngines(receive.DefaultTenantHeader, TenantLimitsConfig{Tenants: map[string]TenantLimits{
+		"limited":       {MaxSamples: 5},
+		"lookback-only": {MaxLookback: model.Duration(time.Hour)},
+	}}, opts, func(o promql.EngineOpts) func(int64) *promql.Engine {
+		created = append(created, o)
+		e := promql.NewEngine(o)
+		return func(int64) *promql.Engine { return e }
+	})
+	testutil.Equals(t, 1, len(created))
+	testutil.Equals(t, 5, created[0].MaxSamples)
+	testutil.Equals(t, opts.Timeout, created[0].Timeout)
+
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, opts.Timeout, nil, false),
+		queryEngine:     func(int64) *promql.Engine { return qe },
+		tenantEngines:   tenantEngines,
+		gate:            gate.New(nil, 4),
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	for _, tcase := range []struct {
+		tenant      string
+		expectedErr string
+	}{
+		{tenant: ""},
+		{tenant: "unlimited"},
+		{
+			tenant:      "limited",
+			expectedErr: "max samples limit of tenant limited is 5: query processing would load too many samples into memory",
+		},
+	} {
+		t.Run(tcase.tenant, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "http://example.com/api/v1/query_range?"+url.Values{
+				"query": []string{"test_metric"},
+				"start": []string{"0"},
+				"end":   []string{"540"},
+				"step":  []string{"60"},
+			}.Encode(), nil)
+			testutil.Ok(t, err)
+			if tcase.tenant != "" {
+				r.Header.Set(receive.DefaultTenantHeader, tcase.tenant)
+			}
+
+			_, _, apiErr := api.queryRange(r)
+			if tcase.expectedErr == "" {
+				testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+				return
+			}
+			testutil.Assert(t, apiErr != nil, "expected error")
+			testutil.Assert(t, strings.Contains(apiErr.Err.Error(), tcase.expectedErr), apiErr.Err.Error())
+		})
+	}
+}
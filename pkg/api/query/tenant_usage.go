@@ -0,0 +1,170 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/query"
+)
+
+const (
+	// AnonymousTenant is the tenant of query requests without tenant header.
+	AnonymousTenant = "anonymous"
+	// OverflowTenant is the tenant the usage of tenants beyond the maximum number of tracked tenants is accounted to.
+	OverflowTenant = "__overflow__"
+)
+
+// TenantUsage is the cost of the queries of a tenant.
+type TenantUsage struct {
+	Queries          int64   `json:"queries"`
+	SamplesProcessed int64   `json:"samplesProcessed"`
+	SeriesFetched    int64   `json:"seriesFetched"`
+	BytesFetched     int64   `json:"bytesFetched"`
+	EngineSeconds    float64 `json:"engineSeconds"`
+}
+
+// TenantUsageTracker accounts the cost of instant and range queries per tenant, as identified by the tenant header of
+// query requests. To bound the cardinality of its metrics, only the first maxTenants tenants are accounted
+// separately, the usage of the others is accounted to OverflowTenant.
+type TenantUsageTracker struct {
+	header     string
+	maxTenants int
+	start      time.Time
+
+	mtx     sync.Mutex
+	tenants map[string]*TenantUsage
+
+	queries          *prometheus.CounterVec
+	samplesProcessed *prometheus.CounterVec
+	seriesFetched    *prometheus.CounterVec
+	bytesFetched     *prometheus.CounterVec
+	engineSeconds    *prometheus.CounterVec
+}
+
+// NewTenantUsageTracker returns a TenantUsageTracker accounting the usage of at most maxTenants tenants separately.
+func NewTenantUsageTracker(reg prometheus.Registerer, header string, maxTenants int) *TenantUsageTracker {
+	return &TenantUsageTracker{
+		header:     header,
+		maxTenants: maxTenants,
+		start:      time.Now(),
+		tenants:    map[string]*TenantUsage{},
+		queries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_tenant_queries_total",
+			Help: "Total number of instant and range queries evaluated by tenant.",
+		}, []string{"tenant"}),
+		samplesProcessed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_tenant_samples_processed_total",
+			Help: "Total number of samples processed by the PromQL engine for the queries of each tenant.",
+		}, []string{"tenant"}),
+		seriesFetched: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_tenant_series_fetched_total",
+			Help: "Total number of series fetched from the stores for the queries of each tenant.",
+		}, []string{"tenant"}),
+		bytesFetched: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_tenant_bytes_fetched_total",
+			Help: "Total size of the series fetched from the stores for the queries of each tenant.",
+		}, []string{"tenant"}),
+		engineSeconds: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_tenant_engine_seconds_total",
+			Help: "Total wall-clock time spent by the PromQL engine evaluating the queries of each tenant.",
+		}, []string{"tenant"}),
+	}
+}
+
+// tenant returns the tenant of the request, AnonymousTenant if it has none.
+func (t *TenantUsageTracker) tenant(r *http.Request) string {
+	if tenant := r.Header.Get(t.header); tenant != "" {
+		return tenant
+	}
+	return AnonymousTenant
+}
+
+// add accounts the usage of a query of the tenant. It is a no-op on a nil TenantUsageTracker.
+func (t *TenantUsageTracker) add(tenant string, u TenantUsage) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	tu, ok := t.tenants[tenant]
+	if !ok {
+		if len(t.tenants) >= t.maxTenants {
+			tenant = OverflowTenant
+			tu = t.tenants[tenant]
+		}
+		if tu == nil {
+			tu = &TenantUsage{}
+			t.tenants[tenant] = tu
+		}
+	}
+	tu.Queries += u.Queries
+	tu.SamplesProcessed += u.SamplesProcessed
+	tu.SeriesFetched += u.SeriesFetched
+	tu.BytesFetched += u.BytesFetched
+	tu.EngineSeconds += u.EngineSeconds
+	t.mtx.Unlock()
+
+	t.queries.WithLabelValues(tenant).Add(float64(u.Queries))
+	t.samplesProcessed.WithLabelValues(tenant).Add(float64(u.SamplesProcessed))
+	t.seriesFetched.WithLabelValues(tenant).Add(float64(u.SeriesFetched))
+	t.bytesFetched.WithLabelValues(tenant).Add(float64(u.BytesFetched))
+	t.engineSeconds.WithLabelValues(tenant).Add(u.EngineSeconds)
+}
+
+// track returns the context making the querier account the data fetched for the query of the request, and the
+// function accounting the usage of the query to the tenant of the request once the engine evaluated it in the given
+// time. It is a no-op on a nil TenantUsageTracker.
+func (t *TenantUsageTracker) track(ctx context.Context, r *http.Request) (context.Context, func(qry promql.Query, engineTime time.Duration)) {
+	if t == nil {
+		return ctx, func(promql.Query, time.Duration) {}
+	}
+	tenant := t.tenant(r)
+	ctx, qu := query.NewContextWithQueryUsage(ctx)
+	return ctx, func(qry promql.Query, engineTime time.Duration) {
+		u := TenantUsage{
+			Queries:       1,
+			SeriesFetched: qu.SeriesFetched(),
+			BytesFetched:  qu.BytesFetched(),
+			EngineSeconds: engineTime.Seconds(),
+		}
+		if s := qry.Stats(); s != nil && s.Samples != nil {
+			u.SamplesProcessed = s.Samples.TotalSamples
+		}
+		t.add(tenant, u)
+	}
+}
+
+// TenantUsageSummary is the usage of the tenants since the start of the querier.
+type TenantUsageSummary struct {
+	Since   time.Time              `json:"since"`
+	Tenants map[string]TenantUsage `json:"tenants"`
+}
+
+// Summary returns the usage of the tenants since the start of the querier.
+func (t *TenantUsageTracker) Summary() TenantUsageSummary {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	s := TenantUsageSummary{Since: t.start, Tenants: make(map[string]TenantUsage, len(t.tenants))}
+	for tenant, u := range t.tenants {
+		s.Tenants[tenant] = *u
+	}
+	return s
+}
+
+func (qapi *QueryAPI) tenantUsageHandler(_ *http.Request) (interface{}, []error, *api.ApiError) {
+	if qapi.tenantUsage == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("tenant usage accounting is disabled")}
+	}
+	return qapi.tenantUsage.Summary(), nil, nil
+}
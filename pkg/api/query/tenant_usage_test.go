@@ -0,0 +1,109 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	baseAPI "github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestTenantUsageTracker_Overflow(t *testing.T) {
+	tracker := NewTenantUsageTracker(prometheus.NewRegistry(), receive.DefaultTenantHeader, 2)
+	for _, tenant := range []string{"team-a", "team-b", "team-c", "team-a", "team-d"} {
+		tracker.add(tenant, TenantUsage{Queries: 1, SeriesFetched: 10})
+	}
+
+	summary := tracker.Summary()
+	testutil.Equals(t, map[string]TenantUsage{
+		"team-a":       {Queries: 2, SeriesFetched: 20},
+		"team-b":       {Queries: 1, SeriesFetched: 10},
+		OverflowTenant: {Queries: 2, SeriesFetched: 20},
+	}, summary.Tenants)
+	testutil.Equals(t, 2.0, promtest.ToFloat64(tracker.queries.WithLabelValues(OverflowTenant)))
+	testutil.Equals(t, 20.0, promtest.ToFloat64(tracker.seriesFetched.WithLabelValues("team-a")))
+
+	var disabled *TenantUsageTracker
+	disabled.add("team-a", TenantUsage{Queries: 1})
+}
+
+func TestQueryAPI_TenantUsage(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "test_metric", "instance", "a"),
+		labels.FromStrings("__name__", "test_metric", "instance", "b"),
+	} {
+		for i := int64(0); i < 10; i++ {
+			_, err := app.Append(0, lset, i*60000, float64(i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	qe := promql.NewEngine(promql.EngineOpts{MaxSamples: 10000, Timeout: 100 * time.Second})
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, 100*time.Second, nil, false),
+		queryEngine:     func(int64) *promql.Engine { return qe },
+		tenantHeader:    receive.DefaultTenantHeader,
+		gate:            gate.New(nil, 4),
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	_, _, apiErr := api.tenantUsageHandler(nil)
+	testutil.Assert(t, apiErr != nil, "expected error while tenant usage accounting is disabled")
+
+	api.tenantUsage = NewTenantUsageTracker(prometheus.NewRegistry(), receive.DefaultTenantHeader, 10)
+	for _, tenant := range []string{"team-a", ""} {
+		r, err := http.NewRequest(http.MethodGet, "http://example.com/api/v1/query_range?"+url.Values{
+			"query": []string{"test_metric"},
+			"start": []string{"0"},
+			"end":   []string{"540"},
+			"step":  []string{"60"},
+		}.Encode(), nil)
+		testutil.Ok(t, err)
+		if tenant != "" {
+			r.Header.Set(receive.DefaultTenantHeader, tenant)
+		}
+		_, _, apiErr := api.queryRange(r)
+		testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+	}
+
+	res, _, apiErr := api.tenantUsageHandler(nil)
+	testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+	summary := res.(TenantUsageSummary)
+	testutil.Equals(t, 2, len(summary.Tenants))
+	for _, tenant := range []string{"team-a", AnonymousTenant} {
+		u, ok := summary.Tenants[tenant]
+		testutil.Assert(t, ok, "missing usage of tenant %s", tenant)
+		testutil.Equals(t, int64(1), u.Queries)
+		testutil.Equals(t, int64(20), u.SamplesProcessed)
+		testutil.Equals(t, int64(2), u.SeriesFetched)
+		testutil.Assert(t, u.BytesFetched > 0, "no bytes fetched")
+		testutil.Assert(t, u.EngineSeconds > 0, "no engine time")
+	}
+}
@@ -20,7 +20,11 @@
 package v1
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"sort"
@@ -35,15 +39,18 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
 
 	"github.com/prometheus/prometheus/util/stats"
 
 	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/exemplars"
 	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
@@ -55,6 +62,9 @@ import (
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/server/http/middleware"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/targets"
 	"github.com/thanos-io/thanos/pkg/targets/targetspb"
@@ -68,8 +78,12 @@ const (
 	ReplicaLabelsParam       = "replicaLabels[]"
 	MatcherParam             = "match[]"
 	StoreMatcherParam        = "storeMatch[]"
+	StoreTypeParam           = "storeType[]"
 	Step                     = "step"
 	Stats                    = "stats"
+
+	// StoreTypeHeader restricts the request to the stores of the given comma separated types, like StoreTypeParam.
+	StoreTypeHeader = "X-Thanos-Store-Type"
 )
 
 // QueryAPI is an API used by Thanos Querier.
@@ -80,10 +94,23 @@ type QueryAPI struct {
 	queryableCreate query.QueryableCreator
 	// queryEngine returns appropriate promql.Engine for a query with a given step.
 	queryEngine func(int64) *promql.Engine
-	ruleGroups  rules.UnaryClient
-	targets     targets.UnaryClient
-	metadatas   metadata.UnaryClient
-	exemplars   exemplars.UnaryClient
+	// engineFeatures are the optional PromQL features enabled in the query engines.
+	engineFeatures EngineFeatures
+	ruleGroups     rules.UnaryClient
+	targets        targets.UnaryClient
+	metadatas      metadata.UnaryClient
+	exemplars      exemplars.UnaryClient
+	// tenantEngines are the engines of the tenants with their own engine limits.
+	tenantEngines *TenantEngines
+	// maxLookback limits how far in the past queries can start, nil if unlimited.
+	maxLookback *MaxLookback
+	// tenantReplicaLabels are the replica labels of the tenants overriding replicaLabels, nil if none.
+	tenantReplicaLabels *TenantReplicaLabels
+	// tenantHeader is the header identifying the tenant of query requests.
+	tenantHeader  string
+	activeQueries *query.ActiveQueryTracker
+	// tenantUsage accounts the cost of queries per tenant, nil if disabled.
+	tenantUsage *TenantUsageTracker
 
 	enableAutodownsampling              bool
 	enableQueryPartialResponse          bool
@@ -96,19 +123,40 @@ type QueryAPI struct {
 
 	replicaLabels  []string
 	endpointStatus func() []query.EndpointStatus
+	// matchStores tells which stores a Series request with the given label matchers and time range is sent to.
+	matchStores func(ctx context.Context, mint, maxt int64, matchers ...*labels.Matcher) ([]store.StoreMatch, error)
 
 	defaultRangeQueryStep                  time.Duration
 	defaultInstantQueryMaxSourceResolution time.Duration
 	defaultMetadataTimeRange               time.Duration
 
+	// maxResponseBytes is the maximum size of the responses of queries, 0 means unlimited.
+	maxResponseBytes int64
+	// cardinalityMaxSeries is the maximum number of series fetched from the stores by a cardinality request, 0 means
+	// unlimited.
+	cardinalityMaxSeries int
+	// cacheImmutableAfter is the age of the end of queries after which their responses are cacheable for
+	// cacheMaxAge, 0 disables the Cache-Control headers of query responses.
+	cacheImmutableAfter time.Duration
+	cacheMaxAge         time.Duration
+
 	queryRangeHist prometheus.Histogram
+	responseSize   *prometheus.HistogramVec
 }
 
 // NewQueryAPI returns an initialized QueryAPI type.
 func NewQueryAPI(
 	logger log.Logger,
 	endpointStatus func() []query.EndpointStatus,
+	matchStores func(ctx context.Context, mint, maxt int64, matchers ...*labels.Matcher) ([]store.StoreMatch, error),
 	qe func(int64) *promql.Engine,
+	engineFeatures EngineFeatures,
+	tenantEngines *TenantEngines,
+	maxLookback *MaxLookback,
+	tenantReplicaLabels *TenantReplicaLabels,
+	tenantHeader string,
+	activeQueries *query.ActiveQueryTracker,
+	tenantUsage *TenantUsageTracker,
 	c query.QueryableCreator,
 	ruleGroups rules.UnaryClient,
 	targets targets.UnaryClient,
@@ -128,18 +176,29 @@ func NewQueryAPI(
 	defaultMetadataTimeRange time.Duration,
 	disableCORS bool,
 	gate gate.Gate,
+	maxResponseBytes int64,
+	cardinalityMaxSeries int,
+	cacheImmutableAfter time.Duration,
+	cacheMaxAge time.Duration,
 	reg *prometheus.Registry,
 ) *QueryAPI {
 	return &QueryAPI{
-		baseAPI:         api.NewBaseAPI(logger, disableCORS, flagsMap),
-		logger:          logger,
-		queryEngine:     qe,
-		queryableCreate: c,
-		gate:            gate,
-		ruleGroups:      ruleGroups,
-		targets:         targets,
-		metadatas:       metadatas,
-		exemplars:       exemplars,
+		baseAPI:             api.NewBaseAPI(logger, disableCORS, flagsMap),
+		logger:              logger,
+		queryEngine:         qe,
+		engineFeatures:      engineFeatures,
+		tenantEngines:       tenantEngines,
+		maxLookback:         maxLookback,
+		tenantHeader:        tenantHeader,
+		tenantReplicaLabels: tenantReplicaLabels,
+		activeQueries:       activeQueries,
+		tenantUsage:         tenantUsage,
+		queryableCreate:     c,
+		gate:                gate,
+		ruleGroups:          ruleGroups,
+		targets:             targets,
+		metadatas:           metadatas,
+		exemplars:           exemplars,
 
 		enableAutodownsampling:                 enableAutodownsampling,
 		enableQueryPartialResponse:             enableQueryPartialResponse,
@@ -150,16 +209,26 @@ func NewQueryAPI(
 		enableQueryPushdown:                    enableQueryPushdown,
 		replicaLabels:                          replicaLabels,
 		endpointStatus:                         endpointStatus,
+		matchStores:                            matchStores,
 		defaultRangeQueryStep:                  defaultRangeQueryStep,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
 		defaultMetadataTimeRange:               defaultMetadataTimeRange,
 		disableCORS:                            disableCORS,
+		maxResponseBytes:                       maxResponseBytes,
+		cardinalityMaxSeries:                   cardinalityMaxSeries,
+		cacheImmutableAfter:                    cacheImmutableAfter,
+		cacheMaxAge:                            cacheMaxAge,
 
 		queryRangeHist: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 			Name:    "thanos_query_range_requested_timespan_duration_seconds",
 			Help:    "A histogram of the query range window in seconds",
 			Buckets: prometheus.ExponentialBuckets(15*60, 2, 12),
 		}),
+		responseSize: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_query_response_size_bytes",
+			Help:    "Size of the responses of queries in bytes, before compression.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+		}, []string{"handler"}),
 	}
 }
 
@@ -169,11 +238,11 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 
 	instr := api.GetInstr(tracer, logger, ins, logMiddleware, qapi.disableCORS)
 
-	r.Get("/query", instr("query", qapi.query))
-	r.Post("/query", instr("query", qapi.query))
+	r.Get("/query", instr("query", qapi.streamed("query", "time", qapi.query)))
+	r.Post("/query", instr("query", qapi.streamed("query", "time", qapi.query)))
 
-	r.Get("/query_range", instr("query_range", qapi.queryRange))
-	r.Post("/query_range", instr("query_range", qapi.queryRange))
+	r.Get("/query_range", instr("query_range", qapi.streamed("query_range", "end", qapi.queryRange)))
+	r.Post("/query_range", instr("query_range", qapi.streamed("query_range", "end", qapi.queryRange)))
 
 	r.Get("/label/:name/values", instr("label_values", qapi.labelValues))
 
@@ -183,7 +252,18 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Get("/labels", instr("label_names", qapi.labelNames))
 	r.Post("/labels", instr("label_names", qapi.labelNames))
 
+	r.Get("/queries/active", instr("active_queries", qapi.activeQueriesHandler))
+
+	r.Get("/tenant_usage", instr("tenant_usage", qapi.tenantUsageHandler))
+
+	r.Get("/status/engine", instr("status_engine", qapi.engineStatus))
+	r.Get("/status/cardinality", instr("status_cardinality", qapi.cardinality))
+	r.Post("/status/cardinality", instr("status_cardinality", qapi.cardinality))
+
 	r.Get("/stores", instr("stores", qapi.stores))
+	r.Get("/stores/replica_labels", instr("replica_labels", qapi.replicaLabelsStatus))
+	r.Get("/stores/match", instr("stores_match", qapi.storesMatch))
+	r.Post("/stores/match", instr("stores_match", qapi.storesMatch))
 
 	r.Get("/alerts", instr("alerts", NewAlertsHandler(qapi.ruleGroups, qapi.enableRulePartialResponse)))
 	r.Get("/rules", instr("rules", NewRulesHandler(qapi.ruleGroups, qapi.enableRulePartialResponse)))
@@ -194,6 +274,15 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 
 	r.Get("/query_exemplars", instr("exemplars", NewExemplarsHandler(qapi.exemplars, qapi.enableExemplarPartialResponse)))
 	r.Post("/query_exemplars", instr("exemplars", NewExemplarsHandler(qapi.exemplars, qapi.enableExemplarPartialResponse)))
+
+	// Remote read responses are snappy compressed protobufs, so they are not wrapped like the JSON APIs.
+	r.Post("/read", tracing.HTTPMiddleware(tracer, "read", logger,
+		ins.NewHandler("read",
+			middleware.RequestID(
+				logMiddleware.HTTPMiddleware("read", http.HandlerFunc(qapi.remoteRead)),
+			),
+		),
+	))
 }
 
 type queryData struct {
@@ -202,6 +291,224 @@ type queryData struct {
 	Stats      stats.QueryStats `json:"stats,omitempty"`
 	// Additional Thanos Response field.
 	Warnings []error `json:"warnings,omitempty"`
+	// PartialResponseWarnings are the stores whose data is missing from the partial response.
+	PartialResponseWarnings []store.StoreFailure `json:"partialResponseWarnings,omitempty"`
+}
+
+// encodeJSON writes the JSON encoding of the query data to w, encoding the series of matrix results one by one so that
+// large matrices are not entirely encoded in memory.
+func (qd *queryData) encodeJSON(w io.Writer) error {
+	m, ok := qd.Result.(promql.Matrix)
+	if !ok {
+		b, err := json.Marshal(qd)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	rest := *qd
+	rest.Result = nil
+	b, err := json.Marshal(&rest)
+	if err != nil {
+		return err
+	}
+	resultType, err := json.Marshal(qd.ResultType)
+	if err != nil {
+		return err
+	}
+	// The result is the second field of the encoding, the other ones are written after the series.
+	prefix := []byte(`{"resultType":` + string(resultType) + `,"result":`)
+	if !bytes.HasPrefix(b, append(prefix, "null"...)) {
+		return errors.Errorf("unexpected encoding of query data %q", b)
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	sep := []byte{'['}
+	for _, series := range m {
+		sb, err := json.Marshal(series)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(sep, sb...)); err != nil {
+			return err
+		}
+		sep = []byte{','}
+	}
+	if len(m) == 0 {
+		if _, err := w.Write(sep); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write([]byte{']'}); err != nil {
+		return err
+	}
+	_, err = w.Write(b[len(prefix)+len("null"):])
+	return err
+}
+
+// streamed returns the handler streaming the query data returned by f to the response, up to the maximum response size.
+// The end of the queries is given by the endParam parameter of the requests.
+func (qapi *QueryAPI) streamed(handler, endParam string, f api.ApiFunc) api.ApiFunc {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		data, warnings, apiErr := f(r)
+		qd, ok := data.(*queryData)
+		if apiErr != nil || !ok {
+			return data, warnings, apiErr
+		}
+		return &api.StreamedData{
+			Encode:   qd.encodeJSON,
+			MaxBytes: qapi.maxResponseBytes,
+			Written: func(size int64) {
+				qapi.responseSize.WithLabelValues(handler).Observe(float64(size))
+			},
+			CacheControl: qapi.cacheControl(r, endParam, qd),
+		}, warnings, nil
+	}
+}
+
+// cacheControl returns the Cache-Control header of the response of the query data to the request. Responses of queries
+// whose data is older than the immutability threshold can be cached by any intermediary. Partial responses must never
+// be stored, which the query frontend respects too. The responses of other queries must be revalidated, but the query
+// frontend still caches them, as it only caches the data older than its max freshness.
+func (qapi *QueryAPI) cacheControl(r *http.Request, endParam string, qd *queryData) string {
+	if qapi.cacheImmutableAfter <= 0 {
+		return ""
+	}
+	if len(qd.Warnings) > 0 || len(qd.PartialResponseWarnings) > 0 {
+		return "no-store"
+	}
+	now := qapi.baseAPI.Now()
+	end, err := parseTimeParam(r, endParam, now)
+	if err != nil {
+		return "no-cache"
+	}
+	expr, err := parser.ParseExpr(r.FormValue("query"))
+	if err != nil || now.Sub(latestQueriedTime(expr, end)) < qapi.cacheImmutableAfter {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(qapi.cacheMaxAge/time.Second))
+}
+
+// latestQueriedTime returns the latest time the selectors of the expression evaluated up to end select data at, as @
+// modifiers and negative offsets can select data after the end of the query.
+func latestQueriedTime(expr parser.Expr, end time.Time) time.Time {
+	latest := end
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		var (
+			ts     *int64
+			offset time.Duration
+		)
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			ts, offset = n.Timestamp, n.OriginalOffset
+		case *parser.SubqueryExpr:
+			ts, offset = n.Timestamp, n.OriginalOffset
+		default:
+			return nil
+		}
+		t := end
+		if ts != nil {
+			t = timestamp.Time(*ts)
+		}
+		if t = t.Add(-offset); t.After(latest) {
+			latest = t
+		}
+		return nil
+	})
+	return latest
+}
+
+// queryStats extends the Prometheus query statistics with the trace ID of the query, the statistics of its most
+// expensive blocks, the stores which failed to return their data and the types of stores the query was restricted to.
+type queryStats struct {
+	stats.QueryStats
+	TraceID                 string
+	Blocks                  []blockStats
+	PartialResponseWarnings []store.StoreFailure
+	StoreTypes              []string
+}
+
+// blockStats are the statistics of the data of a block fetched by a query, with durations in seconds.
+type blockStats struct {
+	BlockID           string  `json:"blockID"`
+	PostingsTouched   int64   `json:"postingsTouched"`
+	SeriesFetched     int64   `json:"seriesFetched"`
+	ChunksFetched     int64   `json:"chunksFetched"`
+	PostingsFetchTime float64 `json:"postingsFetchTime"`
+	SeriesFetchTime   float64 `json:"seriesFetchTime"`
+	ChunksFetchTime   float64 `json:"chunksFetchTime"`
+}
+
+// newQueryStats returns the statistics of the executed query, with its trace ID if the query was traced, the
+// statistics of its most expensive blocks, which are also logged to the span of the query, and the store failures.
+func newQueryStats(ctx context.Context, qry promql.Query, bs *query.BlockStats, failures []store.StoreFailure) stats.QueryStats {
+	qs := queryStats{QueryStats: stats.NewQueryStats(qry.Stats()), PartialResponseWarnings: failures}
+	qs.TraceID, _ = tracing.TraceIDFromContext(ctx)
+	for _, t := range store.StoreTypesFromContext(ctx) {
+		qs.StoreTypes = append(qs.StoreTypes, t.String())
+	}
+
+	span := tracing.SpanFromContext(ctx)
+	for _, b := range bs.Top(hintspb.MaxBlockStats) {
+		s := blockStats{
+			BlockID:           b.BlockId,
+			PostingsTouched:   b.PostingsTouched,
+			SeriesFetched:     b.SeriesFetched,
+			ChunksFetched:     b.ChunksFetched,
+			PostingsFetchTime: time.Duration(b.PostingsFetchDurationNs).Seconds(),
+			SeriesFetchTime:   time.Duration(b.SeriesFetchDurationNs).Seconds(),
+			ChunksFetchTime:   time.Duration(b.ChunksFetchDurationNs).Seconds(),
+		}
+		qs.Blocks = append(qs.Blocks, s)
+		span.LogKV(
+			"block.id", s.BlockID,
+			"block.postings_touched", s.PostingsTouched,
+			"block.series_fetched", s.SeriesFetched,
+			"block.chunks_fetched", s.ChunksFetched,
+			"block.postings_fetch_time", s.PostingsFetchTime,
+			"block.series_fetch_time", s.SeriesFetchTime,
+			"block.chunks_fetch_time", s.ChunksFetchTime,
+		)
+	}
+	return qs
+}
+
+// MarshalJSON implements json.Marshaler, adding the traceID, blocks, partialResponseWarnings and storeTypes fields to
+// the fields of the Prometheus query statistics.
+func (s queryStats) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(s.QueryStats)
+	if err != nil || (s.TraceID == "" && len(s.Blocks) == 0 && len(s.PartialResponseWarnings) == 0 && len(s.StoreTypes) == 0) {
+		return b, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	if s.TraceID != "" {
+		if fields["traceID"], err = json.Marshal(s.TraceID); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Blocks) > 0 {
+		if fields["blocks"], err = json.Marshal(s.Blocks); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.PartialResponseWarnings) > 0 {
+		if fields["partialResponseWarnings"], err = json.Marshal(s.PartialResponseWarnings); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.StoreTypes) > 0 {
+		if fields["storeTypes"], err = json.Marshal(s.StoreTypes); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
 }
 
 func (qapi *QueryAPI) parseEnableDedupParam(r *http.Request) (enableDeduplication bool, _ *api.ApiError) {
@@ -223,7 +530,11 @@ func (qapi *QueryAPI) parseReplicaLabelsParam(r *http.Request) (replicaLabels []
 	}
 
 	replicaLabels = qapi.replicaLabels
-	// Overwrite the cli flag when provided as a query parameter.
+	// Overwrite the cli flag with the replica labels of the tenant of the request, if any.
+	if tenantLabels, ok := qapi.tenantReplicaLabels.replicaLabels(r); ok {
+		replicaLabels = tenantLabels
+	}
+	// Overwrite both when provided as a query parameter.
 	if len(r.Form[ReplicaLabelsParam]) > 0 {
 		replicaLabels = r.Form[ReplicaLabelsParam]
 	}
@@ -247,11 +558,26 @@ func (qapi *QueryAPI) parseStoreDebugMatchersParam(r *http.Request) (storeMatche
 	return storeMatchers, nil
 }
 
+// parseStoreTypesParam returns the types of stores the request is restricted to, given with the storeType[]
+// parameter or the X-Thanos-Store-Type header. All stores are queried if none is given.
+func (qapi *QueryAPI) parseStoreTypesParam(r *http.Request) (storeTypes []component.StoreAPI, _ *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
+	}
+
+	names := append(append([]string{}, r.Form[StoreTypeParam]...), r.Header.Values(StoreTypeHeader)...)
+	storeTypes, err := store.ParseStoreTypes(names)
+	if err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", StoreTypeParam)}
+	}
+	return storeTypes, nil
+}
+
 func (qapi *QueryAPI) parseDownsamplingParamMillis(r *http.Request, defaultVal time.Duration) (maxResolutionMillis int64, _ *api.ApiError) {
 	maxSourceResolution := 0 * time.Second
 
 	val := r.FormValue(MaxSourceResolutionParam)
-	if qapi.enableAutodownsampling || (val == "auto") {
+	if qapi.isAutoDownsampling(r) {
 		maxSourceResolution = defaultVal
 	}
 	if val != "" && val != "auto" {
@@ -269,6 +595,12 @@ func (qapi *QueryAPI) parseDownsamplingParamMillis(r *http.Request, defaultVal t
 	return int64(maxSourceResolution / time.Millisecond), nil
 }
 
+// isAutoDownsampling returns true if the maximum source resolution is chosen automatically for the request.
+func (qapi *QueryAPI) isAutoDownsampling(r *http.Request) bool {
+	val := r.FormValue(MaxSourceResolutionParam)
+	return val == "auto" || (qapi.enableAutodownsampling && val == "")
+}
+
 func (qapi *QueryAPI) parsePartialResponseParam(r *http.Request, defaultEnablePartialResponse bool) (enablePartialResponse bool, _ *api.ApiError) {
 	// Overwrite the cli flag when provided as a query parameter.
 	if val := r.FormValue(PartialResponseParam); val != "" {
@@ -296,12 +628,29 @@ func (qapi *QueryAPI) parseStep(r *http.Request, defaultRangeQueryStep time.Dura
 	return d, nil
 }
 
+// engine returns the engine evaluating the query of the request with the given max source resolution, using the limits
+// of the tenant of the request if it has some, and the function annotating the errors of the engine.
+func (qapi *QueryAPI) engine(r *http.Request, maxSourceResolution int64) (*promql.Engine, func(error) error) {
+	if qe, annotateErr := qapi.tenantEngines.engine(r, maxSourceResolution); qe != nil {
+		return qe, annotateErr
+	}
+	return qapi.queryEngine(maxSourceResolution), func(err error) error { return err }
+}
+
 func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiError) {
 	ts, err := parseTimeParam(r, "time", qapi.baseAPI.Now())
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
+	_, lookbackWarning, ok, apiErr := qapi.maxLookback.check(r, qapi.baseAPI.Now(), ts, ts, 0)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if !ok {
+		return &queryData{ResultType: parser.ValueTypeVector, Result: promql.Vector{}}, []error{lookbackWarning}, nil
+	}
+
 	ctx := r.Context()
 	if to := r.FormValue("timeout"); to != "" {
 		var cancel context.CancelFunc
@@ -329,6 +678,12 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		return nil, nil, apiErr
 	}
 
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx = store.NewContextWithStoreTypes(ctx, storeTypes)
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr
@@ -339,13 +694,27 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		return nil, nil, apiErr
 	}
 
-	qe := qapi.queryEngine(maxSourceResolution)
+	qe, annotateErr := qapi.engine(r, maxSourceResolution)
 
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_instant_query")
 	defer span.Finish()
 
-	qry, err := qe.NewInstantQuery(qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, qapi.enableQueryPushdown, false), &promql.QueryOpts{}, r.FormValue("query"), ts)
+	// The statistics of the queried blocks are only requested from the stores if the query stats are returned.
+	var bs *query.BlockStats
+	if r.FormValue(Stats) != "" {
+		ctx, bs = query.NewContextWithBlockStats(ctx)
+	}
+	// The stores failing to return their data are only collected if a partial response can be returned.
+	var sf *store.StoreFailures
+	if enablePartialResponse {
+		ctx, sf = store.NewContextWithStoreFailures(ctx)
+	}
+
+	if apiErr := checkEngineCapabilities(r.FormValue("query"), qapi.engineFeatures); apiErr != nil {
+		return nil, nil, apiErr
+	}
+	qry, err := qe.NewInstantQuery(qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, qapi.isAutoDownsampling(r), enablePartialResponse, qapi.enableQueryPushdown, false), &promql.QueryOpts{}, r.FormValue("query"), ts)
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
@@ -359,7 +728,14 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	}
 	defer qapi.gate.Done()
 
+	tq := qapi.activeQueries.Register(r.FormValue("query"), r.Header.Get(qapi.tenantHeader))
+	defer tq.Done()
+	ctx = query.NewContextWithTrackedQuery(ctx, tq)
+
+	ctx, accountUsage := qapi.tenantUsage.track(ctx, r)
+	begin := time.Now()
 	res := qry.Exec(ctx)
+	accountUsage(qry, time.Since(begin))
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -369,18 +745,20 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		case promql.ErrStorage:
 			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: res.Err}
 		}
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: res.Err}
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: annotateErr(res.Err)}
 	}
 
 	// Optional stats field in response if parameter "stats" is not empty.
+	failures := sf.Failures()
 	var qs stats.QueryStats
 	if r.FormValue(Stats) != "" {
-		qs = stats.NewQueryStats(qry.Stats())
+		qs = newQueryStats(ctx, qry, bs, failures)
 	}
 	return &queryData{
-		ResultType: res.Value.Type(),
-		Result:     res.Value,
-		Stats:      qs,
+		ResultType:              res.Value.Type(),
+		Result:                  res.Value,
+		Stats:                   qs,
+		PartialResponseWarnings: failures,
 	}, res.Warnings, nil
 }
 
@@ -415,6 +793,14 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
+	start, lookbackWarning, ok, apiErr := qapi.maxLookback.check(r, qapi.baseAPI.Now(), start, end, step)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if !ok {
+		return &queryData{ResultType: parser.ValueTypeMatrix, Result: promql.Matrix{}}, []error{lookbackWarning}, nil
+	}
+
 	ctx := r.Context()
 	if to := r.FormValue("timeout"); to != "" {
 		var cancel context.CancelFunc
@@ -442,6 +828,12 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx = store.NewContextWithStoreTypes(ctx, storeTypes)
+
 	// If no max_source_resolution is specified fit at least 5 samples between steps.
 	maxSourceResolution, apiErr := qapi.parseDownsamplingParamMillis(r, step/5)
 	if apiErr != nil {
@@ -453,7 +845,7 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
-	qe := qapi.queryEngine(maxSourceResolution)
+	qe, annotateErr := qapi.engine(r, maxSourceResolution)
 
 	// Record the query range requested.
 	qapi.queryRangeHist.Observe(end.Sub(start).Seconds())
@@ -462,8 +854,22 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	span, ctx := tracing.StartSpan(ctx, "promql_range_query")
 	defer span.Finish()
 
+	// The statistics of the queried blocks are only requested from the stores if the query stats are returned.
+	var bs *query.BlockStats
+	if r.FormValue(Stats) != "" {
+		ctx, bs = query.NewContextWithBlockStats(ctx)
+	}
+	// The stores failing to return their data are only collected if a partial response can be returned.
+	var sf *store.StoreFailures
+	if enablePartialResponse {
+		ctx, sf = store.NewContextWithStoreFailures(ctx)
+	}
+
+	if apiErr := checkEngineCapabilities(r.FormValue("query"), qapi.engineFeatures); apiErr != nil {
+		return nil, nil, apiErr
+	}
 	qry, err := qe.NewRangeQuery(
-		qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, qapi.enableQueryPushdown, false),
+		qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, qapi.isAutoDownsampling(r), enablePartialResponse, qapi.enableQueryPushdown, false),
 		&promql.QueryOpts{},
 		r.FormValue("query"),
 		start,
@@ -483,7 +889,14 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	}
 	defer qapi.gate.Done()
 
+	tq := qapi.activeQueries.Register(r.FormValue("query"), r.Header.Get(qapi.tenantHeader))
+	defer tq.Done()
+	ctx = query.NewContextWithTrackedQuery(ctx, tq)
+
+	ctx, accountUsage := qapi.tenantUsage.track(ctx, r)
+	begin := time.Now()
 	res := qry.Exec(ctx)
+	accountUsage(qry, time.Since(begin))
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -491,19 +904,25 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		case promql.ErrQueryTimeout:
 			return nil, nil, &api.ApiError{Typ: api.ErrorTimeout, Err: res.Err}
 		}
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: res.Err}
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: annotateErr(res.Err)}
 	}
 
 	// Optional stats field in response if parameter "stats" is not empty.
+	failures := sf.Failures()
 	var qs stats.QueryStats
 	if r.FormValue(Stats) != "" {
-		qs = stats.NewQueryStats(qry.Stats())
+		qs = newQueryStats(ctx, qry, bs, failures)
+	}
+	warnings := res.Warnings
+	if lookbackWarning != nil {
+		warnings = append(warnings, lookbackWarning)
 	}
 	return &queryData{
-		ResultType: res.Value.Type(),
-		Result:     res.Value,
-		Stats:      qs,
-	}, res.Warnings, nil
+		ResultType:              res.Value.Type(),
+		Result:                  res.Value,
+		Stats:                   qs,
+		PartialResponseWarnings: failures,
+	}, warnings, nil
 }
 
 func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.ApiError) {
@@ -529,6 +948,12 @@ func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.A
 		return nil, nil, apiErr
 	}
 
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx = store.NewContextWithStoreTypes(ctx, storeTypes)
+
 	var matcherSets [][]*labels.Matcher
 	for _, s := range r.Form[MatcherParam] {
 		matchers, err := parser.ParseMetricSelector(s)
@@ -538,7 +963,7 @@ func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.A
 		matcherSets = append(matcherSets, matchers)
 	}
 
-	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, qapi.enableQueryPushdown, true).
+	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, false, enablePartialResponse, qapi.enableQueryPushdown, true).
 		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
@@ -620,13 +1045,19 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		return nil, nil, apiErr
 	}
 
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx := store.NewContextWithStoreTypes(r.Context(), storeTypes)
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
-	q, err := qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, enablePartialResponse, qapi.enableQueryPushdown, true).
-		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	q, err := qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, false, enablePartialResponse, qapi.enableQueryPushdown, true).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
 	}
@@ -666,6 +1097,12 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx := store.NewContextWithStoreTypes(r.Context(), storeTypes)
+
 	var matcherSets [][]*labels.Matcher
 	for _, s := range r.Form[MatcherParam] {
 		matchers, err := parser.ParseMetricSelector(s)
@@ -675,8 +1112,8 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 		matcherSets = append(matcherSets, matchers)
 	}
 
-	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, qapi.enableQueryPushdown, true).
-		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, false, enablePartialResponse, qapi.enableQueryPushdown, true).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
 	}
@@ -720,6 +1157,14 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 	return names, warnings, nil
 }
 
+// activeQueriesHandler returns the queries being executed by the querier.
+func (qapi *QueryAPI) activeQueriesHandler(_ *http.Request) (interface{}, []error, *api.ApiError) {
+	if active := qapi.activeQueries.Active(); active != nil {
+		return active, nil, nil
+	}
+	return []query.ActiveQuery{}, nil, nil
+}
+
 func (qapi *QueryAPI) stores(_ *http.Request) (interface{}, []error, *api.ApiError) {
 	statuses := make(map[string][]query.EndpointStatus)
 	for _, status := range qapi.endpointStatus() {
@@ -732,6 +1177,186 @@ func (qapi *QueryAPI) stores(_ *http.Request) (interface{}, []error, *api.ApiErr
 	return statuses, nil, nil
 }
 
+// StoreMatchStatus tells whether an endpoint would be queried for the label matchers of a request.
+type StoreMatchStatus struct {
+	Name          string `json:"name"`
+	ComponentType string `json:"componentType,omitempty"`
+	Queried       bool   `json:"queried"`
+	// Reason tells why the endpoint would not be queried.
+	Reason string `json:"reason,omitempty"`
+}
+
+// StoresMatch are the endpoint decisions for a single label matcher set.
+type StoresMatch struct {
+	Match  string             `json:"match"`
+	Stores []StoreMatchStatus `json:"stores"`
+}
+
+// storesMatch explains for each known endpoint whether a query selecting the given series in the given time range
+// would be sent to it, as decided by the proxy store for the actual queries.
+func (qapi *QueryAPI) storesMatch(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
+	}
+	if len(r.Form[MatcherParam]) == 0 {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("no match[] parameter provided")}
+	}
+
+	start, end, err := parseMetadataTimeRange(r, qapi.defaultMetadataTimeRange)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+
+	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx := store.NewContextWithStoreTypes(context.WithValue(r.Context(), store.StoreMatcherKey, storeDebugMatchers), storeTypes)
+
+	statuses := qapi.endpointStatus()
+	res := make([]StoresMatch, 0, len(r.Form[MatcherParam]))
+	for _, s := range r.Form[MatcherParam] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		matches, err := qapi.matchStores(ctx, timestamp.FromTime(start), timestamp.FromTime(end), matchers...)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		res = append(res, StoresMatch{Match: s, Stores: storeMatchStatuses(statuses, matches)})
+	}
+	return res, nil, nil
+}
+
+// storeMatchStatuses returns the match status of all given endpoints. Endpoints without a store match are not
+// used by the proxy store at all, because they are unhealthy or do not expose the Store API.
+func storeMatchStatuses(statuses []query.EndpointStatus, matches []store.StoreMatch) []StoreMatchStatus {
+	byAddr := make(map[string]store.StoreMatch, len(matches))
+	for _, m := range matches {
+		byAddr[m.Store.Addr()] = m
+	}
+
+	res := make([]StoreMatchStatus, 0, len(statuses))
+	for _, st := range statuses {
+		ms := StoreMatchStatus{Name: st.Name}
+		if st.ComponentType != nil {
+			ms.ComponentType = st.ComponentType.String()
+		}
+		m, ok := byAddr[st.Name]
+		switch {
+		case ok:
+			ms.Queried, ms.Reason = m.Matches, m.Reason
+			delete(byAddr, st.Name)
+		case st.LastError != nil:
+			ms.Reason = "endpoint unhealthy: " + st.LastError.Error()
+		default:
+			ms.Reason = "endpoint does not expose the Store API"
+		}
+		res = append(res, ms)
+	}
+	// Stores without an endpoint status, like in-process ones.
+	for _, m := range matches {
+		if _, ok := byAddr[m.Store.Addr()]; ok {
+			res = append(res, StoreMatchStatus{Name: m.Store.Addr(), Queried: m.Matches, Reason: m.Reason})
+		}
+	}
+	return res
+}
+
+// Limits of the Prometheus-compatible remote read endpoint, matching the Prometheus defaults.
+const (
+	remoteReadSampleLimit      = 5e7
+	remoteReadMaxBytesPerFrame = 1048576
+)
+
+// remoteRead serves the Prometheus remote read API https://prometheus.io/docs/prometheus/latest/querying/remote_read_api/.
+// Like the query APIs, it honors the Thanos-specific dedup, replica labels, max_source_resolution, partial_response
+// and store type URL parameters.
+func (qapi *QueryAPI) remoteRead(w http.ResponseWriter, r *http.Request) {
+	queryable, apiErr := qapi.requestQueryable(r)
+	if apiErr != nil {
+		http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+	storeTypes, apiErr := qapi.parseStoreTypesParam(r)
+	if apiErr != nil {
+		http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(store.NewContextWithStoreTypes(r.Context(), storeTypes))
+
+	var err error
+	tracing.DoInSpan(r.Context(), "query_gate_ismyturn", func(ctx context.Context) {
+		err = qapi.gate.Start(ctx)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer qapi.gate.Done()
+
+	// Concurrency is already limited by the query gate and there are no external labels to add.
+	remote.NewReadHandler(qapi.logger, nil, sampleAndChunkQueryable{Queryable: queryable}, func() config.Config { return config.Config{} },
+		remoteReadSampleLimit, 1, remoteReadMaxBytesPerFrame).ServeHTTP(w, r)
+}
+
+// requestQueryable returns the queryable of the endpoints selecting series directly, configured by the dedup,
+// replica labels, store debug matchers, max_source_resolution and partial_response URL parameters of the request.
+func (qapi *QueryAPI) requestQueryable(r *http.Request) (storage.Queryable, *api.ApiError) {
+	enableDedup, apiErr := qapi.parseEnableDedupParam(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	replicaLabels, apiErr := qapi.parseReplicaLabelsParam(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	maxSourceResolution, apiErr := qapi.parseDownsamplingParamMillis(r, qapi.defaultInstantQueryMaxSourceResolution)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	return qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, qapi.isAutoDownsampling(r), enablePartialResponse, qapi.enableQueryPushdown, false), nil
+}
+
+// sampleAndChunkQueryable allows to stream chunks of a queryable supporting samples only.
+type sampleAndChunkQueryable struct {
+	storage.Queryable
+}
+
+func (q sampleAndChunkQueryable) ChunkQuerier(ctx context.Context, mint, maxt int64) (storage.ChunkQuerier, error) {
+	querier, err := q.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return chunkQuerier{Querier: querier}, nil
+}
+
+type chunkQuerier struct {
+	storage.Querier
+}
+
+func (q chunkQuerier) Select(sortSeries bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.ChunkSeriesSet {
+	return storage.NewSeriesSetToChunkSet(q.Querier.Select(sortSeries, hints, ms...))
+}
+
 // NewTargetsHandler created handler compatible with HTTP /api/v1/targets https://prometheus.io/docs/prometheus/latest/querying/api/#targets
 // which uses gRPC Unary Targets API.
 func NewTargetsHandler(client targets.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError) {
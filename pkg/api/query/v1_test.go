@@ -17,6 +17,7 @@
 package v1
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -25,22 +26,28 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/tsdbutil"
 	promgate "github.com/prometheus/prometheus/util/gate"
@@ -191,7 +198,7 @@ func TestQueryEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, nil, false),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -641,6 +648,121 @@ func TestQueryEndpoints(t *testing.T) {
 	}
 }
 
+func TestQueryStatsMarshalJSON(t *testing.T) {
+	qs := stats.NewQueryStats(&stats.Statistics{Timers: stats.NewQueryTimers()})
+	expected, err := json.Marshal(qs)
+	testutil.Ok(t, err)
+
+	b, err := json.Marshal(queryStats{QueryStats: qs})
+	testutil.Ok(t, err)
+	testutil.Equals(t, string(expected), string(b))
+
+	b, err = json.Marshal(queryStats{QueryStats: qs, TraceID: "1234"})
+	testutil.Ok(t, err)
+	var fields map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(b, &fields))
+	testutil.Equals(t, "1234", fields["traceID"])
+	testutil.Assert(t, fields["timings"] != nil, "expected timings in %s", b)
+
+	b, err = json.Marshal(queryStats{QueryStats: qs, Blocks: []blockStats{{BlockID: "block", ChunksFetched: 2, ChunksFetchTime: 0.5}}})
+	testutil.Ok(t, err)
+	fields = nil
+	testutil.Ok(t, json.Unmarshal(b, &fields))
+	testutil.Equals(t, nil, fields["traceID"])
+	testutil.Equals(t, []interface{}{map[string]interface{}{
+		"blockID":           "block",
+		"postingsTouched":   float64(0),
+		"seriesFetched":     float64(0),
+		"chunksFetched":     float64(2),
+		"postingsFetchTime": float64(0),
+		"seriesFetchTime":   float64(0),
+		"chunksFetchTime":   0.5,
+	}}, fields["blocks"])
+
+	b, err = json.Marshal(queryStats{QueryStats: qs, PartialResponseWarnings: []store.StoreFailure{{
+		Endpoint:  "store:10901",
+		LabelSets: []labels.Labels{labels.FromStrings("ext", "1")},
+		MinTime:   1,
+		MaxTime:   2,
+		Error:     "error",
+	}}})
+	testutil.Ok(t, err)
+	fields = nil
+	testutil.Ok(t, json.Unmarshal(b, &fields))
+	testutil.Equals(t, nil, fields["blocks"])
+	testutil.Equals(t, []interface{}{map[string]interface{}{
+		"endpoint":  "store:10901",
+		"labelSets": []interface{}{map[string]interface{}{"ext": "1"}},
+		"minTime":   float64(1),
+		"maxTime":   float64(2),
+		"error":     "error",
+	}}, fields["partialResponseWarnings"])
+}
+
+func TestQueryDataEncodeJSON(t *testing.T) {
+	for _, qd := range []*queryData{
+		{ResultType: parser.ValueTypeMatrix, Result: promql.Matrix{}},
+		{
+			ResultType: parser.ValueTypeMatrix,
+			Result: promql.Matrix{
+				{Metric: labels.FromStrings("a", "1"), Points: []promql.Point{{T: 1000, V: 1}, {T: 2000, V: 2}}},
+				{Metric: labels.FromStrings("a", "2"), Points: []promql.Point{{T: 1000, V: math.Inf(1)}}},
+			},
+			Stats:                   stats.NewQueryStats(&stats.Statistics{Timers: stats.NewQueryTimers()}),
+			PartialResponseWarnings: []store.StoreFailure{{Endpoint: "store:10901", Error: "error"}},
+		},
+		{ResultType: parser.ValueTypeVector, Result: promql.Vector{{Metric: labels.FromStrings("a", "1"), Point: promql.Point{T: 1000, V: 1}}}},
+		{ResultType: parser.ValueTypeScalar, Result: promql.Scalar{T: 1000, V: 1}},
+	} {
+		expected, err := json.Marshal(qd)
+		testutil.Ok(t, err)
+
+		var b bytes.Buffer
+		testutil.Ok(t, qd.encodeJSON(&b))
+		testutil.Equals(t, string(expected), b.String())
+	}
+}
+
+func TestQueryCacheControl(t *testing.T) {
+	now := time.Unix(100000, 0)
+	qapi := &QueryAPI{
+		baseAPI:             &baseAPI.BaseAPI{Now: func() time.Time { return now }},
+		cacheImmutableAfter: 2 * time.Hour,
+		cacheMaxAge:         time.Hour,
+	}
+	old, recent := now.Add(-3*time.Hour).Unix(), now.Add(-time.Hour).Unix()
+
+	for _, tcase := range []struct {
+		name     string
+		params   string
+		endParam string
+		qd       *queryData
+		expected string
+	}{
+		{name: "historical range query", params: fmt.Sprintf("query=up&end=%d", old), endParam: "end", expected: "public, max-age=3600"},
+		{name: "historical instant query", params: fmt.Sprintf("query=up&time=%d", old), endParam: "time", expected: "public, max-age=3600"},
+		{name: "recent range query", params: fmt.Sprintf("query=up&end=%d", recent), endParam: "end", expected: "no-cache"},
+		{name: "instant query without time", params: "query=up", endParam: "time", expected: "no-cache"},
+		{name: "@ modifier after the end", params: fmt.Sprintf("query=up @ %d&end=%d", recent, old), endParam: "end", expected: "no-cache"},
+		{name: "@ modifier before the end", params: fmt.Sprintf("query=up @ %d&end=%d", old-3600, old), endParam: "end", expected: "public, max-age=3600"},
+		{name: "negative offset", params: fmt.Sprintf("query=rate(up[5m] offset -2h)&end=%d", old), endParam: "end", expected: "no-cache"},
+		{name: "subquery with negative offset", params: fmt.Sprintf("query=max_over_time(up[1h:1m] offset -2h)&end=%d", old), endParam: "end", expected: "no-cache"},
+		{name: "partial response", params: fmt.Sprintf("query=up&end=%d", old), endParam: "end", qd: &queryData{PartialResponseWarnings: []store.StoreFailure{{Endpoint: "store:10901"}}}, expected: "no-store"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+url.PathEscape(tcase.params), nil)
+			qd := tcase.qd
+			if qd == nil {
+				qd = &queryData{}
+			}
+			testutil.Equals(t, tcase.expected, qapi.cacheControl(r, tcase.endParam, qd))
+		})
+	}
+
+	// Cache-Control headers are disabled by default.
+	qapi.cacheImmutableAfter = 0
+	testutil.Equals(t, "", qapi.cacheControl(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?query=up&end=%d", old), nil), "end", &queryData{}))
+}
 func TestMetadataEndpoints(t *testing.T) {
 	var old = []labels.Labels{
 		{
@@ -733,7 +855,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, nil, false),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -746,7 +868,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, nil, false),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -1289,6 +1411,148 @@ func TestStoresEndpoint(t *testing.T) {
 	}
 }
 
+// matchStoreClient is a store client with the given metadata, used for pruning decisions only.
+type matchStoreClient struct {
+	storepb.StoreClient
+
+	addr             string
+	labelSets        []labels.Labels
+	minTime, maxTime int64
+	storeType        component.StoreAPI
+}
+
+func (c matchStoreClient) LabelSets() []labels.Labels                { return c.labelSets }
+func (c matchStoreClient) TimeRange() (int64, int64)                 { return c.minTime, c.maxTime }
+func (c matchStoreClient) SupportsWithoutReplicaLabels() bool        { return false }
+func (c matchStoreClient) MetricNameFilter() *store.MetricNameFilter { return nil }
+func (c matchStoreClient) StoreType() component.StoreAPI             { return c.storeType }
+func (c matchStoreClient) String() string                            { return c.addr }
+func (c matchStoreClient) Addr() string                              { return c.addr }
+
+func TestActiveQueriesEndpoint(t *testing.T) {
+	api := &QueryAPI{}
+	res, _, apiErr := api.activeQueriesHandler(&http.Request{})
+	testutil.Assert(t, apiErr == nil)
+	testutil.Equals(t, []query.ActiveQuery{}, res)
+
+	tracker, err := query.NewActiveQueryTracker(log.NewNopLogger(), "", 10, 100)
+	testutil.Ok(t, err)
+	api = &QueryAPI{activeQueries: tracker}
+	q := tracker.Register("up", "team-a")
+	res, _, apiErr = api.activeQueriesHandler(&http.Request{})
+	testutil.Assert(t, apiErr == nil)
+	active := res.([]query.ActiveQuery)
+	testutil.Equals(t, 1, len(active))
+	testutil.Equals(t, "up", active[0].Query)
+	testutil.Equals(t, "team-a", active[0].Tenant)
+	testutil.Equals(t, query.QueryPhaseEval, active[0].Phase)
+
+	q.Done()
+	res, _, apiErr = api.activeQueriesHandler(&http.Request{})
+	testutil.Assert(t, apiErr == nil)
+	testutil.Equals(t, []query.ActiveQuery{}, res)
+}
+
+func TestStoresMatchEndpoint(t *testing.T) {
+	proxy := store.NewProxyStore(nil, nil, func() []store.Client {
+		return []store.Client{
+			matchStoreClient{addr: "sidecar-1", labelSets: []labels.Labels{labels.FromStrings("cluster", "a")}, minTime: 0, maxTime: 10000, storeType: component.Sidecar},
+			matchStoreClient{addr: "sidecar-2", labelSets: []labels.Labels{labels.FromStrings("cluster", "b")}, minTime: 0, maxTime: 10000, storeType: component.Sidecar},
+			matchStoreClient{addr: "store-1", minTime: 20000, maxTime: 30000, storeType: component.Store},
+		}
+	}, component.Query, nil, 0)
+	api := &QueryAPI{
+		endpointStatus: func() []query.EndpointStatus {
+			return []query.EndpointStatus{
+				{Name: "receive-1", ComponentType: component.Receive},
+				{Name: "sidecar-1", ComponentType: component.Sidecar},
+				{Name: "sidecar-2", ComponentType: component.Sidecar},
+				{Name: "store-1", ComponentType: component.Store},
+			}
+		},
+		matchStores: proxy.MatchStores,
+	}
+
+	for i, test := range []endpointTestCase{
+		{
+			endpoint: api.storesMatch,
+			errType:  baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.storesMatch,
+			query: url.Values{
+				"match[]": []string{`{cluster="a"}`},
+				"start":   []string{"0"},
+				"end":     []string{"5"},
+			},
+			response: []StoresMatch{
+				{
+					Match: `{cluster="a"}`,
+					Stores: []StoreMatchStatus{
+						{Name: "receive-1", ComponentType: "receive", Reason: "endpoint does not expose the Store API"},
+						{Name: "sidecar-1", ComponentType: "sidecar", Queried: true},
+						{Name: "sidecar-2", ComponentType: "sidecar", Reason: `external labels [{cluster="b"}] does not match request label matchers: [cluster="a"]`},
+						{Name: "store-1", ComponentType: "store", Reason: "does not have data within this time period: [0,5000]. Store time ranges: [20000,30000]"},
+					},
+				},
+			},
+		},
+		{
+			endpoint: api.storesMatch,
+			method:   http.MethodPost,
+			query: url.Values{
+				"match[]":      []string{`up`},
+				"storeMatch[]": []string{`{__address__="store-1"}`},
+				"start":        []string{"0"},
+				"end":          []string{"25"},
+			},
+			response: []StoresMatch{
+				{
+					Match: `up`,
+					Stores: []StoreMatchStatus{
+						{Name: "receive-1", ComponentType: "receive", Reason: "endpoint does not expose the Store API"},
+						{Name: "sidecar-1", ComponentType: "sidecar", Reason: `__address__ sidecar-1 does not match debug store metadata matchers: [[__address__="store-1"]]`},
+						{Name: "sidecar-2", ComponentType: "sidecar", Reason: `__address__ sidecar-2 does not match debug store metadata matchers: [[__address__="store-1"]]`},
+						{Name: "store-1", ComponentType: "store", Queried: true},
+					},
+				},
+			},
+		},
+		{
+			endpoint: api.storesMatch,
+			query: url.Values{
+				"match[]":     []string{`up`},
+				"storeType[]": []string{"store", "receive"},
+				"start":       []string{"0"},
+				"end":         []string{"25"},
+			},
+			response: []StoresMatch{
+				{
+					Match: `up`,
+					Stores: []StoreMatchStatus{
+						{Name: "receive-1", ComponentType: "receive", Reason: "endpoint does not expose the Store API"},
+						{Name: "sidecar-1", ComponentType: "sidecar", Reason: "store type sidecar is not one of the requested store types [store receive]"},
+						{Name: "sidecar-2", ComponentType: "sidecar", Reason: "store type sidecar is not one of the requested store types [store receive]"},
+						{Name: "store-1", ComponentType: "store", Queried: true},
+					},
+				},
+			},
+		},
+		{
+			endpoint: api.storesMatch,
+			query: url.Values{
+				"match[]":     []string{`up`},
+				"storeType[]": []string{"compactor"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+	} {
+		if ok := testEndpoint(t, test, strings.TrimSpace(fmt.Sprintf("#%d %s", i, test.query.Encode())), reflect.DeepEqual); !ok {
+			return
+		}
+	}
+}
+
 func TestParseTime(t *testing.T) {
 	ts, err := time.Parse(time.RFC3339Nano, "2015-06-03T13:21:58.555Z")
 	if err != nil {
@@ -1857,3 +2121,158 @@ func (s sample) T() int64 {
 func (s sample) V() float64 {
 	return s.v
 }
+
+// seriesRequestRecorder records the Series requests passed to the wrapped store.
+type seriesRequestRecorder struct {
+	storepb.StoreServer
+
+	mtx  sync.Mutex
+	reqs []*storepb.SeriesRequest
+}
+
+func (s *seriesRequestRecorder) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.mtx.Lock()
+	s.reqs = append(s.reqs, r)
+	s.mtx.Unlock()
+	return s.StoreServer.Series(r, srv)
+}
+
+func (s *seriesRequestRecorder) last() *storepb.SeriesRequest {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.reqs[len(s.reqs)-1]
+}
+
+func TestRemoteReadEndpoint(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "a"),
+		labels.FromStrings("__name__", "up", "job", "api", "replica", "b"),
+	} {
+		for i := int64(0); i < 10; i++ {
+			_, err := app.Append(0, lset, i*60000, float64(i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	st := &seriesRequestRecorder{StoreServer: store.NewTSDBStore(nil, db, component.Query, nil)}
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		logger:          log.NewNopLogger(),
+		queryableCreate: query.NewQueryableCreator(nil, nil, st, 2, 100*time.Second, nil, false),
+		gate:            gate.New(nil, 4),
+	}
+
+	for _, respType := range []prompb.ReadRequest_ResponseType{prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS} {
+		t.Run(respType.String(), func(t *testing.T) {
+			for _, tcase := range []struct {
+				name   string
+				params url.Values
+
+				expLabels               []string
+				expMaxResolution        int64
+				expPartialResponseAllow bool
+				expCode                 int
+			}{
+				{
+					name:      "dedup without replica labels",
+					expLabels: []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`},
+				},
+				{
+					name:      "dedup",
+					params:    url.Values{DedupParam: []string{"true"}, ReplicaLabelsParam: []string{"replica"}},
+					expLabels: []string{`{__name__="up", job="api"}`},
+				},
+				{
+					name:      "no dedup",
+					params:    url.Values{DedupParam: []string{"false"}, ReplicaLabelsParam: []string{"replica"}},
+					expLabels: []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`},
+				},
+				{
+					name:                    "max source resolution and partial response",
+					params:                  url.Values{MaxSourceResolutionParam: []string{"5m"}, PartialResponseParam: []string{"true"}},
+					expLabels:               []string{`{__name__="up", job="api", replica="a"}`, `{__name__="up", job="api", replica="b"}`},
+					expMaxResolution:        300000,
+					expPartialResponseAllow: true,
+				},
+				{
+					name:    "invalid max source resolution",
+					params:  url.Values{MaxSourceResolutionParam: []string{"-5m"}},
+					expCode: http.StatusBadRequest,
+				},
+				{
+					name:    "invalid partial response",
+					params:  url.Values{PartialResponseParam: []string{"maybe"}},
+					expCode: http.StatusBadRequest,
+				},
+			} {
+				t.Run(tcase.name, func(t *testing.T) {
+					body, err := proto.Marshal(&prompb.ReadRequest{
+						Queries: []*prompb.Query{{
+							StartTimestampMs: 0,
+							EndTimestampMs:   600000,
+							Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+						}},
+						AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{respType},
+					})
+					testutil.Ok(t, err)
+
+					req := httptest.NewRequest("POST", "/api/v1/read?"+tcase.params.Encode(), bytes.NewReader(snappy.Encode(nil, body)))
+					req.Header.Set("Content-Type", "application/x-protobuf")
+					req.Header.Set("Content-Encoding", "snappy")
+					rec := httptest.NewRecorder()
+					api.remoteRead(rec, req)
+
+					if tcase.expCode != 0 {
+						testutil.Equals(t, tcase.expCode, rec.Code)
+						return
+					}
+					testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+					testutil.Equals(t, tcase.expMaxResolution, st.last().MaxResolutionWindow)
+					testutil.Equals(t, !tcase.expPartialResponseAllow, st.last().PartialResponseDisabled)
+
+					var got []string
+					if respType == prompb.ReadRequest_SAMPLES {
+						b, err := snappy.Decode(nil, rec.Body.Bytes())
+						testutil.Ok(t, err)
+						var resp prompb.ReadResponse
+						testutil.Ok(t, proto.Unmarshal(b, &resp))
+						testutil.Equals(t, 1, len(resp.Results))
+						for _, ts := range resp.Results[0].Timeseries {
+							got = append(got, remoteLabels(ts.Labels).String())
+							testutil.Equals(t, 10, len(ts.Samples))
+						}
+					} else {
+						r := remote.NewChunkedReader(rec.Body, remote.DefaultChunkedReadLimit, nil)
+						for {
+							var resp prompb.ChunkedReadResponse
+							if err := r.NextProto(&resp); err == io.EOF {
+								break
+							} else {
+								testutil.Ok(t, err)
+							}
+							for _, s := range resp.ChunkedSeries {
+								got = append(got, remoteLabels(s.Labels).String())
+								testutil.Equals(t, 1, len(s.Chunks))
+							}
+						}
+					}
+					testutil.Equals(t, tcase.expLabels, got)
+				})
+			}
+		})
+	}
+}
+
+func remoteLabels(lbls []prompb.Label) labels.Labels {
+	res := make(labels.Labels, 0, len(lbls))
+	for _, l := range lbls {
+		res = append(res, labels.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
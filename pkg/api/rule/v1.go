@@ -11,6 +11,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/route"
 
+	"github.com/thanos-io/thanos/pkg/alert"
 	"github.com/thanos-io/thanos/pkg/api"
 	qapi "github.com/thanos-io/thanos/pkg/api/query"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
@@ -21,34 +22,46 @@ import (
 
 // RuleAPI is a very simple API used by Thanos Ruler.
 type RuleAPI struct {
-	baseAPI     *api.BaseAPI
-	logger      log.Logger
-	ruleGroups  rules.UnaryClient
-	alerts      alertsRetriever
-	reg         prometheus.Registerer
-	disableCORS bool
+	baseAPI       *api.BaseAPI
+	logger        log.Logger
+	ruleGroups    rules.UnaryClient
+	alerts        alertsRetriever
+	alertmanagers alertmanagersRetriever
+	reg           prometheus.Registerer
+	disableCORS   bool
 }
 
 type alertsRetriever interface {
 	Active() []*rulespb.AlertInstance
 }
 
+type alertmanagersRetriever interface {
+	Alertmanagers() []alert.AlertmanagerStatus
+}
+
+// AlertmanagersResult is the health of the Alertmanager endpoints the alerts are sent to.
+type AlertmanagersResult struct {
+	ActiveAlertmanagers []alert.AlertmanagerStatus `json:"activeAlertmanagers"`
+}
+
 // NewRuleAPI creates an Thanos ruler API.
 func NewRuleAPI(
 	logger log.Logger,
 	reg prometheus.Registerer,
 	ruleGroups rules.UnaryClient,
 	activeAlerts alertsRetriever,
+	alertmanagers alertmanagersRetriever,
 	disableCORS bool,
 	flagsMap map[string]string,
 ) *RuleAPI {
 	return &RuleAPI{
-		baseAPI:     api.NewBaseAPI(logger, disableCORS, flagsMap),
-		logger:      logger,
-		ruleGroups:  ruleGroups,
-		alerts:      activeAlerts,
-		reg:         reg,
-		disableCORS: disableCORS,
+		baseAPI:       api.NewBaseAPI(logger, disableCORS, flagsMap),
+		logger:        logger,
+		ruleGroups:    ruleGroups,
+		alerts:        activeAlerts,
+		alertmanagers: alertmanagers,
+		reg:           reg,
+		disableCORS:   disableCORS,
 	}
 }
 
@@ -61,4 +74,7 @@ func (rapi *RuleAPI) Register(r *route.Router, tracer opentracing.Tracer, logger
 		return struct{ Alerts []*rulespb.AlertInstance }{Alerts: rapi.alerts.Active()}, nil, nil
 	}))
 	r.Get("/rules", instr("rules", qapi.NewRulesHandler(rapi.ruleGroups, false)))
+	r.Get("/alertmanagers", instr("alertmanagers", func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		return AlertmanagersResult{ActiveAlertmanagers: rapi.alertmanagers.Alertmanagers()}, nil, nil
+	}))
 }
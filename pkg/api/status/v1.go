@@ -17,7 +17,9 @@
 package status
 
 import (
+	"math"
 	"net/http"
+	"sort"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/tsdb"
@@ -33,6 +35,12 @@ import (
 	"github.com/thanos-io/thanos/pkg/logging"
 )
 
+// AggregateQueryParam is the query parameter for getting the TSDB stats aggregated across all tenants.
+const AggregateQueryParam = "aggregate"
+
+// maxStats is the number of items of each top list of the TSDB stats, like in the TSDB.
+const maxStats = 10
+
 // Stat holds the information about individual cardinality.
 type Stat struct {
 	Name  string `json:"name"`
@@ -119,6 +127,7 @@ func (sapi *StatusAPI) httpServeStats(r *http.Request) (interface{}, []error, *a
 		}
 	}
 
+	aggregate := r.FormValue(AggregateQueryParam) == "true"
 	for _, s := range stats {
 		var chunkCount int64
 		if c, ok := tenantChunks[s.Tenant]; ok {
@@ -139,5 +148,66 @@ func (sapi *StatusAPI) httpServeStats(r *http.Request) (interface{}, []error, *a
 			SeriesCountByLabelValuePair: convertStats(s.Stats.IndexPostingStats.LabelValuePairsStats),
 		})
 	}
+	if aggregate {
+		return []TSDBStatus{aggregateTSDBStatus(result)}, nil, nil
+	}
 	return result, nil, nil
 }
+
+// aggregateTSDBStatus returns the TSDB stats of all the given tenants, with an empty tenant. The head stats are summed,
+// except for the number of label pairs which is an upper bound, as the label pairs of the tenants overlap. The top
+// lists are merged from the top lists of the tenants, so they are exact for the items in the top lists of all tenants
+// and lower bounds otherwise.
+func aggregateTSDBStatus(statuses []TSDBStatus) TSDBStatus {
+	res := TSDBStatus{HeadStats: v1.HeadStats{MinTime: math.MaxInt64, MaxTime: math.MinInt64}}
+	var (
+		seriesCountByMetricName     = map[string]uint64{}
+		labelValueCountByLabelName  = map[string]uint64{}
+		memoryInBytesByLabelName    = map[string]uint64{}
+		seriesCountByLabelValuePair = map[string]uint64{}
+	)
+	for _, s := range statuses {
+		res.HeadStats.NumSeries += s.HeadStats.NumSeries
+		res.HeadStats.NumLabelPairs += s.HeadStats.NumLabelPairs
+		res.HeadStats.ChunkCount += s.HeadStats.ChunkCount
+		if s.HeadStats.MinTime < res.HeadStats.MinTime {
+			res.HeadStats.MinTime = s.HeadStats.MinTime
+		}
+		if s.HeadStats.MaxTime > res.HeadStats.MaxTime {
+			res.HeadStats.MaxTime = s.HeadStats.MaxTime
+		}
+		addStats(seriesCountByMetricName, s.SeriesCountByMetricName)
+		addStats(labelValueCountByLabelName, s.LabelValueCountByLabelName)
+		addStats(memoryInBytesByLabelName, s.MemoryInBytesByLabelName)
+		addStats(seriesCountByLabelValuePair, s.SeriesCountByLabelValuePair)
+	}
+	res.SeriesCountByMetricName = topStats(seriesCountByMetricName)
+	res.LabelValueCountByLabelName = topStats(labelValueCountByLabelName)
+	res.MemoryInBytesByLabelName = topStats(memoryInBytesByLabelName)
+	res.SeriesCountByLabelValuePair = topStats(seriesCountByLabelValuePair)
+	return res
+}
+
+func addStats(m map[string]uint64, stats []Stat) {
+	for _, s := range stats {
+		m[s.Name] += s.Value
+	}
+}
+
+// topStats returns the maxStats items with the highest values, sorted by decreasing value and then by name.
+func topStats(m map[string]uint64) []Stat {
+	res := make([]Stat, 0, len(m))
+	for name, value := range m {
+		res = append(res, Stat{Name: name, Value: value})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Value != res[j].Value {
+			return res[i].Value > res[j].Value
+		}
+		return res[i].Name < res[j].Name
+	})
+	if len(res) > maxStats {
+		res = res[:maxStats]
+	}
+	return res
+}
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -22,6 +23,7 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -37,11 +39,18 @@ const (
 	IndexHeaderFilename = "index-header"
 	// ChunksDirname is the known dir name for chunks with compressed samples.
 	ChunksDirname = "chunks"
+	// ExemplarsFilename is the known file for the exemplars of the series of a block. It is optional.
+	ExemplarsFilename = "exemplars"
+	// LabelIndexFilename is the known file for the label names and values of the series of a block. It is optional.
+	LabelIndexFilename = "label-index"
 
 	// DebugMetas is a directory for debug meta files that happen in the past. Useful for debugging.
 	DebugMetas = "debug/metas"
 )
 
+// optionalFilenames are the known files a block may have, next to its index and chunks.
+var optionalFilenames = []string{ExemplarsFilename, LabelIndexFilename}
+
 // Download downloads directory that is mean to be block directory. If any of the files
 // have a hash calculated in the meta file and it matches with what is in the destination path then
 // we do not download it. We always re-download the meta file.
@@ -153,6 +162,16 @@ func upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
 	}
 
+	for _, fn := range optionalFilenames {
+		if _, err := os.Stat(filepath.Join(bdir, fn)); err == nil {
+			if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(bdir, fn), path.Join(id.String(), fn)); err != nil {
+				return cleanUp(logger, bkt, id, errors.Wrapf(err, "upload %s", fn))
+			}
+		} else if !os.IsNotExist(err) {
+			return cleanUp(logger, bkt, id, errors.Wrapf(err, "stat %s", fn))
+		}
+	}
+
 	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file to be pending uploads.
 	if err := bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader(metaEncoded.String())); err != nil {
 		// Don't call cleanUp here. Despite getting error, meta.json may have been uploaded in certain cases,
@@ -165,6 +184,75 @@ func upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 	return nil
 }
 
+// Copy copies the block from the src bucket to the dst bucket, with its meta.json modified by modifyMeta, and verifies
+// the size of each copied object. Like Upload, the meta.json is copied last, so that the block is only visible in the
+// dst bucket once complete. The markers of the block are not copied.
+func Copy(ctx context.Context, logger log.Logger, src, dst objstore.Bucket, id ulid.ULID, modifyMeta func(*metadata.Meta)) error {
+	meta, err := DownloadMeta(ctx, logger, src, id)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	if err := src.Iter(ctx, path.Join(id.String(), ChunksDirname), func(name string) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "list chunks")
+	}
+	names = append(names, path.Join(id.String(), IndexFilename))
+	for _, fn := range optionalFilenames {
+		name := path.Join(id.String(), fn)
+		if ok, err := src.Exists(ctx, name); err != nil {
+			return errors.Wrapf(err, "stat %s", name)
+		} else if ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if err := copyObject(ctx, logger, src, dst, name); err != nil {
+			return cleanUp(logger, dst, id, errors.Wrapf(err, "copy %s", name))
+		}
+	}
+
+	modifyMeta(&meta)
+	metaEncoded := strings.Builder{}
+	if err := meta.Write(&metaEncoded); err != nil {
+		return cleanUp(logger, dst, id, errors.Wrap(err, "encode meta file"))
+	}
+	if err := dst.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader(metaEncoded.String())); err != nil {
+		return errors.Wrap(err, "upload meta file")
+	}
+	return nil
+}
+
+// copyObject copies the object from the src bucket to the dst bucket and verifies its size.
+func copyObject(ctx context.Context, logger log.Logger, src objstore.BucketReader, dst objstore.Bucket, name string) error {
+	attrs, err := src.Attributes(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get attributes")
+	}
+	rc, err := src.Get(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get")
+	}
+	defer runutil.CloseWithLogOnErr(logger, rc, "copy object bucket reader")
+
+	if err := dst.Upload(ctx, name, rc); err != nil {
+		return errors.Wrap(err, "upload")
+	}
+	copied, err := dst.Attributes(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get attributes of copy")
+	}
+	if copied.Size != attrs.Size {
+		return errors.Errorf("copy has %d bytes instead of %d", copied.Size, attrs.Size)
+	}
+	level.Debug(logger).Log("msg", "copied file", "file", name, "bucket", dst.Name())
+	return nil
+}
+
 func cleanUp(logger log.Logger, bkt objstore.Bucket, id ulid.ULID, err error) error {
 	// Cleanup the dir with an uncancelable context.
 	cleanErr := Delete(context.Background(), logger, bkt, id)
@@ -174,8 +262,54 @@ func cleanUp(logger log.Logger, bkt objstore.Bucket, id ulid.ULID, err error) er
 	return err
 }
 
+// DeletionMarkOption configures the deletion mark written by MarkForDeletion.
+type DeletionMarkOption func(*deletionMarkOptions)
+
+type deletionMarkOptions struct {
+	source      string
+	group       string
+	auditObject bool
+}
+
+// WithDeletionSource records the given component and the current version as the source of the deletion mark.
+func WithDeletionSource(component string) DeletionMarkOption {
+	return func(o *deletionMarkOptions) {
+		o.source = component + "/" + version.Version
+	}
+}
+
+// WithCompactionGroup records the key of the compaction group of the block in the deletion mark.
+func WithCompactionGroup(key string) DeletionMarkOption {
+	return func(o *deletionMarkOptions) {
+		o.group = key
+	}
+}
+
+// WithDeletionAudit enables uploading a copy of every deletion mark to the audit directory in the bucket.
+func WithDeletionAudit(enabled bool) DeletionMarkOption {
+	return func(o *deletionMarkOptions) {
+		o.auditObject = enabled
+	}
+}
+
+func newDeletionMark(id ulid.ULID, reason metadata.DeletionReason, details string, opts []DeletionMarkOption) (metadata.DeletionMark, deletionMarkOptions) {
+	var o deletionMarkOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return metadata.DeletionMark{
+		ID:           id,
+		DeletionTime: time.Now().Unix(),
+		Version:      metadata.DeletionMarkVersion1,
+		Details:      details,
+		Reason:       reason,
+		Source:       o.source,
+		Group:        o.group,
+	}, o
+}
+
 // MarkForDeletion creates a file which stores information about when the block was marked for deletion.
-func MarkForDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, details string, markedForDeletion prometheus.Counter) error {
+func MarkForDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.DeletionReason, details string, markedForDeletion prometheus.Counter, opts ...DeletionMarkOption) error {
 	deletionMarkFile := path.Join(id.String(), metadata.DeletionMarkFilename)
 	deletionMarkExists, err := bkt.Exists(ctx, deletionMarkFile)
 	if err != nil {
@@ -186,21 +320,46 @@ func MarkForDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket
 		return nil
 	}
 
-	deletionMark, err := json.Marshal(metadata.DeletionMark{
-		ID:           id,
-		DeletionTime: time.Now().Unix(),
-		Version:      metadata.DeletionMarkVersion1,
-		Details:      details,
-	})
+	m, o := newDeletionMark(id, reason, details, opts)
+	deletionMark, err := json.Marshal(m)
 	if err != nil {
 		return errors.Wrap(err, "json encode deletion mark")
 	}
 
+	// Upload the audit file first, so no block is deleted without it.
+	if o.auditObject {
+		if err := uploadDeletionAudit(ctx, bkt, m, deletionMark); err != nil {
+			return err
+		}
+	}
 	if err := bkt.Upload(ctx, deletionMarkFile, bytes.NewBuffer(deletionMark)); err != nil {
 		return errors.Wrapf(err, "upload file %s to bucket", deletionMarkFile)
 	}
 	markedForDeletion.Inc()
-	level.Info(logger).Log("msg", "block has been marked for deletion", "block", id)
+	level.Info(logger).Log("msg", "block has been marked for deletion", "block", id, "reason", reason, "details", details, "source", m.Source, "group", m.Group)
+	return nil
+}
+
+// AuditDeletion records the deletion of a block which is deleted without being marked for deletion first,
+// e.g. an aborted partial upload. The audit file is uploaded only if enabled with WithDeletionAudit.
+func AuditDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.DeletionReason, details string, opts ...DeletionMarkOption) error {
+	m, o := newDeletionMark(id, reason, details, opts)
+	level.Info(logger).Log("msg", "block is being deleted", "block", id, "reason", reason, "details", details, "source", m.Source, "group", m.Group)
+	if !o.auditObject {
+		return nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "json encode deletion audit")
+	}
+	return uploadDeletionAudit(ctx, bkt, m, b)
+}
+
+func uploadDeletionAudit(ctx context.Context, bkt objstore.Bucket, m metadata.DeletionMark, b []byte) error {
+	auditFile := path.Join(metadata.DeletionAuditDirname, fmt.Sprintf("%d-%s.json", m.DeletionTime, m.ID))
+	if err := bkt.Upload(ctx, auditFile, bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload file %s to bucket", auditFile)
+	}
 	return nil
 }
 
@@ -253,6 +412,60 @@ func Delete(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid
 	return nil
 }
 
+// DeletionMode is the way blocks are removed from the bucket once they are meant to be deleted.
+type DeletionMode string
+
+const (
+	// DeleteDeletionMode removes all objects of the block from the bucket.
+	DeleteDeletionMode DeletionMode = "delete"
+	// MarkOnlyDeletionMode keeps all objects of the block in the bucket and writes a tombstone next to them instead,
+	// for buckets which do not allow deletions, e.g. S3 buckets with object lock.
+	// The expiry of the objects is left to the lifecycle rules of the object storage.
+	MarkOnlyDeletionMode DeletionMode = "mark-only"
+)
+
+// Tombstone writes a tombstone for the block, which is kept in the bucket instead of being deleted. As with AuditDeletion,
+// the audit file is uploaded first if enabled with WithDeletionAudit. It returns false if the block already had a tombstone.
+func Tombstone(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.DeletionReason, details string, opts ...DeletionMarkOption) (bool, error) {
+	tombstoneFile := path.Join(id.String(), metadata.TombstoneFilename)
+	tombstoneExists, err := bkt.Exists(ctx, tombstoneFile)
+	if err != nil {
+		return false, errors.Wrapf(err, "check exists %s in bucket", tombstoneFile)
+	}
+	if tombstoneExists {
+		level.Debug(logger).Log("msg", "block already has a tombstone, skipping", "block", id)
+		return false, nil
+	}
+
+	m, o := newDeletionMark(id, reason, details, opts)
+	if o.auditObject {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return false, errors.Wrap(err, "json encode deletion audit")
+		}
+		if err := uploadDeletionAudit(ctx, bkt, m, b); err != nil {
+			return false, err
+		}
+	}
+
+	tombstone, err := json.Marshal(metadata.Tombstone{
+		ID:            id,
+		Version:       metadata.TombstoneVersion1,
+		Details:       details,
+		TombstoneTime: m.DeletionTime,
+		Reason:        reason,
+		Source:        m.Source,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "json encode tombstone")
+	}
+	if err := bkt.Upload(ctx, tombstoneFile, bytes.NewBuffer(tombstone)); err != nil {
+		return false, errors.Wrapf(err, "upload file %s to bucket", tombstoneFile)
+	}
+	level.Info(logger).Log("msg", "block has been kept in bucket with a tombstone instead of being deleted", "block", id, "reason", reason, "details", details, "source", m.Source)
+	return true, nil
+}
+
 // deleteDirRec removes all objects prefixed with dir from the bucket. It skips objects that return true for the passed keep function.
 // NOTE: For objects removal use `block.Delete` strictly.
 func deleteDirRec(ctx context.Context, logger log.Logger, bkt objstore.Bucket, dir string, keep func(name string) bool) error {
@@ -354,6 +567,28 @@ func GatherFileStats(blockDir string, hf metadata.HashFunc, logger log.Logger) (
 	}
 	res = append(res, mf)
 
+	for _, fn := range optionalFilenames {
+		optionalFile, err := os.Stat(filepath.Join(blockDir, fn))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "stat %v", filepath.Join(blockDir, fn))
+		}
+		mf := metadata.File{
+			RelPath:   optionalFile.Name(),
+			SizeBytes: optionalFile.Size(),
+		}
+		if hf != metadata.NoneFunc {
+			h, err := metadata.CalculateHash(filepath.Join(blockDir, fn), hf, logger)
+			if err != nil {
+				return nil, errors.Wrapf(err, "calculate hash %v", optionalFile.Name())
+			}
+			mf.Hash = &h
+		}
+		res = append(res, mf)
+	}
+
 	metaFile, err := os.Stat(filepath.Join(blockDir, MetaFilename))
 	if err != nil {
 		return nil, errors.Wrapf(err, "stat %v", filepath.Join(blockDir, MetaFilename))
@@ -397,3 +632,21 @@ func MarkForNoCompact(ctx context.Context, logger log.Logger, bkt objstore.Bucke
 	level.Info(logger).Log("msg", "block has been marked for no compaction", "block", id)
 	return nil
 }
+
+// RemoveMark removes the marker file with the given name, e.g. metadata.NoCompactMarkFilename, of the block. It fails
+// if the block has no such marker.
+func RemoveMark(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, markerFilename string) error {
+	m := path.Join(id.String(), markerFilename)
+	exists, err := bkt.Exists(ctx, m)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", m)
+	}
+	if !exists {
+		return errors.Errorf("block %s has no %s", id, markerFilename)
+	}
+	if err := bkt.Delete(ctx, m); err != nil {
+		return errors.Wrapf(err, "delete file %s from bucket", m)
+	}
+	level.Info(logger).Log("msg", "marker of block has been removed", "block", id, "marker", markerFilename)
+	return nil
+}
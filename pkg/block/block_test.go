@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/version"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/thanos-io/objstore"
 
@@ -252,7 +253,7 @@ func TestDelete(t *testing.T) {
 		testutil.Equals(t, 3, len(bkt.Objects()))
 
 		markedForDeletion := promauto.With(prometheus.NewRegistry()).NewCounter(prometheus.CounterOpts{Name: "test"})
-		testutil.Ok(t, MarkForDeletion(ctx, log.NewNopLogger(), bkt, b1, "", markedForDeletion))
+		testutil.Ok(t, MarkForDeletion(ctx, log.NewNopLogger(), bkt, b1, metadata.ManualDeletionReason, "", markedForDeletion))
 
 		// Full delete.
 		testutil.Ok(t, Delete(ctx, log.NewNopLogger(), bkt, b1))
@@ -326,13 +327,58 @@ func TestMarkForDeletion(t *testing.T) {
 			testutil.Ok(t, Upload(ctx, log.NewNopLogger(), bkt, path.Join(tmpDir, id.String()), metadata.NoneFunc))
 
 			c := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
-			err = MarkForDeletion(ctx, log.NewNopLogger(), bkt, id, "", c)
+			err = MarkForDeletion(ctx, log.NewNopLogger(), bkt, id, metadata.ManualDeletionReason, "", c)
 			testutil.Ok(t, err)
 			testutil.Equals(t, float64(tcase.blocksMarked), promtest.ToFloat64(c))
 		})
 	}
 }
 
+func TestMarkForDeletionWithAudit(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+	ctx := context.Background()
+
+	bkt := objstore.NewInMemBucket()
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader("{}")))
+
+	c := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	testutil.Ok(t, MarkForDeletion(ctx, log.NewNopLogger(), bkt, id, metadata.CompactedDeletionReason, "source of compacted block", c,
+		WithDeletionSource("compact"), WithCompactionGroup("0@123"), WithDeletionAudit(true)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(c))
+
+	m := &metadata.DeletionMark{}
+	testutil.Ok(t, metadata.ReadMarker(ctx, log.NewNopLogger(), objstore.WithNoopInstr(bkt), id.String(), m))
+	testutil.Equals(t, metadata.CompactedDeletionReason, m.Reason)
+	testutil.Equals(t, "source of compacted block", m.Details)
+	testutil.Equals(t, "compact/"+version.Version, m.Source)
+	testutil.Equals(t, "0@123", m.Group)
+
+	var audits []string
+	testutil.Ok(t, bkt.Iter(ctx, metadata.DeletionAuditDirname, func(name string) error {
+		audits = append(audits, name)
+		return nil
+	}))
+	testutil.Equals(t, 1, len(audits))
+
+	r, err := bkt.Get(ctx, audits[0])
+	testutil.Ok(t, err)
+	audit := metadata.DeletionMark{}
+	testutil.Ok(t, json.NewDecoder(r).Decode(&audit))
+	testutil.Ok(t, r.Close())
+	testutil.Equals(t, *m, audit)
+
+	// Direct deletions are audited as well.
+	other := ulid.MustNew(2, nil)
+	testutil.Ok(t, AuditDeletion(ctx, log.NewNopLogger(), bkt, other, metadata.PartialUploadDeletionReason, "aborted partial upload", WithDeletionAudit(true)))
+	audits = audits[:0]
+	testutil.Ok(t, bkt.Iter(ctx, metadata.DeletionAuditDirname, func(name string) error {
+		audits = append(audits, name)
+		return nil
+	}))
+	testutil.Equals(t, 2, len(audits))
+}
+
 func TestMarkForNoCompact(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 	ctx := context.Background()
@@ -389,6 +435,25 @@ func TestMarkForNoCompact(t *testing.T) {
 	}
 }
 
+func TestRemoveMark(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+	ctx := context.Background()
+
+	bkt := objstore.NewInMemBucket()
+	id := ulid.MustNew(1, nil)
+	c := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	testutil.Ok(t, MarkForNoCompact(ctx, log.NewNopLogger(), bkt, id, metadata.ManualNoCompactReason, "", c))
+
+	testutil.Ok(t, RemoveMark(ctx, log.NewNopLogger(), bkt, id, metadata.NoCompactMarkFilename))
+	exists, err := bkt.Exists(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "no-compact mark was not removed")
+
+	// Removing a missing marker fails.
+	testutil.NotOk(t, RemoveMark(ctx, log.NewNopLogger(), bkt, id, metadata.NoCompactMarkFilename))
+	testutil.NotOk(t, RemoveMark(ctx, log.NewNopLogger(), bkt, id, metadata.DeletionMarkFilename))
+}
+
 // TestHashDownload uploads an empty block to in-memory storage
 // and tries to download it to the same dir. It should not try
 // to download twice.
@@ -0,0 +1,413 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// The exemplars file of a block holds the exemplars of its series, referenced by the references of the series in the
+// index of the block. Its layout is:
+//
+//	┌────────────────────────────┬─────────────────────┐
+//	│ magic(0x45584d50) <4b>     │ version(1) <1b>     │
+//	├────────────────────────────┴─────────────────────┤
+//	│ ┌──────────────────────────────────────────────┐ │
+//	│ │                  Series 1                    │ │
+//	│ ├──────────────────────────────────────────────┤ │
+//	│ │                    ...                       │ │
+//	│ ├──────────────────────────────────────────────┤ │
+//	│ │                  Series n                    │ │
+//	│ └──────────────────────────────────────────────┘ │
+//	├──────────────────────────────────────────────────┤
+//	│                  Series Table                    │
+//	├──────────────────────────────────────────────────┤
+//	│ series table offset <8b>   │ CRC32 <4b>          │
+//	└──────────────────────────────────────────────────┘
+//
+// Each series holds its exemplars sorted by timestamp:
+//
+//	┌───────────────┬──────────────────────┬───────────────────────────┬────────────┐
+//	│ len <uvarint> │ #exemplars <uvarint> │ exemplar 1 ... exemplar n │ CRC32 <4b> │
+//	└───────────────┴──────────────────────┴───────────────────────────┴────────────┘
+//
+// where each exemplar is encoded as its number of labels <uvarint>, each label name and value <uvarint str>, its
+// timestamp <varint64> and its value <8b>. The series table lists the series sorted by reference, with their reference
+// and the offset of their series in the file, both delta encoded:
+//
+//	┌──────────┬───────────────────┬──────────────────────────────────────────────────┬────────────┐
+//	│ len <4b> │ #series <uvarint> │ ref <uvarint64> offset <uvarint64> ... (n times) │ CRC32 <4b> │
+//	└──────────┴───────────────────┴──────────────────────────────────────────────────┴────────────┘
+const (
+	// ExemplarsMagic is the magic number of the exemplars file of a block.
+	ExemplarsMagic = 0x45584d50
+	// ExemplarsFormatV1 is the version of the exemplars file supported by Thanos.
+	ExemplarsFormatV1 = 1
+
+	exemplarsHeaderLen = 5
+	exemplarsTOCLen    = 8 + 4
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SeriesExemplars are the exemplars of the series with the given reference in the index of a block.
+type SeriesExemplars struct {
+	Ref       storage.SeriesRef
+	Exemplars []exemplar.Exemplar
+}
+
+// EncodeExemplars encodes the given exemplars in the format of the exemplars file. Series are sorted by reference and
+// their exemplars by timestamp, and duplicated exemplars are removed.
+func EncodeExemplars(series []SeriesExemplars) []byte {
+	series = append([]SeriesExemplars(nil), series...)
+	sort.Slice(series, func(i, j int) bool { return series[i].Ref < series[j].Ref })
+
+	buf := encoding.Encbuf{B: make([]byte, 0, 1024)}
+	buf.PutBE32(ExemplarsMagic)
+	buf.PutByte(ExemplarsFormatV1)
+
+	var (
+		entry   encoding.Encbuf
+		offsets = make([]uint64, 0, len(series))
+	)
+	for _, s := range series {
+		offsets = append(offsets, uint64(buf.Len()))
+
+		entry.Reset()
+		exemplars := sortedExemplars(s.Exemplars)
+		entry.PutUvarint(len(exemplars))
+		for _, e := range exemplars {
+			entry.PutUvarint(len(e.Labels))
+			for _, l := range e.Labels {
+				entry.PutUvarintStr(l.Name)
+				entry.PutUvarintStr(l.Value)
+			}
+			entry.PutVarint64(e.Ts)
+			entry.PutBEFloat64(e.Value)
+		}
+		buf.PutUvarint(entry.Len())
+		buf.PutBytes(entry.Get())
+		buf.PutBE32(crc32.Checksum(entry.Get(), castagnoliTable))
+	}
+
+	tableOff := buf.Len()
+	entry.Reset()
+	entry.PutUvarint(len(series))
+	var prevRef, prevOff uint64
+	for i, s := range series {
+		entry.PutUvarint64(uint64(s.Ref) - prevRef)
+		entry.PutUvarint64(offsets[i] - prevOff)
+		prevRef, prevOff = uint64(s.Ref), offsets[i]
+	}
+	buf.PutBE32int(entry.Len())
+	buf.PutBytes(entry.Get())
+	buf.PutBE32(crc32.Checksum(entry.Get(), castagnoliTable))
+
+	buf.PutBE64(uint64(tableOff))
+	buf.PutBE32(crc32.Checksum(buf.Get()[buf.Len()-8:], castagnoliTable))
+	return buf.Get()
+}
+
+// sortedExemplars returns the exemplars sorted by timestamp, without duplicates.
+func sortedExemplars(exemplars []exemplar.Exemplar) []exemplar.Exemplar {
+	res := append([]exemplar.Exemplar(nil), exemplars...)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Ts < res[j].Ts })
+
+	i := 0
+	for j := 1; j < len(res); j++ {
+		if res[i].Ts == res[j].Ts && res[i].Value == res[j].Value && labels.Equal(res[i].Labels, res[j].Labels) {
+			continue
+		}
+		i++
+		res[i] = res[j]
+	}
+	if len(res) == 0 {
+		return res
+	}
+	return res[:i+1]
+}
+
+// ExemplarsFile is a decoded exemplars file of a block.
+type ExemplarsFile struct {
+	b       []byte
+	refs    []storage.SeriesRef
+	offsets []int
+}
+
+// DecodeExemplars decodes the given exemplars file. Series are decoded on demand.
+func DecodeExemplars(b []byte) (*ExemplarsFile, error) {
+	if len(b) < exemplarsHeaderLen+exemplarsTOCLen {
+		return nil, errors.Errorf("exemplars file too small: %d bytes", len(b))
+	}
+	d := encoding.Decbuf{B: b[:exemplarsHeaderLen]}
+	if m := d.Be32(); m != ExemplarsMagic {
+		return nil, errors.Errorf("invalid exemplars file magic number %x", m)
+	}
+	if v := d.Byte(); v != ExemplarsFormatV1 {
+		return nil, errors.Errorf("unexpected exemplars file version %d, expected %d", v, ExemplarsFormatV1)
+	}
+
+	toc := encoding.Decbuf{B: b[len(b)-exemplarsTOCLen:]}
+	tableOff := toc.Be64int64()
+	if exp := toc.Be32(); crc32.Checksum(b[len(b)-exemplarsTOCLen:len(b)-4], castagnoliTable) != exp {
+		return nil, errors.New("exemplars file table of contents checksum mismatch")
+	}
+	if tableOff < exemplarsHeaderLen || tableOff > int64(len(b)-exemplarsTOCLen) {
+		return nil, errors.Errorf("invalid exemplars file series table offset %d", tableOff)
+	}
+
+	d = encoding.NewDecbufAt(exemplarsByteSlice(b[:len(b)-exemplarsTOCLen]), int(tableOff), castagnoliTable)
+	if d.Err() != nil {
+		return nil, errors.Wrap(d.Err(), "read exemplars file series table")
+	}
+	n := d.Uvarint()
+	if n > d.Len() {
+		return nil, errors.Errorf("invalid number of series %d in exemplars file series table", n)
+	}
+	f := &ExemplarsFile{
+		b:       b,
+		refs:    make([]storage.SeriesRef, 0, n),
+		offsets: make([]int, 0, n),
+	}
+	var ref, off uint64
+	for i := 0; i < n && d.Err() == nil; i++ {
+		ref += d.Uvarint64()
+		off += d.Uvarint64()
+		f.refs = append(f.refs, storage.SeriesRef(ref))
+		f.offsets = append(f.offsets, int(off))
+	}
+	if d.Err() != nil {
+		return nil, errors.Wrap(d.Err(), "decode exemplars file series table")
+	}
+	return f, nil
+}
+
+// Refs returns the references of the series with exemplars, sorted.
+func (f *ExemplarsFile) Refs() []storage.SeriesRef {
+	return f.refs
+}
+
+// Size returns the size of the file in bytes.
+func (f *ExemplarsFile) Size() int {
+	return len(f.b)
+}
+
+// Exemplars returns the exemplars of the series with the given reference within the given closed time range, sorted by
+// timestamp. It returns no exemplars if the series has none.
+func (f *ExemplarsFile) Exemplars(ref storage.SeriesRef, mint, maxt int64) ([]exemplar.Exemplar, error) {
+	i := sort.Search(len(f.refs), func(i int) bool { return f.refs[i] >= ref })
+	if i == len(f.refs) || f.refs[i] != ref {
+		return nil, nil
+	}
+
+	d := encoding.NewDecbufUvarintAt(exemplarsByteSlice(f.b), f.offsets[i], castagnoliTable)
+	if d.Err() != nil {
+		return nil, errors.Wrapf(d.Err(), "read exemplars of series %d", ref)
+	}
+	var res []exemplar.Exemplar
+	for n := d.Uvarint(); n > 0 && d.Err() == nil; n-- {
+		lset := make(labels.Labels, d.Uvarint())
+		for j := range lset {
+			lset[j].Name = d.UvarintStr()
+			lset[j].Value = d.UvarintStr()
+		}
+		e := exemplar.Exemplar{Labels: lset, Ts: d.Varint64(), Value: d.Be64Float64(), HasTs: true}
+		if e.Ts > maxt {
+			break
+		}
+		if e.Ts >= mint {
+			res = append(res, e)
+		}
+	}
+	if d.Err() != nil {
+		return nil, errors.Wrapf(d.Err(), "decode exemplars of series %d", ref)
+	}
+	return res, nil
+}
+
+type exemplarsByteSlice []byte
+
+func (b exemplarsByteSlice) Len() int {
+	return len(b)
+}
+
+func (b exemplarsByteSlice) Range(start, end int) []byte {
+	return b[start:end]
+}
+
+// HasExemplars returns true if the block of the given meta has an exemplars file, according to the files listed in
+// the meta.
+func HasExemplars(m *metadata.Meta) bool {
+	for _, f := range m.Thanos.Files {
+		if f.RelPath == ExemplarsFilename {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteExemplars writes the exemplars file of the block in the given dir with the given exemplars, resolving the
+// references of their series in the index of the block. Exemplars of series the block does not have, or outside of
+// its time range, are dropped. It returns the number of exemplars written; no file is written if there are none.
+func WriteExemplars(logger log.Logger, blockDir string, results []exemplar.QueryResult) (int, error) {
+	meta, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return 0, errors.Wrap(err, "read meta")
+	}
+
+	bySeries := make(map[uint64][]exemplar.QueryResult, len(results))
+	for _, r := range results {
+		h := r.SeriesLabels.Hash()
+		bySeries[h] = append(bySeries[h], r)
+	}
+
+	var (
+		series []SeriesExemplars
+		total  int
+	)
+	if err := iterSeries(filepath.Join(blockDir, IndexFilename), func(ref storage.SeriesRef, lset labels.Labels) {
+		rs, ok := bySeries[lset.Hash()]
+		if !ok {
+			return
+		}
+		s := SeriesExemplars{Ref: ref}
+		for _, r := range rs {
+			if !labels.Equal(r.SeriesLabels, lset) {
+				continue
+			}
+			for _, e := range r.Exemplars {
+				if e.Ts >= meta.MinTime && e.Ts < meta.MaxTime {
+					s.Exemplars = append(s.Exemplars, e)
+				}
+			}
+		}
+		s.Exemplars = sortedExemplars(s.Exemplars)
+		if len(s.Exemplars) > 0 {
+			series = append(series, s)
+			total += len(s.Exemplars)
+		}
+	}); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	fn := filepath.Join(blockDir, ExemplarsFilename)
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, EncodeExemplars(series), 0600); err != nil {
+		return 0, errors.Wrap(err, "write exemplars file")
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return 0, errors.Wrap(err, "rename exemplars file")
+	}
+	level.Debug(logger).Log("msg", "wrote exemplars file", "block", meta.ULID, "series", len(series), "exemplars", total)
+	return total, nil
+}
+
+// ReadExemplars reads the exemplars of the block in the given dir, along with the labels of their series. It returns
+// no exemplars if the block has no exemplars file.
+func ReadExemplars(blockDir string) ([]exemplar.QueryResult, error) {
+	b, err := ioutil.ReadFile(filepath.Join(blockDir, ExemplarsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read exemplars file")
+	}
+	f, err := DecodeExemplars(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode exemplars file")
+	}
+
+	var (
+		res       []exemplar.QueryResult
+		refs      = f.Refs()
+		seriesErr error
+	)
+	if err := iterSeries(filepath.Join(blockDir, IndexFilename), func(ref storage.SeriesRef, lset labels.Labels) {
+		if seriesErr != nil || len(refs) == 0 || refs[0] != ref {
+			return
+		}
+		refs = refs[1:]
+
+		exemplars, err := f.Exemplars(ref, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			seriesErr = err
+			return
+		}
+		res = append(res, exemplar.QueryResult{SeriesLabels: lset.Copy(), Exemplars: exemplars})
+	}); err != nil {
+		return nil, err
+	}
+	if seriesErr != nil {
+		return nil, seriesErr
+	}
+	if len(refs) > 0 {
+		return nil, errors.Errorf("exemplars of series %d not in the index", refs[0])
+	}
+	return res, nil
+}
+
+// CopyExemplars writes the exemplars file of the block in dstDir with the exemplars of the blocks in srcDirs, e.g. the
+// source blocks of a compacted or downsampled block. Exemplars of series the block does not have are dropped. It
+// returns the number of exemplars written.
+func CopyExemplars(logger log.Logger, dstDir string, srcDirs ...string) (int, error) {
+	var res []exemplar.QueryResult
+	for _, dir := range srcDirs {
+		r, err := ReadExemplars(dir)
+		if err != nil {
+			return 0, errors.Wrapf(err, "read exemplars of block %s", dir)
+		}
+		res = append(res, r...)
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+	return WriteExemplars(logger, dstDir, res)
+}
+
+// iterSeries calls f with the reference and labels of each series of the given index file, in order of reference.
+// The labels must not be retained.
+func iterSeries(fn string, f func(ref storage.SeriesRef, lset labels.Labels)) (err error) {
+	r, err := index.NewFileReader(fn)
+	if err != nil {
+		return errors.Wrap(err, "open index file")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "series index reader")
+
+	p, err := r.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "get all postings")
+	}
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for p.Next() {
+		if err := r.Series(p.At(), &lset, &chks); err != nil {
+			return errors.Wrap(err, "read series")
+		}
+		f(p.At(), lset)
+	}
+	return errors.Wrap(p.Err(), "iterate postings")
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestExemplarsFile_EncodeDecode(t *testing.T) {
+	ex := func(ts int64, v float64, traceID string) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", traceID), Value: v, Ts: ts, HasTs: true}
+	}
+	b := EncodeExemplars([]SeriesExemplars{
+		{Ref: 16, Exemplars: []exemplar.Exemplar{ex(30, 3, "c"), ex(10, 1, "a"), ex(20, 2, "b"), ex(10, 1, "a")}},
+		{Ref: 48, Exemplars: []exemplar.Exemplar{ex(5, 0.5, "d")}},
+	})
+
+	f, err := DecodeExemplars(b)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []storage.SeriesRef{16, 48}, f.Refs())
+	testutil.Equals(t, len(b), f.Size())
+
+	// Exemplars are sorted by timestamp and deduplicated.
+	res, err := f.Exemplars(16, 10, 20)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []exemplar.Exemplar{ex(10, 1, "a"), ex(20, 2, "b")}, res)
+	res, err = f.Exemplars(48, 6, 100)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(res))
+	res, err = f.Exemplars(32, 0, 100)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(res))
+
+	// Corrupted series are detected by their checksum.
+	corrupted := append([]byte{}, b...)
+	corrupted[exemplarsHeaderLen+3]++
+	f, err = DecodeExemplars(corrupted)
+	testutil.Ok(t, err)
+	_, err = f.Exemplars(16, 0, 100)
+	testutil.NotOk(t, err)
+
+	_, err = DecodeExemplars(b[:len(b)-1])
+	testutil.NotOk(t, err)
+}
+
+func TestWriteReadCopyExemplars(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	tmpDir := t.TempDir()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+		labels.FromStrings("a", "3"),
+	}
+	id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 100, 0, 1000, labels.FromStrings("ext1", "val1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(tmpDir, id.String())
+
+	ex := func(ts int64) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "abc"), Value: 1, Ts: ts, HasTs: true}
+	}
+	n, err := WriteExemplars(logger, bdir, []exemplar.QueryResult{
+		{SeriesLabels: labels.FromStrings("a", "1"), Exemplars: []exemplar.Exemplar{ex(100), ex(2000)}},
+		{SeriesLabels: labels.FromStrings("a", "3"), Exemplars: []exemplar.Exemplar{ex(200), ex(300)}},
+		// Series the block does not have are dropped.
+		{SeriesLabels: labels.FromStrings("a", "4"), Exemplars: []exemplar.Exemplar{ex(200)}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, n)
+
+	expected := []exemplar.QueryResult{
+		{SeriesLabels: labels.FromStrings("a", "1"), Exemplars: []exemplar.Exemplar{ex(100)}},
+		{SeriesLabels: labels.FromStrings("a", "3"), Exemplars: []exemplar.Exemplar{ex(200), ex(300)}},
+	}
+	res, err := ReadExemplars(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, res)
+
+	// The exemplars file is uploaded along with the block and listed in its meta.
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, Upload(ctx, logger, bkt, bdir, metadata.NoneFunc))
+	ok, err := bkt.Exists(ctx, path.Join(id.String(), ExemplarsFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "exemplars file not uploaded")
+	meta, err := DownloadMeta(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Assert(t, HasExemplars(&meta), "exemplars file not in meta")
+
+	// Exemplars are copied to blocks created from the block, e.g. compacted ones.
+	id2, err := e2eutil.CreateBlock(ctx, tmpDir, series[:2], 100, 0, 1000, labels.FromStrings("ext1", "val1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	bdir2 := filepath.Join(tmpDir, id2.String())
+	n, err = CopyExemplars(logger, bdir2, bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, n)
+	res, err = ReadExemplars(bdir2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected[:1], res)
+
+	// Blocks without exemplars file have no exemplars.
+	n, err = CopyExemplars(logger, bdir, bdir2+"-none")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, n)
+}
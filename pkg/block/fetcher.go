@@ -6,6 +6,7 @@ package block
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -71,6 +72,8 @@ const (
 	// Synced label values.
 	labelExcludedMeta = "label-excluded"
 	timeExcludedMeta  = "time-excluded"
+	tierExcludedMeta  = "tier-excluded"
+	relocatedMeta     = "relocated"
 	tooFreshMeta      = "too-fresh"
 	duplicateMeta     = "duplicate"
 	// Blocks that are marked for deletion can be loaded as well. This is done to make sure that we load blocks that are meant to be deleted,
@@ -80,8 +83,12 @@ const (
 	// MarkedForNoCompactionMeta is label for blocks which are loaded but also marked for no compaction. This label is also counted in `loaded` label metric.
 	MarkedForNoCompactionMeta = "marked-for-no-compact"
 
+	// NewerMetaVersionMeta is label for blocks excluded because their meta was written by a newer version of Thanos.
+	NewerMetaVersionMeta = "newer-meta-version"
+
 	// Modified label values.
-	replicaRemovedMeta = "replica-label-removed"
+	replicaRemovedMeta       = "replica-label-removed"
+	groupKeyLabelRemovedMeta = "group-key-label-removed"
 )
 
 func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExtraLabels [][]string) *FetcherMetrics {
@@ -119,9 +126,12 @@ func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExt
 			{FailedMeta},
 			{labelExcludedMeta},
 			{timeExcludedMeta},
+			{tierExcludedMeta},
+			{relocatedMeta},
 			{duplicateMeta},
 			{MarkedForDeletionMeta},
 			{MarkedForNoCompactionMeta},
+			{NewerMetaVersionMeta},
 		}, syncedExtraLabels...)...,
 	)
 	m.Modified = extprom.NewTxGaugeVec(
@@ -134,6 +144,7 @@ func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExt
 		[]string{"modified"},
 		append([][]string{
 			{replicaRemovedMeta},
+			{groupKeyLabelRemovedMeta},
 		}, modifiedExtraLabels...)...,
 	)
 	return &m
@@ -535,6 +546,57 @@ func (f *TimePartitionMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]
 	return nil
 }
 
+// TierMetaFilter is a BaseFetcher filter that filters out blocks of other storage tiers than the given one, e.g. the
+// blocks of a cold bucket which were not relocated there by the compactor.
+// Not go-routine safe.
+type TierMetaFilter struct {
+	tier string
+}
+
+// NewTierMetaFilter creates TierMetaFilter keeping the blocks of the given tier, empty for the blocks which were not
+// relocated.
+func NewTierMetaFilter(tier string) *TierMetaFilter {
+	return &TierMetaFilter{tier: tier}
+}
+
+// Filter filters out blocks of other tiers.
+func (f *TierMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, modified *extprom.TxGaugeVec) error {
+	for id, m := range metas {
+		if m.Thanos.Tier == f.tier {
+			continue
+		}
+		synced.WithLabelValues(tierExcludedMeta).Inc()
+		delete(metas, id)
+	}
+	return nil
+}
+
+// RelocatedMetaFilter is a BaseFetcher filter that filters out the blocks marked for deletion because they were
+// relocated to the bucket of another storage tier, once their copy is served from there.
+// Not go-routine safe.
+type RelocatedMetaFilter struct {
+	deletionMarks func() map[ulid.ULID]*metadata.DeletionMark
+	served        func(ulid.ULID) bool
+}
+
+// NewRelocatedMetaFilter creates RelocatedMetaFilter. It has to run after the filter returning the deletion marks,
+// e.g. IgnoreDeletionMarkFilter.DeletionMarkBlocks.
+func NewRelocatedMetaFilter(deletionMarks func() map[ulid.ULID]*metadata.DeletionMark, served func(ulid.ULID) bool) *RelocatedMetaFilter {
+	return &RelocatedMetaFilter{deletionMarks: deletionMarks, served: served}
+}
+
+// Filter filters out relocated blocks whose copy is served.
+func (f *RelocatedMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, modified *extprom.TxGaugeVec) error {
+	for id, m := range f.deletionMarks() {
+		if _, ok := metas[id]; !ok || m.Reason != metadata.RelocatedDeletionReason || !f.served(id) {
+			continue
+		}
+		synced.WithLabelValues(relocatedMeta).Inc()
+		delete(metas, id)
+	}
+	return nil
+}
+
 var _ MetadataFilter = &LabelShardedMetaFilter{}
 
 // LabelShardedMetaFilter represents struct that allows sharding.
@@ -604,9 +666,12 @@ func (f *DeduplicateFilter) Filter(_ context.Context, metas map[ulid.ULID]*metad
 	}
 
 	// We need only look within a compaction group for duplicates, so splitting by group key gives us parallelizable streams.
+	// Blocks split into shards are compared with the blocks they were split from, so shards are ignored.
 	metasByCompactionGroup := make(map[string][]*metadata.Meta)
 	for _, meta := range metas {
-		groupKey := meta.Thanos.GroupKey()
+		unsharded := meta.Thanos
+		unsharded.Shard = nil
+		groupKey := unsharded.GroupKey()
 		metasByCompactionGroup[groupKey] = append(metasByCompactionGroup[groupKey], meta)
 	}
 	for _, group := range metasByCompactionGroup {
@@ -624,6 +689,10 @@ func (f *DeduplicateFilter) filterGroup(metaSlice []*metadata.Meta, metas map[ul
 		jlen := len(metaSlice[j].Compaction.Sources)
 
 		if ilen == jlen {
+			// Prefer blocks split into more shards, as those are split from the other ones.
+			if icount, jcount := shardCount(metaSlice[i].Thanos.Shard), shardCount(metaSlice[j].Thanos.Shard); icount != jcount {
+				return icount > jcount
+			}
 			return metaSlice[i].ULID.Compare(metaSlice[j].ULID) < 0
 		}
 
@@ -635,14 +704,26 @@ func (f *DeduplicateFilter) filterGroup(metaSlice []*metadata.Meta, metas map[ul
 childLoop:
 	for _, child := range metaSlice {
 		childSources := child.Compaction.Sources
+		var splitInto []*metadata.ThanosShard
 		for _, parent := range coveringSet {
 			parentSources := parent.Compaction.Sources
+			if !contains(parentSources, childSources) {
+				continue
+			}
 
-			// child's sources are present in parent's sources, filter it out.
-			if contains(parentSources, childSources) {
+			// child's sources and series are present in parent, filter it out.
+			if parent.Thanos.Shard.Covers(child.Thanos.Shard) {
 				duplicates = append(duplicates, child.ULID)
 				continue childLoop
 			}
+			if child.Thanos.Shard.Covers(parent.Thanos.Shard) {
+				splitInto = append(splitInto, parent.Thanos.Shard)
+			}
+		}
+		// child's sources are present in parents holding all its series together, filter it out.
+		if shardsCover(child.Thanos.Shard, splitInto) {
+			duplicates = append(duplicates, child.ULID)
+			continue childLoop
 		}
 
 		// Child's sources not covered by any member of coveringSet, add it to coveringSet.
@@ -660,6 +741,54 @@ childLoop:
 	f.mu.Unlock()
 }
 
+func shardCount(s *metadata.ThanosShard) uint64 {
+	if s == nil {
+		return 1
+	}
+	return s.Count
+}
+
+// maxShardCoverResidues limits the residues checked by shardsCover. Shards for which more would be needed are considered not covered.
+const maxShardCoverResidues = 1 << 16
+
+// shardsCover returns true if all series of the given shard belong to any of the given shards.
+func shardsCover(shard *metadata.ThanosShard, shards []*metadata.ThanosShard) bool {
+	if len(shards) == 0 {
+		return false
+	}
+
+	// Series belong to a shard depending only on their hash modulo the least common multiple of all shard counts.
+	l := shardCount(shard)
+	for _, s := range shards {
+		l = lcm(l, s.Count)
+		if l > maxShardCoverResidues {
+			return false
+		}
+	}
+	index := uint64(0)
+	if shard != nil {
+		index = shard.Index
+	}
+ResiduesLoop:
+	for r := index; r < l; r += shardCount(shard) {
+		for _, s := range shards {
+			if r%s.Count == s.Index {
+				continue ResiduesLoop
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func lcm(a, b uint64) uint64 {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
 // DuplicateIDs returns slice of block ids that are filtered out by DeduplicateFilter.
 func (f *DeduplicateFilter) DuplicateIDs() []ulid.ULID {
 	return f.duplicateIDs
@@ -726,6 +855,57 @@ func (r *ReplicaLabelRemover) Filter(_ context.Context, metas map[ulid.ULID]*met
 	return nil
 }
 
+var _ MetadataFilter = &GroupKeyLabelRemover{}
+
+// GroupKeyLabelRemover is a BaseFetcher filter that removes the given external labels from the metadata of blocks, so
+// that blocks only differing by these labels have the same compaction group key. Unlike ReplicaLabelRemover, it fails
+// on blocks left without external labels, as these would be compacted with the blocks of all sources.
+type GroupKeyLabelRemover struct {
+	logger log.Logger
+
+	labels []string
+}
+
+// NewGroupKeyLabelRemover creates a GroupKeyLabelRemover.
+func NewGroupKeyLabelRemover(logger log.Logger, labels []string) *GroupKeyLabelRemover {
+	return &GroupKeyLabelRemover{logger: logger, labels: labels}
+}
+
+// Filter removes the labels of the GroupKeyLabelRemover from the external labels of the blocks having them.
+func (r *GroupKeyLabelRemover) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, modified *extprom.TxGaugeVec) error {
+	if len(r.labels) == 0 {
+		return nil
+	}
+
+	for u, meta := range metas {
+		l := make(map[string]string, len(meta.Thanos.Labels))
+		for n, v := range meta.Thanos.Labels {
+			l[n] = v
+		}
+
+		removed := false
+		for _, name := range r.labels {
+			if _, exists := l[name]; exists {
+				delete(l, name)
+				removed = true
+			}
+		}
+		if !removed {
+			continue
+		}
+		if len(l) == 0 {
+			return errors.Errorf("block %s has no external labels left once the %v group key labels are removed", u, r.labels)
+		}
+		level.Debug(r.logger).Log("msg", "group key labels removed", "block", u, "labels", fmt.Sprint(r.labels))
+		modified.WithLabelValues(groupKeyLabelRemovedMeta).Inc()
+
+		nm := *meta
+		nm.Thanos.Labels = l
+		metas[u] = &nm
+	}
+	return nil
+}
+
 // ConsistencyDelayMetaFilter is a BaseFetcher filter that filters out blocks that are created before a specified consistency delay.
 // Not go-routine safe.
 type ConsistencyDelayMetaFilter struct {
@@ -795,6 +975,11 @@ func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBuc
 	}
 }
 
+// Delay returns the duration after which the blocks marked for deletion are filtered out.
+func (f *IgnoreDeletionMarkFilter) Delay() time.Duration {
+	return f.delay
+}
+
 // DeletionMarkBlocks returns block ids that were marked for deletion.
 func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.DeletionMark {
 	f.mtx.Lock()
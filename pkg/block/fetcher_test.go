@@ -523,9 +523,49 @@ func TestTimePartitionMetaFilter_Filter(t *testing.T) {
 
 }
 
+func TestTierMetaFilter_Filter(t *testing.T) {
+	ctx := context.Background()
+
+	input := map[ulid.ULID]*metadata.Meta{
+		ULID(1): {},
+		ULID(2): {Thanos: metadata.Thanos{Tier: metadata.ColdTier}},
+		ULID(3): {},
+	}
+
+	m := newTestFetcherMetrics()
+	testutil.Ok(t, NewTierMetaFilter(metadata.ColdTier).Filter(ctx, input, m.Synced, nil))
+	testutil.Equals(t, map[ulid.ULID]*metadata.Meta{ULID(2): {Thanos: metadata.Thanos{Tier: metadata.ColdTier}}}, input)
+	testutil.Equals(t, 2.0, promtest.ToFloat64(m.Synced.WithLabelValues(tierExcludedMeta)))
+}
+
+func TestRelocatedMetaFilter_Filter(t *testing.T) {
+	ctx := context.Background()
+
+	input := map[ulid.ULID]*metadata.Meta{
+		ULID(1): {},
+		ULID(2): {},
+		ULID(3): {},
+		ULID(4): {},
+	}
+	marks := map[ulid.ULID]*metadata.DeletionMark{
+		ULID(1): {ID: ULID(1), Reason: metadata.RelocatedDeletionReason},
+		ULID(2): {ID: ULID(2), Reason: metadata.RelocatedDeletionReason},
+		ULID(3): {ID: ULID(3)},
+		ULID(5): {ID: ULID(5), Reason: metadata.RelocatedDeletionReason},
+	}
+	served := map[ulid.ULID]bool{ULID(1): true, ULID(3): true, ULID(5): true}
+
+	m := newTestFetcherMetrics()
+	f := NewRelocatedMetaFilter(func() map[ulid.ULID]*metadata.DeletionMark { return marks }, func(id ulid.ULID) bool { return served[id] })
+	testutil.Ok(t, f.Filter(ctx, input, m.Synced, nil))
+	testutil.Equals(t, map[ulid.ULID]*metadata.Meta{ULID(2): {}, ULID(3): {}, ULID(4): {}}, input)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.Synced.WithLabelValues(relocatedMeta)))
+}
+
 type sourcesAndResolution struct {
 	sources    []ulid.ULID
 	resolution int64
+	shard      *metadata.ThanosShard
 }
 
 func TestDeduplicateFilter_Filter(t *testing.T) {
@@ -846,6 +886,75 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 				ULID(12),
 			},
 		},
+		{
+			name: "compacted block split into all shards",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(1): {
+					sources: []ulid.ULID{ULID(1)},
+				},
+				ULID(2): {
+					sources: []ulid.ULID{ULID(2)},
+				},
+				ULID(3): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 0, Count: 2},
+				},
+				ULID(4): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 1, Count: 2},
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(3),
+				ULID(4),
+			},
+		},
+		{
+			name: "compacted block split, but not all shards uploaded yet",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(1): {
+					sources: []ulid.ULID{ULID(1)},
+				},
+				ULID(2): {
+					sources: []ulid.ULID{ULID(2)},
+				},
+				ULID(3): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 0, Count: 2},
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(1),
+				ULID(2),
+				ULID(3),
+			},
+		},
+		{
+			name: "shard split further",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(3): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 0, Count: 2},
+				},
+				ULID(4): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 1, Count: 2},
+				},
+				ULID(5): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 0, Count: 4},
+				},
+				ULID(6): {
+					sources: []ulid.ULID{ULID(1), ULID(2)},
+					shard:   &metadata.ThanosShard{Index: 2, Count: 4},
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(4),
+				ULID(5),
+				ULID(6),
+			},
+		},
 	} {
 		f := NewDeduplicateFilter(1)
 		if ok := t.Run(tcase.name, func(t *testing.T) {
@@ -864,6 +973,7 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 						Downsample: metadata.ThanosDownsample{
 							Resolution: metaInfo.resolution,
 						},
+						Shard: metaInfo.shard,
 					},
 				}
 			}
@@ -943,6 +1053,30 @@ func TestReplicaLabelRemover_Modify(t *testing.T) {
 	}
 }
 
+func TestGroupKeyLabelRemover_Modify(t *testing.T) {
+	ctx := context.Background()
+
+	input := map[ulid.ULID]*metadata.Meta{
+		ULID(1): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu", "shard": "a"}}},
+		ULID(2): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu", "shard": "b"}}},
+		ULID(3): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu"}}},
+	}
+	m := newTestFetcherMetrics()
+	testutil.Ok(t, NewGroupKeyLabelRemover(log.NewNopLogger(), []string{"shard"}).Filter(ctx, input, nil, m.Modified))
+	testutil.Equals(t, map[ulid.ULID]*metadata.Meta{
+		ULID(1): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu"}}},
+		ULID(2): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu"}}},
+		ULID(3): {Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "eu"}}},
+	}, input)
+	testutil.Equals(t, 2.0, promtest.ToFloat64(m.Modified.WithLabelValues(groupKeyLabelRemovedMeta)))
+
+	// Blocks left without labels would be compacted with the blocks of all sources.
+	input = map[ulid.ULID]*metadata.Meta{
+		ULID(1): {Thanos: metadata.Thanos{Labels: map[string]string{"shard": "a"}}},
+	}
+	testutil.NotOk(t, NewGroupKeyLabelRemover(log.NewNopLogger(), []string{"shard"}).Filter(ctx, input, nil, newTestFetcherMetrics().Modified))
+}
+
 func compareSliceWithMapKeys(tb testing.TB, m map[ulid.ULID]*metadata.Meta, s []ulid.ULID) {
 	_, file, line, _ := runtime.Caller(1)
 	matching := true
@@ -0,0 +1,784 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// indexTOCLen is the length of the TOC at the end of an index, without its checksum.
+	indexTOCLen = 6*8 + crc32.Size
+	// analyzeReadBufferSize is the size of the buffers of the streams read from the index.
+	analyzeReadBufferSize = 1 << 20
+	// churnPairsCapacityFactor is the number of label pairs for which the churn is tracked, per reported label pair.
+	churnPairsCapacityFactor = 100
+)
+
+// IndexAnalysisOptions configures the analysis of the index of a block.
+type IndexAnalysisOptions struct {
+	// Limit is the number of entries reported in each top list.
+	Limit int
+	// SampledChunks is the number of chunks sampled at random to gather the chunk statistics. 0 disables the sampling.
+	SampledChunks int
+}
+
+// IndexSection is a section of an index and its size in bytes.
+type IndexSection struct {
+	Name  string `json:"name"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// LabelPairStats are the statistics of a label pair.
+type LabelPairStats struct {
+	Name          string `json:"name"`
+	Value         string `json:"value"`
+	Series        uint64 `json:"series"`
+	PostingsBytes uint64 `json:"postingsBytes"`
+}
+
+// LabelNameStats are the statistics of a label name, over all its values.
+type LabelNameStats struct {
+	Name          string `json:"name"`
+	Values        uint64 `json:"values"`
+	Series        uint64 `json:"series"`
+	PostingsBytes uint64 `json:"postingsBytes"`
+}
+
+// ChurnStats is the churn of the series with a label name or pair, in series over the whole block range: the sum,
+// over these series, of the part of the block range they don't cover.
+type ChurnStats struct {
+	Name  string  `json:"name"`
+	Value string  `json:"value,omitempty"`
+	Churn float64 `json:"churn"`
+}
+
+// ChunkSampleStats are the statistics of the chunks sampled at random.
+type ChunkSampleStats struct {
+	Chunks  uint64 `json:"chunks"`
+	Samples uint64 `json:"samples"`
+	Bytes   uint64 `json:"bytes"`
+	// Encodings is the number of sampled chunks per encoding.
+	Encodings map[string]uint64 `json:"encodings"`
+}
+
+// IndexAnalysis is the cardinality analysis of the index of a block.
+type IndexAnalysis struct {
+	ULID         ulid.ULID      `json:"ulid"`
+	IndexVersion int            `json:"indexVersion"`
+	IndexBytes   uint64         `json:"indexBytes"`
+	Sections     []IndexSection `json:"sections"`
+	Series       uint64         `json:"series"`
+	Chunks       uint64         `json:"chunks"`
+	LabelNames   uint64         `json:"labelNames"`
+	LabelPairs   uint64         `json:"labelPairs"`
+
+	// TopLabelPairs are the label pairs with the most series.
+	TopLabelPairs []LabelPairStats `json:"topLabelPairs"`
+	// TopMetricNames are the metric names with the most series.
+	TopMetricNames []LabelPairStats `json:"topMetricNames"`
+	// TopLabelNamesByValues are the label names with the most values.
+	TopLabelNamesByValues []LabelNameStats `json:"topLabelNamesByValues"`
+	// TopLabelNamesByPostings are the label names with the largest postings.
+	TopLabelNamesByPostings []LabelNameStats `json:"topLabelNamesByPostings"`
+	// TopChurnLabelNames are the label names most involved in series churn.
+	TopChurnLabelNames []ChurnStats `json:"topChurnLabelNames"`
+	// TopChurnLabelPairs are the label pairs most involved in series churn. It is an approximation, which may
+	// overestimate the churn of label pairs involved in little churn.
+	TopChurnLabelPairs []ChurnStats `json:"topChurnLabelPairs"`
+
+	// ChunkSample is only set if chunks were sampled.
+	ChunkSample *ChunkSampleStats `json:"chunkSample,omitempty"`
+}
+
+// AnalyzeIndex analyzes the cardinality of the block with the given ID by streaming its index from the bucket, without
+// downloading it. The memory used doesn't depend on the size of the index, but on the number of label names and the
+// limit of the options.
+func AnalyzeIndex(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, opts IndexAnalysisOptions) (*IndexAnalysis, error) {
+	if opts.Limit <= 0 {
+		return nil, errors.New("limit must be greater than 0")
+	}
+	meta, err := DownloadMeta(ctx, logger, bkt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &indexAnalyzer{
+		ctx:  ctx,
+		bkt:  bkt,
+		opts: opts,
+		path: path.Join(id.String(), IndexFilename),
+		res:  &IndexAnalysis{ULID: id},
+	}
+	if err := a.readTOC(); err != nil {
+		return nil, err
+	}
+	if err := a.analyzePostings(); err != nil {
+		return nil, err
+	}
+	if err := a.analyzeSeries(meta.MinTime, meta.MaxTime); err != nil {
+		return nil, err
+	}
+	if err := a.resolveChurn(meta.MaxTime - meta.MinTime); err != nil {
+		return nil, err
+	}
+	if opts.SampledChunks > 0 {
+		if err := a.sampleChunks(meta.Thanos.SegmentFiles); err != nil {
+			return nil, err
+		}
+	}
+	return a.res, nil
+}
+
+type indexAnalyzer struct {
+	ctx  context.Context
+	bkt  objstore.Bucket
+	opts IndexAnalysisOptions
+	path string
+	toc  *index.TOC
+	res  *IndexAnalysis
+
+	// The churn in milliseconds per label name and pair symbol references, gathered from the series.
+	churnNames map[uint32]uint64
+	churnPairs *spaceSaving
+	// chunkRefs is a reservoir of the references of the chunks to sample.
+	chunkRefs []uint64
+}
+
+func (a *indexAnalyzer) readTOC() error {
+	attrs, err := a.bkt.Attributes(a.ctx, a.path)
+	if err != nil {
+		return errors.Wrapf(err, "get object attributes of %s", a.path)
+	}
+	a.res.IndexBytes = uint64(attrs.Size)
+	if attrs.Size < index.HeaderLen+indexTOCLen {
+		return errors.Errorf("index %s is too small", a.path)
+	}
+
+	header, err := a.readRange(0, index.HeaderLen)
+	if err != nil {
+		return err
+	}
+	if m := binary.BigEndian.Uint32(header[0:4]); m != index.MagicIndex {
+		return errors.Errorf("invalid magic number %x for %s", m, a.path)
+	}
+	a.res.IndexVersion = int(header[4])
+	if a.res.IndexVersion != index.FormatV1 && a.res.IndexVersion != index.FormatV2 {
+		return errors.Errorf("not supported index file version %d of %s", a.res.IndexVersion, a.path)
+	}
+
+	b, err := a.readRange(attrs.Size-indexTOCLen, indexTOCLen)
+	if err != nil {
+		return err
+	}
+	if a.toc, err = index.NewTOCFromByteSlice(realByteSlice(b)); err != nil {
+		return errors.Wrap(err, "read TOC")
+	}
+
+	end := a.res.IndexBytes - indexTOCLen
+	a.res.Sections = []IndexSection{
+		{Name: "symbols", Bytes: a.toc.Series - a.toc.Symbols},
+		{Name: "series", Bytes: a.toc.LabelIndices - a.toc.Series},
+		{Name: "label indices", Bytes: a.toc.Postings - a.toc.LabelIndices},
+		{Name: "postings", Bytes: a.toc.LabelIndicesTable - a.toc.Postings},
+		{Name: "label offset table", Bytes: a.toc.PostingsTable - a.toc.LabelIndicesTable},
+		{Name: "postings offset table", Bytes: end - a.toc.PostingsTable},
+	}
+	return nil
+}
+
+func (a *indexAnalyzer) readRange(off, length int64) (_ []byte, err error) {
+	rc, err := a.bkt.GetRange(a.ctx, a.path, off, length)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get range of %s", a.path)
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "close range reader")
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read range of %s", a.path)
+	}
+	if int64(len(b)) != length {
+		return nil, errors.Errorf("unexpected length %d of range of %s, expected %d", len(b), a.path, length)
+	}
+	return b, nil
+}
+
+// openStream opens a stream of the index from the given offset to the given end.
+func (a *indexAnalyzer) openStream(start, end uint64) (*indexStream, error) {
+	rc, err := a.bkt.GetRange(a.ctx, a.path, int64(start), int64(end-start))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get range of %s", a.path)
+	}
+	return &indexStream{rc: rc, r: bufio.NewReaderSize(rc, analyzeReadBufferSize), pos: start}, nil
+}
+
+// analyzePostings walks the postings offset table, whose entries are sorted by label name and value, along with the
+// postings they point to, to gather the statistics of the label names and pairs.
+func (a *indexAnalyzer) analyzePostings() (err error) {
+	table, err := a.openStream(a.toc.PostingsTable, a.res.IndexBytes-indexTOCLen)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, table, "close postings offset table reader")
+
+	postings, err := a.openStream(a.toc.Postings, a.toc.LabelIndicesTable)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, postings, "close postings reader")
+
+	var (
+		limit          = a.opts.Limit
+		topPairs       = newTopK(limit)
+		topMetricNames = newTopK(limit)
+		topByValues    = newTopK(limit)
+		topByPostings  = newTopK(limit)
+		current        *LabelNameStats
+	)
+	flushName := func() {
+		if current == nil {
+			return
+		}
+		a.res.LabelNames++
+		topByValues.push(current.Values, *current)
+		topByPostings.push(current.PostingsBytes, *current)
+	}
+
+	if _, err := table.be32(); err != nil {
+		return errors.Wrap(err, "read postings offset table length")
+	}
+	n, err := table.be32()
+	if err != nil {
+		return errors.Wrap(err, "read postings offset table entries")
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		if keyCount, err := table.uvarint(); err != nil {
+			return errors.Wrap(err, "read postings offset table entry")
+		} else if keyCount != 2 {
+			return errors.Errorf("unexpected key length for posting table %d", keyCount)
+		}
+		name, err := table.uvarintStr()
+		if err != nil {
+			return errors.Wrap(err, "read label name")
+		}
+		value, err := table.uvarintStr()
+		if err != nil {
+			return errors.Wrap(err, "read label value")
+		}
+		off, err := table.uvarint()
+		if err != nil {
+			return errors.Wrap(err, "read postings offset")
+		}
+
+		if err := postings.skipTo(off); err != nil {
+			return errors.Wrapf(err, "seek to postings of %s=%s", name, value)
+		}
+		length, err := postings.be32()
+		if err != nil {
+			return errors.Wrapf(err, "read postings length of %s=%s", name, value)
+		}
+		series, err := postings.be32()
+		if err != nil {
+			return errors.Wrapf(err, "read postings of %s=%s", name, value)
+		}
+		if name == "" && value == "" {
+			// The postings of all series.
+			continue
+		}
+
+		pair := LabelPairStats{Name: name, Value: value, Series: uint64(series), PostingsBytes: uint64(length) + 4 + crc32.Size}
+		a.res.LabelPairs++
+		topPairs.push(pair.Series, pair)
+		if name == labels.MetricName {
+			topMetricNames.push(pair.Series, pair)
+		}
+
+		if current == nil || current.Name != name {
+			flushName()
+			current = &LabelNameStats{Name: name}
+		}
+		current.Values++
+		current.Series += pair.Series
+		current.PostingsBytes += pair.PostingsBytes
+	}
+	flushName()
+
+	for _, v := range topPairs.sorted() {
+		a.res.TopLabelPairs = append(a.res.TopLabelPairs, v.(LabelPairStats))
+	}
+	for _, v := range topMetricNames.sorted() {
+		a.res.TopMetricNames = append(a.res.TopMetricNames, v.(LabelPairStats))
+	}
+	for _, v := range topByValues.sorted() {
+		a.res.TopLabelNamesByValues = append(a.res.TopLabelNamesByValues, v.(LabelNameStats))
+	}
+	for _, v := range topByPostings.sorted() {
+		a.res.TopLabelNamesByPostings = append(a.res.TopLabelNamesByPostings, v.(LabelNameStats))
+	}
+	return nil
+}
+
+// analyzeSeries walks the series of the index to count them and their chunks, and to gather the churn of their labels
+// as the part of the block range they don't cover.
+func (a *indexAnalyzer) analyzeSeries(minTime, maxTime int64) (err error) {
+	s, err := a.openStream(a.toc.Series, a.toc.LabelIndices)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, s, "close series reader")
+
+	a.churnNames = map[uint32]uint64{}
+	a.churnPairs = newSpaceSaving(a.opts.Limit * churnPairsCapacityFactor)
+
+	var (
+		buf   []byte
+		rng   = rand.New(rand.NewSource(int64(a.res.ULID.Time())))
+		nrefs []uint32
+	)
+	for {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		next := s.pos
+		if a.res.IndexVersion == index.FormatV2 {
+			// Series are 16 bytes aligned in the version 2 of the index format.
+			next = (next + 15) / 16 * 16
+		}
+		if next >= a.toc.LabelIndices {
+			break
+		}
+		if err := s.skipTo(next); err != nil {
+			return errors.Wrap(err, "seek to series")
+		}
+
+		l, err := s.uvarint()
+		if err != nil {
+			return errors.Wrap(err, "read series length")
+		}
+		if uint64(cap(buf)) < l {
+			buf = make([]byte, l)
+		}
+		buf = buf[:l]
+		if err := s.readFull(buf); err != nil {
+			return errors.Wrap(err, "read series")
+		}
+		if err := s.skipTo(s.pos + crc32.Size); err != nil {
+			return errors.Wrap(err, "read series checksum")
+		}
+
+		d := encoding.Decbuf{B: buf}
+		k := d.Uvarint()
+		nrefs = nrefs[:0]
+		var prefs []uint64
+		for i := 0; i < k; i++ {
+			name := uint32(d.Uvarint())
+			value := uint32(d.Uvarint())
+			nrefs = append(nrefs, name)
+			prefs = append(prefs, uint64(name)<<32|uint64(value))
+		}
+
+		chunks := d.Uvarint()
+		if chunks == 0 {
+			if d.Err() != nil {
+				return errors.Wrap(d.Err(), "decode series")
+			}
+			a.res.Series++
+			continue
+		}
+		first := d.Varint64()
+		last := first + int64(d.Uvarint64())
+		ref := d.Uvarint64()
+		a.sampleChunkRef(rng, ref)
+		for i := 1; i < chunks; i++ {
+			mint := last + int64(d.Uvarint64())
+			last = mint + int64(d.Uvarint64())
+			ref += uint64(d.Varint64())
+			a.sampleChunkRef(rng, ref)
+		}
+		if d.Err() != nil {
+			return errors.Wrap(d.Err(), "decode series")
+		}
+		a.res.Series++
+
+		var uncovered uint64
+		if covered := last - first; maxTime-minTime > covered {
+			uncovered = uint64(maxTime - minTime - covered)
+		}
+		if uncovered == 0 {
+			continue
+		}
+		for i, name := range nrefs {
+			a.churnNames[name] += uncovered
+			a.churnPairs.add(prefs[i], uncovered)
+		}
+	}
+	return nil
+}
+
+// sampleChunkRef counts the chunk and keeps its reference in the reservoir of sampled chunks with the right
+// probability.
+func (a *indexAnalyzer) sampleChunkRef(rng *rand.Rand, ref uint64) {
+	a.res.Chunks++
+	if a.opts.SampledChunks <= 0 {
+		return
+	}
+	if len(a.chunkRefs) < a.opts.SampledChunks {
+		a.chunkRefs = append(a.chunkRefs, ref)
+		return
+	}
+	if i := rng.Int63n(int64(a.res.Chunks)); i < int64(a.opts.SampledChunks) {
+		a.chunkRefs[i] = ref
+	}
+}
+
+// resolveChurn resolves the symbols of the label names and pairs most involved in churn.
+func (a *indexAnalyzer) resolveChurn(blockDuration int64) error {
+	if blockDuration <= 0 {
+		return nil
+	}
+
+	names := newTopK(a.opts.Limit)
+	for ref, churn := range a.churnNames {
+		names.push(churn, ref)
+	}
+	pairs := newTopK(a.opts.Limit)
+	for ref, churn := range a.churnPairs.counts() {
+		pairs.push(churn, ref)
+	}
+	topNames, topPairs := names.sortedEntries(), pairs.sortedEntries()
+
+	refs := map[uint32]string{}
+	for _, e := range topNames {
+		refs[e.value.(uint32)] = ""
+	}
+	for _, e := range topPairs {
+		ref := e.value.(uint64)
+		refs[uint32(ref>>32)] = ""
+		refs[uint32(ref)] = ""
+	}
+	if err := a.lookupSymbols(refs); err != nil {
+		return err
+	}
+
+	for _, e := range topNames {
+		a.res.TopChurnLabelNames = append(a.res.TopChurnLabelNames, ChurnStats{
+			Name:  refs[e.value.(uint32)],
+			Churn: float64(e.score) / float64(blockDuration),
+		})
+	}
+	for _, e := range topPairs {
+		ref := e.value.(uint64)
+		a.res.TopChurnLabelPairs = append(a.res.TopChurnLabelPairs, ChurnStats{
+			Name:  refs[uint32(ref>>32)],
+			Value: refs[uint32(ref)],
+			Churn: float64(e.score) / float64(blockDuration),
+		})
+	}
+	return nil
+}
+
+// lookupSymbols sets the symbols of the given references by walking the symbol table. The references are the
+// positions of the symbols in the table in the version 2 of the index format, and their offsets in the index in the
+// version 1.
+func (a *indexAnalyzer) lookupSymbols(refs map[uint32]string) (err error) {
+	if len(refs) == 0 {
+		return nil
+	}
+	s, err := a.openStream(a.toc.Symbols, a.toc.Series)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, s, "close symbols reader")
+
+	if _, err := s.be32(); err != nil {
+		return errors.Wrap(err, "read symbols length")
+	}
+	n, err := s.be32()
+	if err != nil {
+		return errors.Wrap(err, "read symbols count")
+	}
+	found := 0
+	for i := uint32(0); i < n && found < len(refs); i++ {
+		ref := i
+		if a.res.IndexVersion == index.FormatV1 {
+			ref = uint32(s.pos)
+		}
+		sym, err := s.uvarintStr()
+		if err != nil {
+			return errors.Wrap(err, "read symbol")
+		}
+		if _, ok := refs[ref]; ok {
+			refs[ref] = sym
+			found++
+		}
+	}
+	if found < len(refs) {
+		return errors.Errorf("%d symbol references not found in the symbol table", len(refs)-found)
+	}
+	return nil
+}
+
+// sampleChunks reads the sampled chunks from the bucket to gather their statistics.
+func (a *indexAnalyzer) sampleChunks(segmentFiles []string) error {
+	dir := path.Join(a.res.ULID.String(), ChunksDirname)
+	var files []string
+	for _, f := range segmentFiles {
+		files = append(files, path.Join(dir, f))
+	}
+	if len(files) == 0 {
+		if err := a.bkt.Iter(a.ctx, dir, func(name string) error {
+			files = append(files, name)
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "list chunk files")
+		}
+	}
+	sort.Strings(files)
+
+	stats := &ChunkSampleStats{Encodings: map[string]uint64{}}
+	for _, ref := range a.chunkRefs {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		seq, off := int(ref>>32), int64(uint32(ref))
+		if seq >= len(files) {
+			return errors.Errorf("chunk reference %d points to missing segment file %d", ref, seq)
+		}
+		chk, size, err := readChunk(a.ctx, a.bkt, files[seq], off)
+		if err != nil {
+			return errors.Wrapf(err, "read chunk %d", ref)
+		}
+		stats.Chunks++
+		stats.Samples += uint64(chk.NumSamples())
+		stats.Bytes += size
+		stats.Encodings[chk.Encoding().String()]++
+	}
+	a.res.ChunkSample = stats
+	return nil
+}
+
+// readChunk reads the chunk at the given offset of the segment file, and returns it with its size in the file.
+func readChunk(ctx context.Context, bkt objstore.BucketReader, name string, off int64) (_ chunkenc.Chunk, _ uint64, err error) {
+	rc, err := bkt.GetRange(ctx, name, off, binary.MaxVarintLen32+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, err := ioutil.ReadAll(rc)
+	runutil.CloseWithErrCapture(&err, rc, "close chunk reader")
+	if err != nil {
+		return nil, 0, err
+	}
+	l, n := binary.Uvarint(b)
+	if n <= 0 || n >= len(b) {
+		return nil, 0, errors.New("invalid chunk length")
+	}
+	enc := chunkenc.Encoding(b[n])
+
+	rc, err = bkt.GetRange(ctx, name, off+int64(n)+1, int64(l))
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := ioutil.ReadAll(rc)
+	runutil.CloseWithErrCapture(&err, rc, "close chunk reader")
+	if err != nil {
+		return nil, 0, err
+	}
+	chk, err := chunkenc.FromData(enc, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return chk, uint64(n) + 1 + l + crc32.Size, nil
+}
+
+// indexStream is a forward only reader of a range of an index, which keeps track of its offset in the index.
+type indexStream struct {
+	rc  io.ReadCloser
+	r   *bufio.Reader
+	pos uint64
+	buf [4]byte
+}
+
+func (s *indexStream) Close() error { return s.rc.Close() }
+
+func (s *indexStream) readFull(b []byte) error {
+	n, err := io.ReadFull(s.r, b)
+	s.pos += uint64(n)
+	return err
+}
+
+func (s *indexStream) be32() (uint32, error) {
+	if err := s.readFull(s.buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(s.buf[:]), nil
+}
+
+func (s *indexStream) ReadByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == nil {
+		s.pos++
+	}
+	return c, err
+}
+
+func (s *indexStream) uvarint() (uint64, error) {
+	return binary.ReadUvarint(s)
+}
+
+func (s *indexStream) uvarintStr() (string, error) {
+	l, err := s.uvarint()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, l)
+	if err := s.readFull(b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// skipTo skips the bytes up to the given offset in the index.
+func (s *indexStream) skipTo(pos uint64) error {
+	if pos < s.pos {
+		return errors.Errorf("cannot seek back to %d from %d", pos, s.pos)
+	}
+	n, err := s.r.Discard(int(pos - s.pos))
+	s.pos += uint64(n)
+	return err
+}
+
+type realByteSlice []byte
+
+func (b realByteSlice) Len() int                    { return len(b) }
+func (b realByteSlice) Range(start, end int) []byte { return b[start:end] }
+
+// topKEntry is an entry of a top-K list with its score.
+type topKEntry struct {
+	score uint64
+	value interface{}
+}
+
+// topK keeps the k entries with the highest scores, in a min-heap.
+type topK struct {
+	k       int
+	entries []topKEntry
+}
+
+func newTopK(k int) *topK { return &topK{k: k} }
+
+func (t *topK) Len() int           { return len(t.entries) }
+func (t *topK) Less(i, j int) bool { return t.entries[i].score < t.entries[j].score }
+func (t *topK) Swap(i, j int)      { t.entries[i], t.entries[j] = t.entries[j], t.entries[i] }
+func (t *topK) Push(x interface{}) { t.entries = append(t.entries, x.(topKEntry)) }
+func (t *topK) Pop() (x interface{}) {
+	x, t.entries = t.entries[len(t.entries)-1], t.entries[:len(t.entries)-1]
+	return x
+}
+
+func (t *topK) push(score uint64, value interface{}) {
+	if len(t.entries) < t.k {
+		heap.Push(t, topKEntry{score: score, value: value})
+		return
+	}
+	if score <= t.entries[0].score {
+		return
+	}
+	t.entries[0] = topKEntry{score: score, value: value}
+	heap.Fix(t, 0)
+}
+
+// sortedEntries returns the entries sorted by decreasing score.
+func (t *topK) sortedEntries() []topKEntry {
+	res := append([]topKEntry(nil), t.entries...)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].score > res[j].score })
+	return res
+}
+
+// sorted returns the values sorted by decreasing score.
+func (t *topK) sorted() []interface{} {
+	var res []interface{}
+	for _, e := range t.sortedEntries() {
+		res = append(res, e.value)
+	}
+	return res
+}
+
+// spaceSaving estimates the keys with the highest sums of weights among an unbounded number of keys, tracking at most
+// capacity keys with the Space-Saving algorithm: once full, a new key replaces the one with the lowest sum, and
+// inherits its sum. The sums are thus never underestimated, and the ones higher than the lowest tracked sum are
+// guaranteed to be tracked.
+type spaceSaving struct {
+	capacity int
+	index    map[uint64]int
+	keys     []uint64
+	sums     []uint64
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, index: map[uint64]int{}}
+}
+
+func (s *spaceSaving) Len() int           { return len(s.keys) }
+func (s *spaceSaving) Less(i, j int) bool { return s.sums[i] < s.sums[j] }
+func (s *spaceSaving) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.sums[i], s.sums[j] = s.sums[j], s.sums[i]
+	s.index[s.keys[i]] = i
+	s.index[s.keys[j]] = j
+}
+func (s *spaceSaving) Push(interface{}) {}
+func (s *spaceSaving) Pop() interface{} { return nil }
+
+func (s *spaceSaving) add(key, weight uint64) {
+	if i, ok := s.index[key]; ok {
+		s.sums[i] += weight
+		heap.Fix(s, i)
+		return
+	}
+	if len(s.keys) < s.capacity {
+		s.index[key] = len(s.keys)
+		s.keys = append(s.keys, key)
+		s.sums = append(s.sums, weight)
+		heap.Fix(s, len(s.keys)-1)
+		return
+	}
+	delete(s.index, s.keys[0])
+	s.index[key] = 0
+	s.keys[0] = key
+	s.sums[0] += weight
+	heap.Fix(s, 0)
+}
+
+// counts returns the estimated sums of the tracked keys.
+func (s *spaceSaving) counts() map[uint64]uint64 {
+	res := make(map[uint64]uint64, len(s.keys))
+	for i, k := range s.keys {
+		res[k] = s.sums[i]
+	}
+	return res
+}
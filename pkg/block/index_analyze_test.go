@@ -0,0 +1,109 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestAnalyzeIndex(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	var series []labels.Labels
+	for i := 0; i < 30; i++ {
+		series = append(series, labels.FromStrings("__name__", "up", "instance", fmt.Sprintf("host-%d", i), "job", "node"))
+	}
+	for i := 0; i < 10; i++ {
+		series = append(series, labels.FromStrings("__name__", "requests_total", "instance", fmt.Sprintf("host-%d", i), "job", "api"))
+	}
+	series = append(series, labels.FromStrings("__name__", "build_info", "job", "node", "version", "1.0"))
+
+	id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 200, 0, 10000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, id.String()), metadata.NoneFunc))
+
+	a, err := AnalyzeIndex(ctx, log.NewNopLogger(), bkt, id, IndexAnalysisOptions{Limit: 2, SampledChunks: 5})
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, id, a.ULID)
+	testutil.Equals(t, 2, a.IndexVersion)
+	testutil.Equals(t, uint64(41), a.Series)
+	testutil.Assert(t, a.Chunks >= a.Series, "expected at least one chunk per series, got %d", a.Chunks)
+	testutil.Equals(t, uint64(4), a.LabelNames)
+	// 3 metric names, 30 instances, 2 jobs and 1 version.
+	testutil.Equals(t, uint64(36), a.LabelPairs)
+
+	var sectionsBytes uint64
+	for _, s := range a.Sections {
+		sectionsBytes += s.Bytes
+	}
+	testutil.Equals(t, a.IndexBytes-index.HeaderLen-indexTOCLen, sectionsBytes)
+
+	testutil.Equals(t, []LabelPairStats{
+		{Name: "job", Value: "node", Series: 31, PostingsBytes: 4 + 4 + 31*4 + 4},
+		{Name: "__name__", Value: "up", Series: 30, PostingsBytes: 4 + 4 + 30*4 + 4},
+	}, a.TopLabelPairs)
+	testutil.Equals(t, []LabelPairStats{
+		{Name: "__name__", Value: "up", Series: 30, PostingsBytes: 4 + 4 + 30*4 + 4},
+		{Name: "__name__", Value: "requests_total", Series: 10, PostingsBytes: 4 + 4 + 10*4 + 4},
+	}, a.TopMetricNames)
+
+	testutil.Equals(t, []LabelNameStats{
+		{Name: "instance", Values: 30, Series: 40, PostingsBytes: 30*12 + 40*4},
+		{Name: "__name__", Values: 3, Series: 41, PostingsBytes: 3*12 + 41*4},
+	}, a.TopLabelNamesByValues)
+	testutil.Equals(t, []LabelNameStats{
+		{Name: "instance", Values: 30, Series: 40, PostingsBytes: 30*12 + 40*4},
+		{Name: "__name__", Values: 3, Series: 41, PostingsBytes: 3*12 + 41*4},
+	}, a.TopLabelNamesByPostings)
+
+	// All series end before the end of the block range, the label names and pairs of the most series churn the most.
+	testutil.Equals(t, 2, len(a.TopChurnLabelNames))
+	names := []string{a.TopChurnLabelNames[0].Name, a.TopChurnLabelNames[1].Name}
+	sort.Strings(names)
+	testutil.Equals(t, []string{"__name__", "job"}, names)
+	testutil.Assert(t, a.TopChurnLabelNames[0].Churn > 0, "expected churn")
+	testutil.Equals(t, ChurnStats{Name: "job", Value: "node", Churn: a.TopChurnLabelPairs[0].Churn}, a.TopChurnLabelPairs[0])
+	testutil.Equals(t, ChurnStats{Name: "__name__", Value: "up", Churn: a.TopChurnLabelPairs[1].Churn}, a.TopChurnLabelPairs[1])
+	testutil.Assert(t, a.TopChurnLabelPairs[0].Churn > a.TopChurnLabelPairs[1].Churn, "expected more churn for more series")
+
+	testutil.Equals(t, uint64(5), a.ChunkSample.Chunks)
+	testutil.Assert(t, a.ChunkSample.Samples > 0, "expected samples in sampled chunks")
+	testutil.Assert(t, a.ChunkSample.Bytes > 0, "expected bytes in sampled chunks")
+	testutil.Equals(t, map[string]uint64{"XOR": 5}, a.ChunkSample.Encodings)
+}
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving(3)
+	for i := uint64(0); i < 100; i++ {
+		// Keys 0 and 1 are heavy hitters among many light keys.
+		s.add(0, 20)
+		s.add(1, 10)
+		s.add(100+i, 1)
+	}
+	top := newTopK(2)
+	for k, v := range s.counts() {
+		top.push(v, k)
+	}
+	testutil.Equals(t, []interface{}{uint64(0), uint64(1)}, top.sorted())
+	testutil.Equals(t, 3, len(s.counts()))
+	// Sums are never underestimated.
+	testutil.Assert(t, s.counts()[0] >= 2000, "expected sum of at least 2000, got %d", s.counts()[0])
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
 	"github.com/prometheus/prometheus/tsdb/index"
@@ -120,7 +121,10 @@ func WriteBinary(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID, f
 	}
 
 	// Create index-header in atomic way, to avoid partial writes (e.g during restart or crash of store GW).
-	return os.Rename(tmpFilename, filename)
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return err
+	}
+	return errors.Wrap(writeMeta(filename, int64(ir.size)), "write index header meta")
 }
 
 type chunkedIndexReader struct {
@@ -459,14 +463,34 @@ type BinaryReader struct {
 
 // NewBinaryReader loads or builds new index-header if not present on disk.
 func NewBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID, postingOffsetsInMemSampling int) (*BinaryReader, error) {
+	return newBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, nil)
+}
+
+// newBinaryReader is like NewBinaryReader, but if rebuilds is not nil it verifies the index-header on disk before
+// loading it, rebuilding it if it doesn't match its source index and counting it in rebuilds.
+func newBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID, postingOffsetsInMemSampling int, rebuilds prometheus.Counter) (*BinaryReader, error) {
 	binfn := filepath.Join(dir, id.String(), block.IndexHeaderFilename)
+	if rebuilds != nil {
+		if _, err := os.Stat(binfn); err == nil {
+			if err := VerifyBinary(ctx, bkt, id, binfn); err != nil {
+				level.Warn(logger).Log("msg", "index-header failed verification; rebuilding", "path", binfn, "err", err)
+				rebuilds.Inc()
+				return buildBinaryReader(ctx, logger, bkt, id, binfn, postingOffsetsInMemSampling)
+			}
+		}
+	}
+
 	br, err := newFileBinaryReader(binfn, postingOffsetsInMemSampling)
 	if err == nil {
 		return br, nil
 	}
 
 	level.Debug(logger).Log("msg", "failed to read index-header from disk; recreating", "path", binfn, "err", err)
+	return buildBinaryReader(ctx, logger, bkt, id, binfn, postingOffsetsInMemSampling)
+}
 
+// buildBinaryReader builds the index-header at the given path from the index in the bucket and loads it.
+func buildBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, id ulid.ULID, binfn string, postingOffsetsInMemSampling int) (*BinaryReader, error) {
 	start := time.Now()
 	if err := WriteBinary(ctx, bkt, id, binfn); err != nil {
 		return nil, errors.Wrap(err, "write index header")
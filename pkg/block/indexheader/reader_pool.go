@@ -13,18 +13,24 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/thanos-io/objstore"
 )
 
 // ReaderPoolMetrics holds metrics tracked by ReaderPool.
 type ReaderPoolMetrics struct {
 	lazyReader *LazyBinaryReaderMetrics
+	rebuilds   prometheus.Counter
 }
 
 // NewReaderPoolMetrics makes new ReaderPoolMetrics.
 func NewReaderPoolMetrics(reg prometheus.Registerer) *ReaderPoolMetrics {
 	return &ReaderPoolMetrics{
 		lazyReader: NewLazyBinaryReaderMetrics(reg),
+		rebuilds: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "indexheader_rebuilds_total",
+			Help: "Total number of index-headers on disk rebuilt because they failed verification against their source index.",
+		}),
 	}
 }
 
@@ -35,6 +41,7 @@ func NewReaderPoolMetrics(reg prometheus.Registerer) *ReaderPoolMetrics {
 type ReaderPool struct {
 	lazyReaderEnabled     bool
 	lazyReaderIdleTimeout time.Duration
+	verifyOnLoad          bool
 	logger                log.Logger
 	metrics               *ReaderPoolMetrics
 
@@ -46,13 +53,15 @@ type ReaderPool struct {
 	lazyReaders   map[*LazyBinaryReader]struct{}
 }
 
-// NewReaderPool makes a new ReaderPool.
-func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, metrics *ReaderPoolMetrics) *ReaderPool {
+// NewReaderPool makes a new ReaderPool. If verifyOnLoad is true, the index-headers on disk are verified against their
+// source index before being loaded, and rebuilt if they don't match.
+func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, verifyOnLoad bool, metrics *ReaderPoolMetrics) *ReaderPool {
 	p := &ReaderPool{
 		logger:                logger,
 		metrics:               metrics,
 		lazyReaderEnabled:     lazyReaderEnabled,
 		lazyReaderIdleTimeout: lazyReaderIdleTimeout,
+		verifyOnLoad:          verifyOnLoad,
 		lazyReaders:           make(map[*LazyBinaryReader]struct{}),
 		close:                 make(chan struct{}),
 	}
@@ -83,10 +92,20 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	var reader Reader
 	var err error
 
+	var rebuilds prometheus.Counter
+	if p.verifyOnLoad {
+		rebuilds = p.metrics.rebuilds
+	}
+
 	if p.lazyReaderEnabled {
-		reader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.metrics.lazyReader, p.onLazyReaderClosed)
+		var lazyReader *LazyBinaryReader
+		lazyReader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.metrics.lazyReader, p.onLazyReaderClosed)
+		if err == nil {
+			lazyReader.rebuilds = rebuilds
+			reader = lazyReader
+		}
 	} else {
-		reader, err = NewBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling)
+		reader, err = newBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, rebuilds)
 	}
 
 	if err != nil {
@@ -5,9 +5,11 @@ package indexheader
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,7 +62,7 @@ func TestReaderPool_NewBinaryReader(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, NewReaderPoolMetrics(nil))
+			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, false, NewReaderPoolMetrics(nil))
 			defer pool.Close()
 
 			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -97,7 +99,7 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
 
 	metrics := NewReaderPoolMetrics(nil)
-	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, metrics)
+	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, false, metrics)
 	defer pool.Close()
 
 	r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -133,3 +135,87 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.loadCount))
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.unloadCount))
 }
+
+func TestReaderPool_VerifyOnLoad(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	blockID, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+		{{Name: "a", Value: "2"}},
+	}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+
+	for _, lazyReaderEnabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy reader enabled=%v", lazyReaderEnabled), func(t *testing.T) {
+			dir := t.TempDir()
+			headerPath := filepath.Join(dir, blockID.String(), block.IndexHeaderFilename)
+
+			metrics := NewReaderPoolMetrics(nil)
+			pool := NewReaderPool(log.NewNopLogger(), lazyReaderEnabled, 0, true, metrics)
+			defer pool.Close()
+
+			load := func() {
+				r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, dir, blockID, 3)
+				testutil.Ok(t, err)
+				defer func() { testutil.Ok(t, r.Close()) }()
+
+				labelNames, err := r.LabelNames()
+				testutil.Ok(t, err)
+				testutil.Equals(t, []string{"a"}, labelNames)
+				testutil.Ok(t, VerifyBinary(ctx, bkt, blockID, headerPath))
+			}
+
+			// A newly built index-header is not a rebuild.
+			load()
+			testutil.Equals(t, float64(0), promtestutil.ToFloat64(metrics.rebuilds))
+
+			// An intact index-header is loaded as is.
+			load()
+			testutil.Equals(t, float64(0), promtestutil.ToFloat64(metrics.rebuilds))
+
+			// A truncated index-header is rebuilt.
+			fi, err := os.Stat(headerPath)
+			testutil.Ok(t, err)
+			testutil.Ok(t, os.Truncate(headerPath, fi.Size()-1))
+			testutil.NotOk(t, VerifyBinary(ctx, bkt, blockID, headerPath))
+			load()
+			testutil.Equals(t, float64(1), promtestutil.ToFloat64(metrics.rebuilds))
+
+			// An index-header without meta file, e.g. built by a previous version, is rebuilt.
+			testutil.Ok(t, os.Remove(filepath.Join(dir, blockID.String(), MetaFilename)))
+			load()
+			testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.rebuilds))
+		})
+	}
+}
+
+func TestVerifyBinary_IndexChanged(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	blockID, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+	}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+
+	headerPath := filepath.Join(tmpDir, "header", block.IndexHeaderFilename)
+	testutil.Ok(t, os.MkdirAll(filepath.Dir(headerPath), os.ModePerm))
+	testutil.Ok(t, WriteBinary(ctx, bkt, blockID, headerPath))
+	testutil.Ok(t, VerifyBinary(ctx, bkt, blockID, headerPath))
+
+	// The index in the bucket no longer is the one the index-header was built from.
+	indexPath := filepath.Join(blockID.String(), block.IndexFilename)
+	testutil.Ok(t, bkt.Upload(ctx, indexPath, strings.NewReader("not the same index")))
+	testutil.NotOk(t, VerifyBinary(ctx, bkt, blockID, headerPath))
+}
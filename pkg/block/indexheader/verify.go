@@ -0,0 +1,117 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package indexheader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// MetaFilename is the name of the file next to an index-header describing it and its source index, so that the
+	// index-header can be verified before loading it.
+	MetaFilename = "index-header.meta.json"
+
+	// MetaVersion1 is the first version of the index-header meta file.
+	MetaVersion1 = 1
+)
+
+// Meta describes an index-header and the index it was built from.
+type Meta struct {
+	Version int `json:"version"`
+	// IndexSize is the size of the source index in the bucket.
+	IndexSize int64 `json:"index_size"`
+	// HeaderSize and HeaderCRC32 are the size and the CRC32 checksum, with the Castagnoli polynomial, of the
+	// index-header file.
+	HeaderSize  int64  `json:"header_size"`
+	HeaderCRC32 uint32 `json:"header_crc32"`
+}
+
+// metaPath returns the path of the meta file of the index-header at the given path.
+func metaPath(headerPath string) string {
+	return filepath.Join(filepath.Dir(headerPath), MetaFilename)
+}
+
+// fileCRC32 returns the size and the CRC32 checksum of the file.
+func fileCRC32(fn string) (_ int64, _ uint32, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close %s", fn)
+
+	h := newCRC32()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "read %s", fn)
+	}
+	return n, h.Sum32(), nil
+}
+
+// writeMeta writes the meta file of the index-header at the given path, built from an index of the given size.
+func writeMeta(headerPath string, indexSize int64) error {
+	size, crc, err := fileCRC32(headerPath)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(Meta{Version: MetaVersion1, IndexSize: indexSize, HeaderSize: size, HeaderCRC32: crc})
+	if err != nil {
+		return err
+	}
+
+	fn := metaPath(headerPath)
+	if err := ioutil.WriteFile(fn+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// VerifyBinary verifies that the index-header at the given path was fully written and built from the current index
+// of the block in the bucket, according to its meta file. It returns an error if it doesn't or can't be verified, e.g.
+// because it has no meta file, in which case it should be rebuilt.
+func VerifyBinary(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID, headerPath string) error {
+	b, err := ioutil.ReadFile(metaPath(headerPath))
+	if err != nil {
+		return errors.Wrap(err, "read index-header meta")
+	}
+	var m Meta
+	if err := json.Unmarshal(b, &m); err != nil {
+		return errors.Wrap(err, "unmarshal index-header meta")
+	}
+	if m.Version != MetaVersion1 {
+		return errors.Errorf("unexpected index-header meta version %d", m.Version)
+	}
+
+	size, crc, err := fileCRC32(headerPath)
+	if err != nil {
+		return err
+	}
+	if size != m.HeaderSize {
+		return errors.Errorf("index-header size %d does not match the expected %d", size, m.HeaderSize)
+	}
+	if crc != m.HeaderCRC32 {
+		return errors.Errorf("index-header checksum %x does not match the expected %x", crc, m.HeaderCRC32)
+	}
+
+	indexFilepath := filepath.Join(id.String(), block.IndexFilename)
+	attrs, err := bkt.Attributes(ctx, indexFilepath)
+	if err != nil {
+		return errors.Wrapf(err, "get object attributes of %s", indexFilepath)
+	}
+	if attrs.Size != m.IndexSize {
+		return errors.Errorf("size %d of %s does not match the size %d of the index the index-header was built from", attrs.Size, indexFilepath, m.IndexSize)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// The label index file of a block holds the label names of its series, with their values and the number of series of
+// each value, so that label names and values requests can be answered without the index of the block. The values of
+// each label name are stored as two columns, so that the label names can be listed without decoding the values, and
+// the values without decoding their number of series. Its layout is:
+//
+//	┌────────────────────────────┬─────────────────────┐
+//	│ magic(0x4c424c58) <4b>     │ version(1) <1b>     │
+//	├────────────────────────────┴─────────────────────┤
+//	│ ┌──────────────────────────────────────────────┐ │
+//	│ │                Label name 1                  │ │
+//	│ ├──────────────────────────────────────────────┤ │
+//	│ │                    ...                       │ │
+//	│ ├──────────────────────────────────────────────┤ │
+//	│ │                Label name n                  │ │
+//	│ └──────────────────────────────────────────────┘ │
+//	├──────────────────────────────────────────────────┤
+//	│                  Name Table                      │
+//	├──────────────────────────────────────────────────┤
+//	│ name table offset <8b>     │ CRC32 <4b>          │
+//	└──────────────────────────────────────────────────┘
+//
+// Each label name holds the column of its values, sorted, followed by the column of their number of series:
+//
+//	┌───────────────┬───────────────────┬─────────────────────────┬─────────────────────────┬────────────┐
+//	│ len <uvarint> │ #values <uvarint> │ value <uvarint str> ... │ #series <uvarint64> ... │ CRC32 <4b> │
+//	└───────────────┴───────────────────┴─────────────────────────┴─────────────────────────┴────────────┘
+//
+// The name table holds the number of series of the block and lists the label names sorted:
+//
+//	┌──────────┬─────────────────────┬──────────────────┬──────────────────────────┬────────────┐
+//	│ len <4b> │ #series <uvarint64> │ #names <uvarint> │ name entry ... (n times) │ CRC32 <4b> │
+//	└──────────┴─────────────────────┴──────────────────┴──────────────────────────┴────────────┘
+//
+// where each name entry is encoded as its name <uvarint str>, its number of values <uvarint> and of series
+// <uvarint64>, and the offset of its columns in the file <uvarint64>, delta encoded.
+const (
+	// LabelIndexMagic is the magic number of the label index file of a block.
+	LabelIndexMagic = 0x4c424c58
+	// LabelIndexFormatV1 is the version of the label index file supported by Thanos.
+	LabelIndexFormatV1 = 1
+
+	labelIndexHeaderLen = 5
+	labelIndexTOCLen    = 8 + 4
+)
+
+// LabelNameIndex are the values of a label name and their number of series, sorted by value.
+type LabelNameIndex struct {
+	Name   string
+	Values []string
+	Series []uint64
+}
+
+// EncodeLabelIndex encodes the label index of a block with the given number of series and label names in the format
+// of the label index file. The label names must not have duplicated values.
+func EncodeLabelIndex(numSeries uint64, names []LabelNameIndex) []byte {
+	names = append([]LabelNameIndex(nil), names...)
+	sort.Slice(names, func(i, j int) bool { return names[i].Name < names[j].Name })
+
+	buf := encoding.Encbuf{B: make([]byte, 0, 1024)}
+	buf.PutBE32(LabelIndexMagic)
+	buf.PutByte(LabelIndexFormatV1)
+
+	var (
+		entry   encoding.Encbuf
+		offsets = make([]uint64, 0, len(names))
+		series  = make([]uint64, 0, len(names))
+	)
+	for _, n := range names {
+		offsets = append(offsets, uint64(buf.Len()))
+
+		idx := make([]int, len(n.Values))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.Slice(idx, func(i, j int) bool { return n.Values[idx[i]] < n.Values[idx[j]] })
+
+		entry.Reset()
+		entry.PutUvarint(len(idx))
+		for _, i := range idx {
+			entry.PutUvarintStr(n.Values[i])
+		}
+		var total uint64
+		for _, i := range idx {
+			entry.PutUvarint64(n.Series[i])
+			total += n.Series[i]
+		}
+		series = append(series, total)
+		buf.PutUvarint(entry.Len())
+		buf.PutBytes(entry.Get())
+		buf.PutBE32(crc32.Checksum(entry.Get(), castagnoliTable))
+	}
+
+	tableOff := buf.Len()
+	entry.Reset()
+	entry.PutUvarint64(numSeries)
+	entry.PutUvarint(len(names))
+	var prevOff uint64
+	for i, n := range names {
+		entry.PutUvarintStr(n.Name)
+		entry.PutUvarint(len(n.Values))
+		entry.PutUvarint64(series[i])
+		entry.PutUvarint64(offsets[i] - prevOff)
+		prevOff = offsets[i]
+	}
+	buf.PutBE32int(entry.Len())
+	buf.PutBytes(entry.Get())
+	buf.PutBE32(crc32.Checksum(entry.Get(), castagnoliTable))
+
+	buf.PutBE64(uint64(tableOff))
+	buf.PutBE32(crc32.Checksum(buf.Get()[buf.Len()-8:], castagnoliTable))
+	return buf.Get()
+}
+
+// LabelIndexFile is a decoded label index file. The values of label names are decoded on demand.
+type LabelIndexFile struct {
+	b         []byte
+	numSeries uint64
+	names     []labelIndexName
+}
+
+type labelIndexName struct {
+	name      string
+	numValues int
+	numSeries uint64
+	offset    int
+}
+
+// DecodeLabelIndex decodes the given label index file. The values of label names are decoded on demand.
+func DecodeLabelIndex(b []byte) (*LabelIndexFile, error) {
+	if len(b) < labelIndexHeaderLen+labelIndexTOCLen {
+		return nil, errors.Errorf("label index file too small: %d bytes", len(b))
+	}
+	d := encoding.Decbuf{B: b[:labelIndexHeaderLen]}
+	if m := d.Be32(); m != LabelIndexMagic {
+		return nil, errors.Errorf("invalid label index file magic number %x", m)
+	}
+	if v := d.Byte(); v != LabelIndexFormatV1 {
+		return nil, errors.Errorf("unexpected label index file version %d, expected %d", v, LabelIndexFormatV1)
+	}
+
+	toc := encoding.Decbuf{B: b[len(b)-labelIndexTOCLen:]}
+	tableOff := toc.Be64int64()
+	if exp := toc.Be32(); crc32.Checksum(b[len(b)-labelIndexTOCLen:len(b)-4], castagnoliTable) != exp {
+		return nil, errors.New("label index file table of contents checksum mismatch")
+	}
+	if tableOff < labelIndexHeaderLen || tableOff > int64(len(b)-labelIndexTOCLen) {
+		return nil, errors.Errorf("invalid label index file name table offset %d", tableOff)
+	}
+
+	d = encoding.NewDecbufAt(realByteSlice(b[:len(b)-labelIndexTOCLen]), int(tableOff), castagnoliTable)
+	if d.Err() != nil {
+		return nil, errors.Wrap(d.Err(), "read label index file name table")
+	}
+	f := &LabelIndexFile{b: b, numSeries: d.Uvarint64()}
+	n := d.Uvarint()
+	if n > d.Len() {
+		return nil, errors.Errorf("invalid number of label names %d in label index file name table", n)
+	}
+	f.names = make([]labelIndexName, 0, n)
+	var off uint64
+	for i := 0; i < n && d.Err() == nil; i++ {
+		e := labelIndexName{name: d.UvarintStr(), numValues: d.Uvarint(), numSeries: d.Uvarint64()}
+		off += d.Uvarint64()
+		e.offset = int(off)
+		f.names = append(f.names, e)
+	}
+	if d.Err() != nil {
+		return nil, errors.Wrap(d.Err(), "decode label index file name table")
+	}
+	return f, nil
+}
+
+// Size returns the size of the file in bytes.
+func (f *LabelIndexFile) Size() int {
+	return len(f.b)
+}
+
+// NumSeries returns the number of series of the block.
+func (f *LabelIndexFile) NumSeries() uint64 {
+	return f.numSeries
+}
+
+// LabelNames returns the label names of the block, sorted.
+func (f *LabelIndexFile) LabelNames() []string {
+	res := make([]string, 0, len(f.names))
+	for _, n := range f.names {
+		res = append(res, n.name)
+	}
+	return res
+}
+
+// LabelValues returns the values of the given label name, sorted. It returns no values if the block has no series with
+// the label name.
+func (f *LabelIndexFile) LabelValues(name string) ([]string, error) {
+	li, err := f.labelName(name, false)
+	if err != nil || li == nil {
+		return nil, err
+	}
+	return li.Values, nil
+}
+
+// LabelName returns the values of the given label name with their number of series, sorted by value. It returns nil if
+// the block has no series with the label name.
+func (f *LabelIndexFile) LabelName(name string) (*LabelNameIndex, error) {
+	return f.labelName(name, true)
+}
+
+func (f *LabelIndexFile) labelName(name string, withSeries bool) (*LabelNameIndex, error) {
+	i := sort.Search(len(f.names), func(i int) bool { return f.names[i].name >= name })
+	if i == len(f.names) || f.names[i].name != name {
+		return nil, nil
+	}
+
+	d := encoding.NewDecbufUvarintAt(realByteSlice(f.b), f.names[i].offset, castagnoliTable)
+	if d.Err() != nil {
+		return nil, errors.Wrapf(d.Err(), "read values of label name %s", name)
+	}
+	n := d.Uvarint()
+	if n != f.names[i].numValues || n > d.Len() {
+		return nil, errors.Errorf("invalid number of values %d of label name %s", n, name)
+	}
+	res := &LabelNameIndex{Name: name, Values: make([]string, 0, n)}
+	for j := 0; j < n && d.Err() == nil; j++ {
+		res.Values = append(res.Values, d.UvarintStr())
+	}
+	if withSeries {
+		res.Series = make([]uint64, 0, n)
+		for j := 0; j < n && d.Err() == nil; j++ {
+			res.Series = append(res.Series, d.Uvarint64())
+		}
+	}
+	if d.Err() != nil {
+		return nil, errors.Wrapf(d.Err(), "decode values of label name %s", name)
+	}
+	return res, nil
+}
+
+// LabelIndexSize returns the size of the label index file of the block of the given meta, and false if it has none,
+// according to the files listed in the meta.
+func LabelIndexSize(m *metadata.Meta) (int64, bool) {
+	for _, f := range m.Thanos.Files {
+		if f.RelPath == LabelIndexFilename {
+			return f.SizeBytes, true
+		}
+	}
+	return 0, false
+}
+
+// WriteLabelIndex writes the label index file of the block in the given dir from the index of the block.
+func WriteLabelIndex(logger log.Logger, blockDir string) (err error) {
+	r, err := index.NewFileReader(filepath.Join(blockDir, IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index file")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "label index reader")
+
+	allName, allValue := index.AllPostingsKey()
+	numSeries, err := countPostings(r, allName, allValue)
+	if err != nil {
+		return err
+	}
+	lnames, err := r.LabelNames()
+	if err != nil {
+		return errors.Wrap(err, "read label names")
+	}
+	names := make([]LabelNameIndex, 0, len(lnames))
+	for _, name := range lnames {
+		values, err := r.SortedLabelValues(name)
+		if err != nil {
+			return errors.Wrapf(err, "read values of label name %s", name)
+		}
+		n := LabelNameIndex{Name: name, Values: values, Series: make([]uint64, 0, len(values))}
+		for _, v := range values {
+			c, err := countPostings(r, name, v)
+			if err != nil {
+				return err
+			}
+			n.Series = append(n.Series, c)
+		}
+		names = append(names, n)
+	}
+
+	fn := filepath.Join(blockDir, LabelIndexFilename)
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, EncodeLabelIndex(numSeries, names), 0600); err != nil {
+		return errors.Wrap(err, "write label index file")
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return errors.Wrap(err, "rename label index file")
+	}
+	level.Debug(logger).Log("msg", "wrote label index file", "block", filepath.Base(blockDir), "series", numSeries, "label_names", len(names))
+	return nil
+}
+
+func countPostings(r *index.Reader, name, value string) (uint64, error) {
+	p, err := r.Postings(name, value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "get postings of %s=%q", name, value)
+	}
+	var n uint64
+	for p.Next() {
+		n++
+	}
+	return n, errors.Wrapf(p.Err(), "iterate postings of %s=%q", name, value)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestLabelIndexFile_EncodeDecode(t *testing.T) {
+	b := EncodeLabelIndex(5, []LabelNameIndex{
+		{Name: "job", Values: []string{"b", "a"}, Series: []uint64{3, 2}},
+		{Name: "__name__", Values: []string{"up"}, Series: []uint64{5}},
+		{Name: "empty"},
+	})
+
+	f, err := DecodeLabelIndex(b)
+	testutil.Ok(t, err)
+	testutil.Equals(t, len(b), f.Size())
+	testutil.Equals(t, uint64(5), f.NumSeries())
+	// Label names and values are sorted.
+	testutil.Equals(t, []string{"__name__", "empty", "job"}, f.LabelNames())
+	values, err := f.LabelValues("job")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, values)
+	li, err := f.LabelName("job")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &LabelNameIndex{Name: "job", Values: []string{"a", "b"}, Series: []uint64{2, 3}}, li)
+	values, err = f.LabelValues("empty")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(values))
+	values, err = f.LabelValues("missing")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(values))
+	li, err = f.LabelName("missing")
+	testutil.Ok(t, err)
+	testutil.Assert(t, li == nil, "expected no label name")
+
+	// Corrupted values are detected by their checksum.
+	corrupted := append([]byte{}, b...)
+	corrupted[labelIndexHeaderLen+3]++
+	f, err = DecodeLabelIndex(corrupted)
+	testutil.Ok(t, err)
+	_, err = f.LabelValues("__name__")
+	testutil.NotOk(t, err)
+
+	corrupted = append([]byte{}, b...)
+	corrupted[4] = LabelIndexFormatV1 + 1
+	_, err = DecodeLabelIndex(corrupted)
+	testutil.NotOk(t, err)
+	_, err = DecodeLabelIndex(b[:len(b)-1])
+	testutil.NotOk(t, err)
+}
+
+func TestWriteLabelIndex(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	id, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b", "instance", "1"),
+		labels.FromStrings("__name__", "down", "job", "a"),
+	}, 10, 0, 1000, labels.FromStrings("ext1", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(tmpDir, id.String())
+
+	testutil.Ok(t, WriteLabelIndex(log.NewNopLogger(), bdir))
+	b, err := ioutil.ReadFile(filepath.Join(bdir, LabelIndexFilename))
+	testutil.Ok(t, err)
+	f, err := DecodeLabelIndex(b)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, uint64(3), f.NumSeries())
+	testutil.Equals(t, []string{"__name__", "instance", "job"}, f.LabelNames())
+	for _, exp := range []*LabelNameIndex{
+		{Name: "__name__", Values: []string{"down", "up"}, Series: []uint64{1, 2}},
+		{Name: "instance", Values: []string{"1"}, Series: []uint64{1}},
+		{Name: "job", Values: []string{"a", "b"}, Series: []uint64{2, 1}},
+	} {
+		li, err := f.LabelName(exp.Name)
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp, li)
+	}
+}
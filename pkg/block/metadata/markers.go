@@ -24,11 +24,21 @@ const (
 	// NoCompactMarkFilename is the known json filename for optional file storing details about why block has to be excluded from compaction.
 	// If such file is present in block dir, it means the block has to excluded from compaction (both vertical and horizontal) or rewrite (e.g deletions).
 	NoCompactMarkFilename = "no-compact-mark.json"
+	// TombstoneFilename is the known json filename for optional file storing details about when block was meant to be deleted.
+	// If such file is present in block dir, it means the block was kept in the bucket instead of being deleted, e.g. because the
+	// bucket does not allow deletions, and it is left for the object storage lifecycle rules to expire.
+	TombstoneFilename = "tombstone.json"
+
+	// DeletionAuditDirname is the known dir name in the bucket for optional audit files of block deletions.
+	// Each file is a copy of the deletion-mark file of the deleted block, named <deletion time>-<block ID>.json.
+	DeletionAuditDirname = "markers/audit"
 
 	// DeletionMarkVersion1 is the version of deletion-mark file supported by Thanos.
 	DeletionMarkVersion1 = 1
 	// NoCompactMarkVersion1 is the version of no-compact-mark file supported by Thanos.
 	NoCompactMarkVersion1 = 1
+	// TombstoneVersion1 is the version of tombstone file supported by Thanos.
+	TombstoneVersion1 = 1
 )
 
 var (
@@ -55,10 +65,38 @@ type DeletionMark struct {
 
 	// DeletionTime is a unix timestamp of when the block was marked to be deleted.
 	DeletionTime int64 `json:"deletion_time"`
+	// Reason is the reason of the block being marked for deletion.
+	Reason DeletionReason `json:"reason,omitempty"`
+	// Source is the component and its version which marked the block for deletion, e.g. compact/0.28.0.
+	Source string `json:"source,omitempty"`
+	// Group is the key of the compaction group of the block, if it was marked for deletion by the compactor.
+	Group string `json:"group,omitempty"`
 }
 
 func (m *DeletionMark) markerFilename() string { return DeletionMarkFilename }
 
+// DeletionReason is a reason for a block to be marked for deletion.
+type DeletionReason string
+
+const (
+	// ManualDeletionReason is a reason of marking for deletion that should be added when the block is deleted on user request.
+	ManualDeletionReason DeletionReason = "manual"
+	// RetentionDeletionReason is a reason of marking for deletion of a block exceeding the retention.
+	RetentionDeletionReason DeletionReason = "retention"
+	// CompactedDeletionReason is a reason of marking for deletion of a source block of a newly compacted block.
+	CompactedDeletionReason DeletionReason = "compacted"
+	// OutdatedDeletionReason is a reason of marking for deletion of a block which is fully included in another block.
+	OutdatedDeletionReason DeletionReason = "outdated"
+	// RepairedDeletionReason is a reason of marking for deletion of a source block of a repaired block.
+	RepairedDeletionReason DeletionReason = "repaired"
+	// RewrittenDeletionReason is a reason of marking for deletion of a source block of a rewritten block.
+	RewrittenDeletionReason DeletionReason = "rewritten"
+	// PartialUploadDeletionReason is a reason of deletion of an aborted partial upload.
+	PartialUploadDeletionReason DeletionReason = "partial-upload"
+	// RelocatedDeletionReason is a reason of marking for deletion of a block copied to the bucket of another storage tier.
+	RelocatedDeletionReason DeletionReason = "relocated"
+)
+
 // NoCompactReason is a reason for a block to be excluded from compaction.
 type NoCompactReason string
 
@@ -70,6 +108,8 @@ const (
 	IndexSizeExceedingNoCompactReason = "index-size-exceeding"
 	// OutOfOrderChunksNoCompactReason is a reason of to no compact block with index contains out of order chunk so that the compaction is not blocked.
 	OutOfOrderChunksNoCompactReason = "block-index-out-of-order-chunk"
+	// OutputVerificationFailedNoCompactReason is a reason to not compact a block whose compacted block did not match its source blocks, e.g. because of missing series.
+	OutputVerificationFailedNoCompactReason = "output-verification-failed"
 )
 
 // NoCompactMark marker stores reason of block being excluded from compaction if needed.
@@ -88,6 +128,25 @@ type NoCompactMark struct {
 
 func (n *NoCompactMark) markerFilename() string { return NoCompactMarkFilename }
 
+// Tombstone stores block id and when block was meant to be deleted, if it was kept in the bucket instead.
+type Tombstone struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// Version of the file.
+	Version int `json:"version"`
+	// Details is a human readable string giving details of reason.
+	Details string `json:"details,omitempty"`
+
+	// TombstoneTime is a unix timestamp of when the block was meant to be deleted.
+	TombstoneTime int64 `json:"tombstone_time"`
+	// Reason is the reason of the block being deleted.
+	Reason DeletionReason `json:"reason,omitempty"`
+	// Source is the component and its version which wrote the tombstone, e.g. compact/0.28.0.
+	Source string `json:"source,omitempty"`
+}
+
+func (m *Tombstone) markerFilename() string { return TombstoneFilename }
+
 // ReadMarker reads the given mark file from <dir>/<marker filename>.json in bucket.
 func ReadMarker(ctx context.Context, logger log.Logger, bkt objstore.InstrumentedBucketReader, dir string, marker Marker) error {
 	markerFile := path.Join(dir, marker.markerFilename())
@@ -117,6 +176,10 @@ func ReadMarker(ctx context.Context, logger log.Logger, bkt objstore.Instrumente
 		if version := marker.(*DeletionMark).Version; version != DeletionMarkVersion1 {
 			return errors.Errorf("unexpected deletion-mark file version %d, expected %d", version, DeletionMarkVersion1)
 		}
+	case TombstoneFilename:
+		if version := marker.(*Tombstone).Version; version != TombstoneVersion1 {
+			return errors.Errorf("unexpected tombstone file version %d, expected %d", version, TombstoneVersion1)
+		}
 	}
 	return nil
 }
@@ -9,11 +9,14 @@ package metadata
 // this package.
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
@@ -53,11 +56,22 @@ const (
 	ThanosVersion1 = 1
 )
 
+// FromOutOfOrderHint is the compaction hint of blocks holding samples ingested out of order, which overlap with the
+// in-order blocks of the same time range. Later TSDB versions set it in the compaction section of the meta.json.
+const FromOutOfOrderHint = "from-out-of-order"
+
+// ColdTier is the tier of the blocks the compactor relocated to the cold bucket.
+const ColdTier = "cold"
+
 // Meta describes the a block's meta. It wraps the known TSDB meta structure and
 // extends it by Thanos-specific fields.
 type Meta struct {
 	tsdb.BlockMeta
 
+	// CompactionHints are the hints of the compaction section, which the TSDB block meta of this Prometheus version
+	// does not have. Optional.
+	CompactionHints []string `json:"-"`
+
 	Thanos Thanos `json:"thanos"`
 }
 
@@ -65,6 +79,50 @@ func (m *Meta) String() string {
 	return fmt.Sprintf("%s (min time: %d, max time: %d)", m.ULID, m.MinTime, m.MaxTime)
 }
 
+// FromOutOfOrder returns true if the block holds samples ingested out of order.
+func (m *Meta) FromOutOfOrder() bool {
+	for _, h := range m.CompactionHints {
+		if h == FromOutOfOrderHint {
+			return true
+		}
+	}
+	return false
+}
+
+// metaCompaction is the compaction section of the meta.json with its hints.
+type metaCompaction struct {
+	tsdb.BlockMetaCompaction
+	Hints []string `json:"hints,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, adding the compaction hints to the compaction section.
+func (m Meta) MarshalJSON() ([]byte, error) {
+	type plain Meta
+	if len(m.CompactionHints) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Compaction metaCompaction `json:"compaction"`
+	}{plain: plain(m), Compaction: metaCompaction{BlockMetaCompaction: m.Compaction, Hints: m.CompactionHints}})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading the compaction hints of the compaction section.
+func (m *Meta) UnmarshalJSON(b []byte) error {
+	type plain Meta
+	var aux struct {
+		plain
+		Compaction metaCompaction `json:"compaction"`
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	*m = Meta(aux.plain)
+	m.Compaction = aux.Compaction.BlockMetaCompaction
+	m.CompactionHints = aux.Compaction.Hints
+	return nil
+}
+
 // Thanos holds block meta information specific to Thanos.
 type Thanos struct {
 	// Version of Thanos meta file. If none specified, 1 is assumed (since first version did not have explicit version specified).
@@ -90,6 +148,85 @@ type Thanos struct {
 
 	// Rewrites is present when any rewrite (deletion, relabel etc) were applied to this block. Optional.
 	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// Shard is present when the compactor split the series of the block's group into multiple blocks. Optional.
+	Shard *ThanosShard `json:"shard,omitempty"`
+
+	// Tier is the storage tier the compactor relocated the block to, e.g. cold. Empty for blocks which were not
+	// relocated. Optional.
+	Tier string `json:"tier,omitempty"`
+
+	// Unknown are the fields of the Thanos section this version of Thanos doesn't know, e.g. extensions added by newer
+	// versions, by name. They are written back as is, so that rewriting the meta of a block doesn't drop them.
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// thanosFields are the lowercased names of the known fields of the Thanos section. Like encoding/json, field names are
+// matched case-insensitively.
+var thanosFields = func() map[string]struct{} {
+	t := reflect.TypeOf(Thanos{})
+	res := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			res[strings.ToLower(name)] = struct{}{}
+		}
+	}
+	return res
+}()
+
+// MarshalJSON implements json.Marshaler, writing the unknown fields along with the known ones.
+func (m Thanos) MarshalJSON() ([]byte, error) {
+	type plain Thanos
+	b, err := json.Marshal(plain(m))
+	if err != nil || len(m.Unknown) == 0 {
+		return b, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for name, v := range m.Unknown {
+		if _, ok := thanosFields[strings.ToLower(name)]; !ok {
+			fields[name] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping the unknown fields.
+func (m *Thanos) UnmarshalJSON(b []byte) error {
+	type plain Thanos
+	if err := json.Unmarshal(b, (*plain)(m)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	m.Unknown = nil
+	for name, v := range fields {
+		if _, ok := thanosFields[strings.ToLower(name)]; ok {
+			continue
+		}
+		// Compacted, so that the same values of different metas are equal regardless of their indentation.
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, v); err != nil {
+			return err
+		}
+		if m.Unknown == nil {
+			m.Unknown = make(map[string]json.RawMessage)
+		}
+		m.Unknown[name] = buf.Bytes()
+	}
+	return nil
+}
+
+// NewerVersion returns true if the Thanos section was written by a newer version of Thanos with a meta version this
+// version doesn't support.
+func (m *Thanos) NewerVersion() bool {
+	return m.Version > ThanosVersion1
 }
 
 type Rewrite struct {
@@ -130,6 +267,45 @@ type ThanosDownsample struct {
 	Resolution int64 `json:"resolution"`
 }
 
+// ThanosShard identifies the part of a group's series held by a block. A block of shard
+// Index out of Count holds the series whose labels hash modulo Count equals Index.
+type ThanosShard struct {
+	Index uint64 `json:"index"`
+	Count uint64 `json:"count"`
+}
+
+// Contains returns true if a series with the given labels belongs to the shard.
+func (s *ThanosShard) Contains(lset labels.Labels) bool {
+	if s == nil {
+		return true
+	}
+	return lset.Hash()%s.Count == s.Index
+}
+
+// Equal returns true if both shards are the same. A nil shard is only equal to a nil shard.
+func (s *ThanosShard) Equal(o *ThanosShard) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	return *s == *o
+}
+
+// Covers returns true if all series of the other shard belong to this shard as well,
+// i.e. the other shard is the same shard or was split out of it. A nil shard covers everything.
+func (s *ThanosShard) Covers(o *ThanosShard) bool {
+	if s == nil {
+		return true
+	}
+	if o == nil {
+		return false
+	}
+	return o.Count%s.Count == 0 && o.Index%s.Count == s.Index
+}
+
+func (s *ThanosShard) String() string {
+	return fmt.Sprintf("%d_of_%d", s.Index, s.Count)
+}
+
 // InjectThanos sets Thanos meta to the block meta JSON and saves it to the disk.
 // NOTE: It should be used after writing any block by any Thanos component, otherwise we will miss crucial metadata.
 func InjectThanos(logger log.Logger, bdir string, meta Thanos, downsampledMeta *tsdb.BlockMeta) (*Meta, error) {
@@ -152,8 +328,11 @@ func InjectThanos(logger log.Logger, bdir string, meta Thanos, downsampledMeta *
 }
 
 // Returns a unique identifier for the compaction group the block belongs to.
-// It considers the downsampling resolution and the block's labels.
+// It considers the downsampling resolution, the block's labels and its shard, if any.
 func (m *Thanos) GroupKey() string {
+	if m.Shard != nil {
+		return fmt.Sprintf("%d@%v@%v", m.Downsample.Resolution, labels.FromMap(m.Labels).Hash(), m.Shard)
+	}
 	return fmt.Sprintf("%d@%v", m.Downsample.Resolution, labels.FromMap(m.Labels).Hash())
 }
 
@@ -235,7 +414,7 @@ func Read(rc io.ReadCloser) (_ *Meta, err error) {
 	}
 
 	if version != ThanosVersion1 {
-		return nil, errors.Errorf("unexpected meta file Thanos section version %d", m.Version)
+		return nil, errors.Errorf("unexpected meta file Thanos section version %d", version)
 	}
 
 	if m.Thanos.Labels == nil {
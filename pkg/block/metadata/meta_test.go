@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -211,4 +212,135 @@ func TestMeta_ReadWrite(t *testing.T) {
 		m1.Thanos.Labels = map[string]string{}
 		testutil.Equals(t, m1, *retMeta)
 	})
+
+	t.Run("compaction hints write/read", func(t *testing.T) {
+		b := bytes.Buffer{}
+		m1 := Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(5, nil),
+				Version:    1,
+				Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{ulid.MustNew(5, nil)}},
+			},
+			CompactionHints: []string{FromOutOfOrderHint},
+			Thanos:          Thanos{Labels: map[string]string{}},
+		}
+		testutil.Ok(t, m1.Write(&b))
+		testutil.Assert(t, bytes.Contains(b.Bytes(), []byte(`"hints": [
+			"from-out-of-order"
+		]`)), b.String())
+
+		retMeta, err := Read(ioutil.NopCloser(&b))
+		testutil.Ok(t, err)
+		testutil.Equals(t, m1, *retMeta)
+		testutil.Assert(t, retMeta.FromOutOfOrder(), "block must be from out of order samples")
+		testutil.Assert(t, !(&Meta{}).FromOutOfOrder(), "block must not be from out of order samples")
+	})
+
+	t.Run("unknown Thanos fields read/write", func(t *testing.T) {
+		const meta = `{
+	"ulid": "00000000050000000000000000",
+	"minTime": 0,
+	"maxTime": 0,
+	"stats": {},
+	"compaction": {
+		"level": 1
+	},
+	"version": 1,
+	"thanos": {
+		"version": 1,
+		"labels": {
+			"ext": "1"
+		},
+		"downsample": {
+			"resolution": 0
+		},
+		"source": "sidecar",
+		"extensions": {
+			"tenant": "team-a",
+			"retention": [
+				"30d"
+			]
+		},
+		"future_field": 5
+	}
+}
+`
+		m, err := Read(ioutil.NopCloser(bytes.NewBufferString(meta)))
+		testutil.Ok(t, err)
+		testutil.Equals(t, map[string]string{"ext": "1"}, m.Thanos.Labels)
+		testutil.Equals(t, 2, len(m.Thanos.Unknown))
+		testutil.Equals(t, "5", string(m.Thanos.Unknown["future_field"]))
+
+		// Unknown fields survive changes of the known ones, and never override them.
+		m.Thanos.Source = CompactorSource
+		m.Thanos.Unknown["Source"] = []byte(`"overridden"`)
+		b := bytes.Buffer{}
+		testutil.Ok(t, m.Write(&b))
+		testutil.Equals(t, `{
+	"ulid": "00000000050000000000000000",
+	"minTime": 0,
+	"maxTime": 0,
+	"stats": {},
+	"compaction": {
+		"level": 1
+	},
+	"version": 1,
+	"thanos": {
+		"downsample": {
+			"resolution": 0
+		},
+		"extensions": {
+			"tenant": "team-a",
+			"retention": [
+				"30d"
+			]
+		},
+		"future_field": 5,
+		"labels": {
+			"ext": "1"
+		},
+		"source": "compactor",
+		"version": 1
+	}
+}
+`, b.String())
+
+		retMeta, err := Read(ioutil.NopCloser(&b))
+		testutil.Ok(t, err)
+		delete(m.Thanos.Unknown, "Source")
+		testutil.Equals(t, m, retMeta)
+		testutil.Assert(t, !retMeta.Thanos.NewerVersion(), "meta version must be supported")
+	})
+}
+
+func TestThanosShard(t *testing.T) {
+	var (
+		unsharded *ThanosShard
+		half      = &ThanosShard{Index: 1, Count: 2}
+		quarter   = &ThanosShard{Index: 3, Count: 4}
+		other     = &ThanosShard{Index: 2, Count: 4}
+	)
+	testutil.Assert(t, unsharded.Covers(half))
+	testutil.Assert(t, unsharded.Covers(nil))
+	testutil.Assert(t, !half.Covers(nil))
+	testutil.Assert(t, half.Covers(half))
+	testutil.Assert(t, half.Covers(quarter))
+	testutil.Assert(t, !half.Covers(other))
+	testutil.Assert(t, !quarter.Covers(half))
+
+	testutil.Assert(t, unsharded.Equal(nil))
+	testutil.Assert(t, !unsharded.Equal(half))
+	testutil.Assert(t, half.Equal(&ThanosShard{Index: 1, Count: 2}))
+
+	lset := labels.FromStrings("a", "1")
+	testutil.Assert(t, unsharded.Contains(lset))
+	for _, count := range []uint64{1, 2, 3, 7} {
+		var containing int
+		for i := uint64(0); i < count; i++ {
+			if (&ThanosShard{Index: i, Count: count}).Contains(lset) {
+				containing++
+			}
+		}
+		testutil.Equals(t, 1, containing)
+	}
 }
@@ -0,0 +1,149 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore/exthttp"
+	"github.com/thanos-io/objstore/providers/s3"
+	"gopkg.in/yaml.v2"
+)
+
+// AutoDeletionMode resolves to MarkOnlyDeletionMode for buckets with object lock enabled and to DeleteDeletionMode otherwise.
+const AutoDeletionMode DeletionMode = "auto"
+
+// Resolve returns the deletion mode to use for a bucket with the given object lock configuration.
+func (m DeletionMode) Resolve(lock ObjectLock) DeletionMode {
+	if m != AutoDeletionMode {
+		return m
+	}
+	if lock.Enabled {
+		return MarkOnlyDeletionMode
+	}
+	return DeleteDeletionMode
+}
+
+// ObjectLock is the object lock (immutability) configuration of a bucket.
+type ObjectLock struct {
+	// Enabled is true if objects of the bucket can be locked, which makes deleting them impossible while they are retained.
+	Enabled bool `json:"enabled"`
+	// Mode is the default retention mode of new objects, e.g. GOVERNANCE or COMPLIANCE.
+	Mode string `json:"mode,omitempty"`
+	// Validity is the default retention period of new objects, e.g. 30 DAYS.
+	Validity string `json:"validity,omitempty"`
+}
+
+// DetectObjectLock returns the object lock configuration of the bucket with the given configuration.
+// Only S3 buckets are supported, object lock is reported as disabled for other providers.
+// NOTE: confContentYaml can contain secrets.
+func DetectObjectLock(ctx context.Context, logger log.Logger, confContentYaml []byte) (ObjectLock, error) {
+	// Same as client.BucketConfig, which is not used to avoid importing all providers.
+	bucketConf := &struct {
+		Type   string      `yaml:"type"`
+		Config interface{} `yaml:"config"`
+		Prefix string      `yaml:"prefix"`
+	}{}
+	if err := yaml.UnmarshalStrict(confContentYaml, bucketConf); err != nil {
+		return ObjectLock{}, errors.Wrap(err, "parsing config YAML file")
+	}
+	if !strings.EqualFold(bucketConf.Type, "S3") {
+		return ObjectLock{}, nil
+	}
+
+	rawConf, err := yaml.Marshal(bucketConf.Config)
+	if err != nil {
+		return ObjectLock{}, errors.Wrap(err, "marshal content of bucket configuration")
+	}
+	conf := s3.DefaultConfig
+	if err := yaml.UnmarshalStrict(rawConf, &conf); err != nil {
+		return ObjectLock{}, errors.Wrap(err, "parsing s3 configuration")
+	}
+	minioClient, err := newS3Client(conf)
+	if err != nil {
+		return ObjectLock{}, err
+	}
+
+	lock, err := s3ObjectLock(ctx, minioClient, conf.Bucket)
+	if err != nil {
+		return ObjectLock{}, errors.Wrapf(err, "get object lock configuration of bucket %s", conf.Bucket)
+	}
+	if lock.Enabled {
+		level.Info(logger).Log("msg", "object lock is enabled on bucket", "bucket", conf.Bucket, "mode", lock.Mode, "validity", lock.Validity)
+	}
+	return lock, nil
+}
+
+func s3ObjectLock(ctx context.Context, minioClient *minio.Client, bucket string) (ObjectLock, error) {
+	enabled, mode, validity, unit, err := minioClient.GetObjectLockConfig(ctx, bucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+			return ObjectLock{}, nil
+		}
+		return ObjectLock{}, err
+	}
+
+	lock := ObjectLock{Enabled: enabled == "Enabled"}
+	if mode != nil {
+		lock.Mode = mode.String()
+	}
+	if validity != nil && unit != nil {
+		lock.Validity = fmt.Sprintf("%d %s", *validity, *unit)
+	}
+	return lock, nil
+}
+
+// newS3Client creates a client with the same credentials and transport as the S3 bucket created from the configuration.
+func newS3Client(conf s3.Config) (*minio.Client, error) {
+	signerType := credentials.SignatureV4
+	if conf.SignatureV2 {
+		signerType = credentials.SignatureV2
+	}
+
+	var chain []credentials.Provider
+	if conf.AWSSDKAuth {
+		chain = []credentials.Provider{&s3.AWSSDKAuth{Region: conf.Region}}
+	} else if conf.AccessKey != "" {
+		chain = []credentials.Provider{&credentials.Static{
+			Value: credentials.Value{
+				AccessKeyID:     conf.AccessKey,
+				SecretAccessKey: conf.SecretKey,
+				SignerType:      signerType,
+			},
+		}}
+	} else {
+		chain = []credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{
+				Client:   &http.Client{Transport: http.DefaultTransport},
+				Endpoint: conf.STSEndpoint,
+			},
+		}
+	}
+
+	rt, err := exthttp.DefaultTransport(conf.HTTPConfig)
+	if err != nil {
+		return nil, err
+	}
+	minioClient, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:        credentials.NewChainCredentials(chain),
+		Secure:       !conf.Insecure,
+		Region:       conf.Region,
+		Transport:    rt,
+		BucketLookup: conf.BucketLookupType.MinioType(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "initialize s3 client")
+	}
+	return minioClient, nil
+}
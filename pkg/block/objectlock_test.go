@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestDetectObjectLock(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		response string
+		expected ObjectLock
+	}{
+		{
+			name:     "object lock with default retention",
+			status:   http.StatusOK,
+			response: `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled><Rule><DefaultRetention><Mode>COMPLIANCE</Mode><Days>30</Days></DefaultRetention></Rule></ObjectLockConfiguration>`,
+			expected: ObjectLock{Enabled: true, Mode: "COMPLIANCE", Validity: "30 DAYS"},
+		},
+		{
+			name:     "object lock without default retention",
+			status:   http.StatusOK,
+			response: `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`,
+			expected: ObjectLock{Enabled: true},
+		},
+		{
+			name:     "no object lock",
+			status:   http.StatusNotFound,
+			response: `<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>`,
+			expected: ObjectLock{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.URL.Query()["object-lock"]; !ok || r.URL.Path != "/test-bucket/" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			t.Cleanup(srv.Close)
+
+			lock, err := DetectObjectLock(context.Background(), log.NewNopLogger(), []byte(fmt.Sprintf(`type: S3
+config:
+  bucket: test-bucket
+  endpoint: %s
+  region: us-east-1
+  access_key: key
+  secret_key: secret
+  insecure: true
+  bucket_lookup_type: path
+`, strings.TrimPrefix(srv.URL, "http://"))))
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, lock)
+		})
+	}
+
+	t.Run("not supported provider", func(t *testing.T) {
+		lock, err := DetectObjectLock(context.Background(), log.NewNopLogger(), []byte("type: FILESYSTEM\nconfig:\n  directory: /tmp\n"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, ObjectLock{}, lock)
+	})
+}
+
+func TestDeletionMode_Resolve(t *testing.T) {
+	testutil.Equals(t, MarkOnlyDeletionMode, AutoDeletionMode.Resolve(ObjectLock{Enabled: true}))
+	testutil.Equals(t, DeleteDeletionMode, AutoDeletionMode.Resolve(ObjectLock{}))
+	testutil.Equals(t, DeleteDeletionMode, DeleteDeletionMode.Resolve(ObjectLock{Enabled: true}))
+	testutil.Equals(t, MarkOnlyDeletionMode, MarkOnlyDeletionMode.Resolve(ObjectLock{}))
+}
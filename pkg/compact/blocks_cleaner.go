@@ -22,30 +22,45 @@ type BlocksCleaner struct {
 	ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter
 	bkt                      objstore.Bucket
 	deleteDelay              time.Duration
+	deletionMode             block.DeletionMode
 	blocksCleaned            prometheus.Counter
+	blocksTombstoned         prometheus.Counter
 	blockCleanupFailures     prometheus.Counter
 }
 
 // NewBlocksCleaner creates a new BlocksCleaner.
-func NewBlocksCleaner(logger log.Logger, bkt objstore.Bucket, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, deleteDelay time.Duration, blocksCleaned, blockCleanupFailures prometheus.Counter) *BlocksCleaner {
+func NewBlocksCleaner(logger log.Logger, bkt objstore.Bucket, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, deleteDelay time.Duration, deletionMode block.DeletionMode, blocksCleaned, blocksTombstoned, blockCleanupFailures prometheus.Counter) *BlocksCleaner {
 	return &BlocksCleaner{
 		logger:                   logger,
 		ignoreDeletionMarkFilter: ignoreDeletionMarkFilter,
 		bkt:                      bkt,
 		deleteDelay:              deleteDelay,
+		deletionMode:             deletionMode,
 		blocksCleaned:            blocksCleaned,
+		blocksTombstoned:         blocksTombstoned,
 		blockCleanupFailures:     blockCleanupFailures,
 	}
 }
 
 // DeleteMarkedBlocks uses ignoreDeletionMarkFilter to gather the blocks that are marked for deletion and deletes those
-// if older than given deleteDelay.
+// if older than given deleteDelay. In mark-only deletion mode, the blocks are kept in the bucket with a tombstone instead.
 func (s *BlocksCleaner) DeleteMarkedBlocks(ctx context.Context) error {
 	level.Info(s.logger).Log("msg", "started cleaning of blocks marked for deletion")
 
 	deletionMarkMap := s.ignoreDeletionMarkFilter.DeletionMarkBlocks()
 	for _, deletionMark := range deletionMarkMap {
 		if time.Since(time.Unix(deletionMark.DeletionTime, 0)).Seconds() > s.deleteDelay.Seconds() {
+			if s.deletionMode == block.MarkOnlyDeletionMode {
+				created, err := block.Tombstone(ctx, s.logger, s.bkt, deletionMark.ID, deletionMark.Reason, deletionMark.Details)
+				if err != nil {
+					s.blockCleanupFailures.Inc()
+					return errors.Wrap(err, "tombstone block")
+				}
+				if created {
+					s.blocksTombstoned.Inc()
+				}
+				continue
+			}
 			if err := block.Delete(ctx, s.logger, s.bkt, deletionMark.ID); err != nil {
 				s.blockCleanupFailures.Inc()
 				return errors.Wrap(err, "delete block")
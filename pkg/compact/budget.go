@@ -0,0 +1,188 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// budgetOperations are the object storage operations an OperationBudget can limit.
+var budgetOperations = []string{
+	objstore.OpIter,
+	objstore.OpGet,
+	objstore.OpGetRange,
+	objstore.OpExists,
+	objstore.OpAttributes,
+	objstore.OpUpload,
+	objstore.OpDelete,
+}
+
+// ParseOperationBudgetLimits parses the maximum number of operations by object storage operation type, e.g. "get" to
+// "100000".
+func ParseOperationBudgetLimits(limits map[string]string) (map[string]int64, error) {
+	res := make(map[string]int64, len(limits))
+	for op, v := range limits {
+		known := false
+		for _, o := range budgetOperations {
+			if o == op {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.Errorf("unknown object storage operation %q, expected one of %v", op, budgetOperations)
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid budget %q of operation %s, expected a positive number of operations", v, op)
+		}
+		res[op] = n
+	}
+	return res, nil
+}
+
+// OperationBudget caps the number of object storage operations, by operation type, of each compactor iteration, so
+// that a misbehaving iteration can't issue an unbounded number of billed API calls. The operations are counted by the
+// bucket returned by Bucket, which never fails them: once the budget is exhausted, the groups being compacted are
+// finished, the rest of the iteration is skipped and the next iteration starts with a new budget.
+// Reads of deletion marks are not counted, as skipping them would let compaction use blocks marked for deletion.
+// A nil OperationBudget is never exhausted.
+type OperationBudget struct {
+	limits map[string]int64
+
+	mtx  sync.Mutex
+	used map[string]int64
+}
+
+// NewOperationBudget returns an OperationBudget with the given maximum number of operations by operation type.
+// Operations without limit are not limited.
+func NewOperationBudget(limits map[string]int64) *OperationBudget {
+	return &OperationBudget{limits: limits, used: map[string]int64{}}
+}
+
+// Reset starts a new iteration with the whole budget.
+func (b *OperationBudget) Reset() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.used = map[string]int64{}
+}
+
+// Exhausted returns the first operation type, in alphabetical order, whose budget is exhausted, if any.
+func (b *OperationBudget) Exhausted() (string, bool) {
+	if b == nil {
+		return "", false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	ops := make([]string, 0, len(b.limits))
+	for op := range b.limits {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		if b.used[op] >= b.limits[op] {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// Used returns the number of operations of the given type of the current iteration.
+func (b *OperationBudget) Used(op string) int64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.used[op]
+}
+
+// Limit returns the maximum number of operations of the given type per iteration, 0 if not limited.
+func (b *OperationBudget) Limit(op string) int64 {
+	return b.limits[op]
+}
+
+func (b *OperationBudget) spend(op, name string) {
+	if op == objstore.OpGet || op == objstore.OpExists {
+		if path.Base(name) == metadata.DeletionMarkFilename {
+			return
+		}
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.used[op]++
+}
+
+// Bucket returns the bucket counting its operations in the budget.
+func (b *OperationBudget) Bucket(bkt objstore.InstrumentedBucket) *OperationBudgetBucket {
+	return &OperationBudgetBucket{Bucket: bkt, budget: b}
+}
+
+// OperationBudgetBucket is a bucket counting its operations in an OperationBudget.
+type OperationBudgetBucket struct {
+	objstore.Bucket
+
+	budget *OperationBudget
+}
+
+func (b *OperationBudgetBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	b.budget.spend(objstore.OpIter, dir)
+	return b.Bucket.Iter(ctx, dir, f, options...)
+}
+
+func (b *OperationBudgetBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.budget.spend(objstore.OpGet, name)
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *OperationBudgetBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.budget.spend(objstore.OpGetRange, name)
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func (b *OperationBudgetBucket) Exists(ctx context.Context, name string) (bool, error) {
+	b.budget.spend(objstore.OpExists, name)
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *OperationBudgetBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.budget.spend(objstore.OpAttributes, name)
+	return b.Bucket.Attributes(ctx, name)
+}
+
+func (b *OperationBudgetBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.budget.spend(objstore.OpUpload, name)
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func (b *OperationBudgetBucket) Delete(ctx context.Context, name string) error {
+	b.budget.spend(objstore.OpDelete, name)
+	return b.Bucket.Delete(ctx, name)
+}
+
+func (b *OperationBudgetBucket) WithExpectedErrs(expectedFunc objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	res := &OperationBudgetBucket{Bucket: b.Bucket, budget: b.budget}
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		res.Bucket = ib.WithExpectedErrs(expectedFunc)
+	}
+	return res
+}
+
+func (b *OperationBudgetBucket) ReaderWithExpectedErrs(expectedFunc objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(expectedFunc)
+}
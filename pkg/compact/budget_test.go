@@ -0,0 +1,151 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseOperationBudgetLimits(t *testing.T) {
+	limits, err := ParseOperationBudgetLimits(map[string]string{"get": "100", "iter": "10"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]int64{"get": 100, "iter": 10}, limits)
+
+	for _, invalid := range []map[string]string{
+		{"list": "10"},
+		{"get": "many"},
+		{"get": "0"},
+	} {
+		_, err := ParseOperationBudgetLimits(invalid)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestOperationBudgetBucket(t *testing.T) {
+	ctx := context.Background()
+	budget := NewOperationBudget(map[string]int64{objstore.OpGet: 2, objstore.OpUpload: 10})
+	bkt := budget.Bucket(objstore.WithNoopInstr(objstore.NewInMemBucket()))
+
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.DeletionMarkFilename), bytes.NewReader([]byte("{}"))))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), bytes.NewReader([]byte("{}"))))
+	testutil.Equals(t, int64(2), budget.Used(objstore.OpUpload))
+
+	// Reads of deletion marks are not counted.
+	for i := 0; i < 3; i++ {
+		r, err := bkt.ReaderWithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, path.Join(id.String(), metadata.DeletionMarkFilename))
+		testutil.Ok(t, err)
+		testutil.Ok(t, r.Close())
+	}
+	_, ok := budget.Exhausted()
+	testutil.Assert(t, !ok, "budget must not be exhausted")
+
+	for i := 0; i < 2; i++ {
+		r, err := bkt.WithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, path.Join(id.String(), block.MetaFilename))
+		testutil.Ok(t, err)
+		testutil.Ok(t, r.Close())
+	}
+	op, ok := budget.Exhausted()
+	testutil.Assert(t, ok, "budget must be exhausted")
+	testutil.Equals(t, objstore.OpGet, op)
+
+	// Operations are never failed, even when the budget is exhausted.
+	r, err := bkt.Get(ctx, path.Join(id.String(), block.MetaFilename))
+	testutil.Ok(t, err)
+	testutil.Ok(t, r.Close())
+	testutil.Equals(t, int64(3), budget.Used(objstore.OpGet))
+
+	budget.Reset()
+	_, ok = budget.Exhausted()
+	testutil.Assert(t, !ok, "budget must not be exhausted after reset")
+
+	var noBudget *OperationBudget
+	noBudget.Reset()
+	_, ok = noBudget.Exhausted()
+	testutil.Assert(t, !ok, "nil budget must never be exhausted")
+}
+
+func TestBucketCompactor_OperationBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	logger := log.NewNopLogger()
+
+	// A single upload exhausts the budget, so that only one of the two groups is compacted per iteration.
+	budget := NewOperationBudget(map[string]int64{objstore.OpUpload: 1})
+	bkt := budget.Bucket(objstore.WithNoopInstr(objstore.NewInMemBucket()))
+
+	prepareDir := t.TempDir()
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+	for _, extLset := range []labels.Labels{labels.FromStrings("e1", "1"), labels.FromStrings("e1", "2")} {
+		for _, b := range []blockgenSpec{
+			{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+			{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series},
+			{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series},
+			{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series},
+		} {
+			id, _ := createBlock(t, ctx, prepareDir, b)
+			testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(prepareDir, id.String()), metadata.NoneFunc))
+		}
+	}
+
+	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 48*time.Hour, fetcherConcurrency)
+	duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+	noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, bkt, 2)
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{
+		ignoreDeletionMarkFilter,
+		duplicateBlocksFilter,
+		noCompactMarkerFilter,
+	})
+	testutil.Ok(t, err)
+
+	counter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, counter, counter)
+	testutil.Ok(t, err)
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil)
+	testutil.Ok(t, err)
+	planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, nil, counter, counter, counter, metadata.NoneFunc, 10, 10)
+	bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, t.TempDir(), bkt, 1, true)
+	testutil.Ok(t, err)
+	bComp.WithOperationBudget(budget)
+
+	// compactedGroups returns the external labels of the groups with a compacted block.
+	compactedGroups := func() map[string]struct{} {
+		res := map[string]struct{}{}
+		seriesFromBucket(t, ctx, bkt, func(m *metadata.Meta, _ labels.Labels) {
+			if m.Compaction.Level > 1 {
+				res[m.Thanos.Labels["e1"]] = struct{}{}
+			}
+		})
+		return res
+	}
+
+	budget.Reset()
+	testutil.Ok(t, bComp.Compact(ctx))
+	_, ok := budget.Exhausted()
+	testutil.Assert(t, ok, "budget must be exhausted")
+	testutil.Equals(t, 1, len(compactedGroups()))
+
+	// The next iteration resumes with the other group.
+	budget.Reset()
+	testutil.Ok(t, bComp.Compact(ctx))
+	testutil.Equals(t, map[string]struct{}{"1": {}, "2": {}}, compactedGroups())
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 )
 
 const (
@@ -27,9 +28,12 @@ func BestEffortCleanAbortedPartialUploads(
 	logger log.Logger,
 	partial map[ulid.ULID]error,
 	bkt objstore.Bucket,
+	deletionMode block.DeletionMode,
 	deleteAttempts prometheus.Counter,
 	blockCleanups prometheus.Counter,
+	blocksTombstoned prometheus.Counter,
 	blockCleanupFailures prometheus.Counter,
+	deletionMarkOpts ...block.DeletionMarkOption,
 ) {
 	level.Info(logger).Log("msg", "started cleaning of aborted partial uploads")
 
@@ -45,11 +49,30 @@ func BestEffortCleanAbortedPartialUploads(
 			continue
 		}
 
+		if deletionMode == block.MarkOnlyDeletionMode {
+			// Keep the partial block for the lifecycle rules of the bucket, the tombstone makes sure we record it only once.
+			created, err := block.Tombstone(ctx, logger, bkt, id, metadata.PartialUploadDeletionReason, "aborted partial upload", deletionMarkOpts...)
+			if err != nil {
+				blockCleanupFailures.Inc()
+				level.Warn(logger).Log("msg", "failed to tombstone aborted partial upload; will retry in next iteration", "block", id, "err", err)
+				continue
+			}
+			if created {
+				blocksTombstoned.Inc()
+			}
+			continue
+		}
+
 		deleteAttempts.Inc()
 		level.Info(logger).Log("msg", "found partially uploaded block; marking for deletion", "block", id)
 		// We don't gather any information about deletion marks for partial blocks, so let's simply remove it. We waited
 		// long PartialUploadThresholdAge already.
 		// TODO(bwplotka): Fix some edge cases: https://github.com/thanos-io/thanos/issues/2470 .
+		if err := block.AuditDeletion(ctx, logger, bkt, id, metadata.PartialUploadDeletionReason, "aborted partial upload", deletionMarkOpts...); err != nil {
+			blockCleanupFailures.Inc()
+			level.Warn(logger).Log("msg", "failed to audit deletion of aborted partial upload; will retry in next iteration", "block", id, "err", err)
+			continue
+		}
 		if err := block.Delete(ctx, logger, bkt, id); err != nil {
 			blockCleanupFailures.Inc()
 			level.Warn(logger).Log("msg", "failed to delete aborted partial upload; will retry in next iteration", "block", id, "thresholdAge", PartialUploadThresholdAge, "err", err)
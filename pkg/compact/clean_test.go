@@ -61,13 +61,15 @@ func TestBestEffortCleanAbortedPartialUploads(t *testing.T) {
 
 	deleteAttempts := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	blockCleanups := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blocksTombstoned := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	blockCleanupFailures := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	_, partial, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
 
-	BestEffortCleanAbortedPartialUploads(ctx, logger, partial, bkt, deleteAttempts, blockCleanups, blockCleanupFailures)
+	BestEffortCleanAbortedPartialUploads(ctx, logger, partial, bkt, block.DeleteDeletionMode, deleteAttempts, blockCleanups, blocksTombstoned, blockCleanupFailures)
 	testutil.Equals(t, 1.0, promtest.ToFloat64(deleteAttempts))
 	testutil.Equals(t, 1.0, promtest.ToFloat64(blockCleanups))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(blocksTombstoned))
 	testutil.Equals(t, 0.0, promtest.ToFloat64(blockCleanupFailures))
 
 	exists, err := bkt.Exists(ctx, path.Join(shouldDeleteID.String(), "chunks", "000001"))
@@ -82,3 +84,96 @@ func TestBestEffortCleanAbortedPartialUploads(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, true, exists)
 }
+
+func TestBestEffortCleanAbortedPartialUploads_MarkOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	logger := log.NewNopLogger()
+
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, nil)
+	testutil.Ok(t, err)
+
+	// No meta, old block, should be kept with a tombstone.
+	id, err := ulid.New(uint64(time.Now().Add(-PartialUploadThresholdAge-1*time.Hour).Unix()*1000), nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), "chunks", "000001"), bytes.NewReader([]byte{0, 1, 2, 3})))
+
+	deleteAttempts := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blockCleanups := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blocksTombstoned := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blockCleanupFailures := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+
+	// The second iteration finds the tombstone and does not count the block again.
+	for i := 0; i < 2; i++ {
+		_, partial, err := metaFetcher.Fetch(ctx)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(partial))
+
+		BestEffortCleanAbortedPartialUploads(ctx, logger, partial, bkt, block.MarkOnlyDeletionMode, deleteAttempts, blockCleanups, blocksTombstoned, blockCleanupFailures, block.WithDeletionAudit(true))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(deleteAttempts))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(blockCleanups))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(blocksTombstoned))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(blockCleanupFailures))
+	}
+
+	exists, err := bkt.Exists(ctx, path.Join(id.String(), "chunks", "000001"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, exists)
+
+	var tombstone metadata.Tombstone
+	testutil.Ok(t, metadata.ReadMarker(ctx, logger, bkt, id.String(), &tombstone))
+	testutil.Equals(t, id, tombstone.ID)
+	testutil.Equals(t, metadata.PartialUploadDeletionReason, tombstone.Reason)
+
+	var audits int
+	testutil.Ok(t, bkt.Iter(ctx, metadata.DeletionAuditDirname, func(string) error {
+		audits++
+		return nil
+	}))
+	testutil.Equals(t, 1, audits)
+}
+
+func TestBlocksCleaner_MarkOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	logger := log.NewNopLogger()
+
+	id := ulid.MustNew(1, nil)
+	var meta metadata.Meta
+	meta.Version = 1
+	meta.ULID = id
+	var buf bytes.Buffer
+	testutil.Ok(t, json.NewEncoder(&buf).Encode(&meta))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.MetaFilename), &buf))
+	testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, metadata.RetentionDeletionReason, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+
+	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 0, 1)
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{ignoreDeletionMarkFilter})
+	testutil.Ok(t, err)
+	_, _, err = metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	blocksCleaned := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blocksTombstoned := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blockCleanupFailures := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	cleaner := NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, 0, block.MarkOnlyDeletionMode, blocksCleaned, blocksTombstoned, blockCleanupFailures)
+	testutil.Ok(t, cleaner.DeleteMarkedBlocks(ctx))
+	testutil.Ok(t, cleaner.DeleteMarkedBlocks(ctx))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(blocksCleaned))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksTombstoned))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(blockCleanupFailures))
+
+	for _, f := range []string{metadata.MetaFilename, metadata.DeletionMarkFilename, metadata.TombstoneFilename} {
+		exists, err := bkt.Exists(ctx, path.Join(id.String(), f))
+		testutil.Ok(t, err)
+		testutil.Assert(t, exists, "%s should be kept", f)
+	}
+
+	var tombstone metadata.Tombstone
+	testutil.Ok(t, metadata.ReadMarker(ctx, logger, bkt, id.String(), &tombstone))
+	testutil.Equals(t, metadata.RetentionDeletionReason, tombstone.Reason)
+}
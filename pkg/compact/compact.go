@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -62,6 +64,8 @@ type Syncer struct {
 	metrics                  *syncerMetrics
 	duplicateBlocksFilter    *block.DeduplicateFilter
 	ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter
+	deletionMarkOpts         []block.DeletionMarkOption
+	blocksInUse              *BlocksInUse
 }
 
 type syncerMetrics struct {
@@ -97,7 +101,8 @@ func newSyncerMetrics(reg prometheus.Registerer, blocksMarkedForDeletion, garbag
 
 // NewMetaSyncer returns a new Syncer for the given Bucket and directory.
 // Blocks must be at least as old as the sync delay for being considered.
-func NewMetaSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher block.MetadataFetcher, duplicateBlocksFilter *block.DeduplicateFilter, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks prometheus.Counter) (*Syncer, error) {
+// The given deletion mark options are used when marking outdated blocks for deletion.
+func NewMetaSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher block.MetadataFetcher, duplicateBlocksFilter *block.DeduplicateFilter, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks prometheus.Counter, deletionMarkOpts ...block.DeletionMarkOption) (*Syncer, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
@@ -110,9 +115,17 @@ func NewMetaSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bu
 		metrics:                  newSyncerMetrics(reg, blocksMarkedForDeletion, garbageCollectedBlocks),
 		duplicateBlocksFilter:    duplicateBlocksFilter,
 		ignoreDeletionMarkFilter: ignoreDeletionMarkFilter,
+		deletionMarkOpts:         deletionMarkOpts,
 	}, nil
 }
 
+// WithBlocksInUse configures the syncer to not garbage collect the blocks in use, and the bucket compactors using the
+// syncer to track the blocks of the groups they compact in it.
+func (s *Syncer) WithBlocksInUse(b *BlocksInUse) *Syncer {
+	s.blocksInUse = b
+	return s
+}
+
 // UntilNextDownsampling calculates how long it will take until the next downsampling operation.
 // Returns an error if there will be no downsampling.
 func UntilNextDownsampling(m *metadata.Meta) (time.Duration, error) {
@@ -179,6 +192,11 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 		if _, exists := deletionMarkMap[id]; exists {
 			continue
 		}
+		// Blocks being compacted are garbage collected once their compaction is done.
+		if s.blocksInUse.InUse(id) {
+			level.Debug(s.logger).Log("msg", "skipping garbage collection of block in use", "block", id)
+			continue
+		}
 		garbageIDs = append(garbageIDs, id)
 	}
 
@@ -190,8 +208,13 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 		// Spawn a new context so we always mark a block for deletion in full on shutdown.
 		delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 
+		var groupKey string
+		if m, ok := s.blocks[id]; ok {
+			groupKey = m.Thanos.GroupKey()
+		}
+
 		level.Info(s.logger).Log("msg", "marking outdated block for deletion", "block", id)
-		err := block.MarkForDeletion(delCtx, s.logger, s.bkt, id, "outdated block", s.metrics.blocksMarkedForDeletion)
+		err := block.MarkForDeletion(delCtx, s.logger, s.bkt, id, metadata.OutdatedDeletionReason, "outdated block", s.metrics.blocksMarkedForDeletion, withCompactionGroup(s.deletionMarkOpts, groupKey)...)
 		cancel()
 		if err != nil {
 			s.metrics.garbageCollectionFailures.Inc()
@@ -208,6 +231,13 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 	return nil
 }
 
+// withCompactionGroup returns a copy of the deletion mark options with the given compaction group recorded.
+func withCompactionGroup(opts []block.DeletionMarkOption, groupKey string) []block.DeletionMarkOption {
+	res := make([]block.DeletionMarkOption, 0, len(opts)+1)
+	res = append(res, opts...)
+	return append(res, block.WithCompactionGroup(groupKey))
+}
+
 // Grouper is responsible to group all known blocks into sub groups which are safe to be
 // compacted concurrently.
 type Grouper interface {
@@ -234,6 +264,12 @@ type DefaultGrouper struct {
 	hashFunc                      metadata.HashFunc
 	blockFilesConcurrency         int
 	compactBlocksFetchConcurrency int
+	deletionMarkOpts              []block.DeletionMarkOption
+	splitLimits                   BlockSplitLimits
+	outputVerification            OutputVerification
+	outputVerificationFailures    prometheus.Counter
+	outputVerificationNoCompact   prometheus.Counter
+	writeLabelIndex               bool
 }
 
 // NewDefaultGrouper makes a new DefaultGrouper.
@@ -249,6 +285,7 @@ func NewDefaultGrouper(
 	hashFunc metadata.HashFunc,
 	blockFilesConcurrency int,
 	compactBlocksFetchConcurrency int,
+	deletionMarkOpts ...block.DeletionMarkOption,
 ) *DefaultGrouper {
 	return &DefaultGrouper{
 		bkt:                      bkt,
@@ -275,15 +312,42 @@ func NewDefaultGrouper(
 			Name: "thanos_compact_group_vertical_compactions_total",
 			Help: "Total number of group compaction attempts that resulted in a new block based on overlapping blocks.",
 		}, []string{"group"}),
+		outputVerificationFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_compact_output_verification_failures_total",
+			Help: "Total number of compactions whose compacted blocks did not match their source blocks, so the source blocks were marked for no compaction instead of being deleted.",
+		}),
 		blocksMarkedForNoCompact:      blocksMarkedForNoCompact,
 		garbageCollectedBlocks:        garbageCollectedBlocks,
 		blocksMarkedForDeletion:       blocksMarkedForDeletion,
 		hashFunc:                      hashFunc,
 		blockFilesConcurrency:         blockFilesConcurrency,
 		compactBlocksFetchConcurrency: compactBlocksFetchConcurrency,
+		deletionMarkOpts:              deletionMarkOpts,
 	}
 }
 
+// WithBlockSplitLimits configures groups to split compacted blocks exceeding the given limits.
+func (g *DefaultGrouper) WithBlockSplitLimits(limits BlockSplitLimits) *DefaultGrouper {
+	g.splitLimits = limits
+	return g
+}
+
+// WithOutputVerification configures groups to verify compacted blocks against their source blocks before uploading
+// them and deleting the source blocks. The counter is incremented for source blocks marked for no compaction after a
+// failed verification.
+func (g *DefaultGrouper) WithOutputVerification(v OutputVerification, blocksMarkedForNoCompact prometheus.Counter) *DefaultGrouper {
+	g.outputVerification = v
+	g.outputVerificationNoCompact = blocksMarkedForNoCompact
+	return g
+}
+
+// WithLabelIndex configures groups to write the label index file of compacted blocks, so that the store gateway can
+// answer label names and values requests without their index.
+func (g *DefaultGrouper) WithLabelIndex() *DefaultGrouper {
+	g.writeLabelIndex = true
+	return g
+}
+
 // Groups returns the compaction groups for all blocks currently known to the syncer.
 // It creates all groups from the scratch on every call.
 func (g *DefaultGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res []*Group, err error) {
@@ -312,10 +376,17 @@ func (g *DefaultGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res []*Gro
 				g.hashFunc,
 				g.blockFilesConcurrency,
 				g.compactBlocksFetchConcurrency,
+				g.deletionMarkOpts...,
 			)
 			if err != nil {
 				return nil, errors.Wrap(err, "create compaction group")
 			}
+			group.shard = m.Thanos.Shard
+			group.splitLimits = g.splitLimits
+			group.outputVerification = g.outputVerification
+			group.outputVerificationFailures = g.outputVerificationFailures
+			group.outputVerificationNoCompact = g.outputVerificationNoCompact
+			group.writeLabelIndex = g.writeLabelIndex
 			groups[groupKey] = group
 			res = append(res, group)
 		}
@@ -352,6 +423,16 @@ type Group struct {
 	hashFunc                      metadata.HashFunc
 	blockFilesConcurrency         int
 	compactBlocksFetchConcurrency int
+	deletionMarkOpts              []block.DeletionMarkOption
+	// shard is set for groups of blocks holding only a part of the series, after splitting.
+	shard       *metadata.ThanosShard
+	splitLimits BlockSplitLimits
+
+	outputVerification          OutputVerification
+	outputVerificationFailures  prometheus.Counter
+	outputVerificationNoCompact prometheus.Counter
+	// writeLabelIndex is true if the label index file of the compacted blocks is written.
+	writeLabelIndex bool
 }
 
 // NewGroup returns a new compaction group.
@@ -374,6 +455,7 @@ func NewGroup(
 	hashFunc metadata.HashFunc,
 	blockFilesConcurrency int,
 	compactBlocksFetchConcurrency int,
+	deletionMarkOpts ...block.DeletionMarkOption,
 ) (*Group, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -402,6 +484,7 @@ func NewGroup(
 		hashFunc:                      hashFunc,
 		blockFilesConcurrency:         blockFilesConcurrency,
 		compactBlocksFetchConcurrency: compactBlocksFetchConcurrency,
+		deletionMarkOpts:              withCompactionGroup(deletionMarkOpts, key),
 	}
 	return g, nil
 }
@@ -435,6 +518,9 @@ func (cg *Group) AppendMeta(meta *metadata.Meta) error {
 	if cg.resolution != meta.Thanos.Downsample.Resolution {
 		return errors.New("block and group resolution do not match")
 	}
+	if !cg.shard.Equal(meta.Thanos.Shard) {
+		return errors.New("block and group shard do not match")
+	}
 
 	cg.metasByMinTime = append(cg.metasByMinTime, meta)
 	sort.Slice(cg.metasByMinTime, func(i, j int) bool {
@@ -561,7 +647,7 @@ func (ps *CompactionProgressCalculator) ProgressCalculate(ctx context.Context, g
 			}
 
 			newMeta := tsdb.CompactBlockMetas(ulid.MustNew(uint64(time.Now().Unix()), nil), metas...)
-			if err := g.AppendMeta(&metadata.Meta{BlockMeta: *newMeta, Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: g.Resolution()}, Labels: g.Labels().Map()}}); err != nil {
+			if err := g.AppendMeta(&metadata.Meta{BlockMeta: *newMeta, Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: g.Resolution()}, Labels: g.Labels().Map(), Shard: g.shard}}); err != nil {
 				return errors.Wrapf(err, "append meta")
 			}
 			tmpGroups = append(tmpGroups, g)
@@ -584,30 +670,40 @@ func (ps *CompactionProgressCalculator) ProgressCalculate(ctx context.Context, g
 // DownsampleProgressMetrics contains Prometheus metrics related to downsampling progress.
 type DownsampleProgressMetrics struct {
 	NumberOfBlocksDownsampled *prometheus.GaugeVec
+	NumberOfBlocksSkipped     *prometheus.GaugeVec
 }
 
 // DownsampleProgressCalculator contains DownsampleMetrics, which are updated during the downsampling simulation process.
 type DownsampleProgressCalculator struct {
 	*DownsampleProgressMetrics
+	policies *downsample.Policies
 }
 
-// NewDownsampleProgressCalculator creates a new DownsampleProgressCalculator.
-func NewDownsampleProgressCalculator(reg prometheus.Registerer) *DownsampleProgressCalculator {
+// NewDownsampleProgressCalculator creates a new DownsampleProgressCalculator. Blocks whose downsampling is skipped by
+// the given policies are not counted as blocks to be downsampled, but as skipped ones.
+func NewDownsampleProgressCalculator(reg prometheus.Registerer, policies *downsample.Policies) *DownsampleProgressCalculator {
 	return &DownsampleProgressCalculator{
 		DownsampleProgressMetrics: &DownsampleProgressMetrics{
 			NumberOfBlocksDownsampled: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 				Name: "thanos_compact_todo_downsample_blocks",
 				Help: "number of blocks to be downsampled",
 			}, []string{"group"}),
+			NumberOfBlocksSkipped: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+				Name: "thanos_compact_downsample_skipped_blocks",
+				Help: "number of blocks not downsampled because of the downsampling policy of their group",
+			}, []string{"group", "reason"}),
 		},
+		policies: policies,
 	}
 }
 
 // ProgressCalculate calculates the number of blocks to be downsampled for the given groups.
 func (ds *DownsampleProgressCalculator) ProgressCalculate(ctx context.Context, groups []*Group) error {
-	sources5m := map[ulid.ULID]struct{}{}
-	sources1h := map[ulid.ULID]struct{}{}
+	sources5m := downsample.Sources{}
+	sources1h := downsample.Sources{}
 	groupBlocks := make(map[string]int, len(groups))
+	type skipKey struct{ group, reason string }
+	skippedBlocks := map[skipKey]int{}
 
 	for _, group := range groups {
 		for _, m := range group.metasByMinTime {
@@ -615,13 +711,9 @@ func (ds *DownsampleProgressCalculator) ProgressCalculate(ctx context.Context, g
 			case downsample.ResLevel0:
 				continue
 			case downsample.ResLevel1:
-				for _, id := range m.Compaction.Sources {
-					sources5m[id] = struct{}{}
-				}
+				sources5m.Add(m)
 			case downsample.ResLevel2:
-				for _, id := range m.Compaction.Sources {
-					sources1h[id] = struct{}{}
-				}
+				sources1h.Add(m)
 			default:
 				return errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
 			}
@@ -633,38 +725,29 @@ func (ds *DownsampleProgressCalculator) ProgressCalculate(ctx context.Context, g
 		for _, m := range group.metasByMinTime {
 			switch m.Thanos.Downsample.Resolution {
 			case downsample.ResLevel0:
-				missing := false
-				for _, id := range m.Compaction.Sources {
-					if _, ok := sources5m[id]; !ok {
-						missing = true
-						break
-					}
-				}
-				if !missing {
+				if sources5m.Covered(m) {
 					continue
 				}
 
 				if m.MaxTime-m.MinTime < downsample.ResLevel1DownsampleRange {
 					continue
 				}
-				groupBlocks[group.key]++
 			case downsample.ResLevel1:
-				missing := false
-				for _, id := range m.Compaction.Sources {
-					if _, ok := sources1h[id]; !ok {
-						missing = true
-						break
-					}
-				}
-				if !missing {
+				if sources1h.Covered(m) {
 					continue
 				}
 
 				if m.MaxTime-m.MinTime < downsample.ResLevel2DownsampleRange {
 					continue
 				}
-				groupBlocks[group.key]++
+			default:
+				continue
+			}
+			if reason := ds.policies.Skip(m); reason != "" {
+				skippedBlocks[skipKey{group: group.key, reason: reason}]++
+				continue
 			}
+			groupBlocks[group.key]++
 		}
 	}
 
@@ -672,6 +755,10 @@ func (ds *DownsampleProgressCalculator) ProgressCalculate(ctx context.Context, g
 	for key, blocks := range groupBlocks {
 		ds.DownsampleProgressMetrics.NumberOfBlocksDownsampled.WithLabelValues(key).Add(float64(blocks))
 	}
+	ds.DownsampleProgressMetrics.NumberOfBlocksSkipped.Reset()
+	for key, blocks := range skippedBlocks {
+		ds.DownsampleProgressMetrics.NumberOfBlocksSkipped.WithLabelValues(key.group, key.reason).Add(float64(blocks))
+	}
 
 	return nil
 }
@@ -776,7 +863,7 @@ func (cg *Group) Compact(ctx context.Context, dir string, planner Planner, comp
 	err := tracing.DoInSpanWithErr(ctx, "compaction_group", func(ctx context.Context) (err error) {
 		shouldRerun, compID, err = cg.compact(ctx, subDir, planner, comp)
 		return err
-	}, opentracing.Tags{"group.key": cg.Key()})
+	}, opentracing.Tags{"group.key": cg.Key(), "group.resolution": cg.resolution})
 	if err != nil {
 		cg.compactionFailures.Inc()
 		return false, ulid.ULID{}, err
@@ -918,8 +1005,19 @@ func (cg *Group) areBlocksOverlapping(include *metadata.Meta, exclude ...*metada
 	return nil
 }
 
+// outOfOrderMetas returns the metas of the blocks of the group holding samples ingested out of order.
+func (cg *Group) outOfOrderMetas() []*metadata.Meta {
+	var res []*metadata.Meta
+	for _, m := range cg.metasByMinTime {
+		if m.FromOutOfOrder() {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
 // RepairIssue347 repairs the https://github.com/prometheus/tsdb/issues/347 issue when having issue347Error.
-func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blocksMarkedForDeletion prometheus.Counter, issue347Err error) error {
+func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blocksMarkedForDeletion prometheus.Counter, issue347Err error, deletionMarkOpts ...block.DeletionMarkOption) error {
 	ie, ok := errors.Cause(issue347Err).(Issue347Error)
 	if !ok {
 		return errors.Errorf("Given error is not an issue347 error: %v", issue347Err)
@@ -970,7 +1068,7 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	defer cancel()
 
 	// TODO(bplotka): Issue with this will introduce overlap that will halt compactor. Automate that (fix duplicate overlaps caused by this).
-	if err := block.MarkForDeletion(delCtx, logger, bkt, ie.id, "source of repaired block", blocksMarkedForDeletion); err != nil {
+	if err := block.MarkForDeletion(delCtx, logger, bkt, ie.id, metadata.RepairedDeletionReason, "source of repaired block", blocksMarkedForDeletion, withCompactionGroup(deletionMarkOpts, meta.Thanos.GroupKey())...); err != nil {
 		return errors.Wrapf(err, "marking old block %s for deletion has failed", ie.id)
 	}
 	return nil
@@ -986,7 +1084,16 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		// TODO(bwplotka): It would really nice if we could still check for other overlaps than replica. In fact this should be checked
 		// in syncer itself. Otherwise with vertical compaction enabled we will sacrifice this important check.
 		if !cg.enableVerticalCompaction {
-			return false, ulid.ULID{}, halt(errors.Wrap(err, "pre compaction overlap check"))
+			// Blocks of samples ingested out of order overlap with the in-order blocks of the same time range by design,
+			// so they are merged with them even without vertical compaction, as long as the in-order blocks don't overlap.
+			ooo := cg.outOfOrderMetas()
+			if len(ooo) == 0 {
+				return false, ulid.ULID{}, halt(errors.Wrap(err, "pre compaction overlap check"))
+			}
+			if err := cg.areBlocksOverlapping(nil, ooo...); err != nil {
+				return false, ulid.ULID{}, halt(errors.Wrap(err, "pre compaction overlap check of in-order blocks"))
+			}
+			level.Info(cg.logger).Log("msg", "vertically compacting blocks of out-of-order samples with the overlapping blocks", "blocks", fmt.Sprintf("%v", blockIDs(ooo)))
 		}
 
 		overlappingBlocks = true
@@ -995,14 +1102,16 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	var toCompact []*metadata.Meta
 	if err := tracing.DoInSpanWithErr(ctx, "compaction_planning", func(ctx context.Context) (e error) {
 		toCompact, e = planner.Plan(ctx, cg.metasByMinTime)
+		tracing.SpanFromContext(ctx).SetTag("plan.blocks", fmt.Sprintf("%v", blockIDs(toCompact)))
 		return e
-	}); err != nil {
+	}, opentracing.Tags{"group.blocks": len(cg.metasByMinTime)}); err != nil {
 		return false, ulid.ULID{}, errors.Wrap(err, "plan compaction")
 	}
 	if len(toCompact) == 0 {
 		// Nothing to do.
 		return false, ulid.ULID{}, nil
 	}
+	span := tracing.SpanFromContext(ctx)
 
 	level.Info(cg.logger).Log("msg", "compaction available and planned; downloading blocks", "plan", fmt.Sprintf("%v", toCompact))
 
@@ -1028,9 +1137,10 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 			g.Go(func() error {
 				if err := tracing.DoInSpanWithErr(ctx, "compaction_block_download", func(ctx context.Context) error {
 					return block.Download(ctx, cg.logger, cg.bkt, meta.ULID, bdir, objstore.WithFetchConcurrency(cg.blockFilesConcurrency))
-				}, opentracing.Tags{"block.id": meta.ULID}); err != nil {
+				}, opentracing.Tags{"block.id": meta.ULID, "block.series": meta.Stats.NumSeries, "block.bytes": blockSize(meta)}); err != nil {
 					return retry(errors.Wrapf(err, "download block %s", meta.ULID))
 				}
+				span.LogKV("event", "block downloaded", "block.id", meta.ULID.String())
 
 				// Ensure all input blocks are valid.
 				var stats block.HealthStats
@@ -1067,17 +1177,38 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	if err := g.Wait(); err != nil {
 		return false, ulid.ULID{}, err
 	}
+	span.LogKV("event", "blocks downloaded", "duration_ms", time.Since(begin).Milliseconds())
 
 	level.Info(cg.logger).Log("msg", "downloaded and verified blocks; compacting blocks", "plan", fmt.Sprintf("%v", toCompactDirs), "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
 
+	shardCount, err := cg.splitLimits.shardCount(toCompact, toCompactDirs)
+	if err != nil {
+		return false, ulid.ULID{}, errors.Wrap(err, "project compacted block size")
+	}
+
+	var inputSeries uint64
+	for _, m := range toCompact {
+		inputSeries += m.Stats.NumSeries
+	}
+
 	begin = time.Now()
+	var outputs []compactionOutput
 	if err := tracing.DoInSpanWithErr(ctx, "compaction", func(ctx context.Context) (e error) {
+		if shardCount > 1 {
+			level.Info(cg.logger).Log("msg", "compacted block would exceed split limits; splitting it", "shards", shardCount)
+			outputs, e = cg.compactShards(ctx, dir, toCompactDirs, childShards(cg.shard, shardCount), comp)
+			return e
+		}
 		compID, e = comp.Compact(dir, toCompactDirs, nil)
+		if e == nil && compID != (ulid.ULID{}) {
+			outputs = []compactionOutput{{id: compID, dir: filepath.Join(dir, compID.String()), shard: cg.shard}}
+		}
 		return e
-	}); err != nil {
+	}, opentracing.Tags{"input.blocks": fmt.Sprintf("%v", blockIDs(toCompact)), "input.series": inputSeries, "shards": shardCount}); err != nil {
 		return false, ulid.ULID{}, halt(errors.Wrapf(err, "compact blocks %v", toCompactDirs))
 	}
-	if compID == (ulid.ULID{}) {
+	span.LogKV("event", "blocks compacted", "duration_ms", time.Since(begin).Milliseconds())
+	if len(outputs) == 0 {
 		// Prometheus compactor found that the compacted block would have no samples.
 		level.Info(cg.logger).Log("msg", "compacted block would have no samples, deleting source blocks", "blocks", fmt.Sprintf("%v", toCompactDirs))
 		for _, meta := range toCompact {
@@ -1094,24 +1225,104 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	if overlappingBlocks {
 		cg.verticalCompactions.Inc()
 	}
-	level.Info(cg.logger).Log("msg", "compacted blocks", "new", compID,
+	compIDs := make([]ulid.ULID, 0, len(outputs))
+	for _, out := range outputs {
+		compIDs = append(compIDs, out.id)
+	}
+	level.Info(cg.logger).Log("msg", "compacted blocks", "new", fmt.Sprintf("%v", compIDs),
 		"blocks", fmt.Sprintf("%v", toCompactDirs), "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds(), "overlapping_blocks", overlappingBlocks)
 
-	bdir := filepath.Join(dir, compID.String())
+	newMetas := make([]*metadata.Meta, 0, len(outputs))
+	for _, out := range outputs {
+		newMeta, err := cg.finalize(ctx, out, toCompact, toCompactDirs)
+		if err != nil {
+			return false, ulid.ULID{}, err
+		}
+		newMetas = append(newMetas, newMeta)
+	}
+
+	if cg.outputVerification.Enabled {
+		outDirs := make([]string, 0, len(outputs))
+		for _, out := range outputs {
+			outDirs = append(outDirs, out.dir)
+		}
+		if err := tracing.DoInSpanWithErr(ctx, "compaction_verify_output", func(ctx context.Context) error {
+			return verifyOutput(toCompact, toCompactDirs, outDirs, overlappingBlocks, cg.outputVerification.Tolerance)
+		}); err != nil {
+			return cg.keepSourceBlocks(ctx, toCompact, compIDs, err)
+		}
+	}
+
+	for i, out := range outputs {
+		if err := cg.upload(ctx, out, newMetas[i]); err != nil {
+			return false, ulid.ULID{}, err
+		}
+		span.LogKV("event", "block uploaded", "result_block.id", out.id.String())
+	}
+	span.SetTag("result_block.ids", fmt.Sprintf("%v", compIDs))
+
+	// Mark for deletion the blocks we just compacted from the group and bucket so they do not get included
+	// into the next planning cycle.
+	// Eventually the block we just uploaded should get synced into the group again (including sync-delay).
+	for _, meta := range toCompact {
+		err = tracing.DoInSpanWithErr(ctx, "compaction_block_delete", func(ctx context.Context) error {
+			return cg.deleteBlock(meta.ULID, filepath.Join(dir, meta.ULID.String()))
+		}, opentracing.Tags{"block.id": meta.ULID})
+		if err != nil {
+			return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark old block for deletion from bucket"))
+		}
+		cg.groupGarbageCollectedBlocks.Inc()
+	}
+	return true, outputs[0].id, nil
+}
+
+// keepSourceBlocks marks the source blocks of compacted blocks that failed the output verification for no compaction,
+// instead of uploading the compacted blocks. Uploaded, they would replace the source blocks, which would then be
+// garbage collected as duplicates.
+func (cg *Group) keepSourceBlocks(ctx context.Context, toCompact []*metadata.Meta, compIDs []ulid.ULID, verifyErr error) (bool, ulid.ULID, error) {
+	level.Error(cg.logger).Log("msg", "compacted blocks do not match their source blocks; marking source blocks for no compaction instead of uploading compacted blocks",
+		"new", fmt.Sprintf("%v", compIDs), "blocks", fmt.Sprintf("%v", blockIDs(toCompact)), "err", verifyErr)
+	cg.outputVerificationFailures.Inc()
+
+	for _, meta := range toCompact {
+		if err := block.MarkForNoCompact(ctx, cg.logger, cg.bkt, meta.ULID, metadata.OutputVerificationFailedNoCompactReason,
+			fmt.Sprintf("compacted block %v failed verification: %v", compIDs, verifyErr), cg.outputVerificationNoCompact); err != nil {
+			return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark block %s for no compaction", meta.ULID))
+		}
+	}
+	// The marked blocks are excluded from the next planning, other blocks of the group may still be compacted.
+	return true, ulid.ULID{}, nil
+}
+
+// finalize sets Thanos metadata of the given compacted block, carries the exemplars of its source blocks in the given
+// dirs and the unknown meta fields they share over, verifies it and writes its label index if enabled.
+func (cg *Group) finalize(ctx context.Context, out compactionOutput, toCompact []*metadata.Meta, toCompactDirs []string) (*metadata.Meta, error) {
+	bdir := out.dir
 	index := filepath.Join(bdir, block.IndexFilename)
 
+	// The meta fields unknown to this version are kept if all the source blocks agree on them.
+	unknown, dropped := sharedUnknownFields(toCompact)
+	if len(dropped) > 0 {
+		level.Warn(cg.logger).Log("msg", "dropping unknown meta fields differing between the source blocks", "block", bdir, "fields", strings.Join(dropped, ","))
+	}
 	newMeta, err := metadata.InjectThanos(cg.logger, bdir, metadata.Thanos{
 		Labels:       cg.labels.Map(),
 		Downsample:   metadata.ThanosDownsample{Resolution: cg.resolution},
 		Source:       metadata.CompactorSource,
 		SegmentFiles: block.GetSegmentFiles(bdir),
+		Shard:        out.shard,
+		Unknown:      unknown,
 	}, nil)
 	if err != nil {
-		return false, ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
+		return nil, errors.Wrapf(err, "failed to finalize the block %s", bdir)
 	}
 
 	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
-		return false, ulid.ULID{}, errors.Wrap(err, "remove tombstones")
+		return nil, errors.Wrap(err, "remove tombstones")
+	}
+
+	if _, err := block.CopyExemplars(cg.logger, bdir, toCompactDirs...); err != nil {
+		return nil, errors.Wrapf(err, "copy exemplars of the source blocks to %s", bdir)
 	}
 
 	// Ensure the output block is valid.
@@ -1119,40 +1330,57 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		return block.VerifyIndex(cg.logger, index, newMeta.MinTime, newMeta.MaxTime)
 	})
 	if !cg.acceptMalformedIndex && err != nil {
-		return false, ulid.ULID{}, halt(errors.Wrapf(err, "invalid result block %s", bdir))
+		return nil, halt(errors.Wrapf(err, "invalid result block %s", bdir))
 	}
 
-	// Ensure the output block is not overlapping with anything else,
+	// Ensure the output block is not overlapping with anything else but blocks of out-of-order samples left to merge,
 	// unless vertical compaction is enabled.
 	if !cg.enableVerticalCompaction {
-		if err := cg.areBlocksOverlapping(newMeta, toCompact...); err != nil {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
+		if err := cg.areBlocksOverlapping(newMeta, append(cg.outOfOrderMetas(), toCompact...)...); err != nil {
+			return nil, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
 		}
 	}
 
-	begin = time.Now()
+	if cg.writeLabelIndex {
+		if err := tracing.DoInSpanWithErr(ctx, "compaction_write_label_index", func(ctx context.Context) error {
+			return block.WriteLabelIndex(cg.logger, bdir)
+		}); err != nil {
+			return nil, errors.Wrapf(err, "write label index of %s", bdir)
+		}
+	}
+	return newMeta, nil
+}
+
+// upload uploads the given finalized compacted block.
+func (cg *Group) upload(ctx context.Context, out compactionOutput, newMeta *metadata.Meta) error {
+	bdir := out.dir
+	begin := time.Now()
 
-	err = tracing.DoInSpanWithErr(ctx, "compaction_block_upload", func(ctx context.Context) error {
+	err := tracing.DoInSpanWithErr(ctx, "compaction_block_upload", func(ctx context.Context) error {
 		return block.Upload(ctx, cg.logger, cg.bkt, bdir, cg.hashFunc, objstore.WithUploadConcurrency(cg.blockFilesConcurrency))
-	})
+	}, opentracing.Tags{"result_block.id": out.id, "block.series": newMeta.Stats.NumSeries, "block.samples": newMeta.Stats.NumSamples})
 	if err != nil {
-		return false, ulid.ULID{}, retry(errors.Wrapf(err, "upload of %s failed", compID))
+		return retry(errors.Wrapf(err, "upload of %s failed", out.id))
 	}
-	level.Info(cg.logger).Log("msg", "uploaded block", "result_block", compID, "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
+	level.Info(cg.logger).Log("msg", "uploaded block", "result_block", out.id, "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
+	return nil
+}
 
-	// Mark for deletion the blocks we just compacted from the group and bucket so they do not get included
-	// into the next planning cycle.
-	// Eventually the block we just uploaded should get synced into the group again (including sync-delay).
-	for _, meta := range toCompact {
-		err = tracing.DoInSpanWithErr(ctx, "compaction_block_delete", func(ctx context.Context) error {
-			return cg.deleteBlock(meta.ULID, filepath.Join(dir, meta.ULID.String()))
-		}, opentracing.Tags{"block.id": meta.ULID})
-		if err != nil {
-			return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark old block for deletion from bucket"))
-		}
-		cg.groupGarbageCollectedBlocks.Inc()
+func blockIDs(metas []*metadata.Meta) []ulid.ULID {
+	ids := make([]ulid.ULID, 0, len(metas))
+	for _, m := range metas {
+		ids = append(ids, m.ULID)
+	}
+	return ids
+}
+
+// blockSize returns the size in bytes of the files of the given block, if known from its meta.
+func blockSize(m *metadata.Meta) int64 {
+	var size int64
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
 	}
-	return true, compID, nil
+	return size
 }
 
 func (cg *Group) deleteBlock(id ulid.ULID, bdir string) error {
@@ -1164,7 +1392,7 @@ func (cg *Group) deleteBlock(id ulid.ULID, bdir string) error {
 	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 	level.Info(cg.logger).Log("msg", "marking compacted block for deletion", "old_block", id)
-	if err := block.MarkForDeletion(delCtx, cg.logger, cg.bkt, id, "source of compacted block", cg.blocksMarkedForDeletion); err != nil {
+	if err := block.MarkForDeletion(delCtx, cg.logger, cg.bkt, id, metadata.CompactedDeletionReason, "source of compacted block", cg.blocksMarkedForDeletion, cg.deletionMarkOpts...); err != nil {
 		return errors.Wrapf(err, "mark block %s for deletion from bucket", id)
 	}
 	return nil
@@ -1181,6 +1409,8 @@ type BucketCompactor struct {
 	bkt                            objstore.Bucket
 	concurrency                    int
 	skipBlocksWithOutOfOrderChunks bool
+	health                         *HealthReporter
+	budget                         *OperationBudget
 }
 
 // NewBucketCompactor creates a new bucket compactor.
@@ -1211,6 +1441,20 @@ func NewBucketCompactor(
 	}, nil
 }
 
+// WithHealthReporter configures the compactor to report the compaction health of the groups it compacts after each
+// compaction iteration.
+func (c *BucketCompactor) WithHealthReporter(r *HealthReporter) *BucketCompactor {
+	c.health = r
+	return c
+}
+
+// WithOperationBudget configures the compactor to stop compacting further groups once the object storage operation
+// budget of the iteration is exhausted. The operations of the bucket of the compactor must be counted in the budget.
+func (c *BucketCompactor) WithOperationBudget(b *OperationBudget) *BucketCompactor {
+	c.budget = b
+	return c
+}
+
 // Compact runs compaction over bucket.
 func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 	defer func() {
@@ -1226,131 +1470,229 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 	}()
 
 	// Loop over bucket and compact until there's no work left.
-	for {
-		var (
-			wg                     sync.WaitGroup
-			workCtx, workCtxCancel = context.WithCancel(ctx)
-			groupChan              = make(chan *Group)
-			errChan                = make(chan error, c.concurrency)
-			finishedAllGroups      = true
-			mtx                    sync.Mutex
-		)
-		defer workCtxCancel()
-
-		// Set up workers who will compact the groups when the groups are ready.
-		// They will compact available groups until they encounter an error, after which they will stop.
-		for i := 0; i < c.concurrency; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for g := range groupChan {
-					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.planner, c.comp)
-					if err == nil {
-						if shouldRerunGroup {
-							mtx.Lock()
-							finishedAllGroups = false
-							mtx.Unlock()
-						}
-						continue
+	for iteration := 0; ; iteration++ {
+		span, iterCtx := tracing.StartSpan(ctx, "compaction_iteration", opentracing.Tags{"iteration": iteration})
+		finishedAllGroups, err := c.compactIteration(iterCtx, span)
+		if err != nil {
+			ext.LogError(span, err)
+		}
+		span.Finish()
+		if err != nil {
+			return err
+		}
+
+		if finishedAllGroups {
+			break
+		}
+		if op, ok := c.budget.Exhausted(); ok {
+			level.Warn(c.logger).Log("msg", "object storage operation budget exhausted, skipping the remaining compactions until the next iteration", "operation", op)
+			return nil
+		}
+	}
+	level.Info(c.logger).Log("msg", "compaction iterations done")
+	return nil
+}
+
+// compactIteration syncs metas of the bucket and compacts all groups once. It returns true if no group needs another run.
+func (c *BucketCompactor) compactIteration(ctx context.Context, span tracing.Span) (bool, error) {
+	var (
+		wg                     sync.WaitGroup
+		workCtx, workCtxCancel = context.WithCancel(ctx)
+		groupChan              = make(chan *Group)
+		errChan                = make(chan error, c.concurrency)
+		finishedAllGroups      = true
+		mtx                    sync.Mutex
+	)
+	defer workCtxCancel()
+
+	// Set up workers who will compact the groups when the groups are ready.
+	// They will compact available groups until they encounter an error, after which they will stop.
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range groupChan {
+				// The groups being compacted are finished, the others are compacted in the next iteration.
+				if _, ok := c.budget.Exhausted(); ok {
+					mtx.Lock()
+					finishedAllGroups = false
+					mtx.Unlock()
+					continue
+				}
+				ids := g.IDs()
+				c.sy.blocksInUse.Acquire(ids)
+				shouldRerunGroup, compID, err := g.Compact(workCtx, c.compactDir, c.planner, c.comp)
+				c.sy.blocksInUse.Release(ids)
+				if err == nil {
+					c.health.compacted(g, compID)
+					if shouldRerunGroup {
+						mtx.Lock()
+						finishedAllGroups = false
+						mtx.Unlock()
 					}
+					continue
+				}
 
-					if IsIssue347Error(err) {
-						if err := RepairIssue347(workCtx, c.logger, c.bkt, c.sy.metrics.blocksMarkedForDeletion, err); err == nil {
-							mtx.Lock()
-							finishedAllGroups = false
-							mtx.Unlock()
-							continue
-						}
+				if IsIssue347Error(err) {
+					if err := RepairIssue347(workCtx, c.logger, c.bkt, c.sy.metrics.blocksMarkedForDeletion, err, c.sy.deletionMarkOpts...); err == nil {
+						mtx.Lock()
+						finishedAllGroups = false
+						mtx.Unlock()
+						continue
 					}
-					// If block has out of order chunk and it has been configured to skip it,
-					// then we can mark the block for no compaction so that the next compaction run
-					// will skip it.
-					if IsOutOfOrderChunkError(err) && c.skipBlocksWithOutOfOrderChunks {
-						if err := block.MarkForNoCompact(
-							ctx,
-							c.logger,
-							c.bkt,
-							err.(OutOfOrderChunksError).id,
-							metadata.OutOfOrderChunksNoCompactReason,
-							"OutofOrderChunk: marking block with out-of-order series/chunks to as no compact to unblock compaction", g.blocksMarkedForNoCompact); err == nil {
-							mtx.Lock()
-							finishedAllGroups = false
-							mtx.Unlock()
-							continue
-						}
+				}
+				// If block has out of order chunk and it has been configured to skip it,
+				// then we can mark the block for no compaction so that the next compaction run
+				// will skip it.
+				if IsOutOfOrderChunkError(err) && c.skipBlocksWithOutOfOrderChunks {
+					if err := block.MarkForNoCompact(
+						ctx,
+						c.logger,
+						c.bkt,
+						err.(OutOfOrderChunksError).id,
+						metadata.OutOfOrderChunksNoCompactReason,
+						"OutofOrderChunk: marking block with out-of-order series/chunks to as no compact to unblock compaction", g.blocksMarkedForNoCompact); err == nil {
+						mtx.Lock()
+						finishedAllGroups = false
+						mtx.Unlock()
+						continue
 					}
-					errChan <- errors.Wrapf(err, "group %s", g.Key())
-					return
 				}
-			}()
-		}
+				c.health.failed(g, err)
+				errChan <- errors.Wrapf(err, "group %s", g.Key())
+				return
+			}
+		}()
+	}
 
-		level.Info(c.logger).Log("msg", "start sync of metas")
-		if err := c.sy.SyncMetas(ctx); err != nil {
-			return errors.Wrap(err, "sync")
-		}
+	level.Info(c.logger).Log("msg", "start sync of metas")
+	if err := tracing.DoInSpanWithErr(ctx, "compaction_sync_metas", c.sy.SyncMetas); err != nil {
+		return false, errors.Wrap(err, "sync")
+	}
 
-		level.Info(c.logger).Log("msg", "start of GC")
-		// Blocks that were compacted are garbage collected after each Compaction.
-		// However if compactor crashes we need to resolve those on startup.
-		if err := c.sy.GarbageCollect(ctx); err != nil {
-			return errors.Wrap(err, "garbage")
-		}
+	level.Info(c.logger).Log("msg", "start of GC")
+	// Blocks that were compacted are garbage collected after each Compaction.
+	// However if compactor crashes we need to resolve those on startup.
+	if err := tracing.DoInSpanWithErr(ctx, "compaction_garbage_collect", c.sy.GarbageCollect); err != nil {
+		return false, errors.Wrap(err, "garbage")
+	}
 
-		groups, err := c.grouper.Groups(c.sy.Metas())
-		if err != nil {
-			return errors.Wrap(err, "build compaction groups")
-		}
+	groups, err := c.grouper.Groups(c.sy.Metas())
+	if err != nil {
+		return false, errors.Wrap(err, "build compaction groups")
+	}
+	span.SetTag("groups", len(groups))
+	c.health.observe(ctx, groups)
+	defer c.health.write(ctx)
 
-		ignoreDirs := []string{}
-		for _, gr := range groups {
-			for _, grID := range gr.IDs() {
-				ignoreDirs = append(ignoreDirs, filepath.Join(gr.Key(), grID.String()))
-			}
+	ignoreDirs := []string{}
+	for _, gr := range groups {
+		for _, grID := range gr.IDs() {
+			ignoreDirs = append(ignoreDirs, filepath.Join(gr.Key(), grID.String()))
 		}
+	}
 
-		if err := runutil.DeleteAll(c.compactDir, ignoreDirs...); err != nil {
-			level.Warn(c.logger).Log("msg", "failed deleting non-compaction group directories/files, some disk space usage might have leaked. Continuing", "err", err, "dir", c.compactDir)
-		}
+	if err := runutil.DeleteAll(c.compactDir, ignoreDirs...); err != nil {
+		level.Warn(c.logger).Log("msg", "failed deleting non-compaction group directories/files, some disk space usage might have leaked. Continuing", "err", err, "dir", c.compactDir)
+	}
 
-		level.Info(c.logger).Log("msg", "start of compactions")
+	level.Info(c.logger).Log("msg", "start of compactions")
 
-		// Send all groups found during this pass to the compaction workers.
-		var groupErrs errutil.MultiError
-	groupLoop:
-		for _, g := range groups {
-			// Ignore groups with only one block because there is nothing to compact.
-			if len(g.IDs()) == 1 {
-				continue
-			}
-			select {
-			case groupErr := <-errChan:
-				groupErrs.Add(groupErr)
-				break groupLoop
-			case groupChan <- g:
-			}
+	// Send all groups found during this pass to the compaction workers.
+	var groupErrs errutil.MultiError
+groupLoop:
+	for _, g := range groups {
+		// Ignore groups with only one block because there is nothing to compact.
+		if len(g.IDs()) == 1 {
+			continue
 		}
-		close(groupChan)
-		wg.Wait()
-
-		// Collect any other error reported by the workers, or any error reported
-		// while we were waiting for the last batch of groups to run the compaction.
-		close(errChan)
-		for groupErr := range errChan {
+		select {
+		case groupErr := <-errChan:
 			groupErrs.Add(groupErr)
+			break groupLoop
+		case groupChan <- g:
 		}
+	}
+	close(groupChan)
+	wg.Wait()
+
+	// Collect any other error reported by the workers, or any error reported
+	// while we were waiting for the last batch of groups to run the compaction.
+	close(errChan)
+	for groupErr := range errChan {
+		groupErrs.Add(groupErr)
+	}
+
+	workCtxCancel()
+	if len(groupErrs) > 0 {
+		return false, groupErrs.Err()
+	}
+
+	return finishedAllGroups, nil
+}
+
+// BlocksInUse tracks the blocks of the groups being compacted and the blocks being downsampled, so that retention and
+// garbage collection running concurrently with them do not mark them for deletion. A nil BlocksInUse tracks no blocks.
+type BlocksInUse struct {
+	mtx sync.Mutex
+	ids map[ulid.ULID]int
+}
+
+// NewBlocksInUse returns an empty BlocksInUse.
+func NewBlocksInUse() *BlocksInUse {
+	return &BlocksInUse{ids: map[ulid.ULID]int{}}
+}
+
+// Acquire marks the blocks as in use until they are released as many times as they were acquired.
+func (b *BlocksInUse) Acquire(ids []ulid.ULID) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, id := range ids {
+		b.ids[id]++
+	}
+}
+
+// Release marks the blocks as no longer used by the caller.
+func (b *BlocksInUse) Release(ids []ulid.ULID) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
 
-		workCtxCancel()
-		if len(groupErrs) > 0 {
-			return groupErrs.Err()
+	for _, id := range ids {
+		if b.ids[id]--; b.ids[id] <= 0 {
+			delete(b.ids, id)
 		}
+	}
+}
 
-		if finishedAllGroups {
-			break
+// InUse returns true if the block is being compacted or downsampled.
+func (b *BlocksInUse) InUse(id ulid.ULID) bool {
+	if b == nil {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	_, ok := b.ids[id]
+	return ok
+}
+
+// NotInUse returns the metas of the blocks which are not being compacted or downsampled.
+func (b *BlocksInUse) NotInUse(metas map[ulid.ULID]*metadata.Meta) map[ulid.ULID]*metadata.Meta {
+	res := make(map[ulid.ULID]*metadata.Meta, len(metas))
+	for id, m := range metas {
+		if b.InUse(id) {
+			continue
 		}
+		res[id] = m
 	}
-	level.Info(c.logger).Log("msg", "compaction iterations done")
-	return nil
+	return res
 }
 
 var _ block.MetadataFilter = &GatherNoCompactionMarkFilter{}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
@@ -32,6 +33,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
 const fetcherConcurrency = 32
@@ -107,6 +109,17 @@ func TestSyncer_GarbageCollect_e2e(t *testing.T) {
 		sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks)
 		testutil.Ok(t, err)
 
+		// Blocks in use are not garbage collected until they are released.
+		blocksInUse := NewBlocksInUse()
+		sy.WithBlocksInUse(blocksInUse)
+		blocksInUse.Acquire([]ulid.ULID{ids[0]})
+		testutil.Ok(t, sy.SyncMetas(ctx))
+		testutil.Ok(t, sy.GarbageCollect(ctx))
+		exists, err := bkt.Exists(ctx, path.Join(ids[0].String(), metadata.DeletionMarkFilename))
+		testutil.Ok(t, err)
+		testutil.Assert(t, !exists, "block in use marked for deletion")
+		blocksInUse.Release([]ulid.ULID{ids[0]})
+
 		// Do one initial synchronization with the bucket.
 		testutil.Ok(t, sy.SyncMetas(ctx))
 		testutil.Ok(t, sy.GarbageCollect(ctx))
@@ -568,3 +581,523 @@ func listBlocksMarkedForDeletion(ctx context.Context, bkt objstore.Bucket) ([]ul
 	})
 	return rem, err
 }
+
+func TestGroupCompactSplitE2E(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	prepareDir := t.TempDir()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+
+	var series []labels.Labels
+	for i := 0; i < 20; i++ {
+		series = append(series, labels.FromStrings("a", fmt.Sprintf("%d", i), "b", "1"))
+	}
+	var blockDirs []string
+	for _, b := range []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series[5:]},
+		{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series[:15]},
+		// Due to TSDB compaction delay (not compacting fresh block), we need one more block to be pushed to trigger compaction.
+		{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series[:1]},
+	} {
+		id, _ := createBlock(t, ctx, prepareDir, b)
+		blockDirs = append(blockDirs, filepath.Join(prepareDir, id.String()))
+	}
+
+	// Compact the same blocks with and without splitting.
+	bkt := objstore.NewInMemBucket()
+	compactForSplitTest(t, ctx, bkt, blockDirs, BlockSplitLimits{})
+
+	expected := map[string]*metadata.Meta{}
+	expectedSeries := seriesFromBucket(t, ctx, bkt, func(m *metadata.Meta, _ labels.Labels) { expected[m.ULID.String()] = m })
+	testutil.Equals(t, 2, len(expected))
+	testutil.Equals(t, 20, len(expectedSeries))
+
+	for _, tcase := range []struct {
+		limits BlockSplitLimits
+		shards uint64
+	}{
+		// Series of the 3 compacted blocks are projected to exceed the limit 3 times.
+		{limits: BlockSplitLimits{MaxSeries: 20}, shards: 3},
+		// More shards than series, some of them are empty.
+		{limits: BlockSplitLimits{MaxSeries: 2}, shards: 25},
+		// Indexes of the 3 compacted blocks are projected to exceed the limit 2 times.
+		{limits: BlockSplitLimits{MaxIndexSizeBytes: (blockDirsIndexSize(t, blockDirs[:3]) + 1) / 2}, shards: 2},
+	} {
+		t.Run(fmt.Sprintf("%+v", tcase.limits), func(t *testing.T) {
+			splitBkt := objstore.NewInMemBucket()
+			compactForSplitTest(t, ctx, splitBkt, blockDirs, tcase.limits)
+
+			var (
+				shards       = map[metadata.ThanosShard]*metadata.Meta{}
+				seriesBlocks = map[string]ulid.ULID{}
+			)
+			splitSeries := seriesFromBucket(t, ctx, splitBkt, func(m *metadata.Meta, lset labels.Labels) {
+				if m.Compaction.Level == 1 {
+					testutil.Assert(t, m.Thanos.Shard == nil, "not compacted block should not be split")
+					return
+				}
+				testutil.Assert(t, m.Thanos.Shard != nil, "compacted block should be split")
+				testutil.Assert(t, m.Thanos.Shard.Contains(lset), "series %v does not belong to shard %v", lset, m.Thanos.Shard)
+
+				if id, ok := seriesBlocks[lset.String()]; ok {
+					testutil.Equals(t, id, m.ULID, "series %v is in multiple split blocks", lset)
+				}
+				seriesBlocks[lset.String()] = m.ULID
+			})
+			testutil.Equals(t, 20, len(seriesBlocks))
+
+			testutil.Ok(t, splitBkt.Iter(ctx, "", func(n string) error {
+				id, ok := block.IsBlockDir(n)
+				if !ok {
+					return nil
+				}
+				if ok, err := splitBkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename)); err != nil || ok {
+					return err
+				}
+				m, err := block.DownloadMeta(ctx, log.NewNopLogger(), splitBkt, id)
+				if err != nil {
+					return err
+				}
+				if m.Thanos.Shard != nil {
+					shards[*m.Thanos.Shard] = &m
+				}
+				return nil
+			}))
+			testutil.Equals(t, int(tcase.shards), len(shards))
+
+			var numSeries, numSamples uint64
+			for shard, m := range shards {
+				testutil.Equals(t, tcase.shards, shard.Count)
+				testutil.Equals(t, int64(0), m.MinTime)
+				testutil.Equals(t, int64(3000), m.MaxTime)
+				testutil.Equals(t, 2, m.Compaction.Level)
+				testutil.Equals(t, 3, len(m.Compaction.Sources))
+				testutil.Equals(t, metadata.CompactorSource, m.Thanos.Source)
+				testutil.Assert(t, labels.Equal(extLset, labels.FromMap(m.Thanos.Labels)), "ext labels does not match")
+				numSeries += m.Stats.NumSeries
+				numSamples += m.Stats.NumSamples
+			}
+			testutil.Equals(t, uint64(20), numSeries)
+			testutil.Equals(t, uint64((20+15+15)*100), numSamples)
+
+			// Querying across the split blocks returns the same data as querying the single compacted block.
+			testutil.Equals(t, expectedSeries, splitSeries)
+
+			// Split blocks stay in distinct groups for future compactions.
+			grouper := NewDefaultGrouper(nil, splitBkt, false, false, nil, nil, nil, nil, metadata.NoneFunc, 1, 1)
+			metas := map[ulid.ULID]*metadata.Meta{}
+			for _, m := range shards {
+				metas[m.ULID] = m
+			}
+			groups, err := grouper.Groups(metas)
+			testutil.Ok(t, err)
+			testutil.Equals(t, int(tcase.shards), len(groups))
+		})
+	}
+}
+
+// lossyCompactor is a broken compactor dropping the first of the compacted blocks.
+type lossyCompactor struct {
+	Compactor
+}
+
+func (c lossyCompactor) Compact(dest string, dirs []string, _ []*tsdb.Block) (ulid.ULID, error) {
+	return c.Compactor.Compact(dest, dirs[1:], nil)
+}
+
+func TestGroupCompactVerifyOutputE2E(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	prepareDir := t.TempDir()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+
+	var series []labels.Labels
+	for i := 0; i < 20; i++ {
+		series = append(series, labels.FromStrings("a", fmt.Sprintf("%d", i), "b", "1"))
+	}
+	var (
+		blockDirs []string
+		ids       []ulid.ULID
+	)
+	for _, b := range []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series[:5]},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series[5:]},
+		{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series},
+		// Due to TSDB compaction delay (not compacting fresh block), we need one more block to be pushed to trigger compaction.
+		{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series[:1]},
+	} {
+		id, _ := createBlock(t, ctx, prepareDir, b)
+		blockDirs = append(blockDirs, filepath.Join(prepareDir, id.String()))
+		ids = append(ids, id)
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		wrapComp func(Compactor) Compactor
+
+		expectFailure bool
+	}{
+		{name: "valid compaction"},
+		{name: "lossy compaction", wrapComp: func(c Compactor) Compactor { return lossyCompactor{c} }, expectFailure: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			var grouper *DefaultGrouper
+			compactForTest(t, ctx, bkt, blockDirs, tcase.wrapComp, func(g *DefaultGrouper) {
+				grouper = g.WithOutputVerification(OutputVerification{Enabled: true}, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
+			})
+
+			var blocks, deleted, noCompact int
+			testutil.Ok(t, bkt.Iter(ctx, "", func(n string) error {
+				id, ok := block.IsBlockDir(n)
+				if !ok {
+					return nil
+				}
+				blocks++
+				if ok, err := bkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename)); err != nil || ok {
+					deleted++
+					return err
+				}
+				if ok, err := bkt.Exists(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename)); err != nil || ok {
+					noCompact++
+					return err
+				}
+				return nil
+			}))
+
+			if tcase.expectFailure {
+				// The compacted block is not uploaded and the source blocks are kept.
+				testutil.Equals(t, 1.0, promtest.ToFloat64(grouper.outputVerificationFailures))
+				testutil.Equals(t, len(ids), blocks)
+				testutil.Equals(t, 0, deleted)
+				testutil.Equals(t, 3, noCompact)
+
+				var m metadata.NoCompactMark
+				testutil.Ok(t, metadata.ReadMarker(ctx, log.NewNopLogger(), objstore.WithNoopInstr(bkt), ids[0].String(), &m))
+				testutil.Equals(t, metadata.NoCompactReason(metadata.OutputVerificationFailedNoCompactReason), m.Reason)
+				return
+			}
+			testutil.Equals(t, 0.0, promtest.ToFloat64(grouper.outputVerificationFailures))
+			testutil.Equals(t, len(ids)+1, blocks)
+			testutil.Equals(t, 3, deleted)
+			testutil.Equals(t, 0, noCompact)
+		})
+	}
+}
+
+func TestGroupCompact_UnknownMetaFields(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	prepareDir := t.TempDir()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+
+	var blockDirs []string
+	for i, b := range []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series},
+		// Due to TSDB compaction delay (not compacting fresh block), we need one more block to be pushed to trigger compaction.
+		{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series},
+	} {
+		id, _ := createBlock(t, ctx, prepareDir, b)
+		bdir := filepath.Join(prepareDir, id.String())
+		blockDirs = append(blockDirs, bdir)
+
+		// The blocks were uploaded by a newer version of Thanos, adding fields to their meta.
+		meta, err := metadata.ReadFromDir(bdir)
+		testutil.Ok(t, err)
+		meta.Thanos.Unknown = map[string]json.RawMessage{
+			"extensions": json.RawMessage(`{"tenant":"team-a"}`),
+			"differing":  json.RawMessage(fmt.Sprintf("%d", i)),
+		}
+		testutil.Ok(t, meta.WriteToDir(log.NewNopLogger(), bdir))
+	}
+
+	bkt := objstore.NewInMemBucket()
+	compactForTest(t, ctx, bkt, blockDirs, nil, nil)
+
+	var compacted int
+	testutil.Ok(t, bkt.Iter(ctx, "", func(n string) error {
+		id, ok := block.IsBlockDir(n)
+		if !ok {
+			return nil
+		}
+		meta, err := block.DownloadMeta(ctx, log.NewNopLogger(), bkt, id)
+		if err != nil {
+			return err
+		}
+		if meta.Thanos.Source != metadata.CompactorSource {
+			return nil
+		}
+		compacted++
+		// The fields shared by all source blocks are kept.
+		testutil.Equals(t, map[string]json.RawMessage{"extensions": json.RawMessage(`{"tenant":"team-a"}`)}, meta.Thanos.Unknown)
+		return nil
+	}))
+	testutil.Equals(t, 1, compacted)
+}
+
+func TestBucketCompactorTracing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	prepareDir := t.TempDir()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+
+	var (
+		blockDirs []string
+		inputs    = map[string]struct{}{}
+	)
+	for _, b := range []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series},
+	} {
+		id, _ := createBlock(t, ctx, prepareDir, b)
+		blockDirs = append(blockDirs, filepath.Join(prepareDir, id.String()))
+		inputs[id.String()] = struct{}{}
+	}
+
+	tracer := mocktracer.New()
+	bkt := objstore.NewInMemBucket()
+	compactForSplitTest(t, tracing.ContextWithTracer(ctx, tracer), bkt, blockDirs, BlockSplitLimits{})
+
+	spans := map[string][]*mocktracer.MockSpan{}
+	for _, s := range tracer.FinishedSpans() {
+		spans[s.OperationName] = append(spans[s.OperationName], s)
+	}
+	testutil.Assert(t, len(spans["compaction_iteration"]) > 0, "expected iteration spans")
+	testutil.Equals(t, 1, len(spans["compaction"]))
+	testutil.Equals(t, 3, len(spans["compaction_block_download"]))
+	testutil.Equals(t, 1, len(spans["compaction_block_upload"]))
+
+	for _, s := range spans["compaction_block_download"] {
+		_, ok := inputs[s.Tag("block.id").(ulid.ULID).String()]
+		testutil.Assert(t, ok, "unexpected downloaded block %v", s.Tag("block.id"))
+		testutil.Equals(t, uint64(2), s.Tag("block.series"))
+		testutil.Assert(t, s.Tag("block.bytes").(int64) > 0, "expected size of downloaded block")
+	}
+	testutil.Equals(t, uint64(6), spans["compaction"][0].Tag("input.series"))
+
+	// The upload span is linked to the resulting block, which is a child of the group span.
+	upload := spans["compaction_block_upload"][0]
+	compacted := upload.Tag("result_block.id").(ulid.ULID)
+	m, err := block.DownloadMeta(ctx, log.NewNopLogger(), bkt, compacted)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(m.Compaction.Sources))
+
+	var group *mocktracer.MockSpan
+	for _, s := range spans["compaction_group"] {
+		if s.SpanContext.SpanID == upload.ParentID {
+			group = s
+		}
+	}
+	testutil.Assert(t, group != nil, "expected upload span to be a child of a group span")
+	testutil.Equals(t, m.Thanos.GroupKey(), group.Tag("group.key"))
+	testutil.Equals(t, fmt.Sprintf("%v", []ulid.ULID{compacted}), group.Tag("result_block.ids"))
+
+	var events []string
+	for _, l := range group.Logs() {
+		for _, f := range l.Fields {
+			if f.Key == "event" {
+				events = append(events, f.ValueString)
+			}
+		}
+	}
+	testutil.Equals(t, []string{"block downloaded", "block downloaded", "block downloaded", "blocks downloaded", "blocks compacted", "block uploaded"}, events)
+}
+
+func blockDirsIndexSize(t *testing.T, blockDirs []string) int64 {
+	var size int64
+	for _, bdir := range blockDirs {
+		fi, err := os.Stat(filepath.Join(bdir, block.IndexFilename))
+		testutil.Ok(t, err)
+		size += fi.Size()
+	}
+	return size
+}
+
+func compactForSplitTest(t *testing.T, ctx context.Context, bkt objstore.Bucket, blockDirs []string, limits BlockSplitLimits) {
+	compactForTest(t, ctx, bkt, blockDirs, nil, func(g *DefaultGrouper) { g.WithBlockSplitLimits(limits) })
+}
+
+// compactForTest uploads the given blocks and compacts them, with the compactor wrapped by wrapComp and the grouper
+// configured by configure if given.
+func compactForTest(t *testing.T, ctx context.Context, bkt objstore.Bucket, blockDirs []string, wrapComp func(Compactor) Compactor, configure func(*DefaultGrouper)) {
+	logger := log.NewNopLogger()
+	for _, bdir := range blockDirs {
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, bdir, metadata.NoneFunc))
+	}
+
+	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, objstore.WithNoopInstr(bkt), 48*time.Hour, fetcherConcurrency)
+	duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+	noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, objstore.WithNoopInstr(bkt), 2)
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", nil, []block.MetadataFilter{
+		ignoreDeletionMarkFilter,
+		duplicateBlocksFilter,
+		noCompactMarkerFilter,
+	})
+	testutil.Ok(t, err)
+
+	counter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, counter, counter)
+	testutil.Ok(t, err)
+
+	var comp Compactor
+	comp, err = tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil)
+	testutil.Ok(t, err)
+	if wrapComp != nil {
+		comp = wrapComp(comp)
+	}
+
+	planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, nil, counter, counter, counter, metadata.NoneFunc, 10, 10)
+	if configure != nil {
+		configure(grouper)
+	}
+	bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, t.TempDir(), bkt, 2, true)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bComp.Compact(ctx))
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+// seriesFromBucket returns the samples of all series of the blocks in the bucket not marked for deletion.
+func seriesFromBucket(t *testing.T, ctx context.Context, bkt objstore.Bucket, seen func(*metadata.Meta, labels.Labels)) map[string][]sample {
+	dir := t.TempDir()
+	res := map[string][]sample{}
+	testutil.Ok(t, bkt.Iter(ctx, "", func(n string) error {
+		id, ok := block.IsBlockDir(n)
+		if !ok {
+			return nil
+		}
+		if ok, err := bkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename)); err != nil || ok {
+			return err
+		}
+
+		bdir := filepath.Join(dir, id.String())
+		if err := block.Download(ctx, log.NewNopLogger(), bkt, id, bdir); err != nil {
+			return err
+		}
+		meta, err := metadata.ReadFromDir(bdir)
+		if err != nil {
+			return err
+		}
+		b, err := tsdb.OpenBlock(nil, bdir, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { testutil.Ok(t, b.Close()) }()
+
+		q, err := tsdb.NewBlockQuerier(b, meta.MinTime, meta.MaxTime)
+		if err != nil {
+			return err
+		}
+		defer func() { testutil.Ok(t, q.Close()) }()
+
+		set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "a", ".+"))
+		for set.Next() {
+			s := set.At()
+			seen(meta, s.Labels())
+
+			it := s.Iterator()
+			for it.Next() {
+				ts, v := it.At()
+				res[s.Labels().String()] = append(res[s.Labels().String()], sample{t: ts, v: v})
+			}
+			if err := it.Err(); err != nil {
+				return err
+			}
+		}
+		return set.Err()
+	}))
+	for _, samples := range res {
+		sort.Slice(samples, func(i, j int) bool { return samples[i].t < samples[j].t })
+	}
+	return res
+}
+
+func TestGroupCompact_OutOfOrderBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	logger := log.NewNopLogger()
+
+	extLset := labels.FromStrings("e1", "1")
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+	for _, tcase := range []struct {
+		name       string
+		outOfOrder bool
+	}{
+		{name: "overlapping block of out-of-order samples is merged", outOfOrder: true},
+		{name: "overlapping in-order blocks halt", outOfOrder: false},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+			prepareDir := t.TempDir()
+			for _, b := range []blockgenSpec{
+				{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+				{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series},
+			} {
+				id, _ := createBlock(t, ctx, prepareDir, b)
+				testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(prepareDir, id.String()), metadata.NoneFunc))
+			}
+			id, meta := createBlock(t, ctx, prepareDir, blockgenSpec{numSamples: 10, mint: 500, maxt: 1500, extLset: extLset, series: series})
+			if tcase.outOfOrder {
+				meta.CompactionHints = []string{metadata.FromOutOfOrderHint}
+				testutil.Ok(t, meta.WriteToDir(logger, filepath.Join(prepareDir, id.String())))
+			}
+			testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(prepareDir, id.String()), metadata.NoneFunc))
+
+			ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 48*time.Hour, fetcherConcurrency)
+			duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+			noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, bkt, 2)
+			metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{
+				ignoreDeletionMarkFilter,
+				duplicateBlocksFilter,
+				noCompactMarkerFilter,
+			})
+			testutil.Ok(t, err)
+
+			counter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, counter, counter)
+			testutil.Ok(t, err)
+			comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil)
+			testutil.Ok(t, err)
+			planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter)
+			// Vertical compaction is disabled.
+			grouper := NewDefaultGrouper(logger, bkt, false, false, nil, counter, counter, counter, metadata.NoneFunc, 10, 10)
+			bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, t.TempDir(), bkt, 1, true)
+			testutil.Ok(t, err)
+
+			err = bComp.Compact(ctx)
+			if !tcase.outOfOrder {
+				testutil.NotOk(t, err)
+				testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+				return
+			}
+			testutil.Ok(t, err)
+
+			var metas []*metadata.Meta
+			seriesFromBucket(t, ctx, bkt, func(m *metadata.Meta, _ labels.Labels) {
+				if len(metas) == 0 || metas[len(metas)-1].ULID != m.ULID {
+					metas = append(metas, m)
+				}
+			})
+			testutil.Equals(t, 1, len(metas))
+			testutil.Equals(t, int64(0), metas[0].MinTime)
+			testutil.Equals(t, int64(2000), metas[0].MaxTime)
+			testutil.Equals(t, 3, len(metas[0].Compaction.Sources))
+			testutil.Assert(t, !metas[0].FromOutOfOrder(), "merged block must not be flagged as from out-of-order")
+		})
+	}
+}
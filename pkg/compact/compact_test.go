@@ -22,6 +22,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/objstore"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -89,6 +90,30 @@ func TestRetryError(t *testing.T) {
 	testutil.Assert(t, IsHaltError(err), "not a halt error. Retry should not hide halt error")
 }
 
+func TestBlocksInUse(t *testing.T) {
+	id1, id2 := ulid.MustNew(1, nil), ulid.MustNew(2, nil)
+	metas := map[ulid.ULID]*metadata.Meta{id1: {}, id2: {}}
+
+	var nilInUse *BlocksInUse
+	nilInUse.Acquire([]ulid.ULID{id1})
+	testutil.Assert(t, !nilInUse.InUse(id1))
+	testutil.Equals(t, metas, nilInUse.NotInUse(metas))
+
+	b := NewBlocksInUse()
+	b.Acquire([]ulid.ULID{id1})
+	b.Acquire([]ulid.ULID{id1})
+	testutil.Assert(t, b.InUse(id1))
+	testutil.Assert(t, !b.InUse(id2))
+	testutil.Equals(t, map[ulid.ULID]*metadata.Meta{id2: metas[id2]}, b.NotInUse(metas))
+
+	// Blocks stay in use until all the groups using them are done.
+	b.Release([]ulid.ULID{id1})
+	testutil.Assert(t, b.InUse(id1))
+	b.Release([]ulid.ULID{id1})
+	testutil.Assert(t, !b.InUse(id1))
+	testutil.Equals(t, metas, b.NotInUse(metas))
+}
+
 func TestGroupKey(t *testing.T) {
 	for _, tcase := range []struct {
 		input    metadata.Thanos
@@ -119,6 +144,14 @@ func TestGroupKey(t *testing.T) {
 			},
 			expected: "0@16590761456214576373",
 		},
+		{
+			input: metadata.Thanos{
+				Labels:     map[string]string{"foo": "bar", "foo1": "bar2"},
+				Downsample: metadata.ThanosDownsample{Resolution: 0},
+				Shard:      &metadata.ThanosShard{Index: 1, Count: 4},
+			},
+			expected: "0@2124638872457683483@1_of_4",
+		},
 	} {
 		if ok := t.Run("", func(t *testing.T) {
 			testutil.Equals(t, tcase.expected, tcase.input.GroupKey())
@@ -128,6 +161,44 @@ func TestGroupKey(t *testing.T) {
 	}
 }
 
+func TestDefaultGrouper_GroupKeyLabelRemover(t *testing.T) {
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i, lbls := range []map[string]string{
+		{"cluster": "eu", "replica": "0", "shard": "a"},
+		{"cluster": "eu", "replica": "1", "shard": "a"},
+		{"cluster": "eu", "replica": "0", "shard": "b"},
+		// Blocks compacted before the shard label was added, or already compacted across shards.
+		{"cluster": "eu"},
+		{"cluster": "us", "replica": "0", "shard": "a"},
+	} {
+		id := ulid.MustNew(uint64(i), nil)
+		metas[id] = &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 0, MaxTime: 100},
+			Thanos:    metadata.Thanos{Labels: lbls},
+		}
+	}
+
+	ctx := context.Background()
+	modified := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"modified"})
+	testutil.Ok(t, block.NewReplicaLabelRemover(log.NewNopLogger(), []string{"replica"}).Filter(ctx, metas, nil, modified))
+	testutil.Ok(t, block.NewGroupKeyLabelRemover(log.NewNopLogger(), []string{"shard"}).Filter(ctx, metas, nil, modified))
+
+	temp := promauto.With(nil).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for compact progress tests"})
+	groups, err := NewDefaultGrouper(log.NewNopLogger(), nil, false, true, nil, temp, temp, temp, "", 1, 1).Groups(metas)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(groups))
+
+	byLabels := map[string]*Group{}
+	for _, g := range groups {
+		byLabels[g.Labels().String()] = g
+	}
+	eu, us := byLabels[`{cluster="eu"}`], byLabels[`{cluster="us"}`]
+	testutil.Equals(t, 4, len(eu.IDs()))
+	testutil.Equals(t, 1, len(us.IDs()))
+	// Groups of blocks without the ignored labels keep their key.
+	testutil.Equals(t, (&metadata.Thanos{Labels: map[string]string{"cluster": "eu"}}).GroupKey(), eu.Key())
+}
+
 func TestGroupMaxMinTime(t *testing.T) {
 	g := &Group{
 		metasByMinTime: []*metadata.Meta{
@@ -494,7 +565,7 @@ func TestDownsampleProgressCalculate(t *testing.T) {
 		keys[ind] = meta.Thanos.GroupKey()
 	}
 
-	ds := NewDownsampleProgressCalculator(reg)
+	ds := NewDownsampleProgressCalculator(reg, nil)
 
 	var bkt objstore.Bucket
 	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for downsample progress tests"})
@@ -595,3 +666,36 @@ func TestDownsampleProgressCalculate(t *testing.T) {
 		}
 	}
 }
+
+func TestDownsampleProgressCalculate_Policies(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	logger := log.NewNopLogger()
+
+	policies, err := downsample.ParsePolicies([]byte(`[{matchers: '{tenant_id="a"}', disable_5m: true}]`))
+	testutil.Ok(t, err)
+	ds := NewDownsampleProgressCalculator(reg, policies)
+
+	var bkt objstore.Bucket
+	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for downsample progress tests"})
+	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1, 1)
+
+	blocks := map[ulid.ULID]*metadata.Meta{}
+	for _, m := range []*metadata.Meta{
+		createBlockMeta(1, 0, downsample.ResLevel1DownsampleRange, map[string]string{"tenant_id": "a"}, downsample.ResLevel0, []uint64{1}),
+		createBlockMeta(2, 0, downsample.ResLevel1DownsampleRange, map[string]string{"tenant_id": "a"}, downsample.ResLevel0, []uint64{2}),
+		createBlockMeta(3, 0, downsample.ResLevel1DownsampleRange, map[string]string{"tenant_id": "b"}, downsample.ResLevel0, []uint64{3}),
+	} {
+		blocks[m.ULID] = m
+	}
+	groups, err := grouper.Groups(blocks)
+	testutil.Ok(t, err)
+	testutil.Ok(t, ds.ProgressCalculate(context.Background(), groups))
+
+	keyA := blocks[ulid.MustNew(1, nil)].Thanos.GroupKey()
+	keyB := blocks[ulid.MustNew(3, nil)].Thanos.GroupKey()
+	// Skipped blocks are reported separately from the blocks to be downsampled.
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(ds.NumberOfBlocksDownsampled.WithLabelValues(keyA)))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(ds.NumberOfBlocksSkipped.WithLabelValues(keyA, downsample.SkipReasonDisabled)))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(ds.NumberOfBlocksDownsampled.WithLabelValues(keyB)))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(ds.NumberOfBlocksSkipped.WithLabelValues(keyB, downsample.SkipReasonDisabled)))
+}
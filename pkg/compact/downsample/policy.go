@@ -0,0 +1,108 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+const (
+	// SkipReasonDisabled is the reason of the blocks not downsampled because their policy disables the downsampling
+	// to the next resolution.
+	SkipReasonDisabled = "disabled"
+	// SkipReasonTooRecent is the reason of the raw blocks not downsampled yet because their data is more recent than
+	// the minimum raw block age of their policy.
+	SkipReasonTooRecent = "too-recent"
+)
+
+// PolicyConfig is the downsampling policy of the blocks whose external labels match its matchers, e.g. the blocks of
+// a tenant.
+type PolicyConfig struct {
+	// Matchers select the blocks of the policy by their external labels, e.g. '{tenant_id="team-a"}'.
+	Matchers string `yaml:"matchers"`
+	// Disable5m disables the downsampling of raw blocks to 5m resolution, and so to 1h resolution too.
+	Disable5m bool `yaml:"disable_5m"`
+	// Disable1h disables the downsampling of 5m resolution blocks to 1h resolution.
+	Disable1h bool `yaml:"disable_1h"`
+	// MinRawBlockAge is the minimum age of the data of raw blocks, as of their max time, before they are downsampled.
+	MinRawBlockAge model.Duration `yaml:"min_raw_block_age"`
+}
+
+type policy struct {
+	PolicyConfig
+	matchers []*labels.Matcher
+}
+
+// Policies are the downsampling policies of the blocks of a bucket. The policy of a block is the first one matching
+// its external labels, blocks matching none are downsampled as usual. Nil Policies downsample all blocks.
+type Policies struct {
+	policies []policy
+	now      func() time.Time
+}
+
+// ParsePolicies parses the YAML list of downsampling policies.
+func ParsePolicies(content []byte) (*Policies, error) {
+	var configs []PolicyConfig
+	if err := yaml.UnmarshalStrict(content, &configs); err != nil {
+		return nil, errors.Wrap(err, "parse downsampling policies config")
+	}
+	p := &Policies{policies: make([]policy, 0, len(configs)), now: time.Now}
+	for i, c := range configs {
+		if c.Matchers == "" {
+			return nil, errors.Errorf("downsampling policy %d: no matchers", i)
+		}
+		ms, err := parser.ParseMetricSelector(c.Matchers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "downsampling policy %d: parse matchers %s", i, c.Matchers)
+		}
+		p.policies = append(p.policies, policy{PolicyConfig: c, matchers: ms})
+	}
+	return p, nil
+}
+
+// Skip returns the reason for which the downsampling of the block to the next resolution is skipped by its policy,
+// or an empty string if it is not.
+func (p *Policies) Skip(m *metadata.Meta) string {
+	if p == nil {
+		return ""
+	}
+	lset := labels.FromMap(m.Thanos.Labels)
+	for _, pol := range p.policies {
+		if !matches(pol.matchers, lset) {
+			continue
+		}
+		switch m.Thanos.Downsample.Resolution {
+		case ResLevel0:
+			if pol.Disable5m {
+				return SkipReasonDisabled
+			}
+			if pol.MinRawBlockAge > 0 && p.now().Sub(time.UnixMilli(m.MaxTime)) < time.Duration(pol.MinRawBlockAge) {
+				return SkipReasonTooRecent
+			}
+		case ResLevel1:
+			if pol.Disable1h {
+				return SkipReasonDisabled
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func matches(ms []*labels.Matcher, lset labels.Labels) bool {
+	for _, m := range ms {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPolicies(t *testing.T) {
+	p, err := ParsePolicies([]byte(`
+- matchers: '{tenant_id="team-a"}'
+  disable_5m: true
+- matchers: '{tenant_id=~"team-.*", region="eu"}'
+  disable_1h: true
+  min_raw_block_age: 2d
+`))
+	testutil.Ok(t, err)
+	now := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	meta := func(lset map[string]string, resolution int64, maxTime time.Time) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{MaxTime: maxTime.UnixMilli()},
+			Thanos:    metadata.Thanos{Labels: lset, Downsample: metadata.ThanosDownsample{Resolution: resolution}},
+		}
+	}
+	old, recent := now.Add(-72*time.Hour), now.Add(-24*time.Hour)
+	teamA := map[string]string{"tenant_id": "team-a", "region": "eu"}
+	teamB := map[string]string{"tenant_id": "team-b", "region": "eu"}
+	teamC := map[string]string{"tenant_id": "team-c", "region": "us"}
+
+	// The first matching policy applies.
+	testutil.Equals(t, SkipReasonDisabled, p.Skip(meta(teamA, ResLevel0, old)))
+	testutil.Equals(t, "", p.Skip(meta(teamA, ResLevel1, old)))
+
+	testutil.Equals(t, "", p.Skip(meta(teamB, ResLevel0, old)))
+	testutil.Equals(t, SkipReasonTooRecent, p.Skip(meta(teamB, ResLevel0, recent)))
+	testutil.Equals(t, SkipReasonDisabled, p.Skip(meta(teamB, ResLevel1, old)))
+
+	// Blocks matching no policy are downsampled as usual.
+	testutil.Equals(t, "", p.Skip(meta(teamC, ResLevel0, recent)))
+	testutil.Equals(t, "", p.Skip(meta(teamC, ResLevel1, old)))
+
+	var nilPolicies *Policies
+	testutil.Equals(t, "", nilPolicies.Skip(meta(teamA, ResLevel0, old)))
+
+	for _, conf := range []string{
+		`- disable_5m: true`,
+		`- {matchers: '{tenant_id='}`,
+		`- {matchers: '{tenant_id="a"}', min_raw_block_age: -1d}`,
+		`- {matchers: '{tenant_id="a"}', unknown: true}`,
+	} {
+		_, err := ParsePolicies([]byte(conf))
+		testutil.NotOk(t, err, conf)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"github.com/oklog/ulid"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Sources tracks which source blocks are already available in downsampled blocks of one resolution.
+// Blocks split by the compactor share their sources, so the shards of those are tracked as well.
+type Sources map[ulid.ULID][]*metadata.ThanosShard
+
+// Add records the sources of the given downsampled block.
+func (s Sources) Add(m *metadata.Meta) {
+	for _, id := range m.Compaction.Sources {
+		s[id] = append(s[id], m.Thanos.Shard)
+	}
+}
+
+// Covered returns true if the data of all sources of the given block is already available
+// in downsampled blocks, so there is no need to downsample it.
+func (s Sources) Covered(m *metadata.Meta) bool {
+SourcesLoop:
+	for _, id := range m.Compaction.Sources {
+		for _, shard := range s[id] {
+			if shard.Covers(m.Thanos.Shard) {
+				continue SourcesLoop
+			}
+		}
+		return false
+	}
+	return true
+}
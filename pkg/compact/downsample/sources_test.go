@@ -0,0 +1,41 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSources(t *testing.T) {
+	var (
+		src1 = ulid.MustNew(1, nil)
+		src2 = ulid.MustNew(2, nil)
+	)
+	meta := func(shard *metadata.ThanosShard, sources ...ulid.ULID) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{Compaction: tsdb.BlockMetaCompaction{Sources: sources}},
+			Thanos:    metadata.Thanos{Shard: shard},
+		}
+	}
+
+	s := Sources{}
+	testutil.Assert(t, !s.Covered(meta(nil, src1)))
+
+	s.Add(meta(&metadata.ThanosShard{Index: 0, Count: 2}, src1, src2))
+	testutil.Assert(t, s.Covered(meta(&metadata.ThanosShard{Index: 0, Count: 2}, src1)))
+	testutil.Assert(t, s.Covered(meta(&metadata.ThanosShard{Index: 2, Count: 4}, src1, src2)))
+	// Other shards of the same sources were not downsampled yet.
+	testutil.Assert(t, !s.Covered(meta(&metadata.ThanosShard{Index: 1, Count: 2}, src1, src2)))
+	testutil.Assert(t, !s.Covered(meta(nil, src1)))
+
+	s.Add(meta(nil, src1))
+	testutil.Assert(t, s.Covered(meta(&metadata.ThanosShard{Index: 1, Count: 2}, src1)))
+	testutil.Assert(t, !s.Covered(meta(&metadata.ThanosShard{Index: 1, Count: 2}, src1, src2)))
+}
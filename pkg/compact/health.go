@@ -0,0 +1,272 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// HealthDir is the known dir in the bucket of the compaction health objects of the compaction groups, named
+	// <group key>.json.
+	HealthDir = "debug/compaction-health"
+
+	// GroupHealthVersion1 is the version of the compaction health object supported by Thanos.
+	GroupHealthVersion1 = 1
+)
+
+// GroupHealth is the compaction health of a compaction group, written by the compactor after each compaction
+// iteration.
+type GroupHealth struct {
+	// Version of the file.
+	Version int `json:"version"`
+	// Group is the key of the compaction group.
+	Group string `json:"group"`
+	// Labels are the external labels of the blocks of the group.
+	Labels map[string]string `json:"labels"`
+	// Resolution is the resolution of the blocks of the group, in milliseconds.
+	Resolution int64 `json:"resolution"`
+
+	// UpdateTime is a unix timestamp of when the object was written.
+	UpdateTime int64 `json:"update_time"`
+	// Interval is the interval between compaction iterations of the compactor, in seconds. It is 0 if the compactor
+	// runs a single iteration.
+	Interval int64 `json:"interval,omitempty"`
+	// LastSuccessfulCompactionTime is a unix timestamp of when blocks of the group were last compacted successfully.
+	// It is 0 if they never were.
+	LastSuccessfulCompactionTime int64 `json:"last_successful_compaction_time,omitempty"`
+	// PendingBlocks is the number of blocks of the group which were not compacted yet.
+	PendingBlocks int `json:"pending_blocks"`
+	// OldestUncompactedBlockAge is the age of the oldest block of the group which was not compacted yet, in seconds.
+	OldestUncompactedBlockAge int64 `json:"oldest_uncompacted_block_age,omitempty"`
+	// Halted is true if the compaction of the group failed with an error halting the compactor.
+	Halted bool `json:"halted,omitempty"`
+	// Error is the error the last compaction of the group failed with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Stale returns true if the object was not updated for more than the given number of compaction iterations of the
+// compactor which wrote it, meaning that the compactor is not running or does not compact the group anymore.
+// Objects written by compactors running a single iteration are never stale.
+func (h *GroupHealth) Stale(now time.Time, iterations int) bool {
+	if h.Interval <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(h.UpdateTime, 0)) > time.Duration(int64(iterations)*h.Interval)*time.Second
+}
+
+// HealthPath returns the path of the compaction health object of the group with the given key.
+func HealthPath(groupKey string) string {
+	return path.Join(HealthDir, groupKey+".json")
+}
+
+// ReadGroupHealth reads the compaction health object of the group with the given key. It returns nil if there is none.
+func ReadGroupHealth(ctx context.Context, bkt objstore.BucketReader, groupKey string) (*GroupHealth, error) {
+	return readGroupHealth(ctx, bkt, HealthPath(groupKey))
+}
+
+// ReadHealth reads all compaction health objects of the bucket, sorted by group key.
+func ReadHealth(ctx context.Context, bkt objstore.BucketReader) ([]*GroupHealth, error) {
+	var res []*GroupHealth
+	if err := bkt.Iter(ctx, HealthDir, func(name string) error {
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		h, err := readGroupHealth(ctx, bkt, name)
+		if err != nil {
+			return err
+		}
+		if h != nil {
+			res = append(res, h)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "iter compaction health objects")
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Group < res[j].Group })
+	return res, nil
+}
+
+func readGroupHealth(ctx context.Context, bkt objstore.BucketReader, name string) (_ *GroupHealth, err error) {
+	r, err := bkt.Get(ctx, name)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get compaction health object %s", name)
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close compaction health object reader")
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read compaction health object %s", name)
+	}
+	h := &GroupHealth{}
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal compaction health object %s", name)
+	}
+	if h.Version != GroupHealthVersion1 {
+		return nil, errors.Errorf("unexpected compaction health object %s version %d, expected %d", name, h.Version, GroupHealthVersion1)
+	}
+	return h, nil
+}
+
+// HealthReporter tracks the compaction health of the compaction groups and writes it to the bucket.
+type HealthReporter struct {
+	logger   log.Logger
+	bkt      objstore.Bucket
+	interval time.Duration
+	now      func() time.Time
+
+	mtx    sync.Mutex
+	groups map[string]*GroupHealth
+}
+
+// NewHealthReporter returns a HealthReporter for a compactor running an iteration every interval, 0 if it runs a
+// single iteration.
+func NewHealthReporter(logger log.Logger, bkt objstore.Bucket, interval time.Duration) *HealthReporter {
+	return &HealthReporter{
+		logger:   logger,
+		bkt:      bkt,
+		interval: interval,
+		now:      time.Now,
+		groups:   map[string]*GroupHealth{},
+	}
+}
+
+// observe starts the compaction iteration of the given groups, updating their pending blocks. The compaction health
+// of groups seen for the first time is read from the bucket, to not lose their last successful compaction time.
+func (r *HealthReporter) observe(ctx context.Context, groups []*Group) {
+	if r == nil {
+		return
+	}
+	now := r.now()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	seen := make(map[string]*GroupHealth, len(groups))
+	for _, g := range groups {
+		h, ok := r.groups[g.Key()]
+		if !ok {
+			var err error
+			if h, err = ReadGroupHealth(ctx, r.bkt, g.Key()); err != nil {
+				level.Warn(r.logger).Log("msg", "failed to read compaction health of group", "group", g.Key(), "err", err)
+			}
+			if h == nil {
+				h = &GroupHealth{}
+			}
+		}
+		h.Version = GroupHealthVersion1
+		h.Group = g.Key()
+		h.Labels = g.Labels().Map()
+		h.Resolution = g.Resolution()
+		h.Halted = false
+		h.Error = ""
+
+		h.PendingBlocks = 0
+		h.OldestUncompactedBlockAge = 0
+		var oldest *ulid.ULID
+		for _, m := range g.metasByMinTime {
+			if m.Compaction.Level > 1 {
+				continue
+			}
+			h.PendingBlocks++
+			if oldest == nil || m.ULID.Time() < oldest.Time() {
+				oldest = &m.ULID
+			}
+		}
+		if oldest != nil {
+			h.OldestUncompactedBlockAge = int64(now.Sub(ulid.Time(oldest.Time())) / time.Second)
+		}
+		seen[g.Key()] = h
+	}
+	// Groups without blocks anymore are not reported.
+	r.groups = seen
+}
+
+// compacted records a successful compaction run of the group. compID is the ID of the compacted block, if any.
+func (r *HealthReporter) compacted(g *Group, compID ulid.ULID) {
+	if r == nil || compID == (ulid.ULID{}) {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if h, ok := r.groups[g.Key()]; ok {
+		h.LastSuccessfulCompactionTime = r.now().Unix()
+	}
+}
+
+// failed records a failed compaction run of the group.
+func (r *HealthReporter) failed(g *Group, err error) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if h, ok := r.groups[g.Key()]; ok {
+		h.Halted = IsHaltError(err)
+		h.Error = err.Error()
+	}
+}
+
+// write writes the compaction health of the groups of the last compaction iteration to the bucket. Failures are
+// only logged, to not fail compactions because of their reporting.
+func (r *HealthReporter) write(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := r.now().Unix()
+	for key, h := range r.groups {
+		h.UpdateTime = now
+		h.Interval = int64(r.interval / time.Second)
+
+		b, err := json.Marshal(h)
+		if err != nil {
+			level.Warn(r.logger).Log("msg", "failed to marshal compaction health of group", "group", key, "err", err)
+			continue
+		}
+		if err := r.bkt.Upload(ctx, HealthPath(key), bytes.NewReader(b)); err != nil {
+			level.Warn(r.logger).Log("msg", "failed to write compaction health of group", "group", key, "err", err)
+		}
+	}
+}
+
+// GroupHealthStatus is the compaction health of a compaction group, along with whether it is stale.
+type GroupHealthStatus struct {
+	GroupHealth
+	// Stale is true if the compaction health was not updated for more than the expected number of iterations.
+	Stale bool `json:"stale"`
+}
+
+// HealthStatus returns the status of the given compaction health objects at the given time, flagging the ones not
+// updated for more than staleIterations compaction iterations as stale.
+func HealthStatus(healths []*GroupHealth, now time.Time, staleIterations int) []GroupHealthStatus {
+	res := make([]GroupHealthStatus, 0, len(healths))
+	for _, h := range healths {
+		res = append(res, GroupHealthStatus{GroupHealth: *h, Stale: h.Stale(now, staleIterations)})
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestHealthReporter(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	t0 := time.Unix(1600000000, 0)
+	now := t0
+
+	newReporter := func() *HealthReporter {
+		r := NewHealthReporter(log.NewNopLogger(), bkt, 5*time.Minute)
+		r.now = func() time.Time { return now }
+		return r
+	}
+	meta := func(created time.Time, level int) *metadata.Meta {
+		id := ulid.MustNew(ulid.Timestamp(created), nil)
+		return &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id, Compaction: tsdb.BlockMetaCompaction{Level: level}}}
+	}
+	eu := &Group{key: "0@1", labels: labels.FromStrings("cluster", "eu"), metasByMinTime: []*metadata.Meta{
+		meta(t0.Add(-2*time.Hour), 1),
+		meta(t0.Add(-3*time.Hour), 1),
+		meta(t0.Add(-10*time.Hour), 2),
+	}}
+	us := &Group{key: "300000@2", labels: labels.FromStrings("cluster", "us"), resolution: 300000, metasByMinTime: []*metadata.Meta{
+		meta(t0.Add(-10*time.Hour), 2),
+		meta(t0.Add(-20*time.Hour), 3),
+	}}
+
+	r := newReporter()
+	r.observe(ctx, []*Group{eu, us})
+	r.compacted(eu, ulid.MustNew(1, nil))
+	r.failed(us, errors.Wrap(halt(errors.New("overlapping blocks")), "compact"))
+	r.write(ctx)
+
+	healths, err := ReadHealth(ctx, bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*GroupHealth{
+		{
+			Version:                      GroupHealthVersion1,
+			Group:                        "0@1",
+			Labels:                       map[string]string{"cluster": "eu"},
+			UpdateTime:                   t0.Unix(),
+			Interval:                     300,
+			LastSuccessfulCompactionTime: t0.Unix(),
+			PendingBlocks:                2,
+			OldestUncompactedBlockAge:    int64((3 * time.Hour).Seconds()),
+		},
+		{
+			Version:    GroupHealthVersion1,
+			Group:      "300000@2",
+			Labels:     map[string]string{"cluster": "us"},
+			Resolution: 300000,
+			UpdateTime: t0.Unix(),
+			Interval:   300,
+			Halted:     true,
+			Error:      "compact: overlapping blocks",
+		},
+	}, healths)
+
+	// A restarted compactor keeps the last successful compaction time, and clears errors of groups not failing anymore.
+	now = t0.Add(5 * time.Minute)
+	r = newReporter()
+	r.observe(ctx, []*Group{eu, us})
+	r.compacted(us, ulid.ULID{})
+	r.write(ctx)
+
+	h, err := ReadGroupHealth(ctx, bkt, eu.Key())
+	testutil.Ok(t, err)
+	testutil.Equals(t, t0.Unix(), h.LastSuccessfulCompactionTime)
+	testutil.Equals(t, now.Unix(), h.UpdateTime)
+	h, err = ReadGroupHealth(ctx, bkt, us.Key())
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), h.LastSuccessfulCompactionTime)
+	testutil.Assert(t, !h.Halted)
+	testutil.Equals(t, "", h.Error)
+
+	h, err = ReadGroupHealth(ctx, bkt, "0@3")
+	testutil.Ok(t, err)
+	testutil.Assert(t, h == nil)
+}
+
+func TestGroupHealth_Stale(t *testing.T) {
+	t0 := time.Unix(1600000000, 0)
+	h := &GroupHealth{UpdateTime: t0.Unix(), Interval: 300}
+
+	testutil.Assert(t, !h.Stale(t0.Add(15*time.Minute), 3))
+	testutil.Assert(t, h.Stale(t0.Add(16*time.Minute), 3))
+	testutil.Assert(t, h.Stale(t0.Add(6*time.Minute), 1))
+
+	// Compactors running a single iteration can't tell when the next one is due.
+	h.Interval = 0
+	testutil.Assert(t, !h.Stale(t0.Add(24*time.Hour), 3))
+
+	status := HealthStatus([]*GroupHealth{{UpdateTime: t0.Unix(), Interval: 300}}, t0.Add(time.Hour), 3)
+	testutil.Equals(t, 1, len(status))
+	testutil.Assert(t, status[0].Stale)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/extprom"
+)
+
+var _ block.MetadataFilter = &MetaVersionFilter{}
+
+// MetaVersionFilter is a block.Fetcher filter guarding the compactor against the blocks whose meta was written by a
+// newer version of Thanos, which it could compact, downsample or delete without knowing the meaning of their meta. It
+// halts the compactor on such blocks, or excludes them if configured to skip them.
+type MetaVersionFilter struct {
+	logger log.Logger
+	skip   bool
+}
+
+// NewMetaVersionFilter creates a MetaVersionFilter excluding the blocks with a newer meta version if skip is true, and
+// halting otherwise.
+func NewMetaVersionFilter(logger log.Logger, skip bool) *MetaVersionFilter {
+	return &MetaVersionFilter{logger: logger, skip: skip}
+}
+
+// Filter filters out the blocks whose meta was written by a newer version of Thanos, or returns a halt error if there
+// are some and they are not skipped.
+func (f *MetaVersionFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, _ *extprom.TxGaugeVec) error {
+	var newer []ulid.ULID
+	for id, m := range metas {
+		if m.Thanos.NewerVersion() {
+			newer = append(newer, id)
+		}
+	}
+	if len(newer) == 0 {
+		return nil
+	}
+	sort.Slice(newer, func(i, j int) bool { return newer[i].Compare(newer[j]) < 0 })
+
+	if !f.skip {
+		return halt(errors.Errorf("block %s has meta version %d, newer than the version %d supported by this compactor; upgrade the compactor or skip these blocks with --compact.skip-newer-meta-versions (%d blocks)",
+			newer[0], metas[newer[0]].Thanos.Version, metadata.ThanosVersion1, len(newer)))
+	}
+	for _, id := range newer {
+		level.Warn(f.logger).Log("msg", "skipping block with newer meta version", "block", id, "version", metas[id].Thanos.Version)
+		synced.WithLabelValues(block.NewerMetaVersionMeta).Inc()
+		delete(metas, id)
+	}
+	return nil
+}
+
+// sharedUnknownFields returns the unknown fields of the Thanos section of the metas set to the same value in all of
+// them, and the names of the other unknown fields.
+func sharedUnknownFields(metas []*metadata.Meta) (shared map[string]json.RawMessage, dropped []string) {
+	if len(metas) == 0 {
+		return nil, nil
+	}
+	names := map[string]struct{}{}
+	for _, m := range metas {
+		for name := range m.Thanos.Unknown {
+			names[name] = struct{}{}
+		}
+	}
+	for name := range names {
+		v, ok := metas[0].Thanos.Unknown[name]
+		for _, m := range metas[1:] {
+			if !ok {
+				break
+			}
+			var o json.RawMessage
+			o, ok = m.Thanos.Unknown[name]
+			ok = ok && bytes.Equal(v, o)
+		}
+		if !ok {
+			dropped = append(dropped, name)
+			continue
+		}
+		if shared == nil {
+			shared = make(map[string]json.RawMessage)
+		}
+		shared[name] = v
+	}
+	sort.Strings(dropped)
+	return shared, dropped
+}
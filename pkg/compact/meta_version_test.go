@@ -0,0 +1,76 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMetaVersionFilter(t *testing.T) {
+	newMetas := func() map[ulid.ULID]*metadata.Meta {
+		metas := map[ulid.ULID]*metadata.Meta{}
+		for i, version := range []int{0, metadata.ThanosVersion1, metadata.ThanosVersion1 + 1} {
+			id := ulid.MustNew(uint64(i), nil)
+			metas[id] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id}, Thanos: metadata.Thanos{Version: version}}
+		}
+		return metas
+	}
+
+	t.Run("halt", func(t *testing.T) {
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"})
+		metas := newMetas()
+		err := NewMetaVersionFilter(log.NewNopLogger(), false).Filter(context.Background(), metas, synced, nil)
+		testutil.NotOk(t, err)
+		testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+		testutil.Equals(t, 3, len(metas))
+	})
+	t.Run("skip", func(t *testing.T) {
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"})
+		metas := newMetas()
+		testutil.Ok(t, NewMetaVersionFilter(log.NewNopLogger(), true).Filter(context.Background(), metas, synced, nil))
+		testutil.Equals(t, 2, len(metas))
+		_, ok := metas[ulid.MustNew(2, nil)]
+		testutil.Assert(t, !ok, "block with newer meta version must be skipped")
+		synced.Submit()
+		testutil.Equals(t, 1.0, promtest.ToFloat64(synced.WithLabelValues(block.NewerMetaVersionMeta)))
+	})
+}
+
+func TestSharedUnknownFields(t *testing.T) {
+	meta := func(fields map[string]string) *metadata.Meta {
+		m := &metadata.Meta{}
+		for name, v := range fields {
+			if m.Thanos.Unknown == nil {
+				m.Thanos.Unknown = map[string]json.RawMessage{}
+			}
+			m.Thanos.Unknown[name] = json.RawMessage(v)
+		}
+		return m
+	}
+
+	shared, dropped := sharedUnknownFields(nil)
+	testutil.Equals(t, 0, len(shared))
+	testutil.Equals(t, 0, len(dropped))
+
+	shared, dropped = sharedUnknownFields([]*metadata.Meta{
+		meta(map[string]string{"ext": `{"a":1}`, "differing": `1`, "partial": `true`}),
+		meta(map[string]string{"ext": `{"a":1}`, "differing": `2`}),
+		meta(map[string]string{"ext": `{"a":1}`, "differing": `1`, "partial": `true`}),
+	})
+	testutil.Equals(t, map[string]json.RawMessage{"ext": json.RawMessage(`{"a":1}`)}, shared)
+	testutil.Equals(t, []string{"differing", "partial"}, dropped)
+}
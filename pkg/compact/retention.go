@@ -6,17 +6,21 @@ package compact
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/objstore"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
 // ApplyRetentionPolicyByResolution removes blocks depending on the specified retentionByResolution based on blocks MaxTime.
@@ -28,18 +32,17 @@ func ApplyRetentionPolicyByResolution(
 	metas map[ulid.ULID]*metadata.Meta,
 	retentionByResolution map[ResolutionLevel]time.Duration,
 	blocksMarkedForDeletion prometheus.Counter,
+	deletionMarkOpts ...block.DeletionMarkOption,
 ) error {
 	level.Info(logger).Log("msg", "start optional retention")
 	for id, m := range metas {
 		retentionDuration := retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
-		if retentionDuration.Seconds() == 0 {
-			continue
-		}
-
-		maxTime := time.Unix(m.MaxTime/1000, 0)
-		if time.Now().After(maxTime.Add(retentionDuration)) {
+		if exceedsRetention(m, retentionDuration, time.Now()) {
+			maxTime := time.Unix(m.MaxTime/1000, 0)
 			level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", id, "maxTime", maxTime.String())
-			if err := block.MarkForDeletion(ctx, logger, bkt, id, fmt.Sprintf("block exceeding retention of %v", retentionDuration), blocksMarkedForDeletion); err != nil {
+			if err := tracing.DoInSpanWithErr(ctx, "retention_block_delete", func(ctx context.Context) error {
+				return block.MarkForDeletion(ctx, logger, bkt, id, metadata.RetentionDeletionReason, fmt.Sprintf("block exceeding retention of %v", retentionDuration), blocksMarkedForDeletion, withCompactionGroup(deletionMarkOpts, m.Thanos.GroupKey())...)
+			}, opentracing.Tags{"block.id": id, "block.resolution": m.Thanos.Downsample.Resolution, "retention": retentionDuration.String()}); err != nil {
 				return errors.Wrap(err, "delete block")
 			}
 		}
@@ -47,3 +50,55 @@ func ApplyRetentionPolicyByResolution(
 	level.Info(logger).Log("msg", "optional retention apply done")
 	return nil
 }
+
+// BlocksExceedingRetention returns the blocks which ApplyRetentionPolicyByResolution would mark for deletion at the
+// given time, sorted by their min time.
+func BlocksExceedingRetention(metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[ResolutionLevel]time.Duration, now time.Time) []*metadata.Meta {
+	var exceeding []*metadata.Meta
+	for _, m := range metas {
+		if exceedsRetention(m, retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)], now) {
+			exceeding = append(exceeding, m)
+		}
+	}
+	sort.Slice(exceeding, func(i, j int) bool {
+		if exceeding[i].MinTime == exceeding[j].MinTime {
+			return exceeding[i].ULID.Compare(exceeding[j].ULID) < 0
+		}
+		return exceeding[i].MinTime < exceeding[j].MinTime
+	})
+	return exceeding
+}
+
+// RawBlocksWithoutDownsampled returns the raw blocks of deleted whose data is not available in any downsampled block
+// of metas which is not deleted as well.
+func RawBlocksWithoutDownsampled(metas map[ulid.ULID]*metadata.Meta, deleted []*metadata.Meta) []*metadata.Meta {
+	deletedIDs := make(map[ulid.ULID]struct{}, len(deleted))
+	for _, m := range deleted {
+		deletedIDs[m.ULID] = struct{}{}
+	}
+	// The 1h resolution blocks are downsampled from 5m ones, so they have the same raw sources.
+	sources := downsample.Sources{}
+	for id, m := range metas {
+		if _, ok := deletedIDs[id]; ok || m.Thanos.Downsample.Resolution == downsample.ResLevel0 {
+			continue
+		}
+		sources.Add(m)
+	}
+
+	var without []*metadata.Meta
+	for _, m := range deleted {
+		if m.Thanos.Downsample.Resolution == downsample.ResLevel0 && !sources.Covered(m) {
+			without = append(without, m)
+		}
+	}
+	return without
+}
+
+// exceedsRetention returns true if the max time of the block is older than the retention at the given time.
+// A retention of 0 is never exceeded.
+func exceedsRetention(m *metadata.Meta, retention time.Duration, now time.Time) bool {
+	if retention.Seconds() == 0 {
+		return false
+	}
+	return now.After(time.Unix(m.MaxTime/1000, 0).Add(retention))
+}
@@ -268,6 +268,9 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 					got = append(got, name)
 					return nil
 				}
+				m := &metadata.DeletionMark{}
+				testutil.Ok(t, metadata.ReadMarker(ctx, logger, bkt, name, m))
+				testutil.Equals(t, metadata.RetentionDeletionReason, m.Reason)
 				gotMarkedBlocksCount += 1.0
 				return nil
 			}))
@@ -278,6 +281,46 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 	}
 }
 
+func TestBlocksExceedingRetention(t *testing.T) {
+	now := time.Now()
+	newMeta := func(id string, age time.Duration, resolution compact.ResolutionLevel, sources ...string) *metadata.Meta {
+		m := &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustParse(id),
+				MinTime: now.Add(-age-2*time.Hour).Unix() * 1000,
+				MaxTime: now.Add(-age).Unix() * 1000,
+			},
+			Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: int64(resolution)}},
+		}
+		for _, s := range sources {
+			m.Compaction.Sources = append(m.Compaction.Sources, ulid.MustParse(s))
+		}
+		return m
+	}
+	var (
+		oldRaw        = newMeta("01CPHBEX20729MJQZXE3W0BW48", 10*24*time.Hour, compact.ResolutionLevelRaw, "01CPHBEX20729MJQZXE3W0BW48")
+		oldRawNoDown  = newMeta("01CPHBEX20729MJQZXE3W0BW49", 9*24*time.Hour, compact.ResolutionLevelRaw, "01CPHBEX20729MJQZXE3W0BW49")
+		newRaw        = newMeta("01CPHBEX20729MJQZXE3W0BW50", time.Hour, compact.ResolutionLevelRaw, "01CPHBEX20729MJQZXE3W0BW50")
+		oldDown5m     = newMeta("01CPHBEX20729MJQZXE3W0BW51", 10*24*time.Hour, compact.ResolutionLevel5m, "01CPHBEX20729MJQZXE3W0BW48")
+		oldestDown5m  = newMeta("01CPHBEX20729MJQZXE3W0BW52", 40*24*time.Hour, compact.ResolutionLevel5m, "01CPHBEX20729MJQZXE3W0BW53")
+		oldestRaw     = newMeta("01CPHBEX20729MJQZXE3W0BW53", 40*24*time.Hour, compact.ResolutionLevelRaw, "01CPHBEX20729MJQZXE3W0BW53")
+		retentionConf = map[compact.ResolutionLevel]time.Duration{
+			compact.ResolutionLevelRaw: 7 * 24 * time.Hour,
+			compact.ResolutionLevel5m:  30 * 24 * time.Hour,
+		}
+	)
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for _, m := range []*metadata.Meta{oldRaw, oldRawNoDown, newRaw, oldDown5m, oldestDown5m, oldestRaw} {
+		metas[m.ULID] = m
+	}
+
+	exceeding := compact.BlocksExceedingRetention(metas, retentionConf, now)
+	testutil.Equals(t, []*metadata.Meta{oldestDown5m, oldestRaw, oldRaw, oldRawNoDown}, exceeding)
+
+	// The downsampled data of the oldest raw block is deleted as well.
+	testutil.Equals(t, []*metadata.Meta{oldestRaw, oldRawNoDown}, compact.RawBlocksWithoutDownsampled(metas, exceeding))
+}
+
 func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64) {
 	t.Helper()
 	meta1 := metadata.Meta{
@@ -0,0 +1,207 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/compactv2"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// BlockSplitLimits are the limits for a block resulting from compaction. When the projected compacted block
+// exceeds any of them, its series are split by hash into multiple blocks, each recording its shard in meta.json.
+// Zero disables the respective limit.
+type BlockSplitLimits struct {
+	// MaxIndexSizeBytes is the maximum index size of a compacted block.
+	MaxIndexSizeBytes int64
+	// MaxSeries is the maximum number of series of a compacted block.
+	MaxSeries uint64
+}
+
+// shardCount returns into how many blocks the compacted block of the given blocks has to be split to stay within the limits.
+// NOTE: The projection is the worst case of blocks sharing no series, thus summing index sizes and series of all blocks.
+func (l BlockSplitLimits) shardCount(metas []*metadata.Meta, blockDirs []string) (uint64, error) {
+	count := uint64(1)
+	if l.MaxSeries > 0 {
+		var series uint64
+		for _, m := range metas {
+			series += m.Stats.NumSeries
+		}
+		count = maxUint64(count, ceilDiv(series, l.MaxSeries))
+	}
+	if l.MaxIndexSizeBytes > 0 {
+		var indexSize int64
+		for _, bdir := range blockDirs {
+			fi, err := os.Stat(filepath.Join(bdir, block.IndexFilename))
+			if err != nil {
+				return 0, errors.Wrapf(err, "stat index of block %s", bdir)
+			}
+			indexSize += fi.Size()
+		}
+		count = maxUint64(count, ceilDiv(uint64(indexSize), uint64(l.MaxIndexSizeBytes)))
+	}
+	return count, nil
+}
+
+func ceilDiv(a, b uint64) uint64 {
+	return (a + b - 1) / b
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// childShards returns the shards the series of the given shard are split into. Series of a shard
+// only hash into its children, so already split blocks can be split further.
+func childShards(parent *metadata.ThanosShard, count uint64) []*metadata.ThanosShard {
+	if parent == nil {
+		parent = &metadata.ThanosShard{Index: 0, Count: 1}
+	}
+	shards := make([]*metadata.ThanosShard, 0, count)
+	for i := uint64(0); i < count; i++ {
+		shards = append(shards, &metadata.ThanosShard{Index: parent.Index + parent.Count*i, Count: parent.Count * count})
+	}
+	return shards
+}
+
+// compactionOutput is a block resulting from compaction of a group.
+type compactionOutput struct {
+	id    ulid.ULID
+	dir   string
+	shard *metadata.ThanosShard
+}
+
+// compactShards compacts the given blocks into a block for each of the given shards. Series of each block are
+// split into the shards first, then the parts of each shard are compacted as usual, so no compacted block ever
+// exceeds the split limits. Shards without any samples result in empty blocks, so the blocks of all shards
+// together always replace the given blocks.
+func (cg *Group) compactShards(ctx context.Context, dir string, blockDirs []string, shards []*metadata.ThanosShard, comp Compactor) ([]compactionOutput, error) {
+	pool := downsample.NewPool()
+	blocks := make([]*tsdb.Block, 0, len(blockDirs))
+	defer func() {
+		for _, b := range blocks {
+			runutil.CloseWithLogOnErr(cg.logger, b, "close block %s", b.Meta().ULID)
+		}
+	}()
+	for _, bdir := range blockDirs {
+		b, err := tsdb.OpenBlock(cg.logger, bdir, pool)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open block %s", bdir)
+		}
+		blocks = append(blocks, b)
+	}
+
+	var outputs []compactionOutput
+	for _, shard := range shards {
+		shardDir := filepath.Join(dir, "shard-"+shard.String())
+		partDirs, err := splitBlocks(ctx, cg.logger, shardDir, blocks, pool, *shard)
+		if err != nil {
+			return nil, errors.Wrapf(err, "split blocks into shard %v", shard)
+		}
+
+		id, err := comp.Compact(shardDir, partDirs, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compact shard %v", shard)
+		}
+		if id == (ulid.ULID{}) {
+			level.Info(cg.logger).Log("msg", "compacted shard would have no samples, writing empty block", "shard", shard)
+			if id, err = writeEmptyBlock(ctx, cg.logger, shardDir, partDirs); err != nil {
+				return nil, errors.Wrapf(err, "write empty block of shard %v", shard)
+			}
+		}
+		outputs = append(outputs, compactionOutput{id: id, dir: filepath.Join(shardDir, id.String()), shard: shard})
+	}
+	return outputs, nil
+}
+
+// splitBlocks writes the series of the given blocks belonging to the given shard into blocks with the same
+// IDs and compaction metadata in dir, so they can be compacted like the original ones. It returns their directories.
+// The pool has to be the one the blocks were opened with.
+func splitBlocks(ctx context.Context, logger log.Logger, dir string, blocks []*tsdb.Block, pool chunkenc.Pool, shard metadata.ThanosShard) ([]string, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, errors.Wrap(err, "remove shard dir")
+	}
+
+	comp := compactv2.New(dir, logger, compactv2.NewChangeLog(ioutil.Discard), pool)
+	partDirs := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		meta, err := metadata.ReadFromDir(b.Dir())
+		if err != nil {
+			return nil, errors.Wrapf(err, "read meta of %s", b.Dir())
+		}
+
+		partDir := filepath.Join(dir, meta.ULID.String())
+		if err := os.MkdirAll(partDir, 0750); err != nil {
+			return nil, errors.Wrap(err, "create part dir")
+		}
+		d, err := block.NewDiskWriter(ctx, logger, partDir)
+		if err != nil {
+			return nil, err
+		}
+		p := compactv2.NewProgressLogger(log.With(logger, "block", meta.ULID, "shard", shard.String()), int(meta.Stats.NumSeries))
+		if err := comp.WriteSeries(ctx, []block.Reader{b}, d, p, compactv2.WithShardModifier(shard)); err != nil {
+			return nil, errors.Wrapf(err, "write series of %s", meta.ULID)
+		}
+		if meta.Stats, err = d.Flush(); err != nil {
+			return nil, errors.Wrapf(err, "flush %s", partDir)
+		}
+		if err := meta.WriteToDir(logger, partDir); err != nil {
+			return nil, errors.Wrapf(err, "write meta of %s", partDir)
+		}
+		partDirs = append(partDirs, partDir)
+	}
+	return partDirs, nil
+}
+
+// writeEmptyBlock writes a block without any series into dir, as if it was compacted from the given blocks.
+func writeEmptyBlock(ctx context.Context, logger log.Logger, dir string, blockDirs []string) (ulid.ULID, error) {
+	metas := make([]*tsdb.BlockMeta, 0, len(blockDirs))
+	for _, bdir := range blockDirs {
+		m, err := metadata.ReadFromDir(bdir)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "read meta of %s", bdir)
+		}
+		metas = append(metas, &m.BlockMeta)
+	}
+	newMeta := &metadata.Meta{BlockMeta: *tsdb.CompactBlockMetas(ulid.MustNew(ulid.Now(), rand.Reader), metas...)}
+	newMeta.Version = metadata.TSDBVersion1
+
+	bdir := filepath.Join(dir, newMeta.ULID.String())
+	if err := os.MkdirAll(bdir, 0750); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create block dir")
+	}
+	d, err := block.NewDiskWriter(ctx, logger, bdir)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	if newMeta.Stats, err = d.Flush(); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "flush %s", bdir)
+	}
+	if _, err := tombstones.WriteFile(logger, bdir, tombstones.NewMemTombstones()); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write tombstones")
+	}
+	if err := newMeta.WriteToDir(logger, bdir); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "write meta of %s", bdir)
+	}
+	return newMeta.ULID, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// BlocksToRelocate returns the blocks whose max time is older than minAge at the given time and which are not marked
+// for deletion, sorted by their min time.
+func BlocksToRelocate(metas map[ulid.ULID]*metadata.Meta, deletionMarks map[ulid.ULID]*metadata.DeletionMark, minAge time.Duration, now time.Time) []*metadata.Meta {
+	var relocate []*metadata.Meta
+	for id, m := range metas {
+		if _, ok := deletionMarks[id]; ok {
+			continue
+		}
+		if now.Sub(time.Unix(m.MaxTime/1000, 0)) > minAge {
+			relocate = append(relocate, m)
+		}
+	}
+	sort.Slice(relocate, func(i, j int) bool {
+		if relocate[i].MinTime == relocate[j].MinTime {
+			return relocate[i].ULID.Compare(relocate[j].ULID) < 0
+		}
+		return relocate[i].MinTime < relocate[j].MinTime
+	})
+	return relocate
+}
+
+// RelocateToColdTier copies the blocks returned by BlocksToRelocate to the cold bucket, with the cold tier in their
+// meta.json, and marks them for deletion in the bucket once their copy is verified. Store gateways stop serving the
+// originals once they serve their copy. Blocks already copied by a previous call which failed to mark them are not copied
+// again. With dryRun, the blocks are only logged.
+func RelocateToColdTier(
+	ctx context.Context,
+	logger log.Logger,
+	bkt, coldBkt objstore.Bucket,
+	metas map[ulid.ULID]*metadata.Meta,
+	deletionMarks map[ulid.ULID]*metadata.DeletionMark,
+	minAge time.Duration,
+	dryRun bool,
+	blocksRelocated prometheus.Counter,
+	blocksMarkedForDeletion prometheus.Counter,
+	deletionMarkOpts ...block.DeletionMarkOption,
+) error {
+	level.Info(logger).Log("msg", "start relocation of blocks to cold tier")
+	for _, m := range BlocksToRelocate(metas, deletionMarks, minAge, time.Now()) {
+		if dryRun {
+			level.Info(logger).Log("msg", "dry run: block would be relocated to cold tier", "id", m.ULID, "minTime", time.Unix(m.MinTime/1000, 0).String(), "maxTime", time.Unix(m.MaxTime/1000, 0).String())
+			continue
+		}
+		if err := tracing.DoInSpanWithErr(ctx, "tiering_block_relocate", func(ctx context.Context) error {
+			return relocateBlock(ctx, logger, bkt, coldBkt, m, blocksMarkedForDeletion, deletionMarkOpts)
+		}, opentracing.Tags{"block.id": m.ULID}); err != nil {
+			return errors.Wrapf(err, "relocate block %s", m.ULID)
+		}
+		blocksRelocated.Inc()
+	}
+	level.Info(logger).Log("msg", "relocation of blocks to cold tier done")
+	return nil
+}
+
+func relocateBlock(ctx context.Context, logger log.Logger, bkt, coldBkt objstore.Bucket, m *metadata.Meta, blocksMarkedForDeletion prometheus.Counter, deletionMarkOpts []block.DeletionMarkOption) error {
+	copied, err := coldBkt.Exists(ctx, path.Join(m.ULID.String(), block.MetaFilename))
+	if err != nil {
+		return errors.Wrap(err, "check block in cold bucket")
+	}
+	if !copied {
+		level.Info(logger).Log("msg", "copying block to cold tier", "id", m.ULID)
+		if err := block.Copy(ctx, logger, bkt, coldBkt, m.ULID, func(m *metadata.Meta) {
+			m.Thanos.Tier = metadata.ColdTier
+		}); err != nil {
+			return errors.Wrap(err, "copy block to cold bucket")
+		}
+	}
+	return block.MarkForDeletion(ctx, logger, bkt, m.ULID, metadata.RelocatedDeletionReason, "block relocated to cold tier", blocksMarkedForDeletion, withCompactionGroup(deletionMarkOpts, m.Thanos.GroupKey())...)
+}
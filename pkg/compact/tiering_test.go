@@ -0,0 +1,105 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact_test
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestBlocksToRelocate(t *testing.T) {
+	now := time.Now()
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i, maxTime := range []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-30 * time.Minute), now.Add(-4 * time.Hour)} {
+		m := &metadata.Meta{}
+		m.ULID = ulid.MustNew(uint64(i+1), nil)
+		m.MinTime = maxTime.Add(-time.Hour).Unix() * 1000
+		m.MaxTime = maxTime.Unix() * 1000
+		metas[m.ULID] = m
+	}
+	marks := map[ulid.ULID]*metadata.DeletionMark{ulid.MustNew(1, nil): {}}
+
+	var ids []ulid.ULID
+	for _, m := range compact.BlocksToRelocate(metas, marks, time.Hour, now) {
+		ids = append(ids, m.ULID)
+	}
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(4, nil), ulid.MustNew(2, nil)}, ids)
+}
+
+func TestRelocateToColdTier(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	coldBkt := objstore.NewInMemBucket()
+
+	dir := t.TempDir()
+	old, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 10, 0, 1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	recent, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 10, time.Now().Add(-time.Minute).Unix()*1000, time.Now().Unix()*1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	for _, id := range []ulid.ULID{old, recent} {
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	relocated := prometheus.NewCounter(prometheus.CounterOpts{})
+	marked := prometheus.NewCounter(prometheus.CounterOpts{})
+
+	// Dry run does not copy or mark anything.
+	testutil.Ok(t, compact.RelocateToColdTier(ctx, logger, bkt, coldBkt, metas, nil, time.Hour, true, relocated, marked))
+	testutil.Equals(t, 0, len(coldBkt.Objects()))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(relocated))
+
+	testutil.Ok(t, compact.RelocateToColdTier(ctx, logger, bkt, coldBkt, metas, nil, time.Hour, false, relocated, marked))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(relocated))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(marked))
+
+	// The copy has the cold tier in its meta.json and all the files of the original.
+	coldMeta, err := block.DownloadMeta(ctx, logger, coldBkt, old)
+	testutil.Ok(t, err)
+	testutil.Equals(t, metadata.ColdTier, coldMeta.Thanos.Tier)
+	for _, name := range []string{block.IndexFilename, path.Join(block.ChunksDirname, "000001")} {
+		ok, err := coldBkt.Exists(ctx, path.Join(old.String(), name))
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok, "missing %s in cold bucket", name)
+	}
+	ok, err := coldBkt.Exists(ctx, path.Join(recent.String(), block.MetaFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "recent block must not be relocated")
+
+	// The original is marked for deletion.
+	deletionMark, err := bkt.Exists(ctx, path.Join(old.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, deletionMark, "relocated block is not marked for deletion")
+
+	// Blocks already copied are only marked for deletion.
+	testutil.Ok(t, bkt.Delete(ctx, path.Join(old.String(), metadata.DeletionMarkFilename)))
+	testutil.Ok(t, coldBkt.Delete(ctx, path.Join(old.String(), block.IndexFilename)))
+	testutil.Ok(t, compact.RelocateToColdTier(ctx, logger, bkt, coldBkt, metas, nil, time.Hour, false, relocated, marked))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(marked))
+	ok, err = coldBkt.Exists(ctx, path.Join(old.String(), block.IndexFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "already copied block must not be copied again")
+}
@@ -0,0 +1,192 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"math"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// OutputVerification configures the verification of compacted blocks against their source blocks, before these are
+// deleted.
+type OutputVerification struct {
+	Enabled bool
+	// Tolerance is the ratio of the samples and of the values of each label name of the source blocks that
+	// compacted blocks may miss.
+	Tolerance float64
+}
+
+// verifyOutput checks that the compacted blocks in outDirs have the samples and the label values of their source
+// blocks in srcDirs, up to the tolerance, and that their chunks are not empty and in order. Vertical compaction
+// deduplicates samples, so the samples of its output are only checked not to exceed the ones of the sources.
+func verifyOutput(srcs []*metadata.Meta, srcDirs, outDirs []string, vertical bool, tolerance float64) error {
+	var srcSamples, outSamples uint64
+	for _, m := range srcs {
+		srcSamples += m.Stats.NumSamples
+	}
+	for _, dir := range outDirs {
+		samples, err := verifyChunks(dir)
+		if err != nil {
+			return errors.Wrapf(err, "compacted block %s", filepath.Base(dir))
+		}
+		outSamples += samples
+	}
+	if outSamples > srcSamples || (!vertical && float64(outSamples) < (1-tolerance)*float64(srcSamples)) {
+		return errors.Errorf("compacted blocks have %d samples, source blocks have %d", outSamples, srcSamples)
+	}
+
+	srcValues, err := labelValuesCounts(srcDirs)
+	if err != nil {
+		return errors.Wrap(err, "source blocks")
+	}
+	outValues, err := labelValuesCounts(outDirs)
+	if err != nil {
+		return errors.Wrap(err, "compacted blocks")
+	}
+	for name, n := range srcValues {
+		if outN := outValues[name]; float64(outN) < (1-tolerance)*float64(n) {
+			return errors.Errorf("compacted blocks have %d values of label %s, source blocks have %d", outN, name, n)
+		}
+	}
+	for name, outN := range outValues {
+		if n := srcValues[name]; outN > n {
+			return errors.Errorf("compacted blocks have %d values of label %s, source blocks have %d", outN, name, n)
+		}
+	}
+	return nil
+}
+
+// verifyChunks checks that the chunks of each series of the block in dir are not empty, do not overlap and have
+// their samples in order. It returns the number of samples of the block.
+func verifyChunks(dir string) (samples uint64, err error) {
+	ir, err := index.NewFileReader(filepath.Join(dir, block.IndexFilename))
+	if err != nil {
+		return 0, errors.Wrap(err, "open index file")
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "index reader")
+
+	cr, err := chunks.NewDirReader(filepath.Join(dir, block.ChunksDirname), downsample.NewPool())
+	if err != nil {
+		return 0, errors.Wrap(err, "open chunks dir")
+	}
+	defer runutil.CloseWithErrCapture(&err, cr, "chunk reader")
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return 0, errors.Wrap(err, "get all postings")
+	}
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for p.Next() {
+		if err := ir.Series(p.At(), &lset, &chks); err != nil {
+			return 0, errors.Wrapf(err, "read series %d", p.At())
+		}
+
+		prevMaxt := int64(math.MinInt64)
+		for i, chk := range chks {
+			if chk.MinTime > chk.MaxTime || chk.MinTime <= prevMaxt {
+				return 0, errors.Errorf("out-of-order chunk %d of series %s", i, lset)
+			}
+			prevMaxt = chk.MaxTime
+
+			c, err := cr.Chunk(chk.Ref)
+			if err != nil {
+				return 0, errors.Wrapf(err, "read chunk %d of series %s", i, lset)
+			}
+			n, err := verifyChunk(c, chk.MinTime, chk.MaxTime)
+			if err != nil {
+				return 0, errors.Wrapf(err, "chunk %d of series %s", i, lset)
+			}
+			samples += uint64(n)
+		}
+	}
+	return samples, errors.Wrap(p.Err(), "iterate postings")
+}
+
+// verifyChunk checks that the chunk is not empty and has its samples in order within the given time range.
+// It returns the number of samples of the chunk.
+func verifyChunk(c chunkenc.Chunk, mint, maxt int64) (int, error) {
+	n := c.NumSamples()
+	if n == 0 {
+		return 0, errors.New("zero-length chunk")
+	}
+	if ac, ok := c.(*downsample.AggrChunk); ok {
+		// Every aggregate has a sample for each sample of the count aggregate.
+		cc, err := ac.Get(downsample.AggrCount)
+		if err != nil {
+			return 0, errors.Wrap(err, "get count aggregate")
+		}
+		c = cc
+	}
+
+	prevT := int64(math.MinInt64)
+	it := c.Iterator(nil)
+	for it.Next() {
+		t, _ := it.At()
+		if t <= prevT {
+			return 0, errors.Errorf("out-of-order sample at %d after %d", t, prevT)
+		}
+		if t < mint || t > maxt {
+			return 0, errors.Errorf("sample at %d outside of the chunk time range %d-%d", t, mint, maxt)
+		}
+		prevT = t
+	}
+	return n, errors.Wrap(it.Err(), "iterate samples")
+}
+
+// labelValuesCounts returns the number of distinct values of each label name across the blocks in dirs.
+func labelValuesCounts(dirs []string) (_ map[string]int, err error) {
+	readers := make([]*index.Reader, 0, len(dirs))
+	defer func() {
+		for _, r := range readers {
+			runutil.CloseWithErrCapture(&err, r, "index reader")
+		}
+	}()
+
+	names := map[string]struct{}{}
+	for _, dir := range dirs {
+		r, err := index.NewFileReader(filepath.Join(dir, block.IndexFilename))
+		if err != nil {
+			return nil, errors.Wrapf(err, "open index file of block %s", filepath.Base(dir))
+		}
+		readers = append(readers, r)
+
+		lnames, err := r.LabelNames()
+		if err != nil {
+			return nil, errors.Wrapf(err, "label names of block %s", filepath.Base(dir))
+		}
+		for _, n := range lnames {
+			names[n] = struct{}{}
+		}
+	}
+
+	counts := make(map[string]int, len(names))
+	for name := range names {
+		values := map[string]struct{}{}
+		for _, r := range readers {
+			vals, err := r.SortedLabelValues(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "label values of %s", name)
+			}
+			for _, v := range vals {
+				values[v] = struct{}{}
+			}
+		}
+		counts[name] = len(values)
+	}
+	return counts, nil
+}
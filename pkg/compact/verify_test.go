@@ -0,0 +1,122 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestVerifyOutput(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var series []labels.Labels
+	for i := 0; i < 10; i++ {
+		series = append(series, labels.FromStrings("a", fmt.Sprintf("%d", i), "b", "1"))
+	}
+	createTestBlock := func(series []labels.Labels) (*metadata.Meta, string) {
+		id, meta := createBlock(t, ctx, dir, blockgenSpec{numSamples: 100, mint: 0, maxt: 1000, series: series})
+		return meta, filepath.Join(dir, id.String())
+	}
+	allMeta, allDir := createTestBlock(series)
+	lessMeta, lessDir := createTestBlock(series[1:])
+
+	for _, tcase := range []struct {
+		name      string
+		srcs      []*metadata.Meta
+		srcDirs   []string
+		outDir    string
+		vertical  bool
+		tolerance float64
+
+		expectedErr string
+	}{
+		{name: "same block", srcs: []*metadata.Meta{allMeta}, srcDirs: []string{allDir}, outDir: allDir},
+		{
+			name: "missing series", srcs: []*metadata.Meta{allMeta}, srcDirs: []string{allDir}, outDir: lessDir,
+			expectedErr: "compacted blocks have 900 samples, source blocks have 1000",
+		},
+		{name: "missing series within tolerance", srcs: []*metadata.Meta{allMeta}, srcDirs: []string{allDir}, outDir: lessDir, tolerance: 0.1},
+		{
+			name: "more samples than sources", srcs: []*metadata.Meta{lessMeta}, srcDirs: []string{lessDir}, outDir: allDir,
+			expectedErr: "compacted blocks have 1000 samples, source blocks have 900",
+		},
+		{
+			name: "missing label values", srcs: []*metadata.Meta{allMeta, lessMeta}, srcDirs: []string{allDir, lessDir}, outDir: lessDir, vertical: true,
+			expectedErr: "compacted blocks have 9 values of label a, source blocks have 10",
+		},
+		{name: "deduplicated samples", srcs: []*metadata.Meta{allMeta, allMeta}, srcDirs: []string{allDir, allDir}, outDir: allDir, vertical: true},
+		{
+			name: "deduplicated samples without vertical compaction", srcs: []*metadata.Meta{allMeta, allMeta}, srcDirs: []string{allDir, allDir}, outDir: allDir,
+			expectedErr: "compacted blocks have 1000 samples, source blocks have 2000",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := verifyOutput(tcase.srcs, tcase.srcDirs, []string{tcase.outDir}, tcase.vertical, tcase.tolerance)
+			if tcase.expectedErr != "" {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, tcase.expectedErr, err.Error())
+				return
+			}
+			testutil.Ok(t, err)
+		})
+	}
+}
+
+func TestVerifyChunk(t *testing.T) {
+	newChunk := func(ts ...int64) chunkenc.Chunk {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		testutil.Ok(t, err)
+		for _, t := range ts {
+			app.Append(t, float64(t))
+		}
+		return c
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		chunk      chunkenc.Chunk
+		mint, maxt int64
+
+		expectedSamples int
+		expectedErr     string
+	}{
+		{name: "valid chunk", chunk: newChunk(1, 2, 3), mint: 1, maxt: 3, expectedSamples: 3},
+		{name: "zero-length chunk", chunk: newChunk(), mint: 1, maxt: 3, expectedErr: "zero-length chunk"},
+		{name: "out-of-order samples", chunk: newChunk(1, 3, 2), mint: 1, maxt: 3, expectedErr: "out-of-order sample at 2 after 3"},
+		{name: "sample outside of time range", chunk: newChunk(1, 2, 3), mint: 2, maxt: 3, expectedErr: "sample at 1 outside of the chunk time range 2-3"},
+		{
+			name:  "valid downsampled chunk",
+			chunk: downsample.EncodeAggrChunk([5]chunkenc.Chunk{newChunk(1, 2), newChunk(1, 2), newChunk(1, 2), newChunk(1, 2), newChunk(1, 2)}),
+			mint:  1, maxt: 2, expectedSamples: 2,
+		},
+		{
+			name:  "out-of-order downsampled chunk",
+			chunk: downsample.EncodeAggrChunk([5]chunkenc.Chunk{newChunk(2, 1), newChunk(2, 1), newChunk(2, 1), newChunk(2, 1), newChunk(2, 1)}),
+			mint:  1, maxt: 2, expectedErr: "out-of-order sample at 1 after 2",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			n, err := verifyChunk(tcase.chunk, tcase.mint, tcase.maxt)
+			if tcase.expectedErr != "" {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, tcase.expectedErr, err.Error())
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedSamples, n)
+		})
+	}
+}
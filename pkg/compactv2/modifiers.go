@@ -421,6 +421,38 @@ func (d *RelabelModifier) Modify(_ index.StringIter, set storage.ChunkSeriesSet,
 	return index.NewStringListIter(symbolsSlice), newListChunkSeriesSet(chunkSeriesSet...)
 }
 
+// ShardModifier keeps only the series belonging to the given shard.
+type ShardModifier struct {
+	shard metadata.ThanosShard
+}
+
+func WithShardModifier(shard metadata.ThanosShard) *ShardModifier {
+	return &ShardModifier{shard: shard}
+}
+
+func (d *ShardModifier) Modify(sym index.StringIter, set storage.ChunkSeriesSet, _ ChangeLogger, p ProgressLogger) (index.StringIter, storage.ChunkSeriesSet) {
+	// Symbols are kept as they are, same as for deletions. Symbols of the series of other shards
+	// stay in the index, which only affects the symbol table, not the series.
+	return sym, &shardModifierSeriesSet{ChunkSeriesSet: set, shard: &d.shard, p: p}
+}
+
+type shardModifierSeriesSet struct {
+	storage.ChunkSeriesSet
+
+	shard *metadata.ThanosShard
+	p     ProgressLogger
+}
+
+func (s *shardModifierSeriesSet) Next() bool {
+	for s.ChunkSeriesSet.Next() {
+		if s.shard.Contains(s.ChunkSeriesSet.At().Labels()) {
+			return true
+		}
+		s.p.SeriesProcessed()
+	}
+	return false
+}
+
 // mergeChunkSeries build storage.ChunkSeries from several chunkenc.Iterator.
 type mergeChunkSeries struct {
 	lset labels.Labels
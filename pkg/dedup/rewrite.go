@@ -0,0 +1,154 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package dedup
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// ReplicaLabelRewrite adds a label to deduplicated series in place of a replica label stripped by deduplication,
+// so that the series keep a stable label about their provenance.
+type ReplicaLabelRewrite struct {
+	// ReplicaLabel is the name of the stripped replica label.
+	ReplicaLabel string
+	// Label is the name of the label added to the deduplicated series.
+	Label string
+	// Value is the template of the added label value. It is executed with the labels of the deduplicated series,
+	// e.g. `ha-pair-{{ .cluster }}`.
+	Value *template.Template
+}
+
+// ParseReplicaLabelRewrite parses a rewrite in the `<replica label>:<label>=<value template>` format.
+func ParseReplicaLabelRewrite(s string) (ReplicaLabelRewrite, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return ReplicaLabelRewrite{}, errors.Errorf("replica label rewrite %q is not in <replica label>:<label>=<value template> format", s)
+	}
+	replicaLabel := parts[0]
+	parts = strings.SplitN(parts[1], "=", 2)
+	if len(parts) != 2 {
+		return ReplicaLabelRewrite{}, errors.Errorf("replica label rewrite %q is not in <replica label>:<label>=<value template> format", s)
+	}
+	label, value := parts[0], parts[1]
+	if !model.LabelName(replicaLabel).IsValid() {
+		return ReplicaLabelRewrite{}, errors.Errorf("invalid replica label name %q in replica label rewrite %q", replicaLabel, s)
+	}
+	if !model.LabelName(label).IsValid() || label == model.MetricNameLabel {
+		return ReplicaLabelRewrite{}, errors.Errorf("invalid label name %q in replica label rewrite %q", label, s)
+	}
+
+	tmpl, err := template.New(label).Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return ReplicaLabelRewrite{}, errors.Wrapf(err, "parse value template of replica label rewrite %q", s)
+	}
+	return ReplicaLabelRewrite{ReplicaLabel: replicaLabel, Label: label, Value: tmpl}, nil
+}
+
+// NewReplicaLabelRewriteSeriesSet returns a series set with the given rewrites applied to the series of a deduplicated
+// series set returned by NewSeriesSet. A rewrite only applies to series which had its replica label before deduplication
+// and do not have its label yet. As added labels change the order of series, the series set is sorted again.
+func NewReplicaLabelRewriteSeriesSet(set storage.SeriesSet, rewrites []ReplicaLabelRewrite) storage.SeriesSet {
+	if len(rewrites) == 0 {
+		return set
+	}
+
+	var (
+		series []storage.Series
+		sb     strings.Builder
+	)
+	for set.Next() {
+		s := set.At()
+		lset := s.Labels()
+		stripped := strippedLabelNames(s)
+
+		var (
+			b    *labels.Builder
+			data map[string]string
+		)
+		for _, rw := range rewrites {
+			if _, ok := stripped[rw.ReplicaLabel]; !ok || lset.Has(rw.Label) {
+				continue
+			}
+			if data == nil {
+				data = lset.Map()
+			}
+
+			sb.Reset()
+			if err := rw.Value.Execute(&sb, data); err != nil {
+				return storage.ErrSeriesSet(errors.Wrapf(err, "execute value template of replica label %s rewrite", rw.ReplicaLabel))
+			}
+			if sb.Len() == 0 {
+				continue
+			}
+			if b == nil {
+				b = labels.NewBuilder(lset)
+			}
+			b.Set(rw.Label, sb.String())
+		}
+		if b == nil {
+			series = append(series, s)
+			continue
+		}
+		series = append(series, seriesWithLabels{Series: s, lset: b.Labels()})
+	}
+	if set.Err() != nil {
+		return storage.ErrSeriesSet(set.Err())
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return labels.Compare(series[i].Labels(), series[j].Labels()) < 0
+	})
+	return &rewrittenSeriesSet{series: series, warns: set.Warnings()}
+}
+
+// strippedLabelNames returns the names of the labels of the replicas of the deduplicated series, which are not part
+// of the series labels anymore.
+func strippedLabelNames(s storage.Series) map[string]struct{} {
+	var replicas []storage.Series
+	switch ds := s.(type) {
+	case seriesWithLabels:
+		replicas = []storage.Series{ds.Series}
+	case *dedupSeries:
+		replicas = append(replicas, ds.replicas...)
+		replicas = append(replicas, ds.pushedDown...)
+	}
+
+	lset := s.Labels()
+	stripped := map[string]struct{}{}
+	for _, r := range replicas {
+		for _, l := range r.Labels() {
+			if !lset.Has(l.Name) {
+				stripped[l.Name] = struct{}{}
+			}
+		}
+	}
+	return stripped
+}
+
+type rewrittenSeriesSet struct {
+	series []storage.Series
+	warns  storage.Warnings
+	cur    int
+}
+
+func (s *rewrittenSeriesSet) Next() bool {
+	if s.cur >= len(s.series) {
+		return false
+	}
+	s.cur++
+	return true
+}
+
+func (s *rewrittenSeriesSet) At() storage.Series { return s.series[s.cur-1] }
+
+func (s *rewrittenSeriesSet) Err() error { return nil }
+
+func (s *rewrittenSeriesSet) Warnings() storage.Warnings { return s.warns }
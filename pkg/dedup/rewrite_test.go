@@ -0,0 +1,79 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package dedup
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseReplicaLabelRewrite(t *testing.T) {
+	rw, err := ParseReplicaLabelRewrite("replica:source=ha-pair-{{ .cluster }}")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "replica", rw.ReplicaLabel)
+	testutil.Equals(t, "source", rw.Label)
+
+	for _, invalid := range []string{
+		"replica",
+		"replica:source",
+		"replica:=value",
+		"rep-lica:source=value",
+		"replica:__name__=value",
+		"replica:source={{ .cluster",
+	} {
+		_, err := ParseReplicaLabelRewrite(invalid)
+		testutil.NotOk(t, err, invalid)
+	}
+}
+
+func TestReplicaLabelRewriteSeriesSet(t *testing.T) {
+	var rewrites []ReplicaLabelRewrite
+	for _, s := range []string{
+		"replica:a_source=ha-pair-{{ .cluster }}",
+		"replica:cluster=unknown",
+		"replica:origin={{ .missing }}",
+	} {
+		rw, err := ParseReplicaLabelRewrite(s)
+		testutil.Ok(t, err)
+		rewrites = append(rewrites, rw)
+	}
+
+	// The input is sorted with replica labels at the end, as the querier does before deduplication.
+	input := []series{
+		{lset: labels.Labels{{Name: "a", Value: "1"}, {Name: "b", Value: "1"}}, samples: []sample{{10000, 1}}},
+		{lset: labels.Labels{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "cluster", Value: "1"}, {Name: "replica", Value: "A"}}, samples: []sample{{10000, 1}}},
+		{lset: labels.Labels{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "cluster", Value: "1"}, {Name: "replica", Value: "B"}}, samples: []sample{{10000, 1}, {20000, 2}}},
+		{lset: labels.Labels{{Name: "a", Value: "1"}, {Name: "b", Value: "3"}, {Name: "replica", Value: "A"}}, samples: []sample{{10000, 1}}},
+	}
+	set := NewReplicaLabelRewriteSeriesSet(
+		NewSeriesSet(&mockedSeriesSet{series: input}, map[string]struct{}{"replica": {}}, "", false),
+		rewrites,
+	)
+
+	var got []series
+	for set.Next() {
+		s := set.At()
+		got = append(got, series{lset: s.Labels(), samples: expandSeries(t, s.Iterator())})
+	}
+	testutil.Ok(t, set.Err())
+
+	// Deduplication is not affected by the rewrites, the added labels change the order of the series.
+	testutil.Equals(t, []series{
+		{
+			lset:    labels.Labels{{Name: "a", Value: "1"}, {Name: "a_source", Value: "ha-pair-"}, {Name: "b", Value: "3"}, {Name: "cluster", Value: "unknown"}},
+			samples: []sample{{10000, 1}},
+		},
+		{
+			lset:    labels.Labels{{Name: "a", Value: "1"}, {Name: "a_source", Value: "ha-pair-1"}, {Name: "b", Value: "2"}, {Name: "cluster", Value: "1"}},
+			samples: []sample{{10000, 1}, {20000, 2}},
+		},
+		{
+			lset:    labels.Labels{{Name: "a", Value: "1"}, {Name: "b", Value: "1"}},
+			samples: []sample{{10000, 1}},
+		},
+	}, got)
+}
@@ -109,3 +109,17 @@ func ExemplarsFromPromExemplars(exemplars []exemplar.Exemplar) []*Exemplar {
 	}
 	return ex
 }
+
+// PromExemplarsFromExemplars returns the given exemplars as Prometheus exemplars.
+func PromExemplarsFromExemplars(exemplars []*Exemplar) []exemplar.Exemplar {
+	ex := make([]exemplar.Exemplar, 0, len(exemplars))
+	for _, e := range exemplars {
+		ex = append(ex, exemplar.Exemplar{
+			Labels: e.Labels.PromLabels(),
+			Value:  e.Value,
+			Ts:     e.Ts,
+			HasTs:  true,
+		})
+	}
+	return ex
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"net/url"
 
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 
 	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
@@ -55,3 +56,19 @@ func (p *Prometheus) Exemplars(r *exemplarspb.ExemplarsRequest, s exemplarspb.Ex
 	}
 	return nil
 }
+
+// AllSeries returns the exemplars of all series within the given closed time range, without the external labels.
+func (p *Prometheus) AllSeries(ctx context.Context, mint, maxt int64) ([]exemplar.QueryResult, error) {
+	exemplars, err := p.client.ExemplarsInGRPC(ctx, p.base, `{__name__=~".+"}`, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]exemplar.QueryResult, 0, len(exemplars))
+	for _, e := range exemplars {
+		res = append(res, exemplar.QueryResult{
+			SeriesLabels: labelpb.ZLabelsToPromLabels(e.SeriesLabels.Labels),
+			Exemplars:    exemplarspb.PromExemplarsFromExemplars(e.Exemplars),
+		})
+	}
+	return res, nil
+}
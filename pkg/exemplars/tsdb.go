@@ -4,8 +4,11 @@
 package exemplars
 
 import (
+	"context"
+
 	"github.com/gogo/status"
 	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"google.golang.org/grpc/codes"
@@ -64,6 +67,15 @@ func (t *TSDB) Exemplars(matchers [][]*labels.Matcher, start, end int64, s exemp
 	return nil
 }
 
+// AllSeries returns the exemplars of all series within the given closed time range, without the external labels.
+func (t *TSDB) AllSeries(ctx context.Context, mint, maxt int64) ([]exemplar.QueryResult, error) {
+	eq, err := t.db.ExemplarQuerier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return eq.Select(mint, maxt, []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+")})
+}
+
 // selectorsMatchesExternalLabels returns false if none of the selectors matches the external labels.
 // If true, it also returns an array of non-empty Prometheus matchers.
 func selectorsMatchesExternalLabels(selectors [][]*labels.Matcher, externalLabels labels.Labels) (bool, [][]*labels.Matcher) {
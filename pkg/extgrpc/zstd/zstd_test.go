@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestZstd(t *testing.T) {
+	c := newCompressor()
+	testutil.Equals(t, "zstd", c.Name())
+
+	for _, tcase := range []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "short", input: "hello world"},
+		{name: "long", input: strings.Repeat("123456789", 1024)},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			// Compressors and decompressors are pooled, so each is used twice.
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				w, err := c.Compress(&buf)
+				testutil.Ok(t, err)
+				n, err := w.Write([]byte(tcase.input))
+				testutil.Ok(t, err)
+				testutil.Equals(t, len(tcase.input), n)
+				testutil.Ok(t, w.Close())
+
+				r, err := c.Decompress(&buf)
+				testutil.Ok(t, err)
+				out, err := io.ReadAll(r)
+				testutil.Ok(t, err)
+				testutil.Equals(t, tcase.input, string(out))
+			}
+		})
+	}
+}
+
+func BenchmarkZstdCompress(b *testing.B) {
+	data := []byte(strings.Repeat("123456789", 1024))
+	c := newCompressor()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, _ := c.Compress(io.Discard)
+		_, _ = w.Write(data)
+		_ = w.Close()
+	}
+}
+
+func BenchmarkZstdDecompress(b *testing.B) {
+	data := []byte(strings.Repeat("123456789", 1024))
+	c := newCompressor()
+	var buf bytes.Buffer
+	w, _ := c.Compress(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	reader := bytes.NewReader(buf.Bytes())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _ := c.Decompress(reader)
+		_, _ = io.ReadAll(r)
+		_, _ = reader.Seek(0, io.SeekStart)
+	}
+}
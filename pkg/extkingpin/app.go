@@ -73,6 +73,8 @@ type SetupFunc func(*run.Group, log.Logger, *prometheus.Registry, opentracing.Tr
 type AppClause interface {
 	FlagClause
 	Command(cmd string, help string) AppClause
+	// Default makes the command the default subcommand of its parent, run when no other subcommand is given.
+	Default() AppClause
 	Flags() []*kingpin.FlagModel
 	Setup(s SetupFunc)
 }
@@ -139,6 +141,11 @@ func (a *appClause) Command(cmd, help string) AppClause {
 	}
 }
 
+func (a *appClause) Default() AppClause {
+	a.c.Default()
+	return a
+}
+
 func (a *appClause) Setup(s SetupFunc) {
 	a.setups[a.prefix] = s
 }
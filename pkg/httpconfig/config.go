@@ -15,6 +15,9 @@ import (
 
 // Config is a structure that allows pointing to various HTTP endpoint, e.g ruler connecting to queriers.
 type Config struct {
+	// Name of the configuration. Configurations with the same name make up a group of endpoints, e.g. the query source
+	// of ruler's rule groups.
+	Name             string          `yaml:"name"`
 	HTTPClientConfig ClientConfig    `yaml:"http_config"`
 	EndpointsConfig  EndpointsConfig `yaml:",inline"`
 }
@@ -5,6 +5,7 @@ package infopb
 
 import (
 	context "context"
+	encoding_binary "encoding/binary"
 	fmt "fmt"
 	io "io"
 	math "math"
@@ -119,6 +120,16 @@ var xxx_messageInfo_InfoResponse proto.InternalMessageInfo
 type StoreInfo struct {
 	MinTime int64 `protobuf:"varint,1,opt,name=min_time,json=minTime,proto3" json:"min_time,omitempty"`
 	MaxTime int64 `protobuf:"varint,2,opt,name=max_time,json=maxTime,proto3" json:"max_time,omitempty"`
+	// supports_without_replica_labels is true if the Store API removes the without_replica_labels of Series
+	// requests from the returned series itself. Otherwise the field is not set in requests to this Store API.
+	// Only queriers announce it, as other components would have to buffer the series of requests to re-sort them.
+	SupportsWithoutReplicaLabels bool `protobuf:"varint,3,opt,name=supports_without_replica_labels,json=supportsWithoutReplicaLabels,proto3" json:"supports_without_replica_labels,omitempty"`
+	// metric_name_filter is a bloom filter of the metric names of the series of the Store API, if it exposes one.
+	// Stores not having a metric name requested by an equality matcher can be skipped.
+	MetricNameFilter *MetricNameFilter `protobuf:"bytes,4,opt,name=metric_name_filter,json=metricNameFilter,proto3" json:"metric_name_filter,omitempty"`
+	// async_replication is true if the component acknowledges writes before they are replicated, without write quorum.
+	// Replicas of the data of the Store API may be missing or lagging behind.
+	AsyncReplication bool `protobuf:"varint,5,opt,name=async_replication,json=asyncReplication,proto3" json:"async_replication,omitempty"`
 }
 
 func (m *StoreInfo) Reset()         { *m = StoreInfo{} }
@@ -154,6 +165,52 @@ func (m *StoreInfo) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_StoreInfo proto.InternalMessageInfo
 
+// MetricNameFilter is a bloom filter of metric names. It may contain metric names the store does not have, but it
+// always contains all metric names it has.
+type MetricNameFilter struct {
+	// version identifies the content of the filter, so that clients only decode changed filters.
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// hash_count is the number of bits set for each metric name.
+	HashCount uint32   `protobuf:"varint,2,opt,name=hash_count,json=hashCount,proto3" json:"hash_count,omitempty"`
+	Bits      []uint64 `protobuf:"fixed64,3,rep,packed,name=bits,proto3" json:"bits,omitempty"`
+	// lease_millis is for how many milliseconds after sending the request for it clients may skip the store by the
+	// filter. The store queries blocks with metric names missing from a filter only once its leases expired.
+	LeaseMillis int64 `protobuf:"varint,4,opt,name=lease_millis,json=leaseMillis,proto3" json:"lease_millis,omitempty"`
+}
+
+func (m *MetricNameFilter) Reset()         { *m = MetricNameFilter{} }
+func (m *MetricNameFilter) String() string { return proto.CompactTextString(m) }
+func (*MetricNameFilter) ProtoMessage()    {}
+func (*MetricNameFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a1214ec45d2bf952, []int{3}
+}
+func (m *MetricNameFilter) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MetricNameFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MetricNameFilter.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MetricNameFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricNameFilter.Merge(m, src)
+}
+func (m *MetricNameFilter) XXX_Size() int {
+	return m.Size()
+}
+func (m *MetricNameFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricNameFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricNameFilter proto.InternalMessageInfo
+
 // RulesInfo holds the metadata related to Rules API exposed by the component.
 type RulesInfo struct {
 }
@@ -162,7 +219,7 @@ func (m *RulesInfo) Reset()         { *m = RulesInfo{} }
 func (m *RulesInfo) String() string { return proto.CompactTextString(m) }
 func (*RulesInfo) ProtoMessage()    {}
 func (*RulesInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a1214ec45d2bf952, []int{3}
+	return fileDescriptor_a1214ec45d2bf952, []int{4}
 }
 func (m *RulesInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -199,7 +256,7 @@ func (m *MetricMetadataInfo) Reset()         { *m = MetricMetadataInfo{} }
 func (m *MetricMetadataInfo) String() string { return proto.CompactTextString(m) }
 func (*MetricMetadataInfo) ProtoMessage()    {}
 func (*MetricMetadataInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a1214ec45d2bf952, []int{4}
+	return fileDescriptor_a1214ec45d2bf952, []int{5}
 }
 func (m *MetricMetadataInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -236,7 +293,7 @@ func (m *TargetsInfo) Reset()         { *m = TargetsInfo{} }
 func (m *TargetsInfo) String() string { return proto.CompactTextString(m) }
 func (*TargetsInfo) ProtoMessage()    {}
 func (*TargetsInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a1214ec45d2bf952, []int{5}
+	return fileDescriptor_a1214ec45d2bf952, []int{6}
 }
 func (m *TargetsInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -275,7 +332,7 @@ func (m *ExemplarsInfo) Reset()         { *m = ExemplarsInfo{} }
 func (m *ExemplarsInfo) String() string { return proto.CompactTextString(m) }
 func (*ExemplarsInfo) ProtoMessage()    {}
 func (*ExemplarsInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a1214ec45d2bf952, []int{6}
+	return fileDescriptor_a1214ec45d2bf952, []int{7}
 }
 func (m *ExemplarsInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -312,7 +369,7 @@ func (m *QueryAPIInfo) Reset()         { *m = QueryAPIInfo{} }
 func (m *QueryAPIInfo) String() string { return proto.CompactTextString(m) }
 func (*QueryAPIInfo) ProtoMessage()    {}
 func (*QueryAPIInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a1214ec45d2bf952, []int{7}
+	return fileDescriptor_a1214ec45d2bf952, []int{8}
 }
 func (m *QueryAPIInfo) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -345,6 +402,7 @@ func init() {
 	proto.RegisterType((*InfoRequest)(nil), "thanos.info.InfoRequest")
 	proto.RegisterType((*InfoResponse)(nil), "thanos.info.InfoResponse")
 	proto.RegisterType((*StoreInfo)(nil), "thanos.info.StoreInfo")
+	proto.RegisterType((*MetricNameFilter)(nil), "thanos.info.MetricNameFilter")
 	proto.RegisterType((*RulesInfo)(nil), "thanos.info.RulesInfo")
 	proto.RegisterType((*MetricMetadataInfo)(nil), "thanos.info.MetricMetadataInfo")
 	proto.RegisterType((*TargetsInfo)(nil), "thanos.info.TargetsInfo")
@@ -355,36 +413,46 @@ func init() {
 func init() { proto.RegisterFile("info/infopb/rpc.proto", fileDescriptor_a1214ec45d2bf952) }
 
 var fileDescriptor_a1214ec45d2bf952 = []byte{
-	// 465 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x93, 0xcf, 0x6a, 0xdb, 0x40,
-	0x10, 0xc6, 0xa5, 0xf8, 0x5f, 0x34, 0x8a, 0x53, 0xba, 0xa4, 0x45, 0xf6, 0x41, 0x31, 0x22, 0x07,
-	0x1f, 0x8a, 0x04, 0x2e, 0x94, 0x42, 0x4f, 0x49, 0x08, 0x34, 0xd0, 0x40, 0xab, 0xf8, 0x94, 0x8b,
-	0x59, 0xa7, 0x13, 0x57, 0xa0, 0xd5, 0x6e, 0xb4, 0x6b, 0xb0, 0xdf, 0xa2, 0xaf, 0xd2, 0xb7, 0xf0,
-	0x31, 0xc7, 0x9e, 0x4a, 0x6b, 0xbf, 0x48, 0xd9, 0x5d, 0x25, 0xb5, 0xa8, 0x4f, 0xb9, 0x48, 0xbb,
-	0xf3, 0xfb, 0xbe, 0xd9, 0x9d, 0x61, 0x16, 0x5e, 0x65, 0xc5, 0x1d, 0x4f, 0xf4, 0x47, 0x4c, 0x93,
-	0x52, 0xdc, 0xc6, 0xa2, 0xe4, 0x8a, 0x13, 0x5f, 0x7d, 0xa3, 0x05, 0x97, 0xb1, 0x06, 0xfd, 0x9e,
-	0x54, 0xbc, 0xc4, 0x24, 0xa7, 0x53, 0xcc, 0xc5, 0x34, 0x51, 0x4b, 0x81, 0xd2, 0xea, 0xfa, 0x47,
-	0x33, 0x3e, 0xe3, 0x66, 0x99, 0xe8, 0x95, 0x8d, 0x46, 0x5d, 0xf0, 0x2f, 0x8b, 0x3b, 0x9e, 0xe2,
-	0xfd, 0x1c, 0xa5, 0x8a, 0x7e, 0x34, 0xe0, 0xc0, 0xee, 0xa5, 0xe0, 0x85, 0x44, 0xf2, 0x0e, 0xc0,
-	0x24, 0x9b, 0x48, 0x54, 0x32, 0x70, 0x07, 0x8d, 0xa1, 0x3f, 0x7a, 0x19, 0x57, 0x47, 0xde, 0x7c,
-	0xd2, 0xe8, 0x1a, 0xd5, 0x59, 0x73, 0xf5, 0xeb, 0xd8, 0x49, 0xbd, 0xbc, 0xda, 0x4b, 0x72, 0x02,
-	0xdd, 0x73, 0xce, 0x04, 0x2f, 0xb0, 0x50, 0xe3, 0xa5, 0xc0, 0x60, 0x6f, 0xe0, 0x0e, 0xbd, 0xb4,
-	0x1e, 0x24, 0x6f, 0xa0, 0x65, 0x2e, 0x1c, 0x34, 0x06, 0xee, 0xd0, 0x1f, 0xbd, 0x8e, 0xb7, 0x6a,
-	0x89, 0xaf, 0x35, 0x31, 0x97, 0xb1, 0x22, 0xad, 0x2e, 0xe7, 0x39, 0xca, 0xa0, 0xb9, 0x43, 0x9d,
-	0x6a, 0x62, 0xd5, 0x46, 0x44, 0x3e, 0xc2, 0x0b, 0x86, 0xaa, 0xcc, 0x6e, 0x27, 0x0c, 0x15, 0xfd,
-	0x4a, 0x15, 0x0d, 0x5a, 0xc6, 0x77, 0x5c, 0xf3, 0x5d, 0x19, 0xcd, 0x55, 0x25, 0x31, 0x09, 0x0e,
-	0x59, 0x2d, 0x46, 0x46, 0xd0, 0x51, 0xb4, 0x9c, 0xe9, 0x06, 0xb4, 0x4d, 0x86, 0xa0, 0x96, 0x61,
-	0x6c, 0x99, 0xb1, 0x3e, 0x0a, 0xc9, 0x7b, 0xf0, 0x70, 0x81, 0x4c, 0xe4, 0xb4, 0x94, 0x41, 0xc7,
-	0xb8, 0xfa, 0x35, 0xd7, 0xc5, 0x23, 0x35, 0xbe, 0x7f, 0x62, 0x92, 0x40, 0xeb, 0x7e, 0x8e, 0xe5,
-	0x32, 0xd8, 0x37, 0xae, 0x5e, 0xcd, 0xf5, 0x45, 0x93, 0xd3, 0xcf, 0x97, 0xb6, 0x50, 0xa3, 0x8b,
-	0x4e, 0xc1, 0x7b, 0x6a, 0x15, 0xe9, 0xc1, 0x3e, 0xcb, 0x8a, 0x89, 0xca, 0x18, 0x06, 0xee, 0xc0,
-	0x1d, 0x36, 0xd2, 0x0e, 0xcb, 0x8a, 0x71, 0xc6, 0xd0, 0x20, 0xba, 0xb0, 0x68, 0xaf, 0x42, 0x74,
-	0xa1, 0x51, 0xe4, 0x83, 0xf7, 0xd4, 0xbf, 0xe8, 0x08, 0xc8, 0xff, 0x4d, 0xd1, 0x83, 0xb2, 0x55,
-	0x68, 0x74, 0x01, 0xdd, 0x5a, 0x05, 0xcf, 0x3c, 0xf8, 0x10, 0x0e, 0xb6, 0x4b, 0x1a, 0x9d, 0x43,
-	0xd3, 0x64, 0xfb, 0x50, 0xfd, 0xeb, 0x9d, 0xde, 0x9a, 0xd4, 0x7e, 0x6f, 0x07, 0xb1, 0x33, 0x7b,
-	0x76, 0xb2, 0xfa, 0x13, 0x3a, 0xab, 0x75, 0xe8, 0x3e, 0xac, 0x43, 0xf7, 0xf7, 0x3a, 0x74, 0xbf,
-	0x6f, 0x42, 0xe7, 0x61, 0x13, 0x3a, 0x3f, 0x37, 0xa1, 0x73, 0xd3, 0xb6, 0x2f, 0x68, 0xda, 0x36,
-	0x0f, 0xe0, 0xed, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x0b, 0x22, 0x37, 0x8b, 0x57, 0x03, 0x00,
+	// 625 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0xcd, 0x4e, 0x1b, 0x3b,
+	0x14, 0xce, 0x90, 0x90, 0x9f, 0x13, 0xc2, 0x05, 0x8b, 0x7b, 0x35, 0x89, 0x2e, 0x43, 0x3a, 0x62,
+	0x11, 0xa9, 0x55, 0x22, 0xa5, 0x52, 0x55, 0xa9, 0xab, 0x82, 0xa8, 0x8a, 0x5a, 0xaa, 0xd6, 0x20,
+	0x55, 0x62, 0x33, 0x72, 0x52, 0x43, 0x2c, 0x8d, 0xc7, 0xc3, 0xd8, 0x69, 0xc9, 0x96, 0x27, 0xe8,
+	0xab, 0xf4, 0x2d, 0x58, 0xb2, 0xec, 0xaa, 0x6a, 0xe1, 0x45, 0x2a, 0x1f, 0x4f, 0x20, 0x43, 0x59,
+	0x75, 0x03, 0xf6, 0xf7, 0x73, 0x62, 0x9f, 0xf3, 0x79, 0xe0, 0x5f, 0x91, 0x9c, 0xa8, 0x81, 0xfd,
+	0x93, 0x8e, 0x06, 0x59, 0x3a, 0xee, 0xa7, 0x99, 0x32, 0x8a, 0x34, 0xcd, 0x84, 0x25, 0x4a, 0xf7,
+	0x2d, 0xd1, 0x69, 0x6b, 0xa3, 0x32, 0x3e, 0x88, 0xd9, 0x88, 0xc7, 0xe9, 0x68, 0x60, 0x66, 0x29,
+	0xd7, 0x4e, 0xd7, 0xd9, 0x38, 0x55, 0xa7, 0x0a, 0x97, 0x03, 0xbb, 0x72, 0x68, 0xd8, 0x82, 0xe6,
+	0x7e, 0x72, 0xa2, 0x28, 0x3f, 0x9b, 0x72, 0x6d, 0xc2, 0x6f, 0x65, 0x58, 0x71, 0x7b, 0x9d, 0xaa,
+	0x44, 0x73, 0xf2, 0x0c, 0x00, 0x8b, 0x45, 0x9a, 0x1b, 0xed, 0x7b, 0xdd, 0x72, 0xaf, 0x39, 0x5c,
+	0xef, 0xe7, 0x3f, 0x79, 0xfc, 0xd6, 0x52, 0x87, 0xdc, 0xec, 0x54, 0x2e, 0x7f, 0x6c, 0x95, 0x68,
+	0x23, 0xce, 0xf7, 0x9a, 0x6c, 0x43, 0x6b, 0x57, 0xc9, 0x54, 0x25, 0x3c, 0x31, 0x47, 0xb3, 0x94,
+	0xfb, 0x4b, 0x5d, 0xaf, 0xd7, 0xa0, 0x45, 0x90, 0x3c, 0x81, 0x65, 0x3c, 0xb0, 0x5f, 0xee, 0x7a,
+	0xbd, 0xe6, 0xf0, 0xbf, 0xfe, 0xc2, 0x5d, 0xfa, 0x87, 0x96, 0xc1, 0xc3, 0x38, 0x91, 0x55, 0x67,
+	0xd3, 0x98, 0x6b, 0xbf, 0xf2, 0x80, 0x9a, 0x5a, 0xc6, 0xa9, 0x51, 0x44, 0x5e, 0xc3, 0x3f, 0x92,
+	0x9b, 0x4c, 0x8c, 0x23, 0xc9, 0x0d, 0xfb, 0xc4, 0x0c, 0xf3, 0x97, 0xd1, 0xb7, 0x55, 0xf0, 0x1d,
+	0xa0, 0xe6, 0x20, 0x97, 0x60, 0x81, 0x55, 0x59, 0xc0, 0xc8, 0x10, 0x6a, 0x86, 0x65, 0xa7, 0xb6,
+	0x01, 0x55, 0xac, 0xe0, 0x17, 0x2a, 0x1c, 0x39, 0x0e, 0xad, 0x73, 0x21, 0x79, 0x0e, 0x0d, 0x7e,
+	0xce, 0x65, 0x1a, 0xb3, 0x4c, 0xfb, 0x35, 0x74, 0x75, 0x0a, 0xae, 0xbd, 0x39, 0x8b, 0xbe, 0x3b,
+	0x31, 0x19, 0xc0, 0xf2, 0xd9, 0x94, 0x67, 0x33, 0xbf, 0x8e, 0xae, 0x76, 0xc1, 0xf5, 0xc1, 0x32,
+	0x2f, 0xdf, 0xef, 0xbb, 0x8b, 0xa2, 0x2e, 0xbc, 0x58, 0x82, 0xc6, 0x6d, 0xaf, 0x48, 0x1b, 0xea,
+	0x52, 0x24, 0x91, 0x11, 0x92, 0xfb, 0x5e, 0xd7, 0xeb, 0x95, 0x69, 0x4d, 0x8a, 0xe4, 0x48, 0x48,
+	0x8e, 0x14, 0x3b, 0x77, 0xd4, 0x52, 0x4e, 0xb1, 0x73, 0xa4, 0xf6, 0x60, 0x4b, 0x4f, 0xd3, 0x54,
+	0x65, 0x46, 0x47, 0x5f, 0x84, 0x99, 0xa8, 0xa9, 0x89, 0x32, 0x9e, 0xc6, 0x62, 0xcc, 0x22, 0x1c,
+	0xaa, 0xc6, 0x11, 0xd5, 0xe9, 0xff, 0x73, 0xd9, 0x47, 0xa7, 0xa2, 0x4e, 0x84, 0x41, 0xd0, 0xe4,
+	0x0d, 0x90, 0xbc, 0xe7, 0x09, 0x93, 0x3c, 0x3a, 0x11, 0xb1, 0xe1, 0x59, 0x3e, 0xae, 0xcd, 0x07,
+	0xda, 0xfe, 0x8e, 0x49, 0xfe, 0x0a, 0x45, 0x74, 0x4d, 0xde, 0x43, 0xc8, 0x63, 0x58, 0x67, 0x7a,
+	0x96, 0x8c, 0xe7, 0x07, 0x31, 0x42, 0x25, 0x38, 0xc2, 0x3a, 0x5d, 0x43, 0x82, 0xde, 0xe1, 0xe1,
+	0x85, 0x07, 0x6b, 0xf7, 0x6b, 0x12, 0x1f, 0x6a, 0x9f, 0x79, 0xa6, 0xad, 0xcf, 0xc3, 0xf8, 0xcd,
+	0xb7, 0x64, 0x13, 0x60, 0xc2, 0xf4, 0x24, 0x1a, 0xab, 0x69, 0x62, 0xb0, 0x19, 0x2d, 0xda, 0xb0,
+	0xc8, 0xae, 0x05, 0x08, 0x81, 0xca, 0x48, 0x18, 0x7b, 0xe7, 0x72, 0xaf, 0x4a, 0x71, 0x4d, 0x1e,
+	0xc1, 0x4a, 0xcc, 0x99, 0xe6, 0x91, 0x14, 0x71, 0x2c, 0x5c, 0x08, 0xcb, 0xb4, 0x89, 0xd8, 0x01,
+	0x42, 0x61, 0x13, 0x1a, 0xb7, 0x31, 0x0c, 0x37, 0x80, 0xfc, 0x99, 0x2d, 0xfb, 0xde, 0x16, 0xf2,
+	0x12, 0xee, 0x41, 0xab, 0x10, 0x84, 0xbf, 0x1b, 0x5f, 0xb8, 0x0a, 0x2b, 0x8b, 0xc9, 0x18, 0xee,
+	0x42, 0x05, 0xab, 0xbd, 0xc8, 0xff, 0x17, 0x03, 0xbb, 0xf0, 0xe0, 0x3b, 0xed, 0x07, 0x18, 0xf7,
+	0xf4, 0x77, 0xb6, 0x2f, 0x7f, 0x05, 0xa5, 0xcb, 0xeb, 0xc0, 0xbb, 0xba, 0x0e, 0xbc, 0x9f, 0xd7,
+	0x81, 0xf7, 0xf5, 0x26, 0x28, 0x5d, 0xdd, 0x04, 0xa5, 0xef, 0x37, 0x41, 0xe9, 0xb8, 0xea, 0x3e,
+	0x44, 0xa3, 0x2a, 0x7e, 0x47, 0x9e, 0xfe, 0x1e, 0x00, 0x97, 0xba, 0x25, 0x4d, 0x9e, 0x04, 0x00,
 	0x00,
 }
 
@@ -629,6 +697,38 @@ func (m *StoreInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.AsyncReplication {
+		i--
+		if m.AsyncReplication {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.MetricNameFilter != nil {
+		{
+			size, err := m.MetricNameFilter.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.SupportsWithoutReplicaLabels {
+		i--
+		if m.SupportsWithoutReplicaLabels {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x18
+	}
 	if m.MaxTime != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.MaxTime))
 		i--
@@ -642,6 +742,55 @@ func (m *StoreInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *MetricNameFilter) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MetricNameFilter) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MetricNameFilter) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.LeaseMillis != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.LeaseMillis))
+		i--
+		dAtA[i] = 0x20
+	}
+	if len(m.Bits) > 0 {
+		for iNdEx := len(m.Bits) - 1; iNdEx >= 0; iNdEx-- {
+			i -= 8
+			encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(m.Bits[iNdEx]))
+		}
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Bits)*8))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.HashCount != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.HashCount))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Version) > 0 {
+		i -= len(m.Version)
+		copy(dAtA[i:], m.Version)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Version)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *RulesInfo) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -842,6 +991,38 @@ func (m *StoreInfo) Size() (n int) {
 	if m.MaxTime != 0 {
 		n += 1 + sovRpc(uint64(m.MaxTime))
 	}
+	if m.SupportsWithoutReplicaLabels {
+		n += 2
+	}
+	if m.MetricNameFilter != nil {
+		l = m.MetricNameFilter.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.AsyncReplication {
+		n += 2
+	}
+	return n
+}
+
+func (m *MetricNameFilter) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Version)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.HashCount != 0 {
+		n += 1 + sovRpc(uint64(m.HashCount))
+	}
+	if len(m.Bits) > 0 {
+		n += 1 + sovRpc(uint64(len(m.Bits)*8)) + len(m.Bits)*8
+	}
+	if m.LeaseMillis != 0 {
+		n += 1 + sovRpc(uint64(m.LeaseMillis))
+	}
 	return n
 }
 
@@ -1351,6 +1532,254 @@ func (m *StoreInfo) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsWithoutReplicaLabels", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsWithoutReplicaLabels = bool(v != 0)
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MetricNameFilter", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.MetricNameFilter == nil {
+				m.MetricNameFilter = &MetricNameFilter{}
+			}
+			if err := m.MetricNameFilter.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AsyncReplication", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.AsyncReplication = bool(v != 0)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *MetricNameFilter) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MetricNameFilter: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MetricNameFilter: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Version = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HashCount", wireType)
+			}
+			m.HashCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.HashCount |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType == 1 {
+				var v uint64
+				if (iNdEx + 8) > l {
+					return io.ErrUnexpectedEOF
+				}
+				v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+				iNdEx += 8
+				m.Bits = append(m.Bits, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowRpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthRpc
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthRpc
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				elementCount = packedLen / 8
+				if elementCount != 0 && len(m.Bits) == 0 {
+					m.Bits = make([]uint64, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					if (iNdEx + 8) > l {
+						return io.ErrUnexpectedEOF
+					}
+					v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+					iNdEx += 8
+					m.Bits = append(m.Bits, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Bits", wireType)
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LeaseMillis", wireType)
+			}
+			m.LeaseMillis = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LeaseMillis |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -108,13 +108,17 @@ func (p *BucketedBytes) Put(b *[]byte) {
 	}
 
 	sz := cap(*b)
-	for i, bktSize := range p.sizes {
-		if sz > bktSize {
-			continue
+	// Only keep slices in the largest bucket they fit, so that Get never returns a slice smaller than requested.
+	// Slices larger than the largest bucket are left to the GC instead of being retained.
+	if len(p.sizes) > 0 && sz <= p.sizes[len(p.sizes)-1] {
+		for i := len(p.sizes) - 1; i >= 0; i-- {
+			if sz < p.sizes[i] {
+				continue
+			}
+			*b = (*b)[:0]
+			p.buckets[i].Put(b)
+			break
 		}
-		*b = (*b)[:0]
-		p.buckets[i].Put(b)
-		break
 	}
 
 	p.mtx.Lock()
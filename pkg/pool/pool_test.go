@@ -64,6 +64,23 @@ func TestBytesPool(t *testing.T) {
 	testutil.Equals(t, uint64(0), chunkPool.usedTotal)
 }
 
+func TestBytesPool_PutUnsizedSlices(t *testing.T) {
+	chunkPool, err := NewBucketedBytes(10, 100, 2, 0)
+	testutil.Ok(t, err)
+
+	// Slices not borrowed from the pool are put into the largest bucket they fit.
+	b := make([]byte, 0, 30)
+	chunkPool.Put(&b)
+
+	for _, sz := range []int{11, 20, 21, 40} {
+		got, err := chunkPool.Get(sz)
+		testutil.Ok(t, err)
+		testutil.Assert(t, cap(*got) >= sz, "expected capacity of at least %d, got %d", sz, cap(*got))
+		testutil.Equals(t, 0, len(*got))
+		chunkPool.Put(got)
+	}
+}
+
 func TestRacePutGet(t *testing.T) {
 	chunkPool, err := NewBucketedBytes(3, 100, 2, 5000)
 	testutil.Ok(t, err)
@@ -128,3 +145,33 @@ func TestRacePutGet(t *testing.T) {
 	default:
 	}
 }
+
+func BenchmarkBytesPool_MixedWorkload(b *testing.B) {
+	// Requests of very different sizes, similar to chunk bytes of small and large Series calls.
+	sizes := []int{512, 16000, 100 * 1024, 700, 1024 * 1024, 16000, 3 * 1024 * 1024, 64 * 1024}
+
+	bucketed, err := NewBucketedBytes(64*1024, 64*1024*1024, 2, 0)
+	testutil.Ok(b, err)
+
+	for _, tc := range []struct {
+		name string
+		pool Bytes
+	}{
+		{name: "noop", pool: NoopBytes{}},
+		{name: "bucketed", pool: bucketed},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for n := 0; n < b.N; n++ {
+				sz := sizes[n%len(sizes)]
+				buf, err := tc.pool.Get(sz)
+				if err != nil {
+					b.Fatal(err)
+				}
+				*buf = (*buf)[:sz]
+				tc.pool.Put(buf)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package pool
+
+import (
+	"sync"
+)
+
+// TrackedBytes is a Bytes pool that keeps track of all byte slices borrowed from its parent pool, e.g. for
+// the duration of a single request. Byte slices that are still borrowed can be returned at once with ReleaseAll,
+// so that errors or cancellations in the middle of a request do not leak them from the parent pool.
+type TrackedBytes struct {
+	parent Bytes
+
+	mtx      sync.Mutex
+	borrowed map[*[]byte]uint64 // Capacity of borrowed slices when they were borrowed.
+	bytes    uint64
+}
+
+// NewTrackedBytes returns a new TrackedBytes borrowing byte slices from the given parent pool.
+func NewTrackedBytes(parent Bytes) *TrackedBytes {
+	return &TrackedBytes{
+		parent:   parent,
+		borrowed: map[*[]byte]uint64{},
+	}
+}
+
+// Get returns a new byte slice from the parent pool that fits the given size.
+func (p *TrackedBytes) Get(sz int) (*[]byte, error) {
+	b, err := p.parent.Get(sz)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.borrowed[b] = uint64(cap(*b))
+	p.bytes += uint64(cap(*b))
+	return b, nil
+}
+
+// Put returns a byte slice borrowed through this pool to the parent pool.
+// Byte slices which were not borrowed through this pool or were already returned are ignored.
+func (p *TrackedBytes) Put(b *[]byte) {
+	if b == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	sz, ok := p.borrowed[b]
+	if !ok {
+		p.mtx.Unlock()
+		return
+	}
+	delete(p.borrowed, b)
+	p.bytes -= sz
+	p.mtx.Unlock()
+
+	p.parent.Put(b)
+}
+
+// Borrowed returns the number of byte slices and their total capacity currently borrowed through this pool.
+func (p *TrackedBytes) Borrowed() (slices int, bytes uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return len(p.borrowed), p.bytes
+}
+
+// ReleaseAll returns all byte slices still borrowed through this pool to the parent pool and returns their number.
+// Byte slices must not be used anymore once they were released.
+func (p *TrackedBytes) ReleaseAll() int {
+	p.mtx.Lock()
+	borrowed := p.borrowed
+	p.borrowed = map[*[]byte]uint64{}
+	p.bytes = 0
+	p.mtx.Unlock()
+
+	for b := range borrowed {
+		p.parent.Put(b)
+	}
+	return len(borrowed)
+}
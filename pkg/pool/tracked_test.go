@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package pool
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTrackedBytes(t *testing.T) {
+	parent, err := NewBucketedBytes(10, 100, 2, 1000)
+	testutil.Ok(t, err)
+
+	p := NewTrackedBytes(parent)
+
+	b1, err := p.Get(10)
+	testutil.Ok(t, err)
+	b2, err := p.Get(40)
+	testutil.Ok(t, err)
+	b3, err := p.Get(500)
+	testutil.Ok(t, err)
+
+	slices, bytes := p.Borrowed()
+	testutil.Equals(t, 3, slices)
+	testutil.Equals(t, uint64(550), bytes)
+	testutil.Equals(t, uint64(550), parent.usedTotal)
+
+	// Growing a slice beyond its capacity does not break the accounting.
+	*b1 = append(*b1, make([]byte, 50)...)
+	p.Put(b1)
+	slices, bytes = p.Borrowed()
+	testutil.Equals(t, 2, slices)
+	testutil.Equals(t, uint64(540), bytes)
+
+	// Slices returned twice or not borrowed through the pool are ignored.
+	p.Put(b1)
+	foreign := make([]byte, 0, 80)
+	p.Put(&foreign)
+	p.Put(nil)
+	slices, _ = p.Borrowed()
+	testutil.Equals(t, 2, slices)
+
+	// Releasing returns all borrowed slices to the parent pool.
+	testutil.Equals(t, 2, p.ReleaseAll())
+	slices, bytes = p.Borrowed()
+	testutil.Equals(t, 0, slices)
+	testutil.Equals(t, uint64(0), bytes)
+	testutil.Equals(t, uint64(0), parent.usedTotal)
+
+	// Slices already released are not returned again.
+	p.Put(b2)
+	p.Put(b3)
+	testutil.Equals(t, 0, p.ReleaseAll())
+	testutil.Equals(t, uint64(0), parent.usedTotal)
+}
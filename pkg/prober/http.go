@@ -4,6 +4,7 @@
 package prober
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 
@@ -12,17 +13,38 @@ import (
 	"go.uber.org/atomic"
 )
 
+// statusCondition is the name of the readiness condition reflecting Ready and NotReady calls.
+const statusCondition = "status"
+
 type check func() bool
 
 // HTTPProbe represents health and readiness status of given component, and provides HTTP integration.
 type HTTPProbe struct {
 	ready   atomic.Uint32
 	healthy atomic.Uint32
+
+	notReadyReason atomic.String
+	readiness      *Readiness
+}
+
+// HTTPProbeOption configures HTTPProbe.
+type HTTPProbeOption func(*HTTPProbe)
+
+// WithReadiness makes the component ready only if all conditions of the given registry are met.
+func WithReadiness(r *Readiness) HTTPProbeOption {
+	return func(p *HTTPProbe) {
+		p.readiness = r
+	}
 }
 
 // NewHTTP returns HTTPProbe representing readiness and healthiness of given component.
-func NewHTTP() *HTTPProbe {
-	return &HTTPProbe{}
+func NewHTTP(opts ...HTTPProbeOption) *HTTPProbe {
+	p := &HTTPProbe{}
+	p.notReadyReason.Store("not ready yet")
+	for _, o := range opts {
+		o(p)
+	}
+	return p
 }
 
 // HealthyHandler returns a HTTP Handler which responds health checks.
@@ -30,9 +52,26 @@ func (p *HTTPProbe) HealthyHandler(logger log.Logger) http.HandlerFunc {
 	return p.handler(logger, p.isHealthy)
 }
 
-// ReadyHandler returns a HTTP Handler which responds readiness checks.
+// ReadyHandler returns a HTTP Handler which responds readiness checks. The JSON response body lists
+// the conditions blocking readiness, if any.
 func (p *HTTPProbe) ReadyHandler(logger log.Logger) http.HandlerFunc {
-	return p.handler(logger, p.IsReady)
+	return func(w http.ResponseWriter, _ *http.Request) {
+		unmet := p.unmet()
+		res := readyResponse{Ready: len(unmet) == 0, Unmet: unmet}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !res.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			level.Error(logger).Log("msg", "failed to write probe response", "err", err)
+		}
+	}
+}
+
+type readyResponse struct {
+	Ready bool             `json:"ready"`
+	Unmet []UnmetCondition `json:"unmet,omitempty"`
 }
 
 func (p *HTTPProbe) handler(logger log.Logger, c check) http.HandlerFunc {
@@ -47,10 +86,20 @@ func (p *HTTPProbe) handler(logger log.Logger, c check) http.HandlerFunc {
 	}
 }
 
-// IsReady returns true if component is ready.
+// unmet returns the conditions blocking readiness. The readiness status set through Ready and NotReady
+// is reported as the "status" condition.
+func (p *HTTPProbe) unmet() []UnmetCondition {
+	unmet := p.readiness.Unmet()
+	if p.ready.Load() == 0 {
+		unmet = append([]UnmetCondition{{Condition: statusCondition, Reason: p.notReadyReason.Load()}}, unmet...)
+	}
+	return unmet
+}
+
+// IsReady returns true if component is ready and all its readiness conditions are met.
 func (p *HTTPProbe) IsReady() bool {
 	ready := p.ready.Load()
-	return ready > 0
+	return ready > 0 && len(p.readiness.Unmet()) == 0
 }
 
 // isHealthy returns true if component is healthy.
@@ -66,8 +115,12 @@ func (p *HTTPProbe) Ready() {
 
 // NotReady sets components status to not ready with given error as a cause.
 func (p *HTTPProbe) NotReady(err error) {
+	reason := "not ready"
+	if err != nil {
+		reason = err.Error()
+	}
+	p.notReadyReason.Store(reason)
 	p.ready.Swap(0)
-
 }
 
 // Healthy sets components status to healthy.
@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package prober
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/pkg/component"
+)
+
+// Readiness is a registry of conditions which all have to be met for a component to be ready,
+// e.g. the initial block sync of a store gateway or the hashring of a receiver being loaded.
+type Readiness struct {
+	mtx        sync.Mutex
+	conditions map[string]*Condition
+
+	conditionMetric *prometheus.GaugeVec
+}
+
+// NewReadiness returns an empty readiness registry of the given component.
+func NewReadiness(component component.Component, reg prometheus.Registerer) *Readiness {
+	return &Readiness{
+		conditions: map[string]*Condition{},
+		conditionMetric: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "readiness_condition_met",
+			Help:        "Represents whether the readiness condition is met (1) or blocks readiness of the component (0).",
+			ConstLabels: map[string]string{"component": component.String()},
+		}, []string{"condition"}),
+	}
+}
+
+// Register adds a condition with the given name, initially not met, and returns it.
+// Registering the same name twice returns the same condition.
+func (r *Readiness) Register(name string) *Condition {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if c, ok := r.conditions[name]; ok {
+		return c
+	}
+	c := &Condition{name: name, reason: "not met yet", gauge: r.conditionMetric.WithLabelValues(name)}
+	c.gauge.Set(0)
+	r.conditions[name] = c
+	return c
+}
+
+// Unmet returns the conditions which are not met, sorted by name.
+// A nil Readiness has no conditions.
+func (r *Readiness) Unmet() []UnmetCondition {
+	if r == nil {
+		return nil
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var unmet []UnmetCondition
+	for _, c := range r.conditions {
+		if met, reason := c.state(); !met {
+			unmet = append(unmet, UnmetCondition{Condition: c.name, Reason: reason})
+		}
+	}
+	sort.Slice(unmet, func(i, j int) bool { return unmet[i].Condition < unmet[j].Condition })
+	return unmet
+}
+
+// UnmetCondition describes a condition blocking readiness.
+type UnmetCondition struct {
+	Condition string `json:"condition"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Condition is a single readiness condition.
+type Condition struct {
+	name  string
+	gauge prometheus.Gauge
+
+	mtx    sync.Mutex
+	met    bool
+	reason string
+}
+
+// Met marks the condition as met.
+func (c *Condition) Met() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.met, c.reason = true, ""
+	c.gauge.Set(1)
+}
+
+// Unmet marks the condition as not met with the given error as a cause.
+func (c *Condition) Unmet(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.met, c.reason = false, ""
+	if err != nil {
+		c.reason = err.Error()
+	}
+	c.gauge.Set(0)
+}
+
+func (c *Condition) state() (bool, string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.met, c.reason
+}
@@ -0,0 +1,67 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package prober
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestReadiness(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := NewReadiness(component.Store, reg)
+	p := NewHTTP(WithReadiness(r))
+
+	sync := r.Register("initial-block-sync")
+	testutil.Equals(t, sync, r.Register("initial-block-sync"))
+	hashring := r.Register("hashring-loaded")
+
+	ready := func() (int, readyResponse) {
+		rec := httptest.NewRecorder()
+		p.ReadyHandler(log.NewNopLogger())(rec, httptest.NewRequest("GET", "/-/ready", nil))
+
+		var res readyResponse
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return rec.Code, res
+	}
+
+	code, res := ready()
+	testutil.Equals(t, http.StatusServiceUnavailable, code)
+	testutil.Equals(t, readyResponse{Unmet: []UnmetCondition{
+		{Condition: statusCondition, Reason: "not ready yet"},
+		{Condition: "hashring-loaded", Reason: "not met yet"},
+		{Condition: "initial-block-sync", Reason: "not met yet"},
+	}}, res)
+
+	p.Ready()
+	sync.Met()
+	hashring.Unmet(errors.New("no hashring configured"))
+	testutil.Assert(t, !p.IsReady())
+	code, res = ready()
+	testutil.Equals(t, http.StatusServiceUnavailable, code)
+	testutil.Equals(t, readyResponse{Unmet: []UnmetCondition{{Condition: "hashring-loaded", Reason: "no hashring configured"}}}, res)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(r.conditionMetric.WithLabelValues("initial-block-sync")))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(r.conditionMetric.WithLabelValues("hashring-loaded")))
+
+	hashring.Met()
+	testutil.Assert(t, p.IsReady())
+	code, res = ready()
+	testutil.Equals(t, http.StatusOK, code)
+	testutil.Equals(t, readyResponse{Ready: true}, res)
+
+	p.NotReady(errors.New("shutting down"))
+	code, res = ready()
+	testutil.Equals(t, http.StatusServiceUnavailable, code)
+	testutil.Equals(t, readyResponse{Unmet: []UnmetCondition{{Condition: statusCondition, Reason: "shutting down"}}}, res)
+}
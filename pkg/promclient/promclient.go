@@ -106,7 +106,8 @@ func NewWithTracingClient(logger log.Logger, httpClient *http.Client, userAgent
 
 // req2xx sends a request to the given url.URL. If method is http.MethodPost then
 // the raw query is encoded in the body and the appropriate Content-Type is set.
-func (c *Client) req2xx(ctx context.Context, u *url.URL, method string) (_ []byte, _ int, err error) {
+// The given headers are added to the request.
+func (c *Client) req2xx(ctx context.Context, u *url.URL, method string, headers http.Header) (_ []byte, _ int, err error) {
 	var b io.Reader
 	if method == http.MethodPost {
 		rq := u.RawQuery
@@ -118,6 +119,11 @@ func (c *Client) req2xx(ctx context.Context, u *url.URL, method string) (_ []byt
 	if err != nil {
 		return nil, 0, errors.Wrapf(err, "create %s request", method)
 	}
+	for k, vs := range headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
 	if c.userAgent != "" {
 		req.Header.Set("User-Agent", c.userAgent)
 	}
@@ -167,7 +173,7 @@ func (c *Client) ExternalLabels(ctx context.Context, base *url.URL) (labels.Labe
 	span, ctx := tracing.StartSpan(ctx, "/prom_config HTTP[client]")
 	defer span.Finish()
 
-	body, _, err := c.req2xx(ctx, &u, http.MethodGet)
+	body, _, err := c.req2xx(ctx, &u, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +204,8 @@ type Flags struct {
 	TSDBMaxTime        model.Duration `json:"storage.tsdb.max-block-duration"`
 	WebEnableAdminAPI  bool           `json:"web.enable-admin-api"`
 	WebEnableLifecycle bool           `json:"web.enable-lifecycle"`
+	// Agent is true if Prometheus runs in agent mode, so it has no local TSDB to query or to ship blocks from.
+	Agent bool `json:"agent"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
@@ -212,6 +220,8 @@ func (f *Flags) UnmarshalJSON(b []byte) error {
 		TSDBMaxTime        modelDuration `json:"storage.tsdb.max-block-duration"`
 		WebEnableAdminAPI  modelBool     `json:"web.enable-admin-api"`
 		WebEnableLifecycle modelBool     `json:"web.enable-lifecycle"`
+		Agent              modelBool     `json:"agent"`
+		EnableFeature      string        `json:"enable-feature"`
 	}{}
 
 	if err := json.Unmarshal(b, &parsableFlags); err != nil {
@@ -225,10 +235,22 @@ func (f *Flags) UnmarshalJSON(b []byte) error {
 		TSDBMaxTime:        model.Duration(parsableFlags.TSDBMaxTime),
 		WebEnableAdminAPI:  bool(parsableFlags.WebEnableAdminAPI),
 		WebEnableLifecycle: bool(parsableFlags.WebEnableLifecycle),
+		// The --agent flag replaced --enable-feature=agent in Prometheus v2.33.
+		Agent: bool(parsableFlags.Agent) || featureEnabled(parsableFlags.EnableFeature, "agent"),
 	}
 	return nil
 }
 
+// featureEnabled returns true if the feature is in the comma separated list of enabled features.
+func featureEnabled(features, feature string) bool {
+	for _, f := range strings.Split(features, ",") {
+		if strings.TrimSpace(f) == feature {
+			return true
+		}
+	}
+	return false
+}
+
 type modelDuration model.Duration
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
@@ -237,6 +259,10 @@ func (d *modelDuration) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
 	}
+	// Prometheus in agent mode does not set the TSDB flags.
+	if s == "" {
+		return nil
+	}
 
 	dur, err := model.ParseDuration(s)
 	if err != nil {
@@ -361,6 +387,8 @@ type QueryOptions struct {
 	PartialResponseStrategy storepb.PartialResponseStrategy
 	Method                  string
 	MaxSourceResolution     string
+	// HTTPHeaders are added to the query requests, e.g. the tenant header.
+	HTTPHeaders http.Header
 }
 
 func (p *QueryOptions) AddTo(values url.Values) error {
@@ -411,7 +439,7 @@ func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string,
 		method = http.MethodGet
 	}
 
-	body, _, err := c.req2xx(ctx, &u, method)
+	body, _, err := c.req2xx(ctx, &u, method, opts.HTTPHeaders)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "read query instant response")
 	}
@@ -513,7 +541,7 @@ func (c *Client) QueryRange(ctx context.Context, base *url.URL, query string, st
 	span, ctx := tracing.StartSpan(ctx, "/prom_query_range HTTP[client]")
 	defer span.Finish()
 
-	body, _, err := c.req2xx(ctx, &u, http.MethodGet)
+	body, _, err := c.req2xx(ctx, &u, http.MethodGet, opts.HTTPHeaders)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "read query range response")
 	}
@@ -595,7 +623,7 @@ func (c *Client) AlertmanagerAlerts(ctx context.Context, base *url.URL) ([]*mode
 	span, ctx := tracing.StartSpan(ctx, "/alertmanager_alerts HTTP[client]")
 	defer span.Finish()
 
-	body, _, err := c.req2xx(ctx, &u, http.MethodGet)
+	body, _, err := c.req2xx(ctx, &u, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -626,7 +654,7 @@ func (c *Client) BuildVersion(ctx context.Context, base *url.URL) (string, error
 	defer span.Finish()
 
 	// We get status code 404 or 405 for prometheus versions lower than 2.14.0
-	body, code, err := c.req2xx(ctx, &u, http.MethodGet)
+	body, code, err := c.req2xx(ctx, &u, http.MethodGet, nil)
 	if err != nil {
 		if code == http.StatusNotFound {
 			return "0", nil
@@ -658,7 +686,7 @@ func (c *Client) get2xxResultWithGRPCErrors(ctx context.Context, spanName string
 	span, ctx := tracing.StartSpan(ctx, spanName)
 	defer span.Finish()
 
-	body, code, err := c.req2xx(ctx, u, http.MethodGet)
+	body, code, err := c.req2xx(ctx, u, http.MethodGet, nil)
 	if err != nil {
 		if code, exists := statusToCode[code]; exists && code != 0 {
 			return status.Error(code, err.Error())
@@ -5,8 +5,11 @@ package promclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -154,6 +157,53 @@ func TestRule_UnmarshalScalarResponse(t *testing.T) {
 	testutil.NotOk(t, err)
 }
 
+func TestQueryInstant_HTTPHeaders(t *testing.T) {
+	var tenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = r.Header.Get("THANOS-TENANT")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	_, _, err = NewDefaultClient().QueryInstant(context.Background(), u, "up", time.Now(), QueryOptions{
+		HTTPHeaders: http.Header{"Thanos-Tenant": []string{"team-a|team-b"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "team-a|team-b", tenant)
+}
+
+func TestFlags_UnmarshalJSON(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		input    string
+		expected Flags
+	}{
+		{
+			name:     "server",
+			input:    `{"storage.tsdb.path":"data","storage.tsdb.min-block-duration":"2h","storage.tsdb.max-block-duration":"2h","web.enable-lifecycle":"true","enable-feature":""}`,
+			expected: Flags{TSDBPath: "data", TSDBMinTime: model.Duration(2 * time.Hour), TSDBMaxTime: model.Duration(2 * time.Hour), WebEnableLifecycle: true},
+		},
+		{
+			name:     "agent feature",
+			input:    `{"storage.tsdb.min-block-duration":"2h","storage.tsdb.max-block-duration":"","enable-feature":"exemplar-storage,agent"}`,
+			expected: Flags{TSDBMinTime: model.Duration(2 * time.Hour), Agent: true},
+		},
+		{
+			name:     "agent flag",
+			input:    `{"agent":"true"}`,
+			expected: Flags{Agent: true},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var flags Flags
+			testutil.Ok(t, json.Unmarshal([]byte(tcase.input), &flags))
+			testutil.Equals(t, tcase.expected, flags)
+		})
+	}
+}
+
 func TestQueryRange_e2e(t *testing.T) {
 	e2eutil.ForeachPrometheus(t, func(t testing.TB, p *e2eutil.Prometheus) {
 		now := time.Now()
@@ -0,0 +1,329 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// QueryPhase is the phase of the execution of an active query.
+type QueryPhase string
+
+const (
+	// QueryPhaseEval is the evaluation of the query by the PromQL engine.
+	QueryPhaseEval QueryPhase = "eval"
+	// QueryPhaseSelect is the fanout of the selects of the query to the stores.
+	QueryPhaseSelect QueryPhase = "select"
+	// QueryPhaseMerge is the merge and deduplication of the series returned by the stores to the selects of the query.
+	QueryPhaseMerge QueryPhase = "merge"
+)
+
+// maxActiveQueryTenantLength is the maximum length of the tenant of active queries, longer ones are truncated.
+const maxActiveQueryTenantLength = 256
+
+// ActiveQuery is a query being executed by the querier.
+type ActiveQuery struct {
+	ID     uint64     `json:"id"`
+	Query  string     `json:"query"`
+	Tenant string     `json:"tenant,omitempty"`
+	Start  time.Time  `json:"start"`
+	Phase  QueryPhase `json:"phase"`
+}
+
+// ActiveQueryTracker tracks the queries being executed by the querier. If it has a file, the active queries are
+// written to it as they change, so that the queries which were running when the querier crashed can be logged
+// on its next start.
+type ActiveQueryTracker struct {
+	logger         log.Logger
+	maxQueryLength int
+
+	mtx     sync.Mutex
+	nextID  uint64
+	queries map[uint64]*TrackedQuery
+
+	// file holds an active query per slot of slotSize bytes, a line of JSON padded with spaces.
+	file     *os.File
+	slots    []bool
+	slotSize int
+}
+
+// NewActiveQueryTracker returns a tracker of active queries whose query text is truncated to maxQueryLength bytes. If
+// path is not empty, the queries left in the file of the previous run are logged, and up to maxQueries active queries
+// are written to it.
+func NewActiveQueryTracker(logger log.Logger, path string, maxQueries, maxQueryLength int) (*ActiveQueryTracker, error) {
+	t := &ActiveQueryTracker{
+		logger:         logger,
+		maxQueryLength: maxQueryLength,
+		queries:        map[uint64]*TrackedQuery{},
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	unfinished, err := ReadActiveQueriesFile(path)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		level.Warn(logger).Log("msg", "failed to read the active queries of the previous run", "file", path, "err", err)
+	}
+	if len(unfinished) > 0 {
+		level.Warn(logger).Log("msg", "queries which did not finish in the previous run, e.g. because of a crash", "count", len(unfinished))
+		for _, q := range unfinished {
+			level.Warn(logger).Log("msg", "unfinished query", "query", q.Query, "tenant", q.Tenant, "start", q.Start, "phase", q.Phase)
+		}
+	}
+
+	// JSON escaping makes strings up to 6 times longer.
+	t.slotSize = 6*(maxQueryLength+maxActiveQueryTenantLength) + 256
+	t.slots = make([]bool, maxQueries)
+	if t.file, err = os.Create(path); err != nil {
+		return nil, errors.Wrap(err, "create active queries file")
+	}
+	if _, err := t.file.Write(bytes.Repeat(t.emptySlot(), maxQueries)); err != nil {
+		return nil, errors.Wrap(err, "write active queries file")
+	}
+	return t, nil
+}
+
+func (t *ActiveQueryTracker) emptySlot() []byte {
+	b := bytes.Repeat([]byte{' '}, t.slotSize)
+	b[len(b)-1] = '\n'
+	return b
+}
+
+// ReadActiveQueriesFile returns the active queries written to the file of an active query tracker.
+func ReadActiveQueriesFile(path string) ([]ActiveQuery, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read active queries file")
+	}
+	var res []ActiveQuery
+	for _, l := range bytes.Split(b, []byte{'\n'}) {
+		l = bytes.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+		var q ActiveQuery
+		if err := json.Unmarshal(l, &q); err != nil {
+			return res, errors.Wrap(err, "decode active query")
+		}
+		res = append(res, q)
+	}
+	return res, nil
+}
+
+// Register tracks the query of the tenant until it is done.
+func (t *ActiveQueryTracker) Register(query, tenant string) *TrackedQuery {
+	if t == nil {
+		return nil
+	}
+	q := &TrackedQuery{
+		t:      t,
+		query:  truncateUTF8(query, t.maxQueryLength),
+		tenant: truncateUTF8(tenant, maxActiveQueryTenantLength),
+		start:  time.Now(),
+		slot:   -1,
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.nextID++
+	q.id = t.nextID
+	t.queries[q.id] = q
+	for i, used := range t.slots {
+		if !used {
+			t.slots[i] = true
+			q.slot = i
+			break
+		}
+	}
+	t.write(q)
+	return q
+}
+
+// Active returns the active queries, sorted by their start.
+func (t *ActiveQueryTracker) Active() []ActiveQuery {
+	if t == nil {
+		return nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	res := make([]ActiveQuery, 0, len(t.queries))
+	for _, q := range t.queries {
+		res = append(res, q.activeQuery())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Close closes the file of the tracker.
+func (t *ActiveQueryTracker) Close() error {
+	if t == nil || t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// write writes the query to its slot of the file, or clears its slot if the query is done. It must be called with
+// t.mtx held.
+func (t *ActiveQueryTracker) write(q *TrackedQuery) {
+	if t.file == nil || q.slot < 0 {
+		return
+	}
+	b := t.emptySlot()
+	if !q.done {
+		e, err := json.Marshal(q.activeQuery())
+		if err != nil {
+			level.Warn(t.logger).Log("msg", "failed to encode active query", "err", err)
+			return
+		}
+		// Queries whose entry does not fit in a slot, with an unlimited query length, are not written.
+		if len(e) < len(b) {
+			copy(b, e)
+		}
+	}
+	if _, err := t.file.WriteAt(b, int64(q.slot*t.slotSize)); err != nil {
+		level.Warn(t.logger).Log("msg", "failed to write active query", "err", err)
+	}
+}
+
+// TrackedQuery is a query registered to an ActiveQueryTracker. Its methods are safe to call on a nil TrackedQuery,
+// e.g. the one of a context without any.
+type TrackedQuery struct {
+	t             *ActiveQueryTracker
+	id            uint64
+	query, tenant string
+	start         time.Time
+	slot          int
+
+	// Guarded by t.mtx.
+	selecting, merging int
+	done               bool
+}
+
+// activeQuery must be called with q.t.mtx held.
+func (q *TrackedQuery) activeQuery() ActiveQuery {
+	return ActiveQuery{ID: q.id, Query: q.query, Tenant: q.tenant, Start: q.start, Phase: q.currentPhase()}
+}
+
+func (q *TrackedQuery) currentPhase() QueryPhase {
+	switch {
+	case q.selecting > 0:
+		return QueryPhaseSelect
+	case q.merging > 0:
+		return QueryPhaseMerge
+	}
+	return QueryPhaseEval
+}
+
+// update applies fn to the query and writes it to the file of the tracker if its phase changed.
+func (q *TrackedQuery) update(fn func()) {
+	if q == nil {
+		return
+	}
+	q.t.mtx.Lock()
+	defer q.t.mtx.Unlock()
+
+	before := q.currentPhase()
+	fn()
+	if q.currentPhase() != before {
+		q.t.write(q)
+	}
+}
+
+// Done stops tracking the query.
+func (q *TrackedQuery) Done() {
+	if q == nil {
+		return
+	}
+	q.t.mtx.Lock()
+	defer q.t.mtx.Unlock()
+
+	if q.done {
+		return
+	}
+	q.done = true
+	delete(q.t.queries, q.id)
+	q.t.write(q)
+	if q.slot >= 0 {
+		q.t.slots[q.slot] = false
+	}
+}
+
+// startSelect marks a select of the query as fanned out to the stores, until the returned trackedSelect is merging
+// or done.
+func (q *TrackedQuery) startSelect() *trackedSelect {
+	q.update(func() { q.selecting++ })
+	return &trackedSelect{q: q}
+}
+
+// trackedSelect is a select of a tracked query.
+type trackedSelect struct {
+	q       *TrackedQuery
+	merging bool
+}
+
+// merge marks the select as merging the series returned by the stores.
+func (s *trackedSelect) merge() {
+	s.q.update(func() {
+		s.q.selecting--
+		s.q.merging++
+	})
+	s.merging = true
+}
+
+// done marks the select as done.
+func (s *trackedSelect) done() {
+	s.q.update(func() {
+		if s.merging {
+			s.q.merging--
+			return
+		}
+		s.q.selecting--
+	})
+}
+
+type trackedQueryKey struct{}
+
+// NewContextWithTrackedQuery returns a context making the queriers created with it report the phases of the selects
+// of the query to the tracked query.
+func NewContextWithTrackedQuery(ctx context.Context, q *TrackedQuery) context.Context {
+	return context.WithValue(ctx, trackedQueryKey{}, q)
+}
+
+func trackedQueryFromContext(ctx context.Context) *TrackedQuery {
+	q, _ := ctx.Value(trackedQueryKey{}).(*TrackedQuery)
+	return q
+}
+
+// copyTrackedQuery returns a copy of the target context with the tracked query of the source context, if any.
+func copyTrackedQuery(trgt, src context.Context) context.Context {
+	if q := trackedQueryFromContext(src); q != nil {
+		return context.WithValue(trgt, trackedQueryKey{}, q)
+	}
+	return trgt
+}
+
+// truncateUTF8 truncates s to at most n bytes, without splitting a rune. A non-positive n leaves s unchanged.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
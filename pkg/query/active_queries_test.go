@@ -0,0 +1,144 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestActiveQueryTracker(t *testing.T) {
+	tracker, err := NewActiveQueryTracker(log.NewNopLogger(), "", 10, 10)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(tracker.Active()))
+
+	q1 := tracker.Register("up", "team-a")
+	// Query texts are truncated without splitting runes.
+	q2 := tracker.Register(`sum(rate({a="ééééé"}[5m]))`, "")
+
+	active := tracker.Active()
+	testutil.Equals(t, 2, len(active))
+	testutil.Equals(t, "up", active[0].Query)
+	testutil.Equals(t, "team-a", active[0].Tenant)
+	testutil.Equals(t, QueryPhaseEval, active[0].Phase)
+	testutil.Equals(t, `sum(rate({`, active[1].Query)
+
+	// A query is selecting as long as any of its selects is fanned out to the stores, then merging.
+	s1, s2 := q1.startSelect(), q1.startSelect()
+	testutil.Equals(t, QueryPhaseSelect, tracker.Active()[0].Phase)
+	s1.merge()
+	testutil.Equals(t, QueryPhaseSelect, tracker.Active()[0].Phase)
+	s2.merge()
+	testutil.Equals(t, QueryPhaseMerge, tracker.Active()[0].Phase)
+	s1.done()
+	s2.done()
+	testutil.Equals(t, QueryPhaseEval, tracker.Active()[0].Phase)
+	// Selects failing before merging are done too.
+	q1.startSelect().done()
+	testutil.Equals(t, QueryPhaseEval, tracker.Active()[0].Phase)
+
+	q1.Done()
+	q1.Done()
+	active = tracker.Active()
+	testutil.Equals(t, 1, len(active))
+	testutil.Equals(t, active[0].ID, q2.id)
+	q2.Done()
+	testutil.Equals(t, 0, len(tracker.Active()))
+
+	// Untracked queries are noops.
+	var nilTracker *ActiveQueryTracker
+	q := nilTracker.Register("up", "")
+	sel := trackedQueryFromContext(NewContextWithTrackedQuery(context.Background(), q)).startSelect()
+	sel.merge()
+	sel.done()
+	q.Done()
+	testutil.Equals(t, 0, len(nilTracker.Active()))
+}
+
+func TestActiveQueryTracker_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.active")
+
+	tracker, err := NewActiveQueryTracker(log.NewNopLogger(), path, 2, 100)
+	testutil.Ok(t, err)
+	q1 := tracker.Register("up", "team-a")
+	q2 := tracker.Register(`rate(http_requests_total{path="/"}[5m])`, "team-b")
+	// Queries beyond the number of slots of the file are only tracked in memory.
+	q3 := tracker.Register("down", "")
+	testutil.Equals(t, 3, len(tracker.Active()))
+	q2.startSelect()
+
+	written, err := ReadActiveQueriesFile(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(written))
+	for i, q := range tracker.Active()[:2] {
+		testutil.Assert(t, q.Start.Equal(written[i].Start))
+		written[i].Start = q.Start
+		testutil.Equals(t, q, written[i])
+	}
+
+	// Slots of done queries are reused.
+	q1.Done()
+	q3.Done()
+	q4 := tracker.Register("sum(up)", "")
+	written, err = ReadActiveQueriesFile(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(written))
+	testutil.Equals(t, q4.id, written[0].ID)
+	testutil.Equals(t, q2.id, written[1].ID)
+	testutil.Equals(t, QueryPhaseSelect, written[1].Phase)
+
+	// The queries left in the file, e.g. after a crash, are logged on the next start.
+	testutil.Ok(t, tracker.Close())
+	var logs bytes.Buffer
+	tracker, err = NewActiveQueryTracker(log.NewLogfmtLogger(&logs), path, 2, 100)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, tracker.Close()) }()
+	testutil.Equals(t, 2, strings.Count(logs.String(), "unfinished query"))
+	testutil.Assert(t, strings.Contains(logs.String(), `tenant=team-b`), logs.String())
+
+	written, err = ReadActiveQueriesFile(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(written))
+}
+
+func TestActiveQueryTracker_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.active")
+	tracker, err := NewActiveQueryTracker(log.NewNopLogger(), path, 5, 100)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, tracker.Close()) }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				q := tracker.Register(fmt.Sprintf("up{i=\"%d\", j=\"%d\"}", i, j), "")
+				sel := q.startSelect()
+				testutil.Assert(t, len(tracker.Active()) > 0)
+				sel.merge()
+				sel.done()
+				q.Done()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	testutil.Equals(t, 0, len(tracker.Active()))
+	written, err := ReadActiveQueriesFile(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(written))
+	for _, used := range tracker.slots {
+		testutil.Assert(t, !used)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
+)
+
+type blockStatsKey struct{}
+
+// BlockStats aggregates the statistics of the blocks queried by all the selects of a query.
+type BlockStats struct {
+	mtx    sync.Mutex
+	blocks map[string]*hintspb.BlockQueryStats
+}
+
+// NewContextWithBlockStats returns a context making the queriers created with it request the statistics of the
+// queried blocks from the stores, and the BlockStats aggregating them.
+func NewContextWithBlockStats(ctx context.Context) (context.Context, *BlockStats) {
+	s := &BlockStats{blocks: map[string]*hintspb.BlockQueryStats{}}
+	return context.WithValue(ctx, blockStatsKey{}, s), s
+}
+
+func blockStatsFromContext(ctx context.Context) *BlockStats {
+	s, _ := ctx.Value(blockStatsKey{}).(*BlockStats)
+	return s
+}
+
+// copyBlockStats returns a copy of the target context with the block stats of the source context, if any.
+func copyBlockStats(trgt, src context.Context) context.Context {
+	if s := blockStatsFromContext(src); s != nil {
+		return context.WithValue(trgt, blockStatsKey{}, s)
+	}
+	return trgt
+}
+
+func (s *BlockStats) add(stats []hintspb.BlockQueryStats) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, st := range stats {
+		if b, ok := s.blocks[st.BlockId]; ok {
+			b.Merge(st)
+			continue
+		}
+		st := st
+		s.blocks[st.BlockId] = &st
+	}
+}
+
+// Top returns the statistics of the n most expensive blocks, ordered by decreasing cost.
+func (s *BlockStats) Top(n int) []hintspb.BlockQueryStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stats := make([]hintspb.BlockQueryStats, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		stats = append(stats, *b)
+	}
+	return hintspb.TopBlockStats(stats, n)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/httpconfig"
+	"github.com/thanos-io/thanos/pkg/tls"
+)
+
+// EndpointsConfig represents the configuration of statically defined endpoints
+// with optional per-endpoint gRPC client settings.
+type EndpointsConfig struct {
+	Endpoints []EndpointConfig `yaml:"endpoints"`
+}
+
+// EndpointConfig represents the configuration of a single endpoint.
+// Settings which are not specified fall back to the ones configured with --grpc-client-* flags.
+type EndpointConfig struct {
+	Address string `yaml:"address"`
+	// Strict marks the endpoint as always used, even if the health check fails.
+	Strict bool `yaml:"strict"`
+	// TLSConfig enables TLS for the endpoint with the given settings, replacing the global gRPC client TLS settings.
+	TLSConfig *httpconfig.TLSConfig `yaml:"tls_config,omitempty"`
+	// BearerTokenFile is the path to a file with the bearer token sent with every request to the endpoint.
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+	// BasicAuth are the basic authentication credentials sent with every request to the endpoint.
+	BasicAuth httpconfig.BasicAuth `yaml:"basic_auth,omitempty"`
+}
+
+// LoadEndpointsConfig parses and validates the endpoints configuration.
+func LoadEndpointsConfig(content []byte) (EndpointsConfig, error) {
+	var cfg EndpointsConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return cfg, errors.Wrap(err, "parsing YAML content")
+	}
+
+	addrs := make(map[string]struct{}, len(cfg.Endpoints))
+	for _, e := range cfg.Endpoints {
+		if e.Address == "" {
+			return cfg, errors.New("endpoint address cannot be empty")
+		}
+		if dns.IsDynamicNode(e.Address) {
+			return cfg, errors.Errorf("%s is a dynamically specified endpoint i.e. it uses SD and that is not supported in the endpoints configuration. Use --endpoint for this", e.Address)
+		}
+		if _, ok := addrs[e.Address]; ok {
+			return cfg, errors.Errorf("duplicated endpoint address %s", e.Address)
+		}
+		addrs[e.Address] = struct{}{}
+
+		if e.BearerTokenFile != "" && !e.BasicAuth.IsZero() {
+			return cfg, errors.Errorf("endpoint %s: at most one of basic_auth and bearer_token_file must be configured", e.Address)
+		}
+		if e.BasicAuth.Password != "" && e.BasicAuth.PasswordFile != "" {
+			return cfg, errors.Errorf("endpoint %s: at most one of basic_auth password and password_file must be configured", e.Address)
+		}
+	}
+	return cfg, nil
+}
+
+// id returns a string identifying the gRPC client settings of the endpoint.
+func (c EndpointConfig) id() (string, error) {
+	c.Address = ""
+	c.Strict = false
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// dialOpts returns the gRPC dial options specific to the endpoint.
+// They are meant to be applied after the global ones, so they take precedence.
+func (c EndpointConfig) dialOpts(logger log.Logger) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if c.TLSConfig != nil {
+		tlsCfg, err := tls.NewClientConfig(logger, c.TLSConfig.CertFile, c.TLSConfig.KeyFile, c.TLSConfig.CAFile, c.TLSConfig.ServerName, c.TLSConfig.InsecureSkipVerify)
+		if err != nil {
+			return nil, errors.Wrapf(err, "building TLS config for endpoint %s", c.Address)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	}
+	if c.BearerTokenFile != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&bearerTokenFileCredentials{file: c.BearerTokenFile, requireTLS: c.TLSConfig != nil}))
+	}
+	if !c.BasicAuth.IsZero() {
+		opts = append(opts, grpc.WithPerRPCCredentials(&basicAuthCredentials{cfg: c.BasicAuth, requireTLS: c.TLSConfig != nil}))
+	}
+	return opts, nil
+}
+
+// EndpointSpecs returns gRPC endpoint specs for all configured endpoints.
+func (c EndpointsConfig) EndpointSpecs(logger log.Logger) ([]*GRPCEndpointSpec, error) {
+	specs := make([]*GRPCEndpointSpec, 0, len(c.Endpoints))
+	for _, e := range c.Endpoints {
+		id, err := e.id()
+		if err != nil {
+			return nil, errors.Wrapf(err, "endpoint %s", e.Address)
+		}
+		opts, err := e.dialOpts(logger)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, NewGRPCEndpointSpecWithDialOpts(e.Address, e.Strict, id, opts...))
+	}
+	return specs, nil
+}
+
+// bearerTokenFileCredentials sends the bearer token read from the file with every request.
+// The file is read on every request, so the token can be rotated without restart.
+type bearerTokenFileCredentials struct {
+	file       string
+	requireTLS bool
+}
+
+func (c *bearerTokenFileCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(c.file))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading bearer token file %s", c.file)
+	}
+	return map[string]string{"authorization": "Bearer " + strings.TrimSpace(string(b))}, nil
+}
+
+func (c *bearerTokenFileCredentials) RequireTransportSecurity() bool { return c.requireTLS }
+
+// basicAuthCredentials sends the basic authentication credentials with every request.
+type basicAuthCredentials struct {
+	cfg        httpconfig.BasicAuth
+	requireTLS bool
+}
+
+func (c *basicAuthCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	password := c.cfg.Password
+	if c.cfg.PasswordFile != "" {
+		b, err := ioutil.ReadFile(filepath.Clean(c.cfg.PasswordFile))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading basic auth password file %s", c.cfg.PasswordFile)
+		}
+		password = strings.TrimSpace(string(b))
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(c.cfg.Username + ":" + password))
+	return map[string]string{"authorization": "Basic " + auth}, nil
+}
+
+func (c *basicAuthCredentials) RequireTransportSecurity() bool { return c.requireTLS }
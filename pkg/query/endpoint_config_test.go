@@ -0,0 +1,142 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestLoadEndpointsConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{
+			name:    "empty",
+			content: ``,
+		},
+		{
+			name: "address only",
+			content: `endpoints:
+- address: localhost:10901`,
+		},
+		{
+			name: "TLS and bearer token",
+			content: `endpoints:
+- address: localhost:10901
+  strict: true
+  tls_config:
+    ca_file: /ca.pem
+    server_name: partner
+  bearer_token_file: /token`,
+		},
+		{
+			name: "unknown field",
+			content: `endpoints:
+- address: localhost:10901
+  unknown: true`,
+			err: true,
+		},
+		{
+			name: "empty address",
+			content: `endpoints:
+- strict: true`,
+			err: true,
+		},
+		{
+			name: "dynamic address",
+			content: `endpoints:
+- address: dns+localhost:10901`,
+			err: true,
+		},
+		{
+			name: "duplicated address",
+			content: `endpoints:
+- address: localhost:10901
+- address: localhost:10901`,
+			err: true,
+		},
+		{
+			name: "both bearer token and basic auth",
+			content: `endpoints:
+- address: localhost:10901
+  bearer_token_file: /token
+  basic_auth:
+    username: user`,
+			err: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadEndpointsConfig([]byte(tc.content))
+			if tc.err {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+		})
+	}
+}
+
+func TestEndpointsConfig_EndpointSpecs(t *testing.T) {
+	cfg, err := LoadEndpointsConfig([]byte(`endpoints:
+- address: a:10901
+- address: b:10901
+  strict: true
+  basic_auth:
+    username: user
+    password: pass`))
+	testutil.Ok(t, err)
+
+	specs, err := cfg.EndpointSpecs(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(specs))
+	testutil.Equals(t, "a:10901", specs[0].Addr())
+	testutil.Equals(t, false, specs[0].IsStrictStatic())
+	testutil.Equals(t, 0, len(specs[0].dialOpts))
+	testutil.Equals(t, "b:10901", specs[1].Addr())
+	testutil.Equals(t, true, specs[1].IsStrictStatic())
+	testutil.Equals(t, 1, len(specs[1].dialOpts))
+
+	// Same settings on a different address, or different strictness, must result in the same dial options ID.
+	cfg.Endpoints[1].Address = "c:10901"
+	cfg.Endpoints[1].Strict = false
+	specs2, err := cfg.EndpointSpecs(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, specs[0].dialOptsID, specs2[0].dialOptsID)
+	testutil.Equals(t, specs[1].dialOptsID, specs2[1].dialOptsID)
+
+	cfg.Endpoints[1].BasicAuth.Password = "changed"
+	specs3, err := cfg.EndpointSpecs(nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, specs[1].dialOptsID != specs3[1].dialOptsID, "changed settings must change dial options ID")
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("secret\n"), os.ModePerm))
+
+	md, err := (&bearerTokenFileCredentials{file: tokenFile}).GetRequestMetadata(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"authorization": "Bearer secret"}, md)
+
+	// Token is read on every request.
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("rotated"), os.ModePerm))
+	md, err = (&bearerTokenFileCredentials{file: tokenFile}).GetRequestMetadata(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"authorization": "Bearer rotated"}, md)
+
+	c := &basicAuthCredentials{}
+	c.cfg.Username, c.cfg.Password = "user", "pass"
+	md, err = c.GetRequestMetadata(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"authorization": "Basic dXNlcjpwYXNz"}, md)
+}
@@ -41,6 +41,9 @@ const (
 type GRPCEndpointSpec struct {
 	addr           string
 	isStrictStatic bool
+
+	dialOptsID string
+	dialOpts   []grpc.DialOption
 }
 
 // NewGRPCEndpointSpec creates gRPC endpoint spec.
@@ -49,6 +52,13 @@ func NewGRPCEndpointSpec(addr string, isStrictStatic bool) *GRPCEndpointSpec {
 	return &GRPCEndpointSpec{addr: addr, isStrictStatic: isStrictStatic}
 }
 
+// NewGRPCEndpointSpecWithDialOpts creates gRPC endpoint spec with dial options used only for this endpoint,
+// on top of the ones configured for the endpoint set. The dialOptsID identifies those dial options; the endpoint
+// is dialed again if it changes between updates.
+func NewGRPCEndpointSpecWithDialOpts(addr string, isStrictStatic bool, dialOptsID string, dialOpts ...grpc.DialOption) *GRPCEndpointSpec {
+	return &GRPCEndpointSpec{addr: addr, isStrictStatic: isStrictStatic, dialOptsID: dialOptsID, dialOpts: dialOpts}
+}
+
 // IsStrictStatic returns true if the endpoint has been statically defined and it is under a strict mode.
 func (es *GRPCEndpointSpec) IsStrictStatic() bool {
 	return es.isStrictStatic
@@ -177,6 +187,7 @@ type EndpointStatus struct {
 	ComponentType component.Component `json:"-"`
 	MinTime       int64               `json:"minTime"`
 	MaxTime       int64               `json:"maxTime"`
+	Capabilities  []string            `json:"capabilities"`
 }
 
 // endpointSetNodeCollector is a metric collector reporting the number of available storeAPIs for Querier.
@@ -260,6 +271,9 @@ type EndpointSet struct {
 	// Map of statuses used only by UI.
 	endpointStatuses         map[string]*EndpointStatus
 	unhealthyEndpointTimeout time.Duration
+
+	// listener is called after every update which added or removed endpoints.
+	listener func()
 }
 
 // NewEndpointSet returns a new set of Thanos APIs.
@@ -315,16 +329,27 @@ func (e *EndpointSet) Update(ctx context.Context) {
 	level.Debug(e.logger).Log("msg", "checked requested endpoints", "activeEndpoints", len(activeEndpoints), "cachedEndpoints", len(endpoints))
 
 	stats := newEndpointAPIStats()
+	changed := false
 
 	// Close endpoints which are not active this time (are not in active endpoints map).
 	for addr, er := range endpoints {
-		if _, ok := activeEndpoints[addr]; ok {
-			stats[er.ComponentType()][labelpb.PromLabelSetsToString(er.LabelSets())]++
+		if active, ok := activeEndpoints[addr]; ok {
+			if active == er {
+				stats[er.ComponentType()][labelpb.PromLabelSetsToString(er.LabelSets())]++
+				continue
+			}
+
+			// Endpoint was dialed again because its dial options changed, replace the old one.
+			er.Close()
+			delete(endpoints, addr)
+			changed = true
+			level.Info(er.logger).Log("msg", "closing endpoint replaced due to changed dial options", "address", addr)
 			continue
 		}
 
 		er.Close()
 		delete(endpoints, addr)
+		changed = true
 		e.updateEndpointStatus(er, errors.New(unhealthyEndpointMessage))
 		level.Info(er.logger).Log("msg", unhealthyEndpointMessage, "address", addr, "extLset", labelpb.PromLabelSetsToString(er.LabelSets()))
 	}
@@ -347,6 +372,7 @@ func (e *EndpointSet) Update(ctx context.Context) {
 		stats[er.ComponentType()][extLset]++
 
 		endpoints[addr] = er
+		changed = true
 		e.updateEndpointStatus(er, nil)
 
 		level.Info(e.logger).Log("msg", fmt.Sprintf("adding new %v with %+v", er.ComponentType(), er.apisPresent()), "address", addr, "extLset", extLset)
@@ -358,6 +384,15 @@ func (e *EndpointSet) Update(ctx context.Context) {
 	e.endpointsMtx.Unlock()
 
 	e.cleanUpEndpointStatuses(endpoints)
+
+	if changed && e.listener != nil {
+		e.listener()
+	}
+}
+
+// UpdateOnChange allows to add listener that will be called after every update which added or removed endpoints.
+func (e *EndpointSet) UpdateOnChange(listener func()) {
+	e.listener = listener
 }
 
 // GetStoreClients returns a list of all active stores.
@@ -370,9 +405,11 @@ func (e *EndpointSet) GetStoreClients() []store.Client {
 		if er.HasStoreAPI() {
 			// Make a new endpointRef with store client.
 			stores = append(stores, &endpointRef{
-				StoreClient: storepb.NewStoreClient(er.cc),
-				addr:        er.addr,
-				metadata:    er.metadata,
+				StoreClient:                 storepb.NewStoreClient(er.cc),
+				addr:                        er.addr,
+				metadata:                    er.metadata,
+				metricNameFilter:            er.metricNameFilter,
+				metricNameFilterLeasedUntil: er.metricNameFilterLeasedUntil,
 			})
 		}
 	}
@@ -488,9 +525,14 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 			defer cancel()
 
 			er, seenAlready := endpoints[addr]
+			if seenAlready && er.dialOptsID != spec.dialOptsID {
+				// Dial options changed, so create the new one. The old one will be closed on update.
+				seenAlready = false
+			}
 			if !seenAlready {
 				// New endpoint or was unactive and was removed in the past - create the new one.
-				conn, err := grpc.DialContext(ctx, addr, e.dialOpts...)
+				dialOpts := append(append(make([]grpc.DialOption, 0, len(e.dialOpts)+len(spec.dialOpts)), e.dialOpts...), spec.dialOpts...)
+				conn, err := grpc.DialContext(ctx, addr, dialOpts...)
 				if err != nil {
 					e.updateEndpointStatus(&endpointRef{addr: addr}, err)
 					level.Warn(e.logger).Log("msg", "update of node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr)
@@ -500,12 +542,14 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 				// Assume that StoreAPI is also exposed because if call to info service fails we will call info method of storeAPI.
 				// It will be overwritten to null if not present.
 				er = &endpointRef{
-					cc:     conn,
-					addr:   addr,
-					logger: e.logger,
+					cc:         conn,
+					addr:       addr,
+					dialOptsID: spec.dialOptsID,
+					logger:     e.logger,
 				}
 			}
 
+			requested := time.Now()
 			metadata, err := spec.Metadata(ctx, infopb.NewInfoClient(er.cc), storepb.NewStoreClient(er.cc))
 			if err != nil {
 				if !seenAlready && !spec.IsStrictStatic() {
@@ -532,7 +576,7 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 							},
 						},
 					}
-					er.Update(metadata)
+					er.Update(metadata, requested)
 				}
 
 				mtx.Lock()
@@ -542,7 +586,7 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 				return
 			}
 
-			er.Update(metadata)
+			er.Update(metadata, requested)
 			e.updateEndpointStatus(er, nil)
 
 			mtx.Lock()
@@ -577,6 +621,7 @@ func (e *EndpointSet) updateEndpointStatus(er *endpointRef, err error) {
 		status.ComponentType = er.ComponentType()
 		status.MinTime = mint
 		status.MaxTime = maxt
+		status.Capabilities = er.capabilities()
 		status.LastError = nil
 	} else {
 		status.LastError = &stringError{originalErr: err}
@@ -622,18 +667,50 @@ type endpointRef struct {
 	mtx  sync.RWMutex
 	cc   *grpc.ClientConn
 	addr string
+	// dialOptsID identifies endpoint specific dial options the connection was created with.
+	dialOptsID string
 
 	// Metadata can change during runtime.
 	metadata *endpointMetadata
+	// Decoded metric name filter of the metadata, only decoded again when its version changes, and until when it may
+	// be used.
+	metricNameFilter            *store.MetricNameFilter
+	metricNameFilterLeasedUntil time.Time
 
 	logger log.Logger
 }
 
-func (er *endpointRef) Update(metadata *endpointMetadata) {
+// Update updates the metadata of the endpoint, requested at the given time.
+func (er *endpointRef) Update(metadata *endpointMetadata, requested time.Time) {
 	er.mtx.Lock()
 	defer er.mtx.Unlock()
 
 	er.metadata = metadata
+	er.updateMetricNameFilter(requested)
+}
+
+// updateMetricNameFilter decodes the metric name filter of the metadata if its version changed, and renews its lease
+// counted from the time the metadata was requested at. er.mtx must be held for writing.
+func (er *endpointRef) updateMetricNameFilter(requested time.Time) {
+	var f *infopb.MetricNameFilter
+	if er.metadata != nil && er.metadata.Store != nil {
+		f = er.metadata.Store.MetricNameFilter
+	}
+	if f == nil {
+		er.metricNameFilter = nil
+		return
+	}
+	er.metricNameFilterLeasedUntil = requested.Add(time.Duration(f.LeaseMillis) * time.Millisecond)
+	if er.metricNameFilter != nil && er.metricNameFilter.Version() == f.Version {
+		return
+	}
+
+	filter, err := store.MetricNameFilterFromBits(f.Version, f.HashCount, f.Bits)
+	if err != nil {
+		// Without a filter, the endpoint is not skipped by metric name.
+		level.Warn(er.logger).Log("msg", "ignoring invalid metric name filter", "address", er.addr, "err", err)
+	}
+	er.metricNameFilter = filter
 }
 
 func (er *endpointRef) ComponentType() component.Component {
@@ -647,6 +724,18 @@ func (er *endpointRef) ComponentType() component.Component {
 	return component.FromString(er.metadata.ComponentType)
 }
 
+// StoreType returns the type of the store the endpoint is, UnknownStoreAPI until its metadata is known.
+func (er *endpointRef) StoreType() component.StoreAPI {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	if er.metadata == nil {
+		return component.UnknownStoreAPI
+	}
+
+	return component.FromString(er.metadata.ComponentType)
+}
+
 func (er *endpointRef) HasStoreAPI() bool {
 	er.mtx.RLock()
 	defer er.mtx.RUnlock()
@@ -723,6 +812,48 @@ func (er *endpointRef) TimeRange() (mint, maxt int64) {
 	return er.metadata.Store.MinTime, er.metadata.Store.MaxTime
 }
 
+func (er *endpointRef) SupportsWithoutReplicaLabels() bool {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	return er.metadata != nil && er.metadata.Store != nil && er.metadata.Store.SupportsWithoutReplicaLabels
+}
+
+// asyncReplication returns true if the endpoint acknowledges writes before they are replicated, so that its replicas
+// may miss some of its data.
+func (er *endpointRef) asyncReplication() bool {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	return er.metadata != nil && er.metadata.Store != nil && er.metadata.Store.AsyncReplication
+}
+
+// MetricNameFilter returns the metric name filter of the endpoint, nil if it has none or its lease expired, as the
+// endpoint may then query blocks with metric names missing from it.
+func (er *endpointRef) MetricNameFilter() *store.MetricNameFilter {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	if !time.Now().Before(er.metricNameFilterLeasedUntil) {
+		return nil
+	}
+	return er.metricNameFilter
+}
+
+// capabilities returns the optional features of the endpoint APIs.
+func (er *endpointRef) capabilities() []string {
+	var capabilities []string
+
+	if er.SupportsWithoutReplicaLabels() {
+		capabilities = append(capabilities, "withoutReplicaLabels")
+	}
+	if er.asyncReplication() {
+		capabilities = append(capabilities, "asyncReplication")
+	}
+
+	return capabilities
+}
+
 func (er *endpointRef) String() string {
 	mint, maxt := er.TimeRange()
 	return fmt.Sprintf("Addr: %s LabelSets: %v Mint: %d Maxt: %d", er.addr, labelpb.PromLabelSetsToString(er.LabelSets()), mint, maxt)
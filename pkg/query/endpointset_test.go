@@ -17,6 +17,8 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/info/infopb"
 	"github.com/thanos-io/thanos/pkg/store"
@@ -698,6 +700,61 @@ func TestEndpointSet_Update_NoneAvailable(t *testing.T) {
 	testutil.Equals(t, expected, endpointSet.endpointsMetric.storeNodes)
 }
 
+func TestEndpointSet_Update_DialOptsChanged(t *testing.T) {
+	endpoints, err := startTestEndpoints([]testEndpointMeta{
+		{
+			InfoResponse: sidecarInfo,
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("addr", addr))}}
+			},
+		},
+		{
+			InfoResponse: sidecarInfo,
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("addr", addr))}}
+			},
+		},
+	})
+	testutil.Ok(t, err)
+	defer endpoints.Close()
+
+	addrs := endpoints.EndpointAddresses()
+	dialOptsIDs := map[string]string{addrs[0]: "a", addrs[1]: "a"}
+	endpointSet := NewEndpointSet(nil, nil,
+		func() (specs []*GRPCEndpointSpec) {
+			for _, addr := range addrs {
+				specs = append(specs, NewGRPCEndpointSpecWithDialOpts(addr, false, dialOptsIDs[addr], grpc.WithUserAgent(dialOptsIDs[addr])))
+			}
+			return specs
+		},
+		testGRPCOpts, time.Minute)
+	defer endpointSet.Close()
+
+	endpointSet.Update(context.Background())
+	testutil.Equals(t, 2, len(endpointSet.endpoints))
+	first, second := endpointSet.endpoints[addrs[0]], endpointSet.endpoints[addrs[1]]
+
+	// Unchanged dial options must not cause dialing again.
+	endpointSet.Update(context.Background())
+	testutil.Assert(t, first == endpointSet.endpoints[addrs[0]], "endpoint with same dial options was dialed again")
+	testutil.Assert(t, second == endpointSet.endpoints[addrs[1]], "endpoint with same dial options was dialed again")
+
+	// Only the endpoint with changed dial options is dialed again.
+	dialOptsIDs[addrs[1]] = "b"
+	endpointSet.Update(context.Background())
+	testutil.Equals(t, 2, len(endpointSet.endpoints))
+	testutil.Assert(t, first == endpointSet.endpoints[addrs[0]], "endpoint with same dial options was dialed again")
+	testutil.Assert(t, second != endpointSet.endpoints[addrs[1]], "endpoint with changed dial options was not dialed again")
+	testutil.Equals(t, "b", endpointSet.endpoints[addrs[1]].dialOptsID)
+
+	expected := newEndpointAPIStats()
+	expected[component.Sidecar] = map[string]int{
+		fmt.Sprintf("{addr=\"%s\"}", addrs[0]): 1,
+		fmt.Sprintf("{addr=\"%s\"}", addrs[1]): 1,
+	}
+	testutil.Equals(t, expected, endpointSet.endpointsMetric.storeNodes)
+}
+
 // TestEndpoint_Update_QuerierStrict tests what happens when the strict mode is enabled/disabled.
 func TestEndpoint_Update_QuerierStrict(t *testing.T) {
 	endpoints, err := startTestEndpoints([]testEndpointMeta{
@@ -1141,6 +1198,62 @@ func TestUpdateEndpointStateForgetsPreviousErrors(t *testing.T) {
 	testutil.Equals(t, `null`, string(b))
 }
 
+func TestUpdateEndpointStateCapabilities(t *testing.T) {
+	mockEndpointSet := &EndpointSet{
+		endpointStatuses: map[string]*EndpointStatus{},
+	}
+	mockEndpointRef := &endpointRef{
+		addr: "mockedStore",
+		metadata: &endpointMetadata{
+			&infopb.InfoResponse{Store: &infopb.StoreInfo{}},
+		},
+	}
+
+	mockEndpointSet.updateEndpointStatus(mockEndpointRef, nil)
+	testutil.Assert(t, !mockEndpointRef.SupportsWithoutReplicaLabels())
+	testutil.Equals(t, 0, len(mockEndpointSet.endpointStatuses["mockedStore"].Capabilities))
+
+	mockEndpointRef.Update(&endpointMetadata{
+		&infopb.InfoResponse{Store: &infopb.StoreInfo{SupportsWithoutReplicaLabels: true}},
+	}, time.Now())
+	mockEndpointSet.updateEndpointStatus(mockEndpointRef, nil)
+	testutil.Assert(t, mockEndpointRef.SupportsWithoutReplicaLabels())
+	testutil.Equals(t, []string{"withoutReplicaLabels"}, mockEndpointSet.endpointStatuses["mockedStore"].Capabilities)
+
+	mockEndpointRef.Update(&endpointMetadata{
+		&infopb.InfoResponse{Store: &infopb.StoreInfo{AsyncReplication: true}},
+	}, time.Now())
+	mockEndpointSet.updateEndpointStatus(mockEndpointRef, nil)
+	testutil.Equals(t, []string{"asyncReplication"}, mockEndpointSet.endpointStatuses["mockedStore"].Capabilities)
+}
+
+func TestEndpointRef_MetricNameFilterLease(t *testing.T) {
+	f := store.NewMetricNameFilter(nil, 0.01)
+	metadata := func(leaseMillis int64) *endpointMetadata {
+		return &endpointMetadata{&infopb.InfoResponse{Store: &infopb.StoreInfo{MetricNameFilter: &infopb.MetricNameFilter{
+			Version:     f.Version(),
+			HashCount:   f.HashCount(),
+			Bits:        f.Bits(),
+			LeaseMillis: leaseMillis,
+		}}}}
+	}
+	er := &endpointRef{addr: "mockedStore"}
+
+	er.Update(metadata(time.Minute.Milliseconds()), time.Now())
+	testutil.Assert(t, er.MetricNameFilter() != nil)
+	testutil.Equals(t, f.Version(), er.MetricNameFilter().Version())
+
+	// The lease counts from the request of the metadata, and is renewed by each update even if the filter is the same.
+	er.Update(metadata(time.Minute.Milliseconds()), time.Now().Add(-2*time.Minute))
+	testutil.Assert(t, er.MetricNameFilter() == nil)
+	er.Update(metadata(time.Minute.Milliseconds()), time.Now())
+	testutil.Assert(t, er.MetricNameFilter() != nil)
+
+	// Filters without lease are not used.
+	er.Update(metadata(0), time.Now())
+	testutil.Assert(t, er.MetricNameFilter() == nil)
+}
+
 func exposedAPIs(c string) *APIs {
 	switch c {
 	case component.Sidecar.String():
@@ -1206,7 +1319,7 @@ func TestDeadlockLocking(t *testing.T) {
 			}
 			mockEndpointRef.Update(&endpointMetadata{
 				InfoResponse: &infopb.InfoResponse{},
-			})
+			}, time.Now())
 		}
 		return nil
 	})
@@ -204,6 +204,18 @@ func (s *storeRef) TimeRange() (int64, int64) {
 	return s.minTime, s.maxTime
 }
 
+func (s *storeRef) SupportsWithoutReplicaLabels() bool {
+	return false
+}
+
+func (s *storeRef) MetricNameFilter() *store.MetricNameFilter {
+	return nil
+}
+
+func (s *storeRef) StoreType() component.StoreAPI {
+	return s.storeType
+}
+
 func (s *storeRef) String() string {
 	mint, maxt := s.TimeRange()
 	return fmt.Sprintf("Addr: %s LabelSets: %v Mint: %d Maxt: %d", s.addr, labelpb.PromLabelSetsToString(s.LabelSets()), mint, maxt)
@@ -7,9 +7,11 @@ import (
 	"context"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/types"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,6 +25,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/tracing"
@@ -33,16 +36,18 @@ import (
 // When the replicaLabels argument is not empty it overwrites the global replicaLabels flag. This allows specifying
 // replicaLabels at query time.
 // maxResolutionMillis controls downsampling resolution that is allowed (specified in milliseconds).
+// When autoDownsampling is true, maxResolutionMillis is further lowered for each selector, so it is never coarser than half of the selector range.
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behavior of proxy.
-type QueryableCreator func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, enableQueryPushdown, skipChunks bool) storage.Queryable
+// The replicaLabelRewrites given to NewQueryableCreator are applied to the deduplicated series.
+type QueryableCreator func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, autoDownsampling, partialResponse, enableQueryPushdown, skipChunks bool) storage.Queryable
 
 // NewQueryableCreator creates QueryableCreator.
-func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration) QueryableCreator {
+func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration, replicaLabelRewrites []dedup.ReplicaLabelRewrite, sliceChunks bool) QueryableCreator {
 	duration := promauto.With(
 		extprom.WrapRegistererWithPrefix("concurrent_selects_", reg),
 	).NewHistogram(gate.DurationHistogramOpts)
 
-	return func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, enableQueryPushdown, skipChunks bool) storage.Queryable {
+	return func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, autoDownsampling, partialResponse, enableQueryPushdown, skipChunks bool) storage.Queryable {
 		return &queryable{
 			logger:              logger,
 			replicaLabels:       replicaLabels,
@@ -50,6 +55,7 @@ func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy sto
 			proxy:               proxy,
 			deduplicate:         deduplicate,
 			maxResolutionMillis: maxResolutionMillis,
+			autoDownsampling:    autoDownsampling,
 			partialResponse:     partialResponse,
 			skipChunks:          skipChunks,
 			gateProviderFn: func() gate.Gate {
@@ -58,6 +64,8 @@ func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy sto
 			maxConcurrentSelects: maxConcurrentSelects,
 			selectTimeout:        selectTimeout,
 			enableQueryPushdown:  enableQueryPushdown,
+			replicaLabelRewrites: replicaLabelRewrites,
+			sliceChunks:          sliceChunks,
 		}
 	}
 }
@@ -69,34 +77,54 @@ type queryable struct {
 	proxy                storepb.StoreServer
 	deduplicate          bool
 	maxResolutionMillis  int64
+	autoDownsampling     bool
 	partialResponse      bool
 	skipChunks           bool
 	gateProviderFn       func() gate.Gate
 	maxConcurrentSelects int
 	selectTimeout        time.Duration
 	enableQueryPushdown  bool
+	replicaLabelRewrites []dedup.ReplicaLabelRewrite
+	sliceChunks          bool
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.partialResponse, q.enableQueryPushdown, q.skipChunks, q.gateProviderFn(), q.selectTimeout), nil
+	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.autoDownsampling, q.partialResponse, q.enableQueryPushdown, q.skipChunks, q.gateProviderFn(), q.selectTimeout, q.replicaLabelRewrites, q.sliceChunks), nil
 }
 
 type querier struct {
-	ctx                 context.Context
-	logger              log.Logger
-	cancel              func()
-	mint, maxt          int64
-	replicaLabels       map[string]struct{}
-	storeDebugMatchers  [][]*labels.Matcher
-	proxy               storepb.StoreServer
-	deduplicate         bool
-	maxResolutionMillis int64
-	partialResponse     bool
-	enableQueryPushdown bool
-	skipChunks          bool
-	selectGate          gate.Gate
-	selectTimeout       time.Duration
+	ctx                  context.Context
+	logger               log.Logger
+	cancel               func()
+	mint, maxt           int64
+	replicaLabels        map[string]struct{}
+	replicaLabelRewrites []dedup.ReplicaLabelRewrite
+	storeDebugMatchers   [][]*labels.Matcher
+	proxy                storepb.StoreServer
+	deduplicate          bool
+	maxResolutionMillis  int64
+	autoDownsampling     bool
+	partialResponse      bool
+	enableQueryPushdown  bool
+	skipChunks           bool
+	sliceChunks          bool
+	selectGate           gate.Gate
+	selectTimeout        time.Duration
+
+	// selects is the scope of the selects of the current query, nil until its first select. It is canceled and
+	// replaced once the query is done, when the querier is closed, so that the querier can be used again.
+	selectsMtx sync.Mutex
+	selects    *selectsScope
+}
+
+// selectsScope is the parent context of the selects of a query, canceled once one of them failed without partial
+// response.
+type selectsScope struct {
+	ctx     context.Context
+	cancel  func()
+	errOnce sync.Once
+	err     error
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -110,9 +138,12 @@ func newQuerier(
 	proxy storepb.StoreServer,
 	deduplicate bool,
 	maxResolutionMillis int64,
+	autoDownsampling bool,
 	partialResponse, enableQueryPushdown bool, skipChunks bool,
 	selectGate gate.Gate,
 	selectTimeout time.Duration,
+	replicaLabelRewrites []dedup.ReplicaLabelRewrite,
+	sliceChunks bool,
 ) *querier {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -130,17 +161,57 @@ func newQuerier(
 		selectGate:    selectGate,
 		selectTimeout: selectTimeout,
 
-		mint:                mint,
-		maxt:                maxt,
-		replicaLabels:       rl,
-		storeDebugMatchers:  storeDebugMatchers,
-		proxy:               proxy,
-		deduplicate:         deduplicate,
-		maxResolutionMillis: maxResolutionMillis,
-		partialResponse:     partialResponse,
-		skipChunks:          skipChunks,
-		enableQueryPushdown: enableQueryPushdown,
+		mint:                 mint,
+		maxt:                 maxt,
+		replicaLabels:        rl,
+		replicaLabelRewrites: replicaLabelRewrites,
+		storeDebugMatchers:   storeDebugMatchers,
+		proxy:                proxy,
+		deduplicate:          deduplicate,
+		maxResolutionMillis:  maxResolutionMillis,
+		autoDownsampling:     autoDownsampling,
+		partialResponse:      partialResponse,
+		skipChunks:           skipChunks,
+		sliceChunks:          sliceChunks,
+		enableQueryPushdown:  enableQueryPushdown,
+	}
+}
+
+// queryValueCopiers copy the values of a query from the context of the query to another one, e.g. its trace and the
+// statistics gathered by its selects.
+var queryValueCopiers = []func(trgt, src context.Context) context.Context{
+	tracing.CopyTraceContext,
+	copyBlockStats,
+	store.CopyStoreFailures,
+	store.CopyStoreTypes,
+	copyTrackedQuery,
+	copyQueryUsage,
+	copySeriesLimit,
+}
+
+// detachedQueryContext returns a context with the values of the query of the given context, which is not canceled
+// with it.
+func detachedQueryContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	for _, copyValue := range queryValueCopiers {
+		detached = copyValue(detached, ctx)
+	}
+	return detached
+}
+
+// selectsScope returns the scope of the selects of the current query.
+func (q *querier) selectsScope() *selectsScope {
+	q.selectsMtx.Lock()
+	defer q.selectsMtx.Unlock()
+
+	if q.selects == nil {
+		// The querier has a context but it gets canceled, as soon as query evaluation is completed, by the engine.
+		// We want to prevent this from happening for the async store API calls we make while preserving the values of
+		// the query.
+		ctx, cancel := context.WithCancel(detachedQueryContext(q.ctx))
+		q.selects = &selectsScope{ctx: ctx, cancel: cancel}
 	}
+	return q.selects
 }
 
 func (q *querier) isDedupEnabled() bool {
@@ -154,6 +225,12 @@ type seriesServer struct {
 
 	seriesSet []storepb.Series
 	warnings  []string
+	// blockStats aggregates the block statistics of the response hints if set.
+	blockStats *BlockStats
+	// usage accounts the series received if set.
+	usage *QueryUsage
+	// seriesLimit fails the select once the query received too many series if set.
+	seriesLimit *SeriesLimit
 }
 
 func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
@@ -163,7 +240,21 @@ func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
 	}
 
 	if r.GetSeries() != nil {
+		if err := s.seriesLimit.addSeries(); err != nil {
+			return err
+		}
 		s.seriesSet = append(s.seriesSet, *r.GetSeries())
+		s.usage.addSeries(r.Size())
+		return nil
+	}
+
+	if r.GetHints() != nil && s.blockStats != nil {
+		resHints := &hintspb.SeriesResponseHints{}
+		if err := types.UnmarshalAny(r.GetHints(), resHints); err != nil {
+			s.warnings = append(s.warnings, errors.Wrap(err, "unmarshal series response hints").Error())
+			return nil
+		}
+		s.blockStats.add(resHints.BlockStats)
 		return nil
 	}
 
@@ -225,10 +316,9 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 		matchers[i] = m.String()
 	}
 
-	// The querier has a context but it gets canceled, as soon as query evaluation is completed, by the engine.
-	// We want to prevent this from happening for the async store API calls we make while preserving tracing context.
-	ctx := tracing.CopyTraceContext(context.Background(), q.ctx)
-	ctx, cancel := context.WithTimeout(ctx, q.selectTimeout)
+	// Selects of a query run concurrently, e.g. the ones of both sides of a binary operation, limited by the select gate.
+	scope := q.selectsScope()
+	ctx, cancel := context.WithTimeout(scope.ctx, q.selectTimeout)
 	span, ctx := tracing.StartSpan(ctx, "querier_select", opentracing.Tags{
 		"minTime":  hints.Start,
 		"maxTime":  hints.End,
@@ -244,7 +334,7 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 			err = q.selectGate.Start(ctx)
 		})
 		if err != nil {
-			promise <- storage.ErrSeriesSet(errors.Wrap(err, "failed to wait for turn"))
+			promise <- storage.ErrSeriesSet(q.selectFailed(scope, errors.Wrap(err, "failed to wait for turn")))
 			return
 		}
 		defer q.selectGate.Done()
@@ -254,7 +344,7 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 
 		set, err := q.selectFn(ctx, hints, ms...)
 		if err != nil {
-			promise <- storage.ErrSeriesSet(err)
+			promise <- storage.ErrSeriesSet(q.selectFailed(scope, err))
 			return
 		}
 
@@ -274,6 +364,32 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 	}}
 }
 
+// selectFailed cancels the other selects of the query if partial response is disabled, as the query fails anyway.
+// It returns the error of the first failed select then, so that the errors of the canceled selects do not hide it.
+func (q *querier) selectFailed(scope *selectsScope, err error) error {
+	if q.partialResponse {
+		return err
+	}
+	scope.errOnce.Do(func() {
+		scope.err = err
+		scope.cancel()
+	})
+	return scope.err
+}
+
+// maxResolutionMillisForSelect returns the maximum resolution allowed for the selector with the given hints.
+// With automatic downsampling the resolution is never coarser than half of the selector range, e.g. the one
+// of rate(x[5m]) in a subquery, to keep at least two samples in every range evaluated by the PromQL engine.
+func (q *querier) maxResolutionMillisForSelect(hints *storage.SelectHints) int64 {
+	if !q.autoDownsampling || hints.Range <= 0 {
+		return q.maxResolutionMillis
+	}
+	if maxRes := hints.Range / 2; maxRes < q.maxResolutionMillis {
+		return maxRes
+	}
+	return q.maxResolutionMillis
+}
+
 func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms ...*labels.Matcher) (storage.SeriesSet, error) {
 	sms, err := storepb.PromMatchersToMatchers(ms...)
 	if err != nil {
@@ -285,26 +401,38 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
 	ctx = context.WithValue(ctx, store.StoreMatcherKey, q.storeDebugMatchers)
 
+	sel := trackedQueryFromContext(ctx).startSelect()
+	defer sel.done()
+
 	// TODO(bwplotka): Use inprocess gRPC.
-	resp := &seriesServer{ctx: ctx}
+	resp := &seriesServer{ctx: ctx, blockStats: blockStatsFromContext(ctx), usage: queryUsageFromContext(ctx), seriesLimit: seriesLimitFromContext(ctx)}
 	var queryHints *storepb.QueryHints
 	if q.enableQueryPushdown {
 		queryHints = storeHintsFromPromHints(hints)
 	}
+	var reqHints *types.Any
+	sliceChunks := q.sliceChunks && !q.skipChunks
+	if resp.blockStats != nil || sliceChunks {
+		if reqHints, err = types.MarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: resp.blockStats != nil, SliceChunks: sliceChunks}); err != nil {
+			return nil, errors.Wrap(err, "marshal series request hints")
+		}
+	}
 	if err := q.proxy.Series(&storepb.SeriesRequest{
 		MinTime:                 hints.Start,
 		MaxTime:                 hints.End,
 		Matchers:                sms,
-		MaxResolutionWindow:     q.maxResolutionMillis,
+		MaxResolutionWindow:     q.maxResolutionMillisForSelect(hints),
 		Aggregates:              aggrs,
 		QueryHints:              queryHints,
 		PartialResponseDisabled: !q.partialResponse,
 		SkipChunks:              q.skipChunks,
 		Step:                    hints.Step,
 		Range:                   hints.Range,
+		Hints:                   reqHints,
 	}, resp); err != nil {
 		return nil, errors.Wrap(err, "proxy Series()")
 	}
+	sel.merge()
 
 	var warns storage.Warnings
 	for _, w := range resp.warnings {
@@ -350,7 +478,8 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 
 	// The merged series set assembles all potentially-overlapping time ranges of the same series into a single one.
 	// TODO(bwplotka): We could potentially dedup on chunk level, use chunk iterator for that when available.
-	return dedup.NewSeriesSet(set, q.replicaLabels, hints.Func, q.enableQueryPushdown), nil
+	// Replica labels are rewritten only after merging, so they do not change which series are deduplicated.
+	return dedup.NewReplicaLabelRewriteSeriesSet(dedup.NewSeriesSet(set, q.replicaLabels, hints.Func, q.enableQueryPushdown), q.replicaLabelRewrites), nil
 }
 
 // sortDedupLabels re-sorts the set so that the same series with different replica
@@ -448,5 +577,12 @@ func (q *querier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.War
 
 func (q *querier) Close() error {
 	q.cancel()
+
+	q.selectsMtx.Lock()
+	defer q.selectsMtx.Unlock()
+	if q.selects != nil {
+		q.selects.cancel()
+		q.selects = nil
+	}
 	return nil
 }
@@ -13,10 +13,12 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/types"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
@@ -30,6 +32,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
@@ -42,10 +45,10 @@ type sample struct {
 
 func TestQueryableCreator_MaxResolution(t *testing.T) {
 	testProxy := &testStoreServer{resps: []*storepb.SeriesResponse{}}
-	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second)
+	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second, nil, false)
 
 	oneHourMillis := int64(1*time.Hour) / int64(time.Millisecond)
-	queryable := queryableCreator(false, nil, nil, oneHourMillis, false, false, false)
+	queryable := queryableCreator(false, nil, nil, oneHourMillis, false, false, false, false)
 
 	q, err := queryable.Querier(context.Background(), 0, 42)
 	testutil.Ok(t, err)
@@ -72,7 +75,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 	}
 
 	timeout := 10 * time.Second
-	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout)(false, nil, nil, 9999999, false, false, false)
+	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout, nil, false)(false, nil, nil, 9999999, false, false, false, false)
 	engine := promql.NewEngine(
 		promql.EngineOpts{
 			MaxSamples: math.MaxInt32,
@@ -138,6 +141,324 @@ func TestQuerier_DownsampledData(t *testing.T) {
 	}
 }
 
+// resolutionStoreServer returns data of the finest resolution allowed by the request.
+type resolutionStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	raw, downsampled *storepb.SeriesResponse
+	resolution       int64
+
+	mtx       sync.Mutex
+	requested []int64
+}
+
+func (s *resolutionStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.mtx.Lock()
+	s.requested = append(s.requested, r.MaxResolutionWindow)
+	s.mtx.Unlock()
+
+	if r.MaxResolutionWindow >= s.resolution {
+		return srv.Send(s.downsampled)
+	}
+	return srv.Send(s.raw)
+}
+
+func TestQuerier_AutoDownsamplingPerSelector(t *testing.T) {
+	hourMillis := time.Hour.Milliseconds()
+
+	// Counter increasing by one every second, scraped every 15s.
+	var raw []sample
+	for ts := int64(0); ts <= 2*hourMillis; ts += 15000 {
+		raw = append(raw, sample{t: ts, v: float64(ts / 1000)})
+	}
+	// The same counter with a single sample per hour, like in blocks downsampled to 1h.
+	var downsampled []sample
+	for ts := int64(0); ts <= 2*hourMillis; ts += hourMillis {
+		downsampled = append(downsampled, sample{t: ts, v: float64(ts / 1000)})
+	}
+
+	timeout := 10 * time.Second
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+	for _, tcase := range []struct {
+		name             string
+		query            string
+		autoDownsampling bool
+
+		expectedResolution int64
+		expected           promql.Vector
+	}{
+		{
+			name:               "subquery with rate uses raw data",
+			query:              "max_over_time(rate(a[10m])[1h:10m])",
+			autoDownsampling:   true,
+			expectedResolution: (5 * time.Minute).Milliseconds(),
+			expected:           promql.Vector{{Metric: labels.Labels{}, Point: promql.Point{T: 2 * hourMillis, V: 1}}},
+		},
+		{
+			name:               "rate with range long enough uses downsampled data",
+			query:              "rate(a[2h])",
+			autoDownsampling:   true,
+			expectedResolution: hourMillis,
+			expected:           promql.Vector{{Metric: labels.Labels{}, Point: promql.Point{T: 2 * hourMillis, V: 1}}},
+		},
+		{
+			name:               "instant selector uses downsampled data",
+			query:              "a",
+			autoDownsampling:   true,
+			expectedResolution: hourMillis,
+			expected:           promql.Vector{{Metric: labels.FromStrings("__name__", "a"), Point: promql.Point{T: 2 * hourMillis, V: 7200}}},
+		},
+		{
+			name:               "explicit resolution is not changed",
+			query:              "max_over_time(rate(a[10m])[1h:10m])",
+			expectedResolution: hourMillis,
+			expected:           promql.Vector{},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			s := &resolutionStoreServer{
+				raw:         storeSeriesResponse(t, labels.FromStrings("__name__", "a"), raw),
+				downsampled: storeSeriesResponse(t, labels.FromStrings("__name__", "a"), downsampled),
+				resolution:  hourMillis,
+			}
+			q := NewQueryableCreator(nil, nil, s, 2, timeout, nil, false)(false, nil, nil, hourMillis, tcase.autoDownsampling, false, false, false)
+
+			qry, err := engine.NewInstantQuery(q, &promql.QueryOpts{}, tcase.query, timestamp.Time(2*hourMillis))
+			testutil.Ok(t, err)
+			t.Cleanup(qry.Close)
+
+			res := qry.Exec(context.Background())
+			testutil.Ok(t, res.Err)
+			v, err := res.Vector()
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, v)
+			testutil.Equals(t, []int64{tcase.expectedResolution}, s.requested)
+		})
+	}
+}
+
+// blockStatsStoreServer returns the statistics of two blocks in the response hints if the request enables query stats.
+type blockStatsStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	series *storepb.SeriesResponse
+}
+
+func (s *blockStatsStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	if err := srv.Send(s.series); err != nil {
+		return err
+	}
+	if r.Hints == nil {
+		return nil
+	}
+	reqHints := &hintspb.SeriesRequestHints{}
+	if err := types.UnmarshalAny(r.Hints, reqHints); err != nil {
+		return err
+	}
+	if !reqHints.EnableQueryStats {
+		return nil
+	}
+	resHints, err := types.MarshalAny(&hintspb.SeriesResponseHints{
+		BlockStats: []hintspb.BlockQueryStats{
+			{BlockId: "cheap", ChunksFetched: 1, ChunksFetchDurationNs: 10},
+			{BlockId: "expensive", SeriesFetched: 1, ChunksFetched: 1, SeriesFetchDurationNs: 100, ChunksFetchDurationNs: 100},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return srv.Send(storepb.NewHintsSeriesResponse(resHints))
+}
+
+func TestQuerier_BlockStats(t *testing.T) {
+	timeout := 10 * time.Second
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+	s := &blockStatsStoreServer{series: storeSeriesResponse(t, labels.FromStrings("__name__", "a"), []sample{{t: 0, v: 1}})}
+	q := NewQueryableCreator(nil, nil, s, 2, timeout, nil, false)(false, nil, nil, 0, false, false, false, false)
+
+	// Without block stats in the context, the stores are not asked for them.
+	qry, err := engine.NewInstantQuery(q, &promql.QueryOpts{}, "a + a", timestamp.Time(0))
+	testutil.Ok(t, err)
+	res := qry.Exec(context.Background())
+	testutil.Ok(t, res.Err)
+	testutil.Equals(t, 0, len(res.Warnings))
+	qry.Close()
+
+	ctx, bs := NewContextWithBlockStats(context.Background())
+	qry, err = engine.NewInstantQuery(q, &promql.QueryOpts{}, "a + a", timestamp.Time(0))
+	testutil.Ok(t, err)
+	defer qry.Close()
+	res = qry.Exec(ctx)
+	testutil.Ok(t, res.Err)
+	testutil.Equals(t, 0, len(res.Warnings))
+
+	// The statistics of both selects are aggregated per block.
+	testutil.Equals(t, []hintspb.BlockQueryStats{
+		{BlockId: "expensive", SeriesFetched: 2, ChunksFetched: 2, SeriesFetchDurationNs: 200, ChunksFetchDurationNs: 200},
+		{BlockId: "cheap", ChunksFetched: 2, ChunksFetchDurationNs: 20},
+	}, bs.Top(hintspb.MaxBlockStats))
+	testutil.Equals(t, []hintspb.BlockQueryStats{
+		{BlockId: "expensive", SeriesFetched: 2, ChunksFetched: 2, SeriesFetchDurationNs: 200, ChunksFetchDurationNs: 200},
+	}, bs.Top(1))
+}
+
+// hintsStoreServer records the hints of the Series requests it receives.
+type hintsStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	series *storepb.SeriesResponse
+	hints  []hintspb.SeriesRequestHints
+}
+
+func (s *hintsStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	reqHints := hintspb.SeriesRequestHints{}
+	if r.Hints != nil {
+		if err := types.UnmarshalAny(r.Hints, &reqHints); err != nil {
+			return err
+		}
+	}
+	s.hints = append(s.hints, reqHints)
+	return srv.Send(s.series)
+}
+
+func TestQuerier_SliceChunks(t *testing.T) {
+	timeout := 10 * time.Second
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+
+	for _, sliceChunks := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sliceChunks=%v", sliceChunks), func(t *testing.T) {
+			s := &hintsStoreServer{series: storeSeriesResponse(t, labels.FromStrings("__name__", "a"), []sample{{t: 0, v: 1}})}
+			q := NewQueryableCreator(nil, nil, s, 2, timeout, nil, sliceChunks)(false, nil, nil, 0, false, false, false, false)
+
+			qry, err := engine.NewInstantQuery(q, &promql.QueryOpts{}, "rate(a[5m])", timestamp.Time(0))
+			testutil.Ok(t, err)
+			defer qry.Close()
+			res := qry.Exec(context.Background())
+			testutil.Ok(t, res.Err)
+
+			testutil.Equals(t, []hintspb.SeriesRequestHints{{SliceChunks: sliceChunks}}, s.hints)
+		})
+	}
+}
+
+// slowStoreServer returns the series of the requested metric after a delay, or fails immediately for the failing metric.
+type slowStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	delay      time.Duration
+	failMetric string
+	resps      map[string]*storepb.SeriesResponse
+}
+
+func (s *slowStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	var metric string
+	for _, m := range r.Matchers {
+		if m.Name == labels.MetricName {
+			metric = m.Value
+		}
+	}
+	if metric == s.failMetric {
+		return errors.New("store failed")
+	}
+
+	select {
+	case <-time.After(s.delay):
+	case <-srv.Context().Done():
+		return srv.Context().Err()
+	}
+	return srv.Send(s.resps[metric])
+}
+
+func TestQuerier_FailedSelectCancelsOtherSelects(t *testing.T) {
+	timeout := time.Minute
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+
+	s := &slowStoreServer{delay: timeout, failMetric: "b"}
+	q := NewQueryableCreator(nil, nil, s, 2, timeout, nil, false)(false, nil, nil, 0, false, false, false, false)
+
+	qry, err := engine.NewInstantQuery(q, &promql.QueryOpts{}, "sum(rate(a[5m])) / sum(rate(b[5m]))", timestamp.Time(0))
+	testutil.Ok(t, err)
+	t.Cleanup(qry.Close)
+
+	// The select of a is canceled instead of waiting for the slow store, and does not hide the error of the select of b.
+	begin := time.Now()
+	res := qry.Exec(context.Background())
+	testutil.NotOk(t, res.Err)
+	testutil.Equals(t, "expanding series: proxy Series(): store failed", res.Err.Error())
+	testutil.Assert(t, time.Since(begin) < timeout/2, "query waited for the canceled select")
+}
+
+func TestQuerier_SelectsAfterFailedQuery(t *testing.T) {
+	timeout := time.Minute
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+
+	var samples []sample
+	for ts := int64(0); ts <= 5*time.Minute.Milliseconds(); ts += 15000 {
+		samples = append(samples, sample{t: ts, v: float64(ts / 1000)})
+	}
+	s := &slowStoreServer{
+		failMetric: "b",
+		resps:      map[string]*storepb.SeriesResponse{"a": storeSeriesResponse(t, labels.FromStrings("__name__", "a"), samples)},
+	}
+	q := newQuerier(context.Background(), nil, 0, 5*time.Minute.Milliseconds(), nil, nil, s, false, 0, false, false, false, false, gate.New(2), timeout, nil, false)
+	queryable := &mockedQueryable{querier: q}
+
+	qry, err := engine.NewInstantQuery(queryable, &promql.QueryOpts{}, "sum(rate(a[5m])) / sum(rate(b[5m]))", timestamp.Time(5*time.Minute.Milliseconds()))
+	testutil.Ok(t, err)
+	res := qry.Exec(context.Background())
+	testutil.NotOk(t, res.Err)
+	qry.Close()
+
+	// The engine closed the querier, which cancels the selects of the failed query but not the ones of the next query.
+	qry, err = engine.NewInstantQuery(queryable, &promql.QueryOpts{}, "sum(rate(a[5m]))", timestamp.Time(5*time.Minute.Milliseconds()))
+	testutil.Ok(t, err)
+	res = qry.Exec(context.Background())
+	testutil.Ok(t, res.Err)
+	qry.Close()
+
+	scope := q.selectsScope()
+	testutil.Ok(t, q.Close())
+	testutil.Equals(t, context.Canceled, scope.ctx.Err())
+}
+
+// BenchmarkQuerier_ConcurrentSelects shows the latency of a query with two selectors against slow stores,
+// depending on how many of its selects run concurrently.
+func BenchmarkQuerier_ConcurrentSelects(b *testing.B) {
+	var samples []sample
+	for ts := int64(0); ts <= 5*time.Minute.Milliseconds(); ts += 15000 {
+		samples = append(samples, sample{t: ts, v: float64(ts / 1000)})
+	}
+	s := &slowStoreServer{
+		delay: 20 * time.Millisecond,
+		resps: map[string]*storepb.SeriesResponse{
+			"a": storeSeriesResponse(b, labels.FromStrings("__name__", "a"), samples),
+			"b": storeSeriesResponse(b, labels.FromStrings("__name__", "b"), samples),
+		},
+	}
+
+	timeout := time.Minute
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: timeout})
+	for _, maxConcurrentSelects := range []int{1, 2} {
+		b.Run(fmt.Sprintf("max concurrent selects=%d", maxConcurrentSelects), func(b *testing.B) {
+			q := NewQueryableCreator(nil, nil, s, maxConcurrentSelects, timeout, nil, false)(false, nil, nil, 0, false, false, false, false)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				qry, err := engine.NewInstantQuery(q, &promql.QueryOpts{}, "sum(rate(a[5m])) / sum(rate(b[5m]))", timestamp.Time(5*time.Minute.Milliseconds()))
+				testutil.Ok(b, err)
+
+				res := qry.Exec(context.Background())
+				testutil.Ok(b, res.Err)
+				qry.Close()
+			}
+		})
+	}
+}
+
 var (
 	realSeriesWithStaleMarkerMint             int64 = 1587690000000 // 04/24/2020 01:00:00 GMT.
 	realSeriesWithStaleMarkerMaxt             int64 = 1587693600000 // 04/24/2020 02:00:00 GMT.
@@ -364,7 +685,7 @@ func TestQuerier_Select_AfterPromQL(t *testing.T) {
 						g := gate.New(2)
 						mq := &mockedQueryable{
 							Creator: func(mint, maxt int64) storage.Querier {
-								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout)
+								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, false, true, false, false, g, timeout, nil, false)
 							},
 						}
 						t.Cleanup(func() {
@@ -608,7 +929,7 @@ func TestQuerier_Select(t *testing.T) {
 				{dedup: true, expected: []series{tcase.expectedAfterDedup}},
 			} {
 				g := gate.New(2)
-				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout)
+				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, false, true, false, false, g, timeout, nil, false)
 				t.Cleanup(func() { testutil.Ok(t, q.Close()) })
 
 				t.Run(fmt.Sprintf("dedup=%v", sc.dedup), func(t *testing.T) {
@@ -837,7 +1158,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 100 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, 0, true, false, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, 0, false, true, false, false, g, timeout, nil, false)
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -907,7 +1228,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 5 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, 0, true, false, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, 0, false, true, false, false, g, timeout, nil, false)
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -963,6 +1284,49 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 	})
 }
 
+func TestQuerier_SelectReplicaLabelRewrite(t *testing.T) {
+	rw, err := dedup.ParseReplicaLabelRewrite("replica:source=ha-pair-{{ .cluster }}")
+	testutil.Ok(t, err)
+
+	storeAPI := &testStoreServer{
+		resps: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "1", "cluster", "1", "replica", "A"), []sample{{0, 0}, {1000, 1}}),
+			storeSeriesResponse(t, labels.FromStrings("a", "1", "cluster", "1", "replica", "B"), []sample{{0, 0}, {1000, 1}}),
+			storeSeriesResponse(t, labels.FromStrings("a", "1", "cluster", "2"), []sample{{0, 5}}),
+		},
+	}
+
+	for _, tcase := range []struct {
+		dedup    bool
+		expected []series
+	}{
+		{
+			dedup: false,
+			expected: []series{
+				{lset: labels.FromStrings("a", "1", "cluster", "1", "replica", "A"), samples: []sample{{0, 0}, {1000, 1}}},
+				{lset: labels.FromStrings("a", "1", "cluster", "1", "replica", "B"), samples: []sample{{0, 0}, {1000, 1}}},
+				{lset: labels.FromStrings("a", "1", "cluster", "2"), samples: []sample{{0, 5}}},
+			},
+		},
+		{
+			dedup: true,
+			expected: []series{
+				{lset: labels.FromStrings("a", "1", "cluster", "1", "source", "ha-pair-1"), samples: []sample{{0, 0}, {1000, 1}}},
+				{lset: labels.FromStrings("a", "1", "cluster", "2"), samples: []sample{{0, 5}}},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("dedup=%v", tcase.dedup), func(t *testing.T) {
+			timeout := 5 * time.Second
+			q := newQuerier(context.Background(), nil, 0, 3000, []string{"replica"}, nil, storeAPI, tcase.dedup, 0, false, true, false, false, gate.New(2), timeout, []dedup.ReplicaLabelRewrite{rw}, false)
+			t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+			res := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "a", "1"))
+			testSelectResponse(t, tcase.expected, res)
+		})
+	}
+}
+
 func TestSortReplicaLabel(t *testing.T) {
 	tests := []struct {
 		input       []storepb.Series
@@ -27,7 +27,7 @@ func TestMain(m *testing.M) {
 func TestQuerier_Proxy(t *testing.T) {
 	files, err := filepath.Glob("testdata/promql/**/*.test")
 	testutil.Ok(t, err)
-	testutil.Equals(t, 10, len(files), "%v", files)
+	testutil.Equals(t, 11, len(files), "%v", files)
 
 	logger := log.NewLogfmtLogger(os.Stderr)
 	t.Run("proxy", func(t *testing.T) {
@@ -39,6 +39,8 @@ func TestQuerier_Proxy(t *testing.T) {
 				component.Debug, nil, 5*time.Minute),
 			1000000,
 			5*time.Minute,
+			nil,
+			false,
 		)
 
 		createQueryableFn := func(stores []*testStore) storage.Queryable {
@@ -54,7 +56,7 @@ func TestQuerier_Proxy(t *testing.T) {
 					name:        fmt.Sprintf("store number %v", i),
 				})
 			}
-			return q(true, nil, nil, 0, false, false, false)
+			return q(true, nil, nil, 0, false, false, false, false)
 		}
 
 		for _, fn := range files {
@@ -0,0 +1,56 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+
+	"go.uber.org/atomic"
+)
+
+type queryUsageKey struct{}
+
+// QueryUsage accumulates the series and bytes fetched from the stores by all the selects of a query.
+type QueryUsage struct {
+	seriesFetched atomic.Int64
+	bytesFetched  atomic.Int64
+}
+
+// NewContextWithQueryUsage returns a context making the queriers created with it account the data they fetch from the
+// stores, and the QueryUsage accumulating it.
+func NewContextWithQueryUsage(ctx context.Context) (context.Context, *QueryUsage) {
+	u := &QueryUsage{}
+	return context.WithValue(ctx, queryUsageKey{}, u), u
+}
+
+func queryUsageFromContext(ctx context.Context) *QueryUsage {
+	u, _ := ctx.Value(queryUsageKey{}).(*QueryUsage)
+	return u
+}
+
+// copyQueryUsage returns a copy of the target context with the query usage of the source context, if any.
+func copyQueryUsage(trgt, src context.Context) context.Context {
+	if u := queryUsageFromContext(src); u != nil {
+		return context.WithValue(trgt, queryUsageKey{}, u)
+	}
+	return trgt
+}
+
+func (u *QueryUsage) addSeries(bytes int) {
+	if u == nil {
+		return
+	}
+	u.seriesFetched.Inc()
+	u.bytesFetched.Add(int64(bytes))
+}
+
+// SeriesFetched returns the number of series fetched from the stores.
+func (u *QueryUsage) SeriesFetched() int64 {
+	return u.seriesFetched.Load()
+}
+
+// BytesFetched returns the size of the series fetched from the stores, as encoded in the Series responses.
+func (u *QueryUsage) BytesFetched() int64 {
+	return u.bytesFetched.Load()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+)
+
+type seriesLimitKey struct{}
+
+// SeriesLimit limits the number of series fetched from the stores by all the selects of a query.
+type SeriesLimit struct {
+	limit    int64
+	series   atomic.Int64
+	exceeded atomic.Bool
+}
+
+// NewContextWithSeriesLimit returns a context making the selects of the queriers created with it fail, canceling their
+// Series calls, as soon as they fetched more than limit series from the stores in total, and the SeriesLimit tracking
+// it. Series are counted as fetched, i.e. before their deduplication.
+func NewContextWithSeriesLimit(ctx context.Context, limit int) (context.Context, *SeriesLimit) {
+	l := &SeriesLimit{limit: int64(limit)}
+	return context.WithValue(ctx, seriesLimitKey{}, l), l
+}
+
+func seriesLimitFromContext(ctx context.Context) *SeriesLimit {
+	l, _ := ctx.Value(seriesLimitKey{}).(*SeriesLimit)
+	return l
+}
+
+// copySeriesLimit returns a copy of the target context with the series limit of the source context, if any.
+func copySeriesLimit(trgt, src context.Context) context.Context {
+	if l := seriesLimitFromContext(src); l != nil {
+		return context.WithValue(trgt, seriesLimitKey{}, l)
+	}
+	return trgt
+}
+
+func (l *SeriesLimit) addSeries() error {
+	if l == nil {
+		return nil
+	}
+	if l.series.Inc() > l.limit {
+		l.exceeded.Store(true)
+		return errors.Errorf("the query fetched more than %d series", l.limit)
+	}
+	return nil
+}
+
+// Exceeded returns true if the selects of the query failed as they fetched more series than the limit.
+func (l *SeriesLimit) Exceeded() bool {
+	return l.exceeded.Load()
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/util/teststorage"
 
+	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
@@ -126,6 +127,8 @@ func (t *test) reset() {
 		MaxSamples:               10000,
 		Timeout:                  100 * time.Second,
 		NoStepSubqueryIntervalFn: func(int64) int64 { return durationMilliseconds(1 * time.Minute) },
+		EnableAtModifier:         true,
+		EnableNegativeOffset:     true,
 	}
 	t.rootEngine = promql.NewEngine(opts)
 
@@ -653,5 +656,11 @@ func (i inProcessClient) TimeRange() (mint, maxt int64) {
 	return r.MinTime, r.MaxTime
 }
 
+func (i inProcessClient) SupportsWithoutReplicaLabels() bool { return false }
+
+func (i inProcessClient) MetricNameFilter() *store.MetricNameFilter { return nil }
+
+func (i inProcessClient) StoreType() component.StoreAPI { return component.UnknownStoreAPI }
+
 func (i inProcessClient) String() string { return i.name }
 func (i inProcessClient) Addr() string   { return i.name }
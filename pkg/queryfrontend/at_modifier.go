@@ -0,0 +1,71 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+// AtModifierMiddleware creates a new Middleware that replaces the start() and end() of @ modifiers in range queries
+// with the requested start and end. Following middlewares change the range of requests, e.g. to align it with the step
+// or to query only a part of it with downsampled data, which would otherwise move the time the modifiers select data at.
+func AtModifierMiddleware() queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return atModifier{next: next}
+	})
+}
+
+type atModifier struct {
+	next queryrange.Handler
+}
+
+func (a atModifier) Do(ctx context.Context, req queryrange.Request) (queryrange.Response, error) {
+	if !strings.Contains(req.GetQuery(), "@") {
+		return a.next.Do(ctx, req)
+	}
+
+	expr, err := parser.ParseExpr(req.GetQuery())
+	if err != nil {
+		// Let the querier report the invalid query.
+		return a.next.Do(ctx, req)
+	}
+	if !resolveAtModifiers(expr, req.GetStart(), req.GetEnd()) {
+		return a.next.Do(ctx, req)
+	}
+	return a.next.Do(ctx, req.WithQuery(expr.String()))
+}
+
+// resolveAtModifiers replaces start() and end() of all @ modifiers of the expression with the given timestamps.
+// It returns true if any modifier was replaced.
+func resolveAtModifiers(expr parser.Expr, start, end int64) bool {
+	resolve := func(startOrEnd *parser.ItemType, ts **int64) bool {
+		switch *startOrEnd {
+		case parser.START:
+			*ts = &start
+		case parser.END:
+			*ts = &end
+		default:
+			return false
+		}
+		*startOrEnd = 0
+		return true
+	}
+
+	var resolved bool
+	parser.Inspect(expr, func(n parser.Node, _ []parser.Node) error {
+		switch e := n.(type) {
+		case *parser.VectorSelector:
+			resolved = resolve(&e.StartOrEnd, &e.Timestamp) || resolved
+		case *parser.SubqueryExpr:
+			resolved = resolve(&e.StartOrEnd, &e.Timestamp) || resolved
+		}
+		return nil
+	})
+	return resolved
+}
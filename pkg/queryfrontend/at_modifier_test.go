@@ -0,0 +1,80 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestAtModifierMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		query    string
+		expected string
+	}{
+		{
+			desc:     "no @ modifier",
+			query:    `rate(foo[5m])`,
+			expected: `rate(foo[5m])`,
+		},
+		{
+			desc:     "constant @ modifier unchanged",
+			query:    `foo @ 100.000`,
+			expected: `foo @ 100.000`,
+		},
+		{
+			desc:     "start() and end() resolved",
+			query:    `rate(foo[5m] @ start()) / bar @ end()`,
+			expected: `rate(foo[5m] @ 60.000) / bar @ 600.000`,
+		},
+		{
+			desc:     "subquery resolved",
+			query:    `max_over_time(rate(foo[5m])[1h:1m] @ start() offset -10m)`,
+			expected: `max_over_time(rate(foo[5m])[1h:1m] @ 60.000 offset -10m)`,
+		},
+		{
+			desc:     "invalid query passed through",
+			query:    `foo @ start(`,
+			expected: `foo @ start(`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got queryrange.Request
+			next := queryrange.HandlerFunc(func(_ context.Context, req queryrange.Request) (queryrange.Response, error) {
+				got = req
+				return &queryrange.PrometheusResponse{}, nil
+			})
+
+			req := &ThanosQueryRangeRequest{Start: 60000, End: 600000, Step: 60000, Query: tc.query}
+			_, err := AtModifierMiddleware().Wrap(next).Do(context.Background(), req)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, got.GetQuery())
+			testutil.Equals(t, tc.query, req.Query)
+		})
+	}
+}
+
+func TestAtModifierMiddleware_RangeChanged(t *testing.T) {
+	var got queryrange.Request
+	next := queryrange.HandlerFunc(func(_ context.Context, req queryrange.Request) (queryrange.Response, error) {
+		got = req
+		return &queryrange.PrometheusResponse{}, nil
+	})
+
+	// Snapping the step moves the start of the request, @ start() still selects data at the requested start.
+	req := &ThanosQueryRangeRequest{Start: 70000, End: 610000, Step: 28000, Query: `foo @ start()`}
+	h := queryrange.MergeMiddlewares(
+		AtModifierMiddleware(),
+		SnapStepMiddleware(time.Minute, nil, true, nil),
+	).Wrap(next)
+	_, err := h.Do(context.Background(), req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(60000), got.GetStart())
+	testutil.Equals(t, `foo @ 70.000`, got.GetQuery())
+}
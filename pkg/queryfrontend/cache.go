@@ -4,17 +4,27 @@
 package queryfrontend
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 )
 
+// rangeCacheKeyVersion is the version of the format of the cache keys of range queries. It is part of the keys, so
+// that results cached with keys of other formats are missed rather than merged with results computed differently.
+// Version 2 added the execution fingerprint of the queries.
+const rangeCacheKeyVersion = 2
+
 // thanosCacheKeyGenerator is a utility for using split interval when determining cache keys.
 type thanosCacheKeyGenerator struct {
 	interval    time.Duration
 	resolutions []int64
+	// invalidations, if set, versions the keys with the generation of the invalidations of their interval.
+	invalidations *cacheInvalidations
 }
 
 func newThanosCacheKeyGenerator(interval time.Duration) thanosCacheKeyGenerator {
@@ -28,12 +38,24 @@ func newThanosCacheKeyGenerator(interval time.Duration) thanosCacheKeyGenerator
 // TODO(yeya24): Add other request params as request key.
 func (t thanosCacheKeyGenerator) GenerateCacheKey(userID string, r queryrange.Request) string {
 	currentInterval := r.GetStart() / t.interval.Milliseconds()
+	key := t.generateCacheKey(userID, r, currentInterval)
+	if t.invalidations == nil {
+		return key
+	}
+	start := currentInterval * t.interval.Milliseconds()
+	if gen := t.invalidations.generation(context.Background(), userID, start, start+t.interval.Milliseconds()-1); gen > 0 {
+		return fmt.Sprintf("%s:%d", key, gen)
+	}
+	return key
+}
+
+func (t thanosCacheKeyGenerator) generateCacheKey(userID string, r queryrange.Request, currentInterval int64) string {
 	switch tr := r.(type) {
 	case *ThanosQueryRangeRequest:
 		i := 0
 		for ; i < len(t.resolutions) && t.resolutions[i] > tr.MaxSourceResolution; i++ {
 		}
-		return fmt.Sprintf("fe:%s:%s:%d:%d:%d", userID, tr.Query, tr.Step, currentInterval, i)
+		return fmt.Sprintf("fe:v%d:%s:%s:%d:%d:%d:%s", rangeCacheKeyVersion, userID, tr.Query, tr.Step, currentInterval, i, executionFingerprint(tr))
 	case *ThanosLabelsRequest:
 		return fmt.Sprintf("fe:%s:%s:%s:%d", userID, tr.Label, tr.Matchers, currentInterval)
 	case *ThanosSeriesRequest:
@@ -41,3 +63,12 @@ func (t thanosCacheKeyGenerator) GenerateCacheKey(userID string, r queryrange.Re
 	}
 	return fmt.Sprintf("fe:%s:%s:%d:%d", userID, r.GetQuery(), r.GetStep(), currentInterval)
 }
+
+// executionFingerprint returns the parameters of the range query changing how its result is computed, other than its
+// query, step and resolution level.
+func executionFingerprint(r *ThanosQueryRangeRequest) string {
+	replicaLabels := make([]string, len(r.ReplicaLabels))
+	copy(replicaLabels, r.ReplicaLabels)
+	sort.Strings(replicaLabels)
+	return fmt.Sprintf("dedup=%t;partial=%t;replicas=%s", r.Dedup, r.PartialResponse, strings.Join(replicaLabels, ","))
+}
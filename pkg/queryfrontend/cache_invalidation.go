@@ -0,0 +1,197 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/chunk/cache"
+	"github.com/thanos-io/thanos/internal/cortex/tenant"
+)
+
+const (
+	// cacheInvalidationsRefreshInterval is how often the invalidations of a tenant are fetched from the results cache
+	// to pick up the ones made through other frontends.
+	cacheInvalidationsRefreshInterval = 10 * time.Second
+	// maxCacheInvalidations is the number of invalidations kept per tenant, beyond which the oldest ones are merged.
+	maxCacheInvalidations = 100
+)
+
+// cacheInvalidation invalidates the cached results of a tenant within a time range.
+type cacheInvalidation struct {
+	// Generation is the time in nanoseconds the invalidation was made at, it identifies the invalidation across
+	// frontends.
+	Generation int64 `json:"generation"`
+	Start      int64 `json:"start"`
+	End        int64 `json:"end"`
+}
+
+// cacheInvalidations keeps the invalidations of the cached results of each tenant. Instead of deleting the cached
+// results, which the caches do not allow to enumerate, cache keys embed the generation of the latest invalidation
+// overlapping their interval, so that results cached before the invalidation are not looked up anymore and expire.
+// The invalidations are stored in the results cache too, so that all the frontends sharing the cache use them.
+type cacheInvalidations struct {
+	logger log.Logger
+	cache  cache.Cache
+	now    func() time.Time
+
+	mtx     sync.Mutex
+	tenants map[string]*tenantCacheInvalidations
+}
+
+type tenantCacheInvalidations struct {
+	invalidations []cacheInvalidation
+	fetchedAt     time.Time
+}
+
+func newCacheInvalidations(logger log.Logger) *cacheInvalidations {
+	return &cacheInvalidations{
+		logger:  logger,
+		now:     time.Now,
+		tenants: map[string]*tenantCacheInvalidations{},
+	}
+}
+
+// generation returns the generation of the latest invalidation of the tenant overlapping the given time range in
+// milliseconds, or 0 if there is none.
+func (c *cacheInvalidations) generation(ctx context.Context, tenantID string, start, end int64) int64 {
+	var gen int64
+	for _, inv := range c.load(ctx, tenantID, false) {
+		if inv.Start <= end && inv.End >= start && inv.Generation > gen {
+			gen = inv.Generation
+		}
+	}
+	return gen
+}
+
+// invalidate invalidates the cached results of the tenant within the given time range in milliseconds.
+func (c *cacheInvalidations) invalidate(ctx context.Context, tenantID string, start, end int64) {
+	invalidations := c.update(tenantID, append(c.load(ctx, tenantID, true), cacheInvalidation{
+		Generation: c.now().UnixNano(),
+		Start:      start,
+		End:        end,
+	}))
+	c.store(ctx, tenantID, invalidations)
+}
+
+// load returns the invalidations of the tenant, merged with the ones stored in the cache if they were not fetched
+// within the refresh interval or force is set.
+func (c *cacheInvalidations) load(ctx context.Context, tenantID string, force bool) []cacheInvalidation {
+	c.mtx.Lock()
+	t, ok := c.tenants[tenantID]
+	if !ok {
+		t = &tenantCacheInvalidations{}
+		c.tenants[tenantID] = t
+	}
+	invalidations := t.invalidations
+	fresh := !force && c.now().Sub(t.fetchedAt) < cacheInvalidationsRefreshInterval
+	c.mtx.Unlock()
+
+	if fresh {
+		return invalidations
+	}
+
+	var stored []cacheInvalidation
+	found, bufs, _ := c.cache.Fetch(ctx, []string{cacheInvalidationsKey(tenantID)})
+	if len(found) == 1 {
+		if err := json.Unmarshal(bufs[0], &stored); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to decode cache invalidations", "tenant", tenantID, "err", err)
+		}
+	}
+	stored = mergeCacheInvalidations(stored)
+
+	invalidations = c.update(tenantID, stored)
+	// Store the invalidations back if the stored ones miss some, e.g. because they were evicted.
+	if !reflect.DeepEqual(invalidations, stored) {
+		c.store(ctx, tenantID, invalidations)
+	}
+	return invalidations
+}
+
+// update merges the given invalidations into the ones of the tenant and returns the result.
+func (c *cacheInvalidations) update(tenantID string, invalidations []cacheInvalidation) []cacheInvalidation {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t := c.tenants[tenantID]
+	t.invalidations = mergeCacheInvalidations(append(append([]cacheInvalidation{}, invalidations...), t.invalidations...))
+	t.fetchedAt = c.now()
+	return t.invalidations
+}
+
+func (c *cacheInvalidations) store(ctx context.Context, tenantID string, invalidations []cacheInvalidation) {
+	buf, err := json.Marshal(invalidations)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to encode cache invalidations", "tenant", tenantID, "err", err)
+		return
+	}
+	c.cache.Store(ctx, []string{cacheInvalidationsKey(tenantID)}, [][]byte{buf})
+}
+
+// mergeCacheInvalidations deduplicates the invalidations and sorts them by generation. Beyond maxCacheInvalidations,
+// the oldest invalidations are merged into one covering their time ranges with the latest of their generations, which
+// only invalidates more cached results.
+func mergeCacheInvalidations(invalidations []cacheInvalidation) []cacheInvalidation {
+	sort.Slice(invalidations, func(i, j int) bool {
+		return invalidations[i].Generation < invalidations[j].Generation
+	})
+	merged := make([]cacheInvalidation, 0, len(invalidations))
+	for _, inv := range invalidations {
+		if len(merged) > 0 && merged[len(merged)-1] == inv {
+			continue
+		}
+		merged = append(merged, inv)
+	}
+	for len(merged) > maxCacheInvalidations {
+		if merged[1].Start > merged[0].Start {
+			merged[1].Start = merged[0].Start
+		}
+		if merged[1].End < merged[0].End {
+			merged[1].End = merged[0].End
+		}
+		merged = merged[1:]
+	}
+	return merged
+}
+
+func cacheInvalidationsKey(tenantID string) string {
+	return cache.HashKey("fe-invalidations:" + tenantID)
+}
+
+// serveHTTP invalidates the cached results of the tenant of the request within its start and end parameters, which
+// default to the whole time range.
+func (c *cacheInvalidations) serveHTTP(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodPost {
+		return nil, httpgrpc.Errorf(http.StatusMethodNotAllowed, "cache invalidation requires a POST request")
+	}
+	tenantIDs, err := tenant.TenantIDs(r.Context())
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+	start, end, err := parseMetadataTimeRange(r, 0)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	tenantID := tenant.JoinTenantIDs(tenantIDs)
+	c.invalidate(r.Context(), tenantID, start, end)
+	level.Info(c.logger).Log("msg", "invalidated cached results", "tenant", tenantID, "start", start, "end", end)
+
+	return &http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    r,
+	}, nil
+}
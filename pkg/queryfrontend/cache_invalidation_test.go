@@ -0,0 +1,77 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/thanos-io/thanos/internal/cortex/chunk/cache"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCacheInvalidations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	newInvalidations := func(c cache.Cache) *cacheInvalidations {
+		inv := newCacheInvalidations(log.NewNopLogger())
+		inv.cache = c
+		inv.now = func() time.Time { return now }
+		return inv
+	}
+	c := cache.NewMockCache()
+	frontend1, frontend2 := newInvalidations(c), newInvalidations(c)
+
+	testutil.Equals(t, int64(0), frontend1.generation(ctx, "a", 0, 100))
+	testutil.Equals(t, int64(0), frontend2.generation(ctx, "a", 0, 100))
+
+	frontend1.invalidate(ctx, "a", 50, 60)
+	gen := now.UnixNano()
+	testutil.Equals(t, gen, frontend1.generation(ctx, "a", 0, 100))
+	testutil.Equals(t, gen, frontend1.generation(ctx, "a", 60, 100))
+	testutil.Equals(t, int64(0), frontend1.generation(ctx, "a", 61, 100))
+	testutil.Equals(t, int64(0), frontend1.generation(ctx, "b", 0, 100))
+
+	// The other frontend picks up the invalidation once its invalidations are refreshed.
+	testutil.Equals(t, int64(0), frontend2.generation(ctx, "a", 0, 100))
+	now = now.Add(cacheInvalidationsRefreshInterval)
+	testutil.Equals(t, gen, frontend2.generation(ctx, "a", 0, 100))
+
+	// Invalidations evicted from the cache are stored again.
+	evicted := cache.NewMockCache()
+	frontend1.cache = evicted
+	now = now.Add(cacheInvalidationsRefreshInterval)
+	testutil.Equals(t, gen, frontend1.generation(ctx, "a", 0, 100))
+	testutil.Equals(t, gen, newInvalidations(evicted).generation(ctx, "a", 0, 100))
+
+	// The latest invalidation overlapping the range is used.
+	now = now.Add(time.Second)
+	frontend2.invalidate(ctx, "a", 0, 55)
+	testutil.Equals(t, now.UnixNano(), frontend2.generation(ctx, "a", 50, 100))
+	testutil.Equals(t, gen, frontend2.generation(ctx, "a", 56, 100))
+}
+
+func TestMergeCacheInvalidations(t *testing.T) {
+	testutil.Equals(t, []cacheInvalidation{
+		{Generation: 1, Start: 0, End: 10},
+		{Generation: 2, Start: 5, End: 20},
+	}, mergeCacheInvalidations([]cacheInvalidation{
+		{Generation: 2, Start: 5, End: 20},
+		{Generation: 1, Start: 0, End: 10},
+		{Generation: 2, Start: 5, End: 20},
+	}))
+
+	var invalidations []cacheInvalidation
+	for i := int64(0); i < maxCacheInvalidations+2; i++ {
+		invalidations = append(invalidations, cacheInvalidation{Generation: i + 1, Start: 10 * i, End: 10*i + 5})
+	}
+	merged := mergeCacheInvalidations(invalidations)
+	testutil.Equals(t, maxCacheInvalidations, len(merged))
+	// The oldest invalidations are merged into the next one.
+	testutil.Equals(t, cacheInvalidation{Generation: 3, Start: 0, End: 25}, merged[0])
+	testutil.Equals(t, invalidations[len(invalidations)-1], merged[len(merged)-1])
+}
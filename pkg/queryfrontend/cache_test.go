@@ -37,7 +37,7 @@ func TestGenerateCacheKey(t *testing.T) {
 				Start: 0,
 				Step:  60 * seconds,
 			},
-			expected: "fe::up:60000:0:2",
+			expected: "fe:v2::up:60000:0:2:dedup=false;partial=false;replicas=",
 		},
 		{
 			name: "10s step",
@@ -46,7 +46,7 @@ func TestGenerateCacheKey(t *testing.T) {
 				Start: 0,
 				Step:  10 * seconds,
 			},
-			expected: "fe::up:10000:0:2",
+			expected: "fe:v2::up:10000:0:2:dedup=false;partial=false;replicas=",
 		},
 		{
 			name: "1m downsampling resolution",
@@ -56,7 +56,7 @@ func TestGenerateCacheKey(t *testing.T) {
 				Step:                10 * seconds,
 				MaxSourceResolution: 60 * seconds,
 			},
-			expected: "fe::up:10000:0:2",
+			expected: "fe:v2::up:10000:0:2:dedup=false;partial=false;replicas=",
 		},
 		{
 			name: "5m downsampling resolution, different cache key",
@@ -66,7 +66,7 @@ func TestGenerateCacheKey(t *testing.T) {
 				Step:                10 * seconds,
 				MaxSourceResolution: 300 * seconds,
 			},
-			expected: "fe::up:10000:0:1",
+			expected: "fe:v2::up:10000:0:1:dedup=false;partial=false;replicas=",
 		},
 		{
 			name: "1h downsampling resolution, different cache key",
@@ -76,7 +76,28 @@ func TestGenerateCacheKey(t *testing.T) {
 				Step:                10 * seconds,
 				MaxSourceResolution: hour,
 			},
-			expected: "fe::up:10000:0:0",
+			expected: "fe:v2::up:10000:0:0:dedup=false;partial=false;replicas=",
+		},
+		{
+			name: "dedup and replica labels, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:         "up",
+				Start:         0,
+				Step:          10 * seconds,
+				Dedup:         true,
+				ReplicaLabels: []string{"replica", "prometheus"},
+			},
+			expected: "fe:v2::up:10000:0:2:dedup=true;partial=false;replicas=prometheus,replica",
+		},
+		{
+			name: "partial response, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:           "up",
+				Start:           0,
+				Step:            10 * seconds,
+				PartialResponse: true,
+			},
+			expected: "fe:v2::up:10000:0:2:dedup=false;partial=true;replicas=",
 		},
 		{
 			name: "label names, no matcher",
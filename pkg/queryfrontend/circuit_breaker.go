@@ -0,0 +1,251 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+)
+
+// CircuitBreakerConfig configures the circuit breaker of the downstream roundtripper.
+type CircuitBreakerConfig struct {
+	// ErrorRatio is the ratio of failed requests within a window above which the circuit opens. 0 disables the breaker.
+	ErrorRatio float64
+	// MinRequests is the minimum number of requests within a window for the circuit to open.
+	MinRequests int
+	// Window is the duration of the windows in which the requests and failures are counted.
+	Window time.Duration
+	// OpenDuration is the duration during which the requests are rejected once the circuit opened, before a probe
+	// request is let through.
+	OpenDuration time.Duration
+}
+
+// Enabled tells whether the circuit breaker is enabled.
+func (cfg CircuitBreakerConfig) Enabled() bool {
+	return cfg.ErrorRatio > 0
+}
+
+func (cfg CircuitBreakerConfig) validate() error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.ErrorRatio > 1 {
+		return errors.New("circuit breaker error ratio must be between 0 and 1")
+	}
+	if cfg.Window <= 0 || cfg.OpenDuration <= 0 {
+		return errors.New("circuit breaker window and open duration must be greater than 0")
+	}
+	return nil
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var circuitStates = []circuitState{circuitClosed, circuitOpen, circuitHalfOpen}
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker is a roundtripper which stops sending requests to the downstream while too many of them fail, so
+// that crash-looping queriers are not flooded with requests and retries. While the circuit is open, the requests are
+// rejected right away with 503 and a Retry-After header. Once the open duration is over, the circuit is half-open:
+// a single probe request is let through at a time, which closes the circuit if it succeeds and opens it again
+// otherwise.
+type circuitBreaker struct {
+	next       http.RoundTripper
+	cfg        CircuitBreakerConfig
+	logger     log.Logger
+	downstream string
+	now        func() time.Time
+
+	mtx         sync.Mutex
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openUntil   time.Time
+	probing     bool
+
+	stateGauge *prometheus.GaugeVec
+	rejected   prometheus.Counter
+}
+
+// NewCircuitBreakerRoundTripper returns a roundtripper breaking the circuit to the downstream of the given URL when
+// too many requests to it fail with 5xx or a non-HTTP error.
+func NewCircuitBreakerRoundTripper(next http.RoundTripper, downstreamURL string, cfg CircuitBreakerConfig, reg prometheus.Registerer, logger log.Logger) http.RoundTripper {
+	cb := &circuitBreaker{
+		next:       next,
+		cfg:        cfg,
+		logger:     logger,
+		downstream: downstreamURL,
+		now:        time.Now,
+		stateGauge: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_query_frontend_downstream_circuit_breaker_state",
+			Help: "1 for the current state of the circuit breaker of the downstream, 0 for the others.",
+		}, []string{"downstream", "state"}),
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_downstream_circuit_breaker_rejected_requests_total",
+			Help: "Total number of requests rejected because the circuit breaker of the downstream was open.",
+		}, []string{"downstream"}).WithLabelValues(downstreamURL),
+	}
+	cb.windowStart = cb.now()
+	cb.setState(circuitClosed)
+	return cb
+}
+
+func (cb *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe, retryAfter, ok := cb.allow()
+	if !ok {
+		cb.rejected.Inc()
+		return nil, circuitOpenError(retryAfter)
+	}
+
+	resp, err := cb.next.RoundTrip(req)
+	switch {
+	case errors.Is(req.Context().Err(), context.Canceled):
+		// The client went away, this tells nothing about the downstream.
+		cb.record(probe, false, true)
+	case err != nil:
+		cb.record(probe, true, false)
+	default:
+		cb.record(probe, resp.StatusCode/100 == 5, false)
+	}
+	return resp, err
+}
+
+// allow tells whether a request can be sent to the downstream, and if so, whether it is a probe of the half-open
+// circuit. Otherwise, it returns the time after which the request can be retried.
+func (cb *circuitBreaker) allow() (probe bool, retryAfter time.Duration, ok bool) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	now := cb.now()
+	if cb.state == circuitOpen {
+		if now.Before(cb.openUntil) {
+			return false, cb.openUntil.Sub(now), false
+		}
+		cb.setState(circuitHalfOpen)
+	}
+	if cb.state == circuitHalfOpen {
+		if cb.probing {
+			return false, cb.cfg.OpenDuration, false
+		}
+		cb.probing = true
+		return true, 0, true
+	}
+	return false, 0, true
+}
+
+// record records the outcome of a request sent to the downstream, ignored if it tells nothing about the downstream.
+func (cb *circuitBreaker) record(probe, failed, ignored bool) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	now := cb.now()
+	if probe {
+		cb.probing = false
+		switch {
+		case ignored:
+		case failed:
+			cb.open(now)
+		default:
+			level.Info(cb.logger).Log("msg", "downstream probe succeeded, closing circuit", "downstream", cb.downstream)
+			cb.setState(circuitClosed)
+			cb.resetWindow(now)
+		}
+		return
+	}
+	if ignored || cb.state != circuitClosed {
+		// Requests sent before the circuit opened don't count anymore.
+		return
+	}
+
+	if now.Sub(cb.windowStart) >= cb.cfg.Window {
+		cb.resetWindow(now)
+	}
+	cb.requests++
+	if failed {
+		cb.failures++
+	}
+	if cb.requests >= cb.cfg.MinRequests && float64(cb.failures)/float64(cb.requests) >= cb.cfg.ErrorRatio {
+		level.Warn(cb.logger).Log("msg", "too many downstream requests failed, opening circuit", "downstream", cb.downstream,
+			"requests", cb.requests, "failures", cb.failures, "open_duration", cb.cfg.OpenDuration)
+		cb.open(now)
+	}
+}
+
+func (cb *circuitBreaker) open(now time.Time) {
+	cb.openUntil = now.Add(cb.cfg.OpenDuration)
+	cb.setState(circuitOpen)
+}
+
+func (cb *circuitBreaker) resetWindow(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+}
+
+func (cb *circuitBreaker) setState(state circuitState) {
+	cb.state = state
+	for _, s := range circuitStates {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		cb.stateGauge.WithLabelValues(cb.downstream, s.String()).Set(v)
+	}
+}
+
+// circuitOpenError returns the error of the requests rejected while the circuit is open, served as a 503 response with
+// a Retry-After header.
+func circuitOpenError(retryAfter time.Duration) error {
+	return httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
+		Code: http.StatusServiceUnavailable,
+		Headers: []*httpgrpc.Header{
+			{Key: "Content-Type", Values: []string{"text/plain; charset=utf-8"}},
+			{Key: "Retry-After", Values: []string{strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))}},
+		},
+		Body: []byte("too many downstream requests failed, not sending requests to the downstream for now"),
+	})
+}
+
+// isCircuitOpenError tells whether the error is the one of a request rejected by an open circuit breaker. The errors
+// of downstream responses are decoded without their headers, so only these have a Retry-After header.
+func isCircuitOpenError(err error) bool {
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	if !ok || resp.Code != http.StatusServiceUnavailable {
+		return false
+	}
+	for _, h := range resp.Headers {
+		if h.Key == "Retry-After" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	cortexcache "github.com/thanos-io/thanos/internal/cortex/chunk/cache"
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		calls  int
+		status = http.StatusOK
+		err    error
+	)
+	next := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		if err != nil {
+			return nil, err
+		}
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(status)
+		return rec.Result(), nil
+	})
+
+	reg := prometheus.NewRegistry()
+	rt := NewCircuitBreakerRoundTripper(next, "http://querier:9090", CircuitBreakerConfig{
+		ErrorRatio:   0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		OpenDuration: 10 * time.Second,
+	}, reg, log.NewNopLogger())
+	cb := rt.(*circuitBreaker)
+	now := time.Unix(0, 0)
+	cb.now = func() time.Time { return now }
+	cb.windowStart = now
+
+	roundTrip := func() error {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+		resp, err := rt.RoundTrip(req)
+		if err == nil {
+			testutil.Ok(t, resp.Body.Close())
+		}
+		return err
+	}
+	state := func(s circuitState) float64 {
+		return promtestutil.ToFloat64(cb.stateGauge.WithLabelValues("http://querier:9090", s.String()))
+	}
+
+	// Client errors and a minority of failures don't open the circuit.
+	status = http.StatusBadRequest
+	testutil.Ok(t, roundTrip())
+	testutil.Ok(t, roundTrip())
+	status = http.StatusBadGateway
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 1.0, state(circuitClosed))
+
+	// The failures of the next window open it.
+	now = now.Add(time.Minute)
+	err = errors.New("connection refused")
+	testutil.NotOk(t, roundTrip())
+	status, err = http.StatusServiceUnavailable, nil
+	testutil.Ok(t, roundTrip())
+	status = http.StatusOK
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 1.0, state(circuitClosed))
+	status = http.StatusServiceUnavailable
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 1.0, state(circuitOpen))
+	testutil.Equals(t, 0.0, state(circuitClosed))
+	testutil.Equals(t, 7, calls)
+
+	// While open, the requests are rejected without reaching the downstream.
+	now = now.Add(2500 * time.Millisecond)
+	rejectErr := roundTrip()
+	testutil.Assert(t, isCircuitOpenError(rejectErr), "expected circuit open error, got %v", rejectErr)
+	resp, _ := httpgrpc.HTTPResponseFromError(rejectErr)
+	testutil.Equals(t, int32(http.StatusServiceUnavailable), resp.Code)
+	testutil.Equals(t, []*httpgrpc.Header{
+		{Key: "Content-Type", Values: []string{"text/plain; charset=utf-8"}},
+		{Key: "Retry-After", Values: []string{"8"}},
+	}, resp.Headers)
+	testutil.Equals(t, 7, calls)
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(cb.rejected))
+
+	// Once the open duration is over, a failing probe opens the circuit again.
+	now = now.Add(10 * time.Second)
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 8, calls)
+	testutil.Equals(t, 1.0, state(circuitOpen))
+	testutil.Assert(t, isCircuitOpenError(roundTrip()), "expected circuit open error")
+
+	// Only one probe at a time is let through.
+	now = now.Add(10 * time.Second)
+	probe, _, ok := cb.allow()
+	testutil.Assert(t, probe && ok, "expected probe")
+	testutil.Equals(t, 1.0, state(circuitHalfOpen))
+	testutil.Assert(t, isCircuitOpenError(roundTrip()), "expected circuit open error")
+	cb.record(true, false, true)
+
+	// A successful probe closes it.
+	status = http.StatusOK
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 1.0, state(circuitClosed))
+	testutil.Ok(t, roundTrip())
+	testutil.Equals(t, 10, calls)
+}
+
+func TestRoundTripCircuitBreaker(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+		Dedup: true,
+	}
+	uncachedRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   4 * hour,
+		Step:  10 * seconds,
+		Dedup: true,
+	}
+
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				MaxRetries: 5,
+				Limits:     defaultLimits,
+				ResultsCacheConfig: &queryrange.ResultsCacheConfig{
+					CacheConfig: cortexcache.Config{
+						EnableFifoCache: true,
+						Fifocache: cortexcache.FifoCacheConfig{
+							MaxSizeBytes: "1MiB",
+							MaxSizeItems: 1000,
+							Validity:     time.Hour,
+						},
+					},
+				},
+				SplitQueriesByInterval: day,
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	downstream, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer downstream.Close()
+	rt := tpw(NewCircuitBreakerRoundTripper(downstream, downstream.URL, CircuitBreakerConfig{
+		ErrorRatio:   0.5,
+		MinRequests:  3,
+		Window:       time.Minute,
+		OpenDuration: time.Minute,
+	}, nil, log.NewNopLogger()))
+
+	roundTrip := func(req queryrange.Request) error {
+		ctx := user.InjectOrgID(context.Background(), "1")
+		httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, req)
+		testutil.Ok(t, err)
+		resp, err := rt.RoundTrip(httpReq)
+		if err == nil {
+			testutil.Ok(t, resp.Body.Close())
+		}
+		return err
+	}
+
+	// Cache the results of the request.
+	res, handler := promqlResults(false)
+	downstream.setHandler(handler)
+	testutil.Ok(t, roundTrip(testRequest))
+	testutil.Equals(t, 1, *res)
+
+	// The downstream fails, the retries open the circuit.
+	res, handler = promqlResults(true)
+	downstream.setHandler(handler)
+	err = roundTrip(uncachedRequest)
+	testutil.Assert(t, isCircuitOpenError(err), "expected circuit open error, got %v", err)
+	testutil.Equals(t, 2, *res)
+
+	// While it is open, the requests fail fast without retries, but the cached results are still served.
+	err = roundTrip(uncachedRequest)
+	testutil.Assert(t, isCircuitOpenError(err), "expected circuit open error, got %v", err)
+	testutil.Ok(t, roundTrip(testRequest))
+	testutil.Equals(t, 2, *res)
+}
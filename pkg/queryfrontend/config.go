@@ -204,6 +204,12 @@ type Config struct {
 	RequestLoggingDecision string
 	DownstreamURL          string
 	ForwardHeaders         []string
+	// CacheDisabledTenants are the tenants whose results are never cached.
+	CacheDisabledTenants []string
+	// RetryableStatusCodes are the status codes, or the 5xx status class, of the downstream responses retried by the
+	// query range and labels tripperwares.
+	RetryableStatusCodes []string
+	CircuitBreakerConfig CircuitBreakerConfig
 }
 
 // QueryRangeConfig holds the config for query range tripperware.
@@ -214,12 +220,18 @@ type QueryRangeConfig struct {
 
 	ResultsCacheConfig *queryrange.ResultsCacheConfig
 	CachePathOrContent extflag.PathOrContent
+	// CacheInvalidationEnabled enables the endpoint invalidating the cached results of a tenant.
+	CacheInvalidationEnabled bool
 
 	AlignRangeWithStep     bool
+	MinStep                time.Duration
+	AllowedSteps           []time.Duration
 	RequestDownsampled     bool
 	SplitQueriesByInterval time.Duration
 	MaxRetries             int
 	Limits                 *cortexvalidation.Limits
+	// TenantMaxLookbacks override the max query lookback of the limits for the tenants, as identified by their org ID.
+	TenantMaxLookbacks map[string]time.Duration
 }
 
 // LabelsConfig holds the config for labels tripperware.
@@ -247,6 +259,8 @@ func (cfg *Config) Validate() error {
 		if err := cfg.QueryRangeConfig.ResultsCacheConfig.Validate(querier.Config{}); err != nil {
 			return errors.Wrap(err, "invalid ResultsCache config for query_range tripperware")
 		}
+	} else if cfg.QueryRangeConfig.CacheInvalidationEnabled {
+		return errors.New("cache invalidation requires caching to be enabled")
 	}
 
 	if cfg.LabelsConfig.ResultsCacheConfig != nil {
@@ -258,6 +272,21 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.QueryRangeConfig.MinStep < 0 {
+		return errors.New("query-range.min-step cannot be negative")
+	}
+	// Steps are snapped to multiples of the allowed steps, which must be at least the millisecond resolution of query
+	// steps as zero steps would be divided by.
+	for _, s := range cfg.QueryRangeConfig.AllowedSteps {
+		if s < time.Millisecond {
+			return errors.Errorf("query-range.allowed-step must be at least 1ms, got %s", s)
+		}
+	}
+
+	if cfg.QueryRangeConfig.Limits != nil && cfg.QueryRangeConfig.Limits.MaxQueryLookback < 0 {
+		return errors.New("query-range.max-lookback cannot be negative")
+	}
+
 	if cfg.LabelsConfig.DefaultTimeRange == 0 {
 		return errors.New("labels.default-time-range cannot be set to 0")
 	}
@@ -266,5 +295,12 @@ func (cfg *Config) Validate() error {
 		return errors.New("downstream URL should be configured")
 	}
 
+	if _, err := parseRetryableStatusCodes(cfg.RetryableStatusCodes); err != nil {
+		return err
+	}
+	if err := cfg.CircuitBreakerConfig.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
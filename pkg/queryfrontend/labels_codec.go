@@ -145,6 +145,9 @@ func (c labelsCodec) EncodeRequest(ctx context.Context, r queryrange.Request) (*
 		if len(thanosReq.StoreMatchers) > 0 {
 			params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 		}
+		if len(thanosReq.StoreTypes) > 0 {
+			params[queryv1.StoreTypeParam] = thanosReq.StoreTypes
+		}
 
 		if strings.Contains(thanosReq.Path, "/api/v1/label/") {
 			u := &url.URL{
@@ -187,6 +190,9 @@ func (c labelsCodec) EncodeRequest(ctx context.Context, r queryrange.Request) (*
 		if len(thanosReq.StoreMatchers) > 0 {
 			params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 		}
+		if len(thanosReq.StoreTypes) > 0 {
+			params[queryv1.StoreTypeParam] = thanosReq.StoreTypes
+		}
 
 		req, err = http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
 		if err != nil {
@@ -307,6 +313,11 @@ func (c labelsCodec) parseLabelsRequest(r *http.Request, op string, forwardHeade
 		return nil, err
 	}
 
+	result.StoreTypes, err = parseStoreTypesParam(r)
+	if err != nil {
+		return nil, err
+	}
+
 	result.Path = r.URL.Path
 
 	if op == labelValuesOp {
@@ -321,6 +332,9 @@ func (c labelsCodec) parseLabelsRequest(r *http.Request, op string, forwardHeade
 			result.CachingOptions.Disabled = true
 			break
 		}
+		if strings.Contains(value, noCacheValue) {
+			result.CachingOptions.Refresh = true
+		}
 	}
 
 	// Include the specified headers from http request in prometheusRequest.
@@ -370,6 +384,11 @@ func (c labelsCodec) parseSeriesRequest(r *http.Request, forwardHeaders []string
 		return nil, err
 	}
 
+	result.StoreTypes, err = parseStoreTypesParam(r)
+	if err != nil {
+		return nil, err
+	}
+
 	result.Path = r.URL.Path
 
 	for _, value := range r.Header.Values(cacheControlHeader) {
@@ -377,6 +396,9 @@ func (c labelsCodec) parseSeriesRequest(r *http.Request, forwardHeaders []string
 			result.CachingOptions.Disabled = true
 			break
 		}
+		if strings.Contains(value, noCacheValue) {
+			result.CachingOptions.Refresh = true
+		}
 	}
 
 	// Include the specified headers from http request in prometheusRequest.
@@ -22,6 +22,7 @@ import (
 	cortexutil "github.com/thanos-io/thanos/internal/cortex/util"
 
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
+	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -31,6 +32,8 @@ const (
 
 	// Value that cacheControlHeader has if the response indicates that the results should not be cached.
 	noStoreValue = "no-store"
+	// Value that cacheControlHeader has if the request indicates that the cached results should be recomputed.
+	noCacheValue = "no-cache"
 )
 
 var (
@@ -117,6 +120,11 @@ func (c queryRangeCodec) DecodeRequest(_ context.Context, r *http.Request, forwa
 		return nil, err
 	}
 
+	result.StoreTypes, err = parseStoreTypesParam(r)
+	if err != nil {
+		return nil, err
+	}
+
 	result.Query = r.FormValue("query")
 	result.Path = r.URL.Path
 
@@ -125,6 +133,9 @@ func (c queryRangeCodec) DecodeRequest(_ context.Context, r *http.Request, forwa
 			result.CachingOptions.Disabled = true
 			break
 		}
+		if strings.Contains(value, noCacheValue) {
+			result.CachingOptions.Refresh = true
+		}
 	}
 
 	for _, header := range forwardHeaders {
@@ -165,6 +176,10 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 		params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 	}
 
+	if len(thanosReq.StoreTypes) > 0 {
+		params[queryv1.StoreTypeParam] = thanosReq.StoreTypes
+	}
+
 	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
@@ -178,6 +193,20 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 	return req.WithContext(ctx), nil
 }
 
+// EncodeResponse encodes the response like the Prometheus codec, additionally passing on the effective step header.
+func (c queryRangeCodec) EncodeResponse(ctx context.Context, res queryrange.Response) (*http.Response, error) {
+	resp, err := c.Codec.EncodeResponse(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range res.GetHeaders() {
+		if h.GetName() == EffectiveStepHeader {
+			resp.Header[EffectiveStepHeader] = h.GetValues()
+		}
+	}
+	return resp, nil
+}
+
 func parseDurationMillis(s string) (int64, error) {
 	if d, err := strconv.ParseFloat(s, 64); err == nil {
 		ts := d * float64(time.Second/time.Millisecond)
@@ -246,6 +275,23 @@ func parseMatchersParam(ss url.Values, matcherParam string) ([][]*labels.Matcher
 	return matchers, nil
 }
 
+// parseStoreTypesParam returns the store types given with the storeType[] parameter or the X-Thanos-Store-Type header,
+// to pass them on as parameter to the querier.
+func parseStoreTypesParam(r *http.Request) ([]string, error) {
+	types, err := store.ParseStoreTypes(append(append([]string{}, r.Form[queryv1.StoreTypeParam]...), r.Header.Values(queryv1.StoreTypeHeader)...))
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, "%s", err.Error())
+	}
+	if len(types) == 0 {
+		return nil, nil
+	}
+	res := make([]string, 0, len(types))
+	for _, t := range types {
+		res = append(res, t.String())
+	}
+	return res, nil
+}
+
 func encodeTime(t int64) string {
 	f := float64(t) / 1.0e3
 	return strconv.FormatFloat(f, 'f', -1, 64)
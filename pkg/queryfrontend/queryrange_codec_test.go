@@ -7,6 +7,7 @@ package queryfrontend
 import (
 	"context"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"github.com/prometheus/prometheus/model/labels"
@@ -167,6 +168,26 @@ func TestQueryRangeCodec_DecodeRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:            "storeTypes",
+			url:             `/api/v1/query_range?start=123&end=456&step=1&storeType[]=store&storeType[]=receive,rule`,
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StoreMatchers: [][]*labels.Matcher{},
+				StoreTypes:    []string{"store", "receive", "rule"},
+			},
+		},
+		{
+			name:            "unknown store type",
+			url:             `/api/v1/query_range?start=123&end=456&step=1&storeType[]=compact`,
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, `unknown store type "compact", expected one of [store sidecar receive rule query]`),
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			r, err := http.NewRequest(http.MethodGet, tc.url, nil)
@@ -269,6 +290,21 @@ func TestQueryRangeCodec_EncodeRequest(t *testing.T) {
 					r.FormValue(queryv1.MaxSourceResolutionParam) == "3600"
 			},
 		},
+		{
+			name: "Store types set",
+			req: &ThanosQueryRangeRequest{
+				Start:      123000,
+				End:        456000,
+				Step:       1000,
+				StoreTypes: []string{"store", "sidecar"},
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					reflect.DeepEqual(r.Form[queryv1.StoreTypeParam], []string{"store", "sidecar"})
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			// Default partial response value doesn't matter when encoding requests.
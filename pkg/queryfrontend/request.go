@@ -20,6 +20,11 @@ type ThanosRequestStoreMatcherGetter interface {
 	GetStoreMatchers() [][]*labels.Matcher
 }
 
+// ThanosRequestStoreTypesGetter is an interface for the requests restricted to the stores of some types.
+type ThanosRequestStoreTypesGetter interface {
+	GetStoreTypes() []string
+}
+
 type RequestHeader struct {
 	Name   string
 	Values []string
@@ -43,6 +48,7 @@ type ThanosQueryRangeRequest struct {
 	MaxSourceResolution int64
 	ReplicaLabels       []string
 	StoreMatchers       [][]*labels.Matcher
+	StoreTypes          []string
 	CachingOptions      queryrange.CachingOptions
 	Headers             []*RequestHeader
 	Stats               string
@@ -54,6 +60,9 @@ func (r *ThanosQueryRangeRequest) IsDedupEnabled() bool { return r.Dedup }
 // GetStoreMatchers returns store matches.
 func (r *ThanosQueryRangeRequest) GetStoreMatchers() [][]*labels.Matcher { return r.StoreMatchers }
 
+// GetStoreTypes returns the types of the stores the request is restricted to.
+func (r *ThanosQueryRangeRequest) GetStoreTypes() []string { return r.StoreTypes }
+
 // GetStart returns the start timestamp of the request in milliseconds.
 func (r *ThanosQueryRangeRequest) GetStart() int64 { return r.Start }
 
@@ -104,6 +113,7 @@ func (r *ThanosQueryRangeRequest) LogToSpan(sp opentracing.Span) {
 		otlog.Bool("partial_response", r.PartialResponse),
 		otlog.Object("replicaLabels", r.ReplicaLabels),
 		otlog.Object("storeMatchers", r.StoreMatchers),
+		otlog.Object("storeTypes", r.StoreTypes),
 		otlog.Bool("auto-downsampling", r.AutoDownsampling),
 		otlog.Int64("max_source_resolution (ms)", r.MaxSourceResolution),
 	}
@@ -130,6 +140,7 @@ type ThanosLabelsRequest struct {
 	Path            string
 	Matchers        [][]*labels.Matcher
 	StoreMatchers   [][]*labels.Matcher
+	StoreTypes      []string
 	PartialResponse bool
 	CachingOptions  queryrange.CachingOptions
 	Headers         []*RequestHeader
@@ -139,6 +150,9 @@ type ThanosLabelsRequest struct {
 // GetStoreMatchers returns store matches.
 func (r *ThanosLabelsRequest) GetStoreMatchers() [][]*labels.Matcher { return r.StoreMatchers }
 
+// GetStoreTypes returns the types of the stores the request is restricted to.
+func (r *ThanosLabelsRequest) GetStoreTypes() []string { return r.StoreTypes }
+
 // GetStart returns the start timestamp of the request in milliseconds.
 func (r *ThanosLabelsRequest) GetStart() int64 { return r.Start }
 
@@ -184,6 +198,7 @@ func (r *ThanosLabelsRequest) LogToSpan(sp opentracing.Span) {
 		otlog.Bool("partial_response", r.PartialResponse),
 		otlog.Object("matchers", r.Matchers),
 		otlog.Object("storeMatchers", r.StoreMatchers),
+		otlog.Object("storeTypes", r.StoreTypes),
 	}
 	if r.Label != "" {
 		fields = append(fields, otlog.Object("label", r.Label))
@@ -213,6 +228,7 @@ type ThanosSeriesRequest struct {
 	ReplicaLabels   []string
 	Matchers        [][]*labels.Matcher
 	StoreMatchers   [][]*labels.Matcher
+	StoreTypes      []string
 	CachingOptions  queryrange.CachingOptions
 	Headers         []*RequestHeader
 	Stats           string
@@ -224,6 +240,9 @@ func (r *ThanosSeriesRequest) IsDedupEnabled() bool { return r.Dedup }
 // GetStoreMatchers returns store matches.
 func (r *ThanosSeriesRequest) GetStoreMatchers() [][]*labels.Matcher { return r.StoreMatchers }
 
+// GetStoreTypes returns the types of the stores the request is restricted to.
+func (r *ThanosSeriesRequest) GetStoreTypes() []string { return r.StoreTypes }
+
 // GetStart returns the start timestamp of the request in milliseconds.
 func (r *ThanosSeriesRequest) GetStart() int64 { return r.Start }
 
@@ -271,6 +290,7 @@ func (r *ThanosSeriesRequest) LogToSpan(sp opentracing.Span) {
 		otlog.Object("replicaLabels", r.ReplicaLabels),
 		otlog.Object("matchers", r.Matchers),
 		otlog.Object("storeMatchers", r.StoreMatchers),
+		otlog.Object("storeTypes", r.StoreTypes),
 	}
 
 	sp.LogFields(fields...)
@@ -0,0 +1,56 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+// DefaultRetryableStatusCodes are the status codes of the downstream responses retried by default.
+var DefaultRetryableStatusCodes = []string{"5xx"}
+
+// parseRetryableStatusCodes parses status codes like 503, and the 5xx status class, into a function telling whether a
+// status code is retryable, the default ones if there are none. Client errors are never retried, as the retries would
+// fail the same way.
+func parseRetryableStatusCodes(codes []string) (func(code int) bool, error) {
+	if len(codes) == 0 {
+		codes = DefaultRetryableStatusCodes
+	}
+	retryable := map[int]struct{}{}
+	for _, c := range codes {
+		if strings.EqualFold(c, "5xx") {
+			for code := 500; code < 600; code++ {
+				retryable[code] = struct{}{}
+			}
+			continue
+		}
+		code, err := strconv.Atoi(c)
+		if err != nil || code/100 != 5 {
+			return nil, errors.Errorf("invalid retryable status code %q, only 5xx status codes can be retried", c)
+		}
+		retryable[code] = struct{}{}
+	}
+	return func(code int) bool {
+		_, ok := retryable[code]
+		return ok
+	}, nil
+}
+
+// newRetryPolicy returns the policy retrying the requests which failed with a non-HTTP error or a retryable status
+// code, except the ones rejected by the open circuit breaker of the downstream, which would be rejected again.
+func newRetryPolicy(retryable func(code int) bool) queryrange.RetryPolicy {
+	return func(err error) bool {
+		if isCircuitOpenError(err) {
+			return false
+		}
+		httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+		return !ok || retryable(int(httpResp.Code))
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	for _, codes := range [][]string{{"400"}, {"422", "503"}, {"5xy"}, {"600"}} {
+		_, err := parseRetryableStatusCodes(codes)
+		testutil.NotOk(t, err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		codes    []string
+		err      error
+		expected bool
+	}{
+		{name: "default, server error", err: httpgrpc.Errorf(http.StatusInternalServerError, "boom"), expected: true},
+		{name: "default, client error", err: httpgrpc.Errorf(http.StatusBadRequest, "bad query")},
+		{name: "default, unprocessable entity", err: httpgrpc.Errorf(http.StatusUnprocessableEntity, "bad data")},
+		{name: "default, non-HTTP error", err: errors.New("connection refused"), expected: true},
+		{name: "default, open circuit", err: circuitOpenError(time.Second)},
+		{name: "class", codes: []string{"5XX"}, err: httpgrpc.Errorf(http.StatusGatewayTimeout, "timeout"), expected: true},
+		{name: "listed code", codes: []string{"502", "503", "504"}, err: httpgrpc.Errorf(http.StatusBadGateway, "bad gateway"), expected: true},
+		{name: "unlisted code", codes: []string{"502", "503", "504"}, err: httpgrpc.Errorf(http.StatusInternalServerError, "boom")},
+		{name: "listed code, non-HTTP error", codes: []string{"503"}, err: errors.New("connection refused"), expected: true},
+		{name: "listed code, open circuit", codes: []string{"503"}, err: circuitOpenError(time.Second)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			retryable, err := parseRetryableStatusCodes(tc.codes)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, newRetryPolicy(retryable)(tc.err))
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
 
 	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
 	"github.com/thanos-io/thanos/internal/cortex/util/validation"
@@ -25,8 +26,13 @@ const (
 	labelNamesOp   = "label_names"
 	labelValuesOp  = "label_values"
 	seriesOp       = "series"
+
+	cacheInvalidationOp = "cache_invalidation"
 )
 
+// CacheInvalidationPath is the path of the endpoint invalidating the cached query range results of a tenant.
+const CacheInvalidationPath = "/api/v1/admin/cache/invalidate"
+
 var labelValuesPattern = regexp.MustCompile("/api/v1/label/.+/values$")
 
 // NewTripperware returns a Tripperware which sends requests to different sub tripperwares based on the query type.
@@ -36,50 +42,88 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 		err                            error
 	)
 	if config.QueryRangeConfig.Limits != nil {
-		queryRangeLimits, err = validation.NewOverrides(*config.QueryRangeConfig.Limits, nil)
+		queryRangeLimits, err = validation.NewOverrides(*config.QueryRangeConfig.Limits, newTenantLimits(*config.QueryRangeConfig.Limits, config.CacheDisabledTenants, config.QueryRangeConfig.TenantMaxLookbacks))
 		if err != nil {
 			return nil, errors.Wrap(err, "initialize query range limits")
 		}
 	}
 
 	if config.LabelsConfig.Limits != nil {
-		labelsLimits, err = validation.NewOverrides(*config.LabelsConfig.Limits, nil)
+		labelsLimits, err = validation.NewOverrides(*config.LabelsConfig.Limits, newTenantLimits(*config.LabelsConfig.Limits, config.CacheDisabledTenants, nil))
 		if err != nil {
 			return nil, errors.Wrap(err, "initialize labels limits")
 		}
 	}
 
+	retryable, err := parseRetryableStatusCodes(config.RetryableStatusCodes)
+	if err != nil {
+		return nil, err
+	}
+	retryPolicy := newRetryPolicy(retryable)
+
 	queryRangeCodec := NewThanosQueryRangeCodec(config.QueryRangeConfig.PartialResponseStrategy)
 	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.DefaultTimeRange)
 
-	queryRangeTripperware, err := newQueryRangeTripperware(config.QueryRangeConfig, queryRangeLimits, queryRangeCodec,
-		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_range"}, reg), logger, config.ForwardHeaders)
+	queryRangeTripperware, cacheInvalidations, err := newQueryRangeTripperware(config.QueryRangeConfig, queryRangeLimits, queryRangeCodec,
+		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_range"}, reg), logger, config.ForwardHeaders, retryPolicy)
 	if err != nil {
 		return nil, err
 	}
 
 	labelsTripperware, err := newLabelsTripperware(config.LabelsConfig, labelsLimits, labelsCodec,
-		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "labels"}, reg), logger, config.ForwardHeaders)
+		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "labels"}, reg), logger, config.ForwardHeaders, retryPolicy)
 	if err != nil {
 		return nil, err
 	}
 
 	return func(next http.RoundTripper) http.RoundTripper {
-		return newRoundTripper(next, queryRangeTripperware(next), labelsTripperware(next), reg)
+		return newRoundTripper(next, queryRangeTripperware(next), labelsTripperware(next), cacheInvalidations, reg)
 	}, nil
 }
 
+// tenantLimits overrides the limits of the tenants whose results are never cached, or whose queries have their own
+// max lookback.
+type tenantLimits map[string]*validation.Limits
+
+func newTenantLimits(defaults validation.Limits, cacheDisabledTenants []string, maxLookbacks map[string]time.Duration) tenantLimits {
+	l := make(tenantLimits, len(cacheDisabledTenants)+len(maxLookbacks))
+	limitsOf := func(tenant string) *validation.Limits {
+		if _, ok := l[tenant]; !ok {
+			tl := defaults
+			l[tenant] = &tl
+		}
+		return l[tenant]
+	}
+	for _, t := range cacheDisabledTenants {
+		limitsOf(t).ResultsCacheDisabled = true
+	}
+	for t, lookback := range maxLookbacks {
+		limitsOf(t).MaxQueryLookback = model.Duration(lookback)
+	}
+	return l
+}
+
+func (l tenantLimits) ByUserID(userID string) *validation.Limits {
+	return l[userID]
+}
+
+func (l tenantLimits) AllByUserID() map[string]*validation.Limits {
+	return l
+}
+
 type roundTripper struct {
 	next, queryRange, labels http.RoundTripper
+	cacheInvalidations       *cacheInvalidations
 
 	queriesCount *prometheus.CounterVec
 }
 
-func newRoundTripper(next, queryRange, metadata http.RoundTripper, reg prometheus.Registerer) roundTripper {
+func newRoundTripper(next, queryRange, metadata http.RoundTripper, cacheInvalidations *cacheInvalidations, reg prometheus.Registerer) roundTripper {
 	r := roundTripper{
-		next:       next,
-		queryRange: queryRange,
-		labels:     metadata,
+		next:               next,
+		queryRange:         queryRange,
+		labels:             metadata,
+		cacheInvalidations: cacheInvalidations,
 		queriesCount: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "thanos_query_frontend_queries_total",
 			Help: "Total queries passing through query frontend",
@@ -104,6 +148,10 @@ func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	case labelNamesOp, labelValuesOp, seriesOp:
 		r.queriesCount.WithLabelValues(op).Inc()
 		return r.labels.RoundTrip(req)
+	case cacheInvalidationOp:
+		if r.cacheInvalidations != nil {
+			return r.cacheInvalidations.serveHTTP(req)
+		}
 	default:
 	}
 
@@ -111,6 +159,9 @@ func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func getOperation(r *http.Request) string {
+	if strings.HasSuffix(r.URL.Path, CacheInvalidationPath) {
+		return cacheInvalidationOp
+	}
 	if r.Method == http.MethodGet || r.Method == http.MethodPost {
 		switch {
 		case strings.HasSuffix(r.URL.Path, "/api/v1/query"):
@@ -132,7 +183,7 @@ func getOperation(r *http.Request) string {
 }
 
 // newQueryRangeTripperware returns a Tripperware for range queries configured with middlewares of
-// limit, step align, downsampled, split by interval, cache requests and retry.
+// limit, step snap, step align, downsampled, split by interval, cache requests and retry.
 func newQueryRangeTripperware(
 	config QueryRangeConfig,
 	limits queryrange.Limits,
@@ -140,10 +191,30 @@ func newQueryRangeTripperware(
 	reg prometheus.Registerer,
 	logger log.Logger,
 	forwardHeaders []string,
-) (queryrange.Tripperware, error) {
-	queryRangeMiddleware := []queryrange.Middleware{queryrange.NewLimitsMiddleware(limits)}
+	retryPolicy queryrange.RetryPolicy,
+) (queryrange.Tripperware, *cacheInvalidations, error) {
+	var queryRangeMiddleware []queryrange.Middleware
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
 
+	// limits middleware, enforcing the max lookback before the range of the request is split.
+	queryRangeMiddleware = append(queryRangeMiddleware, queryrange.NewLimitsMiddleware(limits))
+
+	// @ modifier middleware, before any other middleware changes the range of the request.
+	queryRangeMiddleware = append(
+		queryRangeMiddleware,
+		queryrange.InstrumentMiddleware("at_modifier", m),
+		AtModifierMiddleware(),
+	)
+
+	// step snap middleware, before any other middleware derives anything from the step.
+	if config.MinStep > 0 || len(config.AllowedSteps) > 0 {
+		queryRangeMiddleware = append(
+			queryRangeMiddleware,
+			queryrange.InstrumentMiddleware("step_snap", m),
+			SnapStepMiddleware(config.MinStep, config.AllowedSteps, config.AlignRangeWithStep, reg),
+		)
+	}
+
 	// step align middleware.
 	if config.AlignRangeWithStep {
 		queryRangeMiddleware = append(
@@ -173,11 +244,17 @@ func newQueryRangeTripperware(
 		)
 	}
 
+	var invalidations *cacheInvalidations
 	if config.ResultsCacheConfig != nil {
-		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
+		keyGenerator := newThanosCacheKeyGenerator(config.SplitQueriesByInterval)
+		if config.CacheInvalidationEnabled {
+			invalidations = newCacheInvalidations(logger)
+			keyGenerator.invalidations = invalidations
+		}
+		queryCacheMiddleware, c, err := queryrange.NewResultsCacheMiddleware(
 			logger,
 			*config.ResultsCacheConfig,
-			newThanosCacheKeyGenerator(config.SplitQueriesByInterval),
+			keyGenerator,
 			limits,
 			codec,
 			queryrange.PrometheusResponseExtractor{},
@@ -186,7 +263,10 @@ func newQueryRangeTripperware(
 			reg,
 		)
 		if err != nil {
-			return nil, errors.Wrap(err, "create results cache middleware")
+			return nil, nil, errors.Wrap(err, "create results cache middleware")
+		}
+		if invalidations != nil {
+			invalidations.cache = c
 		}
 
 		queryRangeMiddleware = append(
@@ -200,7 +280,7 @@ func newQueryRangeTripperware(
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("retry", m),
-			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+			queryrange.NewRetryMiddlewareWithPolicy(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg), retryPolicy),
 		)
 	}
 
@@ -209,7 +289,7 @@ func newQueryRangeTripperware(
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
 			return rt.RoundTrip(r)
 		})
-	}, nil
+	}, invalidations, nil
 }
 
 // newLabelsTripperware returns a Tripperware for labels and series requests
@@ -221,6 +301,7 @@ func newLabelsTripperware(
 	reg prometheus.Registerer,
 	logger log.Logger,
 	forwardHeaders []string,
+	retryPolicy queryrange.RetryPolicy,
 ) (queryrange.Tripperware, error) {
 	labelsMiddleware := []queryrange.Middleware{}
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
@@ -264,7 +345,7 @@ func newLabelsTripperware(
 		labelsMiddleware = append(
 			labelsMiddleware,
 			queryrange.InstrumentMiddleware("retry", m),
-			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+			queryrange.NewRetryMiddlewareWithPolicy(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg), retryPolicy),
 		)
 	}
 	return func(next http.RoundTripper) http.RoundTripper {
@@ -285,6 +366,12 @@ func shouldCache(r queryrange.Request) bool {
 		}
 	}
 
+	if thanosReqStoreTypesGettable, ok := r.(ThanosRequestStoreTypesGetter); ok {
+		if len(thanosReqStoreTypesGettable.GetStoreTypes()) > 0 {
+			return false
+		}
+	}
+
 	if thanosReqDedup, ok := r.(ThanosRequestDedup); ok {
 		if !thanosReqDedup.IsDedupEnabled() {
 			return false
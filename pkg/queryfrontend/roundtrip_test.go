@@ -6,14 +6,18 @@ package queryfrontend
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
@@ -516,6 +520,181 @@ func TestRoundTripQueryRangeCacheMiddleware(t *testing.T) {
 	}
 }
 
+// TestRoundTripQueryRangeCacheControls tests refreshing, invalidating and disabling the cache of range queries.
+func TestRoundTripQueryRangeCacheControls(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:                "/api/v1/query_range",
+		Start:               0,
+		End:                 2 * hour,
+		Step:                10 * seconds,
+		MaxSourceResolution: 1 * seconds,
+		Dedup:               true,
+	}
+
+	cacheConf := &queryrange.ResultsCacheConfig{
+		CacheConfig: cortexcache.Config{
+			EnableFifoCache: true,
+			Fifocache: cortexcache.FifoCacheConfig{
+				MaxSizeBytes: "1MiB",
+				MaxSizeItems: 1000,
+				Validity:     time.Hour,
+			},
+		},
+	}
+
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				Limits:                   defaultLimits,
+				ResultsCacheConfig:       cacheConf,
+				CacheInvalidationEnabled: true,
+				SplitQueriesByInterval:   day,
+			},
+			CacheDisabledTenants: []string{"uncached"},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := promqlResults(false)
+	rt.setHandler(handler)
+
+	for _, tc := range []struct {
+		name         string
+		tenant       string
+		cacheControl string
+		// invalidateTenant and invalidateParams describe an invalidation made before the request.
+		invalidateTenant string
+		invalidateParams string
+		expected         int
+	}{
+		{name: "first request", tenant: "1", expected: 1},
+		{name: "same request, directly use cache", tenant: "1", expected: 1},
+		{name: "no-cache request recomputes", tenant: "1", cacheControl: "no-cache", expected: 2},
+		{name: "same request, use refreshed cache", tenant: "1", expected: 2},
+		{name: "invalidation of other tenant", tenant: "1", invalidateTenant: "2", expected: 2},
+		{name: "invalidation of other time range", tenant: "1", invalidateTenant: "1", invalidateParams: "?start=2000-01-01T00:00:00Z&end=2000-01-02T00:00:00Z", expected: 2},
+		{name: "invalidation of request time range", tenant: "1", invalidateTenant: "1", invalidateParams: "?start=1970-01-01T01:00:00Z&end=1970-01-01T02:00:00Z", expected: 3},
+		{name: "same request, use cache after invalidation", tenant: "1", expected: 3},
+		{name: "tenant with disabled cache", tenant: "uncached", expected: 4},
+		{name: "same request of tenant with disabled cache", tenant: "uncached", expected: 5},
+	} {
+		if !t.Run(tc.name, func(t *testing.T) {
+			if tc.invalidateTenant != "" {
+				httpReq := httptest.NewRequest(http.MethodPost, CacheInvalidationPath+tc.invalidateParams, nil)
+				resp, err := tpw(rt).RoundTrip(httpReq.WithContext(user.InjectOrgID(context.Background(), tc.invalidateTenant)))
+				testutil.Ok(t, err)
+				testutil.Equals(t, http.StatusNoContent, resp.StatusCode)
+			}
+
+			ctx := user.InjectOrgID(context.Background(), tc.tenant)
+			httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, testRequest)
+			testutil.Ok(t, err)
+			if tc.cacheControl != "" {
+				httpReq.Header.Set(cacheControlHeader, tc.cacheControl)
+			}
+
+			_, err = tpw(rt).RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, *res)
+		}) {
+			break
+		}
+	}
+}
+
+func TestNewTenantLimits(t *testing.T) {
+	defaults := cortexvalidation.Limits{MaxQueryLookback: model.Duration(5 * time.Minute), MaxQueryLookbackReject: true}
+	overrides, err := cortexvalidation.NewOverrides(defaults, newTenantLimits(defaults, []string{"uncached", "both"}, map[string]time.Duration{"long": time.Hour, "both": time.Hour}))
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		tenant           string
+		expectedLookback time.Duration
+		expectedDisabled bool
+	}{
+		{tenant: "1", expectedLookback: 5 * time.Minute},
+		{tenant: "uncached", expectedLookback: 5 * time.Minute, expectedDisabled: true},
+		{tenant: "long", expectedLookback: time.Hour},
+		{tenant: "both", expectedLookback: time.Hour, expectedDisabled: true},
+	} {
+		testutil.Equals(t, tc.expectedLookback, overrides.MaxQueryLookback(tc.tenant))
+		testutil.Equals(t, tc.expectedDisabled, overrides.ResultsCacheDisabled(tc.tenant))
+		testutil.Assert(t, overrides.MaxQueryLookbackReject(tc.tenant), "expected the mode of the defaults")
+	}
+}
+
+// TestRoundTripQueryRangeCacheKeyMigration tests that results cached with keys of an older format are not used.
+func TestRoundTripQueryRangeCacheKeyMigration(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:                "/api/v1/query_range",
+		Query:               "up",
+		Start:               0,
+		End:                 2 * hour,
+		Step:                10 * seconds,
+		MaxSourceResolution: 1 * seconds,
+		Dedup:               true,
+	}
+
+	// Results cached with the key format without execution fingerprint, computed with other replica labels.
+	c := cortexcache.NewMockCache()
+	oldKey := "fe:1:up:10000:0:2"
+	oldResponse, err := types.MarshalAny(&queryrange.PrometheusResponse{
+		Status: "success",
+		Data: queryrange.PrometheusData{
+			ResultType: string(parser.ValueTypeMatrix),
+			Result: []queryrange.SampleStream{{
+				Labels:  []cortexpb.LabelAdapter{},
+				Samples: []cortexpb.Sample{{Value: 42, TimestampMs: 0}},
+			}},
+		},
+	})
+	testutil.Ok(t, err)
+	buf, err := proto.Marshal(&queryrange.CachedResponse{
+		Key:     oldKey,
+		Extents: []queryrange.Extent{{Start: 0, End: 2 * hour, Response: oldResponse}},
+		Version: 1,
+	})
+	testutil.Ok(t, err)
+	c.Store(context.Background(), []string{cortexcache.HashKey(oldKey)}, [][]byte{buf})
+
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				Limits:                 defaultLimits,
+				ResultsCacheConfig:     &queryrange.ResultsCacheConfig{CacheConfig: cortexcache.Config{Cache: c}},
+				SplitQueriesByInterval: day,
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := promqlResults(false)
+	rt.setHandler(handler)
+
+	for i := 0; i < 2; i++ {
+		ctx := user.InjectOrgID(context.Background(), "1")
+		httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, testRequest)
+		testutil.Ok(t, err)
+
+		resp, err := tpw(rt).RoundTrip(httpReq)
+		testutil.Ok(t, err)
+		body, err := io.ReadAll(resp.Body)
+		testutil.Ok(t, err)
+		testutil.Ok(t, resp.Body.Close())
+
+		// The old entry is missed, and the results computed again are cached with the current key format.
+		testutil.Equals(t, 1, *res)
+		testutil.Assert(t, !strings.Contains(string(body), `"42"`), "unexpected results of the old cache entry: %s", body)
+	}
+}
+
 // TestRoundTripLabelsCacheMiddleware tests the cache middleware for labels requests.
 func TestRoundTripLabelsCacheMiddleware(t *testing.T) {
 	testRequest := &ThanosLabelsRequest{
@@ -0,0 +1,105 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+)
+
+// EffectiveStepHeader is the response header with the step in seconds the range query was evaluated with.
+const EffectiveStepHeader = "X-Thanos-Effective-Step"
+
+// SnapStepMiddleware creates a new Middleware that raises the step of range queries to minStep and snaps it
+// to the smallest of the allowedSteps not below it, so queries of similar resolution share their cached results.
+// Steps above all allowed steps are rounded up to a multiple of the largest one.
+// As changing the step moves the evaluation grid, the end is rounded up to the new grid, so the requested end
+// is still evaluated. If alignRangeWithStep is set, the start is aligned with the new step as well.
+func SnapStepMiddleware(minStep time.Duration, allowedSteps []time.Duration, alignRangeWithStep bool, registerer prometheus.Registerer) queryrange.Middleware {
+	allowed := make([]int64, 0, len(allowedSteps))
+	for _, s := range allowedSteps {
+		allowed = append(allowed, s.Milliseconds())
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i] < allowed[j] })
+
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return snapStep{
+			next:               next,
+			minStep:            minStep.Milliseconds(),
+			allowedSteps:       allowed,
+			alignRangeWithStep: alignRangeWithStep,
+			snappedCount: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+				Namespace: "thanos",
+				Name:      "frontend_snapped_step_queries_total",
+				Help:      "Total number of range queries whose step was changed by step snapping",
+			}),
+		}
+	})
+}
+
+type snapStep struct {
+	next               queryrange.Handler
+	minStep            int64
+	allowedSteps       []int64
+	alignRangeWithStep bool
+
+	// Metrics.
+	snappedCount prometheus.Counter
+}
+
+func (s snapStep) Do(ctx context.Context, req queryrange.Request) (queryrange.Response, error) {
+	tqrr, ok := req.(*ThanosQueryRangeRequest)
+	if !ok {
+		return s.next.Do(ctx, req)
+	}
+
+	r := *tqrr
+	if step := s.effectiveStep(r.Step); step != r.Step {
+		s.snappedCount.Inc()
+
+		if s.alignRangeWithStep {
+			r.Start = (r.Start / step) * step
+		}
+		// Round the end up, so the point at the requested end is not lost. The point of the final, partial
+		// interval might not be complete yet, but results are never cached for the latest freshness period.
+		r.End = r.Start + ((r.End-r.Start+step-1)/step)*step
+		r.Step = step
+	}
+
+	resp, err := s.next.Do(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+	if promResp, ok := resp.(*queryrange.PrometheusResponse); ok {
+		promResp.Headers = append(promResp.Headers, &queryrange.PrometheusResponseHeader{
+			Name:   EffectiveStepHeader,
+			Values: []string{strconv.FormatFloat(float64(r.Step)/1000, 'f', -1, 64)},
+		})
+	}
+	return resp, nil
+}
+
+// effectiveStep returns the step the query with the given step is evaluated with.
+func (s snapStep) effectiveStep(step int64) int64 {
+	if step < s.minStep {
+		step = s.minStep
+	}
+	if len(s.allowedSteps) == 0 {
+		return step
+	}
+	for _, allowed := range s.allowedSteps {
+		if allowed >= step {
+			return allowed
+		}
+	}
+	largest := s.allowedSteps[len(s.allowedSteps)-1]
+	return ((step + largest - 1) / largest) * largest
+}
@@ -0,0 +1,113 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thanos-io/thanos/internal/cortex/querier/queryrange"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestConfig_ValidateSteps(t *testing.T) {
+	validate := func(minStep time.Duration, allowedSteps ...time.Duration) error {
+		cfg := Config{
+			QueryRangeConfig: QueryRangeConfig{MinStep: minStep, AllowedSteps: allowedSteps},
+			LabelsConfig:     LabelsConfig{DefaultTimeRange: time.Hour},
+			DownstreamURL:    "http://localhost:9090",
+		}
+		return cfg.Validate()
+	}
+	testutil.Ok(t, validate(0))
+	testutil.Ok(t, validate(time.Minute, time.Millisecond, time.Minute, time.Hour))
+
+	err := validate(-time.Minute)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "query-range.min-step cannot be negative", err.Error())
+
+	for _, step := range []time.Duration{0, -time.Minute, 500 * time.Microsecond} {
+		err := validate(0, time.Minute, step)
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "query-range.allowed-step must be at least 1ms, got "+step.String(), err.Error())
+	}
+}
+
+func TestSnapStepMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		desc               string
+		minStep            time.Duration
+		allowedSteps       []time.Duration
+		alignRangeWithStep bool
+		req                *ThanosQueryRangeRequest
+		expected           *ThanosQueryRangeRequest
+		expectedStep       string
+	}{
+		{
+			desc:         "step raised to min step, end rounded up",
+			minStep:      30 * time.Second,
+			req:          &ThanosQueryRangeRequest{Start: 1000, End: 62000, Step: 14000},
+			expected:     &ThanosQueryRangeRequest{Start: 1000, End: 91000, Step: 30000},
+			expectedStep: "30",
+		},
+		{
+			desc:         "step above min step unchanged",
+			minStep:      30 * time.Second,
+			req:          &ThanosQueryRangeRequest{Start: 1000, End: 62000, Step: 45000},
+			expected:     &ThanosQueryRangeRequest{Start: 1000, End: 62000, Step: 45000},
+			expectedStep: "45",
+		},
+		{
+			desc:               "step snapped to allowed step and range aligned",
+			allowedSteps:       []time.Duration{time.Minute, 15 * time.Second, 5 * time.Minute},
+			alignRangeWithStep: true,
+			req:                &ThanosQueryRangeRequest{Start: 70000, End: 610000, Step: 28000},
+			expected:           &ThanosQueryRangeRequest{Start: 60000, End: 660000, Step: 60000},
+			expectedStep:       "60",
+		},
+		{
+			desc:               "allowed step unchanged",
+			allowedSteps:       []time.Duration{15 * time.Second, time.Minute},
+			alignRangeWithStep: true,
+			req:                &ThanosQueryRangeRequest{Start: 70000, End: 610000, Step: 15000},
+			expected:           &ThanosQueryRangeRequest{Start: 70000, End: 610000, Step: 15000},
+			expectedStep:       "15",
+		},
+		{
+			desc:               "step above allowed steps rounded up to multiple of the largest one",
+			minStep:            10 * time.Second,
+			allowedSteps:       []time.Duration{15 * time.Second, time.Minute},
+			alignRangeWithStep: true,
+			req:                &ThanosQueryRangeRequest{Start: 0, End: 3600000, Step: 150000},
+			expected:           &ThanosQueryRangeRequest{Start: 0, End: 3600000, Step: 180000},
+			expectedStep:       "180",
+		},
+		{
+			desc:         "min step above allowed steps",
+			minStep:      10 * time.Second,
+			allowedSteps: []time.Duration{2 * time.Second, 5 * time.Second},
+			req:          &ThanosQueryRangeRequest{Start: 0, End: 20000, Step: 1000},
+			expected:     &ThanosQueryRangeRequest{Start: 0, End: 20000, Step: 10000},
+			expectedStep: "10",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got queryrange.Request
+			next := queryrange.HandlerFunc(func(_ context.Context, req queryrange.Request) (queryrange.Response, error) {
+				got = req
+				return &queryrange.PrometheusResponse{}, nil
+			})
+
+			resp, err := SnapStepMiddleware(tc.minStep, tc.allowedSteps, tc.alignRangeWithStep, nil).Wrap(next).Do(context.Background(), tc.req)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, got)
+			testutil.Equals(t, []*queryrange.PrometheusResponseHeader{{Name: EffectiveStepHeader, Values: []string{tc.expectedStep}}}, resp.GetHeaders())
+
+			httpResp, err := NewThanosQueryRangeCodec(true).EncodeResponse(context.Background(), resp)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedStep, httpResp.Header.Get(EffectiveStepHeader))
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// errAdmissionQueueFull is returned for write requests rejected because the admission queue of their tenant is full.
+var errAdmissionQueueFull = errors.New("too many concurrent write requests of the tenant; admission queue is full")
+
+// defaultAdmissionMetricsTenants is the default number of tenants labelled by their ID in the admission metrics.
+const defaultAdmissionMetricsTenants = 100
+
+// AdmissionOptions configure the admission of write requests received from clients.
+type AdmissionOptions struct {
+	// MaxConcurrency is the number of write requests processed concurrently. Further write requests wait in the queue
+	// of their tenant.
+	MaxConcurrency int
+	// TenantQueueSize is the number of write requests of a tenant waiting for admission beyond which new ones are
+	// rejected.
+	TenantQueueSize int
+	// TenantWeights are the weights of the tenants, by tenant ID. Tenants get a share of the write requests processed
+	// concurrently proportional to their weight, 1 if not set.
+	TenantWeights map[string]float64
+	// RetryAfter is the duration clients are told to wait before retrying rejected write requests.
+	RetryAfter time.Duration
+	// MetricsTenants are the tenants labelled by their ID in the admission metrics. If empty, the first
+	// MaxMetricsTenants tenants are.
+	MetricsTenants []string
+	// MaxMetricsTenants is the number of tenants labelled by their ID in the admission metrics if MetricsTenants is
+	// empty, all other tenants are labelled with OtherTenantsLabel. Defaults to 100.
+	MaxMetricsTenants int
+}
+
+// Admission limits the number of write requests processed concurrently. When all slots are taken, write requests wait
+// in a bounded queue per tenant and are admitted by start-time fair queuing: each tenant with waiting write requests
+// gets a share of the slots proportional to its weight, so that a tenant flooding the receiver does not delay the write
+// requests of other tenants beyond its share.
+type Admission struct {
+	opts AdmissionOptions
+
+	mtx      sync.Mutex
+	inFlight int
+	queued   int
+	// vtime is the virtual start time of the last admitted write request.
+	vtime   float64
+	tenants map[string]*admissionTenant
+	// metricsTenants are the tenants labelled by their ID in the metrics.
+	metricsTenants map[string]struct{}
+
+	inFlightRequests prometheus.Gauge
+	queueLength      *prometheus.GaugeVec
+	waitDuration     *prometheus.HistogramVec
+	rejected         *prometheus.CounterVec
+}
+
+type admissionTenant struct {
+	id     string
+	weight float64
+	// finish is the virtual finish time of the last write request of the tenant.
+	finish  float64
+	waiters []*admissionWaiter
+}
+
+type admissionWaiter struct {
+	// start is the virtual start time of the write request, it is admitted when it is the earliest of all tenants.
+	start    float64
+	admitted chan struct{}
+}
+
+// NewAdmission returns an Admission with the given options.
+func NewAdmission(reg prometheus.Registerer, opts AdmissionOptions) *Admission {
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = 1
+	}
+	if opts.MaxMetricsTenants <= 0 {
+		opts.MaxMetricsTenants = defaultAdmissionMetricsTenants
+	}
+	a := &Admission{
+		opts:           opts,
+		tenants:        map[string]*admissionTenant{},
+		metricsTenants: map[string]struct{}{},
+		inFlightRequests: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_admission_in_flight_requests",
+			Help: "The number of admitted write requests being processed.",
+		}),
+		queueLength: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_admission_queue_length",
+			Help: "The number of write requests waiting for admission.",
+		}, []string{"tenant"}),
+		waitDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_receive_admission_wait_duration_seconds",
+			Help:    "The duration write requests waited for admission.",
+			Buckets: writeDurationBuckets,
+		}, []string{"tenant"}),
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_admission_rejected_requests_total",
+			Help: "The number of write requests rejected because the admission queue of their tenant was full.",
+		}, []string{"tenant"}),
+	}
+	for _, t := range opts.MetricsTenants {
+		a.metricsTenants[t] = struct{}{}
+	}
+	return a
+}
+
+// Acquire waits until a write request of the tenant is admitted and returns the function releasing its slot once it
+// was processed. It fails if the queue of the tenant is full or the context is done first.
+func (a *Admission) Acquire(ctx context.Context, tenant string) (release func(), err error) {
+	begin := time.Now()
+
+	a.mtx.Lock()
+	metricsTenant := a.metricsTenant(tenant)
+	t := a.tenant(tenant)
+	if a.inFlight < a.opts.MaxConcurrency && a.queued == 0 {
+		a.admit(a.tag(t))
+		a.mtx.Unlock()
+		a.waitDuration.WithLabelValues(metricsTenant).Observe(0)
+		return a.releaseFunc(), nil
+	}
+	if len(t.waiters) >= a.opts.TenantQueueSize {
+		a.mtx.Unlock()
+		a.rejected.WithLabelValues(metricsTenant).Inc()
+		return nil, errAdmissionQueueFull
+	}
+	w := &admissionWaiter{start: a.tag(t), admitted: make(chan struct{})}
+	t.waiters = append(t.waiters, w)
+	a.queued++
+	a.queueLength.WithLabelValues(metricsTenant).Inc()
+	a.mtx.Unlock()
+
+	select {
+	case <-w.admitted:
+		a.waitDuration.WithLabelValues(metricsTenant).Observe(time.Since(begin).Seconds())
+		return a.releaseFunc(), nil
+	case <-ctx.Done():
+	}
+
+	a.mtx.Lock()
+	for i, o := range t.waiters {
+		if o != w {
+			continue
+		}
+		t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+		if len(t.waiters) == i {
+			// The last write request of the tenant gives its virtual time back.
+			t.finish = w.start
+		}
+		a.queued--
+		a.queueLength.WithLabelValues(metricsTenant).Dec()
+		a.mtx.Unlock()
+		return nil, ctx.Err()
+	}
+	a.mtx.Unlock()
+	// The write request was admitted meanwhile, so its slot is released right away.
+	a.releaseFunc()()
+	return nil, ctx.Err()
+}
+
+// RetryAfter returns the duration clients are told to wait before retrying rejected write requests.
+func (a *Admission) RetryAfter() time.Duration {
+	return a.opts.RetryAfter
+}
+
+func (a *Admission) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(a.release)
+	}
+}
+
+// release frees a slot and admits the waiting write requests with the earliest virtual start time, if any. Ties are
+// broken by tenant ID.
+func (a *Admission) release() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.inFlight--
+	a.inFlightRequests.Dec()
+	for a.inFlight < a.opts.MaxConcurrency && a.queued > 0 {
+		var next *admissionTenant
+		for _, t := range a.tenants {
+			if len(t.waiters) == 0 {
+				continue
+			}
+			if next == nil || t.waiters[0].start < next.waiters[0].start || (t.waiters[0].start == next.waiters[0].start && t.id < next.id) {
+				next = t
+			}
+		}
+		w := next.waiters[0]
+		next.waiters = next.waiters[1:]
+		a.queued--
+		a.queueLength.WithLabelValues(a.metricsTenant(next.id)).Dec()
+		a.admit(w.start)
+		close(w.admitted)
+	}
+
+	// Tenants without waiting write requests which are not ahead of the virtual time are in the same state as new
+	// ones, so they are forgotten.
+	for id, t := range a.tenants {
+		if len(t.waiters) == 0 && t.finish <= a.vtime {
+			delete(a.tenants, id)
+		}
+	}
+}
+
+// tag returns the virtual start time of a new write request of the tenant and advances the virtual finish time of the
+// tenant by the inverse of its weight. Tenants which were idle start at the current virtual time, so that they can't
+// claim the slots they did not use.
+func (a *Admission) tag(t *admissionTenant) float64 {
+	start := math.Max(t.finish, a.vtime)
+	t.finish = start + 1/t.weight
+	return start
+}
+
+// admit takes a slot for a write request with the given virtual start time.
+func (a *Admission) admit(start float64) {
+	a.vtime = start
+	a.inFlight++
+	a.inFlightRequests.Inc()
+}
+
+func (a *Admission) tenant(id string) *admissionTenant {
+	t, ok := a.tenants[id]
+	if !ok {
+		t = &admissionTenant{id: id, weight: 1}
+		if w, ok := a.opts.TenantWeights[id]; ok && w > 0 {
+			t.weight = w
+		}
+		a.tenants[id] = t
+	}
+	return t
+}
+
+// metricsTenant returns the tenant label value of the given tenant. It must be called with the lock held.
+func (a *Admission) metricsTenant(tenant string) string {
+	if _, ok := a.metricsTenants[tenant]; ok {
+		return tenant
+	}
+	if len(a.opts.MetricsTenants) == 0 && len(a.metricsTenants) < a.opts.MaxMetricsTenants {
+		a.metricsTenants[tenant] = struct{}{}
+		return tenant
+	}
+	return OtherTenantsLabel
+}
@@ -0,0 +1,183 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// waitQueued waits until at least the given number of write requests wait for admission.
+func waitQueued(t *testing.T, a *Admission, queued int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(time.Millisecond, ctx.Done(), func() error {
+		a.mtx.Lock()
+		defer a.mtx.Unlock()
+		if a.queued < queued {
+			return errors.Errorf("%d write requests queued, expected at least %d", a.queued, queued)
+		}
+		return nil
+	}))
+}
+
+func TestAdmission_TenantWeights(t *testing.T) {
+	ctx := context.Background()
+	a := NewAdmission(prometheus.NewRegistry(), AdmissionOptions{MaxConcurrency: 1, TenantQueueSize: 10, TenantWeights: map[string]float64{"a": 3}})
+
+	release, err := a.Acquire(ctx, "init")
+	testutil.Ok(t, err)
+
+	var (
+		mtx   sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	for i, tenant := range []string{"a", "a", "a", "a", "b", "b", "b", "b"} {
+		tenant := tenant
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := a.Acquire(ctx, tenant)
+			if err != nil {
+				return
+			}
+			mtx.Lock()
+			order = append(order, tenant)
+			mtx.Unlock()
+			release()
+		}()
+		waitQueued(t, a, i+1)
+	}
+	testutil.Equals(t, 4.0, promtest.ToFloat64(a.queueLength.WithLabelValues("a")))
+
+	release()
+	wg.Wait()
+	// Tenant a gets three times the share of tenant b while both wait.
+	testutil.Equals(t, []string{"a", "b", "a", "a", "a", "b", "b", "b"}, order)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(a.queueLength.WithLabelValues("a")))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(a.inFlightRequests))
+}
+
+func TestAdmission_QueueFullAndCanceled(t *testing.T) {
+	a := NewAdmission(prometheus.NewRegistry(), AdmissionOptions{MaxConcurrency: 1, TenantQueueSize: 1, MetricsTenants: []string{"a"}})
+
+	release, err := a.Acquire(context.Background(), "a")
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := a.Acquire(ctx, "b")
+		errs <- err
+	}()
+	waitQueued(t, a, 1)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(a.queueLength.WithLabelValues(OtherTenantsLabel)))
+
+	_, err = a.Acquire(context.Background(), "b")
+	testutil.Equals(t, errAdmissionQueueFull, err)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(a.rejected.WithLabelValues(OtherTenantsLabel)))
+
+	// Canceled write requests leave the queue.
+	cancel()
+	testutil.Equals(t, context.Canceled, <-errs)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(a.queueLength.WithLabelValues(OtherTenantsLabel)))
+
+	release()
+	release, err = a.Acquire(context.Background(), "b")
+	testutil.Ok(t, err)
+	release()
+	testutil.Equals(t, 0.0, promtest.ToFloat64(a.inFlightRequests))
+}
+
+func TestAdmission_NoisyTenant(t *testing.T) {
+	const (
+		slots       = 2
+		processing  = 2 * time.Millisecond
+		noisyWrites = 200
+		quietWrites = 50
+		// Without fair queuing, write requests of the quiet tenant would wait for the noisy ones queued before them,
+		// noisyWrites*processing/slots = 200ms.
+		maxQuietWait = 50 * time.Millisecond
+	)
+	ctx := context.Background()
+	a := NewAdmission(prometheus.NewRegistry(), AdmissionOptions{MaxConcurrency: slots, TenantQueueSize: noisyWrites})
+
+	var wg sync.WaitGroup
+	for i := 0; i < noisyWrites; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := a.Acquire(ctx, "noisy")
+			if err != nil {
+				return
+			}
+			time.Sleep(processing)
+			release()
+		}()
+	}
+	waitQueued(t, a, noisyWrites/2)
+
+	var waits []time.Duration
+	for i := 0; i < quietWrites; i++ {
+		begin := time.Now()
+		release, err := a.Acquire(ctx, "quiet")
+		testutil.Ok(t, err)
+		waits = append(waits, time.Since(begin))
+		time.Sleep(processing)
+		release()
+	}
+	wg.Wait()
+
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	p99 := waits[len(waits)*99/100]
+	testutil.Assert(t, p99 < maxQuietWait, "p99 admission wait of the quiet tenant %v exceeds %v", p99, maxQuietWait)
+}
+
+func TestReceiveHTTPAdmission(t *testing.T) {
+	admission := NewAdmission(prometheus.NewRegistry(), AdmissionOptions{MaxConcurrency: 1, TenantQueueSize: 0, RetryAfter: 1500 * time.Millisecond})
+	app := newFakeAppender(nil, nil, nil)
+	h := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: 1,
+		ForwardTimeout:    5 * time.Second,
+		ReceiverMode:      IngestorOnly,
+		Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		Admission:         admission,
+	})
+	h.Hashring(SingleNodeHashring(""))
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	rec, err := makeRequest(h, "test", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	release, err := admission.Acquire(context.Background(), "other")
+	testutil.Ok(t, err)
+	defer release()
+
+	rec, err = makeRequest(h, "test", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	testutil.Equals(t, "2", rec.Header().Get("Retry-After"))
+}
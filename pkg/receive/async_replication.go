@@ -0,0 +1,165 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jpillora/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// Replication modes of the write requests received from clients.
+const (
+	// ReplicationModeSync acknowledges write requests once a quorum of their replicas was written.
+	ReplicationModeSync = "sync"
+	// ReplicationModeAsync acknowledges write requests once their first replica was written, the other replicas are
+	// written asynchronously, without quorum.
+	ReplicationModeAsync = "async"
+)
+
+// ReplicationModes are the supported replication modes.
+var ReplicationModes = []string{ReplicationModeSync, ReplicationModeAsync}
+
+// AsyncReplicationOptions configure the asynchronous replication of write requests to the other replicas.
+type AsyncReplicationOptions struct {
+	// QueueSize is the number of replicas waiting to be written beyond which new ones are dropped.
+	QueueSize int
+	// Concurrency is the number of replicas written concurrently.
+	Concurrency int
+	// MaxRetries is the number of times a replica failing with a retriable error is retried before its time series
+	// are dropped.
+	MaxRetries int
+	// ForwardTimeout is the timeout of each remote write.
+	ForwardTimeout time.Duration
+	// Compression is the compression of the remote writes, one of ReplicationCompressions.
+	Compression string
+	DialOpts    []grpc.DialOption
+}
+
+// AsyncReplicator writes the replicas of write requests which were acknowledged after their first replica was
+// written. Replicas which can't be queued or written are dropped, so that replicas of the time series may be missing
+// without the clients being told.
+type AsyncReplicator struct {
+	logger  log.Logger
+	opts    AsyncReplicationOptions
+	peers   *peerGroup
+	queue   chan *asyncReplicationRequest
+	backoff backoff.Backoff
+
+	requests      *prometheus.CounterVec
+	droppedSeries *prometheus.CounterVec
+	lag           prometheus.Histogram
+}
+
+type asyncReplicationRequest struct {
+	tenant   string
+	endpoint string
+	replica  uint64
+	wreq     *prompb.WriteRequest
+	enqueued time.Time
+}
+
+// NewAsyncReplicator returns an AsyncReplicator, which writes the queued replicas once it runs.
+func NewAsyncReplicator(logger log.Logger, reg prometheus.Registerer, opts AsyncReplicationOptions) *AsyncReplicator {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Compression == "" {
+		opts.Compression = ReplicationCompressionNone
+	}
+	r := &AsyncReplicator{
+		logger: logger,
+		opts:   opts,
+		peers:  newPeerGroup(opts.Compression, opts.DialOpts...),
+		queue:  make(chan *asyncReplicationRequest, opts.QueueSize),
+		backoff: backoff.Backoff{
+			Factor: 2,
+			Min:    100 * time.Millisecond,
+			Max:    30 * time.Second,
+			Jitter: true,
+		},
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_async_replication_requests_total",
+			Help: "The number of remote write requests of asynchronously written replicas, including retries.",
+		}, []string{"result"}),
+		droppedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_async_replication_dropped_series_total",
+			Help: "The number of time series whose asynchronously written replicas were dropped, because the queue was full or the remote writes failed. Their write requests were acknowledged nevertheless.",
+		}, []string{"reason"}),
+		lag: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "thanos_receive_async_replication_lag_seconds",
+			Help:    "The duration between acknowledging write requests and writing their asynchronously written replicas.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_receive_async_replication_queue_length",
+		Help: "The number of replicas waiting to be written asynchronously.",
+	}, func() float64 {
+		return float64(len(r.queue))
+	})
+	r.requests.WithLabelValues(labelSuccess)
+	r.requests.WithLabelValues(labelError)
+	r.droppedSeries.WithLabelValues(labelQueueFull)
+	r.droppedSeries.WithLabelValues(labelFailed)
+	return r
+}
+
+// Enqueue queues the replica of the write request of the tenant to be written to the endpoint, or drops it if the
+// queue is full. The write request must not be modified afterwards.
+func (r *AsyncReplicator) Enqueue(tenant, endpoint string, rep uint64, wreq *prompb.WriteRequest) {
+	select {
+	case r.queue <- &asyncReplicationRequest{tenant: tenant, endpoint: endpoint, replica: rep, wreq: wreq, enqueued: time.Now()}:
+	default:
+		r.droppedSeries.WithLabelValues(labelQueueFull).Add(float64(len(wreq.Timeseries)))
+	}
+}
+
+// Run writes the queued replicas until the context is canceled.
+func (r *AsyncReplicator) Run(ctx context.Context) error {
+	done := make(chan struct{})
+	for i := 0; i < r.opts.Concurrency; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-r.queue:
+					r.replicate(ctx, req)
+				}
+			}
+		}()
+	}
+	for i := 0; i < r.opts.Concurrency; i++ {
+		<-done
+	}
+	return nil
+}
+
+func (r *AsyncReplicator) replicate(ctx context.Context, req *asyncReplicationRequest) {
+	err := writeWithRetries(ctx, r.backoff, r.opts.MaxRetries, r.requests, func(ctx context.Context) error {
+		return sendReplica(ctx, r.peers, r.opts.ForwardTimeout, req.tenant, req.endpoint, req.replica, req.wreq)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		level.Warn(r.logger).Log("msg", "failed to write replica asynchronously", "tenant", req.tenant, "endpoint", req.endpoint, "replica", req.replica, "err", err)
+		r.droppedSeries.WithLabelValues(labelFailed).Add(float64(len(req.wreq.Timeseries)))
+		return
+	}
+	r.lag.Observe(time.Since(req.enqueued).Seconds())
+}
@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// newTestAsyncCluster returns a handler replicating write requests asynchronously to the given number of peers, with
+// a replication factor including all of them, and the appenders of the handler and the peers. The peers whose index
+// is in down can't be reached.
+func newTestAsyncCluster(t *testing.T, peers int, down map[int]bool, opts AsyncReplicationOptions) (*Handler, *AsyncReplicator, *fakeAppender, []*fakeAppender) {
+	t.Helper()
+
+	pg := &peerGroup{
+		m:      sync.RWMutex{},
+		cache:  map[string]storepb.WriteableStoreClient{},
+		v1Only: map[string]struct{}{},
+		dialer: func(context.Context, string, ...grpc.DialOption) (*grpc.ClientConn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	local := randomAddr()
+	cfg := []HashringConfig{{Endpoints: []Endpoint{{Address: local}}}}
+	var appenders []*fakeAppender
+	for i := 0; i < peers; i++ {
+		app := newFakeAppender(nil, nil, nil)
+		appenders = append(appenders, app)
+		peer := NewHandler(nil, &Options{
+			TenantHeader:      DefaultTenantHeader,
+			ReplicaHeader:     DefaultReplicaHeader,
+			ReplicationFactor: uint64(peers + 1),
+			ForwardTimeout:    5 * time.Second,
+			ReceiverMode:      IngestorOnly,
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		})
+		peer.Hashring(SingleNodeHashring(""))
+
+		addr := randomAddr()
+		cfg[0].Endpoints = append(cfg[0].Endpoints, Endpoint{Address: addr})
+		if !down[i] {
+			pg.cache[addr] = &fakeRemoteWriteGRPCServer{h: peer}
+		}
+	}
+
+	opts.ForwardTimeout = 5 * time.Second
+	r := NewAsyncReplicator(nil, prometheus.NewRegistry(), opts)
+	r.peers = pg
+	r.backoff.Min, r.backoff.Max = time.Millisecond, time.Millisecond
+
+	app := newFakeAppender(nil, nil, nil)
+	h := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: uint64(peers + 1),
+		ForwardTimeout:    5 * time.Second,
+		Endpoint:          local,
+		Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		AsyncReplicator:   r,
+	})
+	h.peers = pg
+	h.Hashring(newMultiHashring(AlgorithmHashmod, cfg))
+	return h, r, app, appenders
+}
+
+// drainAsyncReplication writes the queued replicas synchronously.
+func drainAsyncReplication(ctx context.Context, r *AsyncReplicator) {
+	for len(r.queue) > 0 {
+		r.replicate(ctx, <-r.queue)
+	}
+}
+
+func TestAsyncReplication(t *testing.T) {
+	ctx := context.Background()
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}},
+			},
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "baz"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	}
+	lsets := []labels.Labels{labels.FromStrings("foo", "bar"), labels.FromStrings("foo", "baz")}
+
+	t.Run("acknowledged once written locally", func(t *testing.T) {
+		h, r, local, peers := newTestAsyncCluster(t, 2, nil, AsyncReplicationOptions{QueueSize: 10})
+		testutil.Equals(t, 1.0, promtest.ToFloat64(h.replicationMode.WithLabelValues(ReplicationModeAsync)))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(h.replicationMode.WithLabelValues(ReplicationModeSync)))
+
+		rec, err := makeRequest(h, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		for i, lset := range lsets {
+			testutil.Equals(t, len(wreq.Timeseries[i].Samples), len(local.Get(lset)))
+			for _, peer := range peers {
+				testutil.Equals(t, 0, len(peer.Get(lset)))
+			}
+		}
+
+		drainAsyncReplication(ctx, r)
+		for i, lset := range lsets {
+			for _, peer := range peers {
+				testutil.Equals(t, len(wreq.Timeseries[i].Samples), len(peer.Get(lset)))
+			}
+		}
+		testutil.Equals(t, 0.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelFailed)))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(r.requests.WithLabelValues(labelError)))
+	})
+
+	t.Run("peers down", func(t *testing.T) {
+		h, r, local, _ := newTestAsyncCluster(t, 2, map[int]bool{0: true, 1: true}, AsyncReplicationOptions{QueueSize: 10, MaxRetries: 1})
+
+		// Without quorum, write requests succeed as long as their first replica is written.
+		rec, err := makeRequest(h, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		testutil.Equals(t, 2, len(local.Get(lsets[0])))
+
+		drainAsyncReplication(ctx, r)
+		// Both series of both peer replicas are dropped.
+		testutil.Equals(t, 4.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelFailed)))
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		h, r, _, peers := newTestAsyncCluster(t, 1, nil, AsyncReplicationOptions{QueueSize: 0})
+
+		rec, err := makeRequest(h, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		testutil.Equals(t, 2.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelQueueFull)))
+
+		drainAsyncReplication(ctx, r)
+		for _, lset := range lsets {
+			testutil.Equals(t, 0, len(peers[0].Get(lset)))
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// circuitState is the state of the circuit of a peer, exposed as the value of the circuit state metric.
+type circuitState int
+
+const (
+	// circuitClosed forwards write requests to the peer.
+	circuitClosed circuitState = iota
+	// circuitOpen fails write requests to the peer without sending them.
+	circuitOpen
+	// circuitHalfOpen forwards a single probing write request to the peer, closing the circuit if it succeeds and
+	// opening it again otherwise.
+	circuitHalfOpen
+)
+
+// peerCircuit is the circuit of a peer.
+type peerCircuit struct {
+	state    circuitState
+	failures int
+	openTill time.Time
+	probing  bool
+}
+
+// peerCircuitBreakers are the circuit breakers of the peers write requests are forwarded to. The circuit of a peer
+// opens after a number of consecutive failed write requests, failing the write requests to the peer without dialing
+// it for the open duration. Then a single probing write request is forwarded to the peer, whose result closes or
+// opens the circuit again.
+type peerCircuitBreakers struct {
+	logger           log.Logger
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+
+	mtx   sync.Mutex
+	peers map[string]*peerCircuit
+
+	state *prometheus.GaugeVec
+}
+
+// newPeerCircuitBreakers creates circuit breakers opening the circuit of a peer for openDuration after
+// failureThreshold consecutive failed write requests. A failureThreshold of 0 disables them.
+func newPeerCircuitBreakers(logger log.Logger, reg prometheus.Registerer, failureThreshold int, openDuration time.Duration) *peerCircuitBreakers {
+	return &peerCircuitBreakers{
+		logger:           logger,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+		peers:            map[string]*peerCircuit{},
+		state: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_forward_circuit_state",
+			Help: "State of the circuit breaker of the write requests forwarded to the endpoint: 0 closed, 1 open, 2 half-open.",
+		}, []string{"endpoint"}),
+	}
+}
+
+// allow returns true if a write request can be forwarded to the peer. Callers allowed to forward a request must
+// record its result with done.
+func (c *peerCircuitBreakers) allow(endpoint string) bool {
+	if c.failureThreshold <= 0 {
+		return true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	p, ok := c.peers[endpoint]
+	if !ok {
+		return true
+	}
+	switch p.state {
+	case circuitOpen:
+		if c.now().Before(p.openTill) {
+			return false
+		}
+		c.set(endpoint, p, circuitHalfOpen)
+		p.probing = true
+		return true
+	case circuitHalfOpen:
+		if p.probing {
+			return false
+		}
+		p.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the result of a write request forwarded to the peer.
+func (c *peerCircuitBreakers) done(endpoint string, err error) {
+	if c.failureThreshold <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	p, ok := c.peers[endpoint]
+	if !ok {
+		p = &peerCircuit{}
+		c.peers[endpoint] = p
+		c.state.WithLabelValues(endpoint).Set(float64(circuitClosed))
+	}
+	p.probing = false
+
+	if isNeutralPeerResult(err) {
+		return
+	}
+	if !isPeerFailure(err) {
+		p.failures = 0
+		if p.state != circuitClosed {
+			level.Info(c.logger).Log("msg", "closing circuit of endpoint", "endpoint", endpoint)
+			c.set(endpoint, p, circuitClosed)
+		}
+		return
+	}
+
+	p.failures++
+	if p.state == circuitHalfOpen || (p.state == circuitClosed && p.failures >= c.failureThreshold) {
+		level.Warn(c.logger).Log("msg", "opening circuit of endpoint", "endpoint", endpoint, "failures", p.failures, "for", c.openDuration, "err", err)
+		p.openTill = c.now().Add(c.openDuration)
+		c.set(endpoint, p, circuitOpen)
+	}
+}
+
+// release records that a write request allowed to be forwarded to the peer was not sent, without changing its circuit.
+func (c *peerCircuitBreakers) release(endpoint string) {
+	if c.failureThreshold <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if p, ok := c.peers[endpoint]; ok {
+		p.probing = false
+	}
+}
+
+func (c *peerCircuitBreakers) set(endpoint string, p *peerCircuit, state circuitState) {
+	p.state = state
+	c.state.WithLabelValues(endpoint).Set(float64(state))
+}
+
+// reset closes the circuits of all peers, e.g. when the hashring changes.
+func (c *peerCircuitBreakers) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.peers = map[string]*peerCircuit{}
+	c.state.Reset()
+}
+
+// isNeutralPeerResult returns true if the error of a forwarded write request tells nothing about the health of the
+// peer, leaving its circuit as it is, e.g. for write requests canceled once the quorum was known.
+func isNeutralPeerResult(err error) bool {
+	return status.Code(err) == codes.Canceled
+}
+
+// isPeerFailure returns true if the error of a forwarded write request is a failure of the peer. Write requests
+// rejected because of their samples or tenant show that the peer is healthy.
+func isPeerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if status.Code(err) == codes.InvalidArgument {
+		return false
+	}
+	return !isConflict(err) && !isTooManyTenants(err)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPeerCircuitBreakers(t *testing.T) {
+	const peer = "peer"
+	now := time.Unix(1600000000, 0)
+	c := newPeerCircuitBreakers(log.NewNopLogger(), nil, 3, time.Minute)
+	c.now = func() time.Time { return now }
+
+	// Write requests rejected because of their samples do not count as failures.
+	for i := 0; i < 3; i++ {
+		testutil.Assert(t, c.allow(peer))
+		c.done(peer, status.Error(codes.AlreadyExists, "out of order"))
+	}
+	// Nor do failures interrupted by a success.
+	for i := 0; i < 2; i++ {
+		testutil.Assert(t, c.allow(peer))
+		c.done(peer, errors.New("failed"))
+	}
+	c.done(peer, nil)
+	testutil.Equals(t, float64(circuitClosed), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	// Canceled requests neither count as failures nor interrupt them.
+	for i := 0; i < 3; i++ {
+		testutil.Assert(t, c.allow(peer))
+		c.done(peer, errors.New("failed"))
+		c.done(peer, status.Error(codes.Canceled, "canceled"))
+	}
+	testutil.Equals(t, float64(circuitOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	c.reset()
+
+	for i := 0; i < 3; i++ {
+		testutil.Assert(t, c.allow(peer))
+		c.done(peer, status.Error(codes.Unavailable, "unavailable"))
+	}
+	testutil.Equals(t, float64(circuitOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	testutil.Assert(t, !c.allow(peer))
+	testutil.Assert(t, c.allow("other"))
+
+	// Once the open duration passed, a single probing request is allowed, and opens the circuit again if it fails.
+	now = now.Add(time.Minute)
+	testutil.Assert(t, c.allow(peer))
+	testutil.Equals(t, float64(circuitHalfOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	testutil.Assert(t, !c.allow(peer))
+	c.done(peer, status.Error(codes.DeadlineExceeded, "timeout"))
+	testutil.Equals(t, float64(circuitOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	testutil.Assert(t, !c.allow(peer))
+
+	// Probing requests failing with an unknown error open the circuit again, like in any other state.
+	now = now.Add(time.Minute)
+	testutil.Assert(t, c.allow(peer))
+	testutil.Equals(t, float64(circuitHalfOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	c.done(peer, errors.New("failed"))
+	testutil.Equals(t, float64(circuitOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	testutil.Assert(t, !c.allow(peer))
+
+	// Probing requests canceled or not sent leave the circuit half-open for the next probing request.
+	now = now.Add(time.Minute)
+	for _, result := range []func(){
+		func() { c.done(peer, status.Error(codes.Canceled, "canceled")) },
+		func() { c.release(peer) },
+	} {
+		testutil.Assert(t, c.allow(peer))
+		testutil.Assert(t, !c.allow(peer))
+		result()
+		testutil.Equals(t, float64(circuitHalfOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	}
+	testutil.Assert(t, c.allow(peer))
+	c.done(peer, status.Error(codes.Unavailable, "unavailable"))
+	testutil.Equals(t, float64(circuitOpen), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+
+	// A successful probing request closes the circuit.
+	now = now.Add(time.Minute)
+	testutil.Assert(t, c.allow(peer))
+	c.done(peer, nil)
+	testutil.Equals(t, float64(circuitClosed), promtest.ToFloat64(c.state.WithLabelValues(peer)))
+	testutil.Assert(t, c.allow(peer))
+	testutil.Assert(t, c.allow(peer))
+
+	// Disabled circuit breakers never open.
+	c = newPeerCircuitBreakers(log.NewNopLogger(), nil, 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		c.done(peer, errors.New("failed"))
+	}
+	testutil.Assert(t, c.allow(peer))
+}
+
+func TestReceiveQuorumWithOpenCircuits(t *testing.T) {
+	const tenant = "foo"
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+
+	var appendables []*fakeAppendable
+	for i := 0; i < 3; i++ {
+		appendables = append(appendables, &fakeAppendable{appender: newFakeAppender(nil, nil, nil)})
+	}
+	handlers, _ := newTestHandlerHashring(appendables, 3)
+	h := handlers[0]
+	h.peerCircuits = newPeerCircuitBreakers(log.NewNopLogger(), nil, 1, time.Hour)
+
+	peerCalls := func(i int) int {
+		f := h.peers.cache[handlers[i].options.Endpoint].(*fakeRemoteWriteGRPCServer)
+		f.callsMtx.Lock()
+		defer f.callsMtx.Unlock()
+		return f.v1Calls + f.v2Calls
+	}
+
+	// The quorum is still reached with the circuit of one peer open, which is not sent the write request.
+	h.peerCircuits.done(handlers[2].options.Endpoint, errors.New("failed"))
+	rec, err := makeRequest(h, tenant, wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, 1.0, promtest.ToFloat64(h.degradedReplications.WithLabelValues(tenant)))
+	testutil.Equals(t, 1, peerCalls(1))
+	testutil.Equals(t, 0, peerCalls(2))
+
+	// The quorum is not reached with the circuits of two peers open.
+	h.peerCircuits.done(handlers[1].options.Endpoint, errors.New("failed"))
+	rec, err = makeRequest(h, tenant, wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	testutil.Equals(t, 1, peerCalls(1))
+	testutil.Equals(t, 0, peerCalls(2))
+}
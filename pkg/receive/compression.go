@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/internal/cortex/util/grpcencoding/snappy"
+	"github.com/thanos-io/thanos/pkg/extgrpc/zstd"
+)
+
+// ReplicationCompressionNone disables the compression of write requests forwarded to peers.
+const ReplicationCompressionNone = "none"
+
+// ReplicationCompressions are the supported compressions of write requests forwarded to peers.
+var ReplicationCompressions = []string{ReplicationCompressionNone, snappy.Name, zstd.Name}
+
+// grpcMsgHeaderLen is the length of the header gRPC prepends to each message on the wire.
+const grpcMsgHeaderLen = 5
+
+// replicationBytesHandler is the gRPC stats handler counting the bytes of the write requests sent to peers, before
+// and after their compression.
+type replicationBytesHandler struct {
+	uncompressedBytes prometheus.Counter
+	compressedBytes   prometheus.Counter
+}
+
+func newReplicationBytesHandler(reg prometheus.Registerer) *replicationBytesHandler {
+	return &replicationBytesHandler{
+		uncompressedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_replication_uncompressed_bytes_total",
+			Help: "The number of bytes of the write requests forwarded to peers, before compression.",
+		}),
+		compressedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_replication_compressed_bytes_total",
+			Help: "The number of bytes of the write requests forwarded to peers, as sent on the wire after compression, if any.",
+		}),
+	}
+}
+
+func (h *replicationBytesHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *replicationBytesHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	p, ok := s.(*stats.OutPayload)
+	if !ok || !p.IsClient() {
+		return
+	}
+	h.uncompressedBytes.Add(float64(p.Length))
+	h.compressedBytes.Add(float64(p.WireLength - grpcMsgHeaderLen))
+}
+
+func (h *replicationBytesHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *replicationBytesHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// isCompressionUnsupported returns true if the error is the one of a gRPC server which doesn't support the
+// compression of the request, i.e. which has no decompressor registered for it.
+func isCompressionUnsupported(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.Unimplemented && strings.Contains(st.Message(), "grpc-encoding")
+}
+
+// compressed calls f with the compressor of the peer group, falling back to uncompressed calls for peers which don't
+// support it.
+func (p *peerGroup) compressed(addr string, f func(opts ...grpc.CallOption) error) error {
+	if p.compression == "" || p.compression == ReplicationCompressionNone {
+		return f()
+	}
+
+	p.m.RLock()
+	_, uncompressed := p.uncompressed[addr]
+	p.m.RUnlock()
+
+	if !uncompressed {
+		err := f(grpc.UseCompressor(p.compression))
+		if !isCompressionUnsupported(err) {
+			return err
+		}
+		p.m.Lock()
+		p.uncompressed[addr] = struct{}{}
+		p.m.Unlock()
+	}
+	return f()
+}
@@ -0,0 +1,204 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/internal/cortex/util/grpcencoding/snappy"
+	"github.com/thanos-io/thanos/pkg/extgrpc/zstd"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// replicationTimeSeries returns the time series of a representative remote write request, with series of a few
+// metrics and targets.
+func replicationTimeSeries(n int) []prompb.TimeSeries {
+	timeseries := make([]prompb.TimeSeries, 0, n)
+	for i := 0; i < n; i++ {
+		timeseries = append(timeseries, prompb.TimeSeries{
+			Labels: []labelpb.ZLabel{
+				{Name: "__name__", Value: fmt.Sprintf("http_requests_total_%d", i%20)},
+				{Name: "cluster", Value: "eu-west-1"},
+				{Name: "instance", Value: fmt.Sprintf("10.0.%d.%d:9090", i/250, i%250)},
+				{Name: "job", Value: "api-server"},
+				{Name: "status_code", Value: fmt.Sprintf("%d", 200+i%5)},
+			},
+			Samples: []prompb.Sample{{Value: float64(i), Timestamp: 1660000000000 + int64(i)}},
+		})
+	}
+	return timeseries
+}
+
+func TestReceiveForwardCompression(t *testing.T) {
+	for _, compression := range ReplicationCompressions {
+		t.Run(compression, func(t *testing.T) {
+			app := newFakeAppender(nil, nil, nil)
+			ingestor := NewHandler(nil, &Options{
+				TenantHeader:      DefaultTenantHeader,
+				ReplicaHeader:     DefaultReplicaHeader,
+				ReplicationFactor: 1,
+				ForwardTimeout:    5 * time.Second,
+				Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+			})
+			ingestor.Hashring(SingleNodeHashring(""))
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			testutil.Ok(t, err)
+			srv := grpc.NewServer()
+			storepb.RegisterWriteableStoreServer(srv, ingestor)
+			go func() { _ = srv.Serve(l) }()
+			t.Cleanup(srv.Stop)
+
+			reg := prometheus.NewRegistry()
+			router := NewHandler(nil, &Options{
+				Registry:               reg,
+				TenantHeader:           DefaultTenantHeader,
+				ReplicaHeader:          DefaultReplicaHeader,
+				ReplicationFactor:      1,
+				ForwardTimeout:         5 * time.Second,
+				ReceiverMode:           RouterOnly,
+				DialOpts:               []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+				ReplicationCompression: compression,
+			})
+			router.peers.dialer = func(ctx context.Context, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+				conn, err := grpc.DialContext(ctx, target, opts...)
+				if err == nil {
+					t.Cleanup(func() { testutil.Ok(t, conn.Close()) })
+				}
+				return conn, err
+			}
+			router.Hashring(SingleNodeHashring(l.Addr().String()))
+
+			rec, err := makeRequest(router, "test", &prompb.WriteRequest{Timeseries: replicationTimeSeries(100)})
+			testutil.Ok(t, err)
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+			testutil.Equals(t, 1, len(app.Get(labels.FromStrings(
+				"__name__", "http_requests_total_0", "cluster", "eu-west-1", "instance", "10.0.0.0:9090", "job", "api-server", "status_code", "200",
+			))))
+
+			uncompressed := promtest.ToFloat64(router.replicationBytes.uncompressedBytes)
+			compressed := promtest.ToFloat64(router.replicationBytes.compressedBytes)
+			testutil.Assert(t, uncompressed > 0, "no forwarded bytes counted")
+			if compression == ReplicationCompressionNone {
+				testutil.Equals(t, uncompressed, compressed)
+				return
+			}
+			testutil.Assert(t, compressed < uncompressed/2, "expected compressed bytes %v to be less than half of uncompressed bytes %v", compressed, uncompressed)
+		})
+	}
+}
+
+// compressionUnsupportedClient simulates a peer without the decompressor of the compression of the requests.
+type compressionUnsupportedClient struct {
+	*fakeRemoteWriteGRPCServer
+
+	compressedCalls int
+}
+
+func (c *compressionUnsupportedClient) RemoteWriteV2(ctx context.Context, in *storepb.WriteRequestV2, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	for _, o := range opts {
+		if co, ok := o.(grpc.CompressorCallOption); ok {
+			c.callsMtx.Lock()
+			c.compressedCalls++
+			c.callsMtx.Unlock()
+			return nil, status.Errorf(codes.Unimplemented, "grpc: Decompressor is not installed for grpc-encoding %q", co.CompressorType)
+		}
+	}
+	return c.fakeRemoteWriteGRPCServer.RemoteWriteV2(ctx, in, opts...)
+}
+
+func TestReceiveForwardCompressionFallback(t *testing.T) {
+	app := newFakeAppender(nil, nil, nil)
+	ingestor := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: 1,
+		ForwardTimeout:    5 * time.Second,
+		Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+	})
+	ingestor.Hashring(SingleNodeHashring(""))
+
+	addr := randomAddr()
+	peer := &compressionUnsupportedClient{fakeRemoteWriteGRPCServer: &fakeRemoteWriteGRPCServer{h: ingestor}}
+	router := NewHandler(nil, &Options{
+		TenantHeader:           DefaultTenantHeader,
+		ReplicaHeader:          DefaultReplicaHeader,
+		ReplicationFactor:      1,
+		ForwardTimeout:         5 * time.Second,
+		ReceiverMode:           RouterOnly,
+		ReplicationCompression: zstd.Name,
+	})
+	router.peers.cache[addr] = peer
+	router.Hashring(SingleNodeHashring(addr))
+
+	wreq := &prompb.WriteRequest{Timeseries: replicationTimeSeries(1)}
+	for i := 0; i < 2; i++ {
+		wreq.Timeseries[0].Samples[0].Timestamp = int64(i)
+		rec, err := makeRequest(router, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+	testutil.Equals(t, 2, len(app.Get(labelpb.ZLabelsToPromLabels(wreq.Timeseries[0].Labels))))
+
+	// Compression is only attempted once per peer, without falling back to Remote Write 1.0.
+	testutil.Equals(t, 1, peer.compressedCalls)
+	testutil.Equals(t, 2, peer.v2Calls)
+	testutil.Equals(t, 0, peer.v1Calls)
+}
+
+// BenchmarkReplicationCompression measures the CPU overhead of the compressions of forwarded write requests. The
+// compressed size relative to the uncompressed one is reported as the ratio metric.
+func BenchmarkReplicationCompression(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		req := &storepb.WriteRequestV2{Request: toWriteV2(replicationTimeSeries(n)), Tenant: "default-tenant"}
+		data, err := proto.Marshal(req)
+		testutil.Ok(b, err)
+
+		for _, name := range []string{snappy.Name, zstd.Name} {
+			c := encoding.GetCompressor(name)
+			b.Run(fmt.Sprintf("%s/series=%d", name, n), func(b *testing.B) {
+				var compressed int
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					var cw countingWriter
+					w, err := c.Compress(&cw)
+					testutil.Ok(b, err)
+					_, err = w.Write(data)
+					testutil.Ok(b, err)
+					testutil.Ok(b, w.Close())
+					compressed = int(cw)
+				}
+				b.ReportMetric(float64(compressed)/float64(len(data)), "ratio")
+			})
+		}
+	}
+}
+
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
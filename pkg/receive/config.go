@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -40,9 +41,77 @@ const (
 // HashringConfig represents the configuration for a hashring
 // a receive node knows about.
 type HashringConfig struct {
-	Hashring  string   `json:"hashring,omitempty"`
-	Tenants   []string `json:"tenants,omitempty"`
-	Endpoints []string `json:"endpoints"`
+	Hashring  string     `json:"hashring,omitempty"`
+	Tenants   []string   `json:"tenants,omitempty"`
+	Endpoints []Endpoint `json:"endpoints"`
+	// ActivationTime is the time at which a configuration reloaded by the ConfigWatcher replaces the one in use.
+	// The latest activation time of the hashrings of a configuration applies to all of them.
+	ActivationTime *time.Time `json:"activation_time,omitempty"`
+}
+
+// Endpoint represents a single receive node within a hashring.
+// It can be specified either as a plain address string or as an object with an address and weight.
+type Endpoint struct {
+	Address string `json:"address"`
+	// Weight scales the share of the hashring owned by the endpoint relatively to others.
+	// It is only honored by the ketama algorithm. Zero value means the default weight of 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// weight returns the effective weight of the endpoint.
+func (e Endpoint) weight() int {
+	if e.Weight == 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	// Plain address string, as used before weights were introduced.
+	if err := json.Unmarshal(data, &e.Address); err == nil {
+		e.Weight = 0
+		return nil
+	}
+
+	var raw struct {
+		Address string `json:"address"`
+		Weight  *int   `json:"weight"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Address == "" {
+		return errors.New("endpoint address is empty")
+	}
+	e.Address = raw.Address
+	e.Weight = 0
+	if raw.Weight != nil {
+		if *raw.Weight <= 0 {
+			return errors.Errorf("endpoint %s: weight must be positive, got %d", raw.Address, *raw.Weight)
+		}
+		e.Weight = *raw.Weight
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// Endpoints with the default weight are marshaled as plain address strings.
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	if e.weight() == 1 {
+		return json.Marshal(e.Address)
+	}
+	type plain Endpoint
+	return json.Marshal(plain(e))
+}
+
+// EndpointsFromAddresses returns endpoints with the default weight for the given addresses.
+func EndpointsFromAddresses(addrs ...string) []Endpoint {
+	endpoints := make([]Endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, Endpoint{Address: addr})
+	}
+	return endpoints
 }
 
 // ConfigWatcher is able to watch a file containing a hashring configuration
@@ -62,9 +131,22 @@ type ConfigWatcher struct {
 	refreshCounter       prometheus.Counter
 	hashringNodesGauge   *prometheus.GaugeVec
 	hashringTenantsGauge *prometheus.GaugeVec
+	hashringOwnership    *prometheus.GaugeVec
+	pendingGauge         prometheus.Gauge
+	activationTimeGauge  prometheus.Gauge
+
+	now func() time.Time
 
 	// lastLoadedConfigHash is the hash of the last successfully loaded configuration.
 	lastLoadedConfigHash float64
+	// applied is true once a configuration was sent on the channel.
+	applied bool
+	// pending is the loaded configuration waiting for its activation time, when activationTimer fires.
+	pending         []HashringConfig
+	activationTimer *time.Timer
+
+	mtx          sync.Mutex
+	pendingUntil time.Time
 }
 
 // NewConfigWatcher creates a new ConfigWatcher.
@@ -129,7 +211,29 @@ func NewConfigWatcher(logger log.Logger, reg prometheus.Registerer, path string,
 				Help: "The number of tenants per hashring.",
 			},
 			[]string{"name"}),
+		hashringOwnership: promauto.With(reg).NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_hashring_endpoint_ownership_ratio",
+				Help: "The share of the hash space owned by each endpoint per hashring.",
+			},
+			[]string{"name", "endpoint"}),
+		pendingGauge: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_hashring_config_pending",
+				Help: "Whether a loaded hashring configuration is waiting for its activation time.",
+			}),
+		activationTimeGauge: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_hashring_config_activation_timestamp_seconds",
+				Help: "Activation time of the pending hashring configuration, 0 if there is none.",
+			}),
+		now: time.Now,
 	}
+	promauto.With(reg).NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "thanos_receive_hashring_config_activation_remaining_seconds",
+			Help: "Seconds until the pending hashring configuration is activated, 0 if there is none.",
+		}, c.activationRemaining)
 	return c, nil
 }
 
@@ -164,6 +268,9 @@ func (cw *ConfigWatcher) Run(ctx context.Context) {
 			// The most reliable solution is to reload everything if anything happens.
 			cw.refresh(ctx)
 
+		case <-cw.activationC():
+			cw.activatePending(ctx)
+
 		case <-ticker.C:
 			// Setting a new watch after an update might fail. Make sure we don't lose
 			// those files forever.
@@ -208,6 +315,9 @@ func (cw *ConfigWatcher) Stop() {
 			}
 		}
 	}()
+	if cw.activationTimer != nil {
+		cw.activationTimer.Stop()
+	}
 	if err := cw.watcher.Close(); err != nil {
 		level.Error(cw.logger).Log("msg", "error closing file watcher", "path", cw.path, "err", err)
 	}
@@ -216,7 +326,8 @@ func (cw *ConfigWatcher) Stop() {
 	level.Debug(cw.logger).Log("msg", "hashring configuration watcher stopped")
 }
 
-// refresh reads the configured file and sends the hashring configuration on the channel.
+// refresh reads the configured file and sends the hashring configuration on the channel, or schedules it if its
+// activation time is in the future.
 func (cw *ConfigWatcher) refresh(ctx context.Context) {
 	cw.refreshCounter.Inc()
 
@@ -240,6 +351,67 @@ func (cw *ConfigWatcher) refresh(ctx context.Context) {
 	cw.successGauge.Set(1)
 	cw.lastSuccessTimeGauge.SetToCurrentTime()
 
+	at := activationTime(config)
+	if !at.IsZero() && at.After(cw.now()) {
+		if cw.applied {
+			cw.schedule(config, at)
+			return
+		}
+		// There is no configuration to keep using until then.
+		level.Warn(cw.logger).Log("msg", "applying hashring config before its activation time, as no other hashring config was applied yet", "activation_time", at)
+	}
+	cw.apply(ctx, config)
+}
+
+// schedule keeps the configuration pending until its activation time, replacing any other pending configuration.
+func (cw *ConfigWatcher) schedule(config []HashringConfig, at time.Time) {
+	if cw.activationTimer != nil {
+		cw.activationTimer.Stop()
+	}
+	cw.pending = config
+	cw.activationTimer = time.NewTimer(at.Sub(cw.now()))
+
+	cw.mtx.Lock()
+	cw.pendingUntil = at
+	cw.mtx.Unlock()
+	cw.pendingGauge.Set(1)
+	cw.activationTimeGauge.Set(float64(at.UnixNano()) / 1e9)
+
+	level.Info(cw.logger).Log("msg", "loaded hashring config, scheduled its activation", "activation_time", at)
+}
+
+// activationC returns the chan on which the activation time of the pending configuration is sent, if any.
+func (cw *ConfigWatcher) activationC() <-chan time.Time {
+	if cw.activationTimer == nil {
+		return nil
+	}
+	return cw.activationTimer.C
+}
+
+// activatePending sends the pending configuration on the channel.
+func (cw *ConfigWatcher) activatePending(ctx context.Context) {
+	if cw.pending == nil {
+		return
+	}
+	level.Info(cw.logger).Log("msg", "activating scheduled hashring config")
+	cw.apply(ctx, cw.pending)
+}
+
+// apply sends the configuration on the channel, dropping the pending configuration.
+func (cw *ConfigWatcher) apply(ctx context.Context, config []HashringConfig) {
+	if cw.activationTimer != nil {
+		cw.activationTimer.Stop()
+		cw.activationTimer = nil
+	}
+	cw.pending = nil
+	cw.mtx.Lock()
+	cw.pendingUntil = time.Time{}
+	cw.mtx.Unlock()
+	cw.pendingGauge.Set(0)
+	cw.activationTimeGauge.Set(0)
+
+	cw.hashringNodesGauge.Reset()
+	cw.hashringTenantsGauge.Reset()
 	for _, c := range config {
 		cw.hashringNodesGauge.WithLabelValues(c.Hashring).Set(float64(len(c.Endpoints)))
 		cw.hashringTenantsGauge.WithLabelValues(c.Hashring).Set(float64(len(c.Tenants)))
@@ -250,8 +422,53 @@ func (cw *ConfigWatcher) refresh(ctx context.Context) {
 	case <-ctx.Done():
 		return
 	case cw.ch <- config:
+		cw.applied = true
+		return
+	}
+}
+
+func (cw *ConfigWatcher) activationRemaining() float64 {
+	cw.mtx.Lock()
+	defer cw.mtx.Unlock()
+
+	if cw.pendingUntil.IsZero() {
+		return 0
+	}
+	if d := cw.pendingUntil.Sub(cw.now()); d > 0 {
+		return d.Seconds()
+	}
+	return 0
+}
+
+// activationTime returns the latest activation time of the hashrings of the configuration, or the zero time if none
+// of them has one.
+func activationTime(config []HashringConfig) time.Time {
+	var at time.Time
+	for _, c := range config {
+		if c.ActivationTime != nil && c.ActivationTime.After(at) {
+			at = *c.ActivationTime
+		}
+	}
+	return at
+}
+
+// setOwnership exposes the ownership of endpoints in the given hashring built from the given configuration.
+func (cw *ConfigWatcher) setOwnership(cfg []HashringConfig, h Hashring) {
+	m, ok := h.(*multiHashring)
+	if !ok {
 		return
 	}
+
+	cw.hashringOwnership.Reset()
+	for i, r := range m.hashrings {
+		o, ok := r.(ownershipHashring)
+		if !ok {
+			continue
+		}
+		for endpoint, share := range o.ownership() {
+			cw.hashringOwnership.WithLabelValues(cfg[i].Hashring, endpoint).Set(share)
+		}
+	}
 }
 
 // loadConfig loads raw configuration content and returns a configuration.
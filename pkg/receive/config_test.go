@@ -4,12 +4,16 @@
 package receive
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -39,7 +43,7 @@ func TestValidateConfig(t *testing.T) {
 			name: "valid config",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1"},
+					Endpoints: []Endpoint{{Address: "node1"}},
 				},
 			},
 			err: nil, // means it's valid.
@@ -72,3 +76,120 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestParseConfigEndpoints(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		content  string
+		expected []HashringConfig
+		err      bool
+	}{
+		{
+			name:     "plain addresses",
+			content:  `[{"endpoints":["node1","node2"]}]`,
+			expected: []HashringConfig{{Endpoints: []Endpoint{{Address: "node1"}, {Address: "node2"}}}},
+		},
+		{
+			name:     "mixed addresses and weighted endpoints",
+			content:  `[{"endpoints":["node1",{"address":"node2","weight":2},{"address":"node3"}]}]`,
+			expected: []HashringConfig{{Endpoints: []Endpoint{{Address: "node1"}, {Address: "node2", Weight: 2}, {Address: "node3"}}}},
+		},
+		{
+			name:    "zero weight",
+			content: `[{"endpoints":[{"address":"node1","weight":0}]}]`,
+			err:     true,
+		},
+		{
+			name:    "negative weight",
+			content: `[{"endpoints":[{"address":"node1","weight":-1}]}]`,
+			err:     true,
+		},
+		{
+			name:    "missing address",
+			content: `[{"endpoints":[{"weight":2}]}]`,
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := parseConfig([]byte(tc.content))
+			if tc.err {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, cfg)
+		})
+	}
+}
+
+func TestEndpointMarshalJSON(t *testing.T) {
+	// Endpoints with default weight have to marshal the same way as before weights were introduced.
+	content, err := json.Marshal([]HashringConfig{{Endpoints: []Endpoint{{Address: "node1"}, {Address: "node2", Weight: 1}}}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, `[{"endpoints":["node1","node2"]}]`, string(content))
+
+	content, err = json.Marshal(Endpoint{Address: "node1", Weight: 3})
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"address":"node1","weight":3}`, string(content))
+}
+
+func TestConfigWatcherActivationTime(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "hashrings.json")
+	write := func(content string) {
+		testutil.Ok(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	write(`[{"endpoints":["node1"],"activation_time":"2020-09-13T13:00:00Z"}]`)
+	cw, err := NewConfigWatcher(nil, nil, path, 1)
+	testutil.Ok(t, err)
+	defer cw.Stop()
+	cw.now = func() time.Time { return now }
+	cw.ch = make(chan []HashringConfig, 1)
+
+	// Without a configuration in use, the first one is applied regardless of its activation time.
+	cw.refresh(ctx)
+	testutil.Equals(t, "node1", (<-cw.C())[0].Endpoints[0].Address)
+
+	// Later ones are pending until their activation time.
+	write(`[{"endpoints":["node2"],"activation_time":"2020-09-13T13:00:00Z"}]`)
+	cw.refresh(ctx)
+	testutil.Equals(t, 0, len(cw.ch))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(cw.pendingGauge))
+	testutil.Equals(t, float64(time.Date(2020, 9, 13, 13, 0, 0, 0, time.UTC).Unix()), promtest.ToFloat64(cw.activationTimeGauge))
+	testutil.Equals(t, 3600.0, cw.activationRemaining())
+	testutil.Assert(t, cw.activationC() != nil)
+
+	// A pending configuration is replaced by the next one.
+	write(`[{"endpoints":["node3"],"activation_time":"2020-09-13T12:50:00Z"},{"hashring":"b","endpoints":["node4"]}]`)
+	cw.refresh(ctx)
+	testutil.Equals(t, 0, len(cw.ch))
+	testutil.Equals(t, 3000.0, cw.activationRemaining())
+
+	cw.activatePending(ctx)
+	cfg := <-cw.C()
+	testutil.Equals(t, 2, len(cfg))
+	testutil.Equals(t, "node3", cfg[0].Endpoints[0].Address)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(cw.pendingGauge))
+	testutil.Equals(t, 0.0, cw.activationRemaining())
+	testutil.Assert(t, cw.activationC() == nil)
+
+	// Activation times in the past apply immediately, and drop the pending configuration.
+	write(`[{"endpoints":["node5"],"activation_time":"2020-09-13T13:00:00Z"}]`)
+	cw.refresh(ctx)
+	write(`[{"endpoints":["node6"],"activation_time":"2020-09-13T11:00:00Z"}]`)
+	cw.refresh(ctx)
+	testutil.Equals(t, "node6", (<-cw.C())[0].Endpoints[0].Address)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(cw.pendingGauge))
+	cw.activatePending(ctx)
+	testutil.Equals(t, 0, len(cw.ch))
+
+	// Malformed activation times reject the reload.
+	write(`[{"endpoints":["node7"],"activation_time":"13:00"}]`)
+	cw.refresh(ctx)
+	testutil.Equals(t, 0, len(cw.ch))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(cw.errorCounter))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(cw.pendingGauge))
+	testutil.NotOk(t, cw.ValidateConfig())
+}
@@ -0,0 +1,261 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	// DebugHeader is the HTTP header of the write requests asking for the replication decisions of the receiver in the
+	// response, set to true.
+	DebugHeader = "X-Thanos-Receive-Debug"
+
+	// debugBatchHeader lists the decisions for a batch of series of the write request, one value per batch.
+	debugBatchHeader = "X-Thanos-Receive-Debug-Batch"
+	// debugSummaryHeader summarizes the decisions for all batches of series of the write request.
+	debugSummaryHeader = "X-Thanos-Receive-Debug-Summary"
+
+	// maxDebugBatches is the number of batches listed in the response, the other ones are only summarized.
+	maxDebugBatches = 10
+	// maxDebugErrorLen is the length of the replica errors beyond which they are truncated in the trace span.
+	maxDebugErrorLen = 256
+
+	replicaPending   = "pending"
+	replicaSucceeded = "succeeded"
+	replicaFailed    = "failed"
+	replicaQueued    = "queued"
+)
+
+var replicaStates = []string{replicaSucceeded, replicaFailed, replicaPending, replicaQueued}
+
+type writeDebugKey struct{}
+
+type writeDebugBatchKey struct{}
+
+// writeDebug records the replication decisions for a write request: the endpoint each batch of its series was routed
+// to, the replicas of each batch and their result, and the write quorum. It is safe for concurrent use, and all its
+// methods are no-ops on nil writeDebug.
+type writeDebug struct {
+	mtx     sync.Mutex
+	batches []*writeDebugBatch
+}
+
+// writeDebugBatch are the replication decisions for a batch of series routed to the same endpoint. All its methods are
+// no-ops on nil writeDebugBatch.
+type writeDebugBatch struct {
+	d        *writeDebug
+	endpoint string
+	series   int
+	// quorum is the write quorum of the batch, 0 if it was not replicated by this receiver.
+	quorum int
+	// tolerated is the number of failed replicas tolerated by the write quorum.
+	tolerated int
+	replicas  []*writeDebugReplica
+}
+
+type writeDebugReplica struct {
+	endpoint string
+	state    string
+	err      error
+}
+
+// withWriteDebug returns a context recording the replication decisions for the write request in d.
+func withWriteDebug(ctx context.Context, d *writeDebug) context.Context {
+	return context.WithValue(ctx, writeDebugKey{}, d)
+}
+
+// writeDebugFromContext returns the replication decisions recorded for the write request of the context, nil if they
+// are not recorded.
+func writeDebugFromContext(ctx context.Context) *writeDebug {
+	d, _ := ctx.Value(writeDebugKey{}).(*writeDebug)
+	return d
+}
+
+// withWriteDebugBatch returns a context recording the decisions for the replicas of the batch in b.
+func withWriteDebugBatch(ctx context.Context, b *writeDebugBatch) context.Context {
+	if b == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, writeDebugBatchKey{}, b)
+}
+
+// writeDebugBatchFromContext returns the batch the replicas written with the context belong to, nil if unknown.
+func writeDebugBatchFromContext(ctx context.Context) *writeDebugBatch {
+	b, _ := ctx.Value(writeDebugBatchKey{}).(*writeDebugBatch)
+	return b
+}
+
+// addBatch records a batch of the given number of series routed to the given endpoint.
+func (d *writeDebug) addBatch(endpoint string, series int) *writeDebugBatch {
+	if d == nil {
+		return nil
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	b := &writeDebugBatch{d: d, endpoint: endpoint, series: series}
+	d.batches = append(d.batches, b)
+	return b
+}
+
+// batch returns the batch routed to the given endpoint, nil if there is none.
+func (d *writeDebug) batch(endpoint string) *writeDebugBatch {
+	if d == nil {
+		return nil
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, b := range d.batches {
+		if b.endpoint == endpoint {
+			return b
+		}
+	}
+	return nil
+}
+
+// addReplicas records the pending replicas of the batch.
+func (b *writeDebugBatch) addReplicas(endpoints []string) {
+	if b == nil {
+		return
+	}
+	b.d.mtx.Lock()
+	defer b.d.mtx.Unlock()
+
+	for _, endpoint := range endpoints {
+		b.replica(endpoint)
+	}
+}
+
+// replicaDone records the result of the replica of the batch written to the given endpoint.
+func (b *writeDebugBatch) replicaDone(endpoint string, err error) {
+	if b == nil {
+		return
+	}
+	b.d.mtx.Lock()
+	defer b.d.mtx.Unlock()
+
+	r := b.replica(endpoint)
+	r.state, r.err = replicaSucceeded, err
+	if err != nil {
+		r.state = replicaFailed
+	}
+}
+
+// replicaQueued records that the replica of the batch for the given endpoint is written asynchronously.
+func (b *writeDebugBatch) replicaQueued(endpoint string) {
+	if b == nil {
+		return
+	}
+	b.d.mtx.Lock()
+	defer b.d.mtx.Unlock()
+
+	b.replica(endpoint).state = replicaQueued
+}
+
+// quorumDone records the write quorum of the batch and the number of failed replicas it tolerated.
+func (b *writeDebugBatch) quorumDone(quorum, tolerated int) {
+	if b == nil {
+		return
+	}
+	b.d.mtx.Lock()
+	defer b.d.mtx.Unlock()
+
+	b.quorum, b.tolerated = quorum, tolerated
+}
+
+// replica returns the replica of the batch for the given endpoint, adding it if needed. The lock must be held.
+func (b *writeDebugBatch) replica(endpoint string) *writeDebugReplica {
+	for _, r := range b.replicas {
+		if r.endpoint == endpoint {
+			return r
+		}
+	}
+	r := &writeDebugReplica{endpoint: endpoint, state: replicaPending}
+	b.replicas = append(b.replicas, r)
+	return r
+}
+
+// String returns the decisions for the batch, the replicas being listed by state. The lock must be held.
+func (b *writeDebugBatch) String() string {
+	fields := []string{"endpoint=" + b.endpoint, fmt.Sprintf("series=%d", b.series)}
+	if b.quorum > 0 {
+		fields = append(fields, fmt.Sprintf("quorum=%d", b.quorum), fmt.Sprintf("failures_tolerated=%d", b.tolerated))
+	}
+	for _, state := range replicaStates {
+		var endpoints []string
+		for _, r := range b.replicas {
+			if r.state == state {
+				endpoints = append(endpoints, r.endpoint)
+			}
+		}
+		if len(endpoints) > 0 {
+			fields = append(fields, state+"="+strings.Join(endpoints, ","))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// report returns the decisions for the first maxDebugBatches batches by endpoint, the summary of the decisions for
+// all batches, and the errors of the failed replicas of the listed batches.
+func (d *writeDebug) report() (batches []string, summary string, errs []string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	sort.Slice(d.batches, func(i, j int) bool { return d.batches[i].endpoint < d.batches[j].endpoint })
+	var series, failed, degraded int
+	for i, b := range d.batches {
+		series += b.series
+		if b.tolerated > 0 {
+			degraded++
+		}
+		for _, r := range b.replicas {
+			if r.state != replicaFailed {
+				continue
+			}
+			failed++
+			if i < maxDebugBatches {
+				msg := r.err.Error()
+				if len(msg) > maxDebugErrorLen {
+					msg = msg[:maxDebugErrorLen] + "..."
+				}
+				errs = append(errs, r.endpoint+": "+msg)
+			}
+		}
+		if i < maxDebugBatches {
+			batches = append(batches, b.String())
+		}
+	}
+	summary = fmt.Sprintf("batches=%d series=%d failed_replicas=%d degraded_batches=%d omitted_batches=%d",
+		len(d.batches), series, failed, degraded, len(d.batches)-len(batches))
+	return batches, summary, errs
+}
+
+// export sets the decisions for the write request in the headers of its response and attaches them to its span.
+func (d *writeDebug) export(header http.Header, span opentracing.Span) {
+	if d == nil {
+		return
+	}
+	batches, summary, errs := d.report()
+	for _, b := range batches {
+		header.Add(debugBatchHeader, b)
+	}
+	header.Set(debugSummaryHeader, summary)
+
+	span.SetTag("receive.debug.summary", summary)
+	for _, b := range batches {
+		span.LogKV("event", "receive batch", "batch", b)
+	}
+	for _, err := range errs {
+		span.LogKV("event", "receive replica failed", "error", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestWriteDebug_Report(t *testing.T) {
+	d := &writeDebug{}
+	for i := maxDebugBatches; i >= 0; i-- {
+		b := d.addBatch(fmt.Sprintf("receive-%02d:10901", i), 2)
+		b.addReplicas([]string{"a:10901", "b:10901", "c:10901"})
+		b.replicaDone("a:10901", nil)
+		b.replicaDone("b:10901", errors.New(strings.Repeat("x", 2*maxDebugErrorLen)))
+		b.quorumDone(2, 1)
+	}
+	d.batch("receive-00:10901").replicaQueued("c:10901")
+
+	batches, summary, errs := d.report()
+	testutil.Equals(t, maxDebugBatches, len(batches))
+	testutil.Equals(t, "endpoint=receive-00:10901 series=2 quorum=2 failures_tolerated=1 succeeded=a:10901 failed=b:10901 queued=c:10901", batches[0])
+	testutil.Equals(t, "endpoint=receive-01:10901 series=2 quorum=2 failures_tolerated=1 succeeded=a:10901 failed=b:10901 pending=c:10901", batches[1])
+	testutil.Equals(t, "batches=11 series=22 failed_replicas=11 degraded_batches=11 omitted_batches=1", summary)
+	// The errors are listed for the listed batches only, truncated.
+	testutil.Equals(t, maxDebugBatches, len(errs))
+	testutil.Equals(t, "b:10901: "+strings.Repeat("x", maxDebugErrorLen)+"...", errs[0])
+
+	// Nil writeDebug records nothing.
+	var nd *writeDebug
+	nd.addBatch("a:10901", 1).replicaDone("a:10901", nil)
+	nd.export(http.Header{}, nil)
+}
+
+func TestReceiveDebugHeader(t *testing.T) {
+	const tenant = "foo"
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	buf, err := proto.Marshal(wreq)
+	testutil.Ok(t, err)
+
+	slowAppenderFn := func() error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil), appenderErr: slowAppenderFn},
+		{appender: newFakeAppender(nil, nil, nil), appenderErr: slowAppenderFn},
+		{appender: newFakeAppender(nil, nil, nil), appenderErr: func() error { return errors.New("failed to get appender") }},
+	}
+	handlers, _ := newTestHandlerHashring(appendables, 3)
+	h := handlers[0]
+
+	request := func(debug string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", h.options.Endpoint, bytes.NewBuffer(snappy.Encode(nil, buf)))
+		testutil.Ok(t, err)
+		req.Header.Add(h.options.TenantHeader, tenant)
+		if debug != "" {
+			req.Header.Add(DebugHeader, debug)
+		}
+		rec := httptest.NewRecorder()
+		h.receiveHTTP(rec, req)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		return rec
+	}
+
+	// The debug header is ignored unless enabled.
+	rec := request("true")
+	testutil.Equals(t, "", rec.Header().Get(debugSummaryHeader))
+
+	h.options.EnableDebugHeader = true
+	rec = request("")
+	testutil.Equals(t, "", rec.Header().Get(debugSummaryHeader))
+
+	rec = request("true")
+	testutil.Equals(t, "batches=1 series=1 failed_replicas=1 degraded_batches=1 omitted_batches=0", rec.Header().Get(debugSummaryHeader))
+	batches := rec.Header().Values(debugBatchHeader)
+	testutil.Equals(t, 1, len(batches))
+	testutil.Assert(t, strings.Contains(batches[0], " series=1 quorum=2 failures_tolerated=1 "), "unexpected batch %q", batches[0])
+	testutil.Assert(t, strings.HasSuffix(batches[0], " failed="+handlers[2].options.Endpoint), "unexpected batch %q", batches[0])
+}
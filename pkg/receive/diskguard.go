@@ -0,0 +1,78 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+)
+
+// errDiskFull is returned for write requests rejected while the disk usage of the data directory is above the high watermark.
+var errDiskFull = errors.New("disk usage of the data directory is above the high watermark; write requests are rejected until local blocks are uploaded or deleted")
+
+// DiskGuard tracks the disk usage of the data directory against high and low watermarks. Once the usage reaches the
+// high watermark, it reports the disk as full until the usage drops below the low watermark again.
+type DiskGuard struct {
+	logger    log.Logger
+	dir       string
+	high, low float64
+	usage     func(dir string) (float64, error)
+
+	aboveHigh atomic.Bool
+
+	usageRatio prometheus.Gauge
+	exceeded   prometheus.Gauge
+}
+
+// NewDiskGuard creates a DiskGuard of the given data directory. The watermarks are disk usage ratios between 0 and 1.
+func NewDiskGuard(logger log.Logger, reg prometheus.Registerer, dir string, high, low float64) *DiskGuard {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &DiskGuard{
+		logger: logger,
+		dir:    dir,
+		high:   high,
+		low:    low,
+		usage:  diskUsage,
+		usageRatio: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_disk_usage_ratio",
+			Help: "Ratio of the used space of the file system of the data directory.",
+		}),
+		exceeded: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_disk_watermark_exceeded",
+			Help: "1 if the disk usage reached the high watermark and did not drop below the low watermark since, so write requests are rejected.",
+		}),
+	}
+}
+
+// Update measures the disk usage of the data directory and updates the watermark state.
+func (g *DiskGuard) Update() error {
+	ratio, err := g.usage(g.dir)
+	if err != nil {
+		return errors.Wrapf(err, "get disk usage of %s", g.dir)
+	}
+	g.usageRatio.Set(ratio)
+
+	switch {
+	case !g.aboveHigh.Load() && ratio >= g.high:
+		g.aboveHigh.Store(true)
+		g.exceeded.Set(1)
+		level.Warn(g.logger).Log("msg", "disk usage reached the high watermark, rejecting write requests", "usage", ratio, "high_watermark", g.high)
+	case g.aboveHigh.Load() && ratio < g.low:
+		g.aboveHigh.Store(false)
+		g.exceeded.Set(0)
+		level.Info(g.logger).Log("msg", "disk usage dropped below the low watermark, accepting write requests", "usage", ratio, "low_watermark", g.low)
+	}
+	return nil
+}
+
+// AboveHighWatermark returns true if the disk usage reached the high watermark and did not drop below the low watermark since.
+func (g *DiskGuard) AboveHighWatermark() bool {
+	return g.aboveHigh.Load()
+}
@@ -0,0 +1,54 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestDiskGuard(t *testing.T) {
+	g := NewDiskGuard(log.NewNopLogger(), nil, "", 0.9, 0.8)
+	var usage float64
+	g.usage = func(string) (float64, error) { return usage, nil }
+
+	for _, tc := range []struct {
+		usage     float64
+		aboveHigh bool
+	}{
+		{usage: 0.5},
+		{usage: 0.89},
+		{usage: 0.9, aboveHigh: true},
+		{usage: 0.85, aboveHigh: true},
+		{usage: 0.8, aboveHigh: true},
+		{usage: 0.79},
+		{usage: 0.85},
+	} {
+		usage = tc.usage
+		testutil.Ok(t, g.Update())
+		testutil.Equals(t, tc.aboveHigh, g.AboveHighWatermark(), "usage %v", tc.usage)
+		testutil.Equals(t, tc.usage, promtest.ToFloat64(g.usageRatio))
+	}
+
+	// The state is kept if the usage can't be measured.
+	usage = 0.95
+	testutil.Ok(t, g.Update())
+	g.usage = func(string) (float64, error) { return 0, errors.New("statfs failed") }
+	testutil.NotOk(t, g.Update())
+	testutil.Assert(t, g.AboveHighWatermark(), "expected disk above high watermark")
+	testutil.Equals(t, 1.0, promtest.ToFloat64(g.exceeded))
+}
+
+func TestDiskUsage(t *testing.T) {
+	usage, err := diskUsage(t.TempDir())
+	if err != nil {
+		t.Skip("disk usage is not supported:", err)
+	}
+	testutil.Assert(t, usage >= 0 && usage <= 1, "unexpected disk usage %v", usage)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package receive
+
+import "syscall"
+
+// diskUsage returns the ratio of the used space of the file system of the given directory, as reported by df.
+func diskUsage(dir string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	used := (uint64(stat.Blocks) - uint64(stat.Bfree)) * uint64(stat.Bsize)
+	avail := uint64(stat.Bavail) * uint64(stat.Bsize)
+	if used+avail == 0 {
+		return 0, nil
+	}
+	return float64(used) / float64(used+avail), nil
+}
@@ -0,0 +1,13 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package receive
+
+import "github.com/pkg/errors"
+
+func diskUsage(string) (float64, error) {
+	return 0, errors.New("disk usage is not supported on this platform")
+}
@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"io"
 	stdlog "log"
+	"math"
 	"net"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +34,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
@@ -46,6 +49,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
@@ -60,9 +64,14 @@ const (
 	DefaultReplicaHeader = "THANOS-REPLICA"
 	// AllTenantsQueryParam is the query parameter for getting TSDB stats for all tenants.
 	AllTenantsQueryParam = "all_tenants"
+	// TenantQueryParam is the query parameter for getting TSDB stats for a tenant, like the tenant header.
+	TenantQueryParam = "tenant"
 	// Labels for metrics.
-	labelSuccess = "success"
-	labelError   = "error"
+	labelSuccess  = "success"
+	labelError    = "error"
+	labelDegraded = "degraded"
+	// OtherTenantsLabel is the tenant label value of detailed write metrics of tenants not in Options.MetricsTenants.
+	OtherTenantsLabel = "__other__"
 )
 
 // Allowed fields in client certificates.
@@ -72,6 +81,16 @@ const (
 	CertificateFieldCommonName         = "commonName"
 )
 
+// Sources of the tenant of write requests.
+const (
+	// TenantSourceHeader takes the tenant from the Options.TenantHeader HTTP header.
+	TenantSourceHeader = "header"
+	// TenantSourceCertificate takes the tenant from the Options.TenantField field of the client certificate.
+	TenantSourceCertificate = "certificate"
+	// TenantSourceLabel takes the tenant from the Options.TenantExtractionLabel label of the incoming series.
+	TenantSourceLabel = "label"
+)
+
 var (
 	// errConflict is returned whenever an operation fails due to any conflict-type error.
 	errConflict = errors.New("conflict")
@@ -79,6 +98,9 @@ var (
 	errBadReplica  = errors.New("request replica exceeds receiver replication factor")
 	errNotReady    = errors.New("target not ready")
 	errUnavailable = errors.New("target not available")
+
+	// errNotReplicated is returned by ingestors which accept only write requests forwarded by routers.
+	errNotReplicated = errors.New("request is not replicated; only write requests forwarded by routers are accepted")
 )
 
 // Options for the web Handler.
@@ -99,6 +121,53 @@ type Options struct {
 	ForwardTimeout    time.Duration
 	RelabelConfigs    []*relabel.Config
 	TSDBStats         TSDBStats
+
+	// ReplicatedWritesOnly makes an IngestorOnly receiver reject write requests which were not forwarded by a router.
+	ReplicatedWritesOnly bool
+	// MetricsTenants limits the tenants labelled by their ID in the detailed write duration metrics, all other tenants
+	// are labelled with OtherTenantsLabel. If empty, all tenants are labelled by their ID.
+	MetricsTenants []string
+	// DiskGuard makes the receiver reject local writes while the disk usage is above its high watermark, if set.
+	DiskGuard *DiskGuard
+	// TenantSources is the order of the sources the tenant of write requests is taken from, the first source
+	// providing a tenant wins. If empty, the tenant is taken only from the client certificate if TenantField is set,
+	// and from the TenantHeader otherwise.
+	TenantSources []string
+	// TenantExtractionLabel is the label of the incoming series the TenantSourceLabel source takes the tenant from.
+	TenantExtractionLabel string
+	// RemoveTenantExtractionLabel removes the TenantExtractionLabel from the incoming series before they are written.
+	RemoveTenantExtractionLabel bool
+	// RejectMissingTenant rejects write requests whose tenant can't be determined, instead of writing them to the
+	// DefaultTenantID.
+	RejectMissingTenant bool
+	// RemoteReplicator replicates the write requests received from clients to the hashring of a remote cluster once
+	// they were written to the local hashring, if set.
+	RemoteReplicator *RemoteReplicator
+	// AsyncReplicator enables the async replication mode if set: write requests received from clients are
+	// acknowledged once their first replica, preferably the local one, was written, and their other replicas are
+	// queued to it. The write quorum is not enforced in this mode.
+	AsyncReplicator *AsyncReplicator
+	// ReplicationCompression is the compression of the write requests forwarded to peers, one of
+	// ReplicationCompressions. Peers not supporting it are sent uncompressed requests.
+	ReplicationCompression string
+	// LabelValidation is the validation of the labels of the series of write requests received from clients, one of
+	// LabelValidationModes. Empty means LabelValidationNone.
+	LabelValidation string
+	// TenantLabelValidation is the label validation mode by tenant, overriding LabelValidation.
+	TenantLabelValidation map[string]string
+	// ForwardCircuitBreakerFailures is the number of consecutive failed write requests forwarded to a peer after
+	// which its circuit opens, failing the write requests to the peer without sending them for
+	// ForwardCircuitBreakerOpenDuration. 0 disables the circuit breakers.
+	ForwardCircuitBreakerFailures int
+	// ForwardCircuitBreakerOpenDuration is how long the circuit of a peer stays open before a probing write request
+	// is forwarded to it.
+	ForwardCircuitBreakerOpenDuration time.Duration
+	// Admission limits the number of write requests received from clients processed concurrently, if set. Write
+	// requests are rejected with 429 Too Many Requests when the admission queue of their tenant is full.
+	Admission *Admission
+	// EnableDebugHeader makes the receiver list its replication decisions for the write requests with the DebugHeader
+	// set to true in the headers of their response and in their trace span.
+	EnableDebugHeader bool
 }
 
 // Handler serves a Prometheus remote write receiving HTTP endpoint.
@@ -114,16 +183,36 @@ type Handler struct {
 	peers        *peerGroup
 	expBackoff   backoff.Backoff
 	peerStates   map[string]*retryState
+	peerCircuits *peerCircuitBreakers
 	receiverMode ReceiverMode
 
+	// tenantRelabelConfigs are the write relabel configs by tenant, applied after the global ones.
+	tenantRelabelConfigs map[string][]*relabel.Config
+
 	forwardRequests   *prometheus.CounterVec
 	replications      *prometheus.CounterVec
 	replicationFactor prometheus.Gauge
+	replicationMode   *prometheus.GaugeVec
+	replicationBytes  *replicationBytesHandler
 
 	writeSamplesTotal    *prometheus.HistogramVec
 	writeTimeseriesTotal *prometheus.HistogramVec
+
+	relabelDroppedSeries  *prometheus.CounterVec
+	relabelModifiedSeries *prometheus.CounterVec
+	invalidLabelsSeries   *prometheus.CounterVec
+
+	// metricsTenants are the tenants labelled by their ID in the metrics below, nil if all are.
+	metricsTenants       map[string]struct{}
+	localAppendDuration  *prometheus.HistogramVec
+	forwardDuration      *prometheus.HistogramVec
+	quorumWaitDuration   *prometheus.HistogramVec
+	degradedReplications *prometheus.CounterVec
+	diskFullRejections   *prometheus.CounterVec
 }
 
+var writeDurationBuckets = []float64{0.001, 0.005, 0.01, 0.02, 0.03, 0.04, 0.05, 0.06, 0.07, 0.08, 0.09, 0.1, 0.25, 0.5, 0.75, 1, 2, 3, 4, 5}
+
 func NewHandler(logger log.Logger, o *Options) *Handler {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -139,7 +228,6 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 		writer:       o.Writer,
 		router:       route.New(),
 		options:      o,
-		peers:        newPeerGroup(o.DialOpts...),
 		receiverMode: o.ReceiverMode,
 		expBackoff: backoff.Backoff{
 			Factor: 2,
@@ -165,6 +253,12 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 				Help: "The number of times to replicate incoming write requests.",
 			},
 		),
+		replicationMode: promauto.With(registerer).NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_replication_mode",
+				Help: "The replication mode of incoming write requests, set to 1 for the mode in use. In the async mode, write requests are acknowledged without write quorum.",
+			}, []string{"mode"},
+		),
 		writeTimeseriesTotal: promauto.With(registerer).NewHistogramVec(
 			prometheus.HistogramOpts{
 				Namespace: "thanos",
@@ -183,7 +277,65 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 				Buckets:   []float64{10, 50, 100, 500, 1000, 5000, 10000},
 			}, []string{"code", "tenant"},
 		),
+		relabelDroppedSeries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_relabel_dropped_series_total",
+				Help: "The number of incoming series dropped by relabeling.",
+			}, []string{"tenant"},
+		),
+		relabelModifiedSeries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_relabel_modified_series_total",
+				Help: "The number of incoming series whose labels were changed by relabeling.",
+			}, []string{"tenant"},
+		),
+		invalidLabelsSeries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_invalid_labels_series_total",
+				Help: "The number of incoming series with invalid labels, by reason and whether they were rejected or normalized.",
+			}, []string{"tenant", "reason", "action"},
+		),
+		localAppendDuration: promauto.With(registerer).NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "thanos_receive_local_append_duration_seconds",
+				Help:    "The duration of appending write requests to the local TSDB of the tenant.",
+				Buckets: writeDurationBuckets,
+			}, []string{"tenant"},
+		),
+		forwardDuration: promauto.With(registerer).NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "thanos_receive_forward_duration_seconds",
+				Help:    "The duration of forwarding write requests to other receivers.",
+				Buckets: writeDurationBuckets,
+			}, []string{"tenant", "endpoint", "result"},
+		),
+		quorumWaitDuration: promauto.With(registerer).NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "thanos_receive_replication_quorum_wait_duration_seconds",
+				Help:    "The duration of waiting for the write quorum of replicated write requests. The result is degraded if the quorum was reached despite failed replicas.",
+				Buckets: writeDurationBuckets,
+			}, []string{"tenant", "result"},
+		),
+		degradedReplications: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_replications_degraded_total",
+				Help: "The number of replication operations which reached the write quorum only by tolerating failed replicas.",
+			}, []string{"tenant"},
+		),
+		diskFullRejections: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_disk_watermark_rejected_requests_total",
+				Help: "The number of local writes rejected because the disk usage was above the high watermark.",
+			}, []string{"tenant"},
+		),
 	}
+	h.metricsTenants = newMetricsTenants(o.MetricsTenants)
+	h.peerCircuits = newPeerCircuitBreakers(logger, registerer, o.ForwardCircuitBreakerFailures, o.ForwardCircuitBreakerOpenDuration)
+
+	h.replicationBytes = newReplicationBytesHandler(registerer)
+	// The stats handler only sees the write requests forwarded to peers, as the peer group has its own connections.
+	dialOpts := append(append([]grpc.DialOption{}, o.DialOpts...), grpc.WithStatsHandler(h.replicationBytes))
+	h.peers = newPeerGroup(o.ReplicationCompression, dialOpts...)
 
 	h.forwardRequests.WithLabelValues(labelSuccess)
 	h.forwardRequests.WithLabelValues(labelError)
@@ -195,13 +347,20 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 	} else {
 		h.replicationFactor.Set(1)
 	}
+	if o.AsyncReplicator != nil {
+		h.replicationMode.WithLabelValues(ReplicationModeSync).Set(0)
+		h.replicationMode.WithLabelValues(ReplicationModeAsync).Set(1)
+	} else {
+		h.replicationMode.WithLabelValues(ReplicationModeSync).Set(1)
+		h.replicationMode.WithLabelValues(ReplicationModeAsync).Set(0)
+	}
 
 	ins := extpromhttp.NewNopInstrumentationMiddleware()
 	if o.Registry != nil {
 		ins = extpromhttp.NewTenantInstrumentationMiddleware(
 			o.TenantHeader,
 			o.Registry,
-			[]float64{0.001, 0.005, 0.01, 0.02, 0.03, 0.04, 0.05, 0.06, 0.07, 0.08, 0.09, 0.1, 0.25, 0.5, 0.75, 1, 2, 3, 4, 5},
+			writeDurationBuckets,
 		)
 	}
 
@@ -247,6 +406,16 @@ func (h *Handler) Hashring(hashring Hashring) {
 	h.hashring = hashring
 	h.expBackoff.Reset()
 	h.peerStates = make(map[string]*retryState)
+	h.peerCircuits.reset()
+}
+
+// TenantRelabelConfigs sets the write relabel configs by tenant, applied to incoming series of the tenant
+// after the global relabel configs, before they are routed and appended.
+func (h *Handler) TenantRelabelConfigs(configs map[string][]*relabel.Config) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.tenantRelabelConfigs = configs
 }
 
 // Verifies whether the server is ready or not.
@@ -280,9 +449,17 @@ func (h *Handler) getStats(r *http.Request, statsByLabelName string) ([]statusap
 	}
 
 	tenantID := r.Header.Get(h.options.TenantHeader)
-	getAllTenantStats := r.FormValue(AllTenantsQueryParam) == "true"
+	if param := r.FormValue(TenantQueryParam); param != "" {
+		if tenantID != "" && tenantID != param {
+			err := fmt.Errorf("the %s parameter and the %s header name different tenants", TenantQueryParam, h.options.TenantHeader)
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		tenantID = param
+	}
+	// The aggregated stats are the ones of all tenants.
+	getAllTenantStats := r.FormValue(AllTenantsQueryParam) == "true" || r.FormValue(statusapi.AggregateQueryParam) == "true"
 	if getAllTenantStats && tenantID != "" {
-		err := fmt.Errorf("using both the %s parameter and the %s header is not supported", AllTenantsQueryParam, h.options.TenantHeader)
+		err := fmt.Errorf("using both the %s or %s parameters and a tenant is not supported", AllTenantsQueryParam, statusapi.AggregateQueryParam)
 		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
@@ -347,12 +524,26 @@ type replica struct {
 func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string, wreq *prompb.WriteRequest) error {
 	tLogger := log.With(h.logger, "tenant", tenant)
 
+	// Ingestors never forward write requests, they store all time series locally.
+	// The replica number was already chosen by the router, so it is not checked
+	// against the replication factor of this receiver.
+	if h.receiverMode == IngestorOnly {
+		if rep == 0 && h.options.ReplicatedWritesOnly {
+			level.Error(tLogger).Log("err", errNotReplicated, "msg", "write request rejected")
+			return errNotReplicated
+		}
+		err := h.writeLocally(ctx, tenant, wreq)
+		writeDebugFromContext(ctx).addBatch(h.options.Endpoint, len(wreq.Timeseries)).replicaDone(h.options.Endpoint, err)
+		return err
+	}
+
 	// This replica value is used to detect cycles in cyclic topologies.
 	// A non-zero value indicates that the request has already been replicated by a previous receive instance.
 	// For almost all users, this is only used in fully connected topologies of IngestorRouter instances.
 	// For acyclic topologies that use RouterOnly and IngestorOnly instances, this causes issues when replicating data.
 	// See discussion in: https://github.com/thanos-io/thanos/issues/4359.
-	if h.receiverMode == RouterOnly || h.receiverMode == IngestorOnly {
+	replicated := rep != 0
+	if h.receiverMode == RouterOnly {
 		rep = 0
 	}
 
@@ -373,7 +564,29 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string,
 	// Forward any time series as necessary. All time series
 	// destined for the local node will be written to the receiver.
 	// Time series will be replicated as necessary.
-	return h.forward(ctx, tenant, r, wreq)
+	if err := h.forward(ctx, tenant, r, wreq); err != nil {
+		return err
+	}
+
+	// Only write requests of clients are replicated to the remote hashring, the replicated ones were either received
+	// from a remote cluster or already queued by the receiver which replicated them.
+	if h.options.RemoteReplicator != nil && !replicated {
+		h.options.RemoteReplicator.Enqueue(tenant, wreq)
+	}
+	return nil
+}
+
+// writeLocally writes the time series of the write request to the local TSDB of the tenant.
+func (h *Handler) writeLocally(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error {
+	var err error
+	tracing.DoInSpan(ctx, "receive_tsdb_write", func(ctx context.Context) {
+		err = h.appendLocally(ctx, tenant, wreq)
+	})
+	if err != nil {
+		level.Debug(h.logger).Log("msg", "local tsdb write failed", "tenant", tenant, "err", err.Error())
+		return errors.Wrap(determineWriteErrorCause(err, 1), "store locally")
+	}
+	return nil
 }
 
 func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
@@ -381,21 +594,17 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	span, ctx := tracing.StartSpan(r.Context(), "receive_http")
 	defer span.Finish()
 
-	tenant := r.Header.Get(h.options.TenantHeader)
-	if tenant == "" {
-		tenant = h.options.DefaultTenantID
-	}
-
-	if h.options.TenantField != "" {
-		tenant, err = h.getTenantFromCertificate(r)
-		if err != nil {
-			// This must hard fail to ensure hard tenancy when feature is enabled.
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	writeProto, err := remoteWriteProto(r.Header.Get("Content-Type"), r.Header.Get(remoteWriteVersionHeader))
+	if err == nil {
+		if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "snappy" {
+			err = errors.Wrapf(errUnsupportedRemoteWriteProto, "content encoding %q", enc)
 		}
 	}
-
-	tLogger := log.With(h.logger, "tenant", tenant)
+	if err != nil {
+		w.Header().Set("Accept", remoteWriteAcceptedContentTypes)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
 
 	// ioutil.ReadAll dynamically adjust the byte slice for read data, starting from 512B.
 	// Since this is receive hot path, grow upfront saving allocations and CPU time.
@@ -413,7 +622,7 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 
 	reqBuf, err := s2.Decode(nil, compressed.Bytes())
 	if err != nil {
-		level.Error(tLogger).Log("msg", "snappy decode error", "err", err)
+		level.Error(h.logger).Log("msg", "snappy decode error", "err", err)
 		http.Error(w, errors.Wrap(err, "snappy decode error").Error(), http.StatusBadRequest)
 		return
 	}
@@ -421,11 +630,37 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	// NOTE: Due to zero copy ZLabels, Labels used from WriteRequests keeps memory
 	// from the whole request. Ensure that we always copy those when we want to
 	// store them for longer time.
-	var wreq prompb.WriteRequest
-	if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
+	var (
+		wreq    prompb.WriteRequest
+		v2Stats *writeV2Stats
+	)
+	switch writeProto {
+	case remoteWriteV2Proto:
+		var req writev2pb.Request
+		if err := proto.Unmarshal(reqBuf, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v1, stats, err := fromWriteV2(&req)
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "decode remote write 2.0 request").Error(), http.StatusBadRequest)
+			return
+		}
+		wreq, v2Stats = *v1, &stats
+	default:
+		if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenant, err := h.determineTenant(r, &wreq)
+	if err != nil {
+		// This must hard fail to ensure hard tenancy when the tenant is required.
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	tLogger := log.With(h.logger, "tenant", tenant)
 
 	rep := uint64(0)
 	// If the header is empty, we assume the request is not yet replicated.
@@ -439,6 +674,13 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	// Exit early if the request contained no data. We don't support metadata yet. We also cannot fail here, because
 	// this would mean lack of forward compatibility for remote write proto.
 	if len(wreq.Timeseries) == 0 {
+		if v2Stats != nil {
+			writeV2Response(w, writeV2Stats{})
+			if v2Stats.histograms > 0 {
+				http.Error(w, errNativeHistograms.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 		// TODO(yeya24): Handle remote write metadata.
 		if len(wreq.Metadata) > 0 {
 			// TODO(bwplotka): Do we need this error message?
@@ -449,15 +691,68 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Apply relabeling configs.
-	h.relabel(&wreq)
+	if err := h.validateLabels(tenant, &wreq); err != nil {
+		level.Debug(tLogger).Log("msg", "rejected write request with invalid labels", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Apply relabeling configs. Series are routed by their relabeled labels.
+	h.relabel(tenant, &wreq)
 	if len(wreq.Timeseries) == 0 {
 		level.Debug(tLogger).Log("msg", "remote write request dropped due to relabeling.")
+		if v2Stats != nil {
+			writeV2Response(w, writeV2Stats{})
+		}
 		return
 	}
 
+	if h.options.Admission != nil {
+		var release func()
+		tracing.DoInSpan(ctx, "receive_admission_wait", func(ctx context.Context) {
+			release, err = h.options.Admission.Acquire(ctx, tenant)
+		})
+		if err != nil {
+			level.Debug(tLogger).Log("msg", "write request not admitted", "err", err)
+			if err == errAdmissionQueueFull {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.options.Admission.RetryAfter().Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+	}
+
+	var dbg *writeDebug
+	if h.options.EnableDebugHeader {
+		if debug, _ := strconv.ParseBool(r.Header.Get(DebugHeader)); debug {
+			dbg = &writeDebug{}
+			ctx = withWriteDebug(ctx, dbg)
+		}
+	}
+
 	responseStatusCode := http.StatusOK
-	if err = h.handleRequest(ctx, rep, tenant, &wreq); err != nil {
+	err = h.handleRequest(ctx, rep, tenant, &wreq)
+	dbg.export(w.Header(), span)
+	if v2Stats != nil {
+		if err == nil {
+			written := writeV2Stats{}
+			for _, ts := range wreq.Timeseries {
+				written.samples += len(ts.Samples)
+				written.exemplars += len(ts.Exemplars)
+			}
+			writeV2Response(w, written)
+			if v2Stats.histograms > 0 {
+				// Everything else was written, let the client know what was not.
+				err = errNativeHistograms
+			}
+		} else {
+			writeV2Response(w, writeV2Stats{})
+		}
+	}
+	if err != nil {
 		level.Debug(tLogger).Log("msg", "failed to handle request", "err", err)
 		switch determineWriteErrorCause(err, 1) {
 		case errNotReady:
@@ -466,7 +761,11 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 			responseStatusCode = http.StatusServiceUnavailable
 		case errConflict:
 			responseStatusCode = http.StatusConflict
-		case errBadReplica:
+		case errDiskFull:
+			responseStatusCode = http.StatusServiceUnavailable
+		case errTooManyTenants:
+			responseStatusCode = http.StatusTooManyRequests
+		case errBadReplica, errNotReplicated, errNativeHistograms, errTenantNotAllowed:
 			responseStatusCode = http.StatusBadRequest
 		default:
 			level.Error(tLogger).Log("err", err, "msg", "internal server error")
@@ -527,7 +826,54 @@ func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *p
 	}
 	h.mtx.RUnlock()
 
-	return h.fanoutForward(ctx, tenant, replicas, wreqs, len(wreqs))
+	dbg := writeDebugFromContext(ctx)
+	for endpoint, wr := range wreqs {
+		dbg.addBatch(endpoint, len(wr.Timeseries))
+	}
+
+	_, err := h.fanoutForward(ctx, tenant, replicas, wreqs, len(wreqs))
+	return err
+}
+
+// appendLocally appends the write request to the local TSDB of the tenant, observing its duration.
+func (h *Handler) appendLocally(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error {
+	if h.options.DiskGuard != nil && h.options.DiskGuard.AboveHighWatermark() {
+		h.diskFullRejections.WithLabelValues(h.metricsTenant(tenant)).Inc()
+		return errDiskFull
+	}
+	defer func(begin time.Time) {
+		h.localAppendDuration.WithLabelValues(h.metricsTenant(tenant)).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return h.writer.Write(ctx, tenant, wreq)
+}
+
+// metricsTenant returns the tenant label value of the given tenant for the detailed write metrics.
+func (h *Handler) metricsTenant(tenant string) string {
+	return metricsTenantLabel(h.metricsTenants, tenant)
+}
+
+// newMetricsTenants returns the set of the tenants labelled by their ID in metrics, nil if all are.
+func newMetricsTenants(tenants []string) map[string]struct{} {
+	if len(tenants) == 0 {
+		return nil
+	}
+	res := make(map[string]struct{}, len(tenants))
+	for _, t := range tenants {
+		res[t] = struct{}{}
+	}
+	return res
+}
+
+// metricsTenantLabel returns the tenant label value of the given tenant in metrics labelling the given tenants by their
+// ID, and all other ones with OtherTenantsLabel.
+func metricsTenantLabel(metricsTenants map[string]struct{}, tenant string) string {
+	if metricsTenants == nil {
+		return tenant
+	}
+	if _, ok := metricsTenants[tenant]; ok {
+		return tenant
+	}
+	return OtherTenantsLabel
 }
 
 // writeQuorum returns minimum number of replicas that has to confirm write success before claiming replication success.
@@ -536,8 +882,9 @@ func (h *Handler) writeQuorum() int {
 }
 
 // fanoutForward fans out concurrently given set of write requests. It returns status immediately when quorum of
-// requests succeeds or fails or if context is canceled.
-func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas map[string]replica, wreqs map[string]*prompb.WriteRequest, successThreshold int) error {
+// requests succeeds or fails or if context is canceled. On success, it returns the number of requests that failed
+// before the quorum was reached.
+func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas map[string]replica, wreqs map[string]*prompb.WriteRequest, successThreshold int) (int, error) {
 	var errs errutil.MultiError
 
 	fctx, cancel := context.WithTimeout(tracing.CopyTraceContext(context.Background(), pctx), h.options.ForwardTimeout)
@@ -561,6 +908,18 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 
 	ec := make(chan error)
 
+	// The replicas are recorded in the batch of the context when replicating it, in the batch routed to their endpoint
+	// otherwise.
+	dbg, dbgBatch := writeDebugFromContext(pctx), writeDebugBatchFromContext(pctx)
+	done := func(endpoint string, err error) {
+		b := dbgBatch
+		if b == nil {
+			b = dbg.batch(endpoint)
+		}
+		b.replicaDone(endpoint, err)
+		ec <- err
+	}
+
 	var wg sync.WaitGroup
 	for endpoint := range wreqs {
 		wg.Add(1)
@@ -574,7 +933,7 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 
 				var err error
 				tracing.DoInSpan(fctx, "receive_replicate", func(ctx context.Context) {
-					err = h.replicate(ctx, tenant, wreqs[endpoint])
+					err = h.replicate(withWriteDebugBatch(ctx, dbg.batch(endpoint)), tenant, wreqs[endpoint])
 				})
 				if err != nil {
 					h.replications.WithLabelValues(labelError).Inc()
@@ -601,16 +960,16 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 
 				var err error
 				tracing.DoInSpan(fctx, "receive_tsdb_write", func(_ context.Context) {
-					err = h.writer.Write(fctx, tenant, wreqs[endpoint])
+					err = h.appendLocally(fctx, tenant, wreqs[endpoint])
 				})
 				if err != nil {
 					// When a MultiError is added to another MultiError, the error slices are concatenated, not nested.
 					// To avoid breaking the counting logic, we need to flatten the error.
 					level.Debug(tLogger).Log("msg", "local tsdb write failed", "err", err.Error())
-					ec <- errors.Wrapf(determineWriteErrorCause(err, 1), "store locally for endpoint %v", endpoint)
+					done(endpoint, errors.Wrapf(determineWriteErrorCause(err, 1), "store locally for endpoint %v", endpoint))
 					return
 				}
-				ec <- nil
+				done(endpoint, nil)
 			}(endpoint)
 
 			continue
@@ -620,6 +979,12 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 		go func(endpoint string) {
 			defer wg.Done()
 
+			// Peers whose circuit is open count as failed replicas without being dialed.
+			if !h.peerCircuits.allow(endpoint) {
+				done(endpoint, errors.Wrapf(errUnavailable, "circuit open for endpoint %v", endpoint))
+				return
+			}
+
 			var (
 				err error
 				cl  storepb.WriteableStoreClient
@@ -635,7 +1000,8 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 
 			cl, err = h.peers.get(fctx, endpoint)
 			if err != nil {
-				ec <- errors.Wrapf(err, "get peer connection for endpoint %v", endpoint)
+				h.peerCircuits.done(endpoint, err)
+				done(endpoint, errors.Wrapf(err, "get peer connection for endpoint %v", endpoint))
 				return
 			}
 
@@ -644,22 +1010,28 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 			if ok {
 				if time.Now().Before(b.nextAllowed) {
 					h.mtx.RUnlock()
-					ec <- errors.Wrapf(errUnavailable, "backing off forward request for endpoint %v", endpoint)
+					h.peerCircuits.release(endpoint)
+					done(endpoint, errors.Wrapf(errUnavailable, "backing off forward request for endpoint %v", endpoint))
 					return
 				}
 			}
 			h.mtx.RUnlock()
 
 			// Create a span to track the request made to another receive node.
+			begin := time.Now()
 			tracing.DoInSpan(fctx, "receive_forward", func(ctx context.Context) {
 				// Actually make the request against the endpoint we determined should handle these time series.
-				_, err = cl.RemoteWrite(ctx, &storepb.WriteRequest{
-					Timeseries: wreqs[endpoint].Timeseries,
-					Tenant:     tenant,
+				err = h.peers.remoteWrite(ctx, cl, endpoint, tenant, wreqs[endpoint].Timeseries,
 					// Increment replica since on-the-wire format is 1-indexed and 0 indicates un-replicated.
-					Replica: int64(replicas[endpoint].n + 1),
-				})
+					int64(replicas[endpoint].n+1),
+				)
 			})
+			result := labelSuccess
+			if err != nil {
+				result = labelError
+			}
+			h.forwardDuration.WithLabelValues(h.metricsTenant(tenant), endpoint, result).Observe(time.Since(begin).Seconds())
+			h.peerCircuits.done(endpoint, err)
 			if err != nil {
 				// Check if peer connection is unavailable, don't attempt to send requests constantly.
 				if st, ok := status.FromError(err); ok {
@@ -676,14 +1048,14 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 						h.mtx.Unlock()
 					}
 				}
-				ec <- errors.Wrapf(err, "forwarding request to endpoint %v", endpoint)
+				done(endpoint, errors.Wrapf(err, "forwarding request to endpoint %v", endpoint))
 				return
 			}
 			h.mtx.Lock()
 			delete(h.peerStates, endpoint)
 			h.mtx.Unlock()
 
-			ec <- nil
+			done(endpoint, nil)
 		}(endpoint)
 	}
 
@@ -708,10 +1080,10 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 	for {
 		select {
 		case <-fctx.Done():
-			return fctx.Err()
+			return 0, fctx.Err()
 		case err, more := <-ec:
 			if !more {
-				return errs.Err()
+				return 0, errs.Err()
 			}
 			if err == nil {
 				success++
@@ -719,7 +1091,7 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 					// In case the success threshold is lower than the total
 					// number of requests, then we can finish early here. This
 					// is the case for quorum writes for example.
-					return nil
+					return len(errs), nil
 				}
 				continue
 			}
@@ -735,6 +1107,7 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error {
 	wreqs := make(map[string]*prompb.WriteRequest)
 	replicas := make(map[string]replica)
+	endpoints := make([]string, 0, h.options.ReplicationFactor)
 	var i uint64
 
 	// It is possible that hashring is ready in testReady() but unready now,
@@ -753,23 +1126,91 @@ func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.Wri
 		}
 		wreqs[endpoint] = wreq
 		replicas[endpoint] = replica{i, true}
+		endpoints = append(endpoints, endpoint)
 	}
 	h.mtx.RUnlock()
 
+	dbgBatch := writeDebugBatchFromContext(ctx)
+	dbgBatch.addReplicas(endpoints)
+
+	if h.options.AsyncReplicator != nil {
+		return h.replicateAsync(ctx, tenant, endpoints, wreq)
+	}
+
 	quorum := h.writeQuorum()
+	begin := time.Now()
 	// fanoutForward only returns an error if successThreshold (quorum) is not reached.
-	if err := h.fanoutForward(ctx, tenant, replicas, wreqs, quorum); err != nil {
+	failed, err := h.fanoutForward(ctx, tenant, replicas, wreqs, quorum)
+	result := labelSuccess
+	switch {
+	case err != nil:
+		result = labelError
+	case failed > 0:
+		result = labelDegraded
+		h.degradedReplications.WithLabelValues(h.metricsTenant(tenant)).Inc()
+	}
+	h.quorumWaitDuration.WithLabelValues(h.metricsTenant(tenant), result).Observe(time.Since(begin).Seconds())
+	dbgBatch.quorumDone(quorum, failed)
+	if err != nil {
 		return errors.Wrap(determineWriteErrorCause(err, quorum), "quorum not reached")
 	}
 	return nil
 }
 
+// replicateAsync writes the first replica of the write request, the local one if the local endpoint is one of the
+// given replica endpoints, and queues the other replicas to the AsyncReplicator. It returns once the first replica
+// is written, regardless of the write quorum.
+func (h *Handler) replicateAsync(ctx context.Context, tenant string, endpoints []string, wreq *prompb.WriteRequest) error {
+	first := 0
+	for i, endpoint := range endpoints {
+		if endpoint == h.options.Endpoint {
+			first = i
+			break
+		}
+	}
+	_, err := h.fanoutForward(ctx, tenant,
+		map[string]replica{endpoints[first]: {n: uint64(first), replicated: true}},
+		map[string]*prompb.WriteRequest{endpoints[first]: wreq},
+		1,
+	)
+	if err != nil {
+		return errors.Wrap(determineWriteErrorCause(err, 1), "write first replica")
+	}
+	for i, endpoint := range endpoints {
+		// Hashrings with less endpoints than the replication factor return the same endpoint for several replicas.
+		if endpoint != endpoints[first] {
+			h.options.AsyncReplicator.Enqueue(tenant, endpoint, uint64(i), wreq)
+			writeDebugBatchFromContext(ctx).replicaQueued(endpoint)
+		}
+	}
+	return nil
+}
+
 // RemoteWrite implements the gRPC remote write handler for storepb.WriteableStore.
 func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*storepb.WriteResponse, error) {
 	span, ctx := tracing.StartSpan(ctx, "receive_grpc")
 	defer span.Finish()
 
-	err := h.handleRequest(ctx, uint64(r.Replica), r.Tenant, &prompb.WriteRequest{Timeseries: r.Timeseries})
+	return h.handleGRPCRequest(ctx, uint64(r.Replica), r.Tenant, &prompb.WriteRequest{Timeseries: r.Timeseries})
+}
+
+// RemoteWriteV2 implements the gRPC Remote Write 2.0 handler for storepb.WriteableStore.
+func (h *Handler) RemoteWriteV2(ctx context.Context, r *storepb.WriteRequestV2) (*storepb.WriteResponse, error) {
+	span, ctx := tracing.StartSpan(ctx, "receive_grpc_v2")
+	defer span.Finish()
+
+	wreq, stats, err := fromWriteV2(&r.Request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "decode remote write 2.0 request").Error())
+	}
+	if stats.histograms > 0 {
+		return nil, status.Error(codes.InvalidArgument, errNativeHistograms.Error())
+	}
+	return h.handleGRPCRequest(ctx, uint64(r.Replica), r.Tenant, wreq)
+}
+
+func (h *Handler) handleGRPCRequest(ctx context.Context, rep uint64, tenant string, wreq *prompb.WriteRequest) (*storepb.WriteResponse, error) {
+	err := h.handleRequest(ctx, rep, tenant, wreq)
 	if err != nil {
 		level.Debug(h.logger).Log("msg", "failed to handle request", "err", err)
 	}
@@ -782,28 +1223,51 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 		return nil, status.Error(codes.Unavailable, err.Error())
 	case errConflict:
 		return nil, status.Error(codes.AlreadyExists, err.Error())
-	case errBadReplica:
+	case errDiskFull, errTooManyTenants:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errBadReplica, errNotReplicated, errTenantNotAllowed:
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	default:
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 }
 
-// relabel relabels the time series labels in the remote write request.
-func (h *Handler) relabel(wreq *prompb.WriteRequest) {
-	if len(h.options.RelabelConfigs) == 0 {
+// relabel relabels the time series labels in the remote write request
+// with the global relabel configs followed by the ones of the tenant.
+func (h *Handler) relabel(tenant string, wreq *prompb.WriteRequest) {
+	h.mtx.RLock()
+	tenantRelabelConfigs := h.tenantRelabelConfigs[tenant]
+	h.mtx.RUnlock()
+
+	if len(h.options.RelabelConfigs) == 0 && len(tenantRelabelConfigs) == 0 {
 		return
 	}
+	var dropped, modified int
 	timeSeries := make([]prompb.TimeSeries, 0, len(wreq.Timeseries))
 	for _, ts := range wreq.Timeseries {
-		lbls := relabel.Process(labelpb.ZLabelsToPromLabels(ts.Labels), h.options.RelabelConfigs...)
+		lset := labelpb.ZLabelsToPromLabels(ts.Labels)
+		lbls := relabel.Process(lset, h.options.RelabelConfigs...)
+		if lbls != nil && len(tenantRelabelConfigs) > 0 {
+			lbls = relabel.Process(lbls, tenantRelabelConfigs...)
+		}
 		if lbls == nil {
+			dropped++
 			continue
 		}
+		if !labels.Equal(lset, lbls) {
+			modified++
+		}
 		ts.Labels = labelpb.ZLabelsFromPromLabels(lbls)
 		timeSeries = append(timeSeries, ts)
 	}
 	wreq.Timeseries = timeSeries
+
+	if dropped > 0 {
+		h.relabelDroppedSeries.WithLabelValues(tenant).Add(float64(dropped))
+	}
+	if modified > 0 {
+		h.relabelModifiedSeries.WithLabelValues(tenant).Add(float64(modified))
+	}
 }
 
 // isConflict returns whether or not the given error represents a conflict.
@@ -834,6 +1298,26 @@ func isUnavailable(err error) bool {
 		status.Code(err) == codes.Unavailable
 }
 
+// isDiskFull returns whether or not the given error represents a write rejected due to the disk watermark.
+func isDiskFull(err error) bool {
+	return err == errDiskFull ||
+		(status.Code(err) == codes.ResourceExhausted && strings.Contains(status.Convert(err).Message(), errDiskFull.Error()))
+}
+
+// isTooManyTenants returns whether or not the given error represents a write of a new tenant rejected due to the
+// maximum number of tenants.
+func isTooManyTenants(err error) bool {
+	return err == errTooManyTenants ||
+		(status.Code(err) == codes.ResourceExhausted && strings.Contains(status.Convert(err).Message(), errTooManyTenants.Error()))
+}
+
+// isTenantNotAllowed returns whether or not the given error represents a write of a new tenant not allowed by the
+// tenant limits.
+func isTenantNotAllowed(err error) bool {
+	return err == errTenantNotAllowed ||
+		(status.Code(err) == codes.InvalidArgument && strings.Contains(status.Convert(err).Message(), errTenantNotAllowed.Error()))
+}
+
 // retryState encapsulates the number of request attempt made against a peer and,
 // next allowed time for the next attempt.
 type retryState struct {
@@ -876,6 +1360,9 @@ func determineWriteErrorCause(err error, threshold int) error {
 		{err: errConflict, cause: isConflict},
 		{err: errNotReady, cause: isNotReady},
 		{err: errUnavailable, cause: isUnavailable},
+		{err: errDiskFull, cause: isDiskFull},
+		{err: errTooManyTenants, cause: isTooManyTenants},
+		{err: errTenantNotAllowed, cause: isTenantNotAllowed},
 	}
 	for _, exp := range expErrs {
 		exp.count = 0
@@ -894,19 +1381,28 @@ func determineWriteErrorCause(err error, threshold int) error {
 	return err
 }
 
-func newPeerGroup(dialOpts ...grpc.DialOption) *peerGroup {
+func newPeerGroup(compression string, dialOpts ...grpc.DialOption) *peerGroup {
 	return &peerGroup{
-		dialOpts: dialOpts,
-		cache:    map[string]storepb.WriteableStoreClient{},
-		m:        sync.RWMutex{},
-		dialer:   grpc.DialContext,
+		dialOpts:     dialOpts,
+		compression:  compression,
+		cache:        map[string]storepb.WriteableStoreClient{},
+		v1Only:       map[string]struct{}{},
+		uncompressed: map[string]struct{}{},
+		m:            sync.RWMutex{},
+		dialer:       grpc.DialContext,
 	}
 }
 
 type peerGroup struct {
 	dialOpts []grpc.DialOption
-	cache    map[string]storepb.WriteableStoreClient
-	m        sync.RWMutex
+	// compression is the gRPC compressor of the write requests sent to the peers, if any.
+	compression string
+	cache       map[string]storepb.WriteableStoreClient
+	// v1Only holds the peers which do not implement Remote Write 2.0 yet.
+	v1Only map[string]struct{}
+	// uncompressed holds the peers which do not support the compression of the peer group.
+	uncompressed map[string]struct{}
+	m            sync.RWMutex
 
 	// dialer is used for testing.
 	dialer func(ctx context.Context, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error)
@@ -938,12 +1434,129 @@ func (p *peerGroup) get(ctx context.Context, addr string) (storepb.WriteableStor
 	return client, nil
 }
 
+// remoteWrite forwards the time series to the peer using Remote Write 2.0, falling back to
+// Remote Write 1.0 for peers not supporting it.
+func (p *peerGroup) remoteWrite(ctx context.Context, cl storepb.WriteableStoreClient, addr, tenant string, timeseries []prompb.TimeSeries, rep int64) error {
+	p.m.RLock()
+	_, v1Only := p.v1Only[addr]
+	p.m.RUnlock()
+
+	if !v1Only {
+		req := &storepb.WriteRequestV2{
+			Request: toWriteV2(timeseries),
+			Tenant:  tenant,
+			Replica: rep,
+		}
+		err := p.compressed(addr, func(opts ...grpc.CallOption) error {
+			_, err := cl.RemoteWriteV2(ctx, req, opts...)
+			return err
+		})
+		if status.Code(err) != codes.Unimplemented {
+			return err
+		}
+		p.m.Lock()
+		p.v1Only[addr] = struct{}{}
+		p.m.Unlock()
+	}
+
+	req := &storepb.WriteRequest{
+		Timeseries: timeseries,
+		Tenant:     tenant,
+		Replica:    rep,
+	}
+	return p.compressed(addr, func(opts ...grpc.CallOption) error {
+		_, err := cl.RemoteWrite(ctx, req, opts...)
+		return err
+	})
+}
+
+// determineTenant returns the tenant of the write request from the first of the configured sources providing one.
+// If none does, the default tenant is returned, unless missing tenants are rejected. The tenant extraction label is
+// removed from the series of the request afterwards, if configured.
+func (h *Handler) determineTenant(r *http.Request, wreq *prompb.WriteRequest) (string, error) {
+	sources, rejectMissing := h.options.TenantSources, h.options.RejectMissingTenant
+	if len(sources) == 0 {
+		sources = []string{TenantSourceHeader}
+		if h.options.TenantField != "" {
+			// The certificate alone determines the tenant, to ensure hard tenancy.
+			sources, rejectMissing = []string{TenantSourceCertificate}, true
+		}
+	}
+
+	var (
+		tenant  string
+		certErr error
+	)
+	for _, source := range sources {
+		switch source {
+		case TenantSourceHeader:
+			tenant = r.Header.Get(h.options.TenantHeader)
+		case TenantSourceCertificate:
+			tenant, certErr = h.getTenantFromCertificate(r)
+		case TenantSourceLabel:
+			var err error
+			if tenant, err = tenantFromLabel(wreq, h.options.TenantExtractionLabel); err != nil {
+				return "", err
+			}
+		}
+		if tenant != "" {
+			break
+		}
+	}
+	if h.options.RemoveTenantExtractionLabel && h.options.TenantExtractionLabel != "" {
+		removeLabel(wreq, h.options.TenantExtractionLabel)
+	}
+
+	if tenant != "" {
+		return tenant, nil
+	}
+	if !rejectMissing {
+		return h.options.DefaultTenantID, nil
+	}
+	if certErr != nil {
+		return "", certErr
+	}
+	return "", errors.New("could not determine tenant of write request")
+}
+
+// tenantFromLabel returns the value of the given label of the series of the write request, or an empty string if
+// none of the series has it. All series having the label must have the same value.
+func tenantFromLabel(wreq *prompb.WriteRequest, name string) (string, error) {
+	var tenant string
+	for _, ts := range wreq.Timeseries {
+		for _, l := range ts.Labels {
+			if l.Name != name {
+				continue
+			}
+			if tenant != "" && l.Value != tenant {
+				return "", errors.Errorf("series of write request have conflicting tenants %q and %q in label %s", tenant, l.Value, name)
+			}
+			tenant = l.Value
+			break
+		}
+	}
+	return tenant, nil
+}
+
+// removeLabel removes the given label from the series of the write request.
+func removeLabel(wreq *prompb.WriteRequest, name string) {
+	for i := range wreq.Timeseries {
+		lset := wreq.Timeseries[i].Labels
+		for j, l := range lset {
+			if l.Name == name {
+				wreq.Timeseries[i].Labels = append(lset[:j], lset[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
 // getTenantFromCertificate extracts the tenant value from a client's presented certificate. The x509 field to use as
 // value can be configured with Options.TenantField. An error is returned when the extraction has not succeeded.
 func (h *Handler) getTenantFromCertificate(r *http.Request) (string, error) {
 	var tenant string
 
-	if len(r.TLS.PeerCertificates) == 0 {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
 		return "", errors.New("could not get required certificate field from client cert")
 	}
 
@@ -6,6 +6,10 @@ package receive
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -16,6 +20,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -24,18 +29,24 @@ import (
 	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/index"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	statusapi "github.com/thanos-io/thanos/pkg/api/status"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
@@ -176,6 +187,27 @@ func TestDetermineWriteErrorCause(t *testing.T) {
 			threshold: 2,
 			exp:       errConflict,
 		},
+		{
+			name: "matching multierror disk full",
+			err: errutil.NonNilMultiError([]error{
+				errors.Wrap(errDiskFull, "store locally"),
+				status.Error(codes.ResourceExhausted, errDiskFull.Error()),
+				status.Error(codes.ResourceExhausted, "grpc: received message larger than max"),
+				errors.New("foo"),
+			}),
+			threshold: 2,
+			exp:       errDiskFull,
+		},
+		{
+			name: "matching multierror too many tenants",
+			err: errutil.NonNilMultiError([]error{
+				errors.Wrap(errors.Wrap(errTooManyTenants, "limit 10"), "store locally"),
+				status.Error(codes.ResourceExhausted, errors.Wrap(errTooManyTenants, "limit 10").Error()),
+				status.Error(codes.ResourceExhausted, errDiskFull.Error()),
+			}),
+			threshold: 2,
+			exp:       errTooManyTenants,
+		},
 		{
 			name: "nested matching multierror",
 			err: errors.Wrap(errors.Wrap(errutil.NonNilMultiError([]error{
@@ -324,6 +356,7 @@ func newTestHandlerHashring(appendables []*fakeAppendable, replicationFactor uin
 		dialOpts: nil,
 		m:        sync.RWMutex{},
 		cache:    map[string]storepb.WriteableStoreClient{},
+		v1Only:   map[string]struct{}{},
 		dialer: func(context.Context, string, ...grpc.DialOption) (*grpc.ClientConn, error) {
 			// dialer should never be called since we are creating fake clients with fake addresses
 			// this protects against some leaking test that may attempt to dial random IP addresses
@@ -344,7 +377,7 @@ func newTestHandlerHashring(appendables []*fakeAppendable, replicationFactor uin
 		h.peers = peers
 		addr := randomAddr()
 		h.options.Endpoint = addr
-		cfg[0].Endpoints = append(cfg[0].Endpoints, h.options.Endpoint)
+		cfg[0].Endpoints = append(cfg[0].Endpoints, Endpoint{Address: h.options.Endpoint})
 		peers.cache[addr] = &fakeRemoteWriteGRPCServer{h: h}
 	}
 	hashring := newMultiHashring(AlgorithmHashmod, cfg)
@@ -690,6 +723,84 @@ func TestReceiveQuorum(t *testing.T) {
 	}
 }
 
+func TestReceiveRouterIngestorTopology(t *testing.T) {
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+				Samples: []prompb.Sample{
+					{Value: 1, Timestamp: 1},
+					{Value: 2, Timestamp: 2},
+				},
+			},
+		},
+	}
+	peers := &peerGroup{
+		m:      sync.RWMutex{},
+		cache:  map[string]storepb.WriteableStoreClient{},
+		v1Only: map[string]struct{}{},
+		dialer: func(context.Context, string, ...grpc.DialOption) (*grpc.ClientConn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	cfg := []HashringConfig{{Hashring: "test"}}
+	var appenders []*fakeAppender
+	for i := 0; i < 3; i++ {
+		app := newFakeAppender(nil, nil, nil)
+		appenders = append(appenders, app)
+		ingestor := NewHandler(nil, &Options{
+			TenantHeader:         DefaultTenantHeader,
+			ReplicaHeader:        DefaultReplicaHeader,
+			ReplicationFactor:    1,
+			ForwardTimeout:       5 * time.Second,
+			ReceiverMode:         IngestorOnly,
+			ReplicatedWritesOnly: true,
+			Writer:               NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		})
+		ingestor.Hashring(SingleNodeHashring(""))
+
+		// Unreplicated requests must not be accepted by ingestors.
+		rec, err := makeRequest(ingestor, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusBadRequest, rec.Code)
+		_, err = ingestor.RemoteWrite(context.Background(), &storepb.WriteRequest{Timeseries: wreq.Timeseries, Tenant: "test"})
+		testutil.Equals(t, codes.InvalidArgument, status.Code(err))
+
+		addr := randomAddr()
+		cfg[0].Endpoints = append(cfg[0].Endpoints, Endpoint{Address: addr})
+		// The last ingestor is down.
+		if i < 2 {
+			peers.cache[addr] = &fakeRemoteWriteGRPCServer{h: ingestor}
+		}
+	}
+	hashring := newMultiHashring(AlgorithmHashmod, cfg)
+
+	for i := 0; i < 2; i++ {
+		router := NewHandler(nil, &Options{
+			TenantHeader:      DefaultTenantHeader,
+			ReplicaHeader:     DefaultReplicaHeader,
+			ReplicationFactor: 3,
+			ForwardTimeout:    5 * time.Second,
+			ReceiverMode:      RouterOnly,
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appenderErr: func() error { return errors.New("router must not ingest") }})),
+		})
+		router.peers = peers
+		router.Hashring(hashring)
+
+		rec, err := makeRequest(router, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	lset := labels.FromStrings("foo", "bar")
+	// With one ingestor down, the quorum can only be reached if both remaining ingestors got the samples from both routers.
+	for _, app := range appenders[:2] {
+		testutil.Equals(t, 4, len(app.Get(lset)))
+	}
+	testutil.Equals(t, 0, len(appenders[2].Get(lset)))
+}
+
 func TestReceiveWithConsistencyDelay(t *testing.T) {
 	appenderErrFn := func() error { return errors.New("failed to get appender") }
 	conflictErrFn := func() error { return storage.ErrOutOfBounds }
@@ -1088,12 +1199,31 @@ func randomAddr() string {
 
 type fakeRemoteWriteGRPCServer struct {
 	h storepb.WriteableStoreServer
+
+	// v1Only simulates a peer not implementing Remote Write 2.0.
+	v1Only   bool
+	v1Calls  int
+	v2Calls  int
+	callsMtx sync.Mutex
 }
 
 func (f *fakeRemoteWriteGRPCServer) RemoteWrite(ctx context.Context, in *storepb.WriteRequest, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	f.callsMtx.Lock()
+	f.v1Calls++
+	f.callsMtx.Unlock()
 	return f.h.RemoteWrite(ctx, in)
 }
 
+func (f *fakeRemoteWriteGRPCServer) RemoteWriteV2(ctx context.Context, in *storepb.WriteRequestV2, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	f.callsMtx.Lock()
+	f.v2Calls++
+	f.callsMtx.Unlock()
+	if f.v1Only {
+		return nil, status.Error(codes.Unimplemented, "unknown method RemoteWriteV2")
+	}
+	return f.h.RemoteWriteV2(ctx, in)
+}
+
 func BenchmarkHandlerReceiveHTTP(b *testing.B) {
 	benchmarkHandlerMultiTSDBReceiveRemoteWrite(testutil.NewTB(b))
 }
@@ -1689,8 +1819,458 @@ func TestRelabel(t *testing.T) {
 				RelabelConfigs: tcase.relabel,
 			})
 
-			h.relabel(&tcase.writeRequest)
+			h.relabel("", &tcase.writeRequest)
 			testutil.Equals(t, tcase.expectedWriteRequest, tcase.writeRequest)
 		})
 	}
 }
+
+func TestTenantRelabel(t *testing.T) {
+	const tenant = "foo"
+
+	var appendables []*fakeAppendable
+	for i := 0; i < 3; i++ {
+		appendables = append(appendables, &fakeAppendable{appender: newFakeAppender(nil, nil, nil)})
+	}
+	handlers, hashring := newTestHandlerHashring(appendables, 1)
+	endpointAppender := func(ts *prompb.TimeSeries) *fakeAppender {
+		endpoint, err := hashring.GetN(tenant, ts, 0)
+		testutil.Ok(t, err)
+		for i, h := range handlers {
+			if h.options.Endpoint == endpoint {
+				return appendables[i].appender.(*fakeAppender)
+			}
+		}
+		t.Fatalf("no handler for endpoint %s", endpoint)
+		return nil
+	}
+
+	stripped := prompb.TimeSeries{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "http_requests_total"}}}
+	// Find a request ID making the series route to another endpoint than the series without it.
+	var withRequestID prompb.TimeSeries
+	for i := 0; ; i++ {
+		withRequestID = prompb.TimeSeries{Labels: append(labelpb.ZLabelsFromPromLabels(labelpb.ZLabelsToPromLabels(stripped.Labels)), labelpb.ZLabel{Name: "request_id", Value: fmt.Sprint(i)})}
+		if endpointAppender(&withRequestID) != endpointAppender(&stripped) {
+			break
+		}
+	}
+	withRequestID.Samples = []prompb.Sample{{Value: 1, Timestamp: 1}}
+	dropped := prompb.TimeSeries{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "debug_info"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{withRequestID, dropped}}
+
+	configs, err := ParseTenantsRelabelConfig([]byte(`
+tenants:
+  foo:
+    write_relabel_configs:
+    - action: labeldrop
+      regex: request_id
+    - action: drop
+      source_labels: [__name__]
+      regex: debug_info
+`))
+	testutil.Ok(t, err)
+	h := handlers[0]
+	h.TenantRelabelConfigs(configs)
+
+	rec, err := makeRequest(h, tenant, wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// The series is routed by its relabeled labels.
+	strippedLset := labelpb.ZLabelsToPromLabels(stripped.Labels)
+	testutil.Equals(t, 1, len(endpointAppender(&stripped).Get(strippedLset)))
+	for _, a := range appendables {
+		testutil.Equals(t, 0, len(a.appender.(*fakeAppender).Get(labelpb.ZLabelsToPromLabels(withRequestID.Labels))))
+		testutil.Equals(t, 0, len(a.appender.(*fakeAppender).Get(labelpb.ZLabelsToPromLabels(dropped.Labels))))
+	}
+	testutil.Equals(t, 1.0, promtest.ToFloat64(h.relabelDroppedSeries.WithLabelValues(tenant)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(h.relabelModifiedSeries.WithLabelValues(tenant)))
+
+	// Other tenants are not relabeled.
+	rec, err = makeRequest(h, "bar", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{dropped}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, 0.0, promtest.ToFloat64(h.relabelDroppedSeries.WithLabelValues("bar")))
+
+	// Once the configs are reloaded without the tenant, its series are routed by their original labels again.
+	h.TenantRelabelConfigs(nil)
+	wreq.Timeseries[0].Samples = []prompb.Sample{{Value: 2, Timestamp: 2}}
+	rec, err = makeRequest(h, tenant, &prompb.WriteRequest{Timeseries: wreq.Timeseries[:1]})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, 1, len(endpointAppender(&stripped).Get(strippedLset)))
+	testutil.Equals(t, 1, len(endpointAppender(&withRequestID).Get(labelpb.ZLabelsToPromLabels(withRequestID.Labels))))
+}
+
+func TestDetermineTenant(t *testing.T) {
+	const label = "tenant"
+	newRequest := func(header string, cert *x509.Certificate) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/receive", nil)
+		if header != "" {
+			r.Header.Set(DefaultTenantHeader, header)
+		}
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		return r
+	}
+	newWriteRequest := func(tenants ...string) *prompb.WriteRequest {
+		wreq := &prompb.WriteRequest{}
+		for i, tenant := range tenants {
+			lset := []labelpb.ZLabel{{Name: "a", Value: fmt.Sprint(i)}}
+			if tenant != "" {
+				lset = append(lset, labelpb.ZLabel{Name: label, Value: tenant})
+			}
+			wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{Labels: lset})
+		}
+		return wreq
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "cert-tenant"}}
+
+	for _, tcase := range []struct {
+		name          string
+		sources       []string
+		removeLabel   bool
+		rejectMissing bool
+		req           *http.Request
+		wreq          *prompb.WriteRequest
+
+		expectedTenant   string
+		expectedErr      string
+		expectedWriteReq *prompb.WriteRequest
+	}{
+		{
+			name: "header by default", req: newRequest("header-tenant", cert), wreq: newWriteRequest("label-tenant"),
+			expectedTenant: "header-tenant",
+		},
+		{
+			name: "default tenant without header", req: newRequest("", cert), wreq: newWriteRequest("label-tenant"),
+			expectedTenant: DefaultTenant,
+		},
+		{
+			name: "first source providing a tenant", sources: []string{TenantSourceHeader, TenantSourceCertificate}, req: newRequest("", cert), wreq: newWriteRequest(),
+			expectedTenant: "cert-tenant",
+		},
+		{
+			name: "precedence of sources", sources: []string{TenantSourceLabel, TenantSourceHeader}, req: newRequest("header-tenant", cert), wreq: newWriteRequest("", "label-tenant"),
+			expectedTenant: "label-tenant",
+		},
+		{
+			name: "label removed", sources: []string{TenantSourceHeader, TenantSourceLabel}, removeLabel: true, req: newRequest("header-tenant", nil), wreq: newWriteRequest("label-tenant", ""),
+			expectedTenant: "header-tenant", expectedWriteReq: newWriteRequest("", ""),
+		},
+		{
+			name: "conflicting labels", sources: []string{TenantSourceLabel}, req: newRequest("", nil), wreq: newWriteRequest("foo", "bar"),
+			expectedErr: "series of write request have conflicting tenants \"foo\" and \"bar\" in label tenant",
+		},
+		{
+			name: "missing tenant", sources: []string{TenantSourceCertificate, TenantSourceLabel}, req: newRequest("header-tenant", nil), wreq: newWriteRequest(),
+			expectedTenant: DefaultTenant,
+		},
+		{
+			name: "missing tenant rejected", sources: []string{TenantSourceHeader, TenantSourceLabel}, rejectMissing: true, req: newRequest("", cert), wreq: newWriteRequest(""),
+			expectedErr: "could not determine tenant of write request",
+		},
+		{
+			name: "missing certificate rejected", sources: []string{TenantSourceCertificate}, rejectMissing: true, req: newRequest("header-tenant", nil), wreq: newWriteRequest(),
+			expectedErr: "could not get required certificate field from client cert",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			h := NewHandler(nil, &Options{
+				TenantHeader:                DefaultTenantHeader,
+				TenantField:                 CertificateFieldCommonName,
+				DefaultTenantID:             DefaultTenant,
+				TenantSources:               tcase.sources,
+				TenantExtractionLabel:       label,
+				RemoveTenantExtractionLabel: tcase.removeLabel,
+				RejectMissingTenant:         tcase.rejectMissing,
+			})
+			if len(tcase.sources) == 0 {
+				h.options.TenantField = ""
+			}
+
+			tenant, err := h.determineTenant(tcase.req, tcase.wreq)
+			if tcase.expectedErr != "" {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, tcase.expectedErr, err.Error())
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedTenant, tenant)
+			if tcase.expectedWriteReq != nil {
+				testutil.Equals(t, tcase.expectedWriteReq, tcase.wreq)
+			}
+		})
+	}
+
+	t.Run("certificate field only", func(t *testing.T) {
+		h := NewHandler(nil, &Options{TenantHeader: DefaultTenantHeader, TenantField: CertificateFieldOrganization, DefaultTenantID: DefaultTenant})
+
+		// The header is ignored and the request rejected, to ensure hard tenancy.
+		_, err := h.determineTenant(newRequest("header-tenant", cert), newWriteRequest())
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "could not get organization field from client cert", err.Error())
+
+		tenant, err := h.determineTenant(newRequest("header-tenant", &x509.Certificate{Subject: pkix.Name{Organization: []string{"org-tenant"}}}), newWriteRequest())
+		testutil.Ok(t, err)
+		testutil.Equals(t, "org-tenant", tenant)
+	})
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	testutil.Ok(t, o.(prometheus.Metric).Write(m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestWriteDurationMetrics(t *testing.T) {
+	const tenant = "foo"
+	slowAppenderFn := func() error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+
+	t.Run("all replicas succeed", func(t *testing.T) {
+		var appendables []*fakeAppendable
+		for i := 0; i < 3; i++ {
+			appendables = append(appendables, &fakeAppendable{appender: newFakeAppender(nil, nil, nil)})
+		}
+		handlers, _ := newTestHandlerHashring(appendables, 3)
+		h := handlers[0]
+
+		rec, err := makeRequest(h, tenant, wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		testutil.Equals(t, uint64(1), histogramCount(t, h.quorumWaitDuration.WithLabelValues(tenant, labelSuccess)))
+		testutil.Equals(t, uint64(0), histogramCount(t, h.quorumWaitDuration.WithLabelValues(tenant, labelDegraded)))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(h.degradedReplications.WithLabelValues(tenant)))
+		testutil.Equals(t, uint64(1), histogramCount(t, h.localAppendDuration.WithLabelValues(tenant)))
+	})
+	t.Run("quorum reached despite failed replica", func(t *testing.T) {
+		appendables := []*fakeAppendable{
+			{appender: newFakeAppender(nil, nil, nil), appenderErr: slowAppenderFn},
+			{appender: newFakeAppender(nil, nil, nil), appenderErr: slowAppenderFn},
+			{appender: newFakeAppender(nil, nil, nil), appenderErr: func() error { return errors.New("failed to get appender") }},
+		}
+		handlers, _ := newTestHandlerHashring(appendables, 3)
+		h := handlers[0]
+
+		rec, err := makeRequest(h, tenant, wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		testutil.Equals(t, uint64(0), histogramCount(t, h.quorumWaitDuration.WithLabelValues(tenant, labelSuccess)))
+		testutil.Equals(t, uint64(1), histogramCount(t, h.quorumWaitDuration.WithLabelValues(tenant, labelDegraded)))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(h.degradedReplications.WithLabelValues(tenant)))
+		testutil.Equals(t, uint64(1), histogramCount(t, h.localAppendDuration.WithLabelValues(tenant)))
+
+		// The failed replica was forwarded to and is observed with its endpoint.
+		failed := handlers[2].options.Endpoint
+		testutil.Equals(t, uint64(1), histogramCount(t, h.forwardDuration.WithLabelValues(tenant, failed, labelError)))
+		testutil.Equals(t, uint64(1), histogramCount(t, handlers[1].localAppendDuration.WithLabelValues(tenant)))
+	})
+	t.Run("quorum not reached", func(t *testing.T) {
+		var appendables []*fakeAppendable
+		for i := 0; i < 3; i++ {
+			appendables = append(appendables, &fakeAppendable{appender: newFakeAppender(nil, nil, nil), appenderErr: func() error { return errors.New("failed to get appender") }})
+		}
+		handlers, _ := newTestHandlerHashring(appendables, 3)
+		h := handlers[0]
+
+		rec, err := makeRequest(h, tenant, wreq)
+		testutil.Ok(t, err)
+		testutil.Assert(t, rec.Code != http.StatusOK, "expected failed write")
+		testutil.Equals(t, uint64(1), histogramCount(t, h.quorumWaitDuration.WithLabelValues(tenant, labelError)))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(h.degradedReplications.WithLabelValues(tenant)))
+	})
+}
+
+func TestReceiveDiskWatermark(t *testing.T) {
+	const tenant = "foo"
+	var wreq prompb.WriteRequest
+	for i := 0; i < 20; i++ {
+		wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+			Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "i", Value: fmt.Sprint(i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		})
+	}
+
+	guard := NewDiskGuard(log.NewNopLogger(), nil, "", 0.9, 0.8)
+	usage := 0.95
+	guard.usage = func(string) (float64, error) { return usage, nil }
+	testutil.Ok(t, guard.Update())
+
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _ := newTestHandlerHashring(appendables, 1)
+	for _, h := range handlers {
+		h.options.DiskGuard = guard
+	}
+
+	// Both local writes and writes forwarded to a receiver above the high watermark are rejected.
+	rec, err := makeRequest(handlers[0], tenant, &wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusServiceUnavailable, rec.Code)
+	testutil.Assert(t, strings.Contains(rec.Body.String(), errDiskFull.Error()), "unexpected response body %q", rec.Body.String())
+	testutil.Equals(t, 1.0, promtest.ToFloat64(handlers[0].diskFullRejections.WithLabelValues(tenant)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(handlers[1].diskFullRejections.WithLabelValues(tenant)))
+
+	_, err = handlers[1].RemoteWrite(context.Background(), &storepb.WriteRequest{Timeseries: wreq.Timeseries[:1], Tenant: tenant, Replica: 1})
+	testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+	testutil.Assert(t, isDiskFull(err), "expected disk full error, got %v", err)
+
+	// Writes are accepted again only below the low watermark.
+	usage = 0.85
+	testutil.Ok(t, guard.Update())
+	testutil.Assert(t, guard.AboveHighWatermark(), "expected disk above high watermark")
+	usage = 0.5
+	testutil.Ok(t, guard.Update())
+	rec, err = makeRequest(handlers[0], tenant, &wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestMetricsTenant(t *testing.T) {
+	h := NewHandler(nil, &Options{})
+	testutil.Equals(t, "foo", h.metricsTenant("foo"))
+
+	h = NewHandler(nil, &Options{MetricsTenants: []string{"foo"}})
+	testutil.Equals(t, "foo", h.metricsTenant("foo"))
+	testutil.Equals(t, OtherTenantsLabel, h.metricsTenant("bar"))
+}
+
+type fakeTSDBStats map[string]*tsdb.Stats
+
+func (f fakeTSDBStats) TenantStats(_ string, tenantIDs ...string) []statusapi.TenantStats {
+	if len(tenantIDs) == 0 {
+		for id := range f {
+			tenantIDs = append(tenantIDs, id)
+		}
+		sort.Strings(tenantIDs)
+	}
+	var res []statusapi.TenantStats
+	for _, id := range tenantIDs {
+		if s, ok := f[id]; ok {
+			res = append(res, statusapi.TenantStats{Tenant: id, Stats: s})
+		}
+	}
+	return res
+}
+
+func TestReceiveTSDBStatus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	chunks := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "prometheus_tsdb_head_chunks"}, []string{"tenant"})
+	reg.MustRegister(chunks)
+	chunks.WithLabelValues("foo").Set(10)
+	chunks.WithLabelValues("bar").Set(5)
+
+	h := NewHandler(nil, &Options{
+		TenantHeader:    DefaultTenantHeader,
+		DefaultTenantID: DefaultTenant,
+		Registry:        reg,
+		Tracer:          opentracing.NoopTracer{},
+		Writer:          NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{})),
+		TSDBStats: fakeTSDBStats{
+			"foo": {NumSeries: 3, MinTime: 1000, MaxTime: 5000, IndexPostingStats: &index.PostingsStats{
+				CardinalityMetricsStats: []index.Stat{{Name: "up", Count: 2}, {Name: "go_goroutines", Count: 1}},
+				CardinalityLabelStats:   []index.Stat{{Name: "job", Count: 2}},
+				NumLabelPairs:           4,
+			}},
+			"bar": {NumSeries: 2, MinTime: 2000, MaxTime: 6000, IndexPostingStats: &index.PostingsStats{
+				CardinalityMetricsStats: []index.Stat{{Name: "go_goroutines", Count: 2}},
+				CardinalityLabelStats:   []index.Stat{{Name: "job", Count: 1}, {Name: "instance", Count: 1}},
+				NumLabelPairs:           3,
+			}},
+		},
+	})
+	h.Hashring(SingleNodeHashring(""))
+
+	for _, tcase := range []struct {
+		name    string
+		params  string
+		tenant  string
+		expCode int
+		// exp are the expected tenants, or the expected aggregated stats if aggregated is set.
+		exp        []statusapi.TSDBStatus
+		aggregated bool
+	}{
+		{
+			name:   "tenant header",
+			tenant: "foo",
+			exp:    []statusapi.TSDBStatus{{Tenant: "foo"}},
+		},
+		{
+			name:   "tenant parameter",
+			params: "?tenant=bar",
+			exp:    []statusapi.TSDBStatus{{Tenant: "bar"}},
+		},
+		{
+			name:    "different tenants in parameter and header",
+			params:  "?tenant=bar",
+			tenant:  "foo",
+			expCode: http.StatusBadRequest,
+		},
+		{
+			name:   "all tenants",
+			params: "?all_tenants=true",
+			exp:    []statusapi.TSDBStatus{{Tenant: "bar"}, {Tenant: "foo"}},
+		},
+		{
+			name:    "aggregate with tenant",
+			params:  "?aggregate=true&tenant=foo",
+			expCode: http.StatusBadRequest,
+		},
+		{
+			name:       "aggregate",
+			params:     "?aggregate=true",
+			aggregated: true,
+			exp: []statusapi.TSDBStatus{{
+				HeadStats:                  v1.HeadStats{NumSeries: 5, NumLabelPairs: 7, ChunkCount: 15, MinTime: 1000, MaxTime: 6000},
+				SeriesCountByMetricName:    []statusapi.Stat{{Name: "go_goroutines", Value: 3}, {Name: "up", Value: 2}},
+				LabelValueCountByLabelName: []statusapi.Stat{{Name: "job", Value: 3}, {Name: "instance", Value: 1}},
+			}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/status/tsdb"+tcase.params, nil)
+			if tcase.tenant != "" {
+				req.Header.Set(DefaultTenantHeader, tcase.tenant)
+			}
+			rec := httptest.NewRecorder()
+			h.router.ServeHTTP(rec, req)
+			if tcase.expCode != 0 {
+				testutil.Equals(t, tcase.expCode, rec.Code)
+				return
+			}
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			var resp struct {
+				Data []statusapi.TSDBStatus `json:"data"`
+			}
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			if !tcase.aggregated {
+				var tenants []statusapi.TSDBStatus
+				for _, s := range resp.Data {
+					tenants = append(tenants, statusapi.TSDBStatus{Tenant: s.Tenant})
+				}
+				testutil.Equals(t, tcase.exp, tenants)
+				return
+			}
+			testutil.Equals(t, 1, len(resp.Data))
+			testutil.Equals(t, tcase.exp[0].HeadStats, resp.Data[0].HeadStats)
+			testutil.Equals(t, tcase.exp[0].SeriesCountByMetricName, resp.Data[0].SeriesCountByMetricName)
+			testutil.Equals(t, tcase.exp[0].LabelValueCountByLabelName, resp.Data[0].LabelValueCountByLabelName)
+		})
+	}
+}
@@ -6,13 +6,14 @@ package receive
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"sync"
 
 	"github.com/cespare/xxhash"
-
 	"github.com/pkg/errors"
+
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
@@ -31,6 +32,16 @@ const (
 	SectionsPerNode = 1000
 )
 
+// HashSeries returns the hash of the series of the tenant, which the hashrings use to distribute series to the
+// endpoints. It is labelpb.HashWithPrefix of the tenant and of the labels, in the given order: labels are not sorted,
+// they are hashed in the order of the remote write request, which Prometheus sends sorted by name.
+//
+// The hash is stable: changing it would reshuffle the series across the receivers, so it must only change
+// deliberately, along with the test vectors of testdata/series_hashes.json.
+func HashSeries(tenant string, lset []labelpb.ZLabel) uint64 {
+	return labelpb.HashWithPrefix(tenant, lset)
+}
+
 // insufficientNodesError is returned when a hashring does not
 // have enough nodes to satisfy a request for a node.
 type insufficientNodesError struct {
@@ -53,6 +64,12 @@ type Hashring interface {
 	GetN(tenant string, timeSeries *prompb.TimeSeries, n uint64) (string, error)
 }
 
+// ownershipHashring is a hashring able to report how its hash space is split across endpoints.
+type ownershipHashring interface {
+	// ownership returns the share of the hash space owned by each endpoint.
+	ownership() map[string]float64
+}
+
 // SingleNodeHashring always returns the same node.
 type SingleNodeHashring string
 
@@ -72,6 +89,15 @@ func (s SingleNodeHashring) GetN(_ string, _ *prompb.TimeSeries, n uint64) (stri
 // simpleHashring represents a group of nodes handling write requests by hashmoding individual series.
 type simpleHashring []string
 
+// newSimpleHashring creates a hashmod hashring. Endpoint weights are not supported and are ignored.
+func newSimpleHashring(endpoints []Endpoint) simpleHashring {
+	ring := make(simpleHashring, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		ring = append(ring, endpoint.Address)
+	}
+	return ring
+}
+
 // Get returns a target to handle the given tenant and time series.
 func (s simpleHashring) Get(tenant string, ts *prompb.TimeSeries) (string, error) {
 	return s.GetN(tenant, ts, 0)
@@ -83,7 +109,16 @@ func (s simpleHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 		return "", &insufficientNodesError{have: uint64(len(s)), want: n + 1}
 	}
 
-	return s[(labelpb.HashWithPrefix(tenant, ts.Labels)+n)%uint64(len(s))], nil
+	return s[(HashSeries(tenant, ts.Labels)+n)%uint64(len(s))], nil
+}
+
+// ownership returns the share of series owned by each endpoint, which is equal for all of them.
+func (s simpleHashring) ownership() map[string]float64 {
+	res := make(map[string]float64, len(s))
+	for _, endpoint := range s {
+		res[endpoint] += 1 / float64(len(s))
+	}
+	return res
 }
 
 type section struct {
@@ -105,18 +140,27 @@ type ketamaHashring struct {
 	numEndpoints uint64
 }
 
-func newKetamaHashring(endpoints []string, sectionsPerNode int) *ketamaHashring {
-	numSections := len(endpoints) * sectionsPerNode
+// newKetamaHashring creates a ketama hashring where each endpoint is assigned
+// sectionsPerNode sections multiplied by its weight.
+func newKetamaHashring(endpoints []Endpoint, sectionsPerNode int) *ketamaHashring {
+	numSections := 0
+	addrs := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		numSections += endpoint.weight() * sectionsPerNode
+		addrs = append(addrs, endpoint.Address)
+	}
 	ring := ketamaHashring{
-		endpoints:    endpoints,
+		endpoints:    addrs,
 		sections:     make(sections, 0, numSections),
 		numEndpoints: uint64(len(endpoints)),
 	}
 
 	hash := xxhash.New()
 	for endpointIndex, endpoint := range endpoints {
-		for i := 1; i <= sectionsPerNode; i++ {
-			_, _ = hash.Write([]byte(endpoint + ":" + strconv.Itoa(i)))
+		// Sections are numbered from 1, so the default weight yields the same ring as an endpoint without weight
+		// and changing the weight of an endpoint only adds or removes its own sections.
+		for i := 1; i <= endpoint.weight()*sectionsPerNode; i++ {
+			_, _ = hash.Write([]byte(endpoint.Address + ":" + strconv.Itoa(i)))
 			n := &section{
 				endpointIndex: uint64(endpointIndex),
 				hash:          hash.Sum64(),
@@ -139,7 +183,7 @@ func (c ketamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 		return "", &insufficientNodesError{have: c.numEndpoints, want: n + 1}
 	}
 
-	v := labelpb.HashWithPrefix(tenant, ts.Labels)
+	v := HashSeries(tenant, ts.Labels)
 
 	var i uint64
 	i = uint64(sort.Search(len(c.sections), func(i int) bool {
@@ -156,6 +200,27 @@ func (c ketamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 	return c.endpoints[nodeIndex], nil
 }
 
+// ownership returns the share of the hash space owned by each endpoint.
+// A section owns the hashes between the previous section (exclusive) and itself (inclusive).
+func (c ketamaHashring) ownership() map[string]float64 {
+	res := make(map[string]float64, len(c.endpoints))
+	if len(c.sections) == 0 {
+		return res
+	}
+	for i, s := range c.sections {
+		var prev uint64
+		if i > 0 {
+			prev = c.sections[i-1].hash
+		} else {
+			// The first section also owns everything after the last section.
+			prev = c.sections[len(c.sections)-1].hash
+		}
+		// Unsigned subtraction wraps around for the first section as intended.
+		res[c.endpoints[s.endpointIndex]] += float64(s.hash-prev) / math.MaxUint64
+	}
+	return res
+}
+
 // multiHashring represents a set of hashrings.
 // Which hashring to use for a tenant is determined
 // by the tenants field of the hashring configuration.
@@ -213,14 +278,14 @@ func newMultiHashring(algorithm HashringAlgorithm, cfg []HashringConfig) Hashrin
 		cache: make(map[string]Hashring),
 	}
 
-	newHashring := func(endpoints []string) Hashring {
+	newHashring := func(endpoints []Endpoint) Hashring {
 		switch algorithm {
 		case AlgorithmHashmod:
-			return simpleHashring(endpoints)
+			return newSimpleHashring(endpoints)
 		case AlgorithmKetama:
 			return newKetamaHashring(endpoints, SectionsPerNode)
 		default:
-			return simpleHashring(endpoints)
+			return newSimpleHashring(endpoints)
 		}
 	}
 
@@ -255,7 +320,9 @@ func HashringFromConfigWatcher(ctx context.Context, algorithm HashringAlgorithm,
 			if !ok {
 				return errors.New("hashring config watcher stopped unexpectedly")
 			}
-			updates <- newMultiHashring(algorithm, cfg)
+			h := newMultiHashring(algorithm, cfg)
+			cw.setOwnership(cfg, h)
+			updates <- h
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -4,7 +4,10 @@
 package receive
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -44,7 +47,7 @@ func TestHashringGet(t *testing.T) {
 			name: "simple",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1"},
+					Endpoints: []Endpoint{{Address: "node1"}},
 				},
 			},
 			nodes: map[string]struct{}{"node1": {}},
@@ -53,11 +56,11 @@ func TestHashringGet(t *testing.T) {
 			name: "specific",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node2"},
+					Endpoints: []Endpoint{{Address: "node2"}},
 					Tenants:   []string{"tenant2"},
 				},
 				{
-					Endpoints: []string{"node1"},
+					Endpoints: []Endpoint{{Address: "node1"}},
 				},
 			},
 			nodes:  map[string]struct{}{"node2": {}},
@@ -67,15 +70,15 @@ func TestHashringGet(t *testing.T) {
 			name: "many tenants",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1"},
+					Endpoints: []Endpoint{{Address: "node1"}},
 					Tenants:   []string{"tenant1"},
 				},
 				{
-					Endpoints: []string{"node2"},
+					Endpoints: []Endpoint{{Address: "node2"}},
 					Tenants:   []string{"tenant2"},
 				},
 				{
-					Endpoints: []string{"node3"},
+					Endpoints: []Endpoint{{Address: "node3"}},
 					Tenants:   []string{"tenant3"},
 				},
 			},
@@ -86,15 +89,15 @@ func TestHashringGet(t *testing.T) {
 			name: "many tenants error",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1"},
+					Endpoints: []Endpoint{{Address: "node1"}},
 					Tenants:   []string{"tenant1"},
 				},
 				{
-					Endpoints: []string{"node2"},
+					Endpoints: []Endpoint{{Address: "node2"}},
 					Tenants:   []string{"tenant2"},
 				},
 				{
-					Endpoints: []string{"node3"},
+					Endpoints: []Endpoint{{Address: "node3"}},
 					Tenants:   []string{"tenant3"},
 				},
 			},
@@ -104,11 +107,11 @@ func TestHashringGet(t *testing.T) {
 			name: "many nodes",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1", "node2", "node3"},
+					Endpoints: []Endpoint{{Address: "node1"}, {Address: "node2"}, {Address: "node3"}},
 					Tenants:   []string{"tenant1"},
 				},
 				{
-					Endpoints: []string{"node4", "node5", "node6"},
+					Endpoints: []Endpoint{{Address: "node4"}, {Address: "node5"}, {Address: "node6"}},
 				},
 			},
 			nodes: map[string]struct{}{
@@ -122,11 +125,11 @@ func TestHashringGet(t *testing.T) {
 			name: "many nodes default",
 			cfg: []HashringConfig{
 				{
-					Endpoints: []string{"node1", "node2", "node3"},
+					Endpoints: []Endpoint{{Address: "node1"}, {Address: "node2"}, {Address: "node3"}},
 					Tenants:   []string{"tenant1"},
 				},
 				{
-					Endpoints: []string{"node4", "node5", "node6"},
+					Endpoints: []Endpoint{{Address: "node4"}, {Address: "node5"}, {Address: "node6"}},
 				},
 			},
 			nodes: map[string]struct{}{
@@ -226,7 +229,7 @@ func TestKetamaHashringGet(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			hashRing := newKetamaHashring(test.nodes, 10)
+			hashRing := newKetamaHashring(EndpointsFromAddresses(test.nodes...), 10)
 			result, err := hashRing.GetN("tenant", test.ts, test.n)
 			require.NoError(t, err)
 			require.Equal(t, test.expectedNode, result)
@@ -314,6 +317,38 @@ func TestKetamaHashringReplicationConsistency(t *testing.T) {
 	}
 }
 
+func TestKetamaHashringWeights(t *testing.T) {
+	unweighted := newKetamaHashring(EndpointsFromAddresses("node-1", "node-2", "node-3"), SectionsPerNode)
+	defaultWeights := newKetamaHashring([]Endpoint{
+		{Address: "node-1", Weight: 1},
+		{Address: "node-2", Weight: 1},
+		{Address: "node-3", Weight: 1},
+	}, SectionsPerNode)
+	require.Equal(t, unweighted.sections, defaultWeights.sections, "default weight must not change the ring")
+
+	weighted := newKetamaHashring([]Endpoint{
+		{Address: "node-1"},
+		{Address: "node-2", Weight: 2},
+		{Address: "node-3"},
+	}, SectionsPerNode)
+	require.Len(t, weighted.sections, 4*SectionsPerNode)
+
+	ownership := weighted.ownership()
+	require.InDelta(t, 1, ownership["node-1"]+ownership["node-2"]+ownership["node-3"], 0.0001)
+	require.InDelta(t, 0.25, ownership["node-1"], 0.03)
+	require.InDelta(t, 0.5, ownership["node-2"], 0.03)
+	require.InDelta(t, 0.25, ownership["node-3"], 0.03)
+
+	assignments := make(map[string]int)
+	series := makeSeries()
+	for _, ts := range series {
+		node, err := weighted.Get("tenant", ts)
+		require.NoError(t, err)
+		assignments[node]++
+	}
+	require.InDelta(t, 0.5, float64(assignments["node-2"])/float64(len(series)), 0.05)
+}
+
 func makeSeries() []*prompb.TimeSeries {
 	numSeries := 10000
 	series := make([]*prompb.TimeSeries, numSeries)
@@ -347,7 +382,7 @@ func assignSeries(series []*prompb.TimeSeries, nodes []string) (map[string][]*pr
 }
 
 func assignReplicatedSeries(series []*prompb.TimeSeries, nodes []string, replicas uint64) (map[string][]*prompb.TimeSeries, error) {
-	hashRing := newKetamaHashring(nodes, SectionsPerNode)
+	hashRing := newKetamaHashring(EndpointsFromAddresses(nodes...), SectionsPerNode)
 	assignments := make(map[string][]*prompb.TimeSeries)
 	for i := uint64(0); i < replicas; i++ {
 		for _, ts := range series {
@@ -362,3 +397,62 @@ func assignReplicatedSeries(series []*prompb.TimeSeries, nodes []string, replica
 
 	return assignments, nil
 }
+
+// seriesHashVectors are the test vectors of the series hashing and of the hashrings, which external tools predicting
+// the receiver owning a series can check themselves against.
+type seriesHashVectors struct {
+	// Hashrings is the hashring configuration the owners of the vectors are computed with.
+	Hashrings []HashringConfig `json:"hashrings"`
+	// ReplicationFactor is the number of owners of each vector.
+	ReplicationFactor uint64             `json:"replication_factor"`
+	Vectors           []seriesHashVector `json:"vectors"`
+}
+
+type seriesHashVector struct {
+	Tenant string `json:"tenant"`
+	// Labels are name and value pairs, in the order they are hashed in.
+	Labels [][2]string `json:"labels"`
+	// Hash is the hexadecimal hash of the series.
+	Hash string `json:"hash"`
+	// Hashmod and Ketama are the endpoints owning the series with each algorithm, in replication order.
+	Hashmod []string `json:"hashmod"`
+	Ketama  []string `json:"ketama"`
+}
+
+func (v seriesHashVector) labels() labels.Labels {
+	lset := make(labels.Labels, 0, len(v.Labels))
+	for _, l := range v.Labels {
+		lset = append(lset, labels.Label{Name: l[0], Value: l[1]})
+	}
+	return lset
+}
+
+func owners(t *testing.T, h Hashring, tenant string, lset labels.Labels, replicationFactor uint64) []string {
+	ts := &prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+	var res []string
+	for n := uint64(0); n < replicationFactor; n++ {
+		endpoint, err := h.GetN(tenant, ts, n)
+		require.NoError(t, err)
+		res = append(res, endpoint)
+	}
+	return res
+}
+
+// TestHashSeriesVectors checks the series hashing and the hashrings against the vectors of
+// testdata/series_hashes.json. Series must only be distributed differently deliberately, by updating the vectors.
+func TestHashSeriesVectors(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "series_hashes.json"))
+	require.NoError(t, err)
+	var vectors seriesHashVectors
+	require.NoError(t, json.Unmarshal(b, &vectors))
+	require.NotEmpty(t, vectors.Vectors)
+
+	hashmod := newMultiHashring(AlgorithmHashmod, vectors.Hashrings)
+	ketama := newMultiHashring(AlgorithmKetama, vectors.Hashrings)
+	for _, v := range vectors.Vectors {
+		lset := v.labels()
+		require.Equal(t, v.Hash, fmt.Sprintf("%016x", HashSeries(v.Tenant, labelpb.ZLabelsFromPromLabels(lset))), "tenant %q, labels %v", v.Tenant, lset)
+		require.Equal(t, v.Hashmod, owners(t, hashmod, v.Tenant, lset, vectors.ReplicationFactor), "tenant %q, labels %v", v.Tenant, lset)
+		require.Equal(t, v.Ketama, owners(t, ketama, v.Tenant, lset, vectors.ReplicationFactor), "tenant %q, labels %v", v.Tenant, lset)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+// defaultHeadCompactionCheckInterval is the interval at which the heads of tenant TSDBs are checked for compaction,
+// the same as the one of the TSDB itself.
+const defaultHeadCompactionCheckInterval = time.Minute
+
+// WithHeadCompactionScheduling makes the MultiTSDB compact the tenant TSDBs in a background goroutine per tenant
+// instead of letting each TSDB compact on its own, with at most concurrency tenants compacting at once. The compaction
+// of each tenant is delayed by a deterministic offset of up to stagger, in the time of its samples, after its head
+// becomes compactable, so that tenants receiving samples at the same time don't all compact at once.
+func WithHeadCompactionScheduling(concurrency int, stagger time.Duration) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.headCompactionGate = gate.New(nil, concurrency)
+		t.headCompactionStagger = stagger
+	}
+}
+
+// headCompactionMetrics are the metrics of the head compactions scheduled by the MultiTSDB.
+type headCompactionMetrics struct {
+	queueLength prometheus.Gauge
+	duration    *prometheus.HistogramVec
+}
+
+func newHeadCompactionMetrics(reg prometheus.Registerer) *headCompactionMetrics {
+	return &headCompactionMetrics{
+		queueLength: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_head_compaction_queue_length",
+			Help: "Number of tenants whose head is due for compaction, waiting for another tenant compaction to finish.",
+		}),
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_receive_head_compaction_duration_seconds",
+			Help:    "Duration of the compactions of the TSDB of each tenant, once it got its turn.",
+			Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+		}, []string{"tenant"}),
+	}
+}
+
+// headCompactionOffset returns the deterministic offset of up to stagger by which the compaction of the tenant is
+// delayed.
+func headCompactionOffset(tenantID string, stagger time.Duration) time.Duration {
+	if stagger <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(tenantID))
+	return time.Duration(h.Sum64() % uint64(stagger))
+}
+
+// headCompactionDue tells whether the head, with blocks of the given duration in milliseconds, spans enough time to be
+// compacted, delayed by the offset. Without offset, this is when the TSDB would compact it itself.
+func headCompactionDue(head *tsdb.Head, blockDuration int64, offset time.Duration) bool {
+	if head.MinTime() == math.MaxInt64 {
+		// The head is empty.
+		return false
+	}
+	return head.MaxTime()-head.MinTime() > blockDuration/2*3+offset.Milliseconds()
+}
+
+// startHeadCompactions starts compacting the TSDB of the tenant in the background, once its head is due for compaction.
+// Auto compactions of the TSDB must be disabled.
+func (t *MultiTSDB) startHeadCompactions(logger log.Logger, tenantID string, tenant *tenant, db *tsdb.DB) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	tenant.mtx.Lock()
+	tenant.stopCompactions = func() {
+		cancel()
+		<-done
+	}
+	tenant.mtx.Unlock()
+
+	offset := headCompactionOffset(tenantID, t.headCompactionStagger)
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(t.headCompactionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !headCompactionDue(db.Head(), t.tsdbOpts.MinBlockDuration, offset) {
+				continue
+			}
+			t.compact(ctx, logger, tenantID, db)
+		}
+	}()
+}
+
+// compact compacts the TSDB of the tenant once it gets its turn.
+func (t *MultiTSDB) compact(ctx context.Context, logger log.Logger, tenantID string, db *tsdb.DB) {
+	t.headCompactionMetrics.queueLength.Inc()
+	err := t.headCompactionGate.Start(ctx)
+	t.headCompactionMetrics.queueLength.Dec()
+	if err != nil {
+		// The TSDB is closing.
+		return
+	}
+	defer t.headCompactionGate.Done()
+
+	start := time.Now()
+	if err := db.Compact(); err != nil {
+		level.Error(logger).Log("msg", "compaction failed", "err", err)
+	}
+	t.headCompactionMetrics.duration.WithLabelValues(tenantID).Observe(time.Since(start).Seconds())
+}
+
+// stopHeadCompactions stops the background compactions of the TSDB of the tenant, if any, waiting for a running one
+// to finish.
+func (t *tenant) stopHeadCompactions() {
+	t.mtx.Lock()
+	stop := t.stopCompactions
+	t.stopCompactions = nil
+	t.mtx.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestHeadCompactionOffset(t *testing.T) {
+	testutil.Equals(t, time.Duration(0), headCompactionOffset("foo", 0))
+
+	stagger := 30 * time.Minute
+	offsets := map[time.Duration]struct{}{}
+	for i := 0; i < 10; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		offset := headCompactionOffset(tenant, stagger)
+		testutil.Assert(t, offset >= 0 && offset < stagger, "offset %v out of range", offset)
+		testutil.Equals(t, offset, headCompactionOffset(tenant, stagger))
+		offsets[offset] = struct{}{}
+	}
+	testutil.Assert(t, len(offsets) > 1, "expected tenants to be staggered")
+}
+
+func TestMultiTSDBHeadCompactionScheduling(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), reg,
+		&tsdb.Options{
+			MinBlockDuration: (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration: (2 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithHeadCompactionScheduling(1, 0),
+	)
+	m.headCompactionCheckInterval = 10 * time.Millisecond
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tenants := []string{"foo", "bar", "baz"}
+	start := time.Now().Add(-6 * time.Hour).Truncate(2 * time.Hour)
+	for _, tenant := range tenants {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		var a storage.Appender
+		testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+			a, err = app.Appender(ctx)
+			return err
+		}))
+		// Enough series for the compactions to take a while, with samples spanning more than one and a half blocks.
+		for i := 0; i < 1000; i++ {
+			lset := labels.FromStrings("__name__", "metric", "series", fmt.Sprint(i))
+			for ts := start; ts.Before(start.Add(4 * time.Hour)); ts = ts.Add(5 * time.Minute) {
+				_, err := a.Append(0, lset, ts.UnixMilli(), 1)
+				testutil.Ok(t, err)
+			}
+		}
+		testutil.Ok(t, a.Commit())
+	}
+
+	// Appends keep succeeding promptly while the tenants are compacted one at a time.
+	compacted := func() bool {
+		for _, tenant := range tenants {
+			if len(m.tenants[tenant].readyStorage().Get().Blocks()) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for ts := start.Add(4 * time.Hour); !compacted(); ts = ts.Add(time.Millisecond) {
+		testutil.Ok(t, ctx.Err())
+		appendStart := time.Now()
+		testutil.Ok(t, appendSample(m, "foo", ts))
+		took := time.Since(appendStart)
+		testutil.Assert(t, took < time.Second, "append took %v during compactions", took)
+		time.Sleep(time.Millisecond)
+	}
+
+	testutil.Equals(t, 0.0, promtest.ToFloat64(m.headCompactionMetrics.queueLength))
+	// The duration of a compaction is observed once its block is already visible.
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		if n := promtest.CollectAndCount(m.headCompactionMetrics.duration); n != len(tenants) {
+			return errors.Errorf("%d compaction durations observed", n)
+		}
+		return nil
+	}))
+	for _, tenant := range tenants {
+		// Only the first block range of the heads was compacted.
+		testutil.Equals(t, 1, len(m.tenants[tenant].readyStorage().Get().Blocks()))
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// IngestionLag exports how far behind the wall clock the samples appended by each tenant are, i.e. the time since the
+// max time of the head of its TSDB, to detect tenants whose clients stopped sending or lag behind.
+type IngestionLag struct {
+	heads          func() map[string]int64
+	now            func() time.Time
+	metricsTenants map[string]struct{}
+
+	headMaxTime *prometheus.GaugeVec
+	lag         *prometheus.GaugeVec
+	maxLag      prometheus.Gauge
+}
+
+// NewIngestionLag creates the IngestionLag of the tenants of the MultiTSDB. Only the given tenants are labelled by
+// their ID, all other ones are aggregated under OtherTenantsLabel. If none is given, all tenants are labelled by their ID.
+func NewIngestionLag(reg prometheus.Registerer, m *MultiTSDB, metricsTenants []string) *IngestionLag {
+	return &IngestionLag{
+		heads:          m.TenantHeadMaxTimes,
+		now:            time.Now,
+		metricsTenants: newMetricsTenants(metricsTenants),
+		headMaxTime: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_head_max_timestamp_seconds",
+			Help: "Unix timestamp of the most recent sample in the head of the tenant TSDB. The oldest one of the tenants labelled \"" + OtherTenantsLabel + "\".",
+		}, []string{"tenant"}),
+		lag: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_ingestion_lag_seconds",
+			Help: "Time between the most recent sample in the head of the tenant TSDB and the last update. The highest one of the tenants labelled \"" + OtherTenantsLabel + "\".",
+		}, []string{"tenant"}),
+		maxLag: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_max_ingestion_lag_seconds",
+			Help: "Highest ingestion lag across all tenants with samples in the head of their TSDB at the last update.",
+		}),
+	}
+}
+
+// Update computes the ingestion lag of the tenants from the max time of the head of their TSDB. Tenants without
+// samples in their head, e.g. just opened or pruned, are not exported.
+func (l *IngestionLag) Update() {
+	maxTimes := map[string]int64{}
+	for tenant, maxt := range l.heads() {
+		label := metricsTenantLabel(l.metricsTenants, tenant)
+		if t, ok := maxTimes[label]; !ok || maxt < t {
+			maxTimes[label] = maxt
+		}
+	}
+
+	now := l.now()
+	l.headMaxTime.Reset()
+	l.lag.Reset()
+	maxLag := 0.0
+	for tenant, maxt := range maxTimes {
+		lag := now.Sub(time.UnixMilli(maxt)).Seconds()
+		l.headMaxTime.WithLabelValues(tenant).Set(float64(maxt) / 1000)
+		l.lag.WithLabelValues(tenant).Set(lag)
+		if lag > maxLag {
+			maxLag = lag
+		}
+	}
+	l.maxLag.Set(maxLag)
+}
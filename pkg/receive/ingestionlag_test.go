@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestIngestionLag(t *testing.T) {
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration: (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration: (2 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	now := time.Now().Truncate(time.Second)
+	testutil.Ok(t, appendSample(m, "foo", now.Add(-time.Minute)))
+	testutil.Ok(t, appendSample(m, "foo", now.Add(-10*time.Second)))
+	testutil.Ok(t, appendSample(m, "bar", now.Add(-time.Hour)))
+	testutil.Ok(t, appendSample(m, "baz", now.Add(-30*time.Minute)))
+	testutil.Equals(t, map[string]int64{
+		"foo": now.Add(-10 * time.Second).UnixMilli(),
+		"bar": now.Add(-time.Hour).UnixMilli(),
+		"baz": now.Add(-30 * time.Minute).UnixMilli(),
+	}, m.TenantHeadMaxTimes())
+
+	l := NewIngestionLag(nil, m, nil)
+	l.now = func() time.Time { return now }
+	l.Update()
+	testutil.Equals(t, 3, promtest.CollectAndCount(l.lag))
+	testutil.Equals(t, 10.0, promtest.ToFloat64(l.lag.WithLabelValues("foo")))
+	testutil.Equals(t, 3600.0, promtest.ToFloat64(l.lag.WithLabelValues("bar")))
+	testutil.Equals(t, float64(now.Add(-10*time.Second).Unix()), promtest.ToFloat64(l.headMaxTime.WithLabelValues("foo")))
+	testutil.Equals(t, 3600.0, promtest.ToFloat64(l.maxLag))
+
+	// Tenants not labelled by their ID are aggregated by their highest lag.
+	l = NewIngestionLag(nil, m, []string{"foo"})
+	l.now = func() time.Time { return now }
+	l.Update()
+	testutil.Equals(t, 2, promtest.CollectAndCount(l.lag))
+	testutil.Equals(t, 10.0, promtest.ToFloat64(l.lag.WithLabelValues("foo")))
+	testutil.Equals(t, 3600.0, promtest.ToFloat64(l.lag.WithLabelValues(OtherTenantsLabel)))
+	testutil.Equals(t, float64(now.Add(-time.Hour).Unix()), promtest.ToFloat64(l.headMaxTime.WithLabelValues(OtherTenantsLabel)))
+
+	// Tenants which are gone are not exported anymore.
+	l.heads = func() map[string]int64 { return map[string]int64{"foo": now.Add(-5 * time.Second).UnixMilli()} }
+	l.Update()
+	testutil.Equals(t, 1, promtest.CollectAndCount(l.lag))
+	testutil.Equals(t, 5.0, promtest.ToFloat64(l.maxLag))
+
+	l.heads = func() map[string]int64 { return nil }
+	l.Update()
+	testutil.Equals(t, 0, promtest.CollectAndCount(l.lag))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(l.maxLag))
+}
@@ -0,0 +1,135 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	// LabelValidationNone writes series as they are received.
+	LabelValidationNone = "none"
+	// LabelValidationStrict rejects write requests with series with invalid labels.
+	LabelValidationStrict = "strict"
+	// LabelValidationNormalize makes the labels of series valid before writing them.
+	LabelValidationNormalize = "normalize"
+)
+
+// LabelValidationModes are the supported label validation modes.
+var LabelValidationModes = []string{LabelValidationNone, LabelValidationStrict, LabelValidationNormalize}
+
+// Reasons of series having invalid labels.
+const (
+	invalidLabelsEmptyName      = "empty_label_name"
+	invalidLabelsName           = "invalid_label_name"
+	invalidLabelsMetricName     = "invalid_metric_name"
+	invalidLabelsUTF8           = "invalid_utf8"
+	invalidLabelsDuplicateNames = "duplicate_label_name"
+)
+
+// invalidLabelsReason returns the reason the labels are invalid, empty if they are valid. Label names must match
+// the Prometheus label name format, metric names the metric name format, and label values must be valid UTF-8.
+func invalidLabelsReason(lset []labelpb.ZLabel) string {
+	names := make(map[string]struct{}, len(lset))
+	for _, l := range lset {
+		switch {
+		case l.Name == "":
+			return invalidLabelsEmptyName
+		case !utf8.ValidString(l.Name) || !utf8.ValidString(l.Value):
+			return invalidLabelsUTF8
+		case !model.LabelName(l.Name).IsValid():
+			return invalidLabelsName
+		case l.Name == labels.MetricName && !model.IsValidMetricName(model.LabelValue(l.Value)):
+			return invalidLabelsMetricName
+		}
+		if _, ok := names[l.Name]; ok {
+			return invalidLabelsDuplicateNames
+		}
+		names[l.Name] = struct{}{}
+	}
+	return ""
+}
+
+// normalizeLabels returns the labels made valid: characters not allowed in label and metric names are replaced with
+// underscores, as in the underscore escaping scheme of Prometheus, and invalid UTF-8 sequences of label values are
+// replaced with the Unicode replacement character. Labels with empty names are removed, and of labels with the same
+// name once normalized, only the first one is kept.
+func normalizeLabels(lset []labelpb.ZLabel) []labelpb.ZLabel {
+	res := make([]labelpb.ZLabel, 0, len(lset))
+	names := make(map[string]struct{}, len(lset))
+	for _, l := range lset {
+		if l.Name == "" {
+			continue
+		}
+		name := escapeName(l.Name, false)
+		if _, ok := names[name]; ok {
+			continue
+		}
+		names[name] = struct{}{}
+
+		value := strings.ToValidUTF8(l.Value, string(utf8.RuneError))
+		if name == labels.MetricName {
+			value = escapeName(value, true)
+		}
+		res = append(res, labelpb.ZLabel{Name: name, Value: value})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// escapeName replaces the characters not allowed in label names, or in metric names if metricName is true, with
+// underscores.
+func escapeName(name string, metricName bool) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	i := 0
+	for _, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') || (metricName && r == ':') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+		i++
+	}
+	return b.String()
+}
+
+// validateLabels validates the labels of the series of the write request according to the label validation mode
+// of the tenant. Series with invalid labels are normalized in place, or an error is returned to reject the request.
+func (h *Handler) validateLabels(tenant string, wreq *prompb.WriteRequest) error {
+	mode, ok := h.options.TenantLabelValidation[tenant]
+	if !ok {
+		mode = h.options.LabelValidation
+	}
+	if mode == "" || mode == LabelValidationNone {
+		return nil
+	}
+
+	var firstErr error
+	for i, ts := range wreq.Timeseries {
+		reason := invalidLabelsReason(ts.Labels)
+		if reason == "" {
+			continue
+		}
+		if mode == LabelValidationNormalize {
+			wreq.Timeseries[i].Labels = normalizeLabels(ts.Labels)
+			h.invalidLabelsSeries.WithLabelValues(h.metricsTenant(tenant), reason, LabelValidationNormalize).Inc()
+			continue
+		}
+		h.invalidLabelsSeries.WithLabelValues(h.metricsTenant(tenant), reason, LabelValidationStrict).Inc()
+		if firstErr == nil {
+			firstErr = errors.Errorf("series %s has invalid labels: %s", strings.ToValidUTF8(labelpb.ZLabelsToPromLabels(ts.Labels).String(), string(utf8.RuneError)), reason)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,142 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"net/http"
+	"testing"
+
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestInvalidLabelsReason(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		lset     []labelpb.ZLabel
+		expected string
+	}{
+		{
+			name: "valid",
+			lset: []labelpb.ZLabel{{Name: "__name__", Value: "http_requests:rate5m"}, {Name: "path", Value: "/ü"}},
+		},
+		{
+			name:     "empty label name",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "", Value: "a"}},
+			expected: invalidLabelsEmptyName,
+		},
+		{
+			name:     "invalid UTF-8 label value",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "path", Value: "/\xff"}},
+			expected: invalidLabelsUTF8,
+		},
+		{
+			name:     "invalid UTF-8 label name",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "pa\xffth", Value: "/"}},
+			expected: invalidLabelsUTF8,
+		},
+		{
+			name:     "invalid label name",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "http.path", Value: "/"}},
+			expected: invalidLabelsName,
+		},
+		{
+			name:     "invalid metric name",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "http.requests"}},
+			expected: invalidLabelsMetricName,
+		},
+		{
+			name:     "duplicate label names",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}, {Name: "job", Value: "b"}},
+			expected: invalidLabelsDuplicateNames,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, invalidLabelsReason(tcase.lset))
+		})
+	}
+}
+
+func TestNormalizeLabels(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		lset     []labelpb.ZLabel
+		expected []labelpb.ZLabel
+	}{
+		{
+			name:     "empty label name",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "", Value: "a"}},
+			expected: []labelpb.ZLabel{{Name: "__name__", Value: "up"}},
+		},
+		{
+			name:     "invalid UTF-8",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "pa\xffth", Value: "/\xff"}},
+			expected: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "pa_th", Value: "/�"}},
+		},
+		{
+			name:     "invalid names",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "1http.requests:total"}, {Name: "http.path", Value: "/"}, {Name: "0code", Value: "200"}},
+			expected: []labelpb.ZLabel{{Name: "__name__", Value: "_http_requests:total"}, {Name: "_code", Value: "200"}, {Name: "http_path", Value: "/"}},
+		},
+		{
+			name:     "duplicate label names",
+			lset:     []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job.name", Value: "a"}, {Name: "job_name", Value: "b"}, {Name: "job_name", Value: "c"}},
+			expected: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job_name", Value: "a"}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			normalized := normalizeLabels(tcase.lset)
+			testutil.Equals(t, tcase.expected, normalized)
+			testutil.Equals(t, "", invalidLabelsReason(normalized))
+		})
+	}
+}
+
+func TestHandlerLabelValidation(t *testing.T) {
+	appendable := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{appendable}, 1)
+	h := handlers[0]
+	h.options.LabelValidation = LabelValidationStrict
+	h.options.TenantLabelValidation = map[string]string{"normalized": LabelValidationNormalize, "unvalidated": LabelValidationNone}
+	// Tenants other than the metrics tenants are accounted together.
+	h.metricsTenants = newMetricsTenants([]string{"strict"})
+
+	valid := prompb.TimeSeries{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}
+	invalid := prompb.TimeSeries{
+		Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "b\xff"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}
+	wreq := func() *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{valid, invalid}}
+	}
+	appended := func(lset []labelpb.ZLabel) int {
+		return len(appendable.appender.(*fakeAppender).Get(labelpb.ZLabelsToPromLabels(lset)))
+	}
+
+	// The whole request is rejected.
+	rec, err := makeRequest(h, "strict", wreq())
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	testutil.Equals(t, 0, appended(valid.Labels))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(h.invalidLabelsSeries.WithLabelValues("strict", invalidLabelsUTF8, LabelValidationStrict)))
+
+	rec, err = makeRequest(h, "normalized", wreq())
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, 1, appended(valid.Labels))
+	testutil.Equals(t, 1, appended([]labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "b�"}}))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(h.invalidLabelsSeries.WithLabelValues(OtherTenantsLabel, invalidLabelsUTF8, LabelValidationNormalize)))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(h.invalidLabelsSeries.WithLabelValues(OtherTenantsLabel, invalidLabelsUTF8, LabelValidationStrict)))
+
+	rec, err = makeRequest(h, "unvalidated", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{invalid}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, 1, appended(invalid.Labels))
+}
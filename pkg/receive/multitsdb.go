@@ -6,6 +6,7 @@ package receive
 import (
 	"context"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
@@ -15,11 +16,14 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 
@@ -31,11 +35,15 @@ import (
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 )
 
+// maxConcurrentTenantStats is the number of tenants whose head stats are computed concurrently.
+const maxConcurrentTenantStats = 4
+
 type TSDBStats interface {
 	// TenantStats returns TSDB head stats for the given tenants.
 	// If no tenantIDs are provided, stats for all tenants are returned.
@@ -55,6 +63,64 @@ type MultiTSDB struct {
 	tenants               map[string]*tenant
 	allowOutOfOrderUpload bool
 	hashFunc              metadata.HashFunc
+
+	idleTimeout          time.Duration
+	idleTimeoutOverrides map[string]time.Duration
+	// evicted holds the tenants whose TSDB was pruned and not reopened since.
+	evicted map[string]struct{}
+
+	diskGuard             *DiskGuard
+	diskPressureRetention time.Duration
+
+	uploadExemplars bool
+
+	// headCompactionGate limits the number of tenant TSDBs compacting at once, nil if each TSDB compacts on its own.
+	headCompactionGate          gate.Gate
+	headCompactionStagger       time.Duration
+	headCompactionCheckInterval time.Duration
+	headCompactionMetrics       *headCompactionMetrics
+
+	// tenantLimits are guarded by mtx.
+	tenantLimits *TenantLimits
+
+	evictedTenants  prometheus.Counter
+	reopenedTenants prometheus.Counter
+	rejectedTenants *prometheus.CounterVec
+}
+
+// MultiTSDBOption configures optional behaviour of the MultiTSDB.
+type MultiTSDBOption func(*MultiTSDB)
+
+// WithTenantIdleTimeout makes the MultiTSDB prune the TSDB of tenants that have not appended any samples
+// for longer than the given duration. Zero disables it, so tenants are pruned only once past the retention.
+func WithTenantIdleTimeout(d time.Duration) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.idleTimeout = d
+	}
+}
+
+// WithTenantIdleTimeoutOverrides overrides the idle timeout for the given tenants.
+func WithTenantIdleTimeoutOverrides(overrides map[string]time.Duration) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.idleTimeoutOverrides = overrides
+	}
+}
+
+// WithDiskPressureRetention makes the MultiTSDB delete local blocks already uploaded to the bucket once they are
+// older than the given retention, while the disk usage of the guard is above its high watermark.
+func WithDiskPressureRetention(guard *DiskGuard, retention time.Duration) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.diskGuard = guard
+		t.diskPressureRetention = retention
+	}
+}
+
+// WithExemplarsUpload makes the shippers of the tenants upload the exemplars of the TSDB of the tenant along with
+// each block.
+func WithExemplarsUpload() MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.uploadExemplars = true
+	}
 }
 
 // NewMultiTSDB creates new MultiTSDB.
@@ -69,12 +135,13 @@ func NewMultiTSDB(
 	bucket objstore.Bucket,
 	allowOutOfOrderUpload bool,
 	hashFunc metadata.HashFunc,
+	options ...MultiTSDBOption,
 ) *MultiTSDB {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
 
-	return &MultiTSDB{
+	t := &MultiTSDB{
 		dataDir:               dataDir,
 		logger:                log.With(l, "component", "multi-tsdb"),
 		reg:                   reg,
@@ -86,7 +153,42 @@ func NewMultiTSDB(
 		bucket:                bucket,
 		allowOutOfOrderUpload: allowOutOfOrderUpload,
 		hashFunc:              hashFunc,
+		evicted:               map[string]struct{}{},
+
+		headCompactionCheckInterval: defaultHeadCompactionCheckInterval,
+		evictedTenants: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_tenants_evicted_total",
+			Help: "Total number of tenants whose TSDB was flushed, closed and removed from local disk.",
+		}),
+		reopenedTenants: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_tenants_reopened_total",
+			Help: "Total number of evicted tenants whose TSDB was opened again on new writes.",
+		}),
+		rejectedTenants: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_tenants_rejected_total",
+			Help: "Total number of write requests of new tenants rejected by the tenant limits, by reason.",
+		}, []string{"reason"}),
+	}
+	for _, o := range options {
+		o(t)
+	}
+	if t.headCompactionGate != nil {
+		t.headCompactionMetrics = newHeadCompactionMetrics(reg)
+	}
+	t.rejectedTenants.WithLabelValues(tenantRejectionLimit)
+	t.rejectedTenants.WithLabelValues(tenantRejectionNotAllowed)
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_receive_tenants",
+		Help: "Number of tenants with a TSDB on the receiver.",
+	}, func() float64 {
+		t.mtx.RLock()
+		defer t.mtx.RUnlock()
+		return float64(len(t.tenants))
+	})
+	if reg != nil {
+		reg.MustRegister(newTenantsCollector(t))
 	}
+	return t
 }
 
 type tenant struct {
@@ -95,6 +197,11 @@ type tenant struct {
 	exemplarsTSDB *exemplars.TSDB
 	ship          *shipper.Shipper
 
+	// lastAppend is the time of the last successful commit to the tenant TSDB in milliseconds.
+	lastAppend atomic.Int64
+	// stopCompactions stops the background compactions of the tenant TSDB, nil if there are none.
+	stopCompactions func()
+
 	mtx *sync.RWMutex
 }
 
@@ -105,6 +212,34 @@ func newTenant() *tenant {
 	}
 }
 
+// Appender returns an appender of the tenant TSDB that records the time of its commits.
+func (t *tenant) Appender(ctx context.Context) (storage.Appender, error) {
+	app, err := t.readyS.Appender(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantAppender{Appender: app, tenant: t}, nil
+}
+
+type tenantAppender struct {
+	storage.Appender
+
+	tenant *tenant
+}
+
+// GetRef implements storage.GetRef of the underlying TSDB appender.
+func (a *tenantAppender) GetRef(lset labels.Labels) (storage.SeriesRef, labels.Labels) {
+	return a.Appender.(storage.GetRef).GetRef(lset)
+}
+
+func (a *tenantAppender) Commit() error {
+	if err := a.Appender.Commit(); err != nil {
+		return err
+	}
+	a.tenant.lastAppend.Store(time.Now().UnixMilli())
+	return nil
+}
+
 func (t *tenant) readyStorage() *ReadyStorage {
 	return t.readyS
 }
@@ -136,6 +271,13 @@ func (t *tenant) set(storeTSDB *store.TSDBStore, tenantTSDB *tsdb.DB, ship *ship
 	t.mtx.Unlock()
 }
 
+// SetTenantLimits sets the limits checked before the TSDB of a new tenant is created. Nil limits disable them.
+func (t *MultiTSDB) SetTenantLimits(l *TenantLimits) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.tenantLimits = l
+}
+
 func (t *MultiTSDB) Open() error {
 	if err := os.MkdirAll(t.dataDir, 0750); err != nil {
 		return err
@@ -154,7 +296,8 @@ func (t *MultiTSDB) Open() error {
 		}
 
 		g.Go(func() error {
-			_, err := t.getOrLoadTenant(f.Name(), true)
+			// The tenants of the data directory already exist, so they are not subject to the tenant limits.
+			_, err := t.getOrLoadTenant(f.Name(), true, false)
 			return err
 		})
 	}
@@ -204,16 +347,17 @@ func (t *MultiTSDB) Close() error {
 			continue
 		}
 		level.Info(t.logger).Log("msg", "closing TSDB", "tenant", id)
+		tenant.stopHeadCompactions()
 		merr.Add(db.Close())
 	}
 	return merr.Err()
 }
 
 // Prune flushes and closes the TSDB for tenants that haven't received
-// any new samples for longer than the TSDB retention period.
+// any new samples for longer than the TSDB retention period or their idle timeout.
 func (t *MultiTSDB) Prune(ctx context.Context) error {
 	// Retention of 0 means infinite retention.
-	if t.tsdbOpts.RetentionDuration == 0 {
+	if t.tsdbOpts.RetentionDuration == 0 && t.idleTimeout == 0 && len(t.idleTimeoutOverrides) == 0 {
 		return nil
 	}
 
@@ -233,7 +377,7 @@ func (t *MultiTSDB) Prune(ctx context.Context) error {
 		go func(tenantID string, tenantInstance *tenant) {
 			defer wg.Done()
 			tlog := log.With(t.logger, "tenant", tenantID)
-			pruned, err := t.pruneTSDB(ctx, tlog, tenantInstance)
+			pruned, err := t.pruneTSDB(ctx, tlog, tenantInstance, t.tenantIdleTimeout(tenantID))
 			if err != nil {
 				merr.Add(err)
 				return
@@ -251,32 +395,47 @@ func (t *MultiTSDB) Prune(ctx context.Context) error {
 	for _, tenantID := range prunedTenants {
 		level.Info(t.logger).Log("msg", "Pruned tenant", "tenant", tenantID)
 		delete(t.tenants, tenantID)
+		t.evicted[tenantID] = struct{}{}
+		t.evictedTenants.Inc()
+		if t.headCompactionMetrics != nil {
+			t.headCompactionMetrics.duration.DeleteLabelValues(tenantID)
+		}
 	}
 
 	return merr.Err()
 }
 
-// pruneTSDB removes a TSDB if its past the retention period.
+// tenantIdleTimeout returns the idle timeout of the given tenant.
+func (t *MultiTSDB) tenantIdleTimeout(tenantID string) time.Duration {
+	if d, ok := t.idleTimeoutOverrides[tenantID]; ok {
+		return d
+	}
+	return t.idleTimeout
+}
+
+// pruneTSDB removes a TSDB if its past the retention period or idle for longer than idleTimeout.
 // It compacts the TSDB head, sends all remaining blocks to S3 and removes the TSDB from disk.
-func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInstance *tenant) (bool, error) {
+func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInstance *tenant, idleTimeout time.Duration) (bool, error) {
 	tenantTSDB := tenantInstance.readyStorage().get()
 	if tenantTSDB == nil {
 		return false, nil
 	}
 	tdb := tenantTSDB.db
 	head := tdb.Head()
-	if head.MaxTime() < 0 {
-		return false, nil
-	}
 
-	sinceLastAppend := time.Since(time.UnixMilli(head.MaxTime()))
-	if sinceLastAppend.Milliseconds() <= t.tsdbOpts.RetentionDuration {
+	idle := idleTimeout > 0 && time.Since(time.UnixMilli(tenantInstance.lastAppend.Load())) > idleTimeout
+	pastRetention := t.tsdbOpts.RetentionDuration > 0 && head.MaxTime() >= 0 &&
+		time.Since(time.UnixMilli(head.MaxTime())).Milliseconds() > t.tsdbOpts.RetentionDuration
+	if !idle && !pastRetention {
 		return false, nil
 	}
 
-	level.Info(logger).Log("msg", "Pruning tenant")
-	if err := tdb.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime())); err != nil {
-		return false, err
+	level.Info(logger).Log("msg", "Pruning tenant", "idle", idle)
+	tenantInstance.stopHeadCompactions()
+	if head.MaxTime() >= 0 {
+		if err := tdb.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime())); err != nil {
+			return false, err
+		}
 	}
 
 	if tenantInstance.shipper() != nil {
@@ -392,6 +551,28 @@ func (t *MultiTSDB) TSDBExemplars() map[string]*exemplars.TSDB {
 	return res
 }
 
+// TenantHeadMaxTimes returns the max time in milliseconds of the head of the TSDB of each tenant with samples in its
+// head.
+func (t *MultiTSDB) TenantHeadMaxTimes() map[string]int64 {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	res := make(map[string]int64, len(t.tenants))
+	for k, tenant := range t.tenants {
+		db := tenant.readyStorage().Get()
+		if db == nil {
+			continue
+		}
+		if maxt := db.Head().MaxTime(); maxt != math.MinInt64 {
+			res[k] = maxt
+		}
+	}
+	return res
+}
+
+// TenantStats returns the head stats of the given tenants, or of all tenants if none is given. At most
+// maxConcurrentTenantStats tenants are processed at once, to bound the CPU used by TSDB stats requests; the cardinality
+// stats of each head are cached by the TSDB for 30s.
 func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []status.TenantStats {
 	t.mtx.RLock()
 	defer t.mtx.RUnlock()
@@ -404,6 +585,7 @@ func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []
 	var (
 		mu     sync.Mutex
 		wg     sync.WaitGroup
+		sem    = make(chan struct{}, maxConcurrentTenantStats)
 		result = make([]status.TenantStats, 0, len(t.tenants))
 	)
 	for _, tenantID := range tenantIDs {
@@ -413,8 +595,10 @@ func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []
 		}
 
 		wg.Add(1)
+		sem <- struct{}{}
 		go func(tenantID string, tenantInstance *tenant) {
 			defer wg.Done()
+			defer func() { <-sem }()
 			db := tenantInstance.readyS.Get()
 			if db == nil {
 				return
@@ -444,6 +628,9 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 
 	level.Info(logger).Log("msg", "opening TSDB")
 	opts := *t.tsdbOpts
+	if t.bucket != nil && t.diskGuard != nil && t.diskPressureRetention > 0 {
+		opts.BlocksToDelete = t.blocksToDelete(logger, dataDir, tenant)
+	}
 	s, err := tsdb.Open(
 		dataDir,
 		logger,
@@ -457,11 +644,14 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 		t.mtx.Unlock()
 		return err
 	}
+	if t.headCompactionGate != nil {
+		s.DisableCompactions()
+	}
 	var ship *shipper.Shipper
 	if t.bucket != nil {
 		ship = shipper.New(
 			logger,
-			reg,
+			&UnRegisterer{Registerer: reg},
 			dataDir,
 			t.bucket,
 			func() labels.Labels { return lset },
@@ -471,16 +661,76 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 			t.hashFunc,
 		)
 	}
-	tenant.set(store.NewTSDBStore(logger, s, component.Receive, lset), s, ship, exemplars.NewTSDB(s, lset))
+	// Until the first commit, estimate the last append from the samples replayed from the WAL.
+	lastAppend := time.Now().UnixMilli()
+	if maxt := s.Head().MaxTime(); maxt >= 0 && maxt < lastAppend {
+		lastAppend = maxt
+	}
+	tenant.lastAppend.Store(lastAppend)
+	exemplarsSrv := exemplars.NewTSDB(s, lset)
+	if ship != nil && t.uploadExemplars {
+		ship.WithExemplars(exemplarsSrv.AllSeries)
+	}
+	tenant.set(store.NewTSDBStore(logger, s, component.Receive, lset), s, ship, exemplarsSrv)
+	if t.headCompactionGate != nil {
+		t.startHeadCompactions(logger, tenantID, tenant, s)
+	}
 	level.Info(logger).Log("msg", "TSDB is now ready")
 	return nil
 }
 
+// blocksToDelete returns the blocks deletable by the TSDB retention and, while the disk usage is above the high
+// watermark, the blocks uploaded by the shipper which are older than the disk pressure retention.
+func (t *MultiTSDB) blocksToDelete(logger log.Logger, dataDir string, tenant *tenant) tsdb.BlocksToDeleteFunc {
+	return func(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
+		db := tenant.readyStorage().Get()
+		if db == nil {
+			// The TSDB is still being opened, blocks are deleted on its next reload.
+			return nil
+		}
+		deletable := tsdb.DefaultBlocksToDelete(db)(blocks)
+		if !t.diskGuard.AboveHighWatermark() || len(blocks) == 0 {
+			return deletable
+		}
+
+		meta, err := shipper.ReadMetaFile(dataDir)
+		if err != nil {
+			if !os.IsNotExist(errors.Cause(err)) {
+				level.Warn(logger).Log("msg", "failed to read shipper meta file, not deleting uploaded blocks", "err", err)
+			}
+			return deletable
+		}
+		uploaded := make(map[ulid.ULID]struct{}, len(meta.Uploaded))
+		for _, id := range meta.Uploaded {
+			uploaded[id] = struct{}{}
+		}
+
+		maxt := blocks[0].Meta().MaxTime
+		for _, b := range blocks[1:] {
+			if b.Meta().MaxTime > maxt {
+				maxt = b.Meta().MaxTime
+			}
+		}
+		for _, b := range blocks {
+			id := b.Meta().ULID
+			if _, ok := uploaded[id]; !ok {
+				continue
+			}
+			if _, ok := deletable[id]; ok || maxt-b.Meta().MaxTime <= t.diskPressureRetention.Milliseconds() {
+				continue
+			}
+			level.Info(logger).Log("msg", "deleting uploaded block due to disk pressure", "block", id)
+			deletable[id] = struct{}{}
+		}
+		return deletable
+	}
+}
+
 func (t *MultiTSDB) defaultTenantDataDir(tenantID string) string {
 	return path.Join(t.dataDir, tenantID)
 }
 
-func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart bool) (*tenant, error) {
+func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart, checkLimits bool) (*tenant, error) {
 	// Fast path, as creating tenants is a very rare operation.
 	t.mtx.RLock()
 	tenant, exist := t.tenants[tenantID]
@@ -498,9 +748,20 @@ func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart bool) (*tenan
 		t.mtx.Unlock()
 		return tenant, nil
 	}
+	if checkLimits {
+		if reason, err := t.tenantLimits.check(tenantID, len(t.tenants)); err != nil {
+			t.mtx.Unlock()
+			t.rejectedTenants.WithLabelValues(reason).Inc()
+			return nil, err
+		}
+	}
 
 	tenant = newTenant()
 	t.tenants[tenantID] = tenant
+	if _, ok := t.evicted[tenantID]; ok {
+		delete(t.evicted, tenantID)
+		t.reopenedTenants.Inc()
+	}
 	t.mtx.Unlock()
 
 	logger := log.With(t.logger, "tenant", tenantID)
@@ -516,11 +777,65 @@ func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart bool) (*tenan
 }
 
 func (t *MultiTSDB) TenantAppendable(tenantID string) (Appendable, error) {
-	tenant, err := t.getOrLoadTenant(tenantID, false)
+	tenant, err := t.getOrLoadTenant(tenantID, false, true)
 	if err != nil {
 		return nil, err
 	}
-	return tenant.readyStorage(), nil
+	return tenant, nil
+}
+
+// tenantsCollector exports the last append time, WAL size and head usage of each tenant TSDB.
+type tenantsCollector struct {
+	m *MultiTSDB
+
+	lastAppend        *prometheus.Desc
+	walSize           *prometheus.Desc
+	headSeries        *prometheus.Desc
+	headMmappedChunks *prometheus.Desc
+}
+
+func newTenantsCollector(m *MultiTSDB) *tenantsCollector {
+	return &tenantsCollector{
+		m: m,
+		lastAppend: prometheus.NewDesc("thanos_receive_tenant_last_append_timestamp_seconds",
+			"Unix timestamp of the last successful append to the tenant TSDB.", []string{"tenant"}, nil),
+		walSize: prometheus.NewDesc("thanos_receive_tenant_wal_size_bytes",
+			"Size of the WAL of the tenant TSDB on disk, including checkpoints.", []string{"tenant"}, nil),
+		headSeries: prometheus.NewDesc("thanos_receive_tenant_head_series",
+			"Number of series in the head of the tenant TSDB, which dominates its memory usage.", []string{"tenant"}, nil),
+		headMmappedChunks: prometheus.NewDesc("thanos_receive_tenant_head_mmapped_chunks_size_bytes",
+			"Size of the memory mapped head chunks of the tenant TSDB.", []string{"tenant"}, nil),
+	}
+}
+
+func (c *tenantsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastAppend
+	ch <- c.walSize
+	ch <- c.headSeries
+	ch <- c.headMmappedChunks
+}
+
+func (c *tenantsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mtx.RLock()
+	defer c.m.mtx.RUnlock()
+
+	for tenantID, tenantInstance := range c.m.tenants {
+		db := tenantInstance.readyStorage().Get()
+		if db == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastAppend, prometheus.GaugeValue, float64(tenantInstance.lastAppend.Load())/1000, tenantID)
+		ch <- prometheus.MustNewConstMetric(c.headSeries, prometheus.GaugeValue, float64(db.Head().NumSeries()), tenantID)
+
+		walSize, err := fileutil.DirSize(filepath.Join(db.Dir(), "wal"))
+		if err != nil {
+			level.Warn(c.m.logger).Log("msg", "failed to get WAL size", "tenant", tenantID, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.walSize, prometheus.GaugeValue, float64(walSize), tenantID)
+		// Head size accounts for the WAL and the memory mapped chunks on disk.
+		ch <- prometheus.MustNewConstMetric(c.headMmappedChunks, prometheus.GaugeValue, float64(db.Head().Size()-walSize), tenantID)
+	}
 }
 
 // ErrNotReady is returned if the underlying storage is not ready yet.
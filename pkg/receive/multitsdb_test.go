@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -15,7 +16,10 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/types"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -25,9 +29,11 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
 func TestMultiTSDB(t *testing.T) {
@@ -477,6 +483,186 @@ func TestMultiTSDBPrune(t *testing.T) {
 	}
 }
 
+func TestMultiTSDBPruneIdleTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-prune-idle")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewRegistry()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), reg,
+		&tsdb.Options{
+			MinBlockDuration: (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration: (2 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		bkt,
+		false,
+		metadata.NoneFunc,
+		WithTenantIdleTimeout(time.Hour),
+		WithTenantIdleTimeoutOverrides(map[string]time.Duration{"foo": time.Nanosecond}),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	testutil.Ok(t, appendSample(m, "foo", time.Now()))
+	testutil.Ok(t, appendSample(m, "bar", time.Now()))
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+	count, err := promtest.GatherAndCount(reg,
+		"thanos_receive_tenant_last_append_timestamp_seconds",
+		"thanos_receive_tenant_wal_size_bytes",
+		"thanos_receive_tenant_head_series",
+		"thanos_receive_tenant_head_mmapped_chunks_size_bytes",
+	)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 8, count)
+
+	// Only foo is idle for longer than its timeout.
+	testutil.Ok(t, m.Prune(context.Background()))
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+	_, ok := m.TSDBStores()["bar"]
+	testutil.Assert(t, ok, "expected bar to be kept")
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.evictedTenants))
+	count, err = promtest.GatherAndCount(reg, "thanos_receive_tenant_last_append_timestamp_seconds")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, count)
+
+	_, err = os.Stat(m.defaultTenantDataDir("foo"))
+	testutil.Assert(t, os.IsNotExist(err), "expected local data of foo to be removed")
+	var shippedBlocks int
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(s string) error {
+		shippedBlocks++
+		return nil
+	}))
+	testutil.Equals(t, 1, shippedBlocks)
+
+	// Writing to an evicted tenant opens its TSDB again.
+	testutil.Ok(t, appendSample(m, "foo", time.Now()))
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.reopenedTenants))
+}
+
+func TestMultiTSDBTenantLimits(t *testing.T) {
+	dir := t.TempDir()
+	reg := prometheus.NewRegistry()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), reg,
+		&tsdb.Options{
+			MinBlockDuration: (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration: (2 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	limits, err := ParseTenantLimitsConfig([]byte(`
+max_tenants: 2
+allowed_tenants: 'team-.*'
+denied_tenants: 'team-test-.*'
+`))
+	testutil.Ok(t, err)
+	m.SetTenantLimits(limits)
+
+	_, err = m.TenantAppendable("foo")
+	testutil.Equals(t, errTenantNotAllowed, errors.Cause(err))
+	_, err = m.TenantAppendable("team-test-1")
+	testutil.Equals(t, errTenantNotAllowed, errors.Cause(err))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(m.rejectedTenants.WithLabelValues(tenantRejectionNotAllowed)))
+
+	testutil.Ok(t, appendSample(m, "team-a", time.Now()))
+	testutil.Ok(t, appendSample(m, "team-b", time.Now()))
+	_, err = m.TenantAppendable("team-c")
+	testutil.Equals(t, errTooManyTenants, errors.Cause(err))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.rejectedTenants.WithLabelValues(tenantRejectionLimit)))
+
+	// Existing tenants are unaffected by a limit lower than the number of tenants.
+	limits, err = ParseTenantLimitsConfig([]byte(`max_tenants: 1`))
+	testutil.Ok(t, err)
+	m.SetTenantLimits(limits)
+	testutil.Ok(t, appendSample(m, "team-a", time.Now()))
+	testutil.Ok(t, appendSample(m, "team-b", time.Now()))
+	_, err = m.TenantAppendable("team-c")
+	testutil.Equals(t, errTooManyTenants, errors.Cause(err))
+
+	m.SetTenantLimits(nil)
+	testutil.Ok(t, appendSample(m, "team-c", time.Now()))
+	count, err := promtest.GatherAndCount(reg, "thanos_receive_tenants")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, count)
+	testutil.Equals(t, 3, len(m.TSDBStores()))
+
+	for _, conf := range []string{
+		`max_tenants: -1`,
+		`allowed_tenants: '('`,
+		`denied_tenants: '('`,
+		`unknown: true`,
+	} {
+		_, err := ParseTenantLimitsConfig([]byte(conf))
+		testutil.NotOk(t, err, conf)
+	}
+}
+func TestMultiTSDBDiskPressureRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-disk-pressure")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	// Blocks of the last 6 hours, of which the first and the last one were uploaded.
+	tenantDir := filepath.Join(dir, "foo")
+	testutil.Ok(t, os.MkdirAll(tenantDir, 0750))
+	var ids []ulid.ULID
+	for i := int64(0); i < 3; i++ {
+		mint := i * (2 * time.Hour).Milliseconds()
+		id, err := e2eutil.CreateBlock(context.Background(), tenantDir, []labels.Labels{labels.FromStrings("a", "b")}, 10,
+			mint, mint+(2*time.Hour).Milliseconds(), labels.FromStrings("tenant_id", "foo"), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		ids = append(ids, id)
+	}
+	testutil.Ok(t, shipper.WriteMetaFile(log.NewNopLogger(), tenantDir, &shipper.Meta{
+		Version:  shipper.MetaVersion1,
+		Uploaded: []ulid.ULID{ids[0], ids[2]},
+	}))
+
+	guard := NewDiskGuard(log.NewNopLogger(), nil, dir, 0.9, 0.8)
+	guard.usage = func(string) (float64, error) { return 0.95, nil }
+	testutil.Ok(t, guard.Update())
+
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration: (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration: (2 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		objstore.NewInMemBucket(),
+		false,
+		metadata.NoneFunc,
+		WithDiskPressureRetention(guard, 2*time.Hour),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	// Blocks are deleted when the TSDB reloads its blocks, e.g. after flushing a new one.
+	testutil.Ok(t, appendSample(m, "foo", time.UnixMilli((7*time.Hour).Milliseconds())))
+	testutil.Ok(t, appendSample(m, "foo", time.UnixMilli((7*time.Hour).Milliseconds()+1)))
+	testutil.Ok(t, m.Flush())
+
+	blocks := map[ulid.ULID]struct{}{}
+	for _, b := range m.tenants["foo"].readyStorage().Get().Blocks() {
+		blocks[b.Meta().ULID] = struct{}{}
+	}
+	testutil.Equals(t, 3, len(blocks))
+	// Only the oldest block is uploaded and older than the retention.
+	_, ok := blocks[ids[0]]
+	testutil.Assert(t, !ok, "expected the oldest uploaded block to be deleted")
+	for _, id := range ids[1:] {
+		_, ok := blocks[id]
+		testutil.Assert(t, ok, "expected block %s to be kept", id)
+	}
+}
+
 func TestMultiTSDBStats(t *testing.T) {
 	tests := []struct {
 		name          string
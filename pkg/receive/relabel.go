@@ -0,0 +1,45 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/relabel"
+	"gopkg.in/yaml.v2"
+)
+
+// TenantRelabelConfig is the relabeling configuration of a single tenant.
+type TenantRelabelConfig struct {
+	// WriteRelabelConfigs are applied to all series written by the tenant, after the global relabeling.
+	WriteRelabelConfigs []*relabel.Config `yaml:"write_relabel_configs"`
+}
+
+// TenantsRelabelConfig is the per-tenant relabeling configuration of a receiver.
+type TenantsRelabelConfig struct {
+	Tenants map[string]TenantRelabelConfig `yaml:"tenants"`
+}
+
+// ParseTenantsRelabelConfig parses the given YAML content into write relabel configs by tenant.
+func ParseTenantsRelabelConfig(content []byte) (map[string][]*relabel.Config, error) {
+	var cfg TenantsRelabelConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parse tenant relabel configuration")
+	}
+
+	configs := make(map[string][]*relabel.Config, len(cfg.Tenants))
+	for tenant, c := range cfg.Tenants {
+		if tenant == "" {
+			return nil, errors.New("tenant relabel configuration with empty tenant")
+		}
+		for i, rc := range c.WriteRelabelConfigs {
+			if rc == nil {
+				return nil, errors.Errorf("empty write relabel config %d of tenant %s", i, tenant)
+			}
+		}
+		if len(c.WriteRelabelConfigs) > 0 {
+			configs[tenant] = c.WriteRelabelConfigs
+		}
+	}
+	return configs, nil
+}
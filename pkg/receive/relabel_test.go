@@ -0,0 +1,46 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseTenantsRelabelConfig(t *testing.T) {
+	configs, err := ParseTenantsRelabelConfig([]byte(`
+tenants:
+  foo:
+    write_relabel_configs:
+    - action: labeldrop
+      regex: request_id
+  bar:
+    write_relabel_configs: []
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(configs))
+	testutil.Equals(t, 1, len(configs["foo"]))
+
+	configs, err = ParseTenantsRelabelConfig(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(configs))
+
+	_, err = ParseTenantsRelabelConfig([]byte(`
+tenants:
+  foo:
+    relabel_configs:
+    - action: labeldrop
+      regex: request_id
+`))
+	testutil.NotOk(t, err)
+
+	_, err = ParseTenantsRelabelConfig([]byte(`
+tenants:
+  foo:
+    write_relabel_configs:
+    - action: unknown
+`))
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,230 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jpillora/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	labelQueueFull = "queue_full"
+	labelFailed    = "failed"
+)
+
+// RemoteReplicationOptions configure the replication of write requests to the hashring of a remote cluster.
+type RemoteReplicationOptions struct {
+	// Hashring is the hashring of the remote cluster, the time series are replicated to its endpoints.
+	Hashring Hashring
+	// ReplicationFactor is the number of endpoints of the remote hashring each time series is replicated to.
+	ReplicationFactor uint64
+	// QueueSize is the number of write requests waiting for replication beyond which new ones are dropped.
+	QueueSize int
+	// Concurrency is the number of write requests replicated concurrently.
+	Concurrency int
+	// MaxRetries is the number of times a remote write failing with a retriable error is retried before its time
+	// series are dropped.
+	MaxRetries int
+	// ForwardTimeout is the timeout of each remote write.
+	ForwardTimeout time.Duration
+	DialOpts       []grpc.DialOption
+}
+
+// RemoteReplicator replicates write requests to the hashring of a remote cluster asynchronously, e.g. for disaster
+// recovery across clusters. Write requests are queued once they were written to the local hashring, so that the
+// replication affects neither the latency nor the status of the responses to clients.
+type RemoteReplicator struct {
+	logger  log.Logger
+	opts    RemoteReplicationOptions
+	peers   *peerGroup
+	queue   chan *remoteReplicationRequest
+	backoff backoff.Backoff
+
+	requests      *prometheus.CounterVec
+	droppedSeries *prometheus.CounterVec
+	lag           prometheus.Histogram
+}
+
+type remoteReplicationRequest struct {
+	tenant   string
+	wreq     *prompb.WriteRequest
+	enqueued time.Time
+}
+
+// NewRemoteReplicator returns a RemoteReplicator, which replicates write requests once it runs.
+func NewRemoteReplicator(logger log.Logger, reg prometheus.Registerer, opts RemoteReplicationOptions) *RemoteReplicator {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if opts.ReplicationFactor == 0 {
+		opts.ReplicationFactor = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	r := &RemoteReplicator{
+		logger: logger,
+		opts:   opts,
+		peers:  newPeerGroup(ReplicationCompressionNone, opts.DialOpts...),
+		queue:  make(chan *remoteReplicationRequest, opts.QueueSize),
+		backoff: backoff.Backoff{
+			Factor: 2,
+			Min:    100 * time.Millisecond,
+			Max:    30 * time.Second,
+			Jitter: true,
+		},
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_remote_replication_requests_total",
+			Help: "The number of remote write requests sent to the remote hashring, including retries.",
+		}, []string{"result"}),
+		droppedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_remote_replication_dropped_series_total",
+			Help: "The number of time series which were not replicated to the remote hashring, because the queue was full or the remote writes failed.",
+		}, []string{"reason"}),
+		lag: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "thanos_receive_remote_replication_lag_seconds",
+			Help:    "The duration between queueing write requests and their replication to the remote hashring.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_receive_remote_replication_queue_length",
+		Help: "The number of write requests waiting for replication to the remote hashring.",
+	}, func() float64 {
+		return float64(len(r.queue))
+	})
+	r.requests.WithLabelValues(labelSuccess)
+	r.requests.WithLabelValues(labelError)
+	r.droppedSeries.WithLabelValues(labelQueueFull)
+	r.droppedSeries.WithLabelValues(labelFailed)
+	return r
+}
+
+// Enqueue queues the write request of the tenant for replication, or drops it if the queue is full. The write
+// request must not be modified afterwards.
+func (r *RemoteReplicator) Enqueue(tenant string, wreq *prompb.WriteRequest) {
+	select {
+	case r.queue <- &remoteReplicationRequest{tenant: tenant, wreq: wreq, enqueued: time.Now()}:
+	default:
+		r.droppedSeries.WithLabelValues(labelQueueFull).Add(float64(len(wreq.Timeseries)))
+	}
+}
+
+// Run replicates the queued write requests until the context is canceled.
+func (r *RemoteReplicator) Run(ctx context.Context) error {
+	done := make(chan struct{})
+	for i := 0; i < r.opts.Concurrency; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-r.queue:
+					r.replicate(ctx, req)
+				}
+			}
+		}()
+	}
+	for i := 0; i < r.opts.Concurrency; i++ {
+		<-done
+	}
+	return nil
+}
+
+// replicate writes the time series of the request to their endpoints of the remote hashring for every replica.
+func (r *RemoteReplicator) replicate(ctx context.Context, req *remoteReplicationRequest) {
+	type target struct {
+		endpoint string
+		replica  uint64
+	}
+	wreqs := map[target]*prompb.WriteRequest{}
+	for i := range req.wreq.Timeseries {
+		for rep := uint64(0); rep < r.opts.ReplicationFactor; rep++ {
+			endpoint, err := r.opts.Hashring.GetN(req.tenant, &req.wreq.Timeseries[i], rep)
+			if err != nil {
+				level.Warn(r.logger).Log("msg", "failed to get endpoint of remote hashring", "tenant", req.tenant, "err", err)
+				r.droppedSeries.WithLabelValues(labelFailed).Inc()
+				continue
+			}
+			t := target{endpoint: endpoint, replica: rep}
+			if _, ok := wreqs[t]; !ok {
+				wreqs[t] = &prompb.WriteRequest{}
+			}
+			wreqs[t].Timeseries = append(wreqs[t].Timeseries, req.wreq.Timeseries[i])
+		}
+	}
+
+	for t, wreq := range wreqs {
+		if err := r.write(ctx, req.tenant, t.endpoint, t.replica, wreq); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			level.Warn(r.logger).Log("msg", "failed to replicate time series to remote hashring", "tenant", req.tenant, "endpoint", t.endpoint, "err", err)
+			r.droppedSeries.WithLabelValues(labelFailed).Add(float64(len(wreq.Timeseries)))
+		}
+	}
+	r.lag.Observe(time.Since(req.enqueued).Seconds())
+}
+
+// write sends the write request to the endpoint, retrying failures with a backoff.
+func (r *RemoteReplicator) write(ctx context.Context, tenant, endpoint string, rep uint64, wreq *prompb.WriteRequest) error {
+	return writeWithRetries(ctx, r.backoff, r.opts.MaxRetries, r.requests, func(ctx context.Context) error {
+		return sendReplica(ctx, r.peers, r.opts.ForwardTimeout, tenant, endpoint, rep, wreq)
+	})
+}
+
+// writeWithRetries calls send until it succeeds, retrying retriable failures with a backoff at most maxRetries times.
+// The result of each attempt is counted in requests.
+func writeWithRetries(ctx context.Context, b backoff.Backoff, maxRetries int, requests *prometheus.CounterVec, send func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := send(ctx)
+		if err == nil {
+			requests.WithLabelValues(labelSuccess).Inc()
+			return nil
+		}
+		requests.WithLabelValues(labelError).Inc()
+
+		switch status.Code(err) {
+		case codes.AlreadyExists:
+			// The samples were already written, e.g. by a previous attempt which timed out.
+			return nil
+		case codes.InvalidArgument:
+			return err
+		}
+		if attempt >= maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.Duration()):
+		}
+	}
+}
+
+// sendReplica writes the time series of the write request to the endpoint as the given replica.
+func sendReplica(ctx context.Context, peers *peerGroup, timeout time.Duration, tenant, endpoint string, rep uint64, wreq *prompb.WriteRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cl, err := peers.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	// The replica is one-indexed on the wire, so that the receivers write the time series locally instead of
+	// replicating them again.
+	return peers.remoteWrite(ctx, cl, endpoint, tenant, wreq.Timeseries, int64(rep)+1)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// newTestRemoteCluster returns the ingestors of a remote cluster and a replicator to its hashring. The ingestors
+// whose index is in down can't be reached.
+func newTestRemoteCluster(t *testing.T, ingestors int, down map[int]bool, opts RemoteReplicationOptions) ([]*fakeAppender, *RemoteReplicator) {
+	t.Helper()
+
+	peers := &peerGroup{
+		m:      sync.RWMutex{},
+		cache:  map[string]storepb.WriteableStoreClient{},
+		v1Only: map[string]struct{}{},
+		dialer: func(context.Context, string, ...grpc.DialOption) (*grpc.ClientConn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	cfg := []HashringConfig{{Hashring: "remote"}}
+	var appenders []*fakeAppender
+	for i := 0; i < ingestors; i++ {
+		app := newFakeAppender(nil, nil, nil)
+		appenders = append(appenders, app)
+		ingestor := NewHandler(nil, &Options{
+			TenantHeader:         DefaultTenantHeader,
+			ReplicaHeader:        DefaultReplicaHeader,
+			ReplicationFactor:    1,
+			ForwardTimeout:       5 * time.Second,
+			ReceiverMode:         IngestorOnly,
+			ReplicatedWritesOnly: true,
+			Writer:               NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		})
+		ingestor.Hashring(SingleNodeHashring(""))
+
+		addr := randomAddr()
+		cfg[0].Endpoints = append(cfg[0].Endpoints, Endpoint{Address: addr})
+		if !down[i] {
+			peers.cache[addr] = &fakeRemoteWriteGRPCServer{h: ingestor}
+		}
+	}
+
+	opts.Hashring = newMultiHashring(AlgorithmHashmod, cfg)
+	opts.ForwardTimeout = 5 * time.Second
+	r := NewRemoteReplicator(nil, prometheus.NewRegistry(), opts)
+	r.peers = peers
+	r.backoff.Min, r.backoff.Max = time.Millisecond, time.Millisecond
+	return appenders, r
+}
+
+func newTestLocalHandler(r *RemoteReplicator) (*Handler, *fakeAppender) {
+	app := newFakeAppender(nil, nil, nil)
+	h := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: 1,
+		ForwardTimeout:    5 * time.Second,
+		Endpoint:          "local",
+		Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		RemoteReplicator:  r,
+	})
+	h.Hashring(SingleNodeHashring("local"))
+	return h, app
+}
+
+// drainRemoteReplication replicates the queued write requests synchronously.
+func drainRemoteReplication(ctx context.Context, r *RemoteReplicator) {
+	for len(r.queue) > 0 {
+		r.replicate(ctx, <-r.queue)
+	}
+}
+
+func TestRemoteReplication(t *testing.T) {
+	ctx := context.Background()
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}},
+			},
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "baz"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	}
+	lsets := []labels.Labels{labels.FromStrings("foo", "bar"), labels.FromStrings("foo", "baz")}
+
+	t.Run("replicated to remote hashring", func(t *testing.T) {
+		remote, r := newTestRemoteCluster(t, 3, nil, RemoteReplicationOptions{ReplicationFactor: 2, QueueSize: 10})
+		h, local := newTestLocalHandler(r)
+
+		rec, err := makeRequest(h, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		testutil.Equals(t, 2, len(local.Get(lsets[0])))
+
+		// Write requests replicated by other receivers are not replicated again.
+		_, err = h.RemoteWrite(ctx, &storepb.WriteRequest{Timeseries: wreq.Timeseries, Tenant: "test", Replica: 1})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(r.queue))
+
+		drainRemoteReplication(ctx, r)
+		for i, lset := range lsets {
+			var replicas int
+			for _, app := range remote {
+				if got := len(app.Get(lset)); got > 0 {
+					testutil.Equals(t, len(wreq.Timeseries[i].Samples), got)
+					replicas++
+				}
+			}
+			testutil.Equals(t, 2, replicas)
+		}
+		testutil.Equals(t, 0.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelFailed)))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(r.requests.WithLabelValues(labelError)))
+	})
+
+	t.Run("remote hashring down", func(t *testing.T) {
+		remote, r := newTestRemoteCluster(t, 1, map[int]bool{0: true}, RemoteReplicationOptions{QueueSize: 10, MaxRetries: 2})
+		h, local := newTestLocalHandler(r)
+
+		// Clients are not affected by failures of the remote hashring.
+		rec, err := makeRequest(h, "test", wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		testutil.Equals(t, 2, len(local.Get(lsets[0])))
+
+		drainRemoteReplication(ctx, r)
+		testutil.Equals(t, 0, len(remote[0].Get(lsets[0])))
+		testutil.Equals(t, 3.0, promtest.ToFloat64(r.requests.WithLabelValues(labelError)))
+		testutil.Equals(t, 2.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelFailed)))
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		remote, r := newTestRemoteCluster(t, 1, nil, RemoteReplicationOptions{QueueSize: 1})
+		h, _ := newTestLocalHandler(r)
+
+		for i := 0; i < 2; i++ {
+			rec, err := makeRequest(h, "test", wreq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		testutil.Equals(t, 2.0, promtest.ToFloat64(r.droppedSeries.WithLabelValues(labelQueueFull)))
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- r.Run(ctx) }()
+		testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+			if got := len(remote[0].Get(lsets[0])); got != 2 {
+				return errors.Errorf("expected 2 replicated samples, got %d", got)
+			}
+			return nil
+		}))
+		cancel()
+		testutil.Ok(t, <-done)
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// errTooManyTenants is returned for write requests of new tenants while the receiver has its maximum number of tenants.
+	errTooManyTenants = errors.New("maximum number of tenants of the receiver reached; write requests of new tenants are rejected")
+	// errTenantNotAllowed is returned for write requests of new tenants not allowed or denied by the tenant limits.
+	errTenantNotAllowed = errors.New("tenant is not allowed by the tenant limits of the receiver")
+)
+
+// Reasons of the rejections of new tenants.
+const (
+	tenantRejectionLimit      = "limit"
+	tenantRejectionNotAllowed = "not-allowed"
+)
+
+// TenantLimitsConfig configures the limits on the tenants of a receiver.
+type TenantLimitsConfig struct {
+	// MaxTenants is the maximum number of tenants of the receiver, 0 means unlimited.
+	MaxTenants int `yaml:"max_tenants"`
+	// AllowedTenants is a regular expression the IDs of new tenants have to match, if set.
+	AllowedTenants string `yaml:"allowed_tenants"`
+	// DeniedTenants is a regular expression the IDs of new tenants must not match, if set.
+	DeniedTenants string `yaml:"denied_tenants"`
+}
+
+// TenantLimits are the limits checked before the TSDB of a new tenant is created. The tenants which already have a
+// TSDB are not affected by them.
+type TenantLimits struct {
+	maxTenants int
+	allowed    *regexp.Regexp
+	denied     *regexp.Regexp
+}
+
+// ParseTenantLimitsConfig parses the YAML tenant limits configuration.
+func ParseTenantLimitsConfig(content []byte) (*TenantLimits, error) {
+	var cfg TenantLimitsConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parse tenant limits config")
+	}
+	if cfg.MaxTenants < 0 {
+		return nil, errors.New("max_tenants must not be negative")
+	}
+	l := &TenantLimits{maxTenants: cfg.MaxTenants}
+	var err error
+	if cfg.AllowedTenants != "" {
+		if l.allowed, err = regexp.Compile("^(?:" + cfg.AllowedTenants + ")$"); err != nil {
+			return nil, errors.Wrap(err, "compile allowed_tenants")
+		}
+	}
+	if cfg.DeniedTenants != "" {
+		if l.denied, err = regexp.Compile("^(?:" + cfg.DeniedTenants + ")$"); err != nil {
+			return nil, errors.Wrap(err, "compile denied_tenants")
+		}
+	}
+	return l, nil
+}
+
+// check returns an error and the reason of the rejection if a new tenant with the given ID cannot be created, given
+// the current number of tenants.
+func (l *TenantLimits) check(tenantID string, tenants int) (string, error) {
+	if l == nil {
+		return "", nil
+	}
+	if (l.allowed != nil && !l.allowed.MatchString(tenantID)) || (l.denied != nil && l.denied.MatchString(tenantID)) {
+		return tenantRejectionNotAllowed, errors.Wrapf(errTenantNotAllowed, "tenant %s", tenantID)
+	}
+	if l.maxTenants > 0 && tenants >= l.maxTenants {
+		return tenantRejectionLimit, errors.Wrapf(errTooManyTenants, "limit %d", l.maxTenants)
+	}
+	return "", nil
+}
@@ -5,6 +5,10 @@ package receive
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -43,12 +47,12 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 	tLogger := log.With(r.logger, "tenant", tenantID)
 
 	var (
-		numOutOfOrder           = 0
-		numDuplicates           = 0
-		numOutOfBounds          = 0
-		numExemplarsOutOfOrder  = 0
-		numExemplarsDuplicate   = 0
-		numExemplarsLabelLength = 0
+		outOfOrder           seriesErrors
+		duplicates           seriesErrors
+		outOfBounds          seriesErrors
+		exemplarsOutOfOrder  seriesErrors
+		exemplarsDuplicate   seriesErrors
+		exemplarsLabelLength seriesErrors
 	)
 
 	s, err := r.multiTSDB.TenantAppendable(tenantID)
@@ -69,7 +73,7 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		ref  storage.SeriesRef
 		errs errutil.MultiError
 	)
-	for _, t := range wreq.Timeseries {
+	for i, t := range wreq.Timeseries {
 		lset := labelpb.ZLabelsToPromLabels(t.Labels)
 
 		// Check if the TSDB has cached reference for those labels.
@@ -86,13 +90,13 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 			ref, err = app.Append(ref, lset, s.Timestamp, s.Value)
 			switch err {
 			case storage.ErrOutOfOrderSample:
-				numOutOfOrder++
+				outOfOrder.add(i)
 				level.Debug(tLogger).Log("msg", "Out of order sample", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			case storage.ErrDuplicateSampleForTimestamp:
-				numDuplicates++
+				duplicates.add(i)
 				level.Debug(tLogger).Log("msg", "Duplicate sample for timestamp", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			case storage.ErrOutOfBounds:
-				numOutOfBounds++
+				outOfBounds.add(i)
 				level.Debug(tLogger).Log("msg", "Out of bounds metric", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
 			}
 		}
@@ -112,13 +116,13 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 				})
 				switch err {
 				case storage.ErrOutOfOrderExemplar:
-					numExemplarsOutOfOrder++
+					exemplarsOutOfOrder.add(i)
 					level.Debug(logger).Log("msg", "Out of order exemplar")
 				case storage.ErrDuplicateExemplar:
-					numExemplarsDuplicate++
+					exemplarsDuplicate.add(i)
 					level.Debug(logger).Log("msg", "Duplicate exemplar")
 				case storage.ErrExemplarLabelLength:
-					numExemplarsLabelLength++
+					exemplarsLabelLength.add(i)
 					level.Debug(logger).Log("msg", "Label length for exemplar exceeds max limit", "limit", exemplar.ExemplarMaxLabelSetLength)
 				default:
 					if err != nil {
@@ -129,29 +133,29 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		}
 	}
 
-	if numOutOfOrder > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting out-of-order samples", "numDropped", numOutOfOrder)
-		errs.Add(errors.Wrapf(storage.ErrOutOfOrderSample, "add %d samples", numOutOfOrder))
+	if outOfOrder.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting out-of-order samples", "numDropped", outOfOrder.count)
+		errs.Add(outOfOrder.err(storage.ErrOutOfOrderSample, "samples"))
 	}
-	if numDuplicates > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting samples with different value but same timestamp", "numDropped", numDuplicates)
-		errs.Add(errors.Wrapf(storage.ErrDuplicateSampleForTimestamp, "add %d samples", numDuplicates))
+	if duplicates.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting samples with different value but same timestamp", "numDropped", duplicates.count)
+		errs.Add(duplicates.err(storage.ErrDuplicateSampleForTimestamp, "samples"))
 	}
-	if numOutOfBounds > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting samples that are too old or are too far into the future", "numDropped", numOutOfBounds)
-		errs.Add(errors.Wrapf(storage.ErrOutOfBounds, "add %d samples", numOutOfBounds))
+	if outOfBounds.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting samples that are too old or are too far into the future", "numDropped", outOfBounds.count)
+		errs.Add(outOfBounds.err(storage.ErrOutOfBounds, "samples"))
 	}
-	if numExemplarsOutOfOrder > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting out-of-order exemplars", "numDropped", numExemplarsOutOfOrder)
-		errs.Add(errors.Wrapf(storage.ErrOutOfOrderExemplar, "add %d exemplars", numExemplarsOutOfOrder))
+	if exemplarsOutOfOrder.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting out-of-order exemplars", "numDropped", exemplarsOutOfOrder.count)
+		errs.Add(exemplarsOutOfOrder.err(storage.ErrOutOfOrderExemplar, "exemplars"))
 	}
-	if numExemplarsDuplicate > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting duplicate exemplars", "numDropped", numExemplarsDuplicate)
-		errs.Add(errors.Wrapf(storage.ErrDuplicateExemplar, "add %d exemplars", numExemplarsDuplicate))
+	if exemplarsDuplicate.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting duplicate exemplars", "numDropped", exemplarsDuplicate.count)
+		errs.Add(exemplarsDuplicate.err(storage.ErrDuplicateExemplar, "exemplars"))
 	}
-	if numExemplarsLabelLength > 0 {
-		level.Warn(tLogger).Log("msg", "Error on ingesting exemplars with label length exceeding maximum limit", "numDropped", numExemplarsLabelLength)
-		errs.Add(errors.Wrapf(storage.ErrExemplarLabelLength, "add %d exemplars", numExemplarsLabelLength))
+	if exemplarsLabelLength.count > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting exemplars with label length exceeding maximum limit", "numDropped", exemplarsLabelLength.count)
+		errs.Add(exemplarsLabelLength.err(storage.ErrExemplarLabelLength, "exemplars"))
 	}
 
 	if err := app.Commit(); err != nil {
@@ -159,3 +163,48 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 	}
 	return errs.Err()
 }
+
+// seriesErrors counts the samples or exemplars of a write request that failed to be appended with the same error,
+// along with the indices of their series in the request.
+type seriesErrors struct {
+	count  int
+	series []int
+}
+
+func (e *seriesErrors) add(idx int) {
+	e.count++
+	// The samples and exemplars of a series are appended together, so the last index is the only one to check.
+	if n := len(e.series); n == 0 || e.series[n-1] != idx {
+		e.series = append(e.series, idx)
+	}
+}
+
+func (e *seriesErrors) err(cause error, what string) error {
+	sort.Ints(e.series)
+	return &seriesError{cause: cause, msg: fmt.Sprintf("add %d %s", e.count, what), series: e.series}
+}
+
+// maxSeriesErrorIndices is the maximum number of indices of series listed in the message of a series error.
+const maxSeriesErrorIndices = 10
+
+// seriesError is the error of the samples or exemplars of some series of a write request, identified by their
+// index in the request. Its cause is the error returned by the TSDB.
+type seriesError struct {
+	cause  error
+	msg    string
+	series []int
+}
+
+func (e *seriesError) Error() string {
+	idx := make([]string, 0, maxSeriesErrorIndices+1)
+	for i, s := range e.series {
+		if i == maxSeriesErrorIndices {
+			idx = append(idx, fmt.Sprintf("and %d more", len(e.series)-i))
+			break
+		}
+		idx = append(idx, strconv.Itoa(s))
+	}
+	return fmt.Sprintf("%s of series %s: %s", e.msg, strings.Join(idx, ", "), e.cause)
+}
+
+func (e *seriesError) Cause() error { return e.cause }
@@ -5,8 +5,10 @@ package receive
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -18,8 +20,10 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"go.uber.org/atomic"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
@@ -92,7 +96,7 @@ func TestWriter(t *testing.T) {
 					},
 				},
 			},
-			expectedErr:  errors.Wrapf(storage.ErrOutOfOrderExemplar, "add 1 exemplars"),
+			expectedErr:  errors.Wrapf(storage.ErrOutOfOrderExemplar, "add 1 exemplars of series 0"),
 			maxExemplars: 2,
 		},
 		"should error out when exemplar label length exceeds the limit": {
@@ -114,7 +118,7 @@ func TestWriter(t *testing.T) {
 					},
 				},
 			},
-			expectedErr:  errors.Wrapf(storage.ErrExemplarLabelLength, "add 1 exemplars"),
+			expectedErr:  errors.Wrapf(storage.ErrExemplarLabelLength, "add 1 exemplars of series 0"),
 			maxExemplars: 2,
 		},
 	}
@@ -174,3 +178,150 @@ func TestWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestWriter_PartialErrors(t *testing.T) {
+	m := newTestWriterMultiTSDB(t)
+	w := NewWriter(log.NewNopLogger(), m)
+
+	series := func(name string, ts int64, v float64) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  []labelpb.ZLabel{{Name: "__name__", Value: name}},
+			Samples: []prompb.Sample{{Value: v, Timestamp: ts}},
+		}
+	}
+	testutil.Ok(t, w.Write(context.Background(), DefaultTenant, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{series("a", 10, 1), series("b", 10, 1), series("c", 10, 1)},
+	}))
+
+	// The valid series of a request are appended, and the errors of the others point to their index in the request.
+	err := w.Write(context.Background(), DefaultTenant, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series("x", 10, 1),
+			series("a", 10, 2),
+			series("y", 10, 1),
+			series("c", 5, 1),
+			series("b", 20, 1),
+			series("c", 4, 1),
+		},
+	})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "2 errors: add 2 samples of series 3, 5: out of order sample; add 1 samples of series 1: duplicate sample for timestamp", err.Error())
+	testutil.Equals(t, errConflict, determineWriteErrorCause(err, 1))
+
+	merr, ok := err.(errutil.NonNilMultiError)
+	testutil.Assert(t, ok, "expected multi error, got %T", err)
+	testutil.Equals(t, storage.ErrOutOfOrderSample, errors.Cause(merr[0]))
+	testutil.Equals(t, []int{3, 5}, merr[0].(*seriesError).series)
+	testutil.Equals(t, []int{1}, merr[1].(*seriesError).series)
+
+	app, err := m.TenantAppendable(DefaultTenant)
+	testutil.Ok(t, err)
+	querier, err := app.(*tenant).readyStorage().Querier(context.Background(), 0, 100)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, querier.Close()) }()
+
+	ss := querier.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+"))
+	got := map[string][]int64{}
+	for ss.Next() {
+		it := ss.At().Iterator()
+		for it.Next() {
+			ts, _ := it.At()
+			got[ss.At().Labels().Get("__name__")] = append(got[ss.At().Labels().Get("__name__")], ts)
+		}
+		testutil.Ok(t, it.Err())
+	}
+	testutil.Ok(t, ss.Err())
+	testutil.Equals(t, map[string][]int64{"a": {10}, "b": {10, 20}, "c": {10}, "x": {10}, "y": {10}}, got)
+}
+
+func BenchmarkWriterWrite(b *testing.B) {
+	const numSeries = 10000
+
+	m := newTestWriterMultiTSDB(b)
+	w := NewWriter(log.NewNopLogger(), m)
+
+	wreq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, numSeries)}
+	for i := range wreq.Timeseries {
+		wreq.Timeseries[i] = prompb.TimeSeries{
+			Labels: []labelpb.ZLabel{
+				{Name: "__name__", Value: "metric"},
+				{Name: "instance", Value: fmt.Sprintf("instance-%d", i%100)},
+				{Name: "series", Value: strconv.Itoa(i)},
+			},
+			Samples: []prompb.Sample{{}},
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range wreq.Timeseries {
+			wreq.Timeseries[j].Samples[0] = prompb.Sample{Value: float64(i), Timestamp: int64(i)}
+		}
+		testutil.Ok(b, w.Write(context.Background(), DefaultTenant, wreq))
+	}
+}
+
+// BenchmarkWriterWriteParallel writes requests of distinct series concurrently, as receivers do for the requests of
+// their clients, so that the writes contend on the locks of the head.
+func BenchmarkWriterWriteParallel(b *testing.B) {
+	const numSeries = 10000
+
+	m := newTestWriterMultiTSDB(b)
+	w := NewWriter(log.NewNopLogger(), m)
+
+	var writers atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		writer := strconv.FormatInt(writers.Inc(), 10)
+		wreq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, numSeries)}
+		for i := range wreq.Timeseries {
+			wreq.Timeseries[i] = prompb.TimeSeries{
+				Labels: []labelpb.ZLabel{
+					{Name: "__name__", Value: "metric"},
+					{Name: "instance", Value: fmt.Sprintf("instance-%d", i%100)},
+					{Name: "series", Value: strconv.Itoa(i)},
+					{Name: "writer", Value: writer},
+				},
+				Samples: []prompb.Sample{{}},
+			}
+		}
+
+		for i := 0; pb.Next(); i++ {
+			for j := range wreq.Timeseries {
+				wreq.Timeseries[j].Samples[0] = prompb.Sample{Value: float64(i), Timestamp: int64(i)}
+			}
+			testutil.Ok(b, w.Write(context.Background(), DefaultTenant, wreq))
+		}
+	})
+}
+
+func newTestWriterMultiTSDB(t testing.TB) *MultiTSDB {
+	m := NewMultiTSDB(t.TempDir(), log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+	)
+	t.Cleanup(func() { testutil.Ok(t, m.Close()) })
+
+	testutil.Ok(t, m.Flush())
+	testutil.Ok(t, m.Open())
+
+	app, err := m.TenantAppendable(DefaultTenant)
+	testutil.Ok(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+		_, err = app.Appender(context.Background())
+		return err
+	}))
+	return m
+}
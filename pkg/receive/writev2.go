@@ -0,0 +1,201 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+)
+
+// Remote Write protocol versions, as defined by the proto message used on the wire.
+const (
+	remoteWriteV1Proto = "prometheus.WriteRequest"
+	remoteWriteV2Proto = "io.prometheus.write.v2.Request"
+
+	remoteWriteVersionHeader = "X-Prometheus-Remote-Write-Version"
+	remoteWriteV2Version     = "2.0.0"
+
+	remoteWriteSamplesWrittenHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	remoteWriteHistogramsWrittenHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	remoteWriteExemplarsWrittenHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+
+	protobufContentType = "application/x-protobuf"
+)
+
+// remoteWriteAcceptedContentTypes is sent back to clients using an unsupported protocol.
+var remoteWriteAcceptedContentTypes = strings.Join([]string{
+	protobufContentType + ";proto=" + remoteWriteV1Proto,
+	protobufContentType + ";proto=" + remoteWriteV2Proto,
+}, ", ")
+
+var (
+	errUnsupportedRemoteWriteProto = errors.New("unsupported remote write protocol")
+
+	// errNativeHistograms is returned for Remote Write 2.0 requests containing native histograms, which cannot be stored yet.
+	errNativeHistograms = errors.New("native histograms are not supported; histogram samples were not written")
+)
+
+// remoteWriteProto returns the proto message of the remote write request with the given headers.
+// Requests without a content type or proto parameter are Remote Write 1.0 requests, unless the
+// version header says otherwise.
+func remoteWriteProto(contentType, version string) (string, error) {
+	if contentType == "" {
+		contentType = protobufContentType
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errors.Wrapf(errUnsupportedRemoteWriteProto, "parse content type %q: %v", contentType, err)
+	}
+	if mediaType != protobufContentType {
+		return "", errors.Wrapf(errUnsupportedRemoteWriteProto, "content type %q", contentType)
+	}
+
+	proto, ok := params["proto"]
+	if !ok {
+		if strings.HasPrefix(version, "2.") {
+			return remoteWriteV2Proto, nil
+		}
+		return remoteWriteV1Proto, nil
+	}
+	switch proto {
+	case remoteWriteV1Proto, remoteWriteV2Proto:
+		return proto, nil
+	default:
+		return "", errors.Wrapf(errUnsupportedRemoteWriteProto, "proto %q", proto)
+	}
+}
+
+// writeV2Stats counts what a Remote Write 2.0 request contains.
+type writeV2Stats struct {
+	samples, histograms, exemplars int
+}
+
+// fromWriteV2 converts a Remote Write 2.0 request into the Remote Write 1.0 one used by the write path.
+// Native histograms are not supported by the write path and are only counted.
+// Created timestamps are validated, but not ingested.
+func fromWriteV2(req *writev2pb.Request) (*prompb.WriteRequest, writeV2Stats, error) {
+	var (
+		stats    writeV2Stats
+		wreq     = &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(req.Timeseries))}
+		metadata = map[string]struct{}{}
+	)
+	if len(req.Symbols) > 0 && req.Symbols[0] != "" {
+		return nil, stats, errors.New("first symbol has to be an empty string")
+	}
+
+	for i, ts := range req.Timeseries {
+		lbls, err := writev2pb.DesymbolizeLabels(ts.LabelsRefs, req.Symbols)
+		if err != nil {
+			return nil, stats, errors.Wrapf(err, "labels of series %d", i)
+		}
+		if len(ts.Samples) > 0 && len(ts.Histograms) > 0 {
+			return nil, stats, errors.Errorf("series %d contains both samples and histograms", i)
+		}
+		if ts.CreatedTimestamp < 0 {
+			return nil, stats, errors.Errorf("series %d has negative created timestamp %d", i, ts.CreatedTimestamp)
+		}
+		stats.histograms += len(ts.Histograms)
+		if len(ts.Samples) == 0 && len(ts.Exemplars) == 0 {
+			// Nothing the write path could ingest.
+			continue
+		}
+
+		v1 := prompb.TimeSeries{
+			Labels:  lbls,
+			Samples: make([]prompb.Sample, 0, len(ts.Samples)),
+		}
+		for _, s := range ts.Samples {
+			v1.Samples = append(v1.Samples, prompb.Sample{Value: s.Value, Timestamp: s.Timestamp})
+		}
+		if len(ts.Exemplars) > 0 {
+			v1.Exemplars = make([]prompb.Exemplar, 0, len(ts.Exemplars))
+			for _, e := range ts.Exemplars {
+				exLbls, err := writev2pb.DesymbolizeLabels(e.LabelsRefs, req.Symbols)
+				if err != nil {
+					return nil, stats, errors.Wrapf(err, "exemplar labels of series %d", i)
+				}
+				v1.Exemplars = append(v1.Exemplars, prompb.Exemplar{Labels: exLbls, Value: e.Value, Timestamp: e.Timestamp})
+			}
+		}
+		stats.samples += len(v1.Samples)
+		stats.exemplars += len(v1.Exemplars)
+		wreq.Timeseries = append(wreq.Timeseries, v1)
+
+		if ts.Metadata.Type == writev2pb.Metadata_METRIC_TYPE_UNSPECIFIED && ts.Metadata.HelpRef == 0 && ts.Metadata.UnitRef == 0 {
+			continue
+		}
+		name := ""
+		for _, l := range lbls {
+			if l.Name == labels.MetricName {
+				name = l.Value
+				break
+			}
+		}
+		if _, ok := metadata[name]; ok {
+			continue
+		}
+		help, err := writev2pb.Symbol(req.Symbols, ts.Metadata.HelpRef)
+		if err != nil {
+			return nil, stats, errors.Wrapf(err, "metadata help of series %d", i)
+		}
+		unit, err := writev2pb.Symbol(req.Symbols, ts.Metadata.UnitRef)
+		if err != nil {
+			return nil, stats, errors.Wrapf(err, "metadata unit of series %d", i)
+		}
+		metadata[name] = struct{}{}
+		wreq.Metadata = append(wreq.Metadata, prompb.MetricMetadata{
+			// Both protocols use the same numbering of metric types.
+			Type:             prompb.MetricMetadata_MetricType(ts.Metadata.Type),
+			MetricFamilyName: name,
+			Help:             help,
+			Unit:             unit,
+		})
+	}
+	return wreq, stats, nil
+}
+
+// writeV2Response sets the headers telling a Remote Write 2.0 client what was written.
+func writeV2Response(w http.ResponseWriter, written writeV2Stats) {
+	w.Header().Set(remoteWriteSamplesWrittenHeader, strconv.Itoa(written.samples))
+	w.Header().Set(remoteWriteHistogramsWrittenHeader, strconv.Itoa(written.histograms))
+	w.Header().Set(remoteWriteExemplarsWrittenHeader, strconv.Itoa(written.exemplars))
+}
+
+// toWriteV2 encodes the given time series with the Remote Write 2.0 protocol.
+func toWriteV2(timeseries []prompb.TimeSeries) writev2pb.Request {
+	var (
+		symbols = writev2pb.NewSymbolTable()
+		req     = writev2pb.Request{Timeseries: make([]writev2pb.TimeSeries, 0, len(timeseries))}
+	)
+	for _, ts := range timeseries {
+		v2 := writev2pb.TimeSeries{
+			LabelsRefs: symbols.SymbolizeLabels(ts.Labels, make([]uint32, 0, 2*len(ts.Labels))),
+			Samples:    make([]writev2pb.Sample, 0, len(ts.Samples)),
+		}
+		for _, s := range ts.Samples {
+			v2.Samples = append(v2.Samples, writev2pb.Sample{Value: s.Value, Timestamp: s.Timestamp})
+		}
+		if len(ts.Exemplars) > 0 {
+			v2.Exemplars = make([]writev2pb.Exemplar, 0, len(ts.Exemplars))
+			for _, e := range ts.Exemplars {
+				v2.Exemplars = append(v2.Exemplars, writev2pb.Exemplar{
+					LabelsRefs: symbols.SymbolizeLabels(e.Labels, nil),
+					Value:      e.Value,
+					Timestamp:  e.Timestamp,
+				})
+			}
+		}
+		req.Timeseries = append(req.Timeseries, v2)
+	}
+	req.Symbols = symbols.Symbols()
+	return req
+}
@@ -0,0 +1,293 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRemoteWriteProto(t *testing.T) {
+	for _, tcase := range []struct {
+		contentType, version string
+
+		exp    string
+		expErr bool
+	}{
+		{exp: remoteWriteV1Proto},
+		{contentType: "application/x-protobuf", exp: remoteWriteV1Proto},
+		{contentType: "application/x-protobuf", version: "0.1.0", exp: remoteWriteV1Proto},
+		{contentType: "application/x-protobuf", version: "2.0.0", exp: remoteWriteV2Proto},
+		{contentType: "application/x-protobuf;proto=prometheus.WriteRequest", version: "2.0.0", exp: remoteWriteV1Proto},
+		{contentType: "application/x-protobuf; proto=io.prometheus.write.v2.Request", exp: remoteWriteV2Proto},
+		{contentType: "application/x-protobuf;proto=io.prometheus.write.v3.Request", expErr: true},
+		{contentType: "application/json", expErr: true},
+		{contentType: "application/x-protobuf;;", expErr: true},
+	} {
+		t.Run(tcase.contentType+" "+tcase.version, func(t *testing.T) {
+			got, err := remoteWriteProto(tcase.contentType, tcase.version)
+			if tcase.expErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.exp, got)
+		})
+	}
+}
+
+func TestWriteV2RoundTrip(t *testing.T) {
+	tss := []prompb.TimeSeries{
+		{
+			Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 2, Timestamp: 20}},
+		},
+		{
+			Labels:    []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "db"}},
+			Samples:   []prompb.Sample{{Value: 3, Timestamp: 10}},
+			Exemplars: []prompb.Exemplar{{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "api"}}, Value: 3, Timestamp: 10}},
+		},
+	}
+
+	req := toWriteV2(tss)
+	// Label names and values are only sent once.
+	testutil.Equals(t, []string{"", "__name__", "up", "job", "api", "db", "trace_id"}, req.Symbols)
+
+	got, stats, err := fromWriteV2(&req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, tss, got.Timeseries)
+	testutil.Equals(t, writeV2Stats{samples: 3, exemplars: 1}, stats)
+}
+
+func TestFromWriteV2(t *testing.T) {
+	t.Run("metadata", func(t *testing.T) {
+		symbols := writev2pb.NewSymbolTable()
+		lbls := symbols.SymbolizeLabels([]labelpb.ZLabel{{Name: "__name__", Value: "http_requests_total"}}, nil)
+		meta := writev2pb.Metadata{
+			Type:    writev2pb.Metadata_METRIC_TYPE_COUNTER,
+			HelpRef: symbols.Symbolize("Total HTTP requests."),
+			UnitRef: symbols.Symbolize("requests"),
+		}
+		req := &writev2pb.Request{
+			Symbols: symbols.Symbols(),
+			Timeseries: []writev2pb.TimeSeries{
+				{LabelsRefs: lbls, Samples: []writev2pb.Sample{{Value: 1, Timestamp: 1}}, Metadata: meta, CreatedTimestamp: 1},
+				{LabelsRefs: lbls, Samples: []writev2pb.Sample{{Value: 2, Timestamp: 2}}, Metadata: meta},
+			},
+		}
+
+		got, _, err := fromWriteV2(req)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []prompb.MetricMetadata{{
+			Type:             prompb.MetricMetadata_COUNTER,
+			MetricFamilyName: "http_requests_total",
+			Help:             "Total HTTP requests.",
+			Unit:             "requests",
+		}}, got.Metadata)
+	})
+	t.Run("histograms are only counted", func(t *testing.T) {
+		req := &writev2pb.Request{
+			Symbols: []string{"", "__name__", "latency"},
+			Timeseries: []writev2pb.TimeSeries{
+				{LabelsRefs: []uint32{1, 2}, Histograms: []writev2pb.Histogram{{Timestamp: 1}, {Timestamp: 2}}},
+			},
+		}
+		got, stats, err := fromWriteV2(req)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(got.Timeseries))
+		testutil.Equals(t, writeV2Stats{histograms: 2}, stats)
+	})
+	for _, tcase := range []struct {
+		name string
+		req  *writev2pb.Request
+	}{
+		{
+			name: "first symbol not empty",
+			req:  &writev2pb.Request{Symbols: []string{"a"}},
+		},
+		{
+			name: "odd label references",
+			req: &writev2pb.Request{
+				Symbols:    []string{"", "a"},
+				Timeseries: []writev2pb.TimeSeries{{LabelsRefs: []uint32{1}}},
+			},
+		},
+		{
+			name: "label reference out of range",
+			req: &writev2pb.Request{
+				Symbols:    []string{"", "a"},
+				Timeseries: []writev2pb.TimeSeries{{LabelsRefs: []uint32{1, 2}}},
+			},
+		},
+		{
+			name: "samples and histograms",
+			req: &writev2pb.Request{
+				Symbols: []string{"", "a"},
+				Timeseries: []writev2pb.TimeSeries{{
+					LabelsRefs: []uint32{1, 1},
+					Samples:    []writev2pb.Sample{{Value: 1, Timestamp: 1}},
+					Histograms: []writev2pb.Histogram{{Timestamp: 1}},
+				}},
+			},
+		},
+		{
+			name: "negative created timestamp",
+			req: &writev2pb.Request{
+				Symbols:    []string{"", "a"},
+				Timeseries: []writev2pb.TimeSeries{{LabelsRefs: []uint32{1, 1}, CreatedTimestamp: -1}},
+			},
+		},
+		{
+			name: "help reference out of range",
+			req: &writev2pb.Request{
+				Symbols: []string{"", "a"},
+				Timeseries: []writev2pb.TimeSeries{{
+					LabelsRefs: []uint32{1, 1},
+					Samples:    []writev2pb.Sample{{Value: 1, Timestamp: 1}},
+					Metadata:   writev2pb.Metadata{HelpRef: 5},
+				}},
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, _, err := fromWriteV2(tcase.req)
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+func makeRequestV2(h *Handler, tenant string, wreq *writev2pb.Request, contentType string) (*httptest.ResponseRecorder, error) {
+	buf, err := proto.Marshal(wreq)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", h.options.Endpoint, bytes.NewBuffer(snappy.Encode(nil, buf)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add(h.options.TenantHeader, tenant)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set(remoteWriteVersionHeader, remoteWriteV2Version)
+
+	rec := httptest.NewRecorder()
+	h.receiveHTTP(rec, req)
+	rec.Flush()
+	return rec, nil
+}
+
+func TestReceiveHTTP_RemoteWriteV2(t *testing.T) {
+	app := newFakeAppender(nil, nil, nil)
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{{appender: app}}, 1)
+	h := handlers[0]
+
+	req := toWriteV2([]prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}},
+	}})
+	contentType := protobufContentType + ";proto=" + remoteWriteV2Proto
+
+	rec, err := makeRequestV2(h, "test", &req, contentType)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "2", rec.Header().Get(remoteWriteSamplesWrittenHeader))
+	testutil.Equals(t, "0", rec.Header().Get(remoteWriteHistogramsWrittenHeader))
+	testutil.Equals(t, "0", rec.Header().Get(remoteWriteExemplarsWrittenHeader))
+	testutil.Equals(t, 2, len(app.Get(labels.FromStrings("foo", "bar"))))
+
+	t.Run("unsupported protocol", func(t *testing.T) {
+		rec, err := makeRequestV2(h, "test", &req, protobufContentType+";proto=io.prometheus.write.v3.Request")
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusUnsupportedMediaType, rec.Code)
+		testutil.Equals(t, remoteWriteAcceptedContentTypes, rec.Header().Get("Accept"))
+	})
+	t.Run("native histograms", func(t *testing.T) {
+		req := toWriteV2([]prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: "foo", Value: "baz"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}})
+		req.Timeseries = append(req.Timeseries, writev2pb.TimeSeries{
+			LabelsRefs: req.Timeseries[0].LabelsRefs,
+			Histograms: []writev2pb.Histogram{{Timestamp: 1}},
+		})
+
+		rec, err := makeRequestV2(h, "test", &req, contentType)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusBadRequest, rec.Code)
+		// Float samples are written nevertheless.
+		testutil.Equals(t, "1", rec.Header().Get(remoteWriteSamplesWrittenHeader))
+		testutil.Equals(t, "0", rec.Header().Get(remoteWriteHistogramsWrittenHeader))
+		testutil.Equals(t, 1, len(app.Get(labels.FromStrings("foo", "baz"))))
+	})
+}
+
+func TestReceiveForwardV2FallbackToV1(t *testing.T) {
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}},
+	}
+
+	for _, v1Only := range []bool{false, true} {
+		app := newFakeAppender(nil, nil, nil)
+		ingestor := NewHandler(nil, &Options{
+			TenantHeader:      DefaultTenantHeader,
+			ReplicaHeader:     DefaultReplicaHeader,
+			ReplicationFactor: 1,
+			ForwardTimeout:    5 * time.Second,
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: app})),
+		})
+		ingestor.Hashring(SingleNodeHashring(""))
+
+		addr := randomAddr()
+		peer := &fakeRemoteWriteGRPCServer{h: ingestor, v1Only: v1Only}
+		router := NewHandler(nil, &Options{
+			TenantHeader:      DefaultTenantHeader,
+			ReplicaHeader:     DefaultReplicaHeader,
+			ReplicationFactor: 1,
+			ForwardTimeout:    5 * time.Second,
+			ReceiverMode:      RouterOnly,
+		})
+		router.peers.cache[addr] = peer
+		router.Hashring(SingleNodeHashring(addr))
+
+		for i := 0; i < 2; i++ {
+			wreq.Timeseries[0].Samples[0].Timestamp = int64(i)
+			rec, err := makeRequest(router, "test", wreq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		testutil.Equals(t, 2, len(app.Get(labels.FromStrings("foo", "bar"))))
+
+		if v1Only {
+			// Remote Write 2.0 is only attempted once per peer.
+			testutil.Equals(t, 1, peer.v2Calls)
+			testutil.Equals(t, 2, peer.v1Calls)
+			continue
+		}
+		testutil.Equals(t, 2, peer.v2Calls)
+		testutil.Equals(t, 0, peer.v1Calls)
+
+		_, err := ingestor.RemoteWriteV2(context.Background(), &storepb.WriteRequestV2{
+			Request: writev2pb.Request{Symbols: []string{"", "a"}, Timeseries: []writev2pb.TimeSeries{{LabelsRefs: []uint32{1}}}},
+		})
+		testutil.NotOk(t, err)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// alertForStateMetricName is the name of the series Prometheus records the 'for' state of active alerts in.
+const alertForStateMetricName = "ALERTS_FOR_STATE"
+
+// AlertState is a snapshot of the 'for' state of the active alerts of a Manager. It holds the same information as the
+// latest samples of the ALERTS_FOR_STATE series, to restore the state without querying them from the storage.
+type AlertState struct {
+	// Timestamp of the snapshot in milliseconds.
+	Timestamp int64           `json:"timestamp"`
+	Alerts    []AlertForState `json:"alerts"`
+}
+
+// AlertForState is the 'for' state of an active alert.
+type AlertForState struct {
+	// Labels of the ALERTS_FOR_STATE series of the alert.
+	Labels labels.Labels `json:"labels"`
+	// ActiveAt is the Unix time in seconds the alert became active at, the value of its ALERTS_FOR_STATE series.
+	ActiveAt float64 `json:"active_at"`
+}
+
+// AlertState returns the 'for' state of the active alerts at the given time. It returns false until the state of all
+// alerting rules has been restored, as the state of those not restored yet would overwrite the state to restore.
+func (m *Manager) AlertState(ts time.Time) (*AlertState, bool) {
+	s := &AlertState{Timestamp: timestamp.FromTime(ts)}
+	for _, r := range m.mgrs {
+		for _, rule := range r.AlertingRules() {
+			if !rule.Restored() {
+				return nil, false
+			}
+			rule.ForEachActiveAlert(func(a *rules.Alert) {
+				// Same labels as the ALERTS_FOR_STATE series recorded by Prometheus.
+				lb := labels.NewBuilder(rule.Labels())
+				for _, l := range a.Labels {
+					lb.Set(l.Name, l.Value)
+				}
+				lb.Set(labels.MetricName, alertForStateMetricName)
+				lb.Set(labels.AlertName, rule.Name())
+
+				s.Alerts = append(s.Alerts, AlertForState{Labels: lb.Labels(), ActiveAt: float64(a.ActiveAt.Unix())})
+			})
+		}
+	}
+	return s, true
+}
+
+// Queryable returns a queryable of the ALERTS_FOR_STATE series of the snapshot, with a single sample at the time of
+// the snapshot, to restore the state of alerting rules from.
+func (s *AlertState) Queryable() storage.Queryable {
+	series := make([]storage.Series, 0, len(s.Alerts))
+	for _, a := range s.Alerts {
+		series = append(series, storage.NewListSeries(a.Labels, []tsdbutil.Sample{forStateSample{t: s.Timestamp, v: a.ActiveAt}}))
+	}
+	return storage.QueryableFunc(func(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+		if s.Timestamp < mint || s.Timestamp > maxt {
+			return &forStateQuerier{}, nil
+		}
+		return &forStateQuerier{series: series}, nil
+	})
+}
+
+// AlertStateStore persists snapshots of the state of alerts in an object of a bucket.
+type AlertStateStore struct {
+	bkt  objstore.Bucket
+	name string
+}
+
+// NewAlertStateStore returns an AlertStateStore persisting snapshots in the object with the given name.
+func NewAlertStateStore(bkt objstore.Bucket, name string) *AlertStateStore {
+	return &AlertStateStore{bkt: bkt, name: name}
+}
+
+// Save persists the snapshot, replacing the previous one.
+func (s *AlertStateStore) Save(ctx context.Context, state *AlertState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal alert state")
+	}
+	return errors.Wrapf(s.bkt.Upload(ctx, s.name, bytes.NewReader(b)), "upload alert state %s", s.name)
+}
+
+// Load returns the last persisted snapshot, nil if there is none.
+func (s *AlertStateStore) Load(ctx context.Context) (_ *AlertState, err error) {
+	r, err := s.bkt.Get(ctx, s.name)
+	if s.bkt.IsObjNotFoundErr(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get alert state %s", s.name)
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close alert state reader")
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read alert state %s", s.name)
+	}
+	state := &AlertState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal alert state %s", s.name)
+	}
+	return state, nil
+}
+
+// NewQueryForStateQueryable returns a queryable of the ALERTS_FOR_STATE series evaluated through the given query
+// function, to restore the state of alerting rules from when they are not stored locally, e.g. when they are remote
+// written. The series have a single sample, with the value and time of their latest sample in the queried time range.
+// The given labels, usually the external labels, are removed from the series, as they are not part of the state.
+func NewQueryForStateQueryable(queryFunc rules.QueryFunc, dropLabels []string) storage.Queryable {
+	return storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return &forStateQuerier{
+			ctx:        ctx,
+			queryFunc:  queryFunc,
+			dropLabels: dropLabels,
+			mint:       mint,
+			maxt:       maxt,
+		}, nil
+	})
+}
+
+// forStateQuerier selects ALERTS_FOR_STATE series from the given series, or through queryFunc if set.
+type forStateQuerier struct {
+	series []storage.Series
+
+	ctx        context.Context
+	queryFunc  rules.QueryFunc
+	dropLabels []string
+	mint, maxt int64
+}
+
+func (q *forStateQuerier) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	series := q.series
+	if q.queryFunc != nil {
+		var err error
+		if series, err = q.query(matchers); err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+	}
+
+	var matched []storage.Series
+	for _, s := range series {
+		if matchesAll(matchers, s.Labels()) {
+			matched = append(matched, s)
+		}
+	}
+	return &forStateSeriesSet{series: matched}
+}
+
+// query returns the series selected by the matchers with their latest sample in the time range of the querier.
+func (q *forStateQuerier) query(matchers []*labels.Matcher) ([]storage.Series, error) {
+	ts := timestamp.Time(q.maxt)
+	selector := (&parser.VectorSelector{LabelMatchers: matchers}).String()
+	rng := model.Duration(time.Duration(q.maxt-q.mint) * time.Millisecond).String()
+
+	values, err := q.queryFunc(q.ctx, fmt.Sprintf("last_over_time(%s[%s])", selector, rng), ts)
+	if err != nil {
+		return nil, errors.Wrap(err, "query values of ALERTS_FOR_STATE")
+	}
+	// timestamp() returns the time of the latest sample of each series within the lookback delta of each step.
+	times, err := q.queryFunc(q.ctx, fmt.Sprintf("max_over_time(timestamp(%s)[%s:])", selector, rng), ts)
+	if err != nil {
+		return nil, errors.Wrap(err, "query timestamps of ALERTS_FOR_STATE")
+	}
+
+	timesByLabels := make(map[uint64]float64, len(times))
+	for _, s := range times {
+		timesByLabels[q.stateLabels(s.Metric).Hash()] = s.V
+	}
+	series := make([]storage.Series, 0, len(values))
+	for _, s := range values {
+		lset := q.stateLabels(s.Metric)
+		t, ok := timesByLabels[lset.Hash()]
+		if !ok {
+			// The value without time would shift the restored state by the whole time range.
+			continue
+		}
+		series = append(series, storage.NewListSeries(lset, []tsdbutil.Sample{forStateSample{t: int64(math.Round(t * 1000)), v: s.V}}))
+	}
+	return series, nil
+}
+
+// stateLabels returns the labels of the ALERTS_FOR_STATE series of the query result with the given labels, which may
+// have lost its metric name.
+func (q *forStateQuerier) stateLabels(lset labels.Labels) labels.Labels {
+	lb := labels.NewBuilder(lset)
+	lb.Del(q.dropLabels...)
+	lb.Set(labels.MetricName, alertForStateMetricName)
+	return lb.Labels()
+}
+
+func (q *forStateQuerier) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+func (q *forStateQuerier) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+func (q *forStateQuerier) Close() error { return nil }
+
+func matchesAll(matchers []*labels.Matcher, lset labels.Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+type forStateSeriesSet struct {
+	series []storage.Series
+	cur    storage.Series
+}
+
+func (s *forStateSeriesSet) Next() bool {
+	if len(s.series) == 0 {
+		return false
+	}
+	s.cur, s.series = s.series[0], s.series[1:]
+	return true
+}
+
+func (s *forStateSeriesSet) At() storage.Series         { return s.cur }
+func (s *forStateSeriesSet) Err() error                 { return nil }
+func (s *forStateSeriesSet) Warnings() storage.Warnings { return nil }
+
+type forStateSample struct {
+	t int64
+	v float64
+}
+
+func (s forStateSample) T() int64   { return s.t }
+func (s forStateSample) V() float64 { return s.v }
@@ -0,0 +1,164 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestAlertState_RestoreAcrossRestart(t *testing.T) {
+	ruleFile := filepath.Join(t.TempDir(), "rules.yaml")
+	testutil.Ok(t, ioutil.WriteFile(ruleFile, []byte(`
+groups:
+- name: test
+  rules:
+  - alert: Down
+    expr: up == 0
+    for: 10m
+`), 0666))
+
+	// newManager returns a Manager with the alert of the rule file, as after a restart of the ruler.
+	newManager := func(queryable storage.Queryable) (*Manager, *rules.AlertingRule, *rules.Group) {
+		m := NewManager(
+			context.Background(),
+			nil,
+			t.TempDir(),
+			rules.ManagerOptions{
+				Logger:          log.NewNopLogger(),
+				Appendable:      nopAppendable{},
+				Queryable:       queryable,
+				NotifyFunc:      func(context.Context, string, ...*rules.Alert) {},
+				OutageTolerance: time.Hour,
+				ForGracePeriod:  time.Minute,
+			},
+			func(storepb.PartialResponseStrategy) rules.QueryFunc {
+				return func(_ context.Context, _ string, t time.Time) (promql.Vector, error) {
+					return promql.Vector{{Metric: labels.FromStrings("job", "a"), Point: promql.Point{T: t.UnixMilli(), V: 0}}}, nil
+				}
+			},
+			labels.FromStrings("replica", "1"),
+			"http://localhost",
+		)
+		testutil.Ok(t, m.Update(time.Minute, []string{ruleFile}))
+		t.Cleanup(func() {
+			m.Run()
+			m.Stop()
+		})
+
+		groups := m.RuleGroups()
+		testutil.Equals(t, 1, len(groups))
+		return m, groups[0].Rules()[0].(*rules.AlertingRule), groups[0].Group
+	}
+	activeAt := func(r *rules.AlertingRule) time.Time {
+		t.Helper()
+		alerts := r.ActiveAlerts()
+		testutil.Equals(t, 1, len(alerts))
+		return alerts[0].ActiveAt
+	}
+
+	ctx := context.Background()
+	t0 := time.Unix(1600000000, 0).UTC()
+	store := NewAlertStateStore(objstore.NewInMemBucket(), "alert-state.json")
+
+	// Nothing was persisted yet.
+	state, err := store.Load(ctx)
+	testutil.Ok(t, err)
+	testutil.Assert(t, state == nil)
+
+	m, rule, g := newManager(nopQueryable{})
+	g.Eval(ctx, t0)
+	// The state is not persisted until it has been restored, to not overwrite the state to restore.
+	_, ok := m.AlertState(t0)
+	testutil.Assert(t, !ok)
+	g.RestoreForState(t0)
+	g.Eval(ctx, t0.Add(5*time.Minute))
+	testutil.Equals(t, rules.StatePending, rule.State())
+	testutil.Equals(t, t0, activeAt(rule))
+
+	state, ok = m.AlertState(t0.Add(5 * time.Minute))
+	testutil.Assert(t, ok)
+	testutil.Equals(t, []AlertForState{{
+		Labels:   labels.FromStrings(labels.MetricName, "ALERTS_FOR_STATE", labels.AlertName, "Down", "job", "a"),
+		ActiveAt: float64(t0.Unix()),
+	}}, state.Alerts)
+	testutil.Ok(t, store.Save(ctx, state))
+
+	// Restart a minute after the snapshot, in the middle of the 'for' period.
+	state, err = store.Load(ctx)
+	testutil.Ok(t, err)
+	_, rule, g = newManager(state.Queryable())
+	g.Eval(ctx, t0.Add(6*time.Minute))
+	testutil.Equals(t, t0.Add(6*time.Minute), activeAt(rule))
+	g.RestoreForState(t0.Add(6 * time.Minute))
+
+	// The 5m spent pending before the restart are kept, the time the ruler was down is not counted.
+	testutil.Equals(t, t0.Add(time.Minute), activeAt(rule))
+	g.Eval(ctx, t0.Add(10*time.Minute))
+	testutil.Equals(t, rules.StatePending, rule.State())
+	g.Eval(ctx, t0.Add(11*time.Minute))
+	testutil.Equals(t, rules.StateFiring, rule.State())
+
+	// Without the state, the alert starts pending again.
+	_, rule, g = newManager((&AlertState{}).Queryable())
+	g.Eval(ctx, t0.Add(6*time.Minute))
+	g.RestoreForState(t0.Add(6 * time.Minute))
+	testutil.Equals(t, t0.Add(6*time.Minute), activeAt(rule))
+
+	// Snapshots older than the outage tolerance are not restored.
+	_, rule, g = newManager(state.Queryable())
+	g.Eval(ctx, t0.Add(2*time.Hour))
+	g.RestoreForState(t0.Add(2 * time.Hour))
+	testutil.Equals(t, t0.Add(2*time.Hour), activeAt(rule))
+}
+
+func TestQueryForStateQueryable(t *testing.T) {
+	var queries []string
+	q := NewQueryForStateQueryable(func(_ context.Context, q string, _ time.Time) (promql.Vector, error) {
+		queries = append(queries, q)
+		lset := labels.FromStrings(labels.AlertName, "Down", "job", "a", "replica", "1")
+		if strings.HasPrefix(q, "last_over_time(") {
+			return promql.Vector{{Metric: labels.NewBuilder(lset).Set(labels.MetricName, "ALERTS_FOR_STATE").Labels(), Point: promql.Point{V: 1000}}}, nil
+		}
+		// Functions of the timestamp query drop the metric name.
+		return promql.Vector{{Metric: lset, Point: promql.Point{V: 1300}}}, nil
+	}, []string{"replica"})
+
+	querier, err := q.Querier(context.Background(), 0, time.Hour.Milliseconds())
+	testutil.Ok(t, err)
+	ss := querier.Select(false, nil,
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "ALERTS_FOR_STATE"),
+		labels.MustNewMatcher(labels.MatchEqual, labels.AlertName, "Down"),
+		labels.MustNewMatcher(labels.MatchEqual, "job", "a"),
+	)
+	testutil.Assert(t, ss.Next())
+	testutil.Equals(t, labels.FromStrings(labels.MetricName, "ALERTS_FOR_STATE", labels.AlertName, "Down", "job", "a"), ss.At().Labels())
+	it := ss.At().Iterator()
+	testutil.Assert(t, it.Next())
+	ts, v := it.At()
+	testutil.Equals(t, int64(1300000), ts)
+	testutil.Equals(t, float64(1000), v)
+	testutil.Assert(t, !it.Next())
+	testutil.Assert(t, !ss.Next())
+	testutil.Ok(t, ss.Err())
+
+	testutil.Equals(t, []string{
+		`last_over_time({__name__="ALERTS_FOR_STATE",alertname="Down",job="a"}[1h])`,
+		`max_over_time(timestamp({__name__="ALERTS_FOR_STATE",alertname="Down",job="a"})[1h:])`,
+	}, queries)
+}
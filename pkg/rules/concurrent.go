@@ -0,0 +1,174 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+)
+
+// DefaultMaxConcurrentEvals is the default number of queries of rules evaluated concurrently across all rule groups
+// with concurrent evaluation enabled.
+const DefaultMaxConcurrentEvals = 4
+
+// concurrentGroup evaluates the queries of the rules of a group which don't depend on the series recorded by the
+// group concurrently. Prometheus evaluates the rules of a group sequentially, so the queries of all independent rules
+// are started on the first query of an evaluation, and their results are returned once the evaluation reaches them.
+// Queries of dependent rules are executed when the evaluation reaches them, after the rules before them recorded
+// their series, as without concurrent evaluation.
+type concurrentGroup struct {
+	// queries are the queries of the independent rules, as Prometheus executes them.
+	queries []string
+	gate    gate.Gate
+
+	mtx     sync.Mutex
+	ts      time.Time
+	pending map[string][]*pendingQuery
+}
+
+type pendingQuery struct {
+	done   chan struct{}
+	vector promql.Vector
+	err    error
+}
+
+// newConcurrentGroup returns the concurrentGroup of the given rules, evaluating their queries through the gate.
+// Rules whose expression can't be parsed are considered dependent, as Prometheus fails to load them anyway.
+func newConcurrentGroup(rs []rulefmt.RuleNode, g gate.Gate) *concurrentGroup {
+	var recorded []string
+	hasAlerts := false
+	for _, r := range rs {
+		if r.Record.Value != "" {
+			recorded = append(recorded, r.Record.Value)
+		} else {
+			hasAlerts = true
+		}
+	}
+	// Alerting rules record their state in these series.
+	if hasAlerts {
+		recorded = append(recorded, "ALERTS", "ALERTS_FOR_STATE")
+	}
+
+	cg := &concurrentGroup{gate: g}
+	for _, r := range rs {
+		expr, err := parser.ParseExpr(r.Expr.Value)
+		if err != nil || dependsOn(expr, recorded) {
+			continue
+		}
+		cg.queries = append(cg.queries, expr.String())
+	}
+	return cg
+}
+
+// dependsOn returns true if the expression selects series of one of the given metric names. Selectors without
+// metric name matchers are assumed to select series of all of them.
+func dependsOn(expr parser.Expr, names []string) bool {
+	depends := false
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok || depends {
+			return nil
+		}
+		for _, name := range names {
+			if matchesName(vs.LabelMatchers, name) {
+				depends = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return depends
+}
+
+func matchesName(ms []*labels.Matcher, name string) bool {
+	for _, m := range ms {
+		if m.Name == labels.MetricName && !m.Matches(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// query returns the result of the query at the given time. The queries of the independent rules are started with next
+// on the first query of each evaluation, i.e. of each evaluation time.
+func (g *concurrentGroup) query(ctx context.Context, q string, t time.Time, next rules.QueryFunc) (promql.Vector, error) {
+	g.mtx.Lock()
+	if !t.Equal(g.ts) {
+		g.ts = t
+		g.pending = make(map[string][]*pendingQuery, len(g.queries))
+		for _, q := range g.queries {
+			p := &pendingQuery{done: make(chan struct{})}
+			g.pending[q] = append(g.pending[q], p)
+			go g.start(ctx, p, q, t, next)
+		}
+	}
+	ps := g.pending[q]
+	if len(ps) == 0 {
+		g.mtx.Unlock()
+		return next(ctx, q, t)
+	}
+	p := ps[0]
+	g.pending[q] = ps[1:]
+	g.mtx.Unlock()
+
+	select {
+	case <-p.done:
+		return p.vector, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *concurrentGroup) start(ctx context.Context, p *pendingQuery, q string, t time.Time, next rules.QueryFunc) {
+	defer close(p.done)
+
+	if p.err = g.gate.Start(ctx); p.err != nil {
+		return
+	}
+	defer g.gate.Done()
+	p.vector, p.err = next(ctx, q, t)
+}
+
+// groupKeyFromContext returns the key of the rule group whose evaluation the context belongs to, if any.
+func groupKeyFromContext(ctx context.Context) (string, bool) {
+	origin, _ := ctx.Value(promql.QueryOrigin{}).(map[string]interface{})
+	group, _ := origin["ruleGroup"].(map[string]string)
+	if group == nil {
+		return "", false
+	}
+	return rules.GroupKey(group["file"], group["name"]), true
+}
+
+// queryFunc returns the query function evaluating the queries of rule groups with concurrent evaluation enabled
+// through their concurrentGroup, and the other ones with next. The source tenants of the groups are passed to next
+// through the context.
+func (m *Manager) queryFunc(next rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		key, ok := groupKeyFromContext(ctx)
+		if !ok {
+			return next(ctx, q, t)
+		}
+
+		m.concurrentMtx.RLock()
+		g, tenants := m.concurrentGroups[key], m.groupTenants[key]
+		m.concurrentMtx.RUnlock()
+
+		if len(tenants.source) > 0 {
+			ctx = context.WithValue(ctx, sourceTenantsKey{}, tenants.source)
+		}
+		if g != nil {
+			return g.query(ctx, q, t, next)
+		}
+		return next(ctx, q, t)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"gopkg.in/yaml.v3"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNewConcurrentGroup(t *testing.T) {
+	var g rulefmt.RuleGroup
+	testutil.Ok(t, yaml.Unmarshal([]byte(`
+name: test
+rules:
+- record: a
+  expr: sum(up)
+- record: b
+  expr: a * 2
+- record: c
+  expr: count({job="test"})
+- record: d
+  expr: rate(foo_total[5m])
+- record: e
+  expr: count(ALERTS)
+- record: f
+  expr: '{__name__=~"b|z"}'
+- record: g
+  expr: '{__name__=~"foo.*"}'
+- alert: h
+  expr: max_over_time(d[1h:5m]) > 1
+- alert: i
+  expr: bar > 1
+`), &g))
+
+	cg := newConcurrentGroup(g.Rules, gate.NewNoop())
+	testutil.Equals(t, []string{"sum(up)", "rate(foo_total[5m])", `{__name__=~"foo.*"}`, "bar > 1"}, cg.queries)
+}
+
+func TestConcurrentGroup_Query(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		mtx     sync.Mutex
+		queries []string
+		started = make(chan string, 10)
+		release = make(chan struct{})
+	)
+	next := func(_ context.Context, q string, _ time.Time) (promql.Vector, error) {
+		mtx.Lock()
+		queries = append(queries, q)
+		mtx.Unlock()
+
+		started <- q
+		if q == "b" {
+			<-release
+			return nil, errors.New("b failed")
+		}
+		return promql.Vector{{Point: promql.Point{V: float64(len(q))}}}, nil
+	}
+	cg := &concurrentGroup{queries: []string{"a", "b"}, gate: gate.NewNoop()}
+
+	for _, ts := range []time.Time{time.Unix(1, 0), time.Unix(2, 0)} {
+		mtx.Lock()
+		queries = nil
+		mtx.Unlock()
+		release = make(chan struct{})
+
+		res, err := cg.query(ctx, "a", ts, next)
+		testutil.Ok(t, err)
+		testutil.Equals(t, promql.Vector{{Point: promql.Point{V: 1}}}, res)
+
+		// The query of b is started with the one of a, before the evaluation reaches it.
+		for i := 0; i < 2; i++ {
+			select {
+			case <-started:
+			case <-ctx.Done():
+				t.Fatal("timeout while waiting for queries of independent rules to start")
+			}
+		}
+		close(release)
+		_, err = cg.query(ctx, "b", ts, next)
+		testutil.NotOk(t, err)
+
+		// Other queries are executed when the evaluation reaches them.
+		res, err = cg.query(ctx, "ccc", ts, next)
+		testutil.Ok(t, err)
+		testutil.Equals(t, promql.Vector{{Point: promql.Point{V: 3}}}, res)
+		<-started
+
+		// Queries of independent rules are not executed again within an evaluation.
+		res, err = cg.query(ctx, "a", ts, next)
+		testutil.Ok(t, err)
+		testutil.Equals(t, promql.Vector{{Point: promql.Point{V: 1}}}, res)
+		<-started
+
+		mtx.Lock()
+		testutil.Equals(t, 4, len(queries))
+		mtx.Unlock()
+	}
+}
+
+func TestManager_ConcurrentEvaluation(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yaml")
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "concurrent"
+  concurrent_evaluation: true
+  rules:
+  - record: "a"
+    expr: "slow_a"
+  - record: "b"
+    expr: "slow_b"
+  - record: "c"
+    expr: "a + b"
+`), os.ModePerm))
+
+	var (
+		mtx     sync.Mutex
+		queries []string
+		slow    int
+		// The slow queries of the first evaluation block until both started, which only happens if they are
+		// evaluated concurrently.
+		slowStarted = make(chan struct{})
+	)
+	queryFuncCreator := func(storepb.PartialResponseStrategy) rules.QueryFunc {
+		return func(_ context.Context, q string, _ time.Time) (promql.Vector, error) {
+			mtx.Lock()
+			queries = append(queries, q)
+			if q == "slow_a" || q == "slow_b" {
+				if slow++; slow == 2 {
+					close(slowStarted)
+				}
+			}
+			mtx.Unlock()
+
+			if q == "slow_a" || q == "slow_b" {
+				select {
+				case <-slowStarted:
+				case <-time.After(5 * time.Second):
+					return nil, errors.Errorf("timeout while waiting for other slow query")
+				}
+			}
+			return nil, nil
+		}
+	}
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		prometheus.NewRegistry(),
+		dir,
+		rules.ManagerOptions{
+			Logger:     log.NewLogfmtLogger(os.Stderr),
+			Appendable: nopAppendable{},
+			Queryable:  nopQueryable{},
+		},
+		queryFuncCreator,
+		nil,
+		"http://localhost",
+		WithMaxConcurrentEvals(2),
+	)
+	thanosRuleMgr.Run()
+	t.Cleanup(thanosRuleMgr.Stop)
+	testutil.Ok(t, thanosRuleMgr.Update(time.Millisecond, []string{filename}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(queries) < 3 {
+			return errors.Errorf("expected 3 queries, got %v", queries)
+		}
+		return nil
+	}))
+	mtx.Lock()
+	defer mtx.Unlock()
+	// The dependent rule is evaluated last.
+	testutil.Equals(t, "a + b", queries[2])
+
+	for _, g := range thanosRuleMgr.RuleGroups() {
+		for _, r := range g.Rules() {
+			testutil.Ok(t, r.LastError())
+		}
+	}
+}
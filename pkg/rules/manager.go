@@ -25,6 +25,7 @@ import (
 
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -37,6 +38,12 @@ type Group struct {
 	*rules.Group
 	OriginalFile            string
 	PartialResponseStrategy storepb.PartialResponseStrategy
+	// QuerySource is the name of the query source the group is evaluated against, empty for the default one.
+	QuerySource string
+	// SourceTenants are the tenants the group queries, none for the tenant of the query endpoints.
+	SourceTenants []string
+	// DestinationTenant is the tenant the results of the group are written to, empty for the tenant of the ruler.
+	DestinationTenant string
 }
 
 func (g Group) toProto() *rulespb.RuleGroup {
@@ -46,6 +53,9 @@ func (g Group) toProto() *rulespb.RuleGroup {
 		Interval:                g.Interval().Seconds(),
 		Limit:                   int64(g.Limit()),
 		PartialResponseStrategy: g.PartialResponseStrategy,
+		QuerySource:             g.QuerySource,
+		SourceTenants:           g.SourceTenants,
+		DestinationTenant:       g.DestinationTenant,
 		// UTC needed due to https://github.com/gogo/protobuf/issues/519.
 		LastEvaluation:            g.GetLastEvaluation().UTC(),
 		EvaluationDurationSeconds: g.GetEvaluationTime().Seconds(),
@@ -110,16 +120,88 @@ func ActiveAlertsToProto(s storepb.PartialResponseStrategy, a *rules.AlertingRul
 	return ret
 }
 
+// managerKey identifies the rules manager evaluating the rule groups with the same partial response strategy and query source.
+type managerKey struct {
+	strategy    storepb.PartialResponseStrategy
+	querySource string
+}
+
 // Manager is a partial response strategy and proto compatible Manager.
 // Manager also implements rulespb.Rules gRPC service.
 type Manager struct {
 	workDir string
-	mgrs    map[storepb.PartialResponseStrategy]*rules.Manager
+	mgrs    map[managerKey]*rules.Manager
 	extLset labels.Labels
 
 	mtx         sync.RWMutex
 	ruleFiles   map[string]string
 	externalURL string
+
+	concurrentEvalGate gate.Gate
+	// concurrentMtx guards concurrentGroups and groupTenants. It is not mtx, as rule groups being stopped by an update
+	// still query them.
+	concurrentMtx sync.RWMutex
+	// concurrentGroups are the rule groups with concurrent evaluation enabled, by group key.
+	concurrentGroups map[string]*concurrentGroup
+	// groupTenants are the tenants of the rule groups with source or destination tenants, by group key.
+	groupTenants map[string]groupTenants
+
+	tenantLabel      string
+	allowCrossTenant bool
+}
+
+// QueryFuncCreator returns the function evaluating rule queries with the given partial response strategy.
+type QueryFuncCreator func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc
+
+// ManagerOption configures optional behaviour of the Manager.
+type ManagerOption func(*managerOptions)
+
+type managerOptions struct {
+	querySources       map[string]QueryFuncCreator
+	maxConcurrentEvals int
+	perRuleMetrics     bool
+	tenantLabel        string
+	allowCrossTenant   bool
+}
+
+// WithQuerySource makes the Manager evaluate rule groups with the given query_source using the given query functions
+// instead of the default ones.
+func WithQuerySource(name string, queryFuncCreator QueryFuncCreator) ManagerOption {
+	return func(o *managerOptions) {
+		o.querySources[name] = queryFuncCreator
+	}
+}
+
+// WithMaxConcurrentEvals limits the number of queries of rules evaluated concurrently across all rule groups with
+// concurrent evaluation enabled. It defaults to DefaultMaxConcurrentEvals.
+func WithMaxConcurrentEvals(n int) ManagerOption {
+	return func(o *managerOptions) {
+		o.maxConcurrentEvals = n
+	}
+}
+
+// WithPerRuleMetrics makes the Manager expose the duration, time and failure of the last evaluation of each rule as
+// metrics. Their number of series grows with the number of rules.
+func WithPerRuleMetrics() ManagerOption {
+	return func(o *managerOptions) {
+		o.perRuleMetrics = true
+	}
+}
+
+// WithTenantLabel sets the label the results of rule groups with a destination_tenant get, with the destination tenant
+// as value. Rule groups with a destination_tenant are rejected without it.
+func WithTenantLabel(name string) ManagerOption {
+	return func(o *managerOptions) {
+		o.tenantLabel = name
+	}
+}
+
+// WithCrossTenantGroups allows rule groups querying other tenants than the one their results are written to, e.g.
+// several source_tenants. They are rejected otherwise.
+func WithCrossTenantGroups() ManagerOption {
+	return func(o *managerOptions) {
+		o.allowCrossTenant = true
+	}
 }
 
 // NewManager creates new Manager.
@@ -129,26 +211,53 @@ func NewManager(
 	reg prometheus.Registerer,
 	dataDir string,
 	baseOpts rules.ManagerOptions,
-	queryFuncCreator func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc,
+	queryFuncCreator QueryFuncCreator,
 	extLset labels.Labels,
 	externalURL string,
+	options ...ManagerOption,
 ) *Manager {
+	o := managerOptions{querySources: map[string]QueryFuncCreator{}, maxConcurrentEvals: DefaultMaxConcurrentEvals}
+	for _, opt := range options {
+		opt(&o)
+	}
+
 	m := &Manager{
-		workDir:     filepath.Join(dataDir, tmpRuleDir),
-		mgrs:        make(map[storepb.PartialResponseStrategy]*rules.Manager),
-		extLset:     extLset,
-		ruleFiles:   make(map[string]string),
-		externalURL: externalURL,
+		workDir:            filepath.Join(dataDir, tmpRuleDir),
+		mgrs:               make(map[managerKey]*rules.Manager),
+		extLset:            extLset,
+		concurrentEvalGate: gate.New(extprom.WrapRegistererWithPrefix("thanos_rule_concurrent_evals_", reg), o.maxConcurrentEvals),
+		ruleFiles:          make(map[string]string),
+		externalURL:        externalURL,
+		concurrentGroups:   make(map[string]*concurrentGroup),
+		groupTenants:       make(map[string]groupTenants),
+		tenantLabel:        o.tenantLabel,
+		allowCrossTenant:   o.allowCrossTenant,
+	}
+	querySources := map[string]QueryFuncCreator{"": queryFuncCreator}
+	for name, c := range o.querySources {
+		querySources[name] = c
 	}
+
 	for _, strategy := range storepb.PartialResponseStrategy_value {
 		s := storepb.PartialResponseStrategy(strategy)
 
-		opts := baseOpts
-		opts.Registerer = extprom.WrapRegistererWith(prometheus.Labels{"strategy": strings.ToLower(s.String())}, reg)
-		opts.Context = ctx
-		opts.QueryFunc = queryFuncCreator(s)
+		for name, c := range querySources {
+			metricLabels := prometheus.Labels{"strategy": strings.ToLower(s.String())}
+			// Rule managers of all query sources register the same metrics, tell them apart only when there are some.
+			if len(o.querySources) > 0 {
+				metricLabels["query_source"] = name
+			}
+
+			opts := baseOpts
+			opts.Registerer = extprom.WrapRegistererWith(metricLabels, reg)
+			opts.Context = ctx
+			opts.QueryFunc = m.queryFunc(c(s))
 
-		m.mgrs[s] = rules.NewManager(&opts)
+			m.mgrs[managerKey{strategy: s, querySource: name}] = rules.NewManager(&opts)
+		}
+	}
+	if o.perRuleMetrics && reg != nil {
+		reg.MustRegister(ruleMetrics{m: m})
 	}
 
 	return m
@@ -179,13 +288,19 @@ func (m *Manager) protoRuleGroups() []*rulespb.RuleGroup {
 func (m *Manager) RuleGroups() []Group {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
+	m.concurrentMtx.RLock()
+	defer m.concurrentMtx.RUnlock()
 	var res []Group
-	for s, r := range m.mgrs {
+	for k, r := range m.mgrs {
 		for _, group := range r.RuleGroups() {
+			tenants := m.groupTenants[rules.GroupKey(group.File(), group.Name())]
 			res = append(res, Group{
 				Group:                   group,
 				OriginalFile:            m.ruleFiles[group.File()],
-				PartialResponseStrategy: s,
+				PartialResponseStrategy: k.strategy,
+				QuerySource:             k.querySource,
+				SourceTenants:           tenants.source,
+				DestinationTenant:       tenants.destination,
 			})
 		}
 	}
@@ -194,9 +309,9 @@ func (m *Manager) RuleGroups() []Group {
 
 func (m *Manager) Active() []*rulespb.AlertInstance {
 	var res []*rulespb.AlertInstance
-	for s, r := range m.mgrs {
+	for k, r := range m.mgrs {
 		for _, r := range r.AlertingRules() {
-			res = append(res, ActiveAlertsToProto(s, r)...)
+			res = append(res, ActiveAlertsToProto(k.strategy, r)...)
 		}
 	}
 	return res
@@ -204,6 +319,10 @@ func (m *Manager) Active() []*rulespb.AlertInstance {
 
 type configRuleAdapter struct {
 	PartialResponseStrategy *storepb.PartialResponseStrategy
+	QuerySource             string
+	ConcurrentEvaluation    bool
+	SourceTenants           []string
+	DestinationTenant       string
 
 	group           rulefmt.RuleGroup
 	nativeRuleGroup map[string]interface{}
@@ -211,8 +330,12 @@ type configRuleAdapter struct {
 
 func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	rs := struct {
-		RuleGroup rulefmt.RuleGroup `yaml:",inline"`
-		Strategy  string            `yaml:"partial_response_strategy"`
+		RuleGroup  rulefmt.RuleGroup `yaml:",inline"`
+		Strategy   string            `yaml:"partial_response_strategy"`
+		Source     string            `yaml:"query_source"`
+		Concurrent bool              `yaml:"concurrent_evaluation"`
+		Sources    []string          `yaml:"source_tenants"`
+		Dest       string            `yaml:"destination_tenant"`
 	}{}
 
 	if err := unmarshal(&rs); err != nil {
@@ -224,6 +347,10 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 	if err := g.PartialResponseStrategy.UnmarshalJSON([]byte("\"" + rs.Strategy + "\"")); err != nil {
 		return err
 	}
+	g.QuerySource = rs.Source
+	g.ConcurrentEvaluation = rs.Concurrent
+	g.SourceTenants = rs.Sources
+	g.DestinationTenant = rs.Dest
 	g.group = rs.RuleGroup
 
 	var native map[string]interface{}
@@ -231,6 +358,10 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 		return errors.Wrap(err, "failed to unmarshal rulefmt.configRuleAdapter")
 	}
 	delete(native, "partial_response_strategy")
+	delete(native, "query_source")
+	delete(native, "concurrent_evaluation")
+	delete(native, "source_tenants")
+	delete(native, "destination_tenant")
 
 	g.nativeRuleGroup = native
 	return nil
@@ -314,15 +445,17 @@ type configGroups struct {
 // special field in configGroups.configRuleAdapter struct.
 func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 	var (
-		errs            errutil.MultiError
-		filesByStrategy = map[storepb.PartialResponseStrategy][]string{}
-		ruleFiles       = map[string]string{}
+		errs             errutil.MultiError
+		filesByManager   = map[managerKey][]string{}
+		ruleFiles        = map[string]string{}
+		concurrentGroups = map[string]*concurrentGroup{}
+		tenantsByGroup   = map[string]groupTenants{}
 	)
 
-	// Initialize filesByStrategy for existing managers' strategies to make
+	// Initialize filesByManager for existing managers to make
 	// sure that managers are updated when they have no rules configured.
-	for strategy := range m.mgrs {
-		filesByStrategy[strategy] = make([]string, 0)
+	for k := range m.mgrs {
+		filesByManager[k] = make([]string, 0)
 	}
 
 	if err := os.RemoveAll(m.workDir); err != nil {
@@ -345,13 +478,26 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 			continue
 		}
 
-		// NOTE: This is very ugly, but we need to write those yaml into tmp dir without the partial partial response field
-		// which is not supported, to be able to reuse rules.Manager. The problem is that it uses yaml.UnmarshalStrict.
-		groupsByStrategy := map[storepb.PartialResponseStrategy][]configRuleAdapter{}
+		// NOTE: This is very ugly, but we need to write those yaml into tmp dir without the partial partial response,
+		// query source, concurrent evaluation and tenant fields which are not supported, to be able to reuse rules.Manager.
+		// The problem is that it uses yaml.UnmarshalStrict.
+		groupsByManager := map[managerKey][]configRuleAdapter{}
 		for _, rg := range rg.Groups {
-			groupsByStrategy[*rg.PartialResponseStrategy] = append(groupsByStrategy[*rg.PartialResponseStrategy], rg)
+			k := managerKey{strategy: *rg.PartialResponseStrategy, querySource: rg.QuerySource}
+			if _, ok := m.mgrs[k]; !ok {
+				errs.Add(errors.Errorf("%s: group %q: unknown query source %q", fn, rg.group.Name, rg.QuerySource))
+				continue
+			}
+			if err := rg.validateTenants(m.tenantLabel, m.allowCrossTenant); err != nil {
+				errs.Add(errors.Wrapf(err, "%s: group %q", fn, rg.group.Name))
+				continue
+			}
+			if rg.DestinationTenant != "" {
+				rg.setRuleLabel(m.tenantLabel, rg.DestinationTenant)
+			}
+			groupsByManager[k] = append(groupsByManager[k], rg)
 		}
-		for s, rg := range groupsByStrategy {
+		for k, rg := range groupsByManager {
 			b, err := yaml.Marshal(configGroups{Groups: rg})
 			if err != nil {
 				errs = append(errs, errors.Wrapf(err, "%s: failed to marshal rule groups", fn))
@@ -360,7 +506,10 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 
 			// Use full file name appending to work dir, so we can differentiate between different dirs and same filenames(!).
 			// This will be also used as key for file group name.
-			newFn := filepath.Join(m.workDir, s.String(), fn)
+			newFn := filepath.Join(m.workDir, k.strategy.String(), fn)
+			if k.querySource != "" {
+				newFn = filepath.Join(m.workDir, k.strategy.String(), "query-source-"+k.querySource, fn)
+			}
 			if err := os.MkdirAll(filepath.Dir(newFn), os.ModePerm); err != nil {
 				errs.Add(errors.Wrapf(err, "create %s", filepath.Dir(newFn)))
 				continue
@@ -369,28 +518,45 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 				errs.Add(errors.Wrapf(err, "write file %v", newFn))
 				continue
 			}
-			filesByStrategy[s] = append(filesByStrategy[s], newFn)
+			filesByManager[k] = append(filesByManager[k], newFn)
 			ruleFiles[newFn] = fn
+			for _, g := range rg {
+				if g.ConcurrentEvaluation {
+					concurrentGroups[rules.GroupKey(newFn, g.group.Name)] = newConcurrentGroup(g.group.Rules, m.concurrentEvalGate)
+				}
+				if len(g.SourceTenants) > 0 || g.DestinationTenant != "" {
+					tenantsByGroup[rules.GroupKey(newFn, g.group.Name)] = g.tenants()
+				}
+			}
 		}
 	}
 
 	m.mtx.Lock()
-	for s, fs := range filesByStrategy {
-		mgr, ok := m.mgrs[s]
+	for k, fs := range filesByManager {
+		mgr, ok := m.mgrs[k]
 		if !ok {
-			errs.Add(errors.Errorf("no manager found for %v", s))
+			errs.Add(errors.Errorf("no manager found for %v", k.strategy))
 			continue
 		}
 		// We add external labels in `pkg/alert.Queue`.
 		if err := mgr.Update(evalInterval, fs, m.extLset, m.externalURL, nil); err != nil {
 			// TODO(bwplotka): Prometheus logs all error details. Fix it upstream to have consistent error handling.
-			errs.Add(errors.Wrapf(err, "strategy %s, update rules", s))
+			if k.querySource != "" {
+				errs.Add(errors.Wrapf(err, "strategy %s, query source %s, update rules", k.strategy, k.querySource))
+				continue
+			}
+			errs.Add(errors.Wrapf(err, "strategy %s, update rules", k.strategy))
 			continue
 		}
 	}
 	m.ruleFiles = ruleFiles
 	m.mtx.Unlock()
 
+	m.concurrentMtx.Lock()
+	m.concurrentGroups = concurrentGroups
+	m.groupTenants = tenantsByGroup
+	m.concurrentMtx.Unlock()
+
 	return errs.Err()
 }
 
@@ -26,6 +26,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
@@ -303,7 +304,10 @@ func TestConfigRuleAdapterUnmarshalMarshalYAML(t *testing.T) {
   - alert: some
     expr: rate(some_metric[1h:5m] offset 1d)
   partial_response_strategy: WARN
+  concurrent_evaluation: true
 `), &c))
+	testutil.Equals(t, false, c.Groups[0].ConcurrentEvaluation)
+	testutil.Equals(t, true, c.Groups[1].ConcurrentEvaluation)
 	b, err := yaml.Marshal(c)
 	testutil.Ok(t, err)
 	testutil.Equals(t, `groups:
@@ -458,3 +462,298 @@ groups:
 	}))
 	testutil.Equals(t, "exceeded limit of 1 with 2 alerts", thanosRuleMgr.protoRuleGroups()[0].Rules[0].GetAlert().LastError)
 }
+
+func TestManager_QuerySources(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yaml")
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "default source"
+  rules:
+  - record: "default"
+    expr: "default_metric"
+- name: "frontend source"
+  query_source: "frontend"
+  partial_response_strategy: "warn"
+  rules:
+  - record: "frontend"
+    expr: "frontend_metric"
+`), os.ModePerm))
+
+	var (
+		mtx     sync.Mutex
+		queries = map[string][]string{}
+	)
+	queryFuncCreator := func(source string) QueryFuncCreator {
+		return func(storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(_ context.Context, q string, _ time.Time) (promql.Vector, error) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				queries[source] = append(queries[source], q)
+				return nil, nil
+			}
+		}
+	}
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		prometheus.NewRegistry(),
+		dir,
+		rules.ManagerOptions{
+			Logger:     log.NewLogfmtLogger(os.Stderr),
+			Appendable: nopAppendable{},
+			Queryable:  nopQueryable{},
+		},
+		queryFuncCreator("default"),
+		nil,
+		"http://localhost",
+		WithQuerySource("frontend", queryFuncCreator("frontend")),
+	)
+	thanosRuleMgr.Run()
+	t.Cleanup(thanosRuleMgr.Stop)
+	testutil.Ok(t, thanosRuleMgr.Update(time.Millisecond, []string{filename}))
+
+	groups := map[string]*rulespb.RuleGroup{}
+	for _, g := range thanosRuleMgr.protoRuleGroups() {
+		groups[g.Name] = g
+	}
+	testutil.Equals(t, 2, len(groups))
+	testutil.Equals(t, "", groups["default source"].QuerySource)
+	testutil.Equals(t, storepb.PartialResponseStrategy_ABORT, groups["default source"].PartialResponseStrategy)
+	testutil.Equals(t, "frontend", groups["frontend source"].QuerySource)
+	testutil.Equals(t, storepb.PartialResponseStrategy_WARN, groups["frontend source"].PartialResponseStrategy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(time.Millisecond, ctx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(queries["default"]) == 0 || len(queries["frontend"]) == 0 {
+			return errors.New("expected queries against both sources")
+		}
+		return nil
+	}))
+	mtx.Lock()
+	testutil.Equals(t, "default_metric", queries["default"][0])
+	testutil.Equals(t, "frontend_metric", queries["frontend"][0])
+	mtx.Unlock()
+
+	// Groups with unknown query sources are rejected.
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "unknown source"
+  query_source: "querier"
+  rules:
+  - record: "unknown"
+    expr: "up"
+`), os.ModePerm))
+	err := thanosRuleMgr.Update(time.Millisecond, []string{filename})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), `unknown query source "querier"`), err.Error())
+}
+
+func TestManager_PerRuleMetrics(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yaml")
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "test"
+  rules:
+  - record: "job:up"
+    expr: "up"
+  - record: "job:up"
+    expr: "failing"
+`), os.ModePerm))
+
+	reg := prometheus.NewRegistry()
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		reg,
+		dir,
+		rules.ManagerOptions{
+			Logger:     log.NewLogfmtLogger(os.Stderr),
+			Appendable: nopAppendable{},
+			Queryable:  nopQueryable{},
+		},
+		func(storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(_ context.Context, q string, _ time.Time) (promql.Vector, error) {
+				if q == "failing" {
+					return nil, errors.New("failed")
+				}
+				return nil, nil
+			}
+		},
+		nil,
+		"http://localhost",
+		WithPerRuleMetrics(),
+	)
+	thanosRuleMgr.Run()
+	t.Cleanup(thanosRuleMgr.Stop)
+	testutil.Ok(t, thanosRuleMgr.Update(time.Millisecond, []string{filename}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var failed map[string]float64
+	testutil.Ok(t, runutil.Retry(time.Millisecond, ctx.Done(), func() error {
+		mfs, err := reg.Gather()
+		if err != nil {
+			return err
+		}
+		failed = map[string]float64{}
+		evaluated := 0
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				lbls := map[string]string{}
+				for _, l := range m.GetLabel() {
+					lbls[l.GetName()] = l.GetValue()
+				}
+				switch mf.GetName() {
+				case "thanos_rule_last_evaluation_timestamp_seconds":
+					if m.GetGauge().GetValue() > 0 {
+						evaluated++
+					}
+				case "thanos_rule_last_evaluation_failed":
+					failed[lbls["rule_group"]+" "+lbls["rule"]+" "+lbls["index"]] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		if evaluated != 2 {
+			return errors.Errorf("expected 2 evaluated rules, got %d", evaluated)
+		}
+		return nil
+	}))
+	testutil.Equals(t, map[string]float64{
+		filename + ";test job:up 0": 0,
+		filename + ";test job:up 1": 1,
+	}, failed)
+}
+
+type recordingAppendable struct {
+	mtx    sync.Mutex
+	series []labels.Labels
+}
+
+func (r *recordingAppendable) Appender(_ context.Context) storage.Appender {
+	return &recordingAppender{nopAppender: nopAppender{}, r: r}
+}
+
+type recordingAppender struct {
+	nopAppender
+	r *recordingAppendable
+}
+
+func (a *recordingAppender) Append(ref storage.SeriesRef, l labels.Labels, _ int64, _ float64) (storage.SeriesRef, error) {
+	a.r.mtx.Lock()
+	defer a.r.mtx.Unlock()
+	a.r.series = append(a.r.series, l)
+	return ref, nil
+}
+
+func TestManager_Tenants(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yaml")
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "default tenant"
+  rules:
+  - record: "default"
+    expr: "default_metric"
+- name: "team-a"
+  source_tenants: ["team-a"]
+  destination_tenant: "team-a"
+  rules:
+  - record: "team_a"
+    expr: "team_a_metric"
+    labels:
+      severity: "none"
+`), os.ModePerm))
+
+	var (
+		mtx     sync.Mutex
+		tenants = map[string][]string{}
+	)
+	newManager := func(app storage.Appendable, opts ...ManagerOption) *Manager {
+		return NewManager(
+			context.Background(),
+			prometheus.NewRegistry(),
+			dir,
+			rules.ManagerOptions{
+				Logger:     log.NewLogfmtLogger(os.Stderr),
+				Appendable: app,
+				Queryable:  nopQueryable{},
+			},
+			func(storepb.PartialResponseStrategy) rules.QueryFunc {
+				return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+					mtx.Lock()
+					defer mtx.Unlock()
+					tenants[q] = SourceTenantsFromContext(ctx)
+					return promql.Vector{{Point: promql.Point{T: t.UnixMilli(), V: 1}, Metric: labels.FromStrings("job", "test")}}, nil
+				}
+			},
+			nil,
+			"http://localhost",
+			append([]ManagerOption{WithTenantLabel("tenant_id")}, opts...)...,
+		)
+	}
+	app := &recordingAppendable{}
+	thanosRuleMgr := newManager(app)
+	thanosRuleMgr.Run()
+	t.Cleanup(thanosRuleMgr.Stop)
+	testutil.Ok(t, thanosRuleMgr.Update(time.Millisecond, []string{filename}))
+
+	groups := map[string]*rulespb.RuleGroup{}
+	for _, g := range thanosRuleMgr.protoRuleGroups() {
+		groups[g.Name] = g
+	}
+	testutil.Equals(t, 2, len(groups))
+	testutil.Equals(t, 0, len(groups["default tenant"].SourceTenants))
+	testutil.Equals(t, "", groups["default tenant"].DestinationTenant)
+	testutil.Equals(t, []string{"team-a"}, groups["team-a"].SourceTenants)
+	testutil.Equals(t, "team-a", groups["team-a"].DestinationTenant)
+
+	// The queries of the groups get their source tenants, their results their destination tenant.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	results := map[string]labels.Labels{}
+	testutil.Ok(t, runutil.Retry(time.Millisecond, ctx.Done(), func() error {
+		app.mtx.Lock()
+		defer app.mtx.Unlock()
+		for _, l := range app.series {
+			results[l.Get(labels.MetricName)] = l
+		}
+		if len(results) != 2 {
+			return errors.Errorf("expected results of both groups, got %v", results)
+		}
+		return nil
+	}))
+	testutil.Equals(t, labels.FromStrings(labels.MetricName, "default", "job", "test"), results["default"])
+	testutil.Equals(t, labels.FromStrings(labels.MetricName, "team_a", "job", "test", "severity", "none", "tenant_id", "team-a"), results["team_a"])
+	mtx.Lock()
+	testutil.Equals(t, 0, len(tenants["default_metric"]))
+	testutil.Equals(t, []string{"team-a"}, tenants["team_a_metric"])
+	mtx.Unlock()
+
+	// Cross-tenant groups are rejected unless allowed.
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "cross tenant"
+  source_tenants: ["team-a", "team-b"]
+  destination_tenant: "team-c"
+  rules:
+  - record: "cross"
+    expr: "up"
+`), os.ModePerm))
+	err := thanosRuleMgr.Update(time.Millisecond, []string{filename})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "cross-tenant group"), err.Error())
+
+	crossTenantMgr := newManager(nopAppendable{}, WithCrossTenantGroups())
+	crossTenantMgr.Run()
+	t.Cleanup(crossTenantMgr.Stop)
+	testutil.Ok(t, crossTenantMgr.Update(time.Millisecond, []string{filename}))
+	groups = map[string]*rulespb.RuleGroup{}
+	for _, g := range crossTenantMgr.protoRuleGroups() {
+		groups[g.Name] = g
+	}
+	testutil.Equals(t, []string{"team-a", "team-b"}, groups["cross tenant"].SourceTenants)
+	testutil.Equals(t, "team-c", groups["cross tenant"].DestinationTenant)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Azure clouds supported by AzureADConfig.
+const (
+	AzurePublic     = "AzurePublic"
+	AzureChina      = "AzureChina"
+	AzureGovernment = "AzureGovernment"
+)
+
+// azureClouds are the token authorities and the remote write audiences of the Azure clouds.
+var azureClouds = map[string]struct{ authority, scope string }{
+	AzurePublic:     {authority: "https://login.microsoftonline.com/", scope: "https://monitor.azure.com//.default"},
+	AzureChina:      {authority: "https://login.chinacloudapi.cn/", scope: "https://monitor.azure.cn//.default"},
+	AzureGovernment: {authority: "https://login.microsoftonline.us/", scope: "https://monitor.azure.us//.default"},
+}
+
+// RemoteWriteConfigs are the remote write configurations of the stateless ruler.
+type RemoteWriteConfigs struct {
+	RemoteWriteConfigs []*RemoteWriteConfig `yaml:"remote_write,omitempty"`
+}
+
+// RemoteWriteConfig is a Prometheus remote write configuration, which can additionally authenticate to the remote
+// storage with Azure AD.
+type RemoteWriteConfig struct {
+	config.RemoteWriteConfig
+	AzureAD *AzureADConfig `yaml:"-"`
+}
+
+// AzureADConfig authenticates remote write requests with tokens of an Azure AD application, acquired with the OAuth2
+// client credentials flow.
+type AzureADConfig struct {
+	// Cloud is the Azure cloud of the application, AzurePublic by default.
+	Cloud           string                 `yaml:"cloud,omitempty"`
+	OAuth           *AzureOAuthConfig      `yaml:"oauth,omitempty"`
+	ManagedIdentity map[string]interface{} `yaml:"managed_identity,omitempty"`
+}
+
+// AzureOAuthConfig are the credentials of an Azure AD application.
+type AzureOAuthConfig struct {
+	ClientID         string             `yaml:"client_id"`
+	ClientSecret     config_util.Secret `yaml:"client_secret,omitempty"`
+	ClientSecretFile string             `yaml:"client_secret_file,omitempty"`
+	TenantID         string             `yaml:"tenant_id"`
+}
+
+// LoadRemoteWriteConfigs parses the remote write configurations of the YAML content. Azure AD authentication is
+// converted to the equivalent OAuth2 configuration, so that tokens are cached and refreshed before they expire like
+// for any OAuth2 configuration.
+func LoadRemoteWriteConfigs(confYAML []byte) ([]*config.RemoteWriteConfig, error) {
+	var conf RemoteWriteConfigs
+	if err := yaml.Unmarshal(confYAML, &conf); err != nil {
+		return nil, err
+	}
+	cfgs := make([]*config.RemoteWriteConfig, 0, len(conf.RemoteWriteConfigs))
+	for _, c := range conf.RemoteWriteConfigs {
+		cfgs = append(cfgs, &c.RemoteWriteConfig)
+	}
+	return cfgs, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *RemoteWriteConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.RemoteWriteConfig); err != nil {
+		return err
+	}
+	var azure struct {
+		AzureAD *AzureADConfig `yaml:"azuread,omitempty"`
+	}
+	if err := unmarshal(&azure); err != nil {
+		return err
+	}
+	c.AzureAD = azure.AzureAD
+	if c.AzureAD == nil {
+		return nil
+	}
+
+	hc := c.HTTPClientConfig
+	if hc.BasicAuth != nil || hc.Authorization != nil || hc.OAuth2 != nil || c.SigV4Config != nil {
+		return errors.New("at most one of basic_auth, authorization, oauth2, sigv4 & azuread must be configured")
+	}
+	oauth2, err := c.AzureAD.oauth2Config()
+	if err != nil {
+		return errors.Wrapf(err, "azuread of remote write to %s", c.URL)
+	}
+	c.HTTPClientConfig.OAuth2 = oauth2
+	return nil
+}
+
+// oauth2Config returns the OAuth2 client credentials configuration acquiring tokens of the application.
+func (c *AzureADConfig) oauth2Config() (*config_util.OAuth2, error) {
+	if c.ManagedIdentity != nil {
+		return nil, errors.New("managed identities are not supported, use the oauth credentials of an application")
+	}
+	if c.OAuth == nil {
+		return nil, errors.New("oauth credentials must be configured")
+	}
+	cloud := c.Cloud
+	if cloud == "" {
+		cloud = AzurePublic
+	}
+	az, ok := azureClouds[cloud]
+	if !ok {
+		return nil, errors.Errorf("unknown cloud %q, expected one of %s, %s or %s", cloud, AzurePublic, AzureChina, AzureGovernment)
+	}
+	if c.OAuth.ClientID == "" || c.OAuth.TenantID == "" {
+		return nil, errors.New("client_id and tenant_id must be configured")
+	}
+	if (c.OAuth.ClientSecret == "") == (c.OAuth.ClientSecretFile == "") {
+		return nil, errors.New("exactly one of client_secret & client_secret_file must be configured")
+	}
+	return &config_util.OAuth2{
+		ClientID:         c.OAuth.ClientID,
+		ClientSecret:     c.OAuth.ClientSecret,
+		ClientSecretFile: c.OAuth.ClientSecretFile,
+		Scopes:           []string{az.scope},
+		TokenURL:         az.authority + url.PathEscape(c.OAuth.TenantID) + "/oauth2/v2.0/token",
+	}, nil
+}
@@ -0,0 +1,282 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/storage/remote"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestLoadRemoteWriteConfigs(t *testing.T) {
+	for _, tcase := range []struct {
+		name   string
+		config string
+
+		expectedOAuth2 *config_util.OAuth2
+		expectedErr    string
+	}{
+		{
+			name: "without azuread",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  oauth2:
+    client_id: client
+    client_secret: secret
+    token_url: http://localhost:8081/token
+`,
+			expectedOAuth2: &config_util.OAuth2{ClientID: "client", ClientSecret: "secret", TokenURL: "http://localhost:8081/token"},
+		},
+		{
+			name: "azuread",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  azuread:
+    oauth:
+      client_id: client
+      client_secret: secret
+      tenant_id: tenant
+`,
+			expectedOAuth2: &config_util.OAuth2{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				Scopes:       []string{"https://monitor.azure.com//.default"},
+				TokenURL:     "https://login.microsoftonline.com/tenant/oauth2/v2.0/token",
+			},
+		},
+		{
+			name: "azuread in china cloud",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  azuread:
+    cloud: AzureChina
+    oauth:
+      client_id: client
+      client_secret_file: /etc/secret
+      tenant_id: tenant
+`,
+			expectedOAuth2: &config_util.OAuth2{
+				ClientID:         "client",
+				ClientSecretFile: "/etc/secret",
+				Scopes:           []string{"https://monitor.azure.cn//.default"},
+				TokenURL:         "https://login.chinacloudapi.cn/tenant/oauth2/v2.0/token",
+			},
+		},
+		{
+			name: "azuread with other authentication",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  bearer_token: token
+  azuread:
+    oauth:
+      client_id: client
+      client_secret: secret
+      tenant_id: tenant
+`,
+			expectedErr: "at most one of basic_auth, authorization, oauth2, sigv4 & azuread must be configured",
+		},
+		{
+			name: "azuread with unknown cloud",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  azuread:
+    cloud: AzureMoon
+    oauth:
+      client_id: client
+      client_secret: secret
+      tenant_id: tenant
+`,
+			expectedErr: `azuread of remote write to http://localhost:8080/api/v1/receive: unknown cloud "AzureMoon", expected one of AzurePublic, AzureChina or AzureGovernment`,
+		},
+		{
+			name: "azuread with managed identity",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  azuread:
+    managed_identity:
+      client_id: client
+`,
+			expectedErr: "azuread of remote write to http://localhost:8080/api/v1/receive: managed identities are not supported, use the oauth credentials of an application",
+		},
+		{
+			name: "azuread without secret",
+			config: `
+remote_write:
+- url: http://localhost:8080/api/v1/receive
+  azuread:
+    oauth:
+      client_id: client
+      tenant_id: tenant
+`,
+			expectedErr: "azuread of remote write to http://localhost:8080/api/v1/receive: exactly one of client_secret & client_secret_file must be configured",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			cfgs, err := LoadRemoteWriteConfigs([]byte(tcase.config))
+			if tcase.expectedErr != "" {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, tcase.expectedErr, err.Error())
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(cfgs))
+			testutil.Equals(t, tcase.expectedOAuth2, cfgs[0].HTTPClientConfig.OAuth2)
+			// Defaults of Prometheus remote write configurations still apply.
+			testutil.Equals(t, config.DefaultRemoteWriteConfig.QueueConfig, cfgs[0].QueueConfig)
+		})
+	}
+}
+
+func TestRemoteWriteAzureADTokens(t *testing.T) {
+	var (
+		mtx         sync.Mutex
+		tokens      int
+		expiresIn   = 3600
+		authHeaders []string
+	)
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Ok(t, r.ParseForm())
+		testutil.Equals(t, "client_credentials", r.PostForm.Get("grant_type"))
+		testutil.Equals(t, "https://monitor.azure.com//.default", r.PostForm.Get("scope"))
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d}`, tokens, expiresIn)
+	}))
+	defer tokenSrv.Close()
+	writeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+	}))
+	defer writeSrv.Close()
+
+	cfgs, err := LoadRemoteWriteConfigs([]byte(`
+remote_write:
+- url: ` + writeSrv.URL + `
+  azuread:
+    oauth:
+      client_id: client
+      client_secret: secret
+      tenant_id: tenant
+`))
+	testutil.Ok(t, err)
+	// Send token requests to the fake token endpoint instead of Azure AD.
+	testutil.Assert(t, strings.HasPrefix(cfgs[0].HTTPClientConfig.OAuth2.TokenURL, "https://login.microsoftonline.com/tenant/"))
+	cfgs[0].HTTPClientConfig.OAuth2.TokenURL = tokenSrv.URL
+
+	u, err := url.Parse(writeSrv.URL)
+	testutil.Ok(t, err)
+	client, err := remote.NewWriteClient("test", &remote.ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(10 * time.Second),
+		HTTPClientConfig: cfgs[0].HTTPClientConfig,
+	})
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	// Tokens are cached until they expire.
+	testutil.Ok(t, client.Store(ctx, []byte{}))
+	testutil.Ok(t, client.Store(ctx, []byte{}))
+	mtx.Lock()
+	testutil.Equals(t, 1, tokens)
+	testutil.Equals(t, []string{"Bearer token-1", "Bearer token-1"}, authHeaders)
+	expiresIn = 1
+	mtx.Unlock()
+
+	// Tokens are refreshed before they expire.
+	client, err = remote.NewWriteClient("test", &remote.ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(10 * time.Second),
+		HTTPClientConfig: cfgs[0].HTTPClientConfig,
+	})
+	testutil.Ok(t, err)
+	testutil.Ok(t, client.Store(ctx, []byte{}))
+	testutil.Ok(t, client.Store(ctx, []byte{}))
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Equals(t, 3, tokens)
+	testutil.Equals(t, []string{"Bearer token-1", "Bearer token-1", "Bearer token-2", "Bearer token-3"}, authHeaders)
+}
+
+func TestRemoteWriteAzureADTokens_Unauthorized(t *testing.T) {
+	var (
+		mtx         sync.Mutex
+		tokens      int
+		authHeaders []string
+	)
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": 3600}`, tokens)
+	}))
+	defer tokenSrv.Close()
+	writeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		if len(authHeaders) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer writeSrv.Close()
+
+	cfgs, err := LoadRemoteWriteConfigs([]byte(`
+remote_write:
+- url: ` + writeSrv.URL + `
+  azuread:
+    oauth:
+      client_id: client
+      client_secret: secret
+      tenant_id: tenant
+`))
+	testutil.Ok(t, err)
+	cfgs[0].HTTPClientConfig.OAuth2.TokenURL = tokenSrv.URL
+
+	u, err := url.Parse(writeSrv.URL)
+	testutil.Ok(t, err)
+	client, err := remote.NewWriteClient("test", &remote.ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(10 * time.Second),
+		HTTPClientConfig: cfgs[0].HTTPClientConfig,
+	})
+	testutil.Ok(t, err)
+
+	// Prometheus remote write neither retries requests rejected with 401, nor refreshes the token of the rejected
+	// request: the batch is dropped and the cached token is used until it expires.
+	ctx := context.Background()
+	err = client.Store(ctx, []byte{})
+	testutil.NotOk(t, err)
+	_, recoverable := err.(remote.RecoverableError)
+	testutil.Assert(t, !recoverable, "expected non recoverable error, got %v", err)
+	testutil.Ok(t, client.Store(ctx, []byte{}))
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Equals(t, 1, tokens)
+	testutil.Equals(t, []string{"Bearer token-1", "Bearer token-1"}, authHeaders)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/rules"
+)
+
+var (
+	ruleLabels = []string{"rule_group", "rule", "index"}
+
+	ruleLastDurationDesc = prometheus.NewDesc(
+		"thanos_rule_last_evaluation_duration_seconds",
+		"Duration of the last evaluation of the rule.",
+		ruleLabels, nil,
+	)
+	ruleLastEvaluationDesc = prometheus.NewDesc(
+		"thanos_rule_last_evaluation_timestamp_seconds",
+		"Timestamp of the last evaluation of the rule.",
+		ruleLabels, nil,
+	)
+	ruleLastFailedDesc = prometheus.NewDesc(
+		"thanos_rule_last_evaluation_failed",
+		"Whether the last evaluation of the rule failed.",
+		ruleLabels, nil,
+	)
+)
+
+// ruleMetrics exposes the state of the last evaluation of each rule of the manager. The rules are identified by their
+// group, i.e. the original file and name of the group, their name and their index in the group, as several rules of a
+// group can have the same name.
+type ruleMetrics struct {
+	m *Manager
+}
+
+func (r ruleMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ruleLastDurationDesc
+	ch <- ruleLastEvaluationDesc
+	ch <- ruleLastFailedDesc
+}
+
+func (r ruleMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, g := range r.m.RuleGroups() {
+		group := rules.GroupKey(g.OriginalFile, g.Name())
+		for i, rule := range g.Rules() {
+			lvs := []string{group, rule.Name(), strconv.Itoa(i)}
+
+			ch <- prometheus.MustNewConstMetric(ruleLastDurationDesc, prometheus.GaugeValue, rule.GetEvaluationDuration().Seconds(), lvs...)
+			var ts float64
+			if t := rule.GetEvaluationTimestamp(); !t.IsZero() {
+				ts = float64(t.UnixNano()) / 1e9
+			}
+			ch <- prometheus.MustNewConstMetric(ruleLastEvaluationDesc, prometheus.GaugeValue, ts, lvs...)
+			var failed float64
+			if rule.LastError() != nil {
+				failed = 1
+			}
+			ch <- prometheus.MustNewConstMetric(ruleLastFailedDesc, prometheus.GaugeValue, failed, lvs...)
+		}
+	}
+}
@@ -283,6 +283,12 @@ type RuleGroup struct {
 	Limit                     int64     `protobuf:"varint,9,opt,name=limit,proto3" json:"limit"`
 	// Thanos specific.
 	PartialResponseStrategy storepb.PartialResponseStrategy `protobuf:"varint,8,opt,name=PartialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partialResponseStrategy"`
+	// Name of the query source the group is evaluated against, empty for the default one.
+	QuerySource string `protobuf:"bytes,10,opt,name=query_source,json=querySource,proto3" json:"querySource,omitempty"`
+	// Tenants the group queries, empty for the tenant of the query endpoints.
+	SourceTenants []string `protobuf:"bytes,11,rep,name=source_tenants,json=sourceTenants,proto3" json:"sourceTenants,omitempty"`
+	// Tenant the results of the group are written to, empty for the tenant of the ruler.
+	DestinationTenant string `protobuf:"bytes,12,opt,name=destination_tenant,json=destinationTenant,proto3" json:"destinationTenant,omitempty"`
 }
 
 func (m *RuleGroup) Reset()         { *m = RuleGroup{} }
@@ -553,71 +559,76 @@ func init() {
 func init() { proto.RegisterFile("rules/rulespb/rpc.proto", fileDescriptor_91b1d28f30eb5efb) }
 
 var fileDescriptor_91b1d28f30eb5efb = []byte{
-	// 1022 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x56, 0x41, 0x4f, 0xe3, 0x46,
-	0x14, 0xb6, 0x71, 0xec, 0xc4, 0x2f, 0xc0, 0xd2, 0xd9, 0x45, 0x18, 0xb6, 0x8a, 0x51, 0x24, 0x2a,
-	0x5a, 0x75, 0x93, 0x0a, 0xb4, 0x5b, 0xed, 0xa9, 0xc2, 0x40, 0x17, 0x24, 0x44, 0x57, 0x13, 0xd4,
-	0xc3, 0xf6, 0x90, 0x0e, 0x61, 0x36, 0x58, 0x72, 0x6c, 0xef, 0xcc, 0x84, 0x8a, 0x1f, 0xd0, 0xfb,
-	0x9e, 0xfb, 0x47, 0xfa, 0x17, 0x38, 0xee, 0xb1, 0xa7, 0xb4, 0x85, 0x53, 0x73, 0xe8, 0x6f, 0xa8,
-	0x66, 0xc6, 0x8e, 0x43, 0x1a, 0xca, 0x6e, 0x9b, 0x5e, 0xfc, 0x66, 0xde, 0xfb, 0xde, 0x78, 0xe6,
-	0xbd, 0x6f, 0x3e, 0x1b, 0x56, 0x58, 0x3f, 0xa2, 0xbc, 0xa9, 0x9e, 0xe9, 0x69, 0x93, 0xa5, 0x9d,
-	0x46, 0xca, 0x12, 0x91, 0x20, 0x47, 0x9c, 0x93, 0x38, 0xe1, 0x6b, 0xab, 0x5c, 0x24, 0x8c, 0x36,
-	0xd5, 0x33, 0x3d, 0x6d, 0x8a, 0xcb, 0x94, 0x72, 0x0d, 0xc9, 0x43, 0x11, 0x39, 0xa5, 0xd1, 0x44,
-	0xe8, 0x51, 0x37, 0xe9, 0x26, 0x6a, 0xd8, 0x94, 0xa3, 0xcc, 0xeb, 0x77, 0x93, 0xa4, 0x1b, 0xd1,
-	0xa6, 0x9a, 0x9d, 0xf6, 0x5f, 0x37, 0x45, 0xd8, 0xa3, 0x5c, 0x90, 0x5e, 0xaa, 0x01, 0xf5, 0x3f,
-	0x4c, 0x98, 0xc7, 0x72, 0x2b, 0x98, 0xbe, 0xe9, 0x53, 0x2e, 0xd0, 0x13, 0x28, 0xc9, 0x65, 0x3d,
-	0x73, 0xdd, 0xdc, 0x5c, 0xdc, 0x5a, 0x6d, 0xe8, 0x4d, 0x35, 0xc6, 0x31, 0x8d, 0x93, 0xcb, 0x94,
-	0x62, 0x05, 0x43, 0xdf, 0xc1, 0x6a, 0x4a, 0x98, 0x08, 0x49, 0xd4, 0x66, 0x94, 0xa7, 0x49, 0xcc,
-	0x69, 0x9b, 0x0b, 0x46, 0x04, 0xed, 0x5e, 0x7a, 0x73, 0x6a, 0x0d, 0x3f, 0x5f, 0xe3, 0xa5, 0x06,
-	0xe2, 0x0c, 0xd7, 0xca, 0x60, 0x78, 0x25, 0x9d, 0x1e, 0x40, 0x1b, 0xb0, 0xd8, 0x23, 0xa2, 0x73,
-	0x4e, 0x99, 0x5c, 0x33, 0x8c, 0xbb, 0x9e, 0xb5, 0x6e, 0x6d, 0xba, 0x78, 0x21, 0xf3, 0xb6, 0x94,
-	0xb3, 0xfe, 0x09, 0x94, 0xe4, 0x8e, 0x50, 0x19, 0xac, 0x9d, 0xa3, 0xa3, 0x25, 0x03, 0xb9, 0x60,
-	0xef, 0x1c, 0xed, 0xe3, 0x93, 0x25, 0x13, 0x01, 0x38, 0x78, 0x7f, 0xf7, 0x1b, 0xbc, 0xb7, 0x34,
-	0x57, 0xff, 0x1e, 0x16, 0xb2, 0x63, 0xe8, 0xf7, 0xa0, 0x4f, 0xc1, 0xee, 0xb2, 0xa4, 0x9f, 0xaa,
-	0xc3, 0x56, 0xb7, 0x3e, 0x1a, 0x3f, 0xec, 0x0b, 0x19, 0x38, 0x30, 0xb0, 0x46, 0xa0, 0x35, 0x28,
-	0xff, 0x40, 0x58, 0x2c, 0xf7, 0x20, 0x4f, 0xe5, 0x1e, 0x18, 0x38, 0x77, 0x04, 0x15, 0x70, 0x18,
-	0xe5, 0xfd, 0x48, 0xd4, 0x77, 0x01, 0x46, 0xb9, 0x1c, 0x3d, 0x05, 0x47, 0x25, 0x73, 0xcf, 0x5c,
-	0xb7, 0xa6, 0xae, 0x1f, 0xc0, 0x70, 0xe0, 0x67, 0x20, 0x9c, 0xd9, 0xfa, 0x9f, 0x16, 0xb8, 0x23,
-	0x04, 0xfa, 0x18, 0x4a, 0x31, 0xe9, 0xe9, 0x7e, 0xb8, 0x41, 0x65, 0x38, 0xf0, 0xd5, 0x1c, 0xab,
-	0xa7, 0x8c, 0xbe, 0x0e, 0x23, 0xaa, 0xf7, 0xa4, 0xa3, 0x72, 0x8e, 0xd5, 0x13, 0x3d, 0x01, 0x5b,
-	0xd1, 0x4c, 0x95, 0xad, 0xba, 0x35, 0x3f, 0xfe, 0xfe, 0xc0, 0x1d, 0x0e, 0x7c, 0x1d, 0xc6, 0xda,
-	0xa0, 0x4d, 0xa8, 0x84, 0xb1, 0xa0, 0xec, 0x82, 0x44, 0x5e, 0x69, 0xdd, 0xdc, 0x34, 0x83, 0xf9,
-	0xe1, 0xc0, 0x1f, 0xf9, 0xf0, 0x68, 0x84, 0x30, 0x3c, 0xa6, 0x17, 0x24, 0xea, 0x13, 0x11, 0x26,
-	0x71, 0xfb, 0xac, 0xcf, 0xf4, 0x80, 0xd3, 0x4e, 0x12, 0x9f, 0x71, 0xcf, 0x56, 0xc9, 0x68, 0x38,
-	0xf0, 0x17, 0x0b, 0xd8, 0x49, 0xd8, 0xa3, 0x78, 0xb5, 0x98, 0xef, 0x65, 0x59, 0x2d, 0x9d, 0x84,
-	0xda, 0xf0, 0x20, 0x22, 0x5c, 0xb4, 0x0b, 0x84, 0xe7, 0xa8, 0xb6, 0xac, 0x35, 0x34, 0x89, 0x1b,
-	0x39, 0x89, 0x1b, 0x27, 0x39, 0x89, 0x83, 0xb5, 0xab, 0x81, 0x6f, 0xc8, 0xf7, 0xc8, 0xd4, 0xfd,
-	0x51, 0xe6, 0xdb, 0x5f, 0x7d, 0x13, 0x4f, 0xf8, 0x90, 0x0f, 0x76, 0x14, 0xf6, 0x42, 0xe1, 0xb9,
-	0xeb, 0xe6, 0xa6, 0xa5, 0xcf, 0xaf, 0x1c, 0x58, 0x1b, 0x74, 0x01, 0x2b, 0x77, 0x50, 0xd4, 0xab,
-	0xbc, 0x17, 0x93, 0x83, 0xc7, 0xc3, 0x81, 0x7f, 0x17, 0x9b, 0xf1, 0x5d, 0x8b, 0xd7, 0x63, 0x28,
-	0xc9, 0x8e, 0xa0, 0xa7, 0xe0, 0x32, 0xda, 0x49, 0xd8, 0x99, 0x64, 0x99, 0xa6, 0xe4, 0xf2, 0xa8,
-	0x65, 0x79, 0x40, 0x22, 0x0f, 0x0c, 0x5c, 0x20, 0xd1, 0x06, 0xd8, 0x24, 0xa2, 0x4c, 0x28, 0x12,
-	0x54, 0xb7, 0x16, 0xf2, 0x94, 0x1d, 0xe9, 0x94, 0x0c, 0x56, 0xd1, 0x31, 0x96, 0xfe, 0x6c, 0xc1,
-	0x82, 0x0a, 0x1e, 0xc6, 0x5c, 0x90, 0xb8, 0x43, 0xd1, 0x73, 0x70, 0x94, 0xa6, 0xf0, 0xc9, 0x9b,
-	0xf0, 0xea, 0x48, 0xba, 0x5b, 0x54, 0x04, 0x8b, 0x59, 0xa5, 0x33, 0x20, 0xce, 0x2c, 0x3a, 0x80,
-	0x2a, 0x89, 0xe3, 0x44, 0xa8, 0x1a, 0xf3, 0x6c, 0x0f, 0x53, 0xf2, 0x1f, 0x66, 0xf9, 0xe3, 0x68,
-	0x3c, 0x3e, 0x41, 0xdb, 0x60, 0x73, 0x41, 0x04, 0xf5, 0x2c, 0x55, 0x6c, 0x74, 0xeb, 0x1c, 0x2d,
-	0x19, 0xd1, 0x3d, 0x53, 0x20, 0xac, 0x0d, 0x6a, 0x81, 0x4b, 0x3a, 0x22, 0xbc, 0xa0, 0x6d, 0x22,
-	0x14, 0x69, 0xef, 0xe1, 0xcb, 0x70, 0xe0, 0x23, 0x9d, 0xb0, 0x23, 0x3e, 0x4f, 0x7a, 0xa1, 0xa0,
-	0xbd, 0x54, 0x5c, 0x2a, 0xbe, 0x54, 0x72, 0xbf, 0x64, 0x8a, 0xa4, 0x0d, 0x55, 0x44, 0x76, 0xf5,
-	0x5b, 0x95, 0x03, 0x6b, 0xf3, 0x4f, 0x4c, 0x71, 0xfe, 0x4f, 0xa6, 0xfc, 0x68, 0x83, 0xad, 0xca,
-	0x51, 0x14, 0xcb, 0xfc, 0x80, 0x62, 0xe5, 0x5a, 0x32, 0x37, 0x55, 0x4b, 0x7c, 0xb0, 0xdf, 0xf4,
-	0x29, 0xbb, 0x54, 0xf5, 0xcf, 0x4e, 0xad, 0x1c, 0x58, 0x1b, 0xf4, 0x25, 0x2c, 0xfd, 0xed, 0xaa,
-	0x8f, 0xe9, 0x44, 0x1e, 0xc3, 0x0f, 0xce, 0x26, 0xae, 0x76, 0x41, 0x2f, 0xfb, 0x3f, 0xd2, 0xcb,
-	0xf9, 0xf7, 0xf4, 0x7a, 0x0e, 0x8e, 0xba, 0x08, 0xdc, 0x2b, 0x2b, 0x35, 0x5c, 0xbe, 0x55, 0xb2,
-	0xfc, 0x2a, 0x68, 0x45, 0xd6, 0x40, 0x9c, 0x59, 0x54, 0x07, 0xe7, 0x9c, 0x92, 0x48, 0x9c, 0x2b,
-	0x1d, 0x70, 0x35, 0x46, 0x7b, 0x70, 0x66, 0xd1, 0x33, 0x00, 0x2d, 0x5f, 0x8c, 0x25, 0x4c, 0x49,
-	0x8c, 0x1b, 0xac, 0x0c, 0x07, 0xfe, 0x43, 0xa5, 0x42, 0xd2, 0x59, 0xd0, 0x0d, 0xbb, 0x23, 0xe7,
-	0x7d, 0x52, 0x0a, 0x33, 0x92, 0xd2, 0xea, 0x2c, 0xa5, 0xb4, 0xfe, 0x93, 0x05, 0x0b, 0xb7, 0x14,
-	0xe9, 0x9e, 0xcf, 0xd4, 0x88, 0x5a, 0x73, 0x77, 0x50, 0xab, 0x60, 0x88, 0xf5, 0xa1, 0x0c, 0x29,
-	0x9a, 0x53, 0x7a, 0xcf, 0xe6, 0xd8, 0xb3, 0x6a, 0x8e, 0x33, 0xa3, 0xe6, 0x94, 0x67, 0xd9, 0x9c,
-	0xcf, 0xb6, 0x01, 0x0a, 0x15, 0x40, 0xf3, 0x50, 0x39, 0x3c, 0xde, 0xd9, 0x3d, 0x39, 0xfc, 0x76,
-	0x7f, 0xc9, 0x40, 0x55, 0x28, 0xbf, 0xdc, 0x3f, 0xde, 0x3b, 0x3c, 0x7e, 0xa1, 0xff, 0x8d, 0xbe,
-	0x3e, 0xc4, 0x72, 0x3c, 0xb7, 0xf5, 0x15, 0xd8, 0xea, 0xdf, 0x08, 0x3d, 0xcb, 0x07, 0x8f, 0xa6,
-	0xfd, 0xfa, 0xad, 0x2d, 0x4f, 0x78, 0xb5, 0x40, 0x7d, 0x61, 0x06, 0x1b, 0x57, 0xbf, 0xd7, 0x8c,
-	0xab, 0xeb, 0x9a, 0xf9, 0xee, 0xba, 0x66, 0xfe, 0x76, 0x5d, 0x33, 0xdf, 0xde, 0xd4, 0x8c, 0x77,
-	0x37, 0x35, 0xe3, 0x97, 0x9b, 0x9a, 0xf1, 0xaa, 0x9c, 0xfd, 0xee, 0x9e, 0x3a, 0xea, 0x70, 0xdb,
-	0x7f, 0x05, 0x00, 0x00, 0xff, 0xff, 0x3c, 0x4a, 0xb5, 0xe4, 0x06, 0x0b, 0x00, 0x00,
+	// 1100 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x56, 0x41, 0x6f, 0xdb, 0xb6,
+	0x17, 0xb7, 0x2c, 0x4b, 0xb6, 0x9e, 0xed, 0x34, 0x65, 0x5b, 0x44, 0x49, 0xff, 0xb0, 0x0c, 0x03,
+	0xf9, 0x23, 0x1b, 0x56, 0x7b, 0x48, 0xd0, 0x0e, 0x05, 0x06, 0x0c, 0x51, 0x92, 0x35, 0x01, 0x82,
+	0xac, 0xa0, 0x8d, 0x1d, 0xba, 0x83, 0xa7, 0x38, 0xac, 0x23, 0x40, 0x96, 0x54, 0x92, 0xce, 0x90,
+	0x0f, 0xb0, 0x7b, 0xcf, 0xfb, 0x22, 0xbb, 0xee, 0x98, 0x63, 0x8f, 0x3b, 0x69, 0x5b, 0x72, 0x9a,
+	0x3f, 0xc5, 0x40, 0x52, 0xb2, 0x94, 0x34, 0x59, 0xda, 0x2d, 0xbb, 0x88, 0xe4, 0xef, 0xfd, 0x1e,
+	0xc5, 0xa7, 0xf7, 0x7b, 0x8f, 0x82, 0x25, 0x3a, 0x0d, 0x08, 0xeb, 0xc9, 0x67, 0x7c, 0xd8, 0xa3,
+	0xf1, 0xa8, 0x1b, 0xd3, 0x88, 0x47, 0xc8, 0xe4, 0xc7, 0x5e, 0x18, 0xb1, 0x95, 0x65, 0xc6, 0x23,
+	0x4a, 0x7a, 0xf2, 0x19, 0x1f, 0xf6, 0xf8, 0x69, 0x4c, 0x98, 0xa2, 0x64, 0xa6, 0xc0, 0x3b, 0x24,
+	0xc1, 0x15, 0xd3, 0xc3, 0x71, 0x34, 0x8e, 0xe4, 0xb4, 0x27, 0x66, 0x29, 0xea, 0x8c, 0xa3, 0x68,
+	0x1c, 0x90, 0x9e, 0x5c, 0x1d, 0x4e, 0x5f, 0xf7, 0xb8, 0x3f, 0x21, 0x8c, 0x7b, 0x93, 0x58, 0x11,
+	0x3a, 0x7f, 0x6a, 0xd0, 0xc0, 0xe2, 0x28, 0x98, 0xbc, 0x99, 0x12, 0xc6, 0xd1, 0x13, 0xa8, 0x88,
+	0x6d, 0x6d, 0xad, 0xad, 0xad, 0x2d, 0xac, 0x2f, 0x77, 0xd5, 0xa1, 0xba, 0x45, 0x4e, 0x77, 0x70,
+	0x1a, 0x13, 0x2c, 0x69, 0xe8, 0x3b, 0x58, 0x8e, 0x3d, 0xca, 0x7d, 0x2f, 0x18, 0x52, 0xc2, 0xe2,
+	0x28, 0x64, 0x64, 0xc8, 0x38, 0xf5, 0x38, 0x19, 0x9f, 0xda, 0x65, 0xb9, 0x87, 0x93, 0xed, 0xf1,
+	0x52, 0x11, 0x71, 0xca, 0xeb, 0xa7, 0x34, 0xbc, 0x14, 0x5f, 0x6f, 0x40, 0xab, 0xb0, 0x30, 0xf1,
+	0xf8, 0xe8, 0x98, 0x50, 0xb1, 0xa7, 0x1f, 0x8e, 0x6d, 0xbd, 0xad, 0xaf, 0x59, 0xb8, 0x99, 0xa2,
+	0x7d, 0x09, 0x76, 0xfe, 0x0f, 0x15, 0x71, 0x22, 0x54, 0x05, 0x7d, 0x73, 0x7f, 0x7f, 0xb1, 0x84,
+	0x2c, 0x30, 0x36, 0xf7, 0x77, 0xf0, 0x60, 0x51, 0x43, 0x00, 0x26, 0xde, 0xd9, 0xfa, 0x06, 0x6f,
+	0x2f, 0x96, 0x3b, 0xdf, 0x43, 0x33, 0x0d, 0x43, 0xbd, 0x07, 0x7d, 0x02, 0xc6, 0x98, 0x46, 0xd3,
+	0x58, 0x06, 0x5b, 0x5f, 0xbf, 0x5f, 0x0c, 0xf6, 0x85, 0x30, 0xec, 0x96, 0xb0, 0x62, 0xa0, 0x15,
+	0xa8, 0xfe, 0xe0, 0xd1, 0x50, 0x9c, 0x41, 0x44, 0x65, 0xed, 0x96, 0x70, 0x06, 0xb8, 0x35, 0x30,
+	0x29, 0x61, 0xd3, 0x80, 0x77, 0xb6, 0x00, 0xe6, 0xbe, 0x0c, 0x3d, 0x05, 0x53, 0x3a, 0x33, 0x5b,
+	0x6b, 0xeb, 0xd7, 0xee, 0xef, 0xc2, 0x2c, 0x71, 0x52, 0x12, 0x4e, 0xc7, 0xce, 0x2f, 0x06, 0x58,
+	0x73, 0x06, 0xfa, 0x1f, 0x54, 0x42, 0x6f, 0xa2, 0xf2, 0x61, 0xb9, 0xb5, 0x59, 0xe2, 0xc8, 0x35,
+	0x96, 0x4f, 0x61, 0x7d, 0xed, 0x07, 0xc4, 0x2e, 0xe7, 0x56, 0xb1, 0xc6, 0xf2, 0x89, 0x9e, 0x80,
+	0x21, 0x65, 0x26, 0x3f, 0x5b, 0x7d, 0xbd, 0x51, 0x7c, 0xbf, 0x6b, 0xcd, 0x12, 0x47, 0x99, 0xb1,
+	0x1a, 0xd0, 0x1a, 0xd4, 0xfc, 0x90, 0x13, 0x7a, 0xe2, 0x05, 0x76, 0xa5, 0xad, 0xad, 0x69, 0x6e,
+	0x63, 0x96, 0x38, 0x73, 0x0c, 0xcf, 0x67, 0x08, 0xc3, 0x63, 0x72, 0xe2, 0x05, 0x53, 0x8f, 0xfb,
+	0x51, 0x38, 0x3c, 0x9a, 0x52, 0x35, 0x61, 0x64, 0x14, 0x85, 0x47, 0xcc, 0x36, 0xa4, 0x33, 0x9a,
+	0x25, 0xce, 0x42, 0x4e, 0x1b, 0xf8, 0x13, 0x82, 0x97, 0xf3, 0xf5, 0x76, 0xea, 0xd5, 0x57, 0x4e,
+	0x68, 0x08, 0xf7, 0x02, 0x8f, 0xf1, 0x61, 0xce, 0xb0, 0x4d, 0x99, 0x96, 0x95, 0xae, 0x12, 0x71,
+	0x37, 0x13, 0x71, 0x77, 0x90, 0x89, 0xd8, 0x5d, 0x39, 0x4b, 0x9c, 0x92, 0x78, 0x8f, 0x70, 0xdd,
+	0x99, 0x7b, 0xbe, 0xfd, 0xcd, 0xd1, 0xf0, 0x15, 0x0c, 0x39, 0x60, 0x04, 0xfe, 0xc4, 0xe7, 0xb6,
+	0xd5, 0xd6, 0xd6, 0x74, 0x15, 0xbf, 0x04, 0xb0, 0x1a, 0xd0, 0x09, 0x2c, 0xdd, 0x20, 0x51, 0xbb,
+	0xf6, 0x41, 0x4a, 0x76, 0x1f, 0xcf, 0x12, 0xe7, 0x26, 0x35, 0xe3, 0x9b, 0x36, 0x47, 0x5f, 0x42,
+	0xe3, 0xcd, 0x94, 0xd0, 0xd3, 0x21, 0x8b, 0xa6, 0x74, 0x44, 0x6c, 0x90, 0xc9, 0x5c, 0x9e, 0x25,
+	0xce, 0x23, 0x89, 0xf7, 0x25, 0xfc, 0x59, 0x34, 0xf1, 0x39, 0x99, 0xc4, 0xfc, 0x14, 0xd7, 0x0b,
+	0x30, 0x72, 0x61, 0x41, 0xf9, 0x0d, 0x39, 0x09, 0xbd, 0x90, 0x33, 0xbb, 0x2e, 0x8a, 0x44, 0x9d,
+	0x45, 0x59, 0x06, 0xca, 0x50, 0xd8, 0xa1, 0x79, 0xc9, 0x80, 0x0e, 0x00, 0x1d, 0x11, 0xc6, 0xfd,
+	0x50, 0xe5, 0x51, 0x6d, 0x64, 0x37, 0xe4, 0x39, 0x9c, 0x59, 0xe2, 0x3c, 0x2e, 0x58, 0x95, 0x4f,
+	0x61, 0xaf, 0xfb, 0xef, 0x19, 0x3b, 0x21, 0x54, 0x84, 0xc6, 0xd0, 0x53, 0xb0, 0x28, 0x19, 0x45,
+	0xf4, 0x48, 0xd4, 0x8d, 0x2a, 0xb2, 0x47, 0x73, 0x11, 0x66, 0x06, 0xc1, 0xdc, 0x2d, 0xe1, 0x9c,
+	0x89, 0x56, 0xc1, 0xf0, 0x02, 0x42, 0xb9, 0x94, 0x75, 0x7d, 0xbd, 0x99, 0xb9, 0x6c, 0x0a, 0x50,
+	0xd4, 0xa4, 0xb4, 0x16, 0xea, 0xee, 0x67, 0x1d, 0x9a, 0xd2, 0xb8, 0x17, 0x32, 0xee, 0x85, 0x23,
+	0x82, 0x9e, 0x83, 0x29, 0xbb, 0x24, 0xbb, 0x5a, 0xdb, 0xaf, 0xf6, 0x05, 0xdc, 0x27, 0xdc, 0x5d,
+	0x48, 0xb5, 0x93, 0x12, 0x71, 0x3a, 0xa2, 0x5d, 0xa8, 0x7b, 0x61, 0x18, 0x71, 0x19, 0x10, 0xb3,
+	0xcb, 0x37, 0xf9, 0x3f, 0x48, 0xfd, 0x8b, 0x6c, 0x5c, 0x5c, 0xa0, 0x0d, 0x30, 0x18, 0xf7, 0x38,
+	0xb1, 0x75, 0x29, 0x1f, 0x74, 0x29, 0x8e, 0xbe, 0xb0, 0x28, 0x15, 0x4a, 0x12, 0x56, 0x03, 0xea,
+	0x83, 0xe5, 0x8d, 0xb8, 0x7f, 0x42, 0x86, 0x1e, 0xb7, 0x2b, 0xb7, 0x57, 0xc0, 0x2c, 0x71, 0x90,
+	0x72, 0xd8, 0x2c, 0x64, 0x45, 0x56, 0x40, 0x2d, 0xc3, 0x85, 0xf6, 0x45, 0x21, 0x10, 0x59, 0x9a,
+	0x96, 0x7a, 0xab, 0x04, 0xb0, 0x1a, 0xfe, 0x4e, 0xfb, 0xe6, 0x7f, 0xa8, 0xfd, 0xce, 0x8f, 0x06,
+	0x18, 0xf2, 0x73, 0xe4, 0x1f, 0x4b, 0xfb, 0x88, 0x8f, 0x95, 0x75, 0xc7, 0xf2, 0xb5, 0xdd, 0xd1,
+	0x01, 0x43, 0x56, 0x8a, 0xad, 0xe7, 0x51, 0x4b, 0x00, 0xab, 0x01, 0x7d, 0x01, 0x8b, 0xef, 0x35,
+	0xaf, 0x42, 0xe7, 0xcb, 0x6c, 0xf8, 0xde, 0xd1, 0x95, 0x66, 0x95, 0xcb, 0xcb, 0xf8, 0x97, 0xf2,
+	0x32, 0xff, 0xb9, 0xbc, 0x9e, 0x83, 0x29, 0x0b, 0x81, 0xd9, 0xd5, 0xb6, 0x5e, 0x2c, 0xad, 0x4b,
+	0xa5, 0xa0, 0xee, 0x18, 0x45, 0xc4, 0xe9, 0x88, 0x3a, 0x60, 0x1e, 0x13, 0x2f, 0xe0, 0xc7, 0xb2,
+	0xb3, 0x59, 0x8a, 0xa3, 0x10, 0x9c, 0x8e, 0xe8, 0x19, 0x80, 0x6a, 0xc8, 0x94, 0x46, 0x54, 0x36,
+	0x4d, 0xcb, 0x5d, 0x9a, 0x25, 0xce, 0x03, 0xd9, 0x57, 0x05, 0x58, 0x68, 0x02, 0xd6, 0x1c, 0xbc,
+	0xed, 0x72, 0x80, 0x3b, 0xba, 0x1c, 0xea, 0x77, 0x79, 0x39, 0x74, 0x7e, 0xd2, 0xa1, 0x79, 0xa9,
+	0x23, 0xdd, 0x72, 0xf1, 0xce, 0xa5, 0x55, 0xbe, 0x41, 0x5a, 0xb9, 0x42, 0xf4, 0x8f, 0x55, 0x48,
+	0x9e, 0x9c, 0xca, 0x07, 0x26, 0xc7, 0xb8, 0xab, 0xe4, 0x98, 0x77, 0x94, 0x9c, 0xea, 0x5d, 0x26,
+	0xe7, 0xd3, 0x0d, 0x80, 0xbc, 0x0b, 0xa0, 0x06, 0xd4, 0xf6, 0x0e, 0x36, 0xb7, 0x06, 0x7b, 0xdf,
+	0xee, 0x2c, 0x96, 0x50, 0x1d, 0xaa, 0x2f, 0x77, 0x0e, 0xb6, 0xf7, 0x0e, 0x5e, 0xa8, 0xbf, 0xbd,
+	0xaf, 0xf7, 0xb0, 0x98, 0x97, 0xd7, 0xbf, 0x02, 0x43, 0xfe, 0xed, 0xa1, 0x67, 0xd9, 0xe4, 0xe1,
+	0x75, 0x3f, 0xb3, 0x2b, 0x8f, 0xae, 0xa0, 0xaa, 0x41, 0x7d, 0xae, 0xb9, 0xab, 0x67, 0x7f, 0xb4,
+	0x4a, 0x67, 0xe7, 0x2d, 0xed, 0xdd, 0x79, 0x4b, 0xfb, 0xfd, 0xbc, 0xa5, 0xbd, 0xbd, 0x68, 0x95,
+	0xde, 0x5d, 0xb4, 0x4a, 0xbf, 0x5e, 0xb4, 0x4a, 0xaf, 0xaa, 0xe9, 0x0f, 0xfc, 0xa1, 0x29, 0x83,
+	0xdb, 0xf8, 0x6b, 0x00, 0xf1, 0x05, 0xb5, 0x0c, 0xd8, 0x0b, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -897,6 +908,29 @@ func (m *RuleGroup) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.DestinationTenant) > 0 {
+		i -= len(m.DestinationTenant)
+		copy(dAtA[i:], m.DestinationTenant)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.DestinationTenant)))
+		i--
+		dAtA[i] = 0x62
+	}
+	if len(m.SourceTenants) > 0 {
+		for iNdEx := len(m.SourceTenants) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.SourceTenants[iNdEx])
+			copy(dAtA[i:], m.SourceTenants[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.SourceTenants[iNdEx])))
+			i--
+			dAtA[i] = 0x5a
+		}
+	}
+	if len(m.QuerySource) > 0 {
+		i -= len(m.QuerySource)
+		copy(dAtA[i:], m.QuerySource)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.QuerySource)))
+		i--
+		dAtA[i] = 0x52
+	}
 	if m.Limit != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.Limit))
 		i--
@@ -1402,6 +1436,20 @@ func (m *RuleGroup) Size() (n int) {
 	if m.Limit != 0 {
 		n += 1 + sovRpc(uint64(m.Limit))
 	}
+	l = len(m.QuerySource)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.SourceTenants) > 0 {
+		for _, s := range m.SourceTenants {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	l = len(m.DestinationTenant)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -2093,6 +2141,102 @@ func (m *RuleGroup) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QuerySource", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.QuerySource = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceTenants", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SourceTenants = append(m.SourceTenants, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 12:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DestinationTenant", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DestinationTenant = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
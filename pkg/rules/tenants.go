@@ -0,0 +1,75 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// groupTenants are the tenants of a rule group.
+type groupTenants struct {
+	// source are the tenants the group queries, none for the tenant of the query endpoints.
+	source []string
+	// destination is the tenant the results of the group are written to, empty for the tenant of the ruler.
+	destination string
+}
+
+type sourceTenantsKey struct{}
+
+// SourceTenantsFromContext returns the tenants the rule group whose query is evaluated with the context queries, nil
+// if the group has no source tenants.
+func SourceTenantsFromContext(ctx context.Context) []string {
+	tenants, _ := ctx.Value(sourceTenantsKey{}).([]string)
+	return tenants
+}
+
+// crossTenant returns true if the group queries other tenants than the one its results are written to. Only groups
+// querying and writing their single destination tenant, or without tenants, are not cross-tenant.
+func (t groupTenants) crossTenant() bool {
+	if len(t.source) == 0 {
+		return t.destination != ""
+	}
+	return len(t.source) > 1 || t.source[0] != t.destination
+}
+
+// validateTenants checks the tenants of the group against the tenant label and whether cross-tenant groups are allowed.
+func (g configRuleAdapter) validateTenants(tenantLabel string, allowCrossTenant bool) error {
+	t := g.tenants()
+	for _, s := range t.source {
+		if s == "" {
+			return errors.New("empty source tenant")
+		}
+	}
+	if t.destination != "" && tenantLabel == "" {
+		return errors.New("destination_tenant requires a tenant label")
+	}
+	if t.crossTenant() && !allowCrossTenant {
+		return errors.Errorf("cross-tenant group with source tenants %v and destination tenant %q is not allowed", t.source, t.destination)
+	}
+	return nil
+}
+
+func (g configRuleAdapter) tenants() groupTenants {
+	return groupTenants{source: g.SourceTenants, destination: g.DestinationTenant}
+}
+
+// setRuleLabel sets the label on all rules of the group, so that the results of its recording rules and its alerts
+// get it.
+func (g configRuleAdapter) setRuleLabel(name, value string) {
+	rs, _ := g.nativeRuleGroup["rules"].([]interface{})
+	for _, r := range rs {
+		r, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		lbls, ok := r["labels"].(map[string]interface{})
+		if !ok {
+			lbls = map[string]interface{}{}
+			r["labels"] = lbls
+		}
+		lbls[name] = value
+	}
+}
@@ -34,6 +34,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
+const (
+	// minStreamWindowSize is the smallest flow control window gRPC accepts.
+	minStreamWindowSize = 64 * 1024
+	// maxConnWindowSize is the largest flow control window gRPC grows connection windows to.
+	maxConnWindowSize = 16 * 1024 * 1024
+)
+
 // A Server defines parameters to serve RPC requests, a wrapper around grpc.Server.
 type Server struct {
 	logger log.Logger
@@ -99,6 +106,15 @@ func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer
 	if options.maxConnAge > 0 {
 		options.grpcOpts = append(options.grpcOpts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionAge: options.maxConnAge}))
 	}
+	if options.streamWindowSize >= minStreamWindowSize {
+		// Fixed windows disable the windows growing with the bandwidth, for connections as well. Connections keep the
+		// largest window gRPC would grow them to, so that streams of a connection are not bounded by each other.
+		connWindowSize := options.streamWindowSize
+		if connWindowSize < maxConnWindowSize {
+			connWindowSize = maxConnWindowSize
+		}
+		options.grpcOpts = append(options.grpcOpts, grpc.InitialWindowSize(options.streamWindowSize), grpc.InitialConnWindowSize(connWindowSize))
+	}
 	s := grpc.NewServer(options.grpcOpts...)
 
 	// Register all configured servers.
@@ -20,6 +20,8 @@ type options struct {
 
 	tlsConfig *tls.Config
 
+	streamWindowSize int32
+
 	grpcOpts []grpc.ServerOption
 }
 
@@ -88,3 +90,12 @@ func WithMaxConnAge(t time.Duration) Option {
 		o.maxConnAge = t
 	})
 }
+
+// WithStreamWindowSize sets the flow control window of each stream, bounding the bytes sent to a client and not
+// acknowledged by it yet. Windows lower than 64KiB are ignored, and gRPC grows the windows with the bandwidth of the
+// connections instead.
+func WithStreamWindowSize(size int32) Option {
+	return optionFunc(func(o *options) {
+		o.streamWindowSize = size
+	})
+}
@@ -30,3 +30,10 @@ func (r *ResponseWriterWithStatus) WriteHeader(code int) {
 		r.isHeaderWritten = true
 	}
 }
+
+// Flush sends any buffered data to the client, if the wrapped http.ResponseWriter supports it.
+func (r *ResponseWriterWithStatus) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -7,7 +7,10 @@ package shipper
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -21,6 +24,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
@@ -38,6 +42,9 @@ type metrics struct {
 	uploads           prometheus.Counter
 	uploadFailures    prometheus.Counter
 	uploadedCompacted prometheus.Gauge
+	uploadedExemplars prometheus.Counter
+
+	uploadVerificationFailures prometheus.Counter
 }
 
 func newMetrics(reg prometheus.Registerer, uploadCompacted bool) *metrics {
@@ -59,6 +66,14 @@ func newMetrics(reg prometheus.Registerer, uploadCompacted bool) *metrics {
 		Name: "thanos_shipper_upload_failures_total",
 		Help: "Total number of block upload failures",
 	})
+	m.uploadedExemplars = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_shipper_uploaded_exemplars_total",
+		Help: "Total number of exemplars uploaded along with blocks",
+	})
+	m.uploadVerificationFailures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_shipper_upload_verification_failures_total",
+		Help: "Total number of block uploads whose uploaded files did not match the local ones",
+	})
 	uploadCompactedGaugeOpts := prometheus.GaugeOpts{
 		Name: "thanos_shipper_upload_compacted_done",
 		Help: "If 1 it means shipper uploaded all compacted blocks from the filesystem.",
@@ -84,8 +99,26 @@ type Shipper struct {
 	uploadCompacted        bool
 	allowOutOfOrderUploads bool
 	hashFunc               metadata.HashFunc
+
+	exemplars          ExemplarsSource
+	uploadVerification UploadVerification
 }
 
+// UploadVerification is how the files of uploaded blocks are compared with the local ones.
+type UploadVerification string
+
+const (
+	// NoUploadVerification does not verify uploaded blocks.
+	NoUploadVerification UploadVerification = "none"
+	// SizeUploadVerification compares the sizes of the uploaded files, as returned by the bucket, with the local ones.
+	SizeUploadVerification UploadVerification = "size"
+	// HashUploadVerification compares the SHA256 hashes of the uploaded files, downloaded again, with the local ones.
+	HashUploadVerification UploadVerification = "hash"
+)
+
+// ExemplarsSource returns the exemplars of the series within the given closed time range.
+type ExemplarsSource func(ctx context.Context, mint, maxt int64) ([]exemplar.QueryResult, error)
+
 // New creates a new shipper that detects new TSDB blocks in dir and uploads them to
 // remote if necessary. It attaches the Thanos metadata section in each meta JSON file.
 // If uploadCompacted is enabled, it also uploads compacted blocks which are already in filesystem.
@@ -120,6 +153,22 @@ func New(
 	}
 }
 
+// WithExemplars makes the shipper upload the exemplars of the series of each block along with it, as an exemplars
+// file of the block. The exemplars are fetched from the given source when uploading the block, so only the ones
+// still available then are uploaded.
+func (s *Shipper) WithExemplars(source ExemplarsSource) *Shipper {
+	s.exemplars = source
+	return s
+}
+
+// WithUploadVerification makes the shipper verify each uploaded block, so that blocks altered on their way to the
+// bucket, e.g. truncated by a proxy, are not considered uploaded. A block whose uploaded files don't match the local
+// ones is deleted from the bucket and its upload fails, so that it is uploaded again on the next sync.
+func (s *Shipper) WithUploadVerification(v UploadVerification) *Shipper {
+	s.uploadVerification = v
+	return s
+}
+
 // Timestamps returns the minimum timestamp for which data is available and the highest timestamp
 // of blocks that were successfully uploaded.
 func (s *Shipper) Timestamps() (minTime, maxSyncTime int64, err error) {
@@ -364,7 +413,118 @@ func (s *Shipper) upload(ctx context.Context, meta *metadata.Meta) error {
 	if err := meta.WriteToDir(s.logger, updir); err != nil {
 		return errors.Wrap(err, "write meta file")
 	}
-	return block.Upload(ctx, s.logger, s.bucket, updir, s.hashFunc)
+	if s.exemplars != nil {
+		// Exemplars are best effort, the block is uploaded without them if they can't be fetched.
+		if err := s.writeExemplars(ctx, meta, updir); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to write exemplars of block, uploading it without exemplars", "block", meta.ULID, "err", err)
+		}
+	}
+	if err := block.Upload(ctx, s.logger, s.bucket, updir, s.hashFunc); err != nil {
+		return err
+	}
+	if s.uploadVerification == "" || s.uploadVerification == NoUploadVerification {
+		return nil
+	}
+	if err := s.verifyUpload(ctx, meta.ULID, updir); err != nil {
+		s.metrics.uploadVerificationFailures.Inc()
+		// Deleting the meta.json first, the block is not considered uploaded anymore, so the next sync uploads it again.
+		if err := block.Delete(ctx, s.logger, s.bucket, meta.ULID); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to delete block whose upload could not be verified", "block", meta.ULID, "err", err)
+		}
+		return errors.Wrap(err, "verify upload")
+	}
+	return nil
+}
+
+// verifyUpload compares the files of the block uploaded from the given upload dir with the local ones.
+func (s *Shipper) verifyUpload(ctx context.Context, id ulid.ULID, updir string) error {
+	// The uploaded meta.json holds the file stats gathered on upload, unlike the local one, so it is only checked to
+	// be complete.
+	m, err := block.DownloadMeta(ctx, s.logger, s.bucket, id)
+	if err != nil {
+		return err
+	}
+	if m.ULID != id {
+		return errors.Errorf("uploaded meta file is of block %s", m.ULID)
+	}
+
+	files := []string{block.IndexFilename}
+	segments, err := ioutil.ReadDir(filepath.Join(updir, block.ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "read chunks dir")
+	}
+	for _, f := range segments {
+		files = append(files, path.Join(block.ChunksDirname, f.Name()))
+	}
+	if _, err := os.Stat(filepath.Join(updir, block.ExemplarsFilename)); err == nil {
+		files = append(files, block.ExemplarsFilename)
+	}
+
+	for _, f := range files {
+		var (
+			local = filepath.Join(updir, filepath.FromSlash(f))
+			name  = path.Join(id.String(), f)
+		)
+		switch s.uploadVerification {
+		case SizeUploadVerification:
+			st, err := os.Stat(local)
+			if err != nil {
+				return errors.Wrapf(err, "stat %s", local)
+			}
+			attrs, err := s.bucket.Attributes(ctx, name)
+			if err != nil {
+				return errors.Wrapf(err, "get attributes of %s", name)
+			}
+			if attrs.Size != st.Size() {
+				return errors.Errorf("uploaded %s has %d bytes, expected %d", name, attrs.Size, st.Size())
+			}
+		case HashUploadVerification:
+			h, err := metadata.CalculateHash(local, metadata.SHA256Func, s.logger)
+			if err != nil {
+				return errors.Wrapf(err, "hash %s", local)
+			}
+			uploaded, err := s.hashObject(ctx, name)
+			if err != nil {
+				return err
+			}
+			if uploaded != h.Value {
+				return errors.Errorf("uploaded %s has SHA256 hash %s, expected %s", name, uploaded, h.Value)
+			}
+		default:
+			return errors.Errorf("unknown upload verification %q", s.uploadVerification)
+		}
+	}
+	return nil
+}
+
+// hashObject returns the hex encoded SHA256 hash of the object with the given name.
+func (s *Shipper) hashObject(ctx context.Context, name string) (string, error) {
+	r, err := s.bucket.Get(ctx, name)
+	if err != nil {
+		return "", errors.Wrapf(err, "get %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(s.logger, r, "close %s", name)
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", errors.Wrapf(err, "read %s", name)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeExemplars writes the exemplars file of the block in the given upload dir.
+func (s *Shipper) writeExemplars(ctx context.Context, meta *metadata.Meta, updir string) error {
+	// The max time of blocks is exclusive.
+	res, err := s.exemplars(ctx, meta.MinTime, meta.MaxTime-1)
+	if err != nil {
+		return errors.Wrap(err, "fetch exemplars")
+	}
+	n, err := block.WriteExemplars(s.logger, updir, res)
+	if err != nil {
+		return errors.Wrap(err, "write exemplars file")
+	}
+	s.metrics.uploadedExemplars.Add(float64(n))
+	return nil
 }
 
 // blockMetasFromOldest returns the block meta of each block found in dir
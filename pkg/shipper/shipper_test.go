@@ -4,8 +4,10 @@
 package shipper
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
@@ -16,6 +18,8 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 
@@ -198,6 +202,101 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	testutil.Equals(t, []string{segmentFile}, meta.Thanos.SegmentFiles)
 }
 
+// alteringBucket alters the uploads of the files with the given name, like a faulty proxy.
+type alteringBucket struct {
+	objstore.Bucket
+
+	name  string
+	alter func([]byte) []byte
+}
+
+func (b *alteringBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if path.Base(name) != b.name || b.alter == nil {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, bytes.NewReader(b.alter(data)))
+}
+
+func TestShipperUploadVerification(t *testing.T) {
+	truncate := func(data []byte) []byte { return data[:len(data)-1] }
+	corrupt := func(data []byte) []byte {
+		altered := append([]byte{}, data...)
+		altered[0]++
+		return altered
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		verification UploadVerification
+		alter        func([]byte) []byte
+		expFailure   bool
+	}{
+		{name: "no verification", verification: NoUploadVerification, alter: truncate},
+		{name: "size", verification: SizeUploadVerification},
+		{name: "size of truncated upload", verification: SizeUploadVerification, alter: truncate, expFailure: true},
+		// Sizes of corrupted files still match.
+		{name: "size of corrupted upload", verification: SizeUploadVerification, alter: corrupt},
+		{name: "hash", verification: HashUploadVerification},
+		{name: "hash of corrupted upload", verification: HashUploadVerification, alter: corrupt, expFailure: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+
+			bkt := &alteringBucket{Bucket: objstore.NewInMemBucket(), name: block.IndexFilename, alter: tcase.alter}
+			lbls := []labels.Label{{Name: "test", Value: "test"}}
+			reg := prometheus.NewRegistry()
+			s := New(nil, reg, dir, bkt, func() labels.Labels { return lbls }, metadata.TestSource, false, false, metadata.NoneFunc).
+				WithUploadVerification(tcase.verification)
+
+			id := ulid.MustNew(1, nil)
+			blockDir := path.Join(dir, id.String())
+			chunksDir := path.Join(blockDir, block.ChunksDirname)
+			testutil.Ok(t, os.MkdirAll(chunksDir, os.ModePerm))
+			testutil.Ok(t, metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    id,
+					MaxTime: 2000,
+					MinTime: 1000,
+					Version: 1,
+					Stats: tsdb.BlockStats{
+						NumSamples: 1000, // Not really, but shipper needs nonzero value.
+					},
+				},
+			}.WriteToDir(log.NewNopLogger(), blockDir))
+			testutil.Ok(t, os.WriteFile(filepath.Join(blockDir, block.IndexFilename), []byte("index file"), 0666))
+			testutil.Ok(t, os.WriteFile(filepath.Join(chunksDir, "00001"), []byte("hello world"), 0666))
+
+			uploaded, err := s.Sync(ctx)
+			if !tcase.expFailure {
+				testutil.Ok(t, err)
+				testutil.Equals(t, 1, uploaded)
+				testutil.Equals(t, 0.0, promtest.ToFloat64(s.metrics.uploadVerificationFailures))
+				return
+			}
+			testutil.NotOk(t, err)
+			testutil.Equals(t, 0, uploaded)
+			testutil.Equals(t, 1.0, promtest.ToFloat64(s.metrics.uploadVerificationFailures))
+
+			// The altered block is deleted, so that it is not considered uploaded.
+			ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+			testutil.Ok(t, err)
+			testutil.Assert(t, !ok, "block failing verification must be deleted")
+
+			// It is uploaded again on the next sync.
+			bkt.alter = nil
+			uploaded, err = s.Sync(ctx)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, uploaded)
+			testutil.Equals(t, 1.0, promtest.ToFloat64(s.metrics.uploadVerificationFailures))
+		})
+	}
+}
+
 func TestReadMetaFile(t *testing.T) {
 	t.Run("Missing meta file", func(t *testing.T) {
 		// Create TSDB directory without meta file
@@ -38,7 +38,7 @@ type labelValuesCallCase struct {
 }
 
 // testLabelAPIs tests labels methods from StoreAPI from closed box perspective.
-func testLabelAPIs(t *testing.T, startStore func(extLset labels.Labels, append func(app storage.Appender)) storepb.StoreServer) {
+func testLabelAPIs(t *testing.T, startStore func(t *testing.T, extLset labels.Labels, append func(app storage.Appender)) storepb.StoreServer) {
 	t.Helper()
 
 	now := time.Now()
@@ -185,6 +185,32 @@ func testLabelAPIs(t *testing.T, startStore func(extLset labels.Labels, append f
 					label:    "bar",
 					matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "different"}},
 				},
+				// Values of external labels with matchers.
+				{
+					start:          timestamp.FromTime(minTime),
+					end:            timestamp.FromTime(maxTime),
+					label:          "region",
+					expectedValues: []string{"eu-west"},
+					matchers:       []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "bar", Value: "barvalue1"}},
+				},
+				{
+					start:    timestamp.FromTime(minTime),
+					end:      timestamp.FromTime(maxTime),
+					label:    "region",
+					matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "bar", Value: "different"}},
+				},
+				{
+					start:    timestamp.FromTime(minTime),
+					end:      timestamp.FromTime(maxTime),
+					label:    "region",
+					matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "different"}},
+				},
+				{
+					start:    timestamp.FromTime(minTime),
+					end:      timestamp.FromTime(now.Add(-4 * time.Hour)),
+					label:    "region",
+					matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "bar", Value: "barvalue1"}},
+				},
 			},
 		},
 	} {
@@ -193,7 +219,7 @@ func testLabelAPIs(t *testing.T, startStore func(extLset labels.Labels, append f
 			if appendFn == nil {
 				appendFn = func(storage.Appender) {}
 			}
-			store := startStore(extLset, appendFn)
+			store := startStore(t, extLset, appendFn)
 			for _, c := range tc.labelNameCalls {
 				t.Run("label_names", func(t *testing.T) {
 					resp, err := store.LabelNames(context.Background(), &storepb.LabelNamesRequest{
@@ -34,7 +34,9 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/prometheus/prometheus/tsdb/index"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -70,8 +72,8 @@ const (
 	EstimatedMaxChunkSize = 16000
 	maxSeriesSize         = 64 * 1024
 	// Relatively large in order to reduce memory waste, yet small enough to avoid excessive allocations.
-	chunkBytesPoolMinSize = 64 * 1024        // 64 KiB
-	chunkBytesPoolMaxSize = 64 * 1024 * 1024 // 64 MiB
+	DefaultChunkBytesPoolMinSize = 64 * 1024        // 64 KiB
+	DefaultChunkBytesPoolMaxSize = 64 * 1024 * 1024 // 64 MiB
 
 	// CompatibilityTypeLabelName is an artificial label that Store Gateway can optionally advertise. This is required for compatibility
 	// with pre v0.8.0 Querier. Previous Queriers was strict about duplicated external labels of all StoreAPIs that had any labels.
@@ -93,8 +95,11 @@ const (
 	PartitionerMaxGapSize = 512 * 1024
 
 	// Labels for metrics.
-	labelEncode = "encode"
-	labelDecode = "decode"
+	labelEncode  = "encode"
+	labelDecode  = "decode"
+	labelWarmed  = "warmed"
+	labelSkipped = "skipped"
+	labelFailed  = "failed"
 
 	minBlockSyncConcurrency = 1
 )
@@ -115,12 +120,19 @@ type bucketStoreMetrics struct {
 	seriesDataSizeTouched *prometheus.SummaryVec
 	seriesDataSizeFetched *prometheus.SummaryVec
 	seriesBlocksQueried   prometheus.Summary
+	labelBlocksQueried    *prometheus.SummaryVec
+	labelIndexBlocks      *prometheus.CounterVec
 	seriesGetAllDuration  prometheus.Histogram
 	seriesMergeDuration   prometheus.Histogram
+	seriesSendStall       prometheus.Histogram
 	resultSeriesCount     prometheus.Summary
 	chunkSizeBytes        prometheus.Histogram
 	queriesDropped        *prometheus.CounterVec
+	tenantQueriesDropped  *prometheus.CounterVec
 	seriesRefetches       prometheus.Counter
+	chunkBytesReleased    prometheus.Counter
+	slicedChunks          prometheus.Counter
+	slicedChunkBytesSaved prometheus.Counter
 
 	cachedPostingsCompressions           *prometheus.CounterVec
 	cachedPostingsCompressionErrors      *prometheus.CounterVec
@@ -130,6 +142,15 @@ type bucketStoreMetrics struct {
 
 	seriesFetchDuration   prometheus.Histogram
 	postingsFetchDuration prometheus.Histogram
+
+	cacheWarmupEntries  *prometheus.CounterVec
+	cacheWarmupDuration prometheus.Gauge
+
+	deletionMarkedBlockDrops     prometheus.Counter
+	deletionMarkedBlocksExcluded prometheus.Counter
+
+	initialSyncPendingBlocks *prometheus.GaugeVec
+	initialSyncLoadedMinTime prometheus.Gauge
 }
 
 func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
@@ -182,6 +203,14 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_series_blocks_queried",
 		Help: "Number of blocks in a bucket store that were touched to satisfy a query.",
 	})
+	m.labelBlocksQueried = promauto.With(reg).NewSummaryVec(prometheus.SummaryOpts{
+		Name: "thanos_bucket_store_label_blocks_queried",
+		Help: "Number of blocks in a bucket store that were touched to satisfy a label names or label values request.",
+	}, []string{"operation"})
+	m.labelIndexBlocks = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_label_index_queried_blocks_total",
+		Help: "Total number of blocks whose label names or values were read from their label index file instead of their index header.",
+	}, []string{"operation"})
 	m.seriesGetAllDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 		Name:    "thanos_bucket_store_series_get_all_duration_seconds",
 		Help:    "Time it takes until all per-block prepares and loads for a query are finished.",
@@ -192,6 +221,11 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Help:    "Time it takes to merge sub-results from all queried blocks into a single result.",
 		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 	})
+	m.seriesSendStall = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_bucket_store_series_send_stall_duration_seconds",
+		Help:    "Time Series calls spend blocked sending their responses, e.g. because of slow clients exhausting the flow control window of their stream.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+	})
 	m.resultSeriesCount = promauto.With(reg).NewSummary(prometheus.SummaryOpts{
 		Name: "thanos_bucket_store_series_result_series",
 		Help: "Number of series observed in the final result of a query.",
@@ -209,10 +243,34 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_queries_dropped_total",
 		Help: "Number of queries that were dropped due to the limit.",
 	}, []string{"reason"})
+	m.tenantQueriesDropped = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_tenant_queries_dropped_total",
+		Help: "Number of queries that were dropped due to the limits of a tenant.",
+	}, []string{"tenant", "reason"})
 	m.seriesRefetches = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_bucket_store_series_refetches_total",
 		Help: fmt.Sprintf("Total number of cases where %v bytes was not enough was to fetch series from index, resulting in refetch.", maxSeriesSize),
 	})
+	m.chunkBytesReleased = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_series_chunk_bytes_released_total",
+		Help: "Total number of chunk byte slices which were not returned to the chunk pool by a Series call and were released once it finished.",
+	})
+	m.slicedChunks = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_sliced_chunks_total",
+		Help: "Total number of chunks sent by Series calls that were cut down to the requested time range.",
+	})
+	m.slicedChunkBytesSaved = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_sliced_chunk_bytes_saved_total",
+		Help: "Total number of chunk bytes not sent by Series calls thanks to chunks being cut down to the requested time range.",
+	})
+	m.deletionMarkedBlockDrops = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_deletion_marked_block_drops_total",
+		Help: "Total number of local blocks that were dropped because their deletion mark got older than the ignore deletion marks delay.",
+	})
+	m.deletionMarkedBlocksExcluded = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_deletion_marked_blocks_excluded_total",
+		Help: "Total number of loaded blocks that were excluded from queries because their deletion mark got older than the ignore deletion marks delay before they were dropped.",
+	})
 
 	m.cachedPostingsCompressions = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 		Name: "thanos_bucket_store_cached_postings_compressions_total",
@@ -256,6 +314,29 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 	})
 
+	m.cacheWarmupEntries = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_cache_warmup_entries_total",
+		Help: "Total number of index cache warmup entries by result. Entries of blocks which are not loaded anymore are skipped.",
+	}, []string{"result"})
+	m.cacheWarmupEntries.WithLabelValues(labelWarmed)
+	m.cacheWarmupEntries.WithLabelValues(labelSkipped)
+	m.cacheWarmupEntries.WithLabelValues(labelFailed)
+	m.cacheWarmupDuration = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_bucket_store_cache_warmup_duration_seconds",
+		Help: "Duration of the last index cache warmup.",
+	})
+
+	m.initialSyncPendingBlocks = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_bucket_store_initial_sync_pending_blocks",
+		Help: "Number of blocks the initial sync has yet to load, by whether their samples are within the recent window served while syncing.",
+	}, []string{"window"})
+	m.initialSyncPendingBlocks.WithLabelValues(labelRecent)
+	m.initialSyncPendingBlocks.WithLabelValues(labelOlder)
+	m.initialSyncLoadedMinTime = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_bucket_store_initial_sync_loaded_min_time_seconds",
+		Help: "Unix time from which all blocks are loaded while the initial sync is in progress, 0 once it is done.",
+	})
+
 	return &m
 }
 
@@ -299,7 +380,9 @@ type BucketStore struct {
 	// seriesLimiterFactory creates a new limiter used to limit the number of touched series by each Series() call,
 	// or LabelName and LabelValues calls when used with matchers.
 	seriesLimiterFactory SeriesLimiterFactory
-	partitioner          Partitioner
+	// tenantLimits are the limits enforced per tenant by each Series() call, nil if disabled. Guarded by mtx.
+	tenantLimits *TenantLimits
+	partitioner  Partitioner
 
 	filterConfig             *FilterConfig
 	advLabelSets             []labelpb.ZLabelSet
@@ -307,9 +390,49 @@ type BucketStore struct {
 
 	// Every how many posting offset entry we pool in heap memory. Default in Prometheus is 32.
 	postingOffsetsInMemSampling int
+	// Verifies the index-headers on disk against their source index before loading them.
+	verifyIndexHeaders bool
 
 	// Enables hints in the Series() response.
 	enableSeriesResponseHints bool
+
+	// Maximum bytes of chunk ranges each Series() call reads ahead of decoding them. 0 disables read-ahead.
+	chunksPrefetchBudget int64
+
+	// Returns the chunk bytes of the series sent by Series() calls to the chunk pool before the calls are done.
+	releaseSentChunks bool
+
+	// Cuts the chunks sent by Series() calls down to the requested time range if the request hints ask for it.
+	chunkSlicing bool
+
+	// Maximum size of the label index files of the blocks used to answer label names and values requests. 0 disables
+	// them.
+	labelIndexMaxSize int64
+	// Total size of the label index files kept in memory, and the cache keeping them.
+	labelIndexCacheSize int64
+	labelIndexCache     *labelIndexCache
+
+	// Tracks the matcher sets used per block to warm up the index cache, nil if disabled.
+	cacheWarmupTracker *cacheWarmupTracker
+
+	// False positive rate of the filter of the metric names of the blocks, 0 if disabled.
+	metricNameFilterFalsePositiveRate float64
+	// Filter of the metric names of the blocks, nil until built. Stale if blocks changed since the last build.
+	metricNameFilter      *MetricNameFilter
+	metricNameFilterStale bool
+	// Duration of the leases of the advertised filter, until when the filter and the replaced ones are leased.
+	metricNameFilterLease               time.Duration
+	metricNameFilterLeasedUntil         time.Time
+	replacedMetricNameFilterLeasedUntil time.Time
+
+	// Filter of the blocks marked for deletion of the fetcher, nil if the loaded blocks are served until dropped.
+	deletionMarkFilter *block.IgnoreDeletionMarkFilter
+
+	// Window of recent blocks after which the initial sync calls serveWhileSyncingReady, 0 if disabled.
+	serveWhileSyncingWindow time.Duration
+	serveWhileSyncingReady  func()
+	// Progress of the initial sync, nil once it is done. Guarded by mtx.
+	initialSyncProgress *initialSyncProgress
 }
 
 func (b *BucketStore) validate() error {
@@ -376,6 +499,32 @@ func WithFilterConfig(filter *FilterConfig) BucketStoreOption {
 	}
 }
 
+// WithChunksPrefetchBudget sets the maximum bytes of chunk ranges each Series call reads ahead of decoding them.
+// Chunk ranges are then downloaded concurrently, instead of one after the other while decoding the chunks of a block.
+func WithChunksPrefetchBudget(bytes int64) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.chunksPrefetchBudget = bytes
+	}
+}
+
+// WithSentChunksRelease makes Series calls return the chunk bytes of the series they sent to the chunk pool right
+// away, instead of once the calls are done. Responses must not be used anymore once sent, as with gRPC servers which
+// encode them, so it must not be used with in-process clients.
+func WithSentChunksRelease() BucketStoreOption {
+	return func(s *BucketStore) {
+		s.releaseSentChunks = true
+	}
+}
+
+// WithChunkSlicing makes Series calls whose hints ask for it decode the raw chunks overlapping the bounds of the
+// requested time range and send only their samples within it, plus one sample on each side, so that functions like
+// rate() and the lookback of instant vectors keep working at the bounds.
+func WithChunkSlicing() BucketStoreOption {
+	return func(s *BucketStore) {
+		s.chunkSlicing = true
+	}
+}
+
 // WithDebugLogging enables debug logging.
 func WithDebugLogging() BucketStoreOption {
 	return func(s *BucketStore) {
@@ -425,8 +574,9 @@ func NewBucketStore(
 
 	// Depend on the options
 	indexReaderPoolMetrics := indexheader.NewReaderPoolMetrics(extprom.WrapRegistererWithPrefix("thanos_bucket_store_", s.reg))
-	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, indexReaderPoolMetrics)
+	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, s.verifyIndexHeaders, indexReaderPoolMetrics)
 	s.metrics = newBucketStoreMetrics(s.reg) // TODO(metalmatze): Might be possible via Option too
+	s.labelIndexCache = newLabelIndexCache(s.labelIndexCacheSize)
 
 	if err := s.validate(); err != nil {
 		return nil, errors.Wrap(err, "validate config")
@@ -452,15 +602,52 @@ func (s *BucketStore) Close() (err error) {
 	return err
 }
 
+// SetTenantLimits sets the limits enforced per tenant by the Series calls starting from now. Nil disables them.
+func (s *BucketStore) SetTenantLimits(limits *TenantLimits) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.tenantLimits = limits
+}
+
 // SyncBlocks synchronizes the stores state with the Bucket bucket.
 // It will reuse disk space as persistent cache based on s.dir param.
 func (s *BucketStore) SyncBlocks(ctx context.Context) error {
+	return s.syncBlocks(ctx, false)
+}
+
+func (s *BucketStore) syncBlocks(ctx context.Context, initial bool) error {
 	metas, _, metaFetchErr := s.fetcher.Fetch(ctx)
 	// For partial view allow adding new blocks at least.
 	if metaFetchErr != nil && metas == nil {
 		return metaFetchErr
 	}
 
+	// Blocks are loaded from the newest to the oldest, as most queries ask for recent data.
+	toLoad := make([]*metadata.Meta, 0, len(metas))
+	for id, meta := range metas {
+		if b := s.getBlock(id); b != nil {
+			continue
+		}
+		toLoad = append(toLoad, meta)
+	}
+	sortMetasNewestFirst(toLoad)
+
+	var progress *initialSyncProgress
+	if initial && s.serveWhileSyncingWindow > 0 {
+		progress = newInitialSyncProgress(s.metrics, toLoad, s.serveWhileSyncingWindow, s.serveWhileSyncingReady, time.Now())
+		s.mtx.Lock()
+		s.initialSyncProgress = progress
+		s.mtx.Unlock()
+		defer func() {
+			s.mtx.Lock()
+			s.initialSyncProgress = nil
+			s.mtx.Unlock()
+			progress.finish()
+		}()
+		progress.readyIfRecentLoaded()
+	}
+
 	var wg sync.WaitGroup
 	blockc := make(chan *metadata.Meta)
 
@@ -468,18 +655,17 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		wg.Add(1)
 		go func() {
 			for meta := range blockc {
-				if err := s.addBlock(ctx, meta); err != nil {
-					continue
+				// Blocks which failed to load are retried by the next sync, so they don't hold back the initial sync.
+				_ = s.addBlock(ctx, meta)
+				if progress != nil {
+					progress.blockDone(meta.ULID)
 				}
 			}
 			wg.Done()
 		}()
 	}
 
-	for id, meta := range metas {
-		if b := s.getBlock(id); b != nil {
-			continue
-		}
+	for _, meta := range toLoad {
 		select {
 		case <-ctx.Done():
 		case blockc <- meta:
@@ -493,6 +679,7 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		return metaFetchErr
 	}
 
+	marks := s.deletionMarks()
 	// Drop all blocks that are no longer present in the bucket.
 	for id := range s.blocks {
 		if _, ok := metas[id]; ok {
@@ -504,11 +691,16 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		}
 		level.Info(s.logger).Log("msg", "dropped outdated block", "block", id)
 		s.metrics.blockDrops.Inc()
+		if _, ok := marks[id]; ok {
+			s.metrics.deletionMarkedBlockDrops.Inc()
+		}
 	}
+	s.syncDeletionMarks(marks)
 
 	// Sync advertise labels.
 	var storeLabels labels.Labels
 	s.mtx.Lock()
+	s.syncMetricNameFilter()
 	s.advLabelSets = make([]labelpb.ZLabelSet, 0, len(s.advLabelSets))
 	for _, bs := range s.blockSets {
 		storeLabels = storeLabels[:0]
@@ -524,7 +716,7 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 // InitialSync perform blocking sync with extra step at the end to delete locally saved blocks that are no longer
 // present in the bucket. The mismatch of these can only happen between restarts, so we can do that only once per startup.
 func (s *BucketStore) InitialSync(ctx context.Context) error {
-	if err := s.SyncBlocks(ctx); err != nil {
+	if err := s.syncBlocks(ctx, true); err != nil {
 		return errors.Wrap(err, "sync block")
 	}
 
@@ -578,9 +770,47 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 	}()
 	s.metrics.blockLoads.Inc()
 
+	b, err := s.loadBlock(ctx, meta)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			runutil.CloseWithErrCapture(&err, b, "index-header")
+		}
+	}()
+
+	if err = s.addBlockMetricNames(ctx, b); err != nil {
+		return err
+	}
+
 	lset := labels.FromMap(meta.Thanos.Labels)
 	h := lset.Hash()
 
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sort.Sort(lset)
+
+	set, ok := s.blockSets[h]
+	if !ok {
+		set = newBucketBlockSet(lset)
+		s.blockSets[h] = set
+	}
+
+	if err = set.add(b); err != nil {
+		return errors.Wrap(err, "add block to set")
+	}
+	s.blocks[b.meta.ULID] = b
+
+	s.metrics.blocksLoaded.Inc()
+	s.metrics.lastLoadedBlock.SetToCurrentTime()
+	return nil
+}
+
+// loadBlock loads the block with its index-header, without adding it to the store.
+func (s *BucketStore) loadBlock(ctx context.Context, meta *metadata.Meta) (_ *bucketBlock, err error) {
+	dir := filepath.Join(s.dir, meta.ULID.String())
 	indexHeaderReader, err := s.indexReaderPool.NewBinaryReader(
 		ctx,
 		s.logger,
@@ -590,7 +820,7 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		s.postingOffsetsInMemSampling,
 	)
 	if err != nil {
-		return errors.Wrap(err, "create index header reader")
+		return nil, errors.Wrap(err, "create index header reader")
 	}
 	defer func() {
 		if err != nil {
@@ -606,12 +836,11 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		s.bkt,
 		dir,
 		s.indexCache,
-		s.chunkPool,
 		indexHeaderReader,
 		s.partitioner,
 	)
 	if err != nil {
-		return errors.Wrap(err, "new bucket block")
+		return nil, errors.Wrap(err, "new bucket block")
 	}
 	defer func() {
 		if err != nil {
@@ -619,25 +848,12 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		}
 	}()
 
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
-
-	sort.Sort(lset)
-
-	set, ok := s.blockSets[h]
-	if !ok {
-		set = newBucketBlockSet(lset)
-		s.blockSets[h] = set
-	}
-
-	if err = set.add(b); err != nil {
-		return errors.Wrap(err, "add block to set")
+	if b.metricNameHashes, err = s.metricNameHashes(indexHeaderReader); err != nil {
+		return nil, err
 	}
-	s.blocks[b.meta.ULID] = b
-
-	s.metrics.blocksLoaded.Inc()
-	s.metrics.lastLoadedBlock.SetToCurrentTime()
-	return nil
+	b.labelIndexMaxSize = s.labelIndexMaxSize
+	b.labelIndexCache = s.labelIndexCache
+	return b, nil
 }
 
 func (s *BucketStore) removeBlock(id ulid.ULID) error {
@@ -647,6 +863,8 @@ func (s *BucketStore) removeBlock(id ulid.ULID) error {
 		lset := labels.FromMap(b.meta.Thanos.Labels)
 		s.blockSets[lset.Hash()].remove(id)
 		delete(s.blocks, id)
+		// The filter keeps the metric names of the block until it is rebuilt.
+		s.metricNameFilterStale = true
 	}
 	s.mtx.Unlock()
 
@@ -655,12 +873,22 @@ func (s *BucketStore) removeBlock(id ulid.ULID) error {
 	}
 
 	s.metrics.blocksLoaded.Dec()
+	s.labelIndexCache.remove(id)
 	if err := b.Close(); err != nil {
 		return errors.Wrap(err, "close block")
 	}
 	return os.RemoveAll(b.dir)
 }
 
+// HasBlock returns true if the block with the given ID is loaded.
+func (s *BucketStore) HasBlock(id ulid.ULID) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	_, ok := s.blocks[id]
+	return ok
+}
+
 // TimeRange returns the minimum and maximum timestamp of data available in the store.
 func (s *BucketStore) TimeRange() (mint, maxt int64) {
 	s.mtx.RLock()
@@ -681,6 +909,13 @@ func (s *BucketStore) TimeRange() (mint, maxt int64) {
 	mint = s.limitMinTime(mint)
 	maxt = s.limitMaxTime(maxt)
 
+	// Older blocks are still loading, so only the time range of which all blocks are loaded is advertised.
+	if s.initialSyncProgress != nil {
+		if loadedMint, ok := s.initialSyncProgress.minTime(); ok && loadedMint > mint {
+			mint = loadedMint
+		}
+	}
+
 	return mint, maxt
 }
 
@@ -747,6 +982,10 @@ type bucketSeriesSet struct {
 	set []seriesEntry
 	i   int
 	err error
+
+	// release, if set, releases the chunks of the series entry with the given index.
+	release  func(i int)
+	released int
 }
 
 func newBucketSeriesSet(set []seriesEntry) *bucketSeriesSet {
@@ -772,6 +1011,19 @@ func (s *bucketSeriesSet) Err() error {
 	return s.err
 }
 
+// releaseUpTo releases the chunks of the series iterated so far with labels up to the given ones. Series being sent
+// in the order of their labels, it is called with the labels of each series sent to release the chunks of the series
+// that were sent, even if they were merged with the series of other sets.
+func (s *bucketSeriesSet) releaseUpTo(lset labels.Labels) {
+	if s.release == nil {
+		return
+	}
+	for s.released <= s.i && s.released < len(s.set) && labels.Compare(s.set[s.released].lset, lset) <= 0 {
+		s.release(s.released)
+		s.released++
+	}
+}
+
 // blockSeries returns series matching given matchers, that have some data in given time range.
 func blockSeries(
 	ctx context.Context,
@@ -863,7 +1115,87 @@ func blockSeries(
 		return nil, nil, errors.Wrap(err, "load chunks")
 	}
 
-	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats), nil
+	set := newBucketSeriesSet(res)
+	set.release = chunkr.releaseSeries
+	return set, indexr.stats.merge(chunkr.stats), nil
+}
+
+// sliceSeriesChunks cuts the raw chunks of the series down to the samples within the given time range, plus the last
+// sample before it and the first one after it. It returns the number of chunks cut down and the number of bytes saved.
+// Chunks of downsampled blocks are left untouched.
+func sliceSeriesChunks(set []seriesEntry, minTime, maxTime int64) (sliced, saved int, err error) {
+	for i := range set {
+		for j := range set[i].chks {
+			c := &set[i].chks[j]
+			if c.Raw == nil || (c.MinTime >= minTime && c.MaxTime <= maxTime) {
+				continue
+			}
+			ok, n, err := sliceChunk(c, minTime, maxTime)
+			if err != nil {
+				return 0, 0, err
+			}
+			if ok {
+				sliced++
+				saved += n
+			}
+		}
+	}
+	return sliced, saved, nil
+}
+
+// sliceChunk replaces the raw chunk with one holding only its samples within the given time range, plus the last
+// sample before it and the first one after it. It returns whether the chunk was replaced and the number of bytes saved.
+func sliceChunk(c *storepb.AggrChunk, minTime, maxTime int64) (bool, int, error) {
+	if c.Raw.Type != storepb.Chunk_XOR {
+		return false, 0, nil
+	}
+	in, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+	if err != nil {
+		return false, 0, errors.Wrap(err, "decode chunk")
+	}
+
+	var (
+		ts []int64
+		vs []float64
+		it = in.Iterator(nil)
+	)
+	for it.Next() {
+		t, v := it.At()
+		ts = append(ts, t)
+		vs = append(vs, v)
+	}
+	if err := it.Err(); err != nil {
+		return false, 0, errors.Wrap(err, "iterate chunk")
+	}
+	if len(ts) == 0 {
+		return false, 0, nil
+	}
+
+	first := sort.Search(len(ts), func(i int) bool { return ts[i] >= minTime })
+	if first > 0 {
+		first--
+	}
+	last := sort.Search(len(ts), func(i int) bool { return ts[i] > maxTime })
+	if last < len(ts) {
+		last++
+	}
+	if first == 0 && last == len(ts) {
+		return false, 0, nil
+	}
+
+	out := chunkenc.NewXORChunk()
+	app, err := out.Appender()
+	if err != nil {
+		return false, 0, errors.Wrap(err, "append to chunk")
+	}
+	for i := first; i < last; i++ {
+		app.Append(ts[i], vs[i])
+	}
+	saved := len(c.Raw.Data) - len(out.Bytes())
+	c.Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: out.Bytes()}
+	c.MinTime = ts[first]
+	c.MaxTime = ts[last-1]
+	return true, saved, nil
 }
 
 func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr, save func([]byte) ([]byte, error)) error {
@@ -994,16 +1326,31 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	req.MaxTime = s.limitMaxTime(req.MaxTime)
 
 	var (
-		ctx              = srv.Context()
-		stats            = &queryStats{}
-		res              []storepb.SeriesSet
-		mtx              sync.Mutex
-		g, gctx          = errgroup.WithContext(ctx)
-		resHints         = &hintspb.SeriesResponseHints{}
-		reqBlockMatchers []*labels.Matcher
-		chunksLimiter    = s.chunksLimiterFactory(s.metrics.queriesDropped.WithLabelValues("chunks"))
-		seriesLimiter    = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
+		ctx               = srv.Context()
+		stats             = &queryStats{}
+		res               []storepb.SeriesSet
+		released          []*bucketSeriesSet // Sets whose chunks are released once their series are sent.
+		mtx               sync.Mutex
+		sendStall         time.Duration
+		g, gctx           = errgroup.WithContext(ctx)
+		resHints          = &hintspb.SeriesResponseHints{}
+		reqBlockMatchers  []*labels.Matcher
+		queryStatsEnabled bool
+		sliceChunks       bool
+		blockStats        []hintspb.BlockQueryStats
+		chunksLimiter     = s.chunksLimiterFactory(s.metrics.queriesDropped.WithLabelValues("chunks"))
+		seriesLimiter     = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
+		// All chunk bytes of the request are borrowed through reqChunkPool, so they are returned to the chunk pool
+		// once the request is done, even if a reader did not return them on errors or cancellation.
+		reqChunkPool = pool.NewTrackedBytes(s.chunkPool)
+		// All chunk ranges read ahead by the request share its prefetch budget.
+		prefetchBudget = newChunksPrefetchBudget(s.chunksPrefetchBudget)
 	)
+	defer func() {
+		if n := reqChunkPool.ReleaseAll(); n > 0 {
+			s.metrics.chunkBytesReleased.Add(float64(n))
+		}
+	}()
 
 	if req.Hints != nil {
 		reqHints := &hintspb.SeriesRequestHints{}
@@ -1015,9 +1362,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		if err != nil {
 			return status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request hints labels matchers").Error())
 		}
+		queryStatsEnabled = reqHints.EnableQueryStats
+		sliceChunks = s.chunkSlicing && reqHints.SliceChunks && !req.SkipChunks
 	}
 
 	s.mtx.RLock()
+	tenantLimiters := newTenantLimiters(s.tenantLimits, s.metrics.tenantQueriesDropped)
 	for _, bs := range s.blockSets {
 		blockMatchers, ok := bs.labelMatchers(matchers...)
 		if !ok {
@@ -1043,13 +1393,15 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			// We must keep the readers open until all their data has been sent.
 			indexr := b.indexReader()
 			if !req.SkipChunks {
-				chunkr = b.chunkReader()
+				chunkr = b.chunkReader(reqChunkPool, prefetchBudget)
 				defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
 			}
 
 			// Defer all closes to the end of Series method.
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "series block")
 
+			tenantLimiter := tenantLimiters.forBlock(b.extLset)
+
 			g.Go(func() error {
 				span, newCtx := tracing.StartSpan(gctx, "bucket_store_block_series", tracing.Tags{
 					"block.id":         b.meta.ULID,
@@ -1059,14 +1411,15 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				})
 				defer span.Finish()
 
+				s.recordCacheWarmup(b.meta.ULID, blockMatchers)
 				part, pstats, err := blockSeries(
 					newCtx,
 					b.extLset,
 					indexr,
 					chunkr,
 					blockMatchers,
-					chunksLimiter,
-					seriesLimiter,
+					tenantLimiter.chunksLimiter(chunksLimiter),
+					tenantLimiter.seriesLimiter(seriesLimiter),
 					req.SkipChunks,
 					req.MinTime, req.MaxTime,
 					req.Aggregates,
@@ -1074,10 +1427,35 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				if err != nil {
 					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
 				}
+				if err := tenantLimiter.reserveBytes(pstats); err != nil {
+					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
+				}
+				if bs, ok := part.(*bucketSeriesSet); ok && sliceChunks {
+					sliced, saved, err := sliceSeriesChunks(bs.set, req.MinTime, req.MaxTime)
+					if err != nil {
+						return errors.Wrapf(err, "slice chunks for block %s", b.meta.ULID)
+					}
+					s.metrics.slicedChunks.Add(float64(sliced))
+					s.metrics.slicedChunkBytesSaved.Add(float64(saved))
+				}
 
 				mtx.Lock()
 				res = append(res, part)
+				if bs, ok := part.(*bucketSeriesSet); ok && bs.release != nil && s.releaseSentChunks {
+					released = append(released, bs)
+				}
 				stats = stats.merge(pstats)
+				if queryStatsEnabled {
+					blockStats = append(blockStats, hintspb.BlockQueryStats{
+						BlockId:                 b.meta.ULID.String(),
+						PostingsTouched:         int64(pstats.postingsTouched),
+						SeriesFetched:           int64(pstats.seriesFetched),
+						ChunksFetched:           int64(pstats.chunksFetched),
+						PostingsFetchDurationNs: int64(pstats.PostingsFetchDurationSum),
+						SeriesFetchDurationNs:   int64(pstats.SeriesFetchDurationSum),
+						ChunksFetchDurationNs:   int64(pstats.ChunksFetchDurationSum),
+					})
+				}
 				mtx.Unlock()
 
 				// No info about samples exactly, so pass at least chunks.
@@ -1158,10 +1536,18 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				s.metrics.chunkSizeBytes.Observe(float64(chunksSize(series.Chunks)))
 			}
 			series.Labels = labelpb.ZLabelsFromPromLabels(lset)
-			if err = srv.Send(storepb.NewSeriesResponse(&series)); err != nil {
+			sendBegin := time.Now()
+			err = srv.Send(storepb.NewSeriesResponse(&series))
+			sendStall += time.Since(sendBegin)
+			if err != nil {
 				err = status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
 				return
 			}
+			// The response is not used once sent, so the chunk bytes of its series can be returned to the pool
+			// instead of being kept until the whole response is sent to a possibly slow client.
+			for _, bs := range released {
+				bs.releaseUpTo(lset)
+			}
 		}
 		if set.Err() != nil {
 			err = status.Error(codes.Unknown, errors.Wrap(set.Err(), "expand series set").Error())
@@ -1169,13 +1555,17 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		}
 		stats.MergeDuration = time.Since(begin)
 		s.metrics.seriesMergeDuration.Observe(stats.MergeDuration.Seconds())
+		s.metrics.seriesSendStall.Observe(sendStall.Seconds())
 
 		err = nil
 	})
 
-	if s.enableSeriesResponseHints {
+	// Hints are always sent to requests enabling query stats, as these come from clients handling them.
+	if s.enableSeriesResponseHints || queryStatsEnabled {
 		var anyHints *types.Any
 
+		// Only the most expensive blocks are kept, to bound the size of the hints.
+		resHints.BlockStats = hintspb.TopBlockStats(blockStats, hintspb.MaxBlockStats)
 		if anyHints, err = types.MarshalAny(resHints); err != nil {
 			err = status.Error(codes.Unknown, errors.Wrap(err, "marshal series response hints").Error())
 			return
@@ -1203,6 +1593,8 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request labels matchers").Error())
 	}
+	req.Start = s.limitMinTime(req.Start)
+	req.End = s.limitMaxTime(req.End)
 
 	resHints := &hintspb.LabelNamesResponseHints{}
 
@@ -1228,18 +1620,18 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 	var sets [][]string
 	var seriesLimiter = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
 
-	for _, b := range s.blocks {
+	var blocksQueried int
+	for _, b := range s.labelBlocks(req.Start, req.End, reqBlockMatchers) {
 		b := b
 		gctx := gctx
 
-		if !b.overlapsClosedInterval(req.Start, req.End) {
-			continue
-		}
-		if len(reqBlockMatchers) > 0 && !b.matchRelabelLabels(reqBlockMatchers) {
+		seriesMatchers, ok := b.extLabelsMatchers(reqSeriesMatchers)
+		if !ok {
 			continue
 		}
 
 		resHints.AddQueriedBlock(b.meta.ULID)
+		blocksQueried++
 
 		indexr := b.indexReader()
 
@@ -1254,13 +1646,16 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label names")
 
 			var result []string
-			if len(reqSeriesMatchers) == 0 {
+			if len(seriesMatchers) == 0 {
 				// Do it via index reader to have pending reader registered correctly.
 				// LabelNames are already sorted.
-				res, err := indexr.block.indexHeaderReader.LabelNames()
+				res, fromLabelIndex, err := indexr.block.labelNames(newCtx)
 				if err != nil {
 					return errors.Wrapf(err, "label names for block %s", b.meta.ULID)
 				}
+				if fromLabelIndex {
+					s.metrics.labelIndexBlocks.WithLabelValues("label_names").Inc()
+				}
 
 				// Add  a set for the external labels as well.
 				// We're not adding them directly to res because there could be duplicates.
@@ -1272,7 +1667,7 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 
 				result = strutil.MergeSlices(res, extRes)
 			} else {
-				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, reqSeriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
+				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, seriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
 				if err != nil {
 					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
 				}
@@ -1309,6 +1704,7 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 	}
 
 	s.mtx.RUnlock()
+	s.metrics.labelBlocksQueried.WithLabelValues("label_names").Observe(float64(blocksQueried))
 
 	if err := g.Wait(); err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -1331,6 +1727,8 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request labels matchers").Error())
 	}
+	req.Start = s.limitMinTime(req.Start)
+	req.End = s.limitMaxTime(req.End)
 
 	resHints := &hintspb.LabelValuesResponseHints{}
 
@@ -1350,14 +1748,10 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 		}
 	}
 
-	// If we have series matchers, add <labelName> != "" matcher, to only select series that have given label name.
-	if len(reqSeriesMatchers) > 0 {
-		m, err := labels.NewMatcher(labels.MatchNotEqual, req.Label, "")
-		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, err.Error())
-		}
-
-		reqSeriesMatchers = append(reqSeriesMatchers, m)
+	// With series matchers, the <labelName> != "" matcher only selects series that have given label name.
+	labelNotEmpty, err := labels.NewMatcher(labels.MatchNotEqual, req.Label, "")
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	s.mtx.RLock()
@@ -1366,17 +1760,21 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	var sets [][]string
 	var seriesLimiter = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
 
-	for _, b := range s.blocks {
+	var blocksQueried int
+	for _, b := range s.labelBlocks(req.Start, req.End, reqBlockMatchers) {
 		b := b
 
-		if !b.overlapsClosedInterval(req.Start, req.End) {
+		seriesMatchers, ok := b.extLabelsMatchers(reqSeriesMatchers)
+		if !ok {
 			continue
 		}
-		if len(reqBlockMatchers) > 0 && !b.matchRelabelLabels(reqBlockMatchers) {
-			continue
+		// External labels are not in the index, series of the block all have them.
+		if len(seriesMatchers) > 0 && b.extLset.Get(req.Label) == "" {
+			seriesMatchers = append(seriesMatchers, labelNotEmpty)
 		}
 
 		resHints.AddQueriedBlock(b.meta.ULID)
+		blocksQueried++
 
 		indexr := b.indexReader()
 		g.Go(func() error {
@@ -1390,11 +1788,14 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label values")
 
 			var result []string
-			if len(reqSeriesMatchers) == 0 {
+			if len(seriesMatchers) == 0 {
 				// Do it via index reader to have pending reader registered correctly.
-				res, err := indexr.block.indexHeaderReader.LabelValues(req.Label)
+				res, fromLabelIndex, err := indexr.block.labelValues(newCtx, req.Label)
 				if err != nil {
-					return errors.Wrapf(err, "index header label values for block %s", b.meta.ULID)
+					return errors.Wrapf(err, "label values for block %s", b.meta.ULID)
+				}
+				if fromLabelIndex {
+					s.metrics.labelIndexBlocks.WithLabelValues("label_values").Inc()
 				}
 
 				// Add the external label value as well.
@@ -1403,7 +1804,7 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 				}
 				result = res
 			} else {
-				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, reqSeriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
+				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, seriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
 				if err != nil {
 					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
 				}
@@ -1414,7 +1815,7 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 				for seriesSet.Next() {
 					ls, _ := seriesSet.At()
 					val := ls.Get(req.Label)
-					if val != "" { // Should never be empty since we added labelName!="" matcher to the list of matchers.
+					if val != "" { // Should never be empty since we added labelName!="" matcher to the list of matchers, or it is an external label.
 						values[val] = struct{}{}
 					}
 				}
@@ -1440,6 +1841,7 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	}
 
 	s.mtx.RUnlock()
+	s.metrics.labelBlocksQueried.WithLabelValues("label_values").Observe(float64(blocksQueried))
 
 	if err := g.Wait(); err != nil {
 		return nil, status.Error(codes.Aborted, err.Error())
@@ -1456,6 +1858,17 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	}, nil
 }
 
+// labelBlocks returns the blocks to query for label names or values within the given time range. Each part of the range
+// is covered by the blocks of a single resolution, the most downsampled ones available, since the blocks of all
+// resolutions have the same series and fewer downsampled blocks cover the same range. It must be called with s.mtx held.
+func (s *BucketStore) labelBlocks(mint, maxt int64, blockMatchers []*labels.Matcher) []*bucketBlock {
+	var blocks []*bucketBlock
+	for _, bs := range s.blockSets {
+		blocks = append(blocks, bs.getFor(mint, maxt, downsample.ResLevel2, blockMatchers)...)
+	}
+	return blocks
+}
+
 // bucketBlockSet holds all blocks of an equal label set. It internally splits
 // them up by downsampling resolution and allows querying.
 type bucketBlockSet struct {
@@ -1545,6 +1958,7 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64, blockMatc
 	// Our current resolution might not cover all data, so recursively fill the gaps with higher resolution blocks
 	// if there is any.
 	start := mint
+	now := time.Now()
 	for _, b := range s.blocks[i] {
 		if b.meta.MaxTime <= mint {
 			continue
@@ -1553,6 +1967,10 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64, blockMatc
 		if b.meta.MinTime > maxt {
 			break
 		}
+		// Blocks about to be dropped are skipped as if they were, so that lower resolutions fill their gap.
+		if b.deletionMarkExpired(now) {
+			continue
+		}
 
 		if i+1 < len(s.resolutions) {
 			bs = append(bs, s.getFor(start, b.meta.MinTime-1, s.resolutions[i+1], blockMatchers)...)
@@ -1600,7 +2018,6 @@ type bucketBlock struct {
 	meta       *metadata.Meta
 	dir        string
 	indexCache storecache.IndexCache
-	chunkPool  pool.Bytes
 	extLset    labels.Labels
 
 	indexHeaderReader indexheader.Reader
@@ -1614,6 +2031,30 @@ type bucketBlock struct {
 	// Block's labels used by block-level matchers to filter blocks to query. These are used to select blocks using
 	// request hints' BlockMatchers.
 	relabelLabels labels.Labels
+
+	// Hashes of the metric names of the block, nil if the metric name filter is disabled.
+	metricNameHashes []uint64
+
+	exemplarsMtx sync.Mutex
+	// Exemplars file of the block, downloaded on the first request of its exemplars.
+	exemplarsFile *block.ExemplarsFile
+
+	// Maximum size of the label index file of the block to use it, 0 if it is not used.
+	labelIndexMaxSize int64
+	// Cache of the label index files, which keeps the one of the block once downloaded until it is evicted.
+	labelIndexCache *labelIndexCache
+
+	labelIndexMtx sync.Mutex
+	// Closed once the label index file of the block being downloaded is in the cache, nil if none is downloaded.
+	labelIndexLoading chan struct{}
+	// Whether the label index file of the block could not be decoded, so that it is not downloaded again.
+	labelIndexInvalid bool
+
+	// Unix time in milliseconds from which the block is excluded from queries because of its deletion mark, 0 if
+	// it is not marked for deletion.
+	deletionExpiry atomic.Int64
+	// Whether the block was excluded from queries because of its deletion mark.
+	deletionExcluded atomic.Bool
 }
 
 func newBucketBlock(
@@ -1624,7 +2065,6 @@ func newBucketBlock(
 	bkt objstore.BucketReader,
 	dir string,
 	indexCache storecache.IndexCache,
-	chunkPool pool.Bytes,
 	indexHeadReader indexheader.Reader,
 	p Partitioner,
 ) (b *bucketBlock, err error) {
@@ -1633,7 +2073,6 @@ func newBucketBlock(
 		metrics:           metrics,
 		bkt:               bkt,
 		indexCache:        indexCache,
-		chunkPool:         chunkPool,
 		dir:               dir,
 		partitioner:       p,
 		meta:              meta,
@@ -1691,7 +2130,7 @@ func (b *bucketBlock) readIndexRange(ctx context.Context, off, length int64) ([]
 	return buf.Bytes(), nil
 }
 
-func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length int64, chunkRanges byteRanges) (*[]byte, error) {
+func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length int64, chunkRanges byteRanges, chunkPool pool.Bytes) (*[]byte, error) {
 	if seq < 0 || seq >= len(b.chunkObjs) {
 		return nil, errors.Errorf("unknown segment file for index %d", seq)
 	}
@@ -1704,13 +2143,14 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 	defer runutil.CloseWithLogOnErr(b.logger, reader, "readChunkRange close range reader")
 
 	// Get a buffer from the pool.
-	chunkBuffer, err := b.chunkPool.Get(chunkRanges.size())
+	chunkBuffer, err := chunkPool.Get(chunkRanges.size())
 	if err != nil {
 		return nil, errors.Wrap(err, "allocate chunk bytes")
 	}
 
 	*chunkBuffer, err = readByteRanges(reader, *chunkBuffer, chunkRanges)
 	if err != nil {
+		chunkPool.Put(chunkBuffer)
 		return nil, err
 	}
 
@@ -1730,9 +2170,9 @@ func (b *bucketBlock) indexReader() *bucketIndexReader {
 	return newBucketIndexReader(b)
 }
 
-func (b *bucketBlock) chunkReader() *bucketChunkReader {
+func (b *bucketBlock) chunkReader(chunkPool pool.Bytes, prefetchBudget *chunksPrefetchBudget) *bucketChunkReader {
 	b.pendingReaders.Add(1)
-	return newBucketChunkReader(b)
+	return newBucketChunkReader(b, chunkPool, prefetchBudget)
 }
 
 // matchRelabelLabels verifies whether the block matches the given matchers.
@@ -1745,6 +2185,23 @@ func (b *bucketBlock) matchRelabelLabels(matchers []*labels.Matcher) bool {
 	return true
 }
 
+// extLabelsMatchers returns the matchers without the ones of external labels of the block, which are not in its index,
+// and false if the block cannot have series matching them because of its external labels.
+func (b *bucketBlock) extLabelsMatchers(matchers []*labels.Matcher) ([]*labels.Matcher, bool) {
+	res := make([]*labels.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		v := b.extLset.Get(m.Name)
+		if v == "" {
+			res = append(res, m)
+			continue
+		}
+		if !m.Matches(v) {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
 // overlapsClosedInterval returns true if the block overlaps [mint, maxt).
 func (b *bucketBlock) overlapsClosedInterval(mint, maxt int64) bool {
 	// The block itself is a half-open interval
@@ -2427,7 +2884,9 @@ type loadIdx struct {
 }
 
 type bucketChunkReader struct {
-	block *bucketBlock
+	block          *bucketBlock
+	chunkPool      pool.Bytes
+	prefetchBudget *chunksPrefetchBudget
 
 	toLoad [][]loadIdx
 
@@ -2436,13 +2895,21 @@ type bucketChunkReader struct {
 	mtx        sync.Mutex
 	stats      *queryStats
 	chunkBytes []*[]byte // Byte slice to return to the chunk pool on close.
+	// chunkBytesRefs are the numbers of chunks saved in each of the chunkBytes by series entries not released yet.
+	chunkBytesRefs []int
+	// seriesChunkBytes are the indices of the chunkBytes the chunks of each series entry were saved to.
+	seriesChunkBytes [][]int
+	// saveEntry is the series entry whose chunks are being saved.
+	saveEntry int
 }
 
-func newBucketChunkReader(block *bucketBlock) *bucketChunkReader {
+func newBucketChunkReader(block *bucketBlock, chunkPool pool.Bytes, prefetchBudget *chunksPrefetchBudget) *bucketChunkReader {
 	return &bucketChunkReader{
-		block:  block,
-		stats:  &queryStats{},
-		toLoad: make([][]loadIdx, len(block.chunkObjs)),
+		block:          block,
+		chunkPool:      chunkPool,
+		prefetchBudget: prefetchBudget,
+		stats:          &queryStats{},
+		toLoad:         make([][]loadIdx, len(block.chunkObjs)),
 	}
 }
 
@@ -2450,11 +2917,32 @@ func (r *bucketChunkReader) Close() error {
 	r.block.pendingReaders.Done()
 
 	for _, b := range r.chunkBytes {
-		r.block.chunkPool.Put(b)
+		if b != nil {
+			r.chunkPool.Put(b)
+		}
 	}
 	return nil
 }
 
+// releaseSeries returns the chunk bytes only used by the given series entry and released series entries to the
+// chunk pool. The chunks of the series entry must not be used anymore.
+func (r *bucketChunkReader) releaseSeries(entry int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if entry >= len(r.seriesChunkBytes) {
+		return
+	}
+	for _, i := range r.seriesChunkBytes[entry] {
+		r.chunkBytesRefs[i]--
+		if r.chunkBytesRefs[i] == 0 && r.chunkBytes[i] != nil {
+			r.chunkPool.Put(r.chunkBytes[i])
+			r.chunkBytes[i] = nil
+		}
+	}
+	r.seriesChunkBytes[entry] = nil
+}
+
 // addLoad adds the chunk with id to the data set to be fetched.
 // Chunk will be fetched and saved to res[seriesEntry][chunk] upon r.load(res, <...>) call.
 func (r *bucketChunkReader) addLoad(id chunks.ChunkRef, seriesEntry, chunk int) error {
@@ -2472,6 +2960,7 @@ func (r *bucketChunkReader) addLoad(id chunks.ChunkRef, seriesEntry, chunk int)
 // load loads all added chunks and saves resulting aggrs to res.
 func (r *bucketChunkReader) load(ctx context.Context, res []seriesEntry, aggrs []storepb.Aggr) error {
 	g, ctx := errgroup.WithContext(ctx)
+	r.seriesChunkBytes = make([][]int, len(res))
 
 	for seq, pIdxs := range r.toLoad {
 		sort.Slice(pIdxs, func(i, j int) bool {
@@ -2498,12 +2987,23 @@ func (r *bucketChunkReader) load(ctx context.Context, res []seriesEntry, aggrs [
 func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, aggrs []storepb.Aggr, seq int, part Part, pIdxs []loadIdx) error {
 	fetchBegin := time.Now()
 
-	// Get a reader for the required range.
-	reader, err := r.block.chunkRangeReader(ctx, seq, int64(part.Start), int64(part.End-part.Start))
+	var reader io.Reader
+	prefetched, release, err := r.prefetchRange(ctx, seq, part)
 	if err != nil {
-		return errors.Wrap(err, "get range reader")
+		return errors.Wrap(err, "prefetch range")
+	}
+	if prefetched != nil {
+		defer release()
+		reader = bytes.NewReader(prefetched)
+	} else {
+		// Get a reader for the required range.
+		rangeReader, err := r.block.chunkRangeReader(ctx, seq, int64(part.Start), int64(part.End-part.Start))
+		if err != nil {
+			return errors.Wrap(err, "get range reader")
+		}
+		defer runutil.CloseWithLogOnErr(r.block.logger, rangeReader, "readChunkRange close range reader")
+		reader = rangeReader
 	}
-	defer runutil.CloseWithLogOnErr(r.block.logger, reader, "readChunkRange close range reader")
 	bufReader := bufio.NewReaderSize(reader, EstimatedMaxChunkSize)
 
 	locked := true
@@ -2531,13 +3031,13 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		n        int
 	)
 
-	bufPooled, err := r.block.chunkPool.Get(EstimatedMaxChunkSize)
-	if err == nil {
+	// Only return the buffer to the pool if it was borrowed from there.
+	if bufPooled, err := r.chunkPool.Get(EstimatedMaxChunkSize); err == nil {
 		buf = *bufPooled
+		defer r.chunkPool.Put(bufPooled)
 	} else {
 		buf = make([]byte, EstimatedMaxChunkSize)
 	}
-	defer r.block.chunkPool.Put(&buf)
 
 	for i, pIdx := range pIdxs {
 		// Fast forward range reader to the next chunk start in case of sparse (for our purposes) byte range.
@@ -2574,6 +3074,7 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		// There is also crc32 after the chunk, but we ignore that.
 		chunkLen = n + 1 + int(chunkDataLen)
 		if chunkLen <= len(cb) {
+			r.saveEntry = pIdx.seriesEntry
 			err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), rawChunk(cb[n:chunkLen]), aggrs, r.save)
 			if err != nil {
 				return errors.Wrap(err, "populate chunk")
@@ -2591,11 +3092,12 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 
 		// Read entire chunk into new buffer.
 		// TODO: readChunkRange call could be avoided for any chunk but last in this particular part.
-		nb, err := r.block.readChunkRange(ctx, seq, int64(pIdx.offset), int64(chunkLen), []byteRange{{offset: 0, length: chunkLen}})
+		nb, err := r.block.readChunkRange(ctx, seq, int64(pIdx.offset), int64(chunkLen), []byteRange{{offset: 0, length: chunkLen}}, r.chunkPool)
 		if err != nil {
 			return errors.Wrapf(err, "preloaded chunk too small, expecting %d, and failed to fetch full chunk", chunkLen)
 		}
 		if len(*nb) != chunkLen {
+			r.chunkPool.Put(nb)
 			return errors.Errorf("preloaded chunk too small, expecting %d", chunkLen)
 		}
 
@@ -2605,33 +3107,94 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		r.stats.chunksFetchCount++
 		r.stats.ChunksFetchDurationSum += time.Since(fetchBegin)
 		r.stats.ChunksFetchedSizeSum += units.Base2Bytes(len(*nb))
+		r.saveEntry = pIdx.seriesEntry
 		err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), rawChunk((*nb)[n:]), aggrs, r.save)
 		if err != nil {
-			r.block.chunkPool.Put(nb)
+			r.chunkPool.Put(nb)
 			return errors.Wrap(err, "populate chunk")
 		}
 		r.stats.chunksTouched++
 		r.stats.ChunksTouchedSizeSum += units.Base2Bytes(int(chunkDataLen))
 
-		r.block.chunkPool.Put(nb)
+		r.chunkPool.Put(nb)
 	}
 	return nil
 }
 
+// prefetchRange reads the whole range of the part from the segment file with sequence number seq, if it fits into the
+// prefetch budget. Otherwise, or if the chunk pool is exhausted, it returns nil bytes and the range has to be streamed.
+// The returned function must be called to release the bytes once the chunks of the range are decoded.
+func (r *bucketChunkReader) prefetchRange(ctx context.Context, seq int, part Part) ([]byte, func(), error) {
+	length := int64(part.End - part.Start)
+	if r.prefetchBudget == nil || length > r.prefetchBudget.size {
+		return nil, nil, nil
+	}
+	if err := r.prefetchBudget.Acquire(ctx, length); err != nil {
+		return nil, nil, err
+	}
+	b, err := r.chunkPool.Get(int(length))
+	if err != nil {
+		r.prefetchBudget.Release(length)
+		return nil, nil, nil
+	}
+	release := func() {
+		r.chunkPool.Put(b)
+		r.prefetchBudget.Release(length)
+	}
+
+	reader, err := r.block.chunkRangeReader(ctx, seq, int64(part.Start), length)
+	if err != nil {
+		release()
+		return nil, nil, errors.Wrap(err, "get range reader")
+	}
+	defer runutil.CloseWithLogOnErr(r.block.logger, reader, "prefetchRange close range reader")
+
+	*b = (*b)[:length]
+	n, err := io.ReadFull(reader, *b)
+	// The range estimated for the last chunk of the part may go beyond the end of the segment file.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		release()
+		return nil, nil, errors.Wrapf(err, "read range for seq %d offset %x", seq, part.Start)
+	}
+	return (*b)[:n], release, nil
+}
+
+// chunksPrefetchBudget bounds the bytes of chunk ranges read ahead and not yet decoded by a Series call.
+type chunksPrefetchBudget struct {
+	*semaphore.Weighted
+	size int64
+}
+
+// newChunksPrefetchBudget returns a budget of the given bytes, or nil if read-ahead is disabled.
+func newChunksPrefetchBudget(size int64) *chunksPrefetchBudget {
+	if size <= 0 {
+		return nil
+	}
+	return &chunksPrefetchBudget{Weighted: semaphore.NewWeighted(size), size: size}
+}
+
 // save saves a copy of b's payload to a memory pool of its own and returns a new byte slice referencing said copy.
-// Returned slice becomes invalid once r.block.chunkPool.Put() is called.
+// The copy is accounted to r.saveEntry, so that it can be released along with the series entry.
+// Returned slice becomes invalid once r.chunkPool.Put() is called.
 func (r *bucketChunkReader) save(b []byte) ([]byte, error) {
 	// Ensure we never grow slab beyond original capacity.
 	if len(r.chunkBytes) == 0 ||
 		cap(*r.chunkBytes[len(r.chunkBytes)-1])-len(*r.chunkBytes[len(r.chunkBytes)-1]) < len(b) {
-		s, err := r.block.chunkPool.Get(len(b))
+		s, err := r.chunkPool.Get(len(b))
 		if err != nil {
 			return nil, errors.Wrap(err, "allocate chunk bytes")
 		}
 		r.chunkBytes = append(r.chunkBytes, s)
+		r.chunkBytesRefs = append(r.chunkBytesRefs, 0)
 	}
-	slab := r.chunkBytes[len(r.chunkBytes)-1]
+	i := len(r.chunkBytes) - 1
+	slab := r.chunkBytes[i]
 	*slab = append(*slab, b...)
+
+	if r.saveEntry < len(r.seriesChunkBytes) {
+		r.chunkBytesRefs[i]++
+		r.seriesChunkBytes[r.saveEntry] = append(r.seriesChunkBytes[r.saveEntry], i)
+	}
 	return (*slab)[len(*slab)-len(b):], nil
 }
 
@@ -2744,5 +3307,14 @@ func (s queryStats) merge(o *queryStats) *queryStats {
 
 // NewDefaultChunkBytesPool returns a chunk bytes pool with default settings.
 func NewDefaultChunkBytesPool(maxChunkPoolBytes uint64) (pool.Bytes, error) {
-	return pool.NewBucketedBytes(chunkBytesPoolMinSize, chunkBytesPoolMaxSize, 2, maxChunkPoolBytes)
+	return NewChunkBytesPool(DefaultChunkBytesPoolMinSize, DefaultChunkBytesPoolMaxSize, maxChunkPoolBytes)
+}
+
+// NewChunkBytesPool returns a chunk bytes pool with buckets of byte slices doubling in size from minBucketSize
+// to maxBucketSize. Chunk byte slices larger than maxBucketSize are allocated for each request.
+func NewChunkBytesPool(minBucketSize, maxBucketSize int, maxChunkPoolBytes uint64) (pool.Bytes, error) {
+	if minBucketSize > maxBucketSize {
+		return nil, errors.Errorf("minimum chunk pool bucket size %d is larger than maximum bucket size %d", minBucketSize, maxBucketSize)
+	}
+	return pool.NewBucketedBytes(minBucketSize, maxBucketSize, 2, maxChunkPoolBytes)
 }
@@ -4,10 +4,13 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -17,6 +20,7 @@ import (
 	"github.com/gogo/status"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
@@ -204,6 +208,7 @@ func prepareStoreWithTestBlocks(t testing.TB, dir string, bkt objstore.Bucket, m
 	defer func() { testutil.Ok(t, store.Close()) }()
 
 	s.store = store
+	enableChunkPoolLeakCheck(t, s.store)
 
 	if manyParts {
 		s.store.partitioner = naivePartitioner{}
@@ -681,6 +686,190 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_TenantLimits_e2e(t *testing.T) {
+	// The query will fetch 2 series from 3 blocks of each of the tenants, so we do expect to hit a total of 6 chunks per
+	// tenant. The blocks of the tenant value2 do not have the ext1 label.
+	expectedChunks := uint64(2 * 3)
+
+	for testName, testData := range map[string]struct {
+		limits         string
+		expectedErr    string
+		expectedTenant string
+		expectedReason string
+	}{
+		"should succeed if the limits of the tenants are not exceeded": {
+			limits: fmt.Sprintf("{default: {max_chunks: %d}, tenants: {value1: {max_chunks: %d}}}", expectedChunks, expectedChunks),
+		},
+		"should fail if the chunks limit of a tenant is exceeded": {
+			limits:         fmt.Sprintf("{tenants: {value1: {max_chunks: %d}}}", expectedChunks-1),
+			expectedErr:    "tenant value1 exceeded chunks limit",
+			expectedTenant: "value1",
+			expectedReason: "chunks",
+		},
+		"should fail if the default limits of a tenant without limits are exceeded": {
+			limits:         "{default: {max_series: 1}, tenants: {default-tenant: {max_series: 100}}}",
+			expectedErr:    "tenant value1 exceeded series limit",
+			expectedTenant: "value1",
+			expectedReason: "series",
+		},
+		"should fail if the bytes touched limit of a tenant is exceeded": {
+			limits:         "{tenants: {value1: {max_bytes_touched: 100B}}}",
+			expectedErr:    "tenant value1 exceeded bytes touched limit",
+			expectedTenant: "value1",
+			expectedReason: "bytes",
+		},
+		"should account the blocks without the tenant label to the default tenant": {
+			limits:         "{default: {max_series: 1}, tenants: {value1: {max_series: 100}}}",
+			expectedErr:    "tenant default-tenant exceeded series limit",
+			expectedTenant: defaultTenant,
+			expectedReason: "series",
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			bkt := objstore.NewInMemBucket()
+
+			dir, err := ioutil.TempDir("", "test_bucket_tenant_limits_e2e")
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+			s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+			testutil.Ok(t, s.store.SyncBlocks(ctx))
+
+			limits, err := ParseTenantLimitsConfig("ext1", []byte(testData.limits))
+			testutil.Ok(t, err)
+			s.store.SetTenantLimits(limits)
+
+			req := &storepb.SeriesRequest{
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				},
+				MinTime: minTimeDuration.PrometheusTimestamp(),
+				MaxTime: maxTimeDuration.PrometheusTimestamp(),
+			}
+
+			s.cache.SwapWith(noopCache{})
+			srv := newStoreSeriesServer(ctx)
+			err = s.store.Series(req, srv)
+
+			if testData.expectedErr == "" {
+				testutil.Ok(t, err)
+				return
+			}
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.Contains(err.Error(), testData.expectedErr), err.Error())
+			status, ok := status.FromError(err)
+			testutil.Equals(t, true, ok)
+			testutil.Equals(t, codes.ResourceExhausted, status.Code())
+			testutil.Equals(t, 1.0, promtest.ToFloat64(s.store.metrics.tenantQueriesDropped.WithLabelValues(testData.expectedTenant, testData.expectedReason)))
+		})
+	}
+}
+
+func TestBucketStore_DeletionMarks_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucket_deletion_marks_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1", "b", "1"),
+		labels.FromStrings("a", "1", "b", "2"),
+		labels.FromStrings("a", "2", "b", "1"),
+		labels.FromStrings("a", "2", "b", "2"),
+		labels.FromStrings("a", "1", "c", "1"),
+		labels.FromStrings("a", "1", "c", "2"),
+		labels.FromStrings("a", "2", "c", "1"),
+		labels.FromStrings("a", "2", "c", "2"),
+	}
+	minTime, maxTime := prepareTestBlocks(t, time.Now(), 1, dir, bkt, series, labels.FromStrings("ext1", "value1"))
+
+	// Two replicas of the store serving the same bucket.
+	const delay = time.Hour
+	var replicas []*BucketStore
+	for i := 0; i < 2; i++ {
+		replicaDir := filepath.Join(dir, fmt.Sprintf("replica-%d", i))
+		filter := block.NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), delay, 1)
+		metaFetcher, err := block.NewMetaFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), replicaDir, nil, []block.MetadataFilter{filter})
+		testutil.Ok(t, err)
+
+		store, err := NewBucketStore(
+			objstore.WithNoopInstr(bkt),
+			metaFetcher,
+			replicaDir,
+			NewChunksLimiterFactory(0),
+			NewSeriesLimiterFactory(0),
+			NewGapBasedPartitioner(PartitionerMaxGapSize),
+			20,
+			true,
+			DefaultPostingOffsetInMemorySampling,
+			true,
+			false,
+			0,
+			WithRegistry(prometheus.NewRegistry()),
+			WithDeletionMarkFilter(filter),
+		)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, store.Close()) }()
+
+		testutil.Ok(t, store.SyncBlocks(ctx))
+		replicas = append(replicas, store)
+	}
+
+	// Mark the block with the ext1 label for deletion, so that its mark gets older than the delay in a few seconds.
+	var id ulid.ULID
+	for _, b := range replicas[0].blocks {
+		if b.meta.Thanos.Labels["ext1"] == "value1" {
+			id = b.meta.ULID
+		}
+	}
+	expiry := time.Now().Add(2 * time.Second)
+	mark, err := json.Marshal(metadata.DeletionMark{
+		ID:           id,
+		Version:      metadata.DeletionMarkVersion1,
+		DeletionTime: expiry.Add(-delay).Unix(),
+	})
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.DeletionMarkFilename), bytes.NewReader(mark)))
+
+	seriesCount := func(store *BucketStore) int {
+		srv := newStoreSeriesServer(ctx)
+		testutil.Ok(t, store.Series(&storepb.SeriesRequest{
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+			MinTime:  minTime,
+			MaxTime:  maxTime,
+		}, srv))
+		return len(srv.SeriesSet)
+	}
+
+	// Both replicas serve the block until its mark gets older than the delay.
+	for _, store := range replicas {
+		testutil.Ok(t, store.SyncBlocks(ctx))
+		testutil.Equals(t, 2, len(store.blocks))
+		testutil.Equals(t, 4, seriesCount(store))
+	}
+
+	// Both replicas stop serving the block once its mark gets older than the delay, without syncing.
+	time.Sleep(time.Until(expiry.Truncate(time.Second).Add(time.Second)))
+	for _, store := range replicas {
+		testutil.Equals(t, 2, len(store.blocks))
+		testutil.Equals(t, 2, seriesCount(store))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(store.metrics.deletionMarkedBlocksExcluded))
+	}
+
+	// The next sync drops the block.
+	for _, store := range replicas {
+		testutil.Ok(t, store.SyncBlocks(ctx))
+		testutil.Equals(t, 1, len(store.blocks))
+		testutil.Equals(t, 2, seriesCount(store))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(store.metrics.deletionMarkedBlockDrops))
+	}
+}
+
 func TestBucketStore_LabelNames_e2e(t *testing.T) {
 	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithCancel(context.Background())
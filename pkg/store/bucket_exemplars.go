@@ -0,0 +1,170 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+)
+
+// Exemplars returns the exemplars of the series matching the query within the requested time range, from the
+// exemplars files uploaded along with the blocks. The exemplars of a series are sent once per block having them, the
+// querier merges them with the ones of other blocks and stores.
+func (s *BucketStore) Exemplars(req *exemplarspb.ExemplarsRequest, srv exemplarspb.Exemplars_ExemplarsServer) error {
+	expr, err := parser.ParseExpr(req.Query)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	selectors := parser.ExtractSelectors(expr)
+	mint, maxt := s.limitMinTime(req.Start), s.limitMaxTime(req.End)
+
+	s.mtx.RLock()
+	blocks := make([]*bucketBlock, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		if block.HasExemplars(b.meta) && b.overlapsClosedInterval(mint, maxt) {
+			blocks = append(blocks, b)
+		}
+	}
+	s.mtx.RUnlock()
+
+	for _, b := range blocks {
+		data, err := b.exemplars(srv.Context(), selectors, mint, maxt)
+		if err != nil {
+			return status.Error(codes.Internal, errors.Wrapf(err, "get exemplars of block %s", b.meta.ULID).Error())
+		}
+		for _, d := range data {
+			if err := srv.Send(exemplarspb.NewExemplarsResponse(d)); err != nil {
+				return status.Error(codes.Unknown, errors.Wrap(err, "send exemplars response").Error())
+			}
+		}
+	}
+	return nil
+}
+
+// exemplars returns the exemplars of the block within the given closed time range, of the series matching any of the
+// given selectors.
+func (b *bucketBlock) exemplars(ctx context.Context, selectors [][]*labels.Matcher, mint, maxt int64) ([]*exemplarspb.ExemplarData, error) {
+	var blockSelectors [][]*labels.Matcher
+	for _, ms := range selectors {
+		if bms, ok := b.extLabelsMatchers(ms); ok {
+			blockSelectors = append(blockSelectors, bms)
+		}
+	}
+	if len(blockSelectors) == 0 {
+		return nil, nil
+	}
+
+	f, err := b.loadExemplars(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	indexr := b.indexReader()
+	defer runutil.CloseWithLogOnErr(b.logger, indexr, "close exemplars index reader")
+
+	// As of version two all series entries are 16 byte padded, the index reader expects their offsets rather than
+	// the references of the exemplars file.
+	version, err := b.indexHeaderReader.IndexVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "get index version")
+	}
+	refs := f.Refs()
+	offsets := make([]storage.SeriesRef, 0, len(refs))
+	for _, ref := range refs {
+		if version >= 2 {
+			ref *= 16
+		}
+		offsets = append(offsets, ref)
+	}
+	if err := indexr.PreloadSeries(ctx, offsets); err != nil {
+		return nil, errors.Wrap(err, "preload series")
+	}
+
+	var (
+		res        []*exemplarspb.ExemplarData
+		symbolized []symbolizedLabel
+		chks       []chunks.Meta
+		lset       labels.Labels
+	)
+	for i, ref := range refs {
+		if _, err := indexr.LoadSeriesForTime(offsets[i], &symbolized, &chks, true, math.MinInt64, math.MaxInt64); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+		if err := indexr.LookupLabelsSymbols(symbolized, &lset); err != nil {
+			return nil, errors.Wrap(err, "lookup labels symbols")
+		}
+		if !matchesAnySelector(lset, blockSelectors) {
+			continue
+		}
+
+		exemplars, err := f.Exemplars(ref, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+		if len(exemplars) == 0 {
+			continue
+		}
+		res = append(res, &exemplarspb.ExemplarData{
+			SeriesLabels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labelpb.ExtendSortedLabels(lset, b.extLset))},
+			Exemplars:    exemplarspb.ExemplarsFromPromExemplars(exemplars),
+		})
+	}
+	return res, nil
+}
+
+// loadExemplars returns the exemplars file of the block, downloading it on first use.
+func (b *bucketBlock) loadExemplars(ctx context.Context) (*block.ExemplarsFile, error) {
+	b.exemplarsMtx.Lock()
+	defer b.exemplarsMtx.Unlock()
+
+	if b.exemplarsFile != nil {
+		return b.exemplarsFile, nil
+	}
+
+	r, err := b.bkt.Get(ctx, path.Join(b.meta.ULID.String(), block.ExemplarsFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "get exemplars file")
+	}
+	defer runutil.CloseWithLogOnErr(b.logger, r, "close exemplars file reader")
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read exemplars file")
+	}
+	f, err := block.DecodeExemplars(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode exemplars file")
+	}
+	b.exemplarsFile = f
+	return f, nil
+}
+
+// matchesAnySelector returns true if the labels match all matchers of any of the given selectors.
+func matchesAnySelector(lset labels.Labels, selectors [][]*labels.Matcher) bool {
+Selectors:
+	for _, ms := range selectors {
+		for _, m := range ms {
+			if !m.Matches(lset.Get(m.Name)) {
+				continue Selectors
+			}
+		}
+		return true
+	}
+	return false
+}
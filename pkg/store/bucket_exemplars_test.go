@@ -0,0 +1,159 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+type exemplarsTestServer struct {
+	exemplarspb.Exemplars_ExemplarsServer
+
+	data []*exemplarspb.ExemplarData
+}
+
+func (s *exemplarsTestServer) Send(r *exemplarspb.ExemplarsResponse) error {
+	s.data = append(s.data, r.GetData())
+	return nil
+}
+
+func (s *exemplarsTestServer) Context() context.Context {
+	return context.Background()
+}
+
+func TestBucketStore_Exemplars(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b"),
+		labels.FromStrings("__name__", "down", "job", "a"),
+	}
+	ex := func(ts int64, traceID string) exemplar.Exemplar {
+		return exemplar.Exemplar{Labels: labels.FromStrings("trace_id", traceID), Value: 1, Ts: ts, HasTs: true}
+	}
+	for _, b := range []struct {
+		mint, maxt int64
+		exemplars  []exemplar.QueryResult
+	}{
+		{mint: 0, maxt: 1000, exemplars: []exemplar.QueryResult{
+			{SeriesLabels: series[0], Exemplars: []exemplar.Exemplar{ex(100, "a1"), ex(500, "a2")}},
+			{SeriesLabels: series[2], Exemplars: []exemplar.Exemplar{ex(100, "c1")}},
+		}},
+		{mint: 1000, maxt: 2000, exemplars: []exemplar.QueryResult{
+			{SeriesLabels: series[0], Exemplars: []exemplar.Exemplar{ex(1500, "a3")}},
+		}},
+		// Blocks without exemplars are not read.
+		{mint: 2000, maxt: 3000},
+	} {
+		id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 10, b.mint, b.maxt, labels.FromStrings("ext1", "1"), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		bdir := filepath.Join(tmpDir, id.String())
+		_, err = block.WriteExemplars(logger, bdir, b.exemplars)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, bdir, metadata.NoneFunc))
+	}
+
+	ibkt := objstore.WithNoopInstr(bkt)
+	f, err := block.NewRawMetaFetcher(logger, ibkt)
+	testutil.Ok(t, err)
+	st, err := NewBucketStore(
+		ibkt,
+		f,
+		filepath.Join(tmpDir, "store"),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithLogger(logger),
+	)
+	testutil.Ok(t, err)
+	testutil.Ok(t, st.SyncBlocks(ctx))
+
+	expected := func(lset labels.Labels, exemplars ...exemplar.Exemplar) *exemplarspb.ExemplarData {
+		return &exemplarspb.ExemplarData{
+			SeriesLabels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labelpb.ExtendSortedLabels(lset, labels.FromStrings("ext1", "1")))},
+			Exemplars:    exemplarspb.ExemplarsFromPromExemplars(exemplars),
+		}
+	}
+	for _, tcase := range []struct {
+		name       string
+		query      string
+		start, end int64
+		expected   []*exemplarspb.ExemplarData
+	}{
+		{
+			name:  "all blocks",
+			query: `up{job="a"}`,
+			start: 0,
+			end:   3000,
+			expected: []*exemplarspb.ExemplarData{
+				expected(series[0], ex(100, "a1"), ex(500, "a2")),
+				expected(series[0], ex(1500, "a3")),
+			},
+		},
+		{
+			name:     "time range",
+			query:    `up`,
+			start:    400,
+			end:      1000,
+			expected: []*exemplarspb.ExemplarData{expected(series[0], ex(500, "a2"))},
+		},
+		{
+			name:  "multiple selectors",
+			query: `up{job="a"} / down`,
+			start: 0,
+			end:   1000,
+			expected: []*exemplarspb.ExemplarData{
+				expected(series[0], ex(100, "a1"), ex(500, "a2")),
+				expected(series[2], ex(100, "c1")),
+			},
+		},
+		{
+			name:  "external labels",
+			query: `up{ext1="2"}`,
+			start: 0,
+			end:   3000,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			srv := &exemplarsTestServer{}
+			testutil.Ok(t, st.Exemplars(&exemplarspb.ExemplarsRequest{Query: tcase.query, Start: tcase.start, End: tcase.end}, srv))
+			testutil.Equals(t, len(tcase.expected), len(srv.data))
+			for _, e := range tcase.expected {
+				found := false
+				for _, d := range srv.data {
+					if d.Compare(e) == 0 {
+						found = true
+					}
+				}
+				testutil.Assert(t, found, "expected exemplars %v not found in %v", e, srv.data)
+			}
+		})
+	}
+
+	testutil.NotOk(t, st.Exemplars(&exemplarspb.ExemplarsRequest{Query: `up{`}, &exemplarsTestServer{}))
+}
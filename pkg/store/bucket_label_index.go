@@ -0,0 +1,192 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"path"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// WithLabelIndexMaxSize makes the BucketStore answer label names and values requests without matchers from the label
+// index files of the blocks up to the given size in bytes. Larger label index files are not downloaded.
+func WithLabelIndexMaxSize(bytes int64) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.labelIndexMaxSize = bytes
+	}
+}
+
+// WithLabelIndexCacheSize sets the total size in bytes of the label index files kept in memory by the BucketStore,
+// dropping the least recently used ones to make room for others. Label index files are not used if it is 0.
+func WithLabelIndexCacheSize(bytes int64) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.labelIndexCacheSize = bytes
+	}
+}
+
+// labelIndexCache keeps the most recently used label index files of the blocks in memory, up to a total size.
+type labelIndexCache struct {
+	maxSize int64
+
+	mtx     sync.Mutex
+	lru     *lru.LRU
+	curSize int64
+}
+
+func newLabelIndexCache(maxSize int64) *labelIndexCache {
+	c := &labelIndexCache{maxSize: maxSize}
+	// Evictions are managed by size using RemoveOldest.
+	c.lru, _ = lru.NewLRU(math.MaxInt32, func(_, val interface{}) {
+		c.curSize -= int64(val.(*block.LabelIndexFile).Size())
+	})
+	return c
+}
+
+func (c *labelIndexCache) get(id ulid.ULID) *block.LabelIndexFile {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if f, ok := c.lru.Get(id); ok {
+		return f.(*block.LabelIndexFile)
+	}
+	return nil
+}
+
+// set adds the label index file of the block, evicting the least recently used ones until it fits.
+func (c *labelIndexCache) set(id ulid.ULID, f *block.LabelIndexFile) {
+	size := int64(f.Size())
+	if size > c.maxSize {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lru.Remove(id)
+	for c.curSize+size > c.maxSize {
+		c.lru.RemoveOldest()
+	}
+	c.lru.Add(id, f)
+	c.curSize += size
+}
+
+func (c *labelIndexCache) remove(id ulid.ULID) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lru.Remove(id)
+}
+
+// labelNames returns the label names of the series of the block, sorted, from its label index file if it has one, or
+// its index header otherwise. It tells whether the label index file was used.
+func (b *bucketBlock) labelNames(ctx context.Context) ([]string, bool, error) {
+	if f := b.loadLabelIndex(ctx); f != nil {
+		return f.LabelNames(), true, nil
+	}
+	res, err := b.indexHeaderReader.LabelNames()
+	return res, false, err
+}
+
+// labelValues returns the values of the label name of the series of the block, sorted, from its label index file if
+// it has one, or its index header otherwise. It tells whether the label index file was used.
+func (b *bucketBlock) labelValues(ctx context.Context, name string) ([]string, bool, error) {
+	if f := b.loadLabelIndex(ctx); f != nil {
+		res, err := f.LabelValues(name)
+		if err == nil {
+			return res, true, nil
+		}
+		level.Warn(b.logger).Log("msg", "failed to read label values from label index file, falling back to index-header", "name", name, "err", err)
+	}
+	res, err := b.indexHeaderReader.LabelValues(name)
+	return res, false, err
+}
+
+// loadLabelIndex returns the label index file of the block from the label index cache, downloading it if it is not
+// there. It returns nil if the block has no label index file, if it is larger than the maximum size, or if it cannot
+// be downloaded or decoded, so that the index header is used instead. Label index files which cannot be decoded, e.g.
+// of an unknown version, are not downloaded again. Concurrent requests wait for the download of the first one.
+func (b *bucketBlock) loadLabelIndex(ctx context.Context) *block.LabelIndexFile {
+	size, ok := block.LabelIndexSize(b.meta)
+	if !ok || size > b.labelIndexMaxSize || size > b.labelIndexCache.maxSize {
+		return nil
+	}
+
+	b.labelIndexMtx.Lock()
+	if b.labelIndexInvalid {
+		b.labelIndexMtx.Unlock()
+		return nil
+	}
+	if f := b.labelIndexCache.get(b.meta.ULID); f != nil {
+		b.labelIndexMtx.Unlock()
+		return f
+	}
+	if loading := b.labelIndexLoading; loading != nil {
+		b.labelIndexMtx.Unlock()
+		select {
+		case <-loading:
+			return b.labelIndexCache.get(b.meta.ULID)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	loading := make(chan struct{})
+	b.labelIndexLoading = loading
+	b.labelIndexMtx.Unlock()
+
+	f, invalid := b.downloadLabelIndex(ctx)
+
+	b.labelIndexMtx.Lock()
+	defer b.labelIndexMtx.Unlock()
+
+	if f != nil {
+		b.labelIndexCache.set(b.meta.ULID, f)
+	}
+	b.labelIndexInvalid = invalid
+	b.labelIndexLoading = nil
+	close(loading)
+	return f
+}
+
+// downloadLabelIndex downloads and decodes the label index file of the block. It tells whether the file is invalid if
+// it cannot be decoded.
+func (b *bucketBlock) downloadLabelIndex(ctx context.Context) (*block.LabelIndexFile, bool) {
+	buf, err := b.readLabelIndex(ctx)
+	if err != nil {
+		level.Warn(b.logger).Log("msg", "failed to download label index file, falling back to index-header", "err", err)
+		return nil, false
+	}
+	f, err := block.DecodeLabelIndex(buf)
+	if err != nil {
+		level.Warn(b.logger).Log("msg", "failed to decode label index file, falling back to index-header", "err", err)
+		return nil, true
+	}
+	return f, false
+}
+
+func (b *bucketBlock) readLabelIndex(ctx context.Context) ([]byte, error) {
+	r, err := b.bkt.Get(ctx, path.Join(b.meta.ULID.String(), block.LabelIndexFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "get label index file")
+	}
+	defer runutil.CloseWithLogOnErr(b.logger, r, "close label index file reader")
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read label index file")
+	}
+	return buf, nil
+}
@@ -0,0 +1,290 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+// prepareLabelIndexBucket uploads the given number of blocks of the given series, with a label index file if
+// withLabelIndex is true.
+func prepareLabelIndexBucket(t testing.TB, numBlocks int, series []labels.Labels, withLabelIndex bool) objstore.Bucket {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	for i := 0; i < numBlocks; i++ {
+		mint := int64(i) * 1000
+		id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 10, mint, mint+1000, labels.FromStrings("ext1", "1"), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		bdir := filepath.Join(tmpDir, id.String())
+		if withLabelIndex {
+			testutil.Ok(t, block.WriteLabelIndex(logger, bdir))
+		}
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, bdir, metadata.NoneFunc))
+	}
+	return bkt
+}
+
+// copyLabelIndexBlock uploads copies of the only block of the bucket with new IDs and following time ranges, until
+// the bucket has the given number of blocks.
+func copyLabelIndexBlock(t testing.TB, bkt objstore.Bucket, numBlocks int) {
+	ctx := context.Background()
+
+	objs := map[string][]byte{}
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		r, err := bkt.Get(ctx, name)
+		testutil.Ok(t, err)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		testutil.Ok(t, err)
+		objs[name] = b
+		return nil
+	}, objstore.WithRecursiveIter))
+
+	var meta *metadata.Meta
+	for name, b := range objs {
+		if path.Base(name) == metadata.MetaFilename {
+			meta = &metadata.Meta{}
+			testutil.Ok(t, json.Unmarshal(b, meta))
+		}
+	}
+	testutil.Assert(t, meta != nil, "no block in bucket")
+
+	src := meta.ULID.String()
+	duration := meta.MaxTime - meta.MinTime
+	for i := 1; i < numBlocks; i++ {
+		m := *meta
+		m.ULID = ulid.MustNew(uint64(i), nil)
+		m.MinTime = meta.MinTime + int64(i)*duration
+		m.MaxTime = m.MinTime + duration
+		for name, b := range objs {
+			if path.Base(name) == metadata.MetaFilename {
+				var err error
+				b, err = json.Marshal(&m)
+				testutil.Ok(t, err)
+			}
+			testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), strings.TrimPrefix(name, src+"/")), bytes.NewReader(b)))
+		}
+	}
+}
+
+// newLabelIndexStore returns a store with lazy index headers synced with the blocks of the bucket, using their label
+// index files up to the given size.
+func newLabelIndexStore(t testing.TB, bkt objstore.Bucket, labelIndexMaxSize int64) *BucketStore {
+	return newLabelIndexStoreWithDir(t, bkt, labelIndexMaxSize, t.TempDir())
+}
+
+func newLabelIndexStoreWithDir(t testing.TB, bkt objstore.Bucket, labelIndexMaxSize int64, dir string) *BucketStore {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	ibkt := objstore.WithNoopInstr(bkt)
+	f, err := block.NewRawMetaFetcher(logger, ibkt)
+	testutil.Ok(t, err)
+	st, err := NewBucketStore(
+		ibkt,
+		f,
+		dir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		true,
+		0,
+		WithLogger(logger),
+		WithLabelIndexMaxSize(labelIndexMaxSize),
+		WithLabelIndexCacheSize(1<<30),
+	)
+	testutil.Ok(t, err)
+	testutil.Ok(t, st.SyncBlocks(ctx))
+	return st
+}
+
+func TestBucketStore_LabelIndex(t *testing.T) {
+	ctx := context.Background()
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "up", "job", "b", "instance", "1"),
+		labels.FromStrings("__name__", "down", "job", "c"),
+	}
+
+	for _, withLabelIndex := range []bool{false, true} {
+		t.Run(fmt.Sprintf("label index=%v", withLabelIndex), func(t *testing.T) {
+			st := newLabelIndexStore(t, prepareLabelIndexBucket(t, 2, series, withLabelIndex), 1<<20)
+			expectedBlocks := 0.0
+			if withLabelIndex {
+				expectedBlocks = 2
+			}
+
+			names, err := st.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 0, End: 2000})
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"__name__", "ext1", "instance", "job"}, names.Names)
+			testutil.Equals(t, expectedBlocks, promtest.ToFloat64(st.metrics.labelIndexBlocks.WithLabelValues("label_names")))
+
+			values, err := st.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "job", Start: 0, End: 2000})
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a", "b", "c"}, values.Values)
+			testutil.Equals(t, expectedBlocks, promtest.ToFloat64(st.metrics.labelIndexBlocks.WithLabelValues("label_values")))
+
+			values, err = st.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "missing", Start: 0, End: 2000})
+			testutil.Ok(t, err)
+			testutil.Equals(t, 0, len(values.Values))
+
+			// Requests with matchers are answered from the index of the blocks.
+			values, err = st.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "job", Start: 0, End: 2000, Matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			}})
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a", "b"}, values.Values)
+			testutil.Equals(t, 2*expectedBlocks, promtest.ToFloat64(st.metrics.labelIndexBlocks.WithLabelValues("label_values")))
+		})
+	}
+}
+
+func TestBucketStore_LabelIndexFallback(t *testing.T) {
+	ctx := context.Background()
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a"),
+		labels.FromStrings("__name__", "down", "job", "b"),
+	}
+
+	for _, tcase := range []struct {
+		name              string
+		labelIndexMaxSize int64
+		labelIndex        func(b []byte) []byte
+	}{
+		{name: "disabled", labelIndexMaxSize: 0},
+		{name: "larger than the maximum size", labelIndexMaxSize: 1},
+		{name: "unknown version", labelIndexMaxSize: 1 << 20, labelIndex: func(b []byte) []byte {
+			b[4] = block.LabelIndexFormatV1 + 1
+			return b
+		}},
+		{name: "corrupted", labelIndexMaxSize: 1 << 20, labelIndex: func(b []byte) []byte { return b[:len(b)/2] }},
+		{name: "missing", labelIndexMaxSize: 1 << 20, labelIndex: func([]byte) []byte { return nil }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			bkt := prepareLabelIndexBucket(t, 1, series, true)
+			if tcase.labelIndex != nil {
+				testutil.Ok(t, bkt.Iter(ctx, "", func(dir string) error {
+					name := path.Join(dir, block.LabelIndexFilename)
+					r, err := bkt.Get(ctx, name)
+					testutil.Ok(t, err)
+					b, err := ioutil.ReadAll(r)
+					testutil.Ok(t, err)
+					testutil.Ok(t, r.Close())
+					if b = tcase.labelIndex(b); b == nil {
+						return bkt.Delete(ctx, name)
+					}
+					return bkt.Upload(ctx, name, bytes.NewReader(b))
+				}))
+			}
+			st := newLabelIndexStore(t, bkt, tcase.labelIndexMaxSize)
+
+			// The requests are answered from the index-header of the block, every time.
+			for i := 0; i < 2; i++ {
+				names, err := st.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 0, End: 1000})
+				testutil.Ok(t, err)
+				testutil.Equals(t, []string{"__name__", "ext1", "job"}, names.Names)
+
+				values, err := st.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "job", Start: 0, End: 1000})
+				testutil.Ok(t, err)
+				testutil.Equals(t, []string{"a", "b"}, values.Values)
+			}
+			testutil.Equals(t, 0.0, promtest.ToFloat64(st.metrics.labelIndexBlocks.WithLabelValues("label_names")))
+			testutil.Equals(t, 0.0, promtest.ToFloat64(st.metrics.labelIndexBlocks.WithLabelValues("label_values")))
+		})
+	}
+}
+
+func TestLabelIndexCache(t *testing.T) {
+	f, err := block.DecodeLabelIndex(block.EncodeLabelIndex(1, []block.LabelNameIndex{{Name: "job", Values: []string{"a"}, Series: []uint64{1}}}))
+	testutil.Ok(t, err)
+	ids := []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)}
+
+	// The cache holds two files.
+	c := newLabelIndexCache(int64(2*f.Size() + 1))
+	c.set(ids[0], f)
+	c.set(ids[1], f)
+	testutil.Assert(t, c.get(ids[0]) == f)
+
+	// The least recently used file is evicted to make room for a new one.
+	c.set(ids[2], f)
+	testutil.Assert(t, c.get(ids[0]) == f)
+	testutil.Assert(t, c.get(ids[1]) == nil)
+	testutil.Assert(t, c.get(ids[2]) == f)
+	testutil.Equals(t, int64(2*f.Size()), c.curSize)
+
+	c.remove(ids[0])
+	testutil.Assert(t, c.get(ids[0]) == nil)
+	testutil.Equals(t, int64(f.Size()), c.curSize)
+
+	// Files larger than the cache are not kept.
+	c = newLabelIndexCache(int64(f.Size() - 1))
+	c.set(ids[0], f)
+	testutil.Assert(t, c.get(ids[0]) == nil)
+	testutil.Equals(t, int64(0), c.curSize)
+}
+
+func BenchmarkBucketStore_LabelValues_LabelIndex(b *testing.B) {
+	ctx := context.Background()
+	var series []labels.Labels
+	for i := 0; i < 1000; i++ {
+		series = append(series, labels.FromStrings("__name__", "metric", "i", fmt.Sprintf("%d", i), "j", fmt.Sprintf("%d", i%10)))
+	}
+
+	for _, numBlocks := range []int{20, 10000} {
+		for _, withLabelIndex := range []bool{false, true} {
+			b.Run(fmt.Sprintf("blocks=%d/label index=%v", numBlocks, withLabelIndex), func(b *testing.B) {
+				bkt := prepareLabelIndexBucket(b, 1, series, withLabelIndex)
+				copyLabelIndexBlock(b, bkt, numBlocks)
+				req := &storepb.LabelValuesRequest{Label: "j", Start: 0, End: int64(numBlocks) * 1000}
+				// The index headers are built once and kept on disk across stores.
+				dir := b.TempDir()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// Each request is the first one of a new store, so that the lazy index headers and label index
+					// files of the blocks are not loaded yet, like after they went idle.
+					b.StopTimer()
+					st := newLabelIndexStoreWithDir(b, bkt, 1<<20, dir)
+					b.StartTimer()
+
+					values, err := st.LabelValues(ctx, req)
+					testutil.Ok(b, err)
+					testutil.Equals(b, 10, len(values.Values))
+
+					b.StopTimer()
+					testutil.Ok(b, st.Close())
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
@@ -29,15 +29,16 @@ import (
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
 	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/thanos-io/objstore/providers/filesystem"
-	"go.uber.org/atomic"
 
 	"github.com/thanos-io/objstore"
 
@@ -47,6 +48,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/pool"
 	storecache "github.com/thanos-io/thanos/pkg/store/cache"
 	"github.com/thanos-io/thanos/pkg/store/hintspb"
@@ -211,7 +213,7 @@ func TestBucketBlock_matchLabels(t *testing.T) {
 		},
 	}
 
-	b, err := newBucketBlock(context.Background(), log.NewNopLogger(), newBucketStoreMetrics(nil), meta, bkt, path.Join(dir, blockID.String()), nil, nil, nil, nil)
+	b, err := newBucketBlock(context.Background(), log.NewNopLogger(), newBucketStoreMetrics(nil), meta, bkt, path.Join(dir, blockID.String()), nil, nil, nil)
 	testutil.Ok(t, err)
 
 	cases := []struct {
@@ -1276,7 +1278,7 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 	f, err := block.NewRawMetaFetcher(logger, ibkt)
 	testutil.Ok(t, err)
 
-	chunkPool, err := pool.NewBucketedBytes(chunkBytesPoolMinSize, chunkBytesPoolMaxSize, 2, 1e9) // 1GB.
+	chunkPool, err := pool.NewBucketedBytes(DefaultChunkBytesPoolMinSize, DefaultChunkBytesPoolMaxSize, 2, 1e9) // 1GB.
 	testutil.Ok(t, err)
 
 	st, err := NewBucketStore(
@@ -1298,7 +1300,7 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 	testutil.Ok(t, err)
 
 	if !t.IsBenchmark() {
-		st.chunkPool = &mockedPool{parent: st.chunkPool}
+		enableChunkPoolLeakCheck(t, st)
 	}
 
 	testutil.Ok(t, st.SyncBlocks(context.Background()))
@@ -1334,9 +1336,8 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 
 	if !t.IsBenchmark() {
 		if !skipChunk {
-			// TODO(bwplotka): This is wrong negative for large number of samples (1mln). Investigate.
-			testutil.Equals(t, 0, int(st.chunkPool.(*mockedPool).balance.Load()))
-			st.chunkPool.(*mockedPool).gets.Store(0)
+			borrowed, _ := st.chunkPool.(*pool.TrackedBytes).Borrowed()
+			testutil.Equals(t, 0, borrowed)
 		}
 
 		for _, b := range st.blocks {
@@ -1357,25 +1358,125 @@ func (m fakePool) Get(sz int) (*[]byte, error) {
 
 func (m fakePool) Put(_ *[]byte) {}
 
-type mockedPool struct {
-	parent  pool.Bytes
-	balance atomic.Uint64
-	gets    atomic.Uint64
+// enableChunkPoolLeakCheck makes the test fail if any chunk bytes borrowed by the store are not returned to its chunk pool
+// by the end of the test, or if they had to be released at the end of a Series call as they were not returned by the readers.
+func enableChunkPoolLeakCheck(t testing.TB, s *BucketStore) {
+	p := pool.NewTrackedBytes(s.chunkPool)
+	s.chunkPool = p
+
+	t.Cleanup(func() {
+		if slices, bytes := p.Borrowed(); slices > 0 {
+			t.Errorf("%d chunk byte slices of %d bytes in total were not returned to the chunk pool", slices, bytes)
+		}
+		if released := promtest.ToFloat64(s.metrics.chunkBytesReleased); released > 0 {
+			t.Errorf("%v chunk byte slices were not returned to the chunk pool by the readers of Series calls", released)
+		}
+	})
 }
 
-func (m *mockedPool) Get(sz int) (*[]byte, error) {
-	b, err := m.parent.Get(sz)
-	if err != nil {
-		return nil, err
+// slowSeriesServer is a Series server of a client reading the responses slowly. It records the chunk bytes borrowed
+// by the store each time a series is sent, and does not retain the responses, as gRPC servers encode them when sent.
+type slowSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	ctx      context.Context
+	delay    time.Duration
+	pool     *pool.TrackedBytes
+	series   int
+	borrowed []uint64
+}
+
+func (s *slowSeriesServer) Send(r *storepb.SeriesResponse) error {
+	if r.GetSeries() != nil {
+		s.series++
+		_, bytes := s.pool.Borrowed()
+		s.borrowed = append(s.borrowed, bytes)
 	}
-	m.balance.Add(uint64(cap(*b)))
-	m.gets.Add(uint64(1))
-	return b, nil
+	time.Sleep(s.delay)
+	return nil
+}
+
+func (s *slowSeriesServer) Context() context.Context {
+	return s.ctx
 }
 
-func (m *mockedPool) Put(b *[]byte) {
-	m.balance.Sub(uint64(cap(*b)))
-	m.parent.Put(b)
+func TestBucketStore_Series_SlowClientReleasesSentChunks(t *testing.T) {
+	const numSeries = 2000
+
+	tmpDir := t.TempDir()
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	var (
+		logger = log.NewNopLogger()
+		reg    = prometheus.NewRegistry()
+	)
+	head, _ := storetestutil.CreateHeadWithSeries(t, 0, storetestutil.HeadGenOptions{
+		TSDBDir:          filepath.Join(tmpDir, "head"),
+		SamplesPerSeries: 240,
+		Series:           numSeries,
+		Random:           rand.New(rand.NewSource(120)),
+	})
+	blockDir := filepath.Join(tmpDir, "tmp")
+	id := createBlockFromHead(t, blockDir, head)
+	testutil.Ok(t, head.Close())
+
+	meta, err := metadata.InjectThanos(logger, filepath.Join(blockDir, id.String()), metadata.Thanos{
+		Labels:     map[string]string{"ext1": "1"},
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.TestSource,
+	}, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, meta.WriteToDir(logger, filepath.Join(blockDir, id.String())))
+	testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(blockDir, id.String()), metadata.NoneFunc))
+
+	ibkt := objstore.WithNoopInstr(bkt)
+	f, err := block.NewRawMetaFetcher(logger, ibkt)
+	testutil.Ok(t, err)
+
+	chunkPool, err := pool.NewBucketedBytes(DefaultChunkBytesPoolMinSize, DefaultChunkBytesPoolMaxSize, 2, 1e9) // 1GB.
+	testutil.Ok(t, err)
+
+	st, err := NewBucketStore(
+		ibkt,
+		f,
+		tmpDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithLogger(logger),
+		WithRegistry(reg),
+		WithChunkPool(chunkPool),
+		WithSentChunksRelease(),
+	)
+	testutil.Ok(t, err)
+	enableChunkPoolLeakCheck(t, st)
+	testutil.Ok(t, st.SyncBlocks(context.Background()))
+
+	srv := &slowSeriesServer{ctx: context.Background(), delay: 100 * time.Microsecond, pool: st.chunkPool.(*pool.TrackedBytes)}
+	testutil.Ok(t, st.Series(&storepb.SeriesRequest{
+		MinTime:  math.MinInt64,
+		MaxTime:  math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"}},
+	}, srv))
+	testutil.Equals(t, numSeries, srv.series)
+
+	// The chunk bytes of the sent series are returned to the pool while the client reads the next ones, so the memory
+	// held by the call decreases as it progresses instead of being held until the last series is sent.
+	first, last := srv.borrowed[0], srv.borrowed[len(srv.borrowed)-1]
+	testutil.Assert(t, first > 0, "expected chunk bytes to be borrowed when sending the first series")
+	testutil.Assert(t, last <= first/10, "expected most chunk bytes to be released before sending the last series, borrowed %d bytes at first and %d at last", first, last)
+
+	stall := gatherFamily(t, reg, "thanos_bucket_store_series_send_stall_duration_seconds").Metric[0].GetHistogram()
+	testutil.Equals(t, uint64(1), stall.GetSampleCount())
+	testutil.Assert(t, stall.GetSampleSum() >= (numSeries*100*time.Microsecond).Seconds(), "expected send stall to include the time the client took to read the series")
 }
 
 // Regression test against: https://github.com/thanos-io/thanos/issues/2147.
@@ -1395,7 +1496,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		Source:     metadata.TestSource,
 	}
 
-	chunkPool, err := pool.NewBucketedBytes(chunkBytesPoolMinSize, chunkBytesPoolMaxSize, 2, 100e7)
+	chunkPool, err := pool.NewBucketedBytes(DefaultChunkBytesPoolMinSize, DefaultChunkBytesPoolMaxSize, 2, 100e7)
 	testutil.Ok(t, err)
 
 	indexCache, err := storecache.NewInMemoryIndexCacheWithConfig(logger, nil, storecache.InMemoryIndexCacheConfig{
@@ -1448,7 +1549,6 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 			meta:        meta,
 			partitioner: NewGapBasedPartitioner(PartitionerMaxGapSize),
 			chunkObjs:   []string{filepath.Join(id.String(), "chunks", "000001")},
-			chunkPool:   chunkPool,
 		}
 		b1.indexHeaderReader, err = indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, b1.meta.ULID, DefaultPostingOffsetInMemorySampling)
 		testutil.Ok(t, err)
@@ -1487,7 +1587,6 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 			meta:        meta,
 			partitioner: NewGapBasedPartitioner(PartitionerMaxGapSize),
 			chunkObjs:   []string{filepath.Join(id.String(), "chunks", "000001")},
-			chunkPool:   chunkPool,
 		}
 		b2.indexHeaderReader, err = indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, b2.meta.ULID, DefaultPostingOffsetInMemorySampling)
 		testutil.Ok(t, err)
@@ -1497,8 +1596,9 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		bkt:             objstore.WithNoopInstr(bkt),
 		logger:          logger,
 		indexCache:      indexCache,
-		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, indexheader.NewReaderPoolMetrics(nil)),
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, false, indexheader.NewReaderPoolMetrics(nil)),
 		metrics:         newBucketStoreMetrics(nil),
+		chunkPool:       chunkPool,
 		blockSets: map[uint64]*bucketBlockSet{
 			labels.Labels{{Name: "ext1", Value: "1"}}.Hash(): {blocks: [][]*bucketBlock{{b1, b2}}},
 		},
@@ -1628,6 +1728,42 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 	storetestutil.TestServerSeries(tb, store, testCases...)
 }
 
+func TestSeries_QueryStatsResponseHints(t *testing.T) {
+	_, store, seriesSet1, seriesSet2, block1, block2, close := setupStoreForHintsTest(t)
+	defer close()
+
+	req := &storepb.SeriesRequest{
+		MinTime: 0,
+		MaxTime: 3,
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"},
+		},
+		Hints: mustMarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: true}),
+	}
+	srv := newStoreSeriesServer(context.Background())
+	testutil.Ok(t, store.Series(req, srv))
+	testutil.Equals(t, len(seriesSet1)+len(seriesSet2), len(srv.SeriesSet))
+	testutil.Equals(t, 1, len(srv.HintsSet))
+
+	hints := hintspb.SeriesResponseHints{}
+	testutil.Ok(t, types.UnmarshalAny(srv.HintsSet[0], &hints))
+	testutil.Equals(t, 2, len(hints.BlockStats))
+	var ids []string
+	for i, s := range hints.BlockStats {
+		ids = append(ids, s.BlockId)
+		testutil.Assert(t, s.PostingsTouched > 0, "expected touched postings for block %s", s.BlockId)
+		testutil.Assert(t, s.SeriesFetched > 0, "expected fetched series for block %s", s.BlockId)
+		testutil.Assert(t, s.ChunksFetched > 0, "expected fetched chunks for block %s", s.BlockId)
+		if i > 0 {
+			testutil.Assert(t, hints.BlockStats[i-1].FetchDuration() >= s.FetchDuration(), "expected blocks ordered by cost")
+		}
+	}
+	sort.Strings(ids)
+	expected := []string{block1.String(), block2.String()}
+	sort.Strings(expected)
+	testutil.Equals(t, expected, ids)
+}
+
 func TestSeries_ErrorUnmarshallingRequestHints(t *testing.T) {
 	tb := testutil.NewTB(t)
 
@@ -1819,6 +1955,198 @@ func TestSeries_BlockWithMultipleChunks(t *testing.T) {
 	}
 }
 
+func TestSeries_ChunkSlicing(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := log.NewNopLogger()
+
+	// Create a block with a counter scraped every 15s for 4h, which resets at every 110th sample,
+	// so that a 5m query spans the boundary between two chunks and a counter reset.
+	headOpts := tsdb.DefaultHeadOptions()
+	headOpts.ChunkDirRoot = filepath.Join(tmpDir, "block")
+	headOpts.ChunkRange = 10000000000
+
+	h, err := tsdb.NewHead(nil, nil, nil, headOpts, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, h.Close()) }()
+
+	const scrapeInterval = int64(15000)
+	series := labels.FromStrings("__name__", "requests_total")
+	for i := int64(0); i < 960; i++ {
+		app := h.Appender(context.Background())
+		_, err := app.Append(0, series, i*scrapeInterval, float64(i%110))
+		testutil.Ok(t, err)
+		testutil.Ok(t, app.Commit())
+	}
+	blk := createBlockFromHead(t, headOpts.ChunkDirRoot, h)
+	_, err = metadata.InjectThanos(logger, filepath.Join(headOpts.ChunkDirRoot, blk.String()), metadata.Thanos{
+		Labels:     labels.Labels{{Name: "ext1", Value: "1"}}.Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.TestSource,
+	}, nil)
+	testutil.Ok(t, err)
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(headOpts.ChunkDirRoot, blk.String()), metadata.NoneFunc))
+
+	fetcher, err := block.NewMetaFetcher(logger, 10, bkt, tmpDir, nil, nil)
+	testutil.Ok(t, err)
+	store, err := NewBucketStore(
+		bkt,
+		fetcher,
+		tmpDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		10,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		true,
+		false,
+		0,
+		WithLogger(logger),
+		WithRegistry(prometheus.NewRegistry()),
+	)
+	testutil.Ok(t, err)
+	testutil.Ok(t, store.SyncBlocks(context.Background()))
+
+	var (
+		minTime = 100 * scrapeInterval
+		maxTime = 120 * scrapeInterval
+	)
+	querySeries := func(hints *hintspb.SeriesRequestHints) (*storeSeriesServer, []sample) {
+		req := &storepb.SeriesRequest{
+			MinTime:  minTime,
+			MaxTime:  maxTime,
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "requests_total"}},
+		}
+		if hints != nil {
+			req.Hints = mustMarshalAny(hints)
+		}
+		srv := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, store.Series(req, srv))
+		testutil.Equals(t, 1, len(srv.SeriesSet))
+
+		var samples []sample
+		for _, c := range srv.SeriesSet[0].Chunks {
+			chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+			testutil.Ok(t, err)
+			it := chk.Iterator(nil)
+			for it.Next() {
+				ts, v := it.At()
+				testutil.Assert(t, ts >= c.MinTime && ts <= c.MaxTime, "sample %d outside of chunk time range [%d, %d]", ts, c.MinTime, c.MaxTime)
+				samples = append(samples, sample{ts, v})
+			}
+			testutil.Ok(t, it.Err())
+		}
+		return srv, samples
+	}
+	// increase computes the increase of the counter over the requested time range from the samples within it,
+	// handling counter resets, as rate() does before extrapolation.
+	increase := func(samples []sample) (first sample, inc float64) {
+		var prev *sample
+		for i := range samples {
+			s := samples[i]
+			if s.t < minTime || s.t > maxTime {
+				continue
+			}
+			if prev == nil {
+				first = s
+			} else if s.v < prev.v {
+				inc += s.v
+			} else {
+				inc += s.v - prev.v
+			}
+			prev = &samples[i]
+		}
+		return first, inc
+	}
+
+	full, fullSamples := querySeries(nil)
+	// The whole chunks overlapping the requested time range are sent.
+	testutil.Equals(t, 2, len(full.SeriesSet[0].Chunks))
+	testutil.Equals(t, sample{0, 0}, fullSamples[0])
+
+	// Stores not enabling chunk slicing ignore the hint.
+	unsliced, unslicedSamples := querySeries(&hintspb.SeriesRequestHints{SliceChunks: true})
+	testutil.Equals(t, fullSamples, unslicedSamples)
+	testutil.Equals(t, full.Size, unsliced.Size)
+
+	store.chunkSlicing = true
+
+	// Old queriers not asking for it get whole chunks.
+	_, samples := querySeries(nil)
+	testutil.Equals(t, fullSamples, samples)
+
+	sliced, slicedSamples := querySeries(&hintspb.SeriesRequestHints{SliceChunks: true})
+	// Only the samples within the requested time range are sent, plus one sample on each side.
+	testutil.Equals(t, sample{99 * scrapeInterval, 99}, slicedSamples[0])
+	testutil.Equals(t, sample{121 * scrapeInterval, 11}, slicedSamples[len(slicedSamples)-1])
+	testutil.Equals(t, 23, len(slicedSamples))
+	for _, s := range slicedSamples {
+		testutil.Equals(t, fullSamples[s.t/scrapeInterval], s)
+	}
+
+	// The first sample within the requested time range and the counter reset are kept, so rate() is unchanged.
+	fullFirst, fullIncrease := increase(fullSamples)
+	slicedFirst, slicedIncrease := increase(slicedSamples)
+	testutil.Equals(t, sample{100 * scrapeInterval, 100}, slicedFirst)
+	testutil.Equals(t, fullFirst, slicedFirst)
+	testutil.Equals(t, fullIncrease, slicedIncrease)
+
+	testutil.Assert(t, sliced.Size*2 < full.Size, "sliced response of %d bytes not half as large as the response of whole chunks of %d bytes", sliced.Size, full.Size)
+	testutil.Equals(t, 2.0, promtest.ToFloat64(store.metrics.slicedChunks))
+	testutil.Assert(t, promtest.ToFloat64(store.metrics.slicedChunkBytesSaved) > 0, "no chunk bytes saved")
+}
+
+func TestSliceChunk(t *testing.T) {
+	newChunk := func(ts ...int64) *storepb.AggrChunk {
+		chk := chunkenc.NewXORChunk()
+		app, err := chk.Appender()
+		testutil.Ok(t, err)
+		for _, t := range ts {
+			app.Append(t, float64(t))
+		}
+		return &storepb.AggrChunk{MinTime: ts[0], MaxTime: ts[len(ts)-1], Raw: &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()}}
+	}
+	timestamps := func(c *storepb.AggrChunk) []int64 {
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+		testutil.Ok(t, err)
+		var ts []int64
+		it := chk.Iterator(nil)
+		for it.Next() {
+			t, _ := it.At()
+			ts = append(ts, t)
+		}
+		return ts
+	}
+
+	for _, tcase := range []struct {
+		name             string
+		minTime, maxTime int64
+		expSliced        bool
+		exp              []int64
+	}{
+		{name: "within time range", minTime: 0, maxTime: 50, exp: []int64{0, 10, 20, 30, 40}},
+		{name: "one sample on each side", minTime: 15, maxTime: 25, exp: []int64{10, 20, 30}, expSliced: true},
+		{name: "between samples", minTime: 21, maxTime: 29, exp: []int64{20, 30}, expSliced: true},
+		{name: "before time range", minTime: 35, maxTime: 100, exp: []int64{30, 40}, expSliced: true},
+		{name: "after time range", minTime: -100, maxTime: 5, exp: []int64{0, 10}, expSliced: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			c := newChunk(0, 10, 20, 30, 40)
+			size := len(c.Raw.Data)
+
+			sliced, saved, err := sliceChunk(c, tcase.minTime, tcase.maxTime)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expSliced, sliced)
+			testutil.Equals(t, tcase.exp, timestamps(c))
+			testutil.Equals(t, tcase.exp[0], c.MinTime)
+			testutil.Equals(t, tcase.exp[len(tcase.exp)-1], c.MaxTime)
+			testutil.Equals(t, size-saved, len(c.Raw.Data))
+		})
+	}
+}
+
 func mustMarshalAny(pb proto.Message) *types.Any {
 	out, err := types.MarshalAny(pb)
 	if err != nil {
@@ -1955,6 +2283,62 @@ func setupStoreForHintsTest(t *testing.T) (testutil.TB, *BucketStore, []*storepb
 	}
 }
 
+func TestBucketStore_LabelAPIs(t *testing.T) {
+	t.Cleanup(func() { testutil.TolerantVerifyLeak(t) })
+	testLabelAPIs(t, func(t *testing.T, extLset labels.Labels, appendFn func(app storage.Appender)) storepb.StoreServer {
+		tmpDir := t.TempDir()
+		bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, bkt.Close()) })
+
+		headOpts := tsdb.DefaultHeadOptions()
+		headOpts.ChunkDirRoot = tmpDir
+		headOpts.ChunkRange = 1000
+		h, err := tsdb.NewHead(nil, nil, nil, headOpts, nil)
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, h.Close()) })
+
+		appendFn(h.Appender(context.Background()))
+		if h.NumSeries() == 0 {
+			t.Skip("bucket store cannot have empty blocks")
+		}
+
+		blockDir := filepath.Join(tmpDir, "tmp")
+		id := createBlockFromHead(t, blockDir, h)
+		_, err = metadata.InjectThanos(log.NewNopLogger(), filepath.Join(blockDir, id.String()), metadata.Thanos{
+			Labels:     extLset.Map(),
+			Downsample: metadata.ThanosDownsample{Resolution: 0},
+			Source:     metadata.TestSource,
+		}, nil)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(context.Background(), log.NewNopLogger(), bkt, filepath.Join(blockDir, id.String()), metadata.NoneFunc))
+
+		metaFetcher, err := block.NewMetaFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), filepath.Join(tmpDir, "meta"), nil, nil)
+		testutil.Ok(t, err)
+
+		bucketStore, err := NewBucketStore(
+			objstore.WithNoopInstr(bkt),
+			metaFetcher,
+			filepath.Join(tmpDir, "store"),
+			NewChunksLimiterFactory(0),
+			NewSeriesLimiterFactory(0),
+			NewGapBasedPartitioner(PartitionerMaxGapSize),
+			20,
+			true,
+			DefaultPostingOffsetInMemorySampling,
+			false,
+			false,
+			time.Minute,
+			WithFilterConfig(allowAllFilterConf),
+		)
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, bucketStore.Close()) })
+		testutil.Ok(t, bucketStore.SyncBlocks(context.Background()))
+
+		return bucketStore
+	})
+}
+
 func TestLabelNamesAndValuesHints(t *testing.T) {
 	_, store, seriesSet1, seriesSet2, block1, block2, close := setupStoreForHintsTest(t)
 	defer close()
@@ -2094,6 +2478,98 @@ func TestLabelNamesAndValuesHints(t *testing.T) {
 	}
 }
 
+func TestBucketStore_LabelAPIs_TimeRange(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+	extLset := labels.FromStrings("region", "eu")
+
+	upload := func(series []labels.Labels, mint, maxt, resolution int64) {
+		id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 10, mint, maxt, extLset, resolution, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(tmpDir, id.String()), metadata.NoneFunc))
+	}
+	upload([]labels.Labels{labels.FromStrings("a", "1")}, 0, 1000, 0)
+	upload([]labels.Labels{labels.FromStrings("b", "1")}, 1000, 2000, 0)
+	upload([]labels.Labels{labels.FromStrings("c", "1")}, 2000, 3000, 0)
+
+	reg := prometheus.NewRegistry()
+	ibkt := objstore.WithNoopInstr(bkt)
+	f, err := block.NewRawMetaFetcher(logger, ibkt)
+	testutil.Ok(t, err)
+	st, err := NewBucketStore(
+		ibkt,
+		f,
+		filepath.Join(tmpDir, "store"),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		0,
+		WithLogger(logger),
+		WithRegistry(reg),
+	)
+	testutil.Ok(t, err)
+	testutil.Ok(t, st.SyncBlocks(ctx))
+
+	// blocksQueried returns the number of blocks queried by the label requests of the given operation so far.
+	blocksQueried := func(operation string) float64 {
+		for _, m := range gatherFamily(t, reg, "thanos_bucket_store_label_blocks_queried").Metric {
+			if m.GetLabel()[0].GetValue() == operation {
+				return m.GetSummary().GetSampleSum()
+			}
+		}
+		return 0
+	}
+	labelAPIs := func(mint, maxt int64) ([]string, []string) {
+		names, err := st.LabelNames(ctx, &storepb.LabelNamesRequest{Start: mint, End: maxt})
+		testutil.Ok(t, err)
+		values, err := st.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "b", Start: mint, End: maxt})
+		testutil.Ok(t, err)
+		return names.Names, values.Values
+	}
+
+	names, values := labelAPIs(0, 3000)
+	testutil.Equals(t, []string{"a", "b", "c", "region"}, names)
+	testutil.Equals(t, []string{"1"}, values)
+	testutil.Equals(t, 3.0, blocksQueried("label_names"))
+	testutil.Equals(t, 3.0, blocksQueried("label_values"))
+
+	// Only the blocks overlapping narrow ranges are queried.
+	names, values = labelAPIs(2000, 2500)
+	testutil.Equals(t, []string{"c", "region"}, names)
+	testutil.Equals(t, []string(nil), values)
+	testutil.Equals(t, 4.0, blocksQueried("label_names"))
+	testutil.Equals(t, 4.0, blocksQueried("label_values"))
+
+	// Ranges are clamped to the range of the store.
+	filterMinTime, filterMaxTime := timestamp.Time(1000), timestamp.Time(1999)
+	st.filterConfig = &FilterConfig{
+		MinTime: model.TimeOrDurationValue{Time: &filterMinTime},
+		MaxTime: model.TimeOrDurationValue{Time: &filterMaxTime},
+	}
+	names, values = labelAPIs(0, 3000)
+	testutil.Equals(t, []string{"b", "region"}, names)
+	testutil.Equals(t, []string{"1"}, values)
+	testutil.Equals(t, 5.0, blocksQueried("label_names"))
+	testutil.Equals(t, 5.0, blocksQueried("label_values"))
+	st.filterConfig = nil
+
+	// With a downsampled block covering the same range, results are the same but taken from a single block.
+	upload([]labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("b", "1"), labels.FromStrings("c", "1")}, 0, 3000, downsample.ResLevel1)
+	testutil.Ok(t, st.SyncBlocks(ctx))
+	names, values = labelAPIs(0, 3000)
+	testutil.Equals(t, []string{"a", "b", "c", "region"}, names)
+	testutil.Equals(t, []string{"1"}, values)
+	testutil.Equals(t, 6.0, blocksQueried("label_names"))
+	testutil.Equals(t, 6.0, blocksQueried("label_values"))
+}
+
 func labelNamesFromSeriesSet(series []*storepb.Series) []string {
 	labelsMap := map[string]struct{}{}
 
@@ -2153,7 +2629,7 @@ func BenchmarkBucketBlock_readChunkRange(b *testing.B) {
 	testutil.Ok(b, err)
 
 	// Create a bucket block with only the dependencies we need for the benchmark.
-	blk, err := newBucketBlock(context.Background(), logger, newBucketStoreMetrics(nil), blockMeta, bkt, tmpDir, nil, chunkPool, nil, nil)
+	blk, err := newBucketBlock(context.Background(), logger, newBucketStoreMetrics(nil), blockMeta, bkt, tmpDir, nil, nil, nil)
 	testutil.Ok(b, err)
 
 	b.ResetTimer()
@@ -2162,7 +2638,7 @@ func BenchmarkBucketBlock_readChunkRange(b *testing.B) {
 		offset := int64(0)
 		length := readLengths[n%len(readLengths)]
 
-		_, err := blk.readChunkRange(ctx, 0, offset, length, byteRanges{{offset: 0, length: int(length)}})
+		_, err := blk.readChunkRange(ctx, 0, offset, length, byteRanges{{offset: 0, length: int(length)}}, chunkPool)
 		if err != nil {
 			b.Fatal(err.Error())
 		}
@@ -2180,7 +2656,7 @@ func BenchmarkBlockSeries(b *testing.B) {
 	}
 }
 
-func prepareBucket(b *testing.B, resolutionLevel compact.ResolutionLevel) (*bucketBlock, *metadata.Meta) {
+func prepareBucket(b testing.TB, resolutionLevel compact.ResolutionLevel) (*bucketBlock, *metadata.Meta) {
 	var (
 		ctx    = context.Background()
 		logger = log.NewNopLogger()
@@ -2233,10 +2709,7 @@ func prepareBucket(b *testing.B, resolutionLevel compact.ResolutionLevel) (*buck
 	}
 	testutil.Ok(b, head.Close())
 
-	// Create chunk pool and partitioner using the same production settings.
-	chunkPool, err := NewDefaultChunkBytesPool(64 * 1024 * 1024 * 1024)
-	testutil.Ok(b, err)
-
+	// Create partitioner using the same production settings.
 	partitioner := NewGapBasedPartitioner(PartitionerMaxGapSize)
 
 	// Create an index header reader.
@@ -2246,7 +2719,7 @@ func prepareBucket(b *testing.B, resolutionLevel compact.ResolutionLevel) (*buck
 	testutil.Ok(b, err)
 
 	// Create a bucket block with only the dependencies we need for the benchmark.
-	blk, err := newBucketBlock(context.Background(), logger, newBucketStoreMetrics(nil), blockMeta, bkt, tmpDir, indexCache, chunkPool, indexHeaderReader, partitioner)
+	blk, err := newBucketBlock(context.Background(), logger, newBucketStoreMetrics(nil), blockMeta, bkt, tmpDir, indexCache, indexHeaderReader, partitioner)
 	testutil.Ok(b, err)
 	return blk, blockMeta
 }
@@ -2259,6 +2732,10 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 	chunksLimiter := NewChunksLimiterFactory(0)(nil)
 	seriesLimiter := NewSeriesLimiterFactory(0)(nil)
 
+	// Create chunk pool using the same production settings.
+	chunkPool, err := NewDefaultChunkBytesPool(64 * 1024 * 1024 * 1024)
+	testutil.Ok(b, err)
+
 	// Run multiple workers to execute the queries.
 	wg := sync.WaitGroup{}
 	wg.Add(concurrency)
@@ -2289,7 +2766,7 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 				testutil.Ok(b, err)
 
 				indexReader := blk.indexReader()
-				chunkReader := blk.chunkReader()
+				chunkReader := blk.chunkReader(chunkPool, nil)
 
 				seriesSet, _, err := blockSeries(context.Background(), nil, indexReader, chunkReader, matchers, chunksLimiter, seriesLimiter, req.SkipChunks, req.MinTime, req.MaxTime, req.Aggregates)
 				testutil.Ok(b, err)
@@ -2306,6 +2783,91 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 	wg.Wait()
 }
 
+// latencyBucketReader emulates a high-latency object storage, with a latency for each range request and a bandwidth
+// limit for reading each range.
+type latencyBucketReader struct {
+	objstore.BucketReader
+
+	latency        time.Duration
+	bytesPerSecond int
+}
+
+func (b latencyBucketReader) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	time.Sleep(b.latency)
+	rc, err := b.BucketReader.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return throttledReader{ReadCloser: rc, bytesPerSecond: b.bytesPerSecond}, nil
+}
+
+type throttledReader struct {
+	io.ReadCloser
+
+	bytesPerSecond int
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	time.Sleep(time.Duration(n) * time.Second / time.Duration(r.bytesPerSecond))
+	return n, err
+}
+
+// blockSeriesWithPrefetch returns the series of the given block matching the label matcher, reading ahead chunk
+// ranges with the given budget.
+func blockSeriesWithPrefetch(t testing.TB, blk *bucketBlock, blockMeta *metadata.Meta, labelMatcher string, prefetchBudget int64) []storepb.Series {
+	chunkPool, err := NewDefaultChunkBytesPool(0)
+	testutil.Ok(t, err)
+
+	indexReader := blk.indexReader()
+	defer func() { testutil.Ok(t, indexReader.Close()) }()
+	chunkReader := blk.chunkReader(chunkPool, newChunksPrefetchBudget(prefetchBudget))
+	defer func() { testutil.Ok(t, chunkReader.Close()) }()
+
+	matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "i", labelMatcher)}
+	seriesSet, _, err := blockSeries(context.Background(), nil, indexReader, chunkReader, matchers,
+		NewChunksLimiterFactory(0)(nil), NewSeriesLimiterFactory(0)(nil), false, blockMeta.MinTime, blockMeta.MaxTime, nil)
+	testutil.Ok(t, err)
+
+	var series []storepb.Series
+	for seriesSet.Next() {
+		lset, chks := seriesSet.At()
+		// Chunk bytes are only valid until the chunk reader is closed.
+		for i := range chks {
+			chks[i].Raw = &storepb.Chunk{Type: chks[i].Raw.Type, Data: append([]byte(nil), chks[i].Raw.Data...)}
+		}
+		series = append(series, storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chks})
+	}
+	testutil.Ok(t, seriesSet.Err())
+	return series
+}
+
+func TestBlockSeries_ChunksPrefetch(t *testing.T) {
+	blk, blockMeta := prepareBucket(t, compact.ResolutionLevelRaw)
+
+	expected := blockSeriesWithPrefetch(t, blk, blockMeta, ".*1.*", 0)
+	testutil.Assert(t, len(expected) > 0, "expected series")
+	// A small budget prefetches some ranges and streams the ones larger than the budget.
+	for _, budget := range []int64{256 * 1024, 64 * 1024 * 1024} {
+		t.Run(fmt.Sprintf("budget: %d", budget), func(t *testing.T) {
+			testutil.Equals(t, expected, blockSeriesWithPrefetch(t, blk, blockMeta, ".*1.*", budget))
+		})
+	}
+}
+
+func BenchmarkBlockSeries_ChunksPrefetch(b *testing.B) {
+	blk, blockMeta := prepareBucket(b, compact.ResolutionLevelRaw)
+	blk.bkt = latencyBucketReader{BucketReader: blk.bkt, latency: 20 * time.Millisecond, bytesPerSecond: 50 * 1024 * 1024}
+
+	for _, budget := range []int64{0, 16 * 1024 * 1024, 64 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("budget: %d", budget), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				blockSeriesWithPrefetch(b, blk, blockMeta, ".*1.*", budget)
+			}
+		})
+	}
+}
+
 func BenchmarkDownsampledBlockSeries(b *testing.B) {
 	blk, blockMeta := prepareBucket(b, compact.ResolutionLevel5m)
 	aggrs := []storepb.Aggr{}
@@ -0,0 +1,204 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	// CacheWarmupFilename is the name of the file in the data directory of a bucket store its cache warmup entries are
+	// exported to.
+	CacheWarmupFilename = "cache-warmup.json"
+
+	// cacheWarmupTrackedFactor bounds the number of distinct keys tracked between two exports, as a multiple of the
+	// number of exported entries.
+	cacheWarmupTrackedFactor = 10
+)
+
+// CacheWarmupEntry is a matcher set used by Series requests against a block, whose postings and series are fetched
+// into the index cache when warming it up.
+type CacheWarmupEntry struct {
+	Block    ulid.ULID `json:"block"`
+	Matchers string    `json:"matchers"`
+}
+
+type cacheWarmupFile struct {
+	Entries []CacheWarmupEntry `json:"entries"`
+}
+
+// cacheWarmupTracker counts the hits of matcher sets per block, keeping at most a bounded number of keys.
+type cacheWarmupTracker struct {
+	maxEntries int
+
+	mtx  sync.Mutex
+	hits map[CacheWarmupEntry]uint64
+}
+
+func newCacheWarmupTracker(maxEntries int) *cacheWarmupTracker {
+	return &cacheWarmupTracker{maxEntries: maxEntries, hits: map[CacheWarmupEntry]uint64{}}
+}
+
+// record counts a hit of the matcher set against the block. Keys seen for the first time are ignored once the
+// tracker is full, until the next call to top.
+func (t *cacheWarmupTracker) record(id ulid.ULID, matchers string) {
+	e := CacheWarmupEntry{Block: id, Matchers: matchers}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if _, ok := t.hits[e]; !ok && len(t.hits) >= t.maxEntries*cacheWarmupTrackedFactor {
+		return
+	}
+	t.hits[e]++
+}
+
+// top returns the most hit entries, most hit first. Only the returned entries are kept, with their hits halved, so that
+// entries which stopped being hit are eventually replaced.
+func (t *cacheWarmupTracker) top() []CacheWarmupEntry {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	entries := make([]CacheWarmupEntry, 0, len(t.hits))
+	for e := range t.hits {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if hi, hj := t.hits[entries[i]], t.hits[entries[j]]; hi != hj {
+			return hi > hj
+		}
+		if entries[i].Block != entries[j].Block {
+			return entries[i].Block.Compare(entries[j].Block) < 0
+		}
+		return entries[i].Matchers < entries[j].Matchers
+	})
+	if len(entries) > t.maxEntries {
+		entries = entries[:t.maxEntries]
+	}
+
+	hits := make(map[CacheWarmupEntry]uint64, len(entries))
+	for _, e := range entries {
+		if h := t.hits[e] / 2; h > 0 {
+			hits[e] = h
+		}
+	}
+	t.hits = hits
+	return entries
+}
+
+// WithCacheWarmupTracking makes the BucketStore track the matcher sets most frequently used per block by Series
+// requests, up to maxEntries of them, so that they can be exported with CacheWarmupEntries.
+func WithCacheWarmupTracking(maxEntries int) BucketStoreOption {
+	return func(s *BucketStore) {
+		if maxEntries > 0 {
+			s.cacheWarmupTracker = newCacheWarmupTracker(maxEntries)
+		}
+	}
+}
+
+// CacheWarmupEntries returns the matcher sets most frequently used per block since the previous call, most frequent
+// first. It returns nil if tracking is not enabled.
+func (s *BucketStore) CacheWarmupEntries() []CacheWarmupEntry {
+	if s.cacheWarmupTracker == nil {
+		return nil
+	}
+	return s.cacheWarmupTracker.top()
+}
+
+// WarmupIndexCache fetches the postings and series of the given entries into the index cache, in order, until all of
+// them are warmed or the context is done. Entries of blocks which are not loaded are skipped. It returns the number of
+// warmed entries.
+func (s *BucketStore) WarmupIndexCache(ctx context.Context, entries []CacheWarmupEntry) int {
+	begin := time.Now()
+	defer func() {
+		s.metrics.cacheWarmupDuration.Set(time.Since(begin).Seconds())
+	}()
+
+	var warmed int
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			level.Warn(s.logger).Log("msg", "index cache warmup stopped before warming all entries", "warmed", warmed, "entries", len(entries), "err", ctx.Err())
+			break
+		}
+		b := s.getBlock(e.Block)
+		if b == nil {
+			s.metrics.cacheWarmupEntries.WithLabelValues(labelSkipped).Inc()
+			continue
+		}
+		if err := warmupBlockIndexCache(ctx, b, e.Matchers); err != nil {
+			level.Debug(s.logger).Log("msg", "failed to warm up index cache", "block", e.Block, "matchers", e.Matchers, "err", err)
+			s.metrics.cacheWarmupEntries.WithLabelValues(labelFailed).Inc()
+			continue
+		}
+		s.metrics.cacheWarmupEntries.WithLabelValues(labelWarmed).Inc()
+		warmed++
+	}
+	return warmed
+}
+
+func warmupBlockIndexCache(ctx context.Context, b *bucketBlock, matchers string) (err error) {
+	ms, err := parser.ParseMetricSelector(matchers)
+	if err != nil {
+		return errors.Wrap(err, "parse matchers")
+	}
+	indexr := b.indexReader()
+	defer runutil.CloseWithErrCapture(&err, indexr, "close index reader")
+
+	ps, err := indexr.ExpandedPostings(ctx, ms)
+	if err != nil {
+		return errors.Wrap(err, "expanded postings")
+	}
+	return errors.Wrap(indexr.PreloadSeries(ctx, ps), "preload series")
+}
+
+// ReadCacheWarmupEntries reads the cache warmup entries of the file. A missing file has no entries.
+func ReadCacheWarmupEntries(path string) ([]CacheWarmupEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f cacheWarmupFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", path)
+	}
+	return f.Entries, nil
+}
+
+// WriteCacheWarmupEntries replaces the file with the cache warmup entries.
+func WriteCacheWarmupEntries(path string, entries []CacheWarmupEntry) error {
+	b, err := json.Marshal(cacheWarmupFile{Entries: entries})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return errors.Wrapf(os.Rename(tmp, path), "rename %s", filepath.Base(tmp))
+}
+
+// recordCacheWarmup counts the use of the matchers by a Series request against the block, if tracking is enabled.
+func (s *BucketStore) recordCacheWarmup(id ulid.ULID, ms []*labels.Matcher) {
+	if s.cacheWarmupTracker != nil && len(ms) > 0 {
+		s.cacheWarmupTracker.record(id, storepb.PromMatchersToString(ms...))
+	}
+}
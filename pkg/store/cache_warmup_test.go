@@ -0,0 +1,117 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	storecache "github.com/thanos-io/thanos/pkg/store/cache"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCacheWarmupTracker(t *testing.T) {
+	id1, id2 := ulid.MustNew(1, nil), ulid.MustNew(2, nil)
+	tr := newCacheWarmupTracker(2)
+
+	for i := 0; i < 3; i++ {
+		tr.record(id1, `{a="1"}`)
+	}
+	tr.record(id2, `{a="1"}`)
+	tr.record(id2, `{a="1"}`)
+	tr.record(id1, `{a="2"}`)
+	testutil.Equals(t, []CacheWarmupEntry{
+		{Block: id1, Matchers: `{a="1"}`},
+		{Block: id2, Matchers: `{a="1"}`},
+	}, tr.top())
+
+	// Hits of the exported entries are halved, so that entries which stopped being hit are replaced.
+	for i := 0; i < 2; i++ {
+		tr.record(id1, `{a="2"}`)
+	}
+	testutil.Equals(t, []CacheWarmupEntry{
+		{Block: id1, Matchers: `{a="2"}`},
+		{Block: id1, Matchers: `{a="1"}`},
+	}, tr.top())
+
+	// New keys are ignored once the tracker is full.
+	tr = newCacheWarmupTracker(1)
+	for i := 0; i < cacheWarmupTrackedFactor; i++ {
+		tr.record(ulid.MustNew(uint64(i), nil), `{a="1"}`)
+	}
+	tr.record(id1, `{a="2"}`)
+	tr.record(id1, `{a="2"}`)
+	testutil.Equals(t, []CacheWarmupEntry{{Block: ulid.MustNew(0, nil), Matchers: `{a="1"}`}}, tr.top())
+}
+
+func TestCacheWarmupEntriesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CacheWarmupFilename)
+
+	entries, err := ReadCacheWarmupEntries(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(entries))
+
+	exp := []CacheWarmupEntry{{Block: ulid.MustNew(1, nil), Matchers: `{a="1", b=~"2|3"}`}}
+	testutil.Ok(t, WriteCacheWarmupEntries(path, exp))
+	entries, err = ReadCacheWarmupEntries(path)
+	testutil.Ok(t, err)
+	testutil.Equals(t, exp, entries)
+}
+
+func TestBucketStore_WarmupIndexCache_e2e(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := prepareStoreWithTestBlocks(t, dir, objstore.NewInMemBucket(), false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	s.store.cacheWarmupTracker = newCacheWarmupTracker(100)
+	s.cache.SwapWith(noopCache{})
+
+	srv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.store.Series(&storepb.SeriesRequest{
+		MinTime:  s.minTime,
+		MaxTime:  s.maxTime,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, srv))
+	testutil.Equals(t, 4, len(srv.SeriesSet))
+
+	entries := s.store.CacheWarmupEntries()
+	// Each of the three time slots has two blocks.
+	testutil.Equals(t, 6, len(entries))
+	for _, e := range entries {
+		testutil.Equals(t, `{a="1"}`, e.Matchers)
+	}
+
+	indexCache, err := storecache.NewInMemoryIndexCacheWithConfig(s.logger, nil, storecache.InMemoryIndexCacheConfig{
+		MaxItemSize: 1e5,
+		MaxSize:     2e5,
+	})
+	testutil.Ok(t, err)
+	s.cache.SwapWith(indexCache)
+
+	unknown := CacheWarmupEntry{Block: ulid.MustNew(1, nil), Matchers: `{a="1"}`}
+	invalid := CacheWarmupEntry{Block: entries[0].Block, Matchers: `{a=}`}
+	testutil.Equals(t, 6, s.store.WarmupIndexCache(ctx, append([]CacheWarmupEntry{unknown, invalid}, entries...)))
+	testutil.Equals(t, 6.0, promtest.ToFloat64(s.store.metrics.cacheWarmupEntries.WithLabelValues(labelWarmed)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(s.store.metrics.cacheWarmupEntries.WithLabelValues(labelSkipped)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(s.store.metrics.cacheWarmupEntries.WithLabelValues(labelFailed)))
+
+	for _, e := range entries {
+		hits, misses := indexCache.FetchMultiPostings(ctx, e.Block, []labels.Label{{Name: "a", Value: "1"}})
+		testutil.Equals(t, 1, len(hits))
+		testutil.Equals(t, 0, len(misses))
+	}
+
+	// The warmup stops once the context is done.
+	ctx, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	testutil.Equals(t, 0, s.store.WarmupIndexCache(ctx, entries))
+}
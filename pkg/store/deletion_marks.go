@@ -0,0 +1,68 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// WithDeletionMarkFilter makes the BucketStore exclude its loaded blocks from queries as soon as their deletion mark
+// is older than the delay of the filter, rather than once the next sync drops them, so that replicas syncing at
+// different times stop serving them at the same time. The filter must be one of the filters of the fetcher of the
+// store.
+func WithDeletionMarkFilter(f *block.IgnoreDeletionMarkFilter) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.deletionMarkFilter = f
+	}
+}
+
+// deletionMarks returns the deletion marks of the blocks found by the last sync, nil if the filter is not set.
+func (s *BucketStore) deletionMarks() map[ulid.ULID]*metadata.DeletionMark {
+	if s.deletionMarkFilter == nil {
+		return nil
+	}
+	return s.deletionMarkFilter.DeletionMarkBlocks()
+}
+
+// syncDeletionMarks sets the time from which each loaded block is excluded from queries because of its deletion mark.
+func (s *BucketStore) syncDeletionMarks(marks map[ulid.ULID]*metadata.DeletionMark) {
+	if s.deletionMarkFilter == nil {
+		return
+	}
+	delay := s.deletionMarkFilter.Delay()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for id, b := range s.blocks {
+		m, ok := marks[id]
+		if !ok {
+			b.deletionExpiry.Store(0)
+			continue
+		}
+		expiry := time.Unix(m.DeletionTime, 0).Add(delay)
+		if b.deletionExpiry.Swap(expiry.UnixMilli()) == 0 {
+			level.Debug(s.logger).Log("msg", "block marked for deletion will be excluded from queries", "block", id, "from", expiry)
+		}
+	}
+}
+
+// deletionMarkExpired returns true if the deletion mark of the block is older than the ignore deletion marks delay at
+// the given time, meaning the next sync drops the block.
+func (b *bucketBlock) deletionMarkExpired(now time.Time) bool {
+	expiry := b.deletionExpiry.Load()
+	if expiry == 0 || now.UnixMilli() < expiry {
+		return false
+	}
+	if b.deletionExcluded.CAS(false, true) {
+		b.metrics.deletionMarkedBlocksExcluded.Inc()
+	}
+	return true
+}
@@ -3,7 +3,15 @@
 
 package hintspb
 
-import "github.com/oklog/ulid"
+import (
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// MaxBlockStats is the maximum number of blocks whose statistics are returned in the hints of a Series response.
+const MaxBlockStats = 10
 
 func (m *SeriesResponseHints) AddQueriedBlock(id ulid.ULID) {
 	m.QueriedBlocks = append(m.QueriedBlocks, Block{
@@ -22,3 +30,36 @@ func (m *LabelValuesResponseHints) AddQueriedBlock(id ulid.ULID) {
 		Id: id.String(),
 	})
 }
+
+// FetchDuration returns the total time spent fetching the data of the block, which is its cost.
+func (m *BlockQueryStats) FetchDuration() time.Duration {
+	return time.Duration(m.PostingsFetchDurationNs + m.SeriesFetchDurationNs + m.ChunksFetchDurationNs)
+}
+
+// Merge adds the statistics of another request to the same block.
+func (m *BlockQueryStats) Merge(o BlockQueryStats) {
+	m.PostingsTouched += o.PostingsTouched
+	m.SeriesFetched += o.SeriesFetched
+	m.ChunksFetched += o.ChunksFetched
+	m.PostingsFetchDurationNs += o.PostingsFetchDurationNs
+	m.SeriesFetchDurationNs += o.SeriesFetchDurationNs
+	m.ChunksFetchDurationNs += o.ChunksFetchDurationNs
+}
+
+// TopBlockStats sorts the statistics by decreasing fetch duration, then by decreasing number of fetched chunks, and
+// returns the first n of them.
+func TopBlockStats(stats []BlockQueryStats, n int) []BlockQueryStats {
+	sort.Slice(stats, func(i, j int) bool {
+		if di, dj := stats[i].FetchDuration(), stats[j].FetchDuration(); di != dj {
+			return di > dj
+		}
+		if stats[i].ChunksFetched != stats[j].ChunksFetched {
+			return stats[i].ChunksFetched > stats[j].ChunksFetched
+		}
+		return stats[i].BlockId < stats[j].BlockId
+	})
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
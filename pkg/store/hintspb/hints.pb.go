@@ -30,6 +30,11 @@ type SeriesRequestHints struct {
 	/// labels to filter which blocks get queried. If the list is empty, no per-block filtering
 	/// is applied.
 	BlockMatchers []storepb.LabelMatcher `protobuf:"bytes,1,rep,name=block_matchers,json=blockMatchers,proto3" json:"block_matchers"`
+	/// enable_query_stats requests the statistics of the most expensive queried blocks in the response hints.
+	EnableQueryStats bool `protobuf:"varint,2,opt,name=enable_query_stats,json=enableQueryStats,proto3" json:"enable_query_stats,omitempty"`
+	/// slice_chunks requests the chunks to be cut down to the samples within the requested time range, plus one sample
+	/// on each side of it. Stores not supporting it return whole chunks.
+	SliceChunks bool `protobuf:"varint,3,opt,name=slice_chunks,json=sliceChunks,proto3" json:"slice_chunks,omitempty"`
 }
 
 func (m *SeriesRequestHints) Reset()         { *m = SeriesRequestHints{} }
@@ -68,6 +73,9 @@ var xxx_messageInfo_SeriesRequestHints proto.InternalMessageInfo
 type SeriesResponseHints struct {
 	/// queried_blocks is the list of blocks that have been queried.
 	QueriedBlocks []Block `protobuf:"bytes,1,rep,name=queried_blocks,json=queriedBlocks,proto3" json:"queried_blocks"`
+	/// block_stats are the statistics of the most expensive queried blocks, ordered by decreasing cost. It is only
+	/// set if the request enables query stats.
+	BlockStats []BlockQueryStats `protobuf:"bytes,2,rep,name=block_stats,json=blockStats,proto3" json:"block_stats"`
 }
 
 func (m *SeriesResponseHints) Reset()         { *m = SeriesResponseHints{} }
@@ -140,6 +148,52 @@ func (m *Block) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_Block proto.InternalMessageInfo
 
+// / BlockQueryStats are the statistics of the data of a block fetched by a Series request.
+type BlockQueryStats struct {
+	BlockId         string `protobuf:"bytes,1,opt,name=block_id,json=blockId,proto3" json:"block_id,omitempty"`
+	PostingsTouched int64  `protobuf:"varint,2,opt,name=postings_touched,json=postingsTouched,proto3" json:"postings_touched,omitempty"`
+	SeriesFetched   int64  `protobuf:"varint,3,opt,name=series_fetched,json=seriesFetched,proto3" json:"series_fetched,omitempty"`
+	ChunksFetched   int64  `protobuf:"varint,4,opt,name=chunks_fetched,json=chunksFetched,proto3" json:"chunks_fetched,omitempty"`
+	/// postings_fetch_duration_ns, series_fetch_duration_ns and chunks_fetch_duration_ns are the cumulative times
+	/// spent fetching the postings, series and chunks of the block, in nanoseconds.
+	PostingsFetchDurationNs int64 `protobuf:"varint,5,opt,name=postings_fetch_duration_ns,json=postingsFetchDurationNs,proto3" json:"postings_fetch_duration_ns,omitempty"`
+	SeriesFetchDurationNs   int64 `protobuf:"varint,6,opt,name=series_fetch_duration_ns,json=seriesFetchDurationNs,proto3" json:"series_fetch_duration_ns,omitempty"`
+	ChunksFetchDurationNs   int64 `protobuf:"varint,7,opt,name=chunks_fetch_duration_ns,json=chunksFetchDurationNs,proto3" json:"chunks_fetch_duration_ns,omitempty"`
+}
+
+func (m *BlockQueryStats) Reset()         { *m = BlockQueryStats{} }
+func (m *BlockQueryStats) String() string { return proto.CompactTextString(m) }
+func (*BlockQueryStats) ProtoMessage()    {}
+func (*BlockQueryStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b82aa23c4c11e83f, []int{3}
+}
+func (m *BlockQueryStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *BlockQueryStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_BlockQueryStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *BlockQueryStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockQueryStats.Merge(m, src)
+}
+func (m *BlockQueryStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *BlockQueryStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockQueryStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlockQueryStats proto.InternalMessageInfo
+
 type LabelNamesRequestHints struct {
 	/// block_matchers is a list of label matchers that are evaluated against each single block's
 	/// labels to filter which blocks get queried. If the list is empty, no per-block filtering
@@ -151,7 +205,7 @@ func (m *LabelNamesRequestHints) Reset()         { *m = LabelNamesRequestHints{}
 func (m *LabelNamesRequestHints) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesRequestHints) ProtoMessage()    {}
 func (*LabelNamesRequestHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b82aa23c4c11e83f, []int{3}
+	return fileDescriptor_b82aa23c4c11e83f, []int{4}
 }
 func (m *LabelNamesRequestHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -189,7 +243,7 @@ func (m *LabelNamesResponseHints) Reset()         { *m = LabelNamesResponseHints
 func (m *LabelNamesResponseHints) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesResponseHints) ProtoMessage()    {}
 func (*LabelNamesResponseHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b82aa23c4c11e83f, []int{4}
+	return fileDescriptor_b82aa23c4c11e83f, []int{5}
 }
 func (m *LabelNamesResponseHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -229,7 +283,7 @@ func (m *LabelValuesRequestHints) Reset()         { *m = LabelValuesRequestHints
 func (m *LabelValuesRequestHints) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesRequestHints) ProtoMessage()    {}
 func (*LabelValuesRequestHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b82aa23c4c11e83f, []int{5}
+	return fileDescriptor_b82aa23c4c11e83f, []int{6}
 }
 func (m *LabelValuesRequestHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -267,7 +321,7 @@ func (m *LabelValuesResponseHints) Reset()         { *m = LabelValuesResponseHin
 func (m *LabelValuesResponseHints) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesResponseHints) ProtoMessage()    {}
 func (*LabelValuesResponseHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b82aa23c4c11e83f, []int{6}
+	return fileDescriptor_b82aa23c4c11e83f, []int{7}
 }
 func (m *LabelValuesResponseHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -300,6 +354,7 @@ func init() {
 	proto.RegisterType((*SeriesRequestHints)(nil), "hintspb.SeriesRequestHints")
 	proto.RegisterType((*SeriesResponseHints)(nil), "hintspb.SeriesResponseHints")
 	proto.RegisterType((*Block)(nil), "hintspb.Block")
+	proto.RegisterType((*BlockQueryStats)(nil), "hintspb.BlockQueryStats")
 	proto.RegisterType((*LabelNamesRequestHints)(nil), "hintspb.LabelNamesRequestHints")
 	proto.RegisterType((*LabelNamesResponseHints)(nil), "hintspb.LabelNamesResponseHints")
 	proto.RegisterType((*LabelValuesRequestHints)(nil), "hintspb.LabelValuesRequestHints")
@@ -309,26 +364,39 @@ func init() {
 func init() { proto.RegisterFile("store/hintspb/hints.proto", fileDescriptor_b82aa23c4c11e83f) }
 
 var fileDescriptor_b82aa23c4c11e83f = []byte{
-	// 295 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x92, 0x2c, 0x2e, 0xc9, 0x2f,
-	0x4a, 0xd5, 0xcf, 0xc8, 0xcc, 0x2b, 0x29, 0x2e, 0x48, 0x82, 0xd0, 0x7a, 0x05, 0x45, 0xf9, 0x25,
-	0xf9, 0x42, 0xec, 0x50, 0x41, 0x29, 0x91, 0xf4, 0xfc, 0xf4, 0x7c, 0xb0, 0x98, 0x3e, 0x88, 0x05,
-	0x91, 0x96, 0x82, 0xea, 0x04, 0x93, 0x05, 0x49, 0xfa, 0x25, 0x95, 0x05, 0xa9, 0x50, 0x9d, 0x4a,
-	0xe1, 0x5c, 0x42, 0xc1, 0xa9, 0x45, 0x99, 0xa9, 0xc5, 0x41, 0xa9, 0x85, 0xa5, 0xa9, 0xc5, 0x25,
-	0x1e, 0x20, 0x83, 0x84, 0x1c, 0xb9, 0xf8, 0x92, 0x72, 0xf2, 0x93, 0xb3, 0xe3, 0x73, 0x13, 0x4b,
-	0x92, 0x33, 0x52, 0x8b, 0x8a, 0x25, 0x18, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0x44, 0xf4, 0x4a, 0x32,
-	0x12, 0xf3, 0xf2, 0x8b, 0xf5, 0x7c, 0x12, 0x93, 0x52, 0x73, 0x7c, 0x21, 0x92, 0x4e, 0x2c, 0x27,
-	0xee, 0xc9, 0x33, 0x04, 0xf1, 0x82, 0x75, 0x40, 0xc5, 0x8a, 0x95, 0x82, 0xb8, 0x84, 0x61, 0x06,
-	0x17, 0x17, 0xe4, 0xe7, 0x15, 0xa7, 0x42, 0x4c, 0xb6, 0xe6, 0xe2, 0x2b, 0x2c, 0x05, 0x89, 0xa7,
-	0xc4, 0x83, 0xd5, 0xc3, 0x4c, 0xe6, 0xd3, 0x83, 0x7a, 0x41, 0xcf, 0x09, 0x24, 0x0c, 0x33, 0x13,
-	0xaa, 0x16, 0x2c, 0x56, 0xac, 0x24, 0xce, 0xc5, 0x0a, 0x66, 0x09, 0xf1, 0x71, 0x31, 0x65, 0xa6,
-	0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x31, 0x65, 0xa6, 0x28, 0x45, 0x73, 0x89, 0x81, 0x5d,
-	0xe4, 0x97, 0x98, 0x4b, 0x7d, 0x9f, 0x84, 0x71, 0x89, 0x23, 0x1b, 0x4e, 0x35, 0xdf, 0xc4, 0x40,
-	0xcd, 0x0d, 0x4b, 0xcc, 0x29, 0xa5, 0xbe, 0xab, 0xc3, 0xb9, 0x24, 0x50, 0x4c, 0xa7, 0x96, 0xb3,
-	0x9d, 0x54, 0x4f, 0x3c, 0x94, 0x63, 0x38, 0xf1, 0x48, 0x8e, 0xf1, 0xc2, 0x23, 0x39, 0xc6, 0x07,
-	0x8f, 0xe4, 0x18, 0x27, 0x3c, 0x96, 0x63, 0xb8, 0xf0, 0x58, 0x8e, 0xe1, 0xc6, 0x63, 0x39, 0x86,
-	0x28, 0x58, 0x4a, 0x4c, 0x62, 0x03, 0xa7, 0x2f, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0x47,
-	0x2f, 0x08, 0x1f, 0xb6, 0x02, 0x00, 0x00,
+	// 505 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x94, 0xcf, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0xe3, 0xa4, 0xff, 0x98, 0x50, 0xb7, 0x5a, 0x0a, 0x71, 0x73, 0x30, 0xc1, 0x52, 0xa5,
+	0x20, 0x21, 0x47, 0x82, 0x03, 0x87, 0x1e, 0x10, 0x01, 0x21, 0x90, 0xa0, 0x12, 0x2e, 0x2a, 0x12,
+	0x20, 0x59, 0xfe, 0xb3, 0xc4, 0x56, 0x5d, 0xaf, 0xeb, 0x59, 0x1f, 0xfa, 0x16, 0x48, 0xbc, 0x04,
+	0x8f, 0x92, 0x63, 0x0f, 0x1c, 0x38, 0x21, 0x48, 0x5e, 0x04, 0x79, 0xd6, 0x4e, 0x6d, 0xce, 0xb9,
+	0x24, 0xf6, 0x37, 0xdf, 0x6f, 0xf6, 0xf3, 0x68, 0xb4, 0x70, 0x88, 0x52, 0xe4, 0x7c, 0x12, 0xc5,
+	0xa9, 0xc4, 0xcc, 0x57, 0xff, 0x76, 0x96, 0x0b, 0x29, 0xd8, 0x76, 0x25, 0x0e, 0x0f, 0x66, 0x62,
+	0x26, 0x48, 0x9b, 0x94, 0x4f, 0xaa, 0x3c, 0xac, 0x48, 0xfa, 0xcd, 0xfc, 0x89, 0xbc, 0xca, 0x78,
+	0x45, 0x5a, 0x3f, 0x34, 0x60, 0xa7, 0x3c, 0x8f, 0x39, 0x3a, 0xfc, 0xb2, 0xe0, 0x28, 0x5f, 0x97,
+	0x9d, 0xd8, 0x73, 0xd0, 0xfd, 0x44, 0x04, 0xe7, 0xee, 0x85, 0x27, 0x83, 0x88, 0xe7, 0x68, 0x68,
+	0xa3, 0xde, 0xb8, 0xff, 0xf8, 0xc0, 0x96, 0x91, 0x97, 0x0a, 0xb4, 0xdf, 0x7a, 0x3e, 0x4f, 0xde,
+	0xa9, 0xe2, 0x74, 0x63, 0xfe, 0xfb, 0x7e, 0xc7, 0xd9, 0x25, 0xa2, 0xd2, 0x90, 0x3d, 0x02, 0xc6,
+	0x53, 0xcf, 0x4f, 0xb8, 0x7b, 0x59, 0xf0, 0xfc, 0xca, 0x45, 0xe9, 0x49, 0x34, 0xba, 0x23, 0x6d,
+	0xbc, 0xe3, 0xec, 0xab, 0xca, 0xfb, 0xb2, 0x70, 0x5a, 0xea, 0xec, 0x01, 0xdc, 0xc6, 0x24, 0x0e,
+	0xb8, 0x1b, 0x44, 0x45, 0x7a, 0x8e, 0x46, 0x8f, 0x7c, 0x7d, 0xd2, 0x5e, 0x90, 0x64, 0x7d, 0xd7,
+	0xe0, 0x4e, 0x1d, 0x15, 0x33, 0x91, 0x22, 0x57, 0x59, 0x8f, 0x41, 0x2f, 0x4f, 0x88, 0x79, 0xe8,
+	0x52, 0x82, 0x3a, 0xab, 0x6e, 0x57, 0x53, 0xb1, 0xa7, 0xa5, 0x5c, 0xa7, 0xac, 0xbc, 0xa4, 0x21,
+	0x7b, 0x06, 0x7d, 0xf5, 0xa1, 0x75, 0xbc, 0x92, 0x34, 0xda, 0xe4, 0x4d, 0xcc, 0xaa, 0x07, 0x10,
+	0x42, 0x8a, 0x35, 0x80, 0x4d, 0x32, 0x31, 0x1d, 0xba, 0x71, 0x68, 0x68, 0x23, 0x6d, 0x7c, 0xcb,
+	0xe9, 0xc6, 0xa1, 0xf5, 0xb3, 0x0b, 0x7b, 0xff, 0xe1, 0xec, 0x10, 0x76, 0xd4, 0x69, 0x2b, 0xe7,
+	0x36, 0xbd, 0xbf, 0x09, 0xd9, 0x43, 0xd8, 0xcf, 0x04, 0xca, 0x38, 0x9d, 0xa1, 0x2b, 0x45, 0x11,
+	0x44, 0x3c, 0xa4, 0x61, 0xf5, 0x9c, 0xbd, 0x5a, 0xff, 0xa0, 0x64, 0x76, 0x04, 0x3a, 0xd2, 0x1c,
+	0xdc, 0xaf, 0x5c, 0x92, 0xb1, 0x47, 0xc6, 0x5d, 0xa5, 0xbe, 0xe2, 0xb2, 0xb6, 0xa9, 0x61, 0xae,
+	0x6c, 0x1b, 0xca, 0xa6, 0xd4, 0xda, 0x76, 0x0c, 0xc3, 0xd5, 0xc1, 0x64, 0x74, 0xc3, 0x22, 0xf7,
+	0x64, 0x2c, 0x52, 0x37, 0x45, 0x63, 0x93, 0x90, 0x41, 0xed, 0x20, 0xe8, 0x65, 0x55, 0x3f, 0x41,
+	0xf6, 0x14, 0x8c, 0x66, 0x94, 0x16, 0xba, 0x45, 0xe8, 0xdd, 0x46, 0xa8, 0x36, 0xd8, 0x0c, 0xd7,
+	0x02, 0xb7, 0x15, 0xd8, 0x88, 0x79, 0x03, 0x5a, 0x9f, 0xe1, 0x1e, 0xed, 0xde, 0x89, 0x77, 0xb1,
+	0xf6, 0x9d, 0xb5, 0xce, 0x60, 0xd0, 0x6c, 0xbe, 0xae, 0x2d, 0xb3, 0xbe, 0x54, 0x7d, 0xcf, 0xbc,
+	0xa4, 0x58, 0x7f, 0xea, 0x8f, 0x60, 0xb4, 0xba, 0xaf, 0x2b, 0xf6, 0xf4, 0x68, 0xfe, 0xd7, 0xec,
+	0xcc, 0x17, 0xa6, 0x76, 0xbd, 0x30, 0xb5, 0x3f, 0x0b, 0x53, 0xfb, 0xb6, 0x34, 0x3b, 0xd7, 0x4b,
+	0xb3, 0xf3, 0x6b, 0x69, 0x76, 0x3e, 0xd5, 0x97, 0x8e, 0xbf, 0x45, 0x57, 0xc9, 0x93, 0x7f, 0x03,
+	0x00, 0x8a, 0xa8, 0xa7, 0x1f, 0xa1, 0x04, 0x00, 0x00,
 }
 
 func (m *SeriesRequestHints) Marshal() (dAtA []byte, err error) {
@@ -351,6 +419,26 @@ func (m *SeriesRequestHints) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SliceChunks {
+		i--
+		if m.SliceChunks {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.EnableQueryStats {
+		i--
+		if m.EnableQueryStats {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
 	if len(m.BlockMatchers) > 0 {
 		for iNdEx := len(m.BlockMatchers) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -388,6 +476,20 @@ func (m *SeriesResponseHints) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.BlockStats) > 0 {
+		for iNdEx := len(m.BlockStats) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.BlockStats[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintHints(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
 	if len(m.QueriedBlocks) > 0 {
 		for iNdEx := len(m.QueriedBlocks) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -435,6 +537,66 @@ func (m *Block) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *BlockQueryStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BlockQueryStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *BlockQueryStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.ChunksFetchDurationNs != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksFetchDurationNs))
+		i--
+		dAtA[i] = 0x38
+	}
+	if m.SeriesFetchDurationNs != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesFetchDurationNs))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.PostingsFetchDurationNs != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsFetchDurationNs))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.ChunksFetched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksFetched))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.SeriesFetched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesFetched))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.PostingsTouched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsTouched))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.BlockId) > 0 {
+		i -= len(m.BlockId)
+		copy(dAtA[i:], m.BlockId)
+		i = encodeVarintHints(dAtA, i, uint64(len(m.BlockId)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *LabelNamesRequestHints) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -606,6 +768,12 @@ func (m *SeriesRequestHints) Size() (n int) {
 			n += 1 + l + sovHints(uint64(l))
 		}
 	}
+	if m.EnableQueryStats {
+		n += 2
+	}
+	if m.SliceChunks {
+		n += 2
+	}
 	return n
 }
 
@@ -621,6 +789,12 @@ func (m *SeriesResponseHints) Size() (n int) {
 			n += 1 + l + sovHints(uint64(l))
 		}
 	}
+	if len(m.BlockStats) > 0 {
+		for _, e := range m.BlockStats {
+			l = e.Size()
+			n += 1 + l + sovHints(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -637,6 +811,37 @@ func (m *Block) Size() (n int) {
 	return n
 }
 
+func (m *BlockQueryStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.BlockId)
+	if l > 0 {
+		n += 1 + l + sovHints(uint64(l))
+	}
+	if m.PostingsTouched != 0 {
+		n += 1 + sovHints(uint64(m.PostingsTouched))
+	}
+	if m.SeriesFetched != 0 {
+		n += 1 + sovHints(uint64(m.SeriesFetched))
+	}
+	if m.ChunksFetched != 0 {
+		n += 1 + sovHints(uint64(m.ChunksFetched))
+	}
+	if m.PostingsFetchDurationNs != 0 {
+		n += 1 + sovHints(uint64(m.PostingsFetchDurationNs))
+	}
+	if m.SeriesFetchDurationNs != 0 {
+		n += 1 + sovHints(uint64(m.SeriesFetchDurationNs))
+	}
+	if m.ChunksFetchDurationNs != 0 {
+		n += 1 + sovHints(uint64(m.ChunksFetchDurationNs))
+	}
+	return n
+}
+
 func (m *LabelNamesRequestHints) Size() (n int) {
 	if m == nil {
 		return 0
@@ -766,6 +971,46 @@ func (m *SeriesRequestHints) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EnableQueryStats", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.EnableQueryStats = bool(v != 0)
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SliceChunks", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SliceChunks = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipHints(dAtA[iNdEx:])
@@ -850,6 +1095,40 @@ func (m *SeriesResponseHints) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockStats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockStats = append(m.BlockStats, BlockQueryStats{})
+			if err := m.BlockStats[len(m.BlockStats)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipHints(dAtA[iNdEx:])
@@ -953,6 +1232,202 @@ func (m *Block) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *BlockQueryStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BlockQueryStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BlockQueryStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockId = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsTouched", wireType)
+			}
+			m.PostingsTouched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsTouched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesFetched", wireType)
+			}
+			m.SeriesFetched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesFetched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksFetched", wireType)
+			}
+			m.ChunksFetched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksFetched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsFetchDurationNs", wireType)
+			}
+			m.PostingsFetchDurationNs = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsFetchDurationNs |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesFetchDurationNs", wireType)
+			}
+			m.SeriesFetchDurationNs = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesFetchDurationNs |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksFetchDurationNs", wireType)
+			}
+			m.ChunksFetchDurationNs = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksFetchDurationNs |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *LabelNamesRequestHints) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
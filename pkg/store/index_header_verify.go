@@ -0,0 +1,95 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// WithIndexHeaderVerification makes the store verify the index-headers on disk against the index of their block in the
+// bucket before loading them, and rebuild the ones that don't match, e.g. because they were truncated.
+func WithIndexHeaderVerification() BucketStoreOption {
+	return func(s *BucketStore) {
+		s.verifyIndexHeaders = true
+	}
+}
+
+// VerifyIndexHeaders verifies the index-headers of all loaded blocks against their source index, and reloads the blocks
+// whose index-header doesn't match with a rebuilt one. The blocks are served from their current index-header until
+// they are reloaded. It requires WithIndexHeaderVerification.
+func (s *BucketStore) VerifyIndexHeaders(ctx context.Context) error {
+	if !s.verifyIndexHeaders {
+		return errors.New("index-header verification is disabled")
+	}
+
+	s.mtx.RLock()
+	metas := make([]*metadata.Meta, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		metas = append(metas, b.meta)
+	}
+	s.mtx.RUnlock()
+
+	var failed int
+	for _, meta := range metas {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fn := filepath.Join(s.dir, meta.ULID.String(), block.IndexHeaderFilename)
+		err := indexheader.VerifyBinary(ctx, s.bkt, meta.ULID, fn)
+		if err == nil {
+			continue
+		}
+
+		level.Warn(s.logger).Log("msg", "index-header failed verification; reloading block", "block", meta.ULID, "err", err)
+		if err := s.reloadBlock(ctx, meta); err != nil {
+			level.Warn(s.logger).Log("msg", "reloading block failed", "block", meta.ULID, "err", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to reload %d blocks whose index-header failed verification", failed)
+	}
+	return nil
+}
+
+// reloadBlock replaces the loaded block with a newly loaded one, whose index-header is verified again and rebuilt if
+// needed, without the block missing from the store meanwhile.
+func (s *BucketStore) reloadBlock(ctx context.Context, meta *metadata.Meta) error {
+	b, err := s.loadBlock(ctx, meta)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	old, ok := s.blocks[meta.ULID]
+	if !ok {
+		// The block was dropped in the meantime.
+		s.mtx.Unlock()
+		runutil.CloseWithLogOnErr(s.logger, b, "reloaded block")
+		return os.RemoveAll(b.dir)
+	}
+	set := s.blockSets[labels.FromMap(meta.Thanos.Labels).Hash()]
+	set.remove(meta.ULID)
+	if err := set.add(b); err != nil {
+		// Never happens, as the block has the labels of the set.
+		s.mtx.Unlock()
+		runutil.CloseWithLogOnErr(s.logger, b, "reloaded block")
+		return errors.Wrap(err, "add block to set")
+	}
+	s.blocks[meta.ULID] = b
+	s.mtx.Unlock()
+
+	return old.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestBucketStore_VerifyIndexHeaders(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := objstore.NewInMemBucket()
+	dir := t.TempDir()
+
+	id, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 10, 0, 1000, labels.FromStrings("ext1", "value1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, objstore.WithNoopInstr(bkt), dir, nil, nil)
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	storeDir := filepath.Join(dir, "store")
+	store, err := NewBucketStore(
+		objstore.WithNoopInstr(bkt),
+		metaFetcher,
+		storeDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		true,
+		false,
+		0,
+		WithRegistry(reg),
+		WithIndexHeaderVerification(),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, store.Close()) }()
+
+	rebuilds := func() string {
+		return `
+# HELP thanos_bucket_store_indexheader_rebuilds_total Total number of index-headers on disk rebuilt because they failed verification against their source index.
+# TYPE thanos_bucket_store_indexheader_rebuilds_total counter
+thanos_bucket_store_indexheader_rebuilds_total `
+	}
+
+	testutil.Ok(t, store.InitialSync(ctx))
+	testutil.Ok(t, store.VerifyIndexHeaders(ctx))
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(rebuilds()+"0\n"), "thanos_bucket_store_indexheader_rebuilds_total"))
+
+	// Corrupt the index-header of the loaded block.
+	store.mtx.RLock()
+	old := store.blocks[id]
+	store.mtx.RUnlock()
+	headerPath := filepath.Join(storeDir, id.String(), block.IndexHeaderFilename)
+	fi, err := os.Stat(headerPath)
+	testutil.Ok(t, err)
+	testutil.Ok(t, os.Truncate(headerPath, fi.Size()-1))
+
+	testutil.Ok(t, store.VerifyIndexHeaders(ctx))
+	testutil.Ok(t, promtest.GatherAndCompare(reg, strings.NewReader(rebuilds()+"1\n"), "thanos_bucket_store_indexheader_rebuilds_total"))
+	testutil.Ok(t, indexheader.VerifyBinary(ctx, bkt, id, headerPath))
+
+	// The block was reloaded with the rebuilt index-header.
+	store.mtx.RLock()
+	b := store.blocks[id]
+	store.mtx.RUnlock()
+	testutil.Assert(t, b != old, "expected block to be reloaded")
+	var setBlocks []*bucketBlock
+	for _, bs := range store.blockSets[labels.FromStrings("ext1", "value1").Hash()].blocks {
+		setBlocks = append(setBlocks, bs...)
+	}
+	testutil.Equals(t, []*bucketBlock{b}, setBlocks)
+
+	labelNames, err := b.indexHeaderReader.LabelNames()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, labelNames)
+}
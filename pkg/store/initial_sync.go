@@ -0,0 +1,154 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+const (
+	labelRecent = "recent"
+	labelOlder  = "older"
+)
+
+// WithServeWhileSyncing makes the initial sync call ready as soon as the blocks with samples newer than the given
+// window are loaded, rather than once all blocks are, so that the store can serve recent data while the older blocks
+// are still loading. Until the initial sync is done, the store advertises only the time range of which all blocks are
+// loaded, so that queriers do not send it queries it can't answer yet. Ready is called once, at the latest when the
+// initial sync is done.
+func WithServeWhileSyncing(window time.Duration, ready func()) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.serveWhileSyncingWindow = window
+		s.serveWhileSyncingReady = ready
+	}
+}
+
+// initialSyncProgress tracks the blocks loaded by the initial sync. Blocks are loaded from the newest to the oldest,
+// by max time, so that the time range of which all blocks are loaded grows towards the past.
+type initialSyncProgress struct {
+	metrics *bucketStoreMetrics
+	// Blocks with samples after this time, in milliseconds, belong to the recent window.
+	windowMinTime int64
+	ready         func()
+
+	mtx sync.Mutex
+	// Max times of the blocks to load, from the newest to the oldest, and whether they are loaded.
+	maxTimes []int64
+	done     []bool
+	index    map[ulid.ULID]int
+	// Index of the newest block which is not loaded yet, len(maxTimes) once all blocks are.
+	next    int
+	isReady bool
+}
+
+// newInitialSyncProgress returns the progress of loading the given blocks, which must be sorted from the newest to the
+// oldest.
+func newInitialSyncProgress(metrics *bucketStoreMetrics, metas []*metadata.Meta, window time.Duration, ready func(), now time.Time) *initialSyncProgress {
+	p := &initialSyncProgress{
+		metrics:       metrics,
+		windowMinTime: now.Add(-window).UnixMilli(),
+		ready:         ready,
+		maxTimes:      make([]int64, 0, len(metas)),
+		done:          make([]bool, len(metas)),
+		index:         make(map[ulid.ULID]int, len(metas)),
+	}
+	var recent, older float64
+	for i, m := range metas {
+		p.maxTimes = append(p.maxTimes, m.MaxTime)
+		p.index[m.ULID] = i
+		if m.MaxTime > p.windowMinTime {
+			recent++
+		} else {
+			older++
+		}
+	}
+	metrics.initialSyncPendingBlocks.WithLabelValues(labelRecent).Set(recent)
+	metrics.initialSyncPendingBlocks.WithLabelValues(labelOlder).Set(older)
+	if len(p.maxTimes) > 0 {
+		metrics.initialSyncLoadedMinTime.Set(float64(p.maxTimes[0]) / 1000)
+	}
+	return p
+}
+
+// sortMetasNewestFirst sorts the blocks from the newest to the oldest by max time.
+func sortMetasNewestFirst(metas []*metadata.Meta) {
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].MaxTime != metas[j].MaxTime {
+			return metas[i].MaxTime > metas[j].MaxTime
+		}
+		return metas[i].MinTime > metas[j].MinTime
+	})
+}
+
+// blockDone marks the block as done, whether it was loaded or failed to load, and calls ready once the recent window
+// is loaded.
+func (p *initialSyncProgress) blockDone(id ulid.ULID) {
+	p.mtx.Lock()
+	i, ok := p.index[id]
+	if !ok || p.done[i] {
+		p.mtx.Unlock()
+		return
+	}
+	p.done[i] = true
+	if p.maxTimes[i] > p.windowMinTime {
+		p.metrics.initialSyncPendingBlocks.WithLabelValues(labelRecent).Dec()
+	} else {
+		p.metrics.initialSyncPendingBlocks.WithLabelValues(labelOlder).Dec()
+	}
+	for p.next < len(p.done) && p.done[p.next] {
+		p.next++
+	}
+	if p.next < len(p.maxTimes) {
+		p.metrics.initialSyncLoadedMinTime.Set(float64(p.maxTimes[p.next]) / 1000)
+	}
+	p.mtx.Unlock()
+
+	p.readyIfRecentLoaded()
+}
+
+// readyIfRecentLoaded calls ready if all blocks of the recent window are loaded and it was not called yet.
+func (p *initialSyncProgress) readyIfRecentLoaded() {
+	p.mtx.Lock()
+	callReady := !p.isReady && (p.next == len(p.maxTimes) || p.maxTimes[p.next] <= p.windowMinTime)
+	if callReady {
+		p.isReady = true
+	}
+	p.mtx.Unlock()
+
+	if callReady && p.ready != nil {
+		p.ready()
+	}
+}
+
+// finish calls ready if it was not called yet, e.g. because there were no blocks to load.
+func (p *initialSyncProgress) finish() {
+	p.mtx.Lock()
+	callReady := !p.isReady
+	p.isReady = true
+	p.mtx.Unlock()
+
+	p.metrics.initialSyncPendingBlocks.WithLabelValues(labelRecent).Set(0)
+	p.metrics.initialSyncPendingBlocks.WithLabelValues(labelOlder).Set(0)
+	p.metrics.initialSyncLoadedMinTime.Set(0)
+	if callReady && p.ready != nil {
+		p.ready()
+	}
+}
+
+// minTime returns the time, in milliseconds, from which all blocks are loaded, false if all blocks are.
+func (p *initialSyncProgress) minTime() (int64, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.next == len(p.maxTimes) {
+		return 0, false
+	}
+	return p.maxTimes[p.next], true
+}
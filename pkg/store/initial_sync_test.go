@@ -0,0 +1,140 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestInitialSyncProgress(t *testing.T) {
+	now := time.Now()
+	metas := []*metadata.Meta{
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: now.Add(-20 * time.Hour).UnixMilli(), MaxTime: now.UnixMilli()}},
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil), MinTime: now.Add(-40 * time.Hour).UnixMilli(), MaxTime: now.Add(-20 * time.Hour).UnixMilli()}},
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(3, nil), MinTime: now.Add(-20 * time.Hour).UnixMilli(), MaxTime: now.Add(-10 * time.Hour).UnixMilli()}},
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(4, nil), MinTime: now.Add(-60 * time.Hour).UnixMilli(), MaxTime: now.Add(-40 * time.Hour).UnixMilli()}},
+	}
+	sortMetasNewestFirst(metas)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(3, nil), ulid.MustNew(2, nil), ulid.MustNew(4, nil)},
+		[]ulid.ULID{metas[0].ULID, metas[1].ULID, metas[2].ULID, metas[3].ULID})
+
+	metrics := newBucketStoreMetrics(prometheus.NewRegistry())
+	readyCalls := 0
+	p := newInitialSyncProgress(metrics, metas, 24*time.Hour, func() { readyCalls++ }, now)
+	testutil.Equals(t, 3.0, promtest.ToFloat64(metrics.initialSyncPendingBlocks.WithLabelValues(labelRecent)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.initialSyncPendingBlocks.WithLabelValues(labelOlder)))
+
+	p.readyIfRecentLoaded()
+	testutil.Equals(t, 0, readyCalls)
+	mint, ok := p.minTime()
+	testutil.Assert(t, ok, "blocks are still loading")
+	testutil.Equals(t, metas[0].MaxTime, mint)
+
+	// Blocks finishing out of order don't grow the loaded time range until the newer ones are done too.
+	p.blockDone(metas[1].ULID)
+	mint, _ = p.minTime()
+	testutil.Equals(t, metas[0].MaxTime, mint)
+	p.blockDone(metas[0].ULID)
+	mint, _ = p.minTime()
+	testutil.Equals(t, metas[2].MaxTime, mint)
+	testutil.Equals(t, 0, readyCalls)
+	testutil.Equals(t, float64(metas[2].MaxTime)/1000, promtest.ToFloat64(metrics.initialSyncLoadedMinTime))
+
+	// Only the blocks older than the window are left.
+	p.blockDone(metas[2].ULID)
+	testutil.Equals(t, 1, readyCalls)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(metrics.initialSyncPendingBlocks.WithLabelValues(labelRecent)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.initialSyncPendingBlocks.WithLabelValues(labelOlder)))
+
+	p.blockDone(metas[3].ULID)
+	p.blockDone(metas[3].ULID)
+	_, ok = p.minTime()
+	testutil.Assert(t, !ok, "all blocks are loaded")
+	p.finish()
+	testutil.Equals(t, 1, readyCalls)
+
+	// Without recent blocks, the store is ready right away.
+	readyCalls = 0
+	p = newInitialSyncProgress(metrics, metas[3:], 24*time.Hour, func() { readyCalls++ }, now)
+	p.readyIfRecentLoaded()
+	testutil.Equals(t, 1, readyCalls)
+}
+
+func TestBucketStore_ServeWhileSyncing(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := objstore.NewInMemBucket()
+	dir := t.TempDir()
+
+	// A recent block overlapping an older one, so that the older one holds back the advertised time range.
+	now := time.Now()
+	series := []labels.Labels{labels.FromStrings("a", "1")}
+	recentMint, recentMaxt := timestamp.FromTime(now.Add(-20*24*time.Hour)), timestamp.FromTime(now)
+	olderMint, olderMaxt := timestamp.FromTime(now.Add(-30*24*time.Hour)), timestamp.FromTime(now.Add(-16*24*time.Hour))
+	for _, r := range [][2]int64{{recentMint, recentMaxt}, {olderMint, olderMaxt}} {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 10, r[0], r[1], labels.FromStrings("ext1", "value1"), 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, objstore.WithNoopInstr(bkt), dir, nil, nil)
+	testutil.Ok(t, err)
+
+	var (
+		store                *BucketStore
+		readyMint, readyMaxt int64
+		readyBlocks          int
+	)
+	store, err = NewBucketStore(
+		objstore.WithNoopInstr(bkt),
+		metaFetcher,
+		filepath.Join(dir, "store"),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		1,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		true,
+		false,
+		0,
+		WithRegistry(prometheus.NewRegistry()),
+		WithServeWhileSyncing(14*24*time.Hour, func() {
+			readyMint, readyMaxt = store.TimeRange()
+			store.mtx.RLock()
+			readyBlocks = len(store.blocks)
+			store.mtx.RUnlock()
+		}),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, store.Close()) }()
+
+	testutil.Ok(t, store.InitialSync(ctx))
+
+	// The store got ready once the recent block was loaded, advertising only the time range after the older block.
+	testutil.Equals(t, 1, readyBlocks)
+	testutil.Equals(t, olderMaxt, readyMint)
+	testutil.Equals(t, recentMaxt, readyMaxt)
+
+	mint, maxt := store.TimeRange()
+	testutil.Equals(t, olderMint, mint)
+	testutil.Equals(t, recentMaxt, maxt)
+}
@@ -208,14 +208,19 @@ func (s *LocalStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	return nil
 }
 
-// LabelNames returns all known label names.
-func (s *LocalStore) LabelNames(_ context.Context, _ *storepb.LabelNamesRequest) (
+// LabelNames returns all known label names of the series matching the matchers within the time range.
+func (s *LocalStore) LabelNames(_ context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
+	lsets, err := s.labelSets(r.Matchers, r.Start, r.End)
+	if err != nil {
+		return nil, err
+	}
+
 	// TODO(bwplotka): Consider precomputing.
 	names := map[string]struct{}{}
-	for _, series := range s.series {
-		for _, l := range series.Labels {
+	for _, lbls := range lsets {
+		for _, l := range lbls {
 			names[l.Name] = struct{}{}
 		}
 	}
@@ -226,13 +231,18 @@ func (s *LocalStore) LabelNames(_ context.Context, _ *storepb.LabelNamesRequest)
 	return resp, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name of the series matching the matchers within the
+// time range.
 func (s *LocalStore) LabelValues(_ context.Context, r *storepb.LabelValuesRequest) (
 	*storepb.LabelValuesResponse, error,
 ) {
+	lsets, err := s.labelSets(r.Matchers, r.Start, r.End)
+	if err != nil {
+		return nil, err
+	}
+
 	vals := map[string]struct{}{}
-	for _, series := range s.series {
-		lbls := labelpb.ZLabelsToPromLabels(series.Labels)
+	for _, lbls := range lsets {
 		val := lbls.Get(r.Label)
 		if val == "" {
 			continue
@@ -246,6 +256,39 @@ func (s *LocalStore) LabelValues(_ context.Context, r *storepb.LabelValuesReques
 	return resp, nil
 }
 
+// labelSets returns the labels of the series matching the matchers with chunks overlapping the time range.
+func (s *LocalStore) labelSets(ms []storepb.LabelMatcher, mint, maxt int64) ([]labels.Labels, error) {
+	match, matchers, err := matchesExternalLabels(ms, s.extLabels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return nil, nil
+	}
+
+	var lsets []labels.Labels
+	for _, series := range s.series {
+		lbls := labelpb.ZLabelsToPromLabels(series.Labels)
+		matches := true
+		for _, m := range matchers {
+			if !m.Matches(lbls.Get(m.Name)) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		for _, c := range series.Chunks {
+			if c.MaxTime >= mint && c.MinTime <= maxt {
+				lsets = append(lsets, lbls)
+				break
+			}
+		}
+	}
+	return lsets, nil
+}
+
 func (s *LocalStore) Close() (err error) {
 	return s.c.Close()
 }
@@ -0,0 +1,169 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	matcherCacheCompiled = "compiled"
+	matcherCacheValues   = "values"
+)
+
+// matcherKey identifies a regex matcher of a single label name.
+type matcherKey struct {
+	typ   labels.MatchType
+	name  string
+	value string
+}
+
+type matchedValueKey struct {
+	matcherKey
+	labelValue string
+}
+
+// MatcherCache caches compiled regex label matchers and the results of evaluating them against
+// label values of store label sets, so that repeated identical selects do not compile and
+// evaluate the same regexes again. Other matcher types are cheap and bypass the cache.
+// A nil *MatcherCache is valid and disables caching.
+type MatcherCache struct {
+	mtx      sync.Mutex
+	compiled *lru.LRU
+
+	// Results of matching label values are kept for at most ttl and dropped when the set of stores changes.
+	valuesMtx     sync.Mutex
+	values        map[matchedValueKey]bool
+	maxValues     int
+	ttl           time.Duration
+	valuesExpires time.Time
+
+	compiledHits, compiledMisses prometheus.Counter
+	valuesHits, valuesMisses     prometheus.Counter
+}
+
+// NewMatcherCache returns a MatcherCache holding at most size compiled matchers and size matched label values.
+// Matched label values are forgotten after ttl.
+func NewMatcherCache(reg prometheus.Registerer, size int, ttl time.Duration) (*MatcherCache, error) {
+	compiled, err := lru.NewLRU(size, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create compiled matchers LRU")
+	}
+	hits := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_matcher_cache_hits_total",
+		Help: "Total number of regex matcher cache hits.",
+	}, []string{"cache"})
+	misses := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_matcher_cache_misses_total",
+		Help: "Total number of regex matcher cache misses.",
+	}, []string{"cache"})
+
+	return &MatcherCache{
+		compiled:       compiled,
+		values:         make(map[matchedValueKey]bool),
+		maxValues:      size,
+		ttl:            ttl,
+		compiledHits:   hits.WithLabelValues(matcherCacheCompiled),
+		compiledMisses: misses.WithLabelValues(matcherCacheCompiled),
+		valuesHits:     hits.WithLabelValues(matcherCacheValues),
+		valuesMisses:   misses.WithLabelValues(matcherCacheValues),
+	}, nil
+}
+
+// MatchersToPromMatchers is like storepb.MatchersToPromMatchers, but reuses compiled regex matchers.
+func (c *MatcherCache) MatchersToPromMatchers(ms ...storepb.LabelMatcher) ([]*labels.Matcher, error) {
+	if c == nil {
+		return storepb.MatchersToPromMatchers(ms...)
+	}
+
+	res := make([]*labels.Matcher, 0, len(ms))
+	for _, m := range ms {
+		if m.Type != storepb.LabelMatcher_RE && m.Type != storepb.LabelMatcher_NRE {
+			pm, err := storepb.MatchersToPromMatchers(m)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, pm...)
+			continue
+		}
+
+		key := matcherKey{typ: labels.MatchRegexp, name: m.Name, value: m.Value}
+		if m.Type == storepb.LabelMatcher_NRE {
+			key.typ = labels.MatchNotRegexp
+		}
+
+		c.mtx.Lock()
+		cached, ok := c.compiled.Get(key)
+		c.mtx.Unlock()
+		if ok {
+			c.compiledHits.Inc()
+			res = append(res, cached.(*labels.Matcher))
+			continue
+		}
+
+		c.compiledMisses.Inc()
+		pm, err := labels.NewMatcher(key.typ, key.name, key.value)
+		if err != nil {
+			return nil, err
+		}
+		c.mtx.Lock()
+		c.compiled.Add(key, pm)
+		c.mtx.Unlock()
+		res = append(res, pm)
+	}
+	return res, nil
+}
+
+// Matches returns true if the matcher matches the given label value.
+func (c *MatcherCache) Matches(m *labels.Matcher, v string) bool {
+	if c == nil || (m.Type != labels.MatchRegexp && m.Type != labels.MatchNotRegexp) {
+		return m.Matches(v)
+	}
+
+	key := matchedValueKey{matcherKey: matcherKey{typ: m.Type, name: m.Name, value: m.Value}, labelValue: v}
+
+	c.valuesMtx.Lock()
+	now := time.Now()
+	if now.After(c.valuesExpires) {
+		c.values = make(map[matchedValueKey]bool, len(c.values))
+		c.valuesExpires = now.Add(c.ttl)
+	}
+	matched, ok := c.values[key]
+	c.valuesMtx.Unlock()
+	if ok {
+		c.valuesHits.Inc()
+		return matched
+	}
+
+	c.valuesMisses.Inc()
+	matched = m.Matches(v)
+
+	c.valuesMtx.Lock()
+	if len(c.values) < c.maxValues {
+		c.values[key] = matched
+	}
+	c.valuesMtx.Unlock()
+	return matched
+}
+
+// InvalidateValues drops all cached results of matching label values, e.g. because the set of stores changed.
+func (c *MatcherCache) InvalidateValues() {
+	if c == nil {
+		return
+	}
+
+	c.valuesMtx.Lock()
+	defer c.valuesMtx.Unlock()
+	c.values = make(map[matchedValueKey]bool)
+	c.valuesExpires = time.Now().Add(c.ttl)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMatcherCache(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := NewMatcherCache(reg, 2, time.Minute)
+	testutil.Ok(t, err)
+
+	ms := []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "job", Value: "api"},
+		{Type: storepb.LabelMatcher_RE, Name: "cluster", Value: "eu-.*"},
+		{Type: storepb.LabelMatcher_NRE, Name: "cluster", Value: "eu-.*"},
+	}
+	exp, err := storepb.MatchersToPromMatchers(ms...)
+	testutil.Ok(t, err)
+
+	for i := 0; i < 3; i++ {
+		got, err := c.MatchersToPromMatchers(ms...)
+		testutil.Ok(t, err)
+		testutil.Equals(t, len(exp), len(got))
+		for j := range exp {
+			testutil.Equals(t, exp[j].String(), got[j].String())
+		}
+	}
+	// Only regex matchers are cached, both regex types separately.
+	testutil.Equals(t, 2.0, promtest.ToFloat64(c.compiledMisses))
+	testutil.Equals(t, 4.0, promtest.ToFloat64(c.compiledHits))
+
+	_, err = c.MatchersToPromMatchers(storepb.LabelMatcher{Type: storepb.LabelMatcher_RE, Name: "a", Value: "("})
+	testutil.NotOk(t, err)
+
+	re := labels.MustNewMatcher(labels.MatchRegexp, "cluster", "eu-.*")
+	for i := 0; i < 2; i++ {
+		testutil.Assert(t, c.Matches(re, "eu-west"))
+		testutil.Assert(t, !c.Matches(re, "us-east"))
+	}
+	testutil.Equals(t, 2.0, promtest.ToFloat64(c.valuesMisses))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(c.valuesHits))
+
+	// Equal matchers bypass the cache.
+	testutil.Assert(t, c.Matches(labels.MustNewMatcher(labels.MatchEqual, "cluster", "eu-west"), "eu-west"))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(c.valuesMisses))
+
+	// No more than size results are kept.
+	testutil.Assert(t, c.Matches(re, "eu-central"))
+	testutil.Assert(t, c.Matches(re, "eu-central"))
+	testutil.Equals(t, 4.0, promtest.ToFloat64(c.valuesMisses))
+
+	c.InvalidateValues()
+	testutil.Assert(t, c.Matches(re, "eu-west"))
+	testutil.Equals(t, 5.0, promtest.ToFloat64(c.valuesMisses))
+}
+
+func TestMatcherCache_TTL(t *testing.T) {
+	c, err := NewMatcherCache(nil, 10, time.Millisecond)
+	testutil.Ok(t, err)
+
+	re := labels.MustNewMatcher(labels.MatchRegexp, "cluster", "eu-.*")
+	testutil.Assert(t, c.Matches(re, "eu-west"))
+	testutil.Assert(t, c.Matches(re, "eu-west"))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(c.valuesMisses))
+
+	time.Sleep(5 * time.Millisecond)
+	testutil.Assert(t, c.Matches(re, "eu-west"))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(c.valuesMisses))
+}
+
+func TestMatcherCache_Nil(t *testing.T) {
+	var c *MatcherCache
+
+	got, err := c.MatchersToPromMatchers(storepb.LabelMatcher{Type: storepb.LabelMatcher_RE, Name: "a", Value: "b.*"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(got))
+	testutil.Assert(t, c.Matches(got[0], "bc"))
+	c.InvalidateValues()
+}
+
+// BenchmarkStoreMatches_MatcherCache simulates the store pruning done for the same dashboard query issued repeatedly.
+func BenchmarkStoreMatches_MatcherCache(b *testing.B) {
+	var stores []Client
+	for i := 0; i < 100; i++ {
+		stores = append(stores, &testClient{
+			labelSets: []labels.Labels{labels.FromStrings("cluster", fmt.Sprintf("cluster-%d", i), "region", fmt.Sprintf("region-%d", i%10))},
+			minTime:   0,
+			maxTime:   1,
+		})
+	}
+	ms := []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "http_requests_total"},
+		{Type: storepb.LabelMatcher_RE, Name: "cluster", Value: "(cluster-1.*|cluster-2.*|cluster-3.*|.*-4[0-9])"},
+		{Type: storepb.LabelMatcher_NRE, Name: "region", Value: ".*-(5|6|7)"},
+	}
+
+	for _, tcase := range []struct {
+		name  string
+		cache func() *MatcherCache
+	}{
+		{name: "no cache", cache: func() *MatcherCache { return nil }},
+		{name: "cache", cache: func() *MatcherCache {
+			c, err := NewMatcherCache(nil, 1000, time.Minute)
+			testutil.Ok(b, err)
+			return c
+		}},
+	} {
+		b.Run(tcase.name, func(b *testing.B) {
+			c := tcase.cache()
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				matchers, err := c.MatchersToPromMatchers(ms...)
+				testutil.Ok(b, err)
+				for _, st := range stores {
+					storeMatches(ctx, c, st, 0, 1, matchers...)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+)
+
+const maxMetricNameFilterHashCount = 32
+
+// MetricNameFilter is a bloom filter of the metric names of the series of a store. It may contain metric names the
+// store does not have, but it always contains the ones it has, so that stores not containing the metric name of an
+// equality matcher can be skipped. MetricNameFilter is immutable and safe for concurrent use.
+type MetricNameFilter struct {
+	version   string
+	hashCount uint32
+	bits      []uint64
+}
+
+// metricNameHash returns the hash of the metric name the filter is built from.
+func metricNameHash(name string) uint64 {
+	return xxhash.Sum64String(name)
+}
+
+// NewMetricNameFilter returns a filter of the metric names with the given hashes, sized for the given false positive
+// rate. The rate must be within (0, 1).
+func NewMetricNameFilter(nameHashes []uint64, falsePositiveRate float64) *MetricNameFilter {
+	n := float64(len(nameHashes))
+	if n < 1 {
+		n = 1
+	}
+	// Optimal number of bits and hashes for n elements, see https://en.wikipedia.org/wiki/Bloom_filter.
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := uint32(math.Round(m / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > maxMetricNameFilterHashCount {
+		k = maxMetricNameFilterHashCount
+	}
+
+	f := &MetricNameFilter{hashCount: k, bits: make([]uint64, int(math.Ceil(m/64)))}
+	for _, h := range nameHashes {
+		f.add(h)
+	}
+	f.version = f.contentVersion()
+	return f
+}
+
+// MetricNameFilterFromBits returns the filter of the given version, as returned by the accessors of a MetricNameFilter.
+func MetricNameFilterFromBits(version string, hashCount uint32, bits []uint64) (*MetricNameFilter, error) {
+	if hashCount < 1 || hashCount > maxMetricNameFilterHashCount {
+		return nil, errors.Errorf("invalid hash count %d of metric name filter", hashCount)
+	}
+	if len(bits) == 0 {
+		return nil, errors.New("metric name filter without bits")
+	}
+	return &MetricNameFilter{version: version, hashCount: hashCount, bits: bits}, nil
+}
+
+// withNameHashes returns a copy of the filter with the metric names of the given hashes added. The false positive rate
+// of the copy increases with every metric name added beyond the ones the filter was sized for.
+func (f *MetricNameFilter) withNameHashes(nameHashes []uint64) *MetricNameFilter {
+	c := &MetricNameFilter{hashCount: f.hashCount, bits: make([]uint64, len(f.bits))}
+	copy(c.bits, f.bits)
+	for _, h := range nameHashes {
+		c.add(h)
+	}
+	c.version = c.contentVersion()
+	return c
+}
+
+// locations calls fn with the bit locations of the metric name with the given hash, using double hashing.
+func (f *MetricNameFilter) locations(h uint64, fn func(i uint64) bool) {
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := uint64(0); i < uint64(f.hashCount); i++ {
+		if !fn((h1 + i*h2) % m) {
+			return
+		}
+	}
+}
+
+func (f *MetricNameFilter) add(h uint64) {
+	f.locations(h, func(i uint64) bool {
+		f.bits[i/64] |= 1 << (i % 64)
+		return true
+	})
+}
+
+// MayContain returns false if the store does not have series of the metric name.
+func (f *MetricNameFilter) MayContain(name string) bool {
+	return f.mayContainHash(metricNameHash(name))
+}
+
+func (f *MetricNameFilter) mayContainHash(h uint64) bool {
+	ok := true
+	f.locations(h, func(i uint64) bool {
+		ok = f.bits[i/64]&(1<<(i%64)) != 0
+		return ok
+	})
+	return ok
+}
+
+// MatchesMetricName returns false if the matchers select a metric name by equality which the store does not have.
+func (f *MetricNameFilter) MatchesMetricName(matchers []*labels.Matcher) (ok bool, name string) {
+	for _, m := range matchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual && !f.MayContain(m.Value) {
+			return false, m.Value
+		}
+	}
+	return true, ""
+}
+
+// Version identifies the content of the filter.
+func (f *MetricNameFilter) Version() string { return f.version }
+
+// HashCount returns the number of bits set for each metric name.
+func (f *MetricNameFilter) HashCount() uint32 { return f.hashCount }
+
+// Bits returns the bits of the filter. They must not be modified.
+func (f *MetricNameFilter) Bits() []uint64 { return f.bits }
+
+func (f *MetricNameFilter) contentVersion() string {
+	d := xxhash.New()
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(f.hashCount))
+	_, _ = d.Write(b)
+	for _, w := range f.bits {
+		binary.LittleEndian.PutUint64(b, w)
+		_, _ = d.Write(b)
+	}
+	return strconv.FormatUint(d.Sum64(), 16)
+}
+
+// WithMetricNameFilter makes the BucketStore build a MetricNameFilter of the metric names of its blocks with the
+// given false positive rate, which is returned by MetricNameFilter. The metric names of each block are read from its
+// index-header when loading it. A rate of 0 disables it. LeaseMetricNameFilter leases the filter for the given duration.
+func WithMetricNameFilter(falsePositiveRate float64, lease time.Duration) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.metricNameFilterFalsePositiveRate = falsePositiveRate
+		s.metricNameFilterLease = lease
+	}
+}
+
+// MetricNameFilter returns the filter of the metric names of the loaded blocks. It returns nil if the filter is not
+// enabled, or until the first sync of blocks completed.
+func (s *BucketStore) MetricNameFilter() *MetricNameFilter {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.metricNameFilter
+}
+
+// LeaseMetricNameFilter returns the filter of the metric names of the loaded blocks to advertise, and for how long
+// clients may skip the store by it. Clients must count the lease from before they requested the filter, as blocks with
+// metric names missing from the filter are only queried once its leases expired. It returns nil if the filter is not
+// enabled, or until the first sync of blocks completed.
+func (s *BucketStore) LeaseMetricNameFilter() (*MetricNameFilter, time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.metricNameFilter == nil || s.metricNameFilterLease <= 0 {
+		return nil, 0
+	}
+	if until := time.Now().Add(s.metricNameFilterLease); until.After(s.metricNameFilterLeasedUntil) {
+		s.metricNameFilterLeasedUntil = until
+	}
+	return s.metricNameFilter, s.metricNameFilterLease
+}
+
+// replaceMetricNameFilter replaces the filter, keeping until when the replaced ones are leased. s.mtx must be held for
+// writing.
+func (s *BucketStore) replaceMetricNameFilter(f *MetricNameFilter) {
+	if s.metricNameFilterLeasedUntil.After(s.replacedMetricNameFilterLeasedUntil) {
+		s.replacedMetricNameFilterLeasedUntil = s.metricNameFilterLeasedUntil
+	}
+	s.metricNameFilterLeasedUntil = time.Time{}
+	s.metricNameFilter = f
+}
+
+// metricNameHashes returns the hashes of the metric names of the block, if the metric name filter is enabled.
+func (s *BucketStore) metricNameHashes(r indexheader.Reader) ([]uint64, error) {
+	if s.metricNameFilterFalsePositiveRate <= 0 {
+		return nil, nil
+	}
+	names, err := r.LabelValues(labels.MetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "get metric names")
+	}
+	hashes := make([]uint64, 0, len(names))
+	for _, n := range names {
+		hashes = append(hashes, metricNameHash(n))
+	}
+	return hashes, nil
+}
+
+// addBlockMetricNames adds the metric names of a block to the filter before the block is queried, so that the filter
+// never misses them. If the block has metric names missing from the filter, it then waits until the leases of the
+// filters advertised before expired, so that clients do not skip the store by them once the block is queried.
+func (s *BucketStore) addBlockMetricNames(ctx context.Context, b *bucketBlock) error {
+	s.mtx.Lock()
+	s.metricNameFilterStale = true
+	f := s.metricNameFilter
+	if f == nil {
+		s.mtx.Unlock()
+		return nil
+	}
+	for _, h := range b.metricNameHashes {
+		if !f.mayContainHash(h) {
+			s.replaceMetricNameFilter(f.withNameHashes(b.metricNameHashes))
+			break
+		}
+	}
+	// Blocks with metric names already added by other blocks wait as well, as those may still wait.
+	wait := time.Until(s.replacedMetricNameFilterLeasedUntil)
+	s.mtx.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	level.Debug(s.logger).Log("msg", "waiting for leases of the metric name filter to expire before querying block", "block", b.meta.ULID, "wait", wait)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// syncMetricNameFilter rebuilds the filter from the metric names of the loaded blocks if they changed since the last
+// build, dropping the ones of removed blocks and sizing it for the number of metric names. s.mtx must be held for
+// writing.
+func (s *BucketStore) syncMetricNameFilter() {
+	if s.metricNameFilterFalsePositiveRate <= 0 || (s.metricNameFilter != nil && !s.metricNameFilterStale) {
+		return
+	}
+	unique := map[uint64]struct{}{}
+	for _, b := range s.blocks {
+		for _, h := range b.metricNameHashes {
+			unique[h] = struct{}{}
+		}
+	}
+	hashes := make([]uint64, 0, len(unique))
+	for h := range unique {
+		hashes = append(hashes, h)
+	}
+	s.replaceMetricNameFilter(NewMetricNameFilter(hashes, s.metricNameFilterFalsePositiveRate))
+	s.metricNameFilterStale = false
+}
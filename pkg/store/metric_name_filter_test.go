@@ -0,0 +1,242 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestMetricNameFilter(t *testing.T) {
+	const n = 10000
+
+	hashes := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		hashes = append(hashes, metricNameHash(fmt.Sprintf("metric_%d", i)))
+	}
+	f := NewMetricNameFilter(hashes, 0.01)
+	for i := 0; i < n; i++ {
+		testutil.Assert(t, f.MayContain(fmt.Sprintf("metric_%d", i)), "false negative for metric_%d", i)
+	}
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.MayContain(fmt.Sprintf("other_%d", i)) {
+			falsePositives++
+		}
+	}
+	testutil.Assert(t, falsePositives < n*2/100, "expected a false positive rate of about 1%%, got %d of %d", falsePositives, n)
+
+	// Filters decoded from their bits behave the same way.
+	decoded, err := MetricNameFilterFromBits(f.Version(), f.HashCount(), f.Bits())
+	testutil.Ok(t, err)
+	testutil.Equals(t, f.Version(), decoded.Version())
+	for i := 0; i < n; i++ {
+		testutil.Equals(t, f.MayContain(fmt.Sprintf("other_%d", i)), decoded.MayContain(fmt.Sprintf("other_%d", i)))
+	}
+	_, err = MetricNameFilterFromBits(f.Version(), 0, f.Bits())
+	testutil.NotOk(t, err)
+	_, err = MetricNameFilterFromBits(f.Version(), f.HashCount(), nil)
+	testutil.NotOk(t, err)
+
+	// The same metric names give the same version.
+	testutil.Equals(t, f.Version(), NewMetricNameFilter(hashes, 0.01).Version())
+
+	// Added metric names are contained by the copy only, in addition to the ones of the original.
+	added := f.withNameHashes([]uint64{metricNameHash("added")})
+	testutil.Assert(t, added.MayContain("added"))
+	testutil.Assert(t, f.Version() != added.Version())
+	for i := 0; i < n; i++ {
+		testutil.Assert(t, added.MayContain(fmt.Sprintf("metric_%d", i)), "false negative for metric_%d", i)
+	}
+
+	ok, name := f.MatchesMetricName([]*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, "a", "b"),
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "metric_1"),
+	})
+	testutil.Assert(t, ok)
+	testutil.Equals(t, "", name)
+}
+
+// uploadMetricNamesBlock uploads a block with a series of each of the given metric names.
+func uploadMetricNamesBlock(t *testing.T, bkt objstore.Bucket, names ...string) ulid.ULID {
+	t.Helper()
+
+	series := make([]labels.Labels, 0, len(names))
+	for _, n := range names {
+		series = append(series, labels.FromStrings(labels.MetricName, n))
+	}
+	dir := t.TempDir()
+	id, err := e2eutil.CreateBlock(context.Background(), dir, series, 10, 0, 1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(context.Background(), log.NewNopLogger(), bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+	return id
+}
+
+func metricNames(prefix string, n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("%s_%d", prefix, i))
+	}
+	return names
+}
+
+func TestBucketStore_MetricNameFilter(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	metaFetcher, err := block.NewMetaFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), filepath.Join(tmpDir, "meta"), nil, nil)
+	testutil.Ok(t, err)
+	s, err := NewBucketStore(
+		objstore.WithNoopInstr(bkt),
+		metaFetcher,
+		filepath.Join(tmpDir, "store"),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		time.Minute,
+		WithFilterConfig(allowAllFilterConf),
+		WithMetricNameFilter(0.01, time.Minute),
+	)
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, s.Close()) })
+
+	// No filter is returned before the first sync, so that stores are not skipped by metric name.
+	testutil.Assert(t, s.MetricNameFilter() == nil)
+
+	assertContains := func(names ...string) {
+		t.Helper()
+		f := s.MetricNameFilter()
+		testutil.Assert(t, f != nil)
+		for _, n := range names {
+			testutil.Assert(t, f.MayContain(n), "false negative for %s", n)
+		}
+	}
+
+	a, b, c := metricNames("a", 200), metricNames("b", 200), metricNames("c", 200)
+	idA := uploadMetricNamesBlock(t, bkt, a...)
+	testutil.Ok(t, s.SyncBlocks(ctx))
+	assertContains(a...)
+	ok, _ := s.MetricNameFilter().MatchesMetricName([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "absent")})
+	testutil.Assert(t, !ok)
+	version := s.MetricNameFilter().Version()
+
+	// Syncs without changed blocks keep the filter.
+	testutil.Ok(t, s.SyncBlocks(ctx))
+	testutil.Equals(t, version, s.MetricNameFilter().Version())
+
+	// Metric names of a new block are added to the filter when the block is added, before the rebuild at the end of the sync.
+	uploadMetricNamesBlock(t, bkt, b...)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	for id, meta := range metas {
+		if id != idA {
+			testutil.Ok(t, s.addBlock(ctx, meta))
+		}
+	}
+	assertContains(append(a, b...)...)
+	testutil.Assert(t, version != s.MetricNameFilter().Version())
+
+	testutil.Ok(t, s.SyncBlocks(ctx))
+	assertContains(append(a, b...)...)
+
+	// Rebuilds after blocks are replaced drop the metric names of removed blocks, but never the ones of loaded blocks.
+	uploadMetricNamesBlock(t, bkt, c...)
+	testutil.Ok(t, block.Delete(ctx, log.NewNopLogger(), bkt, idA))
+	testutil.Ok(t, s.SyncBlocks(ctx))
+	assertContains(append(b, c...)...)
+	falsePositives := 0
+	for _, n := range a {
+		if s.MetricNameFilter().MayContain(n) {
+			falsePositives++
+		}
+	}
+	testutil.Assert(t, falsePositives < len(a)/10, "expected names of the removed block to be dropped, got %d false positives", falsePositives)
+}
+
+func TestBucketStore_LeaseMetricNameFilter(t *testing.T) {
+	const lease = 500 * time.Millisecond
+
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	bkt := objstore.NewInMemBucket()
+
+	metaFetcher, err := block.NewMetaFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), filepath.Join(tmpDir, "meta"), nil, nil)
+	testutil.Ok(t, err)
+	s, err := NewBucketStore(
+		objstore.WithNoopInstr(bkt),
+		metaFetcher,
+		filepath.Join(tmpDir, "store"),
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		20,
+		true,
+		DefaultPostingOffsetInMemorySampling,
+		false,
+		false,
+		time.Minute,
+		WithFilterConfig(allowAllFilterConf),
+		WithMetricNameFilter(0.01, lease),
+	)
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, s.Close()) })
+
+	f, _ := s.LeaseMetricNameFilter()
+	testutil.Assert(t, f == nil)
+
+	uploadMetricNamesBlock(t, bkt, "a")
+	testutil.Ok(t, s.SyncBlocks(ctx))
+	requested := time.Now()
+	f, l := s.LeaseMetricNameFilter()
+	testutil.Assert(t, f != nil)
+	testutil.Equals(t, lease, l)
+
+	idB := uploadMetricNamesBlock(t, bkt, "b")
+	idC := uploadMetricNamesBlock(t, bkt, "a")
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	// A block with metric names missing from the leased filter is only queried once the lease expired. The filter
+	// advertised meanwhile has them already, and its leases do not delay the block further.
+	added := make(chan error)
+	go func() { added <- s.addBlock(ctx, metas[idB]) }()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		if f, _ := s.LeaseMetricNameFilter(); !f.MayContain("b") {
+			return errors.New("metric name b not added yet")
+		}
+		return nil
+	}))
+	s.mtx.RLock()
+	_, ok := s.blocks[idB]
+	s.mtx.RUnlock()
+	testutil.Assert(t, !ok, "block queried before the lease of the filter missing its metric names expired")
+	testutil.Ok(t, <-added)
+	testutil.Assert(t, time.Since(requested) >= lease, "block added before the lease expired")
+
+	// Blocks with metric names the leased filters have are queried right away.
+	start := time.Now()
+	testutil.Ok(t, s.addBlock(ctx, metas[idC]))
+	testutil.Assert(t, time.Since(start) < lease, "block without new metric names waited for the lease")
+}
@@ -0,0 +1,76 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// TimePartition is a store serving the data of a time partition of a bucket, e.g. a bucket store with a time filter.
+type TimePartition struct {
+	// Name identifies the partition in logs and errors.
+	Name  string
+	Store InfoStoreServer
+}
+
+// TimePartitionedStores serves the StoreAPI of multiple time partitions within one process. Requests are proxied to the
+// partitions overlapping with the requested time range and their series are merged, removing duplicated chunks of blocks
+// served by multiple partitions. Info announces the union of the time ranges and label sets of the partitions.
+type TimePartitionedStores struct {
+	*ProxyStore
+}
+
+// NewTimePartitionedStores creates a TimePartitionedStores of the given partitions.
+func NewTimePartitionedStores(logger log.Logger, reg prometheus.Registerer, component component.StoreAPI, partitions []TimePartition) *TimePartitionedStores {
+	clients := make([]Client, 0, len(partitions))
+	for _, p := range partitions {
+		clients = append(clients, &partitionClient{
+			StoreClient: storepb.ServerAsClient(p.Store, 0),
+			name:        fmt.Sprintf("time partition %s", p.Name),
+			store:       p.Store,
+			component:   component,
+		})
+	}
+	return &TimePartitionedStores{
+		ProxyStore: NewProxyStore(logger, reg, func() []Client { return clients }, component, nil, 0),
+	}
+}
+
+// partitionClient is an in-process client of a time partition.
+type partitionClient struct {
+	storepb.StoreClient
+
+	name      string
+	store     InfoStoreServer
+	component component.StoreAPI
+}
+
+func (c *partitionClient) LabelSets() []labels.Labels {
+	return labelpb.ZLabelSetsToPromLabelSets(c.store.LabelSet()...)
+}
+
+func (c *partitionClient) TimeRange() (mint, maxt int64) { return c.store.TimeRange() }
+
+func (c *partitionClient) SupportsWithoutReplicaLabels() bool { return false }
+
+func (c *partitionClient) MetricNameFilter() *MetricNameFilter {
+	if s, ok := c.store.(interface{ MetricNameFilter() *MetricNameFilter }); ok {
+		return s.MetricNameFilter()
+	}
+	return nil
+}
+
+func (c *partitionClient) StoreType() component.StoreAPI { return c.component }
+
+func (c *partitionClient) String() string { return c.name }
+
+func (c *partitionClient) Addr() string { return c.name }
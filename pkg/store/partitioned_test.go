@@ -0,0 +1,193 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestTimePartitionedStores(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var partitions []TimePartition
+	for _, p := range []struct {
+		name    string
+		samples []int64
+	}{
+		{name: "old", samples: []int64{1, 2, 3}},
+		{name: "new", samples: []int64{11, 12, 13}},
+	} {
+		db, err := e2eutil.NewTSDB()
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, db.Close()) }()
+
+		app := db.Appender(context.Background())
+		for _, ts := range p.samples {
+			_, err := app.Append(0, labels.FromStrings("a", "1"), ts, float64(ts))
+			testutil.Ok(t, err)
+		}
+		testutil.Ok(t, app.Commit())
+
+		partitions = append(partitions, TimePartition{
+			Name:  p.name,
+			Store: NewTSDBStore(nil, db, component.Store, labels.FromStrings("region", "eu-west")),
+		})
+	}
+
+	stores := NewTimePartitionedStores(nil, nil, component.Store, partitions)
+
+	mint, maxt := stores.TimeRange()
+	testutil.Equals(t, int64(1), mint)
+	testutil.Equals(t, int64(math.MaxInt64), maxt)
+	testutil.Equals(t, []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "region", Value: "eu-west"}}}}, stores.LabelSet())
+
+	for _, tc := range []struct {
+		title          string
+		mint, maxt     int64
+		expectedSeries []rawSeries
+	}{
+		{
+			title: "all partitions",
+			mint:  0,
+			maxt:  20,
+			expectedSeries: []rawSeries{
+				{
+					lset:   labels.FromStrings("a", "1", "region", "eu-west"),
+					chunks: [][]sample{{{1, 1}, {2, 2}, {3, 3}}, {{11, 11}, {12, 12}, {13, 13}}},
+				},
+			},
+		},
+		{
+			title: "single partition",
+			mint:  10,
+			maxt:  20,
+			expectedSeries: []rawSeries{
+				{
+					lset:   labels.FromStrings("a", "1", "region", "eu-west"),
+					chunks: [][]sample{{{11, 11}, {12, 12}, {13, 13}}},
+				},
+			},
+		},
+		{
+			title:          "no partition",
+			mint:           5,
+			maxt:           9,
+			expectedSeries: []rawSeries{},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			srv := newStoreSeriesServer(ctx)
+			testutil.Ok(t, stores.Series(&storepb.SeriesRequest{
+				MinTime:  tc.mint,
+				MaxTime:  tc.maxt,
+				Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+			}, srv))
+			seriesEquals(t, tc.expectedSeries, srv.SeriesSet)
+		})
+	}
+}
+
+func TestTimePartitionedStores_ColdTierRelocation(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	dir := t.TempDir()
+	bkt, coldBkt := objstore.WithNoopInstr(objstore.NewInMemBucket()), objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	id, err := e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 100, 0, 1000, labels.FromStrings("ext", "1"), 0, metadata.NoneFunc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+
+	var coldStore *BucketStore
+	newStore := func(bkt objstore.InstrumentedBucket, tier string) *BucketStore {
+		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Hour, 20)
+		filters := []block.MetadataFilter{block.NewTierMetaFilter(tier), ignoreDeletionMarkFilter}
+		if tier == "" {
+			filters = append(filters, block.NewRelocatedMetaFilter(ignoreDeletionMarkFilter.DeletionMarkBlocks, func(id ulid.ULID) bool {
+				return coldStore.HasBlock(id)
+			}))
+		}
+		metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, filepath.Join(dir, "meta", tier), nil, filters)
+		testutil.Ok(t, err)
+		s, err := NewBucketStore(
+			bkt,
+			metaFetcher,
+			filepath.Join(dir, "store", tier),
+			NewChunksLimiterFactory(0),
+			NewSeriesLimiterFactory(0),
+			NewGapBasedPartitioner(PartitionerMaxGapSize),
+			20,
+			true,
+			DefaultPostingOffsetInMemorySampling,
+			false,
+			false,
+			time.Minute,
+			WithFilterConfig(allowAllFilterConf),
+		)
+		testutil.Ok(t, err)
+		t.Cleanup(func() { testutil.Ok(t, s.Close()) })
+		return s
+	}
+	hotStore := newStore(bkt, "")
+	coldStore = newStore(coldBkt, metadata.ColdTier)
+	stores := NewTimePartitionedStores(nil, nil, component.Store, []TimePartition{{Name: "hot", Store: hotStore}, {Name: "cold", Store: coldStore}})
+
+	query := func() []storepb.Series {
+		srv := newStoreSeriesServer(ctx)
+		testutil.Ok(t, stores.Series(&storepb.SeriesRequest{
+			MinTime:  0,
+			MaxTime:  1000,
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+		}, srv))
+		return srv.SeriesSet
+	}
+
+	testutil.Ok(t, hotStore.SyncBlocks(ctx))
+	testutil.Ok(t, coldStore.SyncBlocks(ctx))
+	expected := query()
+	testutil.Equals(t, 1, len(expected))
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 20, bkt, "", nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Ok(t, compact.RelocateToColdTier(ctx, logger, bkt, coldBkt, metas, nil, time.Hour, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})))
+
+	// Until the cold partition loaded the relocated block, the hot partition keeps serving it.
+	testutil.Ok(t, hotStore.SyncBlocks(ctx))
+	testutil.Assert(t, hotStore.HasBlock(id), "relocated block dropped before its copy is served")
+	testutil.Equals(t, expected, query())
+
+	// Both partitions serve the block until the next sync of the hot partition.
+	testutil.Ok(t, coldStore.SyncBlocks(ctx))
+	testutil.Assert(t, coldStore.HasBlock(id), "relocated block not served by the cold partition")
+	testutil.Equals(t, expected, query())
+
+	testutil.Ok(t, hotStore.SyncBlocks(ctx))
+	testutil.Assert(t, !hotStore.HasBlock(id), "relocated block still served by the hot partition")
+	testutil.Equals(t, expected, query())
+}
@@ -142,6 +142,9 @@ func (p *PrometheusStore) putBuffer(b *[]byte) {
 
 // Series returns all series for a requested time range and label matcher.
 func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_SeriesServer) error {
+	if p.emptyTimeRange() {
+		return nil
+	}
 	extLset := p.externalLabelsFn()
 
 	match, matchers, err := matchesExternalLabels(r.Matchers, extLset)
@@ -551,9 +554,14 @@ func matchesExternalLabels(ms []storepb.LabelMatcher, externalLabels labels.Labe
 	if err != nil {
 		return false, nil, err
 	}
+	match, matchers := promMatchersMatchExternalLabels(tms, externalLabels)
+	return match, matchers, nil
+}
 
+// promMatchersMatchExternalLabels is like matchesExternalLabels, but for already converted matchers.
+func promMatchersMatchExternalLabels(tms []*labels.Matcher, externalLabels labels.Labels) (bool, []*labels.Matcher) {
 	if len(externalLabels) == 0 {
-		return true, tms, nil
+		return true, tms
 	}
 
 	var newMatchers []*labels.Matcher
@@ -570,10 +578,10 @@ func matchesExternalLabels(ms []storepb.LabelMatcher, externalLabels labels.Labe
 		if !tm.Matches(extValue) {
 			// External label does not match. This should not happen - it should be filtered out on query node,
 			// but let's do that anyway here.
-			return false, nil, nil
+			return false, nil
 		}
 	}
-	return true, newMatchers, nil
+	return true, newMatchers
 }
 
 // encodeChunk translates the sample pairs into a chunk.
@@ -593,6 +601,9 @@ func (p *PrometheusStore) encodeChunk(ss []prompb.Sample) (storepb.Chunk_Encodin
 
 // LabelNames returns all known label names of series that match the given matchers.
 func (p *PrometheusStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	if p.emptyTimeRange() {
+		return &storepb.LabelNamesResponse{Names: nil}, nil
+	}
 	extLset := p.externalLabelsFn()
 
 	match, matchers, err := matchesExternalLabels(r.Matchers, extLset)
@@ -644,14 +655,12 @@ func (p *PrometheusStore) LabelValues(ctx context.Context, r *storepb.LabelValue
 	if r.Label == "" {
 		return nil, status.Error(codes.InvalidArgument, "label name parameter cannot be empty")
 	}
+	if p.emptyTimeRange() {
+		return &storepb.LabelValuesResponse{Values: nil}, nil
+	}
 
 	extLset := p.externalLabelsFn()
 
-	// First check for matching external label which has priority.
-	if l := extLset.Get(r.Label); l != "" {
-		return &storepb.LabelValuesResponse{Values: []string{l}}, nil
-	}
-
 	match, matchers, err := matchesExternalLabels(r.Matchers, extLset)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -660,6 +669,20 @@ func (p *PrometheusStore) LabelValues(ctx context.Context, r *storepb.LabelValue
 		return &storepb.LabelValuesResponse{Values: nil}, nil
 	}
 
+	// External labels have priority, their value is returned if some series match the other matchers.
+	if l := extLset.Get(r.Label); l != "" {
+		if len(matchers) > 0 {
+			resp, err := p.LabelNames(ctx, &storepb.LabelNamesRequest{Start: r.Start, End: r.End, Matchers: r.Matchers})
+			if err != nil {
+				return nil, err
+			}
+			if len(resp.Names) == 0 {
+				return &storepb.LabelValuesResponse{Values: nil}, nil
+			}
+		}
+		return &storepb.LabelValuesResponse{Values: []string{l}}, nil
+	}
+
 	var (
 		sers []map[string]string
 		vals []string
@@ -712,3 +735,10 @@ func (p *PrometheusStore) LabelSet() []labelpb.ZLabelSet {
 func (p *PrometheusStore) Timestamps() (mint int64, maxt int64) {
 	return p.timestamps()
 }
+
+// emptyTimeRange returns true if the announced time range is empty, e.g. because Prometheus runs in agent mode and
+// has no local storage to query.
+func (p *PrometheusStore) emptyTimeRange() bool {
+	mint, maxt := p.timestamps()
+	return mint > maxt
+}
@@ -345,7 +345,7 @@ func TestPrometheusStore_SeriesLabels_e2e(t *testing.T) {
 
 func TestPrometheusStore_LabelAPIs(t *testing.T) {
 	t.Cleanup(func() { testutil.TolerantVerifyLeak(t) })
-	testLabelAPIs(t, func(extLset labels.Labels, appendFn func(app storage.Appender)) storepb.StoreServer {
+	testLabelAPIs(t, func(t *testing.T, extLset labels.Labels, appendFn func(app storage.Appender)) storepb.StoreServer {
 		p, err := e2eutil.NewPrometheus()
 		testutil.Ok(t, err)
 		t.Cleanup(func() { testutil.Ok(t, p.Stop()) })
@@ -450,6 +450,35 @@ func TestPrometheusStore_Info(t *testing.T) {
 	testutil.Equals(t, int64(456), resp.MaxTime)
 }
 
+func TestPrometheusStore_EmptyTimeRange(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Without a base URL, any request to Prometheus fails.
+	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), nil, component.Sidecar,
+		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
+		func() (int64, int64) { return math.MaxInt64, math.MinInt64 }, nil)
+	testutil.Ok(t, err)
+
+	srv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, proxy.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "b"}},
+	}, srv))
+	testutil.Equals(t, 0, len(srv.SeriesSet))
+
+	names, err := proxy.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 0, End: math.MaxInt64})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(names.Names))
+
+	values, err := proxy.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "region", Start: 0, End: math.MaxInt64})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(values.Values))
+}
+
 func testSeries_SplitSamplesIntoChunksWithMaxSizeOf120(t *testing.T, appender storage.Appender, newStore func() storepb.StoreServer) {
 	baseT := timestamp.FromTime(time.Now().AddDate(0, 0, -2)) / 1000 * 1000
 
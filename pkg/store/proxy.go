@@ -14,6 +14,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/types"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tracing"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -26,6 +27,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/strutil"
@@ -48,6 +50,15 @@ type Client interface {
 	// TimeRange returns minimum and maximum time range of data in the store.
 	TimeRange() (mint int64, maxt int64)
 
+	// SupportsWithoutReplicaLabels returns true if the store removes without_replica_labels from series itself.
+	SupportsWithoutReplicaLabels() bool
+
+	// MetricNameFilter returns the filter of the metric names of the store, nil if it does not have one.
+	MetricNameFilter() *MetricNameFilter
+
+	// StoreType returns the type of the store, e.g. sidecar.
+	StoreType() component.StoreAPI
+
 	String() string
 	// Addr returns address of a Client.
 	Addr() string
@@ -62,6 +73,17 @@ type ProxyStore struct {
 
 	responseTimeout time.Duration
 	metrics         *proxyStoreMetrics
+	matcherCache    *MatcherCache
+}
+
+// ProxyStoreOption configures optional behaviour of the ProxyStore.
+type ProxyStoreOption func(*ProxyStore)
+
+// WithMatcherCache makes the ProxyStore reuse compiled regex matchers and their results against store label sets.
+func WithMatcherCache(c *MatcherCache) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.matcherCache = c
+	}
 }
 
 type proxyStoreMetrics struct {
@@ -94,6 +116,7 @@ func NewProxyStore(
 	component component.StoreAPI,
 	selectorLabels labels.Labels,
 	responseTimeout time.Duration,
+	opts ...ProxyStoreOption,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -108,6 +131,9 @@ func NewProxyStore(
 		responseTimeout: responseTimeout,
 		metrics:         metrics,
 	}
+	for _, o := range opts {
+		o(s)
+	}
 	return s
 }
 
@@ -243,10 +269,11 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	// tiggered by tracing span to reduce cognitive load.
 	reqLogger := log.With(s.logger, "component", "proxy", "request", r.String())
 
-	match, matchers, err := matchesExternalLabels(r.Matchers, s.selectorLabels)
+	promMatchers, err := s.matcherCache.MatchersToPromMatchers(r.Matchers...)
 	if err != nil {
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
+	match, matchers := promMatchersMatchExternalLabels(promMatchers, s.selectorLabels)
 	if !match {
 		return nil
 	}
@@ -255,6 +282,9 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	}
 	storeMatchers, _ := storepb.PromMatchersToMatchers(matchers...) // Error would be returned by matchesExternalLabels, so skip check.
 
+	withoutReplicaLabels := r.WithoutReplicaLabels
+	failures := StoreFailuresFromContext(srv.Context())
+
 	g, gctx := errgroup.WithContext(srv.Context())
 
 	// Allow to buffer max 10 series response.
@@ -277,8 +307,12 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				SkipChunks:              r.SkipChunks,
 				QueryHints:              r.QueryHints,
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				Hints:                   r.Hints,
 			}
 			wg = &sync.WaitGroup{}
+			// Hints of the store responses are only passed on to clients requesting query stats, which are
+			// the ones aggregating them.
+			forwardHints = queryStatsEnabled(r.Hints)
 		)
 
 		defer func() {
@@ -288,7 +322,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 
 		for _, st := range s.stores() {
 			// We might be able to skip the store if its meta information indicates it cannot have series matching our query.
-			if ok, reason := storeMatches(gctx, st, r.MinTime, r.MaxTime, matchers...); !ok {
+			if ok, reason := storeMatches(gctx, s.matcherCache, st, r.MinTime, r.MaxTime, matchers...); !ok {
 				storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("store %s filtered out: %v", st, reason))
 				continue
 			}
@@ -311,8 +345,18 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				"store.addr": st.Addr(),
 			})
 
-			sc, err := st.Series(seriesCtx, r)
+			storeReq := r
+			// Only stores announcing support get replica labels to remove, as they are removed after merging anyway.
+			if len(withoutReplicaLabels) > 0 && st.SupportsWithoutReplicaLabels() {
+				rr := *r
+				rr.WithoutReplicaLabels = withoutReplicaLabels
+				storeReq = &rr
+			}
+			sc, err := st.Series(seriesCtx, storeReq)
 			if err != nil {
+				if !r.PartialResponseDisabled {
+					failures.add(st, r.MinTime, r.MaxTime, err)
+				}
 				err = errors.Wrapf(err, "fetch series for %s %s", storeID, st)
 				span.SetTag("err", err.Error())
 				span.Finish()
@@ -324,10 +368,13 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				continue
 			}
 
+			st := st
+			failed := func(err error) { failures.add(st, r.MinTime, r.MaxTime, err) }
+
 			// Schedule streamSeriesSet that translates gRPC streamed response
 			// into seriesSet (if series) or respCh if warnings.
 			seriesSet = append(seriesSet, startStreamSeriesSet(seriesCtx, reqLogger, span, closeSeries,
-				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses))
+				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, failed, forwardHints, s.responseTimeout, s.metrics.emptyStreamResponses))
 		}
 
 		level.Debug(reqLogger).Log("msg", "Series: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
@@ -344,7 +391,8 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		// This however does not matter much when used with QueryAPI. Matters for federated Queries a lot.
 		// https://github.com/thanos-io/thanos/issues/2332
 		// Series are not necessarily merged across themselves.
-		mergedSet := storepb.MergeSeriesSets(seriesSet...)
+		// Replica labels are removed after merging, as underlying stores are not required to support it.
+		mergedSet := storepb.NewWithoutReplicaLabelsSeriesSet(storepb.MergeSeriesSets(seriesSet...), withoutReplicaLabels)
 		for mergedSet.Next() {
 			lset, chk := mergedSet.At()
 			respSender.send(storepb.NewSeriesResponse(&storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chk}))
@@ -369,12 +417,24 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	return nil
 }
 
+// queryStatsEnabled returns true if the given Series request hints request query stats.
+func queryStatsEnabled(hints *types.Any) bool {
+	if hints == nil {
+		return false
+	}
+	reqHints := &hintspb.SeriesRequestHints{}
+	if err := types.UnmarshalAny(hints, reqHints); err != nil {
+		return false
+	}
+	return reqHints.EnableQueryStats
+}
+
 type directSender interface {
 	send(*storepb.SeriesResponse)
 }
 
 // streamSeriesSet iterates over incoming stream of series.
-// All errors are sent out of band via warning channel.
+// All errors, and hints if forwarded, are sent out of band via warning channel.
 type streamSeriesSet struct {
 	ctx    context.Context
 	logger log.Logger
@@ -390,6 +450,8 @@ type streamSeriesSet struct {
 
 	name            string
 	partialResponse bool
+	// failed is called with the error of the stream if a partial response is returned.
+	failed func(error)
 
 	responseTimeout time.Duration
 	closeSeries     context.CancelFunc
@@ -420,6 +482,8 @@ func startStreamSeriesSet(
 	warnCh directSender,
 	name string,
 	partialResponse bool,
+	failed func(error),
+	forwardHints bool,
 	responseTimeout time.Duration,
 	emptyStreamResponses prometheus.Counter,
 ) *streamSeriesSet {
@@ -432,6 +496,7 @@ func startStreamSeriesSet(
 		recvCh:          make(chan *storepb.Series, 10),
 		name:            name,
 		partialResponse: partialResponse,
+		failed:          failed,
 		responseTimeout: responseTimeout,
 	}
 
@@ -502,6 +567,10 @@ func startStreamSeriesSet(
 				s.warnCh.send(storepb.NewWarnSeriesResponse(errors.New(w)))
 			}
 
+			if h := rr.r.GetHints(); h != nil && forwardHints {
+				s.warnCh.send(storepb.NewHintsSeriesResponse(h))
+			}
+
 			if series := rr.r.GetSeries(); series != nil {
 				seriesStats.Count(series)
 
@@ -529,6 +598,7 @@ func (s *streamSeriesSet) handleErr(err error, done chan struct{}) {
 
 	if s.partialResponse {
 		level.Warn(s.logger).Log("err", err, "msg", "returning partial response")
+		s.failed(err)
 		s.warnCh.send(storepb.NewWarnSeriesResponse(err))
 		return
 	}
@@ -556,9 +626,40 @@ func (s *streamSeriesSet) Err() error {
 	return errors.Wrap(s.err, s.name)
 }
 
+// StoreMatch tells whether a store would be queried for a Series request.
+type StoreMatch struct {
+	Store Client
+	// Matches is true if the request would be sent to the store.
+	Matches bool
+	// Reason tells why the store would be filtered out, if it does not match.
+	Reason string
+}
+
+// MatchStores returns for all stores whether a Series request with the given label matchers and time range would be
+// sent to them, and if not, why. It takes the same decisions as Series, so it explains which stores a query ends up
+// with. Debug store matchers are taken from the context as well.
+func (s *ProxyStore) MatchStores(ctx context.Context, mint, maxt int64, matchers ...*labels.Matcher) ([]StoreMatch, error) {
+	match, matchers := promMatchersMatchExternalLabels(matchers, s.selectorLabels)
+	if match && len(matchers) == 0 {
+		return nil, errors.New("no matchers specified (excluding selector labels)")
+	}
+
+	stores := s.stores()
+	res := make([]StoreMatch, 0, len(stores))
+	for _, st := range stores {
+		if !match {
+			res = append(res, StoreMatch{Store: st, Reason: fmt.Sprintf("request label matchers do not match selector labels %v", s.selectorLabels)})
+			continue
+		}
+		ok, reason := storeMatches(ctx, s.matcherCache, st, mint, maxt, matchers...)
+		res = append(res, StoreMatch{Store: st, Matches: ok, Reason: reason})
+	}
+	return res, nil
+}
+
 // storeMatches returns boolean if the given store may hold data for the given label matchers, time ranges and debug store matches gathered from context.
 // It also produces tracing span.
-func storeMatches(ctx context.Context, s Client, mint, maxt int64, matchers ...*labels.Matcher) (ok bool, reason string) {
+func storeMatches(ctx context.Context, c *MatcherCache, s Client, mint, maxt int64, matchers ...*labels.Matcher) (ok bool, reason string) {
 	span, ctx := tracing.StartSpan(ctx, "store_matches")
 	defer span.Finish()
 
@@ -578,10 +679,20 @@ func storeMatches(ctx context.Context, s Client, mint, maxt int64, matchers ...*
 		return false, reason
 	}
 
+	if ok, reason := storeMatchTypes(s, StoreTypesFromContext(ctx)); !ok {
+		return false, reason
+	}
+
 	extLset := s.LabelSets()
-	if !labelSetsMatch(matchers, extLset...) {
+	if !labelSetsMatch(c, matchers, extLset...) {
 		return false, fmt.Sprintf("external labels %v does not match request label matchers: %v", extLset, matchers)
 	}
+
+	if f := s.MetricNameFilter(); f != nil {
+		if ok, name := f.MatchesMetricName(matchers); !ok {
+			return false, fmt.Sprintf("does not have series of metric name %s according to its metric name filter", name)
+		}
+	}
 	return true, ""
 }
 
@@ -593,7 +704,7 @@ func storeMatchDebugMetadata(s Client, storeDebugMatchers [][]*labels.Matcher) (
 
 	match := false
 	for _, sm := range storeDebugMatchers {
-		match = match || labelSetsMatch(sm, labels.FromStrings("__address__", s.Addr()))
+		match = match || labelSetsMatch(nil, sm, labels.FromStrings("__address__", s.Addr()))
 	}
 	if !match {
 		return false, fmt.Sprintf("__address__ %v does not match debug store metadata matchers: %v", s.Addr(), storeDebugMatchers)
@@ -602,7 +713,8 @@ func storeMatchDebugMetadata(s Client, storeDebugMatchers [][]*labels.Matcher) (
 }
 
 // labelSetsMatch returns false if all label-set do not match the matchers (aka: OR is between all label-sets).
-func labelSetsMatch(matchers []*labels.Matcher, lset ...labels.Labels) bool {
+// The matcher cache might be nil.
+func labelSetsMatch(c *MatcherCache, matchers []*labels.Matcher, lset ...labels.Labels) bool {
 	if len(lset) == 0 {
 		return true
 	}
@@ -610,7 +722,7 @@ func labelSetsMatch(matchers []*labels.Matcher, lset ...labels.Labels) bool {
 	for _, ls := range lset {
 		notMatched := false
 		for _, m := range matchers {
-			if lv := ls.Get(m.Name); lv != "" && !m.Matches(lv) {
+			if lv := ls.Get(m.Name); lv != "" && !c.Matches(m, lv) {
 				notMatched = true
 				break
 			}
@@ -622,6 +734,37 @@ func labelSetsMatch(matchers []*labels.Matcher, lset ...labels.Labels) bool {
 	return false
 }
 
+// labelsRequestMatchers returns the matchers of a label names or values request without the ones of the selector
+// labels, both converted and as sent to the stores, or false if the request cannot match the selector labels.
+func (s *ProxyStore) labelsRequestMatchers(ms []storepb.LabelMatcher) (bool, []*labels.Matcher, []storepb.LabelMatcher, error) {
+	if len(ms) == 0 {
+		return true, nil, nil, nil
+	}
+	promMatchers, err := s.matcherCache.MatchersToPromMatchers(ms...)
+	if err != nil {
+		return false, nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	match, matchers := promMatchersMatchExternalLabels(promMatchers, s.selectorLabels)
+	if !match {
+		return false, nil, nil, nil
+	}
+	storeMatchers, _ := storepb.PromMatchersToMatchers(matchers...) // Error would be returned by MatchersToPromMatchers, so skip check.
+	return true, matchers, storeMatchers, nil
+}
+
+// clampTimeRange returns the intersection of the time range with the one of the store, so that all stores get
+// requests within the time range they announce.
+func clampTimeRange(st Client, mint, maxt int64) (int64, int64) {
+	storeMinTime, storeMaxTime := st.TimeRange()
+	if mint < storeMinTime {
+		mint = storeMinTime
+	}
+	if maxt > storeMaxTime {
+		maxt = storeMaxTime
+	}
+	return mint, maxt
+}
+
 // LabelNames returns all known label names.
 func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
@@ -634,24 +777,37 @@ func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesReques
 		storeDebugMsgs []string
 	)
 
+	match, matchers, storeMatchers, err := s.labelsRequestMatchers(r.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return &storepb.LabelNamesResponse{}, nil
+	}
+	failures := StoreFailuresFromContext(ctx)
+
 	for _, st := range s.stores() {
 		st := st
 
 		// We might be able to skip the store if its meta information indicates it cannot have series matching our query.
-		if ok, reason := storeMatches(gctx, st, r.Start, r.End); !ok {
+		if ok, reason := storeMatches(gctx, s.matcherCache, st, r.Start, r.End, matchers...); !ok {
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s filtered out due to %v", st, reason))
 			continue
 		}
 		storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
+		start, end := clampTimeRange(st, r.Start, r.End)
 
 		g.Go(func() error {
 			resp, err := st.LabelNames(gctx, &storepb.LabelNamesRequest{
 				PartialResponseDisabled: r.PartialResponseDisabled,
-				Start:                   r.Start,
-				End:                     r.End,
-				Matchers:                r.Matchers,
+				Start:                   start,
+				End:                     end,
+				Matchers:                storeMatchers,
 			})
 			if err != nil {
+				if !r.PartialResponseDisabled {
+					failures.add(st, r.Start, r.End, err)
+				}
 				err = errors.Wrapf(err, "fetch label names from store %s", st)
 				if r.PartialResponseDisabled {
 					return err
@@ -695,25 +851,38 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		storeDebugMsgs []string
 	)
 
+	match, matchers, storeMatchers, err := s.labelsRequestMatchers(r.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return &storepb.LabelValuesResponse{}, nil
+	}
+	failures := StoreFailuresFromContext(ctx)
+
 	for _, st := range s.stores() {
 		st := st
 
 		// We might be able to skip the store if its meta information indicates it cannot have series matching our query.
-		if ok, reason := storeMatches(gctx, st, r.Start, r.End); !ok {
+		if ok, reason := storeMatches(gctx, s.matcherCache, st, r.Start, r.End, matchers...); !ok {
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s filtered out due to %v", st, reason))
 			continue
 		}
 		storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
+		start, end := clampTimeRange(st, r.Start, r.End)
 
 		g.Go(func() error {
 			resp, err := st.LabelValues(gctx, &storepb.LabelValuesRequest{
 				Label:                   r.Label,
 				PartialResponseDisabled: r.PartialResponseDisabled,
-				Start:                   r.Start,
-				End:                     r.End,
-				Matchers:                r.Matchers,
+				Start:                   start,
+				End:                     end,
+				Matchers:                storeMatchers,
 			})
 			if err != nil {
+				if !r.PartialResponseDisabled {
+					failures.add(st, r.Start, r.End, err)
+				}
 				err = errors.Wrapf(err, "fetch label values from store %s", st)
 				if r.PartialResponseDisabled {
 					return err
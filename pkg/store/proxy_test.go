@@ -27,6 +27,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
@@ -40,6 +41,10 @@ type testClient struct {
 	labelSets []labels.Labels
 	minTime   int64
 	maxTime   int64
+
+	supportsWithoutReplicaLabels bool
+	metricNameFilter             *MetricNameFilter
+	storeType                    component.StoreAPI
 }
 
 func (c testClient) LabelSets() []labels.Labels {
@@ -50,6 +55,18 @@ func (c testClient) TimeRange() (int64, int64) {
 	return c.minTime, c.maxTime
 }
 
+func (c testClient) SupportsWithoutReplicaLabels() bool {
+	return c.supportsWithoutReplicaLabels
+}
+
+func (c testClient) MetricNameFilter() *MetricNameFilter {
+	return c.metricNameFilter
+}
+
+func (c testClient) StoreType() component.StoreAPI {
+	return c.storeType
+}
+
 func (c testClient) String() string {
 	return "test"
 }
@@ -468,6 +485,80 @@ func TestProxyStore_Series(t *testing.T) {
 			storeDebugMatchers:  [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "__address__", "foo")}},
 			expectedWarningsLen: 1, // No stores match.
 		},
+		{
+			title: "replica labels removed; series from different replicas deduplicated",
+			storeAPIs: []Client{
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespSeries: []*storepb.SeriesResponse{
+							storeSeriesResponse(t, labels.FromStrings("a", "a", "replica", "1"), []sample{{0, 0}, {2, 1}, {3, 2}}),
+							storeSeriesResponse(t, labels.FromStrings("a", "b", "replica", "1"), []sample{{1, 1}}),
+						},
+					},
+					minTime:   1,
+					maxTime:   300,
+					labelSets: []labels.Labels{labels.FromStrings("ext", "1")},
+				},
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespSeries: []*storepb.SeriesResponse{
+							storeSeriesResponse(t, labels.FromStrings("a", "a", "replica", "2"), []sample{{0, 0}, {2, 1}, {3, 2}}),
+							storeSeriesResponse(t, labels.FromStrings("a", "a", "replica", "2"), []sample{{4, 3}}),
+						},
+					},
+					minTime:   1,
+					maxTime:   300,
+					labelSets: []labels.Labels{labels.FromStrings("ext", "1")},
+				},
+			},
+			req: &storepb.SeriesRequest{
+				MinTime:              1,
+				MaxTime:              300,
+				Matchers:             []storepb.LabelMatcher{{Name: "ext", Value: "1", Type: storepb.LabelMatcher_EQ}},
+				WithoutReplicaLabels: []string{"replica"},
+			},
+			expectedSeries: []rawSeries{
+				{
+					lset:   labels.FromStrings("a", "a"),
+					chunks: [][]sample{{{0, 0}, {2, 1}, {3, 2}}, {{4, 3}}}, // Exact duplicated chunk removed.
+				},
+				{
+					lset:   labels.FromStrings("a", "b"),
+					chunks: [][]sample{{{1, 1}}},
+				},
+			},
+		},
+		{
+			title: "replica labels removed; series re-sorted",
+			storeAPIs: []Client{
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespSeries: []*storepb.SeriesResponse{
+							storeSeriesResponse(t, labels.FromStrings("a", "a", "b", "1", "c", "2"), []sample{{1, 1}}),
+							storeSeriesResponse(t, labels.FromStrings("a", "a", "b", "2", "c", "1"), []sample{{2, 2}}),
+						},
+					},
+					minTime: 1,
+					maxTime: 300,
+				},
+			},
+			req: &storepb.SeriesRequest{
+				MinTime:              1,
+				MaxTime:              300,
+				Matchers:             []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+				WithoutReplicaLabels: []string{"b"},
+			},
+			expectedSeries: []rawSeries{
+				{
+					lset:   labels.FromStrings("a", "a", "c", "1"),
+					chunks: [][]sample{{{2, 2}}},
+				},
+				{
+					lset:   labels.FromStrings("a", "a", "c", "2"),
+					chunks: [][]sample{{{1, 1}}},
+				},
+			},
+		},
 	} {
 
 		if ok := t.Run(tc.title, func(t *testing.T) {
@@ -1070,6 +1161,169 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 	testutil.Assert(t, proto.Equal(req, m.LastSeriesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", req, m.LastSeriesReq)
 }
 
+func TestProxyStore_Series_WithoutReplicaLabelsProxiedIfSupported(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	supporting := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{1, 1}}),
+		},
+	}
+	old := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a", "replica", "2"), []sample{{1, 1}}),
+		},
+	}
+	cls := []Client{
+		&testClient{StoreClient: supporting, minTime: 1, maxTime: 300, supportsWithoutReplicaLabels: true},
+		&testClient{StoreClient: old, minTime: 1, maxTime: 300},
+	}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+	)
+
+	s := newStoreSeriesServer(context.Background())
+	req := &storepb.SeriesRequest{
+		MinTime:              1,
+		MaxTime:              300,
+		Matchers:             []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+		WithoutReplicaLabels: []string{"replica"},
+	}
+	testutil.Ok(t, q.Series(req, s))
+
+	testutil.Equals(t, []string{"replica"}, supporting.LastSeriesReq.WithoutReplicaLabels)
+	testutil.Equals(t, 0, len(old.LastSeriesReq.WithoutReplicaLabels))
+	// Replica labels of stores without support are still removed by the proxy.
+	seriesEquals(t, []rawSeries{{lset: labels.FromStrings("a", "a"), chunks: [][]sample{{{1, 1}}}}}, s.SeriesSet)
+}
+
+func TestProxyStore_Series_HintsForwardedWithQueryStats(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	resHints := mustMarshalAny(&hintspb.SeriesResponseHints{
+		BlockStats: []hintspb.BlockQueryStats{{BlockId: "block", ChunksFetched: 1}},
+	})
+	m := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{1, 1}}),
+			storepb.NewHintsSeriesResponse(resHints),
+		},
+	}
+	cls := []Client{&testClient{StoreClient: m, minTime: 1, maxTime: 300}}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+	)
+
+	for _, tcase := range []struct {
+		name          string
+		reqHints      *types.Any
+		expectedHints []*types.Any
+	}{
+		{name: "without hints"},
+		{name: "without query stats", reqHints: mustMarshalAny(&hintspb.SeriesRequestHints{})},
+		{
+			name:          "with query stats",
+			reqHints:      mustMarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: true}),
+			expectedHints: []*types.Any{resHints},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			s := newStoreSeriesServer(context.Background())
+			req := &storepb.SeriesRequest{
+				MinTime:  1,
+				MaxTime:  300,
+				Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+				Hints:    tcase.reqHints,
+			}
+			testutil.Ok(t, q.Series(req, s))
+
+			testutil.Equals(t, tcase.reqHints, m.LastSeriesReq.Hints)
+			testutil.Equals(t, 1, len(s.SeriesSet))
+			testutil.Equals(t, tcase.expectedHints, s.HintsSet)
+		})
+	}
+}
+
+func TestProxyStore_StoreFailures(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{1, 1}}),
+				},
+				RespLabelNames: &storepb.LabelNamesResponse{Names: []string{"a"}},
+			},
+			labelSets: []labels.Labels{labels.FromStrings("ext", "1")},
+			minTime:   1,
+			maxTime:   300,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{RespError: errors.New("error!")},
+			labelSets:   []labels.Labels{labels.FromStrings("ext", "2")},
+			minTime:     100,
+			maxTime:     200,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{1, 1}}),
+				},
+				RespLabelNames:     &storepb.LabelNamesResponse{Names: []string{"a"}},
+				injectedError:      errors.New("test"),
+				injectedErrorIndex: 0,
+			},
+			labelSets: []labels.Labels{labels.FromStrings("ext", "3")},
+			minTime:   250,
+			maxTime:   500,
+		},
+	}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+	)
+
+	ctx, failures := NewContextWithStoreFailures(context.Background())
+	s := newStoreSeriesServer(ctx)
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a|b", Type: storepb.LabelMatcher_RE}},
+	}, s))
+	testutil.Equals(t, 1, len(s.SeriesSet))
+	testutil.Equals(t, 2, len(s.Warnings))
+	// The time ranges of the failures are limited to the ones of the failed stores.
+	testutil.Equals(t, []StoreFailure{
+		{Endpoint: "testaddr", LabelSets: []labels.Labels{labels.FromStrings("ext", "2")}, MinTime: 100, MaxTime: 200, Error: "error!"},
+		{Endpoint: "testaddr", LabelSets: []labels.Labels{labels.FromStrings("ext", "3")}, MinTime: 250, MaxTime: 300, Error: "receive series from test: test"},
+	}, failures.Failures())
+
+	ctx, failures = NewContextWithStoreFailures(context.Background())
+	_, err := q.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 150, End: 500})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []StoreFailure{
+		{Endpoint: "testaddr", LabelSets: []labels.Labels{labels.FromStrings("ext", "2")}, MinTime: 150, MaxTime: 200, Error: "error!"},
+	}, failures.Failures())
+
+	// Failures are not collected if a partial response is disabled.
+	ctx, failures = NewContextWithStoreFailures(context.Background())
+	_, err = q.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 150, End: 500, PartialResponseDisabled: true})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 0, len(failures.Failures()))
+}
+
 func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1134,19 +1388,22 @@ func TestProxyStore_LabelValues(t *testing.T) {
 			Warnings: []string{"warning"},
 		},
 	}
+	m3 := &mockedStoreAPI{
+		RespLabelValues: &storepb.LabelValuesResponse{
+			Values: []string{"5", "6"},
+		},
+	}
 	cls := []Client{
-		&testClient{StoreClient: m1},
+		&testClient{StoreClient: m1, minTime: math.MinInt64, maxTime: math.MaxInt64},
 		&testClient{StoreClient: &mockedStoreAPI{
 			RespLabelValues: &storepb.LabelValuesResponse{
 				Values: []string{"3", "4"},
 			},
 		}},
-		&testClient{StoreClient: &mockedStoreAPI{
-			RespLabelValues: &storepb.LabelValuesResponse{
-				Values: []string{"5", "6"},
-			}},
-			minTime: timestamp.FromTime(time.Now().Add(-1 * time.Minute)),
-			maxTime: timestamp.FromTime(time.Now()),
+		&testClient{
+			StoreClient: m3,
+			minTime:     timestamp.FromTime(time.Now().Add(-1 * time.Minute)),
+			maxTime:     timestamp.FromTime(time.Now()),
 		},
 	}
 	q := NewProxyStore(nil,
@@ -1171,6 +1428,10 @@ func TestProxyStore_LabelValues(t *testing.T) {
 	testutil.Equals(t, []string{"1", "2", "3", "4", "5", "6"}, resp.Values)
 	testutil.Equals(t, 1, len(resp.Warnings))
 
+	// The time range of the request is clamped to the one of the store client.
+	testutil.Equals(t, cls[2].(*testClient).minTime, m3.LastLabelValuesReq.Start)
+	testutil.Equals(t, cls[2].(*testClient).maxTime, m3.LastLabelValuesReq.End)
+
 	// Request outside the time range of the last store client.
 	req = &storepb.LabelValuesRequest{
 		Label:                   "a",
@@ -1186,6 +1447,73 @@ func TestProxyStore_LabelValues(t *testing.T) {
 	testutil.Equals(t, 1, len(resp.Warnings))
 }
 
+func TestProxyStore_LabelValues_Matchers(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	eu := &mockedStoreAPI{RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"1"}}}
+	us := &mockedStoreAPI{RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"2"}}}
+	cls := []Client{
+		&testClient{StoreClient: eu, labelSets: []labels.Labels{labels.FromStrings("region", "eu")}, minTime: math.MinInt64, maxTime: math.MaxInt64},
+		&testClient{StoreClient: us, labelSets: []labels.Labels{labels.FromStrings("region", "us")}, minTime: math.MinInt64, maxTime: math.MaxInt64},
+	}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		labels.FromStrings("cluster", "a"),
+		0*time.Second,
+	)
+
+	for _, tc := range []struct {
+		title    string
+		matchers []storepb.LabelMatcher
+
+		expectedValues   []string
+		expectedMatchers []storepb.LabelMatcher
+	}{
+		{
+			title:          "no matchers",
+			expectedValues: []string{"1", "2"},
+		},
+		{
+			title:            "stores filtered out by their external labels",
+			matchers:         []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "eu"}, {Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"}},
+			expectedValues:   []string{"1"},
+			expectedMatchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "eu"}, {Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"}},
+		},
+		{
+			title:            "matchers on selector labels are not forwarded",
+			matchers:         []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "a"}, {Type: storepb.LabelMatcher_EQ, Name: "region", Value: "eu"}},
+			expectedValues:   []string{"1"},
+			expectedMatchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "eu"}},
+		},
+		{
+			title:    "selector labels do not match",
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "b"}},
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			eu.LastLabelValuesReq = nil
+			resp, err := q.LabelValues(context.Background(), &storepb.LabelValuesRequest{
+				Label:    "a",
+				Start:    timestamp.FromTime(minTime),
+				End:      timestamp.FromTime(maxTime),
+				Matchers: tc.matchers,
+			})
+			testutil.Ok(t, err)
+			if len(resp.Values) == 0 {
+				resp.Values = nil
+			}
+			testutil.Equals(t, tc.expectedValues, resp.Values)
+			if tc.expectedValues == nil {
+				testutil.Assert(t, eu.LastLabelValuesReq == nil, "store should not be queried")
+				return
+			}
+			testutil.Equals(t, tc.expectedMatchers, eu.LastLabelValuesReq.Matchers)
+		})
+	}
+}
+
 func TestProxyStore_LabelNames(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1406,6 +1734,10 @@ func seriesEquals(t *testing.T, expected []rawSeries, got []storepb.Series) {
 }
 
 func TestStoreMatches(t *testing.T) {
+	cache, err := NewMatcherCache(nil, 100, time.Minute)
+	testutil.Ok(t, err)
+	metricNameFilter := NewMetricNameFilter([]uint64{metricNameHash("foo")}, 0.001)
+
 	for _, c := range []struct {
 		s          Client
 		mint, maxt int64
@@ -1527,12 +1859,46 @@ func TestStoreMatches(t *testing.T) {
 			maxt:          1,
 			expectedMatch: true,
 		},
+		{
+			s: &testClient{metricNameFilter: metricNameFilter},
+			ms: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "foo"),
+			},
+			maxt:          1,
+			expectedMatch: true,
+		},
+		{
+			s: &testClient{metricNameFilter: metricNameFilter},
+			ms: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "a", "b"),
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "bar"),
+			},
+			maxt:           1,
+			expectedMatch:  false,
+			expectedReason: "does not have series of metric name bar according to its metric name filter",
+		},
+		{
+			// Only equality matchers of the metric name are checked.
+			s: &testClient{metricNameFilter: metricNameFilter},
+			ms: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "bar"),
+				labels.MustNewMatcher(labels.MatchNotEqual, labels.MetricName, "foo"),
+			},
+			maxt:          1,
+			expectedMatch: true,
+		},
 	} {
 		t.Run("", func(t *testing.T) {
-			ok, reason := storeMatches(context.TODO(), c.s, c.mint, c.maxt, c.ms...)
+			ok, reason := storeMatches(context.TODO(), nil, c.s, c.mint, c.maxt, c.ms...)
 			testutil.Equals(t, c.expectedMatch, ok)
 			testutil.Equals(t, c.expectedReason, reason)
 
+			// Cached results must be the same, on both miss and hit.
+			for i := 0; i < 2; i++ {
+				ok, reason = storeMatches(context.TODO(), cache, c.s, c.mint, c.maxt, c.ms...)
+				testutil.Equals(t, c.expectedMatch, ok)
+				testutil.Equals(t, c.expectedReason, reason)
+			}
 		})
 	}
 }
@@ -1898,3 +2264,23 @@ func TestProxyStore_storeMatchMetadata(t *testing.T) {
 	testutil.Assert(t, ok)
 	testutil.Equals(t, "", reason)
 }
+
+func TestProxyStore_storeMatchTypes(t *testing.T) {
+	_, err := ParseStoreTypes([]string{"sidecar", "compact"})
+	testutil.NotOk(t, err)
+	types, err := ParseStoreTypes([]string{"store, receive", "sidecar"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []component.StoreAPI{component.Store, component.Receive, component.Sidecar}, types)
+
+	c := testClient{storeType: component.Rule, minTime: math.MinInt64, maxTime: math.MaxInt64}
+	ok, reason := storeMatches(context.Background(), nil, c, 0, 1)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, "", reason)
+
+	ok, reason = storeMatches(NewContextWithStoreTypes(context.Background(), types), nil, c, 0, 1)
+	testutil.Assert(t, !ok)
+	testutil.Equals(t, "store type rule is not one of the requested store types [store receive sidecar]", reason)
+
+	ok, _ = storeMatches(NewContextWithStoreTypes(context.Background(), []component.StoreAPI{component.Rule}), nil, c, 0, 1)
+	testutil.Assert(t, ok)
+}
@@ -0,0 +1,248 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/client"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/errutil"
+)
+
+const (
+	// primaryEndpoint is the endpoint label value of the primary bucket.
+	primaryEndpoint = "primary"
+
+	fallbackReasonNotFound = "not-found"
+	fallbackReasonError    = "error"
+)
+
+// errReplicaObjectMissing is returned by reads of a replica which does not have the object, e.g. because of the
+// replication lag.
+var errReplicaObjectMissing = errors.New("object missing in read replica")
+
+// ReadReplicaConfig is the configuration of a read replica of the bucket of the store gateway.
+type ReadReplicaConfig struct {
+	// Name identifies the replica in logs and metrics.
+	Name string `yaml:"name"`
+	// Bucket is the client configuration of the replica, in the format of --objstore.config.
+	Bucket client.BucketConfig `yaml:"bucket"`
+}
+
+// NewReadReplicasBucketFromYaml returns a bucket reading from the read replicas configured in the YAML content, in
+// their order, and from the primary bucket. Writes go to the primary bucket only.
+func NewReadReplicasBucketFromYaml(logger log.Logger, reg prometheus.Registerer, confContentYaml []byte, primary objstore.InstrumentedBucket, component string) (*ReadReplicasBucket, error) {
+	var configs []ReadReplicaConfig
+	if err := yaml.UnmarshalStrict(confContentYaml, &configs); err != nil {
+		return nil, errors.Wrap(err, "parsing read replicas config YAML")
+	}
+
+	names := map[string]struct{}{primaryEndpoint: {}}
+	replicas := make([]readReplica, 0, len(configs))
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, errors.New("read replica without name")
+		}
+		if _, ok := names[c.Name]; ok {
+			return nil, errors.Errorf("duplicate read replica name %q", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		conf, err := yaml.Marshal(c.Bucket)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal bucket config of read replica %s", c.Name)
+		}
+		// Replicas are instrumented by the metrics of the read replicas bucket, the objstore ones are left to the primary.
+		bkt, err := client.NewBucket(log.With(logger, "read_replica", c.Name), conf, nil, component)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create bucket client of read replica %s", c.Name)
+		}
+		replicas = append(replicas, readReplica{name: c.Name, bkt: bkt})
+	}
+	return newReadReplicasBucket(logger, reg, primary, replicas), nil
+}
+
+type readReplica struct {
+	name string
+	bkt  objstore.Bucket
+}
+
+// ReadReplicasBucket is a bucket whose reads prefer its read replicas, e.g. the ones local to the zone of the store
+// gateway, and fall back to the next replica and eventually to the primary bucket when a read fails or the object is
+// missing because of the replication lag. Writes go to the primary bucket only.
+type ReadReplicasBucket struct {
+	objstore.Bucket
+
+	logger   log.Logger
+	replicas []readReplica
+
+	reads     *prometheus.CounterVec
+	fallbacks *prometheus.CounterVec
+}
+
+func newReadReplicasBucket(logger log.Logger, reg prometheus.Registerer, primary objstore.Bucket, replicas []readReplica) *ReadReplicasBucket {
+	b := &ReadReplicasBucket{
+		Bucket:   primary,
+		logger:   logger,
+		replicas: replicas,
+		reads: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_store_bucket_read_replica_reads_total",
+			Help: "Number of read operations served by each endpoint of the bucket, its read replicas and the primary.",
+		}, []string{"endpoint", "operation"}),
+		fallbacks: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_store_bucket_read_replica_fallbacks_total",
+			Help: "Number of read operations falling back from a read replica to the next endpoint of the bucket.",
+		}, []string{"endpoint", "operation", "reason"}),
+	}
+	for _, op := range []string{objstore.OpIter, objstore.OpGet, objstore.OpGetRange, objstore.OpExists, objstore.OpAttributes} {
+		b.reads.WithLabelValues(primaryEndpoint, op)
+		for _, r := range replicas {
+			b.reads.WithLabelValues(r.name, op)
+			b.fallbacks.WithLabelValues(r.name, op, fallbackReasonNotFound)
+			b.fallbacks.WithLabelValues(r.name, op, fallbackReasonError)
+		}
+	}
+	return b
+}
+
+func (b *ReadReplicasBucket) Name() string {
+	return "read-replicas: " + b.Bucket.Name()
+}
+
+func (b *ReadReplicasBucket) WithExpectedErrs(expectedFunc objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	// Make a copy, but replace the buckets with instrumented ones.
+	res := &ReadReplicasBucket{}
+	*res = *b
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		res.Bucket = ib.WithExpectedErrs(expectedFunc)
+	}
+	res.replicas = make([]readReplica, 0, len(b.replicas))
+	for _, r := range b.replicas {
+		if ib, ok := r.bkt.(objstore.InstrumentedBucket); ok {
+			r.bkt = ib.WithExpectedErrs(expectedFunc)
+		}
+		res.replicas = append(res.replicas, r)
+	}
+	return res
+}
+
+func (b *ReadReplicasBucket) ReaderWithExpectedErrs(expectedFunc objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(expectedFunc)
+}
+
+// Close closes the primary bucket and the read replicas.
+func (b *ReadReplicasBucket) Close() error {
+	var merr errutil.MultiError
+	merr.Add(b.Bucket.Close())
+	for _, r := range b.replicas {
+		merr.Add(r.bkt.Close())
+	}
+	return merr.Err()
+}
+
+// read calls fn with the read replicas in order, until one of them succeeds, and with the primary bucket otherwise.
+// It returns the error of the primary bucket, or the one of the replica if the context is canceled.
+func (b *ReadReplicasBucket) read(ctx context.Context, op, name string, fn func(r objstore.BucketReader, primary bool) error) error {
+	for _, r := range b.replicas {
+		err := fn(r.bkt, false)
+		if err == nil {
+			b.reads.WithLabelValues(r.name, op).Inc()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		reason := fallbackReasonError
+		if errors.Is(err, errReplicaObjectMissing) || r.bkt.IsObjNotFoundErr(err) {
+			reason = fallbackReasonNotFound
+		} else {
+			level.Debug(b.logger).Log("msg", "read from read replica failed, falling back", "replica", r.name, "operation", op, "name", name, "err", err)
+		}
+		b.fallbacks.WithLabelValues(r.name, op, reason).Inc()
+	}
+	b.reads.WithLabelValues(primaryEndpoint, op).Inc()
+	return fn(b.Bucket, true)
+}
+
+// Iter calls f for the objects listed by the first endpoint whose listing succeeds. Objects not replicated yet are not
+// listed by the read replicas.
+func (b *ReadReplicasBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	var (
+		names       []string
+		fromReplica bool
+	)
+	if err := b.read(ctx, objstore.OpIter, dir, func(r objstore.BucketReader, primary bool) error {
+		if primary {
+			return r.Iter(ctx, dir, f, options...)
+		}
+		// The objects are only passed to f once the listing succeeded, so that failed listings can be retried.
+		names = names[:0]
+		if err := r.Iter(ctx, dir, func(name string) error {
+			names = append(names, name)
+			return nil
+		}, options...); err != nil {
+			return err
+		}
+		fromReplica = true
+		return nil
+	}); err != nil || !fromReplica {
+		return err
+	}
+	for _, name := range names {
+		if err := f(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *ReadReplicasBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.read(ctx, objstore.OpGet, name, func(r objstore.BucketReader, _ bool) error {
+		rc, err = r.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+func (b *ReadReplicasBucket) GetRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.read(ctx, objstore.OpGetRange, name, func(r objstore.BucketReader, _ bool) error {
+		rc, err = r.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+func (b *ReadReplicasBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
+	err = b.read(ctx, objstore.OpExists, name, func(r objstore.BucketReader, primary bool) error {
+		exists, err = r.Exists(ctx, name)
+		if err == nil && !exists && !primary {
+			return errReplicaObjectMissing
+		}
+		return err
+	})
+	return exists, err
+}
+
+func (b *ReadReplicasBucket) Attributes(ctx context.Context, name string) (attrs objstore.ObjectAttributes, err error) {
+	err = b.read(ctx, objstore.OpAttributes, name, func(r objstore.BucketReader, _ bool) error {
+		attrs, err = r.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+// IsObjNotFoundErr returns true if the error of a read means the object does not exist. Reads return the errors of the
+// primary bucket, unless their context is canceled.
+func (b *ReadReplicasBucket) IsObjNotFoundErr(err error) bool {
+	return b.Bucket.IsObjNotFoundErr(err)
+}
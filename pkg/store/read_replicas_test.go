@@ -0,0 +1,174 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// failingBucket fails all reads while failing is true.
+type failingBucket struct {
+	*objstore.InMemBucket
+	failing bool
+}
+
+func (b *failingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if b.failing {
+		return nil, errors.New("unavailable")
+	}
+	return b.InMemBucket.Get(ctx, name)
+}
+
+func (b *failingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if b.failing {
+		return errors.New("unavailable")
+	}
+	return b.InMemBucket.Iter(ctx, dir, f, options...)
+}
+
+func TestReadReplicasBucket(t *testing.T) {
+	ctx := context.Background()
+	primary := objstore.NewInMemBucket()
+	local := &failingBucket{InMemBucket: objstore.NewInMemBucket()}
+	remote := &failingBucket{InMemBucket: objstore.NewInMemBucket()}
+	bkt := newReadReplicasBucket(log.NewNopLogger(), nil, objstore.WithNoopInstr(primary), []readReplica{
+		{name: "local", bkt: local},
+		{name: "remote", bkt: remote},
+	})
+
+	get := func(name string) string {
+		rc, err := bkt.Get(ctx, name)
+		testutil.Ok(t, err)
+		defer rc.Close()
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		return string(b)
+	}
+	reads := func(endpoint, op string) float64 {
+		return promtest.ToFloat64(bkt.reads.WithLabelValues(endpoint, op))
+	}
+	fallbacks := func(endpoint, op, reason string) float64 {
+		return promtest.ToFloat64(bkt.fallbacks.WithLabelValues(endpoint, op, reason))
+	}
+
+	// Writes go to the primary only.
+	testutil.Ok(t, bkt.Upload(ctx, "a", strings.NewReader("primary")))
+	testutil.Equals(t, 1, len(primary.Objects()))
+	testutil.Equals(t, 0, len(local.Objects()))
+	testutil.Ok(t, local.Upload(ctx, "a", strings.NewReader("local")))
+	testutil.Ok(t, remote.Upload(ctx, "a", strings.NewReader("remote")))
+
+	// Reads prefer the replicas in their order.
+	testutil.Equals(t, "local", get("a"))
+	testutil.Equals(t, 1.0, reads("local", objstore.OpGet))
+
+	// Failed reads fall back to the next endpoint.
+	local.failing = true
+	testutil.Equals(t, "remote", get("a"))
+	testutil.Equals(t, 1.0, reads("remote", objstore.OpGet))
+	testutil.Equals(t, 1.0, fallbacks("local", objstore.OpGet, fallbackReasonError))
+	local.failing = false
+
+	// Objects missing in the replicas, e.g. not replicated yet, are read from the primary.
+	testutil.Ok(t, bkt.Upload(ctx, "b", strings.NewReader("primary")))
+	testutil.Equals(t, "primary", get("b"))
+	testutil.Equals(t, 1.0, reads(primaryEndpoint, objstore.OpGet))
+	testutil.Equals(t, 1.0, fallbacks("local", objstore.OpGet, fallbackReasonNotFound))
+	testutil.Equals(t, 1.0, fallbacks("remote", objstore.OpGet, fallbackReasonNotFound))
+
+	ok, err := bkt.Exists(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, 1.0, reads(primaryEndpoint, objstore.OpExists))
+	ok, err = bkt.Exists(ctx, "d")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok)
+
+	attrs, err := bkt.Attributes(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(len("primary")), attrs.Size)
+
+	rc, err := bkt.GetRange(ctx, "a", 1, 2)
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "oc", string(b))
+
+	// Objects missing in all endpoints are reported by the primary.
+	_, err = bkt.Get(ctx, "d")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err))
+
+	// Listings are served by the first replica whose listing succeeds.
+	iter := func() []string {
+		var names []string
+		testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+			names = append(names, name)
+			return nil
+		}))
+		sort.Strings(names)
+		return names
+	}
+	testutil.Ok(t, local.Upload(ctx, "c", strings.NewReader("local")))
+	testutil.Equals(t, []string{"a", "c"}, iter())
+	local.failing = true
+	testutil.Equals(t, []string{"a"}, iter())
+	testutil.Equals(t, 1.0, fallbacks("local", objstore.OpIter, fallbackReasonError))
+	testutil.Equals(t, 1.0, reads("remote", objstore.OpIter))
+	remote.failing = true
+	testutil.Equals(t, []string{"a", "b"}, iter())
+	testutil.Equals(t, 1.0, reads(primaryEndpoint, objstore.OpIter))
+
+	testutil.Ok(t, bkt.Delete(ctx, "b"))
+	testutil.Equals(t, 1, len(primary.Objects()))
+}
+
+func TestNewReadReplicasBucketFromYaml(t *testing.T) {
+	primary := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	dir := t.TempDir()
+
+	bkt, err := NewReadReplicasBucketFromYaml(log.NewNopLogger(), nil, []byte(`
+- name: local
+  bucket:
+    type: FILESYSTEM
+    config:
+      directory: `+dir+`
+`), primary, "store")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(bkt.replicas))
+	testutil.Equals(t, "local", bkt.replicas[0].name)
+
+	testutil.Ok(t, bkt.Upload(context.Background(), "a", bytes.NewReader([]byte("primary"))))
+	ok, err := bkt.Exists(context.Background(), "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(bkt.fallbacks.WithLabelValues("local", objstore.OpExists, fallbackReasonNotFound)))
+	testutil.Ok(t, bkt.Close())
+
+	for _, conf := range []string{
+		`- bucket: {type: FILESYSTEM, config: {directory: ` + dir + `}}`,
+		`- {name: primary, bucket: {type: FILESYSTEM, config: {directory: ` + dir + `}}}`,
+		`- {name: a, bucket: {type: FILESYSTEM, config: {directory: ` + dir + `}}}
+- {name: a, bucket: {type: FILESYSTEM, config: {directory: ` + dir + `}}}`,
+		`- {name: a, bucket: {type: UNKNOWN}}`,
+		`- {name: a, unknown: true}`,
+	} {
+		_, err := NewReadReplicasBucketFromYaml(log.NewNopLogger(), nil, []byte(conf), primary, "store")
+		testutil.NotOk(t, err, conf)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+type storeFailuresKey struct{}
+
+// StoreFailure describes a store whose data is missing from a partial response, because it failed to return it.
+type StoreFailure struct {
+	// Endpoint is the address of the store.
+	Endpoint  string          `json:"endpoint"`
+	LabelSets []labels.Labels `json:"labelSets"`
+	// MinTime and MaxTime are the time range in milliseconds of the data which may be missing, i.e. the time range of
+	// the request limited to the one of the store.
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	Error   string `json:"error"`
+}
+
+// StoreFailures collects the failures of the stores which the proxy got a partial response from.
+type StoreFailures struct {
+	mtx      sync.Mutex
+	failures map[storeFailureKey]StoreFailure
+}
+
+// storeFailureKey identifies the failures of a store for a time range.
+type storeFailureKey struct {
+	endpoint   string
+	mint, maxt int64
+	err        string
+}
+
+// NewContextWithStoreFailures returns a context making the proxy stores called with it collect the failures of the
+// stores into the returned StoreFailures.
+func NewContextWithStoreFailures(ctx context.Context) (context.Context, *StoreFailures) {
+	f := &StoreFailures{failures: map[storeFailureKey]StoreFailure{}}
+	return context.WithValue(ctx, storeFailuresKey{}, f), f
+}
+
+// StoreFailuresFromContext returns the StoreFailures of the context, or nil if it has none.
+func StoreFailuresFromContext(ctx context.Context) *StoreFailures {
+	f, _ := ctx.Value(storeFailuresKey{}).(*StoreFailures)
+	return f
+}
+
+// CopyStoreFailures returns a copy of the target context with the store failures of the source context, if any.
+func CopyStoreFailures(trgt, src context.Context) context.Context {
+	if f := StoreFailuresFromContext(src); f != nil {
+		return context.WithValue(trgt, storeFailuresKey{}, f)
+	}
+	return trgt
+}
+
+// add records the failure of the store to return its data within the time range. It is a no-op on nil StoreFailures.
+func (f *StoreFailures) add(st Client, mint, maxt int64, err error) {
+	if f == nil {
+		return
+	}
+	mint, maxt = clampTimeRange(st, mint, maxt)
+	k := storeFailureKey{endpoint: st.Addr(), mint: mint, maxt: maxt, err: err.Error()}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.failures[k] = StoreFailure{
+		Endpoint:  k.endpoint,
+		LabelSets: st.LabelSets(),
+		MinTime:   k.mint,
+		MaxTime:   k.maxt,
+		Error:     k.err,
+	}
+}
+
+// Failures returns the collected store failures sorted by endpoint and time range. It returns nil on nil
+// StoreFailures.
+func (f *StoreFailures) Failures() []StoreFailure {
+	if f == nil {
+		return nil
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	res := make([]StoreFailure, 0, len(f.failures))
+	for _, failure := range f.failures {
+		res = append(res, failure)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Endpoint != res[j].Endpoint {
+			return res[i].Endpoint < res[j].Endpoint
+		}
+		if res[i].MinTime != res[j].MinTime {
+			return res[i].MinTime < res[j].MinTime
+		}
+		if res[i].MaxTime != res[j].MaxTime {
+			return res[i].MaxTime < res[j].MaxTime
+		}
+		return res[i].Error < res[j].Error
+	})
+	return res
+}
@@ -0,0 +1,82 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/component"
+)
+
+// QueryableStoreTypes are the types of the stores a query can be restricted to.
+var QueryableStoreTypes = []component.StoreAPI{component.Store, component.Sidecar, component.Receive, component.Rule, component.Query}
+
+type storeTypesKey struct{}
+
+// ParseStoreTypes returns the store types of the given names, e.g. "sidecar". Each name may also be a comma
+// separated list of names.
+func ParseStoreTypes(names []string) ([]component.StoreAPI, error) {
+	var types []component.StoreAPI
+	for _, n := range names {
+		for _, name := range strings.Split(n, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			t, ok := queryableStoreType(name)
+			if !ok {
+				return nil, errors.Errorf("unknown store type %q, expected one of %v", name, QueryableStoreTypes)
+			}
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+func queryableStoreType(name string) (component.StoreAPI, bool) {
+	for _, t := range QueryableStoreTypes {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// NewContextWithStoreTypes returns a context making the proxy stores called with it query only the stores of the
+// given types. All stores are queried if no type is given.
+func NewContextWithStoreTypes(ctx context.Context, types []component.StoreAPI) context.Context {
+	if len(types) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, storeTypesKey{}, types)
+}
+
+// StoreTypesFromContext returns the store types the queries of the context are restricted to, nil if they are not.
+func StoreTypesFromContext(ctx context.Context) []component.StoreAPI {
+	types, _ := ctx.Value(storeTypesKey{}).([]component.StoreAPI)
+	return types
+}
+
+// CopyStoreTypes returns a copy of the target context with the store types of the source context, if any.
+func CopyStoreTypes(trgt, src context.Context) context.Context {
+	return NewContextWithStoreTypes(trgt, StoreTypesFromContext(src))
+}
+
+// storeMatchTypes returns true if the store is of one of the given types, or if no type is given.
+func storeMatchTypes(s Client, types []component.StoreAPI) (ok bool, reason string) {
+	if len(types) == 0 {
+		return true, ""
+	}
+	st := s.StoreType()
+	for _, t := range types {
+		if st == t {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("store type %s is not one of the requested store types %v", st, types)
+}
@@ -257,6 +257,103 @@ func (s *uniqueSeriesSet) Next() bool {
 	return true
 }
 
+// NewWithoutReplicaLabelsSeriesSet returns a series set with the given replica labels removed from all series.
+// Removing labels breaks the sort order guarantee, so the wrapped set is buffered and re-sorted if
+// required. Series that are equal after removal are merged into one with exact duplicated chunks removed.
+func NewWithoutReplicaLabelsSeriesSet(wrapped SeriesSet, replicaLabels []string) SeriesSet {
+	if len(replicaLabels) == 0 {
+		return wrapped
+	}
+	return &withoutReplicaLabelsSeriesSet{wrapped: wrapped, replicaLabels: replicaLabels, i: -1}
+}
+
+type withoutReplicaLabelsSeriesSet struct {
+	wrapped       SeriesSet
+	replicaLabels []string
+
+	initiated bool
+	series    []Series
+	i         int
+}
+
+func (s *withoutReplicaLabelsSeriesSet) init() {
+	s.initiated = true
+
+	sorted := true
+	for s.wrapped.Next() {
+		lset, chks := s.wrapped.At()
+		lset = labels.NewBuilder(lset).Del(s.replicaLabels...).Labels()
+
+		if n := len(s.series); n > 0 && labels.Compare(s.series[n-1].PromLabels(), lset) > 0 {
+			sorted = false
+		}
+		s.series = append(s.series, Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chks})
+	}
+	if !sorted {
+		sort.SliceStable(s.series, func(i, j int) bool {
+			return labels.Compare(s.series[i].PromLabels(), s.series[j].PromLabels()) < 0
+		})
+	}
+
+	// Merge adjacent series which became identical after replica labels were removed.
+	merged := s.series[:0]
+	for _, series := range s.series {
+		if n := len(merged); n > 0 && labels.Compare(merged[n-1].PromLabels(), series.PromLabels()) == 0 {
+			merged[n-1].Chunks = append(merged[n-1].Chunks, series.Chunks...)
+			continue
+		}
+		merged = append(merged, series)
+	}
+	for i := range merged {
+		merged[i].Chunks = sortAndRemoveExactDuplicates(merged[i].Chunks)
+	}
+	s.series = merged
+}
+
+func (s *withoutReplicaLabelsSeriesSet) Next() bool {
+	if !s.initiated {
+		s.init()
+	}
+	if s.wrapped.Err() != nil || s.i >= len(s.series)-1 {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *withoutReplicaLabelsSeriesSet) At() (labels.Labels, []AggrChunk) {
+	if s.i < 0 || s.i >= len(s.series) {
+		return nil, nil
+	}
+	return s.series[s.i].PromLabels(), s.series[s.i].Chunks
+}
+
+func (s *withoutReplicaLabelsSeriesSet) Err() error {
+	return s.wrapped.Err()
+}
+
+// sortAndRemoveExactDuplicates sorts chunks by min time and removes 1:1 duplicates.
+func sortAndRemoveExactDuplicates(chks []AggrChunk) []AggrChunk {
+	if len(chks) <= 1 {
+		return chks
+	}
+	sort.SliceStable(chks, func(i, j int) bool {
+		if chks[i].MinTime != chks[j].MinTime {
+			return chks[i].MinTime < chks[j].MinTime
+		}
+		return chks[i].MaxTime < chks[j].MaxTime
+	})
+
+	ret := chks[:1]
+	for _, c := range chks[1:] {
+		if ret[len(ret)-1].Compare(c) == 0 {
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
 // Compare returns positive 1 if chunk is smaller -1 if larger than b by min time, then max time.
 // It returns 0 if chunks are exactly the same.
 func (m AggrChunk) Compare(b AggrChunk) int {
@@ -354,6 +354,74 @@ func TestMergeSeriesSetError(t *testing.T) {
 	testutil.Equals(t, expectedErr, ss.Err())
 }
 
+func TestWithoutReplicaLabelsSeriesSet(t *testing.T) {
+	for _, tcase := range []struct {
+		desc          string
+		in            []rawSeries
+		replicaLabels []string
+		expected      []rawSeries
+	}{
+		{
+			desc: "no replica labels",
+			in: []rawSeries{{
+				lset:   labels.FromStrings("a", "a", "replica", "1"),
+				chunks: [][]sample{{{1, 1}, {2, 2}}},
+			}},
+			expected: []rawSeries{{
+				lset:   labels.FromStrings("a", "a", "replica", "1"),
+				chunks: [][]sample{{{1, 1}, {2, 2}}},
+			}},
+		},
+		{
+			desc: "replicas merged, exact duplicated chunks removed and chunks sorted",
+			in: []rawSeries{{
+				lset:   labels.FromStrings("a", "a", "replica", "1"),
+				chunks: [][]sample{{{3, 3}, {4, 4}}},
+			}, {
+				lset:   labels.FromStrings("a", "a", "replica", "2"),
+				chunks: [][]sample{{{1, 1}, {2, 2}}, {{3, 3}, {4, 4}}},
+			}, {
+				lset:   labels.FromStrings("a", "b", "replica", "1"),
+				chunks: [][]sample{{{1, 1}}},
+			}},
+			replicaLabels: []string{"replica"},
+			expected: []rawSeries{{
+				lset:   labels.FromStrings("a", "a"),
+				chunks: [][]sample{{{1, 1}, {2, 2}}, {{3, 3}, {4, 4}}},
+			}, {
+				lset:   labels.FromStrings("a", "b"),
+				chunks: [][]sample{{{1, 1}}},
+			}},
+		},
+		{
+			desc: "order broken by label removal is restored",
+			in: []rawSeries{{
+				lset:   labels.FromStrings("a", "1", "b", "2"),
+				chunks: [][]sample{{{1, 1}}},
+			}, {
+				lset:   labels.FromStrings("a", "2", "b", "1"),
+				chunks: [][]sample{{{2, 2}}},
+			}, {
+				lset:   labels.FromStrings("a", "3", "b", "2"),
+				chunks: [][]sample{{{3, 3}}},
+			}},
+			replicaLabels: []string{"a"},
+			expected: []rawSeries{{
+				lset:   labels.FromStrings("b", "1"),
+				chunks: [][]sample{{{2, 2}}},
+			}, {
+				lset:   labels.FromStrings("b", "2"),
+				chunks: [][]sample{{{1, 1}}, {{3, 3}}},
+			}},
+		},
+	} {
+		t.Run(tcase.desc, func(t *testing.T) {
+			ss := NewWithoutReplicaLabelsSeriesSet(newListSeriesSet(t, tcase.in), tcase.replicaLabels)
+			testutil.Equals(t, tcase.expected, expandSeriesSet(t, ss))
+		})
+	}
+}
+
 type rawSeries struct {
 	lset   labels.Labels
 	chunks [][]sample
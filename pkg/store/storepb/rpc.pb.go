@@ -16,6 +16,7 @@ import (
 	github_com_thanos_io_thanos_pkg_store_labelpb "github.com/thanos-io/thanos/pkg/store/labelpb"
 	labelpb "github.com/thanos-io/thanos/pkg/store/labelpb"
 	prompb "github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	writev2pb "github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -185,6 +186,45 @@ func (m *WriteRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_WriteRequest proto.InternalMessageInfo
 
+type WriteRequestV2 struct {
+	Request writev2pb.Request `protobuf:"bytes,1,opt,name=request,proto3" json:"request"`
+	Tenant  string            `protobuf:"bytes,2,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	Replica int64             `protobuf:"varint,3,opt,name=replica,proto3" json:"replica,omitempty"`
+}
+
+func (m *WriteRequestV2) Reset()         { *m = WriteRequestV2{} }
+func (m *WriteRequestV2) String() string { return proto.CompactTextString(m) }
+func (*WriteRequestV2) ProtoMessage()    {}
+func (*WriteRequestV2) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{2}
+}
+func (m *WriteRequestV2) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *WriteRequestV2) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_WriteRequestV2.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *WriteRequestV2) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WriteRequestV2.Merge(m, src)
+}
+func (m *WriteRequestV2) XXX_Size() int {
+	return m.Size()
+}
+func (m *WriteRequestV2) XXX_DiscardUnknown() {
+	xxx_messageInfo_WriteRequestV2.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WriteRequestV2 proto.InternalMessageInfo
+
 type InfoRequest struct {
 }
 
@@ -192,7 +232,7 @@ func (m *InfoRequest) Reset()         { *m = InfoRequest{} }
 func (m *InfoRequest) String() string { return proto.CompactTextString(m) }
 func (*InfoRequest) ProtoMessage()    {}
 func (*InfoRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{2}
+	return fileDescriptor_a938d55a388af629, []int{3}
 }
 func (m *InfoRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -235,7 +275,7 @@ func (m *InfoResponse) Reset()         { *m = InfoResponse{} }
 func (m *InfoResponse) String() string { return proto.CompactTextString(m) }
 func (*InfoResponse) ProtoMessage()    {}
 func (*InfoResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{3}
+	return fileDescriptor_a938d55a388af629, []int{4}
 }
 func (m *InfoResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -289,13 +329,17 @@ type SeriesRequest struct {
 	// query_hints are the hints coming from the PromQL engine when
 	// requesting a storage.SeriesSet for a given expression.
 	QueryHints *QueryHints `protobuf:"bytes,12,opt,name=query_hints,json=queryHints,proto3" json:"query_hints,omitempty"`
+	// without_replica_labels are replica labels which have to be excluded from the labels of the returned series.
+	// Series which become identical after the removal are merged into one, so the response is deduplicated
+	// across replicas. Response remains sorted by labels.
+	WithoutReplicaLabels []string `protobuf:"bytes,13,rep,name=without_replica_labels,json=withoutReplicaLabels,proto3" json:"without_replica_labels,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
 func (m *SeriesRequest) String() string { return proto.CompactTextString(m) }
 func (*SeriesRequest) ProtoMessage()    {}
 func (*SeriesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{4}
+	return fileDescriptor_a938d55a388af629, []int{5}
 }
 func (m *SeriesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -340,7 +384,7 @@ func (m *QueryHints) Reset()         { *m = QueryHints{} }
 func (m *QueryHints) String() string { return proto.CompactTextString(m) }
 func (*QueryHints) ProtoMessage()    {}
 func (*QueryHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{5}
+	return fileDescriptor_a938d55a388af629, []int{6}
 }
 func (m *QueryHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -378,7 +422,7 @@ func (m *Func) Reset()         { *m = Func{} }
 func (m *Func) String() string { return proto.CompactTextString(m) }
 func (*Func) ProtoMessage()    {}
 func (*Func) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{6}
+	return fileDescriptor_a938d55a388af629, []int{7}
 }
 func (m *Func) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -418,7 +462,7 @@ func (m *Grouping) Reset()         { *m = Grouping{} }
 func (m *Grouping) String() string { return proto.CompactTextString(m) }
 func (*Grouping) ProtoMessage()    {}
 func (*Grouping) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{7}
+	return fileDescriptor_a938d55a388af629, []int{8}
 }
 func (m *Grouping) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -455,7 +499,7 @@ func (m *Range) Reset()         { *m = Range{} }
 func (m *Range) String() string { return proto.CompactTextString(m) }
 func (*Range) ProtoMessage()    {}
 func (*Range) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{8}
+	return fileDescriptor_a938d55a388af629, []int{9}
 }
 func (m *Range) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -496,7 +540,7 @@ func (m *SeriesResponse) Reset()         { *m = SeriesResponse{} }
 func (m *SeriesResponse) String() string { return proto.CompactTextString(m) }
 func (*SeriesResponse) ProtoMessage()    {}
 func (*SeriesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{9}
+	return fileDescriptor_a938d55a388af629, []int{10}
 }
 func (m *SeriesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -599,7 +643,7 @@ func (m *LabelNamesRequest) Reset()         { *m = LabelNamesRequest{} }
 func (m *LabelNamesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesRequest) ProtoMessage()    {}
 func (*LabelNamesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{10}
+	return fileDescriptor_a938d55a388af629, []int{11}
 }
 func (m *LabelNamesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -641,7 +685,7 @@ func (m *LabelNamesResponse) Reset()         { *m = LabelNamesResponse{} }
 func (m *LabelNamesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesResponse) ProtoMessage()    {}
 func (*LabelNamesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{11}
+	return fileDescriptor_a938d55a388af629, []int{12}
 }
 func (m *LabelNamesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -688,7 +732,7 @@ func (m *LabelValuesRequest) Reset()         { *m = LabelValuesRequest{} }
 func (m *LabelValuesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesRequest) ProtoMessage()    {}
 func (*LabelValuesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{12}
+	return fileDescriptor_a938d55a388af629, []int{13}
 }
 func (m *LabelValuesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -730,7 +774,7 @@ func (m *LabelValuesResponse) Reset()         { *m = LabelValuesResponse{} }
 func (m *LabelValuesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesResponse) ProtoMessage()    {}
 func (*LabelValuesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{13}
+	return fileDescriptor_a938d55a388af629, []int{14}
 }
 func (m *LabelValuesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -764,6 +808,7 @@ func init() {
 	proto.RegisterEnum("thanos.Aggr", Aggr_name, Aggr_value)
 	proto.RegisterType((*WriteResponse)(nil), "thanos.WriteResponse")
 	proto.RegisterType((*WriteRequest)(nil), "thanos.WriteRequest")
+	proto.RegisterType((*WriteRequestV2)(nil), "thanos.WriteRequestV2")
 	proto.RegisterType((*InfoRequest)(nil), "thanos.InfoRequest")
 	proto.RegisterType((*InfoResponse)(nil), "thanos.InfoResponse")
 	proto.RegisterType((*SeriesRequest)(nil), "thanos.SeriesRequest")
@@ -781,84 +826,90 @@ func init() {
 func init() { proto.RegisterFile("store/storepb/rpc.proto", fileDescriptor_a938d55a388af629) }
 
 var fileDescriptor_a938d55a388af629 = []byte{
-	// 1230 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x5f, 0x6f, 0x13, 0x47,
-	0x10, 0xf7, 0xdd, 0xf9, 0xfc, 0x67, 0x9c, 0xa4, 0xc7, 0x62, 0xe0, 0x62, 0x24, 0xc7, 0xba, 0xaa,
-	0x52, 0x84, 0xa8, 0xdd, 0x9a, 0x0a, 0xa9, 0x15, 0x2f, 0x49, 0x30, 0x24, 0x2a, 0x31, 0x65, 0x9d,
-	0x90, 0x96, 0xaa, 0xb2, 0xce, 0xce, 0x72, 0x3e, 0xe1, 0xfb, 0xc3, 0xed, 0x5e, 0xc1, 0xaf, 0xed,
-	0x7b, 0x55, 0xf5, 0x23, 0x54, 0xfd, 0x10, 0xfd, 0x08, 0xbc, 0x95, 0xc7, 0xaa, 0x0f, 0xa8, 0x85,
-	0x2f, 0x52, 0xed, 0x9f, 0xb3, 0x7d, 0x69, 0x80, 0xa2, 0xf0, 0x72, 0xda, 0x99, 0xdf, 0xec, 0xec,
-	0xcc, 0xfc, 0x76, 0xe6, 0x16, 0x2e, 0x51, 0x16, 0x25, 0xa4, 0x23, 0xbe, 0xf1, 0xa8, 0x93, 0xc4,
-	0xe3, 0x76, 0x9c, 0x44, 0x2c, 0x42, 0x25, 0x36, 0x71, 0xc3, 0x88, 0x36, 0xd6, 0xf3, 0x06, 0x6c,
-	0x16, 0x13, 0x2a, 0x4d, 0x1a, 0x75, 0x2f, 0xf2, 0x22, 0xb1, 0xec, 0xf0, 0x95, 0xd2, 0xb6, 0xf2,
-	0x1b, 0xe2, 0x24, 0x0a, 0x4e, 0xec, 0x53, 0x2e, 0xa7, 0xee, 0x88, 0x4c, 0x4f, 0x42, 0x5e, 0x14,
-	0x79, 0x53, 0xd2, 0x11, 0xd2, 0x28, 0x7d, 0xd8, 0x71, 0xc3, 0x99, 0x84, 0x9c, 0x0f, 0x60, 0xf5,
-	0x28, 0xf1, 0x19, 0xc1, 0x84, 0xc6, 0x51, 0x48, 0x89, 0xf3, 0xa3, 0x06, 0x2b, 0x4a, 0xf3, 0x38,
-	0x25, 0x94, 0xa1, 0x2d, 0x00, 0xe6, 0x07, 0x84, 0x92, 0xc4, 0x27, 0xd4, 0xd6, 0x5a, 0xc6, 0x66,
-	0xad, 0x7b, 0x99, 0xef, 0x0e, 0x08, 0x9b, 0x90, 0x94, 0x0e, 0xc7, 0x51, 0x3c, 0x6b, 0x1f, 0xf8,
-	0x01, 0x19, 0x08, 0x93, 0xed, 0xe2, 0xb3, 0x17, 0x1b, 0x05, 0xbc, 0xb4, 0x09, 0x5d, 0x84, 0x12,
-	0x23, 0xa1, 0x1b, 0x32, 0x5b, 0x6f, 0x69, 0x9b, 0x55, 0xac, 0x24, 0x64, 0x43, 0x39, 0x21, 0xf1,
-	0xd4, 0x1f, 0xbb, 0xb6, 0xd1, 0xd2, 0x36, 0x0d, 0x9c, 0x89, 0xce, 0x2a, 0xd4, 0xf6, 0xc2, 0x87,
-	0x91, 0x8a, 0xc1, 0xf9, 0x45, 0x87, 0x15, 0x29, 0xcb, 0x28, 0xd1, 0x18, 0x4a, 0x22, 0xd1, 0x2c,
-	0xa0, 0xd5, 0xb6, 0x2c, 0x6c, 0xfb, 0x0e, 0xd7, 0x6e, 0xdf, 0xe0, 0x21, 0xfc, 0xf5, 0x62, 0xe3,
-	0x33, 0xcf, 0x67, 0x93, 0x74, 0xd4, 0x1e, 0x47, 0x41, 0x47, 0x1a, 0x7c, 0xec, 0x47, 0x6a, 0xd5,
-	0x89, 0x1f, 0x79, 0x9d, 0x5c, 0xcd, 0xda, 0x0f, 0xc4, 0x6e, 0xac, 0x5c, 0xa3, 0x75, 0xa8, 0x04,
-	0x7e, 0x38, 0xe4, 0x89, 0x88, 0xc0, 0x0d, 0x5c, 0x0e, 0xfc, 0x90, 0x67, 0x2a, 0x20, 0xf7, 0xa9,
-	0x84, 0x54, 0xe8, 0x81, 0xfb, 0x54, 0x40, 0x1d, 0xa8, 0x0a, 0xaf, 0x07, 0xb3, 0x98, 0xd8, 0xc5,
-	0x96, 0xb6, 0xb9, 0xd6, 0x3d, 0x97, 0x45, 0x37, 0xc8, 0x00, 0xbc, 0xb0, 0x41, 0xd7, 0x01, 0xc4,
-	0x81, 0x43, 0x4a, 0x18, 0xb5, 0x4d, 0x91, 0xcf, 0x7c, 0x87, 0x0c, 0x69, 0x40, 0x98, 0x2a, 0x6b,
-	0x75, 0xaa, 0x64, 0xea, 0xfc, 0x56, 0x84, 0x55, 0x59, 0xf2, 0x8c, 0xaa, 0xe5, 0x80, 0xb5, 0xd7,
-	0x07, 0xac, 0xe7, 0x03, 0xbe, 0xce, 0x21, 0x36, 0x9e, 0x90, 0x84, 0xda, 0x86, 0x38, 0xbd, 0x9e,
-	0xab, 0xe6, 0xbe, 0x04, 0x55, 0x00, 0x73, 0x5b, 0xd4, 0x85, 0x0b, 0xdc, 0x65, 0x42, 0x68, 0x34,
-	0x4d, 0x99, 0x1f, 0x85, 0xc3, 0x27, 0x7e, 0x78, 0x1c, 0x3d, 0x11, 0x49, 0x1b, 0xf8, 0x7c, 0xe0,
-	0x3e, 0xc5, 0x73, 0xec, 0x48, 0x40, 0xe8, 0x2a, 0x80, 0xeb, 0x79, 0x09, 0xf1, 0x5c, 0x46, 0x64,
-	0xae, 0x6b, 0xdd, 0x95, 0xec, 0xb4, 0x2d, 0xcf, 0x4b, 0xf0, 0x12, 0x8e, 0xbe, 0x80, 0xf5, 0xd8,
-	0x4d, 0x98, 0xef, 0x4e, 0xf9, 0x29, 0x82, 0xf9, 0xe1, 0xb1, 0x4f, 0xdd, 0xd1, 0x94, 0x1c, 0xdb,
-	0xa5, 0x96, 0xb6, 0x59, 0xc1, 0x97, 0x94, 0x41, 0x76, 0x33, 0x6e, 0x2a, 0x18, 0x7d, 0x7b, 0xca,
-	0x5e, 0xca, 0x12, 0x97, 0x11, 0x6f, 0x66, 0x97, 0x05, 0x2d, 0x1b, 0xd9, 0xc1, 0x5f, 0xe5, 0x7d,
-	0x0c, 0x94, 0xd9, 0x7f, 0x9c, 0x67, 0x00, 0xda, 0x80, 0x1a, 0x7d, 0xe4, 0xc7, 0xc3, 0xf1, 0x24,
-	0x0d, 0x1f, 0x51, 0xbb, 0x22, 0x42, 0x01, 0xae, 0xda, 0x11, 0x1a, 0x74, 0x05, 0xcc, 0x89, 0x1f,
-	0x32, 0x6a, 0x57, 0x5b, 0x9a, 0x28, 0xa8, 0xec, 0xc0, 0x76, 0xd6, 0x81, 0xed, 0xad, 0x70, 0x86,
-	0xa5, 0x09, 0x42, 0x50, 0xa4, 0x8c, 0xc4, 0x36, 0x88, 0xb2, 0x89, 0x35, 0xaa, 0x83, 0x99, 0xb8,
-	0xa1, 0x47, 0xec, 0x9a, 0x50, 0x4a, 0x01, 0x5d, 0x83, 0xda, 0xe3, 0x94, 0x24, 0xb3, 0xa1, 0xf4,
-	0xbd, 0x22, 0x7c, 0xa3, 0x2c, 0x8b, 0x7b, 0x1c, 0xda, 0xe5, 0x08, 0x86, 0xc7, 0xf3, 0xb5, 0xf3,
-	0xab, 0x06, 0xb0, 0x80, 0x44, 0xe8, 0x8c, 0xc4, 0xc3, 0xc0, 0x9f, 0x4e, 0x7d, 0xaa, 0xae, 0x09,
-	0x70, 0xd5, 0xbe, 0xd0, 0xa0, 0x16, 0x14, 0x1f, 0xa6, 0xe1, 0x58, 0xdc, 0x92, 0xda, 0x82, 0x9c,
-	0x5b, 0x69, 0x38, 0xc6, 0x02, 0x41, 0x57, 0xa1, 0xe2, 0x25, 0x51, 0x1a, 0xfb, 0xa1, 0x27, 0xb8,
-	0xae, 0x75, 0xad, 0xcc, 0xea, 0xb6, 0xd2, 0xe3, 0xb9, 0x05, 0xfa, 0x30, 0x4b, 0xc5, 0x14, 0xa6,
-	0xf3, 0x4e, 0xc5, 0x5c, 0xa9, 0x32, 0x73, 0x1a, 0x50, 0xe4, 0x07, 0xf0, 0x5a, 0x84, 0xae, 0xba,
-	0xbd, 0x55, 0x2c, 0xd6, 0x4e, 0x17, 0x2a, 0x99, 0x5b, 0xb4, 0x06, 0xfa, 0x68, 0x26, 0xd0, 0x0a,
-	0xd6, 0x47, 0x33, 0x3e, 0x59, 0xd4, 0x1c, 0xe0, 0x37, 0xb7, 0x9a, 0xb5, 0xae, 0xb3, 0x01, 0xa6,
-	0xf0, 0xcf, 0x0d, 0x72, 0x99, 0x2a, 0xc9, 0xf9, 0x49, 0x83, 0xb5, 0xac, 0x79, 0xd4, 0x4c, 0xd9,
-	0x84, 0xd2, 0x7c, 0xc8, 0xf1, 0x48, 0xd7, 0xe6, 0x5d, 0x2b, 0xb4, 0xbb, 0x05, 0xac, 0x70, 0xd4,
-	0x80, 0xf2, 0x13, 0x37, 0x09, 0x79, 0xfe, 0x62, 0xa0, 0xed, 0x16, 0x70, 0xa6, 0x40, 0x57, 0x33,
-	0xe6, 0x8d, 0xd7, 0x33, 0xbf, 0x5b, 0x50, 0xdc, 0x6f, 0x57, 0xa0, 0x94, 0x10, 0x9a, 0x4e, 0x99,
-	0xf3, 0xbb, 0x0e, 0xe7, 0x44, 0xbb, 0xf5, 0xdd, 0x60, 0xd1, 0xd1, 0x6f, 0xec, 0x00, 0xed, 0x0c,
-	0x1d, 0xa0, 0x9f, 0xb1, 0x03, 0xea, 0x60, 0x52, 0xe6, 0x26, 0x4c, 0x4d, 0x3f, 0x29, 0x20, 0x0b,
-	0x0c, 0x12, 0x1e, 0xab, 0x01, 0xc0, 0x97, 0x8b, 0x46, 0x30, 0xdf, 0xde, 0x08, 0xcb, 0x83, 0xa8,
-	0xf4, 0xff, 0x07, 0x91, 0x93, 0x00, 0x5a, 0xae, 0x9c, 0xa2, 0xb3, 0x0e, 0x26, 0xbf, 0x3e, 0xf2,
-	0x0f, 0x51, 0xc5, 0x52, 0x40, 0x0d, 0xa8, 0x28, 0xa6, 0xa8, 0xad, 0x0b, 0x60, 0x2e, 0x2f, 0x62,
-	0x35, 0xde, 0x1a, 0xab, 0xf3, 0x87, 0xae, 0x0e, 0xbd, 0xef, 0x4e, 0xd3, 0x05, 0x5f, 0x75, 0x30,
-	0xc5, 0x0d, 0x54, 0x17, 0x58, 0x0a, 0x6f, 0x66, 0x51, 0x3f, 0x03, 0x8b, 0xc6, 0xfb, 0x62, 0xb1,
-	0x78, 0x0a, 0x8b, 0xe6, 0x29, 0x2c, 0x96, 0xde, 0x8d, 0xc5, 0xf2, 0x3b, 0xb0, 0x98, 0xc2, 0xf9,
-	0x5c, 0x41, 0x15, 0x8d, 0x17, 0xa1, 0xf4, 0xbd, 0xd0, 0x28, 0x1e, 0x95, 0xf4, 0xbe, 0x88, 0xbc,
-	0xf2, 0x1d, 0x54, 0xe7, 0x7f, 0x65, 0x54, 0x83, 0xf2, 0x61, 0xff, 0xcb, 0xfe, 0xdd, 0xa3, 0xbe,
-	0x55, 0x40, 0x55, 0x30, 0xef, 0x1d, 0xf6, 0xf0, 0x37, 0x96, 0x86, 0x2a, 0x50, 0xc4, 0x87, 0x77,
-	0x7a, 0x96, 0xce, 0x2d, 0x06, 0x7b, 0x37, 0x7b, 0x3b, 0x5b, 0xd8, 0x32, 0xb8, 0xc5, 0xe0, 0xe0,
-	0x2e, 0xee, 0x59, 0x45, 0xae, 0xc7, 0xbd, 0x9d, 0xde, 0xde, 0xfd, 0x9e, 0x65, 0x72, 0xfd, 0xcd,
-	0xde, 0xf6, 0xe1, 0x6d, 0xab, 0x74, 0x65, 0x1b, 0x8a, 0xfc, 0xb7, 0x86, 0xca, 0x60, 0xe0, 0xad,
-	0x23, 0xe9, 0x75, 0xe7, 0xee, 0x61, 0xff, 0xc0, 0xd2, 0xb8, 0x6e, 0x70, 0xb8, 0x6f, 0xe9, 0x7c,
-	0xb1, 0xbf, 0xd7, 0xb7, 0x0c, 0xb1, 0xd8, 0xfa, 0x5a, 0xba, 0x13, 0x56, 0x3d, 0x6c, 0x99, 0xdd,
-	0x1f, 0x74, 0x30, 0x45, 0x8c, 0xe8, 0x53, 0x28, 0xf2, 0x67, 0x10, 0x3a, 0x9f, 0x55, 0x74, 0xe9,
-	0x91, 0xd4, 0xa8, 0xe7, 0x95, 0xaa, 0x7e, 0x9f, 0x43, 0x49, 0xce, 0x2f, 0x74, 0x21, 0x3f, 0xcf,
-	0xb2, 0x6d, 0x17, 0x4f, 0xaa, 0xe5, 0xc6, 0x4f, 0x34, 0xb4, 0x03, 0xb0, 0xe8, 0x2b, 0xb4, 0x9e,
-	0x63, 0x71, 0x79, 0x4a, 0x35, 0x1a, 0xa7, 0x41, 0xea, 0xfc, 0x5b, 0x50, 0x5b, 0xa2, 0x15, 0xe5,
-	0x4d, 0x73, 0xcd, 0xd3, 0xb8, 0x7c, 0x2a, 0x26, 0xfd, 0x74, 0xfb, 0xb0, 0x26, 0x9e, 0xa5, 0xbc,
-	0x2b, 0x64, 0x31, 0x6e, 0x40, 0x0d, 0x93, 0x20, 0x62, 0x44, 0xe8, 0xd1, 0x3c, 0xfd, 0xe5, 0xd7,
-	0x6b, 0xe3, 0xc2, 0x09, 0xad, 0x7a, 0xe5, 0x16, 0xb6, 0x3f, 0x7a, 0xf6, 0x4f, 0xb3, 0xf0, 0xec,
-	0x65, 0x53, 0x7b, 0xfe, 0xb2, 0xa9, 0xfd, 0xfd, 0xb2, 0xa9, 0xfd, 0xfc, 0xaa, 0x59, 0x78, 0xfe,
-	0xaa, 0x59, 0xf8, 0xf3, 0x55, 0xb3, 0xf0, 0xa0, 0xac, 0x1e, 0xda, 0xa3, 0x92, 0xb8, 0x33, 0xd7,
-	0xfe, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x5a, 0xb7, 0x5e, 0x64, 0xd2, 0x0b, 0x00, 0x00,
+	// 1319 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0x5f, 0x8f, 0xd3, 0xd6,
+	0x12, 0x8f, 0xed, 0x38, 0x7f, 0x26, 0xbb, 0x7b, 0xcd, 0x21, 0x2c, 0xde, 0x20, 0x65, 0xa3, 0xa0,
+	0x2b, 0x45, 0x88, 0xeb, 0xdc, 0x6b, 0x10, 0xd2, 0xad, 0x90, 0xda, 0xdd, 0x25, 0xb0, 0xab, 0xb2,
+	0x4b, 0x39, 0xd9, 0x3f, 0x2d, 0x55, 0x15, 0x39, 0xd9, 0x83, 0x63, 0x91, 0xd8, 0xc6, 0x3e, 0x66,
+	0xc9, 0x6b, 0xfb, 0x5e, 0xa1, 0x7e, 0x84, 0x7e, 0x8a, 0x7e, 0x04, 0xde, 0xca, 0x63, 0xc5, 0x03,
+	0x6a, 0xe1, 0x8b, 0x54, 0xe7, 0x8f, 0x13, 0x7b, 0xbb, 0x40, 0x29, 0xbc, 0xac, 0xce, 0xcc, 0x6f,
+	0x66, 0xce, 0x9c, 0xf9, 0xcd, 0x4c, 0xbc, 0x70, 0x31, 0xa6, 0x41, 0x44, 0xba, 0xfc, 0x6f, 0x38,
+	0xec, 0x46, 0xe1, 0xc8, 0x0a, 0xa3, 0x80, 0x06, 0xa8, 0x44, 0xc7, 0x8e, 0x1f, 0xc4, 0x8d, 0xb5,
+	0xbc, 0x01, 0x9d, 0x85, 0x24, 0x16, 0x26, 0x8d, 0xba, 0x1b, 0xb8, 0x01, 0x3f, 0x76, 0xd9, 0x49,
+	0x6a, 0x5b, 0x79, 0x87, 0x30, 0x0a, 0xa6, 0xa7, 0xfc, 0x2e, 0xe7, 0x2d, 0x4e, 0x22, 0x8f, 0x92,
+	0x27, 0xf6, 0x29, 0x23, 0x79, 0xef, 0xc4, 0x19, 0x92, 0xc9, 0x69, 0xc8, 0x0d, 0x02, 0x77, 0x42,
+	0xba, 0x5c, 0x1a, 0x26, 0x0f, 0xbb, 0x8e, 0x3f, 0x13, 0x50, 0xfb, 0x5f, 0xb0, 0x7c, 0xc4, 0xc2,
+	0x61, 0x12, 0x87, 0x81, 0x1f, 0x93, 0xf6, 0x0f, 0x0a, 0x2c, 0x49, 0xcd, 0xe3, 0x84, 0xc4, 0x14,
+	0x6d, 0x00, 0x50, 0x6f, 0x4a, 0x62, 0x12, 0x79, 0x24, 0x36, 0x95, 0x96, 0xd6, 0xa9, 0xd9, 0x97,
+	0x98, 0xf7, 0x94, 0xd0, 0x31, 0x49, 0xe2, 0xc1, 0x28, 0x08, 0x67, 0xd6, 0xbe, 0x37, 0x25, 0x7d,
+	0x6e, 0xb2, 0x59, 0x7c, 0xfe, 0x6a, 0xbd, 0x80, 0x33, 0x4e, 0x68, 0x15, 0x4a, 0x94, 0xf8, 0x8e,
+	0x4f, 0x4d, 0xb5, 0xa5, 0x74, 0xaa, 0x58, 0x4a, 0xc8, 0x84, 0x72, 0x44, 0xc2, 0x89, 0x37, 0x72,
+	0x4c, 0xad, 0xa5, 0x74, 0x34, 0x9c, 0x8a, 0x2c, 0x8b, 0x95, 0x6c, 0x16, 0x87, 0x36, 0xfa, 0x9c,
+	0x19, 0x73, 0xc1, 0x54, 0x5a, 0x4a, 0xa7, 0x66, 0xaf, 0x5b, 0x5e, 0x90, 0xc9, 0xc3, 0xe2, 0x65,
+	0xb1, 0x9e, 0xd8, 0x96, 0xf4, 0x91, 0x89, 0xa4, 0x5e, 0xff, 0x20, 0x8b, 0x65, 0xa8, 0xed, 0xf8,
+	0x0f, 0x03, 0x19, 0xaf, 0xfd, 0x93, 0x0a, 0x4b, 0x42, 0x16, 0xb5, 0x42, 0x23, 0x28, 0xf1, 0x72,
+	0xa7, 0x65, 0x59, 0xb6, 0x44, 0x0f, 0x58, 0x77, 0x99, 0x76, 0xf3, 0x26, 0xbb, 0xff, 0xe5, 0xab,
+	0xf5, 0xeb, 0xae, 0x47, 0xc7, 0xc9, 0xd0, 0x1a, 0x05, 0xd3, 0xae, 0x30, 0xf8, 0x8f, 0x17, 0xc8,
+	0x53, 0x37, 0x7c, 0xe4, 0x76, 0x73, 0xcc, 0x59, 0x0f, 0xb8, 0x37, 0x96, 0xa1, 0xd1, 0x1a, 0x54,
+	0xa6, 0x9e, 0x3f, 0x60, 0xe5, 0xe4, 0x89, 0x6b, 0xb8, 0x3c, 0xf5, 0x7c, 0x56, 0x6f, 0x0e, 0x39,
+	0x4f, 0x05, 0x24, 0x53, 0x9f, 0x3a, 0x4f, 0x39, 0xd4, 0x85, 0x2a, 0x8f, 0xba, 0x3f, 0x0b, 0x89,
+	0x59, 0x6c, 0x29, 0x9d, 0x15, 0xfb, 0x5c, 0x9a, 0x5d, 0x3f, 0x05, 0xf0, 0xc2, 0x06, 0xdd, 0x00,
+	0xe0, 0x17, 0x0e, 0x62, 0x42, 0x63, 0x53, 0xe7, 0xef, 0x99, 0x7b, 0x88, 0x94, 0xfa, 0x24, 0xad,
+	0x69, 0x75, 0x22, 0xe5, 0xb8, 0xfd, 0xb2, 0x08, 0xcb, 0x82, 0xf8, 0xb4, 0x61, 0xb2, 0x09, 0x2b,
+	0x6f, 0x4f, 0x58, 0xcd, 0x27, 0x7c, 0x83, 0x41, 0x74, 0x34, 0x26, 0x51, 0x6c, 0x6a, 0xfc, 0xf6,
+	0x7a, 0xae, 0x9a, 0xbb, 0x02, 0x94, 0x09, 0xcc, 0x6d, 0x91, 0x0d, 0x17, 0x58, 0xc8, 0x88, 0xc4,
+	0xc1, 0x24, 0xa1, 0x5e, 0xe0, 0x0f, 0x4e, 0x3c, 0xff, 0x38, 0x38, 0xe1, 0x8f, 0xd6, 0xf0, 0xf9,
+	0xa9, 0xf3, 0x14, 0xcf, 0xb1, 0x23, 0x0e, 0xa1, 0xab, 0x00, 0x8e, 0xeb, 0x46, 0xc4, 0x75, 0x28,
+	0x11, 0x6f, 0x5d, 0xb1, 0x97, 0xd2, 0xdb, 0x36, 0x5c, 0x37, 0xc2, 0x19, 0x1c, 0x7d, 0x06, 0x6b,
+	0xa1, 0x13, 0x51, 0xcf, 0x99, 0x0c, 0x22, 0xc9, 0xfc, 0xe0, 0xd8, 0x8b, 0x9d, 0xe1, 0x84, 0x1c,
+	0x9b, 0xa5, 0x96, 0xd2, 0xa9, 0xe0, 0x8b, 0xd2, 0x20, 0xed, 0x8c, 0x5b, 0x12, 0x46, 0xdf, 0x9e,
+	0xe1, 0x1b, 0xd3, 0xc8, 0xa1, 0xc4, 0x9d, 0x99, 0x65, 0x4e, 0xcb, 0x7a, 0x7a, 0xf1, 0x57, 0xf9,
+	0x18, 0x7d, 0x69, 0xf6, 0x97, 0xe0, 0x29, 0x80, 0xd6, 0xa1, 0x16, 0x3f, 0xf2, 0xc2, 0xc1, 0x68,
+	0x9c, 0xf8, 0x8f, 0x62, 0xb3, 0xc2, 0x53, 0x01, 0xa6, 0xda, 0xe2, 0x1a, 0x74, 0x05, 0xf4, 0xb1,
+	0xe7, 0xd3, 0xd8, 0xac, 0xf2, 0x81, 0xa9, 0x5b, 0x62, 0x0f, 0x58, 0xe9, 0x1e, 0xb0, 0x36, 0xfc,
+	0x19, 0x16, 0x26, 0x08, 0x41, 0x31, 0xa6, 0x24, 0x34, 0x81, 0x97, 0x8d, 0x9f, 0x51, 0x1d, 0xf4,
+	0xc8, 0xf1, 0x5d, 0x62, 0xd6, 0xb8, 0x52, 0x08, 0xe8, 0x1a, 0xd4, 0x1e, 0x27, 0x24, 0x9a, 0x0d,
+	0x44, 0xec, 0x25, 0x1e, 0x1b, 0xa5, 0xaf, 0xb8, 0xcf, 0xa0, 0x6d, 0x86, 0x60, 0x78, 0x3c, 0x3f,
+	0xa3, 0xeb, 0xb0, 0x7a, 0xe2, 0xd1, 0x71, 0x90, 0xd0, 0x81, 0x9c, 0xae, 0x81, 0x1c, 0x9d, 0xe5,
+	0x96, 0xd6, 0xa9, 0xe2, 0xba, 0x44, 0xb1, 0x00, 0x39, 0xe5, 0x71, 0xfb, 0x67, 0x05, 0x60, 0x11,
+	0x90, 0x3f, 0x98, 0x92, 0x70, 0x30, 0xf5, 0x26, 0x13, 0x2f, 0x96, 0xcd, 0x05, 0x4c, 0xb5, 0xcb,
+	0x35, 0xa8, 0x05, 0xc5, 0x87, 0x89, 0x3f, 0xe2, 0xbd, 0x55, 0x5b, 0x50, 0x7a, 0x3b, 0xf1, 0x47,
+	0x98, 0x23, 0xe8, 0x2a, 0x54, 0xdc, 0x28, 0x48, 0x42, 0xcf, 0x77, 0x79, 0x87, 0xd4, 0x6c, 0x23,
+	0xb5, 0xba, 0x23, 0xf5, 0x78, 0x6e, 0x81, 0x2e, 0xa7, 0x05, 0xd0, 0x5b, 0x4a, 0x76, 0xbe, 0x31,
+	0x53, 0xca, 0x7a, 0xb4, 0x1b, 0x50, 0x64, 0x17, 0xb0, 0x0a, 0xfa, 0x8e, 0xec, 0xf9, 0x2a, 0xe6,
+	0xe7, 0xb6, 0x0d, 0x95, 0x34, 0x2c, 0x5a, 0x01, 0x75, 0x38, 0xe3, 0x68, 0x05, 0xab, 0xc3, 0x19,
+	0xdb, 0x47, 0xb2, 0x04, 0x1a, 0x2f, 0x81, 0x94, 0xda, 0xeb, 0xa0, 0xf3, 0xf8, 0xcc, 0x20, 0xf7,
+	0x52, 0x29, 0xb5, 0x7f, 0x54, 0x60, 0x25, 0x1d, 0x39, 0xb9, 0x89, 0x3a, 0x50, 0x9a, 0x2f, 0x68,
+	0x96, 0xe9, 0xca, 0x7c, 0xd6, 0xb9, 0x76, 0xbb, 0x80, 0x25, 0x8e, 0x1a, 0x50, 0x3e, 0x71, 0x22,
+	0x9f, 0xbd, 0x9f, 0xaf, 0xc1, 0xed, 0x02, 0x4e, 0x15, 0xe8, 0x6a, 0xda, 0x2f, 0xda, 0xdb, 0xfb,
+	0x65, 0xbb, 0x20, 0x3b, 0x66, 0xb3, 0x02, 0xa5, 0x88, 0xc4, 0xc9, 0x84, 0xb6, 0x7f, 0x51, 0xe1,
+	0x1c, 0x67, 0x6c, 0xcf, 0x99, 0x2e, 0xf6, 0xc0, 0x3b, 0xe7, 0x46, 0xf9, 0x88, 0xb9, 0x51, 0x3f,
+	0x72, 0x6e, 0xea, 0xa0, 0xc7, 0xd4, 0x89, 0xa8, 0xdc, 0x99, 0x42, 0x40, 0x06, 0x68, 0xc4, 0x3f,
+	0x96, 0x6b, 0x83, 0x1d, 0x17, 0xe3, 0xa3, 0xbf, 0x7f, 0x7c, 0xb2, 0xeb, 0xab, 0xf4, 0xf7, 0xd7,
+	0x57, 0x3b, 0x02, 0x94, 0xad, 0x9c, 0xa4, 0xb3, 0x0e, 0x3a, 0x6b, 0x1f, 0xf1, 0xbb, 0x52, 0xc5,
+	0x42, 0x40, 0x0d, 0xa8, 0x48, 0xa6, 0x62, 0x53, 0xe5, 0xc0, 0x5c, 0x5e, 0xe4, 0xaa, 0xbd, 0x37,
+	0xd7, 0xf6, 0xaf, 0xaa, 0xbc, 0xf4, 0xd0, 0x99, 0x24, 0x0b, 0xbe, 0xea, 0xa0, 0xf3, 0x0e, 0x94,
+	0x0d, 0x2c, 0x84, 0x77, 0xb3, 0xa8, 0x7e, 0x04, 0x8b, 0xda, 0xa7, 0x62, 0xb1, 0x78, 0x06, 0x8b,
+	0xfa, 0x19, 0x2c, 0x96, 0x3e, 0x8c, 0xc5, 0xf2, 0x07, 0xb0, 0x98, 0xc0, 0xf9, 0x5c, 0x41, 0x25,
+	0x8d, 0xab, 0x50, 0x7a, 0xc2, 0x35, 0x92, 0x47, 0x29, 0x7d, 0x2a, 0x22, 0xaf, 0x7c, 0x07, 0xd5,
+	0xf9, 0x6f, 0x39, 0xaa, 0x41, 0xf9, 0x60, 0xef, 0xcb, 0xbd, 0x7b, 0x47, 0x7b, 0x46, 0x01, 0x55,
+	0x41, 0xbf, 0x7f, 0xd0, 0xc3, 0xdf, 0x18, 0x0a, 0xaa, 0x40, 0x11, 0x1f, 0xdc, 0xed, 0x19, 0x2a,
+	0xb3, 0xe8, 0xef, 0xdc, 0xea, 0x6d, 0x6d, 0x60, 0x43, 0x63, 0x16, 0xfd, 0xfd, 0x7b, 0xb8, 0x67,
+	0x14, 0x99, 0x1e, 0xf7, 0xb6, 0x7a, 0x3b, 0x87, 0x3d, 0x43, 0x67, 0xfa, 0x5b, 0xbd, 0xcd, 0x83,
+	0x3b, 0x46, 0xe9, 0xca, 0x26, 0x14, 0xd9, 0x8f, 0x21, 0x2a, 0x83, 0x86, 0x37, 0x8e, 0x44, 0xd4,
+	0xad, 0x7b, 0x07, 0x7b, 0xfb, 0x86, 0xc2, 0x74, 0xfd, 0x83, 0x5d, 0x43, 0x65, 0x87, 0xdd, 0x9d,
+	0x3d, 0x43, 0xe3, 0x87, 0x8d, 0xaf, 0x45, 0x38, 0x6e, 0xd5, 0xc3, 0x86, 0x6e, 0x7f, 0xaf, 0x82,
+	0xce, 0x73, 0x44, 0xff, 0x83, 0x22, 0xfb, 0x78, 0x42, 0xe7, 0xd3, 0x8a, 0x66, 0x3e, 0xad, 0x1a,
+	0xf5, 0xbc, 0x52, 0xd6, 0xef, 0xff, 0x50, 0x12, 0xfb, 0x0b, 0x5d, 0xc8, 0xef, 0xb3, 0xd4, 0x6d,
+	0xf5, 0xb4, 0x5a, 0x38, 0xfe, 0x57, 0x41, 0x5b, 0x00, 0x8b, 0xb9, 0x42, 0x6b, 0x39, 0x16, 0xb3,
+	0x5b, 0xaa, 0xd1, 0x38, 0x0b, 0x92, 0xf7, 0xdf, 0x86, 0x5a, 0x86, 0x56, 0x94, 0x37, 0xcd, 0x0d,
+	0x4f, 0xe3, 0xd2, 0x99, 0x98, 0x88, 0x63, 0x3f, 0x4b, 0xbf, 0x66, 0xd9, 0x58, 0x88, 0x6a, 0xdc,
+	0x84, 0x1a, 0x26, 0xd3, 0x80, 0x12, 0xae, 0x47, 0xf3, 0xf7, 0x67, 0x3f, 0x7a, 0x1b, 0x17, 0x4e,
+	0x69, 0xe5, 0x27, 0x7a, 0x01, 0x7d, 0x01, 0xcb, 0x19, 0xef, 0x43, 0x1b, 0xad, 0x9e, 0xe5, 0x7f,
+	0x68, 0xbf, 0x35, 0xc2, 0xe6, 0xbf, 0x9f, 0xff, 0xd1, 0x2c, 0x3c, 0x7f, 0xdd, 0x54, 0x5e, 0xbc,
+	0x6e, 0x2a, 0xbf, 0xbf, 0x6e, 0x2a, 0xcf, 0xde, 0x34, 0x0b, 0x2f, 0xde, 0x34, 0x0b, 0xbf, 0xbd,
+	0x69, 0x16, 0x1e, 0x94, 0xe5, 0xbf, 0x1a, 0xc3, 0x12, 0x6f, 0xbb, 0x6b, 0x7f, 0x0e, 0x00, 0x64,
+	0x70, 0xc4, 0xd1, 0xf6, 0x0c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1109,6 +1160,9 @@ var _Store_serviceDesc = grpc.ServiceDesc{
 type WriteableStoreClient interface {
 	// WriteRequest allows you to write metrics to this store via remote write
 	RemoteWrite(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	// RemoteWriteV2 is like RemoteWrite, but the time series are encoded with the
+	// Remote Write 2.0 protocol, which interns all label names and values.
+	RemoteWriteV2(ctx context.Context, in *WriteRequestV2, opts ...grpc.CallOption) (*WriteResponse, error)
 }
 
 type writeableStoreClient struct {
@@ -1128,10 +1182,22 @@ func (c *writeableStoreClient) RemoteWrite(ctx context.Context, in *WriteRequest
 	return out, nil
 }
 
+func (c *writeableStoreClient) RemoteWriteV2(ctx context.Context, in *WriteRequestV2, opts ...grpc.CallOption) (*WriteResponse, error) {
+	out := new(WriteResponse)
+	err := c.cc.Invoke(ctx, "/thanos.WriteableStore/RemoteWriteV2", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WriteableStoreServer is the server API for WriteableStore service.
 type WriteableStoreServer interface {
 	// WriteRequest allows you to write metrics to this store via remote write
 	RemoteWrite(context.Context, *WriteRequest) (*WriteResponse, error)
+	// RemoteWriteV2 is like RemoteWrite, but the time series are encoded with the
+	// Remote Write 2.0 protocol, which interns all label names and values.
+	RemoteWriteV2(context.Context, *WriteRequestV2) (*WriteResponse, error)
 }
 
 // UnimplementedWriteableStoreServer can be embedded to have forward compatible implementations.
@@ -1141,6 +1207,9 @@ type UnimplementedWriteableStoreServer struct {
 func (*UnimplementedWriteableStoreServer) RemoteWrite(ctx context.Context, req *WriteRequest) (*WriteResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoteWrite not implemented")
 }
+func (*UnimplementedWriteableStoreServer) RemoteWriteV2(ctx context.Context, req *WriteRequestV2) (*WriteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoteWriteV2 not implemented")
+}
 
 func RegisterWriteableStoreServer(s *grpc.Server, srv WriteableStoreServer) {
 	s.RegisterService(&_WriteableStore_serviceDesc, srv)
@@ -1164,6 +1233,24 @@ func _WriteableStore_RemoteWrite_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WriteableStore_RemoteWriteV2_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequestV2)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WriteableStoreServer).RemoteWriteV2(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thanos.WriteableStore/RemoteWriteV2",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WriteableStoreServer).RemoteWriteV2(ctx, req.(*WriteRequestV2))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _WriteableStore_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "thanos.WriteableStore",
 	HandlerType: (*WriteableStoreServer)(nil),
@@ -1172,6 +1259,10 @@ var _WriteableStore_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RemoteWrite",
 			Handler:    _WriteableStore_RemoteWrite_Handler,
 		},
+		{
+			MethodName: "RemoteWriteV2",
+			Handler:    _WriteableStore_RemoteWriteV2_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "store/storepb/rpc.proto",
@@ -1249,6 +1340,51 @@ func (m *WriteRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *WriteRequestV2) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *WriteRequestV2) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *WriteRequestV2) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Replica != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Replica))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Tenant) > 0 {
+		i -= len(m.Tenant)
+		copy(dAtA[i:], m.Tenant)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Tenant)))
+		i--
+		dAtA[i] = 0x12
+	}
+	{
+		size, err := m.Request.MarshalToSizedBuffer(dAtA[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarintRpc(dAtA, i, uint64(size))
+	}
+	i--
+	dAtA[i] = 0xa
+	return len(dAtA) - i, nil
+}
+
 func (m *InfoRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1358,6 +1494,15 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.WithoutReplicaLabels) > 0 {
+		for iNdEx := len(m.WithoutReplicaLabels) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.WithoutReplicaLabels[iNdEx])
+			copy(dAtA[i:], m.WithoutReplicaLabels[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.WithoutReplicaLabels[iNdEx])))
+			i--
+			dAtA[i] = 0x6a
+		}
+	}
 	if m.QueryHints != nil {
 		{
 			size, err := m.QueryHints.MarshalToSizedBuffer(dAtA[:i])
@@ -1418,20 +1563,20 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		dAtA[i] = 0x30
 	}
 	if len(m.Aggregates) > 0 {
-		dAtA4 := make([]byte, len(m.Aggregates)*10)
-		var j3 int
+		dAtA5 := make([]byte, len(m.Aggregates)*10)
+		var j4 int
 		for _, num := range m.Aggregates {
 			for num >= 1<<7 {
-				dAtA4[j3] = uint8(uint64(num)&0x7f | 0x80)
+				dAtA5[j4] = uint8(uint64(num)&0x7f | 0x80)
 				num >>= 7
-				j3++
+				j4++
 			}
-			dAtA4[j3] = uint8(num)
-			j3++
+			dAtA5[j4] = uint8(num)
+			j4++
 		}
-		i -= j3
-		copy(dAtA[i:], dAtA4[:j3])
-		i = encodeVarintRpc(dAtA, i, uint64(j3))
+		i -= j4
+		copy(dAtA[i:], dAtA5[:j4])
+		i = encodeVarintRpc(dAtA, i, uint64(j4))
 		i--
 		dAtA[i] = 0x2a
 	}
@@ -2022,6 +2167,24 @@ func (m *WriteRequest) Size() (n int) {
 	return n
 }
 
+func (m *WriteRequestV2) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = m.Request.Size()
+	n += 1 + l + sovRpc(uint64(l))
+	l = len(m.Tenant)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.Replica != 0 {
+		n += 1 + sovRpc(uint64(m.Replica))
+	}
+	return n
+}
+
 func (m *InfoRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -2112,6 +2275,12 @@ func (m *SeriesRequest) Size() (n int) {
 		l = m.QueryHints.Size()
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if len(m.WithoutReplicaLabels) > 0 {
+		for _, s := range m.WithoutReplicaLabels {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -2535,6 +2704,140 @@ func (m *WriteRequest) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *WriteRequestV2) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: WriteRequestV2: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: WriteRequestV2: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Request", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Request.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Tenant", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Tenant = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Replica", wireType)
+			}
+			m.Replica = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Replica |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *InfoRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -3118,6 +3421,38 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 13:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WithoutReplicaLabels", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.WithoutReplicaLabels = append(m.WithoutReplicaLabels, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -0,0 +1,76 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package writev2pb
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+)
+
+// SymbolsTable builds the de-duplicated Request.Symbols array and returns references into it.
+type SymbolsTable struct {
+	symbols    []string
+	symbolsMap map[string]uint32
+}
+
+// NewSymbolTable returns a symbols table. As required by the specification, the first symbol is an empty string.
+func NewSymbolTable() SymbolsTable {
+	return SymbolsTable{
+		symbols:    []string{""},
+		symbolsMap: map[string]uint32{"": 0},
+	}
+}
+
+// Symbolize returns the reference of the given string, adding it to the table if needed.
+func (t *SymbolsTable) Symbolize(str string) uint32 {
+	if ref, ok := t.symbolsMap[str]; ok {
+		return ref
+	}
+	ref := uint32(len(t.symbols))
+	t.symbols = append(t.symbols, str)
+	t.symbolsMap[str] = ref
+	return ref
+}
+
+// SymbolizeLabels appends the references of the given labels to buf and returns it.
+func (t *SymbolsTable) SymbolizeLabels(lbls []labelpb.ZLabel, buf []uint32) []uint32 {
+	for _, l := range lbls {
+		buf = append(buf, t.Symbolize(l.Name), t.Symbolize(l.Value))
+	}
+	return buf
+}
+
+// Symbols returns all symbols added so far.
+func (t *SymbolsTable) Symbols() []string {
+	return t.symbols
+}
+
+// Symbol returns the string the given reference points to.
+func Symbol(symbols []string, ref uint32) (string, error) {
+	if int(ref) >= len(symbols) {
+		return "", errors.Errorf("symbol reference %d out of range of %d symbols", ref, len(symbols))
+	}
+	return symbols[ref], nil
+}
+
+// DesymbolizeLabels returns the labels the given name-value pair references point to.
+func DesymbolizeLabels(refs []uint32, symbols []string) ([]labelpb.ZLabel, error) {
+	if len(refs)%2 != 0 {
+		return nil, errors.Errorf("odd number of label references %d", len(refs))
+	}
+	lbls := make([]labelpb.ZLabel, 0, len(refs)/2)
+	for i := 0; i < len(refs); i += 2 {
+		name, err := Symbol(symbols, refs[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := Symbol(symbols, refs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		lbls = append(lbls, labelpb.ZLabel{Name: name, Value: value})
+	}
+	return lbls, nil
+}
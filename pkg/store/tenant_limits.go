@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/model"
+)
+
+// defaultTenant is the tenant the blocks without the tenant label are accounted to. It is the default tenant of the
+// receivers, so that their blocks and the unlabeled ones share the same limits.
+const defaultTenant = "default-tenant"
+
+// TenantLimitConfig are the limits of the data touched by a single Series call in the blocks of a tenant.
+type TenantLimitConfig struct {
+	// MaxSeries is the maximum number of series touched, 0 means no limit.
+	MaxSeries uint64 `yaml:"max_series"`
+	// MaxChunks is the maximum number of chunks fetched, 0 means no limit.
+	MaxChunks uint64 `yaml:"max_chunks"`
+	// MaxBytesTouched is the maximum size of the postings, series and chunks touched, 0 means no limit.
+	MaxBytesTouched model.Bytes `yaml:"max_bytes_touched"`
+}
+
+// TenantLimitsConfig configures the limits of the tenants of a store gateway.
+type TenantLimitsConfig struct {
+	// Default are the limits of the tenants without their own limits.
+	Default TenantLimitConfig `yaml:"default"`
+	// Tenants are the limits of the tenants, by tenant label value. They replace the default limits as a whole. The
+	// blocks without the tenant label are the ones of the default-tenant tenant.
+	Tenants map[string]TenantLimitConfig `yaml:"tenants"`
+}
+
+// TenantLimits are the limits each Series call enforces per tenant, in addition to its overall limits. The tenant of a
+// block is the value of its tenant external label.
+type TenantLimits struct {
+	tenantLabel string
+	conf        TenantLimitsConfig
+}
+
+// ParseTenantLimitsConfig parses the YAML tenant limits configuration of the tenants identified by the given external
+// label.
+func ParseTenantLimitsConfig(tenantLabel string, content []byte) (*TenantLimits, error) {
+	if tenantLabel == "" {
+		return nil, errors.New("tenant label must not be empty")
+	}
+	var conf TenantLimitsConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parse tenant limits config")
+	}
+	return &TenantLimits{tenantLabel: tenantLabel, conf: conf}, nil
+}
+
+func (l *TenantLimits) tenantOf(extLset labels.Labels) (string, TenantLimitConfig) {
+	tenant := extLset.Get(l.tenantLabel)
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	if conf, ok := l.conf.Tenants[tenant]; ok {
+		return tenant, conf
+	}
+	return tenant, l.conf.Default
+}
+
+// tenantLimiters are the limiters of the tenants of the blocks touched by a single Series call. They are not
+// goroutine safe, their tenantLimiter are.
+type tenantLimiters struct {
+	limits  *TenantLimits
+	dropped *prometheus.CounterVec
+	tenants map[string]*tenantLimiter
+}
+
+// newTenantLimiters returns the limiters of a Series call, nil if there are no tenant limits.
+func newTenantLimiters(limits *TenantLimits, dropped *prometheus.CounterVec) *tenantLimiters {
+	if limits == nil {
+		return nil
+	}
+	return &tenantLimiters{limits: limits, dropped: dropped, tenants: map[string]*tenantLimiter{}}
+}
+
+// forBlock returns the limiter of the tenant of the block with the given external labels, shared by all the blocks of
+// the tenant.
+func (t *tenantLimiters) forBlock(extLset labels.Labels) *tenantLimiter {
+	if t == nil {
+		return nil
+	}
+	tenant, conf := t.limits.tenantOf(extLset)
+	if l, ok := t.tenants[tenant]; ok {
+		return l
+	}
+	l := &tenantLimiter{
+		series: tenantLimit{Limiter: NewLimiter(conf.MaxSeries, t.dropped.WithLabelValues(tenant, "series")), tenant: tenant, kind: "series"},
+		chunks: tenantLimit{Limiter: NewLimiter(conf.MaxChunks, t.dropped.WithLabelValues(tenant, "chunks")), tenant: tenant, kind: "chunks"},
+		bytes:  tenantLimit{Limiter: NewLimiter(uint64(conf.MaxBytesTouched), t.dropped.WithLabelValues(tenant, "bytes")), tenant: tenant, kind: "bytes touched"},
+	}
+	t.tenants[tenant] = l
+	return l
+}
+
+// tenantLimiter enforces the limits of a tenant. A nil tenantLimiter enforces no limit.
+type tenantLimiter struct {
+	series, chunks, bytes tenantLimit
+}
+
+// seriesLimiter returns a limiter reserving the series in both the given limiter and the one of the tenant.
+func (l *tenantLimiter) seriesLimiter(limiter SeriesLimiter) SeriesLimiter {
+	if l == nil {
+		return limiter
+	}
+	return multiLimiter{limiter, l.series}
+}
+
+// chunksLimiter returns a limiter reserving the chunks in both the given limiter and the one of the tenant.
+func (l *tenantLimiter) chunksLimiter(limiter ChunksLimiter) ChunksLimiter {
+	if l == nil {
+		return limiter
+	}
+	return multiLimiter{limiter, l.chunks}
+}
+
+// reserveBytes reserves the size of the data touched in a block of the tenant.
+func (l *tenantLimiter) reserveBytes(stats *queryStats) error {
+	if l == nil {
+		return nil
+	}
+	return l.bytes.Reserve(uint64(stats.PostingsTouchedSizeSum + stats.SeriesTouchedSizeSum + stats.ChunksTouchedSizeSum))
+}
+
+// tenantLimit is a limit of a tenant, whose violations are ResourceExhausted errors naming the tenant and the limit.
+type tenantLimit struct {
+	*Limiter
+	tenant, kind string
+}
+
+func (l tenantLimit) Reserve(num uint64) error {
+	if err := l.Limiter.Reserve(num); err != nil {
+		return status.Errorf(codes.ResourceExhausted, "tenant %s exceeded %s limit: %v", l.tenant, l.kind, err)
+	}
+	return nil
+}
+
+// multiLimiter reserves in all of its limiters, until one of them fails.
+type multiLimiter []interface{ Reserve(num uint64) error }
+
+func (m multiLimiter) Reserve(num uint64) error {
+	for _, l := range m {
+		if err := l.Reserve(num); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseTenantLimitsConfig(t *testing.T) {
+	limits, err := ParseTenantLimitsConfig("tenant_id", []byte(`
+default:
+  max_series: 100
+tenants:
+  team-a:
+    max_chunks: 10
+    max_bytes_touched: 1MiB
+`))
+	testutil.Ok(t, err)
+
+	tenant, conf := limits.tenantOf(labels.FromStrings("tenant_id", "team-a"))
+	testutil.Equals(t, "team-a", tenant)
+	testutil.Equals(t, TenantLimitConfig{MaxChunks: 10, MaxBytesTouched: 1024 * 1024}, conf)
+	tenant, conf = limits.tenantOf(labels.FromStrings("tenant_id", "team-b"))
+	testutil.Equals(t, "team-b", tenant)
+	testutil.Equals(t, TenantLimitConfig{MaxSeries: 100}, conf)
+	tenant, conf = limits.tenantOf(labels.FromStrings("replica", "a"))
+	testutil.Equals(t, defaultTenant, tenant)
+	testutil.Equals(t, TenantLimitConfig{MaxSeries: 100}, conf)
+
+	_, err = ParseTenantLimitsConfig("", []byte(`default: {max_series: 1}`))
+	testutil.NotOk(t, err)
+	_, err = ParseTenantLimitsConfig("tenant_id", []byte(`default: {max_samples: 1}`))
+	testutil.NotOk(t, err)
+}
@@ -270,7 +270,8 @@ func (s *TSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesReque
 		return &storepb.LabelValuesResponse{Values: nil}, nil
 	}
 
-	if v := s.extLset.Get(r.Label); v != "" {
+	v := s.extLset.Get(r.Label)
+	if v != "" && len(matchers) == 0 {
 		return &storepb.LabelValuesResponse{Values: []string{v}}, nil
 	}
 
@@ -280,6 +281,18 @@ func (s *TSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesReque
 	}
 	defer runutil.CloseWithLogOnErr(s.logger, q, "close tsdb querier label values")
 
+	// The value of an external label is only returned if some series match the other matchers.
+	if v != "" {
+		names, _, err := q.LabelNames(matchers...)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if len(names) == 0 {
+			return &storepb.LabelValuesResponse{Values: nil}, nil
+		}
+		return &storepb.LabelValuesResponse{Values: []string{v}}, nil
+	}
+
 	res, _, err := q.LabelValues(r.Label, matchers...)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
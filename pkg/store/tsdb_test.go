@@ -190,7 +190,7 @@ func TestTSDBStore_Series(t *testing.T) {
 
 func TestTSDBStore_LabelAPIs(t *testing.T) {
 	t.Cleanup(func() { testutil.TolerantVerifyLeak(t) })
-	testLabelAPIs(t, func(extLset labels.Labels, appendFn func(app storage.Appender)) storepb.StoreServer {
+	testLabelAPIs(t, func(t *testing.T, extLset labels.Labels, appendFn func(app storage.Appender)) storepb.StoreServer {
 		db, err := e2eutil.NewTSDB()
 		testutil.Ok(t, err)
 		t.Cleanup(func() { testutil.Ok(t, db.Close()) })
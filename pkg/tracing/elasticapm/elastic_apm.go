@@ -4,12 +4,16 @@
 package elasticapm
 
 import (
+	"crypto/rand"
+	"fmt"
 	"io"
 
 	"github.com/opentracing/opentracing-go"
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/module/apmot"
 	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 func init() {
@@ -37,7 +41,47 @@ func NewTracer(conf []byte) (opentracing.Tracer, io.Closer, error) {
 		return nil, nil, err
 	}
 	tracer.SetSampler(apm.NewRatioSampler(config.SampleRate))
-	return apmot.New(apmot.WithTracer(tracer)), tracerCloser{tracer}, nil
+	return &forceTracer{Tracer: apmot.New(apmot.WithTracer(tracer))}, tracerCloser{tracer}, nil
+}
+
+// forceTracer samples the spans started with the migration.ForceTracingAttributeKey tag, as the Elastic APM
+// sampler is not aware of span tags.
+type forceTracer struct {
+	opentracing.Tracer
+}
+
+func (t *forceTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	sso := opentracing.StartSpanOptions{}
+	for _, o := range opts {
+		o.Apply(&sso)
+	}
+	// Spans with a parent inherit its sampling decision.
+	if _, ok := sso.Tags[migration.ForceTracingAttributeKey]; ok && len(sso.References) == 0 {
+		if parent, err := t.sampledParent(); err == nil {
+			opts = append(opts, opentracing.ChildOf(parent))
+		}
+	}
+	return t.Tracer.StartSpan(operationName, opts...)
+}
+
+// sampledParent returns the context of a new sampled trace, which is the only way to make the Elastic APM tracer
+// sample a transaction regardless of its sampler.
+func (t *forceTracer) sampledParent() (opentracing.SpanContext, error) {
+	var id [24]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	return t.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier{
+		"Traceparent": []string{fmt.Sprintf("00-%x-%x-01", id[:16], id[16:])},
+	})
+}
+
+// GetTraceIDFromSpanContext return TraceID from span.Context, if the span is sampled.
+func (t *forceTracer) GetTraceIDFromSpanContext(ctx opentracing.SpanContext) (string, bool) {
+	if c, ok := ctx.(interface{ TraceContext() apm.TraceContext }); ok && c.TraceContext().Options.Recorded() {
+		return c.TraceContext().Trace.String(), true
+	}
+	return "", false
 }
 
 type tracerCloser struct {
@@ -5,40 +5,75 @@ package tracing
 
 import (
 	"context"
+	"strings"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tracing"
 	opentracing "github.com/opentracing/opentracing-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
+// forceTracingMetadataKey is the gRPC metadata key propagating forced tracing to downstream components.
+var forceTracingMetadataKey = strings.ToLower(ForceTracingBaggageKey)
+
 // UnaryClientInterceptor returns a new unary client interceptor for OpenTracing.
 func UnaryClientInterceptor(tracer opentracing.Tracer) grpc.UnaryClientInterceptor {
-	return grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(tracer))
+	interceptor := grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(tracer))
+	return func(parentCtx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return interceptor(outgoingForcedTracing(parentCtx), method, req, reply, cc, invoker, opts...)
+	}
 }
 
 // StreamClientInterceptor returns a new streaming client interceptor for OpenTracing.
 func StreamClientInterceptor(tracer opentracing.Tracer) grpc.StreamClientInterceptor {
-	return grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(tracer))
+	interceptor := grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(tracer))
+	return func(parentCtx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return interceptor(outgoingForcedTracing(parentCtx), desc, cc, method, streamer, opts...)
+	}
 }
 
 // UnaryServerInterceptor returns a new unary server interceptor for OpenTracing and injects given tracer.
 func UnaryServerInterceptor(tracer opentracing.Tracer) grpc.UnaryServerInterceptor {
 	interceptor := grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(tracer))
+	forcingInterceptor := grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(forcingTracer{Tracer: tracer}))
 	return func(parentCtx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		// Add our own tracer.
-		return interceptor(ContextWithTracer(parentCtx, tracer), req, info, handler)
+		ctx := ContextWithTracer(parentCtx, tracer)
+		if incomingForcedTracing(ctx) {
+			return forcingInterceptor(ContextWithForcedTracing(ctx), req, info, handler)
+		}
+		return interceptor(ctx, req, info, handler)
 	}
 }
 
 // StreamServerInterceptor returns a new streaming server interceptor for OpenTracing and injects given tracer.
 func StreamServerInterceptor(tracer opentracing.Tracer) grpc.StreamServerInterceptor {
 	interceptor := grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(tracer))
+	forcingInterceptor := grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(forcingTracer{Tracer: tracer}))
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		// Add our own tracer.
 		wrappedStream := grpc_middleware.WrapServerStream(stream)
 		wrappedStream.WrappedContext = ContextWithTracer(stream.Context(), tracer)
 
+		if incomingForcedTracing(wrappedStream.WrappedContext) {
+			wrappedStream.WrappedContext = ContextWithForcedTracing(wrappedStream.WrappedContext)
+			return forcingInterceptor(srv, wrappedStream, info, handler)
+		}
 		return interceptor(srv, wrappedStream, info, handler)
 	}
 }
+
+// outgoingForcedTracing propagates forced tracing of the request with the gRPC metadata of the outgoing context.
+func outgoingForcedTracing(ctx context.Context) context.Context {
+	if !IsTracingForced(ctx) {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, forceTracingMetadataKey, "true")
+}
+
+// incomingForcedTracing returns true if the gRPC metadata of the incoming context forces tracing of the request.
+func incomingForcedTracing(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(forceTracingMetadataKey)) > 0
+}
@@ -0,0 +1,116 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package tracing_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
+)
+
+type forcedTracingStoreServer struct {
+	storepb.UnimplementedStoreServer
+
+	infoForced, seriesForced bool
+}
+
+func (s *forcedTracingStoreServer) Info(ctx context.Context, _ *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	s.infoForced = tracing.IsTracingForced(ctx)
+	return &storepb.InfoResponse{}, nil
+}
+
+func (s *forcedTracingStoreServer) Series(_ *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.seriesForced = tracing.IsTracingForced(srv.Context())
+	return nil
+}
+
+func TestForcedTracingPropagation(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	tracer := mocktracer.New()
+
+	store := &forcedTracingStoreServer{}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(tracing.UnaryServerInterceptor(tracer)),
+		grpc.StreamInterceptor(tracing.StreamServerInterceptor(tracer)),
+	)
+	storepb.RegisterStoreServer(srv, store)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor(tracer)),
+		grpc.WithStreamInterceptor(tracing.StreamClientInterceptor(tracer)),
+	)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, conn.Close()) }()
+	client := storepb.NewStoreClient(conn)
+
+	handler := tracing.HTTPMiddleware(tracer, "query", log.NewNopLogger(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := client.Info(r.Context(), &storepb.InfoRequest{})
+		testutil.Ok(t, err)
+
+		series, err := client.Series(r.Context(), &storepb.SeriesRequest{})
+		testutil.Ok(t, err)
+		_, err = series.Recv()
+		testutil.Equals(t, io.EOF, err)
+	}))
+
+	for _, tcase := range []struct {
+		name   string
+		header string
+	}{
+		{name: "not forced"},
+		{name: "forced", header: "true"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			tracer.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			if tcase.header != "" {
+				req.Header.Set(tracing.ForceTracingBaggageKey, tcase.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			forced := tcase.header != ""
+			testutil.Equals(t, forced, store.infoForced)
+			testutil.Equals(t, forced, store.seriesForced)
+
+			// Client spans inherit the sampling of their parent, only the server spans need to be forced.
+			var serverSpans []string
+			for _, s := range tracer.FinishedSpans() {
+				if s.Tag("span.kind") != ext.SpanKindRPCServerEnum {
+					continue
+				}
+				serverSpans = append(serverSpans, s.OperationName)
+				if forced {
+					testutil.Equals(t, "true", s.Tag(migration.ForceTracingAttributeKey))
+					testutil.Equals(t, uint16(1), s.Tag(string(ext.SamplingPriority)))
+					continue
+				}
+				testutil.Equals(t, nil, s.Tag(migration.ForceTracingAttributeKey))
+			}
+			sort.Strings(serverSpans)
+			testutil.Equals(t, []string{"/query HTTP[server]", "/thanos.Store/Info", "/thanos.Store/Series"}, serverSpans)
+		})
+	}
+}
@@ -8,13 +8,11 @@ import (
 	"net"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
-	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 // HTTPMiddleware returns an HTTP handler that injects the given tracer and starts a new server span.
@@ -31,35 +29,26 @@ func HTTPMiddleware(tracer opentracing.Tracer, name string, logger log.Logger, n
 			level.Error(logger).Log("msg", "failed to extract tracer from request", "operationName", operationName, "err", err)
 		}
 
-		opts := []opentracing.StartSpanOption{ext.RPCServerOption(wireContext)}
-		// Check for force tracing header and add it as a tag at the start of span.
-		// This is required for the OpenTelemetry sampler to force tracing.
+		ctx := ContextWithTracer(r.Context(), tracer)
+		spanTracer := tracer
+		// Check for force tracing header and force sampling of the span and of downstream requests.
 		if r.Header.Get(ForceTracingBaggageKey) != "" {
-			opts = append(opts, opentracing.Tag{Key: migration.ForceTracingAttributeKey, Value: "true"})
+			spanTracer = forcingTracer{Tracer: tracer}
+			ctx = ContextWithForcedTracing(ctx)
 		}
 
-		span := tracer.StartSpan(
+		span := spanTracer.StartSpan(
 			operationName,
-			opts...,
+			ext.RPCServerOption(wireContext),
 		)
 		ext.HTTPMethod.Set(span, r.Method)
 		ext.HTTPUrl.Set(span, r.URL.String())
 
-		// If client specified ForceTracingBaggageKey header, ensure span includes it to force tracing.
-		span.SetBaggageItem(strings.ToLower(ForceTracingBaggageKey), r.Header.Get(ForceTracingBaggageKey))
-
-		if t, ok := tracer.(Tracer); ok {
-			if traceID, ok := t.GetTraceIDFromSpanContext(span.Context()); ok {
-				w.Header().Set(traceIDResponseHeader, traceID)
-			}
-		} else {
-			// Alternative to set trace ID header, if bridge tracer is being used.
-			if traceID, ok := migration.GetTraceIDFromBridgeSpan(span); ok {
-				w.Header().Set(traceIDResponseHeader, traceID)
-			}
+		if traceID, ok := traceID(tracer, span); ok {
+			w.Header().Set(traceIDResponseHeader, traceID)
 		}
 
-		next.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(ContextWithTracer(r.Context(), tracer), span)))
+		next.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(ctx, span)))
 		span.Finish()
 	}
 }
@@ -5,6 +5,7 @@ package lightstep
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -34,6 +35,14 @@ type Tracer struct {
 	ctx context.Context
 }
 
+// GetTraceIDFromSpanContext return TraceID from span.Context.
+func (t *Tracer) GetTraceIDFromSpanContext(ctx opentracing.SpanContext) (string, bool) {
+	if c, ok := ctx.(lightstep.SpanContext); ok {
+		return fmt.Sprintf("%016x%016x", c.TraceIDUpper, c.TraceID), true
+	}
+	return "", false
+}
+
 // Close synchronously flushes the Lightstep tracer, then terminates it.
 func (t *Tracer) Close() error {
 	t.Tracer.Close(t.ctx)
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	trace "cloud.google.com/go/trace/apiv1"
 	"github.com/go-kit/log"
@@ -69,9 +70,8 @@ type forceRecorder struct {
 }
 
 // RecordSpan invokes wrapper SpanRecorder only if Sampled field is true or ForceTracingBaggageKey item is set in span's context.
-// NOTE(bplotka): Currently only HTTP supports ForceTracingBaggageKey injection on ForceTracingBaggageKey header existence.
 func (r *forceRecorder) RecordSpan(sp basictracer.RawSpan) {
-	if force := sp.Context.Baggage[tracing.ForceTracingBaggageKey]; force != "" {
+	if force := sp.Context.Baggage[strings.ToLower(tracing.ForceTracingBaggageKey)]; force != "" {
 		sp.Context.Sampled = true
 	}
 
@@ -5,9 +5,12 @@ package tracing
 
 import (
 	"context"
+	"strings"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 const (
@@ -24,9 +27,12 @@ type Tag = opentracing.Tag
 type Tags = opentracing.Tags
 type Span = opentracing.Span
 
-type contextKey struct{}
+type contextKey int
 
-var tracerKey = contextKey{}
+const (
+	tracerKey contextKey = iota
+	forceTracingKey
+)
 
 // Tracer interface to provide GetTraceIDFromSpanContext method.
 type Tracer interface {
@@ -38,6 +44,54 @@ func ContextWithTracer(ctx context.Context, tracer opentracing.Tracer) context.C
 	return context.WithValue(ctx, tracerKey, tracer)
 }
 
+// ContextWithForcedTracing returns a new `context.Context` that marks the request as forced to be traced. gRPC requests with
+// this context propagate it to downstream components, which sample their spans regardless of the configured sampling.
+func ContextWithForcedTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceTracingKey, true)
+}
+
+// IsTracingForced returns true if the request of the given context was forced to be traced, e.g. with the
+// ForceTracingBaggageKey header.
+func IsTracingForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceTracingKey).(bool)
+	return forced
+}
+
+// forcingTracer starts spans which are sampled regardless of the configured sampling.
+type forcingTracer struct {
+	opentracing.Tracer
+}
+
+func (t forcingTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	opts = append(opts,
+		// Honored by the OpenTelemetry sampler and the Elastic APM tracer.
+		opentracing.Tag{Key: migration.ForceTracingAttributeKey, Value: "true"},
+		// Honored by Jaeger.
+		opentracing.Tag{Key: string(ext.SamplingPriority), Value: uint16(1)},
+	)
+	span := t.Tracer.StartSpan(operationName, opts...)
+	// Honored by Stackdriver, for this span and its children.
+	span.SetBaggageItem(strings.ToLower(ForceTracingBaggageKey), "true")
+	return span
+}
+
+// TraceIDFromContext returns the trace ID of the span found within given context, if the configured tracer exposes it.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", false
+	}
+	return traceID(tracerFromContext(ctx), span)
+}
+
+func traceID(tracer opentracing.Tracer, span opentracing.Span) (string, bool) {
+	if t, ok := tracer.(Tracer); ok {
+		return t.GetTraceIDFromSpanContext(span.Context())
+	}
+	// Alternative to get the trace ID, if bridge tracer is being used.
+	return migration.GetTraceIDFromBridgeSpan(span)
+}
+
 // tracerFromContext extracts opentracing.Tracer from the given context.
 func tracerFromContext(ctx context.Context) opentracing.Tracer {
 	val := ctx.Value(tracerKey)
@@ -53,9 +107,21 @@ func CopyTraceContext(trgt, src context.Context) context.Context {
 	if parentSpan := opentracing.SpanFromContext(src); parentSpan != nil {
 		ctx = opentracing.ContextWithSpan(ctx, parentSpan)
 	}
+	if IsTracingForced(src) {
+		ctx = ContextWithForcedTracing(ctx)
+	}
 	return ctx
 }
 
+// SpanFromContext returns the span found within given context or noop span, if none.
+// It allows to tag or log events to the current span, regardless if tracing is configured.
+func SpanFromContext(ctx context.Context) Span {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		return span
+	}
+	return opentracing.NoopTracer{}.StartSpan("")
+}
+
 // StartSpan starts and returns span with `operationName` and hooking as child to a span found within given context if any.
 // It uses opentracing.Tracer propagated in context. If no found, it uses noop tracer without notification.
 func StartSpan(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (Span, context.Context) {
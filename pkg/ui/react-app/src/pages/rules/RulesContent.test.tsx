@@ -0,0 +1,38 @@
+import { RuleGroup, sortGroupsBySlowestRule } from './RulesContent';
+import { Rule } from '../../types/types';
+
+const rule = (name: string, evaluationTime: string): Rule => ({
+  alerts: [],
+  annotations: {},
+  duration: 0,
+  evaluationTime,
+  health: 'ok',
+  labels: {},
+  lastEvaluation: '2023-01-02T15:00:00Z',
+  name,
+  query: 'up',
+  state: 'inactive',
+  type: 'recording',
+});
+
+const group = (name: string, rules: Rule[]): RuleGroup => ({
+  name,
+  file: 'rules.yaml',
+  rules,
+  evaluationTime: '0',
+  lastEvaluation: '2023-01-02T15:00:00Z',
+});
+
+describe('sortGroupsBySlowestRule', () => {
+  it('sorts groups by the evaluation time of their slowest rule', () => {
+    const groups = [
+      group('fast', [rule('a', '0.001'), rule('b', '0.002')]),
+      group('empty', []),
+      group('slow', [rule('c', '0.001'), rule('d', '1.5'), rule('e', '0.01')]),
+      group('medium', [rule('f', '0.5')]),
+    ];
+    expect(sortGroupsBySlowestRule(groups).map((g) => g.name)).toEqual(['slow', 'medium', 'fast', 'empty']);
+    // The groups are not sorted in place.
+    expect(groups[0].name).toEqual('fast');
+  });
+});
@@ -5,12 +5,14 @@ import { UncontrolledAlert, Table, Badge } from 'reactstrap';
 import { formatRelative, createExternalExpressionLink, humanizeDuration, formatDuration } from '../../utils';
 import { Rule } from '../../types/types';
 import { now } from 'moment';
+import Checkbox from '../../components/Checkbox';
+import { useLocalStorage } from '../../hooks/useLocalStorage';
 
 interface RulesContentProps {
   response: APIResponse<RulesMap>;
 }
 
-interface RuleGroup {
+export interface RuleGroup {
   name: string;
   file: string;
   rules: Rule[];
@@ -34,7 +36,16 @@ const GraphExpressionLink: FC<{ expr: string; title: string }> = (props) => {
   );
 };
 
+const slowestRuleEvaluationTime = (g: RuleGroup): number =>
+  g.rules.reduce((slowest, r) => Math.max(slowest, parseFloat(r.evaluationTime) || 0), 0);
+
+// sortGroupsBySlowestRule returns the groups sorted by the evaluation time of their slowest rule, slowest first.
+export const sortGroupsBySlowestRule = (groups: RuleGroup[]): RuleGroup[] =>
+  [...groups].sort((a, b) => slowestRuleEvaluationTime(b) - slowestRuleEvaluationTime(a));
+
 export const RulesContent: FC<RouteComponentProps & RulesContentProps> = ({ response }) => {
+  const [sortBySlowestRule, setSortBySlowestRule] = useLocalStorage('rules-sort-by-slowest-rule', true);
+
   const getBadgeColor = (state: string) => {
     switch (state) {
       case 'ok':
@@ -49,10 +60,17 @@ export const RulesContent: FC<RouteComponentProps & RulesContentProps> = ({ resp
   };
 
   if (response.data) {
-    const groups: RuleGroup[] = response.data.groups;
+    const groups: RuleGroup[] = sortBySlowestRule ? sortGroupsBySlowestRule(response.data.groups) : response.data.groups;
     return (
       <>
         <h2>Rules</h2>
+        <Checkbox
+          id="sort-by-slowest-rule-checkbox"
+          onChange={({ target }) => setSortBySlowestRule(target.checked)}
+          defaultChecked={sortBySlowestRule}
+        >
+          Sort groups by slowest rule
+        </Checkbox>
         {groups.map((g, i) => {
           return (
             <Table bordered key={i}>
@@ -95,4 +95,55 @@ describe('BlockDetails', () => {
     const labels = list.find('li');
     expect(labels).toHaveLength(Object.keys(sampleBlock.thanos.labels).length);
   });
+
+  it('does not render deletion mark details for a block without one', () => {
+    expect(blockDetails.find({ 'data-testid': 'deletion-mark' })).toHaveLength(0);
+  });
+
+  it('renders the deletion mark reason', () => {
+    const markedBlockDetails = mount(
+      <BlockDetails
+        {...defaultProps}
+        deletionMark={{
+          id: sampleBlock.ulid,
+          deletion_time: 1600000000,
+          version: 1,
+          reason: 'retention',
+          source: 'compact/0.28.0',
+        }}
+      />
+    );
+    const div = markedBlockDetails.find({ 'data-testid': 'deletion-mark' });
+    expect(div).toHaveLength(1);
+    expect(div.find('li')).toHaveLength(2);
+    expect(div.find('li').first().text()).toBe('Reason: retention');
+  });
+
+  it('does not render the mark actions of a read-only API', () => {
+    expect(blockDetails.find({ 'data-testid': 'mark-actions' })).toHaveLength(0);
+  });
+
+  it('renders the no-compact mark and the actions removing marks', () => {
+    const markedBlockDetails = mount(
+      <BlockDetails
+        {...defaultProps}
+        readWrite
+        deletionMark={{ id: sampleBlock.ulid, deletion_time: 1600000000, version: 1 }}
+        noCompactMark={{
+          id: sampleBlock.ulid,
+          no_compact_time: 1600000000,
+          version: 1,
+          reason: 'manual',
+          details: 'broken index',
+        }}
+      />
+    );
+    const div = markedBlockDetails.find({ 'data-testid': 'no-compact-mark' });
+    expect(div).toHaveLength(1);
+    expect(div.find('li')).toHaveLength(2);
+    expect(div.find('li').last().text()).toBe('Details: broken index');
+
+    const buttons = markedBlockDetails.find({ 'data-testid': 'mark-actions' }).find('button');
+    expect(buttons.map((b) => b.text())).toEqual(['Remove Deletion Mark', 'Remove No Compaction Mark']);
+  });
 });
@@ -1,5 +1,5 @@
 import React, { FC, useState } from 'react';
-import { Block } from './block';
+import { Block, DeletionMark, NoCompactMark } from './block';
 import styles from './blocks.module.css';
 import moment from 'moment';
 import { Button, Modal, ModalBody, Form, Input, ModalHeader, ModalFooter } from 'reactstrap';
@@ -8,24 +8,35 @@ import { download } from './helpers';
 export interface BlockDetailsProps {
   block: Block | undefined;
   selectBlock: React.Dispatch<React.SetStateAction<Block | undefined>>;
+  deletionMark?: DeletionMark;
+  noCompactMark?: NoCompactMark;
+  // readWrite shows the actions marking and unmarking the block.
+  readWrite?: boolean;
 }
 
-export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock }) => {
+export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock, deletionMark, noCompactMark, readWrite }) => {
   const [modalAction, setModalAction] = useState<string>('');
+  const [modalRemove, setModalRemove] = useState<boolean>(false);
   const [detailValue, setDetailValue] = useState<string | null>(null);
 
-  const submitMarkBlock = async (action: string, ulid: string, detail: string | null) => {
+  const openModal = (action: string, remove: boolean): void => {
+    setModalAction(action);
+    setModalRemove(remove);
+    setDetailValue('');
+  };
+
+  const submitMarkBlock = async (action: string, ulid: string, detail: string | null, remove: boolean) => {
     try {
-      const body = detail
-        ? new URLSearchParams({
-            id: ulid,
-            action,
-            detail,
-          })
-        : new URLSearchParams({
-            id: ulid,
-            action,
-          });
+      const body = new URLSearchParams({
+        id: ulid,
+        action,
+      });
+      if (detail) {
+        body.set('detail', detail);
+      }
+      if (remove) {
+        body.set('remove', 'true');
+      }
 
       const response = await fetch('/api/v1/blocks/mark', {
         method: 'POST',
@@ -94,48 +105,101 @@ export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock }) => {
               ))}
             </ul>
           </div>
+          {deletionMark && (
+            <>
+              <hr />
+              <div data-testid="deletion-mark">
+                <b>Marked for deletion:</b> <span>{moment.unix(deletionMark.deletion_time).format('LLL')}</span>
+                <ul>
+                  <li>
+                    <b>Reason: </b>
+                    {deletionMark.reason || 'unknown'}
+                  </li>
+                  {deletionMark.details && (
+                    <li>
+                      <b>Details: </b>
+                      {deletionMark.details}
+                    </li>
+                  )}
+                  {deletionMark.source && (
+                    <li>
+                      <b>Source: </b>
+                      {deletionMark.source}
+                    </li>
+                  )}
+                  {deletionMark.group && (
+                    <li>
+                      <b>Group: </b>
+                      {deletionMark.group}
+                    </li>
+                  )}
+                </ul>
+              </div>
+            </>
+          )}
+          {noCompactMark && (
+            <>
+              <hr />
+              <div data-testid="no-compact-mark">
+                <b>Marked for no compaction:</b> <span>{moment.unix(noCompactMark.no_compact_time).format('LLL')}</span>
+                <ul>
+                  <li>
+                    <b>Reason: </b>
+                    {noCompactMark.reason || 'unknown'}
+                  </li>
+                  {noCompactMark.details && (
+                    <li>
+                      <b>Details: </b>
+                      {noCompactMark.details}
+                    </li>
+                  )}
+                </ul>
+              </div>
+            </>
+          )}
           <hr />
           <div data-testid="download">
             <a href={download(block)} download="meta.json">
               <Button>Download meta.json</Button>
             </a>
           </div>
-          <div style={{ marginTop: '12px' }}>
-            <Button
-              onClick={() => {
-                setModalAction('DELETION');
-                setDetailValue('');
-              }}
-            >
-              Mark Deletion
-            </Button>
-          </div>
-          <div style={{ marginTop: '12px' }}>
-            <Button
-              onClick={() => {
-                setModalAction('NO_COMPACTION');
-                setDetailValue('');
-              }}
-            >
-              Mark No Compaction
-            </Button>
-          </div>
+          {readWrite && (
+            <div data-testid="mark-actions">
+              <div style={{ marginTop: '12px' }}>
+                <Button onClick={() => openModal('DELETION', !!deletionMark)}>
+                  {deletionMark ? 'Remove Deletion Mark' : 'Mark Deletion'}
+                </Button>
+              </div>
+              <div style={{ marginTop: '12px' }}>
+                <Button onClick={() => openModal('NO_COMPACTION', !!noCompactMark)}>
+                  {noCompactMark ? 'Remove No Compaction Mark' : 'Mark No Compaction'}
+                </Button>
+              </div>
+            </div>
+          )}
           <Modal isOpen={!!modalAction}>
             <ModalBody>
               <ModalHeader toggle={() => setModalAction('')}>
-                Mark {modalAction === 'DELETION' ? 'Deletion' : 'No Compaction'} Detail (Optional)
+                {modalRemove ? 'Remove' : 'Mark'} {modalAction === 'DELETION' ? 'Deletion' : 'No Compaction'}
+                {modalRemove ? ' Mark' : ' Detail (Optional)'}
               </ModalHeader>
               <Form
                 onSubmit={(e) => {
                   e.preventDefault();
-                  submitMarkBlock(modalAction, block.ulid, detailValue);
+                  submitMarkBlock(modalAction, block.ulid, detailValue, modalRemove);
                 }}
               >
-                <Input
-                  placeholder="Reason for marking block..."
-                  style={{ marginBottom: '16px', marginTop: '16px' }}
-                  onChange={(e) => setDetailValue(e.target.value)}
-                />
+                {modalRemove ? (
+                  <p style={{ marginBottom: '16px', marginTop: '16px' }}>
+                    The block will {modalAction === 'DELETION' ? 'no longer be deleted' : 'be compacted again'} once the mark is removed.
+                  </p>
+                ) : (
+                  <Input
+                    placeholder="Reason for marking block..."
+                    style={{ marginBottom: '16px', marginTop: '16px' }}
+                    onChange={(e) => setDetailValue(e.target.value)}
+                  />
+                )}
                 <ModalFooter>
                   <Button color="primary" type="submit">
                     Submit
@@ -0,0 +1,69 @@
+import React, { FC, useState } from 'react';
+import { Button, Form, Input } from 'reactstrap';
+import { BlockFilters } from './block';
+import styles from './blocks.module.css';
+
+interface BlockFiltersFormProps {
+  filters: BlockFilters;
+  onSubmit: (filters: BlockFilters) => void;
+}
+
+export const BlockFiltersForm: FC<BlockFiltersFormProps> = ({ filters, onSubmit }) => {
+  const [state, setState] = useState<BlockFilters>(filters);
+  const setFilter = (name: keyof BlockFilters, value: string): void => setState((prev) => ({ ...prev, [name]: value }));
+
+  return (
+    <Form
+      inline
+      className={styles.blockFilter}
+      onSubmit={(e) => {
+        e.preventDefault();
+        onSubmit(state);
+      }}
+    >
+      <Input
+        data-testid="filter-matchers"
+        placeholder='External labels, e.g. {tenant="foo"}'
+        style={{ width: '320px', marginRight: '8px' }}
+        defaultValue={filters.matchers}
+        onChange={({ target }) => setFilter('matchers', target.value)}
+      />
+      <Input
+        data-testid="filter-resolution"
+        type="select"
+        style={{ marginRight: '8px' }}
+        value={state.resolution}
+        onChange={({ target }) => setFilter('resolution', target.value)}
+      >
+        <option value="">All resolutions</option>
+        <option value="0">Raw</option>
+        <option value="300000">5m</option>
+        <option value="3600000">1h</option>
+      </Input>
+      <Input
+        data-testid="filter-level"
+        type="number"
+        placeholder="Compaction level"
+        style={{ width: '160px', marginRight: '8px' }}
+        min={1}
+        defaultValue={filters.level}
+        onChange={({ target }) => setFilter('level', target.value)}
+      />
+      <Input
+        data-testid="filter-marked"
+        type="select"
+        style={{ marginRight: '8px' }}
+        value={state.marked}
+        onChange={({ target }) => setFilter('marked', target.value)}
+      >
+        <option value="">All marks</option>
+        <option value="deletion">Marked for deletion</option>
+        <option value="no-compact">Marked for no compaction</option>
+        <option value="none">Not marked</option>
+      </Input>
+      <Button color="primary" type="submit">
+        Filter
+      </Button>
+    </Form>
+  );
+};
@@ -81,6 +81,35 @@ describe('Blocks', () => {
     });
   });
 
+  describe('when the bucket has object lock enabled', () => {
+    it('displays an info alert', async () => {
+      fetchMock.mockResponse(
+        JSON.stringify({
+          status: 'success',
+          data: {
+            blocks: [],
+            deletionMode: 'mark-only',
+            objectLock: { enabled: true, mode: 'COMPLIANCE', validity: '30 DAYS' },
+          },
+        })
+      );
+
+      let blocks: any;
+      await act(async () => {
+        blocks = mount(
+          <QueryParamProvider>
+            <Blocks />
+          </QueryParamProvider>
+        );
+      });
+      blocks.update();
+
+      const alert = blocks.find(UncontrolledAlert).filterWhere((a: ReactWrapper) => a.prop('color') === 'info');
+      expect(alert.text()).toContain('Object lock is enabled on the bucket (default retention: COMPLIANCE, 30 DAYS).');
+      expect(alert.text()).toContain('Blocks are kept in the bucket with a tombstone instead of being deleted');
+    });
+  });
+
   describe('when an error is returned', () => {
     it('displays an error alert', async () => {
       const mock = fetchMock.mockReject(new Error('Error fetching blocks'));
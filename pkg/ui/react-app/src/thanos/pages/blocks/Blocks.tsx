@@ -5,12 +5,14 @@ import { useQueryParams, withDefault, NumberParam, StringParam, BooleanParam } f
 import { withStatusIndicator } from '../../../components/withStatusIndicator';
 import { useFetch } from '../../../hooks/useFetch';
 import PathPrefixProps from '../../../types/PathPrefixProps';
-import { Block } from './block';
+import { Block, BlockFilters, DeletionMarks, NoCompactMarks, ObjectLock } from './block';
 import { SourceView } from './SourceView';
 import { BlockDetails } from './BlockDetails';
 import { BlockSearchInput } from './BlockSearchInput';
 import { BlockFilterCompaction } from './BlockFilterCompaction';
-import { sortBlocks, getBlockByUlid, getFilteredBlockPools } from './helpers';
+import { BlockFiltersForm } from './BlockFiltersForm';
+import { CompactionHealth } from './CompactionHealth';
+import { sortBlocks, getBlockByUlid, getFilteredBlockPools, blocksURL } from './helpers';
 import styles from './blocks.module.css';
 import TimeRange from './TimeRange';
 import Checkbox from '../../../components/Checkbox';
@@ -20,13 +22,32 @@ export interface BlockListProps {
   err: string | null;
   label: string;
   refreshedAt: string;
+  deletionMarks?: DeletionMarks;
+  noCompactMarks?: NoCompactMarks;
+  deletionMode?: string;
+  objectLock?: ObjectLock;
+  readWrite?: boolean;
 }
 
+export const ObjectLockAlert: FC<{ objectLock?: ObjectLock; deletionMode?: string }> = ({ objectLock, deletionMode }) => {
+  if (!objectLock?.enabled && deletionMode !== 'mark-only') {
+    return null;
+  }
+  const retention = [objectLock?.mode, objectLock?.validity].filter(Boolean).join(', ');
+  return (
+    <UncontrolledAlert color="info">
+      {objectLock?.enabled && `Object lock is enabled on the bucket${retention && ` (default retention: ${retention})`}. `}
+      {deletionMode === 'mark-only' &&
+        'Blocks are kept in the bucket with a tombstone instead of being deleted, their expiry is left to the lifecycle rules of the bucket.'}
+    </UncontrolledAlert>
+  );
+};
+
 export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
   const [selectedBlock, selectBlock] = useState<Block>();
   const [searchState, setSearchState] = useState<string>('');
 
-  const { blocks, label, err } = data;
+  const { blocks, label, err, deletionMarks, noCompactMarks, deletionMode, objectLock, readWrite } = data;
 
   const [gridMinTime, gridMaxTime] = useMemo(() => {
     if (!err && blocks.length > 0) {
@@ -120,6 +141,7 @@ export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
 
   return (
     <>
+      <ObjectLockAlert objectLock={objectLock} deletionMode={deletionMode} />
       {blocks.length > 0 ? (
         <>
           <BlockSearchInput
@@ -180,7 +202,13 @@ export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
                 onChange={setViewTime}
               />
             </div>
-            <BlockDetails selectBlock={selectBlock} block={selectedBlock} />
+            <BlockDetails
+              selectBlock={selectBlock}
+              block={selectedBlock}
+              deletionMark={selectedBlock && deletionMarks ? deletionMarks[selectedBlock.ulid] : undefined}
+              noCompactMark={selectedBlock && noCompactMarks ? noCompactMarks[selectedBlock.ulid] : undefined}
+              readWrite={readWrite}
+            />
           </div>
         </>
       ) : (
@@ -197,18 +225,27 @@ interface BlocksProps {
 }
 
 export const Blocks: FC<RouteComponentProps & PathPrefixProps & BlocksProps> = ({ pathPrefix = '', view = 'global' }) => {
-  const { response, error, isLoading } = useFetch<BlockListProps>(
-    `${pathPrefix}/api/v1/blocks${view ? '?view=' + view : ''}`
-  );
+  // The filters are applied by the blocks API, so that huge buckets don't send the metadata of all their blocks.
+  const [filters, setFilters] = useQueryParams({
+    matchers: withDefault(StringParam, ''),
+    resolution: withDefault(StringParam, ''),
+    level: withDefault(StringParam, ''),
+    marked: withDefault(StringParam, ''),
+  });
+  const { response, error, isLoading } = useFetch<BlockListProps>(blocksURL(pathPrefix, view, filters));
   const { status: responseStatus } = response;
   const badResponse = responseStatus !== 'success' && responseStatus !== 'start fetching';
 
   return (
-    <BlocksWithStatusIndicator
-      data={response.data}
-      error={badResponse ? new Error(responseStatus) : error}
-      isLoading={isLoading}
-    />
+    <>
+      {view === 'global' && <CompactionHealth pathPrefix={pathPrefix} />}
+      <BlockFiltersForm filters={filters} onSubmit={(filters: BlockFilters) => setFilters(filters)} />
+      <BlocksWithStatusIndicator
+        data={response.data}
+        error={badResponse ? new Error(responseStatus) : error}
+        isLoading={isLoading}
+      />
+    </>
   );
 };
 
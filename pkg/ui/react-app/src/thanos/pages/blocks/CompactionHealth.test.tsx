@@ -0,0 +1,45 @@
+import React from 'react';
+import { mount } from 'enzyme';
+import { Badge } from 'reactstrap';
+import { CompactionHealthTable, healthStatuses } from './CompactionHealth';
+import { GroupHealth } from './block';
+
+const health: GroupHealth = {
+  group: '0@17241709254077376921',
+  labels: { monitor: 'prometheus_one' },
+  resolution: 0,
+  update_time: 1600000000,
+  interval: 300,
+  last_successful_compaction_time: 1599999700,
+  pending_blocks: 2,
+  oldest_uncompacted_block_age: 7200,
+  stale: false,
+};
+
+describe('healthStatuses', () => {
+  it('returns OK for healthy groups', () => {
+    expect(healthStatuses(health)).toEqual([['OK', 'success']]);
+  });
+
+  it('returns the halted and stale statuses', () => {
+    expect(healthStatuses({ ...health, halted: true, error: 'critical error', stale: true })).toEqual([
+      ['HALTED', 'danger'],
+      ['STALE', 'secondary'],
+    ]);
+  });
+
+  it('returns the error status of groups not halted', () => {
+    expect(healthStatuses({ ...health, error: 'compaction failed' })).toEqual([['ERROR', 'warning']]);
+  });
+});
+
+describe('CompactionHealthTable', () => {
+  it('renders a row per group', () => {
+    const table = mount(<CompactionHealthTable healths={[health, { ...health, group: '300000@1', stale: true }]} />);
+    const rows = table.find('tbody tr');
+    expect(rows).toHaveLength(2);
+    expect(rows.at(0).find('td').at(1).text()).toBe('monitor="prometheus_one"');
+    expect(rows.at(0).find('td').at(5).text()).toBe('2');
+    expect(rows.at(1).find(Badge).text()).toBe('STALE');
+  });
+});
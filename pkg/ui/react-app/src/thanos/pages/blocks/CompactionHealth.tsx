@@ -0,0 +1,85 @@
+import React, { FC } from 'react';
+import { Badge, Table } from 'reactstrap';
+import { useFetch } from '../../../hooks/useFetch';
+import { humanizeDuration } from '../../../utils';
+import { GroupHealth } from './block';
+
+export const columns = [
+  'Group',
+  'Labels',
+  'Resolution',
+  'Updated',
+  'Last Successful Compaction',
+  'Pending Blocks',
+  'Oldest Uncompacted Block',
+  'Status',
+];
+
+// healthStatuses returns the statuses of the compaction group, with the colors of their badges.
+export const healthStatuses = (h: GroupHealth): [string, string][] => {
+  const statuses: [string, string][] = [];
+  if (h.halted) {
+    statuses.push(['HALTED', 'danger']);
+  } else if (h.error) {
+    statuses.push(['ERROR', 'warning']);
+  }
+  if (h.stale) {
+    statuses.push(['STALE', 'secondary']);
+  }
+  return statuses.length > 0 ? statuses : [['OK', 'success']];
+};
+
+const formatUnix = (seconds?: number): string => (seconds ? new Date(seconds * 1000).toISOString() : 'Never');
+
+export const CompactionHealthTable: FC<{ healths: GroupHealth[] }> = ({ healths }) => (
+  <Table size="sm" bordered hover>
+    <thead>
+      <tr>
+        {columns.map((column) => (
+          <th key={column}>{column}</th>
+        ))}
+      </tr>
+    </thead>
+    <tbody>
+      {healths.map((h) => (
+        <tr key={h.group}>
+          <td>{h.group}</td>
+          <td>
+            {Object.entries(h.labels || {})
+              .map(([name, value]) => `${name}="${value}"`)
+              .join(', ')}
+          </td>
+          <td>{h.resolution > 0 ? humanizeDuration(h.resolution) : 'raw'}</td>
+          <td>{formatUnix(h.update_time)}</td>
+          <td>{formatUnix(h.last_successful_compaction_time)}</td>
+          <td>{h.pending_blocks}</td>
+          <td>{h.pending_blocks > 0 ? humanizeDuration((h.oldest_uncompacted_block_age || 0) * 1000) : '-'}</td>
+          <td title={h.error}>
+            {healthStatuses(h).map(([status, color]) => (
+              <Badge key={status} color={color} className="mr-1">
+                {status}
+              </Badge>
+            ))}
+          </td>
+        </tr>
+      ))}
+    </tbody>
+  </Table>
+);
+
+// CompactionHealth shows the compaction health of the compaction groups of the bucket, if the compactor reports it.
+// Nothing is shown otherwise, the blocks being the main content of the page.
+export const CompactionHealth: FC<{ pathPrefix: string }> = ({ pathPrefix }) => {
+  const { response, error } = useFetch<GroupHealth[]>(`${pathPrefix}/api/v1/blocks/health`);
+  if (error || response.status !== 'success' || !Array.isArray(response.data) || response.data.length === 0) {
+    return null;
+  }
+  return (
+    <details>
+      <summary>Compaction health</summary>
+      <CompactionHealthTable healths={response.data} />
+    </details>
+  );
+};
+
+export default CompactionHealth;
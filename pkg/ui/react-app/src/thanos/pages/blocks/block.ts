@@ -26,6 +26,46 @@ export interface Block {
   version: number;
 }
 
+export interface DeletionMark {
+  id: string;
+  deletion_time: number;
+  version: number;
+  details?: string;
+  reason?: string;
+  source?: string;
+  group?: string;
+}
+
+export interface DeletionMarks {
+  [ulid: string]: DeletionMark;
+}
+
+export interface NoCompactMark {
+  id: string;
+  no_compact_time: number;
+  version: number;
+  details?: string;
+  reason?: string;
+}
+
+export interface NoCompactMarks {
+  [ulid: string]: NoCompactMark;
+}
+
+// BlockFilters are the filters of the blocks API, empty filters select all blocks.
+export interface BlockFilters {
+  matchers: string;
+  resolution: string;
+  level: string;
+  marked: string;
+}
+
+export interface ObjectLock {
+  enabled: boolean;
+  mode?: string;
+  validity?: string;
+}
+
 export interface LabelSet {
   [labelName: string]: string;
 }
@@ -33,3 +73,18 @@ export interface LabelSet {
 export interface BlocksPool {
   [key: string]: Block[][];
 }
+
+// GroupHealth is the compaction health of a compaction group, as reported by the compactor.
+export interface GroupHealth {
+  group: string;
+  labels: LabelSet;
+  resolution: number;
+  update_time: number;
+  interval?: number;
+  last_successful_compaction_time?: number;
+  pending_blocks: number;
+  oldest_uncompacted_block_age?: number;
+  halted?: boolean;
+  error?: string;
+  stale: boolean;
+}
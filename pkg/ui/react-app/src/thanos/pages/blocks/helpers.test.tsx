@@ -1,4 +1,4 @@
-import { sortBlocks, isOverlapping, getFilteredBlockPools } from './helpers';
+import { sortBlocks, isOverlapping, getFilteredBlockPools, blocksURL } from './helpers';
 
 // Number of blocks in data: 8.
 const overlapCaseData = {
@@ -656,3 +656,17 @@ describe('Filtered block pools', () => {
     expect(filteredBlockPoolArray[0].thanos.labels).toEqual(filteredBlocks[0].thanos.labels);
   });
 });
+
+describe('Blocks URL', () => {
+  const noFilters = { matchers: '', resolution: '', level: '', marked: '' };
+
+  it('should only have the view without filters', () => {
+    expect(blocksURL('', 'global', noFilters)).toEqual('/api/v1/blocks?view=global');
+    expect(blocksURL('/prefix', '', noFilters)).toEqual('/prefix/api/v1/blocks');
+  });
+  it('should have the parameters of the filters', () => {
+    expect(blocksURL('', 'global', { matchers: '{tenant="foo"}', resolution: '0', level: '4', marked: 'no-compact' })).toEqual(
+      '/api/v1/blocks?view=global&match%5B%5D=%7Btenant%3D%22foo%22%7D&resolution=0&level=4&marked=no-compact'
+    );
+  });
+});
@@ -1,4 +1,4 @@
-import { LabelSet, Block, BlocksPool } from './block';
+import { LabelSet, Block, BlocksPool, BlockFilters } from './block';
 import { Fuzzy, FuzzyResult } from '@nexucis/fuzzy';
 
 const stringify = (map: LabelSet): string => {
@@ -164,3 +164,24 @@ export const getFilteredBlockPools = (
   });
   return newblockPools;
 };
+
+export const blocksURL = (pathPrefix: string, view: string, filters: BlockFilters): string => {
+  const params = new URLSearchParams();
+  if (view) {
+    params.set('view', view);
+  }
+  if (filters.matchers) {
+    params.set('match[]', filters.matchers);
+  }
+  if (filters.resolution) {
+    params.set('resolution', filters.resolution);
+  }
+  if (filters.level) {
+    params.set('level', filters.level);
+  }
+  if (filters.marked) {
+    params.set('marked', filters.marked);
+  }
+  const query = params.toString();
+  return `${pathPrefix}/api/v1/blocks${query ? '?' + query : ''}`;
+};
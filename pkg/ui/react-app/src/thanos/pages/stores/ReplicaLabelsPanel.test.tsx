@@ -0,0 +1,44 @@
+import React from 'react';
+import { mount } from 'enzyme';
+import { Badge, Table } from 'reactstrap';
+import ReplicaLabelsPanel from './ReplicaLabelsPanel';
+
+describe('ReplicaLabelsPanel', () => {
+  const replicaLabelsPanel = mount(
+    <ReplicaLabelsPanel
+      replicaLabels={{
+        default: ['replica'],
+        tenants: [
+          { tenant: 'team-a', replicaLabels: ['pod_replica', 'rule_replica'] },
+          { tenant: 'team-b', replicaLabels: [] },
+        ],
+      }}
+    />
+  );
+
+  it('renders a table', () => {
+    const table = replicaLabelsPanel.find(Table);
+    expect(table).toHaveLength(1);
+    expect(table.find('tbody > tr')).toHaveLength(3);
+  });
+
+  it('renders the default replica labels first', () => {
+    const row = replicaLabelsPanel.find('tbody > tr').first();
+    expect(row.find('td').first().text()).toEqual('default');
+    expect(row.find(Badge).map((badge) => badge.text())).toEqual(['replica']);
+  });
+
+  it('renders the effective replica labels of each tenant', () => {
+    const rows = replicaLabelsPanel.find('tbody > tr');
+    expect(rows.at(1).find('td').first().text()).toEqual('team-a');
+    expect(
+      rows
+        .at(1)
+        .find(Badge)
+        .map((badge) => badge.text())
+    ).toEqual(['pod_replica', 'rule_replica']);
+    expect(rows.at(2).find('td').first().text()).toEqual('team-b');
+    expect(rows.at(2).find(Badge)).toHaveLength(0);
+    expect(rows.at(2).text()).toContain('No deduplication');
+  });
+});
@@ -0,0 +1,54 @@
+import React, { FC } from 'react';
+import { Badge, Container, Table } from 'reactstrap';
+import { ReplicaLabels } from './store';
+
+export type ReplicaLabelsPanelProps = { replicaLabels: ReplicaLabels };
+
+const LabelBadges: FC<{ labels: string[] }> = ({ labels }) =>
+  labels.length > 0 ? (
+    <>
+      {labels.map((label) => (
+        <Badge key={label} color="primary" style={{ margin: '0px 5px' }}>
+          {label}
+        </Badge>
+      ))}
+    </>
+  ) : (
+    <span>No deduplication</span>
+  );
+
+export const ReplicaLabelsPanel: FC<ReplicaLabelsPanelProps> = ({ replicaLabels }) => {
+  return (
+    <Container fluid>
+      <h3>Replica Labels</h3>
+      <Table size="sm" bordered hover>
+        <thead>
+          <tr key="header">
+            <th>Tenant</th>
+            <th>Effective Replica Labels</th>
+          </tr>
+        </thead>
+        <tbody>
+          <tr key="default">
+            <td>
+              <i>default</i>
+            </td>
+            <td>
+              <LabelBadges labels={replicaLabels.default} />
+            </td>
+          </tr>
+          {replicaLabels.tenants.map(({ tenant, replicaLabels }) => (
+            <tr key={tenant}>
+              <td>{tenant}</td>
+              <td>
+                <LabelBadges labels={replicaLabels} />
+              </td>
+            </tr>
+          ))}
+        </tbody>
+      </Table>
+    </Container>
+  );
+};
+
+export default ReplicaLabelsPanel;
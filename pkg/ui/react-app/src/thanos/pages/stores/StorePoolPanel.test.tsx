@@ -55,7 +55,7 @@ describe('StorePoolPanel', () => {
   describe('for each store', () => {
     const table = storePoolPanel.find(Table);
     defaultProps.storePool.forEach((store, idx) => {
-      const { name, minTime, maxTime, labelSets, lastCheck, lastError } = store;
+      const { name, minTime, maxTime, labelSets, lastCheck, lastError, capabilities } = store;
       const row = table.find('tr').at(idx + 1);
       const validMinTime = isValidTime(minTime);
       const validMaxTime = isValidTime(maxTime);
@@ -131,6 +131,15 @@ describe('StorePoolPanel', () => {
           expect(badge.children().text()).toEqual(lastError);
         }
       });
+
+      it('renders a badge for each capability', () => {
+        const td = row.find({ 'data-testid': 'capabilities' });
+        const badges = td.find(Badge);
+        expect(badges).toHaveLength(capabilities ? capabilities.length : 0);
+        badges.forEach((badge, i) => {
+          expect(badge.text()).toEqual(capabilities && capabilities[i]);
+        });
+      });
     });
   });
 });
@@ -20,6 +20,7 @@ export const columns = [
   'Max Time (UTC)',
   'Last Successful Health Check',
   'Last Message',
+  'Capabilities',
 ];
 
 export const storeTimeRangeMsg = (validMin: boolean, validMax: boolean): string => {
@@ -55,7 +56,7 @@ export const StorePoolPanel: FC<StorePoolPanelProps> = ({ title, storePool }) =>
           </thead>
           <tbody>
             {storePool.map((store: Store) => {
-              const { name, minTime, maxTime, labelSets, lastCheck, lastError } = store;
+              const { name, minTime, maxTime, labelSets, lastCheck, lastError, capabilities } = store;
               const health = lastError ? 'down' : 'up';
               const color = getColor(health);
               const validMinTime = isValidTime(minTime);
@@ -87,6 +88,13 @@ export const StorePoolPanel: FC<StorePoolPanelProps> = ({ title, storePool }) =>
                     ago
                   </td>
                   <td data-testid="lastError">{lastError ? <Badge color={color}>{lastError}</Badge> : null}</td>
+                  <td data-testid="capabilities">
+                    {(capabilities || []).map((capability: string) => (
+                      <Badge key={capability} color="primary" className="mr-1">
+                        {capability}
+                      </Badge>
+                    ))}
+                  </td>
                 </tr>
               );
             })}
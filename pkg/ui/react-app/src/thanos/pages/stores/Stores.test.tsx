@@ -26,6 +26,7 @@ describe('Stores', () => {
       });
       stores.update();
       expect(mock).toHaveBeenCalledWith('/api/v1/stores', { cache: 'no-store', credentials: 'same-origin' });
+      expect(mock).toHaveBeenCalledWith('/api/v1/stores/replica_labels', { cache: 'no-store', credentials: 'same-origin' });
 
       const panels = stores.find(StorePoolPanel);
       expect(panels).toHaveLength(2);
@@ -4,8 +4,9 @@ import { UncontrolledAlert } from 'reactstrap';
 import { withStatusIndicator } from '../../../components/withStatusIndicator';
 import { useFetch } from '../../../hooks/useFetch';
 import PathPrefixProps from '../../../types/PathPrefixProps';
-import { Store } from './store';
+import { ReplicaLabels, Store } from './store';
 import { StorePoolPanel } from './StorePoolPanel';
+import { ReplicaLabelsPanel } from './ReplicaLabelsPanel';
 
 export interface StoreListProps {
   [storeType: string]: Store[];
@@ -32,13 +33,19 @@ export const Stores: FC<RouteComponentProps & PathPrefixProps> = ({ pathPrefix =
   const { response, error, isLoading } = useFetch<StoreListProps>(`${pathPrefix}/api/v1/stores`);
   const { status: responseStatus } = response;
   const badResponse = responseStatus !== 'success' && responseStatus !== 'start fetching';
+  // The effective replica labels are informative only, so the page does not fail without them.
+  const { response: replicaLabelsResponse } = useFetch<ReplicaLabels>(`${pathPrefix}/api/v1/stores/replica_labels`);
+  const replicaLabels = replicaLabelsResponse.status === 'success' ? replicaLabelsResponse.data : undefined;
 
   return (
-    <StoresWithStatusIndicator
-      data={response.data}
-      error={badResponse ? new Error(responseStatus) : error}
-      isLoading={isLoading}
-    />
+    <>
+      {replicaLabels && Array.isArray(replicaLabels.default) && <ReplicaLabelsPanel replicaLabels={replicaLabels} />}
+      <StoresWithStatusIndicator
+        data={response.data}
+        error={badResponse ? new Error(responseStatus) : error}
+        isLoading={isLoading}
+      />
+    </>
   );
 };
 
@@ -18,6 +18,7 @@ export const sampleAPIResponse: { status: string; data: StoreListProps } = {
         maxTime: 9223372036854776000,
         minTime: -62167219200000,
         name: 'thanos_sidecar_one:10901',
+        capabilities: ['withoutReplicaLabels'],
       },
       {
         labelSets: [],
@@ -7,4 +7,15 @@ export interface Store {
   lastError: string | null;
   lastCheck: string;
   labelSets: Labels[];
+  capabilities?: string[] | null;
+}
+
+export interface TenantReplicaLabels {
+  tenant: string;
+  replicaLabels: string[];
+}
+
+export interface ReplicaLabels {
+  default: string[];
+  tenants: TenantReplicaLabels[];
 }
@@ -81,7 +81,7 @@ func BackupAndDelete(ctx Context, id ulid.ULID) error {
 	}
 
 	level.Info(ctx.Logger).Log("msg", "Marking block as deleted", "id", id.String())
-	if err := block.MarkForDeletion(ctx, ctx.Logger, ctx.Bkt, id, "manual verify-repair", ctx.metrics.blocksMarkedForDeletion); err != nil {
+	if err := block.MarkForDeletion(ctx, ctx.Logger, ctx.Bkt, id, metadata.RepairedDeletionReason, "manual verify-repair", ctx.metrics.blocksMarkedForDeletion); err != nil {
 		return errors.Wrap(err, "marking delete from source")
 	}
 	return nil
@@ -118,7 +118,7 @@ func BackupAndDeleteDownloaded(ctx Context, bdir string, id ulid.ULID) error {
 	}
 
 	level.Info(ctx.Logger).Log("msg", "Marking block as deleted", "id", id.String())
-	if err := block.MarkForDeletion(ctx, ctx.Logger, ctx.Bkt, id, "manual verify-repair", ctx.metrics.blocksMarkedForDeletion); err != nil {
+	if err := block.MarkForDeletion(ctx, ctx.Logger, ctx.Bkt, id, metadata.RepairedDeletionReason, "manual verify-repair", ctx.metrics.blocksMarkedForDeletion); err != nil {
 		return errors.Wrap(err, "marking delete from source")
 	}
 	return nil
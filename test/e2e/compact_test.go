@@ -406,7 +406,7 @@ func testCompactWithStoreGateway(t *testing.T, penaltyDedup bool) {
 		id, err = malformedBase.Create(ctx, dir, 0*time.Second, metadata.NoneFunc, 120)
 		testutil.Ok(t, err)
 		testutil.Ok(t, os.Remove(path.Join(dir, id.String(), metadata.MetaFilename)))
-		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, metadata.ManualDeletionReason, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
 		testutil.Ok(t, objstore.UploadDir(ctx, logger, bkt, path.Join(dir, id.String()), id.String()))
 
 		// Partial block after consistency delay.
@@ -419,7 +419,7 @@ func testCompactWithStoreGateway(t *testing.T, penaltyDedup bool) {
 		id, err = malformedBase.Create(ctx, dir, justAfterConsistencyDelay, metadata.NoneFunc, 120)
 		testutil.Ok(t, err)
 		testutil.Ok(t, os.Remove(path.Join(dir, id.String(), metadata.MetaFilename)))
-		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, metadata.ManualDeletionReason, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
 		testutil.Ok(t, objstore.UploadDir(ctx, logger, bkt, path.Join(dir, id.String()), id.String()))
 
 		// Partial block after consistency delay + old deletion mark ready to be deleted.
@@ -446,7 +446,7 @@ func testCompactWithStoreGateway(t *testing.T, penaltyDedup bool) {
 		id, err = malformedBase.Create(ctx, dir, 50*time.Hour, metadata.NoneFunc, 120)
 		testutil.Ok(t, err)
 		testutil.Ok(t, os.Remove(path.Join(dir, id.String(), metadata.MetaFilename)))
-		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+		testutil.Ok(t, block.MarkForDeletion(ctx, logger, bkt, id, metadata.ManualDeletionReason, "", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
 		testutil.Ok(t, objstore.UploadDir(ctx, logger, bkt, path.Join(dir, id.String()), id.String()))
 	}
 
@@ -369,6 +369,7 @@ type ReceiveBuilder struct {
 	hashringConfigs []receive.HashringConfig
 	relabelConfigs  []*relabel.Config
 	replication     int
+	mode            string
 	image           string
 }
 
@@ -406,6 +407,12 @@ func (r *ReceiveBuilder) WithRouting(replication int, hashringConfigs ...receive
 	return r
 }
 
+// WithMode sets the receiver mode explicitly, e.g. "router" or "ingestor".
+func (r *ReceiveBuilder) WithMode(mode string) *ReceiveBuilder {
+	r.mode = mode
+	return r
+}
+
 func (r *ReceiveBuilder) WithRelabelConfigs(relabelConfigs []*relabel.Config) *ReceiveBuilder {
 	r.relabelConfigs = relabelConfigs
 	return r
@@ -432,6 +439,10 @@ func (r *ReceiveBuilder) Init() e2e.InstrumentedRunnable {
 		"--tsdb.max-exemplars":   fmt.Sprintf("%v", r.maxExemplars),
 	}
 
+	if r.mode != "" {
+		args["--receive.mode"] = r.mode
+	}
+
 	hashring := r.hashringConfigs
 	if len(hashring) > 0 && r.ingestion {
 		args["--receive.local-endpoint"] = r.InternalEndpoint("grpc")
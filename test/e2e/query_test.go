@@ -337,6 +337,25 @@ func TestQueryLabelValues(t *testing.T) {
 			return len(res) == 0
 		},
 	)
+
+	// Values of external labels are filtered by matchers on both external and series labels.
+	labelValues(t, ctx, q.Endpoint("http"), "prometheus", []*labels.Matcher{{Type: labels.MatchEqual, Name: "replica", Value: "1234"}},
+		timestamp.FromTime(now.Add(-time.Hour)), timestamp.FromTime(now.Add(time.Hour)), func(res []string) bool {
+			return len(res) == 1 && res[0] == "prom-both-remote-write-and-sidecar"
+		},
+	)
+
+	labelValues(t, ctx, q.Endpoint("http"), "prometheus", []*labels.Matcher{{Type: labels.MatchEqual, Name: "__name__", Value: "foobar"}},
+		timestamp.FromTime(now.Add(-time.Hour)), timestamp.FromTime(now.Add(time.Hour)), func(res []string) bool {
+			return len(res) == 0
+		},
+	)
+
+	labelValues(t, ctx, q.Endpoint("http"), "prometheus", []*labels.Matcher{{Type: labels.MatchEqual, Name: "__name__", Value: "up"}},
+		timestamp.FromTime(now.Add(-24*time.Hour)), timestamp.FromTime(now.Add(-23*time.Hour)), func(res []string) bool {
+			return len(res) == 0
+		},
+	)
 }
 
 func TestQueryWithAuthorizedSidecar(t *testing.T) {
@@ -1348,6 +1367,9 @@ func TestGrpcInstantQuery(t *testing.T) {
 				if err == io.EOF {
 					break
 				}
+				if err != nil {
+					return err
+				}
 
 				s := msg.GetTimeseries()
 				if s != nil {
@@ -1458,6 +1480,9 @@ func TestGrpcQueryRange(t *testing.T) {
 			if err == io.EOF {
 				break
 			}
+			if err != nil {
+				return err
+			}
 
 			s := msg.GetTimeseries()
 			if s != nil {
@@ -1484,3 +1509,78 @@ func TestGrpcQueryRange(t *testing.T) {
 	})
 	testutil.Ok(t, err)
 }
+
+func TestGrpcQueryTwoLevels(t *testing.T) {
+	t.Parallel()
+
+	e, err := e2e.NewDockerEnvironment("e2e_test_query_grpc_api_two_levels")
+	testutil.Ok(t, err)
+	t.Cleanup(e2ethanos.CleanScenario(t, e))
+
+	prom1, sidecar1 := e2ethanos.NewPrometheusWithSidecar(e, "p1", e2ethanos.DefaultPromConfig("p1", 0, "", ""), "", e2ethanos.DefaultPrometheusImage(), "", "remote-write-receiver")
+	prom2, sidecar2 := e2ethanos.NewPrometheusWithSidecar(e, "p2", e2ethanos.DefaultPromConfig("p2", 0, "", ""), "", e2ethanos.DefaultPrometheusImage(), "", "remote-write-receiver")
+	testutil.Ok(t, e2e.StartAndWaitReady(prom1, sidecar1, prom2, sidecar2))
+
+	// Each leaf querier queries one Prometheus, and the root querier queries the leaf ones.
+	leaf1 := e2ethanos.NewQuerierBuilder(e, "leaf-1", sidecar1.InternalEndpoint("grpc")).Init()
+	leaf2 := e2ethanos.NewQuerierBuilder(e, "leaf-2", sidecar2.InternalEndpoint("grpc")).Init()
+	testutil.Ok(t, e2e.StartAndWaitReady(leaf1, leaf2))
+	root := e2ethanos.NewQuerierBuilder(e, "root", leaf1.InternalEndpoint("grpc"), leaf2.InternalEndpoint("grpc")).Init()
+	testutil.Ok(t, e2e.StartAndWaitReady(root))
+
+	now := time.Now()
+	ctx := context.Background()
+	testutil.Ok(t, synthesizeSamples(ctx, prom1, []fakeMetricSample{{label: "test", value: 1, timestampUnixNano: now.UnixNano()}}))
+	testutil.Ok(t, synthesizeSamples(ctx, prom2, []fakeMetricSample{{label: "test", value: 2, timestampUnixNano: now.UnixNano()}}))
+
+	grpcConn, err := grpc.Dial(root.Endpoint("grpc"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	testutil.Ok(t, err)
+	defer grpcConn.Close()
+	queryClient := querypb.NewQueryClient(grpcConn)
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(5*time.Second, ctx.Done(), func() error {
+		result, err := queryClient.Query(ctx, &querypb.QueryRequest{
+			Query:       "sum(my_fake_metric)",
+			TimeSeconds: now.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+
+		var (
+			series []*prompb_copy.TimeSeries
+			stats  *querypb.QueryStats
+		)
+		for {
+			msg, err := result.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if w := msg.GetWarnings(); w != "" {
+				return fmt.Errorf("got warnings %q, expected none", w)
+			}
+			if s := msg.GetTimeseries(); s != nil {
+				series = append(series, s)
+			}
+			if s := msg.GetStats(); s != nil {
+				stats = s
+			}
+		}
+
+		if len(series) != 1 || len(series[0].Samples) != 1 {
+			return fmt.Errorf("got unexpected result %v from root querier", series)
+		}
+		if series[0].Samples[0].Value != 3 {
+			return fmt.Errorf("got %v from root querier, expected the sum of both leaves", series[0].Samples[0].Value)
+		}
+		if stats == nil || stats.SamplesTotal != 2 {
+			return fmt.Errorf("got unexpected stats %v from root querier", stats)
+		}
+		return nil
+	}))
+}
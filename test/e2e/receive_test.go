@@ -132,10 +132,10 @@ func TestReceive(t *testing.T) {
 		i3 := e2ethanos.NewReceiveBuilder(e, "i3").WithIngestionEnabled().Init()
 
 		h := receive.HashringConfig{
-			Endpoints: []string{
-				i1.InternalEndpoint("grpc"),
-				i2.InternalEndpoint("grpc"),
-				i3.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: i1.InternalEndpoint("grpc")},
+				{Address: i2.InternalEndpoint("grpc")},
+				{Address: i3.InternalEndpoint("grpc")},
 			},
 		}
 
@@ -182,6 +182,86 @@ func TestReceive(t *testing.T) {
 		})
 	})
 
+	t.Run("router_ingestor_split", func(t *testing.T) {
+		/*
+			The router_ingestor_split suite runs an explicitly configured stateless routing tier in front of
+			stateful ingestors. One of the ingestors is down, yet the writes with triple replication
+			still reach the quorum on the remaining two ingestors.
+
+			  ┌───────┐                 ┌───────┐
+			  │       │                 │       │
+			  │ Prom1 │                 │ Prom2 │
+			  │       │                 │       │
+			  └───┬───┘                 └───┬───┘
+			  ┌───▼─────┐             ┌─────▼───┐
+			  │ Router1 │             │ Router2 │
+			  └───┬─────┘             └─────┬───┘
+			      ├──────────────┬──────────┤
+			┌─────▼─────┐  ┌─────▼─────┐  ┌─▼─────────┐
+			│           │  │           │  │           │
+			│ Ingestor1 │  │ Ingestor2 │  │ Ingestor3 │
+			│           │  │           │  │  (down)   │
+			└─────┬─────┘  └─────┬─────┘  └───────────┘
+			      │  ┌───────┐   │
+			      └──► Query ◄───┘
+			         └───────┘
+
+			NB: Made with asciiflow.com - you can copy & paste the above there to modify.
+		*/
+
+		t.Parallel()
+		e, err := e2e.NewDockerEnvironment("e2e_receive_router_ingestor_split")
+		testutil.Ok(t, err)
+		t.Cleanup(e2ethanos.CleanScenario(t, e))
+
+		// Setup 3 ingestors, the third one is never started.
+		i1 := e2ethanos.NewReceiveBuilder(e, "i1").WithIngestionEnabled().WithMode("ingestor").Init()
+		i2 := e2ethanos.NewReceiveBuilder(e, "i2").WithIngestionEnabled().WithMode("ingestor").Init()
+		i3 := e2ethanos.NewReceiveBuilder(e, "i3").WithIngestionEnabled().WithMode("ingestor")
+
+		h := receive.HashringConfig{
+			Endpoints: []receive.Endpoint{
+				{Address: i1.InternalEndpoint("grpc")},
+				{Address: i2.InternalEndpoint("grpc")},
+				{Address: i3.InternalEndpoint("grpc")},
+			},
+		}
+
+		// Setup 2 routers with triple replication.
+		r1 := e2ethanos.NewReceiveBuilder(e, "r1").WithRouting(3, h).WithMode("router").Init()
+		r2 := e2ethanos.NewReceiveBuilder(e, "r2").WithRouting(3, h).WithMode("router").Init()
+		testutil.Ok(t, e2e.StartAndWaitReady(i1, i2, r1, r2))
+
+		prom1 := e2ethanos.NewPrometheus(e, "1", e2ethanos.DefaultPromConfig("prom1", 0, e2ethanos.RemoteWriteEndpoint(r1.InternalEndpoint("remote-write")), "", e2ethanos.LocalPrometheusTarget), "", e2ethanos.DefaultPrometheusImage())
+		prom2 := e2ethanos.NewPrometheus(e, "2", e2ethanos.DefaultPromConfig("prom2", 0, e2ethanos.RemoteWriteEndpoint(r2.InternalEndpoint("remote-write")), "", e2ethanos.LocalPrometheusTarget), "", e2ethanos.DefaultPrometheusImage())
+		testutil.Ok(t, e2e.StartAndWaitReady(prom1, prom2))
+
+		q := e2ethanos.NewQuerierBuilder(e, "1", i1.InternalEndpoint("grpc"), i2.InternalEndpoint("grpc")).Init()
+		testutil.Ok(t, e2e.StartAndWaitReady(q))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		t.Cleanup(cancel)
+
+		testutil.Ok(t, q.WaitSumMetricsWithOptions(e2e.Equals(2), []string{"thanos_store_nodes_grpc_connections"}, e2e.WaitMissingMetrics()))
+
+		queryAndAssert(t, ctx, q.Endpoint("http"), func() string { return "count(up) by (prometheus)" }, time.Now, promclient.QueryOptions{
+			Deduplicate: false,
+		}, model.Vector{
+			&model.Sample{
+				Metric: model.Metric{
+					"prometheus": "prom1",
+				},
+				Value: model.SampleValue(2),
+			},
+			&model.Sample{
+				Metric: model.Metric{
+					"prometheus": "prom2",
+				},
+				Value: model.SampleValue(2),
+			},
+		})
+	})
+
 	t.Run("routing_tree", func(t *testing.T) {
 		/*
 			The routing_tree suite configures a valid and plausible, but non-trivial topology of receiver components.
@@ -232,15 +312,15 @@ func TestReceive(t *testing.T) {
 
 		// Setup distributors
 		r2 := e2ethanos.NewReceiveBuilder(e, "r2").WithRouting(2, receive.HashringConfig{
-			Endpoints: []string{
-				i2.InternalEndpoint("grpc"),
-				i3.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: i2.InternalEndpoint("grpc")},
+				{Address: i3.InternalEndpoint("grpc")},
 			},
 		}).Init()
 		r1 := e2ethanos.NewReceiveBuilder(e, "r1").WithRouting(2, receive.HashringConfig{
-			Endpoints: []string{
-				i1.InternalEndpoint("grpc"),
-				r2.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: i1.InternalEndpoint("grpc")},
+				{Address: r2.InternalEndpoint("grpc")},
 			},
 		}).Init()
 		testutil.Ok(t, e2e.StartAndWaitReady(i1, i2, i3, r1, r2))
@@ -326,10 +406,10 @@ func TestReceive(t *testing.T) {
 		r3 := e2ethanos.NewReceiveBuilder(e, "3").WithIngestionEnabled()
 
 		h := receive.HashringConfig{
-			Endpoints: []string{
-				r1.InternalEndpoint("grpc"),
-				r2.InternalEndpoint("grpc"),
-				r3.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: r1.InternalEndpoint("grpc")},
+				{Address: r2.InternalEndpoint("grpc")},
+				{Address: r3.InternalEndpoint("grpc")},
 			},
 		}
 
@@ -398,10 +478,10 @@ func TestReceive(t *testing.T) {
 		r3 := e2ethanos.NewReceiveBuilder(e, "3").WithIngestionEnabled()
 
 		h := receive.HashringConfig{
-			Endpoints: []string{
-				r1.InternalEndpoint("grpc"),
-				r2.InternalEndpoint("grpc"),
-				r3.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: r1.InternalEndpoint("grpc")},
+				{Address: r2.InternalEndpoint("grpc")},
+				{Address: r3.InternalEndpoint("grpc")},
 			},
 		}
 
@@ -465,10 +545,10 @@ func TestReceive(t *testing.T) {
 		r3 := e2ethanos.NewReceiveBuilder(e, "3").WithIngestionEnabled()
 
 		h := receive.HashringConfig{
-			Endpoints: []string{
-				r1.InternalEndpoint("grpc"),
-				r2.InternalEndpoint("grpc"),
-				r3.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: r1.InternalEndpoint("grpc")},
+				{Address: r2.InternalEndpoint("grpc")},
+				{Address: r3.InternalEndpoint("grpc")},
 			},
 		}
 
@@ -518,8 +598,8 @@ func TestReceive(t *testing.T) {
 		r1 := e2ethanos.NewReceiveBuilder(e, "1").WithIngestionEnabled()
 
 		h := receive.HashringConfig{
-			Endpoints: []string{
-				r1.InternalEndpoint("grpc"),
+			Endpoints: []receive.Endpoint{
+				{Address: r1.InternalEndpoint("grpc")},
 			},
 		}
 